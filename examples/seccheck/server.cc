@@ -125,6 +125,9 @@ std::vector<Callback> dispatchers = {
     unpackSyscall<::gvisor::syscall::InotifyRmWatch>,
     unpackSyscall<::gvisor::syscall::SocketPair>,
     unpackSyscall<::gvisor::syscall::Write>,
+    unpack<::gvisor::sentry::StraceInfo>,
+    unpackSyscall<::gvisor::syscall::Iopl>,
+    unpackSyscall<::gvisor::syscall::Ioperm>,
 };
 
 void unpack(absl::string_view buf) {
@@ -12,6 +12,7 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+#include <fcntl.h>
 #include <getopt.h>
 #include <linux/audit.h>
 #include <linux/filter.h>
@@ -24,7 +25,7 @@
 
 static int loops = 10000000;
 
-enum syscall_type { get_pid, get_pid_opt };
+enum syscall_type { get_pid, get_pid_opt, write_null };
 enum seccomp_policy { seccomp_none, seccomp_cacheable, seccomp_uncacheable };
 
 #ifdef __x86_64__
@@ -50,8 +51,9 @@ static void show_usage(const char *cmd) {
           "seccomp filter for this syscall\n"
           "\tOptions:\n"
           "\t%d) getpid\n"
-          "\t%d) getpidopt\n",
-          cmd, get_pid, get_pid_opt);
+          "\t%d) getpidopt\n"
+          "\t%d) write one byte to /dev/null\n",
+          cmd, get_pid, get_pid_opt, write_null);
 }
 
 static void set_cacheable_filter() {
@@ -180,6 +182,23 @@ int main(int argc, char *argv[]) {
     case (int)get_pid_opt:
       for (i = 0; i < loops; i++) do_getpidopt();
       break;
+    case (int)write_null: {
+      // A chatty I/O-bound thread: many small writes to the same file.
+      int fd = open("/dev/null", O_WRONLY);
+      if (fd < 0) {
+        fprintf(stderr, "open(/dev/null) failed\n");
+        exit(1);
+      }
+      char c = 0;
+      for (i = 0; i < loops; i++) {
+        if (write(fd, &c, 1) != 1) {
+          fprintf(stderr, "write(/dev/null) failed\n");
+          exit(1);
+        }
+      }
+      close(fd);
+      break;
+    }
     default:
       fprintf(stderr, "unknown syscall option: %d\n", sys_val);
       show_usage(argv[0]);
@@ -0,0 +1,96 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// ACCT_VERSION is the version of process accounting records, from
+// include/uapi/linux/acct.h.
+const ACCT_VERSION = 3
+
+// ACCT_COMM is the length of the command name in process accounting records,
+// from include/uapi/linux/acct.h.
+const ACCT_COMM = 16
+
+// AHZ is the frequency of the times in process accounting records, from
+// include/uapi/linux/acct.h.
+const AHZ = 100
+
+// Process accounting flags, from include/uapi/linux/acct.h.
+const (
+	AFORK = 0x01
+	ASU   = 0x02
+	ACORE = 0x08
+	AXSIG = 0x10
+)
+
+// AcctV3 is struct acct_v3, from include/uapi/linux/acct.h.
+//
+// Times and counts are comp_t values, encoded by EncodeCompT. ETime is a
+// float32.
+//
+// +marshal
+type AcctV3 struct {
+	Flag     uint8
+	Version  uint8
+	TTY      uint16
+	ExitCode uint32
+	UID      uint32
+	GID      uint32
+	PID      uint32
+	PPID     uint32
+	BTime    uint32
+	ETime    uint32
+	UTime    uint16
+	STime    uint16
+	Mem      uint16
+	IO       uint16
+	RW       uint16
+	MinFlt   uint16
+	MajFlt   uint16
+	Swaps    uint16
+	Comm     [ACCT_COMM]byte
+}
+
+// SizeOfAcctV3 is the size of AcctV3.
+const SizeOfAcctV3 = 64
+
+// EncodeCompT encodes v as a comp_t, a 13-bit mantissa and a base 8 exponent,
+// as encode_comp_t() in kernel/acct.c.
+func EncodeCompT(v uint64) uint16 {
+	const (
+		mantSize = 13
+		expSize  = 3
+		maxFract = 1<<mantSize - 1
+	)
+	exp := uint64(0)
+	rnd := uint64(0)
+	for v > maxFract {
+		// Round up?
+		rnd = v & (1 << (expSize - 1))
+		v >>= expSize
+		exp++
+	}
+	// If we need to round up, do it (and handle overflow correctly).
+	if rnd != 0 {
+		v++
+		if v > maxFract {
+			v >>= expSize
+			exp++
+		}
+	}
+	if exp > 1<<expSize-1 {
+		return ^uint16(0)
+	}
+	return uint16(exp<<mantSize + v)
+}
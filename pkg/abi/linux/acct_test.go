@@ -0,0 +1,47 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestAcctV3Size(t *testing.T) {
+	if calculated := uintptr(binary.Size(AcctV3{})); calculated != SizeOfAcctV3 {
+		t.Errorf("AcctV3 has a defined size of %d and calculated size of %d", SizeOfAcctV3, calculated)
+	}
+}
+
+func TestEncodeCompT(t *testing.T) {
+	for _, tc := range []struct {
+		v    uint64
+		want uint16
+	}{
+		{v: 0, want: 0},
+		{v: 8191, want: 8191},
+		// 8192 is 1024 * 8^1.
+		{v: 8192, want: 1<<13 | 1024},
+		// 8196 is rounded up to 1025 * 8^1.
+		{v: 8196, want: 1<<13 | 1025},
+		// 65535 is rounded up to 8192 * 8^1, which overflows the mantissa.
+		{v: 65535, want: 2<<13 | 1024},
+		{v: 1 << 40, want: ^uint16(0)},
+	} {
+		if got := EncodeCompT(tc.v); got != tc.want {
+			t.Errorf("EncodeCompT(%d) = %#x, want %#x", tc.v, got, tc.want)
+		}
+	}
+}
@@ -20,4 +20,187 @@ const (
 	AUDIT_ARCH_X86_64 = 0xc000003e
 	// AUDIT_ARCH_AARCH64 identifies ARM64.
 	AUDIT_ARCH_AARCH64 = 0xc00000b7
+	// AUDIT_ARCH_I386 identifies the 32-bit x86 (ia32) syscall API.
+	AUDIT_ARCH_I386 = 0x40000003
 )
+
+// Audit message types, from <uapi/linux/audit.h>.
+const (
+	AUDIT_GET         = 1000
+	AUDIT_SET         = 1001
+	AUDIT_LIST        = 1002
+	AUDIT_ADD         = 1003
+	AUDIT_DEL         = 1004
+	AUDIT_USER        = 1005
+	AUDIT_LOGIN       = 1006
+	AUDIT_SIGNAL_INFO = 1010
+	AUDIT_ADD_RULE    = 1011
+	AUDIT_DEL_RULE    = 1012
+	AUDIT_LIST_RULES  = 1013
+	AUDIT_TRIM        = 1014
+	AUDIT_MAKE_EQUIV  = 1015
+	AUDIT_TTY_GET     = 1016
+	AUDIT_TTY_SET     = 1017
+	AUDIT_SET_FEATURE = 1018
+	AUDIT_GET_FEATURE = 1019
+
+	AUDIT_FIRST_USER_MSG  = 1100
+	AUDIT_USER_AVC        = 1107
+	AUDIT_LAST_USER_MSG   = 1199
+	AUDIT_FIRST_USER_MSG2 = 2100
+	AUDIT_LAST_USER_MSG2  = 2999
+
+	AUDIT_DAEMON_START = 1200
+	AUDIT_DAEMON_END   = 1201
+
+	AUDIT_SYSCALL       = 1300
+	AUDIT_CONFIG_CHANGE = 1305
+	AUDIT_EOE           = 1320
+
+	AUDIT_AVC = 1400
+
+	AUDIT_KERNEL = 2000
+)
+
+// Masks for AuditStatus.Mask, from <uapi/linux/audit.h>.
+const (
+	AUDIT_STATUS_ENABLED       = 0x0001
+	AUDIT_STATUS_FAILURE       = 0x0002
+	AUDIT_STATUS_PID           = 0x0004
+	AUDIT_STATUS_RATE_LIMIT    = 0x0008
+	AUDIT_STATUS_BACKLOG_LIMIT = 0x0010
+)
+
+// Values for AuditStatus.Failure, from <uapi/linux/audit.h>.
+const (
+	AUDIT_FAIL_SILENT = 0
+	AUDIT_FAIL_PRINTK = 1
+	AUDIT_FAIL_PANIC  = 2
+)
+
+// Audit rule filter lists, from <uapi/linux/audit.h>.
+const (
+	AUDIT_FILTER_USER    = 0x00
+	AUDIT_FILTER_TASK    = 0x01
+	AUDIT_FILTER_ENTRY   = 0x02
+	AUDIT_FILTER_WATCH   = 0x03
+	AUDIT_FILTER_EXIT    = 0x04
+	AUDIT_FILTER_EXCLUDE = 0x05
+	AUDIT_FILTER_FS      = 0x06
+	AUDIT_NR_FILTERS     = 7
+)
+
+// Audit rule actions, from <uapi/linux/audit.h>.
+const (
+	AUDIT_NEVER    = 0
+	AUDIT_POSSIBLE = 1
+	AUDIT_ALWAYS   = 2
+)
+
+// AUDIT_MAX_FIELDS is the maximum number of fields in an audit rule.
+const AUDIT_MAX_FIELDS = 64
+
+// AUDIT_BITMASK_SIZE is the number of 32-bit words in an audit rule syscall
+// mask.
+const AUDIT_BITMASK_SIZE = 64
+
+// Audit rule field types, from <uapi/linux/audit.h>.
+const (
+	AUDIT_PID       = 0
+	AUDIT_UID       = 1
+	AUDIT_EUID      = 2
+	AUDIT_SUID      = 3
+	AUDIT_FSUID     = 4
+	AUDIT_GID       = 5
+	AUDIT_EGID      = 6
+	AUDIT_SGID      = 7
+	AUDIT_FSGID     = 8
+	AUDIT_LOGINUID  = 9
+	AUDIT_PERS      = 10
+	AUDIT_ARCH      = 11
+	AUDIT_MSGTYPE   = 12
+	AUDIT_PPID      = 18
+	AUDIT_EXIT      = 103
+	AUDIT_SUCCESS   = 104
+	AUDIT_ARG0      = 200
+	AUDIT_ARG1      = 201
+	AUDIT_ARG2      = 202
+	AUDIT_ARG3      = 203
+	AUDIT_FILTERKEY = 210
+)
+
+// Audit rule field operators, from <uapi/linux/audit.h>.
+const (
+	AUDIT_BIT_MASK              = 0x08000000
+	AUDIT_LESS_THAN             = 0x10000000
+	AUDIT_GREATER_THAN          = 0x20000000
+	AUDIT_NOT_EQUAL             = 0x30000000
+	AUDIT_EQUAL                 = 0x40000000
+	AUDIT_BIT_TEST              = AUDIT_BIT_MASK | AUDIT_EQUAL
+	AUDIT_LESS_THAN_OR_EQUAL    = AUDIT_LESS_THAN | AUDIT_EQUAL
+	AUDIT_GREATER_THAN_OR_EQUAL = AUDIT_GREATER_THAN | AUDIT_EQUAL
+	AUDIT_OPERATORS             = AUDIT_EQUAL | AUDIT_NOT_EQUAL | AUDIT_BIT_MASK
+)
+
+// AUDIT_MAX_KEY_LEN is the maximum length of an audit rule filter key.
+const AUDIT_MAX_KEY_LEN = 256
+
+// AuditStatus is struct audit_status, from <uapi/linux/audit.h>.
+//
+// +marshal
+type AuditStatus struct {
+	Mask                  uint32
+	Enabled               uint32
+	Failure               uint32
+	PID                   uint32
+	RateLimit             uint32
+	BacklogLimit          uint32
+	Lost                  uint32
+	Backlog               uint32
+	FeatureBitmap         uint32
+	BacklogWaitTime       uint32
+	BacklogWaitTimeActual uint32
+}
+
+// SizeOfAuditStatus is the size of AuditStatus.
+const SizeOfAuditStatus = 44
+
+// AuditRuleData is struct audit_rule_data, from <uapi/linux/audit.h>,
+// without the trailing variable-length buffer.
+//
+// +marshal
+type AuditRuleData struct {
+	Flags      uint32
+	Action     uint32
+	FieldCount uint32
+	Mask       [AUDIT_BITMASK_SIZE]uint32
+	Fields     [AUDIT_MAX_FIELDS]uint32
+	Values     [AUDIT_MAX_FIELDS]uint32
+	FieldFlags [AUDIT_MAX_FIELDS]uint32
+	BufLen     uint32
+}
+
+// SizeOfAuditRuleData is the size of AuditRuleData.
+const SizeOfAuditRuleData = 1040
+
+// AUDIT_FEATURE_VERSION is the version of the audit feature interface.
+const AUDIT_FEATURE_VERSION = 1
+
+// AuditFeatures is struct audit_features, from <uapi/linux/audit.h>.
+//
+// +marshal
+type AuditFeatures struct {
+	Vers     uint32
+	Mask     uint32
+	Features uint32
+	Lock     uint32
+}
+
+// AuditSigInfo is struct audit_sig_info, from <uapi/linux/audit.h>, without
+// the trailing security context.
+//
+// +marshal
+type AuditSigInfo struct {
+	UID uint32
+	PID int32
+}
@@ -49,10 +49,17 @@ const (
 
 	// Sizeof first published struct.
 	CLONE_ARGS_SIZE_VER0 = 64
+	// Sizeof second published struct, which added set_tid and set_tid_size.
+	CLONE_ARGS_SIZE_VER1 = 80
 	// Sizeof third published struct.
 	CLONE_ARGS_SIZE_VER2 = 88
 )
 
+// MAX_PID_NS_LEVEL is the maximum nesting depth of PID namespaces, and thus
+// the maximum length of clone_args.set_tid. From
+// include/linux/pid_namespace.h.
+const MAX_PID_NS_LEVEL = 32
+
 // CloneArgs is struct clone_args, from include/uapi/linux/sched.h.
 //
 // +marshal
@@ -46,6 +46,9 @@ const (
 	// TTYAUX_MAJOR is the major device number for alternate TTY devices.
 	TTYAUX_MAJOR = 5
 
+	// LOOP_MAJOR is the major device number for loop block devices.
+	LOOP_MAJOR = 7
+
 	// MISC_MAJOR is the major device number for non-serial mice, misc feature
 	// devices.
 	MISC_MAJOR = 10
@@ -65,6 +68,12 @@ const (
 	PTMX_MINOR = 2
 )
 
+// Minor device numbers for MISC_MAJOR.
+const (
+	// LOOP_CTRL_MINOR is the minor device number for /dev/loop-control.
+	LOOP_CTRL_MINOR = 237
+)
+
 // from Linux include/drm/drm_accel.h
 const (
 	// ACCEL_MAJOR is the major device number for compute accelerator devices.
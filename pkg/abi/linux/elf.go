@@ -127,6 +127,26 @@ type ElfHeader64 struct {
 	Shstrndx  uint16   // Section name strings section.
 }
 
+// ElfHeader32 is the ELF32 file header.
+//
+// +marshal
+type ElfHeader32 struct {
+	Ident     [16]byte // File identification.
+	Type      uint16   // File type.
+	Machine   uint16   // Machine architecture.
+	Version   uint32   // ELF format version.
+	Entry     uint32   // Entry point.
+	Phoff     uint32   // Program header file offset.
+	Shoff     uint32   // Section header file offset.
+	Flags     uint32   // Architecture-specific flags.
+	Ehsize    uint16   // Size of ELF header in bytes.
+	Phentsize uint16   // Size of program header entry.
+	Phnum     uint16   // Number of program header entries.
+	Shentsize uint16   // Size of section header entry.
+	Shnum     uint16   // Number of section header entries.
+	Shstrndx  uint16   // Section name strings section.
+}
+
 // ElfSection64 is the ELF64 Section header.
 //
 // +marshal
@@ -156,3 +176,17 @@ type ElfProg64 struct {
 	Memsz  uint64 // Size of contents in memory.
 	Align  uint64 // Alignment in memory and file.
 }
+
+// ElfProg32 is the ELF32 Program header.
+//
+// +marshal
+type ElfProg32 struct {
+	Type   uint32 // Entry type.
+	Off    uint32 // File offset of contents.
+	Vaddr  uint32 // Virtual address in memory image.
+	Paddr  uint32 // Physical address (not used).
+	Filesz uint32 // Size of contents in file.
+	Memsz  uint32 // Size of contents in memory.
+	Flags  uint32 // Access permission flags.
+	Align  uint32 // Alignment in memory and file.
+}
@@ -20,10 +20,11 @@ import (
 
 // Socket error origin codes as defined in include/uapi/linux/errqueue.h.
 const (
-	SO_EE_ORIGIN_NONE  = 0
-	SO_EE_ORIGIN_LOCAL = 1
-	SO_EE_ORIGIN_ICMP  = 2
-	SO_EE_ORIGIN_ICMP6 = 3
+	SO_EE_ORIGIN_NONE         = 0
+	SO_EE_ORIGIN_LOCAL        = 1
+	SO_EE_ORIGIN_ICMP         = 2
+	SO_EE_ORIGIN_ICMP6        = 3
+	SO_EE_ORIGIN_TIMESTAMPING = 4
 )
 
 // SockExtendedErr represents struct sock_extended_err in Linux defined in
@@ -101,6 +101,26 @@ const (
 	AT_EACCESS = 0x200
 )
 
+// Constants for name_to_handle_at(2) and open_by_handle_at(2).
+const (
+	AT_HANDLE_FID = 0x200
+	MAX_HANDLE_SZ = 128
+)
+
+// File handle types, from include/linux/exportfs.h.
+const (
+	FILEID_INO64_GEN = 0x81
+)
+
+// FileHandle is the fixed-size header of struct file_handle, which is
+// followed by HandleBytes bytes of the handle itself.
+//
+// +marshal
+type FileHandle struct {
+	HandleBytes uint32
+	HandleType  int32
+}
+
 // Constants for all file-related ...at(2) syscalls.
 const (
 	AT_FDCWD = -100
@@ -64,6 +64,33 @@ const (
 // FUTEX_BITSET_MATCH_ANY has all bits set.
 const FUTEX_BITSET_MATCH_ANY = 0xffffffff
 
+// Flags for struct futex_waitv, from <linux/futex.h>.
+const (
+	FUTEX2_SIZE_U8   = 0x00
+	FUTEX2_SIZE_U16  = 0x01
+	FUTEX2_SIZE_U32  = 0x02
+	FUTEX2_SIZE_U64  = 0x03
+	FUTEX2_SIZE_MASK = 0x03
+	FUTEX2_PRIVATE   = FUTEX_PRIVATE_FLAG
+
+	// FUTEX_32 is the only futex size supported by futex_waitv(2).
+	FUTEX_32 = FUTEX2_SIZE_U32
+)
+
+// FUTEX_WAITV_MAX is the maximum number of futexes that may be passed to
+// futex_waitv(2).
+const FUTEX_WAITV_MAX = 128
+
+// FutexWaitv corresponds to Linux's struct futex_waitv.
+//
+// +marshal slice:FutexWaitvSlice
+type FutexWaitv struct {
+	Val      uint64
+	Uaddr    uint64
+	Flags    uint32
+	Reserved uint32
+}
+
 // ROBUST_LIST_LIMIT protects against a deliberately circular list.
 const ROBUST_LIST_LIMIT = 2048
 
@@ -16,8 +16,13 @@ package linux
 
 // ioctl(2) request numbers from linux/if_tun.h
 var (
-	TUNSETIFF = IOW('T', 202, 4)
-	TUNGETIFF = IOR('T', 210, 4)
+	TUNSETIFF      = IOW('T', 202, 4)
+	TUNSETPERSIST  = IOW('T', 203, 4)
+	TUNSETOWNER    = IOW('T', 204, 4)
+	TUNSETGROUP    = IOW('T', 206, 4)
+	TUNGETFEATURES = IOR('T', 207, 4)
+	TUNGETIFF      = IOR('T', 210, 4)
+	TUNSETQUEUE    = IOW('T', 217, 4)
 )
 
 // Flags from net/if_tun.h
@@ -29,4 +34,9 @@ const (
 
 	// According to linux/if_tun.h "This flag has no real effect"
 	IFF_ONE_QUEUE = 0x2000
+
+	IFF_MULTI_QUEUE  = 0x0100
+	IFF_ATTACH_QUEUE = 0x0200
+	IFF_DETACH_QUEUE = 0x0400
+	IFF_PERSIST      = 0x0800
 )
@@ -60,8 +60,37 @@ const (
 
 // Constants for the IO_URING opcodes. See include/uapi/linux/io_uring.h.
 const (
-	IORING_OP_NOP   = 0
-	IORING_OP_READV = 1
+	IORING_OP_NOP         = 0
+	IORING_OP_READV       = 1
+	IORING_OP_WRITEV      = 2
+	IORING_OP_FSYNC       = 3
+	IORING_OP_READ_FIXED  = 4
+	IORING_OP_WRITE_FIXED = 5
+)
+
+// Constants for IOUringSqe.Flags. See include/uapi/linux/io_uring.h.
+const (
+	IOSQE_FIXED_FILE = (1 << 0)
+)
+
+// Constants for io_uring_register(2) opcodes. See
+// include/uapi/linux/io_uring.h.
+const (
+	IORING_REGISTER_BUFFERS   = 0
+	IORING_UNREGISTER_BUFFERS = 1
+	IORING_REGISTER_FILES     = 2
+	IORING_UNREGISTER_FILES   = 3
+)
+
+// Constants for io_uring_register(2) limits. See io_uring/rsrc.c and
+// io_uring/io_uring.h.
+const (
+	IORING_MAX_REG_BUFFERS = (1 << 14)
+	IORING_MAX_FIXED_FILES = (1 << 20)
+
+	// IORING_MAX_REG_BUFFER_SIZE is the maximum size of a single registered
+	// buffer, SZ_1G.
+	IORING_MAX_REG_BUFFER_SIZE = (1 << 30)
 )
 
 // IORingIndex represents SQE array indexes.
@@ -42,6 +42,7 @@ const (
 	IPPROTO_UDPLITE = 136
 	IPPROTO_MPLS    = 137
 	IPPROTO_RAW     = 255
+	IPPROTO_MPTCP   = 262
 )
 
 // Socket options from uapi/linux/in.h
@@ -103,6 +104,16 @@ const (
 	IP_PMTUDISC_OMIT      = 5
 )
 
+// IPV6_MTU_DISCOVER values from uapi/linux/in6.h
+const (
+	IPV6_PMTUDISC_DONT      = 0
+	IPV6_PMTUDISC_WANT      = 1
+	IPV6_PMTUDISC_DO        = 2
+	IPV6_PMTUDISC_PROBE     = 3
+	IPV6_PMTUDISC_INTERFACE = 4
+	IPV6_PMTUDISC_OMIT      = 5
+)
+
 // Socket options from uapi/linux/in6.h
 const (
 	IPV6_ADDRFORM         = 1
@@ -26,6 +26,7 @@ const (
 	MEMBARRIER_CMD_REGISTER_PRIVATE_EXPEDITED_SYNC_CORE = (1 << 6)
 	MEMBARRIER_CMD_PRIVATE_EXPEDITED_RSEQ               = (1 << 7)
 	MEMBARRIER_CMD_REGISTER_PRIVATE_EXPEDITED_RSEQ      = (1 << 8)
+	MEMBARRIER_CMD_GET_REGISTRATIONS                    = (1 << 9)
 )
 
 // membarrier(2) flags, from include/uapi/linux/membarrier.h.
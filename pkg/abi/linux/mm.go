@@ -67,6 +67,13 @@ const (
 	MCL_ONFAULT = 4
 )
 
+// Values for /proc/sys/vm/overcommit_memory, from include/linux/mman.h.
+const (
+	OVERCOMMIT_GUESS  = 0
+	OVERCOMMIT_ALWAYS = 1
+	OVERCOMMIT_NEVER  = 2
+)
+
 // Advice for madvise(2).
 const (
 	MADV_NORMAL       = 0
@@ -0,0 +1,61 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Socket options for SOL_MPTCP, from include/uapi/linux/mptcp.h.
+const (
+	MPTCP_INFO          = 1
+	MPTCP_TCPINFO       = 2
+	MPTCP_SUBFLOW_ADDRS = 3
+	MPTCP_FULL_INFO     = 4
+)
+
+// Flags for MPTCPInfo.Flags, from include/uapi/linux/mptcp.h.
+const (
+	MPTCP_INFO_FLAG_FALLBACK            = 1 << 0
+	MPTCP_INFO_FLAG_REMOTE_KEY_RECEIVED = 1 << 1
+)
+
+// MPTCPInfo is struct mptcp_info, from include/uapi/linux/mptcp.h.
+//
+// +marshal
+type MPTCPInfo struct {
+	Subflows           uint8
+	AddAddrSignal      uint8
+	AddAddrAccepted    uint8
+	SubflowsMax        uint8
+	AddAddrSignalMax   uint8
+	AddAddrAcceptedMax uint8
+	_                  [2]byte
+	Flags              uint32
+	Token              uint32
+	WriteSeq           uint64
+	SndUna             uint64
+	RcvNxt             uint64
+	LocalAddrUsed      uint8
+	LocalAddrMax       uint8
+	CsumEnabled        uint8
+	_                  uint8
+	Retransmits        uint32
+	BytesRetrans       uint64
+	BytesSent          uint64
+	BytesReceived      uint64
+	BytesAcked         uint64
+	SubflowsTotal      uint8
+	_                  [7]byte
+}
+
+// SizeOfMPTCPInfo is the size of MPTCPInfo.
+const SizeOfMPTCPInfo = 88
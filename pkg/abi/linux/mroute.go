@@ -0,0 +1,131 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+import (
+	"github.com/wilinz/gvisor/pkg/hostarch"
+)
+
+// IPv4 multicast routing socket options from uapi/linux/mroute.h. They are
+// set at level SOL_IP on raw IGMP sockets.
+const (
+	MRT_BASE          = 200
+	MRT_INIT          = MRT_BASE
+	MRT_DONE          = MRT_BASE + 1
+	MRT_ADD_VIF       = MRT_BASE + 2
+	MRT_DEL_VIF       = MRT_BASE + 3
+	MRT_ADD_MFC       = MRT_BASE + 4
+	MRT_DEL_MFC       = MRT_BASE + 5
+	MRT_VERSION       = MRT_BASE + 6
+	MRT_ASSERT        = MRT_BASE + 7
+	MRT_PIM           = MRT_BASE + 8
+	MRT_TABLE         = MRT_BASE + 9
+	MRT_ADD_MFC_PROXY = MRT_BASE + 10
+	MRT_DEL_MFC_PROXY = MRT_BASE + 11
+	MRT_FLUSH         = MRT_BASE + 12
+	MRT_MAX           = MRT_BASE + 12
+)
+
+// MRT_FLUSH flags from uapi/linux/mroute.h.
+const (
+	MRT_FLUSH_MFC         = 1
+	MRT_FLUSH_MFC_STATIC  = 2
+	MRT_FLUSH_VIFS        = 4
+	MRT_FLUSH_VIFS_STATIC = 8
+)
+
+// MRTVersion is the multicast routing API version returned by
+// getsockopt(MRT_VERSION).
+const MRTVersion = 0x0305
+
+// MAXVIFS is the maximum number of virtual interfaces, from
+// uapi/linux/mroute.h.
+const MAXVIFS = 32
+
+// Virtual interface flags, from uapi/linux/mroute.h.
+const (
+	VIFF_TUNNEL      = 0x1
+	VIFF_SRCRT       = 0x2
+	VIFF_REGISTER    = 0x4
+	VIFF_USE_IFINDEX = 0x8
+)
+
+// Types of messages sent to the multicast routing socket, from
+// uapi/linux/mroute.h.
+const (
+	IGMPMSG_NOCACHE    = 1
+	IGMPMSG_WRONGVIF   = 2
+	IGMPMSG_WHOLEPKT   = 3
+	IGMPMSG_WRVIFWHOLE = 4
+)
+
+// VIFCtl is struct vifctl, from uapi/linux/mroute.h.
+//
+// +marshal
+type VIFCtl struct {
+	VIFI      uint16
+	Flags     uint8
+	Threshold uint8
+	RateLimit uint32
+	// LclAddr is a union of the local address and, if Flags contains
+	// VIFF_USE_IFINDEX, the interface index.
+	LclAddr InetAddr
+	RmtAddr InetAddr
+}
+
+// SizeOfVIFCtl is the size of struct vifctl.
+const SizeOfVIFCtl = 16
+
+// LclIfindex returns the interface index stored in v.LclAddr.
+func (v *VIFCtl) LclIfindex() int32 {
+	return int32(hostarch.ByteOrder.Uint32(v.LclAddr[:]))
+}
+
+// MFCCtl is struct mfcctl, from uapi/linux/mroute.h.
+//
+// +marshal
+type MFCCtl struct {
+	Origin   InetAddr
+	McastGrp InetAddr
+	Parent   uint16
+	TTLs     [MAXVIFS]uint8
+	_        [2]byte
+	PktCnt   uint32
+	ByteCnt  uint32
+	WrongIf  uint32
+	Expire   int32
+}
+
+// SizeOfMFCCtl is the size of struct mfcctl.
+const SizeOfMFCCtl = 60
+
+// IGMPMsg is struct igmpmsg, from uapi/linux/mroute.h. It is read from the
+// multicast routing socket in place of an IPv4 header, with MBZ overlapping
+// the protocol field.
+//
+// +marshal
+type IGMPMsg struct {
+	Unused1 uint32
+	Unused2 uint32
+	MsgType uint8
+	MBZ     uint8
+	VIF     uint8
+	VIFHi   uint8
+	Src     InetAddr
+	Dst     InetAddr
+}
+
+// SizeOfIGMPMsg is the size of struct igmpmsg.
+const SizeOfIGMPMsg = 20
@@ -31,6 +31,20 @@ const (
 	NF_INET_LOCAL_OUT    = 3
 	NF_INET_POST_ROUTING = 4
 	NF_INET_NUMHOOKS     = 5
+
+	// NF_INET_INGRESS is only used by nftables.
+	NF_INET_INGRESS = NF_INET_NUMHOOKS
+)
+
+// Hooks of the netdev and ARP families. These correspond to values in
+// include/uapi/linux/netfilter.h and include/uapi/linux/netfilter_arp.h.
+const (
+	NF_NETDEV_INGRESS = 0
+	NF_NETDEV_EGRESS  = 1
+
+	NF_ARP_IN      = 0
+	NF_ARP_OUT     = 1
+	NF_ARP_FORWARD = 2
 )
 
 // Protocol families (address families). These correspond to values in
@@ -436,6 +450,41 @@ type XTNATTargetV2 struct {
 // SizeOfXTNATTargetV2 is the size of an XTNATTargetV2.
 const SizeOfXTNATTargetV2 = SizeOfXTEntryTarget + SizeOfNFNATRange2
 
+// XTTProxyTargetV0 redirects packets to a local socket for transparent
+// proxying when reached. It corresponds to struct xt_tproxy_target_info in
+// include/uapi/linux/netfilter/xt_TPROXY.h, preceded by the target header.
+//
+// +marshal
+type XTTProxyTargetV0 struct {
+	Target    XTEntryTarget
+	MarkMask  uint32
+	MarkValue uint32
+	LAddr     InetAddr
+	LPort     uint16
+	_         [2]byte
+}
+
+// SizeOfXTTProxyTargetV0 is the size of an XTTProxyTargetV0.
+const SizeOfXTTProxyTargetV0 = 48
+
+// XTTProxyTargetV1 is the revision 1 TPROXY target, which supports IPv6. It
+// corresponds to struct xt_tproxy_target_info_v1 in
+// include/uapi/linux/netfilter/xt_TPROXY.h, preceded by the target header.
+// Adding 4 bytes of padding to make the struct 8 byte aligned.
+//
+// +marshal
+type XTTProxyTargetV1 struct {
+	Target    XTEntryTarget
+	MarkMask  uint32
+	MarkValue uint32
+	LAddr     Inet6Addr
+	LPort     uint16
+	_         [6]byte
+}
+
+// SizeOfXTTProxyTargetV1 is the size of an XTTProxyTargetV1.
+const SizeOfXTTProxyTargetV1 = 64
+
 // IPTGetinfo is the argument for the IPT_SO_GET_INFO sockopt. It corresponds
 // to struct ipt_getinfo in include/uapi/linux/netfilter_ipv4/ip_tables.h.
 //
@@ -183,6 +183,16 @@ const (
 	VETH_INFO_PEER = 1
 )
 
+// VLAN link info data attributes, from uapi/linux/if_link.h.
+const (
+	IFLA_VLAN_UNSPEC      = 0
+	IFLA_VLAN_ID          = 1
+	IFLA_VLAN_FLAGS       = 2
+	IFLA_VLAN_EGRESS_QOS  = 3
+	IFLA_VLAN_INGRESS_QOS = 4
+	IFLA_VLAN_PROTOCOL    = 5
+)
+
 // InterfaceAddrMessage is struct ifaddrmsg, from uapi/linux/if_addr.h.
 //
 // +marshal
@@ -375,3 +385,161 @@ type RtAttr struct {
 
 // SizeOfRtAttr is the size of RtAttr.
 const SizeOfRtAttr = 4
+
+// FibRuleHdr is the header of RTM_NEWRULE, RTM_DELRULE and RTM_GETRULE
+// messages. From include/uapi/linux/fib_rules.h.
+//
+// +marshal
+type FibRuleHdr struct {
+	Family uint8
+	DstLen uint8
+	SrcLen uint8
+	TOS    uint8
+	Table  uint8
+	Res1   uint8
+	Res2   uint8
+	Action uint8
+	Flags  uint32
+}
+
+// SizeOfFibRuleHdr is the size of FibRuleHdr.
+const SizeOfFibRuleHdr = 12
+
+// Rule flags, from include/uapi/linux/fib_rules.h.
+const (
+	FIB_RULE_PERMANENT    = 0x1
+	FIB_RULE_INVERT       = 0x2
+	FIB_RULE_UNRESOLVED   = 0x4
+	FIB_RULE_IIF_DETACHED = 0x8
+	FIB_RULE_OIF_DETACHED = 0x10
+)
+
+// Rule attributes, from include/uapi/linux/fib_rules.h.
+const (
+	FRA_UNSPEC             = 0
+	FRA_DST                = 1
+	FRA_SRC                = 2
+	FRA_IIFNAME            = 3
+	FRA_GOTO               = 4
+	FRA_PRIORITY           = 6
+	FRA_FWMARK             = 10
+	FRA_FLOW               = 11
+	FRA_TUN_ID             = 12
+	FRA_SUPPRESS_IFGROUP   = 13
+	FRA_SUPPRESS_PREFIXLEN = 14
+	FRA_TABLE              = 15
+	FRA_FWMASK             = 16
+	FRA_OIFNAME            = 17
+	FRA_PAD                = 18
+	FRA_L3MDEV             = 19
+	FRA_UID_RANGE          = 20
+	FRA_PROTOCOL           = 21
+	FRA_IP_PROTO           = 22
+	FRA_SPORT_RANGE        = 23
+	FRA_DPORT_RANGE        = 24
+)
+
+// Rule actions, from include/uapi/linux/fib_rules.h.
+const (
+	FR_ACT_UNSPEC      = 0
+	FR_ACT_TO_TBL      = 1
+	FR_ACT_GOTO        = 2
+	FR_ACT_NOP         = 3
+	FR_ACT_BLACKHOLE   = 6
+	FR_ACT_UNREACHABLE = 7
+	FR_ACT_PROHIBIT    = 8
+)
+
+// TcMsg is the header of traffic control messages, such as RTM_NEWQDISC.
+// From include/uapi/linux/rtnetlink.h.
+//
+// +marshal
+type TcMsg struct {
+	Family  uint8
+	_       uint8
+	_       uint16
+	Ifindex int32
+	Handle  uint32
+	Parent  uint32
+	Info    uint32
+}
+
+// SizeOfTcMsg is the size of TcMsg.
+const SizeOfTcMsg = 20
+
+// Traffic control attributes, from include/uapi/linux/rtnetlink.h.
+const (
+	TCA_UNSPEC         = 0
+	TCA_KIND           = 1
+	TCA_OPTIONS        = 2
+	TCA_STATS          = 3
+	TCA_XSTATS         = 4
+	TCA_RATE           = 5
+	TCA_FCNT           = 6
+	TCA_STATS2         = 7
+	TCA_STAB           = 8
+	TCA_PAD            = 9
+	TCA_DUMP_INVISIBLE = 10
+	TCA_CHAIN          = 11
+	TCA_HW_OFFLOAD     = 12
+	TCA_INGRESS_BLOCK  = 13
+	TCA_EGRESS_BLOCK   = 14
+	TCA_DUMP_FLAGS     = 15
+	TCA_EXT_WARN_MSG   = 16
+)
+
+// NdMsg is the header of neighbor messages, such as RTM_NEWNEIGH. From
+// include/uapi/linux/neighbour.h.
+//
+// +marshal
+type NdMsg struct {
+	Family  uint8
+	_       uint8
+	_       uint16
+	Ifindex int32
+	State   uint16
+	Flags   uint8
+	Type    uint8
+}
+
+// SizeOfNdMsg is the size of NdMsg.
+const SizeOfNdMsg = 12
+
+// Neighbor attributes, from include/uapi/linux/neighbour.h.
+const (
+	NDA_UNSPEC    = 0
+	NDA_DST       = 1
+	NDA_LLADDR    = 2
+	NDA_CACHEINFO = 3
+	NDA_PROBES    = 4
+	NDA_VLAN      = 5
+	NDA_PORT      = 6
+	NDA_VNI       = 7
+	NDA_IFINDEX   = 8
+	NDA_MASTER    = 9
+)
+
+// Neighbor flags, from include/uapi/linux/neighbour.h.
+const (
+	NTF_USE         = 0x01
+	NTF_SELF        = 0x02
+	NTF_MASTER      = 0x04
+	NTF_PROXY       = 0x08
+	NTF_EXT_LEARNED = 0x10
+	NTF_OFFLOADED   = 0x20
+	NTF_STICKY      = 0x40
+	NTF_ROUTER      = 0x80
+)
+
+// Neighbor states, from include/uapi/linux/neighbour.h.
+const (
+	NUD_INCOMPLETE = 0x01
+	NUD_REACHABLE  = 0x02
+	NUD_STALE      = 0x04
+	NUD_DELAY      = 0x08
+	NUD_PROBE      = 0x10
+	NUD_FAILED     = 0x20
+	NUD_NOARP      = 0x40
+	NUD_PERMANENT  = 0x80
+	NUD_NONE       = 0x00
+)
@@ -207,3 +207,224 @@ const (
 	NFT_META_SDIFNAME             // Slave device interface name
 	NFT_META_BRI_BROUTE           // Packet br_netfilter_broute bit
 )
+
+// The constants below are used to encode and decode nftables netlink
+// messages. They correspond to enum values in
+// include/uapi/linux/netfilter/nf_tables.h.
+
+// Nf tables message types, used with the NFNL_SUBSYS_NFTABLES subsystem.
+const (
+	NFT_MSG_NEWTABLE = iota
+	NFT_MSG_GETTABLE
+	NFT_MSG_DELTABLE
+	NFT_MSG_NEWCHAIN
+	NFT_MSG_GETCHAIN
+	NFT_MSG_DELCHAIN
+	NFT_MSG_NEWRULE
+	NFT_MSG_GETRULE
+	NFT_MSG_DELRULE
+	NFT_MSG_NEWSET
+	NFT_MSG_GETSET
+	NFT_MSG_DELSET
+	NFT_MSG_NEWSETELEM
+	NFT_MSG_GETSETELEM
+	NFT_MSG_DELSETELEM
+	NFT_MSG_NEWGEN
+	NFT_MSG_GETGEN
+	NFT_MSG_TRACE
+	NFT_MSG_NEWOBJ
+	NFT_MSG_GETOBJ
+	NFT_MSG_DELOBJ
+	NFT_MSG_GETOBJ_RESET
+	NFT_MSG_NEWFLOWTABLE
+	NFT_MSG_GETFLOWTABLE
+	NFT_MSG_DELFLOWTABLE
+	NFT_MSG_GETRULE_RESET
+	NFT_MSG_DESTROYTABLE
+	NFT_MSG_DESTROYCHAIN
+	NFT_MSG_DESTROYRULE
+	NFT_MSG_DESTROYSET
+	NFT_MSG_DESTROYSETELEM
+	NFT_MSG_DESTROYOBJ
+	NFT_MSG_DESTROYFLOWTABLE
+	NFT_MSG_GETSETELEM_RESET
+	NFT_MSG_MAX
+)
+
+// Nf table flags.
+const (
+	NFT_TABLE_F_DORMANT = 0x1
+	NFT_TABLE_F_OWNER   = 0x2
+)
+
+// Nf table attributes.
+const (
+	NFTA_TABLE_UNSPEC = iota
+	NFTA_TABLE_NAME
+	NFTA_TABLE_FLAGS
+	NFTA_TABLE_USE
+	NFTA_TABLE_HANDLE
+	NFTA_TABLE_PAD
+	NFTA_TABLE_USERDATA
+	NFTA_TABLE_OWNER
+)
+
+// Nf table chain attributes.
+const (
+	NFTA_CHAIN_UNSPEC = iota
+	NFTA_CHAIN_TABLE
+	NFTA_CHAIN_HANDLE
+	NFTA_CHAIN_NAME
+	NFTA_CHAIN_HOOK
+	NFTA_CHAIN_POLICY
+	NFTA_CHAIN_USE
+	NFTA_CHAIN_TYPE
+	NFTA_CHAIN_COUNTERS
+	NFTA_CHAIN_PAD
+	NFTA_CHAIN_FLAGS
+	NFTA_CHAIN_ID
+	NFTA_CHAIN_USERDATA
+)
+
+// Nf table chain hook attributes.
+const (
+	NFTA_HOOK_UNSPEC = iota
+	NFTA_HOOK_HOOKNUM
+	NFTA_HOOK_PRIORITY
+	NFTA_HOOK_DEV
+	NFTA_HOOK_DEVS
+)
+
+// Nf table rule attributes.
+const (
+	NFTA_RULE_UNSPEC = iota
+	NFTA_RULE_TABLE
+	NFTA_RULE_CHAIN
+	NFTA_RULE_HANDLE
+	NFTA_RULE_EXPRESSIONS
+	NFTA_RULE_COMPAT
+	NFTA_RULE_POSITION
+	NFTA_RULE_USERDATA
+	NFTA_RULE_PAD
+	NFTA_RULE_ID
+	NFTA_RULE_POSITION_ID
+	NFTA_RULE_CHAIN_ID
+)
+
+// Nf table list attributes.
+const (
+	NFTA_LIST_UNSPEC = iota
+	NFTA_LIST_ELEM
+)
+
+// Nf table expression attributes.
+const (
+	NFTA_EXPR_UNSPEC = iota
+	NFTA_EXPR_NAME
+	NFTA_EXPR_DATA
+)
+
+// Nf table data attributes.
+const (
+	NFTA_DATA_UNSPEC = iota
+	NFTA_DATA_VALUE
+	NFTA_DATA_VERDICT
+)
+
+// Nf table verdict attributes.
+const (
+	NFTA_VERDICT_UNSPEC = iota
+	NFTA_VERDICT_CODE
+	NFTA_VERDICT_CHAIN
+	NFTA_VERDICT_CHAIN_ID
+)
+
+// Nf table immediate expression attributes.
+const (
+	NFTA_IMMEDIATE_UNSPEC = iota
+	NFTA_IMMEDIATE_DREG
+	NFTA_IMMEDIATE_DATA
+)
+
+// Nf table comparison expression attributes.
+const (
+	NFTA_CMP_UNSPEC = iota
+	NFTA_CMP_SREG
+	NFTA_CMP_OP
+	NFTA_CMP_DATA
+)
+
+// Nf table range expression attributes.
+const (
+	NFTA_RANGE_UNSPEC = iota
+	NFTA_RANGE_SREG
+	NFTA_RANGE_OP
+	NFTA_RANGE_FROM_DATA
+	NFTA_RANGE_TO_DATA
+)
+
+// Nf table payload expression attributes.
+const (
+	NFTA_PAYLOAD_UNSPEC = iota
+	NFTA_PAYLOAD_DREG
+	NFTA_PAYLOAD_BASE
+	NFTA_PAYLOAD_OFFSET
+	NFTA_PAYLOAD_LEN
+	NFTA_PAYLOAD_SREG
+	NFTA_PAYLOAD_CSUM_TYPE
+	NFTA_PAYLOAD_CSUM_OFFSET
+	NFTA_PAYLOAD_CSUM_FLAGS
+)
+
+// Nf table bitwise expression attributes.
+const (
+	NFTA_BITWISE_UNSPEC = iota
+	NFTA_BITWISE_SREG
+	NFTA_BITWISE_DREG
+	NFTA_BITWISE_LEN
+	NFTA_BITWISE_MASK
+	NFTA_BITWISE_XOR
+	NFTA_BITWISE_OP
+	NFTA_BITWISE_DATA
+)
+
+// Nf table byteorder expression attributes.
+const (
+	NFTA_BYTEORDER_UNSPEC = iota
+	NFTA_BYTEORDER_SREG
+	NFTA_BYTEORDER_DREG
+	NFTA_BYTEORDER_OP
+	NFTA_BYTEORDER_LEN
+	NFTA_BYTEORDER_SIZE
+)
+
+// Nf table meta expression attributes.
+const (
+	NFTA_META_UNSPEC = iota
+	NFTA_META_DREG
+	NFTA_META_KEY
+	NFTA_META_SREG
+)
+
+// Nf table counter expression attributes.
+const (
+	NFTA_COUNTER_UNSPEC = iota
+	NFTA_COUNTER_BYTES
+	NFTA_COUNTER_PACKETS
+	NFTA_COUNTER_PAD
+)
+
+// Nf table generation attributes.
+const (
+	NFTA_GEN_UNSPEC = iota
+	NFTA_GEN_ID
+	NFTA_GEN_PROC_PID
+	NFTA_GEN_PROC_NAME
+)
+
+// Nf table route expression attributes.
+const (
+	NFTA_RT_UNSPEC = iota
+	NFTA_RT_DREG
+	NFTA_RT_KEY
+)
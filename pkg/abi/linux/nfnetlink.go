@@ -0,0 +1,72 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Netfilter netlink subsystem IDs, from uapi/linux/netfilter/nfnetlink.h.
+//
+// The subsystem ID is the upper byte of the netlink message type.
+const (
+	NFNL_SUBSYS_NONE              = 0
+	NFNL_SUBSYS_CTNETLINK         = 1
+	NFNL_SUBSYS_CTNETLINK_EXP     = 2
+	NFNL_SUBSYS_QUEUE             = 3
+	NFNL_SUBSYS_ULOG              = 4
+	NFNL_SUBSYS_OSF               = 5
+	NFNL_SUBSYS_IPSET             = 6
+	NFNL_SUBSYS_ACCT              = 7
+	NFNL_SUBSYS_CTNETLINK_TIMEOUT = 8
+	NFNL_SUBSYS_CTHELPER          = 9
+	NFNL_SUBSYS_NFTABLES          = 10
+	NFNL_SUBSYS_NFT_COMPAT        = 11
+	NFNL_SUBSYS_HOOK              = 12
+	NFNL_SUBSYS_COUNT             = 13
+)
+
+// Netfilter netlink batch message types, from
+// uapi/linux/netfilter/nfnetlink.h.
+const (
+	NFNL_MSG_BATCH_BEGIN = NLMSG_MIN_TYPE
+	NFNL_MSG_BATCH_END   = NLMSG_MIN_TYPE + 1
+)
+
+// NFNETLINK_V0 is the netfilter netlink protocol version, from
+// uapi/linux/netfilter/nfnetlink.h.
+const NFNETLINK_V0 = 0
+
+// NFNL_SUBSYS_ID returns the subsystem ID of a netfilter netlink message type.
+func NFNL_SUBSYS_ID(typ uint16) uint16 {
+	return typ >> 8
+}
+
+// NFNL_MSG_TYPE returns the message type within its subsystem of a netfilter
+// netlink message type.
+func NFNL_MSG_TYPE(typ uint16) uint16 {
+	return typ & 0xff
+}
+
+// NetFilterGenMsg is struct nfgenmsg, from uapi/linux/netfilter/nfnetlink.h.
+// It follows the header of all netfilter netlink messages.
+//
+// +marshal
+type NetFilterGenMsg struct {
+	Family  uint8
+	Version uint8
+
+	// ResourceID is in network byte order.
+	ResourceID uint16
+}
+
+// NetFilterGenMsgSize is the size of NetFilterGenMsg.
+const NetFilterGenMsgSize = 4
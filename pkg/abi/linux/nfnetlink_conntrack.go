@@ -0,0 +1,151 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Conntrack netlink message types, used with the NFNL_SUBSYS_CTNETLINK
+// subsystem. These correspond to enum cntl_msg_types in
+// include/uapi/linux/netfilter/nfnetlink_conntrack.h.
+const (
+	IPCTNL_MSG_CT_NEW = iota
+	IPCTNL_MSG_CT_GET
+	IPCTNL_MSG_CT_DELETE
+	IPCTNL_MSG_CT_GET_CTRZERO
+	IPCTNL_MSG_CT_GET_STATS_CPU
+	IPCTNL_MSG_CT_GET_STATS
+	IPCTNL_MSG_CT_GET_DYING
+	IPCTNL_MSG_CT_GET_UNCONFIRMED
+)
+
+// Conntrack attributes. These correspond to enum ctattr_type in
+// include/uapi/linux/netfilter/nfnetlink_conntrack.h.
+const (
+	CTA_UNSPEC = iota
+	CTA_TUPLE_ORIG
+	CTA_TUPLE_REPLY
+	CTA_STATUS
+	CTA_PROTOINFO
+	CTA_HELP
+	CTA_NAT_SRC
+	CTA_TIMEOUT
+	CTA_MARK
+	CTA_COUNTERS_ORIG
+	CTA_COUNTERS_REPLY
+	CTA_USE
+	CTA_ID
+	CTA_NAT_DST
+	CTA_TUPLE_MASTER
+	CTA_SEQ_ADJ_ORIG
+	CTA_SEQ_ADJ_REPLY
+	CTA_SECMARK
+	CTA_ZONE
+	CTA_SECCTX
+	CTA_TIMESTAMP
+	CTA_MARK_MASK
+	CTA_LABELS
+	CTA_LABELS_MASK
+	CTA_SYNPROXY
+	CTA_FILTER
+	CTA_STATUS_MASK
+)
+
+// Conntrack tuple attributes. These correspond to enum ctattr_tuple in
+// include/uapi/linux/netfilter/nfnetlink_conntrack.h.
+const (
+	CTA_TUPLE_UNSPEC = iota
+	CTA_TUPLE_IP
+	CTA_TUPLE_PROTO
+	CTA_TUPLE_ZONE
+)
+
+// Conntrack tuple address attributes. These correspond to enum ctattr_ip in
+// include/uapi/linux/netfilter/nfnetlink_conntrack.h.
+const (
+	CTA_IP_UNSPEC = iota
+	CTA_IP_V4_SRC
+	CTA_IP_V4_DST
+	CTA_IP_V6_SRC
+	CTA_IP_V6_DST
+)
+
+// Conntrack tuple protocol attributes. These correspond to enum ctattr_l4proto
+// in include/uapi/linux/netfilter/nfnetlink_conntrack.h.
+const (
+	CTA_PROTO_UNSPEC = iota
+	CTA_PROTO_NUM
+	CTA_PROTO_SRC_PORT
+	CTA_PROTO_DST_PORT
+	CTA_PROTO_ICMP_ID
+	CTA_PROTO_ICMP_TYPE
+	CTA_PROTO_ICMP_CODE
+	CTA_PROTO_ICMPV6_ID
+	CTA_PROTO_ICMPV6_TYPE
+	CTA_PROTO_ICMPV6_CODE
+)
+
+// Conntrack protocol information attributes. These correspond to enum
+// ctattr_protoinfo in include/uapi/linux/netfilter/nfnetlink_conntrack.h.
+const (
+	CTA_PROTOINFO_UNSPEC = iota
+	CTA_PROTOINFO_TCP
+	CTA_PROTOINFO_DCCP
+	CTA_PROTOINFO_SCTP
+)
+
+// Conntrack TCP information attributes. These correspond to enum
+// ctattr_protoinfo_tcp in include/uapi/linux/netfilter/nfnetlink_conntrack.h.
+const (
+	CTA_PROTOINFO_TCP_UNSPEC = iota
+	CTA_PROTOINFO_TCP_STATE
+	CTA_PROTOINFO_TCP_WSCALE_ORIGINAL
+	CTA_PROTOINFO_TCP_WSCALE_REPLY
+	CTA_PROTOINFO_TCP_FLAGS_ORIGINAL
+	CTA_PROTOINFO_TCP_FLAGS_REPLY
+)
+
+// Conntrack counter attributes. These correspond to enum ctattr_counters in
+// include/uapi/linux/netfilter/nfnetlink_conntrack.h.
+const (
+	CTA_COUNTERS_UNSPEC = iota
+	CTA_COUNTERS_PACKETS
+	CTA_COUNTERS_BYTES
+	CTA_COUNTERS32_PACKETS
+	CTA_COUNTERS32_BYTES
+	CTA_COUNTERS_PAD
+)
+
+// Conntrack status bits, from enum ip_conntrack_status in
+// include/uapi/linux/netfilter/nf_conntrack_common.h.
+const (
+	IPS_EXPECTED   = 1 << 0
+	IPS_SEEN_REPLY = 1 << 1
+	IPS_ASSURED    = 1 << 2
+	IPS_CONFIRMED  = 1 << 3
+	IPS_SRC_NAT    = 1 << 4
+	IPS_DST_NAT    = 1 << 5
+)
+
+// Conntrack TCP states, from enum tcp_conntrack in
+// include/uapi/linux/netfilter/nf_conntrack_tcp.h.
+const (
+	TCP_CONNTRACK_NONE = iota
+	TCP_CONNTRACK_SYN_SENT
+	TCP_CONNTRACK_SYN_RECV
+	TCP_CONNTRACK_ESTABLISHED
+	TCP_CONNTRACK_FIN_WAIT
+	TCP_CONNTRACK_CLOSE_WAIT
+	TCP_CONNTRACK_LAST_ACK
+	TCP_CONNTRACK_TIME_WAIT
+	TCP_CONNTRACK_CLOSE
+)
@@ -0,0 +1,90 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Traffic control handles, from include/uapi/linux/pkt_sched.h.
+const (
+	TC_H_MAJ_MASK = 0xFFFF0000
+	TC_H_MIN_MASK = 0x0000FFFF
+	TC_H_UNSPEC   = 0
+	TC_H_ROOT     = 0xFFFFFFFF
+	TC_H_INGRESS  = 0xFFFFFFF1
+	TC_H_CLSACT   = TC_H_INGRESS
+)
+
+// PSCHED_SHIFT is log2 of the duration of a packet scheduler tick, in
+// nanoseconds. Traffic control messages express times in ticks. From
+// include/net/pkt_sched.h.
+const PSCHED_SHIFT = 6
+
+// Link layers of rate specifications, from include/uapi/linux/pkt_sched.h.
+const (
+	TC_LINKLAYER_UNAWARE  = 0
+	TC_LINKLAYER_ETHERNET = 1
+	TC_LINKLAYER_ATM      = 2
+)
+
+// TcRateSpec is struct tc_ratespec, from include/uapi/linux/pkt_sched.h.
+//
+// +marshal
+type TcRateSpec struct {
+	CellLog   uint8
+	Linklayer uint8
+	Overhead  uint16
+	CellAlign int16
+	Mpu       uint16
+	Rate      uint32
+}
+
+// TcTbfQopt is struct tc_tbf_qopt, from include/uapi/linux/pkt_sched.h.
+//
+// +marshal
+type TcTbfQopt struct {
+	Rate     TcRateSpec
+	Peakrate TcRateSpec
+	Limit    uint32
+	Buffer   uint32
+	Mtu      uint32
+}
+
+// SizeOfTcTbfQopt is the size of TcTbfQopt.
+const SizeOfTcTbfQopt = 36
+
+// TBF attributes, from include/uapi/linux/pkt_sched.h.
+const (
+	TCA_TBF_UNSPEC  = 0
+	TCA_TBF_PARMS   = 1
+	TCA_TBF_RTAB    = 2
+	TCA_TBF_PTAB    = 3
+	TCA_TBF_RATE64  = 4
+	TCA_TBF_PRATE64 = 5
+	TCA_TBF_BURST   = 6
+	TCA_TBF_PBURST  = 7
+	TCA_TBF_PAD     = 8
+)
+
+// FQ_CODEL attributes, from include/uapi/linux/pkt_sched.h.
+const (
+	TCA_FQ_CODEL_UNSPEC          = 0
+	TCA_FQ_CODEL_TARGET          = 1
+	TCA_FQ_CODEL_LIMIT           = 2
+	TCA_FQ_CODEL_INTERVAL        = 3
+	TCA_FQ_CODEL_ECN             = 4
+	TCA_FQ_CODEL_FLOWS           = 5
+	TCA_FQ_CODEL_QUANTUM         = 6
+	TCA_FQ_CODEL_CE_THRESHOLD    = 7
+	TCA_FQ_CODEL_DROP_BATCH_SIZE = 8
+	TCA_FQ_CODEL_MEMORY_LIMIT    = 9
+)
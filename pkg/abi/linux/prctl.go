@@ -145,6 +145,10 @@ const (
 	// Protection eXtensions (MPX) bounds tables.
 	PR_MPX_DISABLE_MANAGEMENT = 44
 
+	// PR_SET_SYSCALL_USER_DISPATCH enables or disables Syscall User
+	// Dispatch for the calling thread.
+	PR_SET_SYSCALL_USER_DISPATCH = 59
+
 	// The following constants are used to control thread scheduling on cores.
 	PR_SCHED_CORE_SCOPE_THREAD       = 0
 	PR_SCHED_CORE_SCOPE_THREAD_GROUP = 1
@@ -161,6 +165,16 @@ const (
 	PR_SET_PTRACER_ANY = -1
 )
 
+// Modes for prctl(PR_SET_SYSCALL_USER_DISPATCH), and values of its selector,
+// defined in include/uapi/linux/prctl.h.
+const (
+	PR_SYS_DISPATCH_OFF = 0
+	PR_SYS_DISPATCH_ON  = 1
+
+	SYSCALL_DISPATCH_FILTER_ALLOW = 0
+	SYSCALL_DISPATCH_FILTER_BLOCK = 1
+)
+
 // From <asm/prctl.h>
 // Flags are used in syscall arch_prctl(2).
 const (
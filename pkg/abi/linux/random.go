@@ -0,0 +1,38 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Random device ioctl(2) request numbers, from uapi/linux/random.h.
+const (
+	RNDGETENTCNT   = 0x80045200 // _IOR('R', 0x00, int)
+	RNDADDTOENTCNT = 0x40045201 // _IOW('R', 0x01, int)
+	RNDGETPOOL     = 0x80085202 // _IOR('R', 0x02, int[2])
+	RNDADDENTROPY  = 0x40085203 // _IOW('R', 0x03, int[2])
+	RNDZAPENTCNT   = 0x5204     // _IO('R', 0x04)
+	RNDCLEARPOOL   = 0x5206     // _IO('R', 0x06)
+	RNDRESEEDCRNG  = 0x5207     // _IO('R', 0x07)
+)
+
+// RandPoolInfo is the fixed-length header of struct rand_pool_info, from
+// uapi/linux/random.h. It is followed by BufSize bytes of entropy.
+//
+// +marshal
+type RandPoolInfo struct {
+	EntropyCount int32
+	BufSize      int32
+}
+
+// SizeOfRandPoolInfo is the size of RandPoolInfo.
+const SizeOfRandPoolInfo = 8
@@ -0,0 +1,178 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// NETLINK_SOCK_DIAG message types, from uapi/linux/sock_diag.h.
+const (
+	SOCK_DIAG_BY_FAMILY = 20
+	SOCK_DESTROY        = 21
+)
+
+// SockDiagReq is struct sock_diag_req, from uapi/linux/sock_diag.h. It is the
+// start of all SOCK_DIAG_BY_FAMILY requests.
+//
+// +marshal
+type SockDiagReq struct {
+	Family   uint8
+	Protocol uint8
+}
+
+// SizeOfSockDiagReq is the size of SockDiagReq.
+const SizeOfSockDiagReq = 2
+
+// INET_DIAG_NOCOOKIE is the cookie of requests not looking up a socket by
+// cookie, from uapi/linux/inet_diag.h.
+const INET_DIAG_NOCOOKIE = ^uint32(0)
+
+// InetDiagSockID is struct inet_diag_sockid, from uapi/linux/inet_diag.h.
+//
+// Ports and addresses are in network byte order. IPv4 addresses only use the
+// first 4 bytes of Src and Dst.
+//
+// +marshal
+type InetDiagSockID struct {
+	Sport  uint16
+	Dport  uint16
+	Src    [16]byte
+	Dst    [16]byte
+	If     uint32
+	Cookie [2]uint32
+}
+
+// InetDiagReqV2 is struct inet_diag_req_v2, from uapi/linux/inet_diag.h.
+//
+// +marshal
+type InetDiagReqV2 struct {
+	Family   uint8
+	Protocol uint8
+	Ext      uint8
+	_        uint8
+	States   uint32
+	ID       InetDiagSockID
+}
+
+// SizeOfInetDiagReqV2 is the size of InetDiagReqV2.
+const SizeOfInetDiagReqV2 = 56
+
+// InetDiagMsg is struct inet_diag_msg, from uapi/linux/inet_diag.h.
+//
+// +marshal
+type InetDiagMsg struct {
+	Family  uint8
+	State   uint8
+	Timer   uint8
+	Retrans uint8
+	ID      InetDiagSockID
+	Expires uint32
+	RQueue  uint32
+	WQueue  uint32
+	UID     uint32
+	Inode   uint32
+}
+
+// Attributes of inet_diag requests, from uapi/linux/inet_diag.h.
+const (
+	INET_DIAG_REQ_NONE            = 0
+	INET_DIAG_REQ_BYTECODE        = 1
+	INET_DIAG_REQ_SK_BPF_STORAGES = 2
+	INET_DIAG_REQ_PROTOCOL        = 3
+)
+
+// Attributes of inet_diag messages, from uapi/linux/inet_diag.h. Requests ask
+// for attribute n with bit n-1 of InetDiagReqV2.Ext.
+const (
+	INET_DIAG_NONE            = 0
+	INET_DIAG_MEMINFO         = 1
+	INET_DIAG_INFO            = 2
+	INET_DIAG_VEGASINFO       = 3
+	INET_DIAG_CONG            = 4
+	INET_DIAG_TOS             = 5
+	INET_DIAG_TCLASS          = 6
+	INET_DIAG_SKMEMINFO       = 7
+	INET_DIAG_SHUTDOWN        = 8
+	INET_DIAG_DCTCPINFO       = 9
+	INET_DIAG_PROTOCOL        = 10
+	INET_DIAG_SKV6ONLY        = 11
+	INET_DIAG_LOCALS          = 12
+	INET_DIAG_PEERS           = 13
+	INET_DIAG_PAD             = 14
+	INET_DIAG_MARK            = 15
+	INET_DIAG_BBRINFO         = 16
+	INET_DIAG_CLASS_ID        = 17
+	INET_DIAG_MD5SIG          = 18
+	INET_DIAG_ULP_INFO        = 19
+	INET_DIAG_SK_BPF_STORAGES = 20
+	INET_DIAG_CGROUP_ID       = 21
+	INET_DIAG_SOCKOPT         = 22
+)
+
+// UnixDiagReq is struct unix_diag_req, from uapi/linux/unix_diag.h.
+//
+// +marshal
+type UnixDiagReq struct {
+	Family   uint8
+	Protocol uint8
+	_        uint16
+	States   uint32
+	Ino      uint32
+	Show     uint32
+	Cookie   [2]uint32
+}
+
+// SizeOfUnixDiagReq is the size of UnixDiagReq.
+const SizeOfUnixDiagReq = 24
+
+// Flags of UnixDiagReq.Show, from uapi/linux/unix_diag.h.
+const (
+	UDIAG_SHOW_NAME    = 0x00000001
+	UDIAG_SHOW_VFS     = 0x00000002
+	UDIAG_SHOW_PEER    = 0x00000004
+	UDIAG_SHOW_ICONS   = 0x00000008
+	UDIAG_SHOW_RQLEN   = 0x00000010
+	UDIAG_SHOW_MEMINFO = 0x00000020
+	UDIAG_SHOW_UID     = 0x00000040
+)
+
+// UnixDiagMsg is struct unix_diag_msg, from uapi/linux/unix_diag.h.
+//
+// +marshal
+type UnixDiagMsg struct {
+	Family uint8
+	Type   uint8
+	State  uint8
+	_      uint8
+	Ino    uint32
+	Cookie [2]uint32
+}
+
+// Attributes of unix_diag messages, from uapi/linux/unix_diag.h.
+const (
+	UNIX_DIAG_NAME     = 0
+	UNIX_DIAG_VFS      = 1
+	UNIX_DIAG_PEER     = 2
+	UNIX_DIAG_ICONS    = 3
+	UNIX_DIAG_RQLEN    = 4
+	UNIX_DIAG_MEMINFO  = 5
+	UNIX_DIAG_SHUTDOWN = 6
+	UNIX_DIAG_UID      = 7
+)
+
+// UnixDiagRQLen is struct unix_diag_rqlen, from uapi/linux/unix_diag.h.
+//
+// +marshal
+type UnixDiagRQLen struct {
+	RQueue uint32
+	WQueue uint32
+}
@@ -101,6 +101,8 @@ const (
 	SOL_RAW     = 255
 	SOL_PACKET  = 263
 	SOL_NETLINK = 270
+	SOL_TLS     = 282
+	SOL_MPTCP   = 284
 )
 
 // A SockType is a type (as opposed to family) of sockets. These are enumerated
@@ -153,6 +155,7 @@ const (
 	PACKET_VERSION        = 10
 	PACKET_HDRLEN         = 11
 	PACKET_RESERVE        = 12
+	PACKET_TX_RING        = 13
 )
 
 // Statuses for a frame in a packet_mmap ring buffer from <linux/if_packet.h>.
@@ -169,6 +172,15 @@ const (
 	TP_STATUS_GSO_TCP         = 0x100
 )
 
+// Statuses for a frame in a packet_mmap TX ring buffer from
+// <linux/if_packet.h>.
+const (
+	TP_STATUS_AVAILABLE    = 0
+	TP_STATUS_SEND_REQUEST = 0x1
+	TP_STATUS_SENDING      = 0x2
+	TP_STATUS_WRONG_FORMAT = 0x4
+)
+
 // TpacketReq is the request for a packet_mmap ring buffer from
 // <linux/if_packet.h>.
 //
@@ -195,6 +207,20 @@ type TpacketHdr struct {
 	_         [4]uint8
 }
 
+// TpacketReq3 is the request for a TPACKET_V3 packet_mmap ring buffer from
+// <linux/if_packet.h>.
+//
+// +marshal
+type TpacketReq3 struct {
+	TpBlockSize      uint32
+	TpBlockNr        uint32
+	TpFrameSize      uint32
+	TpFrameNr        uint32
+	TpRetireBlkTov   uint32
+	TpSizeofPriv     uint32
+	TpFeatureReqWord uint32
+}
+
 // Tpacket2Hdr is the header for a frame in a packet_mmap ring buffer from
 // <linux/if_packet.h>.
 //
@@ -212,6 +238,44 @@ type Tpacket2Hdr struct {
 	_          [4]uint8
 }
 
+// Tpacket3Hdr is the header for a packet in a TPACKET_V3 packet_mmap ring
+// buffer from <linux/if_packet.h>.
+//
+// +marshal
+type Tpacket3Hdr struct {
+	TpNextOffset uint32
+	TpSec        uint32
+	TpNSec       uint32
+	TpSnaplen    uint32
+	TpLen        uint32
+	TpStatus     uint32
+	TpMac        uint16
+	TpNet        uint16
+	TpRxhash     uint32
+	TpVlanTci    uint32
+	TpVlanTpid   uint16
+	_            [10]uint8
+}
+
+// TpacketBlockDesc is the descriptor of a block in a TPACKET_V3 packet_mmap
+// ring buffer, struct tpacket_block_desc with a struct tpacket_hdr_v1 header
+// from <linux/if_packet.h>.
+//
+// +marshal
+type TpacketBlockDesc struct {
+	Version          uint32
+	OffsetToPriv     uint32
+	BlockStatus      uint32
+	NumPkts          uint32
+	OffsetToFirstPkt uint32
+	BlkLen           uint32
+	SeqNum           uint64
+	TsFirstPktSec    uint32
+	TsFirstPktNSec   uint32
+	TsLastPktSec     uint32
+	TsLastPktNSec    uint32
+}
+
 // TpacketStats is the statistics for a packet_mmap ring buffer from
 // <linux/if_packet.h>.
 //
@@ -221,6 +285,16 @@ type TpacketStats struct {
 	Dropped uint32
 }
 
+// TpacketStatsV3 is the statistics for a TPACKET_V3 packet_mmap ring buffer
+// from <linux/if_packet.h>.
+//
+// +marshal
+type TpacketStatsV3 struct {
+	Packets    uint32
+	Dropped    uint32
+	FreezeQCnt uint32
+}
+
 // TpacketAlignment is the alignment of a frame in a packet_mmap ring buffer
 // from <linux/if_packet.h>.
 const (
@@ -234,6 +308,9 @@ const (
 	TPACKET_V1 = iota
 	// TPACKET_V2 is the version of PACKET_MMAP for tpacket2_hdr.
 	TPACKET_V2
+	// TPACKET_V3 is the version of PACKET_MMAP for tpacket3_hdr, with
+	// variable length frames packed into blocks.
+	TPACKET_V3
 )
 
 var (
@@ -241,6 +318,8 @@ var (
 	TPACKET_HDRLEN = TPacketAlign(uint32((*TpacketHdr)(nil).SizeBytes()) + uint32((*SockAddrLink)(nil).SizeBytes()))
 	// TPACKET2_HDRLEN is the length of a Tpacket2Hdr from <linux/if_packet.h>.
 	TPACKET2_HDRLEN = TPacketAlign(uint32((*Tpacket2Hdr)(nil).SizeBytes()) + uint32((*SockAddrLink)(nil).SizeBytes()))
+	// TPACKET3_HDRLEN is the length of a Tpacket3Hdr from <linux/if_packet.h>.
+	TPACKET3_HDRLEN = TPacketAlign(uint32((*Tpacket3Hdr)(nil).SizeBytes()) + uint32((*SockAddrLink)(nil).SizeBytes()))
 )
 
 // TPacketAlign aligns a value to the alignment of a TPacket.
@@ -307,6 +386,7 @@ const (
 	SO_PEERGROUPS            = 59
 	SO_ZEROCOPY              = 60
 	SO_TXTIME                = 61
+	SO_DETACH_REUSEPORT_BPF  = 68
 )
 
 // enum socket_state, from uapi/linux/net.h.
@@ -68,3 +68,51 @@ const (
 	TCP_CA_Recovery = 3
 	TCP_CA_Loss     = 4
 )
+
+// TCP_INFO options from include/uapi/linux/tcp.h.
+const (
+	TCPI_OPT_TIMESTAMPS = 1
+	TCPI_OPT_SACK       = 2
+	TCPI_OPT_WSCALE     = 4
+	TCPI_OPT_ECN        = 8
+	TCPI_OPT_ECN_SEEN   = 16
+	TCPI_OPT_SYN_DATA   = 32
+)
+
+// Flags and message flags of struct tcp_zerocopy_receive, from
+// include/uapi/linux/tcp.h.
+const (
+	TCP_RECEIVE_ZEROCOPY_FLAG_TLB_CLEAN_HINT = 0x1
+
+	TCP_CMSG_INQ = 1
+	TCP_CMSG_TS  = 2
+)
+
+// TCPZeroCopyReceive is struct tcp_zerocopy_receive, from
+// include/uapi/linux/tcp.h. It is the argument of
+// getsockopt(TCP_ZEROCOPY_RECEIVE).
+//
+// +marshal
+type TCPZeroCopyReceive struct {
+	Address        uint64
+	Length         uint32
+	RecvSkipHint   uint32
+	Inq            uint32
+	Err            int32
+	CopybufAddress uint64
+	CopybufLen     int32
+	Flags          uint32
+	MsgControl     uint64
+	MsgControllen  uint64
+	MsgFlags       uint32
+	Reserved       uint32
+}
+
+// Offsets of the end of the fields of struct tcp_zerocopy_receive that
+// determine which fields getsockopt(TCP_ZEROCOPY_RECEIVE) reads and writes,
+// as the struct grew over time.
+const (
+	TCPZeroCopyReceiveLengthEnd = 12
+	TCPZeroCopyReceiveInqEnd    = 20
+	TCPZeroCopyReceiveErrEnd    = 24
+)
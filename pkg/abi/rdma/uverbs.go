@@ -0,0 +1,324 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rdma describes the userspace interface for RDMA (InfiniBand verbs)
+// devices.
+package rdma
+
+import (
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+)
+
+// Device numbers, from include/rdma/ib_verbs.h and
+// drivers/infiniband/core/uverbs_main.c.
+const (
+	// IB_UVERBS_MAJOR is the major device number of /dev/infiniband/uverbs*.
+	IB_UVERBS_MAJOR = 231
+
+	// IB_UVERBS_BASE_MINOR is the minor device number of
+	// /dev/infiniband/uverbs0.
+	IB_UVERBS_BASE_MINOR = 192
+)
+
+// Legacy write() commands, from include/uapi/rdma/ib_user_verbs.h.
+const (
+	IB_USER_VERBS_CMD_GET_CONTEXT         = 0
+	IB_USER_VERBS_CMD_QUERY_DEVICE        = 1
+	IB_USER_VERBS_CMD_QUERY_PORT          = 2
+	IB_USER_VERBS_CMD_ALLOC_PD            = 3
+	IB_USER_VERBS_CMD_DEALLOC_PD          = 4
+	IB_USER_VERBS_CMD_CREATE_AH           = 5
+	IB_USER_VERBS_CMD_MODIFY_AH           = 6
+	IB_USER_VERBS_CMD_QUERY_AH            = 7
+	IB_USER_VERBS_CMD_DESTROY_AH          = 8
+	IB_USER_VERBS_CMD_REG_MR              = 9
+	IB_USER_VERBS_CMD_REG_SMR             = 10
+	IB_USER_VERBS_CMD_REREG_MR            = 11
+	IB_USER_VERBS_CMD_QUERY_MR            = 12
+	IB_USER_VERBS_CMD_DEREG_MR            = 13
+	IB_USER_VERBS_CMD_ALLOC_MW            = 14
+	IB_USER_VERBS_CMD_BIND_MW             = 15
+	IB_USER_VERBS_CMD_DEALLOC_MW          = 16
+	IB_USER_VERBS_CMD_CREATE_COMP_CHANNEL = 17
+	IB_USER_VERBS_CMD_CREATE_CQ           = 18
+	IB_USER_VERBS_CMD_RESIZE_CQ           = 19
+	IB_USER_VERBS_CMD_DESTROY_CQ          = 20
+	IB_USER_VERBS_CMD_POLL_CQ             = 21
+	IB_USER_VERBS_CMD_PEEK_CQ             = 22
+	IB_USER_VERBS_CMD_REQ_NOTIFY_CQ       = 23
+	IB_USER_VERBS_CMD_CREATE_QP           = 24
+	IB_USER_VERBS_CMD_QUERY_QP            = 25
+	IB_USER_VERBS_CMD_MODIFY_QP           = 26
+	IB_USER_VERBS_CMD_DESTROY_QP          = 27
+	IB_USER_VERBS_CMD_POST_SEND           = 28
+	IB_USER_VERBS_CMD_POST_RECV           = 29
+	IB_USER_VERBS_CMD_ATTACH_MCAST        = 30
+	IB_USER_VERBS_CMD_DETACH_MCAST        = 31
+	IB_USER_VERBS_CMD_CREATE_SRQ          = 32
+	IB_USER_VERBS_CMD_MODIFY_SRQ          = 33
+	IB_USER_VERBS_CMD_QUERY_SRQ           = 34
+	IB_USER_VERBS_CMD_DESTROY_SRQ         = 35
+	IB_USER_VERBS_CMD_POST_SRQ_RECV       = 36
+	IB_USER_VERBS_CMD_OPEN_XRCD           = 37
+	IB_USER_VERBS_CMD_CLOSE_XRCD          = 38
+	IB_USER_VERBS_CMD_CREATE_XSRQ         = 39
+	IB_USER_VERBS_CMD_OPEN_QP             = 40
+)
+
+// Command header flags, from include/uapi/rdma/ib_user_verbs.h.
+const (
+	IB_USER_VERBS_CMD_COMMAND_MASK  = 0xff
+	IB_USER_VERBS_CMD_FLAG_EXTENDED = 0x80000000
+)
+
+// Memory region access flags, from include/rdma/ib_verbs.h.
+const (
+	IB_ACCESS_LOCAL_WRITE   = 1 << 0
+	IB_ACCESS_REMOTE_WRITE  = 1 << 1
+	IB_ACCESS_REMOTE_READ   = 1 << 2
+	IB_ACCESS_REMOTE_ATOMIC = 1 << 3
+	IB_ACCESS_MW_BIND       = 1 << 4
+	IB_ZERO_BASED           = 1 << 5
+	IB_ACCESS_ON_DEMAND     = 1 << 6
+	IB_ACCESS_HUGETLB       = 1 << 7
+	IB_ACCESS_RELAXED_ORDER = 1 << 20
+)
+
+// QP types, from include/uapi/rdma/ib_user_verbs.h.
+const (
+	IB_UVERBS_QPT_RC         = 2
+	IB_UVERBS_QPT_UC         = 3
+	IB_UVERBS_QPT_UD         = 4
+	IB_UVERBS_QPT_RAW_PACKET = 8
+	IB_UVERBS_QPT_XRC_INI    = 9
+	IB_UVERBS_QPT_XRC_TGT    = 10
+)
+
+// RDMA_IOCTL_MAGIC is the ioctl type of RDMA_VERBS_IOCTL, from
+// include/uapi/rdma/rdma_user_ioctl_cmds.h.
+const RDMA_IOCTL_MAGIC = 0x1b
+
+// RDMA_VERBS_IOCTL is the ioctl used by the ioctl() based uverbs interface,
+// from include/uapi/rdma/rdma_user_ioctl_cmds.h.
+var RDMA_VERBS_IOCTL = linux.IOWR(RDMA_IOCTL_MAGIC, 1, SizeofIBUverbsIoctlHdr)
+
+// SizeofIBUverbsIoctlHdr is the size of struct ib_uverbs_ioctl_hdr, excluding
+// its trailing attributes.
+const SizeofIBUverbsIoctlHdr = 24
+
+// IBUverbsCmdHdr is struct ib_uverbs_cmd_hdr, which precedes every legacy
+// write() command.
+//
+// +marshal
+type IBUverbsCmdHdr struct {
+	Command  uint32
+	InWords  uint16
+	OutWords uint16
+}
+
+// IBUverbsGetContext is struct ib_uverbs_get_context.
+//
+// +marshal
+type IBUverbsGetContext struct {
+	Response uint64
+}
+
+// IBUverbsGetContextResp is struct ib_uverbs_get_context_resp.
+//
+// +marshal
+type IBUverbsGetContextResp struct {
+	AsyncFD        uint32
+	NumCompVectors uint32
+}
+
+// IBUverbsQueryDevice is struct ib_uverbs_query_device.
+//
+// +marshal
+type IBUverbsQueryDevice struct {
+	Response uint64
+}
+
+// IBUverbsQueryPort is struct ib_uverbs_query_port.
+//
+// +marshal
+type IBUverbsQueryPort struct {
+	Response uint64
+	PortNum  uint8
+	Reserved [7]uint8
+}
+
+// IBUverbsAllocPD is struct ib_uverbs_alloc_pd.
+//
+// +marshal
+type IBUverbsAllocPD struct {
+	Response uint64
+}
+
+// IBUverbsDeallocPD is struct ib_uverbs_dealloc_pd.
+//
+// +marshal
+type IBUverbsDeallocPD struct {
+	PDHandle uint32
+}
+
+// IBUverbsRegMR is struct ib_uverbs_reg_mr.
+//
+// +marshal
+type IBUverbsRegMR struct {
+	Response    uint64
+	Start       uint64
+	Length      uint64
+	HCAVA       uint64
+	PDHandle    uint32
+	AccessFlags uint32
+}
+
+// IBUverbsRegMRResp is struct ib_uverbs_reg_mr_resp.
+//
+// +marshal
+type IBUverbsRegMRResp struct {
+	MRHandle uint32
+	LKey     uint32
+	RKey     uint32
+}
+
+// IBUverbsDeregMR is struct ib_uverbs_dereg_mr.
+//
+// +marshal
+type IBUverbsDeregMR struct {
+	MRHandle uint32
+}
+
+// IBUverbsCreateCQ is struct ib_uverbs_create_cq.
+//
+// +marshal
+type IBUverbsCreateCQ struct {
+	Response    uint64
+	UserHandle  uint64
+	CQE         uint32
+	CompVector  uint32
+	CompChannel int32
+	Reserved    uint32
+}
+
+// IBUverbsDestroyCQ is struct ib_uverbs_destroy_cq.
+//
+// +marshal
+type IBUverbsDestroyCQ struct {
+	Response uint64
+	CQHandle uint32
+	Reserved uint32
+}
+
+// IBUverbsCreateQP is struct ib_uverbs_create_qp.
+//
+// +marshal
+type IBUverbsCreateQP struct {
+	Response      uint64
+	UserHandle    uint64
+	PDHandle      uint32
+	SendCQHandle  uint32
+	RecvCQHandle  uint32
+	SRQHandle     uint32
+	MaxSendWR     uint32
+	MaxRecvWR     uint32
+	MaxSendSGE    uint32
+	MaxRecvSGE    uint32
+	MaxInlineData uint32
+	SQSigAll      uint8
+	QPType        uint8
+	IsSRQ         uint8
+	Reserved      uint8
+}
+
+// IBUverbsQueryQP is struct ib_uverbs_query_qp.
+//
+// +marshal
+type IBUverbsQueryQP struct {
+	Response uint64
+	QPHandle uint32
+	AttrMask uint32
+}
+
+// IBUverbsQPDest is struct ib_uverbs_qp_dest.
+//
+// +marshal
+type IBUverbsQPDest struct {
+	DGID         [16]uint8
+	FlowLabel    uint32
+	DLID         uint16
+	Reserved     uint16
+	SGIDIndex    uint8
+	HopLimit     uint8
+	TrafficClass uint8
+	SL           uint8
+	SrcPathBits  uint8
+	StaticRate   uint8
+	IsGlobal     uint8
+	PortNum      uint8
+}
+
+// IBUverbsModifyQP is struct ib_uverbs_modify_qp.
+//
+// +marshal
+type IBUverbsModifyQP struct {
+	Dest             IBUverbsQPDest
+	AltDest          IBUverbsQPDest
+	QPHandle         uint32
+	AttrMask         uint32
+	QKey             uint32
+	RQPSN            uint32
+	SQPSN            uint32
+	DestQPNum        uint32
+	QPAccessFlags    uint32
+	PKeyIndex        uint16
+	AltPKeyIndex     uint16
+	QPState          uint8
+	CurQPState       uint8
+	PathMTU          uint8
+	PathMigState     uint8
+	EnSQDAsyncNotify uint8
+	MaxRDAtomic      uint8
+	MaxDestRDAtomic  uint8
+	MinRNRTimer      uint8
+	PortNum          uint8
+	Timeout          uint8
+	RetryCnt         uint8
+	RNRRetry         uint8
+	AltPortNum       uint8
+	AltTimeout       uint8
+	Reserved         [2]uint8
+}
+
+// IBUverbsDestroyQP is struct ib_uverbs_destroy_qp.
+//
+// +marshal
+type IBUverbsDestroyQP struct {
+	Response uint64
+	QPHandle uint32
+	Reserved uint32
+}
+
+// IBUverbsPostWR is the common layout of struct ib_uverbs_post_send and
+// struct ib_uverbs_post_recv, excluding the trailing work requests and
+// scatter/gather entries.
+//
+// +marshal
+type IBUverbsPostWR struct {
+	Response uint64
+	QPHandle uint32
+	WRCount  uint32
+	SGECount uint32
+	WQESize  uint32
+}
@@ -550,6 +550,19 @@ func (b *Buffer) ReadToWriter(w io.Writer, count int64) (int64, error) {
 	return count - int64(bytesLeft), nil
 }
 
+// Writer is an io.Writer which can also write a range of a Buffer at once.
+//
+// Writers implement this when writing each View of a Buffer separately is
+// expensive, e.g. when every write must copy out to application memory.
+type Writer interface {
+	io.Writer
+
+	// WriteFromBuffer writes count bytes of b, starting at offset. It
+	// returns the number of bytes written, and a non-nil error if that is
+	// less than count. b is not modified.
+	WriteFromBuffer(b *Buffer, offset, count int) (int, error)
+}
+
 // read implements the io.Reader interface. This method is used by BufferReader
 // to consume its underlying buffer. To perform io operations on buffers
 // directly, use ReadToWriter or WriteToReader.
@@ -623,6 +636,16 @@ func (br *BufferReader) Len() int {
 	return int(br.b.Size())
 }
 
+// ReadBuffer removes up to count bytes from the front of the buffer and
+// returns them as a new Buffer, which shares the underlying chunks rather
+// than copying them.
+func (br *BufferReader) ReadBuffer(count int64) Buffer {
+	out := br.b.Clone()
+	out.Truncate(count)
+	br.b.TrimFront(count)
+	return out
+}
+
 // Range specifies a range of buffer.
 type Range struct {
 	begin int
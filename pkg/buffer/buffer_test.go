@@ -699,6 +699,27 @@ func TestReadByte(t *testing.T) {
 	}
 }
 
+func TestBufferReaderReadBuffer(t *testing.T) {
+	readStrings := []string{"abcdef", "123456", "ghijkl"}
+	all := strings.Join(readStrings, "")
+	for readSz := 0; readSz < len(all)+1; readSz++ {
+		b := Buffer{}
+		for _, s := range readStrings {
+			b.appendOwned(NewViewWithExternalData([]byte(s), nil))
+		}
+		br := b.AsBufferReader()
+		out := br.ReadBuffer(int64(readSz))
+		if got, want := string(out.Flatten()), all[:readSz]; got != want {
+			t.Errorf("ReadBuffer(%d) = %q, want %q", readSz, got, want)
+		}
+		if got, want := string(b.Flatten()), all[readSz:]; got != want {
+			t.Errorf("ReadBuffer(%d) left %q, want %q", readSz, got, want)
+		}
+		out.Release()
+		br.Close()
+	}
+}
+
 func TestPullUpModifiedViews(t *testing.T) {
 	var b Buffer
 	defer b.Release()
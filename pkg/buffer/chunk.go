@@ -76,6 +76,16 @@ func getChunkPool(size int) *sync.Pool {
 type chunk struct {
 	chunkRefs
 	data []byte
+
+	// external is true if data is not pooled memory, but memory owned by
+	// someone else that is lent to the chunk. External chunks are never
+	// written to.
+	external bool
+
+	// release is called when an external chunk is destroyed. It is not
+	// saved: after restore, data is a copy of the external memory, which
+	// its owner has saved separately.
+	release func() `state:"nosave"`
 }
 
 func newChunk(size int) *chunk {
@@ -93,7 +103,27 @@ func newChunk(size int) *chunk {
 	return c
 }
 
+// newExternalChunk returns a chunk referring to data, which is owned by the
+// caller. release is called once the chunk is no longer used.
+func newExternalChunk(data []byte, release func()) *chunk {
+	c := &chunk{
+		data:     data,
+		external: true,
+		release:  release,
+	}
+	c.InitRefs()
+	return c
+}
+
 func (c *chunk) destroy() {
+	if c.external {
+		if c.release != nil {
+			c.release()
+		}
+		c.data = nil
+		c.release = nil
+		return
+	}
 	if len(c.data) > MaxChunkSize {
 		c.data = nil
 		return
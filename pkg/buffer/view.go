@@ -83,6 +83,22 @@ func NewViewWithData(data []byte) *View {
 	return v
 }
 
+// NewViewWithExternalData creates a new view of data, which the view
+// borrows rather than copies. release is called once all views sharing data
+// have been released, after which data is no longer accessed.
+//
+// data is never written through the view or its clones; writes to them
+// copy data to pooled memory first. The caller must not modify data while
+// the view is in use unless such modifications may be observed by its users.
+func NewViewWithExternalData(data []byte, release func()) *View {
+	v := viewPool.Get().(*View)
+	*v = View{
+		chunk: newExternalChunk(data, release),
+		write: len(data),
+	}
+	return v
+}
+
 // Clone creates a shallow clone of v where the underlying chunk is shared.
 //
 // The caller must own the View to call Clone. It is not safe to call Clone
@@ -119,14 +135,17 @@ func (v *View) Reset() {
 }
 
 func (v *View) sharesChunk() bool {
-	return v.chunk.refCount.Load() > 1
+	// External chunks are treated as shared so that they're copied before
+	// being written to.
+	return v.chunk.external || v.chunk.refCount.Load() > 1
 }
 
 // Full indicates the chunk is full.
 //
-// This indicates there is no capacity left to write.
+// This indicates there is no capacity left to write. External chunks are
+// always full, since they can't be written to.
 func (v *View) Full() bool {
-	return v == nil || v.write == len(v.chunk.data)
+	return v == nil || v.write == len(v.chunk.data) || v.chunk.external
 }
 
 // Capacity returns the total size of this view's chunk.
@@ -173,7 +192,7 @@ func (v *View) ToSlice() []byte {
 
 // AvailableSize returns the number of bytes available for writing.
 func (v *View) AvailableSize() int {
-	if v == nil {
+	if v == nil || v.chunk.external {
 		return 0
 	}
 	return len(v.chunk.data) - v.write
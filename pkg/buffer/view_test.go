@@ -151,6 +151,56 @@ func TestWriteToCloned(t *testing.T) {
 	}
 }
 
+func TestExternalView(t *testing.T) {
+	data := []byte("external data")
+	want := append([]byte(nil), data...)
+	released := false
+	orig := NewViewWithExternalData(data, func() { released = true })
+	if !cmp.Equal(orig.AsSlice(), want) {
+		t.Errorf("got orig.AsSlice() = %v, want %v", orig.AsSlice(), want)
+	}
+
+	// Writes must not modify the external data.
+	clone := orig.Clone()
+	if _, err := clone.WriteAt([]byte("E"), 0); err != nil {
+		t.Fatalf("clone.WriteAt() failed: %v", err)
+	}
+	if _, err := orig.Write([]byte("!")); err != nil {
+		t.Fatalf("orig.Write() failed: %v", err)
+	}
+	if !cmp.Equal(data, want) {
+		t.Errorf("external data = %q, want %q", data, want)
+	}
+	if got, want := string(orig.AsSlice()), "external data!"; got != want {
+		t.Errorf("got orig.AsSlice() = %q, want %q", got, want)
+	}
+	if got, want := string(clone.AsSlice()), "External data"; got != want {
+		t.Errorf("got clone.AsSlice() = %q, want %q", got, want)
+	}
+
+	// Both views have copied the data, so the external chunk is no longer
+	// used.
+	if !released {
+		t.Errorf("external data not released after all views were copied")
+	}
+	orig.Release()
+	clone.Release()
+}
+
+func TestExternalViewRelease(t *testing.T) {
+	released := false
+	orig := NewViewWithExternalData(make([]byte, 10), func() { released = true })
+	clone := orig.Clone()
+	orig.Release()
+	if released {
+		t.Errorf("external data released while a clone is in use")
+	}
+	clone.Release()
+	if !released {
+		t.Errorf("external data not released after all views were released")
+	}
+}
+
 func TestWriteAt(t *testing.T) {
 	size := 10
 	off := 5
@@ -16,7 +16,8 @@
 Package server provides a basic control server interface.
 
 Note that no objects are registered by default. Users must provide their own
-implementations of the control interface.
+implementations of the control interface. Objects may have streaming methods,
+see urpc.Stream, e.g. to send profiles or forwarded data as it is produced.
 */
 package server
 
@@ -59,7 +60,7 @@ func New(socket *unet.ServerSocket) *Server {
 }
 
 // ResetServer resets the server, clearing all registered objects. It stops the
-// old server asynchronously.
+// old server asynchronously, interrupting its streaming calls.
 func (s *Server) ResetServer() {
 	if old := s.server.Swap(urpc.NewServer()); old != nil {
 		go old.Stop(0)
@@ -79,6 +80,9 @@ func (s *Server) Wait() {
 
 // Stop stops the server. Note that this function should only be called once
 // and the server should not be used afterwards.
+//
+// Pending calls are given timeout to complete, after which streaming calls are
+// interrupted, since they may never complete by themselves.
 func (s *Server) Stop(timeout time.Duration) {
 	s.socket.Close()
 	s.Wait()
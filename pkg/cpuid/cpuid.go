@@ -124,6 +124,62 @@ func AllFeatures() (features []Feature) {
 	return
 }
 
+// FeatureOverrides are features added to or removed from a FeatureSet.
+type FeatureOverrides struct {
+	// Add holds the features to add.
+	Add []Feature
+
+	// Remove holds the features to remove.
+	Remove []Feature
+}
+
+// ParseFeatureOverrides parses a comma-separated list of feature names, as
+// they appear in /proc/cpuinfo, each prefixed with '+' to add the feature or
+// '-' to remove it. For example: "+avx2,-avx512f".
+func ParseFeatureOverrides(s string) (FeatureOverrides, error) {
+	var o FeatureOverrides
+	if s == "" {
+		return o, nil
+	}
+	seen := make(map[Feature]struct{})
+	for _, override := range strings.Split(s, ",") {
+		override = strings.TrimSpace(override)
+		if len(override) < 2 || (override[0] != '+' && override[0] != '-') {
+			return FeatureOverrides{}, fmt.Errorf("invalid feature override %q, want +feature or -feature", override)
+		}
+		feature, ok := FeatureFromString(override[1:])
+		if !ok {
+			return FeatureOverrides{}, fmt.Errorf("unknown feature %q", override[1:])
+		}
+		if _, ok := seen[feature]; ok {
+			return FeatureOverrides{}, fmt.Errorf("feature %v is overridden more than once", feature)
+		}
+		seen[feature] = struct{}{}
+		if override[0] == '+' {
+			o.Add = append(o.Add, feature)
+		} else {
+			o.Remove = append(o.Remove, feature)
+		}
+	}
+	return o, nil
+}
+
+// Override returns a copy of fs with the features of o added and removed.
+//
+// Features can only be added if the host supports them, since applications
+// would fault when using them otherwise.
+func (fs FeatureSet) Override(o FeatureOverrides) (FeatureSet, error) {
+	hfs := HostFeatureSet()
+	for _, feature := range o.Add {
+		if !hfs.HasFeature(feature) {
+			return FeatureSet{}, &ErrIncompatible{
+				reason: fmt.Sprintf("feature %v isn't supported by the host", feature),
+			}
+		}
+	}
+	return fs.archOverride(o), nil
+}
+
 // Subtract returns the features present in fs that are not present in other.
 // If all features in fs are present in other, Subtract returns nil.
 //
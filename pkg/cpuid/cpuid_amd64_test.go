@@ -110,3 +110,28 @@ func TestRemove(t *testing.T) {
 		t.Errorf("Remove failed, got %q want %q", testFeatures.FlagString(), justFPU.FlagString())
 	}
 }
+
+func TestOverride(t *testing.T) {
+	fs, err := justFPUandPAE.Override(FeatureOverrides{Remove: []Feature{X86FeaturePAE}})
+	if err != nil {
+		t.Fatalf("Override failed: %v", err)
+	}
+	if !fs.HasFeature(X86FeatureFPU) || fs.HasFeature(X86FeaturePAE) {
+		t.Errorf("got %q, want %q", fs.FlagString(), justFPU.FlagString())
+	}
+	if !justFPUandPAE.HasFeature(X86FeaturePAE) {
+		t.Errorf("Override modified the original feature set")
+	}
+
+	// Check that features unsupported by the host can't be added.
+	hostFeatures := HostFeatureSet()
+	for feature := range allFeatures {
+		if hostFeatures.HasFeature(feature) {
+			continue
+		}
+		if _, err := justFPU.Override(FeatureOverrides{Add: []Feature{feature}}); err == nil {
+			t.Errorf("Override added %v, which isn't supported by the host", feature)
+		}
+		break
+	}
+}
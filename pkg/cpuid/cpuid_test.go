@@ -37,6 +37,30 @@ func TestFeatureFromString(t *testing.T) {
 	}
 }
 
+func TestParseFeatureOverrides(t *testing.T) {
+	features := AllFeatures()
+	a, b := features[0], features[1]
+	o, err := ParseFeatureOverrides("+" + a.String() + ", -" + b.String())
+	if err != nil {
+		t.Fatalf("ParseFeatureOverrides failed: %v", err)
+	}
+	if len(o.Add) != 1 || o.Add[0] != a || len(o.Remove) != 1 || o.Remove[0] != b {
+		t.Errorf("got %+v, want Add: [%v], Remove: [%v]", o, a, b)
+	}
+
+	// Check that invalid overrides are rejected.
+	for _, s := range []string{
+		a.String(),
+		"+",
+		"+bad",
+		"+" + a.String() + ",-" + a.String(),
+	} {
+		if _, err := ParseFeatureOverrides(s); err == nil {
+			t.Errorf("ParseFeatureOverrides(%q) succeeded, want error", s)
+		}
+	}
+}
+
 func TestReadHwCap(t *testing.T) {
 	// Make an auxv with fake entries
 	const (
@@ -41,6 +41,17 @@ func (fs FeatureSet) Fixed() FeatureSet {
 	return fs
 }
 
+// archOverride implements FeatureSet.Override.
+func (fs FeatureSet) archOverride(o FeatureOverrides) FeatureSet {
+	for _, feature := range o.Add {
+		fs.hwCap.hwCap1 |= 1 << feature
+	}
+	for _, feature := range o.Remove {
+		fs.hwCap.hwCap1 &^= 1 << feature
+	}
+	return fs
+}
+
 // Reads CPU information from host /proc/cpuinfo.
 //
 // Must run before syscall filter installation. This value is used to create
@@ -31,6 +31,20 @@ func (fs FeatureSet) Fixed() FeatureSet {
 	return sfs
 }
 
+// archOverride implements FeatureSet.Override.
+func (fs FeatureSet) archOverride(o FeatureOverrides) FeatureSet {
+	s := fs.ToStatic()
+	for _, feature := range o.Add {
+		s.Add(feature)
+	}
+	for _, feature := range o.Remove {
+		s.Remove(feature)
+	}
+	ofs := s.ToFeatureSet()
+	ofs.hwCap = fs.hwCap
+	return ofs
+}
+
 // ToStatic converts a FeatureSet to a Static function.
 //
 // You can create a new static feature set as:
@@ -0,0 +1,235 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ext4
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+)
+
+const (
+	// extentMagic is the magic number of extent tree node headers.
+	extentMagic = 0xf30a
+
+	// extentHeaderSize and extentEntrySize are the sizes of extent tree node
+	// headers and entries respectively.
+	extentHeaderSize = 12
+	extentEntrySize  = 12
+
+	// maxExtentDepth is the maximum depth of an extent tree. Compare Linux's
+	// EXT4_MAX_EXTENT_DEPTH.
+	maxExtentDepth = 5
+
+	// initMaxExtentLen is the maximum length of an initialized extent.
+	// Extents with greater lengths are uninitialized, and read as zeroes.
+	initMaxExtentLen = 32768
+
+	// Indices into the legacy block map in i_block.
+	numDirectBlocks = 12
+	indirectBlock   = 12
+	dIndirectBlock  = 13
+	tIndirectBlock  = 14
+)
+
+// mapping describes a contiguous run of logical blocks in a file.
+type mapping struct {
+	// phys is the physical block containing the first logical block, or 0 if
+	// the run is a hole (or an uninitialized extent) that reads as zeroes.
+	phys uint64
+
+	// len is the number of blocks in the run.
+	len uint64
+}
+
+// mapBlock returns the mapping for the logical block lblk of the inode's
+// data.
+func (in *Inode) mapBlock(lblk uint64) (mapping, error) {
+	if in.flags&InodeFlagExtents != 0 {
+		return in.mapExtent(lblk)
+	}
+	return in.mapIndirect(lblk)
+}
+
+// mapExtent implements mapBlock for inodes that use extent trees. Compare
+// Linux's fs/ext4/extents.c:ext4_find_extent().
+func (in *Inode) mapExtent(lblk uint64) (mapping, error) {
+	le := binary.LittleEndian
+	node := in.block[:]
+	var buf []byte
+	for level := 0; ; level++ {
+		if len(node) < extentHeaderSize || le.Uint16(node[0:]) != extentMagic {
+			return mapping{}, linuxerr.EUCLEAN
+		}
+		entries := int(le.Uint16(node[2:]))
+		depth := le.Uint16(node[6:])
+		if level > maxExtentDepth || extentHeaderSize+entries*extentEntrySize > len(node) {
+			return mapping{}, linuxerr.EUCLEAN
+		}
+		entry := func(j int) []byte {
+			off := extentHeaderSize + j*extentEntrySize
+			return node[off : off+extentEntrySize]
+		}
+
+		// Find the last entry whose first logical block is <= lblk.
+		idx := -1
+		for j := 0; j < entries; j++ {
+			if uint64(le.Uint32(entry(j)[0:])) > lblk {
+				break
+			}
+			idx = j
+		}
+
+		if depth == 0 {
+			// Leaf node.
+			if idx >= 0 {
+				e := entry(idx)
+				start := uint64(le.Uint32(e[0:]))
+				length := uint64(le.Uint16(e[4:]))
+				uninit := length > initMaxExtentLen
+				if uninit {
+					length -= initMaxExtentLen
+				}
+				if lblk < start+length {
+					m := mapping{len: start + length - lblk}
+					if !uninit {
+						m.phys = (uint64(le.Uint16(e[6:]))<<32 | uint64(le.Uint32(e[8:]))) + lblk - start
+					}
+					return m, nil
+				}
+			}
+			// lblk is in a hole that extends to the next extent.
+			if idx+1 < entries {
+				return mapping{len: uint64(le.Uint32(entry(idx + 1)[0:])) - lblk}, nil
+			}
+			return mapping{len: 1}, nil
+		}
+
+		// Index node.
+		if idx < 0 {
+			return mapping{len: 1}, nil
+		}
+		e := entry(idx)
+		child := uint64(le.Uint16(e[8:]))<<32 | uint64(le.Uint32(e[4:]))
+		if buf == nil {
+			buf = make([]byte, in.image.blockSize)
+		}
+		if err := in.image.readBlock(child, buf); err != nil {
+			return mapping{}, err
+		}
+		node = buf
+	}
+}
+
+// mapIndirect implements mapBlock for inodes that use the legacy block map.
+// Compare Linux's fs/ext4/indirect.c:ext4_block_to_path().
+func (in *Inode) mapIndirect(lblk uint64) (mapping, error) {
+	le := binary.LittleEndian
+	ptrsPerBlock := uint64(in.image.blockSize / 4)
+
+	var path []uint64
+	switch {
+	case lblk < numDirectBlocks:
+		path = []uint64{lblk}
+	case lblk-numDirectBlocks < ptrsPerBlock:
+		path = []uint64{indirectBlock, lblk - numDirectBlocks}
+	case lblk-numDirectBlocks-ptrsPerBlock < ptrsPerBlock*ptrsPerBlock:
+		n := lblk - numDirectBlocks - ptrsPerBlock
+		path = []uint64{dIndirectBlock, n / ptrsPerBlock, n % ptrsPerBlock}
+	default:
+		n := lblk - numDirectBlocks - ptrsPerBlock - ptrsPerBlock*ptrsPerBlock
+		if n >= ptrsPerBlock*ptrsPerBlock*ptrsPerBlock {
+			return mapping{}, linuxerr.EFBIG
+		}
+		path = []uint64{tIndirectBlock, n / (ptrsPerBlock * ptrsPerBlock), (n / ptrsPerBlock) % ptrsPerBlock, n % ptrsPerBlock}
+	}
+
+	blk := uint64(le.Uint32(in.block[4*path[0]:]))
+	if len(path) > 1 {
+		buf := make([]byte, in.image.blockSize)
+		for _, off := range path[1:] {
+			if blk == 0 {
+				break
+			}
+			if err := in.image.readBlock(blk, buf); err != nil {
+				return mapping{}, err
+			}
+			blk = uint64(le.Uint32(buf[4*off:]))
+		}
+	}
+	return mapping{phys: blk, len: 1}, nil
+}
+
+// ReadAt reads the inode's data at offset off into dst, with the semantics of
+// io.ReaderAt.ReadAt.
+func (in *Inode) ReadAt(dst []byte, off uint64) (int, error) {
+	if off >= in.size {
+		return 0, io.EOF
+	}
+	var eof error
+	if rem := in.size - off; uint64(len(dst)) > rem {
+		dst = dst[:rem]
+		eof = io.EOF
+	}
+	if in.hasInlineData() {
+		data, err := in.inlineData()
+		if err != nil {
+			return 0, err
+		}
+		if off >= uint64(len(data)) {
+			return 0, linuxerr.EUCLEAN
+		}
+		n := copy(dst, data[off:])
+		if n < len(dst) {
+			return n, linuxerr.EUCLEAN
+		}
+		return n, eof
+	}
+
+	bs := uint64(in.image.blockSize)
+	done := 0
+	for done < len(dst) {
+		pos := off + uint64(done)
+		m, err := in.mapBlock(pos / bs)
+		if err != nil {
+			return done, err
+		}
+		n := m.len*bs - pos%bs
+		if rem := uint64(len(dst) - done); n > rem {
+			n = rem
+		}
+		chunk := dst[done : uint64(done)+n]
+		if m.phys == 0 {
+			clear(chunk)
+		} else if err := in.image.readAt(chunk, m.phys*bs+pos%bs); err != nil {
+			return done, err
+		}
+		done += int(n)
+	}
+	return done, eof
+}
+
+// inlineData returns the inode's inline data, which is stored in i_block and
+// continued in the "system.data" extended attribute.
+func (in *Inode) inlineData() ([]byte, error) {
+	data := append([]byte(nil), in.block[:]...)
+	if extra, err := in.Xattr("system.data"); err == nil {
+		data = append(data, extra...)
+	} else if !linuxerr.Equals(linuxerr.ENODATA, err) {
+		return nil, err
+	}
+	return data, nil
+}
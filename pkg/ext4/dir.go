@@ -0,0 +1,362 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ext4
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+)
+
+const (
+	// direntHeaderSize is the size of a directory entry, excluding its name.
+	direntHeaderSize = 8
+
+	// maxRecLen is the on-disk rec_len used to represent 64KB in filesystems
+	// with 64KB blocks.
+	maxRecLen = 65535
+
+	// dxRootInfoOffset is the offset of struct dx_root_info in the first
+	// block of a hash-indexed directory, after the "." and ".." entries.
+	dxRootInfoOffset = 24
+
+	// dxNodeEntriesOffset is the offset of the entries in interior nodes of
+	// hash-indexed directories, after a fake empty directory entry.
+	dxNodeEntriesOffset = 8
+
+	// dxEntrySize is the size of struct dx_entry.
+	dxEntrySize = 8
+
+	// dxBlockMask masks the block number in struct dx_entry.
+	dxBlockMask = 0x0fffffff
+
+	// inlineDirParentSize is the size of the parent inode number that
+	// precedes the entries of an inline directory.
+	inlineDirParentSize = 4
+)
+
+// Directory entry file types, used if the filetype feature is enabled. These
+// match the Linux FT_* values.
+const (
+	FileTypeUnknown = 0
+	FileTypeRegular = 1
+	FileTypeDir     = 2
+	FileTypeChar    = 3
+	FileTypeBlock   = 4
+	FileTypeFIFO    = 5
+	FileTypeSocket  = 6
+	FileTypeSymlink = 7
+)
+
+// recLen decodes the rec_len field of a directory entry. Compare Linux's
+// fs/ext4/ext4.h:ext4_rec_len_from_disk().
+func (i *Image) recLen(dlen uint16) uint32 {
+	if i.blockSize < 65536 {
+		return uint32(dlen)
+	}
+	if dlen == maxRecLen || dlen == 0 {
+		return i.blockSize
+	}
+	return uint32(dlen&65532) | uint32(dlen&3)<<16
+}
+
+// parseDirents invokes cb on each in-use entry in the directory entry block
+// buf, until cb returns false.
+func (i *Image) parseDirents(buf []byte, cb func(name []byte, typ uint8, ino uint32) bool) error {
+	le := binary.LittleEndian
+	hasFiletype := i.sb.FeatureIncompat&FeatureIncompatFiletype != 0
+	for off := 0; off < len(buf); {
+		if off+direntHeaderSize > len(buf) {
+			return linuxerr.EUCLEAN
+		}
+		ino := le.Uint32(buf[off:])
+		recLen := int(i.recLen(le.Uint16(buf[off+4:])))
+		nameLen := int(le.Uint16(buf[off+6:]))
+		var typ uint8
+		if hasFiletype {
+			nameLen = int(buf[off+6])
+			typ = buf[off+7]
+		}
+		if recLen < direntHeaderSize || recLen%4 != 0 || off+recLen > len(buf) || direntHeaderSize+nameLen > recLen {
+			return linuxerr.EUCLEAN
+		}
+		if ino != 0 {
+			if !cb(buf[off+direntHeaderSize:off+direntHeaderSize+nameLen], typ, ino) {
+				return nil
+			}
+		}
+		off += recLen
+	}
+	return nil
+}
+
+// forEachDirBlock invokes cb on each block of directory entries in the
+// directory, until cb returns false. For inline directories, the blocks are
+// the regions of inline data following the parent inode number.
+func (in *Inode) forEachDirBlock(cb func(buf []byte) (bool, error)) error {
+	if in.hasInlineData() {
+		cont, err := cb(in.block[inlineDirParentSize:])
+		if err != nil || !cont {
+			return err
+		}
+		extra, err := in.Xattr("system.data")
+		if err != nil {
+			if linuxerr.Equals(linuxerr.ENODATA, err) {
+				return nil
+			}
+			return err
+		}
+		if len(extra) != 0 {
+			_, err = cb(extra)
+		}
+		return err
+	}
+
+	bs := uint64(in.image.blockSize)
+	buf := make([]byte, bs)
+	for off := uint64(0); off < in.size; off += bs {
+		if _, err := in.ReadAt(buf, off); err != nil {
+			return err
+		}
+		if cont, err := cb(buf); err != nil || !cont {
+			return err
+		}
+	}
+	return nil
+}
+
+// IterDirents invokes cb on each entry in the directory, including "." and
+// "..". typ is a file type (FileTypeUnknown if the filesystem does not record
+// file types in directory entries).
+func (in *Inode) IterDirents(cb func(name string, typ uint8, ino uint32) error) error {
+	if !in.IsDir() {
+		return linuxerr.ENOTDIR
+	}
+	if in.hasInlineData() {
+		// Inline directories omit "." and ".."; the parent inode number is
+		// stored before the entries.
+		if err := cb(".", FileTypeDir, in.ino); err != nil {
+			return err
+		}
+		if err := cb("..", FileTypeDir, binary.LittleEndian.Uint32(in.block[:])); err != nil {
+			return err
+		}
+	}
+	var cbErr error
+	err := in.forEachDirBlock(func(buf []byte) (bool, error) {
+		err := in.image.parseDirents(buf, func(name []byte, typ uint8, ino uint32) bool {
+			cbErr = cb(string(name), typ, ino)
+			return cbErr == nil
+		})
+		return cbErr == nil, err
+	})
+	if err != nil {
+		return err
+	}
+	return cbErr
+}
+
+// Lookup returns the inode number of the directory's child with the given
+// name.
+func (in *Inode) Lookup(name string) (uint32, error) {
+	if !in.IsDir() {
+		return 0, linuxerr.ENOTDIR
+	}
+	if len(name) == 0 || len(name) > MaxNameLen {
+		return 0, linuxerr.ENOENT
+	}
+	nameBytes := []byte(name)
+	if in.hasInlineData() {
+		switch name {
+		case ".":
+			return in.ino, nil
+		case "..":
+			return binary.LittleEndian.Uint32(in.block[:]), nil
+		}
+	} else if in.flags&InodeFlagIndex != 0 && in.image.sb.FeatureCompat&FeatureCompatDirIndex != 0 {
+		ino, ok, err := in.htreeLookup(nameBytes)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			if ino == 0 {
+				return 0, linuxerr.ENOENT
+			}
+			return ino, nil
+		}
+		// Fall back to a linear search, as Linux does for directories with
+		// unusable indexes.
+	}
+
+	var found uint32
+	err := in.forEachDirBlock(func(buf []byte) (bool, error) {
+		err := in.image.parseDirents(buf, func(dname []byte, _ uint8, ino uint32) bool {
+			if bytes.Equal(dname, nameBytes) {
+				found = ino
+				return false
+			}
+			return true
+		})
+		return found == 0, err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if found == 0 {
+		return 0, linuxerr.ENOENT
+	}
+	return found, nil
+}
+
+// dxFrame is one level of a path through a directory hash index.
+type dxFrame struct {
+	// entries contains the dx_entries of the index node.
+	entries []byte
+
+	// idx is the index of the current entry in entries.
+	idx int
+}
+
+func (f *dxFrame) count() int {
+	return int(binary.LittleEndian.Uint16(f.entries[2:]))
+}
+
+func (f *dxFrame) hash(i int) uint32 {
+	return binary.LittleEndian.Uint32(f.entries[i*dxEntrySize:])
+}
+
+func (f *dxFrame) block(i int) uint64 {
+	return uint64(binary.LittleEndian.Uint32(f.entries[i*dxEntrySize+4:]) & dxBlockMask)
+}
+
+// dxNode returns a frame for the index node at logical block lblk, with the
+// current entry being the last whose hash is <= hash. Compare Linux's
+// fs/ext4/namei.c:dx_probe().
+func (in *Inode) dxNode(lblk uint64, entriesOff int, hash uint32) (dxFrame, error) {
+	bs := uint64(in.image.blockSize)
+	buf := make([]byte, bs)
+	if _, err := in.ReadAt(buf, lblk*bs); err != nil {
+		return dxFrame{}, err
+	}
+	f := dxFrame{entries: buf[entriesOff:]}
+	limit := int(binary.LittleEndian.Uint16(f.entries[0:]))
+	count := f.count()
+	if count == 0 || count > limit || count*dxEntrySize > len(f.entries) {
+		return dxFrame{}, linuxerr.EUCLEAN
+	}
+	// Binary search for the last entry (excluding the first, whose hash field
+	// is occupied by the count and limit) with hash <= the target hash.
+	lo, hi := 1, count-1
+	for lo <= hi {
+		mid := lo + (hi-lo)/2
+		if f.hash(mid) > hash {
+			hi = mid - 1
+		} else {
+			lo = mid + 1
+		}
+	}
+	f.idx = lo - 1
+	return f, nil
+}
+
+// htreeLookup looks up name in a hash-indexed directory. If ok is false, the
+// index is unusable and the caller should fall back to a linear search.
+// Otherwise, ino is the child's inode number, or 0 if no such child exists.
+// Compare Linux's fs/ext4/namei.c:ext4_dx_find_entry().
+func (in *Inode) htreeLookup(name []byte) (ino uint32, ok bool, err error) {
+	bs := uint64(in.image.blockSize)
+	root := make([]byte, bs)
+	if _, err := in.ReadAt(root, 0); err != nil {
+		return 0, false, err
+	}
+	info := root[dxRootInfoOffset:]
+	version := info[4]
+	infoLen := int(info[5])
+	levels := int(info[6])
+	maxLevels := 2
+	if in.image.sb.FeatureIncompat&FeatureIncompatLargeDir != 0 {
+		maxLevels = 3
+	}
+	if levels >= maxLevels || dxRootInfoOffset+infoLen >= len(root) {
+		return 0, false, nil
+	}
+	if version <= hashTea && in.image.sb.Flags&flagsUnsignedHash != 0 {
+		version += 3
+	}
+	hash, err := dirHash(name, version, in.image.sb.HashSeed)
+	if err != nil {
+		return 0, false, nil
+	}
+
+	frames := make([]dxFrame, 0, levels+1)
+	f, err := in.dxNode(0, dxRootInfoOffset+infoLen, hash)
+	if err != nil {
+		return 0, false, nil
+	}
+	frames = append(frames, f)
+	for len(frames) <= levels {
+		last := &frames[len(frames)-1]
+		f, err := in.dxNode(last.block(last.idx), dxNodeEntriesOffset, hash)
+		if err != nil {
+			return 0, false, nil
+		}
+		frames = append(frames, f)
+	}
+
+	leaf := make([]byte, bs)
+	for {
+		last := &frames[len(frames)-1]
+		if _, err := in.ReadAt(leaf, last.block(last.idx)*bs); err != nil {
+			return 0, true, err
+		}
+		if err := in.image.parseDirents(leaf, func(dname []byte, _ uint8, dino uint32) bool {
+			if bytes.Equal(dname, name) {
+				ino = dino
+				return false
+			}
+			return true
+		}); err != nil {
+			return 0, true, err
+		}
+		if ino != 0 {
+			return ino, true, nil
+		}
+
+		// Entries with colliding hashes may continue into the next leaf
+		// block, in which case the next index entry's hash has its low bit
+		// set. Compare Linux's fs/ext4/namei.c:ext4_htree_next_block().
+		level := len(frames) - 1
+		for level >= 0 && frames[level].idx+1 >= frames[level].count() {
+			level--
+		}
+		if level < 0 {
+			return 0, true, nil
+		}
+		frames[level].idx++
+		if frames[level].hash(frames[level].idx)&^1 != hash {
+			return 0, true, nil
+		}
+		for level++; level < len(frames); level++ {
+			parent := &frames[level-1]
+			f, err := in.dxNode(parent.block(parent.idx), dxNodeEntriesOffset, 0)
+			if err != nil {
+				return 0, true, err
+			}
+			f.idx = 0
+			frames[level] = f
+		}
+	}
+}
@@ -0,0 +1,362 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ext4 provides read-only access to the contents of an ext2, ext3 or
+// ext4 [1] filesystem image.
+//
+// Like package erofs, this package never caches objects internally; every
+// accessor reads the relevant on-disk structures from the underlying device.
+// Callers are expected to cache the objects that they need.
+//
+// [1] https://docs.kernel.org/filesystems/ext4/index.html
+package ext4
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+)
+
+const (
+	// SuperBlockMagic is the value of SuperBlock.Magic.
+	SuperBlockMagic = 0xef53
+
+	// SuperBlockOffset is the offset of the primary superblock on the
+	// device, in bytes.
+	SuperBlockOffset = 1024
+
+	// SuperBlockSize is the size of the on-disk superblock in bytes.
+	SuperBlockSize = 1024
+
+	// RootIno is the inode number of the root directory.
+	RootIno = 2
+
+	// MaxNameLen is the maximum length of a file name.
+	MaxNameLen = 255
+
+	// goodOldInodeSize is the size of inodes in revision 0 filesystems.
+	goodOldInodeSize = 128
+
+	// goodOldFirstIno is the first non-reserved inode in revision 0
+	// filesystems.
+	goodOldFirstIno = 11
+)
+
+// Compatible features. This is not exhaustive; unused features are not
+// listed.
+const (
+	FeatureCompatHasJournal = 0x0004
+	FeatureCompatExtAttr    = 0x0008
+	FeatureCompatDirIndex   = 0x0020
+)
+
+// Read-only compatible features. Since this package never writes to images,
+// all read-only compatible features are supported. This is not exhaustive;
+// unused features are not listed.
+const (
+	FeatureROCompatSparseSuper = 0x0001
+	FeatureROCompatHugeFile    = 0x0008
+)
+
+// Incompatible features. Any features that aren't in FeatureIncompatSupported
+// are incompatible with this implementation.
+const (
+	FeatureIncompatCompression = 0x0001
+	FeatureIncompatFiletype    = 0x0002
+	FeatureIncompatRecover     = 0x0004
+	FeatureIncompatJournalDev  = 0x0008
+	FeatureIncompatMetaBG      = 0x0010
+	FeatureIncompatExtents     = 0x0040
+	FeatureIncompat64Bit       = 0x0080
+	FeatureIncompatMMP         = 0x0100
+	FeatureIncompatFlexBG      = 0x0200
+	FeatureIncompatEAInode     = 0x0400
+	FeatureIncompatDirData     = 0x1000
+	FeatureIncompatCsumSeed    = 0x2000
+	FeatureIncompatLargeDir    = 0x4000
+	FeatureIncompatInlineData  = 0x8000
+	FeatureIncompatEncrypt     = 0x10000
+	FeatureIncompatCasefold    = 0x20000
+
+	FeatureIncompatSupported = FeatureIncompatFiletype | FeatureIncompatRecover |
+		FeatureIncompatMetaBG | FeatureIncompatExtents | FeatureIncompat64Bit |
+		FeatureIncompatMMP | FeatureIncompatFlexBG | FeatureIncompatEAInode |
+		FeatureIncompatCsumSeed | FeatureIncompatLargeDir |
+		FeatureIncompatInlineData
+)
+
+// Superblock flags (SuperBlock.Flags).
+const (
+	flagsUnsignedHash = 0x0002
+)
+
+// SuperBlock contains the fields of the on-disk superblock that are used by
+// this package.
+//
+// +stateify savable
+type SuperBlock struct {
+	InodesCount     uint32
+	BlocksCount     uint64
+	FirstDataBlock  uint32
+	LogBlockSize    uint32
+	BlocksPerGroup  uint32
+	InodesPerGroup  uint32
+	Mtime           uint32
+	Magic           uint16
+	RevLevel        uint32
+	FirstIno        uint32
+	InodeSize       uint16
+	FeatureCompat   uint32
+	FeatureIncompat uint32
+	FeatureROCompat uint32
+	UUID            [16]byte
+	VolumeName      [16]byte
+	HashSeed        [4]uint32
+	DefHashVersion  uint8
+	DescSize        uint16
+	FirstMetaBG     uint32
+	FreeBlocksCount uint64
+	FreeInodesCount uint32
+	Flags           uint32
+}
+
+// parseSuperBlock decodes the on-disk superblock in b.
+func parseSuperBlock(b []byte) SuperBlock {
+	le := binary.LittleEndian
+	sb := SuperBlock{
+		InodesCount:     le.Uint32(b[0:]),
+		BlocksCount:     uint64(le.Uint32(b[4:])),
+		FreeBlocksCount: uint64(le.Uint32(b[12:])),
+		FreeInodesCount: le.Uint32(b[16:]),
+		FirstDataBlock:  le.Uint32(b[20:]),
+		LogBlockSize:    le.Uint32(b[24:]),
+		BlocksPerGroup:  le.Uint32(b[32:]),
+		InodesPerGroup:  le.Uint32(b[40:]),
+		Mtime:           le.Uint32(b[44:]),
+		Magic:           le.Uint16(b[56:]),
+		RevLevel:        le.Uint32(b[76:]),
+		FirstIno:        goodOldFirstIno,
+		InodeSize:       goodOldInodeSize,
+		FeatureCompat:   le.Uint32(b[92:]),
+		FeatureIncompat: le.Uint32(b[96:]),
+		FeatureROCompat: le.Uint32(b[100:]),
+		DefHashVersion:  b[252],
+		DescSize:        le.Uint16(b[254:]),
+		FirstMetaBG:     le.Uint32(b[260:]),
+		Flags:           le.Uint32(b[352:]),
+	}
+	if sb.RevLevel != 0 {
+		sb.FirstIno = le.Uint32(b[84:])
+		sb.InodeSize = le.Uint16(b[88:])
+	}
+	copy(sb.UUID[:], b[104:120])
+	copy(sb.VolumeName[:], b[120:136])
+	for i := range sb.HashSeed {
+		sb.HashSeed[i] = le.Uint32(b[236+4*i:])
+	}
+	if sb.FeatureIncompat&FeatureIncompat64Bit != 0 {
+		sb.BlocksCount |= uint64(le.Uint32(b[336:])) << 32
+		sb.FreeBlocksCount |= uint64(le.Uint32(b[344:])) << 32
+	}
+	return sb
+}
+
+// BlockSize returns the block size in bytes.
+func (sb *SuperBlock) BlockSize() uint32 {
+	return 1024 << sb.LogBlockSize
+}
+
+// groupDescSize returns the size of each block group descriptor.
+func (sb *SuperBlock) groupDescSize() uint32 {
+	if sb.FeatureIncompat&FeatureIncompat64Bit != 0 && sb.DescSize != 0 {
+		return uint32(sb.DescSize)
+	}
+	return 32
+}
+
+// groupCount returns the number of block groups. Preconditions:
+// sb.BlocksCount > sb.FirstDataBlock.
+func (sb *SuperBlock) groupCount() uint64 {
+	n := sb.BlocksCount - uint64(sb.FirstDataBlock)
+	return (n + uint64(sb.BlocksPerGroup) - 1) / uint64(sb.BlocksPerGroup)
+}
+
+// groupHasSuper returns true if block group g contains a superblock backup.
+func (sb *SuperBlock) groupHasSuper(g uint64) bool {
+	if g <= 1 || sb.FeatureROCompat&FeatureROCompatSparseSuper == 0 {
+		return true
+	}
+	if g&1 == 0 {
+		return false
+	}
+	for _, base := range []uint64{3, 5, 7} {
+		n := base
+		for n < g {
+			n *= base
+		}
+		if n == g {
+			return true
+		}
+	}
+	return false
+}
+
+// Image represents an open ext4 image.
+//
+// +stateify savable
+type Image struct {
+	// dev is the device containing the image.
+	dev io.ReaderAt
+
+	// sb is the image's superblock.
+	sb SuperBlock
+
+	// blockSize is sb.BlockSize(), cached for convenience.
+	blockSize uint32
+
+	// inodeTables contains the first block of the inode table for each block
+	// group.
+	inodeTables []uint64
+}
+
+// OpenImage returns an Image for the filesystem on dev, which is size bytes
+// long.
+func OpenImage(dev io.ReaderAt, size int64) (*Image, error) {
+	buf := make([]byte, SuperBlockSize)
+	if _, err := dev.ReadAt(buf, SuperBlockOffset); err != nil {
+		return nil, fmt.Errorf("failed to read superblock: %w", err)
+	}
+	sb := parseSuperBlock(buf)
+	if sb.Magic != SuperBlockMagic {
+		return nil, fmt.Errorf("unknown magic: 0x%x", sb.Magic)
+	}
+	if sb.LogBlockSize > 6 {
+		return nil, fmt.Errorf("unsupported block size: log %d", sb.LogBlockSize)
+	}
+	if unsupported := sb.FeatureIncompat &^ FeatureIncompatSupported; unsupported != 0 {
+		return nil, fmt.Errorf("unsupported incompatible features: 0x%x", unsupported)
+	}
+	if sb.BlocksPerGroup == 0 || sb.InodesPerGroup == 0 {
+		return nil, fmt.Errorf("invalid superblock: %d blocks and %d inodes per group", sb.BlocksPerGroup, sb.InodesPerGroup)
+	}
+	if sb.InodeSize < goodOldInodeSize || sb.InodeSize&(sb.InodeSize-1) != 0 || uint32(sb.InodeSize) > sb.BlockSize() {
+		return nil, fmt.Errorf("invalid inode size: %d", sb.InodeSize)
+	}
+	if descSize := sb.groupDescSize(); descSize < 32 || descSize&(descSize-1) != 0 || descSize > sb.BlockSize() {
+		return nil, fmt.Errorf("invalid group descriptor size: %d", descSize)
+	}
+	// The number of block groups, and hence the size of inodeTables, is
+	// derived from BlocksCount, so it must be bounded by the device size
+	// before anything is allocated.
+	if sb.BlocksCount <= uint64(sb.FirstDataBlock) {
+		return nil, fmt.Errorf("invalid superblock: %d blocks, first data block %d", sb.BlocksCount, sb.FirstDataBlock)
+	}
+	if size < 0 || sb.BlocksCount > uint64(size)/uint64(sb.BlockSize()) {
+		return nil, fmt.Errorf("filesystem has %d blocks of %d bytes, but the device is only %d bytes", sb.BlocksCount, sb.BlockSize(), size)
+	}
+
+	i := &Image{
+		dev:       dev,
+		sb:        sb,
+		blockSize: sb.BlockSize(),
+	}
+	if err := i.readGroupDescriptors(); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// readGroupDescriptors initializes i.inodeTables.
+func (i *Image) readGroupDescriptors() error {
+	le := binary.LittleEndian
+	groups := i.sb.groupCount()
+	descSize := uint64(i.sb.groupDescSize())
+	descsPerBlock := uint64(i.blockSize) / descSize
+	i.inodeTables = make([]uint64, groups)
+	buf := make([]byte, i.blockSize)
+	for blk := uint64(0); blk*descsPerBlock < groups; blk++ {
+		if err := i.readBlock(i.groupDescBlock(blk, descsPerBlock), buf); err != nil {
+			return fmt.Errorf("failed to read group descriptors: %w", err)
+		}
+		for j := uint64(0); j < descsPerBlock; j++ {
+			g := blk*descsPerBlock + j
+			if g >= groups {
+				break
+			}
+			desc := buf[j*descSize : (j+1)*descSize]
+			table := uint64(le.Uint32(desc[8:]))
+			if descSize >= 64 {
+				table |= uint64(le.Uint32(desc[40:])) << 32
+			}
+			if table == 0 || table >= i.sb.BlocksCount {
+				return fmt.Errorf("invalid inode table block %d for group %d", table, g)
+			}
+			i.inodeTables[g] = table
+		}
+	}
+	return nil
+}
+
+// groupDescBlock returns the location of the blk'th block of group
+// descriptors. Compare Linux's fs/ext4/super.c:descriptor_loc().
+func (i *Image) groupDescBlock(blk, descsPerBlock uint64) uint64 {
+	first := uint64(i.sb.FirstDataBlock)
+	if i.sb.FeatureIncompat&FeatureIncompatMetaBG == 0 || blk < uint64(i.sb.FirstMetaBG) {
+		return first + 1 + blk
+	}
+	// With meta_bg, each block of descriptors is stored in the first group
+	// of the "meta group" that it describes.
+	g := blk * descsPerBlock
+	b := first + g*uint64(i.sb.BlocksPerGroup)
+	if i.sb.groupHasSuper(g) {
+		b++
+	}
+	return b
+}
+
+// SuperBlock returns a copy of the image's superblock.
+func (i *Image) SuperBlock() SuperBlock {
+	return i.sb
+}
+
+// BlockSize returns the block size of the image.
+func (i *Image) BlockSize() uint32 {
+	return i.blockSize
+}
+
+// Blocks returns the number of blocks in the image.
+func (i *Image) Blocks() uint64 {
+	return i.sb.BlocksCount
+}
+
+// readBlock reads the block at physical block number blk into buf, which
+// must be at most one block in length.
+func (i *Image) readBlock(blk uint64, buf []byte) error {
+	return i.readAt(buf, blk*uint64(i.blockSize))
+}
+
+// readAt fills buf from the device at offset off.
+func (i *Image) readAt(buf []byte, off uint64) error {
+	n, err := i.dev.ReadAt(buf, int64(off))
+	if n == len(buf) {
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		// The image is truncated.
+		return linuxerr.EUCLEAN
+	}
+	return err
+}
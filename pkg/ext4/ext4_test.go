@@ -0,0 +1,167 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ext4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestDirHash(t *testing.T) {
+	// Expected values were obtained using debugfs's dx_hash command with the
+	// seed 01234567-89ab-cdef-0123-456789abcdef.
+	seed := [4]uint32{0x67452301, 0xefcdab89, 0x67452301, 0xefcdab89}
+	for _, test := range []struct {
+		name    string
+		version uint8
+		want    uint32
+	}{
+		{"a", hashLegacy, 0xe74b53e2},
+		{"hello.txt", hashLegacy, 0x65a05776},
+		{"xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx", hashLegacy, 0x382d277e},
+		{"\xc3\xa9t\xc3\xa9", hashLegacy, 0x70d7b7fc},
+		{"\xc3\xa9t\xc3\xa9", hashLegacyUnsigned, 0x40d0f40c},
+		{"a", hashHalfMD4, 0x35dc0cc4},
+		{"hello.txt", hashHalfMD4, 0x42a85304},
+		{"xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx", hashHalfMD4, 0x509021ca},
+		{"\xc3\xa9t\xc3\xa9", hashHalfMD4, 0xff329f74},
+		{"\xc3\xa9t\xc3\xa9", hashHalfMD4Unsigned, 0x354475ae},
+		{"a", hashTea, 0x6d0ea4c0},
+		{"hello.txt", hashTea, 0x5107c3f2},
+		{"xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx", hashTea, 0xb3f4bbfc},
+		{"\xc3\xa9t\xc3\xa9", hashTea, 0x04d337a6},
+		{"\xc3\xa9t\xc3\xa9", hashTeaUnsigned, 0x2ed2feac},
+	} {
+		got, err := dirHash([]byte(test.name), test.version, seed)
+		if err != nil {
+			t.Errorf("dirHash(%q, %d) failed: %v", test.name, test.version, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("dirHash(%q, %d): got %#x, want %#x", test.name, test.version, got, test.want)
+		}
+	}
+}
+
+func TestConvertACL(t *testing.T) {
+	disk := []byte{
+		0x01, 0x00, 0x00, 0x00, // version
+		0x01, 0x00, 0x06, 0x00, // ACL_USER_OBJ rw-
+		0x02, 0x00, 0x06, 0x00, 0xd2, 0x04, 0x00, 0x00, // ACL_USER 1234 rw-
+		0x04, 0x00, 0x04, 0x00, // ACL_GROUP_OBJ r--
+		0x10, 0x00, 0x06, 0x00, // ACL_MASK rw-
+		0x20, 0x00, 0x04, 0x00, // ACL_OTHER r--
+	}
+	want := []byte{
+		0x02, 0x00, 0x00, 0x00,
+		0x01, 0x00, 0x06, 0x00, 0xff, 0xff, 0xff, 0xff,
+		0x02, 0x00, 0x06, 0x00, 0xd2, 0x04, 0x00, 0x00,
+		0x04, 0x00, 0x04, 0x00, 0xff, 0xff, 0xff, 0xff,
+		0x10, 0x00, 0x06, 0x00, 0xff, 0xff, 0xff, 0xff,
+		0x20, 0x00, 0x04, 0x00, 0xff, 0xff, 0xff, 0xff,
+	}
+	got, err := convertACL(disk)
+	if err != nil {
+		t.Fatalf("convertACL failed: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("convertACL: got %x, want %x", got, want)
+	}
+	if _, err := convertACL(disk[:10]); err == nil {
+		t.Errorf("convertACL succeeded on truncated ACL")
+	}
+}
+
+// testImage returns a minimal image with 1KiB blocks and a single block group
+// whose superblock is modified by f.
+func testImage(f func(sb []byte)) []byte {
+	const (
+		blockSize = 1024
+		blocks    = 64
+	)
+	le := binary.LittleEndian
+	img := make([]byte, blocks*blockSize)
+	sb := img[SuperBlockOffset : SuperBlockOffset+SuperBlockSize]
+	le.PutUint32(sb[4:], blocks) // BlocksCount
+	le.PutUint32(sb[20:], 1)     // FirstDataBlock
+	le.PutUint32(sb[32:], 8192)  // BlocksPerGroup
+	le.PutUint32(sb[40:], 16)    // InodesPerGroup
+	le.PutUint16(sb[56:], SuperBlockMagic)
+	// The group descriptors follow the superblock, in block 2.
+	le.PutUint32(img[2*blockSize+8:], 8) // Inode table
+	f(sb)
+	return img
+}
+
+func TestOpenImageCraftedSuperBlock(t *testing.T) {
+	le := binary.LittleEndian
+	for _, test := range []struct {
+		name string
+		sb   func(sb []byte)
+		want string
+	}{
+		{
+			name: "valid",
+			sb:   func(sb []byte) {},
+		},
+		{
+			name: "huge block count",
+			sb: func(sb []byte) {
+				le.PutUint32(sb[96:], FeatureIncompat64Bit)
+				le.PutUint32(sb[4:], 0xffffffff)
+				le.PutUint32(sb[336:], 0xffffffff)
+				le.PutUint32(sb[32:], 1) // BlocksPerGroup
+			},
+			want: "but the device is only",
+		},
+		{
+			name: "block count larger than device",
+			sb: func(sb []byte) {
+				le.PutUint32(sb[4:], 65)
+			},
+			want: "but the device is only",
+		},
+		{
+			name: "block count below first data block",
+			sb: func(sb []byte) {
+				le.PutUint32(sb[4:], 0)
+			},
+			want: "first data block",
+		},
+		{
+			name: "block count equal to first data block",
+			sb: func(sb []byte) {
+				le.PutUint32(sb[4:], 1)
+			},
+			want: "first data block",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			img := testImage(test.sb)
+			_, err := OpenImage(bytes.NewReader(img), int64(len(img)))
+			if test.want == "" {
+				if err != nil {
+					t.Fatalf("OpenImage failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("OpenImage: got error %v, want error containing %q", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ext4
+
+import (
+	"math/bits"
+
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+)
+
+// Directory hash versions. Compare Linux's fs/ext4/ext4.h.
+const (
+	hashLegacy          = 0
+	hashHalfMD4         = 1
+	hashTea             = 2
+	hashLegacyUnsigned  = 3
+	hashHalfMD4Unsigned = 4
+	hashTeaUnsigned     = 5
+	hashSiphash         = 6
+)
+
+// htreeEOF32 is the 32-bit hash value reserved to indicate the end of a
+// directory.
+const htreeEOF32 = 0x7fffffff
+
+// teaTransform implements Linux's fs/ext4/hash.c:TEA_transform().
+func teaTransform(buf *[4]uint32, in []uint32) {
+	const delta = 0x9e3779b9
+	var sum uint32
+	b0, b1 := buf[0], buf[1]
+	a, b, c, d := in[0], in[1], in[2], in[3]
+	for n := 0; n < 16; n++ {
+		sum += delta
+		b0 += ((b1 << 4) + a) ^ (b1 + sum) ^ ((b1 >> 5) + b)
+		b1 += ((b0 << 4) + c) ^ (b0 + sum) ^ ((b0 >> 5) + d)
+	}
+	buf[0] += b0
+	buf[1] += b1
+}
+
+// halfMD4Transform implements Linux's fs/ext4/hash.c:half_md4_transform().
+func halfMD4Transform(buf *[4]uint32, in []uint32) {
+	const (
+		k1 = 0
+		k2 = 013240474631
+		k3 = 015666365641
+	)
+	f := func(x, y, z uint32) uint32 { return z ^ (x & (y ^ z)) }
+	g := func(x, y, z uint32) uint32 { return (x & y) + ((x ^ y) & z) }
+	h := func(x, y, z uint32) uint32 { return x ^ y ^ z }
+	round := func(fn func(x, y, z uint32) uint32, a *uint32, b, c, d, x uint32, s int) {
+		*a = bits.RotateLeft32(*a+fn(b, c, d)+x, s)
+	}
+	a, b, c, d := buf[0], buf[1], buf[2], buf[3]
+
+	// Round 1.
+	round(f, &a, b, c, d, in[0]+k1, 3)
+	round(f, &d, a, b, c, in[1]+k1, 7)
+	round(f, &c, d, a, b, in[2]+k1, 11)
+	round(f, &b, c, d, a, in[3]+k1, 19)
+	round(f, &a, b, c, d, in[4]+k1, 3)
+	round(f, &d, a, b, c, in[5]+k1, 7)
+	round(f, &c, d, a, b, in[6]+k1, 11)
+	round(f, &b, c, d, a, in[7]+k1, 19)
+
+	// Round 2.
+	round(g, &a, b, c, d, in[1]+k2, 3)
+	round(g, &d, a, b, c, in[3]+k2, 5)
+	round(g, &c, d, a, b, in[5]+k2, 9)
+	round(g, &b, c, d, a, in[7]+k2, 13)
+	round(g, &a, b, c, d, in[0]+k2, 3)
+	round(g, &d, a, b, c, in[2]+k2, 5)
+	round(g, &c, d, a, b, in[4]+k2, 9)
+	round(g, &b, c, d, a, in[6]+k2, 13)
+
+	// Round 3.
+	round(h, &a, b, c, d, in[3]+k3, 3)
+	round(h, &d, a, b, c, in[7]+k3, 9)
+	round(h, &c, d, a, b, in[2]+k3, 11)
+	round(h, &b, c, d, a, in[6]+k3, 15)
+	round(h, &a, b, c, d, in[1]+k3, 3)
+	round(h, &d, a, b, c, in[5]+k3, 9)
+	round(h, &c, d, a, b, in[0]+k3, 11)
+	round(h, &b, c, d, a, in[4]+k3, 15)
+
+	buf[0] += a
+	buf[1] += b
+	buf[2] += c
+	buf[3] += d
+}
+
+// legacyHash implements Linux's fs/ext4/hash.c:dx_hack_hash_{signed,unsigned}().
+func legacyHash(name []byte, unsigned bool) uint32 {
+	hash0, hash1 := uint32(0x12a3fe2d), uint32(0x37abe8f9)
+	for _, c := range name {
+		v := uint32(c)
+		if !unsigned {
+			v = uint32(int32(int8(c)))
+		}
+		hash := hash1 + (hash0 ^ (v * 7152373))
+		if hash&0x80000000 != 0 {
+			hash -= 0x7fffffff
+		}
+		hash1 = hash0
+		hash0 = hash
+	}
+	return hash0 << 1
+}
+
+// str2hashbuf implements Linux's fs/ext4/hash.c:str2hashbuf_{signed,unsigned}().
+func str2hashbuf(msg []byte, buf []uint32, unsigned bool) {
+	num := len(buf)
+	pad := uint32(len(msg)) | uint32(len(msg))<<8
+	pad |= pad << 16
+	val := pad
+	if len(msg) > num*4 {
+		msg = msg[:num*4]
+	}
+	j := 0
+	for i, c := range msg {
+		v := uint32(c)
+		if !unsigned {
+			v = uint32(int32(int8(c)))
+		}
+		val = v + (val << 8)
+		if i%4 == 3 {
+			buf[j] = val
+			j++
+			val = pad
+		}
+	}
+	if j < num {
+		buf[j] = val
+		j++
+	}
+	for ; j < num; j++ {
+		buf[j] = pad
+	}
+}
+
+// dirHash returns the major hash of a directory entry name, as used by
+// hash-indexed directories. Compare Linux's
+// fs/ext4/hash.c:__ext4fs_dirhash().
+func dirHash(name []byte, version uint8, seed [4]uint32) (uint32, error) {
+	buf := [4]uint32{0x67452301, 0xefcdab89, 0x98badcfe, 0x10325476}
+	if seed != [4]uint32{} {
+		buf = seed
+	}
+
+	var hash uint32
+	switch version {
+	case hashLegacy, hashLegacyUnsigned:
+		hash = legacyHash(name, version == hashLegacyUnsigned)
+	case hashHalfMD4, hashHalfMD4Unsigned:
+		var in [8]uint32
+		for p := name; len(p) > 0; {
+			str2hashbuf(p, in[:], version == hashHalfMD4Unsigned)
+			halfMD4Transform(&buf, in[:])
+			if len(p) <= 32 {
+				break
+			}
+			p = p[32:]
+		}
+		hash = buf[1]
+	case hashTea, hashTeaUnsigned:
+		var in [4]uint32
+		for p := name; len(p) > 0; {
+			str2hashbuf(p, in[:], version == hashTeaUnsigned)
+			teaTransform(&buf, in[:])
+			if len(p) <= 16 {
+				break
+			}
+			p = p[16:]
+		}
+		hash = buf[0]
+	default:
+		// hashSiphash is only used by casefolded directories, which are
+		// unsupported.
+		return 0, linuxerr.EOPNOTSUPP
+	}
+
+	hash &^= 1
+	if hash == htreeEOF32<<1 {
+		hash = (htreeEOF32 - 1) << 1
+	}
+	return hash, nil
+}
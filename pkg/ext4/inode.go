@@ -0,0 +1,296 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ext4
+
+import (
+	"encoding/binary"
+
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+)
+
+// Inode flags. This is not exhaustive; unused flags are not listed.
+const (
+	InodeFlagEncrypt    = 0x800
+	InodeFlagIndex      = 0x1000
+	InodeFlagHugeFile   = 0x40000
+	InodeFlagExtents    = 0x80000
+	InodeFlagEAInode    = 0x200000
+	InodeFlagInlineData = 0x10000000
+	InodeFlagCasefold   = 0x40000000
+)
+
+const (
+	// inodeBlockSize is the size of Inode.block, i.e. i_block.
+	inodeBlockSize = 60
+
+	// File type bits of the mode, from include/uapi/linux/stat.h.
+	modeTypeMask = 0170000
+	modeDir      = 0040000
+	modeRegular  = 0100000
+	modeSymlink  = 0120000
+)
+
+// Timestamp is an inode timestamp.
+//
+// +stateify savable
+type Timestamp struct {
+	Sec  int64
+	Nsec uint32
+}
+
+// Inode represents an on-disk inode.
+//
+// +stateify savable
+type Inode struct {
+	image *Image
+
+	ino        uint32
+	mode       uint16
+	uid        uint32
+	gid        uint32
+	size       uint64
+	nlink      uint16
+	blocks     uint64
+	flags      uint32
+	generation uint32
+	fileACL    uint64
+	atime      Timestamp
+	ctime      Timestamp
+	mtime      Timestamp
+	crtime     Timestamp
+
+	// block is i_block, which holds the block map, extent tree root, inline
+	// data or fast symlink target.
+	block [inodeBlockSize]byte
+
+	// inlineXattrs is the in-inode extended attribute area, or nil if the
+	// inode has none.
+	inlineXattrs []byte
+}
+
+// Inode returns the inode with the given inode number.
+func (i *Image) Inode(ino uint32) (Inode, error) {
+	if ino == 0 || ino > i.sb.InodesCount {
+		return Inode{}, linuxerr.EUCLEAN
+	}
+	group := uint64(ino-1) / uint64(i.sb.InodesPerGroup)
+	index := uint64(ino-1) % uint64(i.sb.InodesPerGroup)
+	if group >= uint64(len(i.inodeTables)) {
+		return Inode{}, linuxerr.EUCLEAN
+	}
+	inodeSize := uint64(i.sb.InodeSize)
+	buf := make([]byte, inodeSize)
+	if err := i.readAt(buf, i.inodeTables[group]*uint64(i.blockSize)+index*inodeSize); err != nil {
+		return Inode{}, err
+	}
+	return i.parseInode(ino, buf)
+}
+
+// parseInode decodes the on-disk inode in buf.
+func (i *Image) parseInode(ino uint32, buf []byte) (Inode, error) {
+	le := binary.LittleEndian
+	in := Inode{
+		image:      i,
+		ino:        ino,
+		mode:       le.Uint16(buf[0:]),
+		uid:        uint32(le.Uint16(buf[2:])) | uint32(le.Uint16(buf[120:]))<<16,
+		size:       uint64(le.Uint32(buf[4:])) | uint64(le.Uint32(buf[108:]))<<32,
+		gid:        uint32(le.Uint16(buf[24:])) | uint32(le.Uint16(buf[122:]))<<16,
+		nlink:      le.Uint16(buf[26:]),
+		blocks:     uint64(le.Uint32(buf[28:])),
+		flags:      le.Uint32(buf[32:]),
+		generation: le.Uint32(buf[100:]),
+		fileACL:    uint64(le.Uint32(buf[104:])) | uint64(le.Uint16(buf[118:]))<<32,
+	}
+	copy(in.block[:], buf[40:40+inodeBlockSize])
+	if i.sb.FeatureROCompat&FeatureROCompatHugeFile != 0 {
+		in.blocks |= uint64(le.Uint16(buf[116:])) << 32
+		if in.flags&InodeFlagHugeFile != 0 {
+			// i_blocks is in units of filesystem blocks rather than sectors.
+			in.blocks *= uint64(i.blockSize / 512)
+		}
+	}
+
+	// Decode timestamps, including the extra precision and range stored in
+	// the inode's extra space if present.
+	var extraSize uint64
+	if len(buf) > goodOldInodeSize {
+		extraSize = uint64(le.Uint16(buf[128:]))
+		if goodOldInodeSize+extraSize > uint64(len(buf)) {
+			return Inode{}, linuxerr.EUCLEAN
+		}
+	}
+	decodeTime := func(off, extraOff uint64) Timestamp {
+		ts := Timestamp{Sec: int64(int32(le.Uint32(buf[off:])))}
+		if extraOff+4 <= goodOldInodeSize+extraSize {
+			extra := le.Uint32(buf[extraOff:])
+			ts.Sec += int64(extra&3) << 32
+			ts.Nsec = extra >> 2
+		}
+		return ts
+	}
+	in.atime = decodeTime(8, 140)
+	in.ctime = decodeTime(12, 132)
+	in.mtime = decodeTime(16, 136)
+	if 148 <= goodOldInodeSize+extraSize {
+		in.crtime = decodeTime(144, 148)
+	}
+
+	// In-inode extended attributes follow the extra fields, starting with
+	// a magic number.
+	if xoff := goodOldInodeSize + extraSize; extraSize != 0 && xoff+4 <= uint64(len(buf)) {
+		if le.Uint32(buf[xoff:]) == xattrMagic {
+			in.inlineXattrs = buf[xoff+4:]
+		}
+	}
+	return in, nil
+}
+
+// Ino returns the inode number.
+func (in *Inode) Ino() uint32 {
+	return in.ino
+}
+
+// Mode returns the file mode, including the file type.
+func (in *Inode) Mode() uint16 {
+	return in.mode
+}
+
+// UID returns the file owner.
+func (in *Inode) UID() uint32 {
+	return in.uid
+}
+
+// GID returns the file group.
+func (in *Inode) GID() uint32 {
+	return in.gid
+}
+
+// Size returns the file size in bytes.
+func (in *Inode) Size() uint64 {
+	return in.size
+}
+
+// Nlink returns the file's link count.
+func (in *Inode) Nlink() uint32 {
+	return uint32(in.nlink)
+}
+
+// Blocks returns the number of 512-byte sectors allocated to the file,
+// including extended attribute blocks.
+func (in *Inode) Blocks() uint64 {
+	return in.blocks
+}
+
+// Flags returns the inode flags.
+func (in *Inode) Flags() uint32 {
+	return in.flags
+}
+
+// Generation returns the inode's generation number.
+func (in *Inode) Generation() uint32 {
+	return in.generation
+}
+
+// Atime returns the file's last access time.
+func (in *Inode) Atime() Timestamp {
+	return in.atime
+}
+
+// Ctime returns the file's last status change time.
+func (in *Inode) Ctime() Timestamp {
+	return in.ctime
+}
+
+// Mtime returns the file's last modification time.
+func (in *Inode) Mtime() Timestamp {
+	return in.mtime
+}
+
+// Crtime returns the file's creation time, or the zero Timestamp if the
+// inode does not record a creation time.
+func (in *Inode) Crtime() Timestamp {
+	return in.crtime
+}
+
+// IsDir returns true if the inode is a directory.
+func (in *Inode) IsDir() bool {
+	return in.mode&modeTypeMask == modeDir
+}
+
+// IsRegular returns true if the inode is a regular file.
+func (in *Inode) IsRegular() bool {
+	return in.mode&modeTypeMask == modeRegular
+}
+
+// IsSymlink returns true if the inode is a symbolic link.
+func (in *Inode) IsSymlink() bool {
+	return in.mode&modeTypeMask == modeSymlink
+}
+
+// DeviceNumber returns the device number of a character or block device
+// inode, in the encoding used by linux.DecodeDeviceID.
+func (in *Inode) DeviceNumber() uint32 {
+	le := binary.LittleEndian
+	// Old-style (8-bit major and minor) device numbers are stored in
+	// i_block[0], and are a subset of the new-style encoding. New-style
+	// device numbers are stored in i_block[1] with i_block[0] zeroed.
+	if old := le.Uint32(in.block[0:]); old != 0 {
+		return old
+	}
+	return le.Uint32(in.block[4:])
+}
+
+// hasInlineData returns true if the inode's data is stored inline.
+func (in *Inode) hasInlineData() bool {
+	return in.flags&InodeFlagInlineData != 0
+}
+
+// isFastSymlink returns true if the inode is a symlink whose target is stored
+// in i_block. Compare Linux's fs/ext4/inode.c:ext4_inode_is_fast_symlink().
+func (in *Inode) isFastSymlink() bool {
+	if !in.IsSymlink() || in.hasInlineData() {
+		return false
+	}
+	if in.flags&InodeFlagEAInode != 0 {
+		return in.size != 0 && in.size < inodeBlockSize
+	}
+	var eaBlocks uint64
+	if in.fileACL != 0 {
+		eaBlocks = uint64(in.image.blockSize / 512)
+	}
+	return in.blocks-eaBlocks == 0
+}
+
+// Readlink returns the target of a symbolic link.
+func (in *Inode) Readlink() (string, error) {
+	if !in.IsSymlink() {
+		return "", linuxerr.EINVAL
+	}
+	if in.isFastSymlink() {
+		if in.size > inodeBlockSize {
+			return "", linuxerr.EUCLEAN
+		}
+		return string(in.block[:in.size]), nil
+	}
+	if in.size > uint64(in.image.blockSize) {
+		return "", linuxerr.EUCLEAN
+	}
+	buf := make([]byte, in.size)
+	if _, err := in.ReadAt(buf, 0); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
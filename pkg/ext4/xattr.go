@@ -0,0 +1,258 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ext4
+
+import (
+	"encoding/binary"
+
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+)
+
+const (
+	// xattrMagic is the magic number at the start of extended attribute
+	// blocks and in-inode extended attribute areas.
+	xattrMagic = 0xea020000
+
+	// xattrBlockHeaderSize is the size of the header of an extended
+	// attribute block.
+	xattrBlockHeaderSize = 32
+
+	// xattrEntrySize is the size of an extended attribute entry, excluding
+	// its name.
+	xattrEntrySize = 16
+
+	// Extended attribute name indexes. Compare Linux's fs/ext4/xattr.h.
+	xattrIndexUser            = 1
+	xattrIndexPosixACLAccess  = 2
+	xattrIndexPosixACLDefault = 3
+	xattrIndexTrusted         = 4
+	xattrIndexSecurity        = 6
+	xattrIndexSystem          = 7
+	xattrIndexRichACL         = 8
+
+	// ext4 POSIX ACL format. Compare Linux's fs/ext4/acl.h.
+	ext4ACLVersion = 1
+
+	// POSIX ACL extended attribute format. Compare Linux's
+	// include/uapi/linux/posix_acl_xattr.h.
+	posixACLXattrVersion = 2
+	aclUndefinedID       = 0xffffffff
+
+	// ACL entry tags. Compare Linux's include/uapi/linux/posix_acl.h.
+	aclUser     = 0x02
+	aclGroup    = 0x08
+	aclUserObj  = 0x01
+	aclGroupObj = 0x04
+	aclMask     = 0x10
+	aclOther    = 0x20
+)
+
+// xattrPrefixes maps extended attribute name indexes to name prefixes.
+var xattrPrefixes = map[uint8]string{
+	xattrIndexUser:            "user.",
+	xattrIndexPosixACLAccess:  "system.posix_acl_access",
+	xattrIndexPosixACLDefault: "system.posix_acl_default",
+	xattrIndexTrusted:         "trusted.",
+	xattrIndexSecurity:        "security.",
+	xattrIndexSystem:          "system.",
+	xattrIndexRichACL:         "system.richacl",
+}
+
+// xattrEntry is a decoded extended attribute entry.
+type xattrEntry struct {
+	index uint8
+	name  string
+
+	// If valueInum is non-zero, the value is stored as the data of inode
+	// valueInum. Otherwise, the value is valueSize bytes at valueOff in area.
+	valueInum uint32
+	valueOff  uint32
+	valueSize uint32
+	area      []byte
+}
+
+// fullName returns the full name of the extended attribute, or "" if its name
+// index is unknown.
+func (e *xattrEntry) fullName() string {
+	prefix, ok := xattrPrefixes[e.index]
+	if !ok {
+		return ""
+	}
+	return prefix + e.name
+}
+
+// value returns the raw value of the extended attribute.
+func (e *xattrEntry) value(img *Image) ([]byte, error) {
+	val := make([]byte, e.valueSize)
+	if e.valueInum != 0 {
+		vin, err := img.Inode(e.valueInum)
+		if err != nil {
+			return nil, err
+		}
+		if vin.flags&InodeFlagEAInode == 0 || vin.size != uint64(e.valueSize) {
+			return nil, linuxerr.EUCLEAN
+		}
+		if _, err := vin.ReadAt(val, 0); err != nil {
+			return nil, err
+		}
+		return val, nil
+	}
+	if uint64(e.valueOff)+uint64(e.valueSize) > uint64(len(e.area)) {
+		return nil, linuxerr.EUCLEAN
+	}
+	copy(val, e.area[e.valueOff:])
+	return val, nil
+}
+
+// parseXattrEntries decodes the extended attribute entries in entries. Value
+// offsets are relative to area. Compare Linux's
+// fs/ext4/xattr.c:ext4_xattr_list_entries().
+func parseXattrEntries(entries, area []byte, cb func(e *xattrEntry) bool) error {
+	le := binary.LittleEndian
+	for off := 0; off+4 <= len(entries) && le.Uint32(entries[off:]) != 0; {
+		if off+xattrEntrySize > len(entries) {
+			return linuxerr.EUCLEAN
+		}
+		nameLen := int(entries[off])
+		if off+xattrEntrySize+nameLen > len(entries) {
+			return linuxerr.EUCLEAN
+		}
+		e := xattrEntry{
+			index:     entries[off+1],
+			name:      string(entries[off+xattrEntrySize : off+xattrEntrySize+nameLen]),
+			valueOff:  uint32(le.Uint16(entries[off+2:])),
+			valueInum: le.Uint32(entries[off+4:]),
+			valueSize: le.Uint32(entries[off+8:]),
+			area:      area,
+		}
+		if !cb(&e) {
+			return nil
+		}
+		off += (xattrEntrySize + nameLen + 3) &^ 3
+	}
+	return nil
+}
+
+// forEachXattr invokes cb on each of the inode's extended attributes, first
+// those stored in the inode and then those stored in its extended attribute
+// block, until cb returns false.
+func (in *Inode) forEachXattr(cb func(e *xattrEntry) bool) error {
+	stopped := false
+	wrapped := func(e *xattrEntry) bool {
+		if !cb(e) {
+			stopped = true
+			return false
+		}
+		return true
+	}
+	if in.inlineXattrs != nil {
+		if err := parseXattrEntries(in.inlineXattrs, in.inlineXattrs, wrapped); err != nil {
+			return err
+		}
+		if stopped {
+			return nil
+		}
+	}
+	if in.fileACL == 0 {
+		return nil
+	}
+	buf := make([]byte, in.image.blockSize)
+	if err := in.image.readBlock(in.fileACL, buf); err != nil {
+		return err
+	}
+	if binary.LittleEndian.Uint32(buf[0:]) != xattrMagic {
+		return linuxerr.EUCLEAN
+	}
+	return parseXattrEntries(buf[xattrBlockHeaderSize:], buf, wrapped)
+}
+
+// ListXattrs returns the names of the inode's extended attributes.
+func (in *Inode) ListXattrs() ([]string, error) {
+	var names []string
+	err := in.forEachXattr(func(e *xattrEntry) bool {
+		// The "system.data" attribute holds inline data and is not visible
+		// to users.
+		if name := e.fullName(); name != "" && name != "system.data" {
+			names = append(names, name)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// Xattr returns the value of the inode's extended attribute with the given
+// name, or ENODATA if no such attribute exists. POSIX ACLs are returned in the
+// format used by the getxattr(2) syscall.
+func (in *Inode) Xattr(name string) ([]byte, error) {
+	var found *xattrEntry
+	if err := in.forEachXattr(func(e *xattrEntry) bool {
+		if e.fullName() == name {
+			found = e
+			return false
+		}
+		return true
+	}); err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, linuxerr.ENODATA
+	}
+	val, err := found.value(in.image)
+	if err != nil {
+		return nil, err
+	}
+	if found.index == xattrIndexPosixACLAccess || found.index == xattrIndexPosixACLDefault {
+		return convertACL(val)
+	}
+	return val, nil
+}
+
+// convertACL converts a POSIX ACL from its compact on-disk ext4 format to the
+// extended attribute format. Compare Linux's fs/ext4/acl.c:ext4_acl_from_disk().
+func convertACL(disk []byte) ([]byte, error) {
+	le := binary.LittleEndian
+	if len(disk) < 4 || le.Uint32(disk) != ext4ACLVersion {
+		return nil, linuxerr.EUCLEAN
+	}
+	out := make([]byte, 4, len(disk)*2)
+	le.PutUint32(out, posixACLXattrVersion)
+	for off := 4; off < len(disk); {
+		if off+4 > len(disk) {
+			return nil, linuxerr.EUCLEAN
+		}
+		tag := le.Uint16(disk[off:])
+		perm := le.Uint16(disk[off+2:])
+		id := uint32(aclUndefinedID)
+		switch tag {
+		case aclUserObj, aclGroupObj, aclMask, aclOther:
+			off += 4
+		case aclUser, aclGroup:
+			if off+8 > len(disk) {
+				return nil, linuxerr.EUCLEAN
+			}
+			id = le.Uint32(disk[off+4:])
+			off += 8
+		default:
+			return nil, linuxerr.EUCLEAN
+		}
+		out = le.AppendUint16(out, tag)
+		out = le.AppendUint16(out, perm)
+		out = le.AppendUint32(out, id)
+	}
+	return out, nil
+}
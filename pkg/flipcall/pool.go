@@ -0,0 +1,188 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flipcall
+
+import (
+	"github.com/wilinz/gvisor/pkg/sync"
+)
+
+// PoolConn is a client connection that can be managed by a Pool. *Endpoint
+// implements PoolConn; users that pair an Endpoint with other state (e.g. a
+// channel to donate file descriptors) can wrap it in their own type.
+type PoolConn interface {
+	// Shutdown causes concurrent and future calls on the connection to
+	// return ShutdownError. It may be called concurrently with other
+	// methods, like Endpoint.Shutdown.
+	Shutdown()
+
+	// Destroy releases the resources of the connection.
+	Destroy()
+}
+
+// A Pool allows multiple goroutines to make concurrent calls to a server over
+// a set of client connections. Each connection is used by a single goroutine
+// at a time, since a flipcall Endpoint only supports one call in flight.
+//
+// Connections are created on demand by calling the dial function passed to
+// NewPool, up to a maximum number of connections. Once that number is
+// reached, callers wait for a connection to be returned to the pool. If dial
+// fails, the maximum is lowered to the number of existing connections, so
+// that a server which refuses more connections isn't asked again.
+type Pool[C PoolConn] struct {
+	dial func() (C, error)
+
+	mu   sync.Mutex
+	cond sync.Cond
+
+	// max is the maximum number of connections.
+	//
+	// +checklocks:mu
+	max int
+
+	// size is the number of connections, including the ones being dialed.
+	//
+	// +checklocks:mu
+	size int
+
+	// idle is a LIFO of the connections that are not in use. Recently used
+	// connections are preferred, since their peer is more likely to be
+	// scheduled.
+	//
+	// +checklocks:mu
+	idle []C
+
+	// busy is the set of connections in use.
+	//
+	// +checklocks:mu
+	busy map[PoolConn]struct{}
+
+	// dialErr is the last error returned by dial.
+	//
+	// +checklocks:mu
+	dialErr error
+
+	// closed is true after Close has been called.
+	//
+	// +checklocks:mu
+	closed bool
+}
+
+// NewPool returns a Pool of at most max connections created by dial.
+func NewPool[C PoolConn](max int, dial func() (C, error)) *Pool[C] {
+	p := &Pool[C]{
+		dial: dial,
+		max:  max,
+		busy: make(map[PoolConn]struct{}),
+	}
+	p.cond.L = &p.mu
+	return p
+}
+
+// Get returns a connection that the caller can use exclusively until it is
+// returned with Put. Get blocks if all connections are in use and no more can
+// be created.
+//
+// Get returns the last error of dial if no connection exists and none can be
+// created, and ShutdownError if the pool has been closed.
+func (p *Pool[C]) Get() (C, error) {
+	var zero C
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		if p.closed {
+			return zero, ShutdownError{}
+		}
+		if n := len(p.idle); n > 0 {
+			c := p.idle[n-1]
+			p.idle = p.idle[:n-1]
+			p.busy[c] = struct{}{}
+			return c, nil
+		}
+		if p.size < p.max {
+			// dial may be slow and may make calls on the pool (for
+			// example to ask the server for a new connection), so
+			// it is called without p.mu.
+			p.size++
+			p.mu.Unlock()
+			c, err := p.dial()
+			p.mu.Lock()
+			if err != nil {
+				p.size--
+				p.max = p.size
+				p.dialErr = err
+				p.cond.Broadcast()
+				continue
+			}
+			if p.closed {
+				p.size--
+				p.cond.Broadcast()
+				c.Destroy()
+				return zero, ShutdownError{}
+			}
+			p.busy[c] = struct{}{}
+			return c, nil
+		}
+		if p.size == 0 {
+			// No connection can be created and none will be
+			// returned.
+			return zero, p.dialErr
+		}
+		p.cond.Wait()
+	}
+}
+
+// Put returns a connection obtained from Get to the pool. If ok is false, the
+// connection is unusable, e.g. because a call on it failed; it is destroyed
+// and may be replaced by a new connection.
+func (p *Pool[C]) Put(c C, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.busy, c)
+	if !ok || p.closed {
+		p.size--
+		c.Destroy()
+	} else {
+		p.idle = append(p.idle, c)
+	}
+	p.cond.Broadcast()
+}
+
+// Size returns the number of connections in the pool.
+func (p *Pool[C]) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.size
+}
+
+// Close shuts down the connections in use, waits for them to be returned to
+// the pool and destroys all connections. Subsequent calls to Get return
+// ShutdownError.
+func (p *Pool[C]) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for c := range p.busy {
+		c.Shutdown()
+	}
+	for _, c := range p.idle {
+		c.Destroy()
+	}
+	p.size -= len(p.idle)
+	p.idle = nil
+	p.cond.Broadcast()
+	for p.size > 0 {
+		p.cond.Wait()
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flipcall
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/wilinz/gvisor/pkg/sync"
+)
+
+// fakePoolConn is a PoolConn that doesn't communicate.
+type fakePoolConn struct {
+	shutdown  bool
+	destroyed bool
+}
+
+func (c *fakePoolConn) Shutdown() { c.shutdown = true }
+func (c *fakePoolConn) Destroy()  { c.destroyed = true }
+
+func TestPoolReuse(t *testing.T) {
+	dials := 0
+	p := NewPool(2, func() (*fakePoolConn, error) {
+		dials++
+		return &fakePoolConn{}, nil
+	})
+	defer p.Close()
+
+	c1, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	p.Put(c1, true)
+	c2, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if c2 != c1 {
+		t.Errorf("Get() didn't reuse the idle connection")
+	}
+	c3, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if c3 == c2 {
+		t.Errorf("Get() returned a connection in use")
+	}
+	if dials != 2 || p.Size() != 2 {
+		t.Errorf("got %d dials and %d connections, want 2 and 2", dials, p.Size())
+	}
+
+	// An unusable connection is destroyed and replaced.
+	p.Put(c3, false)
+	if !c3.destroyed {
+		t.Errorf("unusable connection wasn't destroyed")
+	}
+	c4, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if c4 == c3 || dials != 3 {
+		t.Errorf("unusable connection wasn't replaced: %d dials", dials)
+	}
+	p.Put(c2, true)
+	p.Put(c4, true)
+}
+
+func TestPoolWaitsAtLimit(t *testing.T) {
+	p := NewPool(1, func() (*fakePoolConn, error) {
+		return &fakePoolConn{}, nil
+	})
+	defer p.Close()
+
+	c, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	got := make(chan *fakePoolConn)
+	go func() {
+		c, err := p.Get()
+		if err != nil {
+			t.Errorf("Get() failed: %v", err)
+		}
+		got <- c
+	}()
+	select {
+	case <-got:
+		t.Fatalf("Get() returned while the only connection was in use")
+	case <-time.After(100 * time.Millisecond):
+	}
+	p.Put(c, true)
+	if c2 := <-got; c2 != c {
+		t.Errorf("Get() didn't return the released connection")
+	}
+	p.Put(c, true)
+}
+
+func TestPoolDialFailure(t *testing.T) {
+	errRefused := errors.New("refused")
+	fail := true
+	p := NewPool(4, func() (*fakePoolConn, error) {
+		if fail {
+			return nil, errRefused
+		}
+		return &fakePoolConn{}, nil
+	})
+	defer p.Close()
+
+	if _, err := p.Get(); err != errRefused {
+		t.Fatalf("got Get() = %v, want %v", err, errRefused)
+	}
+	// The pool doesn't retry dialing once the server refused a connection.
+	fail = false
+	if _, err := p.Get(); err != errRefused {
+		t.Fatalf("got Get() = %v, want %v", err, errRefused)
+	}
+}
+
+func TestPoolClose(t *testing.T) {
+	p := NewPool(2, func() (*fakePoolConn, error) {
+		return &fakePoolConn{}, nil
+	})
+	busy, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	idle, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	p.Put(idle, true)
+
+	closed := make(chan struct{})
+	go func() {
+		p.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatalf("Close() returned while a connection was in use")
+	case <-time.After(100 * time.Millisecond):
+	}
+	p.Put(busy, true)
+	<-closed
+	if !busy.shutdown || !busy.destroyed || !idle.destroyed {
+		t.Errorf("connections weren't shut down and destroyed: busy %+v, idle %+v", busy, idle)
+	}
+	if _, err := p.Get(); err != (ShutdownError{}) {
+		t.Errorf("got Get() = %v after Close(), want ShutdownError", err)
+	}
+}
+
+// testPoolConn is a PoolConn backed by a testConnection, with a server
+// goroutine that replies to every call.
+type testPoolConn struct {
+	*testConnection
+	serverRun sync.WaitGroup
+}
+
+func newTestPoolConn(tb testing.TB) (*testPoolConn, error) {
+	c := &testPoolConn{testConnection: newTestConnection(tb)}
+	c.serverRun.Add(1)
+	go func() {
+		defer c.serverRun.Done()
+		if _, err := c.serverEP.RecvFirst(); err != nil {
+			return
+		}
+		for {
+			if _, err := c.serverEP.SendRecv(0); err != nil {
+				return
+			}
+		}
+	}()
+	if err := c.clientEP.Connect(); err != nil {
+		c.Destroy()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *testPoolConn) Shutdown() {
+	c.clientEP.Shutdown()
+}
+
+func (c *testPoolConn) Destroy() {
+	c.clientEP.Shutdown()
+	c.serverEP.Shutdown()
+	c.serverRun.Wait()
+	c.destroy()
+}
+
+func benchmarkPoolContention(b *testing.B, maxConns int) {
+	p := NewPool(maxConns, func() (*testPoolConn, error) {
+		return newTestPoolConn(b)
+	})
+	defer p.Close()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c, err := p.Get()
+			if err != nil {
+				b.Errorf("Get() failed: %v", err)
+				return
+			}
+			_, err = c.clientEP.SendRecv(0)
+			p.Put(c, err == nil)
+			if err != nil {
+				b.Errorf("client Endpoint.SendRecv() failed: %v", err)
+				return
+			}
+		}
+	})
+	b.StopTimer()
+}
+
+func BenchmarkPoolContention(b *testing.B) {
+	for _, maxConns := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("conns=%d", maxConns), func(b *testing.B) {
+			benchmarkPoolContention(b, maxConns)
+		})
+	}
+}
@@ -96,6 +96,16 @@ func (ch *channel) destroy() {
 	ch.data.Destroy()
 }
 
+// Shutdown implements flipcall.PoolConn.Shutdown.
+func (ch *channel) Shutdown() {
+	ch.shutdown()
+}
+
+// Destroy implements flipcall.PoolConn.Destroy.
+func (ch *channel) Destroy() {
+	ch.destroy()
+}
+
 // createChannel creates a server side channel. It returns a packet window
 // descriptor (for the data channel) and an open socket for the FD channel.
 func (c *Connection) createChannel(maxMessageSize uint32) (*channel, flipcall.PacketWindowDescriptor, int, error) {
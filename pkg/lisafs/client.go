@@ -49,6 +49,11 @@ type Client struct {
 	// activeWg represents active channels.
 	activeWg sync.WaitGroup
 
+	// chanPool is the pool of channels started by StartChannelPool. If it is
+	// set, channels and availableChannels are unused. chanPool is set before
+	// the client is used concurrently and is immutable after.
+	chanPool *flipcall.Pool[*channel]
+
 	// watchdogWg only holds the watchdog goroutine.
 	watchdogWg sync.WaitGroup
 
@@ -157,6 +162,25 @@ func (c *Client) StartChannels() error {
 	return nil
 }
 
+// StartChannelPool starts a pool of channel communicators that grows on
+// demand. Unlike StartChannels, channels are only created when concurrent RPCs
+// need them, up to maxChannels(), and RPCs wait for a channel to become
+// available instead of falling back to the socket when all of them are in
+// use. Channels that fail are replaced.
+func (c *Client) StartChannelPool() error {
+	c.chanPool = flipcall.NewPool(maxChannels(), c.createChannel)
+
+	// Create the first channel to flag server side issues early, like
+	// StartChannels. This is not required by lisafs protocol.
+	ch, err := c.chanPool.Get()
+	if err != nil {
+		log.Warningf("channel creation failed: %v", err)
+		return nil
+	}
+	c.chanPool.Put(ch, true)
+	return nil
+}
+
 func (c *Client) watchdog() {
 	defer c.watchdogWg.Done()
 
@@ -182,6 +206,9 @@ func (c *Client) watchdog() {
 	}
 
 	// Shutdown all active channels and wait for them to complete.
+	if c.chanPool != nil {
+		c.chanPool.Close()
+	}
 	c.shutdownActiveChans()
 	c.activeWg.Wait()
 
@@ -335,7 +362,7 @@ func (c *Client) SndRcvMessage(m MID, payloadLen uint32, reqMarshal marshalFunc,
 	}
 
 	// Acquire a communicator.
-	comm := c.acquireCommunicator()
+	comm := c.acquireCommunicator(m)
 	defer c.releaseCommunicator(comm)
 
 	debugf("send", comm, reqString)
@@ -402,13 +429,21 @@ func debugf(action string, comm Communicator, debugMsg debugStringer) {
 }
 
 // Postcondition: releaseCommunicator() must be called on the returned value.
-func (c *Client) acquireCommunicator() Communicator {
+func (c *Client) acquireCommunicator(m MID) Communicator {
 	// Prefer using channel over socket because:
 	//	- Channel uses a shared memory region for passing messages. IO from shared
 	//		memory is faster and does not involve making a syscall.
 	//	- No intermediate buffer allocation needed. With a channel, the message
 	//		can be directly pasted into the shared memory region.
-	if ch := c.getChannel(); ch != nil {
+	if c.chanPool != nil {
+		// Channel RPCs are made by the pool to create channels, so they
+		// must not wait for a channel.
+		if m != Channel {
+			if ch, err := c.chanPool.Get(); err == nil {
+				return ch
+			}
+		}
+	} else if ch := c.getChannel(); ch != nil {
 		return ch
 	}
 
@@ -422,7 +457,11 @@ func (c *Client) releaseCommunicator(comm Communicator) {
 	case *sockCommunicator:
 		c.sockMu.Unlock() // +checklocksforce: locked in acquireCommunicator().
 	case *channel:
-		c.releaseChannel(t)
+		if c.chanPool != nil {
+			c.chanPool.Put(t, !t.dead)
+		} else {
+			c.releaseChannel(t)
+		}
 	default:
 		panic(fmt.Sprintf("unknown communicator type %T", t))
 	}
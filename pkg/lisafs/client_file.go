@@ -543,6 +543,24 @@ func (f *ClientFD) Getdents64(ctx context.Context, count int32) ([]Dirent64, err
 	return resp.Dirents, err
 }
 
+// Getdents64Cursor makes the Getdents64Cursor RPC. It returns directory
+// entries starting at cursor, which is either 0 or the Off field of a
+// previously returned dirent. An empty result indicates the end of the
+// directory.
+func (f *ClientFD) Getdents64Cursor(ctx context.Context, cursor uint64, count uint32) ([]Dirent64, error) {
+	req := Getdents64CursorReq{
+		DirFD:  f.fd,
+		Cursor: cursor,
+		Count:  count,
+	}
+
+	var resp Getdents64Resp
+	ctx.UninterruptibleSleepStart(false)
+	err := f.client.SndRcvMessage(Getdents64Cursor, uint32(req.SizeBytes()), req.MarshalUnsafe, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	ctx.UninterruptibleSleepFinish(false)
+	return resp.Dirents, err
+}
+
 // ListXattr makes the FListXattr RPC.
 func (f *ClientFD) ListXattr(ctx context.Context, size uint64) ([]string, error) {
 	req := FListXattrReq{
@@ -619,6 +619,16 @@ type OpenFDImpl interface {
 	// On the server, Getdent64 has a read concurrency guarantee.
 	Getdent64(count uint32, seek0 bool, recordDirent func(Dirent64)) error
 
+	// Getdent64Cursor is similar to Getdent64, but iteration starts at the
+	// position in the directory stream given by cursor, which is either 0 or
+	// the Off field of a dirent previously passed to recordDirent. Reads with
+	// different cursors may be interleaved, so that multiple readers can
+	// iterate the same directory independently and resume where they left
+	// off.
+	//
+	// On the server, Getdent64Cursor has a read concurrency guarantee.
+	Getdent64Cursor(cursor uint64, count uint32, recordDirent func(Dirent64)) error
+
 	// Renamed is called to notify the FD implementation that the file has been
 	// renamed. FD implementation may update its state accordingly.
 	//
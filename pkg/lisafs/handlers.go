@@ -79,6 +79,7 @@ var handlers = [...]RPCHandler{
 	Listen:           ListenHandler,
 	Accept:           AcceptHandler,
 	ConnectWithCreds: ConnectWithCredsHandler,
+	Getdents64Cursor: Getdents64CursorHandler,
 }
 
 // ErrorHandler handles Error message.
@@ -1366,7 +1367,32 @@ func Getdents64Handler(c *Connection, comm Communicator, payloadLen uint32) (uin
 		return 0, unix.EIO
 	}
 
-	fd, err := c.lookupOpenFD(req.DirFD)
+	seek0 := false
+	if req.Count < 0 {
+		seek0 = true
+		req.Count = -req.Count
+	}
+	return getdents64(c, comm, req.DirFD, func(fd *OpenFD, recordDirent func(Dirent64)) error {
+		return fd.impl.Getdent64(uint32(req.Count), seek0, recordDirent)
+	})
+}
+
+// Getdents64CursorHandler handles the Getdents64Cursor RPC.
+func Getdents64CursorHandler(c *Connection, comm Communicator, payloadLen uint32) (uint32, error) {
+	var req Getdents64CursorReq
+	if _, ok := req.CheckedUnmarshal(comm.PayloadBuf(payloadLen)); !ok {
+		return 0, unix.EIO
+	}
+
+	return getdents64(c, comm, req.DirFD, func(fd *OpenFD, recordDirent func(Dirent64)) error {
+		return fd.impl.Getdent64Cursor(req.Cursor, req.Count, recordDirent)
+	})
+}
+
+// getdents64 implements the Getdents64 and Getdents64Cursor RPCs, which only
+// differ in how directory entries are read by the OpenFD implementation.
+func getdents64(c *Connection, comm Communicator, dirFD FDID, read func(fd *OpenFD, recordDirent func(Dirent64)) error) (uint32, error) {
+	fd, err := c.lookupOpenFD(dirFD)
 	if err != nil {
 		return 0, err
 	}
@@ -1375,12 +1401,6 @@ func Getdents64Handler(c *Connection, comm Communicator, payloadLen uint32) (uin
 		return 0, unix.ENOTDIR
 	}
 
-	seek0 := false
-	if req.Count < 0 {
-		seek0 = true
-		req.Count = -req.Count
-	}
-
 	// We will manually marshal the response Getdents64Resp.
 
 	// numDirents is the number of dirents marshalled into the payload.
@@ -1395,7 +1415,7 @@ func Getdents64Handler(c *Connection, comm Communicator, payloadLen uint32) (uin
 		if fd.controlFD.node.isDeleted() {
 			return unix.EINVAL
 		}
-		return fd.impl.Getdent64(uint32(req.Count), seek0, func(dirent Dirent64) {
+		return read(fd, func(dirent Dirent64) {
 			// Paste the dirent into the payload buffer without having the dirent
 			// escape. Request a larger buffer if needed.
 			if int(payloadBufPos)+dirent.SizeBytes() > len(payloadBuf) {
@@ -176,6 +176,10 @@ const (
 	// ConnectWithCreds is analogous to connect(2) but it asks the server
 	// to connect with the provided effective uid/gid.
 	ConnectWithCreds MID = 32
+
+	// Getdents64Cursor is analogous to getdents64(2), but starts reading at an
+	// explicit position in the directory stream.
+	Getdents64Cursor MID = 33
 )
 
 const (
@@ -1565,6 +1569,26 @@ func (g *Getdents64Req) String() string {
 	return fmt.Sprintf("Getdents64Req{DirFD: %d, Count: %d}", g.DirFD, g.Count)
 }
 
+// Getdents64CursorReq is used to make Getdents64Cursor requests. The response
+// is also Getdents64Resp.
+//
+// +marshal boundCheck
+type Getdents64CursorReq struct {
+	DirFD FDID
+	// Cursor is the position in the directory stream at which to start
+	// reading. It must be 0 (the beginning of the directory) or the Off field
+	// of a Dirent64 previously returned for the same directory.
+	Cursor uint64
+	// Count is the maximum number of bytes of directory entries to read.
+	Count uint32
+	_     uint32 // Need to make struct packed.
+}
+
+// String implements fmt.Stringer.String.
+func (g *Getdents64CursorReq) String() string {
+	return fmt.Sprintf("Getdents64CursorReq{DirFD: %d, Cursor: %d, Count: %d}", g.DirFD, g.Cursor, g.Count)
+}
+
 // Dirent64 is analogous to struct linux_dirent64.
 type Dirent64 struct {
 	Ino      primitive.Uint64
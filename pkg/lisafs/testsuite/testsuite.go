@@ -62,6 +62,19 @@ func RunAllLocalFSTests(t *testing.T, tester Tester) {
 	}
 }
 
+// RunAllLocalFSTestsWithChannelPool runs all local FS tests as subtests, with
+// a client that makes RPCs over a channel pool.
+func RunAllLocalFSTestsWithChannelPool(t *testing.T, tester Tester) {
+	for name, testFn := range localFSTests {
+		mountPath, err := os.MkdirTemp(os.Getenv("TEST_TMPDIR"), "")
+		if err != nil {
+			t.Fatalf("creation of temporary mountpoint failed: %v", err)
+		}
+		runTest(t, tester, name, testFn, mountPath, true /* channelPool */)
+		os.RemoveAll(mountPath)
+	}
+}
+
 // TestFunc describes the signature of a test method.
 type TestFunc func(context.Context, *testing.T, Tester, lisafs.ClientFD)
 
@@ -80,10 +93,15 @@ var localFSTests = map[string]TestFunc{
 	"Mknod":           testMknod,
 	"UDS":             testUDS,
 	"Getdents":        testGetdents,
+	"GetdentsCursor":  testGetdentsCursor,
 }
 
 // RunTest runs the passed test function as a subtest.
 func RunTest(t *testing.T, tester Tester, testName string, testFn TestFunc, mountPath string) {
+	runTest(t, tester, testName, testFn, mountPath, false /* channelPool */)
+}
+
+func runTest(t *testing.T, tester Tester, testName string, testFn TestFunc, mountPath string, channelPool bool) {
 	refs.SetLeakMode(refs.LeaksPanic)
 	// server should run with a umask of 0, because we want to preserve file
 	// modes exactly for testing purposes.
@@ -106,7 +124,11 @@ func RunTest(t *testing.T, tester Tester, testName string, testFn TestFunc, moun
 	if err != nil {
 		t.Fatalf("client creation failed: %v", err)
 	}
-	if err := c.StartChannels(); err != nil {
+	startChannels := c.StartChannels
+	if channelPool {
+		startChannels = c.StartChannelPool
+	}
+	if err := startChannels(); err != nil {
 		t.Fatalf("failed to start channels: %v", err)
 	}
 
@@ -706,3 +728,62 @@ func testGetdents(ctx context.Context, t *testing.T, tester Tester, root lisafs.
 		}
 	}
 }
+
+func testGetdentsCursor(ctx context.Context, t *testing.T, tester Tester, root lisafs.ClientFD) {
+	if !root.Client().IsSupported(lisafs.Getdents64Cursor) {
+		t.Skip("Getdents64Cursor is not supported")
+	}
+
+	tempDir, _ := mkdir(ctx, t, root, "tempDir")
+	defer closeFD(ctx, t, tempDir)
+	defer unlinkFile(ctx, t, root, "tempDir", true /* isDir */)
+
+	// Create 10 files in tempDir.
+	n := 10
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("file-%d", i)
+		newFile, _ := mknod(ctx, t, tempDir, name)
+		defer closeFD(ctx, t, newFile)
+		defer unlinkFile(ctx, t, tempDir, name, false /* isDir */)
+	}
+
+	openDirFile, dirHostFD := openFile(ctx, t, tempDir, unix.O_RDONLY, false /* isReg */)
+	unix.Close(dirHostFD)
+	defer closeFD(ctx, t, openDirFile)
+
+	// Interleave two iterations over the same directory FD. Each must see
+	// every entry exactly once, regardless of the other.
+	var cursors [2]uint64
+	var done [2]bool
+	seen := [2]map[string]int{make(map[string]int), make(map[string]int)}
+	for iter := 0; iter < 4*(n+2) && !(done[0] && done[1]); iter++ {
+		i := iter % 2
+		if done[i] {
+			continue
+		}
+		gotDirents, err := openDirFile.Getdents64Cursor(ctx, cursors[i], 40)
+		if err != nil {
+			t.Fatalf("getdents with cursor %d failed: %v", cursors[i], err)
+		}
+		if len(gotDirents) == 0 {
+			done[i] = true
+			continue
+		}
+		for _, dirent := range gotDirents {
+			seen[i][string(dirent.Name)]++
+		}
+		cursors[i] = uint64(gotDirents[len(gotDirents)-1].Off)
+	}
+
+	for i := range seen {
+		if !done[i] {
+			t.Errorf("iteration %d did not reach the end of the directory", i)
+		}
+		for j := 0; j < n; j++ {
+			name := fmt.Sprintf("file-%d", j)
+			if got := seen[i][name]; got != 1 {
+				t.Errorf("iteration %d saw %q %d times, want 1", i, name, got)
+			}
+		}
+	}
+}
@@ -61,9 +61,10 @@ func (k *Kernel) init(maxCPUs int) {
 	// Setup the IDT, which is uniform.
 	for v, handler := range handlers {
 		// Allow Breakpoint and Overflow to be called from all
-		// privilege levels.
+		// privilege levels, as well as int $0x80, which is the syscall
+		// instruction of 32-bit compatibility mode.
 		dpl := 0
-		if v == Breakpoint || v == Overflow {
+		if v == Breakpoint || v == Overflow || v == SyscallInt80 {
 			dpl = 3
 		}
 		// Note that we set all traps to use the interrupt stack, this
@@ -252,11 +253,17 @@ func (c *CPU) SwitchToUser(switchOpts SwitchOpts) (vector Vector) {
 	regs := switchOpts.Registers
 	regs.Eflags &= ^uint64(UserFlagsClear)
 	regs.Eflags |= UserFlagsSet
-	regs.Cs = uint64(Ucode64) // Required for iret.
-	regs.Ss = uint64(Udata)   // Ditto.
+	needIRET := uint64(0)
+	if regs.Cs == uint64(Ucode32) {
+		// 32-bit compatibility mode code can only be returned to with
+		// iret, since sysret returns to 64-bit mode.
+		needIRET = 1
+	} else {
+		regs.Cs = uint64(Ucode64) // Required for iret.
+	}
+	regs.Ss = uint64(Udata) // Ditto.
 
 	// Perform the switch.
-	needIRET := uint64(0)
 	if switchOpts.FullRestore {
 		needIRET = 1
 	}
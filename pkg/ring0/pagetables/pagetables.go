@@ -321,6 +321,41 @@ func (p *PageTables) Lookup(addr hostarch.Addr, findFirst bool) (virtual hostarc
 	return hostarch.Addr(w.visitor.target), w.visitor.physical, w.visitor.size, w.visitor.opts
 }
 
+// accessedVisitor is used for TestAndClearAccessed.
+type accessedVisitor struct {
+	fn func(start, length uintptr) // Input.
+}
+
+// visit clears the accessed bit of a valid entry.
+//
+//go:nosplit
+func (v *accessedVisitor) visit(start uintptr, pte *PTE, align uintptr) bool {
+	if pte.Valid() && pte.testAndClearAccessed() {
+		v.fn(start, align+1)
+	}
+	return true
+}
+
+//go:nosplit
+func (*accessedVisitor) requiresAlloc() bool { return false }
+
+//go:nosplit
+func (*accessedVisitor) requiresSplit() bool { return false }
+
+// TestAndClearAccessed clears the accessed bits of all mappings in the given
+// range, and calls fn with the range of each mapping whose accessed bit was
+// set. The ranges passed to fn may extend beyond the given range if it is not
+// aligned to the underlying page sizes.
+func (p *PageTables) TestAndClearAccessed(addr hostarch.Addr, length uintptr, fn func(start, length uintptr)) {
+	w := accessedWalker{
+		pageTables: p,
+		visitor: accessedVisitor{
+			fn: fn,
+		},
+	}
+	w.iterateRange(uintptr(addr), uintptr(addr)+length)
+}
+
 // MarkReadOnlyShared marks the pagetables read-only and can be shared.
 //
 // It is usually used on the pagetables that are used as the upper
@@ -131,6 +131,17 @@ func (p *PTE) Opts() MapOpts {
 	}
 }
 
+// testAndClearAccessed returns true iff this entry is valid.
+//
+// The access flag is never cleared, since hardware management of the access
+// flag is optional and clearing it would otherwise cause access flag faults.
+// All valid entries are therefore reported as accessed.
+//
+//go:nosplit
+func (p *PTE) testAndClearAccessed() bool {
+	return p.Valid()
+}
+
 // SetSect sets this page as a sect page.
 //
 // The page must not be valid or a panic will result.
@@ -108,6 +108,21 @@ func (p *PTE) Opts() MapOpts {
 	}
 }
 
+// testAndClearAccessed clears the accessed bit and returns its previous value.
+//
+//go:nosplit
+func (p *PTE) testAndClearAccessed() bool {
+	for {
+		v := atomic.LoadUintptr((*uintptr)(p))
+		if v&accessed == 0 {
+			return false
+		}
+		if atomic.CompareAndSwapUintptr((*uintptr)(p), v, v&^accessed) {
+			return true
+		}
+	}
+}
+
 // SetSuper sets this page as a super page.
 //
 // The page must not be valid or a panic will result.
@@ -85,6 +85,11 @@ type contextInterface interface {
 	// Width returns the number of bytes for a native value.
 	Width() uint
 
+	// Compat returns true if the context runs 32-bit code that uses the
+	// 32-bit syscall ABI of a 64-bit architecture (for example, ia32
+	// binaries on amd64).
+	Compat() bool
+
 	// Fork creates a clone of the context.
 	Fork() *Context64
 
@@ -127,6 +127,10 @@ func (c *Context64) Fork() *Context64 {
 
 // Return returns the current syscall return value.
 func (c *Context64) Return() uintptr {
+	if c.Compat() {
+		// Only %eax is visible to 32-bit code.
+		return uintptr(int32(c.Regs.Rax))
+	}
 	return uintptr(c.Regs.Rax)
 }
 
@@ -178,17 +182,28 @@ func (c *Context64) SetOldRSeqInterruptedIP(value uintptr) {
 
 // Native returns the native type for the given val.
 func (c *Context64) Native(val uintptr) marshal.Marshallable {
+	if c.Compat() {
+		v := primitive.Uint32(val)
+		return &v
+	}
 	v := primitive.Uint64(val)
 	return &v
 }
 
 // Value returns the generic val for the given native type.
 func (c *Context64) Value(val marshal.Marshallable) uintptr {
+	if v, ok := val.(*primitive.Uint32); ok {
+		return uintptr(*v)
+	}
 	return uintptr(*val.(*primitive.Uint64))
 }
 
-// Width returns the byte width of this architecture.
+// Width returns the byte width of this architecture, which is 4 in the 32-bit
+// compatibility mode.
 func (c *Context64) Width() uint {
+	if c.Compat() {
+		return 4
+	}
 	return 8
 }
 
@@ -199,6 +214,9 @@ func mmapRand(max uint64) hostarch.Addr {
 
 // NewMmapLayout implements Context.NewMmapLayout consistently with Linux.
 func (c *Context64) NewMmapLayout(min, max hostarch.Addr, r *limits.LimitSet) (MmapLayout, error) {
+	if c.Compat() {
+		return c.newMmapLayout32(min, max, r)
+	}
 	min, ok := min.RoundUp()
 	if !ok {
 		return MmapLayout{}, unix.EINVAL
@@ -265,6 +283,9 @@ func (c *Context64) NewMmapLayout(min, max hostarch.Addr, r *limits.LimitSet) (M
 
 // PIELoadAddress implements Context.PIELoadAddress.
 func (c *Context64) PIELoadAddress(l MmapLayout) hostarch.Addr {
+	if c.Compat() {
+		return preferredPIELoadAddr32 + mmapRand(maxMmapRand32)
+	}
 	base := preferredPIELoadAddr
 	max, ok := base.AddLength(maxMmapRand64)
 	if !ok {
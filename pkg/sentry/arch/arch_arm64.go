@@ -181,6 +181,17 @@ func (c *Context64) Width() uint {
 	return 8
 }
 
+// Compat implements Context.Compat. AArch32 is not supported.
+func (c *Context64) Compat() bool {
+	return false
+}
+
+// SetCompat switches the context to the 32-bit compatibility mode. AArch32 is
+// not supported, so it must not be called on arm64.
+func (c *Context64) SetCompat() {
+	panic("32-bit compatibility mode is not supported on arm64")
+}
+
 // mmapRand returns a random adjustment for randomizing an mmap layout.
 func mmapRand(max uint64) hostarch.Addr {
 	return hostarch.Addr(rand.Int63n(int64(max))).RoundDown()
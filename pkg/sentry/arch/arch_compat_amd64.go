@@ -0,0 +1,134 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build amd64
+// +build amd64
+
+package arch
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+	"github.com/wilinz/gvisor/pkg/hostarch"
+	"github.com/wilinz/gvisor/pkg/sentry/limits"
+)
+
+// A Context64 runs ia32 binaries in the 32-bit compatibility mode of the CPU,
+// which is selected by the user32CS code segment. In that mode, the task uses
+// the i386 syscall ABI (int $0x80) and a 32-bit address space.
+
+// These constants come directly from Linux.
+const (
+	// maxAddr32 is the maximum userspace address. It is TASK_SIZE in Linux
+	// for a 32-bit process on x86_64 (IA32_PAGE_OFFSET).
+	maxAddr32 hostarch.Addr = 0xffffe000
+
+	// maxStackRand32 is the maximum randomization to apply to the stack.
+	// It is defined by arch/x86/mm/mmap.c:stack_maxrandom_size in Linux,
+	// with the 32-bit STACK_RND_MASK.
+	maxStackRand32 = 0x7ff * hostarch.PageSize
+
+	// maxMmapRand32 is the maximum randomization to apply to the mmap
+	// layout. It is defined by arch/x86/mm/mmap.c:arch_mmap_rnd in Linux,
+	// with the default mmap_rnd_compat_bits.
+	maxMmapRand32 = (1 << 8) * hostarch.PageSize
+
+	// minGap32 is the minimum gap to leave at the top of the address space
+	// for the stack. It is defined by arch/x86/mm/mmap.c:MIN_GAP in Linux.
+	minGap32 = (128 << 20) + maxStackRand32
+
+	// preferredPIELoadAddr32 is the standard Linux position-independent
+	// executable base load address for 32-bit processes. It is
+	// ELF_ET_DYN_BASE in Linux.
+	preferredPIELoadAddr32 hostarch.Addr = 0x400000
+)
+
+// Segment selectors used by platforms to run 32-bit compatibility mode code.
+const (
+	// User32CS is the code segment selector of 32-bit compatibility mode.
+	User32CS = user32CS
+
+	// UserDS is the data segment selector of user code, for both 64-bit and
+	// 32-bit code.
+	UserDS = userDS
+)
+
+// Compat implements Context.Compat.
+func (c *Context64) Compat() bool {
+	return c.Regs.Cs == user32CS
+}
+
+// SetCompat switches the context to the 32-bit compatibility mode, as done
+// for ia32 binaries in arch/x86/kernel/process_64.c:compat_start_thread().
+//
+// SetCompat must be called before the context is used to create the mmap
+// layout of the binary.
+func (c *Context64) SetCompat() {
+	c.Regs.Cs = user32CS
+	c.Regs.Ss = userDS
+	c.Regs.Ds = userDS
+	c.Regs.Es = userDS
+}
+
+// newMmapLayout32 implements Context.NewMmapLayout for the 32-bit
+// compatibility mode, consistently with Linux.
+func (c *Context64) newMmapLayout32(min, max hostarch.Addr, r *limits.LimitSet) (MmapLayout, error) {
+	min, ok := min.RoundUp()
+	if !ok {
+		return MmapLayout{}, unix.EINVAL
+	}
+	if max > maxAddr32 {
+		max = maxAddr32
+	}
+	max = max.RoundDown()
+
+	if min > max {
+		return MmapLayout{}, unix.EINVAL
+	}
+
+	stackSize := r.Get(limits.Stack)
+
+	// MAX_GAP in Linux.
+	maxGap := (max / 6) * 5
+	gap := hostarch.Addr(stackSize.Cur)
+	if gap < minGap32 {
+		gap = minGap32
+	}
+	if gap > maxGap {
+		gap = maxGap
+	}
+	defaultDir := MmapTopDown
+	if stackSize.Cur == limits.Infinity {
+		defaultDir = MmapBottomUp
+	}
+
+	rnd := mmapRand(maxMmapRand32)
+	l := MmapLayout{
+		MinAddr: min,
+		MaxAddr: max,
+		// TASK_UNMAPPED_BASE in Linux.
+		BottomUpBase:     (max/3 + rnd).RoundDown(),
+		TopDownBase:      (max - gap - rnd).RoundDown(),
+		DefaultDirection: defaultDir,
+		MaxStackRand:     maxStackRand32,
+	}
+
+	// Final sanity check on the layout.
+	if !l.Valid() {
+		panic(fmt.Sprintf("Invalid MmapLayout: %+v", l))
+	}
+
+	return l, nil
+}
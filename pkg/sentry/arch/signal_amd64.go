@@ -88,6 +88,10 @@ type UContext64 struct {
 // SignalSetup implements Context.SignalSetup. (Compare to Linux's
 // arch/x86/kernel/signal.c:__setup_rt_frame().)
 func (c *Context64) SignalSetup(st *Stack, act *linux.SigAction, info *linux.SignalInfo, alt *linux.SignalStack, sigset linux.SignalSet, featureSet cpuid.FeatureSet) error {
+	if c.Compat() {
+		return c.signalSetup32(st, act, info, alt, sigset, featureSet)
+	}
+
 	// "The 128-byte area beyond the location pointed to by %rsp is considered
 	// to be reserved and shall not be modified by signal or interrupt
 	// handlers. ... leaf functions may use this area for their entire stack
@@ -165,28 +169,8 @@ func (c *Context64) SignalSetup(st *Stack, act *linux.SigAction, info *linux.Sig
 		return unix.EFAULT
 	}
 
-	// Set up floating point state on the stack. Compare Linux's
-	// arch/x86/kernel/fpu/signal.c:copy_fpstate_to_sigframe().
-	if _, err := st.IO.CopyOut(context.Background(), fpStart, fpState[:fpu.FP_SW_FRAME_OFFSET], usermem.IOOpts{}); err != nil {
-		return err
-	}
-	fpsw := fpu.FPSoftwareFrame{
-		Magic1:       fpu.FP_XSTATE_MAGIC1,
-		ExtendedSize: uint32(fpSize),
-		Xfeatures:    fpu.XFEATURE_MASK_FPSSE | featureSet.ValidXCR0Mask(),
-		XstateSize:   uint32(fpSize) - fpu.FP_XSTATE_MAGIC2_SIZE,
-	}
-	st.Bottom = fpStart + 512
-	if _, err := fpsw.CopyOut(st, StackBottomMagic); err != nil {
-		return err
-	}
-	if len(fpState) > 512 {
-		if _, err := st.IO.CopyOut(context.Background(), fpStart+512, fpState[512:], usermem.IOOpts{}); err != nil {
-			return err
-		}
-	}
-	st.Bottom = fpStart + hostarch.Addr(fpSize)
-	if _, err := primitive.CopyUint32Out(st, StackBottomMagic, fpu.FP_XSTATE_MAGIC2); err != nil {
+	// Set up floating point state on the stack.
+	if err := c.fpStateSetup(st, fpStart, fpSize, featureSet); err != nil {
 		return err
 	}
 
@@ -236,6 +220,10 @@ func (c *Context64) SignalSetup(st *Stack, act *linux.SigAction, info *linux.Sig
 // SignalRestore implements Context.SignalRestore. (Compare to Linux's
 // arch/x86/kernel/signal.c:sys_rt_sigreturn().)
 func (c *Context64) SignalRestore(st *Stack, rt bool, featureSet cpuid.FeatureSet) (linux.SignalSet, linux.SignalStack, error) {
+	if c.Compat() {
+		return c.signalRestore32(st, rt, featureSet)
+	}
+
 	// Copy out the stack frame.
 	var uc UContext64
 	if _, err := uc.CopyIn(st, StackBottomMagic); err != nil {
@@ -269,38 +257,78 @@ func (c *Context64) SignalRestore(st *Stack, rt bool, featureSet cpuid.FeatureSe
 	// N.B. _UC_STRICT_RESTORE_SS not supported.
 	c.Regs.Orig_rax = math.MaxUint64
 
-	// Restore floating point state. Compare Linux's
-	// arch/x86/kernel/fpu/signal.c:fpu__restore_sig().
-	if uc.MContext.Fpstate == 0 {
-		c.fpState.Reset()
-	} else {
-		fpsw := fpu.FPSoftwareFrame{}
-		st.Bottom = hostarch.Addr(uc.MContext.Fpstate + fpu.FP_SW_FRAME_OFFSET)
-		if _, err := fpsw.CopyIn(st, StackBottomMagic); err != nil {
-			c.fpState.Reset()
-			return 0, linux.SignalStack{}, err
-		}
-		if fpsw.Magic1 != fpu.FP_XSTATE_MAGIC1 ||
-			fpsw.XstateSize < fpu.FXSAVE_AREA_SIZE ||
-			fpsw.XstateSize > fpsw.ExtendedSize {
-			c.fpState.Reset()
-			return 0, linux.SignalStack{}, linuxerr.EFAULT
-		}
+	// Restore floating point state.
+	if err := c.fpStateRestore(st, hostarch.Addr(uc.MContext.Fpstate), featureSet); err != nil {
+		return 0, linux.SignalStack{}, err
+	}
 
-		fpState := c.fpState.Slice()
-		fpSize := fpsw.XstateSize
-		if int(fpSize) < len(fpState) {
-			// The signal frame FPU state is smaller than expected. This can happen after S/R.
-			c.fpState.Reset()
-			fpState = fpState[:fpSize]
-		}
+	return uc.Sigset, uc.Stack, nil
+}
 
-		if _, err := st.IO.CopyIn(context.Background(), hostarch.Addr(uc.MContext.Fpstate), fpState, usermem.IOOpts{}); err != nil {
-			c.fpState.Reset()
-			return 0, linux.SignalStack{}, err
+// fpStateSetup copies the floating point state to the fpSize bytes of the
+// signal frame at fpStart. Compare Linux's
+// arch/x86/kernel/fpu/signal.c:copy_fpstate_to_sigframe().
+func (c *Context64) fpStateSetup(st *Stack, fpStart hostarch.Addr, fpSize int, featureSet cpuid.FeatureSet) error {
+	fpState := c.fpState.Slice()
+	if _, err := st.IO.CopyOut(context.Background(), fpStart, fpState[:fpu.FP_SW_FRAME_OFFSET], usermem.IOOpts{}); err != nil {
+		return err
+	}
+	fpsw := fpu.FPSoftwareFrame{
+		Magic1:       fpu.FP_XSTATE_MAGIC1,
+		ExtendedSize: uint32(fpSize),
+		Xfeatures:    fpu.XFEATURE_MASK_FPSSE | featureSet.ValidXCR0Mask(),
+		XstateSize:   uint32(fpSize) - fpu.FP_XSTATE_MAGIC2_SIZE,
+	}
+	st.Bottom = fpStart + 512
+	if _, err := fpsw.CopyOut(st, StackBottomMagic); err != nil {
+		return err
+	}
+	if len(fpState) > 512 {
+		if _, err := st.IO.CopyOut(context.Background(), fpStart+512, fpState[512:], usermem.IOOpts{}); err != nil {
+			return err
 		}
-		c.fpState.SanitizeUser(featureSet)
 	}
+	st.Bottom = fpStart + hostarch.Addr(fpSize)
+	if _, err := primitive.CopyUint32Out(st, StackBottomMagic, fpu.FP_XSTATE_MAGIC2); err != nil {
+		return err
+	}
+	return nil
+}
 
-	return uc.Sigset, uc.Stack, nil
+// fpStateRestore restores the floating point state from the signal frame at
+// fpStart, or resets it if fpStart is 0. Compare Linux's
+// arch/x86/kernel/fpu/signal.c:fpu__restore_sig().
+func (c *Context64) fpStateRestore(st *Stack, fpStart hostarch.Addr, featureSet cpuid.FeatureSet) error {
+	if fpStart == 0 {
+		c.fpState.Reset()
+		return nil
+	}
+
+	fpsw := fpu.FPSoftwareFrame{}
+	st.Bottom = fpStart + fpu.FP_SW_FRAME_OFFSET
+	if _, err := fpsw.CopyIn(st, StackBottomMagic); err != nil {
+		c.fpState.Reset()
+		return err
+	}
+	if fpsw.Magic1 != fpu.FP_XSTATE_MAGIC1 ||
+		fpsw.XstateSize < fpu.FXSAVE_AREA_SIZE ||
+		fpsw.XstateSize > fpsw.ExtendedSize {
+		c.fpState.Reset()
+		return linuxerr.EFAULT
+	}
+
+	fpState := c.fpState.Slice()
+	fpSize := fpsw.XstateSize
+	if int(fpSize) < len(fpState) {
+		// The signal frame FPU state is smaller than expected. This can happen after S/R.
+		c.fpState.Reset()
+		fpState = fpState[:fpSize]
+	}
+
+	if _, err := st.IO.CopyIn(context.Background(), fpStart, fpState, usermem.IOOpts{}); err != nil {
+		c.fpState.Reset()
+		return err
+	}
+	c.fpState.SanitizeUser(featureSet)
+	return nil
 }
@@ -0,0 +1,380 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build amd64
+// +build amd64
+
+package arch
+
+import (
+	"math"
+
+	"golang.org/x/sys/unix"
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/cpuid"
+	"github.com/wilinz/gvisor/pkg/hostarch"
+	"github.com/wilinz/gvisor/pkg/marshal/primitive"
+	"github.com/wilinz/gvisor/pkg/sentry/arch/fpu"
+	"github.com/wilinz/gvisor/pkg/usermem"
+)
+
+// SignalContext32 is equivalent to struct sigcontext_32, the machine context
+// saved in ia32 signal frames.
+//
+// +marshal
+type SignalContext32 struct {
+	Gs          uint16
+	Gsh         uint16
+	Fs          uint16
+	Fsh         uint16
+	Es          uint16
+	Esh         uint16
+	Ds          uint16
+	Dsh         uint16
+	Edi         uint32
+	Esi         uint32
+	Ebp         uint32
+	Esp         uint32
+	Ebx         uint32
+	Edx         uint32
+	Ecx         uint32
+	Eax         uint32
+	Trapno      uint32
+	Err         uint32
+	Eip         uint32
+	Cs          uint16
+	Csh         uint16
+	Eflags      uint32
+	EspAtSignal uint32
+	Ss          uint16
+	Ssh         uint16
+	// Pointer to a struct _fpstate_32.
+	Fpstate uint32
+	Oldmask uint32
+	Cr2     uint32
+}
+
+// SignalStack32 is equivalent to compat_stack_t.
+//
+// +marshal
+type SignalStack32 struct {
+	Addr  uint32
+	Flags uint32
+	Size  uint32
+}
+
+// UContext32 is equivalent to struct ucontext_ia32.
+//
+// +marshal
+type UContext32 struct {
+	Flags    uint32
+	Link     uint32
+	Stack    SignalStack32
+	MContext SignalContext32
+	// Sigset is a compat_sigset_t, which is only 4-byte aligned.
+	Sigset [2]uint32
+}
+
+const (
+	// compatSignalInfoSize is sizeof(compat_siginfo_t).
+	compatSignalInfoSize = 128
+
+	// fsaveHeaderSize is sizeof(struct fregs_state), the legacy i387 state
+	// that precedes the FXSR/XSAVE state in ia32 signal frames.
+	fsaveHeaderSize = 112
+
+	// fpstateUnusedSize is sizeof(struct _fpstate_32), which is kept unused
+	// in non-RT ia32 signal frames.
+	fpstateUnusedSize = 624
+
+	// retcodeSize is the size of the sigreturn trampolines in ia32 signal
+	// frames.
+	retcodeSize = 8
+
+	// sigreturn32 and rtSigreturn32 are the i386 syscall numbers of
+	// sigreturn(2) and rt_sigreturn(2).
+	sigreturn32   = 119
+	rtSigreturn32 = 173
+)
+
+// compatSignalInfo returns info in the layout of compat_siginfo_t, in which the
+// union starts at offset 12 and longs and pointers are 32 bits wide. Compare
+// Linux's kernel/signal.c:copy_siginfo_to_user32().
+func compatSignalInfo(info *linux.SignalInfo) []byte {
+	b := make([]byte, compatSignalInfoSize)
+	hostarch.ByteOrder.PutUint32(b[0:], uint32(info.Signo))
+	hostarch.ByteOrder.PutUint32(b[4:], uint32(info.Errno))
+	hostarch.ByteOrder.PutUint32(b[8:], uint32(info.Code))
+	f := b[12:]
+	kernelCode := info.Code > linux.SI_USER && info.Code < linux.SI_KERNEL
+	switch sig := linux.Signal(info.Signo); {
+	case kernelCode && (sig == linux.SIGSEGV || sig == linux.SIGBUS || sig == linux.SIGILL || sig == linux.SIGFPE || sig == linux.SIGTRAP):
+		hostarch.ByteOrder.PutUint32(f[0:], uint32(info.Addr()))
+	case kernelCode && sig == linux.SIGCHLD:
+		// pid, uid and status are followed by utime and stime, which are
+		// 64 bits wide and aligned in siginfo_t.
+		copy(f[0:12], info.Fields[0:12])
+		hostarch.ByteOrder.PutUint32(f[12:], uint32(hostarch.ByteOrder.Uint64(info.Fields[16:])))
+		hostarch.ByteOrder.PutUint32(f[16:], uint32(hostarch.ByteOrder.Uint64(info.Fields[24:])))
+	case kernelCode && sig == linux.SIGPOLL:
+		hostarch.ByteOrder.PutUint32(f[0:], uint32(info.Band()))
+		hostarch.ByteOrder.PutUint32(f[4:], info.FD())
+	case kernelCode && sig == linux.SIGSYS:
+		hostarch.ByteOrder.PutUint32(f[0:], uint32(info.CallAddr()))
+		hostarch.ByteOrder.PutUint32(f[4:], uint32(info.Syscall()))
+		hostarch.ByteOrder.PutUint32(f[8:], info.Arch())
+	default:
+		// The kill, timer and rt layouts are made of two ints followed by
+		// a sigval, of which 32-bit code sees the low 32 bits.
+		copy(f[0:12], info.Fields[0:12])
+	}
+	return b
+}
+
+// signalSetup32 implements Context.SignalSetup for the 32-bit compatibility
+// mode. (Compare to Linux's arch/x86/kernel/signal_32.c:ia32_setup_frame() and
+// ia32_setup_rt_frame().)
+//
+// An RT frame is set up if the handler was installed with SA_SIGINFO, and a
+// non-RT frame otherwise, like Linux does.
+func (c *Context64) signalSetup32(st *Stack, act *linux.SigAction, info *linux.SignalInfo, alt *linux.SignalStack, sigset linux.SignalSet, featureSet cpuid.FeatureSet) error {
+	rt := act.Flags&linux.SA_SIGINFO != 0
+	sp := st.Bottom
+
+	// Allocate space for floating point state on the stack. The FXSR/XSAVE
+	// state is preceded by the legacy i387 state.
+	_, fpAlign := featureSet.ExtendedStateSize()
+	fpState := c.fpState.Slice()
+	fpSize := len(fpState) + fpu.FP_XSTATE_MAGIC2_SIZE
+	fxStart := (sp - hostarch.Addr(fpSize)) & ^hostarch.Addr(fpAlign-1)
+	fpStart := fxStart - fsaveHeaderSize
+
+	sc := SignalContext32{
+		Gs:          uint16(c.Regs.Gs),
+		Fs:          uint16(c.Regs.Fs),
+		Es:          uint16(c.Regs.Es),
+		Ds:          uint16(c.Regs.Ds),
+		Edi:         uint32(c.Regs.Rdi),
+		Esi:         uint32(c.Regs.Rsi),
+		Ebp:         uint32(c.Regs.Rbp),
+		Esp:         uint32(c.Regs.Rsp),
+		Ebx:         uint32(c.Regs.Rbx),
+		Edx:         uint32(c.Regs.Rdx),
+		Ecx:         uint32(c.Regs.Rcx),
+		Eax:         uint32(c.Regs.Rax),
+		Eip:         uint32(c.Regs.Rip),
+		Cs:          uint16(c.Regs.Cs),
+		Eflags:      uint32(c.Regs.Eflags),
+		EspAtSignal: uint32(c.Regs.Rsp),
+		Ss:          uint16(c.Regs.Ss),
+		Fpstate:     uint32(fpStart),
+		Oldmask:     uint32(sigset),
+	}
+	// See the TODO in SignalSetup about Err, Trapno and Cr2.
+	if linux.Signal(info.Signo) == linux.SIGSEGV || linux.Signal(info.Signo) == linux.SIGBUS {
+		sc.Cr2 = uint32(info.Addr())
+	}
+
+	// The frame starts with the return address and the signal number, and
+	// ends with the sigreturn trampoline.
+	var frameSize int
+	if rt {
+		// The RT frame also holds pointers to the siginfo and ucontext.
+		frameSize = 4*4 + compatSignalInfoSize + (*UContext32)(nil).SizeBytes() + retcodeSize
+	} else {
+		// The non-RT frame also holds the high word of the signal mask.
+		frameSize = 2*4 + sc.SizeBytes() + fpstateUnusedSize + 4 + retcodeSize
+	}
+	// "... ((sp + 4) & 15) == 0 ... at function entry" - i386 ABI, as in
+	// Linux's arch/x86/kernel/signal.c:align_sigframe().
+	frameStart := ((fpStart - hostarch.Addr(frameSize) + 4) & ^hostarch.Addr(15)) - 4
+	frameEnd := frameStart + hostarch.Addr(frameSize)
+
+	// See SignalSetup.
+	if act.Flags&linux.SA_ONSTACK != 0 && alt.IsEnabled() && !alt.Contains(frameStart) {
+		return unix.EFAULT
+	}
+
+	// Set up floating point state on the stack. Only the status word and
+	// its magic are set in the legacy i387 state, since the FXSR/XSAVE
+	// state is the one restored by sigreturn.
+	if err := c.fpStateSetup(st, fxStart, fpSize, featureSet); err != nil {
+		return err
+	}
+	fsaveHeader := make([]byte, fsaveHeaderSize)
+	fcw := hostarch.ByteOrder.Uint16(fpState[0:])
+	fsw := hostarch.ByteOrder.Uint16(fpState[2:])
+	hostarch.ByteOrder.PutUint32(fsaveHeader[0:], 0xffff0000|uint32(fcw))
+	hostarch.ByteOrder.PutUint32(fsaveHeader[4:], 0xffff0000|uint32(fsw))
+	hostarch.ByteOrder.PutUint16(fsaveHeader[108:], fsw)
+	// fsaveHeader[110:] is the magic, X86_FXSR_MAGIC (0).
+	if _, err := st.IO.CopyOut(context.Background(), fpStart, fsaveHeader, usermem.IOOpts{}); err != nil {
+		return err
+	}
+
+	// Adjust the code.
+	info.FixSignalCodeForUser()
+
+	// Set up the stack frame, starting with the trampoline that is used
+	// when there is no restorer: "popl %eax; movl $__NR_sigreturn, %eax;
+	// int $0x80" or "movl $__NR_rt_sigreturn, %eax; int $0x80".
+	var retcode [retcodeSize]byte
+	if rt {
+		retcode[0] = 0xb8
+		hostarch.ByteOrder.PutUint32(retcode[1:], rtSigreturn32)
+		retcode[5], retcode[6] = 0xcd, 0x80
+	} else {
+		retcode[0], retcode[1] = 0x58, 0xb8
+		hostarch.ByteOrder.PutUint32(retcode[2:], sigreturn32)
+		retcode[6], retcode[7] = 0xcd, 0x80
+	}
+	st.Bottom = frameEnd
+	if _, err := primitive.CopyByteSliceOut(st, StackBottomMagic, retcode[:]); err != nil {
+		return err
+	}
+	restorer := uint32(st.Bottom)
+	if act.Flags&linux.SA_RESTORER != 0 {
+		restorer = uint32(act.Restorer)
+	}
+
+	var infoAddr, ucAddr hostarch.Addr
+	if rt {
+		uc := &UContext32{
+			Stack: SignalStack32{
+				Addr:  uint32(alt.Addr),
+				Flags: alt.Flags,
+				Size:  uint32(alt.Size),
+			},
+			MContext: sc,
+			Sigset:   [2]uint32{uint32(sigset), uint32(sigset >> 32)},
+		}
+		if featureSet.UseXsave() {
+			uc.Flags |= _UC_FP_XSTATE
+		}
+		if _, err := uc.CopyOut(st, StackBottomMagic); err != nil {
+			return err
+		}
+		ucAddr = st.Bottom
+		if _, err := primitive.CopyByteSliceOut(st, StackBottomMagic, compatSignalInfo(info)); err != nil {
+			return err
+		}
+		infoAddr = st.Bottom
+		if _, err := primitive.CopyUint32SliceOut(st, StackBottomMagic, []uint32{uint32(infoAddr), uint32(ucAddr)}); err != nil {
+			return err
+		}
+	} else {
+		if _, err := primitive.CopyUint32Out(st, StackBottomMagic, uint32(sigset>>32)); err != nil {
+			return err
+		}
+		if _, err := primitive.CopyByteSliceOut(st, StackBottomMagic, make([]byte, fpstateUnusedSize)); err != nil {
+			return err
+		}
+		if _, err := sc.CopyOut(st, StackBottomMagic); err != nil {
+			return err
+		}
+	}
+	if _, err := primitive.CopyUint32SliceOut(st, StackBottomMagic, []uint32{restorer, uint32(info.Signo)}); err != nil {
+		return err
+	}
+
+	// Set up registers.
+	c.Regs.Rip = uint64(uint32(act.Handler))
+	c.Regs.Rsp = uint64(st.Bottom)
+	c.Regs.Rax = uint64(info.Signo)
+	c.Regs.Rdx = uint64(infoAddr)
+	c.Regs.Rcx = uint64(ucAddr)
+	c.Regs.Eflags &^= eflagsDF | eflagsRF | eflagsTF
+	c.Regs.Ds = userDS
+	c.Regs.Es = userDS
+	c.Regs.Cs = user32CS
+	c.Regs.Ss = userDS
+
+	// Clear floating point registers.
+	c.fpState.Reset()
+
+	return nil
+}
+
+// signalRestore32 implements Context.SignalRestore for the 32-bit
+// compatibility mode. (Compare to Linux's
+// arch/x86/kernel/signal_32.c:sys_ia32_sigreturn() and
+// sys_ia32_rt_sigreturn().)
+//
+// The returned signal stack is only meaningful if rt is true.
+func (c *Context64) signalRestore32(st *Stack, rt bool, featureSet cpuid.FeatureSet) (linux.SignalSet, linux.SignalStack, error) {
+	var (
+		sc     SignalContext32
+		sigset linux.SignalSet
+		alt    linux.SignalStack
+	)
+	if rt {
+		// The restorer has popped the return address, so the ucontext
+		// follows the signal number, the two pointers and the siginfo.
+		st.Bottom += 3*4 + compatSignalInfoSize
+		var uc UContext32
+		if _, err := uc.CopyIn(st, StackBottomMagic); err != nil {
+			return 0, linux.SignalStack{}, err
+		}
+		sc = uc.MContext
+		sigset = linux.SignalSet(uc.Sigset[0]) | linux.SignalSet(uc.Sigset[1])<<32
+		alt = linux.SignalStack{
+			Addr:  uint64(uc.Stack.Addr),
+			Flags: uc.Stack.Flags,
+			Size:  uint64(uc.Stack.Size),
+		}
+	} else {
+		// The restorer has popped the return address and the signal
+		// number, so the sigcontext is at the top of the stack.
+		if _, err := sc.CopyIn(st, StackBottomMagic); err != nil {
+			return 0, linux.SignalStack{}, err
+		}
+		st.Bottom += fpstateUnusedSize
+		var extramask primitive.Uint32
+		if _, err := extramask.CopyIn(st, StackBottomMagic); err != nil {
+			return 0, linux.SignalStack{}, err
+		}
+		sigset = linux.SignalSet(sc.Oldmask) | linux.SignalSet(extramask)<<32
+	}
+
+	// Restore registers. The high halves of the registers and r8-r15 are
+	// not visible to 32-bit code.
+	c.Regs.Rdi = uint64(sc.Edi)
+	c.Regs.Rsi = uint64(sc.Esi)
+	c.Regs.Rbp = uint64(sc.Ebp)
+	c.Regs.Rsp = uint64(sc.Esp)
+	c.Regs.Rbx = uint64(sc.Ebx)
+	c.Regs.Rdx = uint64(sc.Edx)
+	c.Regs.Rcx = uint64(sc.Ecx)
+	c.Regs.Rax = uint64(sc.Eax)
+	c.Regs.Rip = uint64(sc.Eip)
+	c.Regs.Eflags = (c.Regs.Eflags & ^eflagsRestorable) | (uint64(sc.Eflags) & eflagsRestorable)
+	c.Regs.Cs = uint64(sc.Cs) | 3
+	// N.B. As in SignalRestore, SS can't be changed. Data segments other
+	// than the TLS ones are flat, so they are reset rather than restored.
+	c.Regs.Ds = userDS
+	c.Regs.Es = userDS
+	c.Regs.Orig_rax = math.MaxUint64
+
+	// Restore floating point state, which follows the legacy i387 state.
+	fpStart := hostarch.Addr(sc.Fpstate)
+	if fpStart != 0 {
+		fpStart += fsaveHeaderSize
+	}
+	if err := c.fpStateRestore(st, fpStart, featureSet); err != nil {
+		return 0, linux.SignalStack{}, err
+	}
+
+	return sigset, alt, nil
+}
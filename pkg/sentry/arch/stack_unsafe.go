@@ -45,7 +45,12 @@ func (s *Stack) pushAddrSliceAndTerminator(src []hostarch.Addr) (int, error) {
 		if err != nil {
 			return 0, err
 		}
-		srcAsUint32 := *(*[]uint32)(unsafe.Pointer(&src))
+		// hostarch.Addr is 64 bits wide, so the addresses must be
+		// truncated one by one.
+		srcAsUint32 := make([]uint32, len(src))
+		for i, addr := range src {
+			srcAsUint32[i] = uint32(addr)
+		}
 		n, err := primitive.CopyUint32SliceOut(s, StackBottomMagic, srcAsUint32)
 		return n + nNull, err
 	default:
@@ -17,7 +17,13 @@
 
 package arch
 
-const restartSyscallNr = uintptr(219)
+const (
+	restartSyscallNr = uintptr(219)
+
+	// restartSyscallNr32 is the number of restart_syscall(2) in the i386
+	// syscall ABI.
+	restartSyscallNr32 = uintptr(0)
+)
 
 // SyscallSaveOrig save the value of the register which is clobbered in
 // syscall handler(doSyscall()).
@@ -26,8 +32,12 @@ const restartSyscallNr = uintptr(219)
 func (c *Context64) SyscallSaveOrig() {
 }
 
-// SyscallNo returns the syscall number according to the 64-bit convention.
+// SyscallNo returns the syscall number according to the 64-bit convention,
+// or the i386 convention in the 32-bit compatibility mode.
 func (c *Context64) SyscallNo() uintptr {
+	if c.Compat() {
+		return uintptr(uint32(c.Regs.Orig_rax))
+	}
 	return uintptr(c.Regs.Orig_rax)
 }
 
@@ -36,7 +46,20 @@ func (c *Context64) SyscallNo() uintptr {
 // Due to the way addresses are mapped for the sentry this binary *must* be
 // built in 64-bit mode. So we can just assume the syscall numbers that come
 // back match the expected host system call numbers.
+//
+// In the 32-bit compatibility mode, arguments are passed in %ebx, %ecx, %edx,
+// %esi, %edi and %ebp, and are zero-extended like in Linux.
 func (c *Context64) SyscallArgs() SyscallArguments {
+	if c.Compat() {
+		return SyscallArguments{
+			SyscallArgument{Value: uintptr(uint32(c.Regs.Rbx))},
+			SyscallArgument{Value: uintptr(uint32(c.Regs.Rcx))},
+			SyscallArgument{Value: uintptr(uint32(c.Regs.Rdx))},
+			SyscallArgument{Value: uintptr(uint32(c.Regs.Rsi))},
+			SyscallArgument{Value: uintptr(uint32(c.Regs.Rdi))},
+			SyscallArgument{Value: uintptr(uint32(c.Regs.Rbp))},
+		}
+	}
 	return SyscallArguments{
 		SyscallArgument{Value: uintptr(c.Regs.Rdi)},
 		SyscallArgument{Value: uintptr(c.Regs.Rsi)},
@@ -54,7 +77,13 @@ func (c *Context64) RestartSyscall() {
 }
 
 // RestartSyscallWithRestartBlock implements Context.RestartSyscallWithRestartBlock.
+//
+// int $0x80, used by 32-bit code, has the same width as syscall.
 func (c *Context64) RestartSyscallWithRestartBlock() {
 	c.Regs.Rip -= SyscallWidth
+	if c.Compat() {
+		c.Regs.Rax = uint64(restartSyscallNr32)
+		return
+	}
 	c.Regs.Rax = uint64(restartSyscallNr)
 }
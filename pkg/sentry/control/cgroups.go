@@ -16,6 +16,8 @@ package control
 
 import (
 	"fmt"
+	"path"
+	"sort"
 	"strings"
 
 	"github.com/wilinz/gvisor/pkg/context"
@@ -157,3 +159,109 @@ func (c *Cgroups) WriteControlFiles(args *CgroupsWriteArgs, out *CgroupsResults)
 	}
 	return nil
 }
+
+// cgroupStatFiles lists the control files reported as stats by List, by
+// controller. Only files that may be read from a background context are
+// included.
+var cgroupStatFiles = map[kernel.CgroupControllerType][]string{
+	kernel.CgroupControllerCPUAcct: {"cpuacct.usage", "cpuacct.usage_user", "cpuacct.usage_sys"},
+	kernel.CgroupControllerCPUSet:  {"cpuset.cpus", "cpuset.mems"},
+	kernel.CgroupControllerMemory:  {"memory.usage_in_bytes"},
+	kernel.CgroupControllerPIDs:    {"pids.current", "pids.max"},
+}
+
+// CgroupsListArgs represents the arguments for a list command.
+type CgroupsListArgs struct {
+	// Stats indicates whether per-cgroup stats should be included.
+	Stats bool `json:"stats"`
+}
+
+// CgroupInfo describes a single cgroup.
+type CgroupInfo struct {
+	ID       uint32 `json:"id"`
+	Path     string `json:"path"`
+	NumTasks int    `json:"num_tasks"`
+
+	// Stats maps control file names to their values. Only populated if
+	// CgroupsListArgs.Stats is set.
+	Stats map[string]string `json:"stats,omitempty"`
+}
+
+// CgroupHierarchy describes a cgroup hierarchy and all of its cgroups.
+type CgroupHierarchy struct {
+	ID          uint32   `json:"id"`
+	Name        string   `json:"name,omitempty"`
+	Controllers []string `json:"controllers"`
+
+	// Cgroups lists the cgroups in the hierarchy in pre-order, starting with
+	// the root cgroup.
+	Cgroups []CgroupInfo `json:"cgroups"`
+}
+
+// CgroupsListResult represents the result of a list command.
+type CgroupsListResult struct {
+	Hierarchies []CgroupHierarchy `json:"hierarchies"`
+}
+
+// List is an RPC stub for listing the cgroup hierarchies in the sandbox,
+// along with their controllers and cgroups.
+func (c *Cgroups) List(args *CgroupsListArgs, out *CgroupsListResult) error {
+	ctx := c.Kernel.SupervisorContext()
+	c.Kernel.CgroupRegistry().ForEachHierarchy(ctx, func(info kernel.CgroupHierarchyInfo) {
+		out.Hierarchies = append(out.Hierarchies, describeHierarchy(ctx, info, args.Stats))
+	})
+	return nil
+}
+
+// describeHierarchy returns the description of a hierarchy reported by List.
+func describeHierarchy(ctx context.Context, info kernel.CgroupHierarchyInfo, stats bool) CgroupHierarchy {
+	h := CgroupHierarchy{
+		ID:   info.ID,
+		Name: info.Name,
+	}
+	for _, ty := range info.Controllers {
+		h.Controllers = append(h.Controllers, string(ty))
+	}
+	var walk func(p string, cg kernel.CgroupImpl)
+	walk = func(p string, cg kernel.CgroupImpl) {
+		ci := CgroupInfo{
+			ID:       cg.ID(),
+			Path:     p,
+			NumTasks: cg.NumTasks(),
+		}
+		if stats {
+			ci.Stats = readCgroupStats(ctx, cg, info.Controllers)
+		}
+		h.Cgroups = append(h.Cgroups, ci)
+
+		var names []string
+		children := make(map[string]kernel.CgroupImpl)
+		cg.ForEachChild(func(name string, child kernel.CgroupImpl) {
+			names = append(names, name)
+			children[name] = child
+		})
+		sort.Strings(names)
+		for _, name := range names {
+			walk(path.Join(p, name), children[name])
+		}
+	}
+	walk("/", info.Root.CgroupImpl)
+	return h
+}
+
+// readCgroupStats reads the stat control files of cg for the given
+// controllers. Files that can't be read, such as pids.max in the root cgroup,
+// are omitted.
+func readCgroupStats(ctx context.Context, cg kernel.CgroupImpl, ctypes []kernel.CgroupControllerType) map[string]string {
+	stats := make(map[string]string)
+	for _, ty := range ctypes {
+		for _, name := range cgroupStatFiles[ty] {
+			val, err := cg.ReadControl(ctx, name)
+			if err != nil {
+				continue
+			}
+			stats[name] = strings.TrimSpace(val)
+		}
+	}
+	return stats
+}
@@ -0,0 +1,144 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+)
+
+// testCgroup is a kernel.CgroupImpl with fixed contents. Only the methods
+// used by List are implemented.
+type testCgroup struct {
+	kernel.CgroupImpl
+
+	id       uint32
+	numTasks int
+	children map[string]*testCgroup
+	controls map[string]string
+}
+
+// ID implements kernel.CgroupImpl.ID.
+func (cg *testCgroup) ID() uint32 {
+	return cg.id
+}
+
+// NumTasks implements kernel.CgroupImpl.NumTasks.
+func (cg *testCgroup) NumTasks() int {
+	return cg.numTasks
+}
+
+// ForEachChild implements kernel.CgroupImpl.ForEachChild.
+func (cg *testCgroup) ForEachChild(fn func(name string, child kernel.CgroupImpl)) {
+	for name, child := range cg.children {
+		fn(name, child)
+	}
+}
+
+// ReadControl implements kernel.CgroupImpl.ReadControl.
+func (cg *testCgroup) ReadControl(ctx context.Context, name string) (string, error) {
+	val, ok := cg.controls[name]
+	if !ok {
+		return "", linuxerr.ENOENT
+	}
+	return val, nil
+}
+
+func TestDescribeHierarchy(t *testing.T) {
+	root := &testCgroup{
+		id:       1,
+		numTasks: 3,
+		controls: map[string]string{
+			"pids.current":          "5\n",
+			"memory.usage_in_bytes": "4096\n",
+			// Not a stat file.
+			"pids.events": "max 0\n",
+		},
+		children: map[string]*testCgroup{
+			"b": {
+				id:       3,
+				numTasks: 1,
+				controls: map[string]string{
+					"pids.current": "1\n",
+					"pids.max":     "max\n",
+				},
+			},
+			"a": {
+				id:       2,
+				numTasks: 1,
+				controls: map[string]string{
+					"pids.current": "1\n",
+					"pids.max":     "16\n",
+				},
+				children: map[string]*testCgroup{
+					"c": {id: 4},
+				},
+			},
+		},
+	}
+	info := kernel.CgroupHierarchyInfo{
+		ID:          7,
+		Name:        "test",
+		Controllers: []kernel.CgroupControllerType{kernel.CgroupControllerMemory, kernel.CgroupControllerPIDs},
+		Root:        kernel.Cgroup{CgroupImpl: root},
+	}
+
+	for _, test := range []struct {
+		name  string
+		stats bool
+		want  CgroupHierarchy
+	}{
+		{
+			name: "without stats",
+			want: CgroupHierarchy{
+				ID:          7,
+				Name:        "test",
+				Controllers: []string{"memory", "pids"},
+				Cgroups: []CgroupInfo{
+					{ID: 1, Path: "/", NumTasks: 3},
+					{ID: 2, Path: "/a", NumTasks: 1},
+					{ID: 4, Path: "/a/c"},
+					{ID: 3, Path: "/b", NumTasks: 1},
+				},
+			},
+		},
+		{
+			name:  "with stats",
+			stats: true,
+			want: CgroupHierarchy{
+				ID:          7,
+				Name:        "test",
+				Controllers: []string{"memory", "pids"},
+				Cgroups: []CgroupInfo{
+					{ID: 1, Path: "/", NumTasks: 3, Stats: map[string]string{"memory.usage_in_bytes": "4096", "pids.current": "5"}},
+					{ID: 2, Path: "/a", NumTasks: 1, Stats: map[string]string{"pids.current": "1", "pids.max": "16"}},
+					{ID: 4, Path: "/a/c", Stats: map[string]string{}},
+					{ID: 3, Path: "/b", NumTasks: 1, Stats: map[string]string{"pids.current": "1", "pids.max": "max"}},
+				},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := describeHierarchy(context.Background(), info, test.stats)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("describeHierarchy: got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
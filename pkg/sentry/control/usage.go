@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"runtime/debug"
 
 	"golang.org/x/sys/unix"
 	"github.com/wilinz/gvisor/pkg/sentry/fsmetric"
@@ -157,6 +158,60 @@ func (u *Usage) Reduce(opts *UsageReduceOpts, out *UsageReduceOutput) error {
 	return nil
 }
 
+// UsageReclaimOpts contains options to Usage.Reclaim().
+type UsageReclaimOpts struct {
+	// If KeepCaches is true, Reclaim does not evict evictable memory, such
+	// as cached file contents, and only releases memory that is already
+	// unused.
+	KeepCaches bool `json:"keep_caches"`
+}
+
+// UsageReclaimOutput contains output from Usage.Reclaim().
+type UsageReclaimOutput struct {
+	// Before and After are the total memory usage of the MemoryFile, in
+	// bytes, before and after reclaiming.
+	Before uint64 `json:"before"`
+	After  uint64 `json:"after"`
+
+	// Released is the amount of MemoryFile memory, in bytes, that was
+	// returned to the host. It is zero if usage grew while reclaiming.
+	Released uint64 `json:"released"`
+}
+
+// Reclaim returns as much memory as possible to the host, like inflating a
+// balloon in a virtual machine. Unlike Reduce, it blocks until the memory has
+// been released: evictable memory is evicted (unless opts.KeepCaches is set),
+// freed MemoryFile pages are decommitted without waiting for the
+// asynchronous releaser, and unused Go heap memory is returned to the host.
+//
+// It is meant to be used by orchestrators to take memory back from idle
+// sandboxes. Memory is not reserved: the sandbox may allocate it again.
+func (u *Usage) Reclaim(opts *UsageReclaimOpts, out *UsageReclaimOutput) error {
+	mf := u.Kernel.MemoryFile()
+	before, err := mf.TotalUsage()
+	if err != nil {
+		return err
+	}
+	if !opts.KeepCaches {
+		mf.StartEvictions()
+		mf.WaitForEvictions()
+	}
+	mf.ReleaseWaste()
+	debug.FreeOSMemory()
+	after, err := mf.TotalUsage()
+	if err != nil {
+		return err
+	}
+	*out = UsageReclaimOutput{
+		Before: before,
+		After:  after,
+	}
+	if after < before {
+		out.Released = before - after
+	}
+	return nil
+}
+
 // MemoryUsageRecord contains the mapping and platform memory file.
 type MemoryUsageRecord struct {
 	mmap  uintptr
@@ -0,0 +1,734 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loopdev
+
+import (
+	"io"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/hostarch"
+	"github.com/wilinz/gvisor/pkg/marshal/primitive"
+	"github.com/wilinz/gvisor/pkg/sentry/arch"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+	"github.com/wilinz/gvisor/pkg/sentry/vfs"
+	"github.com/wilinz/gvisor/pkg/sync"
+	"github.com/wilinz/gvisor/pkg/usermem"
+)
+
+const (
+	// sectorSize is the unit of BLKGETSIZE.
+	sectorSize = 512
+
+	// defaultBlockSize is the logical block size of loop devices that have
+	// not been configured with LOOP_SET_BLOCK_SIZE or LOOP_CONFIGURE.
+	defaultBlockSize = 512
+)
+
+// binding describes the file bound to a loop device.
+//
+// +stateify savable
+type binding struct {
+	// file is the backing file.
+	file *vfs.FileDescription
+
+	// offset is the offset into file at which the device's contents begin.
+	offset uint64
+
+	// sizeLimit is the maximum size of the device in bytes. If sizeLimit is
+	// 0, the device extends to the end of file.
+	sizeLimit uint64
+
+	// flags contains LO_FLAGS_*.
+	flags uint32
+
+	// blockSize is the device's logical block size.
+	blockSize uint32
+
+	// fileName and cryptName are opaque values set by userspace, typically
+	// the path to file.
+	fileName  [linux.LO_NAME_SIZE]byte
+	cryptName [linux.LO_NAME_SIZE]byte
+}
+
+// size returns the size of the device in bytes.
+func (b *binding) size(ctx context.Context) (int64, error) {
+	fileSize, err := backingFileSize(ctx, b.file)
+	if err != nil {
+		return 0, err
+	}
+	if fileSize <= b.offset {
+		return 0, nil
+	}
+	size := fileSize - b.offset
+	if b.sizeLimit != 0 && b.sizeLimit < size {
+		size = b.sizeLimit
+	}
+	// Like Linux, round down to a multiple of the sector size.
+	return int64(size &^ (sectorSize - 1)), nil
+}
+
+// backingFileSize returns the size of file, which is a regular file or a loop
+// device, in bytes.
+func backingFileSize(ctx context.Context, file *vfs.FileDescription) (uint64, error) {
+	if lfd, ok := file.Impl().(*loopFD); ok {
+		// The device file's metadata doesn't include the device's size.
+		b, err := lfd.dev.getBinding()
+		if err != nil {
+			// The device has been unbound since file was validated.
+			return 0, nil
+		}
+		defer b.file.DecRef(ctx)
+		size, err := b.size(ctx)
+		return uint64(size), err
+	}
+	stat, err := file.Stat(ctx, vfs.StatOptions{Mask: linux.STATX_SIZE})
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size, nil
+}
+
+// loopDevice implements vfs.BlockDeviceOpener for /dev/loopN.
+//
+// +stateify savable
+type loopDevice struct {
+	r     *registry
+	minor uint32
+
+	mu sync.Mutex `state:"nosave"`
+
+	// removed is true if the device has been removed by LOOP_CTL_REMOVE.
+	// removed is protected by mu.
+	removed bool
+
+	// bind is the device's current binding, or nil if the device is
+	// unbound. A binding is never mutated after it is installed; changes
+	// are made by replacing bind. bind is protected by mu.
+	bind *binding
+
+	// users is the number of open file descriptions and
+	// vfs.BlockDeviceFiles referring to the device. users is protected by
+	// mu.
+	users int64
+}
+
+// Open implements vfs.Device.Open.
+func (dev *loopDevice) Open(ctx context.Context, mnt *vfs.Mount, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	if err := dev.incUsers(); err != nil {
+		return nil, err
+	}
+	fd := &loopFD{dev: dev}
+	if err := fd.vfsfd.Init(fd, opts.Flags, mnt, vfsd, &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+	}); err != nil {
+		dev.decUsers(ctx)
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// OpenBlockDevice implements vfs.BlockDeviceOpener.OpenBlockDevice.
+func (dev *loopDevice) OpenBlockDevice(ctx context.Context) (vfs.BlockDeviceFile, error) {
+	dev.mu.Lock()
+	defer dev.mu.Unlock()
+	if dev.removed || dev.bind == nil {
+		return nil, linuxerr.ENXIO
+	}
+	dev.users++
+	return &blockFile{dev: dev}, nil
+}
+
+func (dev *loopDevice) incUsers() error {
+	dev.mu.Lock()
+	defer dev.mu.Unlock()
+	if dev.removed {
+		return linuxerr.ENXIO
+	}
+	dev.users++
+	return nil
+}
+
+func (dev *loopDevice) decUsers(ctx context.Context) {
+	dev.mu.Lock()
+	dev.users--
+	var b *binding
+	if dev.users == 0 && dev.bind != nil && dev.bind.flags&linux.LO_FLAGS_AUTOCLEAR != 0 {
+		b = dev.bind
+		dev.bind = nil
+	}
+	dev.mu.Unlock()
+	if b != nil {
+		b.file.DecRef(ctx)
+	}
+}
+
+// getBinding returns the device's current binding. Callers must call
+// b.file.DecRef() when they are done with the returned binding.
+func (dev *loopDevice) getBinding() (*binding, error) {
+	dev.mu.Lock()
+	defer dev.mu.Unlock()
+	if dev.bind == nil {
+		return nil, linuxerr.ENXIO
+	}
+	dev.bind.file.IncRef()
+	return dev.bind, nil
+}
+
+// setStatusLocked installs a copy of dev.bind modified by fn.
+//
+// Preconditions: dev.mu must be locked. dev.bind != nil.
+func (dev *loopDevice) setStatusLocked(fn func(b *binding)) {
+	b := *dev.bind
+	fn(&b)
+	dev.bind = &b
+}
+
+// pread reads from the device at the given offset.
+func (dev *loopDevice) pread(ctx context.Context, dst usermem.IOSequence, offset int64) (int64, error) {
+	b, err := dev.getBinding()
+	if err != nil {
+		// Reads from unbound loop devices return EOF.
+		return 0, io.EOF
+	}
+	defer b.file.DecRef(ctx)
+	size, err := b.size(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if offset >= size {
+		return 0, io.EOF
+	}
+	dst = dst.TakeFirst64(size - offset)
+	return b.file.PRead(ctx, dst, int64(b.offset)+offset, vfs.ReadOptions{})
+}
+
+// pwrite writes to the device at the given offset.
+func (dev *loopDevice) pwrite(ctx context.Context, src usermem.IOSequence, offset int64) (int64, error) {
+	b, err := dev.getBinding()
+	if err != nil {
+		return 0, linuxerr.ENOSPC
+	}
+	defer b.file.DecRef(ctx)
+	if b.flags&linux.LO_FLAGS_READ_ONLY != 0 {
+		return 0, linuxerr.EPERM
+	}
+	size, err := b.size(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if offset >= size {
+		return 0, linuxerr.ENOSPC
+	}
+	src = src.TakeFirst64(size - offset)
+	return b.file.PWrite(ctx, src, int64(b.offset)+offset, vfs.WriteOptions{})
+}
+
+// configure binds the device to file, implementing LOOP_SET_FD and
+// LOOP_CONFIGURE. configure takes ownership of the caller's reference on
+// file. writable is true if the loop device was opened for writing.
+func (dev *loopDevice) configure(ctx context.Context, file *vfs.FileDescription, writable bool, cfg *linux.LoopConfig) error {
+	dev.r.bindMu.Lock()
+	defer dev.r.bindMu.Unlock()
+	if err := validateFile(ctx, dev, file); err != nil {
+		file.DecRef(ctx)
+		return err
+	}
+	blockSize := cfg.BlockSize
+	if blockSize == 0 {
+		blockSize = defaultBlockSize
+	}
+	if !validBlockSize(blockSize) {
+		file.DecRef(ctx)
+		return linuxerr.EINVAL
+	}
+	if cfg.Info.EncryptType != 0 {
+		file.DecRef(ctx)
+		return linuxerr.EINVAL
+	}
+
+	b := &binding{
+		file:      file,
+		offset:    cfg.Info.Offset,
+		sizeLimit: cfg.Info.SizeLimit,
+		flags:     cfg.Info.Flags & linux.LOOP_CONFIGURE_SETTABLE_FLAGS,
+		blockSize: blockSize,
+		fileName:  cfg.Info.FileName,
+		cryptName: cfg.Info.CryptName,
+	}
+	// As in Linux's drivers/block/loop.c:loop_configure(), the device is
+	// read-only unless both the backing file and the loop device itself were
+	// opened for writing. Otherwise writes through the loop device would
+	// bypass the access mode of the backing file.
+	if !file.IsWritable() || !writable {
+		b.flags |= linux.LO_FLAGS_READ_ONLY
+	}
+
+	dev.mu.Lock()
+	defer dev.mu.Unlock()
+	if dev.removed {
+		file.DecRef(ctx)
+		return linuxerr.ENXIO
+	}
+	if dev.bind != nil {
+		file.DecRef(ctx)
+		return linuxerr.EBUSY
+	}
+	dev.bind = b
+	return nil
+}
+
+// changeFD replaces the device's backing file, implementing LOOP_CHANGE_FD.
+// As in Linux, this is only permitted for read-only devices, and the new
+// file must have the same size as the old one. changeFD takes ownership of
+// the caller's reference on file.
+func (dev *loopDevice) changeFD(ctx context.Context, file *vfs.FileDescription) error {
+	dev.r.bindMu.Lock()
+	defer dev.r.bindMu.Unlock()
+	if err := validateFile(ctx, dev, file); err != nil {
+		file.DecRef(ctx)
+		return err
+	}
+	old, err := dev.getBinding()
+	if err != nil {
+		file.DecRef(ctx)
+		return err
+	}
+	defer old.file.DecRef(ctx)
+	if old.flags&linux.LO_FLAGS_READ_ONLY == 0 {
+		file.DecRef(ctx)
+		return linuxerr.EINVAL
+	}
+	oldSize, err := backingFileSize(ctx, old.file)
+	if err != nil {
+		file.DecRef(ctx)
+		return err
+	}
+	newSize, err := backingFileSize(ctx, file)
+	if err != nil {
+		file.DecRef(ctx)
+		return err
+	}
+	if oldSize != newSize {
+		file.DecRef(ctx)
+		return linuxerr.EINVAL
+	}
+
+	dev.mu.Lock()
+	if dev.bind != old {
+		dev.mu.Unlock()
+		file.DecRef(ctx)
+		return linuxerr.EBUSY
+	}
+	dev.setStatusLocked(func(b *binding) {
+		b.file = file
+	})
+	dev.mu.Unlock()
+	// Drop the reference previously held by dev.bind.
+	old.file.DecRef(ctx)
+	return nil
+}
+
+// clear unbinds the device, implementing LOOP_CLR_FD.
+func (dev *loopDevice) clear(ctx context.Context) error {
+	dev.mu.Lock()
+	if dev.bind == nil {
+		dev.mu.Unlock()
+		return linuxerr.ENXIO
+	}
+	// If the device is in use by anything other than the caller, defer
+	// clearing it until the last user goes away. This is consistent with
+	// Linux, and is relied on by e.g. umount -d.
+	if dev.users > 1 {
+		dev.setStatusLocked(func(b *binding) {
+			b.flags |= linux.LO_FLAGS_AUTOCLEAR
+		})
+		dev.mu.Unlock()
+		return nil
+	}
+	b := dev.bind
+	dev.bind = nil
+	dev.mu.Unlock()
+	b.file.DecRef(ctx)
+	return nil
+}
+
+// getStatus returns the device's status, implementing LOOP_GET_STATUS64.
+func (dev *loopDevice) getStatus(ctx context.Context) (linux.LoopInfo64, error) {
+	b, err := dev.getBinding()
+	if err != nil {
+		return linux.LoopInfo64{}, err
+	}
+	defer b.file.DecRef(ctx)
+	stat, err := b.file.Stat(ctx, vfs.StatOptions{Mask: linux.STATX_INO})
+	if err != nil {
+		return linux.LoopInfo64{}, err
+	}
+	return linux.LoopInfo64{
+		Device:    uint64(linux.MakeDeviceID(uint16(stat.DevMajor), stat.DevMinor)),
+		Inode:     stat.Ino,
+		Rdevice:   uint64(linux.MakeDeviceID(uint16(stat.RdevMajor), stat.RdevMinor)),
+		Offset:    b.offset,
+		SizeLimit: b.sizeLimit,
+		Number:    dev.minor,
+		Flags:     b.flags,
+		FileName:  b.fileName,
+		CryptName: b.cryptName,
+	}, nil
+}
+
+// setStatus updates the device's status, implementing LOOP_SET_STATUS64.
+func (dev *loopDevice) setStatus(info *linux.LoopInfo64) error {
+	if info.EncryptType != 0 {
+		return linuxerr.EINVAL
+	}
+	dev.mu.Lock()
+	defer dev.mu.Unlock()
+	if dev.bind == nil {
+		return linuxerr.ENXIO
+	}
+	dev.setStatusLocked(func(b *binding) {
+		b.offset = info.Offset
+		b.sizeLimit = info.SizeLimit
+		b.flags &^= linux.LOOP_SET_STATUS_CLEARABLE_FLAGS
+		b.flags |= info.Flags & linux.LOOP_SET_STATUS_SETTABLE_FLAGS
+		b.fileName = info.FileName
+		b.cryptName = info.CryptName
+	})
+	return nil
+}
+
+// setFlag sets or clears flag in the device's binding.
+func (dev *loopDevice) setFlag(flag uint32, set bool) error {
+	dev.mu.Lock()
+	defer dev.mu.Unlock()
+	if dev.bind == nil {
+		return linuxerr.ENXIO
+	}
+	dev.setStatusLocked(func(b *binding) {
+		if set {
+			b.flags |= flag
+		} else {
+			b.flags &^= flag
+		}
+	})
+	return nil
+}
+
+// setBlockSize sets the device's logical block size, implementing
+// LOOP_SET_BLOCK_SIZE.
+func (dev *loopDevice) setBlockSize(blockSize uint32) error {
+	if !validBlockSize(blockSize) {
+		return linuxerr.EINVAL
+	}
+	dev.mu.Lock()
+	defer dev.mu.Unlock()
+	if dev.bind == nil {
+		return linuxerr.ENXIO
+	}
+	dev.setStatusLocked(func(b *binding) {
+		b.blockSize = blockSize
+	})
+	return nil
+}
+
+// validateFile returns an error if file may not be bound to dev.
+//
+// As in Linux's drivers/block/loop.c:loop_validate_file(), file may be another
+// loop device, in which case the whole chain of loop devices backing it is
+// walked: it must not include dev, which would deadlock, or an unbound
+// device. Unlike Linux, other block devices are rejected, since their size
+// isn't known.
+//
+// Preconditions: dev.r.bindMu must be locked.
+func validateFile(ctx context.Context, dev *loopDevice, file *vfs.FileDescription) error {
+	f := file
+	f.IncRef()
+	defer func() {
+		f.DecRef(ctx)
+	}()
+	for {
+		lfd, ok := f.Impl().(*loopFD)
+		if !ok {
+			break
+		}
+		if lfd.dev == dev {
+			return linuxerr.EBADF
+		}
+		b, err := lfd.dev.getBinding()
+		if err != nil {
+			return linuxerr.EINVAL
+		}
+		f.DecRef(ctx)
+		f = b.file
+	}
+	stat, err := f.Stat(ctx, vfs.StatOptions{Mask: linux.STATX_TYPE})
+	if err != nil {
+		return err
+	}
+	if stat.Mode&linux.S_IFMT != linux.S_IFREG {
+		return linuxerr.EINVAL
+	}
+	return nil
+}
+
+// validBlockSize returns true if blockSize is a valid logical block size.
+func validBlockSize(blockSize uint32) bool {
+	return blockSize >= 512 && blockSize <= hostarch.PageSize && blockSize&(blockSize-1) == 0
+}
+
+// loopFD implements vfs.FileDescriptionImpl for /dev/loopN.
+//
+// +stateify savable
+type loopFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.NoLockFD
+
+	dev *loopDevice
+
+	// off is the file offset. offMu serializes operations that may mutate
+	// off.
+	off   int64
+	offMu sync.Mutex `state:"nosave"`
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *loopFD) Release(ctx context.Context) {
+	fd.dev.decUsers(ctx)
+}
+
+// PRead implements vfs.FileDescriptionImpl.PRead.
+func (fd *loopFD) PRead(ctx context.Context, dst usermem.IOSequence, offset int64, opts vfs.ReadOptions) (int64, error) {
+	if offset < 0 {
+		return 0, linuxerr.EINVAL
+	}
+	return fd.dev.pread(ctx, dst, offset)
+}
+
+// Read implements vfs.FileDescriptionImpl.Read.
+func (fd *loopFD) Read(ctx context.Context, dst usermem.IOSequence, opts vfs.ReadOptions) (int64, error) {
+	fd.offMu.Lock()
+	n, err := fd.dev.pread(ctx, dst, fd.off)
+	fd.off += n
+	fd.offMu.Unlock()
+	return n, err
+}
+
+// PWrite implements vfs.FileDescriptionImpl.PWrite.
+func (fd *loopFD) PWrite(ctx context.Context, src usermem.IOSequence, offset int64, opts vfs.WriteOptions) (int64, error) {
+	if offset < 0 {
+		return 0, linuxerr.EINVAL
+	}
+	return fd.dev.pwrite(ctx, src, offset)
+}
+
+// Write implements vfs.FileDescriptionImpl.Write.
+func (fd *loopFD) Write(ctx context.Context, src usermem.IOSequence, opts vfs.WriteOptions) (int64, error) {
+	fd.offMu.Lock()
+	n, err := fd.dev.pwrite(ctx, src, fd.off)
+	fd.off += n
+	fd.offMu.Unlock()
+	return n, err
+}
+
+// Seek implements vfs.FileDescriptionImpl.Seek.
+func (fd *loopFD) Seek(ctx context.Context, offset int64, whence int32) (int64, error) {
+	fd.offMu.Lock()
+	defer fd.offMu.Unlock()
+	size := int64(0)
+	if b, err := fd.dev.getBinding(); err == nil {
+		size, err = b.size(ctx)
+		b.file.DecRef(ctx)
+		if err != nil {
+			return 0, err
+		}
+	}
+	switch whence {
+	case linux.SEEK_SET:
+		// use offset as specified
+	case linux.SEEK_CUR:
+		offset += fd.off
+	case linux.SEEK_END:
+		offset += size
+	default:
+		return 0, linuxerr.EINVAL
+	}
+	// Block devices have a fixed size; compare Linux's
+	// fs/read_write.c:fixed_size_llseek().
+	if offset < 0 || offset > size {
+		return 0, linuxerr.EINVAL
+	}
+	fd.off = offset
+	return offset, nil
+}
+
+// Sync implements vfs.FileDescriptionImpl.Sync.
+func (fd *loopFD) Sync(ctx context.Context) error {
+	b, err := fd.dev.getBinding()
+	if err != nil {
+		return nil
+	}
+	defer b.file.DecRef(ctx)
+	return b.file.Sync(ctx)
+}
+
+// Ioctl implements vfs.FileDescriptionImpl.Ioctl.
+func (fd *loopFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		panic("Ioctl should be called from a task context")
+	}
+	dev := fd.dev
+
+	switch args[1].Uint() {
+	case linux.LOOP_SET_FD, linux.LOOP_CONFIGURE:
+		var cfg linux.LoopConfig
+		if args[1].Uint() == linux.LOOP_SET_FD {
+			cfg.FD = args[2].Uint()
+		} else if _, err := cfg.CopyIn(t, args[2].Pointer()); err != nil {
+			return 0, err
+		}
+		file := t.GetFile(int32(cfg.FD))
+		if file == nil {
+			return 0, linuxerr.EBADF
+		}
+		return 0, dev.configure(ctx, file, fd.vfsfd.IsWritable(), &cfg)
+
+	case linux.LOOP_CHANGE_FD:
+		file := t.GetFile(args[2].Int())
+		if file == nil {
+			return 0, linuxerr.EBADF
+		}
+		return 0, dev.changeFD(ctx, file)
+
+	case linux.LOOP_CLR_FD:
+		return 0, dev.clear(ctx)
+
+	case linux.LOOP_GET_STATUS64:
+		info, err := dev.getStatus(ctx)
+		if err != nil {
+			return 0, err
+		}
+		_, err = info.CopyOut(t, args[2].Pointer())
+		return 0, err
+
+	case linux.LOOP_SET_STATUS64:
+		var info linux.LoopInfo64
+		if _, err := info.CopyIn(t, args[2].Pointer()); err != nil {
+			return 0, err
+		}
+		return 0, dev.setStatus(&info)
+
+	case linux.LOOP_SET_CAPACITY:
+		// The device's size is always derived from the backing file, so
+		// there's nothing to recompute.
+		b, err := dev.getBinding()
+		if err != nil {
+			return 0, err
+		}
+		b.file.DecRef(ctx)
+		return 0, nil
+
+	case linux.LOOP_SET_DIRECT_IO:
+		return 0, dev.setFlag(linux.LO_FLAGS_DIRECT_IO, args[2].Uint64() != 0)
+
+	case linux.LOOP_SET_BLOCK_SIZE:
+		return 0, dev.setBlockSize(args[2].Uint())
+
+	case linux.BLKGETSIZE64, linux.BLKGETSIZE:
+		var size int64
+		if b, err := dev.getBinding(); err == nil {
+			size, err = b.size(ctx)
+			b.file.DecRef(ctx)
+			if err != nil {
+				return 0, err
+			}
+		}
+		if args[1].Uint() == linux.BLKGETSIZE {
+			size /= sectorSize
+		}
+		return copyOutUint64(t, args, uint64(size))
+
+	case linux.BLKSSZGET, linux.BLKBSZGET:
+		blockSize := uint32(defaultBlockSize)
+		if b, err := dev.getBinding(); err == nil {
+			blockSize = b.blockSize
+			b.file.DecRef(ctx)
+		}
+		_, err := primitive.CopyInt32Out(t, args[2].Pointer(), int32(blockSize))
+		return 0, err
+
+	case linux.BLKROGET:
+		var ro int32
+		if b, err := dev.getBinding(); err == nil {
+			if b.flags&linux.LO_FLAGS_READ_ONLY != 0 {
+				ro = 1
+			}
+			b.file.DecRef(ctx)
+		}
+		_, err := primitive.CopyInt32Out(t, args[2].Pointer(), ro)
+		return 0, err
+
+	case linux.BLKFLSBUF:
+		if !t.HasCapability(linux.CAP_SYS_ADMIN) {
+			return 0, linuxerr.EACCES
+		}
+		return 0, fd.Sync(ctx)
+
+	default:
+		return 0, linuxerr.ENOTTY
+	}
+}
+
+// blockFile implements vfs.BlockDeviceFile for loop devices.
+//
+// +stateify savable
+type blockFile struct {
+	dev *loopDevice
+}
+
+// ReadAt implements vfs.BlockDeviceFile.ReadAt.
+func (bf *blockFile) ReadAt(ctx context.Context, dst []byte, off int64) (int, error) {
+	var total int
+	for total < len(dst) {
+		n, err := bf.dev.pread(ctx, usermem.BytesIOSequence(dst[total:]), off+int64(total))
+		total += int(n)
+		if err != nil {
+			return total, err
+		}
+		if n == 0 {
+			return total, io.ErrUnexpectedEOF
+		}
+	}
+	return total, nil
+}
+
+// Size implements vfs.BlockDeviceFile.Size.
+func (bf *blockFile) Size(ctx context.Context) (int64, error) {
+	b, err := bf.dev.getBinding()
+	if err != nil {
+		return 0, err
+	}
+	defer b.file.DecRef(ctx)
+	return b.size(ctx)
+}
+
+// Release implements vfs.BlockDeviceFile.Release.
+func (bf *blockFile) Release(ctx context.Context) {
+	bf.dev.decUsers(ctx)
+}
@@ -0,0 +1,261 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package loopdev implements loop block devices (/dev/loopN) and the
+// /dev/loop-control device, as implemented in Linux by drivers/block/loop.c.
+//
+// A loop device maps a regular file to a block device, allowing filesystem
+// images stored in sandbox filesystems to be mounted.
+package loopdev
+
+import (
+	"fmt"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/marshal/primitive"
+	"github.com/wilinz/gvisor/pkg/sentry/arch"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+	"github.com/wilinz/gvisor/pkg/sentry/vfs"
+	"github.com/wilinz/gvisor/pkg/sync"
+	"github.com/wilinz/gvisor/pkg/usermem"
+)
+
+// numLoopDevices is the number of loop devices registered by Register. This
+// is consistent with Linux's default CONFIG_BLK_DEV_LOOP_MIN_COUNT.
+//
+// Unlike Linux, the number of loop devices is fixed: device files in /dev are
+// only created for devices that are registered when /dev is mounted, so
+// devices added by LOOP_CTL_ADD or LOOP_CTL_GET_FREE after that point would
+// be inaccessible. Instead, LOOP_CTL_ADD may only revive a removed device
+// with minor number less than numLoopDevices, and both LOOP_CTL_ADD and
+// LOOP_CTL_GET_FREE fail with ENOSPC when no such device is available.
+const numLoopDevices = 8
+
+// registry tracks all loop devices in a VirtualFilesystem.
+//
+// +stateify savable
+type registry struct {
+	vfsObj *vfs.VirtualFilesystem
+
+	mu sync.Mutex `state:"nosave"`
+
+	// devices maps minor device numbers to loop devices. devices is
+	// protected by mu.
+	devices map[uint32]*loopDevice
+
+	// bindMu serializes validating backing files with binding them, so that
+	// concurrent binds can't form a cycle of loop devices. This is
+	// equivalent to Linux's loop_validate_mutex. bindMu is ordered before
+	// loopDevice.mu.
+	bindMu sync.Mutex `state:"nosave"`
+}
+
+// registerLocked registers the loop device with the given minor device
+// number.
+//
+// Preconditions: r.mu must be locked. minor < numLoopDevices.
+func (r *registry) registerLocked(minor uint32) error {
+	dev := &loopDevice{
+		r:     r,
+		minor: minor,
+	}
+	if err := r.vfsObj.RegisterDevice(vfs.BlockDevice, linux.LOOP_MAJOR, minor, dev, &vfs.RegisterDeviceOptions{
+		GroupName: "loop",
+		Pathname:  fmt.Sprintf("loop%d", minor),
+		FilePerms: 0660,
+	}); err != nil {
+		return err
+	}
+	r.devices[minor] = dev
+	return nil
+}
+
+// add adds the loop device with the given minor device number, implementing
+// LOOP_CTL_ADD.
+func (r *registry) add(minor uint32) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	dev, ok := r.devices[minor]
+	if !ok {
+		// See comment on numLoopDevices.
+		return linuxerr.ENOSPC
+	}
+	// Device numbers can't be unregistered from VFS, so removed loop devices
+	// are revived rather than registered again.
+	dev.mu.Lock()
+	defer dev.mu.Unlock()
+	if !dev.removed {
+		return linuxerr.EEXIST
+	}
+	dev.removed = false
+	return nil
+}
+
+// getFree returns the minor device number of an unbound loop device,
+// reviving a removed loop device if necessary, implementing
+// LOOP_CTL_GET_FREE.
+func (r *registry) getFree() (uint32, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var removed *loopDevice
+	for minor := uint32(0); minor < numLoopDevices; minor++ {
+		dev := r.devices[minor]
+		dev.mu.Lock()
+		if !dev.removed && dev.bind == nil {
+			dev.mu.Unlock()
+			return minor, nil
+		}
+		if dev.removed && removed == nil {
+			removed = dev
+		}
+		dev.mu.Unlock()
+	}
+	if removed == nil {
+		return 0, linuxerr.ENOSPC
+	}
+	removed.mu.Lock()
+	defer removed.mu.Unlock()
+	removed.removed = false
+	return removed.minor, nil
+}
+
+// remove removes the loop device with the given minor device number.
+func (r *registry) remove(minor uint32) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	dev, ok := r.devices[minor]
+	if !ok {
+		return linuxerr.ENODEV
+	}
+	dev.mu.Lock()
+	defer dev.mu.Unlock()
+	if dev.removed {
+		return linuxerr.ENODEV
+	}
+	if dev.bind != nil || dev.users != 0 {
+		return linuxerr.EBUSY
+	}
+	dev.removed = true
+	return nil
+}
+
+// controlDevice implements vfs.Device for /dev/loop-control.
+//
+// +stateify savable
+type controlDevice struct {
+	r *registry
+}
+
+// Open implements vfs.Device.Open.
+func (dev *controlDevice) Open(ctx context.Context, mnt *vfs.Mount, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	fd := &controlFD{r: dev.r}
+	if err := fd.vfsfd.Init(fd, opts.Flags, mnt, vfsd, &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+	}); err != nil {
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// controlFD implements vfs.FileDescriptionImpl for /dev/loop-control.
+//
+// +stateify savable
+type controlFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.NoLockFD
+
+	r *registry
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *controlFD) Release(context.Context) {
+	// noop
+}
+
+// Ioctl implements vfs.FileDescriptionImpl.Ioctl.
+func (fd *controlFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		panic("Ioctl should be called from a task context")
+	}
+	if !t.HasCapability(linux.CAP_SYS_ADMIN) {
+		return 0, linuxerr.EPERM
+	}
+
+	// Unlike most ioctls, the loop-control ioctls take their argument by
+	// value.
+	switch args[1].Uint() {
+	case linux.LOOP_CTL_ADD:
+		minor := args[2].Uint()
+		if err := fd.r.add(minor); err != nil {
+			return 0, err
+		}
+		return uintptr(minor), nil
+
+	case linux.LOOP_CTL_REMOVE:
+		minor := args[2].Uint()
+		if err := fd.r.remove(minor); err != nil {
+			return 0, err
+		}
+		return uintptr(minor), nil
+
+	case linux.LOOP_CTL_GET_FREE:
+		minor, err := fd.r.getFree()
+		if err != nil {
+			return 0, err
+		}
+		return uintptr(minor), nil
+
+	default:
+		return 0, linuxerr.ENOTTY
+	}
+}
+
+// Register registers all devices implemented by this package in vfsObj.
+func Register(vfsObj *vfs.VirtualFilesystem) error {
+	_, err := register(vfsObj)
+	return err
+}
+
+// register implements Register, and returns the registry of loop devices.
+func register(vfsObj *vfs.VirtualFilesystem) (*registry, error) {
+	r := &registry{
+		vfsObj:  vfsObj,
+		devices: make(map[uint32]*loopDevice),
+	}
+	if err := vfsObj.RegisterDevice(vfs.CharDevice, linux.MISC_MAJOR, linux.LOOP_CTRL_MINOR, &controlDevice{r: r}, &vfs.RegisterDeviceOptions{
+		Pathname:  "loop-control",
+		FilePerms: 0660,
+	}); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for minor := uint32(0); minor < numLoopDevices; minor++ {
+		if err := r.registerLocked(minor); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// copyOutUint64 copies val to the ioctl argument in args.
+func copyOutUint64(t *kernel.Task, args arch.SyscallArguments, val uint64) (uintptr, error) {
+	_, err := primitive.CopyUint64Out(t, args[2].Pointer(), val)
+	return 0, err
+}
@@ -0,0 +1,446 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loopdev
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/fspath"
+	"github.com/wilinz/gvisor/pkg/sentry/contexttest"
+	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/tmpfs"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
+	"github.com/wilinz/gvisor/pkg/sentry/vfs"
+	"github.com/wilinz/gvisor/pkg/usermem"
+)
+
+// testFileSize is the size of the backing file created by setup.
+const testFileSize = 4096
+
+type testEnv struct {
+	ctx    context.Context
+	creds  *auth.Credentials
+	vfsObj *vfs.VirtualFilesystem
+	root   vfs.VirtualDentry
+	r      *registry
+}
+
+// setup returns a VFS with a tmpfs root containing a file "backing" of size
+// testFileSize, and loop devices registered.
+func setup(t *testing.T) *testEnv {
+	t.Helper()
+
+	ctx := contexttest.Context(t)
+	creds := auth.CredentialsFromContext(ctx)
+	vfsObj := &vfs.VirtualFilesystem{}
+	if err := vfsObj.Init(ctx); err != nil {
+		t.Fatalf("VFS init: %v", err)
+	}
+	vfsObj.MustRegisterFilesystemType("tmpfs", tmpfs.FilesystemType{}, &vfs.RegisterFilesystemTypeOptions{
+		AllowUserMount: true,
+	})
+	mntns, err := vfsObj.NewMountNamespace(ctx, creds, "", "tmpfs", &vfs.MountOptions{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create tmpfs root mount: %v", err)
+	}
+	root := mntns.Root(ctx)
+	t.Cleanup(func() {
+		root.DecRef(ctx)
+		mntns.DecRef(ctx)
+	})
+	r, err := register(vfsObj)
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	env := &testEnv{
+		ctx:    ctx,
+		creds:  creds,
+		vfsObj: vfsObj,
+		root:   root,
+		r:      r,
+	}
+	fd := env.open(t, linux.O_RDWR|linux.O_CREAT)
+	defer fd.DecRef(ctx)
+	if _, err := fd.Write(ctx, usermem.BytesIOSequence(bytes.Repeat([]byte{'a'}, testFileSize)), vfs.WriteOptions{}); err != nil {
+		t.Fatalf("write backing file: %v", err)
+	}
+	return env
+}
+
+// open opens the backing file with the given flags.
+func (env *testEnv) open(t *testing.T, flags uint32) *vfs.FileDescription {
+	t.Helper()
+	pop := vfs.PathOperation{
+		Root:  env.root,
+		Start: env.root,
+		Path:  fspath.Parse("backing"),
+	}
+	fd, err := env.vfsObj.OpenAt(env.ctx, env.creds, &pop, &vfs.OpenOptions{
+		Flags: flags,
+		Mode:  0644,
+	})
+	if err != nil {
+		t.Fatalf("open backing file: %v", err)
+	}
+	return fd
+}
+
+// bind binds the loop device with the given minor number to the backing file
+// opened with fileFlags, and returns the device.
+func (env *testEnv) bind(t *testing.T, minor uint32, fileFlags uint32, writable bool, info linux.LoopInfo64) *loopDevice {
+	t.Helper()
+	dev := env.r.devices[minor]
+	cfg := linux.LoopConfig{Info: info}
+	if err := dev.configure(env.ctx, env.open(t, fileFlags), writable, &cfg); err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+	t.Cleanup(func() {
+		dev.mu.Lock()
+		b := dev.bind
+		dev.bind = nil
+		dev.mu.Unlock()
+		if b != nil {
+			b.file.DecRef(env.ctx)
+		}
+	})
+	return dev
+}
+
+// openDevice opens a device file for the loop device with the given minor
+// number, creating it if necessary.
+func (env *testEnv) openDevice(t *testing.T, minor uint32) *vfs.FileDescription {
+	t.Helper()
+	pop := vfs.PathOperation{
+		Root:  env.root,
+		Start: env.root,
+		Path:  fspath.Parse(fmt.Sprintf("loop%d", minor)),
+	}
+	if err := env.vfsObj.MknodAt(env.ctx, env.creds, &pop, &vfs.MknodOptions{
+		Mode:     linux.S_IFBLK | 0600,
+		DevMajor: linux.LOOP_MAJOR,
+		DevMinor: minor,
+	}); err != nil && err != linuxerr.EEXIST {
+		t.Fatalf("mknod loop%d: %v", minor, err)
+	}
+	fd, err := env.vfsObj.OpenAt(env.ctx, env.creds, &pop, &vfs.OpenOptions{
+		Flags: linux.O_RDWR,
+	})
+	if err != nil {
+		t.Fatalf("open loop%d: %v", minor, err)
+	}
+	return fd
+}
+
+func TestRegister(t *testing.T) {
+	env := setup(t)
+	for minor := uint32(0); minor < numLoopDevices; minor++ {
+		if !env.vfsObj.IsDeviceRegistered(vfs.BlockDevice, linux.LOOP_MAJOR, minor) {
+			t.Errorf("loop%d is not registered", minor)
+		}
+	}
+	if env.vfsObj.IsDeviceRegistered(vfs.BlockDevice, linux.LOOP_MAJOR, numLoopDevices) {
+		t.Errorf("loop%d is registered", numLoopDevices)
+	}
+	if !env.vfsObj.IsDeviceRegistered(vfs.CharDevice, linux.MISC_MAJOR, linux.LOOP_CTRL_MINOR) {
+		t.Errorf("loop-control is not registered")
+	}
+}
+
+func TestAddRemove(t *testing.T) {
+	env := setup(t)
+	for _, test := range []struct {
+		name string
+		op   func() error
+		want error
+	}{
+		{"add existing", func() error { return env.r.add(0) }, linuxerr.EEXIST},
+		{"add past limit", func() error { return env.r.add(numLoopDevices) }, linuxerr.ENOSPC},
+		{"remove", func() error { return env.r.remove(3) }, nil},
+		{"remove removed", func() error { return env.r.remove(3) }, linuxerr.ENODEV},
+		{"remove past limit", func() error { return env.r.remove(numLoopDevices) }, linuxerr.ENODEV},
+		{"add removed", func() error { return env.r.add(3) }, nil},
+	} {
+		if err := test.op(); err != test.want {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestRemoveBusy(t *testing.T) {
+	env := setup(t)
+	env.bind(t, 0, linux.O_RDWR, true, linux.LoopInfo64{})
+	if err := env.r.remove(0); err != linuxerr.EBUSY {
+		t.Errorf("remove bound device: got error %v, want %v", err, linuxerr.EBUSY)
+	}
+}
+
+func TestGetFree(t *testing.T) {
+	env := setup(t)
+	for minor := uint32(0); minor < numLoopDevices; minor++ {
+		got, err := env.r.getFree()
+		if err != nil || got != minor {
+			t.Fatalf("getFree: got (%d, %v), want (%d, nil)", got, err, minor)
+		}
+		env.bind(t, minor, linux.O_RDWR, true, linux.LoopInfo64{})
+	}
+	if _, err := env.r.getFree(); err != linuxerr.ENOSPC {
+		t.Fatalf("getFree with all devices bound: got error %v, want %v", err, linuxerr.ENOSPC)
+	}
+
+	// Removed devices are revived by getFree.
+	dev := env.r.devices[5]
+	dev.mu.Lock()
+	b := dev.bind
+	dev.bind = nil
+	dev.removed = true
+	dev.mu.Unlock()
+	b.file.DecRef(env.ctx)
+	if got, err := env.r.getFree(); err != nil || got != 5 {
+		t.Fatalf("getFree with removed device: got (%d, %v), want (5, nil)", got, err)
+	}
+	if dev.removed {
+		t.Errorf("getFree did not revive loop5")
+	}
+}
+
+func TestConfigureReadOnly(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		fileFlags uint32
+		writable  bool
+		flags     uint32
+		readOnly  bool
+	}{
+		{"writable", linux.O_RDWR, true, 0, false},
+		{"read-only backing file", linux.O_RDONLY, true, 0, true},
+		{"read-only loop device", linux.O_RDWR, false, 0, true},
+		{"LO_FLAGS_READ_ONLY", linux.O_RDWR, true, linux.LO_FLAGS_READ_ONLY, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			env := setup(t)
+			dev := env.bind(t, 0, test.fileFlags, test.writable, linux.LoopInfo64{Flags: test.flags})
+			if got := dev.bind.flags&linux.LO_FLAGS_READ_ONLY != 0; got != test.readOnly {
+				t.Errorf("LO_FLAGS_READ_ONLY: got %t, want %t", got, test.readOnly)
+			}
+			_, err := dev.pwrite(env.ctx, usermem.BytesIOSequence([]byte{'b'}), 0)
+			if test.readOnly && err != linuxerr.EPERM {
+				t.Errorf("pwrite: got error %v, want %v", err, linuxerr.EPERM)
+			} else if !test.readOnly && err != nil {
+				t.Errorf("pwrite: got error %v, want nil", err)
+			}
+
+			// LOOP_SET_STATUS64 can't make the device writable.
+			if err := dev.setStatus(&linux.LoopInfo64{}); err != nil {
+				t.Fatalf("setStatus: %v", err)
+			}
+			if got := dev.bind.flags&linux.LO_FLAGS_READ_ONLY != 0; got != test.readOnly {
+				t.Errorf("LO_FLAGS_READ_ONLY after setStatus: got %t, want %t", got, test.readOnly)
+			}
+		})
+	}
+}
+
+func TestConfigureErrors(t *testing.T) {
+	env := setup(t)
+
+	dev := env.r.devices[1]
+	if err := env.r.remove(1); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := dev.configure(env.ctx, env.open(t, linux.O_RDWR), true, &linux.LoopConfig{}); err != linuxerr.ENXIO {
+		t.Errorf("configure removed device: got error %v, want %v", err, linuxerr.ENXIO)
+	}
+
+	dev = env.bind(t, 0, linux.O_RDWR, true, linux.LoopInfo64{})
+	if err := dev.configure(env.ctx, env.open(t, linux.O_RDWR), true, &linux.LoopConfig{}); err != linuxerr.EBUSY {
+		t.Errorf("configure bound device: got error %v, want %v", err, linuxerr.EBUSY)
+	}
+
+	dev = env.r.devices[2]
+	if err := dev.configure(env.ctx, env.open(t, linux.O_RDWR), true, &linux.LoopConfig{BlockSize: 1000}); err != linuxerr.EINVAL {
+		t.Errorf("configure with invalid block size: got error %v, want %v", err, linuxerr.EINVAL)
+	}
+	if dev.bind != nil {
+		t.Errorf("failed configure bound the device")
+	}
+}
+
+func TestReadWrite(t *testing.T) {
+	env := setup(t)
+	dev := env.bind(t, 0, linux.O_RDWR, true, linux.LoopInfo64{
+		Offset:    512,
+		SizeLimit: 1024,
+	})
+
+	size, err := dev.bind.size(env.ctx)
+	if err != nil || size != 1024 {
+		t.Fatalf("size: got (%d, %v), want (1024, nil)", size, err)
+	}
+
+	// Writes are truncated to the size of the device, and are relative to
+	// the binding's offset.
+	src := bytes.Repeat([]byte{'b'}, 1024)
+	if n, err := dev.pwrite(env.ctx, usermem.BytesIOSequence(src), 512); err != nil || n != 512 {
+		t.Fatalf("pwrite: got (%d, %v), want (512, nil)", n, err)
+	}
+	if _, err := dev.pwrite(env.ctx, usermem.BytesIOSequence(src), 1024); err != linuxerr.ENOSPC {
+		t.Errorf("pwrite past end: got error %v, want %v", err, linuxerr.ENOSPC)
+	}
+
+	fd := env.open(t, linux.O_RDONLY)
+	defer fd.DecRef(env.ctx)
+	buf := make([]byte, testFileSize)
+	if _, err := fd.PRead(env.ctx, usermem.BytesIOSequence(buf), 0, vfs.ReadOptions{}); err != nil && err != io.EOF {
+		t.Fatalf("read backing file: %v", err)
+	}
+	want := bytes.Repeat([]byte{'a'}, testFileSize)
+	copy(want[1024:1536], bytes.Repeat([]byte{'b'}, 512))
+	if !bytes.Equal(buf, want) {
+		t.Errorf("backing file has unexpected contents after pwrite")
+	}
+
+	buf = make([]byte, 1024)
+	if n, err := dev.pread(env.ctx, usermem.BytesIOSequence(buf), 0); err != nil || n != 1024 {
+		t.Fatalf("pread: got (%d, %v), want (1024, nil)", n, err)
+	}
+	if !bytes.Equal(buf, want[512:1536]) {
+		t.Errorf("pread returned unexpected contents")
+	}
+	if _, err := dev.pread(env.ctx, usermem.BytesIOSequence(buf), 1024); err != io.EOF {
+		t.Errorf("pread past end: got error %v, want %v", err, io.EOF)
+	}
+}
+
+func TestUnboundDevice(t *testing.T) {
+	env := setup(t)
+	dev := env.r.devices[0]
+	if _, err := dev.pread(env.ctx, usermem.BytesIOSequence(make([]byte, 1)), 0); err != io.EOF {
+		t.Errorf("pread: got error %v, want %v", err, io.EOF)
+	}
+	if _, err := dev.pwrite(env.ctx, usermem.BytesIOSequence(make([]byte, 1)), 0); err != linuxerr.ENOSPC {
+		t.Errorf("pwrite: got error %v, want %v", err, linuxerr.ENOSPC)
+	}
+	if _, err := dev.OpenBlockDevice(env.ctx); err != linuxerr.ENXIO {
+		t.Errorf("OpenBlockDevice: got error %v, want %v", err, linuxerr.ENXIO)
+	}
+	if err := dev.clear(env.ctx); err != linuxerr.ENXIO {
+		t.Errorf("clear: got error %v, want %v", err, linuxerr.ENXIO)
+	}
+}
+
+func TestClearDeferred(t *testing.T) {
+	env := setup(t)
+	dev := env.bind(t, 0, linux.O_RDWR, true, linux.LoopInfo64{})
+
+	// Simulate the caller's file description and a mounted filesystem.
+	if err := dev.incUsers(); err != nil {
+		t.Fatalf("incUsers: %v", err)
+	}
+	bf, err := dev.OpenBlockDevice(env.ctx)
+	if err != nil {
+		t.Fatalf("OpenBlockDevice: %v", err)
+	}
+
+	if err := dev.clear(env.ctx); err != nil {
+		t.Fatalf("clear: %v", err)
+	}
+	if dev.bind == nil {
+		t.Fatalf("clear unbound a device that is in use")
+	}
+	if dev.bind.flags&linux.LO_FLAGS_AUTOCLEAR == 0 {
+		t.Errorf("clear did not set LO_FLAGS_AUTOCLEAR")
+	}
+
+	bf.Release(env.ctx)
+	if dev.bind == nil {
+		t.Fatalf("device was unbound while still in use")
+	}
+	dev.decUsers(env.ctx)
+	if dev.bind != nil {
+		t.Errorf("device was not unbound after its last user went away")
+	}
+}
+
+func TestChangeFD(t *testing.T) {
+	env := setup(t)
+
+	dev := env.bind(t, 0, linux.O_RDWR, true, linux.LoopInfo64{})
+	if err := dev.changeFD(env.ctx, env.open(t, linux.O_RDONLY)); err != linuxerr.EINVAL {
+		t.Errorf("changeFD on writable device: got error %v, want %v", err, linuxerr.EINVAL)
+	}
+
+	dev = env.bind(t, 1, linux.O_RDONLY, true, linux.LoopInfo64{})
+	old := dev.bind
+	if err := dev.changeFD(env.ctx, env.open(t, linux.O_RDONLY)); err != nil {
+		t.Fatalf("changeFD: %v", err)
+	}
+	if dev.bind == old || dev.bind.file == old.file {
+		t.Errorf("changeFD did not replace the backing file")
+	}
+	if dev.bind.flags&linux.LO_FLAGS_READ_ONLY == 0 {
+		t.Errorf("changeFD cleared LO_FLAGS_READ_ONLY")
+	}
+}
+
+func TestLoopDeviceBacking(t *testing.T) {
+	env := setup(t)
+
+	// Binding a loop device to itself, directly or through other loop
+	// devices, or to an unbound loop device fails.
+	dev0 := env.bind(t, 0, linux.O_RDWR, true, linux.LoopInfo64{Offset: 512})
+	if err := dev0.configure(env.ctx, env.openDevice(t, 0), true, &linux.LoopConfig{}); err != linuxerr.EBUSY {
+		t.Errorf("configure bound device: got error %v, want %v", err, linuxerr.EBUSY)
+	}
+	if err := dev0.changeFD(env.ctx, env.openDevice(t, 0)); err != linuxerr.EBADF {
+		t.Errorf("changeFD to itself: got error %v, want %v", err, linuxerr.EBADF)
+	}
+	dev1 := env.r.devices[1]
+	if err := dev1.configure(env.ctx, env.openDevice(t, 2), true, &linux.LoopConfig{}); err != linuxerr.EINVAL {
+		t.Errorf("configure with unbound loop device: got error %v, want %v", err, linuxerr.EINVAL)
+	}
+
+	// A loop device backed by another loop device has that device's size.
+	if err := dev1.configure(env.ctx, env.openDevice(t, 0), true, &linux.LoopConfig{}); err != nil {
+		t.Fatalf("configure with loop device: %v", err)
+	}
+	t.Cleanup(func() {
+		dev1.mu.Lock()
+		b := dev1.bind
+		dev1.bind = nil
+		dev1.mu.Unlock()
+		if b != nil {
+			b.file.DecRef(env.ctx)
+		}
+	})
+	b, err := dev1.getBinding()
+	if err != nil {
+		t.Fatalf("getBinding: %v", err)
+	}
+	defer b.file.DecRef(env.ctx)
+	if size, err := b.size(env.ctx); err != nil || size != testFileSize-512 {
+		t.Errorf("size: got (%d, %v), want (%d, nil)", size, err, testFileSize-512)
+	}
+
+	// loop0 -> backing can't be changed to loop0 -> loop1 -> loop0.
+	if err := dev0.changeFD(env.ctx, env.openDevice(t, 1)); err != linuxerr.EBADF {
+		t.Errorf("changeFD to form a cycle: got error %v, want %v", err, linuxerr.EBADF)
+	}
+}
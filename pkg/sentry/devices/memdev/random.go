@@ -15,17 +15,28 @@
 package memdev
 
 import (
+	"github.com/wilinz/gvisor/pkg/abi/linux"
 	"github.com/wilinz/gvisor/pkg/atomicbitops"
 	"github.com/wilinz/gvisor/pkg/context"
-	"github.com/wilinz/gvisor/pkg/rand"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/hostarch"
+	"github.com/wilinz/gvisor/pkg/marshal/primitive"
 	"github.com/wilinz/gvisor/pkg/safemem"
+	"github.com/wilinz/gvisor/pkg/sentry/arch"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/entropy"
 	"github.com/wilinz/gvisor/pkg/sentry/vfs"
 	"github.com/wilinz/gvisor/pkg/usermem"
+	"github.com/wilinz/gvisor/pkg/waiter"
 )
 
 const (
 	randomDevMinor  = 8
 	urandomDevMinor = 9
+
+	// maxMixChunk is the maximum number of bytes copied in from the
+	// application at a time when mixing data into the entropy pool.
+	maxMixChunk = hostarch.PageSize
 )
 
 // randomDevice implements vfs.Device for /dev/random and /dev/urandom.
@@ -35,7 +46,9 @@ type randomDevice struct{}
 
 // Open implements vfs.Device.Open.
 func (randomDevice) Open(ctx context.Context, mnt *vfs.Mount, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
-	fd := &randomFD{}
+	fd := &randomFD{
+		pool: kernel.KernelFromContext(ctx).EntropyPool(),
+	}
 	if err := fd.vfsfd.Init(fd, opts.Flags, mnt, vfsd, &vfs.FileDescriptionOptions{
 		UseDentryMetadata: true,
 	}); err != nil {
@@ -53,6 +66,9 @@ type randomFD struct {
 	vfs.DentryMetadataFileDescriptionImpl
 	vfs.NoLockFD
 
+	// pool is the kernel's entropy pool.
+	pool *entropy.Pool
+
 	// off is the "file offset". off is accessed using atomic memory
 	// operations.
 	off atomicbitops.Int64
@@ -65,27 +81,47 @@ func (fd *randomFD) Release(context.Context) {
 
 // PRead implements vfs.FileDescriptionImpl.PRead.
 func (fd *randomFD) PRead(ctx context.Context, dst usermem.IOSequence, offset int64, opts vfs.ReadOptions) (int64, error) {
-	return dst.CopyOutFrom(ctx, safemem.FromIOReader{rand.Reader})
+	return dst.CopyOutFrom(ctx, safemem.FromIOReader{fd.pool})
 }
 
 // Read implements vfs.FileDescriptionImpl.Read.
 func (fd *randomFD) Read(ctx context.Context, dst usermem.IOSequence, opts vfs.ReadOptions) (int64, error) {
-	n, err := dst.CopyOutFrom(ctx, safemem.FromIOReader{rand.Reader})
+	n, err := dst.CopyOutFrom(ctx, safemem.FromIOReader{fd.pool})
 	fd.off.Add(n)
 	return n, err
 }
 
 // PWrite implements vfs.FileDescriptionImpl.PWrite.
 func (fd *randomFD) PWrite(ctx context.Context, src usermem.IOSequence, offset int64, opts vfs.WriteOptions) (int64, error) {
-	// In Linux, this mixes the written bytes into the entropy pool; we just
-	// throw them away.
-	return src.NumBytes(), nil
+	// As in Linux, written bytes are mixed into the entropy pool without
+	// crediting any entropy.
+	return fd.mix(ctx, src)
 }
 
 // Write implements vfs.FileDescriptionImpl.Write.
 func (fd *randomFD) Write(ctx context.Context, src usermem.IOSequence, opts vfs.WriteOptions) (int64, error) {
-	fd.off.Add(src.NumBytes())
-	return src.NumBytes(), nil
+	n, err := fd.mix(ctx, src)
+	fd.off.Add(n)
+	return n, err
+}
+
+// mix mixes the contents of src into the entropy pool.
+func (fd *randomFD) mix(ctx context.Context, src usermem.IOSequence) (int64, error) {
+	var total int64
+	buf := make([]byte, min(src.NumBytes(), maxMixChunk))
+	for src.NumBytes() > 0 {
+		n, err := src.CopyIn(ctx, buf[:min(src.NumBytes(), int64(len(buf)))])
+		fd.pool.Mix(buf[:n])
+		total += int64(n)
+		if err != nil {
+			if total > 0 {
+				return total, nil
+			}
+			return 0, err
+		}
+		src = src.DropFirst(n)
+	}
+	return total, nil
 }
 
 // Seek implements vfs.FileDescriptionImpl.Seek.
@@ -94,3 +130,95 @@ func (fd *randomFD) Seek(ctx context.Context, offset int64, whence int32) (int64
 	// == noop_llseek
 	return fd.off.Load(), nil
 }
+
+// Readiness implements waiter.Waitable.Readiness.
+func (fd *randomFD) Readiness(mask waiter.EventMask) waiter.EventMask {
+	return fd.pool.Readiness(mask)
+}
+
+// EventRegister implements waiter.Waitable.EventRegister.
+func (fd *randomFD) EventRegister(e *waiter.Entry) error {
+	return fd.pool.EventRegister(e)
+}
+
+// EventUnregister implements waiter.Waitable.EventUnregister.
+func (fd *randomFD) EventUnregister(e *waiter.Entry) {
+	fd.pool.EventUnregister(e)
+}
+
+// Epollable implements FileDescriptionImpl.Epollable.
+func (fd *randomFD) Epollable() bool {
+	return true
+}
+
+// Ioctl implements vfs.FileDescriptionImpl.Ioctl.
+//
+// Linux: drivers/char/random.c:random_ioctl()
+func (fd *randomFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		panic("Ioctl should be called from a task context")
+	}
+	cmd := args[1].Uint()
+	argp := args[2].Pointer()
+
+	if cmd == linux.RNDGETENTCNT {
+		_, err := primitive.CopyInt32Out(t, argp, fd.pool.EntropyAvail())
+		return 0, err
+	}
+
+	// All other requests modify the pool.
+	switch cmd {
+	case linux.RNDADDTOENTCNT, linux.RNDADDENTROPY, linux.RNDZAPENTCNT, linux.RNDCLEARPOOL, linux.RNDRESEEDCRNG:
+		if !t.HasCapabilityIn(linux.CAP_SYS_ADMIN, t.Kernel().RootUserNamespace()) {
+			return 0, linuxerr.EPERM
+		}
+	default:
+		// Includes RNDGETPOOL, which Linux no longer supports.
+		return 0, linuxerr.EINVAL
+	}
+
+	switch cmd {
+	case linux.RNDADDTOENTCNT:
+		var bits int32
+		if _, err := primitive.CopyInt32In(t, argp, &bits); err != nil {
+			return 0, err
+		}
+		fd.pool.Credit(bits)
+		return 0, nil
+
+	case linux.RNDADDENTROPY:
+		var info linux.RandPoolInfo
+		if _, err := info.CopyIn(t, argp); err != nil {
+			return 0, err
+		}
+		if info.EntropyCount < 0 || info.BufSize < 0 {
+			return 0, linuxerr.EINVAL
+		}
+		src, err := t.SingleIOSequence(argp+linux.SizeOfRandPoolInfo, int(info.BufSize), usermem.IOOpts{
+			AddressSpaceActive: true,
+		})
+		if err != nil {
+			return 0, err
+		}
+		if n, err := fd.mix(ctx, src); err != nil || n != int64(info.BufSize) {
+			if err == nil {
+				err = linuxerr.EFAULT
+			}
+			return 0, err
+		}
+		fd.pool.Credit(info.EntropyCount)
+		return 0, nil
+
+	case linux.RNDZAPENTCNT, linux.RNDCLEARPOOL:
+		fd.pool.Zap()
+		return 0, nil
+
+	case linux.RNDRESEEDCRNG:
+		fd.pool.Reseed()
+		return 0, nil
+
+	default:
+		panic("unreachable")
+	}
+}
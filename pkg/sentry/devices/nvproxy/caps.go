@@ -0,0 +1,118 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nvproxy
+
+import (
+	"fmt"
+	"regexp"
+
+	"golang.org/x/sys/unix"
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/devutil"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/log"
+	"github.com/wilinz/gvisor/pkg/sentry/vfs"
+)
+
+// CapsDeviceRegex is the regex for detecting nvidia-caps device paths.
+var CapsDeviceRegex = regexp.MustCompile(`^/dev/nvidia-caps/nvidia-cap(\d+)$`)
+
+// capsDevice implements vfs.Device for /dev/nvidia-caps/nvidia-cap#.
+//
+// Capability devices grant access to MIG instances (and to MIG configuration
+// and monitoring). The minor number of the device granting a given capability
+// is read by the application from
+// /proc/driver/nvidia/capabilities/.../access, so device files must keep
+// their host minor numbers.
+//
+// +stateify savable
+type capsDevice struct {
+	minor uint32
+}
+
+func (dev *capsDevice) basename() string {
+	return fmt.Sprintf("nvidia-caps/nvidia-cap%d", dev.minor)
+}
+
+// Open implements vfs.Device.Open.
+func (dev *capsDevice) Open(ctx context.Context, mnt *vfs.Mount, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	// Capability devices are only ever opened read-only by the driver's
+	// userspace components, and are read-only on the host.
+	if opts.Flags&linux.O_ACCMODE != linux.O_RDONLY {
+		return nil, linuxerr.EACCES
+	}
+	devClient := devutil.GoferClientFromContext(ctx)
+	if devClient == nil {
+		log.Warningf("devutil.CtxDevGoferClient is not set")
+		return nil, linuxerr.ENOENT
+	}
+	basename := dev.basename()
+	hostFD, err := devClient.OpenAt(ctx, basename, opts.Flags)
+	if err != nil {
+		ctx.Warningf("nvproxy: failed to open host %s: %v", basename, err)
+		return nil, err
+	}
+	fd := &capsFD{
+		dev:           dev,
+		containerName: devClient.ContainerName(),
+		hostFD:        int32(hostFD),
+	}
+	if err := fd.vfsfd.Init(fd, opts.Flags, mnt, vfsd, &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+	}); err != nil {
+		unix.Close(hostFD)
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// capsFD implements vfs.FileDescriptionImpl for /dev/nvidia-caps/nvidia-cap#.
+//
+// The host device supports no file operations; holding it open is what
+// grants the capability. capsFD therefore only holds the host FD.
+//
+// +stateify savable
+type capsFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.NoLockFD
+
+	dev           *capsDevice
+	containerName string
+	hostFD        int32 `state:"nosave"`
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *capsFD) Release(context.Context) {
+	unix.Close(int(fd.hostFD))
+}
+
+// IsNvidiaDeviceFD implements NvidiaDeviceFD.IsNvidiaDeviceFD.
+func (fd *capsFD) IsNvidiaDeviceFD() {}
+
+// RegisterCapsDevice registers the nvidia-caps device with the given device
+// numbers in vfsObj.
+func RegisterCapsDevice(vfsObj *vfs.VirtualFilesystem, major, minor uint32) error {
+	if vfsObj.IsDeviceRegistered(vfs.CharDevice, major, minor) {
+		return nil
+	}
+	return vfsObj.RegisterDevice(vfs.CharDevice, major, minor, &capsDevice{
+		minor: minor,
+	}, &vfs.RegisterDeviceOptions{
+		GroupName: "nvidia-caps",
+	})
+}
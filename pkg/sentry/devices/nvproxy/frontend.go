@@ -71,6 +71,7 @@ func (dev *frontendDevice) Open(ctx context.Context, mnt *vfs.Mount, vfsd *vfs.D
 		containerName: devClient.ContainerName(),
 		hostFD:        int32(hostFD),
 	}
+	fd.throttle = dev.nvp.throttleFor(fd.containerName)
 	if err := fd.vfsfd.Init(fd, opts.Flags, mnt, vfsd, &vfs.FileDescriptionOptions{
 		UseDentryMetadata: true,
 	}); err != nil {
@@ -102,9 +103,14 @@ type frontendFD struct {
 
 	dev           *frontendDevice
 	containerName string
-	hostFD        int32
+	hostFD        int32 `state:"nosave"`
 	memmapFile    frontendFDMemmapFile
 
+	// throttle limits work submissions by containerName. throttle is nil if
+	// submissions are not throttled. throttle is immutable after
+	// initialization.
+	throttle *submitThrottle `state:"nosave"`
+
 	// The driver's implementation of poll() for these files,
 	// kernel-open/nvidia/nv.c:nvidia_poll(), unsets
 	// nv_linux_file_private_t::dataless_event_pending if it's set. This makes
@@ -719,6 +725,11 @@ func rmControl(fi *frontendIoctlState) (uintptr, error) {
 	// - Add symbol definition to //pkg/abi/nvgpu. Parameter type definition is
 	// only required for non-simple commands.
 	// - Add handling below.
+	if isSubmissionControlCmd(ioctlParams.Cmd) {
+		if err := throttleSubmission(fi.t, fi.fd.throttle); err != nil {
+			return 0, err
+		}
+	}
 	result, err := fi.fd.dev.nvp.abi.controlCmd[ioctlParams.Cmd].handle(fi, &ioctlParams)
 	if err != nil {
 		if handleErr, ok := err.(*errHandler); ok {
@@ -30,7 +30,7 @@ import (
 )
 
 // Register registers all devices implemented by this package in vfsObj.
-func Register(vfsObj *vfs.VirtualFilesystem, version nvconf.DriverVersion, driverCaps nvconf.DriverCaps, uvmDevMajor uint32) error {
+func Register(vfsObj *vfs.VirtualFilesystem, version nvconf.DriverVersion, driverCaps nvconf.DriverCaps, uvmDevMajor uint32, submitLimit SubmitLimit) error {
 	// The kernel driver's interface is unstable, so only allow versions of the
 	// driver that are known to be supported.
 	log.Infof("NVIDIA driver version: %s", version)
@@ -45,7 +45,9 @@ func Register(vfsObj *vfs.VirtualFilesystem, version nvconf.DriverVersion, drive
 		abi:         abiCons.cons(),
 		version:     version,
 		capsEnabled: driverCaps,
+		submitLimit: submitLimit,
 		frontendFDs: make(map[*frontendFD]struct{}),
+		uvmFDs:      make(map[*uvmFD]struct{}),
 		clients:     make(map[nvgpu.Handle]*rootClient),
 		objsFreeSet: make(map[*object]struct{}),
 	}
@@ -75,8 +77,14 @@ type nvproxy struct {
 	version     nvconf.DriverVersion
 	capsEnabled nvconf.DriverCaps
 
+	// submitLimit configures throttling of work submission ioctls. See
+	// throttle.go.
+	submitLimit SubmitLimit
+	throttles   submitThrottles `state:"nosave"`
+
 	fdsMu       fdsMutex `state:"nosave"`
 	frontendFDs map[*frontendFD]struct{}
+	uvmFDs      map[*uvmFD]struct{}
 
 	// See object.go.
 	// Users should call nvproxy.objsLock/Unlock() rather than locking objsMu
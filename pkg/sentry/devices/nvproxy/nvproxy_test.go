@@ -15,8 +15,12 @@
 package nvproxy
 
 import (
+	"errors"
+	"fmt"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"golang.org/x/sys/unix"
 	"github.com/wilinz/gvisor/pkg/abi/nvgpu"
@@ -338,3 +342,264 @@ func TestFilterCapabilities(t *testing.T) {
 		})
 	}
 }
+
+func TestUVMReplayStateTrack(t *testing.T) {
+	var s uvmReplayState
+	for _, params := range []nvgpu.HasStatus{
+		&nvgpu.UVM_INITIALIZE_PARAMS{Flags: 1},
+		&nvgpu.UVM_CREATE_EXTERNAL_RANGE_PARAMS{Base: 0x1000, Length: 0x2000},
+		&nvgpu.UVM_CREATE_EXTERNAL_RANGE_PARAMS{Base: 0x4000, Length: 0x1000},
+		&nvgpu.UVM_FREE_PARAMS{Base: 0x1000},
+		// Failed ioctls are not tracked.
+		&nvgpu.UVM_CREATE_EXTERNAL_RANGE_PARAMS{Base: 0x8000, Length: 0x1000, RMStatus: nvgpu.NV_ERR_INVALID_ARGUMENT},
+		&nvgpu.UVM_FREE_PARAMS{Base: 0x4000, RMStatus: nvgpu.NV_ERR_INVALID_ARGUMENT},
+	} {
+		s.track(params)
+	}
+	if !s.initialized || s.initFlags != 1 {
+		t.Errorf("got initialized=%t initFlags=%#x, want initialized=true initFlags=0x1", s.initialized, s.initFlags)
+	}
+	if len(s.externalRanges) != 1 || s.externalRanges[0x4000] != 0x1000 {
+		t.Errorf("got external ranges %v, want map[0x4000:0x1000]", s.externalRanges)
+	}
+	if err := s.checkSavable(); err != nil {
+		t.Errorf("checkSavable: got error %v, want nil", err)
+	}
+}
+
+func TestUVMReplayStateCheckSavable(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		register   nvgpu.HasStatus
+		unregister nvgpu.HasStatus
+	}{
+		{"GPU", &nvgpu.UVM_REGISTER_GPU_PARAMS{}, &nvgpu.UVM_UNREGISTER_GPU_PARAMS{}},
+		{"GPU VA space", &nvgpu.UVM_REGISTER_GPU_VASPACE_PARAMS{}, &nvgpu.UVM_UNREGISTER_GPU_VASPACE_PARAMS{}},
+		{"channel", &nvgpu.UVM_REGISTER_CHANNEL_PARAMS{}, &nvgpu.UVM_UNREGISTER_CHANNEL_PARAMS{}},
+		{"range group", &nvgpu.UVM_CREATE_RANGE_GROUP_PARAMS{}, &nvgpu.UVM_DESTROY_RANGE_GROUP_PARAMS{}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var s uvmReplayState
+			s.track(test.register)
+			if err := s.checkSavable(); err == nil {
+				t.Errorf("checkSavable after registration: got nil, want error")
+			}
+			s.track(test.unregister)
+			if err := s.checkSavable(); err != nil {
+				t.Errorf("checkSavable after unregistration: got error %v, want nil", err)
+			}
+		})
+	}
+	t.Run("mapping", func(t *testing.T) {
+		s := uvmReplayState{mappedBytes: 4096}
+		if err := s.checkSavable(); err == nil {
+			t.Errorf("checkSavable with mapping: got nil, want error")
+		}
+	})
+}
+
+// fakeUVMReplayer implements uvmReplayer by recording calls.
+type fakeUVMReplayer struct {
+	calls []string
+	err   error
+}
+
+func (r *fakeUVMReplayer) initialize(params *nvgpu.UVM_INITIALIZE_PARAMS) error {
+	r.calls = append(r.calls, fmt.Sprintf("initialize(%#x)", params.Flags))
+	return r.err
+}
+
+func (r *fakeUVMReplayer) mmInitialize(params *nvgpu.UVM_MM_INITIALIZE_PARAMS) error {
+	r.calls = append(r.calls, fmt.Sprintf("mmInitialize(%d)", params.UvmFD))
+	return r.err
+}
+
+func (r *fakeUVMReplayer) createExternalRange(params *nvgpu.UVM_CREATE_EXTERNAL_RANGE_PARAMS) error {
+	r.calls = append(r.calls, fmt.Sprintf("createExternalRange(%#x, %#x)", params.Base, params.Length))
+	return r.err
+}
+
+func TestUVMReplayStateReplay(t *testing.T) {
+	s := uvmReplayState{
+		initialized: true,
+		mmFD:        &uvmFD{hostFD: 7},
+		externalRanges: map[uint64]uint64{
+			0x5000: 0x1000,
+			0x1000: 0x2000,
+		},
+	}
+	var r fakeUVMReplayer
+	for _, replay := range []func(*uvmReplayState, uvmReplayer) error{
+		(*uvmReplayState).replayInitialize,
+		(*uvmReplayState).replayMMInitialize,
+		(*uvmReplayState).replayExternalRanges,
+	} {
+		if err := replay(&s, &r); err != nil {
+			t.Fatalf("replay failed: %v", err)
+		}
+	}
+	want := []string{
+		fmt.Sprintf("initialize(%#x)", nvgpu.UVM_INIT_FLAGS_MULTI_PROCESS_SHARING_MODE),
+		"mmInitialize(7)",
+		"createExternalRange(0x1000, 0x2000)",
+		"createExternalRange(0x5000, 0x1000)",
+	}
+	if !reflect.DeepEqual(r.calls, want) {
+		t.Errorf("got calls %v, want %v", r.calls, want)
+	}
+
+	// Uninitialized files replay nothing.
+	r = fakeUVMReplayer{err: errors.New("unexpected call")}
+	var empty uvmReplayState
+	if err := empty.replayInitialize(&r); err != nil {
+		t.Errorf("replayInitialize: %v", err)
+	}
+	if err := empty.replayMMInitialize(&r); err != nil {
+		t.Errorf("replayMMInitialize: %v", err)
+	}
+	if err := empty.replayExternalRanges(&r); err != nil {
+		t.Errorf("replayExternalRanges: %v", err)
+	}
+	if err := s.replayInitialize(&r); err == nil {
+		t.Errorf("replayInitialize: got nil, want error")
+	}
+}
+
+func TestPrepareSave(t *testing.T) {
+	nvp := &nvproxy{
+		clients: make(map[nvgpu.Handle]*rootClient),
+		uvmFDs:  make(map[*uvmFD]struct{}),
+	}
+	if err := nvp.prepareSaveImpl(); err != nil {
+		t.Errorf("prepareSave with no state: got error %v, want nil", err)
+	}
+
+	fd := &uvmFD{}
+	fd.replay.track(&nvgpu.UVM_INITIALIZE_PARAMS{})
+	nvp.uvmFDs[fd] = struct{}{}
+	if err := nvp.prepareSaveImpl(); err != nil {
+		t.Errorf("prepareSave with replayable UVM state: got error %v, want nil", err)
+	}
+
+	fd.replay.track(&nvgpu.UVM_REGISTER_GPU_PARAMS{})
+	if err := nvp.prepareSaveImpl(); err == nil {
+		t.Errorf("prepareSave with registered GPU: got nil, want error")
+	}
+	fd.replay.track(&nvgpu.UVM_UNREGISTER_GPU_PARAMS{})
+
+	nvp.clients[nvgpu.Handle{Val: 1}] = &rootClient{}
+	if err := nvp.prepareSaveImpl(); err == nil {
+		t.Errorf("prepareSave with live client: got nil, want error")
+	}
+}
+
+func TestThrottleFor(t *testing.T) {
+	nvp := &nvproxy{}
+	if st := nvp.throttleFor("a"); st != nil {
+		t.Errorf("throttleFor with no limit: got %p, want nil", st)
+	}
+
+	nvp.submitLimit = SubmitLimit{Rate: 1, Burst: 1}
+	a := nvp.throttleFor("a")
+	b := nvp.throttleFor("b")
+	if a == nil || b == nil {
+		t.Fatalf("throttleFor with limit: got (%p, %p), want non-nil", a, b)
+	}
+	if a == b {
+		t.Errorf("containers a and b share a throttle")
+	}
+	if got := nvp.throttleFor("a"); got != a {
+		t.Errorf("throttleFor(a) returned %p, then %p", a, got)
+	}
+}
+
+func TestSubmitThrottleReserve(t *testing.T) {
+	nvp := &nvproxy{submitLimit: SubmitLimit{Rate: 10, Burst: 2}}
+	a := nvp.throttleFor("a")
+	b := nvp.throttleFor("b")
+	now := time.Unix(1000, 0)
+
+	// The first Burst submissions by a aren't delayed.
+	for i := 0; i < 2; i++ {
+		if delay := a.reserve(now).DelayFrom(now); delay != 0 {
+			t.Errorf("submission %d by a: got delay %v, want 0", i, delay)
+		}
+	}
+	// The next one waits for a token.
+	res := a.reserve(now)
+	if delay := res.DelayFrom(now); delay != 100*time.Millisecond {
+		t.Errorf("submission 2 by a: got delay %v, want 100ms", delay)
+	}
+	// Cancelling the reservation returns the token.
+	res.CancelAt(now)
+	if delay := a.reserve(now).DelayFrom(now); delay != 100*time.Millisecond {
+		t.Errorf("submission after cancel by a: got delay %v, want 100ms", delay)
+	}
+	// b has its own bucket.
+	if delay := b.reserve(now).DelayFrom(now); delay != 0 {
+		t.Errorf("submission 0 by b: got delay %v, want 0", delay)
+	}
+}
+
+func TestSubmitThrottleFairness(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		counts []int
+		want   uint64
+	}{
+		{
+			name:   "none",
+			counts: []int{0, 0},
+			want:   1000,
+		},
+		{
+			name:   "equal",
+			counts: []int{5, 5, 5},
+			want:   1000,
+		},
+		{
+			name:   "one active",
+			counts: []int{4, 0},
+			want:   500,
+		},
+		{
+			name:   "uneven",
+			counts: []int{3, 1},
+			// (3+1)^2 / (2 * (9+1)) = 0.8
+			want: 800,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			nvp := &nvproxy{submitLimit: SubmitLimit{Rate: 1000000, Burst: 1000}}
+			now := time.Unix(1000, 0)
+			for i, n := range test.counts {
+				st := nvp.throttleFor(fmt.Sprintf("c%d", i))
+				for j := 0; j < n; j++ {
+					st.reserve(now)
+				}
+			}
+			if got := nvp.throttles.fairness(); got != test.want {
+				t.Errorf("fairness: got %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSubmissionIoctls(t *testing.T) {
+	for _, cmd := range []uint32{nvgpu.NVA06C_CTRL_CMD_GPFIFO_SCHEDULE, nvgpu.NVA06F_CTRL_CMD_GPFIFO_SCHEDULE} {
+		if !isSubmissionControlCmd(cmd) {
+			t.Errorf("isSubmissionControlCmd(%#x): got false, want true", cmd)
+		}
+	}
+	if isSubmissionControlCmd(nvgpu.NV0000_CTRL_CMD_SYSTEM_GET_BUILD_VERSION) {
+		t.Errorf("isSubmissionControlCmd(NV0000_CTRL_CMD_SYSTEM_GET_BUILD_VERSION): got true, want false")
+	}
+	for _, cmd := range []uint32{nvgpu.UVM_MIGRATE, nvgpu.UVM_MIGRATE_RANGE_GROUP} {
+		if !isSubmissionUVMIoctl(cmd) {
+			t.Errorf("isSubmissionUVMIoctl(%d): got false, want true", cmd)
+		}
+	}
+	if isSubmissionUVMIoctl(nvgpu.UVM_INITIALIZE) {
+		t.Errorf("isSubmissionUVMIoctl(UVM_INITIALIZE): got true, want false")
+	}
+}
@@ -17,8 +17,42 @@ package nvproxy
 import (
 	goContext "context"
 	"fmt"
+
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/sentry/devices/nvproxy/nvconf"
+)
+
+// contextID is this package's type for context.Context.Value keys.
+type contextID int
+
+const (
+	// CtxDriverVersion is a Context.Value key for the nvconf.DriverVersion of
+	// the host driver that restored nvproxy state will run against.
+	CtxDriverVersion contextID = iota
 )
 
+// driverVersionFromContext returns the host driver version used by ctx, or
+// false if ctx does not specify one.
+func driverVersionFromContext(ctx goContext.Context) (nvconf.DriverVersion, bool) {
+	if v := ctx.Value(CtxDriverVersion); v != nil {
+		return v.(nvconf.DriverVersion), true
+	}
+	return nvconf.DriverVersion{}, false
+}
+
+// PrepareSave implements vfs.DeviceSaveRestoreExtension.PrepareSave.
+//
+// Each nvproxy registers exactly one uvmDevice, so uvmDevice implements
+// vfs.DeviceSaveRestoreExtension on behalf of the nvproxy.
+func (dev *uvmDevice) PrepareSave(ctx context.Context) error {
+	return dev.nvp.prepareSaveImpl()
+}
+
+// CompleteRestore implements vfs.DeviceSaveRestoreExtension.CompleteRestore.
+func (dev *uvmDevice) CompleteRestore(ctx context.Context) error {
+	return dev.nvp.completeRestoreImpl()
+}
+
 // beforeSave is invoked by stateify.
 func (nvp *nvproxy) beforeSave() {
 	nvp.beforeSaveImpl()
@@ -27,6 +61,11 @@ func (nvp *nvproxy) beforeSave() {
 // afterLoad is invoked by stateify.
 func (nvp *nvproxy) afterLoad(ctx goContext.Context) {
 	Init()
+	if hostVersion, ok := driverVersionFromContext(ctx); ok && hostVersion != nvp.version {
+		// Driver ABIs are unstable, and state saved from one driver (e.g.
+		// object handles and UVM ranges) is not valid for another.
+		panic(fmt.Sprintf("nvproxy state was saved with driver version %s, but host driver version is %s", nvp.version, hostVersion))
+	}
 	abiCons, ok := abis[nvp.version]
 	if !ok {
 		panic(fmt.Sprintf("driver version %q not found in abis map", nvp.version))
@@ -43,6 +82,7 @@ func (fd *frontendFD) beforeSave() {
 
 // afterLoad is invoked by stateify.
 func (fd *frontendFD) afterLoad(ctx goContext.Context) {
+	fd.throttle = fd.dev.nvp.throttleFor(fd.containerName)
 	fd.afterLoadImpl(ctx)
 }
 
@@ -53,5 +93,16 @@ func (fd *uvmFD) beforeSave() {
 
 // afterLoad is invoked by stateify.
 func (fd *uvmFD) afterLoad(ctx goContext.Context) {
+	fd.throttle = fd.dev.nvp.throttleFor(fd.containerName)
+	fd.afterLoadImpl(ctx)
+}
+
+// beforeSave is invoked by stateify.
+func (fd *capsFD) beforeSave() {
+	fd.beforeSaveImpl()
+}
+
+// afterLoad is invoked by stateify.
+func (fd *capsFD) afterLoad(ctx goContext.Context) {
 	fd.afterLoadImpl(ctx)
 }
@@ -19,32 +19,124 @@ package nvproxy
 
 import (
 	goContext "context"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/devutil"
+	"github.com/wilinz/gvisor/pkg/fdnotifier"
 )
 
-func (nvp *nvproxy) beforeSaveImpl() {
+// Saving nvproxy state is only supported when no GPU state exists in the
+// driver, i.e. when all RM clients have been freed. Applications that have
+// GPU state must first move it into host memory using the CUDA driver
+// checkpoint API, e.g. using runsc checkpoint --cuda-checkpoint, and restore
+// it after the sandbox has been restored. Device files may remain open across
+// checkpoint/restore; they are reopened on the host during restore, and UVM
+// state that doesn't depend on RM objects is replayed on the reopened files
+// (see uvmReplayState).
+
+func (nvp *nvproxy) prepareSaveImpl() error {
 	nvp.objsLock()
-	defer nvp.objsUnlock()
-	if len(nvp.clients) != 0 {
-		panic("can't save with live nvproxy clients")
+	numClients := len(nvp.clients)
+	nvp.objsUnlock()
+	if numClients != 0 {
+		return fmt.Errorf("nvproxy: can't save with %d live RM clients; checkpoint GPU state (e.g. using runsc checkpoint --cuda-checkpoint) first", numClients)
+	}
+	nvp.fdsMu.Lock()
+	defer nvp.fdsMu.Unlock()
+	for fd := range nvp.uvmFDs {
+		fd.replayMu.Lock()
+		err := fd.replay.checkSavable()
+		fd.replayMu.Unlock()
+		if err != nil {
+			return fmt.Errorf("nvproxy: can't save /dev/nvidia-uvm file: %w", err)
+		}
 	}
+	return nil
+}
+
+func (nvp *nvproxy) completeRestoreImpl() error {
+	nvp.fdsMu.Lock()
+	fds := make([]*uvmFD, 0, len(nvp.uvmFDs))
+	for fd := range nvp.uvmFDs {
+		fds = append(fds, fd)
+	}
+	nvp.fdsMu.Unlock()
+	// The order of replay phases is significant; see uvm_replay.go.
+	for _, replay := range []func(*uvmReplayState, uvmReplayer) error{
+		(*uvmReplayState).replayInitialize,
+		(*uvmReplayState).replayMMInitialize,
+		(*uvmReplayState).replayExternalRanges,
+	} {
+		for _, fd := range fds {
+			fd.replayMu.Lock()
+			err := replay(&fd.replay, hostUVMReplayer{fd.hostFD})
+			fd.replayMu.Unlock()
+			if err != nil {
+				return fmt.Errorf("nvproxy: failed to restore /dev/nvidia-uvm state: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (nvp *nvproxy) beforeSaveImpl() {
+	// no-op; see prepareSaveImpl.
 }
 
 func (nvp *nvproxy) afterLoadImpl(goContext.Context) {
-	// no-op
+	// no-op; see completeRestoreImpl.
+}
+
+// reopenHostDevice opens the host device file /dev/{name} for the container
+// with the given name during restore.
+func reopenHostDevice(ctx goContext.Context, containerName, name string, flags uint32) int32 {
+	provider := devutil.GoferClientProviderFromContext(ctx)
+	if provider == nil {
+		panic("devutil.CtxDevGoferClientProvider is not set")
+	}
+	devClient := provider.GetDevGoferClient(containerName)
+	if devClient == nil {
+		panic(fmt.Sprintf("no device gofer client for container %q", containerName))
+	}
+	hostFD, err := devClient.OpenAt(context.Background(), name, flags)
+	if err != nil {
+		panic(fmt.Sprintf("failed to reopen host /dev/%s: %v", name, err))
+	}
+	return int32(hostFD)
 }
 
 func (fd *frontendFD) beforeSaveImpl() {
-	panic("nvproxy.frontendFD is not saveable")
+	// no-op; nvproxy.prepareSaveImpl checks that no clients exist.
+}
+
+func (fd *frontendFD) afterLoadImpl(ctx goContext.Context) {
+	fd.hostFD = reopenHostDevice(ctx, fd.containerName, fd.dev.basename(), fd.vfsfd.StatusFlags())
+	// fd.internalEntry is still registered with fd.internalQueue, since both
+	// are saved.
+	if err := fdnotifier.AddFD(fd.hostFD, &fd.internalQueue); err != nil {
+		unix.Close(int(fd.hostFD))
+		panic(fmt.Sprintf("fdnotifier.AddFD failed for restored host %s: %v", fd.dev.basename(), err))
+	}
+}
+
+func (fd *capsFD) beforeSaveImpl() {
+	// no-op
 }
 
-func (fd *frontendFD) afterLoadImpl(goContext.Context) {
-	panic("nvproxy.frontendFD is not restorable")
+func (fd *capsFD) afterLoadImpl(ctx goContext.Context) {
+	fd.hostFD = reopenHostDevice(ctx, fd.containerName, fd.dev.basename(), fd.vfsfd.StatusFlags())
 }
 
 func (fd *uvmFD) beforeSaveImpl() {
-	panic("nvproxy.uvmFD is not saveable")
+	// no-op
 }
 
-func (fd *uvmFD) afterLoadImpl(goContext.Context) {
-	panic("nvproxy.uvmFD is not restorable")
+func (fd *uvmFD) afterLoadImpl(ctx goContext.Context) {
+	fd.hostFD = reopenHostDevice(ctx, fd.containerName, "nvidia-uvm", fd.vfsfd.StatusFlags())
+	if err := fdnotifier.AddFD(fd.hostFD, &fd.queue); err != nil {
+		unix.Close(int(fd.hostFD))
+		panic(fmt.Sprintf("fdnotifier.AddFD failed for restored host nvidia-uvm: %v", err))
+	}
 }
@@ -0,0 +1,211 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nvproxy
+
+import (
+	"time"
+
+	"golang.org/x/time/rate"
+	"github.com/wilinz/gvisor/pkg/abi/nvgpu"
+	"github.com/wilinz/gvisor/pkg/atomicbitops"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/metric"
+	metricpb "github.com/wilinz/gvisor/pkg/metric/metric_go_proto"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+	"github.com/wilinz/gvisor/pkg/sync"
+)
+
+// SubmitLimit configures cooperative time-slicing of the GPU between
+// containers in a sandbox. Ioctls that submit work to the GPU (see
+// isSubmissionControlCmd and isSubmissionUVMIoctl) issued by each container
+// are subject to a separate token bucket, so that one container cannot
+// starve others of GPU time by submitting work faster than its share.
+//
+// Since applications submit most work by writing to user-mapped doorbells
+// rather than via ioctls, this only approximates fractional GPU sharing.
+//
+// +stateify savable
+type SubmitLimit struct {
+	// Rate is the sustained number of submission ioctls per second allowed for
+	// each container. If Rate is 0, submissions are not throttled.
+	Rate int
+
+	// Burst is the number of submission ioctls that a container may issue
+	// back-to-back after being idle. If Burst is less than 1, it is treated
+	// as 1.
+	Burst int
+}
+
+// isSubmissionControlCmd returns true if the RM control command cmd is
+// treated as a work submission. These commands schedule channels (enabling
+// the GPU to run work that has been written to them) and are issued by
+// applications when they start running work on a channel.
+func isSubmissionControlCmd(cmd uint32) bool {
+	switch cmd {
+	case nvgpu.NVA06C_CTRL_CMD_GPFIFO_SCHEDULE, nvgpu.NVA06F_CTRL_CMD_GPFIFO_SCHEDULE:
+		return true
+	default:
+		return false
+	}
+}
+
+// isSubmissionUVMIoctl returns true if the UVM ioctl cmd is treated as a work
+// submission. These ioctls make the driver run copy engine work on behalf of
+// the application.
+func isSubmissionUVMIoctl(cmd uint32) bool {
+	switch cmd {
+	case nvgpu.UVM_MIGRATE, nvgpu.UVM_MIGRATE_RANGE_GROUP:
+		return true
+	default:
+		return false
+	}
+}
+
+// Metrics for submission throttling.
+var (
+	submissions = metric.MustCreateNewUint64Metric("/nvproxy/submissions", metric.Uint64Metadata{
+		Cumulative:  true,
+		Description: "Number of GPU work submission ioctls subject to throttling.",
+	})
+	submissionsThrottled = metric.MustCreateNewUint64Metric("/nvproxy/submissions_throttled", metric.Uint64Metadata{
+		Cumulative:  true,
+		Description: "Number of GPU work submission ioctls that were delayed by throttling.",
+	})
+	submissionThrottleWait = metric.MustCreateNewUint64Metric("/nvproxy/submission_throttle_wait", metric.Uint64Metadata{
+		Cumulative:  true,
+		Description: "Time GPU work submission ioctls were delayed by throttling, in nanoseconds.",
+		Unit:        metricpb.MetricMetadata_UNITS_NANOSECONDS,
+	})
+	submissionFairness = metric.MustCreateNewUint64Metric("/nvproxy/submission_fairness", metric.Uint64Metadata{
+		Description: "Jain's fairness index of GPU work submissions between containers, in thousandths (1000 is perfectly fair).",
+	})
+)
+
+// submitThrottle is the token bucket for a single container. File
+// descriptions look up their container's submitThrottle when they are
+// opened, so submissions by different containers don't contend with each
+// other.
+type submitThrottle struct {
+	ts *submitThrottles
+
+	// limiter is internally synchronized.
+	limiter *rate.Limiter
+
+	// submissions is the number of submissions issued by the container.
+	submissions atomicbitops.Uint64
+}
+
+// submitThrottles holds the token buckets for all containers.
+type submitThrottles struct {
+	mu sync.Mutex
+
+	// byContainer maps container names to token buckets. It is protected by
+	// mu.
+	byContainer map[string]*submitThrottle
+
+	// The following fields maintain the terms of Jain's fairness index,
+	// (sum x)^2 / (n * sum x^2), where x is the number of submissions issued
+	// by each of n containers, so that it can be updated in constant time.
+	// Since they are updated separately, a concurrent reader may observe
+	// them slightly out of sync, which is acceptable for a metric.
+	numContainers    atomicbitops.Uint64
+	sumSubmissions   atomicbitops.Uint64
+	sumSqSubmissions atomicbitops.Uint64
+}
+
+// throttleFor returns the submitThrottle for the container with the given
+// name, or nil if submissions are not throttled.
+func (nvp *nvproxy) throttleFor(containerName string) *submitThrottle {
+	if nvp.submitLimit.Rate <= 0 {
+		return nil
+	}
+	ts := &nvp.throttles
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.byContainer == nil {
+		ts.byContainer = make(map[string]*submitThrottle)
+	}
+	st, ok := ts.byContainer[containerName]
+	if !ok {
+		burst := nvp.submitLimit.Burst
+		if burst < 1 {
+			burst = 1
+		}
+		st = &submitThrottle{
+			ts:      ts,
+			limiter: rate.NewLimiter(rate.Limit(nvp.submitLimit.Rate), burst),
+		}
+		ts.byContainer[containerName] = st
+		ts.numContainers.Add(1)
+	}
+	return st
+}
+
+// throttleSubmission blocks t until the container that owns st may issue
+// another work submission ioctl. st may be nil, in which case
+// throttleSubmission does nothing.
+func throttleSubmission(t *kernel.Task, st *submitThrottle) error {
+	if st == nil {
+		return nil
+	}
+	clock := t.Kernel().MonotonicClock()
+	now := time.Unix(0, clock.Now().Nanoseconds())
+	res := st.reserve(now)
+	delay := res.DelayFrom(now)
+	if delay == 0 {
+		return nil
+	}
+	submissionsThrottled.Increment()
+	_, err := t.BlockWithTimeout(nil, true, delay)
+	end := time.Unix(0, clock.Now().Nanoseconds())
+	submissionThrottleWait.IncrementBy(uint64(end.Sub(now)))
+	if err != linuxerr.ETIMEDOUT {
+		// Interrupted; give the token back so that the restarted ioctl doesn't
+		// pay for it twice.
+		res.CancelAt(end)
+		return linuxerr.ERESTARTSYS
+	}
+	return nil
+}
+
+// reserve takes a token from st's bucket at time now and returns the
+// reservation for it.
+func (st *submitThrottle) reserve(now time.Time) *rate.Reservation {
+	// Going from x to x+1 submissions adds 1 to sum x and 2x+1 to sum x^2.
+	x := st.submissions.Add(1) - 1
+	ts := st.ts
+	ts.sumSubmissions.Add(1)
+	ts.sumSqSubmissions.Add(2*x + 1)
+	submissions.Increment()
+	submissionFairness.Set(ts.fairness())
+	return st.limiter.ReserveN(now, 1)
+}
+
+// fairness returns Jain's fairness index of per-container submission
+// counts, scaled by 1000.
+func (ts *submitThrottles) fairness() uint64 {
+	n := float64(ts.numContainers.Load())
+	sum := float64(ts.sumSubmissions.Load())
+	sumSq := float64(ts.sumSqSubmissions.Load())
+	if n == 0 || sumSq == 0 {
+		return 1000
+	}
+	f := 1000 * sum * sum / (n * sumSq)
+	if f > 1000 {
+		// Possible if the terms are observed out of sync.
+		f = 1000
+	}
+	return uint64(f)
+}
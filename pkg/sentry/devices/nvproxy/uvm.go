@@ -28,6 +28,7 @@ import (
 	"github.com/wilinz/gvisor/pkg/sentry/arch"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel"
 	"github.com/wilinz/gvisor/pkg/sentry/vfs"
+	"github.com/wilinz/gvisor/pkg/sync"
 	"github.com/wilinz/gvisor/pkg/usermem"
 	"github.com/wilinz/gvisor/pkg/waiter"
 )
@@ -56,6 +57,7 @@ func (dev *uvmDevice) Open(ctx context.Context, mnt *vfs.Mount, vfsd *vfs.Dentry
 		containerName: devClient.ContainerName(),
 		hostFD:        int32(hostFD),
 	}
+	fd.throttle = dev.nvp.throttleFor(fd.containerName)
 	if err := fd.vfsfd.Init(fd, opts.Flags, mnt, vfsd, &vfs.FileDescriptionOptions{
 		UseDentryMetadata: true,
 	}); err != nil {
@@ -67,6 +69,9 @@ func (dev *uvmDevice) Open(ctx context.Context, mnt *vfs.Mount, vfsd *vfs.Dentry
 		return nil, err
 	}
 	fd.memmapFile.fd = fd
+	dev.nvp.fdsMu.Lock()
+	dev.nvp.uvmFDs[fd] = struct{}{}
+	dev.nvp.fdsMu.Unlock()
 	return &fd.vfsfd, nil
 }
 
@@ -81,17 +86,37 @@ type uvmFD struct {
 
 	dev           *uvmDevice
 	containerName string
-	hostFD        int32
+	hostFD        int32 `state:"nosave"`
 	memmapFile    uvmFDMemmapFile
 
+	// throttle limits work submissions by containerName. throttle is nil if
+	// submissions are not throttled. throttle is immutable after
+	// initialization.
+	throttle *submitThrottle `state:"nosave"`
+
 	queue waiter.Queue
+
+	// replay is the driver state associated with hostFD. replay is protected
+	// by replayMu.
+	replayMu sync.Mutex `state:"nosave"`
+	replay   uvmReplayState
 }
 
 // Release implements vfs.FileDescriptionImpl.Release.
-func (fd *uvmFD) Release(context.Context) {
+func (fd *uvmFD) Release(ctx context.Context) {
+	fd.dev.nvp.fdsMu.Lock()
+	delete(fd.dev.nvp.uvmFDs, fd)
+	fd.dev.nvp.fdsMu.Unlock()
 	fdnotifier.RemoveFD(fd.hostFD)
 	fd.queue.Notify(waiter.EventHUp)
 	unix.Close(int(fd.hostFD))
+	fd.replayMu.Lock()
+	mmFD := fd.replay.mmFD
+	fd.replay.mmFD = nil
+	fd.replayMu.Unlock()
+	if mmFD != nil {
+		mmFD.vfsfd.DecRef(ctx)
+	}
 }
 
 // EventRegister implements waiter.Waitable.EventRegister.
@@ -131,6 +156,11 @@ func (fd *uvmFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args
 	if t == nil {
 		panic("Ioctl should be called from a task context")
 	}
+	if isSubmissionUVMIoctl(cmd) {
+		if err := throttleSubmission(t, fd.throttle); err != nil {
+			return 0, err
+		}
+	}
 
 	if ctx.IsLogging(log.Debug) {
 		ctx.Debugf("nvproxy: uvm ioctl %d = %#x", cmd, cmd)
@@ -149,8 +179,14 @@ func (fd *uvmFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args
 			ctx.Warningf("nvproxy: %v for uvm ioctl %d = %#x", handleErr, cmd, cmd)
 			return 0, linuxerr.EINVAL
 		}
+		return result, err
 	}
-	return result, err
+	if ui.params != nil {
+		fd.replayMu.Lock()
+		fd.replay.track(ui.params)
+		fd.replayMu.Unlock()
+	}
+	return result, nil
 }
 
 // IsNvidiaDeviceFD implements NvidiaDeviceFD.IsNvidiaDeviceFD.
@@ -163,6 +199,10 @@ type uvmIoctlState struct {
 	t               *kernel.Task
 	cmd             uint32
 	ioctlParamsAddr hostarch.Addr
+
+	// params is set by uvmIoctlInvoke to the parameters of the ioctl
+	// invoked on the host file, if any.
+	params nvgpu.HasStatus
 }
 
 func uvmIoctlNoParams(ui *uvmIoctlState) (uintptr, error) {
@@ -243,6 +283,16 @@ func uvmMMInitialize(ui *uvmIoctlState) (uintptr, error) {
 	if err != nil {
 		return n, err
 	}
+	if ioctlParams.RMStatus == nvgpu.NV_OK {
+		// The driver holds a reference on the other file until this one is
+		// closed; see uvmFD.Release.
+		ui.fd.replayMu.Lock()
+		if ui.fd.replay.mmFD == nil {
+			uvmFile.vfsfd.IncRef()
+			ui.fd.replay.mmFD = uvmFile
+		}
+		ui.fd.replayMu.Unlock()
+	}
 	if _, err := ioctlParams.CopyOut(ui.t, ui.ioctlParamsAddr); err != nil {
 		return n, err
 	}
@@ -32,16 +32,22 @@ func (fd *uvmFD) ConfigureMMap(ctx context.Context, opts *memmap.MMapOpts) error
 
 // AddMapping implements memmap.Mappable.AddMapping.
 func (fd *uvmFD) AddMapping(ctx context.Context, ms memmap.MappingSpace, ar hostarch.AddrRange, offset uint64, writable bool) error {
+	fd.replayMu.Lock()
+	defer fd.replayMu.Unlock()
+	fd.replay.mappedBytes += uint64(ar.Length())
 	return nil
 }
 
 // RemoveMapping implements memmap.Mappable.RemoveMapping.
 func (fd *uvmFD) RemoveMapping(ctx context.Context, ms memmap.MappingSpace, ar hostarch.AddrRange, offset uint64, writable bool) {
+	fd.replayMu.Lock()
+	defer fd.replayMu.Unlock()
+	fd.replay.mappedBytes -= uint64(ar.Length())
 }
 
 // CopyMapping implements memmap.Mappable.CopyMapping.
 func (fd *uvmFD) CopyMapping(ctx context.Context, ms memmap.MappingSpace, srcAR, dstAR hostarch.AddrRange, offset uint64, writable bool) error {
-	return nil
+	return fd.AddMapping(ctx, ms, dstAR, offset, writable)
 }
 
 // Translate implements memmap.Mappable.Translate.
@@ -0,0 +1,168 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nvproxy
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/wilinz/gvisor/pkg/abi/nvgpu"
+)
+
+// uvmReplayState records the driver state associated with a uvmFD's host
+// file. Host files are reopened during restore, losing all driver state;
+// uvmReplayState tracks the subset of that state that can be recreated by
+// replaying ioctls, and whether any state exists that can't be.
+//
+// +stateify savable
+type uvmReplayState struct {
+	// initialized is true if UVM_INITIALIZE has succeeded, in which case
+	// initFlags are the flags that were passed to it.
+	initialized bool
+	initFlags   uint64
+
+	// mmFD is the uvmFD passed to a successful UVM_MM_INITIALIZE, or nil if
+	// there is none. If mmFD is not nil, a reference is held on mmFD.vfsfd.
+	mmFD *uvmFD
+
+	// externalRanges maps the base address of each range created by
+	// UVM_CREATE_EXTERNAL_RANGE, and not yet freed by UVM_FREE, to its
+	// length.
+	externalRanges map[uint64]uint64
+
+	// The following fields count driver objects that refer to RM objects
+	// (which can't be restored) or to identifiers allocated by the driver
+	// (which may differ when replayed), and therefore make the file
+	// unsavable.
+	gpus        int64
+	gpuVASpaces int64
+	channels    int64
+	rangeGroups int64
+
+	// mappedBytes is the number of bytes of application mappings of the
+	// file. UVM-managed memory is stored by the driver, so its contents
+	// can't be saved.
+	mappedBytes uint64
+}
+
+// track updates s to reflect a UVM ioctl that was invoked with the given
+// parameters and returned successfully.
+func (s *uvmReplayState) track(params nvgpu.HasStatus) {
+	if params.GetStatus() != nvgpu.NV_OK {
+		return
+	}
+	switch p := params.(type) {
+	case *nvgpu.UVM_INITIALIZE_PARAMS:
+		s.initialized = true
+		s.initFlags = p.Flags
+	case *nvgpu.UVM_CREATE_EXTERNAL_RANGE_PARAMS:
+		if s.externalRanges == nil {
+			s.externalRanges = make(map[uint64]uint64)
+		}
+		s.externalRanges[p.Base] = p.Length
+	case *nvgpu.UVM_FREE_PARAMS:
+		delete(s.externalRanges, p.Base)
+	case *nvgpu.UVM_REGISTER_GPU_PARAMS:
+		s.gpus++
+	case *nvgpu.UVM_UNREGISTER_GPU_PARAMS:
+		s.gpus--
+	case *nvgpu.UVM_REGISTER_GPU_VASPACE_PARAMS:
+		s.gpuVASpaces++
+	case *nvgpu.UVM_UNREGISTER_GPU_VASPACE_PARAMS:
+		s.gpuVASpaces--
+	case *nvgpu.UVM_REGISTER_CHANNEL_PARAMS:
+		s.channels++
+	case *nvgpu.UVM_UNREGISTER_CHANNEL_PARAMS:
+		s.channels--
+	case *nvgpu.UVM_CREATE_RANGE_GROUP_PARAMS:
+		s.rangeGroups++
+	case *nvgpu.UVM_DESTROY_RANGE_GROUP_PARAMS:
+		s.rangeGroups--
+	}
+}
+
+// checkSavable returns an error if s includes state that can't be replayed.
+func (s *uvmReplayState) checkSavable() error {
+	switch {
+	case s.gpus > 0:
+		return fmt.Errorf("%d GPUs are registered with UVM", s.gpus)
+	case s.gpuVASpaces > 0:
+		return fmt.Errorf("%d GPU VA spaces are registered with UVM", s.gpuVASpaces)
+	case s.channels > 0:
+		return fmt.Errorf("%d channels are registered with UVM", s.channels)
+	case s.rangeGroups > 0:
+		return fmt.Errorf("%d UVM range groups exist", s.rangeGroups)
+	case s.mappedBytes > 0:
+		return fmt.Errorf("%d bytes of UVM-managed memory are mapped", s.mappedBytes)
+	}
+	return nil
+}
+
+// uvmReplayer invokes UVM ioctls on a newly-opened host file.
+type uvmReplayer interface {
+	initialize(params *nvgpu.UVM_INITIALIZE_PARAMS) error
+	mmInitialize(params *nvgpu.UVM_MM_INITIALIZE_PARAMS) error
+	createExternalRange(params *nvgpu.UVM_CREATE_EXTERNAL_RANGE_PARAMS) error
+}
+
+// The replay* methods recreate s using r. Since UVM_MM_INITIALIZE refers to
+// another initialized file, replayInitialize must be called for all files
+// before replayMMInitialize is called for any, and similarly UVM requires
+// that a file is fully initialized before replayExternalRanges.
+
+func (s *uvmReplayState) replayInitialize(r uvmReplayer) error {
+	if !s.initialized {
+		return nil
+	}
+	// See uvmInitialize.
+	params := nvgpu.UVM_INITIALIZE_PARAMS{
+		Flags: s.initFlags | nvgpu.UVM_INIT_FLAGS_MULTI_PROCESS_SHARING_MODE,
+	}
+	if err := r.initialize(&params); err != nil {
+		return fmt.Errorf("UVM_INITIALIZE: %w", err)
+	}
+	return nil
+}
+
+func (s *uvmReplayState) replayMMInitialize(r uvmReplayer) error {
+	if s.mmFD == nil {
+		return nil
+	}
+	params := nvgpu.UVM_MM_INITIALIZE_PARAMS{
+		UvmFD: s.mmFD.hostFD,
+	}
+	if err := r.mmInitialize(&params); err != nil {
+		return fmt.Errorf("UVM_MM_INITIALIZE: %w", err)
+	}
+	return nil
+}
+
+func (s *uvmReplayState) replayExternalRanges(r uvmReplayer) error {
+	bases := make([]uint64, 0, len(s.externalRanges))
+	for base := range s.externalRanges {
+		bases = append(bases, base)
+	}
+	sort.Slice(bases, func(i, j int) bool { return bases[i] < bases[j] })
+	for _, base := range bases {
+		params := nvgpu.UVM_CREATE_EXTERNAL_RANGE_PARAMS{
+			Base:   base,
+			Length: s.externalRanges[base],
+		}
+		if err := r.createExternalRange(&params); err != nil {
+			return fmt.Errorf("UVM_CREATE_EXTERNAL_RANGE(%#x, %#x): %w", base, params.Length, err)
+		}
+	}
+	return nil
+}
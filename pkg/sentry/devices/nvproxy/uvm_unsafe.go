@@ -15,6 +15,7 @@
 package nvproxy
 
 import (
+	"fmt"
 	"runtime"
 	"unsafe"
 
@@ -29,6 +30,7 @@ func uvmIoctlInvoke[Params any, PtrParams hasStatusPtr[Params]](ui *uvmIoctlStat
 	if errno != 0 {
 		return n, errno
 	}
+	ui.params = ioctlParams
 	if log.IsLogging(log.Debug) {
 		if status := ioctlParams.GetStatus(); status != nvgpu.NV_OK {
 			ui.ctx.Debugf("nvproxy: uvm ioctl failed: status=%#x", status)
@@ -92,3 +94,34 @@ func (mf *uvmFDMemmapFile) BufferWriteAt(off uint64, src []byte) (uint64, error)
 	}
 	return params.BytesWritten, nil
 }
+
+// hostUVMReplayer implements uvmReplayer for a host UVM file.
+type hostUVMReplayer struct {
+	hostFD int32
+}
+
+func uvmReplayInvoke[Params any, PtrParams hasStatusPtr[Params]](r hostUVMReplayer, cmd uint32, ioctlParams PtrParams) error {
+	_, _, errno := unix.RawSyscall(unix.SYS_IOCTL, uintptr(r.hostFD), uintptr(cmd), uintptr(unsafe.Pointer(ioctlParams)))
+	if errno != 0 {
+		return errno
+	}
+	if status := ioctlParams.GetStatus(); status != nvgpu.NV_OK {
+		return fmt.Errorf("status %#x", status)
+	}
+	return nil
+}
+
+// initialize implements uvmReplayer.initialize.
+func (r hostUVMReplayer) initialize(params *nvgpu.UVM_INITIALIZE_PARAMS) error {
+	return uvmReplayInvoke(r, nvgpu.UVM_INITIALIZE, params)
+}
+
+// mmInitialize implements uvmReplayer.mmInitialize.
+func (r hostUVMReplayer) mmInitialize(params *nvgpu.UVM_MM_INITIALIZE_PARAMS) error {
+	return uvmReplayInvoke(r, nvgpu.UVM_MM_INITIALIZE, params)
+}
+
+// createExternalRange implements uvmReplayer.createExternalRange.
+func (r hostUVMReplayer) createExternalRange(params *nvgpu.UVM_CREATE_EXTERNAL_RANGE_PARAMS) error {
+	return uvmReplayInvoke(r, nvgpu.UVM_CREATE_EXTERNAL_RANGE, params)
+}
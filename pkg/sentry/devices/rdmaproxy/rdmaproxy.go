@@ -0,0 +1,93 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rdmaproxy implements a proxy for RDMA verbs devices
+// (/dev/infiniband/uverbs*).
+//
+// Only a restricted set of legacy write() commands is supported: enough to
+// open a device context, allocate protection domains, register memory
+// regions, and create completion and reliable/unreliable queue pairs. Data
+// path operations are expected to go through memory mapped by the provider
+// library, with the kernel only used as a doorbell. Commands carrying
+// driver-private input data are rejected, which limits support to providers
+// that don't need any (e.g. rxe and siw).
+package rdmaproxy
+
+import (
+	"fmt"
+	"regexp"
+
+	"golang.org/x/sys/unix"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/devutil"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/fdnotifier"
+	"github.com/wilinz/gvisor/pkg/log"
+	"github.com/wilinz/gvisor/pkg/sentry/vfs"
+)
+
+// UverbsDeviceRegex is the regex for detecting uverbs device paths.
+var UverbsDeviceRegex = regexp.MustCompile(`^/dev/infiniband/uverbs(\d+)$`)
+
+// uverbsDevice implements vfs.Device for /dev/infiniband/uverbs[0-9]+.
+//
+// +stateify savable
+type uverbsDevice struct {
+	num uint32
+}
+
+// Open implements vfs.Device.Open.
+func (dev *uverbsDevice) Open(ctx context.Context, mnt *vfs.Mount, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	devClient := devutil.GoferClientFromContext(ctx)
+	if devClient == nil {
+		log.Warningf("devutil.CtxDevGoferClient is not set")
+		return nil, linuxerr.ENOENT
+	}
+	name := fmt.Sprintf("infiniband/uverbs%d", dev.num)
+	hostFD, err := devClient.OpenAt(ctx, name, opts.Flags)
+	if err != nil {
+		ctx.Warningf("uverbsDevice: failed to open device %s: %v", name, err)
+		return nil, err
+	}
+	fd := &uverbsFD{
+		hostFD: int32(hostFD),
+		device: dev,
+		mrs:    make(map[uint32]MirrorRange),
+	}
+	if err := fd.vfsfd.Init(fd, opts.Flags, mnt, vfsd, &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+	}); err != nil {
+		unix.Close(hostFD)
+		return nil, err
+	}
+	if err := fdnotifier.AddFD(int32(hostFD), &fd.queue); err != nil {
+		unix.Close(hostFD)
+		return nil, err
+	}
+	fd.memmapFile.fd = fd
+	return &fd.vfsfd, nil
+}
+
+// RegisterUverbsDevice registers the uverbs device /dev/infiniband/uverbs{num}
+// with the given device numbers in vfsObj.
+func RegisterUverbsDevice(vfsObj *vfs.VirtualFilesystem, major, minor, num uint32) error {
+	if vfsObj.IsDeviceRegistered(vfs.CharDevice, major, minor) {
+		return nil
+	}
+	return vfsObj.RegisterDevice(vfs.CharDevice, major, minor, &uverbsDevice{
+		num: num,
+	}, &vfs.RegisterDeviceOptions{
+		GroupName: "infiniband_verbs",
+	})
+}
@@ -0,0 +1,275 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rdmaproxy
+
+import (
+	"golang.org/x/sys/unix"
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/abi/rdma"
+	"github.com/wilinz/gvisor/pkg/cleanup"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/hostarch"
+	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/host"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+	"github.com/wilinz/gvisor/pkg/sentry/memmap"
+	"github.com/wilinz/gvisor/pkg/sentry/mm"
+)
+
+// maxCmdSize is the maximum size of a command, including its header. It is
+// well above the size of any supported command.
+const maxCmdSize = hostarch.PageSize
+
+// command describes a supported uverbs command.
+type command struct {
+	// size is the size of the command's input, excluding its header. Commands
+	// of any other size are rejected.
+	size int
+
+	// handler executes the command in buf, which includes its header, on
+	// the host device. outSize is the size of the command's response buffer.
+	//
+	// Preconditions: fd.mu must be locked.
+	handler func(ctx context.Context, t *kernel.Task, fd *uverbsFD, buf []byte, outSize int) error
+}
+
+// commands is the allowlist of uverbs commands.
+var commands = map[uint32]command{
+	rdma.IB_USER_VERBS_CMD_GET_CONTEXT:  {(*rdma.IBUverbsGetContext)(nil).SizeBytes(), getContext},
+	rdma.IB_USER_VERBS_CMD_QUERY_DEVICE: {(*rdma.IBUverbsQueryDevice)(nil).SizeBytes(), withResponse},
+	rdma.IB_USER_VERBS_CMD_QUERY_PORT:   {(*rdma.IBUverbsQueryPort)(nil).SizeBytes(), withResponse},
+	rdma.IB_USER_VERBS_CMD_ALLOC_PD:     {(*rdma.IBUverbsAllocPD)(nil).SizeBytes(), withResponse},
+	rdma.IB_USER_VERBS_CMD_DEALLOC_PD:   {(*rdma.IBUverbsDeallocPD)(nil).SizeBytes(), withoutResponse},
+	rdma.IB_USER_VERBS_CMD_REG_MR:       {(*rdma.IBUverbsRegMR)(nil).SizeBytes(), regMR},
+	rdma.IB_USER_VERBS_CMD_DEREG_MR:     {(*rdma.IBUverbsDeregMR)(nil).SizeBytes(), deregMR},
+	rdma.IB_USER_VERBS_CMD_CREATE_CQ:    {(*rdma.IBUverbsCreateCQ)(nil).SizeBytes(), createCQ},
+	rdma.IB_USER_VERBS_CMD_DESTROY_CQ:   {(*rdma.IBUverbsDestroyCQ)(nil).SizeBytes(), withResponse},
+	rdma.IB_USER_VERBS_CMD_CREATE_QP:    {(*rdma.IBUverbsCreateQP)(nil).SizeBytes(), createQP},
+	rdma.IB_USER_VERBS_CMD_QUERY_QP:     {(*rdma.IBUverbsQueryQP)(nil).SizeBytes(), withResponse},
+	rdma.IB_USER_VERBS_CMD_MODIFY_QP:    {(*rdma.IBUverbsModifyQP)(nil).SizeBytes(), withoutResponse},
+	rdma.IB_USER_VERBS_CMD_DESTROY_QP:   {(*rdma.IBUverbsDestroyQP)(nil).SizeBytes(), withResponse},
+	rdma.IB_USER_VERBS_CMD_POST_SEND:    {(*rdma.IBUverbsPostWR)(nil).SizeBytes(), postWR},
+	rdma.IB_USER_VERBS_CMD_POST_RECV:    {(*rdma.IBUverbsPostWR)(nil).SizeBytes(), postWR},
+}
+
+// cmdInput returns the input of the command in buf, excluding its header.
+func cmdInput(buf []byte) []byte {
+	return buf[(*rdma.IBUverbsCmdHdr)(nil).SizeBytes():]
+}
+
+// exec writes the command in buf to the host device.
+func (fd *uverbsFD) exec(buf []byte) error {
+	n, err := unix.Write(int(fd.hostFD), buf)
+	if err != nil {
+		return err
+	}
+	if n != len(buf) {
+		return linuxerr.EIO
+	}
+	return nil
+}
+
+func withoutResponse(ctx context.Context, t *kernel.Task, fd *uverbsFD, buf []byte, outSize int) error {
+	return fd.exec(buf)
+}
+
+func withResponse(ctx context.Context, t *kernel.Task, fd *uverbsFD, buf []byte, outSize int) error {
+	out, addr, err := fd.execWithResponse(buf, outSize)
+	if err != nil {
+		return err
+	}
+	_, err = t.CopyOutBytes(addr, out)
+	return err
+}
+
+func getContext(ctx context.Context, t *kernel.Task, fd *uverbsFD, buf []byte, outSize int) error {
+	var resp rdma.IBUverbsGetContextResp
+	if outSize < resp.SizeBytes() {
+		// We must see the async event FD created by the host to import it.
+		return linuxerr.ENOSPC
+	}
+	out, addr, err := fd.execWithResponse(buf, outSize)
+	if err != nil {
+		return err
+	}
+	resp.UnmarshalUnsafe(out)
+	if hostFD := int(int32(resp.AsyncFD)); hostFD >= 0 {
+		file, err := host.NewFD(ctx, t.Kernel().HostMount(), hostFD, &host.NewFDOptions{})
+		if err != nil {
+			unix.Close(hostFD)
+			return err
+		}
+		defer file.DecRef(ctx)
+		appFD, err := t.NewFDFrom(0, file, kernel.FDFlags{CloseOnExec: true})
+		if err != nil {
+			return err
+		}
+		resp.AsyncFD = uint32(appFD)
+		resp.MarshalUnsafe(out)
+	}
+	_, err = t.CopyOutBytes(addr, out)
+	return err
+}
+
+func regMR(ctx context.Context, t *kernel.Task, fd *uverbsFD, buf []byte, outSize int) error {
+	var cmd rdma.IBUverbsRegMR
+	cmd.UnmarshalUnsafe(cmdInput(buf))
+	if cmd.AccessFlags&rdma.IB_ACCESS_ON_DEMAND != 0 {
+		// On-demand paging would let the device access application memory
+		// that isn't pinned.
+		ctx.Warningf("rdmaproxy: unsupported on-demand paging memory region")
+		return linuxerr.EOPNOTSUPP
+	}
+	var resp rdma.IBUverbsRegMRResp
+	if outSize < resp.SizeBytes() {
+		// We must see the memory region handle to track its mirror.
+		return linuxerr.ENOSPC
+	}
+	if cmd.Length == 0 {
+		return linuxerr.EINVAL
+	}
+	ar, ok := t.MemoryManager().CheckIORange(hostarch.Addr(cmd.Start), int64(cmd.Length))
+	if !ok {
+		return linuxerr.EFAULT
+	}
+	end, ok := ar.End.RoundUp()
+	if !ok {
+		return linuxerr.EFAULT
+	}
+	pageAR := hostarch.AddrRange{ar.Start.RoundDown(), end}
+	at := hostarch.Read
+	if cmd.AccessFlags&(rdma.IB_ACCESS_LOCAL_WRITE|rdma.IB_ACCESS_REMOTE_WRITE|rdma.IB_ACCESS_REMOTE_ATOMIC) != 0 {
+		at = hostarch.ReadWrite
+	}
+
+	mirror, prs, err := mirrorAppMemory(ctx, t, pageAR, at)
+	if err != nil {
+		return err
+	}
+	cu := cleanup.Make(func() {
+		mm.Unpin(prs)
+		unix.RawSyscall(unix.SYS_MUNMAP, uintptr(mirror.Start), uintptr(mirror.Length()), 0)
+	})
+	defer cu.Clean()
+
+	// Register the mirror in place of the application memory. The device
+	// address (HCAVA) is left as is.
+	sentryCmd := cmd
+	sentryCmd.Start = mirror.Start + uint64(ar.Start-pageAR.Start)
+	sentryCmd.MarshalUnsafe(cmdInput(buf))
+	out, addr, err := fd.execWithResponse(buf, outSize)
+	if err != nil {
+		return err
+	}
+	cu.Release()
+
+	resp.UnmarshalUnsafe(out)
+	start := mirror.Start
+	for _, pr := range prs {
+		rlen := uint64(pr.Source.Length())
+		fd.mirrors.InsertRange(MirrorRange{start, start + rlen}, pr)
+		start += rlen
+	}
+	fd.mrs[resp.MRHandle] = mirror
+	_, err = t.CopyOutBytes(addr, out)
+	return err
+}
+
+// mirrorAppMemory pins the application memory in ar and maps it into a new
+// range of the sentry's address space, which it returns along with the pinned
+// ranges.
+func mirrorAppMemory(ctx context.Context, t *kernel.Task, ar hostarch.AddrRange, at hostarch.AccessType) (MirrorRange, []mm.PinnedRange, error) {
+	// Reserve a range in our address space.
+	m, _, errno := unix.RawSyscall6(unix.SYS_MMAP, 0 /* addr */, uintptr(ar.Length()), unix.PROT_NONE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS, ^uintptr(0) /* fd */, 0 /* offset */)
+	if errno != 0 {
+		return MirrorRange{}, nil, errno
+	}
+	cu := cleanup.Make(func() {
+		unix.RawSyscall(unix.SYS_MUNMAP, m, uintptr(ar.Length()), 0)
+	})
+	defer cu.Clean()
+	// Mirror application mappings into the reserved range.
+	prs, err := t.MemoryManager().Pin(ctx, ar, at, false /* ignorePermissions */)
+	cu.Add(func() {
+		mm.Unpin(prs)
+	})
+	if err != nil {
+		return MirrorRange{}, nil, err
+	}
+	sentryAddr := m
+	for _, pr := range prs {
+		ims, err := pr.File.MapInternal(memmap.FileRange{pr.Offset, pr.Offset + uint64(pr.Source.Length())}, at)
+		if err != nil {
+			return MirrorRange{}, nil, err
+		}
+		for !ims.IsEmpty() {
+			im := ims.Head()
+			if _, _, errno := unix.RawSyscall6(unix.SYS_MREMAP, im.Addr(), 0 /* old_size */, uintptr(im.Len()), linux.MREMAP_MAYMOVE|linux.MREMAP_FIXED, sentryAddr, 0); errno != 0 {
+				return MirrorRange{}, nil, errno
+			}
+			sentryAddr += uintptr(im.Len())
+			ims = ims.Tail()
+		}
+	}
+	cu.Release()
+	return MirrorRange{uint64(m), uint64(m) + uint64(ar.Length())}, prs, nil
+}
+
+func deregMR(ctx context.Context, t *kernel.Task, fd *uverbsFD, buf []byte, outSize int) error {
+	var cmd rdma.IBUverbsDeregMR
+	cmd.UnmarshalUnsafe(cmdInput(buf))
+	if err := fd.exec(buf); err != nil {
+		return err
+	}
+	if mirror, ok := fd.mrs[cmd.MRHandle]; ok {
+		fd.removeMirrorLocked(mirror)
+		delete(fd.mrs, cmd.MRHandle)
+	}
+	return nil
+}
+
+func createCQ(ctx context.Context, t *kernel.Task, fd *uverbsFD, buf []byte, outSize int) error {
+	var cmd rdma.IBUverbsCreateCQ
+	cmd.UnmarshalUnsafe(cmdInput(buf))
+	if cmd.CompChannel != -1 {
+		// Completion channels are host FDs that we don't proxy.
+		ctx.Warningf("rdmaproxy: unsupported completion channel %d", cmd.CompChannel)
+		return linuxerr.EOPNOTSUPP
+	}
+	return withResponse(ctx, t, fd, buf, outSize)
+}
+
+func createQP(ctx context.Context, t *kernel.Task, fd *uverbsFD, buf []byte, outSize int) error {
+	var cmd rdma.IBUverbsCreateQP
+	cmd.UnmarshalUnsafe(cmdInput(buf))
+	switch cmd.QPType {
+	case rdma.IB_UVERBS_QPT_RC, rdma.IB_UVERBS_QPT_UC, rdma.IB_UVERBS_QPT_UD:
+	default:
+		ctx.Warningf("rdmaproxy: unsupported QP type %d", cmd.QPType)
+		return linuxerr.EOPNOTSUPP
+	}
+	return withResponse(ctx, t, fd, buf, outSize)
+}
+
+func postWR(ctx context.Context, t *kernel.Task, fd *uverbsFD, buf []byte, outSize int) error {
+	var cmd rdma.IBUverbsPostWR
+	cmd.UnmarshalUnsafe(cmdInput(buf))
+	if cmd.WRCount != 0 || cmd.SGECount != 0 {
+		// Only doorbells, which carry no work requests, are supported; work
+		// requests are posted through queues mapped by the provider library.
+		return linuxerr.EOPNOTSUPP
+	}
+	return withResponse(ctx, t, fd, buf, outSize)
+}
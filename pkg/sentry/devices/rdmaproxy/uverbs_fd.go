@@ -0,0 +1,228 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rdmaproxy
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+	"github.com/wilinz/gvisor/pkg/abi/rdma"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/fdnotifier"
+	"github.com/wilinz/gvisor/pkg/hostarch"
+	"github.com/wilinz/gvisor/pkg/log"
+	"github.com/wilinz/gvisor/pkg/sentry/arch"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+	"github.com/wilinz/gvisor/pkg/sentry/mm"
+	"github.com/wilinz/gvisor/pkg/sentry/vfs"
+	"github.com/wilinz/gvisor/pkg/sync"
+	"github.com/wilinz/gvisor/pkg/usermem"
+	"github.com/wilinz/gvisor/pkg/waiter"
+)
+
+// uverbsFD implements vfs.FileDescriptionImpl for
+// /dev/infiniband/uverbs[0-9]+.
+//
+// uverbsFD is not savable; we do not implement save/restore of RDMA device
+// state.
+type uverbsFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.NoLockFD
+
+	hostFD     int32
+	device     *uverbsDevice
+	queue      waiter.Queue
+	memmapFile uverbsFDMemmapFile
+
+	// mu serializes commands, since a command registering or deregistering a
+	// memory region must update the host and mirrors atomically.
+	mu sync.Mutex
+
+	// mrs maps the handles of registered memory regions to the range of the
+	// sentry's address space that mirrors the application memory they were
+	// registered with.
+	//
+	// +checklocks:mu
+	mrs map[uint32]MirrorRange
+
+	// mirrors tracks the application memory pinned for each mirror range in
+	// mrs.
+	//
+	// +checklocks:mu
+	mirrors MirrorSet
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *uverbsFD) Release(context.Context) {
+	fdnotifier.RemoveFD(fd.hostFD)
+	// Closing the host FD destroys the device context along with all memory
+	// regions registered through it, so the mirrors are no longer used by the
+	// host after this.
+	unix.Close(int(fd.hostFD))
+
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	for handle, r := range fd.mrs {
+		fd.removeMirrorLocked(r)
+		delete(fd.mrs, handle)
+	}
+}
+
+// EventRegister implements waiter.Waitable.EventRegister.
+func (fd *uverbsFD) EventRegister(e *waiter.Entry) error {
+	fd.queue.EventRegister(e)
+	if err := fdnotifier.UpdateFD(fd.hostFD); err != nil {
+		fd.queue.EventUnregister(e)
+		return err
+	}
+	return nil
+}
+
+// EventUnregister implements waiter.Waitable.EventUnregister.
+func (fd *uverbsFD) EventUnregister(e *waiter.Entry) {
+	fd.queue.EventUnregister(e)
+	if err := fdnotifier.UpdateFD(fd.hostFD); err != nil {
+		panic(fmt.Sprint("UpdateFD:", err))
+	}
+}
+
+// Readiness implements waiter.Waitable.Readiness.
+func (fd *uverbsFD) Readiness(mask waiter.EventMask) waiter.EventMask {
+	return fdnotifier.NonBlockingPoll(fd.hostFD, mask)
+}
+
+// Epollable implements vfs.FileDescriptionImpl.Epollable.
+func (fd *uverbsFD) Epollable() bool {
+	return true
+}
+
+// Ioctl implements vfs.FileDescriptionImpl.Ioctl.
+func (fd *uverbsFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+	// The ioctl() based interface (RDMA_VERBS_IOCTL) is not supported. Report
+	// it the way kernels predating it do, so that rdma-core falls back to the
+	// write() based interface.
+	return 0, linuxerr.ENOTTY
+}
+
+// Write implements vfs.FileDescriptionImpl.Write.
+func (fd *uverbsFD) Write(ctx context.Context, src usermem.IOSequence, opts vfs.WriteOptions) (int64, error) {
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		panic("Write should be called from a task context")
+	}
+
+	size := src.NumBytes()
+	var hdr rdma.IBUverbsCmdHdr
+	if size < int64(hdr.SizeBytes()) || size > maxCmdSize {
+		return 0, linuxerr.EINVAL
+	}
+	buf := make([]byte, size)
+	if _, err := src.CopyIn(ctx, buf); err != nil {
+		return 0, err
+	}
+	hdr.UnmarshalUnsafe(buf)
+	if hdr.Command&rdma.IB_USER_VERBS_CMD_FLAG_EXTENDED != 0 {
+		ctx.Debugf("rdmaproxy: unsupported extended command %#x", hdr.Command)
+		return 0, linuxerr.EOPNOTSUPP
+	}
+	if int64(hdr.InWords)*4 != size {
+		return 0, linuxerr.EINVAL
+	}
+	cmd, ok := commands[hdr.Command]
+	if !ok {
+		ctx.Warningf("rdmaproxy: unsupported command %d", hdr.Command)
+		return 0, linuxerr.EOPNOTSUPP
+	}
+	in := buf[hdr.SizeBytes():]
+	if len(in) != cmd.size {
+		// Either the command is truncated or it carries driver-private data,
+		// which we can't validate.
+		ctx.Warningf("rdmaproxy: command %d has %d bytes of input, want %d", hdr.Command, len(in), cmd.size)
+		return 0, linuxerr.EOPNOTSUPP
+	}
+
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	if err := cmd.handler(ctx, t, fd, buf, int(hdr.OutWords)*4); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// removeMirrorLocked unpins the application memory mirrored by r and unmaps r
+// from the sentry's address space.
+//
+// Preconditions: fd.mu must be locked.
+func (fd *uverbsFD) removeMirrorLocked(r MirrorRange) {
+	fd.mirrors.RemoveRangeWith(r, func(seg MirrorIterator) {
+		mm.Unpin([]mm.PinnedRange{seg.Value()})
+	})
+	if _, _, errno := unix.RawSyscall(unix.SYS_MUNMAP, uintptr(r.Start), uintptr(r.Length()), 0); errno != 0 {
+		log.Warningf("rdmaproxy: failed to unmap mirror [%#x, %#x): %v", r.Start, r.End, errno)
+	}
+}
+
+// mirrorSetFuncs implements segment.Functions for MirrorSet, which maps ranges
+// of the sentry's address space to the application memory they mirror.
+type mirrorSetFuncs struct{}
+
+func (mirrorSetFuncs) MinKey() uint64 {
+	return 0
+}
+
+func (mirrorSetFuncs) MaxKey() uint64 {
+	return ^uint64(0)
+}
+
+func (mirrorSetFuncs) ClearValue(val *mm.PinnedRange) {
+	*val = mm.PinnedRange{}
+}
+
+func (mirrorSetFuncs) Merge(r1 MirrorRange, v1 mm.PinnedRange, r2 MirrorRange, v2 mm.PinnedRange) (mm.PinnedRange, bool) {
+	// Do we have the same backing file?
+	if v1.File != v2.File {
+		return mm.PinnedRange{}, false
+	}
+
+	// Do we have contiguous offsets in the backing file?
+	if v1.Offset+uint64(v1.Source.Length()) != v2.Offset {
+		return mm.PinnedRange{}, false
+	}
+
+	// Are the application addresses contiguous? As for accel's DevAddrSet,
+	// this isn't strictly needed but simplifies things.
+	if v1.Source.End != v2.Source.Start {
+		return mm.PinnedRange{}, false
+	}
+
+	v1.Source.End = v2.Source.End
+	return v1, true
+}
+
+func (mirrorSetFuncs) Split(r MirrorRange, val mm.PinnedRange, split uint64) (mm.PinnedRange, mm.PinnedRange) {
+	n := split - r.Start
+
+	left := val
+	left.Source.End = left.Source.Start + hostarch.Addr(n)
+
+	right := val
+	right.Source.Start += hostarch.Addr(n)
+	right.Offset += n
+
+	return left, right
+}
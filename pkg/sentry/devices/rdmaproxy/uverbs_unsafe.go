@@ -0,0 +1,41 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rdmaproxy
+
+import (
+	"runtime"
+	"unsafe"
+
+	"github.com/wilinz/gvisor/pkg/hostarch"
+)
+
+// execWithResponse executes the command in buf, whose input starts with the
+// address of its response buffer, on the host device. The response is written
+// to a sentry buffer of size outSize instead of application memory.
+// execWithResponse returns the response and the application address it must
+// be copied out to.
+func (fd *uverbsFD) execWithResponse(buf []byte, outSize int) ([]byte, hostarch.Addr, error) {
+	in := cmdInput(buf)
+	addr := hostarch.Addr(hostarch.ByteOrder.Uint64(in))
+	out := make([]byte, outSize)
+	var outAddr uint64
+	if outSize != 0 {
+		outAddr = uint64(uintptr(unsafe.Pointer(&out[0])))
+	}
+	hostarch.ByteOrder.PutUint64(in, outAddr)
+	err := fd.exec(buf)
+	runtime.KeepAlive(out)
+	return out, addr, err
+}
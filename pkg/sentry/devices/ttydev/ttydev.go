@@ -12,7 +12,7 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// Package ttydev implements a vfs.Device for /dev/tty.
+// Package ttydev implements vfs.Devices for /dev/tty and /dev/console.
 package ttydev
 
 import (
@@ -50,11 +50,44 @@ func (ttyDevice) Open(ctx context.Context, mnt *vfs.Mount, vfsd *vfs.Dentry, opt
 	return tty.Open(ctx, mnt, vfsd, opts)
 }
 
+// consoleDevice implements vfs.Device for /dev/console.
+//
+// Each container in a sandbox has its own console, which is the terminal the
+// container was started with.
+//
+// +stateify savable
+type consoleDevice struct{}
+
+// Open implements vfs.Device.Open.
+func (consoleDevice) Open(ctx context.Context, mnt *vfs.Mount, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		return nil, linuxerr.ENXIO
+	}
+	tty := t.Kernel().ContainerConsole(t.ContainerID())
+	if tty == nil {
+		// Linux returns ENODEV if there is no console driver, see
+		// drivers/tty/tty_io.c:tty_lookup_driver().
+		return nil, linuxerr.ENODEV
+	}
+	// Like /dev/tty, opening /dev/console never sets the controlling
+	// terminal, see Linux tty_open_current_tty()/tty_lookup_driver().
+	opts.Flags |= linux.O_NOCTTY
+	return tty.Open(ctx, mnt, vfsd, opts)
+}
+
 // Register registers all devices implemented by this package in vfsObj.
 func Register(vfsObj *vfs.VirtualFilesystem) error {
-	return vfsObj.RegisterDevice(vfs.CharDevice, linux.TTYAUX_MAJOR, ttyDevMinor, ttyDevice{}, &vfs.RegisterDeviceOptions{
+	if err := vfsObj.RegisterDevice(vfs.CharDevice, linux.TTYAUX_MAJOR, ttyDevMinor, ttyDevice{}, &vfs.RegisterDeviceOptions{
 		GroupName: "tty",
 		Pathname:  "tty",
 		FilePerms: 0666,
+	}); err != nil {
+		return err
+	}
+	return vfsObj.RegisterDevice(vfs.CharDevice, linux.TTYAUX_MAJOR, consoleDevMinor, consoleDevice{}, &vfs.RegisterDeviceOptions{
+		GroupName: "tty",
+		Pathname:  "console",
+		FilePerms: 0600,
 	})
 }
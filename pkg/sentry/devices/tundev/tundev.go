@@ -24,9 +24,11 @@ import (
 	"github.com/wilinz/gvisor/pkg/context"
 	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
 	"github.com/wilinz/gvisor/pkg/hostarch"
+	"github.com/wilinz/gvisor/pkg/marshal/primitive"
 	"github.com/wilinz/gvisor/pkg/sentry/arch"
 	"github.com/wilinz/gvisor/pkg/sentry/inet"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
 	"github.com/wilinz/gvisor/pkg/sentry/socket/netstack"
 	"github.com/wilinz/gvisor/pkg/sentry/vfs"
 	"github.com/wilinz/gvisor/pkg/tcpip/link/tun"
@@ -79,9 +81,6 @@ func (fd *tunFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args
 
 	switch request {
 	case linux.TUNSETIFF:
-		if !t.HasCapability(linux.CAP_NET_ADMIN) {
-			return 0, linuxerr.EPERM
-		}
 		stack, ok := t.NetworkContext().(*netstack.Stack)
 		if !ok {
 			return 0, linuxerr.EINVAL
@@ -97,20 +96,77 @@ func (fd *tunFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args
 		if err != nil {
 			return 0, err
 		}
-		return 0, fd.device.SetIff(stack.Stack, req.Name(), flags)
+		return 0, fd.device.SetIff(stack.Stack, req.Name(), flags, func(owner, group uint32) bool {
+			return tunCapable(t, owner, group)
+		})
 
 	case linux.TUNGETIFF:
 		var req linux.IFReq
 		copy(req.IFName[:], fd.device.Name())
-		hostarch.ByteOrder.PutUint16(req.Data[:], netstack.TUNFlagsToLinux(fd.device.Flags()))
+		flags := netstack.TUNFlagsToLinux(fd.device.Flags())
+		if fd.device.Persistent() {
+			flags |= linux.IFF_PERSIST
+		}
+		hostarch.ByteOrder.PutUint16(req.Data[:], flags)
 		_, err := req.CopyOut(t, data)
 		return 0, err
 
+	case linux.TUNGETFEATURES:
+		features := uint32(linux.IFF_TUN | linux.IFF_TAP | linux.IFF_NO_PI | linux.IFF_ONE_QUEUE | linux.IFF_MULTI_QUEUE)
+		_, err := primitive.CopyUint32Out(t, data, features)
+		return 0, err
+
+	case linux.TUNSETQUEUE:
+		var req linux.IFReq
+		if _, err := req.CopyIn(t, data); err != nil {
+			return 0, err
+		}
+		flags := hostarch.ByteOrder.Uint16(req.Data[:])
+		switch {
+		case flags&linux.IFF_ATTACH_QUEUE != 0:
+			return 0, fd.device.SetQueue(true)
+		case flags&linux.IFF_DETACH_QUEUE != 0:
+			return 0, fd.device.SetQueue(false)
+		default:
+			return 0, linuxerr.EINVAL
+		}
+
+	case linux.TUNSETPERSIST:
+		return 0, fd.device.SetPersist(args[2].Uint64() != 0)
+
+	case linux.TUNSETOWNER:
+		owner := t.UserNamespace().MapToKUID(auth.UID(args[2].Uint()))
+		if !owner.Ok() {
+			return 0, linuxerr.EINVAL
+		}
+		return 0, fd.device.SetOwner(uint32(owner))
+
+	case linux.TUNSETGROUP:
+		group := t.UserNamespace().MapToKGID(auth.GID(args[2].Uint()))
+		if !group.Ok() {
+			return 0, linuxerr.EINVAL
+		}
+		return 0, fd.device.SetGroup(uint32(group))
+
 	default:
 		return 0, linuxerr.ENOTTY
 	}
 }
 
+// tunCapable returns true if t may create a tun interface, or attach to one
+// owned by the given user and group (tun.NoID if unset). See
+// drivers/net/tun.c:tun_not_capable().
+func tunCapable(t *kernel.Task, owner, group uint32) bool {
+	creds := t.Credentials()
+	if owner != tun.NoID && auth.KUID(owner) == creds.EffectiveKUID {
+		return true
+	}
+	if group != tun.NoID && creds.InGroup(auth.KGID(group)) {
+		return true
+	}
+	return creds.HasCapability(linux.CAP_NET_ADMIN)
+}
+
 // Release implements vfs.FileDescriptionImpl.Release.
 func (fd *tunFD) Release(ctx context.Context) {
 	fd.device.Release(ctx)
@@ -395,6 +395,22 @@ func (c *cgroupInode) ID() uint32 {
 	return c.id
 }
 
+// NumTasks implements kernel.CgroupImpl.NumTasks.
+func (c *cgroupInode) NumTasks() int {
+	c.fs.tasksMu.RLock()
+	defer c.fs.tasksMu.RUnlock()
+	return len(c.ts)
+}
+
+// ForEachChild implements kernel.CgroupImpl.ForEachChild.
+func (c *cgroupInode) ForEachChild(fn func(name string, child kernel.CgroupImpl)) {
+	c.dir.OrderedChildren.ForEachChild(func(name string, i kernfs.Inode) {
+		if child, ok := i.(*cgroupInode); ok {
+			fn(name, child)
+		}
+	})
+}
+
 func sortTIDs(tids []kernel.ThreadID) {
 	sort.Slice(tids, func(i, j int) bool { return tids[i] < tids[j] })
 }
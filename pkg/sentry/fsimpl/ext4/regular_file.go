@@ -0,0 +1,308 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ext4
+
+import (
+	"io"
+	"sync"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/hostarch"
+	"github.com/wilinz/gvisor/pkg/log"
+	"github.com/wilinz/gvisor/pkg/safemem"
+	"github.com/wilinz/gvisor/pkg/sentry/memmap"
+	"github.com/wilinz/gvisor/pkg/sentry/pgalloc"
+	"github.com/wilinz/gvisor/pkg/sentry/usage"
+	"github.com/wilinz/gvisor/pkg/sentry/vfs"
+	"github.com/wilinz/gvisor/pkg/usermem"
+)
+
+// maxReadChunk is the maximum number of bytes read from the image at once by
+// regularFileReader.
+const maxReadChunk = 1 << 20
+
+// +stateify savable
+type regularFileFD struct {
+	fileDescription
+
+	// offMu protects off.
+	offMu sync.Mutex `state:"nosave"`
+
+	// off is the file offset.
+	// +checklocks:offMu
+	off int64
+}
+
+// PRead implements vfs.FileDescriptionImpl.PRead.
+func (fd *regularFileFD) PRead(ctx context.Context, dst usermem.IOSequence, offset int64, opts vfs.ReadOptions) (int64, error) {
+	if offset < 0 {
+		return 0, linuxerr.EINVAL
+	}
+
+	// Check that flags are supported.
+	//
+	// TODO(gvisor.dev/issue/2601): Support select preadv2 flags.
+	if opts.Flags&^linux.RWF_HIPRI != 0 {
+		return 0, linuxerr.EOPNOTSUPP
+	}
+
+	if dst.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	r := &regularFileReader{
+		inode: fd.inode(),
+		off:   uint64(offset),
+	}
+	return dst.CopyOutFrom(ctx, r)
+}
+
+// regularFileReader implements safemem.Reader by reading from the image.
+type regularFileReader struct {
+	inode *inode
+	off   uint64
+}
+
+// ReadToBlocks implements safemem.Reader.ReadToBlocks.
+func (r *regularFileReader) ReadToBlocks(dsts safemem.BlockSeq) (uint64, error) {
+	n, err := r.inode.readToBlocksAt(dsts, r.off)
+	r.off += n
+	return n, err
+}
+
+// readToBlocksAt reads the file's data at offset off into dsts.
+func (i *inode) readToBlocksAt(dsts safemem.BlockSeq, off uint64) (uint64, error) {
+	size := i.Size()
+	if off >= size {
+		return 0, io.EOF
+	}
+	var done uint64
+	for !dsts.IsEmpty() && off < size {
+		n := dsts.NumBytes()
+		if rem := size - off; n > rem {
+			n = rem
+		}
+		if n > maxReadChunk {
+			n = maxReadChunk
+		}
+		buf := make([]byte, n)
+		read, err := i.ReadAt(buf, off)
+		cp, cperr := safemem.CopySeq(dsts, safemem.BlockSeqOf(safemem.BlockFromSafeSlice(buf[:read])))
+		done += cp
+		off += cp
+		dsts = dsts.DropFirst64(cp)
+		if cperr != nil {
+			return done, cperr
+		}
+		if err != nil && err != io.EOF {
+			return done, err
+		}
+	}
+	return done, nil
+}
+
+// Read implements vfs.FileDescriptionImpl.Read.
+func (fd *regularFileFD) Read(ctx context.Context, dst usermem.IOSequence, opts vfs.ReadOptions) (int64, error) {
+	fd.offMu.Lock()
+	n, err := fd.PRead(ctx, dst, fd.off, opts)
+	fd.off += n
+	fd.offMu.Unlock()
+	return n, err
+}
+
+// PWrite implements vfs.FileDescriptionImpl.PWrite.
+func (fd *regularFileFD) PWrite(ctx context.Context, src usermem.IOSequence, offset int64, opts vfs.WriteOptions) (int64, error) {
+	return 0, linuxerr.EROFS
+}
+
+// Write implements vfs.FileDescriptionImpl.Write.
+func (fd *regularFileFD) Write(ctx context.Context, src usermem.IOSequence, opts vfs.WriteOptions) (int64, error) {
+	return 0, linuxerr.EROFS
+}
+
+// Seek implements vfs.FileDescriptionImpl.Seek.
+func (fd *regularFileFD) Seek(ctx context.Context, offset int64, whence int32) (int64, error) {
+	fd.offMu.Lock()
+	defer fd.offMu.Unlock()
+	switch whence {
+	case linux.SEEK_SET:
+		// use offset as specified
+	case linux.SEEK_CUR:
+		offset += fd.off
+	case linux.SEEK_END:
+		offset += int64(fd.inode().Size())
+	default:
+		return 0, linuxerr.EINVAL
+	}
+	if offset < 0 {
+		return 0, linuxerr.EINVAL
+	}
+	fd.off = offset
+	return offset, nil
+}
+
+// ConfigureMMap implements vfs.FileDescriptionImpl.ConfigureMMap.
+func (fd *regularFileFD) ConfigureMMap(ctx context.Context, opts *memmap.MMapOpts) error {
+	if opts.MaxPerms.Write && !opts.Private {
+		return linuxerr.EINVAL
+	}
+	return vfs.GenericConfigureMMap(&fd.vfsfd, fd.inode(), opts)
+}
+
+// AddMapping implements memmap.Mappable.AddMapping.
+func (i *inode) AddMapping(ctx context.Context, ms memmap.MappingSpace, ar hostarch.AddrRange, offset uint64, writable bool) error {
+	i.mapsMu.Lock()
+	mapped := i.mappings.AddMapping(ms, ar, offset, writable)
+	// i.Evict() will refuse to evict memory-mapped pages, so tell the
+	// MemoryFile to not bother trying.
+	for _, r := range mapped {
+		i.fs.mf.MarkUnevictable(i, pgalloc.EvictableRange{r.Start, r.End})
+	}
+	i.mapsMu.Unlock()
+	return nil
+}
+
+// RemoveMapping implements memmap.Mappable.RemoveMapping.
+func (i *inode) RemoveMapping(ctx context.Context, ms memmap.MappingSpace, ar hostarch.AddrRange, offset uint64, writable bool) {
+	i.mapsMu.Lock()
+	unmapped := i.mappings.RemoveMapping(ms, ar, offset, writable)
+	// Pages that are no longer referenced by any application memory mappings
+	// are now considered unused; allow MemoryFile to evict them when
+	// necessary.
+	for _, r := range unmapped {
+		i.fs.mf.MarkEvictable(i, pgalloc.EvictableRange{r.Start, r.End})
+	}
+	i.mapsMu.Unlock()
+}
+
+// CopyMapping implements memmap.Mappable.CopyMapping.
+func (i *inode) CopyMapping(ctx context.Context, ms memmap.MappingSpace, srcAR, dstAR hostarch.AddrRange, offset uint64, writable bool) error {
+	return i.AddMapping(ctx, ms, dstAR, offset, writable)
+}
+
+// Translate implements memmap.Mappable.Translate.
+func (i *inode) Translate(ctx context.Context, required, optional memmap.MappableRange, at hostarch.AccessType) ([]memmap.Translation, error) {
+	size := i.Size()
+	pgend, _ := hostarch.PageRoundUp(size)
+	var beyondEOF bool
+	if required.End > pgend {
+		if required.Start >= pgend {
+			return nil, &memmap.BusError{io.EOF}
+		}
+		beyondEOF = true
+		required.End = pgend
+	}
+	if optional.End > pgend {
+		optional.End = pgend
+	}
+	if at.Write {
+		// This shouldn't be possible due to the check in ConfigureMMap().
+		inodeTranslateWriteWarnOnce.Do(func() {
+			log.Traceback("ext4.inode.Translate: unexpected access type %v", at)
+		})
+		return nil, &memmap.BusError{linuxerr.EROFS}
+	}
+
+	memCgID := pgalloc.MemoryCgroupIDFromContext(ctx)
+	i.dataMu.Lock()
+	defer i.dataMu.Unlock()
+
+	mf := i.fs.mf
+	_, cerr := i.cache.Fill(ctx, required, maxFillRange(required, optional), size, mf, pgalloc.AllocOpts{
+		Kind:    usage.PageCache,
+		MemCgID: memCgID,
+		Mode:    pgalloc.AllocateAndWritePopulate,
+	}, func(ctx context.Context, dsts safemem.BlockSeq, off uint64) (uint64, error) {
+		return i.readToBlocksAt(dsts, off)
+	})
+
+	var ts []memmap.Translation
+	var translatedEnd uint64
+	for seg := i.cache.FindSegment(required.Start); seg.Ok() && seg.Start() < required.End; seg, _ = seg.NextNonEmpty() {
+		segMR := seg.Range().Intersect(optional)
+		ts = append(ts, memmap.Translation{
+			Source: segMR,
+			File:   mf,
+			Offset: seg.FileRangeOf(segMR).Start,
+			Perms:  hostarch.ReadExecute,
+		})
+		translatedEnd = segMR.End
+	}
+
+	// Don't return the error returned by i.cache.Fill if it occurred outside
+	// of required.
+	if translatedEnd < required.End && cerr != nil {
+		return ts, &memmap.BusError{cerr}
+	}
+	if beyondEOF {
+		return ts, &memmap.BusError{io.EOF}
+	}
+	return ts, nil
+}
+
+var inodeTranslateWriteWarnOnce sync.Once
+
+func maxFillRange(required, optional memmap.MappableRange) memmap.MappableRange {
+	const maxReadahead = 64 << 10 // 64 KB, chosen arbitrarily
+	if required.Length() >= maxReadahead {
+		return required
+	}
+	if optional.Length() <= maxReadahead {
+		return optional
+	}
+	optional.Start = required.Start
+	if optional.Length() <= maxReadahead {
+		return optional
+	}
+	optional.End = optional.Start + maxReadahead
+	return optional
+}
+
+// InvalidateUnsavable implements memmap.Mappable.InvalidateUnsavable.
+func (i *inode) InvalidateUnsavable(ctx context.Context) error {
+	i.mapsMu.Lock()
+	defer i.mapsMu.Unlock()
+	i.mappings.InvalidateAll(memmap.InvalidateOpts{})
+
+	// Discard the cache so that it's not stored in saved state. This is safe
+	// because per InvalidateUnsavable invariants, no new translations can have
+	// been returned after we invalidated all existing translations above.
+	i.dataMu.Lock()
+	defer i.dataMu.Unlock()
+	i.fs.mf.MarkAllUnevictable(i)
+	i.cache.DropAll(i.fs.mf)
+	return nil
+}
+
+// Evict implements pgalloc.EvictableMemoryUser.Evict.
+func (i *inode) Evict(ctx context.Context, er pgalloc.EvictableRange) {
+	mr := memmap.MappableRange{er.Start, er.End}
+	i.mapsMu.Lock()
+	defer i.mapsMu.Unlock()
+	i.dataMu.Lock()
+	defer i.dataMu.Unlock()
+
+	// Only allow pages that are no longer memory-mapped to be evicted. Cached
+	// pages are never dirty, so they can be dropped without writeback.
+	for mgap := i.mappings.LowerBoundGap(mr.Start); mgap.Ok() && mgap.Start() < mr.End; mgap = mgap.NextGap() {
+		mgapMR := mgap.Range().Intersect(mr)
+		if mgapMR.Length() == 0 {
+			continue
+		}
+		i.cache.Drop(mgapMR, i.fs.mf)
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+
+	"golang.org/x/sys/unix"
+	"github.com/wilinz/gvisor/pkg/cleanup"
+	"github.com/wilinz/gvisor/pkg/context"
+)
+
+const (
+	// contentCacheDigestSuffix is the suffix of the names of the files
+	// holding the digests of cached files.
+	contentCacheDigestSuffix = ".sha256"
+
+	// contentCacheTempPrefix is the prefix of the names of files being
+	// written to the cache directory.
+	contentCacheTempPrefix = ".tmp-"
+
+	// contentCacheBufSize is the size of the buffer used to copy files.
+	contentCacheBufSize = 1 << 20
+)
+
+// errContentCacheCorrupt is returned when a cached file doesn't match its
+// digest.
+var errContentCacheCorrupt = errors.New("cached file doesn't match its digest")
+
+// ContentCache is a host directory caching the contents of regular files of
+// read-only gofer mounts. Files are read through the gofer once; later reads,
+// including by later sandboxes sharing the directory, use the local copy.
+//
+// Entries are keyed by file identity and version: the device and inode
+// numbers, size, and modification and change times of the file. Each entry is
+// stored along with its SHA-256 digest, which is verified before the entry is
+// used. Entries failing verification are removed.
+//
+// ContentCache is safe for concurrent use, including by several sandboxes
+// sharing the same directory.
+type ContentCache struct {
+	// dirFD is a host FD for the cache directory. dirFD is immutable.
+	dirFD int
+
+	// maxFileSize is the size of the largest file to cache. maxFileSize is
+	// immutable.
+	maxFileSize uint64
+}
+
+// NewContentCache returns a ContentCache in the directory represented by
+// dirFD, which it takes ownership of. Files larger than maxFileSize bytes
+// aren't cached.
+func NewContentCache(dirFD int, maxFileSize uint64) *ContentCache {
+	return &ContentCache{
+		dirFD:       dirFD,
+		maxFileSize: maxFileSize,
+	}
+}
+
+// contentCacheKey identifies a version of a file.
+type contentCacheKey struct {
+	inoKey
+	size  uint64
+	mtime int64
+	ctime int64
+}
+
+// name returns the name of the cache entry for k.
+func (k *contentCacheKey) name() string {
+	return fmt.Sprintf("%x.%x.%x.%x.%x.%x", k.devMajor, k.devMinor, k.ino, k.size, k.mtime, k.ctime)
+}
+
+// open returns a read-only host FD for the contents of the file version
+// identified by key, copying them to the cache with read first if they are
+// not cached yet. It returns -1 if the file can't be cached.
+func (c *ContentCache) open(ctx context.Context, key contentCacheKey, read func(dst []byte, off uint64) (uint64, error)) int32 {
+	if key.size > c.maxFileSize {
+		return -1
+	}
+	name := key.name()
+	fd, err := c.lookup(name, key.size)
+	if err == nil {
+		return int32(fd)
+	}
+	if err == errContentCacheCorrupt {
+		ctx.Warningf("gofer.ContentCache: discarding cached file %q: %v", name, err)
+		c.remove(name)
+	}
+	fd, err = c.fill(name, key.size, read)
+	if err != nil {
+		ctx.Debugf("gofer.ContentCache: failed to cache %q: %v", name, err)
+		return -1
+	}
+	return int32(fd)
+}
+
+// lookup returns a read-only host FD for the cache entry name, after checking
+// it against its digest.
+func (c *ContentCache) lookup(name string, size uint64) (int, error) {
+	var want [sha256.Size]byte
+	if err := c.readFile(name+contentCacheDigestSuffix, want[:]); err != nil {
+		return -1, err
+	}
+	fd, err := unix.Openat(c.dirFD, name, unix.O_RDONLY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, err
+	}
+	got, n, err := digestFile(fd)
+	if err == nil && (n != size || !bytes.Equal(got, want[:])) {
+		err = errContentCacheCorrupt
+	}
+	if err != nil {
+		unix.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+// fill copies size bytes read with read to the cache entry name, and returns a
+// read-only host FD for it.
+func (c *ContentCache) fill(name string, size uint64, read func(dst []byte, off uint64) (uint64, error)) (int, error) {
+	h := sha256.New()
+	if err := c.writeFile(name, func(fd int) error {
+		buf := make([]byte, min(size, contentCacheBufSize))
+		for off := uint64(0); off < size; {
+			n, err := read(buf[:min(size-off, uint64(len(buf)))], off)
+			if n == 0 {
+				if err == nil || err == io.EOF {
+					// The file shrunk.
+					err = io.ErrUnexpectedEOF
+				}
+				return err
+			}
+			if err := pwriteFull(fd, buf[:n], off); err != nil {
+				return err
+			}
+			h.Write(buf[:n])
+			off += n
+		}
+		return nil
+	}, func() error {
+		// Only make the entry visible once its digest can be checked.
+		return c.writeFile(name+contentCacheDigestSuffix, func(fd int) error {
+			return pwriteFull(fd, h.Sum(nil), 0)
+		}, nil)
+	}); err != nil {
+		return -1, err
+	}
+	return unix.Openat(c.dirFD, name, unix.O_RDONLY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+}
+
+// writeFile atomically creates the file name in the cache directory, with
+// contents written by write. If beforeRename is not nil, it is called after the
+// contents are synced and before the file is made visible.
+func (c *ContentCache) writeFile(name string, write func(fd int) error, beforeRename func() error) error {
+	tmpName := fmt.Sprintf("%s%s.%x", contentCacheTempPrefix, name, rand.Uint64())
+	fd, err := unix.Openat(c.dirFD, tmpName, unix.O_WRONLY|unix.O_CREAT|unix.O_EXCL|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0600)
+	if err != nil {
+		return err
+	}
+	cu := cleanup.Make(func() { unix.Unlinkat(c.dirFD, tmpName, 0) })
+	defer cu.Clean()
+	err = write(fd)
+	if err == nil {
+		err = unix.Fsync(fd)
+	}
+	unix.Close(fd)
+	if err != nil {
+		return err
+	}
+	if beforeRename != nil {
+		if err := beforeRename(); err != nil {
+			return err
+		}
+	}
+	if err := unix.Renameat(c.dirFD, tmpName, c.dirFD, name); err != nil {
+		return err
+	}
+	cu.Release()
+	return nil
+}
+
+// readFile reads the file name in the cache directory into buf, which must be
+// the size of the file.
+func (c *ContentCache) readFile(name string, buf []byte) error {
+	fd, err := unix.Openat(c.dirFD, name, unix.O_RDONLY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	n, err := unix.Pread(fd, buf, 0)
+	if err != nil {
+		return err
+	}
+	if n != len(buf) {
+		return errContentCacheCorrupt
+	}
+	return nil
+}
+
+// remove removes the cache entry name.
+func (c *ContentCache) remove(name string) {
+	// Remove the digest first so that the entry isn't used if removing the
+	// file fails.
+	unix.Unlinkat(c.dirFD, name+contentCacheDigestSuffix, 0)
+	unix.Unlinkat(c.dirFD, name, 0)
+}
+
+// digestFile returns the SHA-256 digest and the size of the file represented
+// by fd.
+func digestFile(fd int) ([]byte, uint64, error) {
+	h := sha256.New()
+	buf := make([]byte, contentCacheBufSize)
+	var off uint64
+	for {
+		n, err := unix.Pread(fd, buf, int64(off))
+		if err != nil {
+			return nil, 0, err
+		}
+		if n == 0 {
+			return h.Sum(nil), off, nil
+		}
+		h.Write(buf[:n])
+		off += uint64(n)
+	}
+}
+
+// pwriteFull writes all of buf to fd at offset off.
+func pwriteFull(fd int, buf []byte, off uint64) error {
+	for len(buf) > 0 {
+		n, err := unix.Pwrite(fd, buf, int64(off))
+		if err != nil {
+			return err
+		}
+		buf = buf[n:]
+		off += uint64(n)
+	}
+	return nil
+}
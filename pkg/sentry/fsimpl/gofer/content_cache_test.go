@@ -0,0 +1,156 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+	"github.com/wilinz/gvisor/pkg/sentry/contexttest"
+)
+
+func newTestContentCache(t *testing.T, maxFileSize uint64) (*ContentCache, string) {
+	t.Helper()
+	dir := t.TempDir()
+	dirFD, err := unix.Open(dir, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		t.Fatalf("open(%q) failed: %v", dir, err)
+	}
+	t.Cleanup(func() { unix.Close(dirFD) })
+	return NewContentCache(dirFD, maxFileSize), dir
+}
+
+// testFileReader returns a read function for data which counts its calls in
+// reads.
+func testFileReader(data []byte, reads *int) func([]byte, uint64) (uint64, error) {
+	return func(dst []byte, off uint64) (uint64, error) {
+		*reads++
+		if off >= uint64(len(data)) {
+			return 0, io.EOF
+		}
+		return uint64(copy(dst, data[off:])), nil
+	}
+}
+
+func readHostFD(t *testing.T, fd int32) []byte {
+	t.Helper()
+	f := os.NewFile(uintptr(fd), "cached")
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("reading cached file failed: %v", err)
+	}
+	return b
+}
+
+func TestContentCache(t *testing.T) {
+	ctx := contexttest.Context(t)
+	c, dir := newTestContentCache(t, 1<<20)
+	data := bytes.Repeat([]byte("gvisor"), 1000)
+	key := contentCacheKey{
+		inoKey: inoKey{ino: 1, devMinor: 2, devMajor: 3},
+		size:   uint64(len(data)),
+		mtime:  4,
+		ctime:  5,
+	}
+
+	// The first open fills the cache from the file.
+	reads := 0
+	fd := c.open(ctx, key, testFileReader(data, &reads))
+	if fd < 0 {
+		t.Fatalf("open() failed")
+	}
+	if got := readHostFD(t, fd); !bytes.Equal(got, data) {
+		t.Errorf("cached file contents = %q, want %q", got, data)
+	}
+	if reads == 0 {
+		t.Errorf("file wasn't read when filling the cache")
+	}
+
+	// The second open uses the cached contents.
+	reads = 0
+	fd = c.open(ctx, key, testFileReader(data, &reads))
+	if fd < 0 {
+		t.Fatalf("open() failed")
+	}
+	if got := readHostFD(t, fd); !bytes.Equal(got, data) {
+		t.Errorf("cached file contents = %q, want %q", got, data)
+	}
+	if reads != 0 {
+		t.Errorf("file was read %d times, want 0", reads)
+	}
+
+	// A corrupted entry is discarded and filled again.
+	if err := os.WriteFile(filepath.Join(dir, key.name()), []byte("corrupted"), 0600); err != nil {
+		t.Fatalf("corrupting cached file failed: %v", err)
+	}
+	fd = c.open(ctx, key, testFileReader(data, &reads))
+	if fd < 0 {
+		t.Fatalf("open() failed")
+	}
+	if got := readHostFD(t, fd); !bytes.Equal(got, data) {
+		t.Errorf("cached file contents = %q, want %q", got, data)
+	}
+	if reads == 0 {
+		t.Errorf("file wasn't read after the cached file was corrupted")
+	}
+
+	// A new version of the file doesn't use the old entry.
+	newData := []byte("new version")
+	newKey := key
+	newKey.size = uint64(len(newData))
+	newKey.mtime++
+	fd = c.open(ctx, newKey, testFileReader(newData, &reads))
+	if fd < 0 {
+		t.Fatalf("open() failed")
+	}
+	if got := readHostFD(t, fd); !bytes.Equal(got, newData) {
+		t.Errorf("cached file contents = %q, want %q", got, newData)
+	}
+}
+
+func TestContentCacheNotCached(t *testing.T) {
+	ctx := contexttest.Context(t)
+	c, dir := newTestContentCache(t, 10)
+	data := []byte("0123456789")
+	key := contentCacheKey{size: uint64(len(data))}
+
+	// Files which shrink while they are copied aren't cached.
+	reads := 0
+	if fd := c.open(ctx, key, testFileReader(data[:5], &reads)); fd >= 0 {
+		unix.Close(int(fd))
+		t.Errorf("open() of a truncated file = %d, want -1", fd)
+	}
+
+	// Files larger than the limit aren't cached.
+	key.size++
+	if fd := c.open(ctx, key, testFileReader(append(data, 'a'), &reads)); fd >= 0 {
+		unix.Close(int(fd))
+		t.Errorf("open() of a large file = %d, want -1", fd)
+	}
+
+	// Nothing is left in the directory.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir(%q) failed: %v", dir, err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("cache directory has %d entries, want 0", len(entries))
+	}
+}
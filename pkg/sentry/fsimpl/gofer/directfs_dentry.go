@@ -142,7 +142,7 @@ func (fs *filesystem) newDirectfsDentry(controlFD int) (*dentry, error) {
 	}
 	d.dentry.init(d)
 	fs.syncMu.Lock()
-	fs.syncableDentries.PushBack(&d.syncableListEntry)
+	fs.addSyncableDentryLocked(&d.dentry)
 	fs.syncMu.Unlock()
 	return &d.dentry, nil
 }
@@ -22,6 +22,7 @@ import (
 	"github.com/wilinz/gvisor/pkg/context"
 	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
 	"github.com/wilinz/gvisor/pkg/hostarch"
+	"github.com/wilinz/gvisor/pkg/lisafs"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel/pipe"
 	"github.com/wilinz/gvisor/pkg/sentry/socket/unix/transport"
@@ -162,8 +163,14 @@ func (fs *filesystem) newSyntheticDentry(opts *createSyntheticOpts) *dentry {
 func (d *dentry) clearDirentsLocked() {
 	d.dirents = nil
 	d.childrenSet = nil
+	d.direntsGen++
 }
 
+// maxStreamedDirents is the number of directory entries that a streaming
+// directoryFD retains before discarding entries that have already been
+// consumed, bounding memory usage for huge directories.
+const maxStreamedDirents = 4096
+
 // +stateify savable
 type directoryFD struct {
 	fileDescription
@@ -172,6 +179,22 @@ type directoryFD struct {
 	mu      sync.Mutex `state:"nosave"`
 	off     int64
 	dirents []vfs.Dirent
+
+	// If streaming is true, dirents is a window of the directory's entries
+	// that is read from the server in batches as off advances, rather than
+	// all entries in the directory. See fd.iterStreamingDirentsLocked().
+	streaming bool
+	// base is the offset of dirents[0].
+	base int64
+	// cursor is the server's position in the directory stream at which the
+	// next batch of entries begins.
+	cursor uint64
+	// eof is true if all entries have been read from the server.
+	eof bool
+	// partial is true if entries have been discarded from dirents.
+	partial bool
+	// gen is the value of dentry.direntsGen when streaming began.
+	gen uint64
 }
 
 // Release implements vfs.FileDescriptionImpl.Release.
@@ -184,18 +207,30 @@ func (fd *directoryFD) IterDirents(ctx context.Context, cb vfs.IterDirentsCallba
 	defer fd.mu.Unlock()
 
 	d := fd.dentry()
-	if fd.dirents == nil {
-		ds, err := d.getDirents(ctx)
-		if err != nil {
-			return err
+	if fd.streaming && fd.off < fd.base {
+		// Entries before fd.off have been discarded, so start over.
+		fd.dirents = nil
+		fd.streaming = false
+	}
+	if fd.dirents == nil && !fd.streaming {
+		if gen, ok := d.canStreamDirents(); ok {
+			fd.resetStreamLocked(d, gen)
+		} else {
+			ds, err := d.getDirents(ctx)
+			if err != nil {
+				return err
+			}
+			fd.dirents = ds
 		}
-		fd.dirents = ds
 	}
 
 	if d.cachedMetadataAuthoritative() {
 		d.touchAtime(fd.vfsfd.Mount())
 	}
 
+	if fd.streaming {
+		return fd.iterStreamingDirentsLocked(ctx, d, cb)
+	}
 	for fd.off < int64(len(fd.dirents)) {
 		if err := cb.Handle(fd.dirents[fd.off]); err != nil {
 			return err
@@ -205,6 +240,166 @@ func (fd *directoryFD) IterDirents(ctx context.Context, cb vfs.IterDirentsCallba
 	return nil
 }
 
+// canStreamDirents returns true if directoryFDs representing d should read
+// directory entries from the server incrementally, along with the current
+// value of d.direntsGen.
+//
+// Preconditions: d.isDir().
+func (d *dentry) canStreamDirents() (uint64, bool) {
+	if _, ok := d.impl.(*lisafsDentry); !ok || !d.fs.client.IsSupported(lisafs.Getdents64Cursor) {
+		return 0, false
+	}
+	d.childrenMu.Lock()
+	defer d.childrenMu.Unlock()
+	// Use cached dirents if available. Synthetic children must be merged
+	// with the entries returned by the server, which requires all of them.
+	if d.dirents != nil || d.syntheticChildren != 0 {
+		return 0, false
+	}
+	return d.direntsGen, true
+}
+
+// resetStreamLocked (re)starts streaming directory entries for d from the
+// beginning of the directory.
+//
+// Preconditions: fd.mu must be locked.
+func (fd *directoryFD) resetStreamLocked(d *dentry, gen uint64) {
+	// filesystem.renameMu is needed for d.parent.
+	d.fs.renameMu.RLock()
+	fd.dirents = d.dotDirents()
+	d.fs.renameMu.RUnlock()
+	fd.streaming = true
+	fd.base = 0
+	fd.cursor = 0
+	fd.eof = false
+	fd.partial = false
+	fd.gen = gen
+}
+
+// iterStreamingDirentsLocked implements IterDirents for streaming
+// directoryFDs.
+//
+// Unlike dentry.getDirents(), this does not exclude directory mutations while
+// the directory is being read, since batches are read lazily. Instead, it
+// relies on the server's directory stream to provide POSIX readdir
+// semantics, as the host's getdents64(2) does.
+//
+// Preconditions:
+//   - fd.mu must be locked.
+//   - fd.streaming == true.
+//   - fd.off >= fd.base.
+func (fd *directoryFD) iterStreamingDirentsLocked(ctx context.Context, d *dentry, cb vfs.IterDirentsCallback) error {
+	for {
+		for fd.off < fd.base+int64(len(fd.dirents)) {
+			if err := cb.Handle(fd.dirents[fd.off-fd.base]); err != nil {
+				return err
+			}
+			fd.off++
+		}
+		if fd.eof {
+			return nil
+		}
+		if err := fd.readBatchLocked(ctx, d); err != nil {
+			return err
+		}
+	}
+}
+
+// readBatchLocked reads the next batch of directory entries from the server
+// into fd.dirents.
+//
+// Preconditions:
+//   - fd.mu must be locked.
+//   - fd.streaming == true.
+//   - fd.eof == false.
+func (fd *directoryFD) readBatchLocked(ctx context.Context, d *dentry) error {
+	if len(fd.dirents) >= maxStreamedDirents {
+		consumed := fd.off - fd.base
+		if consumed > int64(len(fd.dirents)) {
+			consumed = int64(len(fd.dirents))
+		}
+		if consumed > 0 {
+			fd.dirents = append(fd.dirents[:0], fd.dirents[consumed:]...)
+			fd.base += consumed
+			fd.partial = true
+		}
+	}
+	d.handleMu.RLock()
+	if !d.isReadHandleOk() {
+		// This should not be possible because a readable handle should have
+		// been opened when fd was opened.
+		panic("gofer.directoryFD.readBatchLocked called without a readable handle")
+	}
+	next, ok, err := d.impl.(*lisafsDentry).getDirentsBatchLocked(ctx, fd.cursor, func(name string, key inoKey, dType uint8) {
+		fd.dirents = append(fd.dirents, vfs.Dirent{
+			Name:    name,
+			Ino:     d.fs.inoFromKey(key),
+			NextOff: fd.base + int64(len(fd.dirents)) + 1,
+			Type:    dType,
+		})
+	})
+	d.handleMu.RUnlock()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fd.eof = true
+		fd.publishDirentsLocked(d)
+		return nil
+	}
+	fd.cursor = next
+	return nil
+}
+
+// publishDirentsLocked caches the complete set of directory entries read by
+// fd in d, so that future directoryFDs don't need to read them from the
+// server again.
+//
+// Preconditions:
+//   - fd.mu must be locked.
+//   - fd.eof == true.
+func (fd *directoryFD) publishDirentsLocked(d *dentry) {
+	if fd.partial || !d.cachedMetadataAuthoritative() {
+		return
+	}
+	d.childrenMu.Lock()
+	defer d.childrenMu.Unlock()
+	if d.direntsGen != fd.gen || d.dirents != nil || d.syntheticChildren != 0 {
+		// The directory was mutated while being streamed, or another
+		// directoryFD got here first.
+		return
+	}
+	d.dirents = fd.dirents
+	d.childrenSet = make(map[string]struct{}, len(d.dirents))
+	for _, dirent := range d.dirents {
+		d.childrenSet[dirent.Name] = struct{}{}
+	}
+}
+
+// dotDirents returns directory entries for "." and "..", which are
+// synthesized by the client.
+//
+// Preconditions: d.fs.renameMu must be locked.
+func (d *dentry) dotDirents() []vfs.Dirent {
+	// It's not clear if 9P2000.L's readdir is expected to return "." and "..",
+	// so we generate them here.
+	parent := genericParentOrSelf(d)
+	return []vfs.Dirent{
+		{
+			Name:    ".",
+			Type:    linux.DT_DIR,
+			Ino:     uint64(d.ino),
+			NextOff: 1,
+		},
+		{
+			Name:    "..",
+			Type:    uint8(parent.mode.Load() >> 12),
+			Ino:     uint64(parent.ino),
+			NextOff: 2,
+		},
+	}
+}
+
 // Preconditions:
 //   - d.isDir().
 //   - There exists at least one directoryFD representing d.
@@ -241,23 +436,7 @@ func (d *dentry) getDirents(ctx context.Context) ([]vfs.Dirent, error) {
 		return d.dirents, nil
 	}
 
-	// It's not clear if 9P2000.L's readdir is expected to return "." and "..",
-	// so we generate them here.
-	parent := genericParentOrSelf(d)
-	dirents := []vfs.Dirent{
-		{
-			Name:    ".",
-			Type:    linux.DT_DIR,
-			Ino:     uint64(d.ino),
-			NextOff: 1,
-		},
-		{
-			Name:    "..",
-			Type:    uint8(parent.mode.Load() >> 12),
-			Ino:     uint64(parent.ino),
-			NextOff: 2,
-		},
-	}
+	dirents := d.dotDirents()
 	var realChildren map[string]struct{}
 	if !d.isSynthetic() {
 		if d.syntheticChildren != 0 && d.fs.opts.interop == InteropModeShared {
@@ -329,8 +508,9 @@ func (fd *directoryFD) Seek(ctx context.Context, offset int64, whence int32) (in
 		}
 		if offset == 0 {
 			// Ensure that the next call to fd.IterDirents() calls
-			// fd.dentry().getDirents().
+			// fd.dentry().getDirents() or restarts streaming.
 			fd.dirents = nil
+			fd.streaming = false
 		}
 		fd.off = offset
 		return fd.off, nil
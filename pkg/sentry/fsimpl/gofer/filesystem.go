@@ -26,6 +26,7 @@ import (
 	"github.com/wilinz/gvisor/pkg/context"
 	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
 	"github.com/wilinz/gvisor/pkg/fspath"
+	"github.com/wilinz/gvisor/pkg/hostarch"
 	"github.com/wilinz/gvisor/pkg/log"
 	"github.com/wilinz/gvisor/pkg/refs"
 	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/host"
@@ -1766,6 +1767,53 @@ func (fs *filesystem) IsDescendant(vfsroot, vd vfs.VirtualDentry) bool {
 	return genericIsDescendant(fs, vfsroot.Dentry(), vd.Dentry().Impl().(*dentry))
 }
 
+// fileHandleSize is the size of gofer file handles, which consist of a 64-bit
+// inode number followed by a 32-bit generation number that is always 0.
+const fileHandleSize = 12
+
+// EncodeFileHandle implements vfs.FilesystemImplFileHandleExtension.EncodeFileHandle.
+//
+// Handles are built from the inode numbers assigned by the sentry (see
+// filesystem.inoFromKey) rather than from host file handles, so that they can
+// never be used to reach host files outside of the mount.
+func (fs *filesystem) EncodeFileHandle(ctx context.Context, vfsd *vfs.Dentry) (int32, []byte, error) {
+	d := vfsd.Impl().(*dentry)
+	if d.isSynthetic() {
+		return 0, nil, linuxerr.EOPNOTSUPP
+	}
+	handle := make([]byte, fileHandleSize)
+	hostarch.ByteOrder.PutUint64(handle, d.ino)
+	return linux.FILEID_INO64_GEN, handle, nil
+}
+
+// DecodeFileHandle implements vfs.FilesystemImplFileHandleExtension.DecodeFileHandle.
+//
+// Handles are resolved within the sentry, so only files that have a dentry
+// reachable from the root of the filesystem can be found. Other handles are
+// reported as stale.
+func (fs *filesystem) DecodeFileHandle(ctx context.Context, mntRoot *vfs.Dentry, handleType int32, handle []byte) (*vfs.Dentry, error) {
+	if handleType != linux.FILEID_INO64_GEN || len(handle) != fileHandleSize || hostarch.ByteOrder.Uint32(handle[8:]) != 0 {
+		return nil, linuxerr.ESTALE
+	}
+	ino := hostarch.ByteOrder.Uint64(handle)
+
+	var ds *[]*dentry
+	fs.renameMu.RLock()
+	defer fs.renameMuRUnlockAndCheckCaching(ctx, &ds)
+	fs.syncMu.Lock()
+	d, ok := fs.dentriesByIno[ino]
+	fs.syncMu.Unlock()
+	// Connected dentries are only destroyed with fs.renameMu locked for
+	// writing, so d can't be destroyed while it is found to be connected.
+	if !ok || d.isDeleted() || !genericIsDescendant(fs, mntRoot, d) {
+		return nil, linuxerr.ESTALE
+	}
+	d.IncRef()
+	// Call d.checkCachingLocked() so it can be removed from the cache if needed.
+	ds = appendDentry(ds, d)
+	return &d.vfsd, nil
+}
+
 type mopt struct {
 	key   string
 	value any
@@ -1817,6 +1865,9 @@ func (fs *filesystem) MountOptions() string {
 	if fs.opts.overlayfsStaleRead {
 		optsKV = append(optsKV, mopt{moptOverlayfsStaleRead, nil})
 	}
+	if fs.opts.channelPool {
+		optsKV = append(optsKV, mopt{moptChannelPool, nil})
+	}
 	if fs.opts.directfs.enabled {
 		optsKV = append(optsKV, mopt{moptDirectfs, nil})
 	}
@@ -88,6 +88,7 @@ const (
 	moptOverlayfsStaleRead       = "overlayfs_stale_read"
 	moptDisableFileHandleSharing = "disable_file_handle_sharing"
 	moptDisableFifoOpen          = "disable_fifo_open"
+	moptChannelPool              = "channel_pool"
 
 	// Directfs options.
 	moptDirectfs = "directfs"
@@ -155,6 +156,29 @@ type dentryCache struct {
 	dentries dentryList
 	// dentriesLen is the number of dentries in dentries.
 	dentriesLen uint64
+	// added is true if maxCachedDentries has been registered with
+	// vfs.VirtualFilesystem.AddDentryCache.
+	added bool
+}
+
+// addToVFS registers cache with vfsObj if it isn't already registered.
+func (cache *dentryCache) addToVFS(vfsObj *vfs.VirtualFilesystem) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if !cache.added {
+		vfsObj.AddDentryCache(cache.maxCachedDentries)
+		cache.added = true
+	}
+}
+
+// removeFromVFS undoes a previous call to addToVFS.
+func (cache *dentryCache) removeFromVFS(vfsObj *vfs.VirtualFilesystem) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.added {
+		vfsObj.RemoveDentryCache(cache.maxCachedDentries)
+		cache.added = false
+	}
 }
 
 // SetDentryCacheSize sets the size of the global gofer dentry cache.
@@ -231,6 +255,12 @@ type filesystem struct {
 	syncableDentries dentryList
 	specialFileFDs   specialFDList
 
+	// dentriesByIno maps inode numbers to syncable dentries for those inodes,
+	// so that file handles can be decoded. If several dentries share an inode
+	// number (e.g. hard links), only the first one is tracked. dentriesByIno
+	// is protected by syncMu.
+	dentriesByIno map[uint64]*dentry
+
 	// inoByKey maps previously-observed device ID and host inode numbers to
 	// internal inode numbers assigned to those files. inoByKey is not preserved
 	// across checkpoint/restore because inode numbers may be reused between
@@ -300,6 +330,10 @@ type filesystemOptions struct {
 	// are disallowed.
 	disableFifoOpen bool
 
+	// If channelPool is true, RPCs are made over a pool of channels that
+	// grows on demand. See lisafs.Client.StartChannelPool.
+	channelPool bool
+
 	// directfs holds options for directfs mode.
 	directfs directfsOpts
 }
@@ -392,6 +426,11 @@ type InternalFilesystemOptions struct {
 	// TODO(b/354724938): Remove this option once there are no callers who
 	// rely on this behavior.
 	OpenSocketsByConnecting bool
+
+	// If ContentCache is not nil, the contents of regular files are cached
+	// there. The filesystem must only be mounted read-only, and is used in
+	// InteropModeExclusive.
+	ContentCache *ContentCache `state:"nosave"`
 }
 
 // _V9FS_DEFUID and _V9FS_DEFGID (from Linux's fs/9p/v9fs.h) are the default
@@ -505,6 +544,10 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		delete(mopts, moptDisableFifoOpen)
 		fsopts.disableFifoOpen = true
 	}
+	if _, ok := mopts[moptChannelPool]; ok {
+		delete(mopts, moptChannelPool)
+		fsopts.channelPool = true
+	}
 	if _, ok := mopts[moptForcePageCache]; ok {
 		delete(mopts, moptForcePageCache)
 		fsopts.forcePageCache = true
@@ -554,12 +597,13 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		return nil, nil, err
 	}
 	fs := &filesystem{
-		mf:       mf,
-		opts:     fsopts,
-		iopts:    iopts,
-		clock:    ktime.RealtimeClockFromContext(ctx),
-		devMinor: devMinor,
-		inoByKey: make(map[inoKey]uint64),
+		mf:            mf,
+		opts:          fsopts,
+		iopts:         iopts,
+		clock:         ktime.RealtimeClockFromContext(ctx),
+		devMinor:      devMinor,
+		inoByKey:      make(map[inoKey]uint64),
+		dentriesByIno: make(map[uint64]*dentry),
 	}
 
 	// Did the user configure a global dentry cache?
@@ -570,6 +614,7 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 	}
 
 	fs.vfsfs.Init(vfsObj, &fstype, fs)
+	fs.dentryCache.addToVFS(vfsObj)
 
 	rootInode, rootHostFD, err := fs.initClientAndGetRoot(ctx)
 	if err != nil {
@@ -637,7 +682,11 @@ func (fs *filesystem) initClientAndGetRoot(ctx context.Context) (lisafs.Inode, i
 			rootHostFD = -1
 		}
 		// Use flipcall channels with lisafs because it makes a lot of RPCs.
-		if err := fs.client.StartChannels(); err != nil {
+		startChannels := fs.client.StartChannels
+		if fs.opts.channelPool {
+			startChannels = fs.client.StartChannelPool
+		}
+		if err := startChannels(); err != nil {
 			return lisafs.Inode{}, -1, err
 		}
 		rootInode, err = fs.handleAnameLisafs(ctx, rootInode)
@@ -742,6 +791,11 @@ func (fs *filesystem) Release(ctx context.Context) {
 		}
 	}
 
+	// The global dentry cache outlives fs.
+	if fs.dentryCache != globalDentryCache {
+		fs.dentryCache.removeFromVFS(fs.vfsfs.VirtualFilesystem())
+	}
+
 	fs.vfsfs.VirtualFilesystem().PutAnonBlockDevMinor(fs.devMinor)
 }
 
@@ -897,6 +951,12 @@ type dentry struct {
 	dirents []vfs.Dirent `state:"nosave"`
 	// +checklocks:childrenMu
 	childrenSet map[string]struct{} `state:"nosave"`
+	// direntsGen is incremented whenever dirents is invalidated. It is used
+	// to detect mutations that race with streaming directoryFDs that may
+	// populate dirents; see directoryFD.publishDirentsLocked().
+	//
+	// +checklocks:childrenMu
+	direntsGen uint64 `state:"nosave"`
 
 	// Cached metadata; protected by metadataMu.
 	// To access:
@@ -1060,6 +1120,16 @@ func (fs *filesystem) inoFromKey(key inoKey) uint64 {
 	return ino
 }
 
+// addSyncableDentryLocked adds d to fs.syncableDentries.
+//
+// Preconditions: fs.syncMu must be locked.
+func (fs *filesystem) addSyncableDentryLocked(d *dentry) {
+	fs.syncableDentries.PushBack(&d.syncableListEntry)
+	if _, ok := fs.dentriesByIno[d.ino]; !ok {
+		fs.dentriesByIno[d.ino] = d
+	}
+}
+
 func (fs *filesystem) nextIno() uint64 {
 	return fs.lastIno.Add(1)
 }
@@ -1444,6 +1514,10 @@ func (d *dentry) checkPermissions(creds *auth.Credentials, ats vfs.AccessTypes)
 	return vfs.GenericCheckPermissions(creds, ats, linux.FileMode(d.mode.Load()), auth.KUID(d.uid.Load()), auth.KGID(d.gid.Load()))
 }
 
+// overlayXattrPrefix is the prefix of extended attributes used by Linux
+// overlayfs, see fs/overlayfs/overlayfs.h:OVL_XATTR_PREFIX.
+const overlayXattrPrefix = linux.XATTR_TRUSTED_PREFIX + "overlay."
+
 func (d *dentry) checkXattrPermissions(creds *auth.Credentials, name string, ats vfs.AccessTypes) error {
 	// Deny access to the "system" namespaces since applications
 	// may expect these to affect kernel behavior in unimplemented ways
@@ -1452,8 +1526,14 @@ func (d *dentry) checkXattrPermissions(creds *auth.Credentials, name string, ats
 	// but consistent with other filesystems (e.g. FUSE).
 	//
 	// NOTE(b/202533394): Also disallow "trusted" namespace for now. This is
-	// consistent with the VFS1 gofer client.
-	if strings.HasPrefix(name, linux.XATTR_SYSTEM_PREFIX) || strings.HasPrefix(name, linux.XATTR_TRUSTED_PREFIX) {
+	// consistent with the VFS1 gofer client. The exception is reading
+	// overlayfs attributes, which mark opaque directories on layers prepared
+	// by Linux overlayfs; vfs.CheckXattrPermissions below limits this to
+	// privileged users.
+	if strings.HasPrefix(name, linux.XATTR_SYSTEM_PREFIX) {
+		return linuxerr.EOPNOTSUPP
+	}
+	if strings.HasPrefix(name, linux.XATTR_TRUSTED_PREFIX) && (ats.MayWrite() || !strings.HasPrefix(name, overlayXattrPrefix)) {
 		return linuxerr.EOPNOTSUPP
 	}
 	mode := linux.FileMode(d.mode.Load())
@@ -1692,9 +1772,14 @@ func (d *dentry) checkCachingLocked(ctx context.Context, renameMuWriteLocked boo
 	d.fs.dentryCache.dentries.PushFront(&d.cacheEntry)
 	d.fs.dentryCache.dentriesLen++
 	d.cached = true
-	shouldEvict := d.fs.dentryCache.dentriesLen > d.fs.dentryCache.maxCachedDentries
+	vfsObj := d.fs.vfsfs.VirtualFilesystem()
+	// The limit may have been lowered since the last insertion, if other
+	// filesystems registered their caches.
+	limit := vfsObj.DentryCacheLimit(d.fs.dentryCache.maxCachedDentries)
+	shouldEvict := d.fs.dentryCache.dentriesLen > limit
 	d.fs.dentryCache.mu.Unlock()
 	d.cachingMu.Unlock()
+	vfsObj.DentryCached()
 
 	if shouldEvict {
 		if !renameMuWriteLocked {
@@ -1703,7 +1788,7 @@ func (d *dentry) checkCachingLocked(ctx context.Context, renameMuWriteLocked boo
 			d.fs.renameMu.Lock()
 			defer d.fs.renameMu.Unlock()
 		}
-		d.fs.evictCachedDentryLocked(ctx) // +checklocksforce: see above.
+		d.fs.evictCachedDentriesLocked(ctx, limit) // +checklocksforce: see above.
 	}
 }
 
@@ -1715,6 +1800,7 @@ func (d *dentry) removeFromCacheLocked() {
 		d.fs.dentryCache.dentriesLen--
 		d.fs.dentryCache.mu.Unlock()
 		d.cached = false
+		d.fs.vfsfs.VirtualFilesystem().DentryUncached()
 	}
 }
 
@@ -1727,6 +1813,44 @@ func (fs *filesystem) evictAllCachedDentriesLocked(ctx context.Context) {
 	}
 }
 
+// evictCachedDentriesLocked evicts cached dentries until at most limit
+// remain.
+//
+// Precondition: fs.renameMu must be locked for writing; it may be temporarily
+// unlocked.
+// +checklocks:fs.renameMu
+func (fs *filesystem) evictCachedDentriesLocked(ctx context.Context, limit uint64) {
+	for {
+		fs.dentryCache.mu.Lock()
+		done := fs.dentryCache.dentriesLen <= limit
+		fs.dentryCache.mu.Unlock()
+		if done {
+			return
+		}
+		fs.evictCachedDentryLocked(ctx)
+	}
+}
+
+// ReclaimCachedDentries implements vfs.DentryCacheReclaimer.ReclaimCachedDentries.
+//
+// If fs uses the global dentry cache, dentries of other gofer filesystems may
+// be evicted as well.
+func (fs *filesystem) ReclaimCachedDentries(ctx context.Context, n uint64) uint64 {
+	fs.renameMu.Lock()
+	defer fs.renameMu.Unlock()
+	var reclaimed uint64
+	for ; reclaimed < n; reclaimed++ {
+		fs.dentryCache.mu.Lock()
+		empty := fs.dentryCache.dentriesLen == 0
+		fs.dentryCache.mu.Unlock()
+		if empty {
+			break
+		}
+		fs.evictCachedDentryLocked(ctx)
+	}
+	return reclaimed
+}
+
 // Preconditions:
 //   - fs.renameMu must be locked for writing; it may be temporarily unlocked.
 //
@@ -1855,6 +1979,9 @@ func (d *dentry) destroyDisconnected(ctx context.Context) {
 		// Remove d from the set of syncable dentries.
 		d.fs.syncMu.Lock()
 		d.fs.syncableDentries.Remove(&d.syncableListEntry)
+		if d.fs.dentriesByIno[d.ino] == d {
+			delete(d.fs.dentriesByIno, d.ino)
+		}
 		d.fs.syncMu.Unlock()
 	}
 
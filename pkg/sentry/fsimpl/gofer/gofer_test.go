@@ -27,9 +27,10 @@ import (
 func TestDestroyIdempotent(t *testing.T) {
 	ctx := contexttest.Context(t)
 	fs := filesystem{
-		mf:       pgalloc.MemoryFileFromContext(ctx),
-		inoByKey: make(map[inoKey]uint64),
-		clock:    ktime.RealtimeClockFromContext(ctx),
+		mf:            pgalloc.MemoryFileFromContext(ctx),
+		inoByKey:      make(map[inoKey]uint64),
+		dentriesByIno: make(map[uint64]*dentry),
+		clock:         ktime.RealtimeClockFromContext(ctx),
 		// Test relies on no dentry being held in the cache.
 		dentryCache: &dentryCache{maxCachedDentries: 0},
 		client:      &lisafs.Client{},
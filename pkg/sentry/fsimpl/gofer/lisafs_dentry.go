@@ -168,7 +168,7 @@ func (fs *filesystem) newLisafsDentry(ctx context.Context, ino *lisafs.Inode) (*
 	}
 	d.dentry.init(d)
 	fs.syncMu.Lock()
-	fs.syncableDentries.PushBack(&d.syncableListEntry)
+	fs.addSyncableDentryLocked(&d.dentry)
 	fs.syncMu.Unlock()
 	return &d.dentry, nil
 }
@@ -178,10 +178,24 @@ func (d *lisafsDentry) openHandle(ctx context.Context, flags uint32) (handle, er
 	if err != nil {
 		return noHandle, err
 	}
-	return handle{
+	h := handle{
 		fdLisa: d.controlFD.Client().NewFD(openFD),
 		fd:     int32(hostFD),
-	}, nil
+	}
+	if h.fd < 0 && flags == linux.O_RDONLY && d.isRegularFile() {
+		if cc := d.fs.iopts.ContentCache; cc != nil && d.fs.opts.interop == InteropModeExclusive {
+			key := contentCacheKey{
+				inoKey: d.inoKey,
+				size:   d.size.Load(),
+				mtime:  d.mtime.Load(),
+				ctime:  d.ctime.Load(),
+			}
+			h.fd = cc.open(ctx, key, func(dst []byte, off uint64) (uint64, error) {
+				return h.fdLisa.Read(ctx, dst, off)
+			})
+		}
+	}
+	return h, nil
 }
 
 func (d *lisafsDentry) updateHandles(ctx context.Context, h handle, readable, writable bool) {
@@ -507,6 +521,36 @@ func (d *lisafsDentry) getDirentsLocked(ctx context.Context, recordDirent func(n
 	}
 }
 
+// getDirentsBatchLocked reads the batch of directory entries starting at
+// cursor using the Getdents64Cursor RPC, and calls recordDirent for each. It
+// returns the cursor at which the next batch starts, or false if the end of
+// the directory was reached.
+//
+// Preconditions:
+//   - d.handleMu must be locked.
+//   - d.fs.client.IsSupported(lisafs.Getdents64Cursor).
+func (d *lisafsDentry) getDirentsBatchLocked(ctx context.Context, cursor uint64, recordDirent func(name string, key inoKey, dType uint8)) (uint64, bool, error) {
+	dirents, err := d.readFDLisa.Getdents64Cursor(ctx, cursor, uint32(lisafsGetdentsCount))
+	if err != nil {
+		return cursor, false, err
+	}
+	if len(dirents) == 0 {
+		return cursor, false, nil
+	}
+	for i := range dirents {
+		name := string(dirents[i].Name)
+		if name == "." || name == ".." {
+			continue
+		}
+		recordDirent(name, inoKey{
+			ino:      uint64(dirents[i].Ino),
+			devMinor: uint32(dirents[i].DevMinor),
+			devMajor: uint32(dirents[i].DevMajor),
+		}, uint8(dirents[i].Type))
+	}
+	return uint64(dirents[len(dirents)-1].Off), true, nil
+}
+
 func flush(ctx context.Context, fd lisafs.ClientFD) error {
 	if fd.Ok() {
 		return fd.Flush(ctx)
@@ -20,6 +20,7 @@ import (
 	"math"
 
 	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/buffer"
 	"github.com/wilinz/gvisor/pkg/context"
 	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
 	"github.com/wilinz/gvisor/pkg/hostarch"
@@ -167,6 +168,49 @@ func (fd *regularFileFD) PRead(ctx context.Context, dst usermem.IOSequence, offs
 	return n, readErr
 }
 
+// PReadBuffer implements vfs.BufferReader.PReadBuffer.
+func (fd *regularFileFD) PReadBuffer(ctx context.Context, dst *buffer.Buffer, offset, count int64) (int64, error) {
+	if offset < 0 || count < 0 {
+		return 0, linuxerr.EINVAL
+	}
+	if fd.vfsfd.StatusFlags()&linux.O_DIRECT != 0 {
+		return 0, linuxerr.EOPNOTSUPP
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	d := fd.dentry()
+	rw := getDentryReadWriter(ctx, d, offset)
+	n, err := rw.appendToBuffer(dst, uint64(count))
+	putDentryReadWriter(rw)
+	if n > 0 {
+		// Compare Linux's mm/filemap.c:do_generic_file_read() => file_accessed().
+		d.touchAtime(fd.vfsfd.Mount())
+	}
+	return int64(n), err
+}
+
+// WithHostFDForRead implements vfs.HostFDReader.WithHostFDForRead.
+func (fd *regularFileFD) WithHostFDForRead(fn func(hostFD int32) (int64, error)) (int64, error) {
+	d := fd.dentry()
+	d.handleMu.RLock()
+	defer d.handleMu.RUnlock()
+	// Only donate the host FD when regular reads would use it too, so that
+	// we stay coherent with the page cache.
+	if !d.readsBypassCacheLocked() {
+		return 0, linuxerr.EOPNOTSUPP
+	}
+	h := d.readHandle()
+	if h.fd < 0 {
+		return 0, linuxerr.EOPNOTSUPP
+	}
+	n, err := fn(h.fd)
+	if n > 0 && d.fs.opts.interop != InteropModeShared {
+		d.touchAtime(fd.vfsfd.Mount())
+	}
+	return n, err
+}
+
 // Read implements vfs.FileDescriptionImpl.Read.
 func (fd *regularFileFD) Read(ctx context.Context, dst usermem.IOSequence, opts vfs.ReadOptions) (int64, error) {
 	fd.mu.Lock()
@@ -350,6 +394,17 @@ func putDentryReadWriter(rw *dentryReadWriter) {
 	dentryReadWriterPool.Put(rw)
 }
 
+// readsBypassCacheLocked returns true if reads from d must go directly to its
+// read handle rather than through the page cache: if d has a mmappable host
+// FD (which must be used to ensure coherence with memory-mapped I/O), or if
+// InteropModeShared is in effect (which prevents us from caching file
+// contents and makes dentry.size unreliable).
+//
+// Preconditions: d.handleMu must be locked.
+func (d *dentry) readsBypassCacheLocked() bool {
+	return (d.mmapFD.RacyLoad() >= 0 && !d.fs.opts.forcePageCache) || d.fs.opts.interop == InteropModeShared
+}
+
 // ReadToBlocks implements safemem.Reader.ReadToBlocks.
 func (rw *dentryReadWriter) ReadToBlocks(dsts safemem.BlockSeq) (uint64, error) {
 	if dsts.IsEmpty() {
@@ -364,7 +419,7 @@ func (rw *dentryReadWriter) ReadToBlocks(dsts safemem.BlockSeq) (uint64, error)
 	rw.d.handleMu.RLock()
 	defer rw.d.handleMu.RUnlock()
 	h := rw.d.readHandle()
-	if (rw.d.mmapFD.RacyLoad() >= 0 && !rw.d.fs.opts.forcePageCache) || rw.d.fs.opts.interop == InteropModeShared || rw.direct {
+	if rw.d.readsBypassCacheLocked() || rw.direct {
 		n, err := h.readToBlocksAt(rw.ctx, dsts, rw.off)
 		rw.off += n
 		return n, err
@@ -422,18 +477,7 @@ func (rw *dentryReadWriter) ReadToBlocks(dsts safemem.BlockSeq) (uint64, error)
 			if fillCache {
 				// Read into the cache, then re-enter the loop to read from the
 				// cache.
-				gapEnd, _ := hostarch.PageRoundUp(gapMR.End)
-				reqMR := memmap.MappableRange{
-					Start: hostarch.PageRoundDown(gapMR.Start),
-					End:   gapEnd,
-				}
-				optMR := gap.Range()
-				_, err := rw.d.cache.Fill(rw.ctx, reqMR, maxFillRange(reqMR, optMR), rw.d.size.Load(), mf, pgalloc.AllocOpts{
-					Kind:    usage.PageCache,
-					MemCgID: memCgID,
-					Mode:    pgalloc.AllocateAndWritePopulate,
-				}, h.readToBlocksAt)
-				mf.MarkEvictable(rw.d, pgalloc.EvictableRange{optMR.Start, optMR.End})
+				err := rw.fillCacheLocked(h, gap, gapMR, memCgID)
 				seg, gap = rw.d.cache.Find(rw.off)
 				if !seg.Ok() {
 					return done, err
@@ -462,6 +506,103 @@ func (rw *dentryReadWriter) ReadToBlocks(dsts safemem.BlockSeq) (uint64, error)
 	return done, nil
 }
 
+// fillCacheLocked reads the part of the file covered by gap, which must
+// include gapMR, into the cache.
+//
+// Preconditions: rw.d.dataMu must be locked for writing. rw.d.handleMu must be
+// locked.
+func (rw *dentryReadWriter) fillCacheLocked(h handle, gap fsutil.FileRangeGapIterator, gapMR memmap.MappableRange, memCgID uint32) error {
+	mf := rw.d.fs.mf
+	gapEnd, _ := hostarch.PageRoundUp(gapMR.End)
+	reqMR := memmap.MappableRange{
+		Start: hostarch.PageRoundDown(gapMR.Start),
+		End:   gapEnd,
+	}
+	optMR := gap.Range()
+	_, err := rw.d.cache.Fill(rw.ctx, reqMR, maxFillRange(reqMR, optMR), rw.d.size.Load(), mf, pgalloc.AllocOpts{
+		Kind:    usage.PageCache,
+		MemCgID: memCgID,
+		Mode:    pgalloc.AllocateAndWritePopulate,
+	}, h.readToBlocksAt)
+	mf.MarkEvictable(rw.d, pgalloc.EvictableRange{optMR.Start, optMR.End})
+	return err
+}
+
+// appendToBuffer appends up to count bytes of the file, starting at rw.off,
+// to dst. Data in the page cache is appended by reference rather than copied.
+//
+// appendToBuffer returns EOPNOTSUPP if reads from rw.d bypass the page cache.
+func (rw *dentryReadWriter) appendToBuffer(dst *buffer.Buffer, count uint64) (uint64, error) {
+	rw.d.handleMu.RLock()
+	defer rw.d.handleMu.RUnlock()
+	if rw.d.readsBypassCacheLocked() {
+		return 0, linuxerr.EOPNOTSUPP
+	}
+	h := rw.d.readHandle()
+
+	memCgID := pgalloc.MemoryCgroupIDFromContext(rw.ctx)
+	mf := rw.d.fs.mf
+	fillCache := mf.ShouldCacheEvictable()
+	var dataMuUnlock func()
+	if fillCache {
+		rw.d.dataMu.Lock()
+		dataMuUnlock = rw.d.dataMu.Unlock
+	} else {
+		rw.d.dataMu.RLock()
+		dataMuUnlock = rw.d.dataMu.RUnlock
+	}
+	defer dataMuUnlock()
+
+	// Compute the range to read (limited by file size and overflow-checked).
+	end := rw.d.size.Load()
+	if rw.off >= end {
+		return 0, nil
+	}
+	if rend := rw.off + count; rend > rw.off && rend < end {
+		end = rend
+	}
+
+	var done uint64
+	seg, gap := rw.d.cache.Find(rw.off)
+	for rw.off < end {
+		mr := memmap.MappableRange{rw.off, end}
+		switch {
+		case seg.Ok():
+			segMR := seg.Range().Intersect(mr)
+			if err := mf.AppendToBuffer(dst, seg.FileRangeOf(segMR)); err != nil {
+				return done, err
+			}
+			done += segMR.Length()
+			rw.off = segMR.End
+			seg, gap = seg.NextNonEmpty()
+
+		case gap.Ok():
+			gapMR := gap.Range().Intersect(mr)
+			if fillCache {
+				err := rw.fillCacheLocked(h, gap, gapMR, memCgID)
+				seg, gap = rw.d.cache.Find(rw.off)
+				if !seg.Ok() {
+					return done, err
+				}
+			} else {
+				// Read directly from the file into a new view.
+				v := buffer.NewViewSize(int(gapMR.Length()))
+				n, err := h.readToBlocksAt(rw.ctx, safemem.BlockSeqOf(safemem.BlockFromSafeSlice(v.AsSlice())), gapMR.Start)
+				v.CapLength(int(n))
+				dst.Append(v)
+				done += n
+				rw.off += n
+				// Partial reads are fine. But we must stop reading.
+				if n != gapMR.Length() || err != nil {
+					return done, err
+				}
+				seg, gap = gap.NextSegment(), fsutil.FileRangeGapIterator{}
+			}
+		}
+	}
+	return done, nil
+}
+
 // WriteFromBlocks implements safemem.Writer.WriteFromBlocks.
 //
 // Preconditions: rw.d.metadataMu must be locked.
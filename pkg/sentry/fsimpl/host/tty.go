@@ -85,6 +85,19 @@ func (t *TTYFileDescription) ThreadGroup() *kernel.ThreadGroup {
 	return t.tty.ThreadGroup()
 }
 
+// SetWinsize sets the window size of the host TTY and sends SIGWINCH to its
+// foreground process group. It is used to propagate resizes of the terminal
+// that runsc is attached to. Unlike TIOCSWINSZ, the signal is sent even if the
+// host TTY already has the given size, since the host terminal may have been
+// resized directly.
+func (t *TTYFileDescription) SetWinsize(ws *linux.Winsize) error {
+	if err := ioctlSetWinsize(t.inode.hostFD, ws); err != nil {
+		return err
+	}
+	t.tty.SignalForegroundProcessGroup(kernel.SignalInfoPriv(linux.SIGWINCH))
+	return nil
+}
+
 // PRead implements vfs.FileDescriptionImpl.PRead.
 //
 // Reading from a TTY is only allowed for foreground process groups. Background
@@ -278,8 +291,20 @@ func (t *TTYFileDescription) Ioctl(ctx context.Context, io usermem.IO, sysno uin
 		if _, err := winsize.CopyIn(task, args[2].Pointer()); err != nil {
 			return 0, err
 		}
-		err := ioctlSetWinsize(fd, &winsize)
-		return 0, err
+		old, err := ioctlGetWinsize(fd)
+		if err != nil {
+			return 0, err
+		}
+		if *old == winsize {
+			return 0, nil
+		}
+		if err := ioctlSetWinsize(fd, &winsize); err != nil {
+			return 0, err
+		}
+		// Notify the foreground process group of the change, like
+		// drivers/tty/tty_io.c:tty_do_resize().
+		t.tty.SignalForegroundProcessGroup(kernel.SignalInfoPriv(linux.SIGWINCH))
+		return 0, nil
 
 	// Unimplemented commands.
 	case linux.TIOCSETD,
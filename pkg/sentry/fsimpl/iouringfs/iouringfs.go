@@ -34,6 +34,7 @@ import (
 	"github.com/wilinz/gvisor/pkg/safemem"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel"
 	"github.com/wilinz/gvisor/pkg/sentry/memmap"
+	"github.com/wilinz/gvisor/pkg/sentry/mm"
 	"github.com/wilinz/gvisor/pkg/sentry/pgalloc"
 	"github.com/wilinz/gvisor/pkg/sentry/usage"
 	"github.com/wilinz/gvisor/pkg/sentry/vfs"
@@ -71,6 +72,19 @@ type FileDescription struct {
 	// remap indicates whether the shared buffers need to be remapped
 	// due to a S/R. Protected by ProcessSubmissions critical section.
 	remap bool
+
+	// bufs are the buffers registered with IORING_REGISTER_BUFFERS, or nil if
+	// there are none. bufsMM is the MemoryManager they were pinned from and
+	// bufsPinned is the number of bytes charged to it. Protected by the
+	// critical section entered by lock.
+	bufs       []registeredBuffer
+	bufsMM     *mm.MemoryManager
+	bufsPinned uint64
+
+	// files are the files registered with IORING_REGISTER_FILES, or nil if
+	// there are none. Empty slots are nil. A reference is held on every file.
+	// Protected by the critical section entered by lock.
+	files []*vfs.FileDescription
 }
 
 var _ vfs.FileDescriptionImpl = (*FileDescription)(nil)
@@ -214,6 +228,9 @@ func New(ctx context.Context, vfsObj *vfs.VirtualFilesystem, entries uint32, par
 
 // Release implements vfs.FileDescriptionImpl.Release.
 func (fd *FileDescription) Release(ctx context.Context) {
+	fd.unregisterBuffersLocked()
+	decRefFiles(ctx, fd.files)
+	fd.files = nil
 	fd.mf.DecRef(fd.rbmf.fr)
 	fd.mf.DecRef(fd.sqemf.fr)
 }
@@ -265,17 +282,17 @@ func (fd *FileDescription) ConfigureMMap(ctx context.Context, opts *memmap.MMapO
 	return vfs.GenericConfigureMMap(&fd.vfsfd, mf, opts)
 }
 
-// ProcessSubmissions processes the submission queue. Concurrent calls to
-// ProcessSubmissions serialize, yielding task goroutines with Task.Block since
-// processing can take a long time.
-func (fd *FileDescription) ProcessSubmissions(t *kernel.Task, toSubmit uint32, minComplete uint32, flags uint32) (int, error) {
+// lock enters the critical section serializing concurrent callers of
+// ProcessSubmissions and io_uring_register(2), yielding task goroutines with
+// Task.Block since processing can take a long time.
+func (fd *FileDescription) lock(t *kernel.Task) {
 	// We use a combination of fd.running and fd.runC to serialize concurrent
-	// callers to ProcessSubmissions. runC has a capacity of 1. The protocol
+	// callers to the critical section. runC has a capacity of 1. The protocol
 	// works as follows:
 	//
 	// * Becoming the active task
 	//
-	// On entry to ProcessSubmissions, we try to transition running from 0 to
+	// On entry to the critical section, we try to transition running from 0 to
 	// 1. If there is already an active task, this will fail and we'll go to
 	// sleep with Task.Block(). If we succeed, we're the active task.
 	//
@@ -284,9 +301,9 @@ func (fd *FileDescription) ProcessSubmissions(t *kernel.Task, toSubmit uint32, m
 	// If we had to sleep, on wakeup we try to transition running to 1 again as
 	// we could still be racing with other tasks. Note that if multiple tasks
 	// are sleeping, only one will wake up since only one will successfully
-	// receive from runC. However we could still race with a new caller of
-	// ProcessSubmissions that hasn't gone to sleep yet. Only one waiting task
-	// will succeed and become the active task, the rest will go to sleep.
+	// receive from runC. However we could still race with a new caller of lock
+	// that hasn't gone to sleep yet. Only one waiting task will succeed and
+	// become the active task, the rest will go to sleep.
 	//
 	// runC needs to be buffered to avoid a race between checking running and
 	// going back to sleep. With an unbuffered channel, we could miss a wakeup
@@ -319,16 +336,25 @@ func (fd *FileDescription) ProcessSubmissions(t *kernel.Task, toSubmit uint32, m
 		t.Block(fd.runC)
 	}
 	// We successfully set fd.running, so we're the active task now.
-	defer func() {
-		// Unblock any potentially waiting tasks.
-		if !fd.running.CompareAndSwap(1, 0) {
-			panic(fmt.Sprintf("iouringfs.FileDescription.ProcessSubmissions: active task encountered invalid fd.running state %v", fd.running.Load()))
-		}
-		select {
-		case fd.runC <- struct{}{}:
-		default:
-		}
-	}()
+}
+
+// unlock leaves the critical section entered by lock, waking up any waiting
+// tasks.
+func (fd *FileDescription) unlock() {
+	if !fd.running.CompareAndSwap(1, 0) {
+		panic(fmt.Sprintf("iouringfs.FileDescription.unlock: active task encountered invalid fd.running state %v", fd.running.Load()))
+	}
+	select {
+	case fd.runC <- struct{}{}:
+	default:
+	}
+}
+
+// ProcessSubmissions processes the submission queue. Concurrent calls to
+// ProcessSubmissions serialize, see FileDescription.lock.
+func (fd *FileDescription) ProcessSubmissions(t *kernel.Task, toSubmit uint32, minComplete uint32, flags uint32) (int, error) {
+	fd.lock(t)
+	defer fd.unlock()
 
 	// The rest of this function is a critical section with respect to
 	// concurrent callers.
@@ -463,6 +489,13 @@ func (fd *FileDescription) ProcessSubmission(t *kernel.Task, sqe *linux.IOUringS
 			// reads aren't failures.
 			cqeErr = nil
 		}
+	case linux.IORING_OP_READ_FIXED:
+		retValue, cqeErr = fd.handleRWFixed(t, sqe, false /* write */)
+		if cqeErr == io.EOF {
+			cqeErr = nil
+		}
+	case linux.IORING_OP_WRITE_FIXED:
+		retValue, cqeErr = fd.handleRWFixed(t, sqe, true /* write */)
 	default: // Unsupported operation
 		retValue = -int32(linuxerr.EINVAL.Errno())
 	}
@@ -480,12 +513,9 @@ func (fd *FileDescription) ProcessSubmission(t *kernel.Task, sqe *linux.IOUringS
 
 // handleReadv handles IORING_OP_READV.
 func (fd *FileDescription) handleReadv(t *kernel.Task, sqe *linux.IOUringSqe, flags uint32) (int32, error) {
-	// Check that a file descriptor is valid.
-	if sqe.Fd < 0 {
-		return 0, linuxerr.EBADF
-	}
-	// Currently we don't support any flags for the SQEs.
-	if sqe.Flags != 0 {
+	// Currently we don't support any flags for the SQEs other than
+	// IOSQE_FIXED_FILE.
+	if sqe.Flags&^linux.IOSQE_FIXED_FILE != 0 {
 		return 0, linuxerr.EINVAL
 	}
 	// If the file is not seekable then offset must be zero. And currently, we don't support them.
@@ -505,9 +535,9 @@ func (fd *FileDescription) handleReadv(t *kernel.Task, sqe *linux.IOUringSqe, fl
 	if err != nil {
 		return 0, err
 	}
-	file := t.GetFile(sqe.Fd)
-	if file == nil {
-		return 0, linuxerr.EBADF
+	file, err := fd.getFile(t, sqe)
+	if err != nil {
+		return 0, err
 	}
 	defer file.DecRef(t)
 	n, err := file.PRead(t, dst, 0, vfs.ReadOptions{})
@@ -15,12 +15,17 @@
 package iouringfs
 
 import (
+	"bytes"
 	"fmt"
 	"math"
 	"strings"
 	"testing"
 
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
 	"github.com/wilinz/gvisor/pkg/hostarch"
+	"github.com/wilinz/gvisor/pkg/safemem"
+	"github.com/wilinz/gvisor/pkg/usermem"
 )
 
 func TestRoundUpPowerOfTwo(t *testing.T) {
@@ -141,3 +146,39 @@ func TestUint32PtrAtOffsetInvalidOffsets(t *testing.T) {
 		})
 	}
 }
+
+func TestBlockSeqIO(t *testing.T) {
+	// Split the buffer across two blocks, like a registered buffer backed by
+	// discontiguous pages.
+	first := make([]byte, 8)
+	second := make([]byte, 8)
+	io := &blockSeqIO{safemem.BlockSeqFromSlice([]safemem.Block{
+		safemem.BlockFromSafeSlice(first),
+		safemem.BlockFromSafeSlice(second),
+	})}
+	ctx := context.Background()
+
+	src := []byte("DEADBEEF")
+	if n, err := io.CopyOut(ctx, 4, src, usermem.IOOpts{}); n != len(src) || err != nil {
+		t.Fatalf("CopyOut: got (%d, %v), want (%d, nil)", n, err, len(src))
+	}
+	if got, want := string(first[4:])+string(second[:4]), "DEADBEEF"; got != want {
+		t.Errorf("Got blocks containing %q, want %q", got, want)
+	}
+
+	dst := make([]byte, len(src))
+	if n, err := io.CopyIn(ctx, 4, dst, usermem.IOOpts{}); n != len(dst) || err != nil {
+		t.Fatalf("CopyIn: got (%d, %v), want (%d, nil)", n, err, len(dst))
+	}
+	if !bytes.Equal(dst, src) {
+		t.Errorf("CopyIn: got %q, want %q", dst, src)
+	}
+
+	// Accesses beyond the end of the blocks are truncated.
+	if n, err := io.CopyIn(ctx, 12, dst, usermem.IOOpts{}); n != 4 || !linuxerr.Equals(linuxerr.EFAULT, err) {
+		t.Errorf("CopyIn beyond end: got (%d, %v), want (4, EFAULT)", n, err)
+	}
+	if n, err := io.CopyOut(ctx, 16, src, usermem.IOOpts{}); n != 0 || !linuxerr.Equals(linuxerr.EFAULT, err) {
+		t.Errorf("CopyOut at end: got (%d, %v), want (0, EFAULT)", n, err)
+	}
+}
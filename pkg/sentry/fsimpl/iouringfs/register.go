@@ -0,0 +1,482 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iouringfs
+
+import (
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/hostarch"
+	"github.com/wilinz/gvisor/pkg/marshal/primitive"
+	"github.com/wilinz/gvisor/pkg/safemem"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+	"github.com/wilinz/gvisor/pkg/sentry/limits"
+	"github.com/wilinz/gvisor/pkg/sentry/mm"
+	"github.com/wilinz/gvisor/pkg/sentry/vfs"
+	"github.com/wilinz/gvisor/pkg/usermem"
+)
+
+// iovecSize is the size of struct iovec on 64-bit architectures.
+const iovecSize = 16
+
+// registeredBuffer is a buffer registered with IORING_REGISTER_BUFFERS. The
+// pages containing the buffer are pinned when it is registered, so fixed
+// operations on it don't need to validate or translate application addresses.
+// Like Linux, the pinned pages remain in use by the buffer even if the
+// application unmaps or remaps them.
+//
+// +stateify savable
+type registeredBuffer struct {
+	// ar is the registered range of application addresses.
+	ar hostarch.AddrRange
+
+	// prs pins the pages containing ar. prs is not saved, the buffer is
+	// pinned again on first use after restore.
+	prs []mm.PinnedRange `state:"nosave"`
+
+	// bs maps prs. The first byte of bs corresponds to ar.Start rounded down
+	// to a page boundary.
+	bs safemem.BlockSeq `state:"nosave"`
+}
+
+// pinnedLength returns the number of bytes pinned by the buffer, which is the
+// length of its address range rounded out to page boundaries.
+func (b *registeredBuffer) pinnedLength() uint64 {
+	end, _ := b.ar.End.RoundUp()
+	return uint64(end - b.ar.Start.RoundDown())
+}
+
+// pin pins and maps the pages containing b.ar in m.
+func (b *registeredBuffer) pin(ctx context.Context, m *mm.MemoryManager) error {
+	end, _ := b.ar.End.RoundUp()
+	prs, err := m.Pin(ctx, hostarch.AddrRange{b.ar.Start.RoundDown(), end}, hostarch.ReadWrite, false /* ignorePermissions */)
+	if err != nil {
+		mm.Unpin(prs)
+		return err
+	}
+	var blocks []safemem.Block
+	for _, pr := range prs {
+		ims, err := pr.File.MapInternal(pr.FileRange(), hostarch.ReadWrite)
+		if err != nil {
+			mm.Unpin(prs)
+			return err
+		}
+		for !ims.IsEmpty() {
+			blocks = append(blocks, ims.Head())
+			ims = ims.Tail()
+		}
+	}
+	b.prs = prs
+	b.bs = safemem.BlockSeqFromSlice(blocks)
+	return nil
+}
+
+// unpin releases the pages pinned by pin.
+func (b *registeredBuffer) unpin() {
+	mm.Unpin(b.prs)
+	b.prs = nil
+	b.bs = safemem.BlockSeq{}
+}
+
+// validateBuffer checks a buffer passed to IORING_REGISTER_BUFFERS. See
+// io_uring/rsrc.c:io_buffer_validate().
+func validateBuffer(ar hostarch.AddrRange) error {
+	if ar.Length() == 0 || ar.Length() > linux.IORING_MAX_REG_BUFFER_SIZE {
+		return linuxerr.EFAULT
+	}
+	if _, ok := ar.End.RoundUp(); !ok {
+		return linuxerr.EOVERFLOW
+	}
+	return nil
+}
+
+// RegisterBuffers implements io_uring_register(2) IORING_REGISTER_BUFFERS.
+// The nr buffers described by the array of struct iovec at addr are pinned and
+// charged to the caller's RLIMIT_MEMLOCK.
+func (fd *FileDescription) RegisterBuffers(t *kernel.Task, addr hostarch.Addr, nr uint32) error {
+	if nr == 0 || nr > linux.IORING_MAX_REG_BUFFERS {
+		return linuxerr.EINVAL
+	}
+
+	fd.lock(t)
+	defer fd.unlock()
+
+	if fd.bufs != nil {
+		return linuxerr.EBUSY
+	}
+
+	// Copy in and validate every buffer before pinning any memory, so that
+	// nothing needs to be undone for invalid arguments.
+	bufs := make([]registeredBuffer, nr)
+	var pinned uint64
+	for i := range bufs {
+		// Copy in the iovecs one at a time, since each buffer may be as large
+		// as IORING_MAX_REG_BUFFER_SIZE and copying in all of them at once
+		// would truncate their combined length to MAX_RW_COUNT.
+		ars, err := t.CopyInIovecsAsSlice(addr+hostarch.Addr(i*iovecSize), 1)
+		if err != nil {
+			return err
+		}
+		if err := validateBuffer(ars[0]); err != nil {
+			return err
+		}
+		bufs[i].ar = ars[0]
+		pinned += bufs[i].pinnedLength()
+	}
+
+	m := t.MemoryManager()
+	if err := m.AccountPinned(t, pinned); err != nil {
+		return err
+	}
+	for i := range bufs {
+		if err := bufs[i].pin(t, m); err != nil {
+			for j := 0; j < i; j++ {
+				bufs[j].unpin()
+			}
+			m.UnaccountPinned(pinned)
+			return err
+		}
+	}
+	fd.bufs = bufs
+	fd.bufsMM = m
+	fd.bufsPinned = pinned
+	return nil
+}
+
+// UnregisterBuffers implements io_uring_register(2)
+// IORING_UNREGISTER_BUFFERS.
+func (fd *FileDescription) UnregisterBuffers(t *kernel.Task) error {
+	fd.lock(t)
+	defer fd.unlock()
+
+	if fd.bufs == nil {
+		return linuxerr.ENXIO
+	}
+	fd.unregisterBuffersLocked()
+	return nil
+}
+
+// unregisterBuffersLocked unpins all registered buffers and releases the
+// memory charged for them.
+//
+// Preconditions: The caller must be in the critical section entered by lock,
+// or have the only reference on fd.
+func (fd *FileDescription) unregisterBuffersLocked() {
+	for i := range fd.bufs {
+		fd.bufs[i].unpin()
+	}
+	if fd.bufsMM != nil {
+		fd.bufsMM.UnaccountPinned(fd.bufsPinned)
+	}
+	fd.bufs = nil
+	fd.bufsMM = nil
+	fd.bufsPinned = 0
+}
+
+// RegisterFiles implements io_uring_register(2) IORING_REGISTER_FILES. The nr
+// file descriptors in the int32 array at addr are added to the ring's file
+// set, in which they can be referred to by index by SQEs with
+// IOSQE_FIXED_FILE. A file descriptor of -1 leaves its slot empty.
+func (fd *FileDescription) RegisterFiles(t *kernel.Task, addr hostarch.Addr, nr uint32) error {
+	if nr == 0 {
+		return linuxerr.EINVAL
+	}
+	if nr > linux.IORING_MAX_FIXED_FILES {
+		return linuxerr.EMFILE
+	}
+	if uint64(nr) > limits.FromContext(t).Get(limits.NumberOfFiles).Cur {
+		return linuxerr.EMFILE
+	}
+
+	fd.lock(t)
+	defer fd.unlock()
+
+	if fd.files != nil {
+		return linuxerr.EBUSY
+	}
+
+	fds := make([]int32, nr)
+	if _, err := primitive.CopyInt32SliceIn(t, addr, fds); err != nil {
+		return err
+	}
+	files := make([]*vfs.FileDescription, nr)
+	for i, fdNum := range fds {
+		if fdNum == -1 {
+			continue
+		}
+		file := t.GetFile(fdNum)
+		if file == nil {
+			decRefFiles(t, files[:i])
+			return linuxerr.EBADF
+		}
+		// Like Linux, don't allow io_uring file descriptors in the file set,
+		// which would create reference cycles.
+		if _, ok := file.Impl().(*FileDescription); ok {
+			file.DecRef(t)
+			decRefFiles(t, files[:i])
+			return linuxerr.EBADF
+		}
+		files[i] = file
+	}
+	fd.files = files
+	return nil
+}
+
+// UnregisterFiles implements io_uring_register(2) IORING_UNREGISTER_FILES.
+func (fd *FileDescription) UnregisterFiles(t *kernel.Task) error {
+	fd.lock(t)
+	defer fd.unlock()
+
+	if fd.files == nil {
+		return linuxerr.ENXIO
+	}
+	decRefFiles(t, fd.files)
+	fd.files = nil
+	return nil
+}
+
+// decRefFiles drops the references held on files. Empty slots are skipped.
+func decRefFiles(ctx context.Context, files []*vfs.FileDescription) {
+	for _, file := range files {
+		if file != nil {
+			file.DecRef(ctx)
+		}
+	}
+}
+
+// getFile returns the file referred to by sqe, with a reference that the
+// caller must release. If sqe has IOSQE_FIXED_FILE set, sqe.Fd is an index
+// into the ring's registered file set.
+//
+// Preconditions: The caller must be in the critical section entered by lock.
+func (fd *FileDescription) getFile(t *kernel.Task, sqe *linux.IOUringSqe) (*vfs.FileDescription, error) {
+	if sqe.Fd < 0 {
+		return nil, linuxerr.EBADF
+	}
+	if sqe.Flags&linux.IOSQE_FIXED_FILE == 0 {
+		file := t.GetFile(sqe.Fd)
+		if file == nil {
+			return nil, linuxerr.EBADF
+		}
+		return file, nil
+	}
+	if int(sqe.Fd) >= len(fd.files) || fd.files[sqe.Fd] == nil {
+		return nil, linuxerr.EBADF
+	}
+	file := fd.files[sqe.Fd]
+	file.IncRef()
+	return file, nil
+}
+
+// fixedBufferIOSequence returns an IOSequence for the length bytes at addr in
+// the registered buffer with index bufIndex, which must contain them.
+//
+// Preconditions: The caller must be in the critical section entered by lock.
+func (fd *FileDescription) fixedBufferIOSequence(t *kernel.Task, bufIndex uint16, addr hostarch.Addr, length uint32) (usermem.IOSequence, error) {
+	if int(bufIndex) >= len(fd.bufs) {
+		return usermem.IOSequence{}, linuxerr.EFAULT
+	}
+	buf := &fd.bufs[bufIndex]
+	end, ok := addr.AddLength(uint64(length))
+	if !ok || addr < buf.ar.Start || end > buf.ar.End {
+		return usermem.IOSequence{}, linuxerr.EFAULT
+	}
+	if buf.prs == nil {
+		// The buffer hasn't been used since restore.
+		if err := buf.pin(t, fd.bufsMM); err != nil {
+			return usermem.IOSequence{}, linuxerr.EFAULT
+		}
+	}
+	start := uint64(addr - buf.ar.Start.RoundDown())
+	return usermem.IOSequence{
+		IO:    &blockSeqIO{buf.bs},
+		Addrs: hostarch.AddrRangeSeqOf(hostarch.AddrRange{hostarch.Addr(start), hostarch.Addr(start + uint64(length))}),
+	}, nil
+}
+
+// handleRWFixed handles IORING_OP_READ_FIXED and IORING_OP_WRITE_FIXED.
+//
+// Preconditions: The caller must be in the critical section entered by lock.
+func (fd *FileDescription) handleRWFixed(t *kernel.Task, sqe *linux.IOUringSqe, write bool) (int32, error) {
+	if sqe.Flags&^linux.IOSQE_FIXED_FILE != 0 {
+		return 0, linuxerr.EINVAL
+	}
+	if sqe.IoPrio != 0 {
+		return 0, linuxerr.EINVAL
+	}
+	file, err := fd.getFile(t, sqe)
+	if err != nil {
+		return 0, err
+	}
+	defer file.DecRef(t)
+	seq, err := fd.fixedBufferIOSequence(t, sqe.BufIndexOrGroup, hostarch.Addr(sqe.AddrOrSpliceOff), sqe.Len)
+	if err != nil {
+		return 0, err
+	}
+
+	// An offset of -1 means the file's current position. See
+	// io_uring/rw.c:io_kiocb_update_pos().
+	offset := int64(sqe.OffOrAddrOrCmdOp)
+	var n int64
+	switch {
+	case write && offset == -1:
+		n, err = file.Write(t, seq, vfs.WriteOptions{})
+	case write:
+		n, err = file.PWrite(t, seq, offset, vfs.WriteOptions{})
+	case offset == -1:
+		n, err = file.Read(t, seq, vfs.ReadOptions{})
+	default:
+		n, err = file.PRead(t, seq, offset, vfs.ReadOptions{})
+	}
+	if n > 0 {
+		// Like read(2) and write(2), report partial transfers.
+		return int32(n), nil
+	}
+	return int32(n), err
+}
+
+// blockSeqIO implements usermem.IO for a safemem.BlockSeq, such as the
+// mapping of a registered buffer. Addresses are interpreted as offsets into
+// the BlockSeq. Accesses beyond its end return EFAULT.
+type blockSeqIO struct {
+	bs safemem.BlockSeq
+}
+
+// blocks returns the blocks of b.bs in ar, and EFAULT if ar extends beyond
+// the end of b.bs.
+func (b *blockSeqIO) blocks(ar hostarch.AddrRange) (safemem.BlockSeq, error) {
+	if uint64(ar.Start) >= b.bs.NumBytes() {
+		return safemem.BlockSeq{}, linuxerr.EFAULT
+	}
+	bs := b.bs.DropFirst64(uint64(ar.Start)).TakeFirst64(uint64(ar.Length()))
+	if bs.NumBytes() < uint64(ar.Length()) {
+		return bs, linuxerr.EFAULT
+	}
+	return bs, nil
+}
+
+// CopyOut implements usermem.IO.CopyOut.
+func (b *blockSeqIO) CopyOut(ctx context.Context, addr hostarch.Addr, src []byte, opts usermem.IOOpts) (int, error) {
+	dsts, rngErr := b.blocks(hostarch.AddrRange{addr, addr + hostarch.Addr(len(src))})
+	n, err := safemem.CopySeq(dsts, safemem.BlockSeqOf(safemem.BlockFromSafeSlice(src)))
+	if err != nil {
+		return int(n), err
+	}
+	return int(n), rngErr
+}
+
+// CopyIn implements usermem.IO.CopyIn.
+func (b *blockSeqIO) CopyIn(ctx context.Context, addr hostarch.Addr, dst []byte, opts usermem.IOOpts) (int, error) {
+	dsts := safemem.BlockSeqOf(safemem.BlockFromSafeSlice(dst))
+	srcs, rngErr := b.blocks(hostarch.AddrRange{addr, addr + hostarch.Addr(len(dst))})
+	n, err := safemem.CopySeq(dsts, srcs)
+	if err != nil {
+		return int(n), err
+	}
+	return int(n), rngErr
+}
+
+// ZeroOut implements usermem.IO.ZeroOut.
+func (b *blockSeqIO) ZeroOut(ctx context.Context, addr hostarch.Addr, toZero int64, opts usermem.IOOpts) (int64, error) {
+	dsts, rngErr := b.blocks(hostarch.AddrRange{addr, addr + hostarch.Addr(toZero)})
+	n, err := safemem.ZeroSeq(dsts)
+	if err != nil {
+		return int64(n), err
+	}
+	return int64(n), rngErr
+}
+
+// CopyOutFrom implements usermem.IO.CopyOutFrom.
+func (b *blockSeqIO) CopyOutFrom(ctx context.Context, ars hostarch.AddrRangeSeq, src safemem.Reader, opts usermem.IOOpts) (int64, error) {
+	var done int64
+	for !ars.IsEmpty() {
+		dsts, rngErr := b.blocks(ars.Head())
+		n, err := src.ReadToBlocks(dsts)
+		done += int64(n)
+		if err != nil {
+			return done, err
+		}
+		if rngErr != nil {
+			return done, rngErr
+		}
+		if n < uint64(ars.Head().Length()) {
+			break
+		}
+		ars = ars.Tail()
+	}
+	return done, nil
+}
+
+// CopyInTo implements usermem.IO.CopyInTo.
+func (b *blockSeqIO) CopyInTo(ctx context.Context, ars hostarch.AddrRangeSeq, dst safemem.Writer, opts usermem.IOOpts) (int64, error) {
+	var done int64
+	for !ars.IsEmpty() {
+		srcs, rngErr := b.blocks(ars.Head())
+		n, err := dst.WriteFromBlocks(srcs)
+		done += int64(n)
+		if err != nil {
+			return done, err
+		}
+		if rngErr != nil {
+			return done, rngErr
+		}
+		if n < uint64(ars.Head().Length()) {
+			break
+		}
+		ars = ars.Tail()
+	}
+	return done, nil
+}
+
+// uint32Block returns the block containing the 4 bytes at addr.
+func (b *blockSeqIO) uint32Block(addr hostarch.Addr) (safemem.Block, error) {
+	bs, err := b.blocks(hostarch.AddrRange{addr, addr + 4})
+	if err != nil {
+		return safemem.Block{}, err
+	}
+	if bs.NumBlocks() != 1 {
+		// The bytes are split across blocks, which can only happen if addr
+		// is misaligned.
+		return safemem.Block{}, linuxerr.EINVAL
+	}
+	return bs.Head(), nil
+}
+
+// SwapUint32 implements usermem.IO.SwapUint32.
+func (b *blockSeqIO) SwapUint32(ctx context.Context, addr hostarch.Addr, new uint32, opts usermem.IOOpts) (uint32, error) {
+	block, err := b.uint32Block(addr)
+	if err != nil {
+		return 0, err
+	}
+	return safemem.SwapUint32(block, new)
+}
+
+// CompareAndSwapUint32 implements usermem.IO.CompareAndSwapUint32.
+func (b *blockSeqIO) CompareAndSwapUint32(ctx context.Context, addr hostarch.Addr, old, new uint32, opts usermem.IOOpts) (uint32, error) {
+	block, err := b.uint32Block(addr)
+	if err != nil {
+		return 0, err
+	}
+	return safemem.CompareAndSwapUint32(block, old, new)
+}
+
+// LoadUint32 implements usermem.IO.LoadUint32.
+func (b *blockSeqIO) LoadUint32(ctx context.Context, addr hostarch.Addr, opts usermem.IOOpts) (uint32, error) {
+	block, err := b.uint32Block(addr)
+	if err != nil {
+		return 0, err
+	}
+	return safemem.LoadUint32(block)
+}
@@ -298,11 +298,27 @@ func (fs *Filesystem) Release(ctx context.Context) {
 	for fs.cachedDentriesLen != 0 {
 		fs.evictCachedDentryLocked(ctx)
 	}
+	if fs.dentryCacheAdded {
+		fs.vfsfs.VirtualFilesystem().RemoveDentryCache(fs.MaxCachedDentries)
+		fs.dentryCacheAdded = false
+	}
 	fs.mu.Unlock()
 	// Drop ref acquired in Dentry.InitRoot().
 	root.DecRef(ctx)
 }
 
+// ReclaimCachedDentries implements vfs.DentryCacheReclaimer.ReclaimCachedDentries.
+func (fs *Filesystem) ReclaimCachedDentries(ctx context.Context, n uint64) uint64 {
+	fs.mu.Lock()
+	defer fs.processDeferredDecRefs(ctx)
+	defer fs.mu.Unlock()
+	var reclaimed uint64
+	for ; reclaimed < n && fs.cachedDentriesLen != 0; reclaimed++ {
+		fs.evictCachedDentryLocked(ctx)
+	}
+	return reclaimed
+}
+
 // releaseKeptDentriesLocked recursively drops all dentry references created by
 // Lookup when Dentry.inode.Keep() is true.
 //
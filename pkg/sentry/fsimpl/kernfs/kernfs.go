@@ -130,6 +130,11 @@ type Filesystem struct {
 	// defaults to 0 and kernfs does not cache any dentries. This is immutable.
 	MaxCachedDentries uint64
 
+	// dentryCacheAdded is true if MaxCachedDentries has been registered with
+	// vfs.VirtualFilesystem.AddDentryCache. dentryCacheAdded is protected by
+	// mu.
+	dentryCacheAdded bool
+
 	// root is the root dentry of this filesystem. Note that root may be nil for
 	// filesystems on a disconnected mount without a root (e.g. pipefs, sockfs,
 	// hostfs). Filesystem holds an extra reference on root to prevent it from
@@ -357,11 +362,7 @@ func (d *Dentry) cacheLocked(ctx context.Context) {
 		return
 	}
 	if refs > 0 {
-		if d.cached {
-			d.fs.cachedDentries.Remove(d)
-			d.fs.cachedDentriesLen--
-			d.cached = false
-		}
+		d.removeFromCacheLocked()
 		return
 	}
 	// If the dentry is deleted and invalidated or has no parent, then it is no
@@ -376,11 +377,7 @@ func (d *Dentry) cacheLocked(ctx context.Context) {
 				d.fs.deferDecRef(rc)
 			}
 		}
-		if d.cached {
-			d.fs.cachedDentries.Remove(d)
-			d.fs.cachedDentriesLen--
-			d.cached = false
-		}
+		d.removeFromCacheLocked()
 		if d.isDeleted() {
 			d.inode.Watches().HandleDeletion(ctx)
 		}
@@ -402,15 +399,36 @@ func (d *Dentry) cacheLocked(ctx context.Context) {
 	}
 	// Cache the dentry, then evict the least recently used cached dentry if
 	// the cache becomes over-full.
+	vfsObj := d.fs.vfsfs.VirtualFilesystem()
+	if !d.fs.dentryCacheAdded {
+		vfsObj.AddDentryCache(d.fs.MaxCachedDentries)
+		d.fs.dentryCacheAdded = true
+	}
 	d.fs.cachedDentries.PushFront(d)
 	d.fs.cachedDentriesLen++
 	d.cached = true
-	if d.fs.cachedDentriesLen <= d.fs.MaxCachedDentries {
-		return
+	vfsObj.DentryCached()
+	// The limit may have been lowered since the last insertion, if other
+	// filesystems registered their caches.
+	limit := vfsObj.DentryCacheLimit(d.fs.MaxCachedDentries)
+	for d.fs.cachedDentriesLen > limit {
+		// Whether or not victim is destroyed, it is removed from
+		// fs.cachedDentries, so this terminates.
+		d.fs.evictCachedDentryLocked(ctx)
+	}
+}
+
+// removeFromCacheLocked removes d from d.fs.cachedDentries if it is cached.
+//
+// Preconditions:
+//   - d.fs.mu must be locked for writing.
+func (d *Dentry) removeFromCacheLocked() {
+	if d.cached {
+		d.fs.cachedDentries.Remove(d)
+		d.fs.cachedDentriesLen--
+		d.cached = false
+		d.fs.vfsfs.VirtualFilesystem().DentryUncached()
 	}
-	d.fs.evictCachedDentryLocked(ctx)
-	// Whether or not victim was destroyed, we brought fs.cachedDentriesLen
-	// back down to fs.opts.maxCachedDentries, so we don't loop.
 }
 
 // Preconditions:
@@ -427,11 +445,7 @@ func (d *Dentry) evictLocked(ctx context.Context) {
 	if d == nil {
 		return
 	}
-	if d.cached {
-		d.fs.cachedDentries.Remove(d)
-		d.fs.cachedDentriesLen--
-		d.cached = false
-	}
+	d.removeFromCacheLocked()
 	// victim.refs may have become non-zero from an earlier path resolution
 	// after it was inserted into fs.cachedDentries.
 	if d.refs.Load() == 0 {
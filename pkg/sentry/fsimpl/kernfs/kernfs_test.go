@@ -44,13 +44,19 @@ type RootDentryFn func(context.Context, *auth.Credentials, *filesystem) kernfs.I
 // filesystem by providing an appropriate rootFn, which should return a
 // pre-populated root dentry.
 func newTestSystem(t *testing.T, rootFn RootDentryFn) *testutil.System {
+	return newTestSystemWithCache(t, 0, rootFn)
+}
+
+// newTestSystemWithCache is like newTestSystem, but the test filesystem caches
+// up to maxCachedDentries unreferenced dentries.
+func newTestSystemWithCache(t *testing.T, maxCachedDentries uint64, rootFn RootDentryFn) *testutil.System {
 	ctx := contexttest.Context(t)
 	creds := auth.CredentialsFromContext(ctx)
 	v := &vfs.VirtualFilesystem{}
 	if err := v.Init(ctx); err != nil {
 		t.Fatalf("VFS init: %v", err)
 	}
-	v.MustRegisterFilesystemType("testfs", &fsType{rootFn: rootFn}, &vfs.RegisterFilesystemTypeOptions{
+	v.MustRegisterFilesystemType("testfs", &fsType{rootFn: rootFn, maxCachedDentries: maxCachedDentries}, &vfs.RegisterFilesystemTypeOptions{
 		AllowUserMount: true,
 	})
 	mns, err := v.NewMountNamespace(ctx, creds, "", "testfs", &vfs.MountOptions{}, nil)
@@ -61,7 +67,8 @@ func newTestSystem(t *testing.T, rootFn RootDentryFn) *testutil.System {
 }
 
 type fsType struct {
-	rootFn RootDentryFn
+	rootFn            RootDentryFn
+	maxCachedDentries uint64
 }
 
 type filesystem struct {
@@ -222,6 +229,7 @@ func (fsType) Release(ctx context.Context) {}
 
 func (fst fsType) GetFilesystem(ctx context.Context, vfsObj *vfs.VirtualFilesystem, creds *auth.Credentials, source string, opt vfs.GetFilesystemOptions) (*vfs.Filesystem, *vfs.Dentry, error) {
 	fs := &filesystem{}
+	fs.MaxCachedDentries = fst.maxCachedDentries
 	fs.VFSFilesystem().Init(vfsObj, &fst, fs)
 	root := fst.rootFn(ctx, creds, fs)
 	var d kernfs.Dentry
@@ -413,3 +421,104 @@ func TestDirWalkDentryTree(t *testing.T) {
 	testWalk(dir2D, "dir2/file1", "/file1", nil)
 	testWalk(dir2D, "dir2/file1", "file1", nil)
 }
+
+func TestDentryCacheLimits(t *testing.T) {
+	const files = 10
+	sys := newTestSystemWithCache(t, files, func(ctx context.Context, creds *auth.Credentials, fs *filesystem) kernfs.Inode {
+		contents := make(map[string]kernfs.Inode)
+		for i := 0; i < files; i++ {
+			contents[fmt.Sprintf("file%d", i)] = fs.newFile(ctx, creds, staticFileContent)
+		}
+		return fs.newReadonlyDir(ctx, creds, 0755, contents)
+	})
+	defer sys.Destroy()
+
+	walk := func() {
+		for i := 0; i < files; i++ {
+			sys.GetDentryOrDie(sys.PathOpAtRoot(fmt.Sprintf("file%d", i))).DecRef(sys.Ctx)
+		}
+	}
+
+	// The VFS-wide limit applies on top of the filesystem's.
+	const max = 4
+	sys.VFS.SetMaxCachedDentries(max)
+	walk()
+	if got := sys.VFS.CachedDentries(); got > max {
+		t.Errorf("CachedDentries() = %d, want <= %d", got, max)
+	}
+
+	// Without it, all unreferenced dentries fit in the filesystem's cache.
+	sys.VFS.SetMaxCachedDentries(0)
+	walk()
+	if got := sys.VFS.CachedDentries(); got != files {
+		t.Errorf("CachedDentries() = %d, want %d", got, files)
+	}
+
+	// Reclaiming all cached dentries empties the cache.
+	if got := sys.VFS.ReclaimCachedDentries(sys.Ctx, 100); got != files {
+		t.Errorf("ReclaimCachedDentries(_, 100) = %d, want %d", got, files)
+	}
+	if got := sys.VFS.CachedDentries(); got != 0 {
+		t.Errorf("CachedDentries() = %d, want 0", got)
+	}
+}
+
+func TestDentryCacheLimitsScaled(t *testing.T) {
+	const files = 10
+	rootFn := func(ctx context.Context, creds *auth.Credentials, fs *filesystem) kernfs.Inode {
+		contents := make(map[string]kernfs.Inode)
+		for i := 0; i < files; i++ {
+			contents[fmt.Sprintf("file%d", i)] = fs.newFile(ctx, creds, staticFileContent)
+		}
+		return fs.newReadonlyDir(ctx, creds, 0755, contents)
+	}
+	sys := newTestSystemWithCache(t, files, rootFn)
+	defer sys.Destroy()
+
+	// Mount a second filesystem with the same cache limit.
+	fst := fsType{rootFn: rootFn, maxCachedDentries: files}
+	fs, root, err := fst.GetFilesystem(sys.Ctx, sys.VFS, sys.Creds, "", vfs.GetFilesystemOptions{})
+	if err != nil {
+		t.Fatalf("GetFilesystem failed: %v", err)
+	}
+	mnt := sys.VFS.NewDisconnectedMount(fs, root, &vfs.MountOptions{})
+	fs.DecRef(sys.Ctx)
+	root.DecRef(sys.Ctx)
+	defer mnt.DecRef(sys.Ctx)
+	mntRoot := vfs.MakeVirtualDentry(mnt, mnt.Root())
+
+	walk := func(start vfs.VirtualDentry, first, last int) {
+		for i := first; i <= last; i++ {
+			pop := &vfs.PathOperation{
+				Root:  start,
+				Start: start,
+				Path:  fspath.Parse(fmt.Sprintf("file%d", i)),
+			}
+			sys.GetDentryOrDie(pop).DecRef(sys.Ctx)
+		}
+	}
+
+	sys.VFS.SetMaxCachedDentries(files)
+
+	// While it is the only filesystem caching dentries, the first filesystem
+	// may use the entire VFS-wide limit.
+	walk(sys.Root, 0, files-2)
+	if got, want := sys.VFS.CachedDentries(), uint64(files-1); got != want {
+		t.Errorf("CachedDentries() = %d, want %d", got, want)
+	}
+
+	// Once the second filesystem caches dentries, both filesystems are
+	// limited to half of the VFS-wide limit. The second filesystem doesn't
+	// have to evict its own dentries to make room for the first's.
+	walk(mntRoot, 0, files-1)
+	if got, want := sys.VFS.CachedDentries(), uint64(files-1+files/2); got != want {
+		t.Errorf("CachedDentries() = %d, want %d", got, want)
+	}
+
+	// The first filesystem's cache shrinks to its share on its next
+	// insertion.
+	walk(sys.Root, files-1, files-1)
+	if got, want := sys.VFS.CachedDentries(), uint64(files); got != want {
+		t.Errorf("CachedDentries() = %d, want %d", got, want)
+	}
+}
@@ -108,6 +108,10 @@ func (d *dentry) copyUpMaybeSyntheticMountpointLocked(ctx context.Context, forSy
 	}
 	// Used during copy-up of memory-mapped regular files.
 	var mmapOpts *memmap.MMapOpts
+	// journalEnded is true if the journal no longer needs to record the end
+	// of copy-up, either because it already has or because copy-up couldn't
+	// be undone, in which case recovery must undo it.
+	journalEnded := false
 	cleanupUndoCopyUp := func() {
 		var err error
 		if ftype == linux.S_IFDIR {
@@ -116,6 +120,7 @@ func (d *dentry) copyUpMaybeSyntheticMountpointLocked(ctx context.Context, forSy
 			err = vfsObj.UnlinkAt(ctx, d.fs.creds, &newpop)
 		}
 		if err != nil {
+			journalEnded = true
 			panic(fmt.Sprintf("unrecoverable overlayfs inconsistency: failed to delete upper layer file after copy-up error: %v", err))
 		}
 		if d.upperVD.Ok() {
@@ -123,6 +128,16 @@ func (d *dentry) copyUpMaybeSyntheticMountpointLocked(ctx context.Context, forSy
 			d.upperVD = vfs.VirtualDentry{}
 		}
 	}
+	jid, err := d.fs.journalBegin(ctx, journalOpCopyUp, parent, d.name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if !journalEnded {
+			// Copy-up failed and was undone.
+			d.fs.journalEnd(ctx, jid)
+		}
+	}()
 	switch ftype {
 	case linux.S_IFREG:
 		oldFD, err := vfsObj.OpenAt(ctx, d.fs.creds, &oldpop, &vfs.OpenOptions{
@@ -175,6 +190,14 @@ func (d *dentry) copyUpMaybeSyntheticMountpointLocked(ctx context.Context, forSy
 			cleanupUndoCopyUp()
 			return err
 		}
+		if d.fs.journal != nil {
+			// Copied-up data must be durable before the journal records
+			// copy-up as complete.
+			if err := newFD.Sync(ctx); err != nil {
+				cleanupUndoCopyUp()
+				return err
+			}
+		}
 		d.upperVD = newFD.VirtualDentry()
 		d.upperVD.IncRef()
 
@@ -273,6 +296,12 @@ func (d *dentry) copyUpMaybeSyntheticMountpointLocked(ctx context.Context, forSy
 		cleanupUndoCopyUp()
 		return err
 	}
+	journalEnded = true
+	if err := d.fs.journalEnd(ctx, jid); err != nil {
+		// Recovery would undo the copy-up anyway.
+		cleanupUndoCopyUp()
+		return err
+	}
 
 	// Update the dentry's device and inode numbers (except for directories,
 	// for which these remain overlay-assigned).
@@ -281,6 +281,9 @@ func (fd *directoryFD) Sync(ctx context.Context) error {
 	if !d.isCopiedUp() {
 		return nil
 	}
+	if err := d.fs.journalSync(ctx); err != nil {
+		return err
+	}
 	vfsObj := d.fs.vfsfs.VirtualFilesystem()
 	pop := vfs.PathOperation{
 		Root:  d.upperVD,
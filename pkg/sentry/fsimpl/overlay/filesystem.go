@@ -41,6 +41,13 @@ const _OVL_XATTR_PREFIX = linux.XATTR_TRUSTED_PREFIX + "overlay."
 // Linux: fs/overlayfs/overlayfs.h:OVL_XATTR_OPAQUE
 const _OVL_XATTR_OPAQUE = _OVL_XATTR_PREFIX + "opaque"
 
+// _OVL_XATTR_USER_OPAQUE is the extended attribute key used instead of
+// _OVL_XATTR_OPAQUE by layers prepared for Linux overlays mounted with the
+// userxattr option. It is only honored on lower layers, and only if
+// FilesystemOptions.UserXattr is true.
+// Linux: fs/overlayfs/overlayfs.h:OVL_XATTR_USER_PREFIX
+const _OVL_XATTR_USER_OPAQUE = linux.XATTR_USER_PREFIX + "overlay.opaque"
+
 func isWhiteout(stat *linux.Statx) bool {
 	return stat.Mode&linux.S_IFMT == linux.S_IFCHR && stat.RdevMajor == 0 && stat.RdevMinor == 0
 }
@@ -48,6 +55,9 @@ func isWhiteout(stat *linux.Statx) bool {
 // Sync implements vfs.FilesystemImpl.Sync.
 func (fs *filesystem) Sync(ctx context.Context) error {
 	if fs.opts.UpperRoot.Ok() {
+		if err := fs.journalSync(ctx); err != nil {
+			return err
+		}
 		return fs.opts.UpperRoot.Mount().Filesystem().Impl().Sync(ctx)
 	}
 	return nil
@@ -306,14 +316,7 @@ func (fs *filesystem) lookupLocked(ctx context.Context, parent *dentry, name str
 
 		// Directories are merged with directories from lower layers if they
 		// are not explicitly opaque.
-		opaqueVal, err := vfsObj.GetXattrAt(ctx, fs.creds, &vfs.PathOperation{
-			Root:  childVD,
-			Start: childVD,
-		}, &vfs.GetXattrOptions{
-			Name: _OVL_XATTR_OPAQUE,
-			Size: 1,
-		})
-		return !(err == nil && opaqueVal == "y")
+		return !fs.isOpaqueDir(ctx, childVD, isUpper)
 	})
 
 	if lookupErr != nil {
@@ -554,6 +557,11 @@ func (fs *filesystem) doCreateAt(ctx context.Context, rp *vfs.ResolvingPath, ct
 	if err := parent.copyUpMaybeSyntheticMountpointLocked(ctx, ct == createSyntheticMountpoint); err != nil {
 		return err
 	}
+	// Recovery must not mistake the new file for one left by an operation
+	// that ended before it was created.
+	if err := fs.journalSync(ctx); err != nil {
+		return err
+	}
 
 	// Finally create the new file.
 	if err := create(parent, name, childLayer == lookupLayerUpperWhiteout); err != nil {
@@ -1011,6 +1019,10 @@ func (fs *filesystem) createAndOpenLocked(ctx context.Context, rp *vfs.Resolving
 	if err := parent.copyUpLocked(ctx); err != nil {
 		return nil, err
 	}
+	// See doCreateAt.
+	if err := fs.journalSync(ctx); err != nil {
+		return nil, err
+	}
 
 	vfsObj := fs.vfsfs.VirtualFilesystem()
 	childName := rp.Component()
@@ -1260,6 +1272,13 @@ func (fs *filesystem) RenameAt(ctx context.Context, rp *vfs.ResolvingPath, oldPa
 		Path:  fspath.Parse(newName),
 	}
 
+	jid, err := fs.journalBeginRename(ctx, oldParent, oldName, newParent, newName)
+	if err != nil {
+		vfsObj.AbortRenameDentry(&renamed.vfsd, replacedVFSD)
+		return err
+	}
+	defer fs.journalEnd(ctx, jid)
+
 	needRecreateWhiteouts := false
 	cleanupRecreateWhiteouts := func() {
 		if !needRecreateWhiteouts {
@@ -1440,6 +1459,12 @@ func (fs *filesystem) RmdirAt(ctx context.Context, rp *vfs.ResolvingPath) error
 		Start: parent.upperVD,
 		Path:  fspath.Parse(name),
 	}
+	jid, err := fs.journalBegin(ctx, journalOpRmdir, parent, name)
+	if err != nil {
+		vfsObj.AbortDeleteDentry(&child.vfsd)
+		return err
+	}
+	defer fs.journalEnd(ctx, jid)
 	if child.upperVD.Ok() {
 		cleanupRecreateWhiteouts := func() {
 			if !child.upperVD.Ok() {
@@ -1704,6 +1729,12 @@ func (fs *filesystem) UnlinkAt(ctx context.Context, rp *vfs.ResolvingPath) error
 		Start: parent.upperVD,
 		Path:  fspath.Parse(name),
 	}
+	jid, err := fs.journalBegin(ctx, journalOpUnlink, parent, name)
+	if err != nil {
+		vfsObj.AbortDeleteDentry(&child.vfsd)
+		return err
+	}
+	defer fs.journalEnd(ctx, jid)
 	if childLayer == lookupLayerUpper {
 		// Remove the existing file on the upper layer.
 		if err := vfsObj.UnlinkAt(ctx, fs.creds, &pop); err != nil {
@@ -1735,6 +1766,31 @@ func (fs *filesystem) UnlinkAt(ctx context.Context, rp *vfs.ResolvingPath) error
 	return nil
 }
 
+// isOpaqueDir returns true if the directory vd on a layer is marked opaque,
+// such that directories on layers below it are not merged with it.
+// Linux: fs/overlayfs/util.c:ovl_is_opaquedir()
+func (fs *filesystem) isOpaqueDir(ctx context.Context, vd vfs.VirtualDentry, isUpper bool) bool {
+	if fs.getOpaqueXattr(ctx, vd, _OVL_XATTR_OPAQUE) {
+		return true
+	}
+	// Applications may set user.* attributes on the upper layer, so
+	// _OVL_XATTR_USER_OPAQUE is only meaningful on lower layers.
+	return !isUpper && fs.opts.UserXattr && fs.getOpaqueXattr(ctx, vd, _OVL_XATTR_USER_OPAQUE)
+}
+
+// getOpaqueXattr returns true if the extended attribute name on vd has the
+// value "y".
+func (fs *filesystem) getOpaqueXattr(ctx context.Context, vd vfs.VirtualDentry, name string) bool {
+	val, err := fs.vfsfs.VirtualFilesystem().GetXattrAt(ctx, fs.creds, &vfs.PathOperation{
+		Root:  vd,
+		Start: vd,
+	}, &vfs.GetXattrOptions{
+		Name: name,
+		Size: 1,
+	})
+	return err == nil && val == "y"
+}
+
 // isOverlayXattr returns whether the given extended attribute configures the
 // overlay.
 func isOverlayXattr(name string) bool {
@@ -1901,6 +1957,98 @@ func (fs *filesystem) IsDescendant(vfsroot, vd vfs.VirtualDentry) bool {
 	return genericIsDescendant(fs, vfsroot.Dentry(), vd.Dentry().Impl().(*dentry))
 }
 
+// upperFileHandleExtension returns the file handle implementation of the
+// upper layer, or nil if the upper layer doesn't support file handles.
+func (fs *filesystem) upperFileHandleExtension() vfs.FilesystemImplFileHandleExtension {
+	if !fs.opts.UpperRoot.Ok() {
+		return nil
+	}
+	ext, _ := fs.opts.UpperRoot.Mount().Filesystem().Impl().(vfs.FilesystemImplFileHandleExtension)
+	return ext
+}
+
+// EncodeFileHandle implements vfs.FilesystemImplFileHandleExtension.EncodeFileHandle.
+//
+// Overlay file handles are upper layer file handles. Files are copied up
+// before encoding, since handles of lower layer files would become stale
+// when the files are copied up.
+func (fs *filesystem) EncodeFileHandle(ctx context.Context, vfsd *vfs.Dentry) (int32, []byte, error) {
+	ext := fs.upperFileHandleExtension()
+	if ext == nil {
+		return 0, nil, linuxerr.EOPNOTSUPP
+	}
+	d := vfsd.Impl().(*dentry)
+	fs.renameMu.RLock()
+	err := d.copyUpLocked(ctx)
+	fs.renameMu.RUnlock()
+	if err != nil {
+		return 0, nil, err
+	}
+	return ext.EncodeFileHandle(ctx, d.upperVD.Dentry())
+}
+
+// DecodeFileHandle implements vfs.FilesystemImplFileHandleExtension.DecodeFileHandle.
+func (fs *filesystem) DecodeFileHandle(ctx context.Context, mntRoot *vfs.Dentry, handleType int32, handle []byte) (*vfs.Dentry, error) {
+	ext := fs.upperFileHandleExtension()
+	if ext == nil {
+		return nil, linuxerr.ESTALE
+	}
+	upperRoot := fs.opts.UpperRoot
+	upperD, err := ext.DecodeFileHandle(ctx, upperRoot.Dentry(), handleType, handle)
+	if err != nil {
+		return nil, err
+	}
+	defer upperD.DecRef(ctx)
+	pathname, err := fs.vfsfs.VirtualFilesystem().PathnameReachable(ctx, upperRoot, vfs.MakeVirtualDentry(upperRoot.Mount(), upperD))
+	if err != nil {
+		return nil, err
+	}
+	if pathname == "" {
+		// The file is not linked into the upper layer, so it can't be found
+		// in the overlay.
+		return nil, linuxerr.ESTALE
+	}
+
+	// Walk the upper layer path in the overlay to find the overlay dentry
+	// for the file.
+	if !fs.root.TryIncRef() {
+		return nil, linuxerr.ESTALE
+	}
+	defer fs.root.DecRef(ctx)
+	var ds *[]*dentry
+	fs.renameMu.RLock()
+	defer fs.renameMuRUnlockAndCheckDrop(ctx, &ds)
+	d := fs.root
+	for _, name := range strings.Split(pathname, "/") {
+		if name == "" {
+			continue
+		}
+		if !d.isDir() {
+			return nil, linuxerr.ESTALE
+		}
+		d.dirMu.Lock()
+		child, _, err := fs.getChildLocked(ctx, d, name, &ds)
+		d.dirMu.Unlock()
+		if err != nil {
+			if linuxerr.Equals(linuxerr.ENOENT, err) {
+				return nil, linuxerr.ESTALE
+			}
+			return nil, err
+		}
+		d = child
+	}
+	// The file may have been replaced in the overlay since it was found on
+	// the upper layer.
+	if !d.isCopiedUp() || d.upperVD.Dentry() != upperD {
+		return nil, linuxerr.ESTALE
+	}
+	if mntRoot != &fs.root.vfsd && !genericIsDescendant(fs, mntRoot, d) {
+		return nil, linuxerr.ESTALE
+	}
+	d.IncRef()
+	return &d.vfsd, nil
+}
+
 // MountOptions implements vfs.FilesystemImpl.MountOptions.
 func (fs *filesystem) MountOptions() string {
 	// Return the mount options from the topmost layer.
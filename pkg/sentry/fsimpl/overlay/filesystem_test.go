@@ -0,0 +1,154 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package overlay
+
+import (
+	"testing"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/fspath"
+	"github.com/wilinz/gvisor/pkg/sentry/contexttest"
+	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/tmpfs"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
+	"github.com/wilinz/gvisor/pkg/sentry/vfs"
+)
+
+// newTestVFS returns a VirtualFilesystem with tmpfs and overlay registered.
+func newTestVFS(t *testing.T, ctx context.Context) *vfs.VirtualFilesystem {
+	t.Helper()
+	vfsObj := &vfs.VirtualFilesystem{}
+	if err := vfsObj.Init(ctx); err != nil {
+		t.Fatalf("VFS init: %v", err)
+	}
+	vfsObj.MustRegisterFilesystemType(tmpfs.Name, tmpfs.FilesystemType{}, &vfs.RegisterFilesystemTypeOptions{})
+	vfsObj.MustRegisterFilesystemType(Name, FilesystemType{}, &vfs.RegisterFilesystemTypeOptions{})
+	return vfsObj
+}
+
+// newTestLayer returns the root of a new tmpfs mount containing the directory
+// "d", which contains an empty file named file. If userOpaque is true, "d" has
+// the user.overlay.opaque extended attribute.
+func newTestLayer(t *testing.T, ctx context.Context, vfsObj *vfs.VirtualFilesystem, file string, userOpaque bool) vfs.VirtualDentry {
+	t.Helper()
+	creds := auth.CredentialsFromContext(ctx)
+	mnt, err := vfsObj.MountDisconnected(ctx, creds, "", tmpfs.Name, &vfs.MountOptions{})
+	if err != nil {
+		t.Fatalf("failed to mount tmpfs: %v", err)
+	}
+	root := vfs.MakeVirtualDentry(mnt, mnt.Root())
+	root.IncRef()
+	mnt.DecRef(ctx)
+	t.Cleanup(func() { root.DecRef(ctx) })
+	pop := func(path string) *vfs.PathOperation {
+		return &vfs.PathOperation{Root: root, Start: root, Path: fspath.Parse(path)}
+	}
+	if err := vfsObj.MkdirAt(ctx, creds, pop("d"), &vfs.MkdirOptions{Mode: 0755}); err != nil {
+		t.Fatalf("failed to create d: %v", err)
+	}
+	if err := vfsObj.MknodAt(ctx, creds, pop("d/"+file), &vfs.MknodOptions{Mode: linux.ModeRegular | 0644}); err != nil {
+		t.Fatalf("failed to create d/%s: %v", file, err)
+	}
+	if userOpaque {
+		if err := vfsObj.SetXattrAt(ctx, creds, pop("d"), &vfs.SetXattrOptions{
+			Name:  _OVL_XATTR_USER_OPAQUE,
+			Value: "y",
+		}); err != nil {
+			t.Fatalf("failed to set %s on d: %v", _OVL_XATTR_USER_OPAQUE, err)
+		}
+	}
+	return root
+}
+
+func TestLookupUserXattrOpaque(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		// If upper is true, the top layer is the upper layer; otherwise it is
+		// a lower layer.
+		upper     bool
+		userXattr bool
+		// wantMerged is true if d/bottom is visible in the overlay.
+		wantMerged bool
+	}{
+		{
+			name:       "lower ignored by default",
+			userXattr:  false,
+			wantMerged: true,
+		},
+		{
+			name:       "lower honored with userxattr",
+			userXattr:  true,
+			wantMerged: false,
+		},
+		{
+			name:       "upper ignored with userxattr",
+			upper:      true,
+			userXattr:  true,
+			wantMerged: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := contexttest.RootContext(t)
+			creds := auth.CredentialsFromContext(ctx)
+			vfsObj := newTestVFS(t, ctx)
+			top := newTestLayer(t, ctx, vfsObj, "top", true /* userOpaque */)
+			bottom := newTestLayer(t, ctx, vfsObj, "bottom", false /* userOpaque */)
+
+			fsopts := FilesystemOptions{
+				LowerRoots: []vfs.VirtualDentry{top, bottom},
+				UserXattr:  test.userXattr,
+			}
+			if test.upper {
+				fsopts.UpperRoot = top
+				fsopts.LowerRoots = []vfs.VirtualDentry{bottom}
+			}
+			mnt, err := vfsObj.MountDisconnected(ctx, creds, "", Name, &vfs.MountOptions{
+				GetFilesystemOptions: vfs.GetFilesystemOptions{
+					InternalMount: true,
+					InternalData:  fsopts,
+				},
+			})
+			if err != nil {
+				t.Fatalf("failed to mount overlay: %v", err)
+			}
+			defer mnt.DecRef(ctx)
+			root := vfs.MakeVirtualDentry(mnt, mnt.Root())
+			pop := func(path string) *vfs.PathOperation {
+				return &vfs.PathOperation{Root: root, Start: root, Path: fspath.Parse(path)}
+			}
+
+			if _, err := vfsObj.StatAt(ctx, creds, pop("d/top"), &vfs.StatOptions{}); err != nil {
+				t.Errorf("stat d/top: %v", err)
+			}
+			_, err = vfsObj.StatAt(ctx, creds, pop("d/bottom"), &vfs.StatOptions{})
+			switch {
+			case test.wantMerged && err != nil:
+				t.Errorf("stat d/bottom: got error %v, want success", err)
+			case !test.wantMerged && !linuxerr.Equals(linuxerr.ENOENT, err):
+				t.Errorf("stat d/bottom: got error %v, want ENOENT", err)
+			}
+
+			// user.* attributes are not reserved by the overlay.
+			val, err := vfsObj.GetXattrAt(ctx, creds, pop("d"), &vfs.GetXattrOptions{
+				Name: _OVL_XATTR_USER_OPAQUE,
+				Size: 1,
+			})
+			if err != nil || val != "y" {
+				t.Errorf("getxattr d %s: got (%q, %v), want (\"y\", nil)", _OVL_XATTR_USER_OPAQUE, val, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,601 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package overlay
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/fspath"
+	"github.com/wilinz/gvisor/pkg/log"
+	"github.com/wilinz/gvisor/pkg/sentry/vfs"
+	"github.com/wilinz/gvisor/pkg/usermem"
+)
+
+// journalName is the name of the journal file in FilesystemOptions.WorkRoot.
+const journalName = "journal"
+
+// journalCompactSize is the journal size above which the journal is truncated
+// once no operations are in progress.
+const journalCompactSize = 64 << 10
+
+// Operations recorded in the journal.
+const (
+	// journalOpCopyUp is recorded by copy-up. Incomplete copy-ups are rolled
+	// back, since the copied-up file may be missing data or metadata.
+	journalOpCopyUp = "copyup"
+
+	// journalOpUnlink is recorded by UnlinkAt, which removes a file from the
+	// upper layer and then creates a whiteout in its place. Incomplete unlinks
+	// are rolled forward.
+	journalOpUnlink = "unlink"
+
+	// journalOpRmdir is recorded by RmdirAt, which removes whiteouts from a
+	// directory on the upper layer, removes the directory, and then creates a
+	// whiteout in its place. Incomplete rmdirs are rolled forward.
+	journalOpRmdir = "rmdir"
+
+	// journalOpRename is recorded by RenameAt, which renames a file on the
+	// upper layer and then creates a whiteout at its origin. Incomplete renames
+	// are rolled forward.
+	journalOpRename = "rename"
+)
+
+// journal is a write-ahead log of overlay operations that require multiple
+// mutations of the upper layer. It is only maintained if
+// FilesystemOptions.WorkRoot is provided, i.e. when the upper layer may
+// outlive the sandbox.
+//
+// Before the first mutation, each operation appends a "begin" record naming
+// the affected paths, and syncs it to the upper layer. After the last
+// mutation (or after undoing a failed operation), it appends an "end" record.
+// Syncing "end" records is deferred until the journal is next synced, which
+// happens when another operation begins, before a file is created on the
+// upper layer, and before the overlay syncs the upper layer on behalf of the
+// application. Recovering an operation whose "end" record was lost is
+// therefore harmless: the operation's paths haven't been reused, and any
+// changes that recovery discards were never synced. After a crash,
+// filesystem.recoverJournal repairs every operation with a "begin" record but
+// no "end" record before the overlay is mounted again.
+//
+// +stateify savable
+type journal struct {
+	// fd is the journal file, opened with O_APPEND. fd is immutable.
+	fd *vfs.FileDescription
+
+	// mu serializes appends to the journal and protects the following fields.
+	mu journalMutex `state:"nosave"`
+
+	// lastID is the ID of the most recently begun operation.
+	lastID uint64
+
+	// pending is the number of begun operations that have not ended.
+	pending int
+
+	// size is the size of the journal file in bytes.
+	size int64
+
+	// dirty is true if records have been appended to the journal file since
+	// it was last synced.
+	dirty bool
+}
+
+// journalRecord is an operation read from the journal file.
+type journalRecord struct {
+	id    uint64
+	op    string
+	paths []string
+}
+
+// String implements fmt.Stringer.String.
+func (rec *journalRecord) String() string {
+	return fmt.Sprintf("%d %s %q", rec.id, rec.op, rec.paths)
+}
+
+// upperChildPathLocked returns the path of the child of d named name,
+// relative to the root of the upper layer.
+//
+// Preconditions: d.fs.renameMu must be locked.
+func (d *dentry) upperChildPathLocked(name string) string {
+	names := []string{name}
+	for parent := d.parent.Load(); parent != nil; parent = d.parent.Load() {
+		names = append(names, d.name)
+		d = parent
+	}
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+	return strings.Join(names, "/")
+}
+
+// journalBegin records the beginning of op, which affects the child of parent
+// named name, and returns an ID that must be passed to fs.journalEnd when op
+// completes.
+//
+// Preconditions: fs.renameMu must be locked.
+func (fs *filesystem) journalBegin(ctx context.Context, op string, parent *dentry, name string) (uint64, error) {
+	if fs.journal == nil {
+		return 0, nil
+	}
+	return fs.journal.begin(ctx, op, parent.upperChildPathLocked(name))
+}
+
+// journalBeginRename is equivalent to fs.journalBegin for journalOpRename.
+//
+// Preconditions: fs.renameMu must be locked.
+func (fs *filesystem) journalBeginRename(ctx context.Context, oldParent *dentry, oldName string, newParent *dentry, newName string) (uint64, error) {
+	if fs.journal == nil {
+		return 0, nil
+	}
+	return fs.journal.begin(ctx, journalOpRename, oldParent.upperChildPathLocked(oldName), newParent.upperChildPathLocked(newName))
+}
+
+// journalEnd records the end of the operation with the given ID.
+//
+// Failing to record the end of an operation that is rolled forward is
+// harmless, since recovering it again is idempotent; callers that perform
+// operations that are rolled back must handle errors.
+func (fs *filesystem) journalEnd(ctx context.Context, id uint64) error {
+	if fs.journal == nil {
+		return nil
+	}
+	j := fs.journal
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.pending--
+	if err := j.appendLocked(ctx, fmt.Sprintf("end %d\n", id), false /* sync */); err != nil {
+		log.Warningf("overlay.filesystem.journalEnd: failed to end operation %d: %v", id, err)
+		return err
+	}
+	if j.pending == 0 && j.size >= journalCompactSize {
+		// All operations in the journal are complete, so it can be discarded.
+		if err := j.truncateLocked(ctx); err != nil {
+			log.Warningf("overlay.filesystem.journalEnd: failed to truncate journal: %v", err)
+		}
+	}
+	return nil
+}
+
+func (j *journal) begin(ctx context.Context, op string, paths ...string) (uint64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	id := j.lastID + 1
+	var b strings.Builder
+	fmt.Fprintf(&b, "begin %d %s", id, op)
+	for _, path := range paths {
+		b.WriteByte(' ')
+		b.WriteString(strconv.Quote(path))
+	}
+	b.WriteByte('\n')
+	if err := j.appendLocked(ctx, b.String(), true /* sync */); err != nil {
+		log.Warningf("overlay.journal.begin: failed to begin %s %q: %v", op, paths, err)
+		return 0, err
+	}
+	j.lastID = id
+	j.pending++
+	return id, nil
+}
+
+// journalSync syncs the journal file if any records are not yet durable. It
+// must be called before creating files on the upper layer, and before syncing
+// the upper layer on behalf of the application.
+func (fs *filesystem) journalSync(ctx context.Context) error {
+	if fs.journal == nil {
+		return nil
+	}
+	j := fs.journal
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !j.dirty {
+		return nil
+	}
+	if err := j.fd.Sync(ctx); err != nil {
+		log.Warningf("overlay.filesystem.journalSync: failed to sync journal: %v", err)
+		return err
+	}
+	j.dirty = false
+	return nil
+}
+
+// appendLocked appends rec to the journal file. If sync is true, it also
+// syncs the journal file, making rec and all previous records durable.
+//
+// Preconditions: j.mu must be locked.
+func (j *journal) appendLocked(ctx context.Context, rec string, sync bool) error {
+	n, err := j.fd.Write(ctx, usermem.BytesIOSequence([]byte(rec)), vfs.WriteOptions{})
+	if err == nil && n != int64(len(rec)) {
+		err = io.ErrShortWrite
+	}
+	if err == nil && sync {
+		err = j.fd.Sync(ctx)
+	}
+	if err != nil {
+		// Don't leave a torn record that would corrupt the next one.
+		if terr := j.fd.SetStat(ctx, vfs.SetStatOptions{
+			Stat: linux.Statx{
+				Mask: linux.STATX_SIZE,
+				Size: uint64(j.size),
+			},
+		}); terr != nil {
+			log.Warningf("overlay.journal.appendLocked: failed to remove partial record: %v", terr)
+		}
+		return err
+	}
+	j.size += n
+	j.dirty = !sync
+	return nil
+}
+
+// truncateLocked discards all records in the journal.
+//
+// Preconditions: j.mu must be locked.
+func (j *journal) truncateLocked(ctx context.Context) error {
+	if err := j.fd.SetStat(ctx, vfs.SetStatOptions{
+		Stat: linux.Statx{
+			Mask: linux.STATX_SIZE,
+			Size: 0,
+		},
+	}); err != nil {
+		return err
+	}
+	j.size = 0
+	if err := j.fd.Sync(ctx); err != nil {
+		return err
+	}
+	j.dirty = false
+	return nil
+}
+
+// readJournal returns the contents of the journal file.
+func readJournal(ctx context.Context, fd *vfs.FileDescription) ([]byte, error) {
+	var data []byte
+	buf := make([]byte, 4096)
+	for {
+		n, err := fd.PRead(ctx, usermem.BytesIOSequence(buf), int64(len(data)), vfs.ReadOptions{})
+		data = append(data, buf[:n]...)
+		if err == io.EOF || (err == nil && n == 0) {
+			return data, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseJournal returns the operations in data that were begun but not ended,
+// ordered by ID, and the largest ID in data. Malformed records, such as a
+// final record that was torn by a crash, are skipped.
+func parseJournal(data []byte) ([]*journalRecord, uint64) {
+	var (
+		lastID  uint64
+		pending = make(map[uint64]*journalRecord)
+	)
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if !strings.HasSuffix(line, "\n") {
+			if line != "" {
+				log.Infof("overlay.parseJournal: ignoring incomplete record %q", line)
+			}
+			continue
+		}
+		rec, ended, err := parseJournalRecord(strings.TrimSuffix(line, "\n"))
+		if err != nil {
+			log.Warningf("overlay.parseJournal: ignoring malformed record %q: %v", line, err)
+			continue
+		}
+		if rec.id > lastID {
+			lastID = rec.id
+		}
+		if ended {
+			delete(pending, rec.id)
+		} else {
+			pending[rec.id] = rec
+		}
+	}
+	recs := make([]*journalRecord, 0, len(pending))
+	for _, rec := range pending {
+		recs = append(recs, rec)
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		return recs[i].id < recs[j].id
+	})
+	return recs, lastID
+}
+
+// parseJournalRecord parses a single journal record. If the record is an
+// "end" record, only the returned journalRecord.id is meaningful.
+func parseJournalRecord(line string) (*journalRecord, bool, error) {
+	kind, rest, _ := strings.Cut(line, " ")
+	idStr, rest, _ := strings.Cut(rest, " ")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		return nil, false, err
+	}
+	rec := &journalRecord{id: id}
+	switch kind {
+	case "end":
+		if rest != "" {
+			return nil, false, fmt.Errorf("trailing data %q", rest)
+		}
+		return rec, true, nil
+	case "begin":
+		rec.op, rest, _ = strings.Cut(rest, " ")
+		for rest != "" {
+			quoted, err := strconv.QuotedPrefix(rest)
+			if err != nil {
+				return nil, false, err
+			}
+			path, err := strconv.Unquote(quoted)
+			if err != nil {
+				return nil, false, err
+			}
+			rec.paths = append(rec.paths, path)
+			rest = strings.TrimPrefix(rest[len(quoted):], " ")
+		}
+		return rec, false, nil
+	default:
+		return nil, false, fmt.Errorf("unknown record type %q", kind)
+	}
+}
+
+// recoverJournal opens the journal in fs.opts.WorkRoot, repairs the upper
+// layer by completing or undoing every operation that the journal records as
+// incomplete, and then discards the journal. This is analogous to running
+// fsck on the upper layer: it ensures that a crash of a previous sandbox
+// cannot leave the upper layer in a state that the overlay can't mount, such
+// as a file that was unlinked without being replaced by a whiteout.
+//
+// Preconditions: fs.opts.UpperRoot.Ok() and fs.opts.WorkRoot.Ok().
+func (fs *filesystem) recoverJournal(ctx context.Context, vfsObj *vfs.VirtualFilesystem) error {
+	fd, err := vfsObj.OpenAt(ctx, fs.creds, &vfs.PathOperation{
+		Root:  fs.opts.WorkRoot,
+		Start: fs.opts.WorkRoot,
+		Path:  fspath.Parse(journalName),
+	}, &vfs.OpenOptions{
+		Flags: linux.O_RDWR | linux.O_CREAT | linux.O_APPEND,
+		Mode:  0600,
+	})
+	if err != nil {
+		return err
+	}
+	data, err := readJournal(ctx, fd)
+	if err != nil {
+		fd.DecRef(ctx)
+		return err
+	}
+	recs, lastID := parseJournal(data)
+	for _, rec := range recs {
+		if err := fs.recoverOp(ctx, vfsObj, rec); err != nil {
+			ctx.Warningf("overlay.filesystem.recoverJournal: failed to recover operation %v: %v", rec, err)
+			fd.DecRef(ctx)
+			return err
+		}
+	}
+	if len(recs) != 0 {
+		ctx.Infof("overlay.filesystem.recoverJournal: recovered %d incomplete operations on the upper layer", len(recs))
+	}
+	j := &journal{
+		fd:     fd,
+		lastID: lastID,
+		size:   int64(len(data)),
+	}
+	if err := j.truncateLocked(ctx); err != nil {
+		fd.DecRef(ctx)
+		return err
+	}
+	fs.journal = j
+	return nil
+}
+
+// recoverOp completes or undoes the incomplete operation rec.
+func (fs *filesystem) recoverOp(ctx context.Context, vfsObj *vfs.VirtualFilesystem, rec *journalRecord) error {
+	wantPaths := 1
+	if rec.op == journalOpRename {
+		wantPaths = 2
+	}
+	if len(rec.paths) != wantPaths {
+		ctx.Warningf("overlay.filesystem.recoverOp: ignoring operation %v with %d paths, wanted %d", rec, len(rec.paths), wantPaths)
+		return nil
+	}
+	switch rec.op {
+	case journalOpCopyUp:
+		return fs.recoverCopyUp(ctx, vfsObj, rec.paths[0])
+	case journalOpUnlink:
+		return fs.recoverUnlink(ctx, vfsObj, rec.paths[0])
+	case journalOpRmdir:
+		return fs.recoverRmdir(ctx, vfsObj, rec.paths[0])
+	case journalOpRename:
+		return fs.recoverRename(ctx, vfsObj, rec.paths[0], rec.paths[1])
+	default:
+		ctx.Warningf("overlay.filesystem.recoverOp: ignoring unknown operation %v", rec)
+		return nil
+	}
+}
+
+// upperPathOperation returns a PathOperation for the given path relative to
+// the root of the upper layer.
+func (fs *filesystem) upperPathOperation(path string) *vfs.PathOperation {
+	return &vfs.PathOperation{
+		Root:  fs.opts.UpperRoot,
+		Start: fs.opts.UpperRoot,
+		Path:  fspath.Parse(path),
+	}
+}
+
+// statUpper returns the type and device number of the file at path on the
+// upper layer. If no such file exists, it returns ENOENT.
+func (fs *filesystem) statUpper(ctx context.Context, vfsObj *vfs.VirtualFilesystem, path string) (linux.Statx, error) {
+	return vfsObj.StatAt(ctx, fs.creds, fs.upperPathOperation(path), &vfs.StatOptions{
+		Mask: linux.STATX_TYPE,
+	})
+}
+
+// ensureUpperWhiteout creates a whiteout at path on the upper layer if
+// nothing exists there.
+func (fs *filesystem) ensureUpperWhiteout(ctx context.Context, vfsObj *vfs.VirtualFilesystem, path string) error {
+	if err := CreateWhiteout(ctx, vfsObj, fs.creds, fs.upperPathOperation(path)); err != nil && !linuxerr.Equals(linuxerr.EEXIST, err) {
+		return err
+	}
+	return nil
+}
+
+// removeUpperWhiteouts removes all whiteouts from the directory at path on the
+// upper layer, leaving it empty. If the directory contains any files that are
+// not whiteouts, it returns false without removing anything.
+func (fs *filesystem) removeUpperWhiteouts(ctx context.Context, vfsObj *vfs.VirtualFilesystem, path string) (bool, error) {
+	dirFD, err := vfsObj.OpenAt(ctx, fs.creds, fs.upperPathOperation(path), &vfs.OpenOptions{
+		Flags: linux.O_RDONLY | linux.O_DIRECTORY,
+	})
+	if err != nil {
+		return false, err
+	}
+	defer dirFD.DecRef(ctx)
+	var maybeWhiteouts []string
+	if err := dirFD.IterDirents(ctx, vfs.IterDirentsCallbackFunc(func(dirent vfs.Dirent) error {
+		if dirent.Name == "." || dirent.Name == ".." {
+			return nil
+		}
+		if dirent.Type != linux.DT_CHR {
+			return linuxerr.ENOTEMPTY
+		}
+		maybeWhiteouts = append(maybeWhiteouts, dirent.Name)
+		return nil
+	})); err != nil {
+		if linuxerr.Equals(linuxerr.ENOTEMPTY, err) {
+			return false, nil
+		}
+		return false, err
+	}
+	for _, name := range maybeWhiteouts {
+		stat, err := fs.statUpper(ctx, vfsObj, path+"/"+name)
+		if err != nil {
+			return false, err
+		}
+		if !isWhiteout(&stat) {
+			return false, nil
+		}
+	}
+	for _, name := range maybeWhiteouts {
+		if err := vfsObj.UnlinkAt(ctx, fs.creds, fs.upperPathOperation(path+"/"+name)); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// recoverCopyUp undoes an incomplete copy-up of the file at path.
+func (fs *filesystem) recoverCopyUp(ctx context.Context, vfsObj *vfs.VirtualFilesystem, path string) error {
+	stat, err := fs.statUpper(ctx, vfsObj, path)
+	if err != nil {
+		if linuxerr.Equals(linuxerr.ENOENT, err) {
+			// Copy-up didn't create the file.
+			return nil
+		}
+		return err
+	}
+	if stat.Mode&linux.S_IFMT == linux.S_IFDIR {
+		return vfsObj.RmdirAt(ctx, fs.creds, fs.upperPathOperation(path))
+	}
+	return vfsObj.UnlinkAt(ctx, fs.creds, fs.upperPathOperation(path))
+}
+
+// recoverUnlink completes an incomplete unlink of the file at path.
+func (fs *filesystem) recoverUnlink(ctx context.Context, vfsObj *vfs.VirtualFilesystem, path string) error {
+	stat, err := fs.statUpper(ctx, vfsObj, path)
+	if err != nil && !linuxerr.Equals(linuxerr.ENOENT, err) {
+		return err
+	}
+	if err == nil && !isWhiteout(&stat) {
+		if err := vfsObj.UnlinkAt(ctx, fs.creds, fs.upperPathOperation(path)); err != nil {
+			return err
+		}
+	}
+	return fs.ensureUpperWhiteout(ctx, vfsObj, path)
+}
+
+// recoverRmdir completes an incomplete rmdir of the directory at path.
+func (fs *filesystem) recoverRmdir(ctx context.Context, vfsObj *vfs.VirtualFilesystem, path string) error {
+	stat, err := fs.statUpper(ctx, vfsObj, path)
+	if err != nil && !linuxerr.Equals(linuxerr.ENOENT, err) {
+		return err
+	}
+	if err == nil && stat.Mode&linux.S_IFMT == linux.S_IFDIR {
+		empty, err := fs.removeUpperWhiteouts(ctx, vfsObj, path)
+		if err != nil {
+			return err
+		}
+		if !empty {
+			// RmdirAt didn't get as far as removing anything, and the
+			// directory is no longer empty; leave it in place.
+			ctx.Warningf("overlay.filesystem.recoverRmdir: not removing non-empty directory %q", path)
+			return nil
+		}
+		if err := vfsObj.RmdirAt(ctx, fs.creds, fs.upperPathOperation(path)); err != nil {
+			return err
+		}
+	}
+	return fs.ensureUpperWhiteout(ctx, vfsObj, path)
+}
+
+// recoverRename completes an incomplete rename of the file at oldPath to
+// newPath.
+func (fs *filesystem) recoverRename(ctx context.Context, vfsObj *vfs.VirtualFilesystem, oldPath, newPath string) error {
+	oldStat, err := fs.statUpper(ctx, vfsObj, oldPath)
+	if err != nil && !linuxerr.Equals(linuxerr.ENOENT, err) {
+		return err
+	}
+	if err == nil && !isWhiteout(&oldStat) {
+		// The upper layer rename hasn't happened yet.
+		if oldStat.Mode&linux.S_IFMT == linux.S_IFDIR {
+			newStat, err := fs.statUpper(ctx, vfsObj, newPath)
+			switch {
+			case err != nil && !linuxerr.Equals(linuxerr.ENOENT, err):
+				return err
+			case err != nil:
+				// Nothing to replace.
+			case newStat.Mode&linux.S_IFMT == linux.S_IFDIR:
+				empty, err := fs.removeUpperWhiteouts(ctx, vfsObj, newPath)
+				if err != nil {
+					return err
+				}
+				if !empty {
+					ctx.Warningf("overlay.filesystem.recoverRename: not replacing non-empty directory %q", newPath)
+					return nil
+				}
+			case isWhiteout(&newStat):
+				if err := vfsObj.UnlinkAt(ctx, fs.creds, fs.upperPathOperation(newPath)); err != nil {
+					return err
+				}
+			}
+		}
+		if err := vfsObj.RenameAt(ctx, fs.creds, fs.upperPathOperation(oldPath), fs.upperPathOperation(newPath), &vfs.RenameOptions{}); err != nil {
+			return err
+		}
+	}
+	if newStat, err := fs.statUpper(ctx, vfsObj, newPath); err == nil && newStat.Mode&linux.S_IFMT == linux.S_IFDIR {
+		if err := vfsObj.SetXattrAt(ctx, fs.creds, fs.upperPathOperation(newPath), &vfs.SetXattrOptions{
+			Name:  _OVL_XATTR_OPAQUE,
+			Value: "y",
+		}); err != nil {
+			ctx.Warningf("overlay.filesystem.recoverRename: failed to make renamed directory %q opaque: %v", newPath, err)
+		}
+	}
+	return fs.ensureUpperWhiteout(ctx, vfsObj, oldPath)
+}
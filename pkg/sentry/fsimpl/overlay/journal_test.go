@@ -0,0 +1,167 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package overlay
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseJournalRecord(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		line      string
+		want      *journalRecord
+		wantEnded bool
+		wantErr   bool
+	}{
+		{
+			name:      "end",
+			line:      "end 7",
+			want:      &journalRecord{id: 7},
+			wantEnded: true,
+		},
+		{
+			name: "begin one path",
+			line: `begin 1 unlink "a/b"`,
+			want: &journalRecord{id: 1, op: journalOpUnlink, paths: []string{"a/b"}},
+		},
+		{
+			name: "begin two paths",
+			line: `begin 2 rename "a" "b/c"`,
+			want: &journalRecord{id: 2, op: journalOpRename, paths: []string{"a", "b/c"}},
+		},
+		{
+			name: "begin quoted path",
+			line: `begin 3 copyup "dir/with space\n\"quote\""`,
+			want: &journalRecord{id: 3, op: journalOpCopyUp, paths: []string{"dir/with space\n\"quote\""}},
+		},
+		{
+			name: "begin no paths",
+			line: "begin 4 rmdir",
+			want: &journalRecord{id: 4, op: journalOpRmdir},
+		},
+		{
+			name:    "empty",
+			line:    "",
+			wantErr: true,
+		},
+		{
+			name:    "bad id",
+			line:    `begin x unlink "a"`,
+			wantErr: true,
+		},
+		{
+			name:    "end trailing data",
+			line:    "end 1 2",
+			wantErr: true,
+		},
+		{
+			name:    "unknown kind",
+			line:    "commit 1",
+			wantErr: true,
+		},
+		{
+			name:    "unquoted path",
+			line:    "begin 1 unlink a",
+			wantErr: true,
+		},
+		{
+			name:    "unterminated quote",
+			line:    `begin 1 unlink "a`,
+			wantErr: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, ended, err := parseJournalRecord(test.line)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("parseJournalRecord(%q): got (%v, %t, nil), want error", test.line, got, ended)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseJournalRecord(%q) failed: %v", test.line, err)
+			}
+			if ended != test.wantEnded {
+				t.Errorf("parseJournalRecord(%q): got ended %t, want %t", test.line, ended, test.wantEnded)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseJournalRecord(%q): got %v, want %v", test.line, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseJournal(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		data       string
+		want       []*journalRecord
+		wantLastID uint64
+	}{
+		{
+			name: "empty",
+			data: "",
+			want: []*journalRecord{},
+		},
+		{
+			name:       "all ended",
+			data:       "begin 1 unlink \"a\"\nbegin 2 rmdir \"b\"\nend 2\nend 1\n",
+			want:       []*journalRecord{},
+			wantLastID: 2,
+		},
+		{
+			name: "pending in id order",
+			data: "begin 3 unlink \"c\"\nbegin 1 copyup \"a\"\nbegin 2 rename \"b\" \"d\"\nend 2\n",
+			want: []*journalRecord{
+				{id: 1, op: journalOpCopyUp, paths: []string{"a"}},
+				{id: 3, op: journalOpUnlink, paths: []string{"c"}},
+			},
+			wantLastID: 3,
+		},
+		{
+			name: "torn final record",
+			data: "begin 1 unlink \"a\"\nend 1\nbegin 2 unl",
+			want: []*journalRecord{},
+			// The torn record's ID isn't known.
+			wantLastID: 1,
+		},
+		{
+			name: "malformed record skipped",
+			data: "begin 1 unlink \"a\"\ngarbage\nbegin 2 rmdir \"b\"\nend 1\n",
+			want: []*journalRecord{
+				{id: 2, op: journalOpRmdir, paths: []string{"b"}},
+			},
+			wantLastID: 2,
+		},
+		{
+			name:       "end without begin",
+			data:       "end 5\n",
+			want:       []*journalRecord{},
+			wantLastID: 5,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, lastID := parseJournal([]byte(test.data))
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseJournal(%q): got records %v, want %v", test.data, got, test.want)
+			}
+			if lastID != test.wantLastID {
+				t.Errorf("parseJournal(%q): got last ID %d, want %d", test.data, lastID, test.wantLastID)
+			}
+		})
+	}
+}
@@ -81,9 +81,25 @@ type FilesystemOptions struct {
 	// overlay.
 	UpperRoot vfs.VirtualDentry
 
+	// If WorkRoot.Ok(), it is a directory on the upper layer's filesystem,
+	// outside of UpperRoot, in which the overlay keeps a journal of operations
+	// that mutate the upper layer in multiple steps. The journal is replayed
+	// when the overlay is mounted, so that an upper layer that outlives a
+	// crashed sandbox remains usable. WorkRoot requires UpperRoot.Ok().
+	WorkRoot vfs.VirtualDentry
+
 	// LowerRoots contains the roots of the immutable lower layers of the
 	// overlay. LowerRoots is immutable.
 	LowerRoots []vfs.VirtualDentry
+
+	// If UserXattr is true, directories on lower layers that have the
+	// user.overlay.opaque extended attribute are opaque, as for Linux overlays
+	// mounted with the userxattr option. This allows using layers prepared by
+	// unprivileged tools, which can't set trusted.overlay.opaque. The overlay
+	// itself still marks directories on the upper layer using
+	// trusted.overlay.opaque, and user.* attributes remain visible to
+	// applications. UserXattr is immutable.
+	UserXattr bool
 }
 
 // filesystem implements vfs.FilesystemImpl.
@@ -134,6 +150,14 @@ type filesystem struct {
 
 	// MaxFilenameLen is the maximum filename length allowed by the overlayfs.
 	maxFilenameLen uint64
+
+	// journal records multi-step mutations of the upper layer. If
+	// opts.WorkRoot is not Ok(), journal is nil. journal is immutable.
+	journal *journal
+
+	// root is the root dentry, which is used to decode file handles. No
+	// reference is held on root by the filesystem. root is immutable.
+	root *dentry
 }
 
 // +stateify savable
@@ -169,20 +193,31 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		}
 		delete(mopts, "upperdir")
 		// Linux overlayfs also requires a workdir when upperdir is
-		// specified; we don't, so silently ignore this option.
-		if workdir, ok := mopts["workdir"]; ok {
+		// specified; we don't, but use it for the upper layer journal if
+		// the "journal" option is specified. The journal is only useful
+		// if the upper layer outlives the sandbox, which the overlay can't
+		// determine on its own.
+		_, journaled := mopts["journal"]
+		delete(mopts, "journal")
+		var workPath fspath.Path
+		workdir, haveWorkdir := mopts["workdir"]
+		if journaled && !haveWorkdir {
+			ctx.Infof("overlay.FilesystemType.GetFilesystem: journal requires workdir")
+			return nil, nil, linuxerr.EINVAL
+		}
+		if haveWorkdir {
 			// Linux creates the "work" directory in `workdir`.
 			// Docker calls chown on it and fails if it doesn't
 			// exist.
-			workdirPath := fspath.Parse(workdir + "/work")
-			if !workdirPath.Absolute {
+			workPath = fspath.Parse(workdir + "/work")
+			if !workPath.Absolute {
 				ctx.Infof("overlay.FilesystemType.GetFilesystem: workdir %q must be absolute", workdir)
 				return nil, nil, linuxerr.EINVAL
 			}
 			pop := vfs.PathOperation{
 				Root:               vfsroot,
 				Start:              vfsroot,
-				Path:               workdirPath,
+				Path:               workPath,
 				FollowFinalSymlink: false,
 			}
 			mode := vfs.MkdirOptions{
@@ -226,6 +261,43 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		}
 		defer privateUpperRoot.DecRef(ctx)
 		fsopts.UpperRoot = privateUpperRoot
+
+		if haveWorkdir && fsopts.WorkRoot.Ok() {
+			ctx.Infof("overlay.FilesystemType.GetFilesystem: both workdir and FilesystemOptions.WorkRoot are specified")
+			return nil, nil, linuxerr.EINVAL
+		}
+		if journaled {
+			workRoot, err := vfsObj.GetDentryAt(ctx, creds, &vfs.PathOperation{
+				Root:               vfsroot,
+				Start:              vfsroot,
+				Path:               workPath,
+				FollowFinalSymlink: true,
+			}, &vfs.GetDentryOptions{
+				CheckSearchable: true,
+			})
+			if err != nil {
+				ctx.Infof("overlay.FilesystemType.GetFilesystem: failed to resolve %s/work: %v", workdir, err)
+				return nil, nil, err
+			}
+			if workRoot.Mount().Filesystem() != privateUpperRoot.Mount().Filesystem() {
+				ctx.Infof("overlay.FilesystemType.GetFilesystem: workdir %q and upperdir %q must be on the same filesystem", workdir, upperPathname)
+				workRoot.DecRef(ctx)
+				return nil, nil, linuxerr.EINVAL
+			}
+			privateWorkRoot, err := clonePrivateMount(vfsObj, workRoot, false /* forceReadOnly */)
+			workRoot.DecRef(ctx)
+			if err != nil {
+				ctx.Infof("overlay.FilesystemType.GetFilesystem: failed to make private bind mount of %s/work: %v", workdir, err)
+				return nil, nil, err
+			}
+			defer privateWorkRoot.DecRef(ctx)
+			fsopts.WorkRoot = privateWorkRoot
+		}
+	}
+
+	if _, ok := mopts["userxattr"]; ok {
+		delete(mopts, "userxattr")
+		fsopts.UserXattr = true
 	}
 
 	if lowerPathnamesStr, ok := mopts["lowerdir"]; ok {
@@ -273,6 +345,10 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		ctx.Infof("overlay.FilesystemType.GetFilesystem: at least one lower layer is required")
 		return nil, nil, linuxerr.EINVAL
 	}
+	if fsopts.WorkRoot.Ok() && !fsopts.UpperRoot.Ok() {
+		ctx.Infof("overlay.FilesystemType.GetFilesystem: a work directory requires an upper layer")
+		return nil, nil, linuxerr.EINVAL
+	}
 	if len(fsopts.LowerRoots) < 2 && !fsopts.UpperRoot.Ok() {
 		ctx.Infof("overlay.FilesystemType.GetFilesystem: at least two lower layers are required when no upper layer is present")
 		return nil, nil, linuxerr.EINVAL
@@ -293,6 +369,9 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 	if fsopts.UpperRoot.Ok() {
 		fsopts.UpperRoot.IncRef()
 	}
+	if fsopts.WorkRoot.Ok() {
+		fsopts.WorkRoot.IncRef()
+	}
 	for _, lowerRoot := range fsopts.LowerRoots {
 		lowerRoot.IncRef()
 	}
@@ -320,9 +399,19 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		}
 	}
 
+	// Repair the upper layer before looking up anything on it.
+	if fsopts.WorkRoot.Ok() {
+		if err := fs.recoverJournal(ctx, vfsObj); err != nil {
+			ctx.Infof("overlay.FilesystemType.GetFilesystem: failed to recover upper layer journal: %v", err)
+			fs.vfsfs.DecRef(ctx)
+			return nil, nil, err
+		}
+	}
+
 	// Construct the root dentry.
 	root := fs.newDentry()
 	root.refs = atomicbitops.FromInt64(1)
+	fs.root = root
 	if fs.opts.UpperRoot.Ok() {
 		fs.opts.UpperRoot.IncRef()
 		root.copiedUp = atomicbitops.FromUint32(1)
@@ -418,9 +507,15 @@ func (fs *filesystem) Release(ctx context.Context) {
 	for _, lowerDevMinor := range fs.lowerDevMinors {
 		vfsObj.PutAnonBlockDevMinor(lowerDevMinor)
 	}
+	if fs.journal != nil {
+		fs.journal.fd.DecRef(ctx)
+	}
 	if fs.opts.UpperRoot.Ok() {
 		fs.opts.UpperRoot.DecRef(ctx)
 	}
+	if fs.opts.WorkRoot.Ok() {
+		fs.opts.WorkRoot.DecRef(ctx)
+	}
 	for _, lowerRoot := range fs.opts.LowerRoots {
 		lowerRoot.DecRef(ctx)
 	}
@@ -361,6 +361,9 @@ func (fd *regularFileFD) Sync(ctx context.Context) error {
 	wrappedFD.IncRef()
 	defer wrappedFD.DecRef(ctx)
 	fd.mu.Unlock()
+	if err := fd.dentry().fs.journalSync(ctx); err != nil {
+		return err
+	}
 	return wrappedFD.Sync(ctx)
 }
 
@@ -0,0 +1,122 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proc
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/hostarch"
+	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/kernfs"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+	"github.com/wilinz/gvisor/pkg/sentry/lsm"
+	"github.com/wilinz/gvisor/pkg/sentry/vfs"
+	"github.com/wilinz/gvisor/pkg/usermem"
+)
+
+// newAttrDir creates the /proc/[pid]/attr directory, through which
+// applications query and change the security context of a task.
+func (fs *filesystem) newAttrDir(ctx context.Context, task *kernel.Task) kernfs.Inode {
+	return fs.newTaskOwnedDir(ctx, task, fs.NextIno(), 0555, map[string]kernfs.Inode{
+		"current":    fs.newTaskOwnedInode(ctx, task, fs.NextIno(), 0666, &attrData{task: task, name: "current"}),
+		"exec":       fs.newTaskOwnedInode(ctx, task, fs.NextIno(), 0666, &attrData{task: task, name: "exec"}),
+		"fscreate":   fs.newTaskOwnedInode(ctx, task, fs.NextIno(), 0666, &attrData{task: task, name: "fscreate"}),
+		"keycreate":  fs.newTaskOwnedInode(ctx, task, fs.NextIno(), 0666, &attrData{task: task, name: "keycreate"}),
+		"prev":       fs.newTaskOwnedInode(ctx, task, fs.NextIno(), 0444, &attrData{task: task, name: "prev"}),
+		"sockcreate": fs.newTaskOwnedInode(ctx, task, fs.NextIno(), 0666, &attrData{task: task, name: "sockcreate"}),
+		"apparmor": fs.newTaskOwnedDir(ctx, task, fs.NextIno(), 0555, map[string]kernfs.Inode{
+			"current": fs.newTaskOwnedInode(ctx, task, fs.NextIno(), 0666, &attrData{task: task, name: "current"}),
+			"exec":    fs.newTaskOwnedInode(ctx, task, fs.NextIno(), 0666, &attrData{task: task, name: "exec"}),
+			"prev":    fs.newTaskOwnedInode(ctx, task, fs.NextIno(), 0444, &attrData{task: task, name: "prev"}),
+		}),
+	})
+}
+
+// attrData implements vfs.WritableDynamicBytesSource for the files in
+// /proc/[pid]/attr.
+//
+// +stateify savable
+type attrData struct {
+	kernfs.DynamicBytesFile
+
+	task *kernel.Task
+
+	// name is the attribute name, e.g. "current".
+	name string
+}
+
+var _ vfs.WritableDynamicBytesSource = (*attrData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *attrData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	// As on Linux, attributes are unavailable without an LSM providing
+	// them. The SELinux-only attributes are never available.
+	if !lsm.Enabled() {
+		return linuxerr.EINVAL
+	}
+	switch d.name {
+	case "current", "prev":
+		// All tasks are confined by the same policy, which never changes.
+		buf.WriteString(lsm.Label())
+		buf.WriteByte('\n')
+		return nil
+	case "exec":
+		// No profile transition is ever pending.
+		return nil
+	default:
+		return linuxerr.EINVAL
+	}
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+//
+// Only requests to change to the profile already in effect are accepted, as
+// a no-op, since the policy applies to all tasks.
+func (d *attrData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if !lsm.Enabled() || (d.name != "current" && d.name != "exec") {
+		return 0, linuxerr.EINVAL
+	}
+	// Tasks may only change their own security context.
+	if kernel.TaskFromContext(ctx) != d.task {
+		return 0, linuxerr.EACCES
+	}
+	if src.NumBytes() == 0 {
+		return 0, linuxerr.EINVAL
+	}
+	src = src.TakeFirst(hostarch.PageSize - 1)
+	buf := make([]byte, src.NumBytes())
+	n, err := src.CopyIn(ctx, buf)
+	if err != nil {
+		return 0, err
+	}
+	cmd, name, ok := strings.Cut(strings.TrimRight(string(buf[:n]), "\n\x00"), " ")
+	if !ok {
+		return 0, linuxerr.EINVAL
+	}
+	switch {
+	case d.name == "current" && (cmd == "changeprofile" || cmd == "changehat" || cmd == "permhat" || cmd == "permprofile"):
+	case d.name == "exec" && cmd == "exec":
+	default:
+		return 0, linuxerr.EINVAL
+	}
+	// Labels have the form "<profile> (<mode>)".
+	profile, _, _ := strings.Cut(lsm.Label(), " (")
+	if name != profile {
+		return 0, linuxerr.ENOENT
+	}
+	return int64(n), nil
+}
@@ -160,6 +160,12 @@ func (fs *filesystem) newStaticDir(ctx context.Context, creds *auth.Credentials,
 type InternalData struct {
 	ExtraInternalData
 	Cgroups map[string]string
+
+	// NvidiaDriverFiles maps paths relative to /proc/driver/nvidia to the
+	// contents of the corresponding host files, such as version,
+	// gpus/<bus id>/information and capabilities/.... If it is non-empty,
+	// these files are exposed read-only in /proc/driver/nvidia.
+	NvidiaDriverFiles map[string]string
 }
 
 // +stateify savable
@@ -703,7 +703,9 @@ func (s *taskStatData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 		terminationSignal = s.task.ThreadGroup().TerminationSignal()
 	}
 	fmt.Fprintf(buf, "%d ", terminationSignal)
-	fmt.Fprintf(buf, "0 0 0 " /* processor rt_priority policy */)
+	fmt.Fprintf(buf, "0 " /* processor */)
+	policy, rtPriority, _ := s.task.SchedPolicy()
+	fmt.Fprintf(buf, "%d %d ", rtPriority, policy)
 	fmt.Fprintf(buf, "0 0 0 " /* delayacct_blkio_ticks guest_time cguest_time */)
 	fmt.Fprintf(buf, "0 0 0 0 0 0 0 " /* start_data end_data start_brk arg_start arg_end env_start env_end */)
 	fmt.Fprintf(buf, "0\n" /* exit_code */)
@@ -850,7 +852,7 @@ func (s *statusFD) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	egid := creds.EffectiveKGID.In(s.userns).OrOverflow()
 	sgid := creds.SavedKGID.In(s.userns).OrOverflow()
 	var fds int
-	var vss, rss, data uint64
+	var vss, pin, rss, data uint64
 	s.task.WithMuLocked(func(t *kernel.Task) {
 		if fdTable := t.FDTable(); fdTable != nil {
 			fds = fdTable.CurrentMaxFDs()
@@ -877,6 +879,7 @@ func (s *statusFD) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	buf.WriteString(" \n")
 
 	fmt.Fprintf(buf, "VmSize:\t%d kB\n", vss>>10)
+	fmt.Fprintf(buf, "VmPin:\t%d kB\n", pin>>10)
 	fmt.Fprintf(buf, "VmRSS:\t%d kB\n", rss>>10)
 	fmt.Fprintf(buf, "VmData:\t%d kB\n", data>>10)
 
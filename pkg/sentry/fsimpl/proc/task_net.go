@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"strings"
 	"time"
 
 	"github.com/wilinz/gvisor/pkg/abi/linux"
@@ -57,20 +58,20 @@ func (fs *filesystem) newTaskNetDir(ctx context.Context, task *kernel.Task) kern
 			ptype     = "Type Device      Function\n"
 			upd6      = "  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
 		)
-		psched := fmt.Sprintf("%08x %08x %08x %08x\n", uint64(time.Microsecond/time.Nanosecond), 64, 1000000, uint64(time.Second/time.Nanosecond))
+		psched := fmt.Sprintf("%08x %08x %08x %08x\n", uint64(time.Microsecond/time.Nanosecond), 1<<linux.PSCHED_SHIFT, 1000000, uint64(time.Second/time.Nanosecond))
 
 		// TODO(gvisor.dev/issue/1833): Make sure file contents reflect the task
 		// network namespace.
 		contents = map[string]kernfs.Inode{
-			"dev":  fs.newInode(ctx, root, 0444, &netDevData{stack: stack}),
-			"snmp": fs.newInode(ctx, root, 0444, &netSnmpData{stack: stack}),
+			"dev":     fs.newInode(ctx, root, 0444, &netDevData{stack: stack}),
+			"netstat": fs.newInode(ctx, root, 0444, &netStatData{stack: stack}),
+			"snmp":    fs.newInode(ctx, root, 0444, &netSnmpData{stack: stack}),
 
 			// The following files are simple stubs until they are implemented in
 			// netstack, if the file contains a header the stub is just the header
 			// otherwise it is an empty file.
 			"arp":       fs.newInode(ctx, root, 0444, newStaticFile(arp)),
 			"netlink":   fs.newInode(ctx, root, 0444, newStaticFile(netlink)),
-			"netstat":   fs.newInode(ctx, root, 0444, &netStatData{}),
 			"packet":    fs.newInode(ctx, root, 0444, newStaticFile(packet)),
 			"protocols": fs.newInode(ctx, root, 0444, newStaticFile(protocols)),
 
@@ -784,7 +785,7 @@ var _ dynamicInode = (*netStatData)(nil)
 // Generate implements vfs.DynamicBytesSource.Generate.
 // See Linux's net/ipv4/fib_trie.c:fib_route_seq_show.
 func (d *netStatData) Generate(ctx context.Context, buf *bytes.Buffer) error {
-	buf.WriteString("TcpExt: SyncookiesSent SyncookiesRecv SyncookiesFailed " +
+	const tcpExtHeader = "SyncookiesSent SyncookiesRecv SyncookiesFailed " +
 		"EmbryonicRsts PruneCalled RcvPruned OfoPruned OutOfWindowIcmps " +
 		"LockDroppedIcmps ArpFilter TW TWRecycled TWKilled PAWSPassive " +
 		"PAWSActive PAWSEstab DelayedACKs DelayedACKLocked DelayedACKLost " +
@@ -813,6 +814,23 @@ func (d *netStatData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 		"TCPHystartTrainCwnd TCPHystartDelayDetect TCPHystartDelayCwnd " +
 		"TCPACKSkippedSynRecv TCPACKSkippedPAWS TCPACKSkippedSeq " +
 		"TCPACKSkippedFinWait2 TCPACKSkippedTimeWait TCPACKSkippedChallenge " +
-		"TCPWinProbe TCPKeepAlive TCPMTUPFail TCPMTUPSuccess\n")
+		"TCPWinProbe TCPKeepAlive TCPMTUPFail TCPMTUPSuccess"
+
+	stat := inet.StatNetstatTCPExt{}
+	if err := d.stack.Statistics(&stat, "TcpExt"); err != nil {
+		if linuxerr.Equals(linuxerr.EOPNOTSUPP, err) {
+			log.Infof("Failed to retrieve TcpExt of /proc/net/netstat: %v", err)
+		} else {
+			log.Warningf("Failed to retrieve TcpExt of /proc/net/netstat: %v", err)
+		}
+	}
+
+	fmt.Fprintf(buf, "TcpExt: %s\n", tcpExtHeader)
+	buf.WriteString("TcpExt:")
+	// Counters that the stack doesn't keep are reported as 0.
+	for _, name := range strings.Fields(tcpExtHeader) {
+		fmt.Fprintf(buf, " %d", stat[name])
+	}
+	buf.WriteString("\n")
 	return nil
 }
@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/wilinz/gvisor/pkg/abi/linux"
 	"github.com/wilinz/gvisor/pkg/context"
@@ -101,6 +102,12 @@ func (fs *filesystem) newTasksInode(ctx context.Context, k *kernel.Kernel, pidns
 		contents["cgroups"] = fs.newInode(ctx, root, 0444, &cgroupsData{})
 	}
 
+	if len(internalData.NvidiaDriverFiles) != 0 {
+		contents["driver"] = fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
+			"nvidia": fs.newStaticTree(ctx, root, internalData.NvidiaDriverFiles),
+		})
+	}
+
 	fs.newTasksInodeExtra(ctx, root, internalData, k, contents)
 
 	inode := &tasksInode{
@@ -275,6 +282,28 @@ func newStaticFileSetStat(data string) *staticFileSetStat {
 	return &staticFileSetStat{StaticData: vfs.StaticData{Data: data}}
 }
 
+// newStaticTree returns a static directory containing read-only files with
+// the given contents, keyed by slash-separated paths relative to the
+// directory.
+func (fs *filesystem) newStaticTree(ctx context.Context, creds *auth.Credentials, files map[string]string) kernfs.Inode {
+	subdirs := make(map[string]map[string]string)
+	contents := make(map[string]kernfs.Inode)
+	for name, data := range files {
+		if dir, rest, ok := strings.Cut(name, "/"); ok {
+			if subdirs[dir] == nil {
+				subdirs[dir] = make(map[string]string)
+			}
+			subdirs[dir][rest] = data
+			continue
+		}
+		contents[name] = fs.newInode(ctx, creds, 0444, newStaticFile(data))
+	}
+	for dir, subfiles := range subdirs {
+		contents[dir] = fs.newStaticTree(ctx, creds, subfiles)
+	}
+	return fs.newStaticDir(ctx, creds, contents)
+}
+
 func cpuInfoData(k *kernel.Kernel) string {
 	features := k.FeatureSet()
 	var buf bytes.Buffer
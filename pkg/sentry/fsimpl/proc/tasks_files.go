@@ -27,7 +27,6 @@ import (
 	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/kernfs"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
-	"github.com/wilinz/gvisor/pkg/sentry/ktime"
 	"github.com/wilinz/gvisor/pkg/sentry/usage"
 	"github.com/wilinz/gvisor/pkg/sentry/vfs"
 )
@@ -250,11 +249,21 @@ var _ dynamicInode = (*loadavgData)(nil)
 
 // Generate implements vfs.DynamicBytesSource.Generate.
 func (*loadavgData) Generate(ctx context.Context, buf *bytes.Buffer) error {
-	// TODO(b/62345059): Include real data in fields.
-	// Column 1-3: CPU and IO utilization of the last 1, 5, and 10 minute periods.
-	// Column 4-5: currently running processes and the total number of processes.
+	k := kernel.KernelFromContext(ctx)
+	// Column 1-3: load averages of the last 1, 5, and 15 minute periods.
+	// Column 4-5: currently running tasks and the total number of tasks.
 	// Column 6: the last process ID used.
-	fmt.Fprintf(buf, "%.2f %.2f %.2f %d/%d %d\n", 0.00, 0.00, 0.00, 0, 0, 0)
+	for _, load := range k.LoadAvg() {
+		// Round to hundredths as Linux does.
+		load += (1 << kernel.LoadAvgShift) / 200
+		frac := ((load & (1<<kernel.LoadAvgShift - 1)) * 100) >> kernel.LoadAvgShift
+		fmt.Fprintf(buf, "%d.%02d ", load>>kernel.LoadAvgShift, frac)
+	}
+	var last kernel.ThreadID
+	if pidns := kernel.PIDNamespaceFromContext(ctx); pidns != nil {
+		last = pidns.LastID()
+	}
+	fmt.Fprintf(buf, "%d/%d %d\n", k.NumRunningTasks(), k.TaskSet().Root.NumTasks(), last)
 	return nil
 }
 
@@ -269,7 +278,8 @@ var _ dynamicInode = (*meminfoData)(nil)
 
 // Generate implements vfs.DynamicBytesSource.Generate.
 func (*meminfoData) Generate(ctx context.Context, buf *bytes.Buffer) error {
-	mf := kernel.KernelFromContext(ctx).MemoryFile()
+	k := kernel.KernelFromContext(ctx)
+	mf := k.MemoryFile()
 	_ = mf.UpdateUsage(nil) // Best effort
 	snapshot, totalUsage := usage.MemoryAccounting.Copy()
 	totalSize := usage.TotalMemory(mf.TotalSize(), totalUsage)
@@ -309,6 +319,8 @@ func (*meminfoData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	fmt.Fprintf(buf, "AnonPages:      %8d kB\n", anon/1024)
 	fmt.Fprintf(buf, "Mapped:         %8d kB\n", file/1024) // doesn't count mapped tmpfs, which we don't know
 	fmt.Fprintf(buf, "Shmem:          %8d kB\n", snapshot.Tmpfs/1024)
+	fmt.Fprintf(buf, "CommitLimit:    %8d kB\n", mf.CommitLimit(k.VMOvercommitRatio.Load())/1024)
+	fmt.Fprintf(buf, "Committed_AS:   %8d kB\n", mf.Committed()/1024)
 	return nil
 }
 
@@ -324,10 +336,12 @@ var _ dynamicInode = (*uptimeData)(nil)
 // Generate implements vfs.DynamicBytesSource.Generate.
 func (*uptimeData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	k := kernel.KernelFromContext(ctx)
-	now := ktime.NowFromContext(ctx)
+	// Use the monotonic clock rather than the time elapsed since boot on the
+	// realtime clock, which may go backward across save/restore.
+	now := k.MonotonicClock().Now()
 
 	// Pretend that we've spent zero time sleeping (second number).
-	fmt.Fprintf(buf, "%.2f 0.00\n", now.Sub(k.Timekeeper().BootTime()).Seconds())
+	fmt.Fprintf(buf, "%.2f 0.00\n", float64(now.Nanoseconds())/1e9)
 	return nil
 }
 
@@ -19,6 +19,8 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"strconv"
+	"strings"
 
 	"github.com/wilinz/gvisor/pkg/abi/linux"
 	"github.com/wilinz/gvisor/pkg/atomicbitops"
@@ -30,6 +32,8 @@ import (
 	"github.com/wilinz/gvisor/pkg/sentry/inet"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/entropy"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/pipe"
 	"github.com/wilinz/gvisor/pkg/sentry/vfs"
 	"github.com/wilinz/gvisor/pkg/sync"
 	"github.com/wilinz/gvisor/pkg/tcpip/network/ipv4"
@@ -54,7 +58,12 @@ func (fs *filesystem) newSysDir(ctx context.Context, root *auth.Credentials, k *
 			"overflowuid":  fs.newInode(ctx, root, 0444, newStaticFile(fmt.Sprintf("%d\n", auth.OverflowUID))),
 			"pid_max":      fs.newInode(ctx, root, 0644, newStaticFile(fmt.Sprintf("%d\n", kernel.TasksLimit))),
 			"random": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
-				"boot_id": fs.newInode(ctx, root, 0444, newStaticFile(randUUID())),
+				"boot_id":                 fs.newInode(ctx, root, 0444, newStaticFile(randUUID())),
+				"entropy_avail":           fs.newInode(ctx, root, 0444, &entropyAvailData{k: k}),
+				"poolsize":                fs.newInode(ctx, root, 0444, newStaticFile(fmt.Sprintf("%d\n", entropy.PoolSizeBits))),
+				"urandom_min_reseed_secs": fs.newInode(ctx, root, 0644, &atomicInt32File{val: &k.EntropyPool().URandomMinReseedSecs, min: 0, max: math.MaxInt32}),
+				"uuid":                    fs.newInode(ctx, root, 0444, &uuidData{}),
+				"write_wakeup_threshold":  fs.newInode(ctx, root, 0644, &atomicInt32File{val: &k.EntropyPool().WriteWakeupThreshold, min: 0, max: entropy.PoolSizeBits}),
 			}),
 			"sem":    fs.newInode(ctx, root, 0444, newStaticFile(fmt.Sprintf("%d\t%d\t%d\t%d\n", linux.SEMMSL, linux.SEMMNS, linux.SEMOPM, linux.SEMMNI))),
 			"shmall": fs.newInode(ctx, root, 0444, ipcData(linux.SHMALL)),
@@ -68,12 +77,19 @@ func (fs *filesystem) newSysDir(ctx context.Context, root *auth.Credentials, k *
 			}),
 		}),
 		"fs": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
-			"nr_open": fs.newInode(ctx, root, 0644, &atomicInt32File{val: &k.MaxFDLimit, min: 8, max: kernel.MaxFdLimit}),
+			"aio-max-nr":    fs.newInode(ctx, root, 0644, &aioMaxNrData{k: k}),
+			"aio-nr":        fs.newInode(ctx, root, 0444, &aioNrData{k: k}),
+			"file-max":      fs.newInode(ctx, root, 0644, &fileMaxData{k: k}),
+			"file-nr":       fs.newInode(ctx, root, 0444, &fileNrData{k: k}),
+			"nr_open":       fs.newInode(ctx, root, 0644, &atomicInt32File{val: &k.MaxFDLimit, min: 8, max: kernel.MaxFdLimit}),
+			"pipe-max-size": fs.newInode(ctx, root, 0644, &pipeMaxSizeData{k: k}),
 		}),
 		"vm": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
-			"max_map_count":     fs.newInode(ctx, root, 0444, newStaticFile("2147483647\n")),
+			"max_map_count":     fs.newInode(ctx, root, 0644, &atomicInt32File{val: &k.VMMaxMapCount, min: 0, max: math.MaxInt32}),
 			"mmap_min_addr":     fs.newInode(ctx, root, 0444, &mmapMinAddrData{k: k}),
-			"overcommit_memory": fs.newInode(ctx, root, 0444, newStaticFile("0\n")),
+			"overcommit_memory": fs.newInode(ctx, root, 0644, &atomicInt32File{val: &k.VMOvercommitMemory, min: linux.OVERCOMMIT_GUESS, max: linux.OVERCOMMIT_NEVER}),
+			"overcommit_ratio":  fs.newInode(ctx, root, 0644, &atomicInt32File{val: &k.VMOvercommitRatio, min: 0, max: math.MaxInt32}),
+			"swappiness":        fs.newInode(ctx, root, 0644, &atomicInt32File{val: &k.VMSwappiness, min: 0, max: 200}),
 		}),
 		"net": fs.newSysNetDir(ctx, root, k),
 	})
@@ -88,11 +104,16 @@ func (fs *filesystem) newSysNetDir(ctx context.Context, root *auth.Credentials,
 	if stack := k.RootNetworkNamespace().Stack(); stack != nil {
 		contents = map[string]kernfs.Inode{
 			"ipv4": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
-				"ip_forward":          fs.newInode(ctx, root, 0444, &ipForwarding{stack: stack}),
+				"ip_forward":          fs.newInode(ctx, root, 0644, &ipForwarding{stack: stack}),
 				"ip_local_port_range": fs.newInode(ctx, root, 0644, &portRange{stack: stack}),
+				"tcp_fin_timeout":     fs.newInode(ctx, root, 0644, &netSysctlData{stack: stack, sysctl: inet.SysctlTCPFinTimeout}),
+				"tcp_moderate_rcvbuf": fs.newInode(ctx, root, 0644, &netSysctlData{stack: stack, sysctl: inet.SysctlTCPModerateRcvbuf}),
 				"tcp_recovery":        fs.newInode(ctx, root, 0644, &tcpRecoveryData{stack: stack}),
+				"tcp_retries2":        fs.newInode(ctx, root, 0644, &netSysctlData{stack: stack, sysctl: inet.SysctlTCPRetries2}),
 				"tcp_rmem":            fs.newInode(ctx, root, 0644, &tcpMemData{stack: stack, dir: tcpRMem}),
 				"tcp_sack":            fs.newInode(ctx, root, 0644, &tcpSackData{stack: stack}),
+				"tcp_syn_retries":     fs.newInode(ctx, root, 0644, &netSysctlData{stack: stack, sysctl: inet.SysctlTCPSynRetries}),
+				"tcp_syncookies":      fs.newInode(ctx, root, 0644, &tcpSynCookiesData{stack: stack}),
 				"tcp_wmem":            fs.newInode(ctx, root, 0644, &tcpMemData{stack: stack, dir: tcpWMem}),
 
 				// The following files are simple stubs until they are implemented in
@@ -128,11 +149,9 @@ func (fs *filesystem) newSysNetDir(ctx context.Context, root *auth.Credentials,
 				"tcp_probe_interval":        fs.newInode(ctx, root, 0444, newStaticFile("0")),
 				"tcp_probe_threshold":       fs.newInode(ctx, root, 0444, newStaticFile("0")),
 				"tcp_retries1":              fs.newInode(ctx, root, 0444, newStaticFile("3")),
-				"tcp_retries2":              fs.newInode(ctx, root, 0444, newStaticFile("15")),
 				"tcp_rfc1337":               fs.newInode(ctx, root, 0444, newStaticFile("1")),
 				"tcp_slow_start_after_idle": fs.newInode(ctx, root, 0444, newStaticFile("1")),
 				"tcp_synack_retries":        fs.newInode(ctx, root, 0444, newStaticFile("5")),
-				"tcp_syn_retries":           fs.newInode(ctx, root, 0444, newStaticFile("3")),
 				"tcp_timestamps":            fs.newInode(ctx, root, 0444, newStaticFile("1")),
 			}),
 			"core": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
@@ -140,11 +159,11 @@ func (fs *filesystem) newSysNetDir(ctx context.Context, root *auth.Credentials,
 				"message_burst": fs.newInode(ctx, root, 0444, newStaticFile("10")),
 				"message_cost":  fs.newInode(ctx, root, 0444, newStaticFile("5")),
 				"optmem_max":    fs.newInode(ctx, root, 0444, newStaticFile("0")),
-				"rmem_default":  fs.newInode(ctx, root, 0444, newStaticFile("212992")),
-				"rmem_max":      fs.newInode(ctx, root, 0444, newStaticFile("212992")),
-				"somaxconn":     fs.newInode(ctx, root, 0444, newStaticFile("128")),
-				"wmem_default":  fs.newInode(ctx, root, 0444, newStaticFile("212992")),
-				"wmem_max":      fs.newInode(ctx, root, 0444, newStaticFile("212992")),
+				"rmem_default":  fs.newInode(ctx, root, 0644, &netSysctlData{stack: stack, sysctl: inet.SysctlRmemDefault}),
+				"rmem_max":      fs.newInode(ctx, root, 0644, &netSysctlData{stack: stack, sysctl: inet.SysctlRmemMax}),
+				"somaxconn":     fs.newInode(ctx, root, 0644, &netSysctlData{stack: stack, sysctl: inet.SysctlSomaxconn}),
+				"wmem_default":  fs.newInode(ctx, root, 0644, &netSysctlData{stack: stack, sysctl: inet.SysctlWmemDefault}),
+				"wmem_max":      fs.newInode(ctx, root, 0644, &netSysctlData{stack: stack, sysctl: inet.SysctlWmemMax}),
 			}),
 		}
 	}
@@ -280,6 +299,92 @@ func (d *tcpRecoveryData) Write(ctx context.Context, _ *vfs.FileDescription, src
 	return n, nil
 }
 
+// tcpSynCookiesData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/net/ipv4/tcp_syncookies.
+//
+// +stateify savable
+type tcpSynCookiesData struct {
+	kernfs.DynamicBytesFile
+
+	stack inet.Stack `state:"wait"`
+}
+
+var _ vfs.WritableDynamicBytesSource = (*tcpSynCookiesData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *tcpSynCookiesData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	v, err := d.stack.TCPSynCookies()
+	if err != nil {
+		return err
+	}
+
+	_, err = buf.WriteString(fmt.Sprintf("%d\n", v))
+	return err
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *tcpSynCookiesData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, linuxerr.EINVAL
+	}
+	buf := make([]int32, 1)
+	n, err := ParseInt32Vec(ctx, src, buf)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	// Like Linux, only 0 (never), 1 (on SYN backlog overflow) and 2
+	// (always) are accepted.
+	if buf[0] < 0 || buf[0] > 2 {
+		return 0, linuxerr.EINVAL
+	}
+	if err := d.stack.SetTCPSynCookies(buf[0]); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// netSysctlData implements vfs.WritableDynamicBytesSource for the sysctls
+// under /proc/sys/net that map to an integer option of the network stack.
+//
+// +stateify savable
+type netSysctlData struct {
+	kernfs.DynamicBytesFile
+
+	stack  inet.Stack `state:"wait"`
+	sysctl inet.Sysctl
+}
+
+var _ vfs.WritableDynamicBytesSource = (*netSysctlData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *netSysctlData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	v, err := d.stack.Sysctl(d.sysctl)
+	if err != nil {
+		return err
+	}
+
+	_, err = buf.WriteString(fmt.Sprintf("%d\n", v))
+	return err
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *netSysctlData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, linuxerr.EINVAL
+	}
+	buf := make([]int32, 1)
+	n, err := ParseInt32Vec(ctx, src, buf)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	if err := d.stack.SetSysctl(d.sysctl, int64(buf[0])); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
 // tcpMemData implements vfs.WritableDynamicBytesSource for
 // /proc/sys/net/ipv4/tcp_rmem and /proc/sys/net/ipv4/tcp_wmem.
 //
@@ -504,6 +609,179 @@ func (f *atomicInt32File) Write(ctx context.Context, _ *vfs.FileDescription, src
 	return n, nil
 }
 
+// fileMaxData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/fs/file-max.
+//
+// +stateify savable
+type fileMaxData struct {
+	kernfs.DynamicBytesFile
+
+	k *kernel.Kernel
+}
+
+var _ vfs.WritableDynamicBytesSource = (*fileMaxData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *fileMaxData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	fmt.Fprintf(buf, "%d\n", d.k.VFS().MaxOpenFiles())
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *fileMaxData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// Ignore partial writes.
+		return 0, linuxerr.EINVAL
+	}
+	v, n, err := parseUint64(ctx, src)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	if v > math.MaxInt64 {
+		return 0, linuxerr.EINVAL
+	}
+	d.k.VFS().SetMaxOpenFiles(v)
+	return n, nil
+}
+
+// fileNrData implements vfs.DynamicBytesSource for /proc/sys/fs/file-nr.
+//
+// +stateify savable
+type fileNrData struct {
+	kernfs.DynamicBytesFile
+
+	k *kernel.Kernel
+}
+
+var _ dynamicInode = (*fileNrData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *fileNrData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	// Like Linux since 2.6, the number of free file handles is always 0.
+	fmt.Fprintf(buf, "%d\t0\t%d\n", d.k.VFS().OpenFiles(), d.k.VFS().MaxOpenFiles())
+	return nil
+}
+
+// pipeMaxSizeData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/fs/pipe-max-size.
+//
+// +stateify savable
+type pipeMaxSizeData struct {
+	kernfs.DynamicBytesFile
+
+	k *kernel.Kernel
+}
+
+var _ vfs.WritableDynamicBytesSource = (*pipeMaxSizeData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *pipeMaxSizeData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	fmt.Fprintf(buf, "%d\n", d.k.PipeMaxSize.Load())
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *pipeMaxSizeData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// Ignore partial writes.
+		return 0, linuxerr.EINVAL
+	}
+	v, n, err := parseUint64(ctx, src)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	if v > pipe.MaximumPipeSizeLimit {
+		return 0, linuxerr.EINVAL
+	}
+	// Like Linux, round the size up to a power of two number of pages. See
+	// kernel/sysctl.c:do_proc_dopipe_max_size_conv.
+	d.k.PipeMaxSize.Store(int32(pipe.RoundPipeSize(int64(v))))
+	return n, nil
+}
+
+// aioMaxNrData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/fs/aio-max-nr.
+//
+// +stateify savable
+type aioMaxNrData struct {
+	kernfs.DynamicBytesFile
+
+	k *kernel.Kernel
+}
+
+var _ vfs.WritableDynamicBytesSource = (*aioMaxNrData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *aioMaxNrData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	fmt.Fprintf(buf, "%d\n", d.k.AIOEvents.Max.Load())
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *aioMaxNrData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// Ignore partial writes.
+		return 0, linuxerr.EINVAL
+	}
+	v, n, err := parseUint64(ctx, src)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	d.k.AIOEvents.Max.Store(v)
+	return n, nil
+}
+
+// aioNrData implements vfs.DynamicBytesSource for /proc/sys/fs/aio-nr.
+//
+// +stateify savable
+type aioNrData struct {
+	kernfs.DynamicBytesFile
+
+	k *kernel.Kernel
+}
+
+var _ dynamicInode = (*aioNrData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *aioNrData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	fmt.Fprintf(buf, "%d\n", d.k.AIOEvents.Count())
+	return nil
+}
+
+// entropyAvailData implements vfs.DynamicBytesSource for
+// /proc/sys/kernel/random/entropy_avail.
+//
+// +stateify savable
+type entropyAvailData struct {
+	kernfs.DynamicBytesFile
+
+	k *kernel.Kernel
+}
+
+var _ dynamicInode = (*entropyAvailData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *entropyAvailData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	fmt.Fprintf(buf, "%d\n", d.k.EntropyPool().EntropyAvail())
+	return nil
+}
+
+// uuidData implements vfs.DynamicBytesSource for
+// /proc/sys/kernel/random/uuid, which generates a new UUID on each read.
+//
+// +stateify savable
+type uuidData struct {
+	kernfs.DynamicBytesFile
+}
+
+var _ dynamicInode = (*uuidData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (*uuidData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	buf.WriteString(randUUID())
+	return nil
+}
+
 // randUUID returns a string containing a randomly-generated UUID followed by a
 // newline.
 func randUUID() string {
@@ -529,3 +807,23 @@ func ParseInt32Vec(ctx context.Context, src usermem.IOSequence, buf []int32) (in
 
 	return usermem.CopyInt32StringsInVec(ctx, src.IO, src.Addrs, buf, src.Opts)
 }
+
+// parseUint64 interprets src as a string encoding of a uint64, and returns the
+// parsed value and the number of bytes read.
+func parseUint64(ctx context.Context, src usermem.IOSequence) (uint64, int64, error) {
+	if src.NumBytes() == 0 {
+		return 0, 0, nil
+	}
+	// Limit input size so as not to impact performance if input size is large.
+	src = src.TakeFirst(hostarch.PageSize - 1)
+	buf := make([]byte, src.NumBytes())
+	n, err := src.CopyIn(ctx, buf)
+	if err != nil {
+		return 0, 0, err
+	}
+	v, err := strconv.ParseUint(strings.TrimSpace(string(buf[:n])), 10, 64)
+	if err != nil {
+		return 0, 0, linuxerr.EINVAL
+	}
+	return v, int64(n), nil
+}
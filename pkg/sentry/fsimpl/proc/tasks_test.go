@@ -71,6 +71,7 @@ var (
 		"thread-self": threadSelfLink.NextOff,
 	}
 	taskStaticFiles = map[string]testutil.DirentType{
+		"attr":          linux.DT_DIR,
 		"auxv":          linux.DT_REG,
 		"cgroup":        linux.DT_REG,
 		"cwd":           linux.DT_LNK,
@@ -102,6 +103,15 @@ var (
 )
 
 func setup(t *testing.T) *testutil.System {
+	return setupWithInternalData(t, &InternalData{
+		Cgroups: map[string]string{
+			"cpuset": "/foo/cpuset",
+			"memory": "/foo/memory",
+		},
+	})
+}
+
+func setupWithInternalData(t *testing.T, internalData *InternalData) *testutil.System {
 	k, err := testutil.Boot()
 	if err != nil {
 		t.Fatalf("Error creating kernel: %v", err)
@@ -136,12 +146,7 @@ func setup(t *testing.T) *testutil.System {
 	}
 	mntOpts := &vfs.MountOptions{
 		GetFilesystemOptions: vfs.GetFilesystemOptions{
-			InternalData: &InternalData{
-				Cgroups: map[string]string{
-					"cpuset": "/foo/cpuset",
-					"memory": "/foo/memory",
-				},
-			},
+			InternalData: internalData,
 		},
 	}
 	if _, err := k.VFS().MountAt(ctx, creds, "", pop, Name, mntOpts); err != nil {
@@ -159,6 +164,54 @@ func TestTasksEmpty(t *testing.T) {
 	s.AssertDirentOffsets(collector, tasksStaticFilesNextOffs)
 }
 
+func TestNvidiaDriverFiles(t *testing.T) {
+	files := map[string]string{
+		"version":                              "NVRM version: NVIDIA UNIX x86_64 Kernel Module  550.54.15\nGCC version:  gcc version 12.2.0\n",
+		"gpus/0000:00:04.0/information":        "Model: \t\t NVIDIA A100-SXM4-40GB\nDevice Minor: \t 0\n",
+		"capabilities/mig/config":              "DeviceFileMinor: 1\nDeviceFileMode: 256\nDeviceFileModify: 1\n",
+		"capabilities/mig/monitor":             "DeviceFileMinor: 2\nDeviceFileMode: 292\nDeviceFileModify: 1\n",
+		"capabilities/gpu0/mig/gi1/access":     "DeviceFileMinor: 12\nDeviceFileMode: 292\nDeviceFileModify: 1\n",
+		"capabilities/gpu0/mig/gi1/ci0/access": "DeviceFileMinor: 13\nDeviceFileMode: 292\nDeviceFileModify: 1\n",
+		"capabilities/gpu0/mig/gi2/ci0/access": "DeviceFileMinor: 22\nDeviceFileMode: 292\nDeviceFileModify: 1\n",
+	}
+	s := setupWithInternalData(t, &InternalData{NvidiaDriverFiles: files})
+	defer s.Destroy()
+
+	collector := s.ListDirents(s.PathOpAtRoot("/proc/driver/nvidia"))
+	s.AssertAllDirentTypes(collector, map[string]testutil.DirentType{
+		"version":      linux.DT_REG,
+		"gpus":         linux.DT_DIR,
+		"capabilities": linux.DT_DIR,
+	})
+	collector = s.ListDirents(s.PathOpAtRoot("/proc/driver/nvidia/capabilities/gpu0/mig"))
+	s.AssertAllDirentTypes(collector, map[string]testutil.DirentType{
+		"gi1": linux.DT_DIR,
+		"gi2": linux.DT_DIR,
+	})
+
+	for name, want := range files {
+		fd, err := s.VFS.OpenAt(s.Ctx, s.Creds, s.PathOpAtRoot(path.Join("/proc/driver/nvidia", name)), &vfs.OpenOptions{})
+		if err != nil {
+			t.Errorf("OpenAt(%q): %v", name, err)
+			continue
+		}
+		got, err := s.ReadToEnd(fd)
+		fd.DecRef(s.Ctx)
+		if err != nil {
+			t.Errorf("ReadToEnd(%q): %v", name, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("got %q contents %q, want %q", name, got, want)
+		}
+	}
+
+	// The files must be read-only.
+	if _, err := s.VFS.OpenAt(s.Ctx, s.Creds, s.PathOpAtRoot("/proc/driver/nvidia/version"), &vfs.OpenOptions{Flags: linux.O_WRONLY}); err == nil {
+		t.Errorf("OpenAt(version, O_WRONLY) succeeded, want error")
+	}
+}
+
 func TestTasks(t *testing.T) {
 	s := setup(t)
 	defer s.Destroy()
@@ -0,0 +1,638 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package squashfs implements a read-only squashfs filesystem backed by a
+// block device.
+package squashfs
+
+import (
+	"runtime"
+	"strings"
+	"sync/atomic"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/cleanup"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/fspath"
+	"github.com/wilinz/gvisor/pkg/sentry/fsutil"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
+	"github.com/wilinz/gvisor/pkg/sentry/memmap"
+	"github.com/wilinz/gvisor/pkg/sentry/pgalloc"
+	"github.com/wilinz/gvisor/pkg/sentry/vfs"
+	"github.com/wilinz/gvisor/pkg/squashfs"
+	"github.com/wilinz/gvisor/pkg/sync"
+)
+
+// Name is the filesystem name. It is part of the interface used by users,
+// e.g. via annotations, and shouldn't change.
+const Name = "squashfs"
+
+// FilesystemType implements vfs.FilesystemType.
+//
+// +stateify savable
+type FilesystemType struct{}
+
+// filesystem implements vfs.FilesystemImpl.
+//
+// +stateify savable
+type filesystem struct {
+	vfsfs vfs.Filesystem
+
+	// mopts contains the filesystem's mount options. mopts is immutable.
+	mopts string
+
+	// devMinor is the filesystem's minor device number. devMinor is immutable.
+	devMinor uint32
+
+	// root is the root dentry. root is immutable.
+	root *dentry
+
+	// dev is the block device containing the image. dev is immutable.
+	dev vfs.BlockDeviceFile
+
+	// image is the squashfs image. image is immutable.
+	image *squashfs.Image
+
+	// mf is used to allocate the page cache of mapped regular files. mf is
+	// immutable.
+	mf *pgalloc.MemoryFile `state:"nosave"`
+
+	// inodeBuckets contains the inodes in use. Multiple buckets are used to
+	// reduce the lock contention. Bucket is chosen based on the hash calculation
+	// on the inode's location in the inode table in filesystem.inodeBucket.
+	inodeBuckets []inodeBucket
+
+	// ancestryMu is required by genericfstree.
+	ancestryMu sync.RWMutex `state:"nosave"`
+}
+
+// Name implements vfs.FilesystemType.Name.
+func (FilesystemType) Name() string {
+	return Name
+}
+
+// Release implements vfs.FilesystemType.Release.
+func (FilesystemType) Release(ctx context.Context) {}
+
+// GetFilesystem implements vfs.FilesystemType.GetFilesystem.
+func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.VirtualFilesystem, creds *auth.Credentials, source string, opts vfs.GetFilesystemOptions) (*vfs.Filesystem, *vfs.Dentry, error) {
+	var cu cleanup.Cleanup
+	defer cu.Clean()
+
+	dev, err := openSource(ctx, vfsObj, creds, source)
+	if err != nil {
+		return nil, nil, err
+	}
+	cu.Add(func() { dev.Release(ctx) })
+
+	size, err := dev.Size(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	image, err := squashfs.OpenImage(&deviceReader{dev: dev}, size)
+	if err != nil {
+		ctx.Infof("squashfs.FilesystemType.GetFilesystem: failed to open image on %q: %v", source, err)
+		return nil, nil, linuxerr.EINVAL
+	}
+
+	devMinor, err := vfsObj.GetAnonBlockDevMinor()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fs := &filesystem{
+		mopts:    opts.Data,
+		devMinor: devMinor,
+		dev:      dev,
+		image:    image,
+		mf:       pgalloc.MemoryFileFromContext(ctx),
+	}
+	fs.vfsfs.Init(vfsObj, &fstype, fs)
+	cu.Release()
+	// From now on, fs.Release() releases dev.
+	cu.Add(func() { fs.vfsfs.DecRef(ctx) })
+
+	fs.inodeBuckets = make([]inodeBucket, runtime.GOMAXPROCS(0))
+	for i := range fs.inodeBuckets {
+		fs.inodeBuckets[i].init()
+	}
+
+	root, err := fs.newDentry(image.SuperBlock().RootInode)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !root.inode.IsDir() {
+		root.DecRef(ctx)
+		return nil, nil, linuxerr.EUCLEAN
+	}
+
+	// Increase the root's reference count to 2. One reference is returned to
+	// the caller, and the other is held by fs.
+	root.IncRef()
+	fs.root = root
+
+	cu.Release()
+	return &fs.vfsfs, &root.vfsd, nil
+}
+
+// openSource opens the block device at the absolute path source.
+func openSource(ctx context.Context, vfsObj *vfs.VirtualFilesystem, creds *auth.Credentials, source string) (vfs.BlockDeviceFile, error) {
+	if source == "" {
+		return nil, linuxerr.ENOTBLK
+	}
+	path := fspath.Parse(source)
+	if !path.Absolute {
+		ctx.Infof("squashfs.FilesystemType.GetFilesystem: source %q must be absolute", source)
+		return nil, linuxerr.EINVAL
+	}
+	vfsroot := vfs.RootFromContext(ctx)
+	if vfsroot.Ok() {
+		defer vfsroot.DecRef(ctx)
+	}
+	return vfsObj.OpenBlockDeviceAt(ctx, creds, &vfs.PathOperation{
+		Root:               vfsroot,
+		Start:              vfsroot,
+		Path:               path,
+		FollowFinalSymlink: true,
+	})
+}
+
+// deviceReader implements io.ReaderAt for a vfs.BlockDeviceFile.
+//
+// +stateify savable
+type deviceReader struct {
+	dev vfs.BlockDeviceFile
+}
+
+// ReadAt implements io.ReaderAt.ReadAt.
+func (r *deviceReader) ReadAt(dst []byte, off int64) (int, error) {
+	return r.dev.ReadAt(context.Background(), dst, off)
+}
+
+// Release implements vfs.FilesystemImpl.Release.
+func (fs *filesystem) Release(ctx context.Context) {
+	// An extra reference was held by the filesystem on the root.
+	if fs.root != nil {
+		fs.root.DecRef(ctx)
+	}
+	fs.dev.Release(ctx)
+	fs.vfsfs.VirtualFilesystem().PutAnonBlockDevMinor(fs.devMinor)
+}
+
+func (fs *filesystem) statFS() linux.Statfs {
+	sb := fs.image.SuperBlock()
+	blockSize := int64(fs.image.BlockSize())
+	return linux.Statfs{
+		Type:         squashfs.SuperBlockMagic,
+		NameLength:   squashfs.MaxNameLen,
+		BlockSize:    blockSize,
+		FragmentSize: blockSize,
+		Blocks:       fs.image.Blocks(),
+		Files:        uint64(sb.InodeCount),
+		Flags:        linux.ST_RDONLY,
+	}
+}
+
+// +stateify savable
+type inodeBucket struct {
+	// mu protects inodeMap.
+	mu sync.RWMutex `state:"nosave"`
+
+	// inodeMap contains the inodes indexed by their location in the inode
+	// table.
+	// +checklocks:mu
+	inodeMap map[uint64]*inode
+}
+
+func (ib *inodeBucket) init() {
+	ib.inodeMap = make(map[uint64]*inode) // +checklocksignore
+}
+
+// getInode returns the inode identified by ref. A reference on inode is also
+// returned to caller.
+func (ib *inodeBucket) getInode(ref uint64) *inode {
+	ib.mu.RLock()
+	defer ib.mu.RUnlock()
+	i := ib.inodeMap[ref]
+	if i != nil {
+		i.IncRef()
+	}
+	return i
+}
+
+// addInode adds the inode identified by ref into the bucket. It will first
+// check whether the old inode exists. If not, it will call newInode() to get
+// the new inode. The inode eventually saved in the bucket will be returned
+// with a reference for caller.
+func (ib *inodeBucket) addInode(ref uint64, newInode func() *inode) *inode {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	if i, ok := ib.inodeMap[ref]; ok {
+		i.IncRef()
+		return i
+	}
+	i := newInode()
+	ib.inodeMap[ref] = i
+	return i
+}
+
+// removeInode removes the inode identified by ref.
+func (ib *inodeBucket) removeInode(ref uint64) {
+	ib.mu.Lock()
+	delete(ib.inodeMap, ref)
+	ib.mu.Unlock()
+}
+
+func (fs *filesystem) inodeBucket(ref uint64) *inodeBucket {
+	bucket := ref % uint64(len(fs.inodeBuckets))
+	return &fs.inodeBuckets[bucket]
+}
+
+// inode represents a filesystem object.
+//
+// Each dentry holds a reference on the inode it represents. An inode will
+// be dropped once its reference count reaches zero. We do not cache inodes
+// directly. The caching policy is implemented on top of dentries.
+//
+// +stateify savable
+type inode struct {
+	squashfs.Inode
+
+	// inodeRefs is the reference count.
+	inodeRefs
+
+	// fs is the owning filesystem.
+	fs *filesystem
+
+	// dirMu protects dirents. dirents is immutable after creation.
+	dirMu sync.RWMutex `state:"nosave"`
+	// +checklocks:dirMu
+	dirents []vfs.Dirent `state:"nosave"`
+
+	// mapsMu protects mappings.
+	mapsMu sync.Mutex `state:"nosave"`
+
+	// mappings tracks the mappings of the file into memmap.MappingSpaces
+	// if this inode represents a regular file.
+	// +checklocks:mapsMu
+	mappings memmap.MappingSet
+
+	// dataMu protects cache.
+	dataMu sync.Mutex `state:"nosave"`
+
+	// cache caches the contents of mapped regular files. Since the
+	// filesystem is read-only, cached pages are never dirty.
+	// +checklocks:dataMu
+	cache fsutil.FileRangeSet
+
+	// locks supports POSIX and BSD style locks.
+	locks vfs.FileLocks
+
+	// Inotify watches for this inode.
+	watches vfs.Watches
+}
+
+// getInode returns the inode identified by ref, its location in the inode
+// table. A reference on inode is also returned to caller.
+func (fs *filesystem) getInode(ref uint64) (*inode, error) {
+	bucket := fs.inodeBucket(ref)
+
+	// Fast path, inode already exists.
+	if i := bucket.getInode(ref); i != nil {
+		return i, nil
+	}
+
+	// Slow path, create a new inode.
+	//
+	// Construct the underlying inode object from the image without taking
+	// the bucket lock first to reduce the contention.
+	in, err := fs.image.Inode(ref)
+	if err != nil {
+		return nil, err
+	}
+	return bucket.addInode(ref, func() *inode {
+		i := &inode{
+			Inode: in,
+			fs:    fs,
+		}
+		i.InitRefs()
+		return i
+	}), nil
+}
+
+// DecRef should be called when you're finished with an inode.
+func (i *inode) DecRef(ctx context.Context) {
+	i.inodeRefs.DecRef(func() {
+		ref := i.Ref()
+		i.fs.inodeBucket(ref).removeInode(ref)
+		// Discard cached data.
+		i.dataMu.Lock()
+		if !i.cache.IsEmpty() {
+			i.fs.mf.MarkAllUnevictable(i)
+			i.cache.DropAll(i.fs.mf)
+		}
+		i.dataMu.Unlock()
+	})
+}
+
+func (i *inode) checkPermissions(creds *auth.Credentials, ats vfs.AccessTypes) error {
+	return vfs.GenericCheckPermissions(creds, ats, linux.FileMode(i.Mode()), auth.KUID(i.UID()), auth.KGID(i.GID()))
+}
+
+func (i *inode) statTo(stat *linux.Statx) {
+	stat.Mask = linux.STATX_TYPE | linux.STATX_MODE | linux.STATX_NLINK |
+		linux.STATX_UID | linux.STATX_GID | linux.STATX_INO | linux.STATX_SIZE |
+		linux.STATX_BLOCKS | linux.STATX_ATIME | linux.STATX_CTIME |
+		linux.STATX_MTIME
+	stat.Blksize = i.fs.image.BlockSize()
+	stat.Nlink = i.Nlink()
+	stat.UID = i.UID()
+	stat.GID = i.GID()
+	stat.Mode = i.Mode()
+	stat.Ino = uint64(i.Ino())
+	stat.Size = i.Size()
+	stat.Blocks = i.Blocks()
+	// Squashfs only records the modification time, which Linux also reports
+	// as the access and change times.
+	mtime := linux.StatxTimestamp{Sec: int64(i.Mtime())}
+	stat.Atime = mtime
+	stat.Ctime = mtime
+	stat.Mtime = mtime
+	switch i.fileType() {
+	case linux.S_IFCHR, linux.S_IFBLK:
+		major, minor := linux.DecodeDeviceID(i.DeviceNumber())
+		stat.RdevMajor = uint32(major)
+		stat.RdevMinor = minor
+	}
+	stat.DevMajor = linux.UNNAMED_MAJOR
+	stat.DevMinor = i.fs.devMinor
+}
+
+func (i *inode) fileType() uint16 {
+	return i.Mode() & linux.S_IFMT
+}
+
+func (i *inode) listXattr(creds *auth.Credentials, size uint64) ([]string, error) {
+	all, err := i.ListXattrs()
+	if err != nil {
+		return nil, err
+	}
+	// Hide extended attributes in the "trusted" namespace from non-privileged
+	// users, and keep track of the size of the buffer needed in
+	// listxattr(2) for the list.
+	listSize := 0
+	names := make([]string, 0, len(all))
+	haveCap := creds.HasCapability(linux.CAP_SYS_ADMIN)
+	for _, n := range all {
+		if !haveCap && strings.HasPrefix(n, linux.XATTR_TRUSTED_PREFIX) {
+			continue
+		}
+		names = append(names, n)
+		listSize += len(n) + 1
+	}
+	if size != 0 && uint64(listSize) > size {
+		return nil, linuxerr.ERANGE
+	}
+	return names, nil
+}
+
+func (i *inode) getXattr(creds *auth.Credentials, opts *vfs.GetXattrOptions) (string, error) {
+	mode := linux.FileMode(i.Mode())
+	kuid := auth.KUID(i.UID())
+	kgid := auth.KGID(i.GID())
+	if err := vfs.GenericCheckPermissions(creds, vfs.MayRead, mode, kuid, kgid); err != nil {
+		return "", err
+	}
+	if err := vfs.CheckXattrPermissions(creds, vfs.MayRead, mode, kuid, opts.Name); err != nil {
+		return "", err
+	}
+	val, err := i.Xattr(opts.Name)
+	if err != nil {
+		return "", err
+	}
+	// Check that the size of the buffer provided in getxattr(2) is large
+	// enough to contain the value.
+	if opts.Size != 0 && uint64(len(val)) > opts.Size {
+		return "", linuxerr.ERANGE
+	}
+	return string(val), nil
+}
+
+// dentry implements vfs.DentryImpl.
+//
+// The filesystem is read-only and currently we never drop the cached dentries
+// until the filesystem is unmounted. The reference model works like this:
+//
+//   - The initial reference count of each dentry is one, which is the reference
+//     held by the parent (so when the reference count is one, it also means that
+//     this is a cached dentry, i.e. not in use).
+//
+//   - When a dentry is used (e.g. opened by someone), its reference count will
+//     be increased and the new reference is held by caller.
+//
+//   - The reference count of root dentry is two. One reference is returned to
+//     the caller of `GetFilesystem()`, and the other is held by `fs`.
+//
+// +stateify savable
+type dentry struct {
+	vfsd vfs.Dentry
+
+	// dentryRefs is the reference count.
+	dentryRefs
+
+	// parent is this dentry's parent directory. If this dentry is
+	// a file system root, parent is nil.
+	parent atomic.Pointer[dentry] `state:".(*dentry)"`
+
+	// name is this dentry's name in its parent. If this dentry is
+	// a file system root, name is the empty string.
+	name string
+
+	// inode is the inode represented by this dentry.
+	inode *inode
+
+	// dirMu serializes changes to the dentry tree.
+	dirMu sync.RWMutex `state:"nosave"`
+
+	// childMap contains the mappings of child names to dentries if this
+	// dentry represents a directory.
+	// +checklocks:dirMu
+	childMap map[string]*dentry
+}
+
+// The caller is expected to handle dentry insertion into dentry tree.
+func (fs *filesystem) newDentry(ref uint64) (*dentry, error) {
+	i, err := fs.getInode(ref)
+	if err != nil {
+		return nil, err
+	}
+	d := &dentry{
+		inode: i,
+	}
+	d.InitRefs()
+	d.vfsd.Init(d)
+	return d, nil
+}
+
+// DecRef implements vfs.DentryImpl.DecRef.
+func (d *dentry) DecRef(ctx context.Context) {
+	d.dentryRefs.DecRef(func() {
+		d.dirMu.Lock()
+		for _, c := range d.childMap {
+			c.DecRef(ctx)
+		}
+		d.childMap = nil
+		d.dirMu.Unlock()
+		d.inode.DecRef(ctx)
+	})
+}
+
+// InotifyWithParent implements vfs.DentryImpl.InotifyWithParent.
+func (d *dentry) InotifyWithParent(ctx context.Context, events, cookie uint32, et vfs.EventType) {
+	if d.inode.IsDir() {
+		events |= linux.IN_ISDIR
+	}
+	// The ordering below is important, Linux always notifies the parent first.
+	if parent := d.parent.Load(); parent != nil {
+		parent.inode.watches.Notify(ctx, d.name, events, cookie, et, false)
+	}
+	d.inode.watches.Notify(ctx, "", events, cookie, et, false)
+}
+
+// Watches implements vfs.DentryImpl.Watches.
+func (d *dentry) Watches() *vfs.Watches {
+	return &d.inode.watches
+}
+
+// OnZeroWatches implements vfs.DentryImpl.OnZeroWatches.
+func (d *dentry) OnZeroWatches(ctx context.Context) {}
+
+func (d *dentry) open(ctx context.Context, rp *vfs.ResolvingPath, opts *vfs.OpenOptions) (*vfs.FileDescription, error) {
+	ats := vfs.AccessTypesForOpenFlags(opts)
+	if err := d.inode.checkPermissions(rp.Credentials(), ats); err != nil {
+		return nil, err
+	}
+
+	switch d.inode.fileType() {
+	case linux.S_IFREG:
+		if ats&vfs.MayWrite != 0 {
+			return nil, linuxerr.EROFS
+		}
+		var fd regularFileFD
+		fd.LockFD.Init(&d.inode.locks)
+		if err := fd.vfsfd.Init(&fd, opts.Flags, rp.Mount(), &d.vfsd, &vfs.FileDescriptionOptions{AllowDirectIO: true}); err != nil {
+			return nil, err
+		}
+		return &fd.vfsfd, nil
+
+	case linux.S_IFDIR:
+		// Can't open directories with O_CREAT.
+		if opts.Flags&linux.O_CREAT != 0 {
+			return nil, linuxerr.EISDIR
+		}
+		// Can't open directories writably.
+		if ats&vfs.MayWrite != 0 {
+			return nil, linuxerr.EISDIR
+		}
+		if opts.Flags&linux.O_DIRECT != 0 {
+			return nil, linuxerr.EINVAL
+		}
+		var fd directoryFD
+		fd.LockFD.Init(&d.inode.locks)
+		if err := fd.vfsfd.Init(&fd, opts.Flags, rp.Mount(), &d.vfsd, &vfs.FileDescriptionOptions{AllowDirectIO: true}); err != nil {
+			return nil, err
+		}
+		return &fd.vfsfd, nil
+
+	case linux.S_IFLNK:
+		// Can't open symlinks without O_PATH, which is handled at the VFS layer.
+		return nil, linuxerr.ELOOP
+
+	case linux.S_IFCHR, linux.S_IFBLK:
+		kind := vfs.CharDevice
+		if d.inode.fileType() == linux.S_IFBLK {
+			kind = vfs.BlockDevice
+		}
+		major, minor := linux.DecodeDeviceID(d.inode.DeviceNumber())
+		return rp.VirtualFilesystem().OpenDeviceSpecialFile(ctx, rp.Mount(), &d.vfsd, kind, uint32(major), minor, opts)
+
+	default:
+		return nil, linuxerr.ENXIO
+	}
+}
+
+// +stateify savable
+type fileDescription struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.LockFD
+}
+
+func (fd *fileDescription) filesystem() *filesystem {
+	return fd.vfsfd.Mount().Filesystem().Impl().(*filesystem)
+}
+
+func (fd *fileDescription) dentry() *dentry {
+	return fd.vfsfd.Dentry().Impl().(*dentry)
+}
+
+func (fd *fileDescription) inode() *inode {
+	return fd.dentry().inode
+}
+
+// Stat implements vfs.FileDescriptionImpl.Stat.
+func (fd *fileDescription) Stat(ctx context.Context, opts vfs.StatOptions) (linux.Statx, error) {
+	var stat linux.Statx
+	fd.inode().statTo(&stat)
+	return stat, nil
+}
+
+// SetStat implements vfs.FileDescriptionImpl.SetStat.
+func (fd *fileDescription) SetStat(ctx context.Context, opts vfs.SetStatOptions) error {
+	return linuxerr.EROFS
+}
+
+// StatFS implements vfs.FileDescriptionImpl.StatFS.
+func (fd *fileDescription) StatFS(ctx context.Context) (linux.Statfs, error) {
+	return fd.filesystem().statFS(), nil
+}
+
+// ListXattr implements vfs.FileDescriptionImpl.ListXattr.
+func (fd *fileDescription) ListXattr(ctx context.Context, size uint64) ([]string, error) {
+	return fd.inode().listXattr(auth.CredentialsFromContext(ctx), size)
+}
+
+// GetXattr implements vfs.FileDescriptionImpl.GetXattr.
+func (fd *fileDescription) GetXattr(ctx context.Context, opts vfs.GetXattrOptions) (string, error) {
+	return fd.inode().getXattr(auth.CredentialsFromContext(ctx), &opts)
+}
+
+// SetXattr implements vfs.FileDescriptionImpl.SetXattr.
+func (fd *fileDescription) SetXattr(ctx context.Context, opts vfs.SetXattrOptions) error {
+	return linuxerr.EROFS
+}
+
+// RemoveXattr implements vfs.FileDescriptionImpl.RemoveXattr.
+func (fd *fileDescription) RemoveXattr(ctx context.Context, name string) error {
+	return linuxerr.EROFS
+}
+
+// Sync implements vfs.FileDescriptionImpl.Sync.
+func (*fileDescription) Sync(context.Context) error {
+	return nil
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (*fileDescription) Release(ctx context.Context) {}
@@ -32,6 +32,7 @@ import (
 	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/kernfs"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
+	"github.com/wilinz/gvisor/pkg/sentry/lsm"
 	"github.com/wilinz/gvisor/pkg/sentry/vfs"
 )
 
@@ -196,7 +197,7 @@ func (fsType FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		"firmware": fs.newDir(ctx, creds, defaultSysDirMode, nil),
 		"fs":       fs.newDir(ctx, creds, defaultSysDirMode, fsDirChildren),
 		"kernel":   fs.newDir(ctx, creds, defaultSysDirMode, kernelSub),
-		"module":   fs.newDir(ctx, creds, defaultSysDirMode, nil),
+		"module":   fs.newDir(ctx, creds, defaultSysDirMode, moduleDir(ctx, fs, creds)),
 		"power":    fs.newDir(ctx, creds, defaultSysDirMode, nil),
 	})
 	var rootD kernfs.Dentry
@@ -321,6 +322,38 @@ func kernelDir(ctx context.Context, fs *filesystem, creds *auth.Credentials) map
 			"kcov": fs.newKcovFile(ctx, creds),
 		})
 	}
+	children["security"] = fs.newDir(ctx, creds, defaultSysDirMode, securityDir(ctx, fs, creds))
+	return children
+}
+
+// securityDir returns the contents of /sys/kernel/security, where securityfs
+// is normally mounted, describing the installed LSM.
+func securityDir(ctx context.Context, fs *filesystem, creds *auth.Credentials) map[string]kernfs.Inode {
+	lsms := "capability"
+	children := make(map[string]kernfs.Inode)
+	if name := lsm.Name(); name != "" {
+		lsms += "," + name
+		if name == "apparmor" {
+			children["apparmor"] = fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
+				"profiles": fs.newStaticFile(ctx, creds, defaultSysMode, lsm.Label()+"\n"),
+			})
+		}
+	}
+	children["lsm"] = fs.newStaticFile(ctx, creds, defaultSysMode, lsms)
+	return children
+}
+
+// moduleDir returns the contents of /sys/module. Only the parameters of the
+// installed LSM, which applications probe to detect it, are provided.
+func moduleDir(ctx context.Context, fs *filesystem, creds *auth.Credentials) map[string]kernfs.Inode {
+	children := make(map[string]kernfs.Inode)
+	if lsm.Name() == "apparmor" {
+		children["apparmor"] = fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
+			"parameters": fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
+				"enabled": fs.newStaticFile(ctx, creds, defaultSysMode, "Y\n"),
+			}),
+		})
+	}
 	return children
 }
 
@@ -54,6 +54,11 @@ func New(ctx context.Context, vfsObj *vfs.VirtualFilesystem, clock ktime.Clock,
 	defer vd.DecRef(ctx)
 	tfd := &TimerFileDescription{}
 	tfd.timer = clock.NewTimer(tfd)
+	if st, ok := tfd.timer.(*ktime.SampledTimer); ok {
+		// Coalesce expirations with other timers armed by the creating
+		// task, as with timeouts of blocking syscalls.
+		st.SetSlack(ktime.TimerSlackFromContext(ctx))
+	}
 	if err := tfd.vfsfd.Init(tfd, flags, vd.Mount(), vd.Dentry(), &vfs.FileDescriptionOptions{
 		UseDentryMetadata: true,
 		DenyPRead:         true,
@@ -0,0 +1,282 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmpfs
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/hostarch"
+	"github.com/wilinz/gvisor/pkg/log"
+	"github.com/wilinz/gvisor/pkg/safemem"
+	"github.com/wilinz/gvisor/pkg/sentry/memmap"
+	"github.com/wilinz/gvisor/pkg/sentry/pgalloc"
+	"github.com/wilinz/gvisor/pkg/sync"
+)
+
+// Files in a tmpfs mounted with compress=zstd store their contents in the
+// MemoryFile as usual, but the MemoryFile may ask for pages that are not
+// mapped by any application to be evicted (see pgalloc.EvictableMemoryUser).
+// Instead of being dropped, evicted pages are compressed into
+// regularFile.compressed, and the MemoryFile pages backing them are freed.
+// Compressed pages are decompressed into new MemoryFile pages when they are
+// mapped or written, and directly into the destination when they are read.
+//
+// Compressed pages remain accounted in filesystem.pagesUsed, so compression
+// doesn't change the filesystem's size limit, only its memory usage.
+
+// compressMinSavings is the minimum number of bytes that must be saved by
+// compressing a page for the page to be stored compressed. Pages that compress
+// worse than this stay in the MemoryFile.
+const compressMinSavings = hostarch.PageSize / 4
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+// initZstd initializes zstdEncoder and zstdDecoder, which are shared by all
+// compressed tmpfs mounts. Both support concurrent use of EncodeAll and
+// DecodeAll respectively.
+func initZstd() error {
+	zstdOnce.Do(func() {
+		zstdEncoder, zstdErr = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+		if zstdErr != nil {
+			return
+		}
+		zstdDecoder, zstdErr = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+	})
+	return zstdErr
+}
+
+// Evict implements pgalloc.EvictableMemoryUser.Evict.
+func (rf *regularFile) Evict(ctx context.Context, er pgalloc.EvictableRange) {
+	mr := memmap.MappableRange{er.Start, er.End}
+	rf.mapsMu.Lock()
+	defer rf.mapsMu.Unlock()
+	rf.dataMu.Lock()
+	defer rf.dataMu.Unlock()
+
+	// Only allow pages that are not memory-mapped to be compressed; mapped
+	// pages would have to be refaulted immediately anyway.
+	for mgap := rf.mappings.LowerBoundGap(mr.Start); mgap.Ok() && mgap.Start() < mr.End; mgap = mgap.NextGap() {
+		mgapMR := mgap.Range().Intersect(mr)
+		if mgapMR.Length() == 0 {
+			continue
+		}
+		if err := rf.compressLocked(mgapMR); err != nil {
+			log.Warningf("Failed to compress tmpfs file pages %v: %v", mgapMR, err)
+		}
+	}
+}
+
+// compressLocked compresses the pages of rf in mr that are stored in the
+// MemoryFile, and frees them.
+//
+// Preconditions:
+//   - rf.dataMu must be locked for writing.
+//   - mr must be page-aligned.
+func (rf *regularFile) compressLocked(mr memmap.MappableRange) error {
+	mf := rf.inode.fs.mf
+	var compressed []memmap.MappableRange
+	defer func() {
+		for _, r := range compressed {
+			rf.data.Drop(r, mf)
+		}
+	}()
+	for seg := rf.data.LowerBoundSegment(mr.Start); seg.Ok() && seg.Start() < mr.End; seg = seg.NextSegment() {
+		segMR := seg.Range().Intersect(mr)
+		ims, err := mf.MapInternal(seg.FileRangeOf(segMR), hostarch.Read)
+		if err != nil {
+			return err
+		}
+		page := make([]byte, hostarch.PageSize)
+		for off := segMR.Start; off < segMR.End; off += hostarch.PageSize {
+			n, err := safemem.CopySeq(safemem.BlockSeqOf(safemem.BlockFromSafeSlice(page)), ims)
+			if err != nil {
+				return err
+			}
+			ims = ims.DropFirst64(n)
+			c := zstdEncoder.EncodeAll(page, nil)
+			if len(c) > hostarch.PageSize-compressMinSavings {
+				continue
+			}
+			if rf.compressed == nil {
+				rf.compressed = make(map[uint64][]byte)
+			}
+			rf.compressed[off] = c
+			pageMR := memmap.MappableRange{off, off + hostarch.PageSize}
+			if n := len(compressed); n != 0 && compressed[n-1].End == off {
+				compressed[n-1].End = pageMR.End
+			} else {
+				compressed = append(compressed, pageMR)
+			}
+		}
+	}
+	return nil
+}
+
+// compressedOffsetsLocked returns the offsets of compressed pages in mr, in
+// increasing order.
+//
+// Preconditions: rf.dataMu must be locked.
+func (rf *regularFile) compressedOffsetsLocked(mr memmap.MappableRange) []uint64 {
+	if len(rf.compressed) == 0 {
+		return nil
+	}
+	var offs []uint64
+	start := hostarch.PageRoundDown(mr.Start)
+	if pages := (mr.End - start) / hostarch.PageSize; pages <= uint64(len(rf.compressed)) {
+		for off := start; off < mr.End; off += hostarch.PageSize {
+			if _, ok := rf.compressed[off]; ok {
+				offs = append(offs, off)
+			}
+		}
+		return offs
+	}
+	for off := range rf.compressed {
+		if off >= start && off < mr.End {
+			offs = append(offs, off)
+		}
+	}
+	sort.Slice(offs, func(i, j int) bool { return offs[i] < offs[j] })
+	return offs
+}
+
+// decompressPage returns the contents of the compressed page at off.
+//
+// Preconditions: rf.dataMu must be locked.
+func (rf *regularFile) decompressPage(off uint64) ([]byte, error) {
+	page, err := zstdDecoder.DecodeAll(rf.compressed[off], make([]byte, 0, hostarch.PageSize))
+	if err != nil {
+		return nil, err
+	}
+	if len(page) != hostarch.PageSize {
+		return nil, fmt.Errorf("compressed page at offset %#x decompressed to %d bytes", off, len(page))
+	}
+	return page, nil
+}
+
+// decompressLocked moves all compressed pages of rf in mr back into the
+// MemoryFile. Pages allocated for this purpose are accounted to memCgID.
+//
+// Preconditions: rf.dataMu must be locked for writing.
+func (rf *regularFile) decompressLocked(mr memmap.MappableRange, memCgID uint32) error {
+	mf := rf.inode.fs.mf
+	for _, off := range rf.compressedOffsetsLocked(mr) {
+		page, err := rf.decompressPage(off)
+		if err != nil {
+			return err
+		}
+		fr, err := mf.Allocate(hostarch.PageSize, pgalloc.AllocOpts{
+			Kind:    rf.memoryUsageKind,
+			MemCgID: memCgID,
+			ReaderFunc: func(dsts safemem.BlockSeq) (uint64, error) {
+				return safemem.CopySeq(dsts, safemem.BlockSeqOf(safemem.BlockFromSafeSlice(page)))
+			},
+		})
+		if err != nil {
+			return err
+		}
+		gap := rf.data.FindGap(off)
+		if !gap.Ok() {
+			panic(fmt.Sprintf("compressed page at offset %#x is also stored in the MemoryFile", off))
+		}
+		rf.data.Insert(gap, memmap.MappableRange{off, off + hostarch.PageSize}, fr.Start)
+		delete(rf.compressed, off)
+	}
+	return nil
+}
+
+// readGapLocked reads the contents of gapMR, which must not be stored in the
+// MemoryFile, into dsts. Compressed pages are decompressed; other pages are
+// holes, which are zero-filled.
+//
+// Preconditions: rf.dataMu must be locked.
+func (rf *regularFile) readGapLocked(dsts safemem.BlockSeq, gapMR memmap.MappableRange) (uint64, error) {
+	var done uint64
+	off := gapMR.Start
+	for _, pgoff := range rf.compressedOffsetsLocked(gapMR) {
+		if pgoff > off {
+			n, err := safemem.ZeroSeq(dsts.TakeFirst64(pgoff - off))
+			done += n
+			dsts = dsts.DropFirst64(n)
+			if err != nil {
+				return done, err
+			}
+			off = pgoff
+		}
+		page, err := rf.decompressPage(pgoff)
+		if err != nil {
+			return done, err
+		}
+		pgend := pgoff + hostarch.PageSize
+		if pgend > gapMR.End {
+			pgend = gapMR.End
+		}
+		n, err := safemem.CopySeq(dsts, safemem.BlockSeqOf(safemem.BlockFromSafeSlice(page[off-pgoff:pgend-pgoff])))
+		done += n
+		dsts = dsts.DropFirst64(n)
+		if err != nil {
+			return done, err
+		}
+		off = pgend
+	}
+	if off < gapMR.End {
+		n, err := safemem.ZeroSeq(dsts.TakeFirst64(gapMR.End - off))
+		done += n
+		if err != nil {
+			return done, err
+		}
+	}
+	return done, nil
+}
+
+// truncateCompressedLocked discards compressed pages that are entirely beyond
+// newSize, and zeroes the contents of a compressed page that contains
+// newSize. It returns the number of pages discarded.
+//
+// Preconditions: rf.dataMu must be locked for writing.
+func (rf *regularFile) truncateCompressedLocked(newSize uint64) (uint64, error) {
+	var pagesDec uint64
+	for off := range rf.compressed {
+		if off >= newSize {
+			delete(rf.compressed, off)
+			pagesDec++
+		}
+	}
+	pgoff := hostarch.PageRoundDown(newSize)
+	if _, ok := rf.compressed[pgoff]; ok && pgoff != newSize {
+		page, err := rf.decompressPage(pgoff)
+		if err != nil {
+			return pagesDec, err
+		}
+		clear(page[newSize-pgoff:])
+		rf.compressed[pgoff] = zstdEncoder.EncodeAll(page, nil)
+	}
+	return pagesDec, nil
+}
+
+// markEvictable informs the MemoryFile that the pages of rf in mr may be
+// compressed.
+func (rf *regularFile) markEvictable(mr memmap.MappableRange) {
+	if rf.inode.fs.compress && mr.Length() != 0 {
+		rf.inode.fs.mf.MarkEvictable(rf, pgalloc.EvictableRange{mr.Start, mr.End})
+	}
+}
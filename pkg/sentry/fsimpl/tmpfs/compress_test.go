@@ -0,0 +1,155 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmpfs
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/fspath"
+	"github.com/wilinz/gvisor/pkg/hostarch"
+	"github.com/wilinz/gvisor/pkg/sentry/contexttest"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
+	"github.com/wilinz/gvisor/pkg/sentry/pgalloc"
+	"github.com/wilinz/gvisor/pkg/sentry/vfs"
+	"github.com/wilinz/gvisor/pkg/usermem"
+)
+
+// newCompressedFileFD creates a new file in a new tmpfs mount with the given
+// mount options, and returns the FD.
+func newCompressedFileFD(ctx context.Context, t *testing.T, data string) (*vfs.FileDescription, func(), error) {
+	creds := auth.CredentialsFromContext(ctx)
+	vfsObj := &vfs.VirtualFilesystem{}
+	if err := vfsObj.Init(ctx); err != nil {
+		t.Fatalf("VFS init: %v", err)
+	}
+	vfsObj.MustRegisterFilesystemType("tmpfs", FilesystemType{}, &vfs.RegisterFilesystemTypeOptions{
+		AllowUserMount: true,
+	})
+	mntns, err := vfsObj.NewMountNamespace(ctx, creds, "", "tmpfs", &vfs.MountOptions{
+		GetFilesystemOptions: vfs.GetFilesystemOptions{Data: data},
+	}, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	root := mntns.Root(ctx)
+	cleanup := func() {
+		root.DecRef(ctx)
+		mntns.DecRef(ctx)
+	}
+	fd, err := vfsObj.OpenAt(ctx, creds, &vfs.PathOperation{
+		Root:  root,
+		Start: root,
+		Path:  fspath.Parse("file"),
+	}, &vfs.OpenOptions{
+		Flags: linux.O_RDWR | linux.O_CREAT | linux.O_EXCL,
+		Mode:  linux.ModeRegular | 0644,
+	})
+	if err != nil {
+		cleanup()
+		t.Fatalf("failed to create file: %v", err)
+	}
+	return fd, func() {
+		fd.DecRef(ctx)
+		cleanup()
+	}, nil
+}
+
+func checkContents(ctx context.Context, t *testing.T, fd *vfs.FileDescription, want []byte) {
+	t.Helper()
+	got := make([]byte, len(want)+1)
+	n, err := fd.PRead(ctx, usermem.BytesIOSequence(got), 0, vfs.ReadOptions{})
+	if err != nil && n != int64(len(want)) {
+		t.Fatalf("PRead failed: %v", err)
+	}
+	if !bytes.Equal(got[:n], want) {
+		t.Errorf("PRead returned %d bytes that differ from the %d bytes written", n, len(want))
+	}
+}
+
+func TestCompressInvalidOption(t *testing.T) {
+	ctx := contexttest.Context(t)
+	if _, _, err := newCompressedFileFD(ctx, t, "compress=lz4"); !linuxerr.Equals(linuxerr.EINVAL, err) {
+		t.Errorf("mount with compress=lz4 returned %v, want EINVAL", err)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	ctx := contexttest.Context(t)
+	fd, cleanup, err := newCompressedFileFD(ctx, t, "compress=zstd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	rf := fd.Impl().(*regularFileFD).inode().impl.(*regularFile)
+	fs := rf.inode.fs
+
+	// Write three compressible pages, one incompressible page, and part of a
+	// compressible page.
+	want := bytes.Repeat([]byte("gVisor is awesome. "), 3*hostarch.PageSize/19+1)[:3*hostarch.PageSize]
+	random := make([]byte, hostarch.PageSize)
+	rand.New(rand.NewSource(1)).Read(random)
+	want = append(want, random...)
+	want = append(want, bytes.Repeat([]byte{'a'}, 100)...)
+	if _, err := fd.PWrite(ctx, usermem.BytesIOSequence(want), 0, vfs.WriteOptions{}); err != nil {
+		t.Fatalf("PWrite failed: %v", err)
+	}
+	const pages = 5
+	if got := fs.pagesUsed.Load(); got != pages {
+		t.Errorf("pagesUsed after write is %d, want %d", got, pages)
+	}
+
+	rf.Evict(ctx, pgalloc.EvictableRange{0, pages * hostarch.PageSize})
+	if got, want := len(rf.compressed), pages-1; got != want {
+		t.Errorf("got %d compressed pages, want %d", got, want)
+	}
+	if got, want := rf.data.FirstSegment().Range().Start, uint64(3*hostarch.PageSize); got != want || rf.data.FirstSegment().NextSegment().Ok() {
+		t.Errorf("incompressible page not kept at %#x", want)
+	}
+	if got := fs.pagesUsed.Load(); got != pages {
+		t.Errorf("pagesUsed after compression is %d, want %d", got, pages)
+	}
+	checkContents(ctx, t, fd, want)
+
+	// Writing to a compressed page decompresses it.
+	patch := []byte("gVisor")
+	off := hostarch.PageSize + 10
+	if _, err := fd.PWrite(ctx, usermem.BytesIOSequence(patch), int64(off), vfs.WriteOptions{}); err != nil {
+		t.Fatalf("PWrite failed: %v", err)
+	}
+	copy(want[off:], patch)
+	if _, ok := rf.compressed[hostarch.PageSize]; ok {
+		t.Errorf("page at %#x still compressed after write", hostarch.PageSize)
+	}
+	checkContents(ctx, t, fd, want)
+
+	// Truncating into a compressed page zeroes its tail.
+	newSize := 2*hostarch.PageSize + 20
+	if _, err := rf.truncate(uint64(newSize)); err != nil {
+		t.Fatalf("truncate failed: %v", err)
+	}
+	if _, err := rf.truncate(uint64(len(want))); err != nil {
+		t.Fatalf("truncate failed: %v", err)
+	}
+	clear(want[newSize:])
+	checkContents(ctx, t, fd, want)
+	if got, want := fs.pagesUsed.Load(), uint64(3); got != want {
+		t.Errorf("pagesUsed after truncation is %d, want %d", got, want)
+	}
+}
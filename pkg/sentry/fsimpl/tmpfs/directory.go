@@ -66,6 +66,9 @@ func (dir *directory) insertChildLocked(child *dentry, name string) {
 	}
 	dir.childMap[name] = child
 	dir.numChildren.Add(1)
+	if child.inode.linkedDentry == nil {
+		child.inode.linkedDentry = child
+	}
 	dir.iterMu.Lock()
 	dir.childList.PushBack(child)
 	dir.iterMu.Unlock()
@@ -75,6 +78,9 @@ func (dir *directory) insertChildLocked(child *dentry, name string) {
 func (dir *directory) removeChildLocked(child *dentry) {
 	delete(dir.childMap, child.name)
 	dir.numChildren.Add(-1)
+	if child.inode.linkedDentry == child {
+		child.inode.linkedDentry = nil
+	}
 	dir.iterMu.Lock()
 	dir.childList.Remove(child)
 	dir.iterMu.Unlock()
@@ -21,6 +21,7 @@ import (
 	"github.com/wilinz/gvisor/pkg/context"
 	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
 	"github.com/wilinz/gvisor/pkg/fspath"
+	"github.com/wilinz/gvisor/pkg/hostarch"
 	"github.com/wilinz/gvisor/pkg/refs"
 	"github.com/wilinz/gvisor/pkg/sentry/fsmetric"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
@@ -967,6 +968,55 @@ func (fs *filesystem) IsDescendant(vfsroot, vd vfs.VirtualDentry) bool {
 	return genericIsDescendant(fs, vfsroot.Dentry(), vd.Dentry().Impl().(*dentry))
 }
 
+// fileHandleSize is the size of tmpfs file handles, which consist of a 64-bit
+// inode number followed by a 32-bit generation number that is always 0 since
+// inode numbers are never reused.
+const fileHandleSize = 12
+
+// EncodeFileHandle implements vfs.FilesystemImplFileHandleExtension.EncodeFileHandle.
+func (fs *filesystem) EncodeFileHandle(ctx context.Context, vfsd *vfs.Dentry) (int32, []byte, error) {
+	handle := make([]byte, fileHandleSize)
+	hostarch.ByteOrder.PutUint64(handle, vfsd.Impl().(*dentry).inode.ino)
+	return linux.FILEID_INO64_GEN, handle, nil
+}
+
+// DecodeFileHandle implements vfs.FilesystemImplFileHandleExtension.DecodeFileHandle.
+func (fs *filesystem) DecodeFileHandle(ctx context.Context, mntRoot *vfs.Dentry, handleType int32, handle []byte) (*vfs.Dentry, error) {
+	if handleType != linux.FILEID_INO64_GEN || len(handle) != fileHandleSize || hostarch.ByteOrder.Uint32(handle[8:]) != 0 {
+		return nil, linuxerr.ESTALE
+	}
+	ino := hostarch.ByteOrder.Uint64(handle)
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	fs.inodesMu.Lock()
+	i, ok := fs.inodes[ino]
+	if ok && !i.tryIncRef() {
+		ok = false
+	}
+	fs.inodesMu.Unlock()
+	if !ok {
+		return nil, linuxerr.ESTALE
+	}
+	// The reference taken above is transferred to the returned dentry, since
+	// dentries share their inode's reference count.
+	var d *dentry
+	if dir, ok := i.impl.(*directory); ok {
+		// Directories have a single dentry.
+		d = &dir.dentry
+	} else if i.linkedDentry != nil {
+		d = i.linkedDentry
+	} else {
+		// The file has been unlinked, so return a disconnected dentry as
+		// Linux's d_obtain_alias() does.
+		d = fs.newDentry(i)
+	}
+	if mntRoot != &fs.root.vfsd && !genericIsDescendant(fs, mntRoot, d) {
+		d.DecRef(ctx)
+		return nil, linuxerr.ESTALE
+	}
+	return &d.vfsd, nil
+}
+
 // MountOptions implements vfs.FilesystemImpl.MountOptions.
 func (fs *filesystem) MountOptions() string {
 	return fs.mopts
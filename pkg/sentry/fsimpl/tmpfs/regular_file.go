@@ -21,9 +21,11 @@ import (
 
 	"github.com/wilinz/gvisor/pkg/abi/linux"
 	"github.com/wilinz/gvisor/pkg/atomicbitops"
+	"github.com/wilinz/gvisor/pkg/buffer"
 	"github.com/wilinz/gvisor/pkg/context"
 	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
 	"github.com/wilinz/gvisor/pkg/hostarch"
+	"github.com/wilinz/gvisor/pkg/log"
 	"github.com/wilinz/gvisor/pkg/safemem"
 	"github.com/wilinz/gvisor/pkg/sentry/fsmetric"
 	"github.com/wilinz/gvisor/pkg/sentry/fsutil"
@@ -75,6 +77,14 @@ type regularFile struct {
 	// Protected by dataMu.
 	data fsutil.FileRangeSet
 
+	// compressed maps the offsets of pages of the file that have been
+	// compressed (see compress.go) to their compressed contents. Compressed
+	// pages are not stored in data. compressed is always empty unless the
+	// filesystem was mounted with compress=zstd.
+	//
+	// Protected by dataMu.
+	compressed map[uint64][]byte
+
 	// seals represents file seals on this inode.
 	//
 	// Protected by dataMu.
@@ -89,6 +99,19 @@ type regularFile struct {
 	// alignment padding.
 	initiallyUnlinked bool
 
+	// ownerMemCgID is the memory cgroup ID of the task that created this file
+	// using NewMemfd, or 0 if this file is not a memfd or the creator was not
+	// in a memory cgroup. ownerMemCgID is immutable.
+	ownerMemCgID uint32
+
+	// sharedMemCg is true if this memfd has been mapped by a task in a memory
+	// cgroup other than ownerMemCgID, e.g. after being passed between
+	// containers over SCM_RIGHTS. Once set, all pages backing the file are
+	// accounted to usage.SharedMemCgID rather than to any one container, so
+	// that memory shared by processes in different containers is charged
+	// exactly once. sharedMemCg is never unset.
+	sharedMemCg atomicbitops.Bool
+
 	// size is the size of data.
 	//
 	// Protected by both dataMu and inode.mu; reading it requires holding
@@ -163,12 +186,53 @@ func NewMemfd(ctx context.Context, creds *auth.Credentials, mount *vfs.Mount, al
 	if err != nil {
 		return nil, err
 	}
+	rf := fd.inode().impl.(*regularFile)
 	if allowSeals {
-		fd.inode().impl.(*regularFile).seals = 0
+		rf.seals = 0
 	}
+	rf.ownerMemCgID = pgalloc.MemoryCgroupIDFromContext(ctx)
 	return &fd.vfsfd, nil
 }
 
+// memCgIDLocked returns the memory cgroup ID to which pages allocated for rf
+// on behalf of a task in the memory cgroup taskMemCgID should be accounted.
+//
+// Preconditions: rf.dataMu must be locked, so that rf can't switch to shared
+// accounting after its existing pages were re-attributed but before the
+// caller allocates.
+func (rf *regularFile) memCgIDLocked(taskMemCgID uint32) uint32 {
+	if rf.sharedMemCg.Load() {
+		return usage.SharedMemCgID
+	}
+	return taskMemCgID
+}
+
+// maybeShareMemCgLocked switches rf to shared memory cgroup accounting if ctx
+// belongs to a memory cgroup other than the one that created rf, and
+// re-attributes all pages already backing rf to usage.SharedMemCgID.
+//
+// Preconditions: rf.dataMu must be locked.
+func (rf *regularFile) maybeShareMemCgLocked(ctx context.Context) {
+	if rf.ownerMemCgID == 0 || rf.sharedMemCg.Load() {
+		return
+	}
+	memCgID := pgalloc.MemoryCgroupIDFromContext(ctx)
+	if memCgID == 0 || memCgID == rf.ownerMemCgID {
+		return
+	}
+	// Callers may hold rf.dataMu only for reading, so concurrent callers must
+	// race to perform the re-attribution. Since rf.data can't change while
+	// rf.dataMu is locked, this is still consistent with allocations, which
+	// require rf.dataMu to be locked for writing.
+	if !rf.sharedMemCg.CompareAndSwap(false, true) {
+		return
+	}
+	mf := rf.inode.fs.mf
+	for seg := rf.data.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
+		mf.SetMemoryCgroupID(seg.FileRange(), usage.SharedMemCgID)
+	}
+}
+
 // truncate grows or shrinks the file to the given size. It returns true if the
 // file size was updated.
 func (rf *regularFile) truncate(newSize uint64) (bool, error) {
@@ -232,6 +296,13 @@ func (rf *regularFile) truncateLocked(newSize uint64) (bool, error) {
 	// and can remove them.
 	rf.dataMu.Lock()
 	decPages := rf.data.Truncate(newSize, rf.inode.fs.mf)
+	if len(rf.compressed) != 0 {
+		n, err := rf.truncateCompressedLocked(newSize)
+		if err != nil {
+			log.Warningf("Failed to truncate compressed tmpfs file page: %v", err)
+		}
+		decPages += n
+	}
 	rf.dataMu.Unlock()
 	rf.inode.fs.unaccountPages(decPages)
 	return true, nil
@@ -249,7 +320,15 @@ func (rf *regularFile) AddMapping(ctx context.Context, ms memmap.MappingSpace, a
 		return linuxerr.EPERM
 	}
 
-	rf.mappings.AddMapping(ms, ar, offset, writable)
+	rf.maybeShareMemCgLocked(ctx)
+	mapped := rf.mappings.AddMapping(ms, ar, offset, writable)
+	if rf.inode.fs.compress {
+		// rf.Evict() will refuse to compress memory-mapped pages, so tell the
+		// MemoryFile to not bother trying.
+		for _, r := range mapped {
+			rf.inode.fs.mf.MarkUnevictable(rf, pgalloc.EvictableRange{r.Start, r.End})
+		}
+	}
 	if writable {
 		pagesBefore := rf.writableMappingPages
 
@@ -269,7 +348,11 @@ func (rf *regularFile) RemoveMapping(ctx context.Context, ms memmap.MappingSpace
 	rf.mapsMu.Lock()
 	defer rf.mapsMu.Unlock()
 
-	rf.mappings.RemoveMapping(ms, ar, offset, writable)
+	unmapped := rf.mappings.RemoveMapping(ms, ar, offset, writable)
+	for _, r := range unmapped {
+		// Pages that are no longer mapped may be compressed.
+		rf.markEvictable(r)
+	}
 
 	if writable {
 		pagesBefore := rf.writableMappingPages
@@ -290,10 +373,9 @@ func (rf *regularFile) CopyMapping(ctx context.Context, ms memmap.MappingSpace,
 
 // Translate implements memmap.Mappable.Translate.
 func (rf *regularFile) Translate(ctx context.Context, required, optional memmap.MappableRange, at hostarch.AccessType) ([]memmap.Translation, error) {
-	memCgID := pgalloc.MemoryCgroupIDFromContext(ctx)
-
 	rf.dataMu.Lock()
 	defer rf.dataMu.Unlock()
+	memCgID := rf.memCgIDLocked(pgalloc.MemoryCgroupIDFromContext(ctx))
 
 	// Constrain translations to f.attr.Size (rounded up) to prevent
 	// translation to pages that may be concurrently truncated.
@@ -322,6 +404,9 @@ func (rf *regularFile) Translate(ctx context.Context, required, optional memmap.
 			}
 		}
 	}
+	if err := rf.decompressLocked(optional, memCgID); err != nil {
+		return nil, &memmap.BusError{err}
+	}
 	pagesToFill := rf.data.PagesToFill(required, optional)
 	if !rf.inode.fs.accountPages(pagesToFill) {
 		// If we can not accommodate pagesToFill pages, then retry with just
@@ -434,6 +519,7 @@ func (fd *regularFileFD) Allocate(ctx context.Context, mode, offset, length uint
 func (rf *regularFile) allocateLocked(ctx context.Context, mode, newSize uint64, required memmap.MappableRange, memCgID uint32) error {
 	rf.dataMu.Lock()
 	defer rf.dataMu.Unlock()
+	memCgID = rf.memCgIDLocked(memCgID)
 
 	// We must allocate pages in the range specified by offset and length.
 	// Even if newSize <= oldSize, there might not be actual memory backing this
@@ -441,6 +527,9 @@ func (rf *regularFile) allocateLocked(ctx context.Context, mode, newSize uint64,
 	// "After a successful call, subsequent writes into the range
 	// specified by offset and len are guaranteed not to fail because of
 	// lack of disk space."  - fallocate(2)
+	if err := rf.decompressLocked(required, memCgID); err != nil {
+		return err
+	}
 	pagesToFill := rf.data.PagesToFill(required, required)
 	if !rf.inode.fs.accountPages(pagesToFill) {
 		return linuxerr.ENOSPC
@@ -465,6 +554,7 @@ func (rf *regularFile) allocateLocked(ctx context.Context, mode, newSize uint64,
 	// f.data.Fill() may fail mid-way. We still want to account any pages that
 	// were allocated, irrespective of an error.
 	rf.inode.fs.adjustPageAcct(pagesToFill, pagesAlloced)
+	rf.markEvictable(required)
 	if err != nil && err != io.EOF {
 		return err
 	}
@@ -516,6 +606,75 @@ func (fd *regularFileFD) Read(ctx context.Context, dst usermem.IOSequence, opts
 	return n, err
 }
 
+// PReadBuffer implements vfs.BufferReader.PReadBuffer.
+func (fd *regularFileFD) PReadBuffer(ctx context.Context, dst *buffer.Buffer, offset, count int64) (int64, error) {
+	start := fsmetric.StartReadWait()
+	defer fsmetric.FinishReadWait(fsmetric.TmpfsReadWait, start)
+	fsmetric.TmpfsReads.Increment()
+
+	if offset < 0 || count < 0 {
+		return 0, linuxerr.EINVAL
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	f := fd.inode().impl.(*regularFile)
+	n, err := f.appendToBuffer(dst, uint64(offset), uint64(count))
+	fd.inode().touchAtime(fd.vfsfd.Mount())
+	return int64(n), err
+}
+
+// appendToBuffer appends up to count bytes of the file's contents, starting at
+// off, to dst. Data is appended by reference to the pages backing the file;
+// holes are appended as zeroes.
+func (rf *regularFile) appendToBuffer(dst *buffer.Buffer, off, count uint64) (uint64, error) {
+	rf.dataMu.RLock()
+	defer rf.dataMu.RUnlock()
+	size := rf.size.RacyLoad()
+
+	// Compute the range to read (limited by file size and overflow-checked).
+	if off >= size {
+		return 0, nil
+	}
+	end := size
+	if rend := off + count; rend > off && rend < end {
+		end = rend
+	}
+
+	var done uint64
+	seg, gap := rf.data.Find(off)
+	for off < end {
+		mr := memmap.MappableRange{off, end}
+		switch {
+		case seg.Ok():
+			segMR := seg.Range().Intersect(mr)
+			if err := rf.inode.fs.mf.AppendToBuffer(dst, seg.FileRangeOf(segMR)); err != nil {
+				return done, err
+			}
+			done += segMR.Length()
+			off = segMR.End
+			seg, gap = seg.NextNonEmpty()
+
+		case gap.Ok():
+			// Tmpfs holes are zero-filled.
+			gapMR := gap.Range().Intersect(mr)
+			if len(rf.compressed) != 0 {
+				buf := make([]byte, gapMR.Length())
+				if _, err := rf.readGapLocked(safemem.BlockSeqOf(safemem.BlockFromSafeSlice(buf)), gapMR); err != nil {
+					return done, err
+				}
+				dst.Append(buffer.NewViewWithData(buf))
+			} else {
+				dst.GrowTo(dst.Size()+int64(gapMR.Length()), true /* zero */)
+			}
+			done += gapMR.Length()
+			off = gapMR.End
+			seg, gap = gap.NextSegment(), fsutil.FileRangeGapIterator{}
+		}
+	}
+	return done, nil
+}
+
 // PWrite implements vfs.FileDescriptionImpl.PWrite.
 func (fd *regularFileFD) PWrite(ctx context.Context, src usermem.IOSequence, offset int64, opts vfs.WriteOptions) (int64, error) {
 	n, _, err := fd.pwrite(ctx, src, offset, opts)
@@ -636,8 +795,9 @@ type regularFileReadWriter struct {
 	// different from the FD offset if PRead/PWrite is used.
 	off uint64
 
-	// memCgID is the memory cgroup ID used for accounting the allocated
-	// pages.
+	// memCgID is the memory cgroup ID of the task performing the write. Pages
+	// allocated by the write are accounted to it, unless file has switched to
+	// shared accounting.
 	memCgID uint32
 }
 
@@ -700,10 +860,10 @@ func (rw *regularFileReadWriter) ReadToBlocks(dsts safemem.BlockSeq) (uint64, er
 			seg, gap = seg.NextNonEmpty()
 
 		case gap.Ok():
-			// Tmpfs holes are zero-filled.
+			// Tmpfs holes are zero-filled, except for compressed pages.
 			gapmr := gap.Range().Intersect(mr)
 			dst := dsts.TakeFirst64(gapmr.Length())
-			n, err := safemem.ZeroSeq(dst)
+			n, err := rw.file.readGapLocked(dst, gapmr)
 			done += n
 			rw.off += uint64(n)
 			dsts = dsts.DropFirst64(n)
@@ -765,6 +925,11 @@ func (rw *regularFileReadWriter) WriteFromBlocks(srcs safemem.BlockSeq) (uint64,
 	pgstartaddr := hostarch.Addr(rw.off).RoundDown()
 	pgendaddr, _ := hostarch.Addr(end).RoundUp()
 	pgMR := memmap.MappableRange{uint64(pgstartaddr), uint64(pgendaddr)}
+	memCgID := rw.file.memCgIDLocked(rw.memCgID)
+	if err := rw.file.decompressLocked(pgMR, memCgID); err != nil {
+		return 0, err
+	}
+	defer rw.file.markEvictable(pgMR)
 
 	var (
 		done   uint64
@@ -813,7 +978,7 @@ func (rw *regularFileReadWriter) WriteFromBlocks(srcs safemem.BlockSeq) (uint64,
 			}
 			fr, err := rw.file.inode.fs.mf.Allocate(gapMR.Length(), pgalloc.AllocOpts{
 				Kind:    rw.file.memoryUsageKind,
-				MemCgID: rw.memCgID,
+				MemCgID: memCgID,
 				Mode:    allocMode,
 			})
 			if err != nil {
@@ -21,9 +21,14 @@ import (
 	"testing"
 
 	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/context"
 	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/hostarch"
 	"github.com/wilinz/gvisor/pkg/sentry/contexttest"
 	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/lock"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
+	"github.com/wilinz/gvisor/pkg/sentry/pgalloc"
+	"github.com/wilinz/gvisor/pkg/sentry/usage"
 	"github.com/wilinz/gvisor/pkg/sentry/vfs"
 	"github.com/wilinz/gvisor/pkg/usermem"
 )
@@ -347,3 +352,66 @@ func TestTruncate(t *testing.T) {
 		t.Errorf("fd.Stat got Ctime %v, want %v", got, statAfterTruncateUp.Ctime)
 	}
 }
+
+// memCgContext is a context.Context that belongs to a memory cgroup.
+type memCgContext struct {
+	context.Context
+	memCgID uint32
+}
+
+// Value implements context.Context.Value.
+func (ctx *memCgContext) Value(key any) any {
+	if key == pgalloc.CtxMemoryCgroupID {
+		return ctx.memCgID
+	}
+	return ctx.Context.Value(key)
+}
+
+// Test that a memfd mapped from another memory cgroup is accounted to the
+// shared memory cgroup.
+func TestMemfdSharedMemCg(t *testing.T) {
+	ctx := contexttest.Context(t)
+	_, root, cleanup, err := newTmpfsRoot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	ownerCtx := &memCgContext{Context: ctx, memCgID: 1}
+	fd, err := NewMemfd(ownerCtx, auth.CredentialsFromContext(ctx), root.Mount(), false /* allowSeals */, "test")
+	if err != nil {
+		t.Fatalf("NewMemfd failed: %v", err)
+	}
+	defer fd.DecRef(ctx)
+	data := []byte("foobarbaz")
+	if _, err := fd.Write(ownerCtx, usermem.BytesIOSequence(data), vfs.WriteOptions{}); err != nil {
+		t.Fatalf("fd.Write failed: %v", err)
+	}
+
+	rf := fd.Impl().(*regularFileFD).inode().impl.(*regularFile)
+	ar := hostarch.AddrRange{Start: 0, End: hostarch.PageSize}
+	if err := rf.AddMapping(ownerCtx, nil /* ms */, ar, 0 /* offset */, true /* writable */); err != nil {
+		t.Fatalf("AddMapping failed: %v", err)
+	}
+	rf.dataMu.RLock()
+	got := rf.memCgIDLocked(ownerCtx.memCgID)
+	rf.dataMu.RUnlock()
+	if got != 1 {
+		t.Errorf("memCgID after mapping from owner got %d, want 1", got)
+	}
+
+	otherCtx := &memCgContext{Context: ctx, memCgID: 2}
+	if err := rf.AddMapping(otherCtx, nil /* ms */, ar, 0 /* offset */, true /* writable */); err != nil {
+		t.Fatalf("AddMapping failed: %v", err)
+	}
+	for _, c := range []*memCgContext{ownerCtx, otherCtx} {
+		rf.dataMu.RLock()
+		got := rf.memCgIDLocked(c.memCgID)
+		rf.dataMu.RUnlock()
+		if got != usage.SharedMemCgID {
+			t.Errorf("memCgID after mapping from another memory cgroup got %d, want %d", got, usage.SharedMemCgID)
+		}
+	}
+	rf.RemoveMapping(otherCtx, nil /* ms */, ar, 0 /* offset */, true /* writable */)
+	rf.RemoveMapping(ownerCtx, nil /* ms */, ar, 0 /* offset */, true /* writable */)
+}
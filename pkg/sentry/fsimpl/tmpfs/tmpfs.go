@@ -91,6 +91,16 @@ type filesystem struct {
 
 	nextInoMinusOne atomicbitops.Uint64 // accessed using atomic memory operations
 
+	// inodesMu protects inodes.
+	inodesMu sync.Mutex `state:"nosave"`
+
+	// inodes maps inode numbers to inodes that are still referenced, so that
+	// file handles can be decoded. Since inode numbers are never reused, they
+	// serve as file handles by themselves.
+	//
+	// +checklocks:inodesMu
+	inodes map[uint64]*inode
+
 	root *dentry
 
 	maxFilenameLen int
@@ -108,6 +118,11 @@ type filesystem struct {
 
 	// ovlWhiteout is the shared overlay whiteout device. It is protected by mu.
 	ovlWhiteout *deviceFile
+
+	// compress is true if regular file pages that are not mapped may be
+	// compressed when the MemoryFile requests eviction, as configured by the
+	// compress=zstd mount option. compress is immutable.
+	compress bool
 }
 
 // Name implements vfs.FilesystemType.Name.
@@ -279,6 +294,21 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		}
 	}
 
+	compress := false
+	compressStr, ok := mopts["compress"]
+	if ok {
+		delete(mopts, "compress")
+		if compressStr != "zstd" {
+			ctx.Warningf("tmpfs.FilesystemType.GetFilesystem: unsupported compression algorithm: %q", compressStr)
+			return nil, nil, linuxerr.EINVAL
+		}
+		if err := initZstd(); err != nil {
+			ctx.Warningf("tmpfs.FilesystemType.GetFilesystem: failed to initialize zstd: %v", err)
+			return nil, nil, linuxerr.EINVAL
+		}
+		compress = true
+	}
+
 	if len(mopts) != 0 {
 		ctx.Warningf("tmpfs.FilesystemType.GetFilesystem: unknown options: %v", mopts)
 		return nil, nil, linuxerr.EINVAL
@@ -302,6 +332,8 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		maxFilenameLen:   linux.NAME_MAX,
 		maxSizeInPages:   maxSizeInPages,
 		allowXattrPrefix: allowXattrPrefix,
+		inodes:           make(map[uint64]*inode),
+		compress:         compress,
 	}
 	fs.vfsfs.Init(vfsObj, newFSType, &fs)
 	if tmpfsOptsOk && tmpfsOpts.MaxFilenameLen > 0 {
@@ -502,6 +534,13 @@ type inode struct {
 	// Inotify watches for this inode.
 	watches vfs.Watches
 
+	// linkedDentry is one of the dentries linking this inode into the
+	// filesystem tree, or nil if there are none or they are unknown. (Only
+	// the first dentry to be linked is tracked.) It is used to decode file
+	// handles to connected dentries. linkedDentry is protected by
+	// filesystem.mu.
+	linkedDentry *dentry
+
 	impl any // immutable
 }
 
@@ -533,6 +572,9 @@ func (i *inode) init(impl any, fs *filesystem, kuid auth.KUID, kgid auth.KGID, m
 	// i.nlink initialized by caller
 	i.impl = impl
 	i.refs.InitRefs()
+	fs.inodesMu.Lock()
+	fs.inodes[i.ino] = i
+	fs.inodesMu.Unlock()
 }
 
 // incLinksLocked increments i's link count.
@@ -576,6 +618,9 @@ func (i *inode) tryIncRef() bool {
 
 func (i *inode) decRef(ctx context.Context) {
 	i.refs.DecRef(func() {
+		i.fs.inodesMu.Lock()
+		delete(i.fs.inodes, i.ino)
+		i.fs.inodesMu.Unlock()
 		i.watches.HandleDeletion(ctx)
 		// Remove pages used if child being removed is a SymLink or Regular File.
 		switch impl := i.impl.(type) {
@@ -586,8 +631,16 @@ func (i *inode) decRef(ctx context.Context) {
 		case *regularFile:
 			// Release memory used by regFile to store data. Since regFile is
 			// no longer usable, we don't need to grab any locks or update any
-			// metadata.
-			pagesDec := impl.data.DropAll(i.fs.mf)
+			// metadata, except to exclude a concurrent call to Evict.
+			if i.fs.compress {
+				i.fs.mf.MarkAllUnevictable(impl)
+				impl.dataMu.Lock()
+			}
+			pagesDec := impl.data.DropAll(i.fs.mf) + uint64(len(impl.compressed))
+			impl.compressed = nil
+			if i.fs.compress {
+				impl.dataMu.Unlock()
+			}
 			impl.inode.fs.unaccountPages(pagesDec)
 		}
 
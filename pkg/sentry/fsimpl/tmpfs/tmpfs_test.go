@@ -21,7 +21,9 @@ import (
 	"github.com/wilinz/gvisor/pkg/abi/linux"
 	"github.com/wilinz/gvisor/pkg/atomicbitops"
 	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
 	"github.com/wilinz/gvisor/pkg/fspath"
+	"github.com/wilinz/gvisor/pkg/sentry/contexttest"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
 	"github.com/wilinz/gvisor/pkg/sentry/vfs"
 )
@@ -191,3 +193,67 @@ func TestParseSize(t *testing.T) {
 		})
 	}
 }
+
+func TestFileHandle(t *testing.T) {
+	ctx := contexttest.Context(t)
+	creds := auth.CredentialsFromContext(ctx)
+	vfsObj, root, cleanup, err := newTmpfsRoot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	pop := func(path string) *vfs.PathOperation {
+		return &vfs.PathOperation{
+			Root:  root,
+			Start: root,
+			Path:  fspath.Parse(path),
+		}
+	}
+
+	fd, err := vfsObj.OpenAt(ctx, creds, pop("file"), &vfs.OpenOptions{
+		Flags: linux.O_RDWR | linux.O_CREAT | linux.O_EXCL,
+		Mode:  linux.ModeRegular | 0644,
+	})
+	if err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	handleType, handle, _, err := vfsObj.NameToHandleAt(ctx, creds, pop("file"))
+	if err != nil {
+		t.Fatalf("NameToHandleAt failed: %v", err)
+	}
+	want, err := fd.Stat(ctx, vfs.StatOptions{})
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+
+	// The handle must survive renames.
+	if err := vfsObj.RenameAt(ctx, creds, pop("file"), pop("renamed"), &vfs.RenameOptions{}); err != nil {
+		t.Fatalf("RenameAt failed: %v", err)
+	}
+	hfd, err := vfsObj.OpenByHandleAt(ctx, creds, root.Mount(), handleType, handle, &vfs.OpenOptions{Flags: linux.O_RDONLY})
+	if err != nil {
+		t.Fatalf("OpenByHandleAt failed: %v", err)
+	}
+	got, err := hfd.Stat(ctx, vfs.StatOptions{})
+	hfd.DecRef(ctx)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if got.Ino != want.Ino {
+		t.Errorf("OpenByHandleAt opened inode %d, want %d", got.Ino, want.Ino)
+	}
+
+	// Once the file no longer exists, the handle is stale.
+	if err := vfsObj.UnlinkAt(ctx, creds, pop("renamed")); err != nil {
+		t.Fatalf("UnlinkAt failed: %v", err)
+	}
+	fd.DecRef(ctx)
+	if _, err := vfsObj.OpenByHandleAt(ctx, creds, root.Mount(), handleType, handle, &vfs.OpenOptions{Flags: linux.O_RDONLY}); !linuxerr.Equals(linuxerr.ESTALE, err) {
+		t.Errorf("OpenByHandleAt after unlink got error %v, want %v", err, linuxerr.ESTALE)
+	}
+
+	// Handles from other filesystems are rejected.
+	if _, err := vfsObj.OpenByHandleAt(ctx, creds, root.Mount(), handleType+1, handle, &vfs.OpenOptions{Flags: linux.O_RDONLY}); !linuxerr.Equals(linuxerr.ESTALE, err) {
+		t.Errorf("OpenByHandleAt with bad handle type got error %v, want %v", err, linuxerr.ESTALE)
+	}
+}
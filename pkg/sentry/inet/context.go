@@ -26,6 +26,8 @@ const (
 	CtxStack contextID = iota
 	// CtxNamespaceByFD is a Context.Value key for NamespaceByFD.
 	CtxNamespaceByFD
+	// CtxNamespaceByPID is a Context.Value key for NamespaceByPID.
+	CtxNamespaceByPID
 )
 
 // StackFromContext returns the network stack associated with ctx.
@@ -48,3 +50,16 @@ func NamespaceByFDFromContext(ctx context.Context) NamespaceByFD {
 	}
 	return nil
 }
+
+// NamespaceByPID returns the network namespace of the process with the
+// specified PID.
+type NamespaceByPID = func(pid int32) (*Namespace, error)
+
+// NamespaceByPIDFromContext returns NamespaceByPID to lookup the network
+// namespace of the process with the specified PID.
+func NamespaceByPIDFromContext(ctx context.Context) NamespaceByPID {
+	if v := ctx.Value(CtxNamespaceByPID); v != nil {
+		return v.(NamespaceByPID)
+	}
+	return nil
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/wilinz/gvisor/pkg/sentry/socket/netlink/nlmsg"
 	"github.com/wilinz/gvisor/pkg/syserr"
 	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/link/qdisc/tc"
 	"github.com/wilinz/gvisor/pkg/tcpip/stack"
 )
 
@@ -79,6 +80,19 @@ type Stack interface {
 	// SetTCPRecovery attempts to change TCP loss detection algorithm.
 	SetTCPRecovery(recovery TCPLossRecovery) error
 
+	// TCPSynCookies returns when SYN cookies are used, with the values of
+	// net.ipv4.tcp_syncookies.
+	TCPSynCookies() (int32, error)
+
+	// SetTCPSynCookies attempts to change when SYN cookies are used.
+	SetTCPSynCookies(v int32) error
+
+	// Sysctl returns the value of the sysctl s.
+	Sysctl(s Sysctl) (int64, error)
+
+	// SetSysctl attempts to change the value of the sysctl s.
+	SetSysctl(s Sysctl, v int64) error
+
 	// Statistics reports stack statistics.
 	Statistics(stat any, arg string) error
 
@@ -91,6 +105,35 @@ type Stack interface {
 	// NewRoute adds the given route to the network stack's route table.
 	NewRoute(ctx context.Context, msg *nlmsg.Message) *syserr.Error
 
+	// RoutingRules returns the network stack's routing rules, in the order
+	// they are tried.
+	RoutingRules() []Rule
+
+	// NewRule adds the given routing rule to the network stack.
+	NewRule(ctx context.Context, msg *nlmsg.Message) *syserr.Error
+
+	// RemoveRule deletes the specified routing rule.
+	RemoveRule(ctx context.Context, msg *nlmsg.Message) *syserr.Error
+
+	// QDiscs returns the queueing disciplines of the network interfaces.
+	QDiscs() []QDisc
+
+	// NewQDisc adds, changes or replaces a queueing discipline.
+	NewQDisc(ctx context.Context, msg *nlmsg.Message) *syserr.Error
+
+	// RemoveQDisc deletes the specified queueing discipline.
+	RemoveQDisc(ctx context.Context, msg *nlmsg.Message) *syserr.Error
+
+	// Neighbors returns the entries of the neighbor tables of the network
+	// interfaces.
+	Neighbors() []Neighbor
+
+	// NewNeighbor adds or changes a neighbor table entry.
+	NewNeighbor(ctx context.Context, msg *nlmsg.Message) *syserr.Error
+
+	// RemoveNeighbor deletes the specified neighbor table entry.
+	RemoveNeighbor(ctx context.Context, msg *nlmsg.Message) *syserr.Error
+
 	// Pause pauses the network stack before save.
 	Pause()
 
@@ -111,6 +154,12 @@ type Stack interface {
 	// Destroy the network stack.
 	Destroy()
 
+	// MoveHostDevices moves the network devices that are backed by host
+	// devices to root, the stack of the root network namespace. It is
+	// called before the stack of a non-root network namespace is
+	// destroyed.
+	MoveHostDevices(root Stack)
+
 	// RegisteredEndpoints returns all endpoints which are currently registered.
 	RegisteredEndpoints() []stack.TransportEndpoint
 
@@ -213,7 +262,7 @@ type Route struct {
 	TOS uint8
 
 	// Table is the routing table ID.
-	Table uint8
+	Table uint32
 
 	// Protocol is the route origin, a Linux RTPROT_* constant.
 	Protocol uint8
@@ -240,6 +289,92 @@ type Route struct {
 	GatewayAddr []byte
 }
 
+// QDisc contains information about a queueing discipline.
+type QDisc struct {
+	// Ifindex is the index of the network interface.
+	Ifindex int32
+
+	// Handle is the handle of the queueing discipline.
+	Handle uint32
+
+	// Parent is the handle of the parent class, or linux.TC_H_ROOT.
+	Parent uint32
+
+	// Kind is the kind of the queueing discipline, such as "tbf".
+	Kind string
+
+	// TBF holds the parameters of "tbf" queueing disciplines.
+	TBF tc.TBFParams
+
+	// FQCoDel holds the parameters of "fq_codel" queueing disciplines.
+	FQCoDel tc.FQCoDelParams
+}
+
+// Neighbor contains information about a neighbor table entry, which maps a
+// network address to a link address, as resolved by ARP or NDP.
+type Neighbor struct {
+	// Family is the address family, a Linux AF_* constant.
+	Family uint8
+
+	// Ifindex is the index of the network interface.
+	Ifindex int32
+
+	// State is the state of the entry, a Linux NUD_* constant.
+	State uint16
+
+	// Flags are neighbor flags, Linux NTF_* constants.
+	Flags uint8
+
+	// Addr is the network address of the neighbor (NDA_DST).
+	Addr []byte
+
+	// LinkAddr is the link address of the neighbor (NDA_LLADDR). It is
+	// empty if the link address isn't known.
+	LinkAddr []byte
+}
+
+// Rule contains information about a routing rule.
+type Rule struct {
+	// Family is the address family, a Linux AF_* constant.
+	Family uint8
+
+	// DstLen is the length of the destination address prefix.
+	DstLen uint8
+
+	// SrcLen is the length of the source address prefix.
+	SrcLen uint8
+
+	// Action is the rule action, a Linux FR_ACT_* constant.
+	Action uint8
+
+	// Flags are rule flags, Linux FIB_RULE_* constants.
+	Flags uint32
+
+	// Table is the routing table ID looked up by FR_ACT_TO_TBL rules.
+	Table uint32
+
+	// Priority is the rule priority (FRA_PRIORITY).
+	Priority uint32
+
+	// DstAddr is the destination address prefix (FRA_DST).
+	DstAddr []byte
+
+	// SrcAddr is the source address prefix (FRA_SRC).
+	SrcAddr []byte
+
+	// Mark and Mask are the packet mark and mask (FRA_FWMARK and
+	// FRA_FWMASK). The rule doesn't match on marks if Mask is zero.
+	Mark uint32
+	Mask uint32
+
+	// SuppressPrefixLen causes routes with a prefix no longer than it to be
+	// ignored (FRA_SUPPRESS_PREFIXLEN). It is -1 if no routes are ignored.
+	SuppressPrefixLen int32
+
+	// OutputInterface is the output interface name (FRA_OIFNAME).
+	OutputInterface string
+}
+
 // Below SNMP metrics are from Linux/usr/include/linux/snmp.h.
 
 // StatSNMPIP describes Ip line of /proc/net/snmp.
@@ -260,6 +395,11 @@ type StatSNMPUDP [8]uint64
 // StatSNMPUDPLite describes UdpLite line of /proc/net/snmp.
 type StatSNMPUDPLite [8]uint64
 
+// StatNetstatTCPExt describes the TcpExt line of /proc/net/netstat. It maps
+// the names of the fields to their values; fields that the stack doesn't keep
+// are missing.
+type StatNetstatTCPExt map[string]uint64
+
 // TCPLossRecovery indicates TCP loss detection and recovery methods to use.
 type TCPLossRecovery int32
 
@@ -271,6 +411,79 @@ const (
 	TCP_RACK_NO_DUPTHRESH
 )
 
+// Sysctl is a sysctl under /proc/sys/net that maps to a single integer option
+// of the network stack.
+type Sysctl int
+
+// Sysctls supported by Stack.Sysctl and Stack.SetSysctl.
+const (
+	// SysctlSomaxconn is net.core.somaxconn, the maximum listen backlog.
+	SysctlSomaxconn Sysctl = iota
+
+	// SysctlRmemDefault is net.core.rmem_default, the default receive
+	// buffer size of sockets.
+	SysctlRmemDefault
+
+	// SysctlRmemMax is net.core.rmem_max, the maximum receive buffer size
+	// that can be set with SO_RCVBUF.
+	SysctlRmemMax
+
+	// SysctlWmemDefault is net.core.wmem_default, the default send buffer
+	// size of sockets.
+	SysctlWmemDefault
+
+	// SysctlWmemMax is net.core.wmem_max, the maximum send buffer size that
+	// can be set with SO_SNDBUF.
+	SysctlWmemMax
+
+	// SysctlTCPFinTimeout is net.ipv4.tcp_fin_timeout, the time in seconds
+	// that orphaned connections stay in FIN-WAIT-2.
+	SysctlTCPFinTimeout
+
+	// SysctlTCPModerateRcvbuf is net.ipv4.tcp_moderate_rcvbuf, whether TCP
+	// receive buffers are tuned automatically.
+	SysctlTCPModerateRcvbuf
+
+	// SysctlTCPRetries2 is net.ipv4.tcp_retries2, the number of
+	// retransmissions before an established connection is dropped.
+	SysctlTCPRetries2
+
+	// SysctlTCPSynRetries is net.ipv4.tcp_syn_retries, the number of SYN
+	// retransmissions before a connection attempt fails.
+	SysctlTCPSynRetries
+)
+
+// DefaultSomaxconn is the default value of net.core.somaxconn. It is lower
+// than Linux's default of 4096 to keep the listen backlog limit that the
+// sentry applied before net.core.somaxconn was configurable.
+const DefaultSomaxconn = 1024
+
+// Path returns the path of s relative to /proc/sys/net.
+func (s Sysctl) Path() string {
+	switch s {
+	case SysctlSomaxconn:
+		return "core/somaxconn"
+	case SysctlRmemDefault:
+		return "core/rmem_default"
+	case SysctlRmemMax:
+		return "core/rmem_max"
+	case SysctlWmemDefault:
+		return "core/wmem_default"
+	case SysctlWmemMax:
+		return "core/wmem_max"
+	case SysctlTCPFinTimeout:
+		return "ipv4/tcp_fin_timeout"
+	case SysctlTCPModerateRcvbuf:
+		return "ipv4/tcp_moderate_rcvbuf"
+	case SysctlTCPRetries2:
+		return "ipv4/tcp_retries2"
+	case SysctlTCPSynRetries:
+		return "ipv4/tcp_syn_retries"
+	default:
+		return ""
+	}
+}
+
 // InterfaceRequest contains information about an adding interface.
 type InterfaceRequest struct {
 	// Kind is the link type.
@@ -41,6 +41,10 @@ type Namespace struct {
 	// isRoot indicates whether this is the root network namespace.
 	isRoot bool
 
+	// root is the root network namespace. It is nil in the root network
+	// namespace itself.
+	root *Namespace
+
 	userNS *auth.UserNamespace
 
 	// abstractSockets tracks abstract sockets that are in use.
@@ -78,8 +82,12 @@ func (n *Namespace) GetInode() *nsfs.Inode {
 
 // NewNamespace creates a new network namespace from the root.
 func NewNamespace(root *Namespace, userNS *auth.UserNamespace) *Namespace {
+	if !root.isRoot && root.root != nil {
+		root = root.root
+	}
 	n := &Namespace{
 		creator: root.creator,
+		root:    root,
 		userNS:  userNS,
 	}
 	n.init()
@@ -89,6 +97,13 @@ func NewNamespace(root *Namespace, userNS *auth.UserNamespace) *Namespace {
 // Destroy implements nsfs.Namespace.Destroy.
 func (n *Namespace) Destroy(ctx context.Context) {
 	if s := n.Stack(); s != nil {
+		// Devices backed by host devices outlive the namespace, as
+		// physical devices in Linux.
+		if n.root != nil {
+			if rs := n.root.Stack(); rs != nil {
+				s.MoveHostDevices(rs)
+			}
+		}
 		s.Destroy()
 	}
 }
@@ -153,6 +168,9 @@ func (n *Namespace) init() {
 }
 
 // afterLoad is invoked by stateify.
+//
+// Non-root network namespaces get a fresh stack, so devices created or moved
+// into them at runtime are not restored.
 func (n *Namespace) afterLoad(goContext.Context) {
 	n.init()
 }
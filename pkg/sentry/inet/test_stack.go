@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
 	"github.com/wilinz/gvisor/pkg/sentry/socket/netlink/nlmsg"
 	"github.com/wilinz/gvisor/pkg/syserr"
 	"github.com/wilinz/gvisor/pkg/tcpip"
@@ -38,6 +39,8 @@ type TestStack struct {
 	TCPSendBufSize    TCPBufferSize
 	TCPSACKFlag       bool
 	Recovery          TCPLossRecovery
+	SynCookies        int32
+	Sysctls           map[Sysctl]int64
 	IPForwarding      bool
 }
 
@@ -149,6 +152,35 @@ func (s *TestStack) SetTCPRecovery(recovery TCPLossRecovery) error {
 	return nil
 }
 
+// TCPSynCookies implements Stack.
+func (s *TestStack) TCPSynCookies() (int32, error) {
+	return s.SynCookies, nil
+}
+
+// SetTCPSynCookies implements Stack.
+func (s *TestStack) SetTCPSynCookies(v int32) error {
+	s.SynCookies = v
+	return nil
+}
+
+// Sysctl implements Stack.
+func (s *TestStack) Sysctl(sysctl Sysctl) (int64, error) {
+	v, ok := s.Sysctls[sysctl]
+	if !ok {
+		return 0, linuxerr.ENOENT
+	}
+	return v, nil
+}
+
+// SetSysctl implements Stack.
+func (s *TestStack) SetSysctl(sysctl Sysctl, v int64) error {
+	if s.Sysctls == nil {
+		s.Sysctls = make(map[Sysctl]int64)
+	}
+	s.Sysctls[sysctl] = v
+	return nil
+}
+
 // Statistics implements Stack.
 func (s *TestStack) Statistics(stat any, arg string) error {
 	return nil
@@ -169,12 +201,60 @@ func (s *TestStack) NewRoute(ctx context.Context, msg *nlmsg.Message) *syserr.Er
 	return syserr.ErrNotPermitted
 }
 
+// RoutingRules implements Stack.
+func (s *TestStack) RoutingRules() []Rule {
+	return nil
+}
+
+// NewRule implements Stack.
+func (s *TestStack) NewRule(ctx context.Context, msg *nlmsg.Message) *syserr.Error {
+	return syserr.ErrNotPermitted
+}
+
+// RemoveRule implements Stack.
+func (s *TestStack) RemoveRule(ctx context.Context, msg *nlmsg.Message) *syserr.Error {
+	return syserr.ErrNotPermitted
+}
+
+// Neighbors implements Stack.
+func (s *TestStack) Neighbors() []Neighbor {
+	return nil
+}
+
+// NewNeighbor implements Stack.
+func (s *TestStack) NewNeighbor(ctx context.Context, msg *nlmsg.Message) *syserr.Error {
+	return syserr.ErrNotPermitted
+}
+
+// RemoveNeighbor implements Stack.
+func (s *TestStack) RemoveNeighbor(ctx context.Context, msg *nlmsg.Message) *syserr.Error {
+	return syserr.ErrNotPermitted
+}
+
+// QDiscs implements Stack.
+func (s *TestStack) QDiscs() []QDisc {
+	return nil
+}
+
+// NewQDisc implements Stack.
+func (s *TestStack) NewQDisc(ctx context.Context, msg *nlmsg.Message) *syserr.Error {
+	return syserr.ErrNotPermitted
+}
+
+// RemoveQDisc implements Stack.
+func (s *TestStack) RemoveQDisc(ctx context.Context, msg *nlmsg.Message) *syserr.Error {
+	return syserr.ErrNotPermitted
+}
+
 // Pause implements Stack.
 func (s *TestStack) Pause() {}
 
 // Restore implements Stack.
 func (s *TestStack) Restore() {}
 
+// MoveHostDevices implements Stack.
+func (s *TestStack) MoveHostDevices(_ Stack) {}
+
 // ReplaceConfig implements Stack.
 func (s *TestStack) ReplaceConfig(_ Stack) {}
 
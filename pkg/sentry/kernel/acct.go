@@ -0,0 +1,167 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"math"
+	"time"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
+	"github.com/wilinz/gvisor/pkg/sentry/vfs"
+	"github.com/wilinz/gvisor/pkg/sync"
+	"github.com/wilinz/gvisor/pkg/usermem"
+)
+
+// processAccounting is the process accounting state of a PID namespace. See
+// kernel/acct.c.
+//
+// +stateify savable
+type processAccounting struct {
+	// mu serializes changes to, and writes of records to, file.
+	mu sync.Mutex `state:"nosave"`
+
+	// file is the file to which accounting records are appended, or nil if
+	// process accounting is disabled.
+	//
+	// +checklocks:mu
+	file *vfs.FileDescription
+
+	// userns is the user namespace of the task that enabled process
+	// accounting. User and group IDs in records are relative to userns.
+	//
+	// +checklocks:mu
+	userns *auth.UserNamespace
+}
+
+// SetProcessAccounting sets the file to which accounting records of processes
+// exiting in ns are appended, replacing any previous file. If fd is nil,
+// process accounting is disabled.
+func (ns *PIDNamespace) SetProcessAccounting(ctx context.Context, fd *vfs.FileDescription) {
+	var userns *auth.UserNamespace
+	if fd != nil {
+		fd.IncRef()
+		userns = auth.CredentialsFromContext(ctx).UserNamespace
+	}
+	ns.acct.mu.Lock()
+	old := ns.acct.file
+	ns.acct.file = fd
+	ns.acct.userns = userns
+	ns.acct.mu.Unlock()
+	if old != nil {
+		old.DecRef(ctx)
+	}
+}
+
+// acctProcess appends an accounting record for t's exiting thread group to the
+// accounting file of each PID namespace in which the thread group is visible,
+// as acct_process() in kernel/acct.c.
+//
+// Preconditions:
+//   - t is the last task in its thread group to exit.
+//   - t's MemoryManager has not been released.
+func (t *Task) acctProcess() {
+	tg := t.tg
+	type nsIDs struct {
+		ns   *PIDNamespace
+		pid  ThreadID
+		ppid ThreadID
+	}
+	var ids []nsIDs
+	tg.pidns.owner.mu.RLock()
+	var ptg *ThreadGroup
+	if parent := tg.leader.parent; parent != nil {
+		ptg = parent.tg
+	}
+	leader := tg.leader
+	forked := ptg != nil && !tg.execed
+	for ns := tg.pidns; ns != nil; ns = ns.parent {
+		ids = append(ids, nsIDs{ns, ns.tgids[tg], ns.tgids[ptg]})
+	}
+	tg.pidns.owner.mu.RUnlock()
+
+	// Like Linux, write records as the kernel, so that they aren't subject to
+	// t's limits.
+	ctx := t.Kernel().SupervisorContext()
+	var rec linux.AcctV3
+	filled := false
+	for _, id := range ids {
+		ns := id.ns
+		ns.acct.mu.Lock()
+		if ns.acct.file == nil {
+			ns.acct.mu.Unlock()
+			continue
+		}
+		if !filled {
+			t.fillAcctRecord(&rec, leader, forked)
+			filled = true
+		}
+		creds := t.Credentials()
+		rec.UID = uint32(creds.RealKUID.In(ns.acct.userns).OrOverflow())
+		rec.GID = uint32(creds.RealKGID.In(ns.acct.userns).OrOverflow())
+		rec.PID = uint32(id.pid)
+		rec.PPID = uint32(id.ppid)
+		buf := make([]byte, rec.SizeBytes())
+		rec.MarshalBytes(buf)
+		if _, err := ns.acct.file.Write(ctx, usermem.BytesIOSequence(buf), vfs.WriteOptions{}); err != nil {
+			t.Debugf("Failed to write process accounting record: %v", err)
+		}
+
+		// The namespace is dying with its init process, so stop accounting
+		// in it.
+		var old *vfs.FileDescription
+		if id.pid == initTID {
+			old = ns.acct.file
+			ns.acct.file = nil
+			ns.acct.userns = nil
+		}
+		ns.acct.mu.Unlock()
+		if old != nil {
+			old.DecRef(ctx)
+		}
+	}
+}
+
+// fillAcctRecord sets the fields of rec that don't depend on the PID namespace
+// to which it is written.
+func (t *Task) fillAcctRecord(rec *linux.AcctV3, leader *Task, forked bool) {
+	const tick = time.Second / linux.AHZ
+
+	rec.Version = linux.ACCT_VERSION
+	copy(rec.Comm[:linux.ACCT_COMM-1], t.Name())
+
+	start := leader.StartTime()
+	rec.BTime = uint32(start.Seconds())
+	elapsed := t.Kernel().RealtimeClock().Now().Sub(start)
+	rec.ETime = math.Float32bits(float32(max(elapsed, 0) / tick))
+
+	cpu := t.tg.CPUStats()
+	rec.UTime = linux.EncodeCompT(uint64(cpu.UserTime / tick))
+	rec.STime = linux.EncodeCompT(uint64(cpu.SysTime / tick))
+	rec.Mem = linux.EncodeCompT(t.MemoryManager().VirtualMemorySize() / 1024)
+
+	status := t.tg.ExitStatus()
+	rec.ExitCode = uint32(status)
+	if forked {
+		rec.Flag |= linux.AFORK
+	}
+	if status.Signaled() {
+		rec.Flag |= linux.AXSIG
+	}
+	if status.CoreDumped() {
+		rec.Flag |= linux.ACORE
+	}
+}
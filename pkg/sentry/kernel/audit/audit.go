@@ -0,0 +1,464 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit implements a minimal Linux audit subsystem.
+//
+// Audit records are generated for syscalls matching the rules installed via
+// NETLINK_AUDIT, for messages relayed from userspace (AUDIT_USER,
+// AUDIT_USER_AVC, etc.), and for configuration changes. Records are delivered
+// to the registered audit daemon, if any, and are otherwise written to the
+// sentry log.
+package audit
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/atomicbitops"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/log"
+	"github.com/wilinz/gvisor/pkg/sentry/ktime"
+	"github.com/wilinz/gvisor/pkg/sync"
+)
+
+// LoginUIDUnset is the login UID and session ID reported for all tasks.
+// gVisor does not implement /proc/[pid]/loginuid, so tasks never have a login
+// UID set.
+const LoginUIDUnset = ^uint32(0)
+
+// Daemon receives audit records. It is typically implemented by the
+// NETLINK_AUDIT socket of an auditd that registered itself via AUDIT_SET.
+type Daemon interface {
+	// Deliver sends a record of type typ to the daemon. An error indicates
+	// that the daemon is gone and should be unregistered.
+	Deliver(ctx context.Context, typ uint16, text string) error
+}
+
+// Context is the state of a task that audit rules are matched against and
+// records are generated from.
+type Context struct {
+	// Arch is the AUDIT_ARCH_* value of the syscall table in use.
+	Arch uint32
+
+	// Sysno, Args, Exit and Success describe the syscall being audited. They
+	// are only valid for syscall records.
+	Sysno   uintptr
+	Args    [4]uint64
+	Exit    int64
+	Success bool
+
+	// PID and PPID are the thread group IDs of the task and its parent, in
+	// the root PID namespace.
+	PID  int32
+	PPID int32
+
+	// Credentials of the task, in the root user namespace.
+	UID, EUID, SUID, FSUID uint32
+	GID, EGID, SGID, FSGID uint32
+
+	// Comm is the task name.
+	Comm string
+
+	// Exe is the path of the task's executable, if known.
+	Exe string
+}
+
+// Audit is the state of the audit subsystem. The zero value is a valid,
+// disabled audit subsystem.
+//
+// +stateify savable
+type Audit struct {
+	// syscallActive is 1 if syscalls may need to be audited, i.e. auditing
+	// is enabled and there is at least one syscall exit rule. It is read
+	// without holding mu on every syscall exit.
+	syscallActive atomicbitops.Uint32
+
+	mu sync.Mutex `state:"nosave"`
+
+	// enabled is the AUDIT_STATUS_ENABLED value: 0 (disabled), 1 (enabled)
+	// or 2 (enabled and locked).
+	//
+	// +checklocks:mu
+	enabled uint32
+
+	// failure is the AUDIT_STATUS_FAILURE value.
+	//
+	// +checklocks:mu
+	failure uint32
+
+	// daemon is the registered audit daemon, or nil.
+	//
+	// +checklocks:mu
+	daemon Daemon
+
+	// daemonPID is the PID reported by the daemon upon registration.
+	//
+	// +checklocks:mu
+	daemonPID uint32
+
+	// rateLimit and backlogLimit are recorded for AUDIT_GET but otherwise
+	// have no effect.
+	//
+	// +checklocks:mu
+	rateLimit uint32
+	// +checklocks:mu
+	backlogLimit uint32
+
+	// lost is the number of records that could not be delivered.
+	//
+	// +checklocks:mu
+	lost uint32
+
+	// serial is the serial number of the last record.
+	//
+	// +checklocks:mu
+	serial uint32
+
+	// rules are the installed filter rules, in insertion order.
+	//
+	// +checklocks:mu
+	rules []*Rule
+}
+
+// defaultBacklogLimit is Linux's default audit_backlog_limit.
+const defaultBacklogLimit = 64
+
+// SyscallActive returns true if syscall exits must be reported to
+// AuditSyscall.
+func (a *Audit) SyscallActive() bool {
+	return a.syscallActive.Load() != 0
+}
+
+// updateSyscallActiveLocked recomputes a.syscallActive.
+//
+// +checklocks:a.mu
+func (a *Audit) updateSyscallActiveLocked() {
+	active := uint32(0)
+	if a.enabled != 0 {
+		for _, r := range a.rules {
+			if r.List == linux.AUDIT_FILTER_EXIT {
+				active = 1
+				break
+			}
+		}
+	}
+	a.syscallActive.Store(active)
+}
+
+// Status returns the current status, as reported by AUDIT_GET.
+func (a *Audit) Status() linux.AuditStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	backlogLimit := a.backlogLimit
+	if backlogLimit == 0 {
+		backlogLimit = defaultBacklogLimit
+	}
+	return linux.AuditStatus{
+		Enabled:      a.enabled,
+		Failure:      a.failure,
+		PID:          a.daemonPID,
+		RateLimit:    a.rateLimit,
+		BacklogLimit: backlogLimit,
+		Lost:         a.lost,
+	}
+}
+
+// SetStatus applies the fields of s selected by s.Mask, as requested by
+// AUDIT_SET. d is the daemon to register if s sets a non-zero PID.
+func (a *Audit) SetStatus(ctx context.Context, c *Context, s *linux.AuditStatus, d Daemon) error {
+	a.mu.Lock()
+	if a.enabled == 2 && s.Mask&^linux.AUDIT_STATUS_PID != 0 {
+		// Configuration is locked until reboot.
+		a.mu.Unlock()
+		return linuxerr.EPERM
+	}
+	var changes []string
+	if s.Mask&linux.AUDIT_STATUS_ENABLED != 0 {
+		if s.Enabled > 2 {
+			a.mu.Unlock()
+			return linuxerr.EINVAL
+		}
+		changes = append(changes, fmt.Sprintf("audit_enabled=%d old=%d", s.Enabled, a.enabled))
+		a.enabled = s.Enabled
+	}
+	if s.Mask&linux.AUDIT_STATUS_FAILURE != 0 {
+		if s.Failure > linux.AUDIT_FAIL_PANIC {
+			a.mu.Unlock()
+			return linuxerr.EINVAL
+		}
+		changes = append(changes, fmt.Sprintf("audit_failure=%d old=%d", s.Failure, a.failure))
+		a.failure = s.Failure
+	}
+	if s.Mask&linux.AUDIT_STATUS_PID != 0 {
+		switch {
+		case s.PID == 0:
+			// Only the registered daemon may unregister itself.
+			if a.daemon == d {
+				a.daemon = nil
+				a.daemonPID = 0
+			}
+		case a.daemon != nil && a.daemon != d:
+			a.mu.Unlock()
+			return linuxerr.EEXIST
+		default:
+			a.daemon = d
+			a.daemonPID = s.PID
+		}
+	}
+	if s.Mask&linux.AUDIT_STATUS_RATE_LIMIT != 0 {
+		changes = append(changes, fmt.Sprintf("audit_rate_limit=%d old=%d", s.RateLimit, a.rateLimit))
+		a.rateLimit = s.RateLimit
+	}
+	if s.Mask&linux.AUDIT_STATUS_BACKLOG_LIMIT != 0 {
+		changes = append(changes, fmt.Sprintf("audit_backlog_limit=%d old=%d", s.BacklogLimit, a.backlogLimit))
+		a.backlogLimit = s.BacklogLimit
+	}
+	a.updateSyscallActiveLocked()
+	a.mu.Unlock()
+
+	for _, change := range changes {
+		a.logConfigChange(ctx, c, change)
+	}
+	return nil
+}
+
+// UnregisterDaemon unregisters d if it is the registered daemon.
+func (a *Audit) UnregisterDaemon(d Daemon) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.daemon == d {
+		a.daemon = nil
+		a.daemonPID = 0
+	}
+}
+
+// AddRule installs r, as requested by AUDIT_ADD_RULE.
+func (a *Audit) AddRule(ctx context.Context, c *Context, r *Rule) error {
+	a.mu.Lock()
+	if a.enabled == 2 {
+		a.mu.Unlock()
+		return linuxerr.EPERM
+	}
+	for _, other := range a.rules {
+		if r.equal(other) {
+			a.mu.Unlock()
+			return linuxerr.EEXIST
+		}
+	}
+	a.rules = append(a.rules, r)
+	a.updateSyscallActiveLocked()
+	a.mu.Unlock()
+
+	a.logConfigChange(ctx, c, fmt.Sprintf("op=add_rule key=%s list=%d res=1", keyString(r.Key), r.List))
+	return nil
+}
+
+// DeleteRule removes the rule equal to r, as requested by AUDIT_DEL_RULE.
+func (a *Audit) DeleteRule(ctx context.Context, c *Context, r *Rule) error {
+	a.mu.Lock()
+	if a.enabled == 2 {
+		a.mu.Unlock()
+		return linuxerr.EPERM
+	}
+	found := false
+	for i, other := range a.rules {
+		if r.equal(other) {
+			a.rules = append(a.rules[:i], a.rules[i+1:]...)
+			found = true
+			break
+		}
+	}
+	if !found {
+		a.mu.Unlock()
+		return linuxerr.ENOENT
+	}
+	a.updateSyscallActiveLocked()
+	a.mu.Unlock()
+
+	a.logConfigChange(ctx, c, fmt.Sprintf("op=remove_rule key=%s list=%d res=1", keyString(r.Key), r.List))
+	return nil
+}
+
+// Rules returns the installed rules, as reported by AUDIT_LIST_RULES.
+func (a *Audit) Rules() []*Rule {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]*Rule(nil), a.rules...)
+}
+
+// filterLocked evaluates the rules on list against c. It returns whether a
+// record should be generated and the key of the matching rule.
+//
+// +checklocks:a.mu
+func (a *Audit) filterLocked(list uint32, c *Context, msgType uint32, syscall bool) (bool, string) {
+	for _, r := range a.rules {
+		if r.List != list {
+			continue
+		}
+		if syscall && !r.matchesSyscall(c.Sysno) {
+			continue
+		}
+		if r.matches(c, msgType) {
+			return r.Action == linux.AUDIT_ALWAYS, r.Key
+		}
+	}
+	// Without a matching rule, syscalls are not audited and everything else
+	// is.
+	return !syscall, ""
+}
+
+// excludedLocked returns true if records of type msgType are suppressed by an
+// AUDIT_FILTER_EXCLUDE rule.
+//
+// +checklocks:a.mu
+func (a *Audit) excludedLocked(c *Context, msgType uint32) bool {
+	for _, r := range a.rules {
+		if r.List == linux.AUDIT_FILTER_EXCLUDE && r.matches(c, msgType) {
+			return r.Action == linux.AUDIT_NEVER
+		}
+	}
+	return false
+}
+
+// AuditSyscall generates a record for the syscall described by c if it is
+// selected by the installed rules.
+func (a *Audit) AuditSyscall(ctx context.Context, c *Context) {
+	a.mu.Lock()
+	if a.enabled == 0 {
+		a.mu.Unlock()
+		return
+	}
+	// AUDIT_FILTER_TASK rules are evaluated at syscall exit rather than at
+	// task creation; "never" rules on this list disable syscall auditing for
+	// matching tasks.
+	if ok, _ := a.filterLocked(linux.AUDIT_FILTER_TASK, c, linux.AUDIT_SYSCALL, false); !ok {
+		a.mu.Unlock()
+		return
+	}
+	ok, key := a.filterLocked(linux.AUDIT_FILTER_EXIT, c, linux.AUDIT_SYSCALL, true)
+	if !ok || a.excludedLocked(c, linux.AUDIT_SYSCALL) {
+		a.mu.Unlock()
+		return
+	}
+	a.serial++
+	prefix := a.prefixLocked(ctx)
+	d := a.daemon
+	a.mu.Unlock()
+
+	success := "no"
+	if c.Success {
+		success = "yes"
+	}
+	text := fmt.Sprintf("%sarch=%x syscall=%d success=%s exit=%d a0=%x a1=%x a2=%x a3=%x items=0 ppid=%d pid=%d auid=%d uid=%d gid=%d euid=%d suid=%d fsuid=%d egid=%d sgid=%d fsgid=%d tty=(none) ses=%d comm=%s exe=%s key=%s",
+		prefix, c.Arch, c.Sysno, success, c.Exit, c.Args[0], c.Args[1], c.Args[2], c.Args[3],
+		c.PPID, c.PID, LoginUIDUnset, c.UID, c.GID, c.EUID, c.SUID, c.FSUID, c.EGID, c.SGID, c.FSGID,
+		LoginUIDUnset, encodeString(c.Comm), encodeString(c.Exe), keyString(key))
+	if a.deliver(ctx, d, linux.AUDIT_SYSCALL, text) {
+		a.deliver(ctx, d, linux.AUDIT_EOE, prefix)
+	}
+}
+
+// UserMessage relays a message sent by userspace via NETLINK_AUDIT, such as
+// AUDIT_USER or AUDIT_USER_AVC, subject to the AUDIT_FILTER_USER rules.
+func (a *Audit) UserMessage(ctx context.Context, c *Context, typ uint16, msg string) {
+	a.mu.Lock()
+	if a.enabled == 0 {
+		a.mu.Unlock()
+		return
+	}
+	if ok, _ := a.filterLocked(linux.AUDIT_FILTER_USER, c, uint32(typ), false); !ok || a.excludedLocked(c, uint32(typ)) {
+		a.mu.Unlock()
+		return
+	}
+	a.serial++
+	prefix := a.prefixLocked(ctx)
+	d := a.daemon
+	a.mu.Unlock()
+
+	// Like Linux, truncate the message at the first newline or NUL.
+	if i := strings.IndexAny(msg, "\n\x00"); i >= 0 {
+		msg = msg[:i]
+	}
+	a.deliver(ctx, d, typ, fmt.Sprintf("%spid=%d uid=%d auid=%d ses=%d msg='%s'", prefix, c.PID, c.UID, LoginUIDUnset, LoginUIDUnset, msg))
+}
+
+// Log generates a kernel record of type typ, such as an AUDIT_AVC record from
+// a security module. text is appended to the standard record prefix.
+func (a *Audit) Log(ctx context.Context, c *Context, typ uint16, text string) {
+	a.mu.Lock()
+	if a.enabled == 0 || a.excludedLocked(c, uint32(typ)) {
+		a.mu.Unlock()
+		return
+	}
+	a.serial++
+	prefix := a.prefixLocked(ctx)
+	d := a.daemon
+	a.mu.Unlock()
+
+	a.deliver(ctx, d, typ, prefix+text)
+}
+
+// logConfigChange generates an AUDIT_CONFIG_CHANGE record for change. Unlike
+// other records, configuration changes are reported even while auditing is
+// disabled, as Linux does.
+func (a *Audit) logConfigChange(ctx context.Context, c *Context, change string) {
+	a.mu.Lock()
+	a.serial++
+	prefix := a.prefixLocked(ctx)
+	d := a.daemon
+	a.mu.Unlock()
+
+	a.deliver(ctx, d, linux.AUDIT_CONFIG_CHANGE, fmt.Sprintf("%s%s auid=%d ses=%d", prefix, change, LoginUIDUnset, LoginUIDUnset))
+}
+
+// prefixLocked returns the "audit(time:serial): " prefix for the current
+// record.
+//
+// +checklocks:a.mu
+func (a *Audit) prefixLocked(ctx context.Context) string {
+	now := ktime.NowFromContext(ctx)
+	sec, nsec := now.Unix()
+	return fmt.Sprintf("audit(%d.%03d:%d): ", sec, nsec/1e6, a.serial)
+}
+
+// deliver sends a record to d, or to the sentry log if d is nil. It returns
+// false if the record could not be delivered.
+func (a *Audit) deliver(ctx context.Context, d Daemon, typ uint16, text string) bool {
+	if d == nil {
+		log.Infof("audit: type=%d %s", typ, text)
+		return true
+	}
+	if err := d.Deliver(ctx, typ, text); err != nil {
+		a.mu.Lock()
+		a.lost++
+		if a.daemon == d {
+			a.daemon = nil
+			a.daemonPID = 0
+		}
+		a.mu.Unlock()
+		log.Warningf("audit: daemon unreachable, dropping record type=%d %s: %v", typ, text, err)
+		return false
+	}
+	return true
+}
+
+// keyString formats a rule filter key for a record.
+func keyString(key string) string {
+	if key == "" {
+		return "(null)"
+	}
+	return encodeString(key)
+}
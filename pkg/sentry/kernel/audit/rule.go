@@ -0,0 +1,270 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"fmt"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+)
+
+// Field is a single comparison in an audit rule.
+//
+// +stateify savable
+type Field struct {
+	// Type is the field type, one of linux.AUDIT_PID, linux.AUDIT_UID, etc.
+	Type uint32
+
+	// Op is the comparison operator, one of linux.AUDIT_EQUAL, etc.
+	Op uint32
+
+	// Value is the value to compare against.
+	Value uint32
+}
+
+// Rule is an audit filter rule, as added by AUDIT_ADD_RULE.
+//
+// +stateify savable
+type Rule struct {
+	// List is the filter list that the rule belongs to, one of
+	// linux.AUDIT_FILTER_*.
+	List uint32
+
+	// Action is linux.AUDIT_ALWAYS or linux.AUDIT_NEVER.
+	Action uint32
+
+	// Mask is the bitmask of syscall numbers that the rule applies to.
+	Mask [linux.AUDIT_BITMASK_SIZE]uint32
+
+	// Fields are the comparisons that must all match for the rule to apply.
+	Fields []Field
+
+	// Key is the filter key associated with the rule, reported in records
+	// generated by the rule.
+	Key string
+}
+
+// ParseRule parses an audit_rule_data structure, including its trailing
+// string buffer, from buf.
+func ParseRule(buf []byte) (*Rule, error) {
+	if len(buf) < linux.SizeOfAuditRuleData {
+		return nil, linuxerr.EINVAL
+	}
+	var data linux.AuditRuleData
+	data.UnmarshalUnsafe(buf)
+	strs := buf[linux.SizeOfAuditRuleData:]
+	if uint64(data.BufLen) > uint64(len(strs)) {
+		return nil, linuxerr.EINVAL
+	}
+	strs = strs[:data.BufLen]
+
+	r := &Rule{
+		List:   data.Flags,
+		Action: data.Action,
+		Mask:   data.Mask,
+	}
+	switch r.List {
+	case linux.AUDIT_FILTER_USER, linux.AUDIT_FILTER_TASK, linux.AUDIT_FILTER_EXIT, linux.AUDIT_FILTER_EXCLUDE:
+	default:
+		// AUDIT_FILTER_ENTRY is deprecated and rejected by Linux as well.
+		// Watches and filesystem filters are not supported.
+		return nil, linuxerr.EINVAL
+	}
+	if r.Action != linux.AUDIT_NEVER && r.Action != linux.AUDIT_ALWAYS {
+		return nil, linuxerr.EINVAL
+	}
+	if data.FieldCount > linux.AUDIT_MAX_FIELDS {
+		return nil, linuxerr.EINVAL
+	}
+	for i := uint32(0); i < data.FieldCount; i++ {
+		f := Field{
+			Type:  data.Fields[i],
+			Op:    data.FieldFlags[i] & linux.AUDIT_OPERATORS,
+			Value: data.Values[i],
+		}
+		switch f.Op {
+		case linux.AUDIT_EQUAL, linux.AUDIT_NOT_EQUAL, linux.AUDIT_LESS_THAN,
+			linux.AUDIT_GREATER_THAN, linux.AUDIT_LESS_THAN_OR_EQUAL,
+			linux.AUDIT_GREATER_THAN_OR_EQUAL, linux.AUDIT_BIT_MASK, linux.AUDIT_BIT_TEST:
+		default:
+			return nil, linuxerr.EINVAL
+		}
+		switch f.Type {
+		case linux.AUDIT_PID, linux.AUDIT_PPID, linux.AUDIT_UID, linux.AUDIT_EUID,
+			linux.AUDIT_SUID, linux.AUDIT_FSUID, linux.AUDIT_GID, linux.AUDIT_EGID,
+			linux.AUDIT_SGID, linux.AUDIT_FSGID, linux.AUDIT_LOGINUID, linux.AUDIT_MSGTYPE:
+		case linux.AUDIT_ARCH, linux.AUDIT_EXIT, linux.AUDIT_SUCCESS,
+			linux.AUDIT_ARG0, linux.AUDIT_ARG1, linux.AUDIT_ARG2, linux.AUDIT_ARG3:
+			// Only meaningful on syscall exit.
+			if r.List != linux.AUDIT_FILTER_EXIT {
+				return nil, linuxerr.EINVAL
+			}
+		case linux.AUDIT_FILTERKEY:
+			if r.Key != "" || f.Value > linux.AUDIT_MAX_KEY_LEN || uint64(f.Value) > uint64(len(strs)) {
+				return nil, linuxerr.EINVAL
+			}
+			r.Key = string(strs[:f.Value])
+			strs = strs[f.Value:]
+			// The key is reported separately and never affects matching.
+			continue
+		default:
+			return nil, linuxerr.EINVAL
+		}
+		r.Fields = append(r.Fields, f)
+	}
+	return r, nil
+}
+
+// Marshal serializes r as an audit_rule_data structure followed by its string
+// buffer, as returned by AUDIT_LIST_RULES.
+func (r *Rule) Marshal() []byte {
+	data := linux.AuditRuleData{
+		Flags:  r.List,
+		Action: r.Action,
+		Mask:   r.Mask,
+	}
+	n := 0
+	for _, f := range r.Fields {
+		data.Fields[n] = f.Type
+		data.FieldFlags[n] = f.Op
+		data.Values[n] = f.Value
+		n++
+	}
+	if r.Key != "" {
+		data.Fields[n] = linux.AUDIT_FILTERKEY
+		data.FieldFlags[n] = linux.AUDIT_EQUAL
+		data.Values[n] = uint32(len(r.Key))
+		data.BufLen = uint32(len(r.Key))
+		n++
+	}
+	data.FieldCount = uint32(n)
+
+	buf := make([]byte, linux.SizeOfAuditRuleData+len(r.Key))
+	data.MarshalUnsafe(buf)
+	copy(buf[linux.SizeOfAuditRuleData:], r.Key)
+	return buf
+}
+
+// equal returns true if r and other are the same rule.
+func (r *Rule) equal(other *Rule) bool {
+	if r.List != other.List || r.Action != other.Action || r.Mask != other.Mask || r.Key != other.Key || len(r.Fields) != len(other.Fields) {
+		return false
+	}
+	for i := range r.Fields {
+		if r.Fields[i] != other.Fields[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesSyscall returns true if sysno is set in the rule's syscall mask.
+func (r *Rule) matchesSyscall(sysno uintptr) bool {
+	word := sysno / 32
+	if word >= linux.AUDIT_BITMASK_SIZE {
+		return false
+	}
+	return r.Mask[word]&(1<<(sysno%32)) != 0
+}
+
+// matches returns true if every field of r matches c. msgType is the record
+// type being filtered, used by AUDIT_MSGTYPE fields.
+func (r *Rule) matches(c *Context, msgType uint32) bool {
+	for _, f := range r.Fields {
+		var v uint32
+		switch f.Type {
+		case linux.AUDIT_PID:
+			v = uint32(c.PID)
+		case linux.AUDIT_PPID:
+			v = uint32(c.PPID)
+		case linux.AUDIT_UID:
+			v = c.UID
+		case linux.AUDIT_EUID:
+			v = c.EUID
+		case linux.AUDIT_SUID:
+			v = c.SUID
+		case linux.AUDIT_FSUID:
+			v = c.FSUID
+		case linux.AUDIT_GID:
+			v = c.GID
+		case linux.AUDIT_EGID:
+			v = c.EGID
+		case linux.AUDIT_SGID:
+			v = c.SGID
+		case linux.AUDIT_FSGID:
+			v = c.FSGID
+		case linux.AUDIT_LOGINUID:
+			v = LoginUIDUnset
+		case linux.AUDIT_MSGTYPE:
+			v = msgType
+		case linux.AUDIT_ARCH:
+			v = c.Arch
+		case linux.AUDIT_EXIT:
+			v = uint32(c.Exit)
+		case linux.AUDIT_SUCCESS:
+			if c.Success {
+				v = 1
+			}
+		case linux.AUDIT_ARG0, linux.AUDIT_ARG1, linux.AUDIT_ARG2, linux.AUDIT_ARG3:
+			v = uint32(c.Args[f.Type-linux.AUDIT_ARG0])
+		}
+		// Linux compares exit codes as signed values and everything else
+		// as unsigned values.
+		if !compare(f, v, f.Type == linux.AUDIT_EXIT) {
+			return false
+		}
+	}
+	return true
+}
+
+// compare applies f's operator to v and f.Value.
+func compare(f Field, v uint32, signed bool) bool {
+	less := v < f.Value
+	if signed {
+		less = int32(v) < int32(f.Value)
+	}
+	switch f.Op {
+	case linux.AUDIT_EQUAL:
+		return v == f.Value
+	case linux.AUDIT_NOT_EQUAL:
+		return v != f.Value
+	case linux.AUDIT_LESS_THAN:
+		return less
+	case linux.AUDIT_LESS_THAN_OR_EQUAL:
+		return less || v == f.Value
+	case linux.AUDIT_GREATER_THAN:
+		return !less && v != f.Value
+	case linux.AUDIT_GREATER_THAN_OR_EQUAL:
+		return !less
+	case linux.AUDIT_BIT_MASK:
+		return v&f.Value != 0
+	case linux.AUDIT_BIT_TEST:
+		return v&f.Value == f.Value
+	}
+	return false
+}
+
+// encodeString formats s as an audit record value. Like Linux's
+// audit_log_untrustedstring, strings that could be confused with record
+// syntax are hex-encoded and all others are quoted.
+func encodeString(s string) string {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c == '"' || c < 0x21 || c > 0x7e {
+			return fmt.Sprintf("%X", s)
+		}
+	}
+	return "\"" + s + "\""
+}
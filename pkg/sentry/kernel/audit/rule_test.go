@@ -0,0 +1,164 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"testing"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+)
+
+func syscallRule(sysno uintptr, fields ...Field) *Rule {
+	r := &Rule{
+		List:   linux.AUDIT_FILTER_EXIT,
+		Action: linux.AUDIT_ALWAYS,
+		Fields: fields,
+	}
+	r.Mask[sysno/32] |= 1 << (sysno % 32)
+	return r
+}
+
+func TestRuleMarshalRoundTrip(t *testing.T) {
+	r := syscallRule(59, Field{Type: linux.AUDIT_UID, Op: linux.AUDIT_EQUAL, Value: 1000})
+	r.Key = "exec"
+	got, err := ParseRule(r.Marshal())
+	if err != nil {
+		t.Fatalf("ParseRule failed: %v", err)
+	}
+	if !got.equal(r) {
+		t.Errorf("ParseRule(Marshal()) = %+v, want %+v", got, r)
+	}
+}
+
+func TestParseRuleInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		modify func(*linux.AuditRuleData)
+	}{
+		{
+			name:   "entry list",
+			modify: func(d *linux.AuditRuleData) { d.Flags = linux.AUDIT_FILTER_ENTRY },
+		},
+		{
+			name:   "bad action",
+			modify: func(d *linux.AuditRuleData) { d.Action = 7 },
+		},
+		{
+			name:   "too many fields",
+			modify: func(d *linux.AuditRuleData) { d.FieldCount = linux.AUDIT_MAX_FIELDS + 1 },
+		},
+		{
+			name: "key overflows buffer",
+			modify: func(d *linux.AuditRuleData) {
+				d.FieldCount = 1
+				d.Fields[0] = linux.AUDIT_FILTERKEY
+				d.FieldFlags[0] = linux.AUDIT_EQUAL
+				d.Values[0] = 10
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := linux.AuditRuleData{
+				Flags:  linux.AUDIT_FILTER_EXIT,
+				Action: linux.AUDIT_ALWAYS,
+			}
+			tc.modify(&d)
+			buf := make([]byte, linux.SizeOfAuditRuleData)
+			d.MarshalUnsafe(buf)
+			if _, err := ParseRule(buf); err == nil {
+				t.Errorf("ParseRule succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	c := &Context{
+		Arch:  linux.AUDIT_ARCH_X86_64,
+		Sysno: 2,
+		Exit:  -2,
+		UID:   1000,
+		EUID:  0,
+	}
+	for _, tc := range []struct {
+		name  string
+		rule  *Rule
+		match bool
+	}{
+		{
+			name:  "syscall only",
+			rule:  syscallRule(2),
+			match: true,
+		},
+		{
+			name:  "uid equal",
+			rule:  syscallRule(2, Field{Type: linux.AUDIT_UID, Op: linux.AUDIT_EQUAL, Value: 1000}),
+			match: true,
+		},
+		{
+			name:  "uid not equal",
+			rule:  syscallRule(2, Field{Type: linux.AUDIT_UID, Op: linux.AUDIT_NOT_EQUAL, Value: 1000}),
+			match: false,
+		},
+		{
+			name:  "uid greater than or equal",
+			rule:  syscallRule(2, Field{Type: linux.AUDIT_UID, Op: linux.AUDIT_GREATER_THAN_OR_EQUAL, Value: 500}),
+			match: true,
+		},
+		{
+			name:  "signed exit",
+			rule:  syscallRule(2, Field{Type: linux.AUDIT_EXIT, Op: linux.AUDIT_LESS_THAN, Value: 0}),
+			match: true,
+		},
+		{
+			name:  "failed",
+			rule:  syscallRule(2, Field{Type: linux.AUDIT_SUCCESS, Op: linux.AUDIT_EQUAL, Value: 0}),
+			match: true,
+		},
+		{
+			name: "arch and euid",
+			rule: syscallRule(2,
+				Field{Type: linux.AUDIT_ARCH, Op: linux.AUDIT_EQUAL, Value: linux.AUDIT_ARCH_X86_64},
+				Field{Type: linux.AUDIT_EUID, Op: linux.AUDIT_EQUAL, Value: 1}),
+			match: false,
+		},
+		{
+			name:  "other syscall",
+			rule:  syscallRule(3),
+			match: false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.rule.matchesSyscall(c.Sysno) && tc.rule.matches(c, linux.AUDIT_SYSCALL)
+			if got != tc.match {
+				t.Errorf("rule match = %t, want %t", got, tc.match)
+			}
+		})
+	}
+}
+
+func TestEncodeString(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"cat", `"cat"`},
+		{"a b", "612062"},
+		{`q"`, "7122"},
+	} {
+		if got := encodeString(tc.in); got != tc.want {
+			t.Errorf("encodeString(%q) = %s, want %s", tc.in, got, tc.want)
+		}
+	}
+}
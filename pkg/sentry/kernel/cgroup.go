@@ -25,6 +25,7 @@ import (
 	"github.com/wilinz/gvisor/pkg/fspath"
 	"github.com/wilinz/gvisor/pkg/log"
 	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/kernfs"
+	"github.com/wilinz/gvisor/pkg/sentry/usage"
 	"github.com/wilinz/gvisor/pkg/sentry/vfs"
 )
 
@@ -224,6 +225,13 @@ type CgroupImpl interface {
 
 	// ID returns the id of this cgroup.
 	ID() uint32
+
+	// NumTasks returns the number of tasks in this cgroup. Returned value is a
+	// snapshot in time.
+	NumTasks() int
+
+	// ForEachChild calls fn for each immediate child cgroup of this cgroup.
+	ForEachChild(fn func(name string, child CgroupImpl))
 }
 
 // hierarchy represents a cgroupfs filesystem instance, with a unique set of
@@ -281,7 +289,8 @@ type CgroupRegistry struct {
 	lastHierarchyID atomicbitops.Uint32
 
 	// lastCgroupID is the id of the last allocated cgroup. Valid ids are
-	// from 1 to math.MaxUint32.
+	// from 1 to math.MaxUint32-1; math.MaxUint32 is reserved for
+	// usage.SharedMemCgID.
 	//
 	lastCgroupID atomicbitops.Uint32
 
@@ -465,6 +474,55 @@ func (r *CgroupRegistry) Register(name string, cs []CgroupController, fs cgroupF
 	return nil
 }
 
+// CgroupHierarchyInfo describes a registered cgroup hierarchy. See
+// CgroupRegistry.ForEachHierarchy.
+type CgroupHierarchyInfo struct {
+	// ID is the hierarchy ID.
+	ID uint32
+
+	// Name is the name of the hierarchy, if any.
+	Name string
+
+	// Controllers is the sorted list of controllers attached to the
+	// hierarchy.
+	Controllers []CgroupControllerType
+
+	// Root is the actual root cgroup of the hierarchy, ignoring any override
+	// of the effective root.
+	Root Cgroup
+}
+
+// ForEachHierarchy calls fn for each registered hierarchy, in order of
+// hierarchy ID. A reference is held on the hierarchy's filesystem while fn
+// runs, but r.mu is not, so fn may call other methods of r.
+func (r *CgroupRegistry) ForEachHierarchy(ctx context.Context, fn func(info CgroupHierarchyInfo)) {
+	r.mu.Lock()
+	hs := make([]hierarchy, 0, len(r.hierarchies))
+	for _, h := range r.hierarchies {
+		if !h.fs.TryIncRef() {
+			// Racing with filesystem destruction; see FindHierarchy.
+			continue
+		}
+		hs = append(hs, h)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(hs, func(i, j int) bool { return hs[i].id < hs[j].id })
+	for _, h := range hs {
+		info := CgroupHierarchyInfo{
+			ID:   h.id,
+			Name: h.name,
+			Root: h.fs.Impl().(cgroupFS).RootCgroup(),
+		}
+		for ty := range h.controllers {
+			info.Controllers = append(info.Controllers, ty)
+		}
+		sort.Slice(info.Controllers, func(i, j int) bool { return info.Controllers[i] < info.Controllers[j] })
+		fn(info)
+		h.fs.DecRef(ctx)
+	}
+}
+
 // Unregister removes a previously registered hierarchy from the registry. If no
 // such hierarchy is registered, Unregister is a no-op.
 func (r *CgroupRegistry) Unregister(hid uint32) {
@@ -540,7 +598,7 @@ func (r *CgroupRegistry) GenerateProcCgroups(buf *bytes.Buffer) {
 
 // NextCgroupID returns a newly allocated, unique cgroup ID.
 func (r *CgroupRegistry) NextCgroupID() (uint32, error) {
-	if cid := r.lastCgroupID.Add(1); cid != 0 {
+	if cid := r.lastCgroupID.Add(1); cid != 0 && cid != usage.SharedMemCgID {
 		return cid, nil
 	}
 	return InvalidCgroupID, fmt.Errorf("cgroup ID overflow")
@@ -0,0 +1,146 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/sentry/contexttest"
+	"github.com/wilinz/gvisor/pkg/sentry/vfs"
+)
+
+// testCgroupFS is a cgroupFS with no files. Only the vfs.FilesystemImpl
+// methods needed to manage its lifetime are implemented.
+type testCgroupFS struct {
+	vfs.FilesystemImpl
+
+	vfsfs    vfs.Filesystem
+	hid      uint32
+	root     CgroupImpl
+	released bool
+}
+
+// VFSFilesystem implements cgroupFS.VFSFilesystem.
+func (fs *testCgroupFS) VFSFilesystem() *vfs.Filesystem {
+	return &fs.vfsfs
+}
+
+// InitializeHierarchyID implements cgroupFS.InitializeHierarchyID.
+func (fs *testCgroupFS) InitializeHierarchyID(hid uint32) {
+	fs.hid = hid
+}
+
+// RootCgroup implements cgroupFS.RootCgroup.
+func (fs *testCgroupFS) RootCgroup() Cgroup {
+	return Cgroup{CgroupImpl: fs.root}
+}
+
+// Release implements vfs.FilesystemImpl.Release.
+func (fs *testCgroupFS) Release(ctx context.Context) {
+	fs.released = true
+}
+
+// testCgroupController is a CgroupController of a given type.
+type testCgroupController struct {
+	CgroupController
+
+	ty CgroupControllerType
+}
+
+// Type implements CgroupController.Type.
+func (c *testCgroupController) Type() CgroupControllerType {
+	return c.ty
+}
+
+func TestForEachHierarchy(t *testing.T) {
+	ctx := contexttest.Context(t)
+	vfsObj := &vfs.VirtualFilesystem{}
+	if err := vfsObj.Init(ctx); err != nil {
+		t.Fatalf("VFS init: %v", err)
+	}
+	r := newCgroupRegistry()
+
+	newFS := func() *testCgroupFS {
+		fs := &testCgroupFS{}
+		fs.vfsfs.Init(vfsObj, nil, fs)
+		return fs
+	}
+	register := func(name string, fs *testCgroupFS, ctypes ...CgroupControllerType) {
+		var cs []CgroupController
+		for _, ty := range ctypes {
+			cs = append(cs, &testCgroupController{ty: ty})
+		}
+		if err := r.Register(name, cs, fs); err != nil {
+			t.Fatalf("Register(%q, %v) failed: %v", name, ctypes, err)
+		}
+	}
+
+	memFS := newFS()
+	register("", memFS, CgroupControllerPIDs, CgroupControllerMemory)
+	namedFS := newFS()
+	register("named", namedFS)
+	cpuFS := newFS()
+	register("", cpuFS, CgroupControllerCPU)
+
+	// A hierarchy whose filesystem is being destroyed isn't visited.
+	cpuFS.vfsfs.DecRef(ctx)
+	if !cpuFS.released {
+		t.Fatalf("filesystem not released after dropping its last reference")
+	}
+
+	var got []CgroupHierarchyInfo
+	r.ForEachHierarchy(ctx, func(info CgroupHierarchyInfo) {
+		got = append(got, info)
+		// fn may call other registry methods.
+		if _, err := r.FindHierarchy("named", nil); err != nil {
+			t.Errorf("FindHierarchy failed within ForEachHierarchy: %v", err)
+		}
+		// A reference is held on the filesystem while fn runs.
+		for _, fs := range []*testCgroupFS{memFS, namedFS} {
+			if fs.hid == info.ID {
+				if refs := fs.vfsfs.ReadRefs(); refs < 2 {
+					t.Errorf("hierarchy %d: got %d filesystem references, want at least 2", info.ID, refs)
+				}
+			}
+		}
+	})
+	want := []CgroupHierarchyInfo{
+		{
+			ID:          memFS.hid,
+			Controllers: []CgroupControllerType{CgroupControllerMemory, CgroupControllerPIDs},
+			Root:        memFS.RootCgroup(),
+		},
+		{
+			ID:   namedFS.hid,
+			Name: "named",
+			Root: namedFS.RootCgroup(),
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ForEachHierarchy: got %+v, want %+v", got, want)
+	}
+
+	// FindHierarchy took a reference for each call above.
+	namedFS.vfsfs.DecRef(ctx)
+	namedFS.vfsfs.DecRef(ctx)
+	for _, fs := range []*testCgroupFS{memFS, namedFS} {
+		if refs := fs.vfsfs.ReadRefs(); refs != 1 {
+			t.Errorf("hierarchy %d: got %d filesystem references after ForEachHierarchy, want 1", fs.hid, refs)
+		}
+		fs.vfsfs.DecRef(ctx)
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package entropy implements the sandbox's virtual entropy pool, as exposed
+// by /dev/random, /dev/urandom, getrandom(2) and /proc/sys/kernel/random.
+//
+// Random bytes are always drawn from pkg/rand, so the pool never blocks and
+// output quality never depends on guest input. Data written to the pool is
+// mixed into a key that whitens all subsequent output, and entropy credits
+// are tracked so that entropy_avail, RNDGETENTCNT and poll(2) behave as
+// applications that manage entropy explicitly (e.g. rngd) expect.
+package entropy
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+
+	"github.com/wilinz/gvisor/pkg/atomicbitops"
+	"github.com/wilinz/gvisor/pkg/rand"
+	"github.com/wilinz/gvisor/pkg/sync"
+	"github.com/wilinz/gvisor/pkg/waiter"
+)
+
+const (
+	// PoolSizeBits is the size of the pool in bits, as reported by
+	// /proc/sys/kernel/random/poolsize. It is also the maximum entropy
+	// count. This is Linux's POOL_BITS.
+	PoolSizeBits = 256
+
+	// defaultURandomMinReseedSecs is Linux's default
+	// /proc/sys/kernel/random/urandom_min_reseed_secs.
+	defaultURandomMinReseedSecs = 60
+)
+
+// Pool is a virtual entropy pool. Pool must be initialized with Init before
+// use.
+//
+// +stateify savable
+type Pool struct {
+	// WriteWakeupThreshold is /proc/sys/kernel/random/write_wakeup_threshold:
+	// the pool is writable, as reported by Readiness, while the entropy count
+	// is below it.
+	WriteWakeupThreshold atomicbitops.Int32
+
+	// URandomMinReseedSecs is /proc/sys/kernel/random/urandom_min_reseed_secs.
+	// It is recorded but has no effect, since output is always freshly
+	// seeded.
+	URandomMinReseedSecs atomicbitops.Int32
+
+	// queue is notified when the pool becomes writable.
+	queue waiter.Queue
+
+	mu sync.Mutex `state:"nosave"`
+
+	// entropyCount is the number of bits of entropy credited to the pool, in
+	// the range [0, PoolSizeBits].
+	//
+	// +checklocks:mu
+	entropyCount int32
+
+	// key is mixed with written data, and keys the stream that whitens
+	// output.
+	//
+	// +checklocks:mu
+	key [sha256.Size]byte
+
+	// counter is the position in the whitening stream.
+	//
+	// +checklocks:mu
+	counter uint64
+}
+
+// Init initializes p. Since the host's entropy pool is initialized before the
+// sandbox starts, so is p.
+func (p *Pool) Init() {
+	p.WriteWakeupThreshold.Store(PoolSizeBits)
+	p.URandomMinReseedSecs.Store(defaultURandomMinReseedSecs)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.entropyCount = PoolSizeBits
+	p.reseedLocked()
+}
+
+// Read implements io.Reader.Read. It never blocks, and does not debit the
+// entropy count, as in Linux 5.18 and later.
+func (p *Pool) Read(dst []byte) (int, error) {
+	if _, err := io.ReadFull(rand.Reader, dst); err != nil {
+		return 0, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var block [sha256.Size]byte
+	var in [sha256.Size + 8]byte
+	copy(in[:], p.key[:])
+	for i := 0; i < len(dst); i += len(block) {
+		binary.LittleEndian.PutUint64(in[sha256.Size:], p.counter)
+		p.counter++
+		block = sha256.Sum256(in[:])
+		for j := 0; j < len(block) && i+j < len(dst); j++ {
+			dst[i+j] ^= block[j]
+		}
+	}
+	return len(dst), nil
+}
+
+// Mix mixes data into p without crediting any entropy, as for writes to
+// /dev/random.
+func (p *Pool) Mix(data []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.mixLocked(data)
+}
+
+// AddEntropy mixes data into p and credits bits of entropy, as for
+// RNDADDENTROPY.
+func (p *Pool) AddEntropy(data []byte, bits int32) {
+	p.mu.Lock()
+	p.mixLocked(data)
+	writable := p.creditLocked(bits)
+	p.mu.Unlock()
+	if writable {
+		p.queue.Notify(waiter.WritableEvents)
+	}
+}
+
+// Credit adjusts the entropy count by bits, which may be negative, as for
+// RNDADDTOENTCNT. The result is clamped to [0, PoolSizeBits].
+func (p *Pool) Credit(bits int32) {
+	p.mu.Lock()
+	writable := p.creditLocked(bits)
+	p.mu.Unlock()
+	if writable {
+		p.queue.Notify(waiter.WritableEvents)
+	}
+}
+
+// Zap sets the entropy count to zero, as for RNDZAPENTCNT and RNDCLEARPOOL.
+func (p *Pool) Zap() {
+	p.mu.Lock()
+	writable := p.creditLocked(-PoolSizeBits)
+	p.mu.Unlock()
+	if writable {
+		p.queue.Notify(waiter.WritableEvents)
+	}
+}
+
+// Reseed rekeys p from pkg/rand, as for RNDRESEEDCRNG.
+func (p *Pool) Reseed() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reseedLocked()
+}
+
+// EntropyAvail returns the number of bits of entropy credited to p.
+func (p *Pool) EntropyAvail() int32 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.entropyCount
+}
+
+// Readiness implements waiter.Waitable.Readiness. p is always readable, and
+// is writable while its entropy count is below WriteWakeupThreshold.
+func (p *Pool) Readiness(mask waiter.EventMask) waiter.EventMask {
+	ready := waiter.ReadableEvents
+	if p.EntropyAvail() < p.WriteWakeupThreshold.Load() {
+		ready |= waiter.WritableEvents
+	}
+	return mask & ready
+}
+
+// EventRegister implements waiter.Waitable.EventRegister.
+func (p *Pool) EventRegister(e *waiter.Entry) error {
+	p.queue.EventRegister(e)
+	return nil
+}
+
+// EventUnregister implements waiter.Waitable.EventUnregister.
+func (p *Pool) EventUnregister(e *waiter.Entry) {
+	p.queue.EventUnregister(e)
+}
+
+// creditLocked adjusts the entropy count by bits, and returns true if this
+// made p writable.
+//
+// +checklocks:p.mu
+func (p *Pool) creditLocked(bits int32) bool {
+	threshold := p.WriteWakeupThreshold.Load()
+	wasWritable := p.entropyCount < threshold
+	count := int64(p.entropyCount) + int64(bits)
+	if count < 0 {
+		count = 0
+	} else if count > PoolSizeBits {
+		count = PoolSizeBits
+	}
+	p.entropyCount = int32(count)
+	return !wasWritable && p.entropyCount < threshold
+}
+
+// +checklocks:p.mu
+func (p *Pool) mixLocked(data []byte) {
+	h := sha256.New()
+	h.Write(p.key[:])
+	h.Write(data)
+	h.Sum(p.key[:0])
+}
+
+// +checklocks:p.mu
+func (p *Pool) reseedLocked() {
+	var seed [sha256.Size]byte
+	if _, err := io.ReadFull(rand.Reader, seed[:]); err != nil {
+		panic("failed to seed entropy pool: " + err.Error())
+	}
+	p.mixLocked(seed[:])
+}
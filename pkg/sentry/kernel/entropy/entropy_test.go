@@ -0,0 +1,104 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package entropy
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/wilinz/gvisor/pkg/waiter"
+)
+
+func newTestPool() *Pool {
+	p := &Pool{}
+	p.Init()
+	return p
+}
+
+func TestCredit(t *testing.T) {
+	p := newTestPool()
+	if got := p.EntropyAvail(); got != PoolSizeBits {
+		t.Fatalf("initial EntropyAvail: got %d, wanted %d", got, PoolSizeBits)
+	}
+
+	for _, test := range []struct {
+		bits int32
+		want int32
+	}{
+		{bits: -100, want: PoolSizeBits - 100},
+		{bits: -1000, want: 0},
+		{bits: 8, want: 8},
+		{bits: 1000, want: PoolSizeBits},
+	} {
+		p.Credit(test.bits)
+		if got := p.EntropyAvail(); got != test.want {
+			t.Errorf("after Credit(%d): got %d, wanted %d", test.bits, got, test.want)
+		}
+	}
+
+	p.Zap()
+	if got := p.EntropyAvail(); got != 0 {
+		t.Errorf("after Zap: got %d, wanted 0", got)
+	}
+	p.AddEntropy([]byte("seed"), 16)
+	if got := p.EntropyAvail(); got != 16 {
+		t.Errorf("after AddEntropy: got %d, wanted 16", got)
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	p := newTestPool()
+	mask := waiter.ReadableEvents | waiter.WritableEvents
+	if got, want := p.Readiness(mask), waiter.ReadableEvents; got != want {
+		t.Errorf("full pool: got readiness %v, wanted %v", got, want)
+	}
+
+	e, ch := waiter.NewChannelEntry(waiter.WritableEvents)
+	p.EventRegister(&e)
+	defer p.EventUnregister(&e)
+
+	p.Credit(-1)
+	if got := p.Readiness(mask); got != mask {
+		t.Errorf("below threshold: got readiness %v, wanted %v", got, mask)
+	}
+	select {
+	case <-ch:
+	default:
+		t.Error("waiter not notified when pool became writable")
+	}
+
+	p.WriteWakeupThreshold.Store(64)
+	if got, want := p.Readiness(mask), waiter.ReadableEvents; got != want {
+		t.Errorf("above lowered threshold: got readiness %v, wanted %v", got, want)
+	}
+}
+
+func TestRead(t *testing.T) {
+	p := newTestPool()
+	var a, b [100]byte
+	if n, err := p.Read(a[:]); err != nil || n != len(a) {
+		t.Fatalf("Read: got (%d, %v), wanted (%d, nil)", n, err, len(a))
+	}
+	p.Mix([]byte("input"))
+	if n, err := p.Read(b[:]); err != nil || n != len(b) {
+		t.Fatalf("Read: got (%d, %v), wanted (%d, nil)", n, err, len(b))
+	}
+	if bytes.Equal(a[:], b[:]) {
+		t.Error("consecutive reads returned identical bytes")
+	}
+	if got := p.EntropyAvail(); got != PoolSizeBits {
+		t.Errorf("reads debited the pool: got EntropyAvail %d, wanted %d", got, PoolSizeBits)
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"math/bits"
+)
+
+// fdBitmap is the set of file descriptors in use in an FDTable.
+//
+// It is a tree of bitmaps: levels[0] has a bit per file descriptor, and bit i
+// of levels[k+1] is set iff word i of levels[k] is full. Finding the lowest
+// free file descriptor thus takes O(log64(n)) word operations instead of a
+// scan over all file descriptors in use.
+type fdBitmap struct {
+	// levels holds the bitmaps, from the leaves up. The last level is a
+	// single word.
+	levels [][]uint64
+
+	// numOnes is the number of file descriptors in the set.
+	numOnes uint32
+}
+
+// newFDBitmap returns an empty fdBitmap with room for at least size file
+// descriptors.
+func newFDBitmap(size uint32) fdBitmap {
+	var b fdBitmap
+	b.grow((size + 63) / 64)
+	return b
+}
+
+// grow grows the leaf level to at least words words, and resizes the upper
+// levels to match.
+func (b *fdBitmap) grow(words uint32) {
+	for k := 0; ; k++ {
+		if k > 0 {
+			words = (uint32(len(b.levels[k-1])) + 63) / 64
+		}
+		words = max(words, 1)
+		if k == len(b.levels) {
+			// A new level has to reflect the full words of the
+			// level below, which was the top level until now.
+			level := make([]uint64, words)
+			if k > 0 {
+				for j, w := range b.levels[k-1] {
+					if w == ^uint64(0) {
+						level[j/64] |= 1 << (j % 64)
+					}
+				}
+			}
+			b.levels = append(b.levels, level)
+		} else if n := uint32(len(b.levels[k])); n < words {
+			b.levels[k] = append(b.levels[k], make([]uint64, words-n)...)
+		}
+		if words == 1 {
+			return
+		}
+	}
+}
+
+// isEmpty returns true if there are no file descriptors in the set.
+func (b *fdBitmap) isEmpty() bool {
+	return b.numOnes == 0
+}
+
+// getNumOnes returns the number of file descriptors in the set.
+func (b *fdBitmap) getNumOnes() uint32 {
+	return b.numOnes
+}
+
+// add adds fd to the set.
+func (b *fdBitmap) add(fd uint32) {
+	if i := fd / 64; i >= uint32(len(b.levels[0])) {
+		b.grow(i + 1)
+	}
+	if b.levels[0][fd/64]&(1<<(fd%64)) != 0 {
+		return
+	}
+	b.numOnes++
+	// Set the bit, and propagate fullness up the tree.
+	for k := range b.levels {
+		w := &b.levels[k][fd/64]
+		*w |= 1 << (fd % 64)
+		if *w != ^uint64(0) {
+			return
+		}
+		fd /= 64
+	}
+}
+
+// remove removes fd from the set.
+func (b *fdBitmap) remove(fd uint32) {
+	if fd/64 >= uint32(len(b.levels[0])) || b.levels[0][fd/64]&(1<<(fd%64)) == 0 {
+		return
+	}
+	b.numOnes--
+	// Clear the bit, and clear the fullness bits of the words which were
+	// full.
+	for k := range b.levels {
+		w := &b.levels[k][fd/64]
+		wasFull := *w == ^uint64(0)
+		*w &^= 1 << (fd % 64)
+		if !wasFull {
+			return
+		}
+		fd /= 64
+	}
+}
+
+// firstZero returns the lowest file descriptor greater than or equal to start
+// which isn't in the set.
+func (b *fdBitmap) firstZero(start uint32) uint32 {
+	// Walk up the tree until a word has a zero bit at or after the
+	// position of start in it.
+	i := start
+	k := 0
+	for ; k < len(b.levels); k++ {
+		level := b.levels[k]
+		if i/64 >= uint32(len(level)) {
+			// Past the end of the level, everything is free. All
+			// words before i at this level are full.
+			return i << (6 * k)
+		}
+		w := level[i/64] | (1<<(i%64) - 1)
+		if w != ^uint64(0) {
+			i = i/64*64 + uint32(bits.TrailingZeros64(^w))
+			break
+		}
+		// Continue with the next word of this level.
+		i = i/64 + 1
+	}
+	if k == len(b.levels) {
+		// The whole tree is full.
+		return uint32(len(b.levels[0])) * 64
+	}
+	// Walk down the tree to the first zero bit in the subtree of i.
+	for ; k > 0; k-- {
+		level := b.levels[k-1]
+		if i >= uint32(len(level)) {
+			return i << (6 * k)
+		}
+		i = i*64 + uint32(bits.TrailingZeros64(^level[i]))
+	}
+	return i
+}
+
+// firstOne returns the lowest file descriptor greater than or equal to start
+// which is in the set. ok is false if there is none.
+func (b *fdBitmap) firstOne(start uint32) (fd uint32, ok bool) {
+	leaves := b.levels[0]
+	i := start / 64
+	if i >= uint32(len(leaves)) {
+		return 0, false
+	}
+	w := leaves[i] & (^uint64(0) << (start % 64))
+	for {
+		if w != 0 {
+			return i*64 + uint32(bits.TrailingZeros64(w)), true
+		}
+		i++
+		if i == uint32(len(leaves)) {
+			return 0, false
+		}
+		w = leaves[i]
+	}
+}
+
+// maximum returns the largest file descriptor in the set, or zero if it is
+// empty.
+func (b *fdBitmap) maximum() uint32 {
+	leaves := b.levels[0]
+	for i := len(leaves) - 1; i >= 0; i-- {
+		if w := leaves[i]; w != 0 {
+			return uint32(i*64 + 63 - bits.LeadingZeros64(w))
+		}
+	}
+	return 0
+}
+
+// forEach calls fn for each file descriptor of the set in the range
+// [start, end), in order. If fn returns false, forEach stops the iteration.
+func (b *fdBitmap) forEach(start, end uint32, fn func(fd uint32) bool) {
+	for fd, ok := b.firstOne(start); ok && fd < end; fd, ok = b.firstOne(fd + 1) {
+		if !fn(fd) {
+			return
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestFDBitmapFirstZero(t *testing.T) {
+	b := newFDBitmap(64)
+	// Fill the bitmap past several levels of the tree.
+	const n = 64*64*64 + 100
+	for i := uint32(0); i < n; i++ {
+		if got := b.firstZero(0); got != i {
+			t.Fatalf("b.firstZero(0) = %d, want %d", got, i)
+		}
+		b.add(i)
+	}
+	b.remove(12345)
+	if got, want := b.firstZero(0), uint32(12345); got != want {
+		t.Errorf("b.firstZero(0) = %d, want %d", got, want)
+	}
+	if got, want := b.firstZero(12346), uint32(n); got != want {
+		t.Errorf("b.firstZero(12346) = %d, want %d", got, want)
+	}
+	if got, want := b.getNumOnes(), uint32(n-1); got != want {
+		t.Errorf("b.getNumOnes() = %d, want %d", got, want)
+	}
+	if got, want := b.maximum(), uint32(n-1); got != want {
+		t.Errorf("b.maximum() = %d, want %d", got, want)
+	}
+}
+
+func TestFDBitmapRandom(t *testing.T) {
+	const limit = 10000
+	r := rand.New(rand.NewSource(1))
+	b := newFDBitmap(64)
+	set := make(map[uint32]struct{})
+	has := func(fd uint32) bool {
+		_, ok := set[fd]
+		return ok
+	}
+	for i := 0; i < 100000; i++ {
+		fd := uint32(r.Intn(limit))
+		switch r.Intn(3) {
+		case 0:
+			b.add(fd)
+			set[fd] = struct{}{}
+		case 1:
+			b.remove(fd)
+			delete(set, fd)
+		case 2:
+			want := fd
+			for has(want) {
+				want++
+			}
+			if got := b.firstZero(fd); got != want {
+				t.Fatalf("b.firstZero(%d) = %d, want %d", fd, got, want)
+			}
+			want = fd
+			for want < limit && !has(want) {
+				want++
+			}
+			got, ok := b.firstOne(fd)
+			if wantOK := want < limit; ok != wantOK || (ok && got != want) {
+				t.Fatalf("b.firstOne(%d) = (%d, %t), want (%d, %t)", fd, got, ok, want, wantOK)
+			}
+		}
+	}
+	if got, want := b.getNumOnes(), uint32(len(set)); got != want {
+		t.Errorf("b.getNumOnes() = %d, want %d", got, want)
+	}
+}
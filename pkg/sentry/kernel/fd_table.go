@@ -83,7 +83,7 @@ type FDTable struct {
 	mu fdTableMutex `state:"nosave"`
 
 	// fdBitmap shows which fds are already in use.
-	fdBitmap bitmap.Bitmap `state:"nosave"`
+	fdBitmap fdBitmap `state:"nosave"`
 
 	// descriptorTable holds descriptors.
 	descriptorTable `state:".(map[int32]descriptor)"`
@@ -106,7 +106,7 @@ func (f *FDTable) saveDescriptorTable() map[int32]descriptor {
 func (f *FDTable) loadDescriptorTable(_ goContext.Context, m map[int32]descriptor) {
 	ctx := context.Background()
 	f.initNoLeakCheck() // Initialize table.
-	f.fdBitmap = bitmap.New(uint32(math.MaxUint16))
+	f.fdBitmap = newFDBitmap(uint32(math.MaxUint16))
 	for fd, d := range m {
 		if fd < 0 {
 			panic(fmt.Sprintf("FD is not supposed to be negative. FD: %d", fd))
@@ -115,7 +115,7 @@ func (f *FDTable) loadDescriptorTable(_ goContext.Context, m map[int32]descripto
 		if df := f.set(fd, d.file, d.flags); df != nil {
 			panic("file set")
 		}
-		f.fdBitmap.Add(uint32(fd))
+		f.fdBitmap.add(uint32(fd))
 		// Note that we do _not_ need to acquire a extra table reference here. The
 		// table reference will already be accounted for in the file, so we drop the
 		// reference taken by set above.
@@ -158,7 +158,7 @@ func (f *FDTable) DecRef(ctx context.Context) {
 // It is the caller's responsibility to acquire an appropriate lock.
 func (f *FDTable) forEachUpTo(ctx context.Context, maxFd int32, fn func(fd int32, file *vfs.FileDescription, flags FDFlags) bool) {
 	// Iterate through the fdBitmap.
-	f.fdBitmap.ForEach(0, uint32(maxFd), func(ufd uint32) bool {
+	f.fdBitmap.forEach(0, uint32(maxFd), func(ufd uint32) bool {
 		fd := int32(ufd)
 		file, flags, ok := f.get(fd)
 		if !ok || file == nil {
@@ -243,33 +243,13 @@ func (f *FDTable) NewFDs(ctx context.Context, minFD int32, files []*vfs.FileDesc
 
 	f.mu.Lock()
 
-	// max is used as the largest number in fdBitmap + 1.
-	max := int32(0)
-	if !f.fdBitmap.IsEmpty() {
-		max = int32(f.fdBitmap.Maximum())
-		max++
-	}
-
-	// Adjust max in case it is less than minFD.
-	if max < minFD {
-		max = minFD
-	}
 	// Install all entries.
 	for len(fds) < len(files) {
-		// Try to use free bit in fdBitmap.
-		// If all bits in fdBitmap are used, expand fd to the max.
-		fd, err := f.fdBitmap.FirstZero(uint32(minFD))
-		if err != nil {
-			fd = uint32(max)
-			max++
-		}
+		fd := f.fdBitmap.firstZero(uint32(minFD))
 		if fd >= uint32(end) {
 			break
 		}
-		f.fdBitmap.Add(fd)
-		if fd == uint32(max) {
-			max = int32(fd + 1)
-		}
+		f.fdBitmap.add(fd)
 		if df := f.set(int32(fd), files[len(fds)], flags); df != nil {
 			panic("file set")
 		}
@@ -281,7 +261,7 @@ func (f *FDTable) NewFDs(ctx context.Context, minFD int32, files []*vfs.FileDesc
 	if len(fds) < len(files) {
 		for _, i := range fds {
 			_ = f.set(i, nil, FDFlags{})
-			f.fdBitmap.Remove(uint32(i))
+			f.fdBitmap.remove(uint32(i))
 		}
 		f.mu.Unlock()
 
@@ -337,7 +317,7 @@ func (f *FDTable) NewFDAt(ctx context.Context, fd int32, file *vfs.FileDescripti
 	df := f.set(fd, file, flags)
 	// Add fd to fdBitmap.
 	if df == nil {
-		f.fdBitmap.Add(uint32(fd))
+		f.fdBitmap.add(uint32(fd))
 	}
 	f.mu.Unlock()
 
@@ -383,7 +363,7 @@ func (f *FDTable) SetFlagsForRange(ctx context.Context, startFd int32, endFd int
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	for fd, err := f.fdBitmap.FirstOne(uint32(startFd)); err == nil && fd <= uint32(endFd); fd, err = f.fdBitmap.FirstOne(fd + 1) {
+	for fd, ok := f.fdBitmap.firstOne(uint32(startFd)); ok && fd <= uint32(endFd); fd, ok = f.fdBitmap.firstOne(fd + 1) {
 		fdI32 := int32(fd)
 		file, _, _ := f.get(fdI32)
 		if df := f.set(fdI32, file, flags); df != nil {
@@ -426,7 +406,7 @@ func (f *FDTable) Get(fd int32) (*vfs.FileDescription, FDFlags) {
 func (f *FDTable) GetFDs(ctx context.Context) []int32 {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	fds := make([]int32, 0, int(f.fdBitmap.GetNumOnes()))
+	fds := make([]int32, 0, int(f.fdBitmap.getNumOnes()))
 	f.ForEach(ctx, func(fd int32, _ *vfs.FileDescription, _ FDFlags) bool {
 		fds = append(fds, fd)
 		return true
@@ -456,7 +436,7 @@ func (f *FDTable) Fork(ctx context.Context, maxFd int32) *FDTable {
 		if df := clone.set(fd, file, flags); df != nil {
 			panic("file set")
 		}
-		clone.fdBitmap.Add(uint32(fd))
+		clone.fdBitmap.add(uint32(fd))
 		return true
 	})
 	return clone
@@ -473,7 +453,7 @@ func (f *FDTable) Remove(ctx context.Context, fd int32) *vfs.FileDescription {
 	f.mu.Lock()
 	df := f.set(fd, nil, FDFlags{}) // Zap entry.
 	if df != nil {
-		f.fdBitmap.Remove(uint32(fd))
+		f.fdBitmap.remove(uint32(fd))
 	}
 	f.mu.Unlock()
 
@@ -493,7 +473,7 @@ func (f *FDTable) RemoveIf(ctx context.Context, cond func(*vfs.FileDescription,
 		if cond(file, flags) {
 			// Clear from table.
 			if df := f.set(fd, nil, FDFlags{}); df != nil {
-				f.fdBitmap.Remove(uint32(fd))
+				f.fdBitmap.remove(uint32(fd))
 				files = append(files, df)
 			}
 		}
@@ -517,15 +497,15 @@ func (f *FDTable) RemoveNextInRange(ctx context.Context, startFd int32, endFd in
 	}
 
 	f.mu.Lock()
-	fdUint, err := f.fdBitmap.FirstOne(uint32(startFd))
+	fdUint, ok := f.fdBitmap.firstOne(uint32(startFd))
 	fd := int32(fdUint)
-	if err != nil || fd > endFd {
+	if !ok || fd > endFd {
 		f.mu.Unlock()
 		return MaxFdLimit, nil
 	}
 	df := f.set(fd, nil, FDFlags{}) // Zap entry.
 	if df != nil {
-		f.fdBitmap.Remove(uint32(fd))
+		f.fdBitmap.remove(uint32(fd))
 	}
 	f.mu.Unlock()
 
@@ -541,9 +521,5 @@ func (f *FDTable) GetLastFd() int32 {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	last := f.fdBitmap.Maximum()
-	if last > bitmap.MaxBitEntryLimit {
-		return MaxFdLimit
-	}
-	return int32(last)
+	return int32(f.fdBitmap.maximum())
 }
@@ -313,6 +313,38 @@ func BenchmarkFDLookupAndDecRefConcurrent(b *testing.B) {
 	})
 }
 
+func BenchmarkNewFDAndRemoveWithManyFDs(b *testing.B) {
+	const (
+		maxLimit = 1 << 20
+		open     = 100000
+	)
+	b.StopTimer() // Setup.
+
+	runTest(b, func(ctx context.Context, fdTable *FDTable, fd *vfs.FileDescription, limitSet *limits.LimitSet) {
+		// Remove the previous limit.
+		limitSet.Set(limits.NumberOfFiles, limits.Limit{maxLimit, maxLimit}, true)
+		for i := 0; i < open; i++ {
+			if _, err := fdTable.NewFD(ctx, 0, fd, FDFlags{}); err != nil {
+				b.Fatalf("fdTable.NewFD: got %v, wanted nil", err)
+			}
+		}
+
+		// Close and reopen FDs in the middle of the table, like a proxy
+		// churning through connections does.
+		b.StartTimer() // Benchmark.
+		for i := 0; i < b.N; i++ {
+			n := int32(open / 2)
+			if df := fdTable.Remove(ctx, n); df != nil {
+				df.DecRef(ctx)
+			}
+			got, err := fdTable.NewFD(ctx, 0, fd, FDFlags{})
+			if err != nil || got != n {
+				b.Fatalf("fdTable.NewFD: got (%d, %v), wanted (%d, nil)", got, err, n)
+			}
+		}
+	})
+}
+
 func TestSetFlagsForRange(t *testing.T) {
 	type testCase struct {
 		name    string
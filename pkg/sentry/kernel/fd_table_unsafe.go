@@ -17,7 +17,6 @@ package kernel
 import (
 	"math"
 
-	"github.com/wilinz/gvisor/pkg/bitmap"
 	"github.com/wilinz/gvisor/pkg/sentry/vfs"
 )
 
@@ -46,7 +45,7 @@ func (f *FDTable) initNoLeakCheck() {
 func (f *FDTable) init() {
 	f.initNoLeakCheck()
 	f.InitRefs()
-	f.fdBitmap = bitmap.New(uint32(math.MaxUint16))
+	f.fdBitmap = newFDBitmap(uint32(math.MaxUint16))
 }
 
 const (
@@ -92,6 +92,37 @@ func (k *Key) matches(k2 *Key) bool {
 	return k.Kind == k2.Kind && k.Mappable == k2.Mappable && k.Offset == k2.Offset
 }
 
+// PIKey identifies a futex independently of reference counting. Unlike Key,
+// PIKey is comparable, so it can be used to associate state with PI futexes.
+type PIKey struct {
+	// m is the Manager in which the futex was looked up for private keys,
+	// which are only meaningful within a single address space, and nil for
+	// KindSharedMappable keys.
+	m *Manager
+
+	kind     KeyKind
+	mappable memmap.Mappable
+	offset   uint64
+}
+
+// PIKey returns the PIKey for the futex at addr.
+func (m *Manager) PIKey(t Target, addr hostarch.Addr, private bool) (PIKey, error) {
+	k, err := getKey(t, addr, private)
+	if err != nil {
+		return PIKey{}, err
+	}
+	pk := PIKey{
+		kind:     k.Kind,
+		mappable: k.Mappable,
+		offset:   k.Offset,
+	}
+	if k.Kind != KindSharedMappable {
+		pk.m = m
+	}
+	k.release(t)
+	return pk, nil
+}
+
 // Target abstracts memory accesses and keys.
 type Target interface {
 	context.Context
@@ -232,6 +263,28 @@ type Waiter struct {
 
 	// tid is the thread ID for the waiter in case this is a PI mutex.
 	tid uint32
+
+	// prio is the priority of the waiting task, on the same scale as Linux's
+	// task_struct::prio (lower values are higher priority). PI waiters are
+	// queued in priority order, FIFO among waiters of equal priority.
+	prio int
+
+	// pi is true if the waiter is waiting to acquire a PI futex.
+	pi bool
+
+	// owner is the TID of the owner of the PI futex at the time the waiter
+	// was enqueued on it.
+	owner uint32
+
+	// requeuePI is true if the waiter was enqueued by WaitRequeuePIPrepare,
+	// and may be requeued by CmpRequeuePI onto the PI futex represented by
+	// requeuePIKey.
+	requeuePI    bool
+	requeuePIKey Key
+
+	// acquiredPI is set to true when ownership of a PI futex is transferred
+	// to the waiter.
+	acquiredPI bool
 }
 
 // NewWaiter returns a new unqueued Waiter.
@@ -246,6 +299,54 @@ func (w *Waiter) woken() bool {
 	return len(w.C) != 0
 }
 
+// PIOwner returns the TID of the owner of the PI futex that w is waiting to
+// acquire, as observed when w was enqueued by LockPI.
+//
+// Preconditions: LockPI(w, ...) returned (false, nil) and WaitCompletePI has
+// not yet been called.
+func (w *Waiter) PIOwner() uint32 {
+	return w.owner
+}
+
+// SetPriority changes the priority of w. If w is waiting to acquire a PI
+// futex, it is requeued to maintain priority order. If w is not enqueued,
+// SetPriority has no effect.
+func (w *Waiter) SetPriority(prio int) {
+	for {
+		b := w.bucket.Load()
+		if b == nil {
+			return
+		}
+
+		// See WaitComplete for why we must check that w is still in b.
+		b.mu.Lock()
+		if b != w.bucket.Load() {
+			b.mu.Unlock()
+			continue
+		}
+		if w.prio != prio {
+			w.prio = prio
+			if w.pi {
+				b.waiters.Remove(w)
+				b.enqueuePILocked(w)
+			}
+		}
+		b.mu.Unlock()
+		return
+	}
+}
+
+// reset prepares w to be enqueued.
+func (w *Waiter) reset() {
+	select {
+	case <-w.C:
+	default:
+	}
+	w.pi = false
+	w.requeuePI = false
+	w.acquiredPI = false
+}
+
 // bucket holds a list of waiters for a given address hash.
 //
 // +stateify savable
@@ -263,7 +364,9 @@ type bucket struct {
 func (b *bucket) wakeLocked(key *Key, bitmask uint32, n int) int {
 	done := 0
 	for w := b.waiters.Front(); done < n && w != nil; {
-		if !w.key.matches(key) || w.bitmask&bitmask == 0 {
+		// PI waiters may only be woken by a transfer of ownership. (Linux
+		// fails the wakeup with EINVAL instead.)
+		if !w.key.matches(key) || w.bitmask&bitmask == 0 || w.pi || w.requeuePI {
 			// Not matching.
 			w = w.Next()
 			continue
@@ -279,9 +382,14 @@ func (b *bucket) wakeLocked(key *Key, bitmask uint32, n int) int {
 }
 
 func (b *bucket) wakeWaiterLocked(w *Waiter) {
-	// Remove from the bucket and wake the waiter.
+	// Remove from the bucket and wake the waiter. w.C may be shared by
+	// several Waiters in a MultiWaiter, in which case it may already hold a
+	// pending wakeup.
 	b.waiters.Remove(w)
-	w.C <- struct{}{}
+	select {
+	case w.C <- struct{}{}:
+	default:
+	}
 
 	// NOTE: The above channel write establishes a write barrier according
 	// to the memory model, so nothing may be ordered around it. Since
@@ -301,7 +409,9 @@ func (b *bucket) wakeWaiterLocked(w *Waiter) {
 func (b *bucket) requeueLocked(t Target, to *bucket, key, nkey *Key, n int) int {
 	done := 0
 	for w := b.waiters.Front(); done < n && w != nil; {
-		if !w.key.matches(key) {
+		// Waiters related to PI futexes may only be requeued by
+		// CmpRequeuePI.
+		if !w.key.matches(key) || w.pi || w.requeuePI {
 			// Not matching.
 			w = w.Next()
 			continue
@@ -319,6 +429,42 @@ func (b *bucket) requeueLocked(t Target, to *bucket, key, nkey *Key, n int) int
 	return done
 }
 
+// enqueuePILocked adds the PI waiter w to b, after all waiters for the same
+// futex with equal or higher priority.
+//
+// Preconditions: b.mu must be locked.
+func (b *bucket) enqueuePILocked(w *Waiter) {
+	for o := b.waiters.Front(); o != nil; o = o.Next() {
+		if o.pi && o.prio > w.prio && o.key.matches(&w.key) {
+			b.waiters.InsertBefore(o, w)
+			w.bucket.Store(b)
+			return
+		}
+	}
+	b.waiters.PushBack(w)
+	w.bucket.Store(b)
+}
+
+// nextPIWaitersLocked returns the two highest priority waiters to acquire the
+// PI futex represented by key.
+//
+// Preconditions: b.mu must be locked.
+func (b *bucket) nextPIWaitersLocked(key *Key) (next, next2 *Waiter) {
+	for w := b.waiters.Front(); w != nil; w = w.Next() {
+		if !w.pi || !w.key.matches(key) {
+			continue
+		}
+
+		if next == nil {
+			next = w
+		} else {
+			next2 = w
+			break
+		}
+	}
+	return next, next2
+}
+
 const (
 	// bucketCount is the number of buckets per Manager. By having many of
 	// these we reduce contention when concurrent yet unrelated calls are made.
@@ -577,10 +723,7 @@ func (m *Manager) WaitPrepare(w *Waiter, t Target, addr hostarch.Addr, private b
 	// Ownership of k is transferred to w below.
 
 	// Prepare the Waiter before taking the bucket lock.
-	select {
-	case <-w.C:
-	default:
-	}
+	w.reset()
 	w.key = k
 	w.bitmask = bitmask
 
@@ -605,7 +748,15 @@ func (m *Manager) WaitPrepare(w *Waiter, t Target, addr hostarch.Addr, private b
 // WaitComplete must be called when a Waiter previously added by WaitPrepare is
 // no longer eligible to be woken.
 func (m *Manager) WaitComplete(w *Waiter, t Target) {
-	// Remove w from the bucket it's in.
+	m.dequeue(w)
+
+	// Release references held by the waiter.
+	w.key.release(t)
+}
+
+// dequeue removes w from the bucket it's in, if any. It returns true if w was
+// still enqueued, i.e. it had not been woken.
+func (m *Manager) dequeue(w *Waiter) bool {
 	for {
 		b := w.bucket.Load()
 
@@ -613,7 +764,7 @@ func (m *Manager) WaitComplete(w *Waiter, t Target) {
 		// racy because the waiter can't be concurrently re-queued in another
 		// bucket.
 		if b == nil {
-			break
+			return false
 		}
 
 		// Take the bucket lock. Note that without holding the bucket lock, the
@@ -632,11 +783,112 @@ func (m *Manager) WaitComplete(w *Waiter, t Target) {
 		b.waiters.Remove(w)
 		w.bucket.Store(nil)
 		b.mu.Unlock()
-		break
+		return true
 	}
+}
 
-	// Release references held by the waiter.
-	w.key.release(t)
+// WaitvEntry describes one of the futexes waited on by WaitMultiplePrepare.
+type WaitvEntry struct {
+	// Addr is the address of the futex.
+	Addr hostarch.Addr
+
+	// Private is true if the futex is process-private.
+	Private bool
+
+	// Val is the value that the futex is expected to contain.
+	Val uint32
+}
+
+// MultiWaiter waits on several futexes at once, as for futex_waitv(2). A
+// wakeup of any contained futex is signalled by a send to C.
+type MultiWaiter struct {
+	// C is sent to when any of the futexes waited on is woken.
+	C chan struct{}
+
+	// waiters contains one Waiter per futex. All waiters share C.
+	waiters []Waiter
+}
+
+// NewMultiWaiter returns a new unqueued MultiWaiter.
+func NewMultiWaiter() *MultiWaiter {
+	return &MultiWaiter{
+		C: make(chan struct{}, 1),
+	}
+}
+
+// WaitMultiplePrepare checks that each futex in entries contains the
+// corresponding expected value and enqueues mw to be woken by a wakeup of any
+// of them. Each check is atomic with respect to wakeups of that futex, as for
+// WaitPrepare.
+//
+// If every futex has the expected value, WaitMultiplePrepare returns (-1,
+// nil), and mw must subsequently be removed by calling WaitMultipleComplete.
+// Otherwise, all waiters enqueued so far are removed. If one of them was woken
+// in the meantime, its index is returned with a nil error, as the wakeup
+// satisfies the wait; else the error from the failed check is returned.
+func (m *Manager) WaitMultiplePrepare(mw *MultiWaiter, t Target, entries []WaitvEntry) (int, error) {
+	// Prepare the MultiWaiter before taking any bucket lock.
+	select {
+	case <-mw.C:
+	default:
+	}
+	if cap(mw.waiters) < len(entries) {
+		mw.waiters = make([]Waiter, len(entries))
+	}
+	mw.waiters = mw.waiters[:len(entries)]
+
+	for i := range entries {
+		e := &entries[i]
+		w := &mw.waiters[i]
+		k, err := getKey(t, e.Addr, e.Private)
+		if err != nil {
+			return m.abortWaitMultiple(mw, t, i, err)
+		}
+		// Ownership of k is transferred to w below.
+		*w = Waiter{
+			C:       mw.C,
+			key:     k,
+			bitmask: linux.FUTEX_BITSET_MATCH_ANY,
+		}
+
+		b := m.lockBucket(&k)
+		if err := check(t, e.Addr, e.Val); err != nil {
+			b.mu.Unlock()
+			w.key.release(t)
+			return m.abortWaitMultiple(mw, t, i, err)
+		}
+		b.waiters.PushBack(w)
+		w.bucket.Store(b)
+		b.mu.Unlock()
+	}
+	return -1, nil
+}
+
+// abortWaitMultiple removes the first n waiters in mw after a failed
+// WaitMultiplePrepare.
+func (m *Manager) abortWaitMultiple(mw *MultiWaiter, t Target, n int, err error) (int, error) {
+	mw.waiters = mw.waiters[:n]
+	if woken := m.WaitMultipleComplete(mw, t); woken >= 0 {
+		return woken, nil
+	}
+	return -1, err
+}
+
+// WaitMultipleComplete must be called when a MultiWaiter previously added by
+// WaitMultiplePrepare is no longer eligible to be woken. It returns the index
+// of the first futex whose waiter was woken, or -1 if none were.
+func (m *Manager) WaitMultipleComplete(mw *MultiWaiter, t Target) int {
+	woken := -1
+	for i := range mw.waiters {
+		w := &mw.waiters[i]
+		if !m.dequeue(w) && woken < 0 {
+			woken = i
+		}
+		// Release references held by the waiter.
+		w.key.release(t)
+	}
+	mw.waiters = mw.waiters[:0]
+	return woken
 }
 
 // LockPI attempts to lock the futex following the Priority-inheritance futex
@@ -644,10 +896,13 @@ func (m *Manager) WaitComplete(w *Waiter, t Target) {
 // calling task is set to 'addr' to indicate the futex is owned. It returns true
 // if the futex was successfully acquired.
 //
-// FUTEX_OWNER_DIED is only set by the Linux when robust lists are in use (see
-// exit_robust_list()). Given we don't support robust lists, although handled
-// below, it's never set.
-func (m *Manager) LockPI(w *Waiter, t Target, addr hostarch.Addr, tid uint32, private, try bool) (bool, error) {
+// If LockPI returns (false, nil) and try is false, w has been enqueued with
+// priority prio, and must subsequently be removed by calling WaitCompletePI.
+//
+// FUTEX_OWNER_DIED is only set when robust lists are in use (see
+// Task.exitRobustList() and HandOffPI()); it is preserved when the futex is
+// acquired.
+func (m *Manager) LockPI(w *Waiter, t Target, addr hostarch.Addr, tid uint32, prio int, private, try bool) (bool, error) {
 	k, err := getKey(t, addr, private)
 	if err != nil {
 		return false, err
@@ -655,12 +910,10 @@ func (m *Manager) LockPI(w *Waiter, t Target, addr hostarch.Addr, tid uint32, pr
 	// Ownership of k is transferred to w below.
 
 	// Prepare the Waiter before taking the bucket lock.
-	select {
-	case <-w.C:
-	default:
-	}
+	w.reset()
 	w.key = k
 	w.tid = tid
+	w.prio = prio
 
 	b := m.lockBucket(&k)
 	// Hot function: avoid defers.
@@ -679,6 +932,24 @@ func (m *Manager) LockPI(w *Waiter, t Target, addr hostarch.Addr, tid uint32, pr
 	return success, nil
 }
 
+// WaitCompletePI must be called when a Waiter previously enqueued by LockPI
+// or WaitRequeuePIPrepare is no longer eligible to be woken. It returns true
+// for acquired if ownership of a PI futex was transferred to the waiter, and
+// true for requeued if the waiter was requeued onto a PI futex by
+// CmpRequeuePI.
+func (m *Manager) WaitCompletePI(w *Waiter, t Target) (acquired, requeued bool) {
+	m.dequeue(w)
+	acquired = w.acquiredPI
+	requeued = w.requeuePI && w.pi
+
+	// Release references held by the waiter.
+	w.key.release(t)
+	if w.requeuePI {
+		w.requeuePIKey.release(t)
+	}
+	return acquired, requeued
+}
+
 func (m *Manager) lockPILocked(w *Waiter, t Target, addr hostarch.Addr, tid uint32, b *bucket, try bool) (bool, error) {
 	for {
 		cur, err := t.LoadUint32(addr)
@@ -730,68 +1001,59 @@ func (m *Manager) lockPILocked(w *Waiter, t Target, addr hostarch.Addr, tid uint
 		}
 
 		// Add the waiter to the bucket.
-		b.waiters.PushBack(w)
-		w.bucket.Store(b)
+		w.pi = true
+		w.owner = cur & linux.FUTEX_TID_MASK
+		b.enqueuePILocked(w)
 		return false, nil
 	}
 }
 
 // UnlockPI unlocks the futex following the Priority-inheritance futex rules.
 // The address provided must contain the caller's TID. If there are waiters,
-// TID of the next waiter (FIFO) is set to the given address, and the waiter
-// woken up. If there are no waiters, 0 is set to the address.
-func (m *Manager) UnlockPI(t Target, addr hostarch.Addr, tid uint32, private bool) error {
+// TID of the next waiter (highest priority, FIFO among equal priorities) is
+// set to the given address, and the waiter woken up. If there are no waiters,
+// 0 is set to the address. UnlockPI returns the TID of the new owner, or 0 if
+// there is none.
+func (m *Manager) UnlockPI(t Target, addr hostarch.Addr, tid uint32, private bool) (uint32, error) {
 	k, err := getKey(t, addr, private)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	b := m.lockBucket(&k)
 
-	err = m.unlockPILocked(t, addr, tid, b, &k)
+	newOwner, err := m.unlockPILocked(t, addr, tid, b, &k)
 
 	k.release(t)
 	b.mu.Unlock()
-	return err
+	return newOwner, err
 }
 
-func (m *Manager) unlockPILocked(t Target, addr hostarch.Addr, tid uint32, b *bucket, key *Key) error {
+func (m *Manager) unlockPILocked(t Target, addr hostarch.Addr, tid uint32, b *bucket, key *Key) (uint32, error) {
 	cur, err := t.LoadUint32(addr)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	if (cur & linux.FUTEX_TID_MASK) != tid {
-		return linuxerr.EPERM
+		return 0, linuxerr.EPERM
 	}
 
-	var next *Waiter  // Who's the next owner?
-	var next2 *Waiter // Who's the one after that?
-	for w := b.waiters.Front(); w != nil; w = w.Next() {
-		if !w.key.matches(key) {
-			continue
-		}
-
-		if next == nil {
-			next = w
-		} else {
-			next2 = w
-			break
-		}
-	}
+	// Who's the next owner, and the one after that?
+	next, next2 := b.nextPIWaitersLocked(key)
 
 	if next == nil {
 		// It's safe to set 0 because there are no waiters, no new owner, and the
 		// executing task is the current owner (no owner died bit).
 		prev, err := t.CompareAndSwapUint32(addr, cur, 0)
 		if err != nil {
-			return err
+			return 0, err
 		}
 		if prev != cur {
 			// Let user mode handle CAS races. This is different than lock, which
 			// retries when CAS fails.
-			return linuxerr.EAGAIN
+			return 0, linuxerr.EAGAIN
 		}
-		return nil
+		return 0, nil
 	}
 
 	// Set next owner's TID, waiters if there are any. Resets owner died bit, if
@@ -803,12 +1065,249 @@ func (m *Manager) unlockPILocked(t Target, addr hostarch.Addr, tid uint32, b *bu
 
 	prev, err := t.CompareAndSwapUint32(addr, cur, val)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	if prev != cur {
-		return linuxerr.EINVAL
+		return 0, linuxerr.EINVAL
 	}
 
+	next.acquiredPI = true
 	b.wakeWaiterLocked(next)
+	return next.tid, nil
+}
+
+// HandOffPI releases a PI futex held by a task that has died, as for Linux's
+// handle_futex_death() and exit_pi_state_list(). addr must contain tid. The
+// FUTEX_OWNER_DIED bit is set, and if there are waiters, ownership is handed
+// off to the next waiter (FIFO), which is woken. Unlike UnlockPI, the owner
+// died bit is preserved so that the new owner can recover the protected
+// state. HandOffPI returns the TID of the new owner, or 0 if there is none.
+func (m *Manager) HandOffPI(t Target, addr hostarch.Addr, tid uint32, private bool) (uint32, error) {
+	k, err := getKey(t, addr, private)
+	if err != nil {
+		return 0, err
+	}
+	b := m.lockBucket(&k)
+
+	newOwner, err := m.handOffPILocked(t, addr, tid, b, &k)
+
+	k.release(t)
+	b.mu.Unlock()
+	return newOwner, err
+}
+
+func (m *Manager) handOffPILocked(t Target, addr hostarch.Addr, tid uint32, b *bucket, key *Key) (uint32, error) {
+	// Who's the next owner, and the one after that?
+	next, next2 := b.nextPIWaitersLocked(key)
+
+	for {
+		cur, err := t.LoadUint32(addr)
+		if err != nil {
+			return 0, err
+		}
+		if (cur & linux.FUTEX_TID_MASK) != tid {
+			return 0, linuxerr.EPERM
+		}
+
+		// Without waiters, only mark the futex dead. FUTEX_WAITERS is
+		// preserved in case there are waiters we don't know about, e.g. ones
+		// using a different key kind, so that user mode still calls into the
+		// kernel on unlock.
+		val := (cur & linux.FUTEX_WAITERS) | linux.FUTEX_OWNER_DIED
+		if next != nil {
+			val = next.tid | linux.FUTEX_OWNER_DIED
+			if next2 != nil {
+				val |= linux.FUTEX_WAITERS
+			}
+		}
+
+		prev, err := t.CompareAndSwapUint32(addr, cur, val)
+		if err != nil {
+			return 0, err
+		}
+		if prev != cur {
+			// The owner is dead, so only other tasks updating FUTEX_WAITERS
+			// can race with us; retry.
+			continue
+		}
+		break
+	}
+
+	if next == nil {
+		return 0, nil
+	}
+	next.acquiredPI = true
+	b.wakeWaiterLocked(next)
+	return next.tid, nil
+}
+
+// WaitRequeuePIPrepare atomically checks that addr contains val (via the
+// Target), then enqueues w to be woken by a send to w.C. w may be requeued by
+// CmpRequeuePI onto the PI futex at naddr, which it will then wait to acquire
+// with the given TID and priority, as for FUTEX_WAIT_REQUEUE_PI. If
+// WaitRequeuePIPrepare returns nil, the Waiter must be subsequently removed by
+// calling WaitCompletePI.
+func (m *Manager) WaitRequeuePIPrepare(w *Waiter, t Target, addr hostarch.Addr, val uint32, naddr hostarch.Addr, tid uint32, prio int, private bool) error {
+	k, err := getKey(t, addr, private)
+	if err != nil {
+		return err
+	}
+	k2, err := getKey(t, naddr, private)
+	if err != nil {
+		k.release(t)
+		return err
+	}
+	if k.matches(&k2) {
+		k.release(t)
+		k2.release(t)
+		return linuxerr.EINVAL
+	}
+	// Ownership of k and k2 is transferred to w below.
+
+	// Prepare the Waiter before taking the bucket lock.
+	w.reset()
+	w.key = k
+	w.bitmask = linux.FUTEX_BITSET_MATCH_ANY
+	w.tid = tid
+	w.prio = prio
+	w.requeuePI = true
+	w.requeuePIKey = k2
+
+	b := m.lockBucket(&k)
+	if err := check(t, addr, val); err != nil {
+		b.mu.Unlock()
+		w.key.release(t)
+		w.requeuePIKey.release(t)
+		return err
+	}
+	b.waiters.PushBack(w)
+	w.bucket.Store(b)
+	b.mu.Unlock()
 	return nil
 }
+
+// RequeuePIResult is the result of CmpRequeuePI.
+type RequeuePIResult struct {
+	// Count is the number of waiters that acquired or were requeued onto the
+	// PI futex.
+	Count int
+
+	// Owner is the TID of the owner of the PI futex, or 0 if it is unowned.
+	Owner uint32
+
+	// Requeued contains the TIDs of the waiters requeued onto the PI futex.
+	// They are now waiting for Owner.
+	Requeued []uint32
+}
+
+// CmpRequeuePI atomically checks that addr contains val (via the Target),
+// then attempts to acquire the PI futex at naddr on behalf of the first waiter
+// on addr, waking it if successful. Remaining waiters on addr, up to a total
+// of nreq+1 waiters, are then requeued to wait to acquire the PI futex at
+// naddr, as for FUTEX_CMP_REQUEUE_PI. All affected waiters must have been
+// enqueued by WaitRequeuePIPrepare with naddr.
+func (m *Manager) CmpRequeuePI(t Target, addr, naddr hostarch.Addr, private bool, val uint32, nreq int) (RequeuePIResult, error) {
+	var res RequeuePIResult
+	k1, err := getKey(t, addr, private)
+	if err != nil {
+		return res, err
+	}
+	defer k1.release(t)
+	k2, err := getKey(t, naddr, private)
+	if err != nil {
+		return res, err
+	}
+	defer k2.release(t)
+	if k1.matches(&k2) {
+		return res, linuxerr.EINVAL
+	}
+
+	b1, b2, lockedFirst, lockedSecond := m.lockBuckets(&k1, &k2)
+	defer m.unlockBuckets(lockedFirst, lockedSecond)
+
+	if err := check(t, addr, val); err != nil {
+		return res, err
+	}
+
+	var first *Waiter
+	for w := b1.waiters.Front(); w != nil; w = w.Next() {
+		if w.key.matches(&k1) {
+			first = w
+			break
+		}
+	}
+	if first == nil {
+		return res, nil
+	}
+	if !first.requeuePI || !first.requeuePIKey.matches(&k2) {
+		return res, linuxerr.EINVAL
+	}
+
+	// Try to acquire the PI futex on behalf of the first waiter. As in
+	// Linux, FUTEX_WAITERS is set unconditionally, so that the new owner
+	// calls FUTEX_UNLOCK_PI to hand off the futex to the remaining waiters.
+	n := nreq + 1
+	for {
+		cur, err := t.LoadUint32(naddr)
+		if err != nil {
+			return res, err
+		}
+		owner := cur & linux.FUTEX_TID_MASK
+		if owner == first.tid {
+			return res, linuxerr.EDEADLK
+		}
+		if owner == 0 {
+			newVal := first.tid | (cur & linux.FUTEX_OWNER_DIED) | linux.FUTEX_WAITERS
+			prev, err := t.CompareAndSwapUint32(naddr, cur, newVal)
+			if err != nil {
+				return res, err
+			}
+			if prev != cur {
+				continue
+			}
+			first.acquiredPI = true
+			b1.wakeWaiterLocked(first)
+			res.Count++
+			res.Owner = first.tid
+			n--
+			break
+		}
+		if cur&linux.FUTEX_WAITERS == 0 {
+			prev, err := t.CompareAndSwapUint32(naddr, cur, cur|linux.FUTEX_WAITERS)
+			if err != nil {
+				return res, err
+			}
+			if prev != cur {
+				continue
+			}
+		}
+		res.Owner = owner
+		break
+	}
+
+	// Requeue the remaining waiters onto the PI futex. As in Linux, a
+	// mismatched waiter fails the operation, but waiters already requeued
+	// stay requeued.
+	for w := b1.waiters.Front(); w != nil && n > 0; {
+		if !w.key.matches(&k1) {
+			w = w.Next()
+			continue
+		}
+		if !w.requeuePI || !w.requeuePIKey.matches(&k2) {
+			return res, linuxerr.EINVAL
+		}
+
+		requeued := w
+		w = w.Next() // Next iteration.
+		b1.waiters.Remove(requeued)
+		requeued.key.release(t)
+		requeued.key = k2.clone()
+		requeued.pi = true
+		requeued.owner = res.Owner
+		b2.enqueuePILocked(requeued)
+		res.Count++
+		res.Requeued = append(res.Requeued, requeued.tid)
+		n--
+	}
+	return res, nil
+}
@@ -20,6 +20,7 @@ import (
 	"testing"
 	"unsafe"
 
+	"github.com/wilinz/gvisor/pkg/abi/linux"
 	"github.com/wilinz/gvisor/pkg/atomicbitops"
 	"github.com/wilinz/gvisor/pkg/context"
 	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
@@ -452,6 +453,226 @@ func TestWakeOpSameAddressFailingOp(t *testing.T) {
 	}
 }
 
+func TestWaitMultipleWake(t *testing.T) {
+	for _, private := range []bool{false, true} {
+		t.Run(futexKind(private), func(t *testing.T) {
+			m := NewManager()
+			d := newTestData(2 * sizeofInt32)
+
+			mw := NewMultiWaiter()
+			entries := []WaitvEntry{
+				{Addr: 0, Private: private, Val: 0},
+				{Addr: sizeofInt32, Private: private, Val: 0},
+			}
+			if woken, err := m.WaitMultiplePrepare(mw, d, entries); err != nil || woken != -1 {
+				t.Fatalf("WaitMultiplePrepare: got (%d, %v), wanted (-1, nil)", woken, err)
+			}
+
+			// Wake the second futex.
+			if n, err := m.Wake(d, sizeofInt32, private, ^uint32(0), 1); err != nil || n != 1 {
+				t.Errorf("Wake: got (%d, %v), wanted (1, nil)", n, err)
+			}
+			if len(mw.C) == 0 {
+				t.Error("MultiWaiter not woken")
+			}
+			if woken := m.WaitMultipleComplete(mw, d); woken != 1 {
+				t.Errorf("WaitMultipleComplete: got %d, wanted 1", woken)
+			}
+
+			// The first futex's waiter must have been dequeued.
+			if n, err := m.Wake(d, 0, private, ^uint32(0), 1); err != nil || n != 0 {
+				t.Errorf("Wake after WaitMultipleComplete: got (%d, %v), wanted (0, nil)", n, err)
+			}
+		})
+	}
+}
+
+func TestWaitMultipleValueMismatch(t *testing.T) {
+	m := NewManager()
+	d := newTestData(2 * sizeofInt32)
+
+	mw := NewMultiWaiter()
+	entries := []WaitvEntry{
+		{Addr: 0, Private: true, Val: 0},
+		{Addr: sizeofInt32, Private: true, Val: 1},
+	}
+	if woken, err := m.WaitMultiplePrepare(mw, d, entries); !linuxerr.Equals(linuxerr.EAGAIN, err) || woken != -1 {
+		t.Fatalf("WaitMultiplePrepare: got (%d, %v), wanted (-1, EAGAIN)", woken, err)
+	}
+
+	// The waiter queued for the first futex must have been dequeued.
+	if n, err := m.Wake(d, 0, true, ^uint32(0), 1); err != nil || n != 0 {
+		t.Errorf("Wake: got (%d, %v), wanted (0, nil)", n, err)
+	}
+}
+
+func TestHandOffPI(t *testing.T) {
+	const (
+		ownerTID  = 10
+		waiterTID = 20
+	)
+	for _, private := range []bool{false, true} {
+		t.Run(futexKind(private), func(t *testing.T) {
+			m := NewManager()
+			d := newTestData(sizeofInt32)
+			d.CompareAndSwapUint32(0, 0, ownerTID)
+
+			// Block a waiter on the PI futex.
+			w := NewWaiter()
+			if locked, err := m.LockPI(w, d, 0, waiterTID, 0 /* prio */, private, false); err != nil || locked {
+				t.Fatalf("LockPI: got (%t, %v), wanted (false, nil)", locked, err)
+			}
+			defer m.WaitCompletePI(w, d)
+
+			// The owner dies; ownership passes to the waiter.
+			if newOwner, err := m.HandOffPI(d, 0, ownerTID, private); err != nil || newOwner != waiterTID {
+				t.Fatalf("HandOffPI: got (%d, %v), wanted (%d, nil)", newOwner, err, waiterTID)
+			}
+			if !w.woken() {
+				t.Error("waiter not woken")
+			}
+			want := uint32(waiterTID | linux.FUTEX_OWNER_DIED)
+			if got, _ := d.LoadUint32(0); got != want {
+				t.Errorf("futex word: got %#x, wanted %#x", got, want)
+			}
+
+			// The new owner dies without waiters; the futex is left unowned.
+			if newOwner, err := m.HandOffPI(d, 0, waiterTID, private); err != nil || newOwner != 0 {
+				t.Fatalf("HandOffPI: got (%d, %v), wanted (0, nil)", newOwner, err)
+			}
+			want = linux.FUTEX_OWNER_DIED
+			if got, _ := d.LoadUint32(0); got != want {
+				t.Errorf("futex word: got %#x, wanted %#x", got, want)
+			}
+
+			// Only the owner can be handed off.
+			if _, err := m.HandOffPI(d, 0, ownerTID, private); !linuxerr.Equals(linuxerr.EPERM, err) {
+				t.Errorf("HandOffPI by non-owner: got %v, wanted EPERM", err)
+			}
+		})
+	}
+}
+
+func TestUnlockPIPriorityOrder(t *testing.T) {
+	const (
+		ownerTID = 10
+		lowTID   = 20
+		highTID  = 30
+		midTID   = 40
+	)
+	m := NewManager()
+	d := newTestData(sizeofInt32)
+	d.CompareAndSwapUint32(0, 0, ownerTID)
+
+	// Block waiters on the PI futex in order of increasing priority.
+	waiters := make(map[uint32]*Waiter)
+	for _, tw := range []struct {
+		tid  uint32
+		prio int
+	}{
+		{lowTID, 120},
+		{midTID, 50},
+		{highTID, 10},
+	} {
+		w := NewWaiter()
+		if locked, err := m.LockPI(w, d, 0, tw.tid, tw.prio, true, false); err != nil || locked {
+			t.Fatalf("LockPI(%d): got (%t, %v), wanted (false, nil)", tw.tid, locked, err)
+		}
+		if got := w.PIOwner(); got != ownerTID {
+			t.Errorf("PIOwner: got %d, wanted %d", got, ownerTID)
+		}
+		defer m.WaitCompletePI(w, d)
+		waiters[tw.tid] = w
+	}
+
+	// Boosting the lowest priority waiter moves it ahead of the others.
+	waiters[lowTID].SetPriority(0)
+
+	// Ownership passes to waiters in priority order.
+	prev := uint32(ownerTID)
+	for _, want := range []uint32{lowTID, highTID, midTID} {
+		newOwner, err := m.UnlockPI(d, 0, prev, true)
+		if err != nil || newOwner != want {
+			t.Fatalf("UnlockPI(%d): got (%d, %v), wanted (%d, nil)", prev, newOwner, err, want)
+		}
+		w := waiters[want]
+		if !w.woken() {
+			t.Errorf("waiter %d not woken", want)
+		}
+		if acquired, _ := m.WaitCompletePI(w, d); !acquired {
+			t.Errorf("waiter %d did not acquire the futex", want)
+		}
+		prev = want
+	}
+
+	if newOwner, err := m.UnlockPI(d, 0, prev, true); err != nil || newOwner != 0 {
+		t.Errorf("UnlockPI(%d): got (%d, %v), wanted (0, nil)", prev, newOwner, err)
+	}
+	if got, _ := d.LoadUint32(0); got != 0 {
+		t.Errorf("futex word: got %#x, wanted 0", got)
+	}
+}
+
+func TestCmpRequeuePI(t *testing.T) {
+	const (
+		firstTID  = 10
+		secondTID = 20
+		piAddr    = sizeofInt32
+	)
+	for _, private := range []bool{false, true} {
+		t.Run(futexKind(private), func(t *testing.T) {
+			m := NewManager()
+			d := newTestData(2 * sizeofInt32)
+
+			// Both waiters wait on the condition variable at address 0.
+			w1 := NewWaiter()
+			if err := m.WaitRequeuePIPrepare(w1, d, 0, 0, piAddr, firstTID, 0, private); err != nil {
+				t.Fatalf("WaitRequeuePIPrepare failed: %v", err)
+			}
+			defer m.WaitCompletePI(w1, d)
+			w2 := NewWaiter()
+			if err := m.WaitRequeuePIPrepare(w2, d, 0, 0, piAddr, secondTID, 0, private); err != nil {
+				t.Fatalf("WaitRequeuePIPrepare failed: %v", err)
+			}
+			defer m.WaitCompletePI(w2, d)
+
+			// Ordinary wakes and requeues must skip requeue-PI waiters.
+			if n, err := m.Wake(d, 0, private, ^uint32(0), 2); err != nil || n != 0 {
+				t.Errorf("Wake: got (%d, %v), wanted (0, nil)", n, err)
+			}
+
+			// A mismatched value fails.
+			if _, err := m.CmpRequeuePI(d, 0, piAddr, private, 1, 1); !linuxerr.Equals(linuxerr.EAGAIN, err) {
+				t.Errorf("CmpRequeuePI with mismatched value: got %v, wanted EAGAIN", err)
+			}
+
+			// The first waiter acquires the PI futex; the second is requeued.
+			res, err := m.CmpRequeuePI(d, 0, piAddr, private, 0, 1)
+			if err != nil {
+				t.Fatalf("CmpRequeuePI failed: %v", err)
+			}
+			if res.Count != 2 || res.Owner != firstTID || len(res.Requeued) != 1 || res.Requeued[0] != secondTID {
+				t.Fatalf("CmpRequeuePI: got %+v, wanted {Count: 2, Owner: %d, Requeued: [%d]}", res, firstTID, secondTID)
+			}
+			if acquired, requeued := m.WaitCompletePI(w1, d); !acquired || requeued {
+				t.Errorf("first waiter: got (acquired %t, requeued %t), wanted (true, false)", acquired, requeued)
+			}
+			want := uint32(firstTID | linux.FUTEX_WAITERS)
+			if got, _ := d.LoadUint32(piAddr); got != want {
+				t.Errorf("PI futex word: got %#x, wanted %#x", got, want)
+			}
+
+			// Unlocking the PI futex hands it off to the requeued waiter.
+			if newOwner, err := m.UnlockPI(d, piAddr, firstTID, private); err != nil || newOwner != secondTID {
+				t.Fatalf("UnlockPI: got (%d, %v), wanted (%d, nil)", newOwner, err, secondTID)
+			}
+			if acquired, requeued := m.WaitCompletePI(w2, d); !acquired || !requeued {
+				t.Errorf("second waiter: got (acquired %t, requeued %t), wanted (true, true)", acquired, requeued)
+			}
+		})
+	}
+}
+
 const (
 	testMutexSize            = sizeofInt32
 	testMutexLocked   uint32 = 1
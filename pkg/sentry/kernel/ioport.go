@@ -0,0 +1,179 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxIOPort is the largest x86 I/O port number.
+const MaxIOPort = 0xffff
+
+// IOPortRange is an inclusive range of x86 I/O ports.
+//
+// +stateify savable
+type IOPortRange struct {
+	First uint16
+	Last  uint16
+}
+
+// String implements fmt.Stringer.String.
+func (r IOPortRange) String() string {
+	if r.First == r.Last {
+		return fmt.Sprintf("%#x", r.First)
+	}
+	return fmt.Sprintf("%#x-%#x", r.First, r.Last)
+}
+
+// ParseIOPortRanges parses a comma-separated list of I/O ports and inclusive
+// port ranges, e.g. "0x378-0x37a,0x3f8".
+func ParseIOPortRanges(s string) ([]IOPortRange, error) {
+	var rs []IOPortRange
+	if s == "" {
+		return rs, nil
+	}
+	for _, entry := range strings.Split(s, ",") {
+		first, last, isRange := strings.Cut(entry, "-")
+		f, err := strconv.ParseUint(first, 0, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid I/O port %q: %w", first, err)
+		}
+		l := f
+		if isRange {
+			if l, err = strconv.ParseUint(last, 0, 16); err != nil {
+				return nil, fmt.Errorf("invalid I/O port %q: %w", last, err)
+			}
+			if l < f {
+				return nil, fmt.Errorf("invalid I/O port range %q", entry)
+			}
+		}
+		rs = append(rs, IOPortRange{First: uint16(f), Last: uint16(l)})
+	}
+	return rs, nil
+}
+
+// HasEmulatedIOPorts returns true if any I/O port is emulated.
+func (k *Kernel) HasEmulatedIOPorts() bool {
+	return len(k.emulatedIOPorts) > 0
+}
+
+// EmulatedIOPorts returns true if all ports in [from, from+num) are emulated,
+// i.e. they are backed by a null device that ignores writes and reads as all
+// ones, like an ISA bus without a device.
+func (k *Kernel) EmulatedIOPorts(from, num uint32) bool {
+	for num > 0 {
+		covered := false
+		for _, r := range k.emulatedIOPorts {
+			if from >= uint32(r.First) && from <= uint32(r.Last) {
+				n := min(uint32(r.Last)-from+1, num)
+				from += n
+				num -= n
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// ioPortState is the I/O privilege state of a task, set by iopl(2) and
+// ioperm(2). The state only controls access to emulated I/O ports, since
+// tasks can never access the ports of the host.
+//
+// +stateify savable
+type ioPortState struct {
+	// level is the I/O privilege level set by iopl(2). Access to all
+	// emulated ports is allowed if it is 3.
+	level int32
+
+	// bitmap has a bit set for each port enabled by ioperm(2). It is nil
+	// if no port was ever enabled, and only extends to the last enabled
+	// port.
+	bitmap []uint64
+}
+
+// fork returns a copy of s for a new task.
+func (s *ioPortState) fork() ioPortState {
+	return ioPortState{
+		level:  s.level,
+		bitmap: append([]uint64(nil), s.bitmap...),
+	}
+}
+
+// IOPL returns the I/O privilege level of the task.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) IOPL() int32 {
+	return t.ioPorts.level
+}
+
+// SetIOPL sets the I/O privilege level of the task.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) SetIOPL(level int32) {
+	t.ioPorts.level = level
+}
+
+// SetIOPerm enables or disables the access of the task to the ports in
+// [from, from+num).
+//
+// Preconditions:
+//   - The caller must be running on the task goroutine.
+//   - from+num <= MaxIOPort+1.
+func (t *Task) SetIOPerm(from, num uint32, on bool) {
+	s := &t.ioPorts
+	if on {
+		if n := int((from + num + 63) / 64); n > len(s.bitmap) {
+			s.bitmap = append(s.bitmap, make([]uint64, n-len(s.bitmap))...)
+		}
+	}
+	for port := from; port < from+num; port++ {
+		i := int(port / 64)
+		if i >= len(s.bitmap) {
+			break
+		}
+		if on {
+			s.bitmap[i] |= 1 << (port % 64)
+		} else {
+			s.bitmap[i] &^= 1 << (port % 64)
+		}
+	}
+}
+
+// ioPortsAllowed returns true if the task may access the size ports starting
+// at port, which must be emulated.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) ioPortsAllowed(port, size uint32) bool {
+	if port+size > MaxIOPort+1 || !t.k.EmulatedIOPorts(port, size) {
+		return false
+	}
+	s := &t.ioPorts
+	if s.level == 3 {
+		return true
+	}
+	for p := port; p < port+size; p++ {
+		i := int(p / 64)
+		if i >= len(s.bitmap) || s.bitmap[i]&(1<<(p%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build amd64
+// +build amd64
+
+package kernel
+
+import (
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/hostarch"
+)
+
+// emulateIOPortAccess emulates the in or out instruction that caused the
+// general protection fault described by info, if the task is allowed to
+// access the emulated ports that it uses. It returns true if the instruction
+// was emulated, in which case the task can resume execution.
+//
+// Only the in and out instructions with an immediate or DX port are emulated;
+// string instructions (ins and outs) still fault.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) emulateIOPortAccess(info *linux.SignalInfo) bool {
+	if info.Signo != int32(linux.SIGSEGV) || info.Code != linux.SI_KERNEL || !t.k.HasEmulatedIOPorts() {
+		return false
+	}
+
+	// The longest instruction is an operand-size prefix, a REX prefix, the
+	// opcode and an immediate port. The instruction may end just before an
+	// unmapped page, so a partial read isn't an error.
+	var insn [4]byte
+	ac := t.Arch()
+	ip := ac.IP()
+	n, _ := t.CopyInBytes(hostarch.Addr(ip), insn[:])
+	size := uint32(4)
+	i := 0
+prefixes:
+	for ; i < n; i++ {
+		switch {
+		case insn[i] == 0x66:
+			size = 2
+		case insn[i]&0xf0 == 0x40 && !ac.Compat():
+			// REX prefixes don't change the operand size of in and out.
+		default:
+			break prefixes
+		}
+	}
+	if i >= n {
+		return false
+	}
+	op := insn[i]
+	i++
+	var port uint32
+	switch op {
+	case 0xe4, 0xe5, 0xe6, 0xe7:
+		// in/out with an immediate port.
+		if i >= n {
+			return false
+		}
+		port = uint32(insn[i])
+		i++
+	case 0xec, 0xed, 0xee, 0xef:
+		// in/out with the port in DX.
+		port = uint32(ac.Regs.Rdx & 0xffff)
+	default:
+		return false
+	}
+	if op&1 == 0 {
+		size = 1
+	}
+	if !t.ioPortsAllowed(port, size) {
+		return false
+	}
+
+	if op&2 == 0 {
+		// in: the null device reads as all ones. Like other 32-bit
+		// operations, reading EAX clears the upper half of RAX.
+		switch size {
+		case 1:
+			ac.Regs.Rax |= 0xff
+		case 2:
+			ac.Regs.Rax |= 0xffff
+		case 4:
+			ac.Regs.Rax = 0xffffffff
+		}
+	}
+	// out: writes to the null device are discarded.
+	ac.SetIP(ip + uintptr(i))
+	return true
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseIOPortRanges(t *testing.T) {
+	for _, test := range []struct {
+		in      string
+		want    []IOPortRange
+		wantErr bool
+	}{
+		{in: "", want: nil},
+		{in: "0x378", want: []IOPortRange{{0x378, 0x378}}},
+		{in: "0x378-0x37a,1016-1023", want: []IOPortRange{{0x378, 0x37a}, {0x3f8, 0x3ff}}},
+		{in: "0x37a-0x378", wantErr: true},
+		{in: "0x10000", wantErr: true},
+		{in: "0x378,", wantErr: true},
+		{in: "port", wantErr: true},
+	} {
+		got, err := ParseIOPortRanges(test.in)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseIOPortRanges(%q) got error %v, want error: %t", test.in, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseIOPortRanges(%q) = %v, want %v", test.in, got, test.want)
+		}
+	}
+}
+
+func TestEmulatedIOPorts(t *testing.T) {
+	k := &Kernel{
+		emulatedIOPorts: []IOPortRange{{0x378, 0x37a}, {0x37b, 0x37f}, {0x3f8, 0x3ff}},
+	}
+	for _, test := range []struct {
+		from, num uint32
+		want      bool
+	}{
+		{from: 0x378, num: 1, want: true},
+		{from: 0x378, num: 8, want: true},
+		{from: 0x3fc, num: 4, want: true},
+		{from: 0x377, num: 2, want: false},
+		{from: 0x37f, num: 2, want: false},
+		{from: 0x3fc, num: 5, want: false},
+		{from: 0, num: 1, want: false},
+	} {
+		if got := k.EmulatedIOPorts(test.from, test.num); got != test.want {
+			t.Errorf("EmulatedIOPorts(%#x, %d) = %t, want %t", test.from, test.num, got, test.want)
+		}
+	}
+}
+
+func TestSetIOPerm(t *testing.T) {
+	task := &Task{
+		k: &Kernel{
+			emulatedIOPorts: []IOPortRange{{0, 0x3ff}},
+		},
+	}
+	task.SetIOPerm(0x378, 3, true)
+	if !task.ioPortsAllowed(0x378, 3) {
+		t.Errorf("ports 0x378-0x37a not allowed after ioperm")
+	}
+	if task.ioPortsAllowed(0x377, 2) || task.ioPortsAllowed(0x37a, 2) {
+		t.Errorf("ports outside of 0x378-0x37a allowed after ioperm")
+	}
+	task.SetIOPerm(0x379, 1, false)
+	if task.ioPortsAllowed(0x378, 2) || !task.ioPortsAllowed(0x37a, 1) {
+		t.Errorf("wrong ports allowed after clearing port 0x379")
+	}
+	if child := task.ioPorts.fork(); !reflect.DeepEqual(child, task.ioPorts) {
+		t.Errorf("forked I/O permissions = %+v, want %+v", child, task.ioPorts)
+	}
+
+	// iopl(3) allows access to all emulated ports.
+	task.SetIOPL(3)
+	if !task.ioPortsAllowed(0, 0x400) || task.ioPortsAllowed(0x3ff, 2) {
+		t.Errorf("wrong ports allowed with I/O privilege level 3")
+	}
+}
@@ -37,6 +37,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"path/filepath"
 	"time"
 
@@ -60,9 +61,12 @@ import (
 	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/tmpfs"
 	"github.com/wilinz/gvisor/pkg/sentry/hostcpu"
 	"github.com/wilinz/gvisor/pkg/sentry/inet"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/audit"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/entropy"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel/futex"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel/ipc"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/pipe"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel/sched"
 	"github.com/wilinz/gvisor/pkg/sentry/ktime"
 	"github.com/wilinz/gvisor/pkg/sentry/limits"
@@ -165,12 +169,24 @@ type Kernel struct {
 	vdsoParams           *VDSOParamPage
 	rootUTSNamespace     *UTSNamespace
 	rootIPCNamespace     *IPCNamespace
+	timerSlack           time.Duration
+
+	// emulatedIOPorts are the I/O ports that tasks can be allowed to access
+	// with iopl(2) and ioperm(2). emulatedIOPorts is immutable.
+	emulatedIOPorts []IOPortRange
 
 	// futexes is the "root" futex.Manager, from which all others are forked.
 	// This is necessary to ensure that shared futexes are coherent across all
 	// tasks, including those created by CreateProcess.
 	futexes *futex.Manager
 
+	// futexPIMu protects futexPI and the priority inheritance state of all
+	// tasks. It is ordered before futex bucket locks and Task.mu.
+	futexPIMu sync.Mutex `state:"nosave"`
+
+	// futexPI tracks PI futexes that have waiters.
+	futexPI map[futex.PIKey]*futexPIState `state:"nosave"`
+
 	// globalInit is the thread group whose leader has ID 1 in the root PID
 	// namespace. globalInit is stored separately so that it is accessible even
 	// after all tasks in the thread group have exited, such that ID 1 is no
@@ -225,6 +241,10 @@ type Kernel struct {
 	// need to support timers.
 	cpuClock atomicbitops.Int64
 
+	// loadAvg tracks the system load averages reported by sysinfo(2) and
+	// /proc/loadavg. It is sampled by the CPU clock ticker.
+	loadAvg loadAvg
+
 	// uniqueID is used to generate unique identifiers.
 	//
 	// uniqueID is mutable, and is accessed using atomic memory operations.
@@ -239,6 +259,10 @@ type Kernel struct {
 	// netlinkPorts manages allocation of netlink socket port IDs.
 	netlinkPorts *port.Manager
 
+	// entropyPool is the entropy pool backing /dev/random, /dev/urandom and
+	// getrandom(2).
+	entropyPool entropy.Pool
+
 	// saveStatus is nil if the sandbox has not been saved, errSaved or
 	// errAutoSaved if it has been saved successfully, or the error causing the
 	// sandbox to exit during save.
@@ -318,6 +342,12 @@ type Kernel struct {
 	// YAMAPtraceScope is the current level of YAMA ptrace restrictions.
 	YAMAPtraceScope atomicbitops.Int32
 
+	// audit is the state of the audit subsystem.
+	audit audit.Audit
+
+	// procEvents is the state of the process events connector.
+	procEvents ProcEvents
+
 	// cgroupRegistry contains the set of active cgroup controllers on the
 	// system. It is controller by cgroupfs. Nil if cgroupfs is unavailable on
 	// the system.
@@ -338,6 +368,35 @@ type Kernel struct {
 	// used by processes.
 	MaxFDLimit atomicbitops.Int32
 
+	// PipeMaxSize is /proc/sys/fs/pipe-max-size, the maximum size in bytes
+	// of a pipe set by fcntl(F_SETPIPE_SZ) without CAP_SYS_RESOURCE.
+	PipeMaxSize atomicbitops.Int32
+
+	// AIOEvents accounts for the events of all asynchronous I/O contexts.
+	// AIOEvents.Max is /proc/sys/fs/aio-max-nr.
+	AIOEvents mm.AIOEvents
+
+	// VMMaxMapCount is /proc/sys/vm/max_map_count, the maximum number of vmas
+	// that a MemoryManager may contain.
+	VMMaxMapCount atomicbitops.Int32
+
+	// VMOvercommitMemory is /proc/sys/vm/overcommit_memory, one of
+	// linux.OVERCOMMIT_*.
+	VMOvercommitMemory atomicbitops.Int32
+
+	// VMOvercommitRatio is /proc/sys/vm/overcommit_ratio, the percentage of
+	// total memory that may be committed when VMOvercommitMemory is
+	// linux.OVERCOMMIT_NEVER.
+	VMOvercommitRatio atomicbitops.Int32
+
+	// VMSwappiness is /proc/sys/vm/swappiness. Since the sentry never swaps,
+	// it has no effect and is only recorded for applications that read it.
+	VMSwappiness atomicbitops.Int32
+
+	// workingSetSampler is the WorkingSetSampler started by
+	// StartWorkingSetSampler, or nil if working set sampling is disabled.
+	workingSetSampler *WorkingSetSampler `state:"nosave"`
+
 	// devGofers maps containers (using its name) to its device gofer client.
 	devGofers   map[string]*devutil.GoferClient `state:"nosave"`
 	devGofersMu sync.Mutex                      `state:"nosave"`
@@ -349,6 +408,11 @@ type Kernel struct {
 	// It's protected by extMu.
 	containerNames map[string]string
 
+	// consoles maps container names to the terminal backing /dev/console in
+	// the container. Only containers started with a terminal have an entry.
+	// It's protected by extMu.
+	consoles map[string]*TTY
+
 	// checkpointMu is used to protect the checkpointing related fields below.
 	checkpointMu sync.Mutex `state:"nosave"`
 
@@ -423,8 +487,33 @@ type InitKernelArgs struct {
 	// unlimited.
 	MaxFDLimit int32
 
+	// MaxOpenFiles is the initial value of /proc/sys/fs/file-max. If it is
+	// zero, vfs.DefaultMaxOpenFiles is used.
+	MaxOpenFiles uint64
+
+	// PipeMaxSize is the initial value of /proc/sys/fs/pipe-max-size,
+	// rounded up as for writes to that file. If it is zero,
+	// pipe.MaximumPipeSize is used.
+	PipeMaxSize int64
+
+	// AIOMaxEvents is the initial value of /proc/sys/fs/aio-max-nr. If it is
+	// zero, mm.DefaultAIOMaxEvents is used.
+	AIOMaxEvents uint64
+
 	// UnixSocketOpts contains configuration options for unix sockets.
 	UnixSocketOpts transport.UnixSocketOpts
+
+	// TimerSlack is the initial timer slack of tasks, by which the expirations
+	// of their timers may be delayed so that they are coalesced. If it is
+	// zero, timer expirations are not coalesced, although tasks may still
+	// get and set their timer slack with prctl(2).
+	TimerSlack time.Duration
+
+	// EmulatedIOPorts are the I/O ports that tasks can be allowed to access
+	// with iopl(2) and ioperm(2), which requires CAP_SYS_RAWIO as in Linux.
+	// Emulated ports are backed by a null device. If it is empty, iopl(2)
+	// and ioperm(2) can only drop privileges.
+	EmulatedIOPorts []IOPortRange
 }
 
 // Init initialize the Kernel with no tasks.
@@ -474,8 +563,11 @@ func (k *Kernel) Init(args InitKernelArgs) error {
 	k.extraAuxv = args.ExtraAuxv
 	k.vdso = args.Vdso
 	k.vdsoParams = args.VdsoParams
+	k.timerSlack = args.TimerSlack
+	k.emulatedIOPorts = args.EmulatedIOPorts
 	k.futexes = futex.NewManager()
 	k.netlinkPorts = port.New()
+	k.entropyPool.Init()
 	k.ptraceExceptions = make(map[*Task]*Task)
 	k.YAMAPtraceScope = atomicbitops.FromInt32(linux.YAMA_SCOPE_RELATIONAL)
 	k.userCountersMap = make(map[auth.KUID]*UserCounters)
@@ -483,13 +575,36 @@ func (k *Kernel) Init(args InitKernelArgs) error {
 		args.MaxFDLimit = MaxFdLimit
 	}
 	k.MaxFDLimit.Store(args.MaxFDLimit)
+	if args.PipeMaxSize == 0 {
+		args.PipeMaxSize = pipe.MaximumPipeSize
+	}
+	pipeMaxSize := pipe.RoundPipeSize(args.PipeMaxSize)
+	if pipeMaxSize == 0 {
+		return fmt.Errorf("invalid pipe-max-size %d", args.PipeMaxSize)
+	}
+	k.PipeMaxSize.Store(int32(pipeMaxSize))
+	if args.AIOMaxEvents == 0 {
+		args.AIOMaxEvents = mm.DefaultAIOMaxEvents
+	}
+	k.AIOEvents.Max.Store(args.AIOMaxEvents)
+	// Unlike Linux, which defaults to 65530, max_map_count is effectively
+	// unlimited by default since applications such as Elasticsearch refuse
+	// to start with lower values.
+	k.VMMaxMapCount = atomicbitops.FromInt32(math.MaxInt32)
+	k.VMOvercommitMemory = atomicbitops.FromInt32(pgalloc.DefaultCommitPolicy.Mode)
+	k.VMOvercommitRatio = atomicbitops.FromInt32(pgalloc.DefaultCommitPolicy.Ratio)
+	k.VMSwappiness = atomicbitops.FromInt32(60)
 	k.containerNames = make(map[string]string)
+	k.consoles = make(map[string]*TTY)
 	k.CheckpointWait.k = k
 
 	ctx := k.SupervisorContext()
 	if err := k.vfs.Init(ctx); err != nil {
 		return fmt.Errorf("failed to initialize VFS: %v", err)
 	}
+	if args.MaxOpenFiles != 0 {
+		k.vfs.SetMaxOpenFiles(args.MaxOpenFiles)
+	}
 
 	err := k.rootIPCNamespace.InitPosixQueues(ctx, &k.vfs, auth.CredentialsFromContext(ctx))
 	if err != nil {
@@ -1048,6 +1163,10 @@ func (ctx *createProcessContext) Value(key any) any {
 		return ctx.kernel.RealtimeClock()
 	case limits.CtxLimits:
 		return ctx.args.Limits
+	case mm.CtxMaxMapCount:
+		return int(ctx.kernel.VMMaxMapCount.Load())
+	case pgalloc.CtxCommitPolicy:
+		return ctx.kernel.CommitPolicy()
 	case pgalloc.CtxMemoryCgroupID:
 		return ctx.getMemoryCgroupID()
 	case pgalloc.CtxMemoryFile:
@@ -1719,6 +1838,15 @@ func (k *Kernel) MemoryFile() *pgalloc.MemoryFile {
 	return k.mf
 }
 
+// CommitPolicy returns the pgalloc.CommitPolicy configured by
+// /proc/sys/vm/overcommit_memory and /proc/sys/vm/overcommit_ratio.
+func (k *Kernel) CommitPolicy() pgalloc.CommitPolicy {
+	return pgalloc.CommitPolicy{
+		Mode:  k.VMOvercommitMemory.Load(),
+		Ratio: k.VMOvercommitRatio.Load(),
+	}
+}
+
 // SupervisorContext returns a Context with maximum privileges in k. It should
 // only be used by goroutines outside the control of the emulated kernel
 // defined by e.
@@ -1933,6 +2061,16 @@ func (k *Kernel) CgroupRegistry() *CgroupRegistry {
 	return k.cgroupRegistry
 }
 
+// Audit returns the audit subsystem.
+func (k *Kernel) Audit() *audit.Audit {
+	return &k.audit
+}
+
+// EntropyPool returns the kernel's entropy pool.
+func (k *Kernel) EntropyPool() *entropy.Pool {
+	return &k.entropyPool
+}
+
 // AddCgroupMount adds the cgroup mounts to the cgroupMountsMap. These cgroup
 // mounts are created during the creation of root container process and the
 // reference ownership is transferred to the kernel.
@@ -1972,6 +2110,9 @@ func (k *Kernel) releaseCgroupMounts(ctx context.Context) {
 // initialized, e.g. after k.Start() has been called.
 func (k *Kernel) Release() {
 	ctx := k.SupervisorContext()
+	if k.workingSetSampler != nil {
+		k.workingSetSampler.Stop()
+	}
 	k.releaseCgroupMounts(ctx)
 	k.hostMount.DecRef(ctx)
 	k.pipeMount.DecRef(ctx)
@@ -2162,3 +2303,30 @@ func (k *Kernel) ContainerName(cid string) string {
 	defer k.extMu.Unlock()
 	return k.containerNames[cid]
 }
+
+// RegisterContainerConsole sets tty as the console of the container with the
+// given name.
+func (k *Kernel) RegisterContainerConsole(containerName string, tty *TTY) {
+	k.extMu.Lock()
+	defer k.extMu.Unlock()
+	if k.consoles == nil {
+		k.consoles = make(map[string]*TTY)
+	}
+	k.consoles[containerName] = tty
+}
+
+// UnregisterContainerConsole removes the console of the container with the
+// given name, if any.
+func (k *Kernel) UnregisterContainerConsole(containerName string) {
+	k.extMu.Lock()
+	defer k.extMu.Unlock()
+	delete(k.consoles, containerName)
+}
+
+// ContainerConsole returns the console of the container with the given ID, or
+// nil if the container was not started with a terminal.
+func (k *Kernel) ContainerConsole(cid string) *TTY {
+	k.extMu.Lock()
+	defer k.extMu.Unlock()
+	return k.consoles[k.containerNames[cid]]
+}
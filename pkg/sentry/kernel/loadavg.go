@@ -0,0 +1,133 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"time"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/sync"
+)
+
+const (
+	// LoadAvgShift is the number of fractional bits of the fixed-point load
+	// averages returned by Kernel.LoadAvg. This matches Linux's FSHIFT.
+	LoadAvgShift = 11
+
+	// loadAvgFixed1 is 1.0 in fixed-point.
+	loadAvgFixed1 = 1 << LoadAvgShift
+
+	// loadAvgFreq is the sampling period of load averages. This matches
+	// Linux's LOAD_FREQ.
+	loadAvgFreq = 5*time.Second + linux.ClockTick
+)
+
+// loadAvgExp are the decay factors of the 1, 5 and 15 minute load averages
+// per sampling period, in fixed-point (1/exp(5sec/1min), etc.). These match
+// Linux's EXP_1, EXP_5 and EXP_15.
+var loadAvgExp = [3]uint64{1884, 2014, 2037}
+
+// loadAvg tracks the system load averages, as in Linux's
+// kernel/sched/loadavg.c. The number of running tasks is sampled by the CPU
+// clock ticker.
+//
+// +stateify savable
+type loadAvg struct {
+	mu sync.Mutex `state:"nosave"`
+
+	// avenrun are the 1, 5 and 15 minute load averages, in fixed-point.
+	// avenrun is protected by mu.
+	avenrun [3]uint64
+
+	// next is the monotonic time in nanoseconds at which the next sampling
+	// period ends. next is protected by mu.
+	next int64
+}
+
+// calcLoad returns the load average load after a sampling period during which
+// active tasks (in fixed-point) were running.
+func calcLoad(load, exp, active uint64) uint64 {
+	newload := load*exp + active*(loadAvgFixed1-exp)
+	if active >= load {
+		newload += loadAvgFixed1 - 1
+	}
+	return newload / loadAvgFixed1
+}
+
+// periodsLocked returns the number of sampling periods that ended by now.
+//
+// Preconditions: l.mu must be locked.
+func (l *loadAvg) periodsLocked(now int64) int64 {
+	if now < l.next {
+		return 0
+	}
+	return (now-l.next)/int64(loadAvgFreq) + 1
+}
+
+// calcLocked accounts n sampling periods during which active tasks were
+// running.
+//
+// Preconditions: l.mu must be locked.
+func (l *loadAvg) calcLocked(n int64, active uint64) {
+	for ; n > 0; n-- {
+		if active == 0 && l.avenrun == [3]uint64{} {
+			// Idle periods no longer change the load averages.
+			break
+		}
+		for i := range l.avenrun {
+			l.avenrun[i] = calcLoad(l.avenrun[i], loadAvgExp[i], active*loadAvgFixed1)
+		}
+		l.next += int64(loadAvgFreq)
+	}
+	l.next += n * int64(loadAvgFreq)
+}
+
+// sample records that running tasks are running at monotonic time now.
+func (l *loadAvg) sample(now int64, running uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := l.periodsLocked(now)
+	if n == 0 {
+		return
+	}
+	// The CPU clock ticker doesn't run while no task is running, so all but
+	// the last period were idle.
+	l.calcLocked(n-1, 0)
+	l.calcLocked(1, running)
+}
+
+// load returns the load averages at monotonic time now.
+func (l *loadAvg) load(now int64) [3]uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// Account for periods that ended while the CPU clock ticker wasn't
+	// running, and leave the last one to be sampled by the ticker.
+	if n := l.periodsLocked(now); n > 1 {
+		l.calcLocked(n-1, 0)
+	}
+	return l.avenrun
+}
+
+// LoadAvg returns the 1, 5 and 15 minute system load averages, as fixed-point
+// numbers with LoadAvgShift fractional bits.
+func (k *Kernel) LoadAvg() [3]uint64 {
+	return k.loadAvg.load(k.MonotonicClock().Now().Nanoseconds())
+}
+
+// NumRunningTasks returns the number of tasks currently running application
+// code.
+func (k *Kernel) NumRunningTasks() int64 {
+	return k.runningTasks.Load()
+}
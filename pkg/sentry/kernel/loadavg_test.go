@@ -0,0 +1,52 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadAvg(t *testing.T) {
+	var l loadAvg
+	now := int64(0)
+
+	// Keep 2 tasks running for 3 hours: all load averages converge to 2.
+	for ; now < int64(3*time.Hour); now += int64(10 * time.Millisecond) {
+		l.sample(now, 2)
+	}
+	for i, load := range l.load(now) {
+		if got, want := load>>LoadAvgShift, uint64(2); got != want {
+			t.Errorf("load average %d after running = %d (%#x), want %d", i, got, load, want)
+		}
+	}
+
+	// Go idle for 10 minutes: the ticker stops, and the 1 minute load
+	// average decays faster than the others.
+	now += int64(10 * time.Minute)
+	loads := l.load(now)
+	if !(loads[0] < loads[1] && loads[1] < loads[2]) {
+		t.Errorf("load averages after idling = %v, want increasing", loads)
+	}
+	if loads[0] != 0 {
+		t.Errorf("1 minute load average after idling = %#x, want 0", loads[0])
+	}
+
+	// Idling for a day decays all load averages to 0.
+	now += int64(24 * time.Hour)
+	if got := l.load(now); got != [3]uint64{} {
+		t.Errorf("load averages after idling for a day = %v, want 0", got)
+	}
+}
@@ -18,6 +18,7 @@ package pipe
 import (
 	"fmt"
 	"io"
+	"math/bits"
 
 	"golang.org/x/sys/unix"
 	"github.com/wilinz/gvisor/pkg/atomicbitops"
@@ -32,10 +33,16 @@ const (
 	// It corresponds to fs/pipe.c:pipe_min_size.
 	MinimumPipeSize = hostarch.PageSize
 
-	// MaximumPipeSize is a hard limit on the maximum size of a pipe.
-	// It corresponds to fs/pipe.c:pipe_max_size.
+	// MaximumPipeSize is the default limit on the size of a pipe set by an
+	// unprivileged user. It corresponds to fs/pipe.c:pipe_max_size, the
+	// default value of /proc/sys/fs/pipe-max-size.
 	MaximumPipeSize = 1048576
 
+	// MaximumPipeSizeLimit is a hard limit on the maximum size of a pipe,
+	// including /proc/sys/fs/pipe-max-size. It is lower than Linux's, which
+	// is 2 GiB (fs/pipe.c:round_pipe_size).
+	MaximumPipeSizeLimit = 1 << 30
+
 	// DefaultPipeSize is the system-wide default size of a pipe in bytes.
 	// It corresponds to pipe_fs_i.h:PIPE_DEF_BUFFERS.
 	DefaultPipeSize = 16 * hostarch.PageSize
@@ -443,15 +450,30 @@ func (p *Pipe) queuedLocked() int64 {
 	return p.size
 }
 
-// SetFifoSize implements fs.FifoSizer.SetFifoSize.
-func (p *Pipe) SetFifoSize(size int64) (int64, error) {
+// RoundPipeSize rounds size up to a power of two number of pages, as Linux
+// does for /proc/sys/fs/pipe-max-size. It returns 0 if size exceeds
+// MaximumPipeSizeLimit. See fs/pipe.c:round_pipe_size.
+func RoundPipeSize(size int64) int64 {
+	if size > MaximumPipeSizeLimit {
+		return 0
+	}
+	if size < MinimumPipeSize {
+		return MinimumPipeSize
+	}
+	pages := uint64(size+hostarch.PageSize-1) >> hostarch.PageShift
+	return int64(1<<bits.Len64(pages-1)) << hostarch.PageShift
+}
+
+// SetFifoSize implements fs.FifoSizer.SetFifoSize. max is the largest size
+// the caller is allowed to set.
+func (p *Pipe) SetFifoSize(size, max int64) (int64, error) {
 	if size < 0 {
 		return 0, linuxerr.EINVAL
 	}
 	if size < MinimumPipeSize {
 		size = MinimumPipeSize // Per spec.
 	}
-	if size > MaximumPipeSize {
+	if size > max {
 		return 0, linuxerr.EPERM
 	}
 	p.mu.Lock()
@@ -147,3 +147,45 @@ func TestPipeWriteUntilEnd(t *testing.T) {
 		}
 	})
 }
+
+func TestTeePartial(t *testing.T) {
+	const capacity = MinimumPipeSize
+	runTest(t, capacity, func(ctx context.Context, srcR, srcW *vfs.FileDescription) {
+		runTest(t, capacity, func(ctx context.Context, dstR, dstW *vfs.FileDescription) {
+			// Leave room for only 10 bytes in the destination pipe.
+			const room = 10
+			if n, err := dstW.Write(ctx, usermem.BytesIOSequence(make([]byte, capacity-room)), vfs.WriteOptions{}); n != capacity-room || err != nil {
+				t.Fatalf("Write: got (%d, %v), wanted (%d, nil)", n, err, capacity-room)
+			}
+			msg := []byte("more bytes than fit in the destination")
+			if n, err := srcW.Write(ctx, usermem.BytesIOSequence(msg), vfs.WriteOptions{}); n != int64(len(msg)) || err != nil {
+				t.Fatalf("Write: got (%d, %v), wanted (%d, nil)", n, err, len(msg))
+			}
+
+			// Tee and splice are not atomic, so they must transfer what fits
+			// rather than block.
+			src := srcR.Impl().(*VFSPipeFD)
+			dst := dstW.Impl().(*VFSPipeFD)
+			if n, err := Tee(ctx, dst, src, int64(len(msg))); n != room || err != nil {
+				t.Fatalf("Tee: got (%d, %v), wanted (%d, nil)", n, err, room)
+			}
+			if n, err := Tee(ctx, dst, src, int64(len(msg))); n != 0 || err != linuxerr.ErrWouldBlock {
+				t.Fatalf("Tee into full pipe: got (%d, %v), wanted (0, %v)", n, err, linuxerr.ErrWouldBlock)
+			}
+
+			// Drain the destination and check the data copied by Tee.
+			buf := make([]byte, capacity)
+			if n, err := dstR.Read(ctx, usermem.BytesIOSequence(buf), vfs.ReadOptions{}); n != capacity || err != nil {
+				t.Fatalf("Read: got (%d, %v), wanted (%d, nil)", n, err, capacity)
+			}
+			if got, want := buf[capacity-room:], msg[:room]; !bytes.Equal(got, want) {
+				t.Errorf("Tee copied %q, wanted %q", got, want)
+			}
+
+			// Splice the rest, which was not consumed by Tee.
+			if n, err := Splice(ctx, dst, src, int64(len(msg)+1)); n != int64(len(msg)) || err != nil {
+				t.Fatalf("Splice: got (%d, %v), wanted (%d, nil)", n, err, len(msg))
+			}
+		})
+	})
+}
@@ -15,6 +15,8 @@
 package pipe
 
 import (
+	"io"
+
 	"github.com/wilinz/gvisor/pkg/abi/linux"
 	"github.com/wilinz/gvisor/pkg/context"
 	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
@@ -254,9 +256,10 @@ func (fd *VFSPipeFD) PipeSize() int64 {
 	return fd.pipe.max
 }
 
-// SetPipeSize implements fcntl(F_SETPIPE_SZ).
-func (fd *VFSPipeFD) SetPipeSize(size int64) (int64, error) {
-	return fd.pipe.SetFifoSize(size)
+// SetPipeSize implements fcntl(F_SETPIPE_SZ). max is the largest size the
+// caller is allowed to set.
+func (fd *VFSPipeFD) SetPipeSize(size, max int64) (int64, error) {
+	return fd.pipe.SetFifoSize(size, max)
 }
 
 // SpliceToNonPipe performs a splice operation from fd to a non-pipe file.
@@ -467,15 +470,7 @@ func spliceOrTee(ctx context.Context, dst, src *VFSPipeFD, count int64, removeFr
 	}
 
 	firstLocked, secondLocked := lockTwoPipes(dst.pipe, src.pipe)
-	n, err := dst.pipe.writeLocked(count, func(dsts safemem.BlockSeq) (uint64, error) {
-		n, err := src.pipe.peekLocked(0, int64(dsts.NumBytes()), func(srcs safemem.BlockSeq) (uint64, error) {
-			return safemem.CopySeq(dsts, srcs)
-		})
-		if n > 0 && removeFromSrc {
-			src.pipe.consumeLocked(n)
-		}
-		return uint64(n), err
-	})
+	n, err := spliceOrTeeLocked(dst.pipe, src.pipe, count, removeFromSrc)
 	secondLocked.mu.NestedUnlock(pipeLockPipe)
 	firstLocked.mu.Unlock()
 
@@ -487,3 +482,33 @@ func spliceOrTee(ctx context.Context, dst, src *VFSPipeFD, count int64, removeFr
 	}
 	return n, err
 }
+
+// spliceOrTeeLocked transfers up to count bytes from src to dst.
+//
+// Preconditions: dst.mu and src.mu must be locked.
+func spliceOrTeeLocked(dst, src *Pipe, count int64, removeFromSrc bool) (int64, error) {
+	// As in Linux, running out of input takes precedence over dst being
+	// full.
+	if src.size == 0 && !src.HasWriters() {
+		return 0, io.EOF
+	}
+	// Unlike write(2), splice and tee between pipes need not be atomic, so
+	// transfer as much of the data in src as dst can hold. Otherwise
+	// writeLocked would refuse transfers of up to PIPE_BUF bytes that don't
+	// fit in dst entirely.
+	if src.size != 0 && count > src.size {
+		count = src.size
+	}
+	if avail := dst.max - dst.size; avail != 0 && count > avail {
+		count = avail
+	}
+	return dst.writeLocked(count, func(dsts safemem.BlockSeq) (uint64, error) {
+		n, err := src.peekLocked(0, int64(dsts.NumBytes()), func(srcs safemem.BlockSeq) (uint64, error) {
+			return safemem.CopySeq(dsts, srcs)
+		})
+		if n > 0 && removeFromSrc {
+			src.consumeLocked(n)
+		}
+		return uint64(n), err
+	})
+}
@@ -0,0 +1,210 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/atomicbitops"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/sync"
+)
+
+// ProcEventSubscriber receives process lifecycle events from ProcEvents.
+type ProcEventSubscriber interface {
+	// DeliverProcEvent delivers ev, with the given connector sequence and
+	// acknowledgement numbers. It is called without any kernel locks held,
+	// and must not retain ev.
+	DeliverProcEvent(ctx context.Context, seq, ack uint32, ev *linux.ProcEvent)
+}
+
+// ProcEvents is the kernel side of the process events connector, which
+// reports process lifecycle events to subscribed NETLINK_CONNECTOR sockets.
+// See drivers/connector/cn_proc.c.
+//
+// +stateify savable
+type ProcEvents struct {
+	// numListeners is the number of sockets that have requested events with
+	// PROC_CN_MCAST_LISTEN. Events are only generated while numListeners is
+	// positive.
+	numListeners atomicbitops.Int32
+
+	// seq is the sequence number of the last generated event.
+	seq atomicbitops.Uint32
+
+	// mu protects subscribers.
+	mu sync.Mutex `state:"nosave"`
+
+	// subscribers is the set of subscribers to which events are delivered.
+	subscribers map[ProcEventSubscriber]struct{}
+}
+
+// Subscribe adds s to the set of subscribers that receive events.
+func (pe *ProcEvents) Subscribe(s ProcEventSubscriber) {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	if pe.subscribers == nil {
+		pe.subscribers = make(map[ProcEventSubscriber]struct{})
+	}
+	pe.subscribers[s] = struct{}{}
+}
+
+// Unsubscribe removes s from the set of subscribers that receive events.
+func (pe *ProcEvents) Unsubscribe(s ProcEventSubscriber) {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	delete(pe.subscribers, s)
+}
+
+// Listen enables event generation on behalf of a new listener.
+func (pe *ProcEvents) Listen() {
+	pe.numListeners.Add(1)
+}
+
+// Ignore reverses a previous call to Listen.
+func (pe *ProcEvents) Ignore() {
+	pe.numListeners.Add(-1)
+}
+
+// enabled returns true if events should be generated.
+func (pe *ProcEvents) enabled() bool {
+	return pe.numListeners.Load() > 0
+}
+
+// send delivers ev to all subscribers.
+func (pe *ProcEvents) send(ctx context.Context, seq, ack uint32, ev *linux.ProcEvent) {
+	pe.mu.Lock()
+	subscribers := make([]ProcEventSubscriber, 0, len(pe.subscribers))
+	for s := range pe.subscribers {
+		subscribers = append(subscribers, s)
+	}
+	pe.mu.Unlock()
+	for _, s := range subscribers {
+		s.DeliverProcEvent(ctx, seq, ack, ev)
+	}
+}
+
+// Ack sends a PROC_EVENT_NONE event acknowledging a multicast control message
+// with the given sequence and acknowledgement numbers. err is a Linux errno,
+// or 0 for success.
+//
+// Ack is analogous to drivers/connector/cn_proc.c:cn_proc_ack.
+func (pe *ProcEvents) Ack(t *Task, err uint32, seq, ack uint32) {
+	if !pe.enabled() {
+		return
+	}
+	ev := t.newProcEvent(linux.PROC_EVENT_NONE)
+	data := linux.ProcEventAck{Err: err}
+	data.MarshalUnsafe(ev.EventData[:])
+	pe.send(t, seq, ack+1, &ev)
+}
+
+// ProcEvents returns the process events connector state.
+func (k *Kernel) ProcEvents() *ProcEvents {
+	return &k.procEvents
+}
+
+// newProcEvent returns a ProcEvent of the given type generated by t.
+func (t *Task) newProcEvent(what uint32) linux.ProcEvent {
+	return linux.ProcEvent{
+		What:        what,
+		CPU:         uint32(t.CPU()),
+		TimestampNS: uint64(t.k.MonotonicClock().Now().Nanoseconds()),
+	}
+}
+
+// sendProcEvent delivers an event generated by t.
+func (t *Task) sendProcEvent(ev *linux.ProcEvent) {
+	pe := &t.k.procEvents
+	pe.send(t, pe.seq.Add(1), 0 /* ack */, ev)
+}
+
+// procForkEvent generates a PROC_EVENT_FORK event for the creation of nt by
+// t. Process IDs in events are always from the root PID namespace.
+//
+// procForkEvent is analogous to
+// drivers/connector/cn_proc.c:proc_fork_connector.
+func (t *Task) procForkEvent(nt *Task) {
+	if !t.k.procEvents.enabled() {
+		return
+	}
+	ev := t.newProcEvent(linux.PROC_EVENT_FORK)
+	root := t.k.tasks.Root
+	t.k.tasks.mu.RLock()
+	data := linux.ProcEventFork{
+		ChildPID:  int32(root.tids[nt]),
+		ChildTGID: int32(root.tgids[nt.tg]),
+	}
+	if parent := nt.parent; parent != nil {
+		data.ParentPID = int32(root.tids[parent])
+		data.ParentTGID = int32(root.tgids[parent.tg])
+	}
+	t.k.tasks.mu.RUnlock()
+	data.MarshalUnsafe(ev.EventData[:])
+	t.sendProcEvent(&ev)
+}
+
+// procExecEvent generates a PROC_EVENT_EXEC event for a successful execve by
+// t.
+//
+// procExecEvent is analogous to
+// drivers/connector/cn_proc.c:proc_exec_connector.
+func (t *Task) procExecEvent() {
+	if !t.k.procEvents.enabled() {
+		return
+	}
+	ev := t.newProcEvent(linux.PROC_EVENT_EXEC)
+	root := t.k.tasks.Root
+	t.k.tasks.mu.RLock()
+	data := linux.ProcEventExec{
+		ProcessPID:  int32(root.tids[t]),
+		ProcessTGID: int32(root.tgids[t.tg]),
+	}
+	t.k.tasks.mu.RUnlock()
+	data.MarshalUnsafe(ev.EventData[:])
+	t.sendProcEvent(&ev)
+}
+
+// procExitEvent generates a PROC_EVENT_EXIT event for the exit of t.
+//
+// Preconditions: t.exitStatus has been set by t.exitThreadGroup().
+//
+// procExitEvent is analogous to
+// drivers/connector/cn_proc.c:proc_exit_connector.
+func (t *Task) procExitEvent() {
+	if !t.k.procEvents.enabled() {
+		return
+	}
+	ev := t.newProcEvent(linux.PROC_EVENT_EXIT)
+	root := t.k.tasks.Root
+	t.k.tasks.mu.RLock()
+	data := linux.ProcEventExit{
+		ProcessPID:  int32(root.tids[t]),
+		ProcessTGID: int32(root.tgids[t.tg]),
+		ExitCode:    uint32(t.ExitStatus()),
+		// Only thread group leaders notify their parent when they exit;
+		// Linux reports exit_signal == -1 for other threads.
+		ExitSignal: ^uint32(0),
+	}
+	if t == t.tg.leader {
+		data.ExitSignal = uint32(t.tg.terminationSignal)
+	}
+	if parent := t.parent; parent != nil {
+		data.ParentPID = int32(root.tids[parent])
+		data.ParentTGID = int32(root.tgids[parent.tg])
+	}
+	t.k.tasks.mu.RUnlock()
+	data.MarshalUnsafe(ev.EventData[:])
+	t.sendProcEvent(&ev)
+}
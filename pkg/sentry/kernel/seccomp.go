@@ -145,7 +145,7 @@ func (t *Task) evaluateSyscallFilters(sysno int32, args arch.SyscallArguments, i
 	if ts == nil {
 		return ret
 	}
-	arch := t.image.st.AuditNumber
+	arch := t.SyscallTable().AuditNumber
 	if arch == ts.cacheAuditNumber && sysno >= 0 && sysno <= sentry.MaxSyscallNum {
 		if cached := ts.cache[sysno]; cached != uncacheableBPFAction {
 			return uint32(cached)
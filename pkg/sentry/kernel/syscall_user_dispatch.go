@@ -0,0 +1,118 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/hostarch"
+)
+
+// Syscall User Dispatch (SUD) lets a task intercept its own syscalls: while
+// enabled, syscalls made from outside of an allowed range of instruction
+// pointers are not executed, and SIGSYS is sent to the task instead. An
+// optional selector byte in the task's memory switches interception on and
+// off without a syscall. See Documentation/admin-guide/syscall-user-dispatch.rst.
+
+// syscallUserDispatch is the Syscall User Dispatch configuration of a task.
+//
+// +stateify savable
+type syscallUserDispatch struct {
+	// enabled is true if syscalls are intercepted.
+	enabled bool
+
+	// Syscalls made with an instruction pointer in [offset, offset+length)
+	// are always allowed.
+	offset hostarch.Addr
+	length uint64
+
+	// selector is the address of the selector byte. If it is 0, syscalls
+	// outside of the allowed range are always intercepted.
+	selector hostarch.Addr
+}
+
+// EnableSyscallUserDispatch enables Syscall User Dispatch for syscalls made
+// outside of [offset, offset+length), as selected by the byte at selector.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) EnableSyscallUserDispatch(offset hostarch.Addr, length uint64, selector hostarch.Addr) error {
+	// Like Linux, reject allowed ranges that are empty or wrap around, unless
+	// they start at 0.
+	if offset != 0 && uint64(offset)+length <= uint64(offset) {
+		return linuxerr.EINVAL
+	}
+	t.syscallUserDispatch = syscallUserDispatch{
+		enabled:  true,
+		offset:   offset,
+		length:   length,
+		selector: selector,
+	}
+	return nil
+}
+
+// DisableSyscallUserDispatch disables Syscall User Dispatch.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) DisableSyscallUserDispatch() {
+	t.syscallUserDispatch = syscallUserDispatch{}
+}
+
+// checkSyscallUserDispatch applies Syscall User Dispatch to syscall sysno,
+// made at instruction pointer ip. It returns nil if the syscall should be
+// executed, or the task's next run state otherwise. Like Linux, it runs
+// before ptrace and seccomp see the syscall. See
+// kernel/entry/syscall_user_dispatch.c:syscall_user_dispatch.
+//
+// Preconditions:
+//   - The caller must be running on the task goroutine.
+//   - The syscall's registers must not have been modified yet, so that the
+//     signal handler sees them as they were at the syscall.
+func (t *Task) checkSyscallUserDispatch(sysno uintptr, ip hostarch.Addr) taskRunState {
+	sud := &t.syscallUserDispatch
+	if uint64(ip-sud.offset) < sud.length {
+		return nil
+	}
+	if sud.selector != 0 {
+		var state [1]byte
+		if _, err := t.CopyInBytes(sud.selector, state[:]); err != nil {
+			t.Debugf("Syscall %d: failed to read the syscall user dispatch selector: %v", sysno, err)
+			t.PrepareGroupExit(linux.WaitStatusTerminationSignal(linux.SIGSEGV))
+			return (*runExit)(nil)
+		}
+		switch state[0] {
+		case linux.SYSCALL_DISPATCH_FILTER_ALLOW:
+			return nil
+		case linux.SYSCALL_DISPATCH_FILTER_BLOCK:
+			// Dispatch below.
+		default:
+			t.Debugf("Syscall %d: invalid syscall user dispatch selector %d", sysno, state[0])
+			t.PrepareGroupExit(linux.WaitStatusTerminationSignal(linux.SIGSYS))
+			return (*runExit)(nil)
+		}
+	}
+
+	t.Debugf("Syscall %d: dispatched to the application", sysno)
+	si := &linux.SignalInfo{
+		Signo: int32(linux.SIGSYS),
+		Code:  linux.SYS_USER_DISPATCH,
+	}
+	si.SetCallAddr(uint64(ip))
+	si.SetSyscall(int32(sysno))
+	si.SetArch(t.SyscallTable().AuditNumber)
+	t.forceSignal(linux.SIGSYS, false /* unconditional */)
+	t.SendSignal(si)
+	// The syscall was never entered, so there is no syscall-exit-stop.
+	return (*runApp)(nil)
+}
@@ -17,6 +17,7 @@ package kernel
 import (
 	"fmt"
 	"strconv"
+	"time"
 
 	"google.golang.org/protobuf/proto"
 	"github.com/wilinz/gvisor/pkg/abi"
@@ -104,6 +105,9 @@ const (
 	// StraceEnableEvent enables syscall event tracing.
 	StraceEnableEvent
 
+	// StraceEnableSeccheck enables syscall tracing to seccheck sinks.
+	StraceEnableSeccheck
+
 	// ExternalBeforeEnable enables the external hook before syscall execution.
 	ExternalBeforeEnable
 
@@ -121,10 +125,14 @@ const (
 
 	// SecCheckRawExit represents raw/exit syscall seccheck event.
 	SecCheckRawExit
+
+	// SyscallProfileDeny causes the syscall to fail with EPERM instead of
+	// being executed. See SyscallTable.Restrict.
+	SyscallProfileDeny
 )
 
-// StraceEnableBits combines both strace log and event flags.
-const StraceEnableBits = StraceEnableLog | StraceEnableEvent
+// StraceEnableBits combines the strace log, event and seccheck flags.
+const StraceEnableBits = StraceEnableLog | StraceEnableEvent | StraceEnableSeccheck
 
 // SyscallFlagsTable manages a set of enable/disable bit fields on a per-syscall
 // basis.
@@ -296,6 +304,12 @@ type SyscallTable struct {
 	// Table is the collection of functions.
 	Table map[uintptr]Syscall
 
+	// Compat is the syscall table used by tasks running 32-bit code in
+	// the compatibility mode of the architecture, if it is supported. It
+	// is initialized along with this table, but is not registered on its
+	// own.
+	Compat *SyscallTable
+
 	// lookup is a fixed-size array that holds the syscalls (indexed by
 	// their numbers). It is used for fast look ups.
 	lookup [sentry.MaxSyscallNum + 1]SyscallFn
@@ -328,6 +342,10 @@ type SyscallTable struct {
 
 	// FeatureEnable stores the strace and one-shot enable bits.
 	FeatureEnable SyscallFlagsTable
+
+	// denied counts the attempts to make each syscall that was denied by
+	// Restrict.
+	denied [sentry.MaxSyscallNum + 1]atomicbitops.Uint64
 }
 
 // MaxSysno returns the largest system call number.
@@ -357,6 +375,15 @@ var (
 	// unimplementedSyscallCounter tracks the number of times each unimplemented syscall has been
 	// called by the sandboxed application.
 	unimplementedSyscallCounter *metric.Uint64Metric
+
+	// syscallNumberValues holds the field values of syscall numbers in
+	// [0, maxSyscallNum], followed by outOfRangeSyscallNumber.
+	syscallNumberValues []*metric.FieldValue
+
+	// syscallLatency records the latency of each syscall executed for the
+	// sandboxed application, broken down by syscall number. It is nil unless
+	// EnableSyscallLatencyMetric has been called.
+	syscallLatency *metric.TimerMetric
 )
 
 // SyscallTables returns a read-only slice of registered SyscallTables.
@@ -382,6 +409,11 @@ func RegisterSyscallTable(s *SyscallTable) {
 	if _, ok := LookupSyscallTable(s.OS, s.Arch); ok {
 		panic(fmt.Sprintf("Duplicate SyscallTable registered for OS %v Arch %v", s.OS, s.Arch))
 	}
+	if s.Compat != nil {
+		if max := s.Compat.MaxSysno(); max > sentry.MaxSyscallNum {
+			panic(fmt.Sprintf("Compat SyscallTable %+v contains too large syscall number %d", s.Compat, max))
+		}
+	}
 	allSyscallTables = append(allSyscallTables, s)
 	unimplementedSyscallCounterInit.Do(func() {
 		allowedValues := make([]*metric.FieldValue, sentry.MaxSyscallNum+2)
@@ -392,6 +424,7 @@ func RegisterSyscallTable(s *SyscallTable) {
 			unimplementedSyscallNumbers[i] = []*metric.FieldValue{s}
 		}
 		allowedValues[len(allowedValues)-1] = outOfRangeSyscallNumber[0]
+		syscallNumberValues = allowedValues
 		unimplementedSyscallCounter = metric.MustCreateNewUint64Metric("/unimplemented_syscalls",
 			metric.Uint64Metadata{
 				Cumulative:  true,
@@ -403,6 +436,9 @@ func RegisterSyscallTable(s *SyscallTable) {
 			})
 	})
 	s.Init()
+	if s.Compat != nil {
+		s.Compat.Init()
+	}
 }
 
 // Init initializes the system call table.
@@ -456,6 +492,51 @@ func (s *SyscallTable) LookupNo(name string) (uintptr, error) {
 	return 0, fmt.Errorf("syscall %q not found", name)
 }
 
+// Restrict makes all syscalls in s that are not in allowed fail with EPERM.
+// Missing syscalls are not affected, so that applications can still detect
+// them by their ENOSYS error and fall back to other syscalls.
+//
+// Attempts to make denied syscalls are counted, and can be retrieved with
+// DeniedSyscalls.
+func (s *SyscallTable) Restrict(allowed map[uintptr]bool) {
+	denied := make(map[uintptr]bool)
+	for sysno := range s.Table {
+		if !allowed[sysno] {
+			denied[sysno] = true
+		}
+	}
+	s.FeatureEnable.Enable(SyscallProfileDeny, denied, false)
+}
+
+// DeniedSyscall describes attempts to make a syscall denied by
+// SyscallTable.Restrict.
+type DeniedSyscall struct {
+	// Sysno is the syscall number.
+	Sysno uintptr
+
+	// Name is the syscall name.
+	Name string
+
+	// Count is the number of attempts to make the syscall.
+	Count uint64
+}
+
+// DeniedSyscalls returns the denied syscalls that applications attempted to
+// make, ordered by syscall number.
+func (s *SyscallTable) DeniedSyscalls() []DeniedSyscall {
+	var ds []DeniedSyscall
+	for sysno := range s.denied {
+		if n := s.denied[sysno].Load(); n != 0 {
+			ds = append(ds, DeniedSyscall{
+				Sysno: uintptr(sysno),
+				Name:  s.LookupName(uintptr(sysno)),
+				Count: n,
+			})
+		}
+	}
+	return ds
+}
+
 // LookupEmulate looks up an emulation syscall number.
 func (s *SyscallTable) LookupEmulate(addr hostarch.Addr) (uintptr, bool) {
 	sysno, ok := s.Emulate[addr]
@@ -493,6 +574,39 @@ type SyscallInfo struct {
 	Errno int
 }
 
+// EnableSyscallLatencyMetric registers the /task/syscall_latency metric, which
+// records the latency of each syscall executed for the sandboxed application,
+// broken down by syscall number. Latencies include the time spent blocked.
+//
+// It must be called after a syscall table has been registered, and before
+// metric.Initialize.
+func EnableSyscallLatencyMetric() error {
+	if syscallNumberValues == nil {
+		return fmt.Errorf("no syscall table registered")
+	}
+	m, err := metric.NewTimerMetric("/task/syscall_latency",
+		metric.NewDurationBucketer(20, time.Microsecond, 10*time.Second),
+		"Latency of the syscalls executed by the sentry for the user, including time spent blocked, broken down by syscall number.",
+		metric.NewField("sysno", syscallNumberValues...))
+	if err != nil {
+		return err
+	}
+	syscallLatency = m
+	return nil
+}
+
+// recordSyscallLatency adds a sample to the syscall latency metric for a
+// syscall that started at startNs, as returned by metric.CheapNowNano.
+//
+// Preconditions: EnableSyscallLatencyMetric has been called.
+func recordSyscallLatency(sysno uintptr, startNs int64) {
+	v := syscallNumberValues[len(syscallNumberValues)-1]
+	if sysno <= sentry.MaxSyscallNum {
+		v = syscallNumberValues[sysno]
+	}
+	syscallLatency.AddSample(metric.CheapNowNano()-startNs, v)
+}
+
 // IncrementUnimplementedSyscallCounter increments the "unimplemented syscall" metric for the given
 // syscall number.
 // A syscall table must have been initialized prior to calling this function.
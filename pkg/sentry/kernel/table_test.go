@@ -18,6 +18,8 @@ import (
 	"testing"
 
 	"github.com/wilinz/gvisor/pkg/abi"
+	"github.com/wilinz/gvisor/pkg/abi/sentry"
+	"github.com/wilinz/gvisor/pkg/metric"
 	"github.com/wilinz/gvisor/pkg/sentry/arch"
 )
 
@@ -77,6 +79,61 @@ func TestTable(t *testing.T) {
 	}
 }
 
+func TestRestrict(t *testing.T) {
+	table := createSyscallTable()
+	defer func() {
+		// Cleanup registered tables to keep tests separate.
+		allSyscallTables = []*SyscallTable{}
+	}()
+
+	table.Restrict(map[uintptr]bool{1: true, 2: true})
+	for _, tc := range []struct {
+		sysno  uintptr
+		denied bool
+	}{
+		{sysno: 0, denied: true},
+		{sysno: 1, denied: false},
+		{sysno: 2, denied: false},
+		{sysno: 3, denied: true},
+		{sysno: maxTestSyscall, denied: true},
+		// Missing syscalls are never denied.
+		{sysno: maxTestSyscall + 1, denied: false},
+	} {
+		if got := table.FeatureEnable.Word(tc.sysno)&SyscallProfileDeny != 0; got != tc.denied {
+			t.Errorf("syscall %d denied: got %t, want %t", tc.sysno, got, tc.denied)
+		}
+	}
+
+	if ds := table.DeniedSyscalls(); len(ds) != 0 {
+		t.Errorf("DeniedSyscalls() before any attempt: got %+v, want none", ds)
+	}
+	table.denied[3].Add(2)
+	table.denied[0].Add(1)
+	ds := table.DeniedSyscalls()
+	if len(ds) != 2 || ds[0].Sysno != 0 || ds[0].Count != 1 || ds[1].Sysno != 3 || ds[1].Count != 2 {
+		t.Errorf("DeniedSyscalls(): got %+v, want syscall 0 once and syscall 3 twice", ds)
+	}
+}
+
+func TestSyscallLatencyMetric(t *testing.T) {
+	createSyscallTable()
+	defer func() {
+		// Cleanup registered tables to keep tests separate.
+		allSyscallTables = []*SyscallTable{}
+	}()
+
+	if err := EnableSyscallLatencyMetric(); err != nil {
+		t.Fatalf("EnableSyscallLatencyMetric() failed: %v", err)
+	}
+	defer func() { syscallLatency = nil }()
+
+	// Samples may be recorded for syscall numbers in and out of range.
+	start := metric.CheapNowNano()
+	for _, sysno := range []uintptr{0, 1, sentry.MaxSyscallNum, sentry.MaxSyscallNum + 1} {
+		recordSyscallLatency(sysno, start)
+	}
+}
+
 func BenchmarkTableLookup(b *testing.B) {
 	table := createSyscallTable()
 
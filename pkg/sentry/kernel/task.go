@@ -18,6 +18,7 @@ import (
 	gocontext "context"
 	"runtime/trace"
 	"sync/atomic"
+	"time"
 
 	"github.com/wilinz/gvisor/pkg/abi/linux"
 	"github.com/wilinz/gvisor/pkg/atomicbitops"
@@ -484,6 +485,18 @@ type Task struct {
 	// seccomp is owned by the task goroutine.
 	seccomp atomic.Pointer[taskSeccomp] `state:".(*taskSeccomp)"`
 
+	// syscallUserDispatch is the task's Syscall User Dispatch configuration.
+	// It is not inherited by children, and is reset by execve.
+	//
+	// syscallUserDispatch is owned by the task goroutine.
+	syscallUserDispatch syscallUserDispatch
+
+	// ioPorts is the I/O privilege state set by iopl(2) and ioperm(2). Like
+	// in Linux, it is inherited by children and preserved across execve.
+	//
+	// ioPorts is owned by the task goroutine.
+	ioPorts ioPortState
+
 	// If cleartid is non-zero, treat it as a pointer to a ThreadID in the
 	// task's virtual address space; when the task exits, set the pointed-to
 	// ThreadID to 0, and wake any futex waiters.
@@ -514,6 +527,27 @@ type Task struct {
 	// niceness is protected by mu.
 	niceness int
 
+	// schedPolicy and rtPriority are the scheduling policy and real-time
+	// priority set by sched_setscheduler(2), and schedResetOnFork is true if
+	// SCHED_RESET_ON_FORK was specified. As with niceness, these do not
+	// affect scheduling of the task by the sentry; they determine the
+	// task's priority for priority inheritance (see task_futex_pi.go) and
+	// are reported back to the application.
+	//
+	// These fields are protected by mu.
+	schedPolicy      int32
+	rtPriority       int32
+	schedResetOnFork bool
+
+	// timerSlack is the timer slack set by prctl(PR_SET_TIMERSLACK) in
+	// nanoseconds. It is only honored if the Kernel was initialized with a
+	// non-zero InitKernelArgs.TimerSlack.
+	timerSlack atomicbitops.Int64
+
+	// defaultTimerSlack is the timer slack restored by
+	// prctl(PR_SET_TIMERSLACK, 0). defaultTimerSlack is immutable.
+	defaultTimerSlack time.Duration
+
 	// This is used to track the numa policy for the current thread. This can be
 	// modified through a set_mempolicy(2) syscall. Since we always report a
 	// single numa node, all policies are no-ops. We only track this information
@@ -589,9 +623,29 @@ type Task struct {
 
 	// futexWaiter is used for futex(FUTEX_WAIT) syscalls.
 	//
-	// futexWaiter is exclusive to the task goroutine.
+	// futexWaiter is exclusive to the task goroutine, except that its
+	// priority may be changed by priority inheritance while the task is
+	// blocked on a PI futex (see Task.adjustPIChainLocked).
 	futexWaiter *futex.Waiter `state:"nosave"`
 
+	// piWaitingOn is the state of the PI futex that the task is blocked
+	// acquiring, or nil if it is not blocked on a PI futex.
+	//
+	// piWaitingOn is protected by Kernel.futexPIMu.
+	piWaitingOn *futexPIState `state:"nosave"`
+
+	// piOwned is the set of PI futexes with waiters that are owned by the
+	// task.
+	//
+	// piOwned is protected by Kernel.futexPIMu.
+	piOwned map[*futexPIState]struct{} `state:"nosave"`
+
+	// piBoost is one more than the priority inherited from tasks blocked on
+	// PI futexes owned by the task, or 0 if there is none.
+	//
+	// piBoost is only mutated with Kernel.futexPIMu locked.
+	piBoost atomicbitops.Int32 `state:"nosave"`
+
 	// robustList is a pointer to the head of the tasks's robust futex
 	// list.
 	robustList hostarch.Addr
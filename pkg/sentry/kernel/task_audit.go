@@ -0,0 +1,64 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"github.com/wilinz/gvisor/pkg/sentry/arch"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/audit"
+)
+
+// AuditContext returns the state of t that audit rules are matched against.
+func (t *Task) AuditContext() *audit.Context {
+	creds := t.Credentials()
+	c := &audit.Context{
+		Arch:  t.SyscallTable().AuditNumber,
+		PID:   int32(t.k.tasks.Root.IDOfThreadGroup(t.tg)),
+		UID:   uint32(creds.RealKUID),
+		EUID:  uint32(creds.EffectiveKUID),
+		SUID:  uint32(creds.SavedKUID),
+		FSUID: uint32(creds.EffectiveKUID),
+		GID:   uint32(creds.RealKGID),
+		EGID:  uint32(creds.EffectiveKGID),
+		SGID:  uint32(creds.SavedKGID),
+		FSGID: uint32(creds.EffectiveKGID),
+		Comm:  t.Name(),
+	}
+	if parent := t.Parent(); parent != nil {
+		c.PPID = int32(t.k.tasks.Root.IDOfThreadGroup(parent.tg))
+	}
+	if mm := t.MemoryManager(); mm != nil {
+		if exe := mm.Executable(); exe != nil {
+			c.Exe = exe.MappedName(t)
+			exe.DecRef(t)
+		}
+	}
+	return c
+}
+
+// auditSyscall reports a completed syscall to the audit subsystem.
+func (t *Task) auditSyscall(sysno uintptr, args arch.SyscallArguments, rval uintptr, err error) {
+	c := t.AuditContext()
+	c.Sysno = sysno
+	for i := range c.Args {
+		c.Args[i] = args[i].Uint64()
+	}
+	if errno := ExtractErrno(err, int(sysno)); err != nil && errno != 0 {
+		c.Exit = -int64(errno)
+	} else {
+		c.Exit = int64(rval)
+		c.Success = true
+	}
+	t.k.audit.AuditSyscall(t, c)
+}
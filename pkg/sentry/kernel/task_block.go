@@ -126,6 +126,7 @@ func (t *Task) BlockWithDeadlineFrom(C <-chan struct{}, clock ktime.Clock, haveD
 
 func (t *Task) blockWithDeadlineFromSampledClock(C <-chan struct{}, clock ktime.SampledClock, deadline ktime.Time) error {
 	// Start the timeout timer.
+	t.blockingTimer.SetSlack(t.effectiveTimerSlack())
 	t.blockingTimer.SetClock(clock, ktime.Setting{
 		Enabled: true,
 		Next:    deadline,
@@ -22,6 +22,8 @@ import (
 
 	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
 	"github.com/wilinz/gvisor/pkg/log"
+	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/kernfs"
+	"github.com/wilinz/gvisor/pkg/sentry/vfs"
 )
 
 // EnterInitialCgroups moves t into an initial set of cgroups.
@@ -55,6 +57,69 @@ func (t *Task) EnterInitialCgroups(parent *Task, initCgroups map[Cgroup]struct{}
 	}
 }
 
+// cloneIntoCgroupSet returns the cgroups that a child created by clone3(2)
+// with CLONE_INTO_CGROUP should start in: the cgroup referred to by fd, and
+// t's cgroups in all other hierarchies. A reference is held on each returned
+// cgroup, which is transferred to the caller.
+//
+// Unlike Linux, which only supports CLONE_INTO_CGROUP for cgroup2, fd may
+// refer to a cgroup in any cgroupfs hierarchy.
+func (t *Task) cloneIntoCgroupSet(fd int32) (map[Cgroup]struct{}, error) {
+	file := t.GetFile(fd)
+	if file == nil {
+		return nil, linuxerr.EBADF
+	}
+	defer file.DecRef(t)
+	kd, ok := file.Dentry().Impl().(*kernfs.Dentry)
+	if !ok {
+		return nil, linuxerr.EBADF
+	}
+	impl, ok := kd.Inode().(CgroupImpl)
+	if !ok {
+		return nil, linuxerr.EBADF
+	}
+	// Linux checks for permission to write cgroup.procs in the target cgroup;
+	// approximate this with write permission on the cgroup directory.
+	if err := kd.Inode().CheckPermissions(t, t.Credentials(), vfs.MayWrite); err != nil {
+		return nil, err
+	}
+
+	target := Cgroup{
+		Dentry:     kd,
+		CgroupImpl: impl,
+	}
+	target.IncRef()
+	cgs := map[Cgroup]struct{}{target: {}}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for cg := range t.cgroups {
+		if cg.HierarchyID() != target.HierarchyID() {
+			cg.IncRef()
+			cgs[cg] = struct{}{}
+		}
+	}
+	return cgs, nil
+}
+
+// chargeCgroupsFor charges the cgroup in cgs with controller ctl on behalf of
+// target. Returns the cgroup that's charged if any. Returned cgroup has an
+// extra ref that's transferred to the caller.
+func chargeCgroupsFor(cgs map[Cgroup]struct{}, target *Task, ctl CgroupControllerType, res CgroupResourceType, value int64) (bool, Cgroup, error) {
+	for c := range cgs {
+		for _, cc := range c.Controllers() {
+			if cc.Type() != ctl {
+				continue
+			}
+			err := c.Charge(target, c.Dentry, ctl, res, value)
+			if err == nil {
+				c.IncRef()
+			}
+			return err == nil, c, err
+		}
+	}
+	return false, Cgroup{}, nil
+}
+
 // SetMemCgID sets the given memory cgroup id to the task.
 func (t *Task) SetMemCgID(memCgID uint32) {
 	t.memCgID.Store(memCgID)
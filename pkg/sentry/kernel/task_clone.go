@@ -20,9 +20,11 @@ import (
 	"github.com/wilinz/gvisor/pkg/cleanup"
 	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
 	"github.com/wilinz/gvisor/pkg/hostarch"
+	"github.com/wilinz/gvisor/pkg/marshal/primitive"
 	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/kernfs"
 	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/nsfs"
 	"github.com/wilinz/gvisor/pkg/sentry/inet"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
 	"github.com/wilinz/gvisor/pkg/sentry/seccheck"
 	pb "github.com/wilinz/gvisor/pkg/sentry/seccheck/points/points_go_proto"
 	"github.com/wilinz/gvisor/pkg/sentry/vfs"
@@ -30,14 +32,13 @@ import (
 )
 
 // SupportedCloneFlags is the bitwise OR of all the supported flags for clone.
-// TODO(b/290826530): Implement CLONE_INTO_CGROUP when cgroups v2 is
-// implemented.
 const SupportedCloneFlags = linux.CLONE_VM | linux.CLONE_FS | linux.CLONE_FILES | linux.CLONE_SYSVSEM |
 	linux.CLONE_THREAD | linux.CLONE_SIGHAND | linux.CLONE_CHILD_SETTID | linux.CLONE_NEWPID |
 	linux.CLONE_CHILD_CLEARTID | linux.CLONE_CHILD_SETTID | linux.CLONE_PARENT |
 	linux.CLONE_PARENT_SETTID | linux.CLONE_SETTLS | linux.CLONE_NEWUSER | linux.CLONE_NEWUTS |
 	linux.CLONE_NEWIPC | linux.CLONE_NEWNET | linux.CLONE_PTRACE | linux.CLONE_UNTRACED |
-	linux.CLONE_IO | linux.CLONE_VFORK | linux.CLONE_DETACHED | linux.CLONE_NEWNS
+	linux.CLONE_IO | linux.CLONE_VFORK | linux.CLONE_DETACHED | linux.CLONE_NEWNS |
+	linux.CLONE_INTO_CGROUP
 
 // Clone implements the clone(2) syscall and returns the thread ID of the new
 // task in t's PID namespace. Clone may return both a non-zero thread ID and a
@@ -55,14 +56,15 @@ func (t *Task) Clone(args *linux.CloneArgs) (ThreadID, *SyscallControl, error) {
 	if args.Flags&(linux.CLONE_SIGHAND|linux.CLONE_VM) == linux.CLONE_SIGHAND {
 		return 0, nil, linuxerr.EINVAL
 	}
-	if args.SetTID != 0 {
-		return 0, nil, linuxerr.ENOTSUP
-	}
 	// In order for the behavior of thread-group-directed signals to be sane,
 	// all tasks in a thread group must share signal handlers.
 	if args.Flags&(linux.CLONE_THREAD|linux.CLONE_SIGHAND) == linux.CLONE_THREAD {
 		return 0, nil, linuxerr.EINVAL
 	}
+	// All tasks in a thread group must be in the same cgroups.
+	if args.Flags&(linux.CLONE_THREAD|linux.CLONE_INTO_CGROUP) == linux.CLONE_THREAD|linux.CLONE_INTO_CGROUP {
+		return 0, nil, linuxerr.EINVAL
+	}
 	// All tasks in a thread group must be in the same PID namespace.
 	if (args.Flags&linux.CLONE_THREAD != 0) && (args.Flags&linux.CLONE_NEWPID != 0 || t.childPIDNamespace != nil) {
 		return 0, nil, linuxerr.EINVAL
@@ -227,6 +229,25 @@ func (t *Task) Clone(args *linux.CloneArgs) (ThreadID, *SyscallControl, error) {
 		pidns = pidns.NewChild(userns)
 	}
 
+	tids, err := t.copyInSetTIDs(args, pidns, creds)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var initialCgroups map[Cgroup]struct{}
+	if args.Flags&linux.CLONE_INTO_CGROUP != 0 {
+		cgs, err := t.cloneIntoCgroupSet(int32(args.Cgroup))
+		if err != nil {
+			return 0, nil, err
+		}
+		defer func() {
+			for cg := range cgs {
+				cg.decRef()
+			}
+		}()
+		initialCgroups = cgs
+	}
+
 	tg := t.tg
 	rseqAddr := hostarch.Addr(0)
 	rseqSignature := uint32(0)
@@ -246,6 +267,7 @@ func (t *Task) Clone(args *linux.CloneArgs) (ThreadID, *SyscallControl, error) {
 		uc = t.k.GetUserCounters(creds.RealKUID)
 	}
 
+	niceness, schedPolicy, rtPriority := t.forkSchedParams()
 	cfg := &TaskConfig{
 		Kernel:           t.k,
 		ThreadGroup:      tg,
@@ -254,7 +276,10 @@ func (t *Task) Clone(args *linux.CloneArgs) (ThreadID, *SyscallControl, error) {
 		FSContext:        fsContext,
 		FDTable:          fdTable,
 		Credentials:      creds,
-		Niceness:         t.Niceness(),
+		Niceness:         niceness,
+		SchedPolicy:      schedPolicy,
+		RTPriority:       rtPriority,
+		TimerSlack:       t.TimerSlack(),
 		NetworkNamespace: netns,
 		AllowedCPUMask:   t.CPUMask(),
 		UTSNamespace:     utsns,
@@ -266,6 +291,8 @@ func (t *Task) Clone(args *linux.CloneArgs) (ThreadID, *SyscallControl, error) {
 		UserCounters:     uc,
 		SessionKeyring:   sessionKeyring,
 		Origin:           t.Origin,
+		InitialCgroups:   initialCgroups,
+		TIDs:             tids,
 	}
 	if args.Flags&linux.CLONE_THREAD == 0 {
 		cfg.Parent = t
@@ -289,6 +316,10 @@ func (t *Task) Clone(args *linux.CloneArgs) (ThreadID, *SyscallControl, error) {
 		nt.SetSignalStack(t.SignalStack())
 	}
 
+	// Children inherit the I/O permissions of their parent, see
+	// arch/x86/kernel/process.c:copy_thread() and io_bitmap_share().
+	nt.ioPorts = t.ioPorts.fork()
+
 	if userns != creds.UserNamespace {
 		if err := nt.SetUserNamespace(userns); err != nil {
 			// This shouldn't be possible: userns was created from nt.creds, so
@@ -302,6 +333,8 @@ func (t *Task) Clone(args *linux.CloneArgs) (ThreadID, *SyscallControl, error) {
 	tid := nt.k.tasks.Root.IDOfTask(nt)
 	defer nt.Start(tid)
 
+	t.procForkEvent(nt)
+
 	if seccheck.Global.Enabled(seccheck.PointClone) {
 		mask, info := getCloneSeccheckInfo(t, nt, args.Flags)
 		if err := seccheck.Global.SentToSinks(func(c seccheck.Sink) error {
@@ -390,6 +423,38 @@ func getCloneSeccheckInfo(t, nt *Task, flags uint64) (seccheck.FieldSet, *pb.Clo
 	return fields, info
 }
 
+// copyInSetTIDs copies in the thread IDs requested by clone3(2)'s
+// clone_args.set_tid for a new task in pidns, and checks that creds may
+// request them. The returned slice starts with the thread ID in pidns and
+// continues with thread IDs in its ancestors.
+func (t *Task) copyInSetTIDs(args *linux.CloneArgs, pidns *PIDNamespace, creds *auth.Credentials) ([]ThreadID, error) {
+	if args.SetTIDSize == 0 {
+		return nil, nil
+	}
+	setTIDs := make([]int32, args.SetTIDSize)
+	if _, err := primitive.CopyInt32SliceIn(t, hostarch.Addr(args.SetTID), setTIDs); err != nil {
+		return nil, err
+	}
+	// See Linux kernel/pid.c:alloc_pid().
+	tids := make([]ThreadID, 0, len(setTIDs))
+	ns := pidns
+	for _, tid := range setTIDs {
+		if ns == nil {
+			// More thread IDs than PID namespaces.
+			return nil, linuxerr.EINVAL
+		}
+		if tid < 1 || tid > TasksLimit {
+			return nil, linuxerr.EINVAL
+		}
+		if !creds.HasCapabilityIn(linux.CAP_CHECKPOINT_RESTORE, ns.userns) && !creds.HasCapabilityIn(linux.CAP_SYS_ADMIN, ns.userns) {
+			return nil, linuxerr.EPERM
+		}
+		tids = append(tids, ThreadID(tid))
+		ns = ns.parent
+	}
+	return tids, nil
+}
+
 // maybeBeginVforkStop checks if a previously-started vfork child is still
 // running and has not yet released its MM, such that its parent t should enter
 // a vforkStop.
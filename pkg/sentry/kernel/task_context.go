@@ -27,6 +27,7 @@ import (
 	"github.com/wilinz/gvisor/pkg/sentry/kernel/shm"
 	"github.com/wilinz/gvisor/pkg/sentry/ktime"
 	"github.com/wilinz/gvisor/pkg/sentry/limits"
+	"github.com/wilinz/gvisor/pkg/sentry/mm"
 	"github.com/wilinz/gvisor/pkg/sentry/pgalloc"
 	"github.com/wilinz/gvisor/pkg/sentry/platform"
 	"github.com/wilinz/gvisor/pkg/sentry/unimpl"
@@ -110,14 +111,22 @@ func (t *Task) contextValue(key any, isTaskGoroutine bool) any {
 		return t.NetworkContext()
 	case inet.CtxNamespaceByFD:
 		return t.NetworkNamespaceByFD
+	case inet.CtxNamespaceByPID:
+		return t.NetworkNamespaceByPID
 	case ktime.CtxRealtimeClock:
 		return t.k.RealtimeClock()
+	case ktime.CtxTimerSlack:
+		return t.effectiveTimerSlack()
 	case limits.CtxLimits:
 		return t.tg.limits
 	case linux.CtxSignalNoInfoFunc:
 		return func(sig linux.Signal) error {
 			return t.SendSignal(SignalInfoNoInfo(sig, t, t))
 		}
+	case mm.CtxMaxMapCount:
+		return int(t.k.VMMaxMapCount.Load())
+	case pgalloc.CtxCommitPolicy:
+		return t.k.CommitPolicy()
 	case pgalloc.CtxMemoryCgroupID:
 		return t.memCgID.Load()
 	case pgalloc.CtxMemoryFile:
@@ -223,6 +223,8 @@ func (r *runSyscallAfterExecStop) execute(t *Task) taskRunState {
 	t.rseqSignature = 0
 	t.oldRSeqCPUAddr = 0
 	t.tg.oldRSeqCritical.Store(&OldRSeqCriticalRegion{})
+	// Syscall User Dispatch is disabled.
+	t.syscallUserDispatch = syscallUserDispatch{}
 	t.tg.pidns.owner.mu.Unlock()
 
 	oldFDTable := t.fdTable
@@ -234,8 +236,9 @@ func (r *runSyscallAfterExecStop) execute(t *Task) taskRunState {
 		return flags.CloseOnExec
 	})
 
-	// Handle the robust futex list.
+	// Handle the robust futex list and any PI futexes still owned.
 	t.exitRobustList()
+	t.exitFutexPI()
 
 	// NOTE(b/30815691): We currently do not implement privileged
 	// executables (set-user/group-ID bits and file capabilities). This
@@ -263,6 +266,7 @@ func (r *runSyscallAfterExecStop) execute(t *Task) taskRunState {
 	// NOTE(b/30316266): All locks must be dropped prior to calling Activate.
 	t.MemoryManager().Activate(t)
 
+	t.procExecEvent()
 	t.ptraceExec(oldTID)
 	return (*runSyscallExit)(nil)
 }
@@ -247,6 +247,7 @@ func (*runExitMain) execute(t *Task) taskRunState {
 	}
 
 	lastExiter := t.exitThreadGroup()
+	t.procExitEvent()
 
 	t.ResetKcov()
 
@@ -265,8 +266,9 @@ func (*runExitMain) execute(t *Task) taskRunState {
 		}
 	}
 
-	// Handle the robust futex list.
+	// Handle the robust futex list and any PI futexes still owned.
 	t.exitRobustList()
+	t.exitFutexPI()
 
 	// Deactivate the address space and update max RSS before releasing the
 	// task's MM.
@@ -274,6 +276,9 @@ func (*runExitMain) execute(t *Task) taskRunState {
 	t.tg.pidns.owner.mu.Lock()
 	t.updateRSSLocked()
 	t.tg.pidns.owner.mu.Unlock()
+	if lastExiter {
+		t.acctProcess()
+	}
 
 	// Release the task image resources. Accessing these fields must be
 	// done with t.mu held, but the mm.DecUsers() call must be done outside
@@ -89,55 +89,60 @@ func (t *Task) exitRobustList() {
 		return
 	}
 
-	next := primitive.Uint64(rl.List)
-	done := 0
-	var pendingLockAddr hostarch.Addr
-	if rl.ListOpPending != 0 {
-		pendingLockAddr = hostarch.Addr(rl.ListOpPending + rl.FutexOffset)
-	}
+	// Bit 0 of each list pointer signals a PI futex.
+	entry, pi := robustListEntry(rl.List)
+	pending, pendingPI := robustListEntry(rl.ListOpPending)
 
 	// Wake up normal elements.
-	for hostarch.Addr(next) != addr {
-		// We traverse to the next element of the list before we
-		// actually wake anything. This prevents the race where waking
-		// this futex causes a modification of the list.
-		thisLockAddr := hostarch.Addr(uint64(next) + rl.FutexOffset)
-
-		// Try to decode the next element in the list before waking the
-		// current futex. But don't check the error until after we've
-		// woken the current futex. Linux does it in this order too
-		_, nextErr := next.CopyIn(t, hostarch.Addr(next))
-
-		// Wakeup the current futex if it's not pending.
-		if thisLockAddr != pendingLockAddr {
-			t.wakeRobustListOne(thisLockAddr)
-		}
-
-		// If there was an error copying the next futex, we must bail.
-		if nextErr != nil {
-			break
-		}
-
+	for done := 0; entry != addr; done++ {
 		// This is a user structure, so it could be a massive list, or
 		// even contain a loop if they are trying to mess with us. We
 		// cap traversal to prevent that.
-		done++
 		if done >= linux.ROBUST_LIST_LIMIT {
 			break
 		}
+
+		// Fetch the next element in the list before we wake anything. This
+		// prevents the race where waking this futex causes a modification
+		// of the list. But don't check the error until after we've handled
+		// the current futex. Linux does it in this order too.
+		var next primitive.Uint64
+		_, nextErr := next.CopyIn(t, entry)
+
+		// Handle the current futex if it's not pending; the pending entry
+		// is handled below.
+		if entry != pending {
+			t.handleFutexDeath(entry+hostarch.Addr(rl.FutexOffset), pi, false)
+		}
+
+		// If there was an error copying the next futex, we must bail.
+		if nextErr != nil {
+			break
+		}
+		entry, pi = robustListEntry(uint64(next))
 	}
 
-	// Is there a pending entry to wake?
-	if pendingLockAddr != 0 {
-		t.wakeRobustListOne(pendingLockAddr)
+	// Is there a pending entry to handle?
+	if pending != 0 {
+		t.handleFutexDeath(pending+hostarch.Addr(rl.FutexOffset), pendingPI, true)
 	}
 }
 
-// wakeRobustListOne wakes a single futex from the robust list.
-func (t *Task) wakeRobustListOne(addr hostarch.Addr) {
-	// Bit 0 in address signals PI futex.
-	pi := addr&1 == 1
-	addr = addr &^ 1
+// robustListEntry decodes a robust list pointer into the address of the list
+// entry and whether the entry is for a PI futex.
+func robustListEntry(ptr uint64) (hostarch.Addr, bool) {
+	return hostarch.Addr(ptr &^ 1), ptr&1 != 0
+}
+
+// handleFutexDeath releases a single futex from the robust list of an exiting
+// task. It corresponds to Linux's handle_futex_death(). pendingOp is true if
+// addr was obtained from the list_op_pending field, i.e. the task may have
+// been interrupted while acquiring or releasing the futex.
+func (t *Task) handleFutexDeath(addr hostarch.Addr, pi, pendingOp bool) {
+	// Futex addresses must be 32-bit aligned.
+	if addr&3 != 0 {
+		return
+	}
 
 	// Load the futex.
 	f, err := t.LoadUint32(addr)
@@ -147,35 +152,52 @@ func (t *Task) wakeRobustListOne(addr hostarch.Addr) {
 		return
 	}
 
+	// Robust futexes may be shared between processes, so the kernel always
+	// uses shared futex operations on them. Like Linux, this means that
+	// waiters using FUTEX_PRIVATE_FLAG are not woken.
+	const private = false
+
 	tid := uint32(t.ThreadID())
-	for {
-		// Is this held by someone else?
-		if f&linux.FUTEX_TID_MASK != tid {
-			return
+	owner := f & linux.FUTEX_TID_MASK
+	if owner != tid {
+		// The task may have died after releasing a non-PI futex in user mode
+		// but before calling FUTEX_WAKE, or after being woken but before
+		// acquiring it. In both cases, the futex is unowned; wake a waiter
+		// so that it doesn't block forever.
+		if pendingOp && !pi && owner == 0 {
+			t.Futex().Wake(t, addr, private, linux.FUTEX_BITSET_MATCH_ANY, 1)
 		}
+		return
+	}
+
+	if pi {
+		// This thread is dying and it's holding this PI futex. Hand it off
+		// to the next waiter, if any, with the owner died bit set.
+		t.futexHandOffPI(addr, private)
+		return
+	}
 
+	for {
 		// This thread is dying and it's holding this futex. We need to
 		// set the owner died bit and wake up any waiters.
 		newF := (f & linux.FUTEX_WAITERS) | linux.FUTEX_OWNER_DIED
-		if curF, err := t.CompareAndSwapUint32(addr, f, newF); err != nil {
+		curF, err := t.CompareAndSwapUint32(addr, f, newF)
+		if err != nil {
 			return
-		} else if curF != f {
+		}
+		if curF != f {
 			// Futex changed out from under us. Try again...
 			f = curF
-			continue
-		}
-
-		// Wake waiters if there are any.
-		if f&linux.FUTEX_WAITERS != 0 {
-			private := f&linux.FUTEX_PRIVATE_FLAG != 0
-			if pi {
-				t.Futex().UnlockPI(t, addr, tid, private)
+			if f&linux.FUTEX_TID_MASK != tid {
 				return
 			}
-			t.Futex().Wake(t, addr, private, linux.FUTEX_BITSET_MATCH_ANY, 1)
+			continue
 		}
+		break
+	}
 
-		// Done.
-		return
+	// Wake waiters if there are any.
+	if f&linux.FUTEX_WAITERS != 0 {
+		t.Futex().Wake(t, addr, private, linux.FUTEX_BITSET_MATCH_ANY, 1)
 	}
 }
@@ -0,0 +1,413 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/hostarch"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/futex"
+)
+
+// Task priorities, on the same scale as Linux's task_struct::prio. Lower
+// values are higher priority.
+const (
+	// maxRTPrio is Linux's MAX_RT_PRIO. Priorities below maxRTPrio belong to
+	// real-time (SCHED_FIFO and SCHED_RR) tasks.
+	maxRTPrio = 100
+
+	// defaultPrio is Linux's DEFAULT_PRIO, the priority of a non-real-time
+	// task with niceness 0.
+	defaultPrio = maxRTPrio + 20
+
+	// maxPIChainDepth bounds walks of PI futex owner chains, as for Linux's
+	// max_lock_depth.
+	maxPIChainDepth = 1024
+)
+
+// futexPIState tracks the tasks blocked on a PI futex, so that their
+// priority can be inherited by the futex's owner. It corresponds to Linux's
+// struct futex_pi_state, and exists only while the futex has waiters.
+//
+// futexPIState is protected by Kernel.futexPIMu.
+type futexPIState struct {
+	key futex.PIKey
+
+	// owner is the task that owns the futex. owner is nil if the owner is
+	// unknown, e.g. because it has exited without releasing the futex.
+	owner *Task
+
+	// waiters is the set of tasks blocked acquiring the futex.
+	waiters map[*Task]struct{}
+}
+
+// FutexLockPIPrepare attempts to acquire the PI futex at addr, as for
+// FUTEX_LOCK_PI. If the futex is owned by another task, t.FutexWaiter() is
+// enqueued to acquire it and (false, nil) is returned; the caller must then
+// wait for a send to t.FutexWaiter().C and call FutexLockPIComplete. While t
+// is waiting, its priority is inherited by the owner.
+func (t *Task) FutexLockPIPrepare(addr hostarch.Addr, private bool) (bool, error) {
+	k := t.k
+	k.futexPIMu.Lock()
+	defer k.futexPIMu.Unlock()
+
+	w := t.futexWaiter
+	tid := uint32(t.ThreadID())
+	locked, err := t.Futex().LockPI(w, t, addr, tid, t.piWaiterPrio(), private, false)
+	if err != nil || locked {
+		return locked, err
+	}
+
+	key, err := t.Futex().PIKey(t, addr, private)
+	if err != nil {
+		// Unreachable: LockPI succeeded with the same key.
+		t.Futex().WaitCompletePI(w, t)
+		return false, err
+	}
+	owner := t.futexPIOwnerLocked(key, w.PIOwner())
+	if owner != nil && t.futexPIDeadlockLocked(owner) {
+		// The owner may have released the futex to us since LockPI.
+		if acquired, _ := t.Futex().WaitCompletePI(w, t); acquired {
+			return true, nil
+		}
+		return false, linuxerr.EDEADLK
+	}
+	k.futexPIStateLocked(key, owner).addWaiterLocked(t)
+	return false, nil
+}
+
+// FutexLockPIComplete must be called after FutexLockPIPrepare returns (false,
+// nil), once t is no longer waiting to acquire the futex. It returns true if
+// t acquired the futex.
+func (t *Task) FutexLockPIComplete() bool {
+	acquired, _ := t.futexPIComplete()
+	return acquired
+}
+
+// FutexUnlockPI releases the PI futex at addr, as for FUTEX_UNLOCK_PI.
+// Ownership is transferred to the highest priority waiter, if any, along with
+// the priority inherited from any remaining waiters.
+func (t *Task) FutexUnlockPI(addr hostarch.Addr, private bool) error {
+	k := t.k
+	k.futexPIMu.Lock()
+	defer k.futexPIMu.Unlock()
+
+	newOwner, err := t.Futex().UnlockPI(t, addr, uint32(t.ThreadID()), private)
+	if err != nil {
+		return err
+	}
+	t.futexPIReleaseLocked(addr, private, newOwner)
+	return nil
+}
+
+// futexHandOffPI releases the PI futex at addr on behalf of the exiting task
+// t. See futex.Manager.HandOffPI.
+func (t *Task) futexHandOffPI(addr hostarch.Addr, private bool) {
+	k := t.k
+	k.futexPIMu.Lock()
+	defer k.futexPIMu.Unlock()
+
+	newOwner, err := t.Futex().HandOffPI(t, addr, uint32(t.ThreadID()), private)
+	if err != nil {
+		return
+	}
+	t.futexPIReleaseLocked(addr, private, newOwner)
+}
+
+// FutexWaitRequeuePIPrepare enqueues t.FutexWaiter() to wait on the futex at
+// addr, which must contain val, and to be requeued onto the PI futex at
+// naddr, as for FUTEX_WAIT_REQUEUE_PI. If it returns nil, the caller must
+// wait for a send to t.FutexWaiter().C and call FutexWaitRequeuePIComplete.
+func (t *Task) FutexWaitRequeuePIPrepare(addr hostarch.Addr, val uint32, naddr hostarch.Addr, private bool) error {
+	return t.Futex().WaitRequeuePIPrepare(t.futexWaiter, t, addr, val, naddr, uint32(t.ThreadID()), t.piWaiterPrio(), private)
+}
+
+// FutexWaitRequeuePIComplete must be called after FutexWaitRequeuePIPrepare
+// returns nil, once t is no longer waiting. It returns true for acquired if
+// t acquired the PI futex, and true for requeued if t was requeued onto it.
+func (t *Task) FutexWaitRequeuePIComplete() (acquired, requeued bool) {
+	return t.futexPIComplete()
+}
+
+// FutexCmpRequeuePI implements FUTEX_CMP_REQUEUE_PI. See
+// futex.Manager.CmpRequeuePI. Tasks requeued onto the PI futex at naddr
+// begin to lend their priority to its owner.
+func (t *Task) FutexCmpRequeuePI(addr, naddr hostarch.Addr, private bool, val uint32, nreq int) (int, error) {
+	k := t.k
+	// Registering requeued waiters while holding futexPIMu ensures that they
+	// are registered before they can be woken and call futexPIComplete.
+	k.futexPIMu.Lock()
+	defer k.futexPIMu.Unlock()
+
+	res, err := t.Futex().CmpRequeuePI(t, addr, naddr, private, val, nreq)
+	if len(res.Requeued) == 0 {
+		return res.Count, err
+	}
+	key, kerr := t.Futex().PIKey(t, naddr, private)
+	if kerr != nil {
+		// Unreachable: CmpRequeuePI succeeded with the same key.
+		return res.Count, err
+	}
+	st := k.futexPIStateLocked(key, t.futexPIOwnerLocked(key, res.Owner))
+	for _, tid := range res.Requeued {
+		if w := t.tg.pidns.TaskWithID(ThreadID(tid)); w != nil && w.piWaitingOn == nil {
+			st.addWaiterLocked(w)
+		}
+	}
+	if len(st.waiters) == 0 {
+		k.dropFutexPIStateLocked(st)
+	}
+	return res.Count, err
+}
+
+// futexPIComplete dequeues t.FutexWaiter() after a wait on a PI futex, and
+// stops t from lending its priority to the futex's owner.
+func (t *Task) futexPIComplete() (acquired, requeued bool) {
+	acquired, requeued = t.Futex().WaitCompletePI(t.futexWaiter, t)
+
+	k := t.k
+	k.futexPIMu.Lock()
+	if st := t.piWaitingOn; st != nil {
+		st.removeWaiterLocked(t)
+	}
+	k.futexPIMu.Unlock()
+	return acquired, requeued
+}
+
+// exitFutexPI disowns all PI futexes owned by t, which is exiting or
+// execing, as for Linux's exit_pi_state_list(). Futexes on t's robust list
+// have already been handed off to their waiters.
+func (t *Task) exitFutexPI() {
+	k := t.k
+	k.futexPIMu.Lock()
+	defer k.futexPIMu.Unlock()
+
+	for st := range t.piOwned {
+		st.owner = nil
+	}
+	t.piOwned = nil
+	t.piBoost.Store(0)
+}
+
+// futexPIOwnerLocked returns the owner of the PI futex identified by key, or
+// nil if it is unknown. tid is the owner's TID as read from the futex word.
+//
+// Preconditions: t.k.futexPIMu must be locked.
+func (t *Task) futexPIOwnerLocked(key futex.PIKey, tid uint32) *Task {
+	if st := t.k.futexPI[key]; st != nil && st.owner != nil {
+		return st.owner
+	}
+	if tid == 0 {
+		return nil
+	}
+	return t.tg.pidns.TaskWithID(ThreadID(tid))
+}
+
+// futexPIDeadlockLocked returns true if blocking t on a PI futex owned by
+// owner would deadlock, i.e. owner is t or is transitively blocked on a PI
+// futex owned by t.
+//
+// Preconditions: t.k.futexPIMu must be locked.
+func (t *Task) futexPIDeadlockLocked(owner *Task) bool {
+	for depth := 0; owner != nil && depth < maxPIChainDepth; depth++ {
+		if owner == t {
+			return true
+		}
+		st := owner.piWaitingOn
+		if st == nil {
+			return false
+		}
+		owner = st.owner
+	}
+	return false
+}
+
+// futexPIReleaseLocked transfers the state of the PI futex at addr, which t
+// has just released, to newOwner, the TID of its new owner (0 if none).
+//
+// Preconditions: t.k.futexPIMu must be locked.
+func (t *Task) futexPIReleaseLocked(addr hostarch.Addr, private bool, newOwner uint32) {
+	k := t.k
+	key, err := t.Futex().PIKey(t, addr, private)
+	if err != nil {
+		return
+	}
+	st := k.futexPI[key]
+	if st == nil {
+		return
+	}
+
+	oldOwner := st.owner
+	if oldOwner != nil {
+		delete(oldOwner.piOwned, st)
+	}
+	st.owner = nil
+
+	var n *Task
+	if newOwner != 0 {
+		n = t.tg.pidns.TaskWithID(ThreadID(newOwner))
+	}
+	if n != nil && n.piWaitingOn == st {
+		// n is no longer waiting; futexPIComplete will find nothing to do.
+		delete(st.waiters, n)
+		n.piWaitingOn = nil
+	}
+
+	if len(st.waiters) == 0 {
+		delete(k.futexPI, st.key)
+	} else if n != nil {
+		st.owner = n
+		n.addPIOwnedLocked(st)
+	}
+
+	if oldOwner != nil {
+		oldOwner.adjustPIChainLocked()
+	}
+	if n != nil {
+		n.adjustPIChainLocked()
+	}
+}
+
+// futexPIStateLocked returns the state of the PI futex identified by key,
+// creating it with the given owner if it does not exist.
+//
+// Preconditions: k.futexPIMu must be locked.
+func (k *Kernel) futexPIStateLocked(key futex.PIKey, owner *Task) *futexPIState {
+	st := k.futexPI[key]
+	if st == nil {
+		if k.futexPI == nil {
+			k.futexPI = make(map[futex.PIKey]*futexPIState)
+		}
+		st = &futexPIState{
+			key:     key,
+			waiters: make(map[*Task]struct{}),
+		}
+		k.futexPI[key] = st
+	}
+	if st.owner == nil && owner != nil {
+		st.owner = owner
+		owner.addPIOwnedLocked(st)
+	}
+	return st
+}
+
+// dropFutexPIStateLocked forgets st, which has no waiters.
+//
+// Preconditions: k.futexPIMu must be locked.
+func (k *Kernel) dropFutexPIStateLocked(st *futexPIState) {
+	delete(k.futexPI, st.key)
+	if st.owner != nil {
+		delete(st.owner.piOwned, st)
+		st.owner.adjustPIChainLocked()
+	}
+}
+
+// addWaiterLocked records that w is blocked acquiring the PI futex.
+//
+// Preconditions: The futexPIMu of w's Kernel must be locked. w.piWaitingOn ==
+// nil.
+func (st *futexPIState) addWaiterLocked(w *Task) {
+	st.waiters[w] = struct{}{}
+	w.piWaitingOn = st
+	if st.owner != nil {
+		st.owner.adjustPIChainLocked()
+	}
+}
+
+// removeWaiterLocked records that w is no longer blocked acquiring the PI
+// futex.
+//
+// Preconditions: The futexPIMu of w's Kernel must be locked. w.piWaitingOn ==
+// st.
+func (st *futexPIState) removeWaiterLocked(w *Task) {
+	delete(st.waiters, w)
+	w.piWaitingOn = nil
+	if len(st.waiters) == 0 {
+		w.k.dropFutexPIStateLocked(st)
+	} else if st.owner != nil {
+		st.owner.adjustPIChainLocked()
+	}
+}
+
+// addPIOwnedLocked records that t owns st.
+//
+// Preconditions: t.k.futexPIMu must be locked.
+func (t *Task) addPIOwnedLocked(st *futexPIState) {
+	if t.piOwned == nil {
+		t.piOwned = make(map[*futexPIState]struct{})
+	}
+	t.piOwned[st] = struct{}{}
+}
+
+// piWaiterPrio returns t's priority as a waiter on a PI futex. As in Linux
+// (see __waiter_prio()), all non-real-time tasks have equal priority as
+// waiters, and so do not lend their priority to the futex owner.
+func (t *Task) piWaiterPrio() int {
+	if prio := t.effectivePrio(); prio < maxRTPrio {
+		return prio
+	}
+	return defaultPrio
+}
+
+// adjustPIChain is equivalent to adjustPIChainLocked, but acquires
+// t.k.futexPIMu.
+func (t *Task) adjustPIChain() {
+	t.k.futexPIMu.Lock()
+	t.adjustPIChainLocked()
+	t.k.futexPIMu.Unlock()
+}
+
+// adjustPIChainLocked recomputes the priority inherited by t, then propagates
+// any change in t's priority along the chain of PI futex owners that t is
+// blocked on, as for Linux's rt_mutex_adjust_prio_chain().
+//
+// Preconditions: t.k.futexPIMu must be locked.
+func (t *Task) adjustPIChainLocked() {
+	for depth := 0; t != nil && depth < maxPIChainDepth; depth++ {
+		oldPrio := t.effectivePrio()
+		boost := t.computePIBoostLocked()
+		if boost < maxRTPrio {
+			t.piBoost.Store(int32(boost + 1))
+		} else {
+			t.piBoost.Store(0)
+		}
+		// The first task's priority may have changed for reasons other than
+		// inheritance, e.g. setpriority(2), so always propagate it.
+		if depth > 0 && t.effectivePrio() == oldPrio {
+			return
+		}
+		st := t.piWaitingOn
+		if st == nil {
+			return
+		}
+		t.futexWaiter.SetPriority(t.piWaiterPrio())
+		t = st.owner
+	}
+}
+
+// computePIBoostLocked returns the highest priority of the tasks blocked on
+// PI futexes owned by t, or defaultPrio if there are none.
+//
+// Preconditions: t.k.futexPIMu must be locked.
+func (t *Task) computePIBoostLocked() int {
+	boost := defaultPrio
+	for st := range t.piOwned {
+		for w := range st.waiters {
+			if prio := w.piWaiterPrio(); prio < boost {
+				boost = prio
+			}
+		}
+	}
+	return boost
+}
@@ -121,11 +121,15 @@ func (t *Task) MemoryManager() *mm.MemoryManager {
 	return t.image.MemoryManager
 }
 
-// SyscallTable returns t's syscall table.
+// SyscallTable returns t's syscall table, which is the compat syscall table of
+// t's image while t runs 32-bit code.
 //
 // Preconditions: The caller must be running on the task goroutine, or t.mu
 // must be locked.
 func (t *Task) SyscallTable() *SyscallTable {
+	if t.image.st.Compat != nil && t.Arch().Compat() {
+		return t.image.st.Compat
+	}
 	return t.image.st
 }
 
@@ -77,3 +77,17 @@ func (t *Task) NetworkNamespaceByFD(fd int32) (*inet.Namespace, error) {
 	ns.IncRef()
 	return ns, nil
 }
+
+// NetworkNamespaceByPID returns the network namespace of the task with the
+// specified thread ID in the PID namespace of t.
+func (t *Task) NetworkNamespaceByPID(pid int32) (*inet.Namespace, error) {
+	target := t.PIDNamespace().TaskWithID(ThreadID(pid))
+	if target == nil {
+		return nil, linuxerr.ESRCH
+	}
+	ns := target.GetNetworkNamespace()
+	if ns == nil {
+		return nil, linuxerr.ESRCH
+	}
+	return ns, nil
+}
@@ -322,6 +322,11 @@ func (app *runApp) execute(t *Task) taskRunState {
 			}
 		}
 
+		// Is this an access to an emulated I/O port?
+		if t.emulateIOPortAccess(info) {
+			return (*runApp)(nil)
+		}
+
 		switch sig {
 		case linux.SIGILL, linux.SIGSEGV, linux.SIGBUS, linux.SIGFPE, linux.SIGTRAP:
 			// Synchronous signal. Send it to ourselves. Assume the signal is
@@ -267,6 +267,7 @@ func (k *Kernel) runCPUClockTicker() {
 				incTasks[i] = t
 			}
 		}
+		k.loadAvg.sample(k.MonotonicClock().Now().Nanoseconds(), uint64(runningTasks))
 		numIncTasks := min(runningTasks, len(incTasks))
 		// Shuffle incTasks to ensure that if multiple tasks are in the same
 		// thread group, then all are equally likely to be
@@ -413,18 +414,110 @@ func (t *Task) Niceness() int {
 	return t.niceness
 }
 
-// Priority returns t's priority.
+// Priority returns t's priority, as reported by /proc/[pid]/stat. This
+// includes any priority inherited via PI futexes.
 func (t *Task) Priority() int {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-	return t.niceness + 20
+	return t.effectivePrio() - maxRTPrio
 }
 
 // SetNiceness sets t's niceness to n.
 func (t *Task) SetNiceness(n int) {
 	t.mu.Lock()
-	defer t.mu.Unlock()
 	t.niceness = n
+	t.mu.Unlock()
+	t.adjustPIChain()
+}
+
+// SchedPolicy returns t's scheduling policy, real-time priority, and whether
+// SCHED_RESET_ON_FORK is set.
+func (t *Task) SchedPolicy() (policy, rtPriority int32, resetOnFork bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.schedPolicy, t.rtPriority, t.schedResetOnFork
+}
+
+// SetSchedPolicy sets t's scheduling policy and real-time priority.
+//
+// Preconditions: rtPriority is non-zero iff policy is SCHED_FIFO or SCHED_RR.
+func (t *Task) SetSchedPolicy(policy, rtPriority int32, resetOnFork bool) {
+	t.mu.Lock()
+	t.schedPolicy = policy
+	t.rtPriority = rtPriority
+	t.schedResetOnFork = resetOnFork
+	t.mu.Unlock()
+	t.adjustPIChain()
+}
+
+// defaultTimerSlack is the initial timer slack of tasks if timer expirations
+// are not coalesced. This matches Linux.
+const defaultTimerSlack = 50 * time.Microsecond
+
+// initialTimerSlack returns the timer slack of tasks that don't inherit one.
+func (k *Kernel) initialTimerSlack() time.Duration {
+	if k.timerSlack == 0 {
+		return defaultTimerSlack
+	}
+	return k.timerSlack
+}
+
+// TimerSlack returns t's timer slack, as for prctl(PR_GET_TIMERSLACK).
+func (t *Task) TimerSlack() time.Duration {
+	return time.Duration(t.timerSlack.Load())
+}
+
+// SetTimerSlack sets t's timer slack to slack, or to its default timer slack
+// if slack is zero, as for prctl(PR_SET_TIMERSLACK).
+func (t *Task) SetTimerSlack(slack time.Duration) {
+	if slack == 0 {
+		slack = t.defaultTimerSlack
+	}
+	t.timerSlack.Store(int64(slack))
+}
+
+// effectiveTimerSlack returns the time by which the expirations of timers armed
+// by t may be delayed, or zero if timer expirations are not coalesced.
+func (t *Task) effectiveTimerSlack() time.Duration {
+	if t.k.timerSlack == 0 {
+		return 0
+	}
+	return t.TimerSlack()
+}
+
+// forkSchedParams returns the niceness, scheduling policy, and real-time
+// priority inherited by a child of t, as for Linux's sched_fork().
+func (t *Task) forkSchedParams() (niceness int, policy, rtPriority int32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	niceness, policy, rtPriority = t.niceness, t.schedPolicy, t.rtPriority
+	if t.schedResetOnFork {
+		if policy == linux.SCHED_FIFO || policy == linux.SCHED_RR {
+			policy, rtPriority, niceness = linux.SCHED_NORMAL, 0, 0
+		} else if niceness < 0 {
+			niceness = 0
+		}
+	}
+	return niceness, policy, rtPriority
+}
+
+// normalPrio returns t's priority, excluding priority inheritance, on the
+// same scale as Linux's task_struct::normal_prio.
+func (t *Task) normalPrio() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.schedPolicy == linux.SCHED_FIFO || t.schedPolicy == linux.SCHED_RR {
+		return maxRTPrio - 1 - int(t.rtPriority)
+	}
+	return defaultPrio + t.niceness
+}
+
+// effectivePrio returns t's priority, including priority inheritance, on the
+// same scale as Linux's task_struct::prio.
+func (t *Task) effectivePrio() int {
+	prio := t.normalPrio()
+	if boost := int(t.piBoost.Load()); boost != 0 && boost-1 < prio {
+		prio = boost - 1
+	}
+	return prio
 }
 
 // NumaPolicy returns t's current numa policy.
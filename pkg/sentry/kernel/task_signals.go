@@ -313,8 +313,10 @@ func (t *Task) SignalReturn(rt bool) (*SyscallControl, error) {
 	// Attempt to record the given signal stack. Note that we silently
 	// ignore failures here, as does Linux. Only an EFAULT may be
 	// generated, but SignalRestore has already deserialized the entire
-	// frame successfully.
-	t.SetSignalStack(alt)
+	// frame successfully. Non-RT signal frames don't hold a signal stack.
+	if rt {
+		t.SetSignalStack(alt)
+	}
 
 	// Restore our signal mask. SIGKILL and SIGSTOP should not be blocked.
 	t.SetSignalMask(sigset &^ UnblockableSignals)
@@ -16,6 +16,7 @@ package kernel
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/wilinz/gvisor/pkg/abi/linux"
 	"github.com/wilinz/gvisor/pkg/atomicbitops"
@@ -69,6 +70,15 @@ type TaskConfig struct {
 	// Niceness is the niceness of the new task.
 	Niceness int
 
+	// SchedPolicy and RTPriority are the scheduling policy and real-time
+	// priority of the new task.
+	SchedPolicy int32
+	RTPriority  int32
+
+	// TimerSlack is the timer slack of the new task. If it is zero, the
+	// Kernel's initial timer slack is used.
+	TimerSlack time.Duration
+
 	// NetworkNamespace is the network namespace to be used for the new task.
 	NetworkNamespace *inet.Namespace
 
@@ -97,6 +107,12 @@ type TaskConfig struct {
 	// InitialCgroups are the cgroups the container is initialised to.
 	InitialCgroups map[Cgroup]struct{}
 
+	// TIDs, if not empty, contains the thread IDs requested for the new task,
+	// starting with its thread ID in its own PID namespace and continuing
+	// with its thread IDs in ancestor PID namespaces. Thread IDs in PID
+	// namespaces beyond the end of TIDs are allocated as usual.
+	TIDs []ThreadID
+
 	// UserCounters is user resource counters.
 	UserCounters *UserCounters
 
@@ -163,6 +179,8 @@ func (ts *TaskSet) newTask(ctx context.Context, cfg *TaskConfig) (*Task, error)
 		allowedCPUMask:  cfg.AllowedCPUMask.Copy(),
 		ioUsage:         &usage.IO{},
 		niceness:        cfg.Niceness,
+		schedPolicy:     cfg.SchedPolicy,
+		rtPriority:      cfg.RTPriority,
 		utsns:           cfg.UTSNamespace,
 		ipcns:           cfg.IPCNamespace,
 		mountNamespace:  cfg.MountNamespace,
@@ -177,6 +195,11 @@ func (ts *TaskSet) newTask(ctx context.Context, cfg *TaskConfig) (*Task, error)
 		Origin:          cfg.Origin,
 		onDestroyAction: make(map[TaskDestroyAction]struct{}),
 	}
+	t.defaultTimerSlack = cfg.TimerSlack
+	if t.defaultTimerSlack == 0 {
+		t.defaultTimerSlack = t.k.initialTimerSlack()
+	}
+	t.timerSlack.Store(int64(t.defaultTimerSlack))
 	t.netns = cfg.NetworkNamespace
 	t.creds.Store(cfg.Credentials)
 	t.endStopCond.L = &t.tg.signalHandlers.mu
@@ -197,7 +220,14 @@ func (ts *TaskSet) newTask(ctx context.Context, cfg *TaskConfig) (*Task, error)
 	// bypasses pid limits.
 	if srcT != nil {
 		var err error
-		if charged, cg, err = srcT.ChargeFor(t, CgroupControllerPIDs, CgroupResourcePID, 1); err != nil {
+		if cfg.InitialCgroups != nil {
+			// The new task won't enter srcT's cgroups; charge the ones it
+			// will enter instead.
+			charged, cg, err = chargeCgroupsFor(cfg.InitialCgroups, t, CgroupControllerPIDs, CgroupResourcePID, 1)
+		} else {
+			charged, cg, err = srcT.ChargeFor(t, CgroupControllerPIDs, CgroupResourcePID, 1)
+		}
+		if err != nil {
 			return nil, err
 		}
 		if charged {
@@ -244,7 +274,7 @@ func (ts *TaskSet) newTask(ctx context.Context, cfg *TaskConfig) (*Task, error)
 		// explanatory.
 		return nil, fmt.Errorf("task creation disabled after Kernel.WaitExited() may have returned")
 	}
-	if err := ts.assignTIDsLocked(t); err != nil {
+	if err := ts.assignTIDsLocked(t, cfg.TIDs); err != nil {
 		return nil, err
 	}
 	// Below this point, newTask is expected not to fail (there is no rollback
@@ -312,10 +342,12 @@ func (ts *TaskSet) newTask(ctx context.Context, cfg *TaskConfig) (*Task, error)
 }
 
 // assignTIDsLocked ensures that new task t is visible in all PID namespaces in
-// which it should be visible.
+// which it should be visible. If requested is not empty, it contains the
+// thread IDs that t must be given, starting with t's own PID namespace; see
+// TaskConfig.TIDs.
 //
 // Preconditions: ts.mu must be locked for writing.
-func (ts *TaskSet) assignTIDsLocked(t *Task) error {
+func (ts *TaskSet) assignTIDsLocked(t *Task, requested []ThreadID) error {
 	type allocatedTID struct {
 		ns  *PIDNamespace
 		tid ThreadID
@@ -324,7 +356,13 @@ func (ts *TaskSet) assignTIDsLocked(t *Task) error {
 	var tid ThreadID
 	var err error
 	for ns := t.tg.pidns; ns != nil; ns = ns.parent {
-		if tid, err = ns.allocateTID(); err != nil {
+		if len(requested) != 0 {
+			tid, err = ns.allocateSpecificTID(requested[0])
+			requested = requested[1:]
+		} else {
+			tid, err = ns.allocateTID()
+		}
+		if err != nil {
 			break
 		}
 		if err = ns.addTask(t, tid); err != nil {
@@ -390,6 +428,31 @@ func (ns *PIDNamespace) allocateTID() (ThreadID, error) {
 	}
 }
 
+// allocateSpecificTID returns tid if it is unused in ns.
+//
+// Preconditions: ns.owner.mu must be locked for writing.
+func (ns *PIDNamespace) allocateSpecificTID(tid ThreadID) (ThreadID, error) {
+	if ns.exiting {
+		// See allocateTID.
+		return 0, linuxerr.ENOMEM
+	}
+	// The first task in a PID namespace must be its init process. See Linux
+	// kernel/pid.c:alloc_pid().
+	if tid != initTID && len(ns.tasks) == 0 {
+		return 0, linuxerr.EINVAL
+	}
+	if _, ok := ns.tasks[tid]; ok {
+		return 0, linuxerr.EEXIST
+	}
+	if _, ok := ns.processGroups[ProcessGroupID(tid)]; ok {
+		return 0, linuxerr.EEXIST
+	}
+	if _, ok := ns.sessions[SessionID(tid)]; ok {
+		return 0, linuxerr.EEXIST
+	}
+	return tid, nil
+}
+
 // Start starts the task goroutine. Start must be called exactly once for each
 // task returned by NewTask.
 //
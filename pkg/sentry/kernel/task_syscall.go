@@ -81,6 +81,16 @@ func (t *Task) invokeExternal() {
 	}()
 }
 
+// denySyscall is called instead of syscalls denied by SyscallTable.Restrict.
+// The first attempt to make each denied syscall is logged.
+func (t *Task) denySyscall(sysno uintptr) error {
+	s := t.SyscallTable()
+	if s.denied[sysno].Add(1) == 1 {
+		t.Warningf("Syscall %s (%d) denied by the syscall profile", s.LookupName(sysno), sysno)
+	}
+	return linuxerr.EPERM
+}
+
 func (t *Task) executeSyscall(sysno uintptr, args arch.SyscallArguments) (rval uintptr, ctrl *SyscallControl, err error) {
 	s := t.SyscallTable()
 
@@ -128,7 +138,9 @@ func (t *Task) executeSyscall(sysno uintptr, args arch.SyscallArguments) (rval u
 		})
 	}
 
-	if bits.IsOn32(fe, ExternalBeforeEnable) && (s.ExternalFilterBefore == nil || s.ExternalFilterBefore(t, sysno, args)) {
+	if bits.IsOn32(fe, SyscallProfileDeny) {
+		err = t.denySyscall(sysno)
+	} else if bits.IsOn32(fe, ExternalBeforeEnable) && (s.ExternalFilterBefore == nil || s.ExternalFilterBefore(t, sysno, args)) {
 		t.invokeExternal()
 		// Ensure we check for stops, then invoke the syscall again.
 		ctrl = ctrlStopAndReinvokeSyscall
@@ -138,6 +150,10 @@ func (t *Task) executeSyscall(sysno uintptr, args arch.SyscallArguments) (rval u
 		if trace.IsEnabled() {
 			region = trace.StartRegion(t.traceContext, s.LookupName(sysno))
 		}
+		var startNs int64
+		if syscallLatency != nil {
+			startNs = metric.CheapNowNano()
+		}
 		if fn != nil {
 			// Call our syscall implementation.
 			rval, ctrl, err = fn(t, sysno, args)
@@ -145,6 +161,9 @@ func (t *Task) executeSyscall(sysno uintptr, args arch.SyscallArguments) (rval u
 			// Use the missing function if not found.
 			rval, err = t.SyscallTable().Missing(t, sysno, args)
 		}
+		if syscallLatency != nil {
+			recordSyscallLatency(sysno, startNs)
+		}
 		if region != nil {
 			region.End()
 		}
@@ -203,6 +222,10 @@ func (t *Task) executeSyscall(sysno uintptr, args arch.SyscallArguments) (rval u
 		})
 	}
 
+	if t.k.audit.SyscallActive() {
+		t.auditSyscall(sysno, args, rval, err)
+	}
+
 	return
 }
 
@@ -227,6 +250,14 @@ func (t *Task) doSyscall() taskRunState {
 	sysno := t.Arch().SyscallNo()
 	args := t.Arch().SyscallArgs()
 
+	// Check Syscall User Dispatch before the registers are modified, so that
+	// dispatched syscalls can be emulated from the signal handler.
+	if t.syscallUserDispatch.enabled {
+		if next := t.checkSyscallUserDispatch(sysno, hostarch.Addr(t.Arch().IP())); next != nil {
+			return next
+		}
+	}
+
 	// Tracers expect to see this between when the task traps into the kernel
 	// to perform a syscall and when the syscall is actually invoked.
 	// This useless-looking temporary is needed because Go.
@@ -28,6 +28,10 @@ import (
 
 const iovecLength = 16
 
+// iovecLength32 is the size of a struct compat_iovec, used by 32-bit
+// compatibility mode tasks.
+const iovecLength32 = 8
+
 // MAX_RW_COUNT is the maximum size in bytes of a single read or write.
 // Reads and writes that exceed this size may be silently truncated.
 // (Linux: include/linux/fs.h:MAX_RW_COUNT)
@@ -131,25 +135,28 @@ func (t *Task) CopyInVector(addr hostarch.Addr, maxElemSize, maxTotalSize int) (
 //   - The caller must be running on the task goroutine.
 //   - t's AddressSpace must be active.
 func (t *Task) CopyOutIovecs(addr hostarch.Addr, src hostarch.AddrRangeSeq) error {
-	switch t.Arch().Width() {
-	case 8:
-		if _, ok := addr.AddLength(uint64(src.NumRanges()) * iovecLength); !ok {
-			return linuxerr.EFAULT
-		}
+	size, err := iovecSize(t)
+	if err != nil {
+		return err
+	}
+	if _, ok := addr.AddLength(uint64(src.NumRanges()) * uint64(size)); !ok {
+		return linuxerr.EFAULT
+	}
 
-		b := t.CopyScratchBuffer(iovecLength)
-		for ; !src.IsEmpty(); src = src.Tail() {
-			ar := src.Head()
+	b := t.CopyScratchBuffer(size)
+	for ; !src.IsEmpty(); src = src.Tail() {
+		ar := src.Head()
+		if size == iovecLength32 {
+			hostarch.ByteOrder.PutUint32(b[0:4], uint32(ar.Start))
+			hostarch.ByteOrder.PutUint32(b[4:8], uint32(ar.Length()))
+		} else {
 			hostarch.ByteOrder.PutUint64(b[0:8], uint64(ar.Start))
 			hostarch.ByteOrder.PutUint64(b[8:16], uint64(ar.Length()))
-			if _, err := t.CopyOutBytes(addr, b); err != nil {
-				return err
-			}
-			addr += iovecLength
 		}
-
-	default:
-		return linuxerr.ENOSYS
+		if _, err := t.CopyOutBytes(addr, b); err != nil {
+			return err
+		}
+		addr += hostarch.Addr(size)
 	}
 
 	return nil
@@ -182,10 +189,11 @@ func (t *Task) CopyInIovecsAsSlice(addr hostarch.Addr, numIovecs int) ([]hostarc
 }
 
 func copyInIovec(ctx marshal.CopyContext, t *Task, addr hostarch.Addr) (hostarch.AddrRangeSeq, error) {
-	if err := checkArch(t); err != nil {
+	size, err := iovecSize(t)
+	if err != nil {
 		return hostarch.AddrRangeSeq{}, err
 	}
-	b := ctx.CopyScratchBuffer(iovecLength)
+	b := ctx.CopyScratchBuffer(size)
 	ar, err := makeIovec(ctx, t, addr, b)
 	if err != nil {
 		return hostarch.AddrRangeSeq{}, err
@@ -213,7 +221,8 @@ func copyInIovec(ctx marshal.CopyContext, t *Task, addr hostarch.Addr) (hostarch
 //     combined length of all AddrRanges would otherwise exceed this amount, ranges
 //     beyond MAX_RW_COUNT are silently truncated.
 func copyInIovecs(ctx marshal.CopyContext, t *Task, addr hostarch.Addr, numIovecs int) ([]hostarch.AddrRange, error) {
-	if err := checkArch(t); err != nil {
+	size, err := iovecSize(t)
+	if err != nil {
 		return nil, err
 	}
 	if numIovecs == 0 {
@@ -225,11 +234,11 @@ func copyInIovecs(ctx marshal.CopyContext, t *Task, addr hostarch.Addr, numIovec
 		dst = make([]hostarch.AddrRange, 0, numIovecs)
 	}
 
-	if _, ok := addr.AddLength(uint64(numIovecs) * iovecLength); !ok {
+	if _, ok := addr.AddLength(uint64(numIovecs) * uint64(size)); !ok {
 		return nil, linuxerr.EFAULT
 	}
 
-	b := ctx.CopyScratchBuffer(iovecLength)
+	b := ctx.CopyScratchBuffer(size)
 	for i := 0; i < numIovecs; i++ {
 		ar, err := makeIovec(ctx, t, addr, b)
 		if err != nil {
@@ -237,7 +246,7 @@ func copyInIovecs(ctx marshal.CopyContext, t *Task, addr hostarch.Addr, numIovec
 		}
 		dst = append(dst, ar)
 
-		addr += iovecLength
+		addr += hostarch.Addr(size)
 	}
 	// Truncate to MAX_RW_COUNT.
 	var total uint64
@@ -253,11 +262,16 @@ func copyInIovecs(ctx marshal.CopyContext, t *Task, addr hostarch.Addr, numIovec
 	return dst, nil
 }
 
-func checkArch(t *Task) error {
-	if t.Arch().Width() != 8 {
-		return linuxerr.ENOSYS
+// iovecSize returns the size of a struct iovec for t.
+func iovecSize(t *Task) (int, error) {
+	switch t.Arch().Width() {
+	case 8:
+		return iovecLength, nil
+	case 4:
+		return iovecLength32, nil
+	default:
+		return 0, linuxerr.ENOSYS
 	}
-	return nil
 }
 
 func makeIovec(ctx marshal.CopyContext, t *Task, addr hostarch.Addr, b []byte) (hostarch.AddrRange, error) {
@@ -265,8 +279,21 @@ func makeIovec(ctx marshal.CopyContext, t *Task, addr hostarch.Addr, b []byte) (
 		return hostarch.AddrRange{}, err
 	}
 
-	base := hostarch.Addr(hostarch.ByteOrder.Uint64(b[0:8]))
-	length := hostarch.ByteOrder.Uint64(b[8:16])
+	var (
+		base   hostarch.Addr
+		length uint64
+	)
+	if len(b) == iovecLength32 {
+		base = hostarch.Addr(hostarch.ByteOrder.Uint32(b[0:4]))
+		// compat_ssize_t is signed, so lengths are limited to MaxInt32.
+		length = uint64(hostarch.ByteOrder.Uint32(b[4:8]))
+		if length > math.MaxInt32 {
+			return hostarch.AddrRange{}, linuxerr.EINVAL
+		}
+	} else {
+		base = hostarch.Addr(hostarch.ByteOrder.Uint64(b[0:8]))
+		length = hostarch.ByteOrder.Uint64(b[8:16])
+	}
 	if length > math.MaxInt64 {
 		return hostarch.AddrRange{}, linuxerr.EINVAL
 	}
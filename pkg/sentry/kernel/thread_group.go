@@ -605,24 +605,30 @@ func (tg *ThreadGroup) SetForegroundProcessGroupID(tty *TTY, pgid ProcessGroupID
 	return nil
 }
 
-// SetChildSubreaper marks this ThreadGroup sets the isChildSubreaper field on
-// this ThreadGroup, and marks all child ThreadGroups as having a subreaper.
-// Recursion stops if we find another subreaper process, which is either a
-// ThreadGroup with isChildSubreaper bit set, or a ThreadGroup with PID=1
-// inside a PID namespace.
+// SetChildSubreaper sets the isChildSubreaper field on this ThreadGroup, and
+// if it is set, marks all descendant ThreadGroups as having a subreaper.
+// Recursion stops at descendants which are already marked, and at ThreadGroups
+// with PID=1 inside a PID namespace.
+//
+// hasChildSubreaper is never cleared, since another ancestor may still be a
+// subreaper; findReparentTargetLocked checks isChildSubreaper on the way up.
+// This is consistent with Linux's PR_SET_CHILD_SUBREAPER.
 func (tg *ThreadGroup) SetChildSubreaper(isSubreaper bool) {
 	ts := tg.TaskSet()
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
 	tg.isChildSubreaper = isSubreaper
+	if !isSubreaper {
+		return
+	}
 	tg.walkDescendantThreadGroupsLocked(func(child *ThreadGroup) bool {
-		// Is this child PID 1 in its PID namespace, or already a
-		// subreaper?
-		if child.isInitInLocked(child.PIDNamespace()) || child.isChildSubreaper {
-			// Don't set hasChildSubreaper, and don't recurse.
+		// Is this child PID 1 in its PID namespace, or already marked?
+		// Descendants of a marked ThreadGroup are marked as well.
+		if child.isInitInLocked(child.PIDNamespace()) || child.hasChildSubreaper {
+			// Don't recurse.
 			return false
 		}
-		child.hasChildSubreaper = isSubreaper
+		child.hasChildSubreaper = true
 		return true // Recurse.
 	})
 }
@@ -205,6 +205,9 @@ type PIDNamespace struct {
 	// exited.
 	exiting bool
 
+	// acct is the process accounting state of the namespace.
+	acct processAccounting
+
 	// pidNamespaceData contains additional per-PID-namespace data.
 	extra pidNamespaceData
 }
@@ -319,6 +322,13 @@ func (ns *PIDNamespace) NumTasks() int {
 	return len(ns.tids)
 }
 
+// LastID returns the last thread ID allocated in ns.
+func (ns *PIDNamespace) LastID() ThreadID {
+	ns.owner.mu.RLock()
+	defer ns.owner.mu.RUnlock()
+	return ns.last
+}
+
 // NumTasksPerContainer returns the number of tasks in ns that belongs to given container.
 func (ns *PIDNamespace) NumTasksPerContainer(cid string) int {
 	ns.owner.mu.RLock()
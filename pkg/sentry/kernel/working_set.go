@@ -0,0 +1,171 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"time"
+
+	"github.com/wilinz/gvisor/pkg/atomicbitops"
+	"github.com/wilinz/gvisor/pkg/metric"
+	"github.com/wilinz/gvisor/pkg/sentry/mm"
+	"github.com/wilinz/gvisor/pkg/sync"
+)
+
+var workingSetSamples = metric.MustCreateNewUint64Metric("/memory/working_set_samples", metric.Uint64Metadata{
+	Cumulative:  true,
+	Description: "Number of working set samples taken since startup.",
+})
+
+// lastWorkingSet is the total working set in bytes as of the most recent
+// sample, exported by the /memory/working_set_bytes metric.
+var lastWorkingSet atomicbitops.Uint64
+
+func init() {
+	metric.MustRegisterCustomUint64Metric("/memory/working_set_bytes", metric.Uint64Metadata{
+		Description: "Total bytes of application memory accessed during the most recent working set sampling interval.",
+	}, func(...*metric.FieldValue) uint64 {
+		return lastWorkingSet.Load()
+	})
+}
+
+// WorkingSetSampler periodically estimates the working set of each container
+// by sampling the MemoryManagers of all thread groups in a Kernel. See
+// mm.MemoryManager.SampleWorkingSet.
+type WorkingSetSampler struct {
+	k *Kernel
+
+	// period is the length of each sampling interval.
+	period time.Duration
+
+	// Closing stop indicates that the sampler goroutine should exit.
+	stop chan struct{}
+
+	// done is used to wait for the sampler goroutine to exit.
+	done sync.WaitGroup
+
+	// mu protects the following fields.
+	mu sync.Mutex
+
+	// containers maps container IDs to the working set in bytes of all
+	// MemoryManagers used by thread groups in the container, as of the most
+	// recent sample.
+	containers map[string]uint64
+
+	// sampled is true if any MemoryManager has been successfully sampled,
+	// indicating that the platform supports access tracking.
+	sampled bool
+}
+
+// StartWorkingSetSampler starts sampling working sets with the given period.
+// It must be called at most once, and has no effect if period is 0.
+func (k *Kernel) StartWorkingSetSampler(period time.Duration) {
+	if period == 0 {
+		return
+	}
+	s := &WorkingSetSampler{
+		k:          k,
+		period:     period,
+		stop:       make(chan struct{}),
+		containers: make(map[string]uint64),
+	}
+	k.workingSetSampler = s
+	s.done.Add(1)
+	go s.run() // S/R-SAFE: samples are not saved.
+}
+
+// WorkingSetSampler returns k's WorkingSetSampler, or nil if working set
+// sampling is disabled.
+func (k *Kernel) WorkingSetSampler() *WorkingSetSampler {
+	return k.workingSetSampler
+}
+
+// Stop stops the sampler goroutine. Stop may only be called once.
+func (s *WorkingSetSampler) Stop() {
+	close(s.stop)
+	s.done.Wait()
+}
+
+func (s *WorkingSetSampler) run() {
+	defer s.done.Done()
+
+	ticker := time.NewTicker(s.period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.sample()
+		}
+	}
+}
+
+// sample samples the working sets of all MemoryManagers.
+func (s *WorkingSetSampler) sample() {
+	ctx := s.k.SupervisorContext()
+	containers := make(map[string]uint64)
+	sampled := make(map[*mm.MemoryManager]struct{})
+	var total uint64
+	anySampled := false
+	for _, tg := range s.k.RootPIDNamespace().ThreadGroups() {
+		leader := tg.Leader()
+		if leader == nil {
+			continue
+		}
+		var m *mm.MemoryManager
+		leader.WithMuLocked(func(t *Task) {
+			m = t.MemoryManager()
+		})
+		if m == nil || !m.IncUsers() {
+			continue
+		}
+		// Thread groups created by clone(CLONE_VM) without CLONE_THREAD
+		// share MemoryManagers, which should only be counted once.
+		if _, ok := sampled[m]; !ok {
+			sampled[m] = struct{}{}
+			if ws, ok := m.SampleWorkingSet(); ok {
+				containers[leader.ContainerID()] += ws
+				total += ws
+				anySampled = true
+			}
+		}
+		m.DecUsers(ctx)
+	}
+
+	if !anySampled {
+		return
+	}
+	workingSetSamples.Increment()
+	lastWorkingSet.Store(total)
+	s.mu.Lock()
+	s.containers = containers
+	s.sampled = true
+	s.mu.Unlock()
+}
+
+// ContainerWorkingSet returns the estimated working set in bytes of the
+// container with the given ID, as of the most recent sample. It returns false
+// if the working set is unknown, either because the platform does not support
+// access tracking or because the container has not been sampled.
+func (s *WorkingSetSampler) ContainerWorkingSet(cid string) (uint64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.sampled {
+		return 0, false
+	}
+	ws, ok := s.containers[cid]
+	return ws, ok
+}
@@ -15,6 +15,8 @@
 package ktime
 
 import (
+	"time"
+
 	"github.com/wilinz/gvisor/pkg/context"
 )
 
@@ -24,6 +26,10 @@ type contextID int
 const (
 	// CtxRealtimeClock is a Context.Value key for the current real time.
 	CtxRealtimeClock contextID = iota
+
+	// CtxTimerSlack is a Context.Value key for the slack of timers armed on
+	// behalf of the context.
+	CtxTimerSlack
 )
 
 // RealtimeClockFromContext returns the real time clock associated with context
@@ -35,6 +41,16 @@ func RealtimeClockFromContext(ctx context.Context) Clock {
 	return nil
 }
 
+// TimerSlackFromContext returns the time by which the expirations of timers
+// armed on behalf of ctx may be delayed, so that they are coalesced with other
+// timers. It returns zero if expirations may not be delayed.
+func TimerSlackFromContext(ctx context.Context) time.Duration {
+	if v := ctx.Value(CtxTimerSlack); v != nil {
+		return v.(time.Duration)
+	}
+	return 0
+}
+
 // NowFromContext returns the current real time associated with context ctx.
 func NowFromContext(ctx context.Context) Time {
 	if clk := RealtimeClockFromContext(ctx); clk != nil {
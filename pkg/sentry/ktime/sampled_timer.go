@@ -42,6 +42,10 @@ type SampledTimer struct {
 
 	pauseState timerPauseState
 
+	// slack is the time by which checking for expirations may be delayed, so
+	// that the wakeups of timers are coalesced. slack is protected by mu.
+	slack time.Duration
+
 	// kicker is used to wake the SampledTimer goroutine. The kicker pointer is
 	// immutable, but its state is protected by mu.
 	kicker *time.Timer `state:"nosave"`
@@ -211,6 +215,16 @@ func (t *SampledTimer) Set(s Setting, f func()) (Time, Setting) {
 	return now, oldS
 }
 
+// SetSlack sets the time by which the SampledTimer may delay checking for
+// expirations, so that its wakeups are coalesced with those of other timers
+// with the same slack. Expirations are still counted from the Setting, so that
+// only their notification is delayed.
+func (t *SampledTimer) SetSlack(slack time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.slack = slack
+}
+
 // SetClock atomically changes a SampledTimer's Clock and Setting.
 func (t *SampledTimer) SetClock(c SampledClock, s Setting) {
 	var now Time
@@ -272,7 +286,11 @@ func (t *SampledTimer) resetKickerLocked(now Time) {
 	if t.setting.Enabled {
 		// Clock.WallTimeUntil may return a negative value. This is fine;
 		// time.when treats negative Durations as 0.
-		t.kicker.Reset(t.clock.WallTimeUntil(t.setting.Next, now))
+		d := t.clock.WallTimeUntil(t.setting.Next, now)
+		if t.slack > 0 {
+			d = coalesceWakeup(time.Since(coalesceEpoch), d, t.slack)
+		}
+		t.kicker.Reset(d)
 	}
 	// We don't call t.kicker.Stop if !t.setting.Enabled because in most cases
 	// resetKickerLocked will be called from the SampledTimer goroutine, in
@@ -281,6 +299,24 @@ func (t *SampledTimer) resetKickerLocked(now Time) {
 	// => runtime.deltimer).
 }
 
+// coalesceEpoch is the reference time to which coalesced wakeups are aligned.
+var coalesceEpoch = time.Now()
+
+// coalesceWakeup returns the wall time until a wakeup due in d should occur,
+// given that the time elapsed since coalesceEpoch is elapsed. The wakeup is
+// delayed by less than slack, to the next multiple of slack since
+// coalesceEpoch, such that wakeups with the same slack that are due within
+// the same window occur together.
+func coalesceWakeup(elapsed, d, slack time.Duration) time.Duration {
+	if d < 0 {
+		d = 0
+	}
+	if rem := (elapsed + d) % slack; rem != 0 {
+		d += slack - rem
+	}
+	return d
+}
+
 // A SampledClock is a Clock that can be a time source for a SampledTimer.
 type SampledClock interface {
 	Clock
@@ -0,0 +1,67 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ktime
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCoalesceWakeup(t *testing.T) {
+	const slack = 50 * time.Microsecond
+	for _, test := range []struct {
+		name    string
+		elapsed time.Duration
+		d       time.Duration
+		want    time.Duration
+	}{
+		{
+			name:    "aligned",
+			elapsed: 100 * time.Microsecond,
+			d:       50 * time.Microsecond,
+			want:    50 * time.Microsecond,
+		},
+		{
+			name:    "delayed to the next multiple of slack",
+			elapsed: 100 * time.Microsecond,
+			d:       10 * time.Microsecond,
+			want:    50 * time.Microsecond,
+		},
+		{
+			name:    "unaligned elapsed",
+			elapsed: 130 * time.Microsecond,
+			d:       25 * time.Microsecond,
+			want:    70 * time.Microsecond,
+		},
+		{
+			name:    "past due",
+			elapsed: 130 * time.Microsecond,
+			d:       -10 * time.Microsecond,
+			want:    20 * time.Microsecond,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := coalesceWakeup(test.elapsed, test.d, slack); got != test.want {
+				t.Errorf("coalesceWakeup(%v, %v, %v) = %v, want %v", test.elapsed, test.d, slack, got, test.want)
+			}
+		})
+	}
+
+	// Wakeups due within the same window occur together.
+	const elapsed = 1234 * time.Microsecond
+	if a, b := elapsed+coalesceWakeup(elapsed, 3*time.Microsecond, slack), elapsed+coalesceWakeup(elapsed, 12*time.Microsecond, slack); a != b {
+		t.Errorf("wakeups due at %v and %v were not coalesced: got %v and %v", elapsed+3*time.Microsecond, elapsed+12*time.Microsecond, a, b)
+	}
+}
@@ -22,6 +22,7 @@ import (
 
 	"github.com/wilinz/gvisor/pkg/abi"
 	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/bits"
 	"github.com/wilinz/gvisor/pkg/context"
 	"github.com/wilinz/gvisor/pkg/cpuid"
 	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
@@ -40,8 +41,19 @@ const (
 	elfMagic = "\x7fELF"
 
 	// maxTotalPhdrSize is the maximum combined size of all program
-	// headers.  Linux limits this to one page.
-	maxTotalPhdrSize = hostarch.PageSize
+	// headers. This matches the hard limit in Linux's
+	// fs/binfmt_elf.c:load_elf_phdrs(); modern linkers can emit more
+	// program headers than fit in a single page.
+	maxTotalPhdrSize = 64 << 10
+
+	// maxLoadAlign is the maximum PT_LOAD alignment honored when choosing
+	// the load address of a shared object. Larger alignments would require
+	// reserving an unreasonable amount of address space.
+	maxLoadAlign = 1 << 30
+
+	// pnXNum is the value of e_phnum indicating extended program header
+	// numbering, where the real count is in the first section header.
+	pnXNum = 0xffff
 )
 
 var (
@@ -50,6 +62,12 @@ var (
 
 	// Prog64Size is the size of elf.Prog64.
 	prog64Size = (*linux.ElfProg64)(nil).SizeBytes()
+
+	// header32Size is the size of elf.Header32.
+	header32Size = (*linux.ElfHeader32)(nil).SizeBytes()
+
+	// prog32Size is the size of elf.Prog32.
+	prog32Size = (*linux.ElfProg32)(nil).SizeBytes()
 )
 
 func progFlagsAsPerms(f elf.ProgFlag) hostarch.AccessType {
@@ -74,6 +92,10 @@ type elfInfo struct {
 	// arch is the target architecture of the ELF.
 	arch arch.Arch
 
+	// compat is true if the ELF is a 32-bit binary that runs in the 32-bit
+	// compatibility mode of arch.
+	compat bool
+
 	// entry is the program entry point.
 	entry hostarch.Addr
 
@@ -99,7 +121,10 @@ type fullReader interface {
 // file and returning the ELF program headers.
 //
 // This is similar to elf.NewFile, except that it is more strict about what it
-// accepts from the ELF, and it doesn't parse unnecessary parts of the file.
+// accepts from the ELF, and it doesn't parse unnecessary parts of the file. In
+// particular, section headers are never read, so section contents such as
+// relocation formats (e.g. SHT_RELR) or compressed debug sections don't
+// affect loading.
 func parseHeader(ctx context.Context, f fullReader) (elfInfo, error) {
 	// Check ident first; it will tell us the endianness of the rest of the
 	// structs.
@@ -120,11 +145,14 @@ func parseHeader(ctx context.Context, f fullReader) (elfInfo, error) {
 		return elfInfo{}, linuxerr.ENOEXEC
 	}
 
-	// We only support 64-bit, little endian binaries
-	if class := elf.Class(ident[elf.EI_CLASS]); class != elf.ELFCLASS64 {
+	// We only support 64-bit, little endian binaries, and 32-bit ones that
+	// can run in the compatibility mode of a 64-bit architecture.
+	class := elf.Class(ident[elf.EI_CLASS])
+	if class != elf.ELFCLASS64 && class != elf.ELFCLASS32 {
 		log.Infof("Unsupported ELF class: %v", class)
 		return elfInfo{}, linuxerr.ENOEXEC
 	}
+	compat := class == elf.ELFCLASS32
 	if endian := elf.Data(ident[elf.EI_DATA]); endian != elf.ELFDATA2LSB {
 		log.Infof("Unsupported ELF endianness: %v", endian)
 		return elfInfo{}, linuxerr.ENOEXEC
@@ -137,8 +165,12 @@ func parseHeader(ctx context.Context, f fullReader) (elfInfo, error) {
 	// EI_OSABI is ignored by Linux, which is the only OS supported.
 	os := abi.Linux
 
+	hdrSize, progSize := header64Size, prog64Size
+	if compat {
+		hdrSize, progSize = header32Size, prog32Size
+	}
 	var hdr linux.ElfHeader64
-	hdrBuf := make([]byte, header64Size)
+	hdrBuf := make([]byte, hdrSize)
 	_, err = f.ReadFull(ctx, usermem.BytesIOSequence(hdrBuf), 0)
 	if err != nil {
 		log.Infof("Error reading ELF header: %v", err)
@@ -148,17 +180,42 @@ func parseHeader(ctx context.Context, f fullReader) (elfInfo, error) {
 		}
 		return elfInfo{}, err
 	}
-	hdr.UnmarshalUnsafe(hdrBuf)
+	if compat {
+		// Widen the ELF32 header, so that the rest of the checks are
+		// shared.
+		var hdr32 linux.ElfHeader32
+		hdr32.UnmarshalUnsafe(hdrBuf)
+		hdr = linux.ElfHeader64{
+			Ident:     hdr32.Ident,
+			Type:      hdr32.Type,
+			Machine:   hdr32.Machine,
+			Version:   hdr32.Version,
+			Entry:     uint64(hdr32.Entry),
+			Phoff:     uint64(hdr32.Phoff),
+			Shoff:     uint64(hdr32.Shoff),
+			Flags:     hdr32.Flags,
+			Ehsize:    hdr32.Ehsize,
+			Phentsize: hdr32.Phentsize,
+			Phnum:     hdr32.Phnum,
+			Shentsize: hdr32.Shentsize,
+			Shnum:     hdr32.Shnum,
+			Shstrndx:  hdr32.Shstrndx,
+		}
+	} else {
+		hdr.UnmarshalUnsafe(hdrBuf)
+	}
 
-	// We support amd64 and arm64.
+	// We support amd64 and arm64, and i386 binaries on amd64.
 	var a arch.Arch
-	switch machine := elf.Machine(hdr.Machine); machine {
-	case elf.EM_X86_64:
+	switch machine := elf.Machine(hdr.Machine); {
+	case !compat && machine == elf.EM_X86_64:
 		a = arch.AMD64
-	case elf.EM_AARCH64:
+	case !compat && machine == elf.EM_AARCH64:
 		a = arch.ARM64
+	case compat && machine == elf.EM_386:
+		a = arch.AMD64
 	default:
-		log.Infof("Unsupported ELF machine %d", machine)
+		log.Infof("Unsupported ELF machine %d for class %v", machine, class)
 		return elfInfo{}, linuxerr.ENOEXEC
 	}
 
@@ -174,13 +231,20 @@ func parseHeader(ctx context.Context, f fullReader) (elfInfo, error) {
 		return elfInfo{}, linuxerr.ENOEXEC
 	}
 
-	if int(hdr.Phentsize) != prog64Size {
+	if int(hdr.Phentsize) != progSize {
 		log.Infof("Unsupported phdr size %d", hdr.Phentsize)
 		return elfInfo{}, linuxerr.ENOEXEC
 	}
-	totalPhdrSize := prog64Size * int(hdr.Phnum)
-	if totalPhdrSize < prog64Size {
-		log.Warningf("No phdrs or total phdr size overflows: prog64Size: %d phnum: %d", prog64Size, int(hdr.Phnum))
+	if hdr.Phnum == pnXNum {
+		// The real number of program headers is in the first section
+		// header. Linux doesn't support this for executables either,
+		// and the count would exceed maxTotalPhdrSize anyway.
+		log.Infof("Unsupported extended phdr numbering (PN_XNUM)")
+		return elfInfo{}, linuxerr.ENOEXEC
+	}
+	totalPhdrSize := progSize * int(hdr.Phnum)
+	if totalPhdrSize < progSize {
+		log.Warningf("No phdrs or total phdr size overflows: progSize: %d phnum: %d", progSize, int(hdr.Phnum))
 		return elfInfo{}, linuxerr.ENOEXEC
 	}
 	if totalPhdrSize > maxTotalPhdrSize {
@@ -205,6 +269,21 @@ func parseHeader(ctx context.Context, f fullReader) (elfInfo, error) {
 
 	phdrs := make([]elf.ProgHeader, hdr.Phnum)
 	for i := range phdrs {
+		if compat {
+			var prog32 linux.ElfProg32
+			phdrBuf = prog32.UnmarshalUnsafe(phdrBuf)
+			phdrs[i] = elf.ProgHeader{
+				Type:   elf.ProgType(prog32.Type),
+				Flags:  elf.ProgFlag(prog32.Flags),
+				Off:    uint64(prog32.Off),
+				Vaddr:  uint64(prog32.Vaddr),
+				Paddr:  uint64(prog32.Paddr),
+				Filesz: uint64(prog32.Filesz),
+				Memsz:  uint64(prog32.Memsz),
+				Align:  uint64(prog32.Align),
+			}
+			continue
+		}
 		var prog64 linux.ElfProg64
 		phdrBuf = prog64.UnmarshalUnsafe(phdrBuf)
 		phdrs[i] = elf.ProgHeader{
@@ -222,10 +301,11 @@ func parseHeader(ctx context.Context, f fullReader) (elfInfo, error) {
 	return elfInfo{
 		os:           os,
 		arch:         a,
+		compat:       compat,
 		entry:        hostarch.Addr(hdr.Entry),
 		phdrs:        phdrs,
 		phdrOff:      hdr.Phoff,
-		phdrSize:     prog64Size,
+		phdrSize:     progSize,
 		sharedObject: sharedObject,
 	}, nil
 }
@@ -354,6 +434,44 @@ func mapSegment(ctx context.Context, m *mm.MemoryManager, fd *vfs.FileDescriptio
 	return nil
 }
 
+// maxLoadAlignment returns the largest power-of-two alignment required by a
+// PT_LOAD segment, and at least hostarch.PageSize. Compare Linux's
+// fs/binfmt_elf.c:maximum_alignment().
+func maxLoadAlignment(phdrs []elf.ProgHeader) uint64 {
+	align := uint64(hostarch.PageSize)
+	for _, phdr := range phdrs {
+		if phdr.Type != elf.PT_LOAD || !bits.IsPowerOfTwo64(phdr.Align) {
+			continue
+		}
+		if phdr.Align > align && phdr.Align <= maxLoadAlign {
+			align = phdr.Align
+		}
+	}
+	return align
+}
+
+// phdrLoadAddr returns the unrelocated address at which the program headers,
+// at offset phdrOff in the file, are loaded by a PT_LOAD segment in phdrs. If
+// multiple segments contain them, the last one is used, as in Linux's
+// fs/binfmt_elf.c:load_elf_binary(). It returns false if no segment contains
+// them.
+func phdrLoadAddr(phdrs []elf.ProgHeader, phdrOff uint64) (hostarch.Addr, bool) {
+	var (
+		phdrAddr hostarch.Addr
+		found    bool
+	)
+	for _, phdr := range phdrs {
+		if phdr.Type != elf.PT_LOAD || phdr.Off > phdrOff || phdrOff-phdr.Off >= phdr.Filesz {
+			continue
+		}
+		if addr, ok := hostarch.Addr(phdr.Vaddr).AddLength(phdrOff - phdr.Off); ok {
+			phdrAddr = addr
+			found = true
+		}
+	}
+	return phdrAddr, found
+}
+
 // loadedELF describes an ELF that has been successfully loaded.
 type loadedELF struct {
 	// os is the target OS of the ELF.
@@ -362,6 +480,10 @@ type loadedELF struct {
 	// arch is the target architecture of the ELF.
 	arch arch.Arch
 
+	// compat is true if the ELF runs in the 32-bit compatibility mode of
+	// arch.
+	compat bool
+
 	// entry is the entry point of the ELF.
 	entry hostarch.Addr
 
@@ -484,6 +606,10 @@ func loadParsedELF(ctx context.Context, m *mm.MemoryManager, fd *vfs.FileDescrip
 	// Note that the vaddr of the first PT_LOAD segment is ignored when
 	// choosing the load address (even if it is non-zero). The vaddr does
 	// become an offset from that load address.
+	//
+	// The load address is aligned to the largest PT_LOAD alignment, so that
+	// segments (and the TLS blocks within them) that require more than page
+	// alignment get it, as in Linux.
 	var offset hostarch.Addr
 	if info.sharedObject {
 		totalSize := end - start
@@ -492,10 +618,16 @@ func loadParsedELF(ctx context.Context, m *mm.MemoryManager, fd *vfs.FileDescrip
 			ctx.Infof("ELF PT_LOAD segments too big")
 			return loadedELF{}, linuxerr.ENOEXEC
 		}
+		align := maxLoadAlignment(info.phdrs)
+		reserveSize, ok := totalSize.AddLength(align - hostarch.PageSize)
+		if !ok {
+			ctx.Infof("ELF PT_LOAD segments too big for alignment %#x", align)
+			return loadedELF{}, linuxerr.ENOEXEC
+		}
 
 		var err error
 		offset, err = m.MMap(ctx, memmap.MMapOpts{
-			Length:  uint64(totalSize),
+			Length:  uint64(reserveSize),
 			Addr:    sharedLoadOffset,
 			Private: true,
 		})
@@ -503,9 +635,12 @@ func loadParsedELF(ctx context.Context, m *mm.MemoryManager, fd *vfs.FileDescrip
 			ctx.Infof("Error allocating address space for shared object: %v", err)
 			return loadedELF{}, err
 		}
-		if err := m.MUnmap(ctx, offset, uint64(totalSize)); err != nil {
+		if err := m.MUnmap(ctx, offset, uint64(reserveSize)); err != nil {
 			panic(fmt.Sprintf("Failed to unmap base address: %v", err))
 		}
+		// This can't overflow, since the reservation extends at least
+		// this far.
+		offset = hostarch.Addr(bits.AlignUp(int(offset), uint(align)))
 
 		start, ok = start.AddLength(uint64(offset))
 		if !ok {
@@ -543,18 +678,31 @@ func loadParsedELF(ctx context.Context, m *mm.MemoryManager, fd *vfs.FileDescrip
 		}
 	}
 
-	// This assumes that the first segment contains the ELF headers. This
-	// may not be true in a malformed ELF, but Linux makes the same
-	// assumption.
-	phdrAddr, ok := start.AddLength(info.phdrOff)
-	if !ok {
-		ctx.Warningf("ELF start address %#x + phdr offset %#x overflows", start, info.phdrOff)
-		phdrAddr = 0
+	// Find the program headers in memory using the PT_LOAD segment that
+	// contains them, as Linux does. Linkers don't always place them at the
+	// same offset from the first segment as in the file. If no segment
+	// contains them, assume that the first segment contains the ELF
+	// headers.
+	var phdrAddr hostarch.Addr
+	if phdrVaddr, ok := phdrLoadAddr(info.phdrs, info.phdrOff); ok {
+		phdrAddr, ok = phdrVaddr.AddLength(uint64(offset))
+		if !ok {
+			ctx.Warningf("ELF phdr address %#x + offset %#x overflows", phdrVaddr, offset)
+			phdrAddr = 0
+		}
+	} else {
+		var ok bool
+		phdrAddr, ok = start.AddLength(info.phdrOff)
+		if !ok {
+			ctx.Warningf("ELF start address %#x + phdr offset %#x overflows", start, info.phdrOff)
+			phdrAddr = 0
+		}
 	}
 
 	return loadedELF{
 		os:          info.os,
 		arch:        info.arch,
+		compat:      info.compat,
 		entry:       info.entry,
 		start:       start,
 		end:         end,
@@ -590,6 +738,9 @@ func loadInitialELF(ctx context.Context, m *mm.MemoryManager, fs cpuid.FeatureSe
 	// Create the arch.Context64 now so we can prepare the mmap layout before
 	// mapping anything.
 	ac := arch.New(info.arch)
+	if info.compat {
+		ac.SetCompat()
+	}
 
 	l, err := m.SetMmapLayout(ac, limits.FromContext(ctx))
 	if err != nil {
@@ -625,8 +776,8 @@ func loadInterpreterELF(ctx context.Context, m *mm.MemoryManager, fd *vfs.FileDe
 		ctx.Infof("Initial ELF OS %v and interpreter ELF OS %v differ", initial.os, info.os)
 		return loadedELF{}, linuxerr.ELIBBAD
 	}
-	if info.arch != initial.arch {
-		ctx.Infof("Initial ELF arch %v and interpreter ELF arch %v differ", initial.arch, info.arch)
+	if info.arch != initial.arch || info.compat != initial.compat {
+		ctx.Infof("Initial ELF arch %v (compat: %t) and interpreter ELF arch %v (compat: %t) differ", initial.arch, initial.compat, info.arch, info.compat)
 		return loadedELF{}, linuxerr.ELIBBAD
 	}
 
@@ -0,0 +1,344 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"debug/elf"
+	"io"
+	"testing"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/hostarch"
+	"github.com/wilinz/gvisor/pkg/sentry/arch"
+	"github.com/wilinz/gvisor/pkg/usermem"
+)
+
+// bytesReader implements fullReader for an in-memory file.
+type bytesReader []byte
+
+// ReadFull implements fullReader.ReadFull.
+func (b bytesReader) ReadFull(ctx context.Context, dst usermem.IOSequence, offset int64) (int64, error) {
+	if offset >= int64(len(b)) {
+		return 0, io.EOF
+	}
+	n, err := dst.CopyOut(ctx, b[offset:])
+	if err != nil {
+		return int64(n), err
+	}
+	if int64(n) < dst.NumBytes() {
+		return int64(n), io.ErrUnexpectedEOF
+	}
+	return int64(n), nil
+}
+
+// newTestELF returns a static-PIE x86-64 ELF file with phnum program headers
+// following the ELF header. The program headers are phdrs, followed by
+// PT_NULL headers.
+func newTestELF(phnum uint16, phdrs []linux.ElfProg64) []byte {
+	hdr := linux.ElfHeader64{
+		Type:      uint16(elf.ET_DYN),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Phoff:     uint64(header64Size),
+		Ehsize:    uint16(header64Size),
+		Phentsize: uint16(prog64Size),
+		Phnum:     phnum,
+	}
+	copy(hdr.Ident[:], elfMagic)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	n := int(phnum)
+	if phnum == pnXNum {
+		n = 0
+	}
+	buf := make([]byte, header64Size+n*prog64Size)
+	hdr.MarshalUnsafe(buf)
+	for i := 0; i < n; i++ {
+		var phdr linux.ElfProg64
+		if i < len(phdrs) {
+			phdr = phdrs[i]
+		}
+		phdr.MarshalUnsafe(buf[header64Size+i*prog64Size:])
+	}
+	return buf
+}
+
+func TestParseHeaderPhdrCount(t *testing.T) {
+	maxPhnum := uint16(maxTotalPhdrSize / prog64Size)
+	for _, test := range []struct {
+		name    string
+		phnum   uint16
+		wantErr bool
+	}{
+		{
+			name:  "one",
+			phnum: 1,
+		},
+		{
+			name:  "more than a page",
+			phnum: uint16(hostarch.PageSize/prog64Size) + 1,
+		},
+		{
+			name:  "maximum",
+			phnum: maxPhnum,
+		},
+		{
+			name:    "too many",
+			phnum:   maxPhnum + 1,
+			wantErr: true,
+		},
+		{
+			name:    "none",
+			phnum:   0,
+			wantErr: true,
+		},
+		{
+			name:    "PN_XNUM",
+			phnum:   pnXNum,
+			wantErr: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			info, err := parseHeader(ctx, bytesReader(newTestELF(test.phnum, nil)))
+			if test.wantErr {
+				if !linuxerr.Equals(linuxerr.ENOEXEC, err) {
+					t.Errorf("parseHeader: got error %v, want ENOEXEC", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseHeader failed: %v", err)
+			}
+			if len(info.phdrs) != int(test.phnum) {
+				t.Errorf("parseHeader: got %d phdrs, want %d", len(info.phdrs), test.phnum)
+			}
+			if !info.sharedObject {
+				t.Errorf("parseHeader: got sharedObject false, want true")
+			}
+		})
+	}
+}
+
+func TestParseHeaderPhdrs(t *testing.T) {
+	// A typical static-PIE layout: a read-only segment containing the
+	// headers, an executable segment, and a writable segment containing an
+	// over-aligned TLS template.
+	want := []linux.ElfProg64{
+		{Type: uint32(elf.PT_PHDR), Off: 0x40, Vaddr: 0x40, Filesz: 4 * 56, Memsz: 4 * 56, Align: 8},
+		{Type: uint32(elf.PT_LOAD), Off: 0, Vaddr: 0, Filesz: 0x1000, Memsz: 0x1000, Align: 0x1000},
+		{Type: uint32(elf.PT_LOAD), Off: 0x1000, Vaddr: 0x201000, Filesz: 0x1000, Memsz: 0x1000, Align: 0x200000},
+		{Type: uint32(elf.PT_TLS), Off: 0x1800, Vaddr: 0x201800, Filesz: 0x10, Memsz: 0x100, Align: 0x40},
+	}
+	info, err := parseHeader(context.Background(), bytesReader(newTestELF(uint16(len(want)), want)))
+	if err != nil {
+		t.Fatalf("parseHeader failed: %v", err)
+	}
+	if len(info.phdrs) != len(want) {
+		t.Fatalf("parseHeader: got %d phdrs, want %d", len(info.phdrs), len(want))
+	}
+	for i, phdr := range info.phdrs {
+		w := want[i]
+		if phdr.Type != elf.ProgType(w.Type) || phdr.Off != w.Off || phdr.Vaddr != w.Vaddr || phdr.Filesz != w.Filesz || phdr.Memsz != w.Memsz || phdr.Align != w.Align {
+			t.Errorf("phdr %d: got %+v, want %+v", i, phdr, w)
+		}
+	}
+	if info.phdrOff != uint64(header64Size) {
+		t.Errorf("phdrOff: got %#x, want %#x", info.phdrOff, header64Size)
+	}
+	if got := maxLoadAlignment(info.phdrs); got != 0x200000 {
+		t.Errorf("maxLoadAlignment: got %#x, want 0x200000", got)
+	}
+	if got, ok := phdrLoadAddr(info.phdrs, info.phdrOff); !ok || got != 0x40 {
+		t.Errorf("phdrLoadAddr: got (%#x, %t), want (0x40, true)", got, ok)
+	}
+}
+
+// newTestELF32 returns a 32-bit ELF file for machine with the program headers
+// phdrs following the ELF header.
+func newTestELF32(machine elf.Machine, phdrs []linux.ElfProg32) []byte {
+	hdr := linux.ElfHeader32{
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Entry:     0x8049000,
+		Phoff:     uint32(header32Size),
+		Ehsize:    uint16(header32Size),
+		Phentsize: uint16(prog32Size),
+		Phnum:     uint16(len(phdrs)),
+	}
+	copy(hdr.Ident[:], elfMagic)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS32)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	buf := make([]byte, header32Size+len(phdrs)*prog32Size)
+	hdr.MarshalUnsafe(buf)
+	for i := range phdrs {
+		phdrs[i].MarshalUnsafe(buf[header32Size+i*prog32Size:])
+	}
+	return buf
+}
+
+func TestParseHeaderELF32(t *testing.T) {
+	phdrs := []linux.ElfProg32{
+		{Type: uint32(elf.PT_LOAD), Off: 0, Vaddr: 0x8048000, Filesz: 0x2000, Memsz: 0x3000, Flags: uint32(elf.PF_R | elf.PF_X), Align: 0x1000},
+	}
+	info, err := parseHeader(context.Background(), bytesReader(newTestELF32(elf.EM_386, phdrs)))
+	if err != nil {
+		t.Fatalf("parseHeader failed: %v", err)
+	}
+	if !info.compat || info.arch != arch.AMD64 {
+		t.Errorf("parseHeader: got compat %t arch %v, want compat true arch %v", info.compat, info.arch, arch.AMD64)
+	}
+	if info.entry != 0x8049000 {
+		t.Errorf("entry: got %#x, want 0x8049000", info.entry)
+	}
+	if info.phdrSize != prog32Size || info.phdrOff != uint64(header32Size) {
+		t.Errorf("phdrs: got size %d offset %#x, want size %d offset %#x", info.phdrSize, info.phdrOff, prog32Size, header32Size)
+	}
+	want := elf.ProgHeader{Type: elf.PT_LOAD, Flags: elf.PF_R | elf.PF_X, Vaddr: 0x8048000, Filesz: 0x2000, Memsz: 0x3000, Align: 0x1000}
+	if len(info.phdrs) != 1 || info.phdrs[0] != want {
+		t.Errorf("phdrs: got %+v, want [%+v]", info.phdrs, want)
+	}
+
+	// 64-bit machines aren't valid for 32-bit ELFs.
+	if _, err := parseHeader(context.Background(), bytesReader(newTestELF32(elf.EM_X86_64, phdrs))); !linuxerr.Equals(linuxerr.ENOEXEC, err) {
+		t.Errorf("parseHeader with EM_X86_64: got error %v, want ENOEXEC", err)
+	}
+}
+
+func TestMaxLoadAlignment(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		phdrs []elf.ProgHeader
+		want  uint64
+	}{
+		{
+			name: "no segments",
+			want: hostarch.PageSize,
+		},
+		{
+			name: "small alignment",
+			phdrs: []elf.ProgHeader{
+				{Type: elf.PT_LOAD, Align: 16},
+			},
+			want: hostarch.PageSize,
+		},
+		{
+			name: "largest",
+			phdrs: []elf.ProgHeader{
+				{Type: elf.PT_LOAD, Align: 0x10000},
+				{Type: elf.PT_LOAD, Align: 0x200000},
+				{Type: elf.PT_LOAD, Align: 0x1000},
+			},
+			want: 0x200000,
+		},
+		{
+			name: "not a power of two",
+			phdrs: []elf.ProgHeader{
+				{Type: elf.PT_LOAD, Align: 0x30000},
+			},
+			want: hostarch.PageSize,
+		},
+		{
+			name: "too large",
+			phdrs: []elf.ProgHeader{
+				{Type: elf.PT_LOAD, Align: 2 * maxLoadAlign},
+			},
+			want: hostarch.PageSize,
+		},
+		{
+			name: "not PT_LOAD",
+			phdrs: []elf.ProgHeader{
+				{Type: elf.PT_TLS, Align: 0x200000},
+			},
+			want: hostarch.PageSize,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := maxLoadAlignment(test.phdrs); got != test.want {
+				t.Errorf("maxLoadAlignment: got %#x, want %#x", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPhdrLoadAddr(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		phdrs   []elf.ProgHeader
+		phdrOff uint64
+		want    hostarch.Addr
+		wantOK  bool
+	}{
+		{
+			name: "first segment",
+			phdrs: []elf.ProgHeader{
+				{Type: elf.PT_LOAD, Off: 0, Vaddr: 0, Filesz: 0x1000},
+			},
+			phdrOff: 0x40,
+			want:    0x40,
+			wantOK:  true,
+		},
+		{
+			// e.g. lld places the headers in a segment that doesn't
+			// start at file offset 0.
+			name: "later segment",
+			phdrs: []elf.ProgHeader{
+				{Type: elf.PT_LOAD, Off: 0, Vaddr: 0x10000, Filesz: 0x40},
+				{Type: elf.PT_LOAD, Off: 0x1000, Vaddr: 0x21000, Filesz: 0x1000},
+			},
+			phdrOff: 0x1040,
+			want:    0x21040,
+			wantOK:  true,
+		},
+		{
+			name: "last match",
+			phdrs: []elf.ProgHeader{
+				{Type: elf.PT_LOAD, Off: 0, Vaddr: 0, Filesz: 0x1000},
+				{Type: elf.PT_LOAD, Off: 0, Vaddr: 0x400000, Filesz: 0x1000},
+			},
+			phdrOff: 0x40,
+			want:    0x400040,
+			wantOK:  true,
+		},
+		{
+			name: "end of segment",
+			phdrs: []elf.ProgHeader{
+				{Type: elf.PT_LOAD, Off: 0, Vaddr: 0, Filesz: 0x40},
+			},
+			phdrOff: 0x40,
+		},
+		{
+			name: "not PT_LOAD",
+			phdrs: []elf.ProgHeader{
+				{Type: elf.PT_PHDR, Off: 0x40, Vaddr: 0x40, Filesz: 0x100},
+			},
+			phdrOff: 0x40,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := phdrLoadAddr(test.phdrs, test.phdrOff)
+			if got != test.want || ok != test.wantOK {
+				t.Errorf("phdrLoadAddr: got (%#x, %t), want (%#x, %t)", got, ok, test.want, test.wantOK)
+			}
+		})
+	}
+}
@@ -59,6 +59,10 @@ type LoadArgs struct {
 	// Filename is the path for the executable.
 	Filename string
 
+	// Name is the name of the executable, used as the task command name. If
+	// Name is empty, the last component of Filename is used.
+	Name string
+
 	// File is an open FD of the executable. If File is not nil, then File will
 	// be loaded and Filename will be ignored.
 	//
@@ -276,10 +280,14 @@ func Load(ctx context.Context, args LoadArgs, extraAuxv []arch.AuxEntry, vdso *V
 		return ImageInfo{}, syserr.NewDynamic(fmt.Sprintf("failed to read file capabilities of %s: %v", args.Filename, err), syserr.FromError(err).ToLinux())
 	}
 
-	// Load the VDSO.
-	vdsoAddr, err := loadVDSO(ctx, args.MemoryManager, vdso, loaded)
-	if err != nil {
-		return ImageInfo{}, syserr.NewDynamic(fmt.Sprintf("error loading VDSO: %v", err), syserr.FromError(err).ToLinux())
+	// Load the VDSO. The VDSO is a 64-bit ELF, so 32-bit compat binaries run
+	// without one and make all syscalls directly.
+	var vdsoAddr hostarch.Addr
+	if !loaded.compat {
+		vdsoAddr, err = loadVDSO(ctx, args.MemoryManager, vdso, loaded)
+		if err != nil {
+			return ImageInfo{}, syserr.NewDynamic(fmt.Sprintf("error loading VDSO: %v", err), syserr.FromError(err).ToLinux())
+		}
 	}
 
 	// Setup the heap. brk starts at the next page after the end of the
@@ -328,10 +336,12 @@ func Load(ctx context.Context, args LoadArgs, extraAuxv []arch.AuxEntry, vdso *V
 		arch.AuxEntry{linux.AT_EXECFN, execfn},
 		arch.AuxEntry{linux.AT_RANDOM, random},
 		arch.AuxEntry{linux.AT_PAGESZ, hostarch.PageSize},
-		arch.AuxEntry{linux.AT_SYSINFO_EHDR, vdsoAddr},
 		arch.AuxEntry{linux.AT_HWCAP, hostarch.Addr(args.Features.AllowedHWCap1())},
 		arch.AuxEntry{linux.AT_HWCAP2, hostarch.Addr(args.Features.AllowedHWCap2())},
 	}...)
+	if vdsoAddr != 0 {
+		auxv = append(auxv, arch.AuxEntry{linux.AT_SYSINFO_EHDR, vdsoAddr})
+	}
 
 	sl, err := stack.Load(newArgv, args.Envv, auxv)
 	if err != nil {
@@ -345,12 +355,17 @@ func Load(ctx context.Context, args LoadArgs, extraAuxv []arch.AuxEntry, vdso *V
 	m.SetEnvvEnd(sl.EnvvEnd)
 	m.SetAuxv(auxv)
 	m.SetExecutable(ctx, file)
-	m.SetVDSOSigReturn(uint64(vdsoAddr) + vdsoSigreturnOffset - vdsoPrelink)
+	if vdsoAddr != 0 {
+		m.SetVDSOSigReturn(uint64(vdsoAddr) + vdsoSigreturnOffset - vdsoPrelink)
+	}
 
 	ac.SetIP(uintptr(loaded.entry))
 	ac.SetStack(uintptr(stack.Bottom))
 
-	name := path.Base(args.Filename)
+	name := args.Name
+	if name == "" {
+		name = path.Base(args.Filename)
+	}
 	if len(name) > linux.TASK_COMM_LEN-1 {
 		name = name[:linux.TASK_COMM_LEN-1]
 	}
@@ -0,0 +1,62 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+)
+
+// FormatAddress formats the socket address addr of the given family for
+// matching against policy rules:
+//
+//	AF_INET:  "inet:10.0.0.1:80"
+//	AF_INET6: "inet6:[::1]:80"
+//	AF_UNIX:  "unix:/path/to/socket", or "unix:@name" for abstract sockets
+//
+// Other families are formatted as "family:<number>".
+func FormatAddress(family int, addr []byte) string {
+	switch family {
+	case linux.AF_INET:
+		if len(addr) < 8 {
+			break
+		}
+		ip := netip.AddrFrom4([4]byte(addr[4:8]))
+		return fmt.Sprintf("inet:%s:%d", ip, binary.BigEndian.Uint16(addr[2:4]))
+	case linux.AF_INET6:
+		if len(addr) < 24 {
+			break
+		}
+		ip := netip.AddrFrom16([16]byte(addr[8:24]))
+		return fmt.Sprintf("inet6:[%s]:%d", ip, binary.BigEndian.Uint16(addr[2:4]))
+	case linux.AF_UNIX:
+		if len(addr) <= 2 {
+			break
+		}
+		path := string(addr[2:])
+		if path[0] == 0 {
+			return "unix:@" + path[1:]
+		}
+		if i := strings.IndexByte(path, 0); i >= 0 {
+			path = path[:i]
+		}
+		return "unix:" + path
+	}
+	return fmt.Sprintf("family:%d", family)
+}
@@ -0,0 +1,118 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lsm provides Linux Security Module-style hooks through which a
+// mandatory access control (MAC) policy can restrict sandboxed applications.
+//
+// Hooks are called for file open, executable loading, socket connection and
+// mounting. With no Module installed, every hook allows the operation.
+package lsm
+
+import (
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
+)
+
+// Module is a MAC policy. Each hook returns nil to allow the operation, or an
+// error (typically EACCES) that is returned to the application to deny it.
+type Module interface {
+	// Name returns the name of the LSM, as reported by
+	// /sys/kernel/security/lsm, e.g. "apparmor".
+	Name() string
+
+	// Label returns the security context of tasks confined by the policy,
+	// as reported by /proc/[pid]/attr/current.
+	Label() string
+
+	// FileOpen is called when the file at path is opened with the given
+	// open(2) flags. It is not called for O_PATH opens.
+	FileOpen(ctx context.Context, creds *auth.Credentials, path string, flags uint32) error
+
+	// BprmCheck is called when the file at path is opened to be executed.
+	BprmCheck(ctx context.Context, creds *auth.Credentials, path string) error
+
+	// SocketConnect is called when a socket of the given family connects
+	// to addr. See FormatAddress for the format of addr.
+	SocketConnect(ctx context.Context, creds *auth.Credentials, family int, addr string) error
+
+	// SBMount is called when a filesystem of type fstype is mounted from
+	// source onto target.
+	SBMount(ctx context.Context, creds *auth.Credentials, source, target, fstype string, flags uint64) error
+}
+
+// module is the installed Module, or nil if no Module is installed.
+var module Module
+
+// SetModule installs m as the MAC policy.
+//
+// Preconditions: No tasks are running.
+func SetModule(m Module) {
+	module = m
+}
+
+// Enabled returns true if a Module is installed. Callers may use it to avoid
+// the cost of computing hook arguments when no policy is in effect.
+func Enabled() bool {
+	return module != nil
+}
+
+// Name returns the name of the installed Module, or the empty string if no
+// Module is installed.
+func Name() string {
+	if module == nil {
+		return ""
+	}
+	return module.Name()
+}
+
+// Label returns the security context of confined tasks. Without an installed
+// Module, all tasks are unconfined.
+func Label() string {
+	if module == nil {
+		return "unconfined"
+	}
+	return module.Label()
+}
+
+// FileOpen calls Module.FileOpen on the installed Module.
+func FileOpen(ctx context.Context, creds *auth.Credentials, path string, flags uint32) error {
+	if module == nil {
+		return nil
+	}
+	return module.FileOpen(ctx, creds, path, flags)
+}
+
+// BprmCheck calls Module.BprmCheck on the installed Module.
+func BprmCheck(ctx context.Context, creds *auth.Credentials, path string) error {
+	if module == nil {
+		return nil
+	}
+	return module.BprmCheck(ctx, creds, path)
+}
+
+// SocketConnect calls Module.SocketConnect on the installed Module.
+func SocketConnect(ctx context.Context, creds *auth.Credentials, family int, addr string) error {
+	if module == nil {
+		return nil
+	}
+	return module.SocketConnect(ctx, creds, family, addr)
+}
+
+// SBMount calls Module.SBMount on the installed Module.
+func SBMount(ctx context.Context, creds *auth.Credentials, source, target, fstype string, flags uint64) error {
+	if module == nil {
+		return nil
+	}
+	return module.SBMount(ctx, creds, source, target, fstype, flags)
+}
@@ -0,0 +1,172 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+)
+
+const testProfile = `
+# Test profile.
+profile test-profile
+allow read /etc/hostname
+deny  write /etc/**
+deny  read /etc/shadow
+deny  exec /usr/bin/nc*
+deny  connect inet:10.*:*
+deny  connect unix:/run/docker.sock
+deny  mount /proc/**
+`
+
+func TestParseProfileErrors(t *testing.T) {
+	for _, profile := range []string{
+		"profile",
+		"mode permissive",
+		"deny open",
+		"deny chmod /etc",
+		"permit open /etc",
+	} {
+		if _, err := ParseProfile(strings.NewReader(profile)); err == nil {
+			t.Errorf("ParseProfile(%q) succeeded, want error", profile)
+		}
+	}
+}
+
+func TestProfile(t *testing.T) {
+	p, err := ParseProfile(strings.NewReader(testProfile))
+	if err != nil {
+		t.Fatalf("ParseProfile failed: %v", err)
+	}
+	if got, want := p.Label(), "test-profile (enforce)"; got != want {
+		t.Errorf("Label() = %q, want %q", got, want)
+	}
+	var denials []string
+	p.Audit = func(_ context.Context, text string) {
+		denials = append(denials, text)
+	}
+
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name  string
+		check func() error
+		deny  bool
+	}{
+		{
+			name:  "read allowed file",
+			check: func() error { return p.FileOpen(ctx, nil, "/etc/hostname", linux.O_RDONLY) },
+		},
+		{
+			name:  "write under denied tree",
+			check: func() error { return p.FileOpen(ctx, nil, "/etc/ssh/sshd_config", linux.O_WRONLY) },
+			deny:  true,
+		},
+		{
+			name:  "truncate under denied tree",
+			check: func() error { return p.FileOpen(ctx, nil, "/etc/passwd", linux.O_RDONLY|linux.O_TRUNC) },
+			deny:  true,
+		},
+		{
+			name:  "read denied file",
+			check: func() error { return p.FileOpen(ctx, nil, "/etc/shadow", linux.O_RDONLY) },
+			deny:  true,
+		},
+		{
+			name:  "read other file",
+			check: func() error { return p.FileOpen(ctx, nil, "/etc/passwd", linux.O_RDONLY) },
+		},
+		{
+			name:  "exec denied",
+			check: func() error { return p.BprmCheck(ctx, nil, "/usr/bin/ncat") },
+			deny:  true,
+		},
+		{
+			name:  "exec glob stays within component",
+			check: func() error { return p.BprmCheck(ctx, nil, "/usr/bin/nc.d/tool") },
+		},
+		{
+			name:  "connect denied network",
+			check: func() error { return p.SocketConnect(ctx, nil, linux.AF_INET, "inet:10.0.0.1:80") },
+			deny:  true,
+		},
+		{
+			name:  "connect other network",
+			check: func() error { return p.SocketConnect(ctx, nil, linux.AF_INET, "inet:192.168.0.1:80") },
+		},
+		{
+			name:  "connect denied unix socket",
+			check: func() error { return p.SocketConnect(ctx, nil, linux.AF_UNIX, "unix:/run/docker.sock") },
+			deny:  true,
+		},
+		{
+			name:  "mount denied",
+			check: func() error { return p.SBMount(ctx, nil, "none", "/proc/sys", "tmpfs", 0) },
+			deny:  true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			denials = nil
+			err := tc.check()
+			if tc.deny && !linuxerr.Equals(linuxerr.EACCES, err) {
+				t.Errorf("got error %v, want EACCES", err)
+			}
+			if !tc.deny && err != nil {
+				t.Errorf("got error %v, want nil", err)
+			}
+			if tc.deny != (len(denials) == 1) {
+				t.Errorf("got denial records %q", denials)
+			}
+		})
+	}
+}
+
+func TestProfileComplain(t *testing.T) {
+	p, err := ParseProfile(strings.NewReader("mode complain\ndeny open /**"))
+	if err != nil {
+		t.Fatalf("ParseProfile failed: %v", err)
+	}
+	var denials []string
+	p.Audit = func(_ context.Context, text string) {
+		denials = append(denials, text)
+	}
+	if err := p.FileOpen(context.Background(), nil, "/etc/shadow", linux.O_RDONLY); err != nil {
+		t.Errorf("FileOpen failed in complain mode: %v", err)
+	}
+	if len(denials) != 1 || !strings.Contains(denials[0], `apparmor="ALLOWED"`) {
+		t.Errorf("got denial records %q, want one ALLOWED record", denials)
+	}
+}
+
+func TestFormatAddress(t *testing.T) {
+	for _, tc := range []struct {
+		family int
+		addr   []byte
+		want   string
+	}{
+		{linux.AF_INET, []byte{2, 0, 0, 80, 10, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0}, "inet:10.0.0.1:80"},
+		{linux.AF_INET6, append([]byte{10, 0, 0x1f, 0x90, 0, 0, 0, 0}, append(make([]byte, 15), 1, 0, 0, 0, 0)...), "inet6:[::1]:8080"},
+		{linux.AF_UNIX, []byte("\x01\x00/tmp/sock\x00"), "unix:/tmp/sock"},
+		{linux.AF_UNIX, []byte("\x01\x00\x00abstract"), "unix:@abstract"},
+		{linux.AF_NETLINK, []byte{16, 0}, "family:16"},
+	} {
+		if got := FormatAddress(tc.family, tc.addr); got != tc.want {
+			t.Errorf("FormatAddress(%d, %v) = %q, want %q", tc.family, tc.addr, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/log"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
+)
+
+// Operations that profile rules apply to.
+const (
+	opOpen    = "open"
+	opRead    = "read"
+	opWrite   = "write"
+	opExec    = "exec"
+	opConnect = "connect"
+	opMount   = "mount"
+)
+
+// profileRule is a single allow or deny rule in a Profile.
+type profileRule struct {
+	allow   bool
+	op      string
+	pattern string
+	re      *regexp.Regexp
+}
+
+// Profile is a Module implementing a simple AppArmor-like policy. It is
+// reported to applications as "apparmor".
+//
+// Profiles are parsed by ParseProfile from a line-based format:
+//
+//	# Comments and blank lines are ignored.
+//	profile <name>
+//	mode <enforce|complain>
+//	<allow|deny> <operation> <pattern>
+//
+// Operations are "open" (any open), "read" (opens for reading), "write"
+// (opens for writing, creating or truncating), "exec", "connect" and "mount".
+// Patterns for file operations match absolute paths; patterns for "connect"
+// match addresses formatted by FormatAddress; patterns for "mount" match the
+// mount point. In patterns, "*" and "?" match within a path component and
+// "**" matches any string.
+//
+// Rules are evaluated in order and the first matching rule applies.
+// Operations matching no rule are allowed. In complain mode, denials are
+// reported but not enforced.
+type Profile struct {
+	name     string
+	complain bool
+	rules    []profileRule
+
+	// Audit, if set, is called with an AVC-style description of each
+	// denial.
+	Audit func(ctx context.Context, text string)
+}
+
+var _ Module = (*Profile)(nil)
+
+// ParseProfile parses a Profile from r.
+func ParseProfile(r io.Reader) (*Profile, error) {
+	p := &Profile{name: "gvisor-default"}
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "profile":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("line %d: want \"profile <name>\"", n)
+			}
+			p.name = fields[1]
+		case "mode":
+			if len(fields) != 2 || (fields[1] != "enforce" && fields[1] != "complain") {
+				return nil, fmt.Errorf("line %d: want \"mode <enforce|complain>\"", n)
+			}
+			p.complain = fields[1] == "complain"
+		case "allow", "deny":
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("line %d: want \"%s <operation> <pattern>\"", n, fields[0])
+			}
+			switch fields[1] {
+			case opOpen, opRead, opWrite, opExec, opConnect, opMount:
+			default:
+				return nil, fmt.Errorf("line %d: unknown operation %q", n, fields[1])
+			}
+			p.rules = append(p.rules, profileRule{
+				allow:   fields[0] == "allow",
+				op:      fields[1],
+				pattern: fields[2],
+				re:      compilePattern(fields[2]),
+			})
+		default:
+			return nil, fmt.Errorf("line %d: unknown directive %q", n, fields[0])
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// compilePattern converts a profile pattern to a regular expression.
+func compilePattern(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteByte('^')
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteByte('$')
+	return regexp.MustCompile(b.String())
+}
+
+// Name implements Module.Name.
+func (p *Profile) Name() string {
+	return "apparmor"
+}
+
+// Label implements Module.Label.
+func (p *Profile) Label() string {
+	if p.complain {
+		return p.name + " (complain)"
+	}
+	return p.name + " (enforce)"
+}
+
+// check evaluates the rules for ops against subject, which is the first
+// matching operation's target. It reports and returns an error on denial.
+func (p *Profile) check(ctx context.Context, operation, subject string, ops ...string) error {
+	for _, r := range p.rules {
+		matchesOp := false
+		for _, op := range ops {
+			if r.op == op {
+				matchesOp = true
+				break
+			}
+		}
+		if !matchesOp || !r.re.MatchString(subject) {
+			continue
+		}
+		if r.allow {
+			return nil
+		}
+		result := "DENIED"
+		if p.complain {
+			result = "ALLOWED"
+		}
+		text := fmt.Sprintf("apparmor=%q operation=%q profile=%q name=%q", result, operation, p.name, subject)
+		if p.Audit != nil {
+			p.Audit(ctx, text)
+		} else {
+			log.Infof("lsm: %s", text)
+		}
+		if p.complain {
+			return nil
+		}
+		return linuxerr.EACCES
+	}
+	return nil
+}
+
+// FileOpen implements Module.FileOpen.
+func (p *Profile) FileOpen(ctx context.Context, creds *auth.Credentials, path string, flags uint32) error {
+	ops := []string{opOpen}
+	if flags&linux.O_ACCMODE != linux.O_WRONLY {
+		ops = append(ops, opRead)
+	}
+	if flags&linux.O_ACCMODE != linux.O_RDONLY || flags&(linux.O_CREAT|linux.O_TRUNC) != 0 {
+		ops = append(ops, opWrite)
+	}
+	return p.check(ctx, opOpen, path, ops...)
+}
+
+// BprmCheck implements Module.BprmCheck.
+func (p *Profile) BprmCheck(ctx context.Context, creds *auth.Credentials, path string) error {
+	return p.check(ctx, opExec, path, opExec)
+}
+
+// SocketConnect implements Module.SocketConnect.
+func (p *Profile) SocketConnect(ctx context.Context, creds *auth.Credentials, family int, addr string) error {
+	return p.check(ctx, opConnect, addr, opConnect)
+}
+
+// SBMount implements Module.SBMount.
+func (p *Profile) SBMount(ctx context.Context, creds *auth.Credentials, source, target, fstype string, flags uint64) error {
+	return p.check(ctx, opMount, target, opMount)
+}
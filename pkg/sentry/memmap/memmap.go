@@ -360,6 +360,10 @@ type MMapOpts struct {
 	// Linux.
 	Stack bool
 
+	// NoReserve is equivalent to MAP_NORESERVE: the mapping is not charged
+	// against the commit limit unless overcommit is disabled.
+	NoReserve bool
+
 	// PlatformEffect controls the synchronous effect of this call on the
 	// underlying platform.AddressSpace.
 	PlatformEffect MMapPlatformEffect
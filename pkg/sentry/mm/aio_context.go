@@ -16,6 +16,7 @@ package mm
 
 import (
 	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/atomicbitops"
 	"github.com/wilinz/gvisor/pkg/context"
 	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
 	"github.com/wilinz/gvisor/pkg/hostarch"
@@ -36,6 +37,47 @@ type aioManager struct {
 	contexts map[uint64]*AIOContext
 }
 
+// DefaultAIOMaxEvents is the default AIOEvents.Max. It corresponds to the
+// default value of Linux's /proc/sys/fs/aio-max-nr.
+const DefaultAIOMaxEvents = 0x10000
+
+// AIOEvents accounts for the events of the asynchronous I/O contexts of all
+// MemoryManagers that share it. It is analogous to Linux's fs/aio.c:aio_nr and
+// aio_max_nr.
+//
+// +stateify savable
+type AIOEvents struct {
+	// Max is the maximum number of events.
+	Max atomicbitops.Uint64
+
+	// nr is the number of events of all live contexts.
+	nr atomicbitops.Uint64
+}
+
+// Count returns the number of events of all live contexts.
+func (a *AIOEvents) Count() uint64 {
+	return a.nr.Load()
+}
+
+// reserve accounts for n more events. It returns false if that would exceed
+// a.Max.
+func (a *AIOEvents) reserve(n uint64) bool {
+	for {
+		nr := a.nr.Load()
+		if nr+n > a.Max.Load() || nr+n < nr {
+			return false
+		}
+		if a.nr.CompareAndSwap(nr, nr+n) {
+			return true
+		}
+	}
+}
+
+// release undoes a previous call to reserve.
+func (a *AIOEvents) release(n uint64) {
+	a.nr.Add(-n)
+}
+
 func (mm *MemoryManager) destroyAIOManager(ctx context.Context) {
 	mm.aioManager.mu.Lock()
 	defer mm.aioManager.mu.Unlock()
@@ -48,7 +90,7 @@ func (mm *MemoryManager) destroyAIOManager(ctx context.Context) {
 // newAIOContext creates a new context for asynchronous I/O.
 //
 // Returns false if 'id' is currently in use.
-func (a *aioManager) newAIOContext(events uint32, id uint64) bool {
+func (a *aioManager) newAIOContext(events uint32, id uint64, limit *AIOEvents) bool {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
@@ -59,6 +101,7 @@ func (a *aioManager) newAIOContext(events uint32, id uint64) bool {
 	a.contexts[id] = &AIOContext{
 		requestReady:   make(chan struct{}, 1),
 		maxOutstanding: events,
+		limit:          limit,
 	}
 	return true
 }
@@ -123,6 +166,10 @@ type AIOContext struct {
 
 	// dead is set when the context is destroyed.
 	dead bool `state:"zerovalue"`
+
+	// limit accounts for maxOutstanding until the context is destroyed. If
+	// nil, the context isn't accounted for. limit is immutable.
+	limit *AIOEvents
 }
 
 // destroy marks the context dead.
@@ -131,6 +178,9 @@ func (aio *AIOContext) destroy() {
 	defer aio.mu.Unlock()
 	aio.dead = true
 	aio.checkForDone()
+	if aio.limit != nil {
+		aio.limit.release(uint64(aio.maxOutstanding))
+	}
 }
 
 // Preconditions: ctx.mu must be held by caller.
@@ -360,10 +410,25 @@ func (m *aioMappable) InvalidateUnsavable(ctx context.Context) error {
 	return nil
 }
 
-// NewAIOContext creates a new context for asynchronous I/O.
+// NewAIOContext creates a new context for asynchronous I/O. Its events are
+// accounted for in limit, unless it is nil, and NewAIOContext returns EAGAIN
+// if that would exceed limit.Max.
 //
 // NewAIOContext is analogous to Linux's fs/aio.c:ioctx_alloc().
-func (mm *MemoryManager) NewAIOContext(ctx context.Context, events uint32) (uint64, error) {
+func (mm *MemoryManager) NewAIOContext(ctx context.Context, events uint32, limit *AIOEvents) (uint64, error) {
+	if limit != nil {
+		if !limit.reserve(uint64(events)) {
+			return 0, linuxerr.EAGAIN
+		}
+	}
+	id, err := mm.newAIOContext(ctx, events, limit)
+	if err != nil && limit != nil {
+		limit.release(uint64(events))
+	}
+	return id, err
+}
+
+func (mm *MemoryManager) newAIOContext(ctx context.Context, events uint32, limit *AIOEvents) (uint64, error) {
 	// libaio get_ioevents() expects context "handle" to be a valid address.
 	// libaio peeks inside looking for a magic number. This function allocates
 	// a page per context and keeps it set to zeroes to ensure it will not
@@ -387,7 +452,7 @@ func (mm *MemoryManager) NewAIOContext(ctx context.Context, events uint32) (uint
 		return 0, err
 	}
 	id := uint64(addr)
-	if !mm.aioManager.newAIOContext(events, id) {
+	if !mm.aioManager.newAIOContext(events, id, limit) {
 		mm.MUnmap(ctx, addr, aioRingBufferSize)
 		return 0, linuxerr.EINVAL
 	}
@@ -96,6 +96,18 @@ func (mm *MemoryManager) Fork(ctx context.Context) (*MemoryManager, error) {
 		vdsoSigReturnAddr:  mm.vdsoSigReturnAddr,
 	}
 
+	// Charge the copied vmas against the commit limit before copying them.
+	// Compare Linux's kernel/fork.c:dup_mmap() => security_vm_enough_memory_mm().
+	mm2.committedAS = mm.committedAS
+	for srcvseg := mm.vmas.FirstSegment(); srcvseg.Ok(); srcvseg = srcvseg.NextSegment() {
+		if vma := srcvseg.ValuePtr(); vma.dontfork && vma.accounted {
+			mm2.committedAS -= uint64(srcvseg.Range().Length())
+		}
+	}
+	if err := mm.mf.Commit(ctx, mm2.committedAS); err != nil {
+		return nil, err
+	}
+
 	// Copy vmas.
 	dontforks := false
 	dstvgap := mm2.vmas.FirstGap()
@@ -117,6 +129,9 @@ func (mm *MemoryManager) Fork(ctx context.Context) (*MemoryManager, error) {
 		if vma.mappable != nil {
 			if err := vma.mappable.AddMapping(ctx, mm2, vmaAR, vma.off, vma.canWriteMappableLocked()); err != nil {
 				_, droppedIDs = mm2.removeVMAsLocked(ctx, mm2.applicationAddrRange(), droppedIDs)
+				// removeVMAsLocked released the charges for copied vmas;
+				// release the remainder.
+				mm.mf.Uncommit(mm2.committedAS)
 				return nil, err
 			}
 		}
@@ -111,12 +111,35 @@ type MemoryManager struct {
 	// lockedAS is protected by mappingMu.
 	lockedAS uint64
 
+	// pinnedAS is the number of bytes pinned on behalf of the application by
+	// long-term users of MemoryManager.Pin, like mm_struct->pinned_vm. Unlike
+	// lockedAS, it is not tied to any vma.
+	//
+	// pinnedAS is protected by mappingMu.
+	pinnedAS uint64
+
 	// dataAS is the size of private data segments, like mm_struct->data_vm.
 	// It means the vma which is private, writable, not stack.
 	//
 	// dataAS is protected by mappingMu.
 	dataAS uint64
 
+	// committedAS is the combined size in bytes of all vmas with
+	// vma.accounted == true, all of which is charged to mf by
+	// pgalloc.MemoryFile.Commit.
+	//
+	// committedAS is protected by mappingMu.
+	committedAS uint64
+
+	// workingSet is the number of bytes of mapped memory that were accessed
+	// during the most recent working set sampling interval; see
+	// SampleWorkingSet. workingSetSampled is true if SampleWorkingSet has
+	// succeeded at least once, indicating that vma.referenced is meaningful.
+	//
+	// workingSet and workingSetSampled are protected by mappingMu.
+	workingSet        uint64
+	workingSetSampled bool
+
 	// New VMAs created by MMap use whichever of memmap.MMapOpts.MLockMode or
 	// defMLockMode is greater.
 	//
@@ -245,6 +268,17 @@ type MemoryManager struct {
 	// membarrierRSeqEnabled is non-zero if EnableMembarrierRSeq has previously
 	// been called.
 	membarrierRSeqEnabled atomicbitops.Uint32
+
+	// membarrierGlobalEnabled is non-zero if EnableMembarrierGlobal has
+	// previously been called. Since MEMBARRIER_CMD_GLOBAL_EXPEDITED is
+	// implemented as a global memory barrier that reaches all threads
+	// regardless of registration, membarrierGlobalEnabled is only reported
+	// by MEMBARRIER_CMD_GET_REGISTRATIONS.
+	membarrierGlobalEnabled atomicbitops.Uint32
+
+	// membarrierSyncCoreEnabled is non-zero if EnableMembarrierSyncCore has
+	// previously been called.
+	membarrierSyncCoreEnabled atomicbitops.Uint32
 }
 
 // vma represents a virtual memory area.
@@ -300,6 +334,10 @@ type vma struct {
 	// dontfork is the MADV_DONTFORK setting for this vma configured by madvise().
 	dontfork bool
 
+	// accounted is true if this vma's size is included in
+	// MemoryManager.committedAS, like VM_ACCOUNT.
+	accounted bool
+
 	mlockMode memmap.MLockMode
 
 	// numaPolicy is the NUMA policy for this vma set by mbind().
@@ -318,6 +356,12 @@ type vma struct {
 
 	nameMut memmap.NameMut
 
+	// referenced is the number of bytes in this vma that were accessed during
+	// the most recent working set sampling interval. When vmas are split or
+	// merged, referenced is distributed or combined proportionally, so it is
+	// an estimate.
+	referenced uint64
+
 	// lastFault records the last address that was paged faulted. It hints at
 	// which direction addresses in this vma are being accessed.
 	//
@@ -337,6 +381,7 @@ func (v *vma) copy() vma {
 		growsDown:      v.growsDown,
 		isStack:        v.isStack,
 		dontfork:       v.dontfork,
+		accounted:      v.accounted,
 		mlockMode:      v.mlockMode,
 		numaPolicy:     v.numaPolicy,
 		numaNodemask:   v.numaNodemask,
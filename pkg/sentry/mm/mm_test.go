@@ -113,7 +113,7 @@ func TestDataASUpdates(t *testing.T) {
 		t.Fatalf("dataAS believes %v bytes are mapped; %v bytes are actually mapped", mm.dataAS, realDataAS)
 	}
 
-	mm.MProtect(addr+hostarch.PageSize, hostarch.PageSize, hostarch.Read, false)
+	mm.MProtect(ctx, addr+hostarch.PageSize, hostarch.PageSize, hostarch.Read, false)
 	realDataAS = mm.realDataAS()
 	if mm.dataAS != realDataAS {
 		t.Fatalf("dataAS believes %v bytes are mapped; %v bytes are actually mapped", mm.dataAS, realDataAS)
@@ -143,6 +143,127 @@ func TestBrkDataLimitUpdates(t *testing.T) {
 	}
 }
 
+func (mm *MemoryManager) realCommittedAS() uint64 {
+	var sz uint64
+	for seg := mm.vmas.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
+		if seg.ValuePtr().accounted {
+			sz += uint64(seg.Range().Length())
+		}
+	}
+	return sz
+}
+
+func TestCommittedASUpdates(t *testing.T) {
+	ctx := contexttest.Context(t)
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+
+	addr, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   3 * hostarch.PageSize,
+		Private:  true,
+		Perms:    hostarch.Read,
+		MaxPerms: hostarch.AnyAccess,
+	})
+	if err != nil {
+		t.Fatalf("MMap got err %v want nil", err)
+	}
+	if mm.committedAS != 0 {
+		t.Fatalf("committedAS is %v for a read-only mapping, wanted 0", mm.committedAS)
+	}
+
+	if err := mm.MProtect(ctx, addr+hostarch.PageSize, hostarch.PageSize, hostarch.ReadWrite, false); err != nil {
+		t.Fatalf("MProtect got err %v want nil", err)
+	}
+	if want := uint64(hostarch.PageSize); mm.committedAS != want {
+		t.Fatalf("committedAS is %v after mprotect, wanted %v", mm.committedAS, want)
+	}
+
+	if _, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:    hostarch.PageSize,
+		Private:   true,
+		Perms:     hostarch.ReadWrite,
+		MaxPerms:  hostarch.AnyAccess,
+		NoReserve: true,
+	}); err != nil {
+		t.Fatalf("MMap got err %v want nil", err)
+	}
+	if realCommittedAS := mm.realCommittedAS(); mm.committedAS != realCommittedAS {
+		t.Fatalf("committedAS believes %v bytes are committed; %v bytes are actually committed", mm.committedAS, realCommittedAS)
+	}
+
+	mm.MUnmap(ctx, addr, 3*hostarch.PageSize)
+	if mm.committedAS != 0 {
+		t.Fatalf("committedAS is %v after munmap, wanted 0", mm.committedAS)
+	}
+}
+
+// maxMapCountContext overrides the vm.max_map_count seen by a MemoryManager.
+type maxMapCountContext struct {
+	context.Context
+	maxMapCount int
+}
+
+// Value implements context.Context.Value.
+func (ctx *maxMapCountContext) Value(key any) any {
+	if key == CtxMaxMapCount {
+		return ctx.maxMapCount
+	}
+	return ctx.Context.Value(key)
+}
+
+func TestMaxMapCount(t *testing.T) {
+	ctx := &maxMapCountContext{Context: contexttest.Context(t), maxMapCount: 2}
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+
+	// Alternate permissions so that adjacent vmas can't merge.
+	var addrs []hostarch.Addr
+	for _, perms := range []hostarch.AccessType{hostarch.Read, hostarch.ReadWrite} {
+		addr, err := mm.MMap(ctx, memmap.MMapOpts{
+			Length:   3 * hostarch.PageSize,
+			Private:  true,
+			Perms:    perms,
+			MaxPerms: hostarch.AnyAccess,
+		})
+		if err != nil {
+			t.Fatalf("MMap got err %v want nil", err)
+		}
+		addrs = append(addrs, addr)
+	}
+
+	// A third vma is permitted since Linux checks map_count > max_map_count
+	// before mapping, but a fourth is not.
+	if _, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   hostarch.PageSize,
+		Private:  true,
+		Perms:    hostarch.Read,
+		MaxPerms: hostarch.AnyAccess,
+	}); err != nil {
+		t.Fatalf("MMap got err %v want nil", err)
+	}
+	if _, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   hostarch.PageSize,
+		Private:  true,
+		Perms:    hostarch.Read,
+		MaxPerms: hostarch.AnyAccess,
+	}); !linuxerr.Equals(linuxerr.ENOMEM, err) {
+		t.Errorf("MMap got err %v want ENOMEM", err)
+	}
+
+	// Splitting a vma fails.
+	if err := mm.MUnmap(ctx, addrs[0]+hostarch.PageSize, hostarch.PageSize); !linuxerr.Equals(linuxerr.ENOMEM, err) {
+		t.Errorf("MUnmap got err %v want ENOMEM", err)
+	}
+	if err := mm.MProtect(ctx, addrs[1], hostarch.PageSize, hostarch.Read, false); !linuxerr.Equals(linuxerr.ENOMEM, err) {
+		t.Errorf("MProtect got err %v want ENOMEM", err)
+	}
+
+	// Unmapping the end of a vma doesn't split it, so it succeeds.
+	if err := mm.MUnmap(ctx, addrs[0]+2*hostarch.PageSize, hostarch.PageSize); err != nil {
+		t.Errorf("MUnmap got err %v want nil", err)
+	}
+}
+
 // TestIOAfterUnmap ensures that IO fails after unmap.
 func TestIOAfterUnmap(t *testing.T) {
 	ctx := contexttest.Context(t)
@@ -209,7 +330,7 @@ func TestIOAfterMProtect(t *testing.T) {
 		t.Errorf("CopyOut got %d want 1", n)
 	}
 
-	err = mm.MProtect(addr, hostarch.PageSize, hostarch.Read, false)
+	err = mm.MProtect(ctx, addr, hostarch.PageSize, hostarch.Read, false)
 	if err != nil {
 		t.Errorf("MProtect got err %v want nil", err)
 	}
@@ -242,7 +363,7 @@ func TestAIOPrepareAfterDestroy(t *testing.T) {
 	mm := testMemoryManager(ctx)
 	defer mm.DecUsers(ctx)
 
-	id, err := mm.NewAIOContext(ctx, 1)
+	id, err := mm.NewAIOContext(ctx, 1, nil /* limit */)
 	if err != nil {
 		t.Fatalf("mm.NewAIOContext got err %v want nil", err)
 	}
@@ -260,13 +381,41 @@ func TestAIOPrepareAfterDestroy(t *testing.T) {
 	}
 }
 
+// TestAIOEventsLimit tests that AIOContexts are accounted for in AIOEvents
+// until they are destroyed.
+func TestAIOEventsLimit(t *testing.T) {
+	ctx := contexttest.Context(t)
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+
+	var limit AIOEvents
+	limit.Max.Store(16)
+	if _, err := mm.NewAIOContext(ctx, 32, &limit); !linuxerr.Equals(linuxerr.EAGAIN, err) {
+		t.Errorf("mm.NewAIOContext(32) got err %v want EAGAIN", err)
+	}
+	id, err := mm.NewAIOContext(ctx, 16, &limit)
+	if err != nil {
+		t.Fatalf("mm.NewAIOContext(16) got err %v want nil", err)
+	}
+	if got := limit.Count(); got != 16 {
+		t.Errorf("limit.Count() got %d want 16", got)
+	}
+	if _, err := mm.NewAIOContext(ctx, 1, &limit); !linuxerr.Equals(linuxerr.EAGAIN, err) {
+		t.Errorf("mm.NewAIOContext(1) got err %v want EAGAIN", err)
+	}
+	mm.DestroyAIOContext(ctx, id)
+	if got := limit.Count(); got != 0 {
+		t.Errorf("limit.Count() after destroy got %d want 0", got)
+	}
+}
+
 // TestAIOLookupAfterDestroy tests that AIOContext should not be able to be
 // looked up after memory manager is destroyed.
 func TestAIOLookupAfterDestroy(t *testing.T) {
 	ctx := contexttest.Context(t)
 	mm := testMemoryManager(ctx)
 
-	id, err := mm.NewAIOContext(ctx, 1)
+	id, err := mm.NewAIOContext(ctx, 1, nil /* limit */)
 	if err != nil {
 		mm.DecUsers(ctx)
 		t.Fatalf("mm.NewAIOContext got err %v want nil", err)
@@ -340,3 +489,23 @@ func TestGetAllocationDirection(t *testing.T) {
 		})
 	}
 }
+
+func TestReferencedSplitMerge(t *testing.T) {
+	ar := hostarch.AddrRange{0x10000, 0x10000 + 4*hostarch.PageSize}
+	v := vma{referenced: 2 * hostarch.PageSize}
+	split := ar.Start + hostarch.PageSize
+	v1, v2 := vmaSetFunctions{}.Split(ar, v, split)
+	if got, want := v1.referenced+v2.referenced, v.referenced; got != want {
+		t.Errorf("split referenced sums to %d, want %d", got, want)
+	}
+	if got, want := v1.referenced, uint64(hostarch.PageSize/2); got != want {
+		t.Errorf("first vma referenced got %d, want %d", got, want)
+	}
+	merged, ok := vmaSetFunctions{}.Merge(hostarch.AddrRange{ar.Start, split}, v1, hostarch.AddrRange{split, ar.End}, v2)
+	if !ok {
+		t.Fatalf("Merge failed")
+	}
+	if merged.referenced != v.referenced {
+		t.Errorf("merged referenced got %d, want %d", merged.referenced, v.referenced)
+	}
+}
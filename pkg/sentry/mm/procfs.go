@@ -195,8 +195,14 @@ func (mm *MemoryManager) vmaSmapsEntryIntoLocked(ctx context.Context, vseg vmaIt
 	}
 	fmt.Fprintf(b, "Private_Clean:  %8d kB\n", clean/1024)
 	fmt.Fprintf(b, "Private_Dirty:  %8d kB\n", (rss-clean)/1024)
-	// Pretend that all pages are "referenced" (recently touched).
-	fmt.Fprintf(b, "Referenced:     %8d kB\n", rss/1024)
+	// If the working set has been sampled, report pages accessed during the
+	// last sampling interval as "referenced" (recently touched). Otherwise,
+	// pretend that all pages are referenced.
+	referenced := rss
+	if mm.workingSetSampled && vma.referenced < referenced {
+		referenced = vma.referenced
+	}
+	fmt.Fprintf(b, "Referenced:     %8d kB\n", referenced/1024)
 	fmt.Fprintf(b, "Anonymous:      %8d kB\n", anon/1024)
 	// Hugepages (hugetlb and THP) are not implemented.
 	fmt.Fprintf(b, "AnonHugePages:  %8d kB\n", 0)
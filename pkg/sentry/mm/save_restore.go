@@ -40,6 +40,7 @@ func (mm *MemoryManager) InvalidateUnsavable(ctx context.Context) error {
 // afterLoad is invoked by stateify.
 func (mm *MemoryManager) afterLoad(ctx goContext.Context) {
 	mm.mf = pgalloc.MemoryFileFromContext(ctx)
+	mm.mf.RestoreCommitted(mm.committedAS)
 	mm.haveASIO = mm.p.SupportsAddressSpaceIO()
 }
 
@@ -322,6 +322,14 @@ func (mm *MemoryManager) MUnmap(ctx context.Context, addr hostarch.Addr, length
 	}
 
 	mm.mappingMu.Lock()
+	// Unmapping the middle of a vma splits it in two, which is subject to
+	// vm.max_map_count. Compare Linux's mm/mmap.c:do_vmi_align_munmap().
+	if vseg := mm.vmas.FindSegment(ar.Start); vseg.Ok() && vseg.Start() < ar.Start && ar.End < vseg.End() {
+		if mm.vmaCountAtLeastLocked(MaxMapCountFromContext(ctx)) {
+			mm.mappingMu.Unlock()
+			return linuxerr.ENOMEM
+		}
+	}
 	_, droppedIDs := mm.unmapLocked(ctx, ar, nil /* droppedIDs */)
 	mm.mappingMu.Unlock()
 
@@ -466,6 +474,7 @@ func (mm *MemoryManager) MRemap(ctx context.Context, oldAddr hostarch.Addr, oldS
 			Private:         vma.private,
 			GrowsDown:       vma.growsDown,
 			Stack:           vma.isStack,
+			NoReserve:       !vma.accounted,
 			MLockMode:       vma.mlockMode,
 			Name:            vma.name,
 			NameMut:         vma.nameMut,
@@ -483,6 +492,12 @@ func (mm *MemoryManager) MRemap(ctx context.Context, oldAddr hostarch.Addr, oldS
 		}
 	}
 
+	// Copying or moving may split vmas at both the source and destination.
+	// Compare Linux's mm/mremap.c:move_vma().
+	if mm.vmaCountAtLeastLocked(MaxMapCountFromContext(ctx) - 3) {
+		return 0, linuxerr.ENOMEM
+	}
+
 	// Find a location for the new mapping.
 	var newAR hostarch.AddrRange
 	switch opts.Move {
@@ -547,16 +562,28 @@ func (mm *MemoryManager) MRemap(ctx context.Context, oldAddr hostarch.Addr, oldS
 		return 0, linuxerr.ENOMEM
 	}
 
+	// Charge any growth of an accounted vma against the commit limit.
+	var commitDelta uint64
+	if vseg.ValuePtr().accounted && newAR.Length() > oldAR.Length() {
+		commitDelta = uint64(newAR.Length() - oldAR.Length())
+		if err := mm.mf.Commit(ctx, commitDelta); err != nil {
+			return 0, err
+		}
+	}
+
 	if vma := vseg.ValuePtr(); vma.mappable != nil {
 		// Check that offset+length does not overflow.
 		if vma.off+uint64(newAR.Length()) < vma.off {
+			mm.mf.Uncommit(commitDelta)
 			return 0, linuxerr.EINVAL
 		}
 		// Inform the Mappable, if any, of the new mapping.
 		if err := vma.mappable.CopyMapping(ctx, mm, oldAR, newAR, vseg.mappableOffsetAt(oldAR.Start), vma.canWriteMappableLocked()); err != nil {
+			mm.mf.Uncommit(commitDelta)
 			return 0, err
 		}
 	}
+	mm.committedAS += commitDelta
 
 	if oldSize == 0 {
 		// Handle copying.
@@ -630,7 +657,7 @@ func (mm *MemoryManager) MRemap(ctx context.Context, oldAddr hostarch.Addr, oldS
 }
 
 // MProtect implements the semantics of Linux's mprotect(2).
-func (mm *MemoryManager) MProtect(addr hostarch.Addr, length uint64, realPerms hostarch.AccessType, growsDown bool) error {
+func (mm *MemoryManager) MProtect(ctx context.Context, addr hostarch.Addr, length uint64, realPerms hostarch.AccessType, growsDown bool) error {
 	addr = hostarch.UntaggedUserAddr(addr)
 	if addr.RoundDown() != addr {
 		return linuxerr.EINVAL
@@ -682,6 +709,7 @@ func (mm *MemoryManager) MProtect(addr hostarch.Addr, length uint64, realPerms h
 		mm.pmas.MergeOutsideRange(ar)
 	}()
 	pseg := mm.pmas.LowerBoundSegment(ar.Start)
+	maxMapCount := MaxMapCountFromContext(ctx)
 	var didUnmapAS bool
 	for {
 		// Check for permission validity before splitting vmas, for consistency
@@ -689,11 +717,25 @@ func (mm *MemoryManager) MProtect(addr hostarch.Addr, length uint64, realPerms h
 		if !vseg.ValuePtr().maxPerms.SupersetOf(effectivePerms) {
 			return linuxerr.EACCES
 		}
+		// Splitting a vma is subject to vm.max_map_count. Compare Linux's
+		// mm/mprotect.c:mprotect_fixup() => split_vma().
+		if vseg.ValuePtr().realPerms != realPerms && (vseg.Start() < ar.Start || ar.End < vseg.End()) && mm.vmaCountAtLeastLocked(maxMapCount) {
+			return linuxerr.ENOMEM
+		}
 		vseg = mm.vmas.Isolate(vseg, ar)
 
 		// Update vma permissions.
 		vma := vseg.ValuePtr()
 		vmaLength := vseg.Range().Length()
+		// Making a private vma writable charges it against the commit limit,
+		// as in Linux's mm/mprotect.c:mprotect_fixup().
+		if realPerms.Write && !vma.realPerms.Write && vma.private && !vma.accounted {
+			if err := mm.mf.Commit(ctx, uint64(vmaLength)); err != nil {
+				return err
+			}
+			vma.accounted = true
+			mm.committedAS += uint64(vmaLength)
+		}
 		if vma.isPrivateDataLocked() {
 			mm.dataAS -= uint64(vmaLength)
 		}
@@ -1497,6 +1539,44 @@ func (mm *MemoryManager) VirtualDataSize() uint64 {
 	return mm.dataAS
 }
 
+// AccountPinned charges length bytes, pinned on behalf of the application by
+// a long-term user of MemoryManager.Pin such as io_uring registered buffers,
+// to mm. Unless the caller has CAP_IPC_LOCK, it returns ENOMEM if this would
+// exceed RLIMIT_MEMLOCK. Like Linux, pinned memory is accounted separately
+// from mlocked memory. See io_uring/rsrc.c:__io_account_mem().
+func (mm *MemoryManager) AccountPinned(ctx context.Context, length uint64) error {
+	mm.mappingMu.Lock()
+	defer mm.mappingMu.Unlock()
+	newPinnedAS := mm.pinnedAS + length
+	if newPinnedAS < mm.pinnedAS {
+		return linuxerr.ENOMEM
+	}
+	if creds := auth.CredentialsFromContext(ctx); !creds.HasCapabilityIn(linux.CAP_IPC_LOCK, creds.UserNamespace.Root()) {
+		if mlockLimit := limits.FromContext(ctx).Get(limits.MemoryLocked).Cur; newPinnedAS > mlockLimit {
+			return linuxerr.ENOMEM
+		}
+	}
+	mm.pinnedAS = newPinnedAS
+	return nil
+}
+
+// UnaccountPinned releases length bytes charged to mm by AccountPinned.
+func (mm *MemoryManager) UnaccountPinned(length uint64) {
+	mm.mappingMu.Lock()
+	defer mm.mappingMu.Unlock()
+	if length > mm.pinnedAS {
+		panic(fmt.Sprintf("releasing %d pinned bytes, only %d accounted", length, mm.pinnedAS))
+	}
+	mm.pinnedAS -= length
+}
+
+// PinnedSize returns the number of bytes charged to mm by AccountPinned.
+func (mm *MemoryManager) PinnedSize() uint64 {
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	return mm.pinnedAS
+}
+
 // EnableMembarrierPrivate causes future calls to IsMembarrierPrivateEnabled to
 // return true.
 func (mm *MemoryManager) EnableMembarrierPrivate() {
@@ -1521,6 +1601,30 @@ func (mm *MemoryManager) IsMembarrierRSeqEnabled() bool {
 	return mm.membarrierRSeqEnabled.Load() != 0
 }
 
+// EnableMembarrierGlobal causes future calls to IsMembarrierGlobalEnabled to
+// return true.
+func (mm *MemoryManager) EnableMembarrierGlobal() {
+	mm.membarrierGlobalEnabled.Store(1)
+}
+
+// IsMembarrierGlobalEnabled returns true if mm.EnableMembarrierGlobal() has
+// previously been called.
+func (mm *MemoryManager) IsMembarrierGlobalEnabled() bool {
+	return mm.membarrierGlobalEnabled.Load() != 0
+}
+
+// EnableMembarrierSyncCore causes future calls to IsMembarrierSyncCoreEnabled
+// to return true.
+func (mm *MemoryManager) EnableMembarrierSyncCore() {
+	mm.membarrierSyncCoreEnabled.Store(1)
+}
+
+// IsMembarrierSyncCoreEnabled returns true if mm.EnableMembarrierSyncCore()
+// has previously been called.
+func (mm *MemoryManager) IsMembarrierSyncCoreEnabled() bool {
+	return mm.membarrierSyncCoreEnabled.Load() != 0
+}
+
 // FindVMAByName finds a vma with the specified name and returns its start address and offset.
 func (mm *MemoryManager) FindVMAByName(ar hostarch.AddrRange, name string) (hostarch.Addr, uint64, error) {
 	mm.mappingMu.RLock()
@@ -16,6 +16,7 @@ package mm
 
 import (
 	"fmt"
+	"math/bits"
 	"sync/atomic"
 
 	"github.com/wilinz/gvisor/pkg/abi/linux"
@@ -26,6 +27,7 @@ import (
 	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
 	"github.com/wilinz/gvisor/pkg/sentry/limits"
 	"github.com/wilinz/gvisor/pkg/sentry/memmap"
+	"github.com/wilinz/gvisor/pkg/sentry/pgalloc"
 )
 
 // Caller provides the droppedIDs slice to collect dropped mapping
@@ -62,6 +64,12 @@ func (mm *MemoryManager) createVMALocked(ctx context.Context, opts memmap.MMapOp
 	}
 	ar, _ := addr.ToRange(opts.Length)
 
+	// Check against vm.max_map_count. This is checked before any existing
+	// mappings are removed, consistent with Linux's mm/mmap.c:do_mmap().
+	if mm.vmaCountAtLeastLocked(MaxMapCountFromContext(ctx) + 1) {
+		return vmaIterator{}, hostarch.AddrRange{}, droppedIDs, linuxerr.ENOMEM
+	}
+
 	// Check against RLIMIT_AS.
 	newUsageAS := mm.usageAS + opts.Length
 	if opts.Unmap {
@@ -98,11 +106,24 @@ func (mm *MemoryManager) createVMALocked(ctx context.Context, opts memmap.MMapOp
 		vgap = mm.vmas.FindGap(ar.Start)
 	}
 
+	// Charge the new mapping against the commit limit. As in Linux, this
+	// happens after overwritten mappings are removed, so that replacing a
+	// mapping does not count it twice.
+	accounted := accountable(ctx, opts.Private, opts.Perms, opts.NoReserve)
+	if accounted {
+		if err := mm.mf.Commit(ctx, opts.Length); err != nil {
+			return vmaIterator{}, hostarch.AddrRange{}, droppedIDs, err
+		}
+	}
+
 	// Inform the Mappable, if any, of the new mapping.
 	if opts.Mappable != nil {
 		// The expression for writable is vma.canWriteMappableLocked(), but we
 		// don't yet have a vma.
 		if err := opts.Mappable.AddMapping(ctx, mm, ar, opts.Offset, !opts.Private && opts.MaxPerms.Write); err != nil {
+			if accounted {
+				mm.mf.Uncommit(opts.Length)
+			}
 			return vmaIterator{}, hostarch.AddrRange{}, droppedIDs, err
 		}
 	}
@@ -123,6 +144,7 @@ func (mm *MemoryManager) createVMALocked(ctx context.Context, opts memmap.MMapOp
 		private:        opts.Private,
 		growsDown:      opts.GrowsDown,
 		isStack:        opts.Stack,
+		accounted:      accounted,
 		mlockMode:      opts.MLockMode,
 		numaPolicy:     linux.MPOL_DEFAULT,
 		id:             opts.MappingIdentity,
@@ -138,10 +160,46 @@ func (mm *MemoryManager) createVMALocked(ctx context.Context, opts memmap.MMapOp
 	if opts.MLockMode != memmap.MLockNone {
 		mm.lockedAS += opts.Length
 	}
+	if accounted {
+		mm.committedAS += opts.Length
+	}
 
 	return vseg, ar, droppedIDs, nil
 }
 
+// accountable returns true if a mapping with the given properties should be
+// charged against the commit limit, like Linux's
+// mm/mmap.c:accountable_mapping(). MAP_NORESERVE is ignored when overcommit is
+// disabled.
+func accountable(ctx context.Context, private bool, perms hostarch.AccessType, noReserve bool) bool {
+	if !private || !perms.Write {
+		return false
+	}
+	return !noReserve || pgalloc.CommitPolicyFromContext(ctx).Mode == linux.OVERCOMMIT_NEVER
+}
+
+// vmaCountAtLeastLocked returns true if mm contains at least n vmas.
+//
+// Preconditions: mm.mappingMu must be locked.
+func (mm *MemoryManager) vmaCountAtLeastLocked(n int) bool {
+	if n <= 0 {
+		return true
+	}
+	// Each vma spans at least one page, so there can't be more vmas than
+	// mapped pages. This avoids iterating vmas in the common case.
+	if mm.usageAS/hostarch.PageSize < uint64(n) {
+		return false
+	}
+	count := 0
+	for vseg := mm.vmas.FirstSegment(); vseg.Ok(); vseg = vseg.NextSegment() {
+		count++
+		if count >= n {
+			return true
+		}
+	}
+	return false
+}
+
 type findAvailableOpts struct {
 	// These fields are equivalent to those in memmap.MMapOpts, except that:
 	//
@@ -418,6 +476,10 @@ func (mm *MemoryManager) removeVMAsLocked(ctx context.Context, ar hostarch.AddrR
 		if vma.mlockMode != memmap.MLockNone {
 			mm.lockedAS -= uint64(vmaAR.Length())
 		}
+		if vma.accounted {
+			mm.committedAS -= uint64(vmaAR.Length())
+			mm.mf.Uncommit(uint64(vmaAR.Length()))
+		}
 	})
 	return vgap, droppedIDs
 }
@@ -472,6 +534,7 @@ func (vmaSetFunctions) Merge(ar1 hostarch.AddrRange, vma1 vma, ar2 hostarch.Addr
 		vma1.numaPolicy != vma2.numaPolicy ||
 		vma1.numaNodemask != vma2.numaNodemask ||
 		vma1.dontfork != vma2.dontfork ||
+		vma1.accounted != vma2.accounted ||
 		vma1.id != vma2.id ||
 		vma1.name != vma2.name ||
 		vma1.nameMut != vma2.nameMut {
@@ -485,6 +548,8 @@ func (vmaSetFunctions) Merge(ar1 hostarch.AddrRange, vma1 vma, ar2 hostarch.Addr
 		vma2.id.DecRef(context.Background())
 	}
 
+	vma1.referenced += vma2.referenced
+
 	// If the existing vma (vma2) has non-zero lastFault address,
 	// we should preserve it to the resulting merged-VMA
 	if vma1.lastFault == 0 {
@@ -499,6 +564,12 @@ func (vmaSetFunctions) Split(ar hostarch.AddrRange, v vma, split hostarch.Addr)
 	if v2.mappable != nil {
 		v2.off += uint64(split - ar.Start)
 	}
+	if v.referenced != 0 {
+		// v.referenced <= ar.Length(), so the quotient can't overflow.
+		hi, lo := bits.Mul64(v.referenced, uint64(split-ar.Start))
+		v.referenced, _ = bits.Div64(hi, lo, uint64(ar.Length()))
+		v2.referenced -= v.referenced
+	}
 	if v2.id != nil {
 		v2.id.IncRef()
 	}
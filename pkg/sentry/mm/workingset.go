@@ -0,0 +1,78 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mm
+
+import (
+	"github.com/wilinz/gvisor/pkg/hostarch"
+	"github.com/wilinz/gvisor/pkg/sentry/platform"
+)
+
+// SampleWorkingSet ends the current working set sampling interval and begins
+// a new one. It returns the number of bytes of mm's mappings that were
+// accessed during the interval that ended, and records per-vma access counts
+// that are reported as "Referenced" in /proc/[pid]/smaps.
+//
+// Accesses are observed through platform.AddressSpaceAccessTracker. If mm's
+// platform does not support access tracking, SampleWorkingSet returns (0,
+// false).
+func (mm *MemoryManager) SampleWorkingSet() (uint64, bool) {
+	mm.mappingMu.Lock()
+	defer mm.mappingMu.Unlock()
+	mm.activeMu.RLock()
+	defer mm.activeMu.RUnlock()
+
+	var tracker platform.AddressSpaceAccessTracker
+	if mm.as != nil {
+		var ok bool
+		if tracker, ok = mm.as.(platform.AddressSpaceAccessTracker); !ok {
+			return 0, false
+		}
+	} else if !mm.workingSetSampled {
+		// We can't tell whether access tracking is supported without an
+		// AddressSpace.
+		return 0, false
+	}
+	// If there is no active AddressSpace, none of mm's mappings can have been
+	// accessed since it was last active, so the working set is empty.
+
+	var total uint64
+	for vseg := mm.vmas.FirstSegment(); vseg.Ok(); vseg = vseg.NextSegment() {
+		vma := vseg.ValuePtr()
+		vma.referenced = 0
+		if tracker == nil {
+			continue
+		}
+		// Only ranges with pmas can be mapped into the AddressSpace.
+		vsegAR := vseg.Range()
+		for pseg := mm.pmas.LowerBoundSegment(vsegAR.Start); pseg.Ok() && pseg.Start() < vsegAR.End; pseg = pseg.NextSegment() {
+			tracker.TestAndClearAccessed(pseg.Range().Intersect(vsegAR), func(ar hostarch.AddrRange) {
+				vma.referenced += uint64(ar.Length())
+			})
+		}
+		total += vma.referenced
+	}
+	mm.workingSet = total
+	mm.workingSetSampled = true
+	return total, true
+}
+
+// WorkingSet returns the number of bytes of mm's mappings that were accessed
+// during the most recent working set sampling interval, and false if mm's
+// working set has never been sampled.
+func (mm *MemoryManager) WorkingSet() (uint64, bool) {
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	return mm.workingSet, mm.workingSetSampled
+}
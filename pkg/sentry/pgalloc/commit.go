@@ -0,0 +1,111 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgalloc
+
+import (
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/sentry/usage"
+)
+
+// CommitPolicy controls how MemoryFile.Commit charges address space, as
+// configured by /proc/sys/vm/overcommit_memory and
+// /proc/sys/vm/overcommit_ratio.
+type CommitPolicy struct {
+	// Mode is one of linux.OVERCOMMIT_*.
+	Mode int32
+
+	// Ratio is the percentage of total memory that may be committed in mode
+	// linux.OVERCOMMIT_NEVER.
+	Ratio int32
+}
+
+// DefaultCommitPolicy is the CommitPolicy used when none is specified, and
+// matches Linux's defaults.
+var DefaultCommitPolicy = CommitPolicy{
+	Mode:  linux.OVERCOMMIT_GUESS,
+	Ratio: 50,
+}
+
+// totalMemory returns the total memory size reported to applications, as in
+// /proc/meminfo:MemTotal.
+func (f *MemoryFile) totalMemory() uint64 {
+	return usage.TotalMemory(f.TotalSize(), usage.MemoryAccounting.Total())
+}
+
+// CommitLimit returns the maximum number of bytes that may be committed in
+// mode linux.OVERCOMMIT_NEVER with the given overcommit ratio, as in
+// /proc/meminfo:CommitLimit. Since there is no swap, this is simply the
+// given percentage of total memory.
+func (f *MemoryFile) CommitLimit(ratio int32) uint64 {
+	if ratio < 0 {
+		ratio = 0
+	}
+	return f.totalMemory() / 100 * uint64(ratio)
+}
+
+// Committed returns the number of bytes currently charged by Commit, as in
+// /proc/meminfo:Committed_AS.
+func (f *MemoryFile) Committed() uint64 {
+	return f.committedAS.Load()
+}
+
+// Commit charges length bytes of address space against f, subject to the
+// CommitPolicy from ctx. It returns ENOMEM if the charge would exceed the
+// policy's limit, in which case nothing is charged. This is analogous to
+// Linux's __vm_enough_memory().
+func (f *MemoryFile) Commit(ctx context.Context, length uint64) error {
+	if length == 0 {
+		return nil
+	}
+	policy := CommitPolicyFromContext(ctx)
+	switch policy.Mode {
+	case linux.OVERCOMMIT_ALWAYS:
+		f.committedAS.Add(length)
+		return nil
+	case linux.OVERCOMMIT_NEVER:
+		limit := f.CommitLimit(policy.Ratio)
+		for {
+			committed := f.committedAS.Load()
+			if committed+length < committed || committed+length > limit {
+				return linuxerr.ENOMEM
+			}
+			if f.committedAS.CompareAndSwap(committed, committed+length) {
+				return nil
+			}
+		}
+	default:
+		// Heuristic overcommit only rejects allocations that could never be
+		// satisfied.
+		if length > f.totalMemory() {
+			return linuxerr.ENOMEM
+		}
+		f.committedAS.Add(length)
+		return nil
+	}
+}
+
+// Uncommit releases length bytes previously charged by Commit.
+func (f *MemoryFile) Uncommit(length uint64) {
+	f.committedAS.Add(-length)
+}
+
+// RestoreCommitted recharges length bytes of address space without checking
+// the CommitPolicy. It is used to reestablish charges held by saved mappings
+// after restore.
+func (f *MemoryFile) RestoreCommitted(length uint64) {
+	f.committedAS.Add(length)
+}
@@ -31,6 +31,9 @@ const (
 	// CtxMemoryFileMap is a Context.Value key for mapping
 	// MemoryFileOpts.RestoreID to *MemoryFile. This is used for save/restore.
 	CtxMemoryFileMap
+
+	// CtxCommitPolicy is a Context.Value key for a CommitPolicy.
+	CtxCommitPolicy
 )
 
 // MemoryFileFromContext returns the MemoryFile used by ctx, or nil if no such
@@ -59,3 +62,12 @@ func MemoryFileMapFromContext(ctx context.Context) map[string]*MemoryFile {
 	}
 	return nil
 }
+
+// CommitPolicyFromContext returns the CommitPolicy used by ctx, or the
+// default CommitPolicy if ctx does not specify one.
+func CommitPolicyFromContext(ctx context.Context) CommitPolicy {
+	if v := ctx.Value(CtxCommitPolicy); v != nil {
+		return v.(CommitPolicy)
+	}
+	return DefaultCommitPolicy
+}
@@ -27,6 +27,7 @@ import (
 	"golang.org/x/sys/unix"
 	"github.com/wilinz/gvisor/pkg/abi/linux"
 	"github.com/wilinz/gvisor/pkg/atomicbitops"
+	"github.com/wilinz/gvisor/pkg/buffer"
 	"github.com/wilinz/gvisor/pkg/context"
 	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
 	"github.com/wilinz/gvisor/pkg/hostarch"
@@ -171,6 +172,11 @@ type MemoryFile struct {
 	// evictionWG counts the number of goroutines currently performing evictions.
 	evictionWG sync.WaitGroup
 
+	// committedAS is the number of bytes of address space that have been
+	// charged to this MemoryFile by Commit and not yet released by Uncommit.
+	// committedAS is analogous to Linux's vm_committed_as.
+	committedAS atomicbitops.Uint64
+
 	// opts holds options passed to NewMemoryFile. opts is immutable.
 	opts MemoryFileOpts
 
@@ -1099,6 +1105,33 @@ func (f *MemoryFile) Decommit(fr memmap.FileRange) {
 	})
 }
 
+// SetMemoryCgroupID changes the memory cgroup to which the given pages are
+// accounted to memCgID, moving any usage already charged for them.
+//
+// Preconditions:
+//   - fr.Start and fr.End must be page-aligned.
+//   - fr.Length() > 0.
+//   - At least one reference must be held on all pages in fr.
+func (f *MemoryFile) SetMemoryCgroupID(fr memmap.FileRange, memCgID uint32) {
+	if !fr.WellFormed() || fr.Length() == 0 || fr.Start%hostarch.PageSize != 0 || fr.End%hostarch.PageSize != 0 {
+		panic(fmt.Sprintf("invalid range: %v", fr))
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.memAcct.MutateFullRange(fr, func(maseg memAcctIterator) bool {
+		ma := maseg.ValuePtr()
+		if ma.memCgID == memCgID {
+			return true
+		}
+		if ma.knownCommitted && !f.opts.DisableMemoryAccounting {
+			usage.MemoryAccounting.MoveCgroup(maseg.Range().Length(), ma.kind, ma.memCgID, memCgID)
+		}
+		ma.memCgID = memCgID
+		return true
+	})
+}
+
 func (f *MemoryFile) commitFile(fr memmap.FileRange) error {
 	// "The default operation (i.e., mode is zero) of fallocate() allocates the
 	// disk space within the range specified by offset and len." - fallocate(2)
@@ -1284,15 +1317,7 @@ MainLoop:
 		// unwasteHuge, and higher offsets before lower ones.
 		for i, unwaste := range []*unwasteSet{&f.unwasteSmall, &f.unwasteHuge} {
 			if uwgap := unwaste.LastLargeEnoughGap(1); uwgap.Ok() {
-				fr := uwgap.Range()
-				// Linux serializes fallocate()s on shmem files, so limit the amount we
-				// release at once to avoid starving Decommit().
-				const maxReleasingBytes = 128 << 20 // 128 MB
-				if fr.Length() > maxReleasingBytes {
-					fr.Start = fr.End - maxReleasingBytes
-				}
-				unwaste.Insert(uwgap, fr, unwasteInfo{})
-				f.releaseLocked(fr, i == 1)
+				f.releaseGapLocked(unwaste, uwgap, i == 1)
 				continue MainLoop
 			}
 		}
@@ -1300,6 +1325,43 @@ MainLoop:
 	}
 }
 
+// releaseGapLocked releases the waste pages at the end of uwgap, a gap in
+// unwaste.
+//
+// Preconditions: f.mu must be locked; it may be unlocked and reacquired.
+func (f *MemoryFile) releaseGapLocked(unwaste *unwasteSet, uwgap unwasteGapIterator, huge bool) {
+	fr := uwgap.Range()
+	// Linux serializes fallocate()s on shmem files, so limit the amount we
+	// release at once to avoid starving Decommit().
+	const maxReleasingBytes = 128 << 20 // 128 MB
+	if fr.Length() > maxReleasingBytes {
+		fr.Start = fr.End - maxReleasingBytes
+	}
+	unwaste.Insert(uwgap, fr, unwasteInfo{})
+	f.releaseLocked(fr, huge)
+}
+
+// ReleaseWaste releases all waste pages, which are freed but not yet
+// decommitted, before returning. Waste pages are otherwise released
+// asynchronously by the releaser goroutine, which may lag behind when many
+// pages are freed at once. Since decommitting punches holes in the backing
+// file, this returns their memory to the host, and removes the pages from
+// all mappings of the file, including the guest physical memory of platforms
+// that map it.
+func (f *MemoryFile) ReleaseWaste() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, unwaste := range []*unwasteSet{&f.unwasteSmall, &f.unwasteHuge} {
+		for !f.destroyed {
+			uwgap := unwaste.LastLargeEnoughGap(1)
+			if !uwgap.Ok() {
+				break
+			}
+			f.releaseGapLocked(unwaste, uwgap, i == 1)
+		}
+	}
+}
+
 // Preconditions: f.mu must be locked; it may be unlocked and reacquired.
 func (f *MemoryFile) releaseLocked(fr memmap.FileRange, huge bool) {
 	defer func() {
@@ -1395,6 +1457,7 @@ func (f *MemoryFile) releaseLocked(fr memmap.FileRange, huge bool) {
 			decommitFR.Start = firstHugeStart
 			freeFR.Start = firstHugeStart
 		} else {
+			f.subreleased[firstHugeStart] = newSubrel
 			decommitFR.Start = fr.Start
 			freeFR.Start = firstHugeEnd
 		}
@@ -1413,6 +1476,7 @@ func (f *MemoryFile) releaseLocked(fr memmap.FileRange, huge bool) {
 			decommitFR.End = lastHugeEnd
 			freeFR.End = lastHugeEnd
 		} else {
+			f.subreleased[lastHugeStart] = newSubrel
 			decommitFR.End = fr.End
 			freeFR.End = lastHugeStart
 		}
@@ -1456,6 +1520,34 @@ func (f *MemoryFile) MapInternal(fr memmap.FileRange, at hostarch.AccessType) (s
 	return safemem.BlockSeqFromSlice(blocks), nil
 }
 
+// AppendToBuffer appends the contents of fr to dst without copying. Each
+// appended view holds a reference on the pages it maps, which is dropped when
+// the view is released, so the caller may drop its own references on fr once
+// AppendToBuffer returns.
+//
+// Since the appended views alias f, writes to fr are visible through dst
+// until they are released.
+func (f *MemoryFile) AppendToBuffer(dst *buffer.Buffer, fr memmap.FileRange) error {
+	ims, err := f.MapInternal(fr, hostarch.Read)
+	if err != nil {
+		return err
+	}
+	off := fr.Start
+	for !ims.IsEmpty() {
+		b := ims.Head()
+		ims = ims.Tail()
+		blockFR := memmap.FileRange{off, off + uint64(b.Len())}
+		off = blockFR.End
+		end, _ := hostarch.PageRoundUp(blockFR.End)
+		refFR := memmap.FileRange{hostarch.PageRoundDown(blockFR.Start), end}
+		f.IncRef(refFR, 0 /* memCgID */)
+		dst.Append(buffer.NewViewWithExternalData(b.ToSlice(), func() {
+			f.DecRef(refFR)
+		}))
+	}
+	return nil
+}
+
 // forEachMappingSlice invokes fn on a sequence of byte slices that
 // collectively map all bytes in fr.
 func (f *MemoryFile) forEachMappingSlice(fr memmap.FileRange, fn func([]byte)) {
@@ -15,8 +15,10 @@
 package pgalloc
 
 import (
+	"os"
 	"testing"
 
+	"golang.org/x/sys/unix"
 	"github.com/wilinz/gvisor/pkg/hostarch"
 	"github.com/wilinz/gvisor/pkg/sentry/memmap"
 )
@@ -42,6 +44,55 @@ const (
 	existingReleasing // or sub-releasing
 )
 
+// newFakeMemoryFile returns a MemoryFile with chunks of the given hugeness,
+// whose pages are in the given states and otherwise free. The returned
+// MemoryFile has no releaser goroutine, and no backing file unless the caller
+// sets one.
+func newFakeMemoryFile(t *testing.T, chunkHuge []bool, existing []existingSegment) *MemoryFile {
+	f := &MemoryFile{
+		opts: MemoryFileOpts{
+			ExpectHugepages:         true,
+			DisableMemoryAccounting: true,
+		},
+	}
+	f.initFields()
+	chunks := make([]chunkInfo, len(chunkHuge))
+	for i, huge := range chunkHuge {
+		chunks[i].huge = huge
+		chunkFR := memmap.FileRange{uint64(i) * chunkSize, uint64(i+1) * chunkSize}
+		if huge {
+			f.unfreeHuge.RemoveRange(chunkFR)
+		} else {
+			f.unfreeSmall.RemoveRange(chunkFR)
+		}
+	}
+	f.chunks.Store(&chunks)
+	for _, es := range existing {
+		f.forEachChunk(memmap.FileRange{es.start, es.end}, func(chunk *chunkInfo, chunkFR memmap.FileRange) bool {
+			unwaste, unfree := &f.unwasteSmall, &f.unfreeSmall
+			if chunk.huge {
+				unwaste, unfree = &f.unwasteHuge, &f.unfreeHuge
+			}
+			switch es.state {
+			case existingUsed:
+				unfree.InsertRange(chunkFR, unfreeInfo{refs: 1})
+			case existingWaste:
+				unfree.InsertRange(chunkFR, unfreeInfo{refs: 0})
+				unwaste.RemoveRange(chunkFR)
+			case existingReleasing:
+				unfree.InsertRange(chunkFR, unfreeInfo{refs: 0})
+			default:
+				t.Fatalf("existingSegment %+v has unknown state", es)
+			}
+			f.memAcct.InsertRange(chunkFR, memAcctInfo{
+				wasteOrReleasing: es.state != existingUsed,
+			})
+			return true
+		})
+	}
+	return f
+}
+
 func TestFindAllocatable(t *testing.T) {
 	for _, test := range []struct {
 		name string
@@ -514,48 +565,7 @@ func TestFindAllocatable(t *testing.T) {
 		},
 	} {
 		t.Run(test.name, func(t *testing.T) {
-			// Build the fake MemoryFile.
-			f := &MemoryFile{
-				opts: MemoryFileOpts{
-					ExpectHugepages:         true,
-					DisableMemoryAccounting: true,
-				},
-			}
-			f.initFields()
-			chunks := make([]chunkInfo, len(test.chunkHuge))
-			for i, huge := range test.chunkHuge {
-				chunks[i].huge = huge
-				chunkFR := memmap.FileRange{uint64(i) * chunkSize, uint64(i+1) * chunkSize}
-				if huge {
-					f.unfreeHuge.RemoveRange(chunkFR)
-				} else {
-					f.unfreeSmall.RemoveRange(chunkFR)
-				}
-			}
-			f.chunks.Store(&chunks)
-			for _, es := range test.existing {
-				f.forEachChunk(memmap.FileRange{es.start, es.end}, func(chunk *chunkInfo, chunkFR memmap.FileRange) bool {
-					unwaste, unfree := &f.unwasteSmall, &f.unfreeSmall
-					if chunk.huge {
-						unwaste, unfree = &f.unwasteHuge, &f.unfreeHuge
-					}
-					switch es.state {
-					case existingUsed:
-						unfree.InsertRange(chunkFR, unfreeInfo{refs: 1})
-					case existingWaste:
-						unfree.InsertRange(chunkFR, unfreeInfo{refs: 0})
-						unwaste.RemoveRange(chunkFR)
-					case existingReleasing:
-						unfree.InsertRange(chunkFR, unfreeInfo{refs: 0})
-					default:
-						t.Fatalf("existingSegment %+v has unknown state", es)
-					}
-					f.memAcct.InsertRange(chunkFR, memAcctInfo{
-						wasteOrReleasing: es.state != existingUsed,
-					})
-					return true
-				})
-			}
+			f := newFakeMemoryFile(t, test.chunkHuge, test.existing)
 
 			// Perform the test allocation.
 			alloc := allocState{
@@ -583,3 +593,183 @@ func TestFindAllocatable(t *testing.T) {
 		})
 	}
 }
+
+func TestReleaseWaste(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		// Initial state:
+		chunkHuge []bool
+		existing  []existingSegment
+		// Expected outcome:
+		wantFree        []memmap.FileRange
+		wantSubreleased map[uint64]uint64
+	}{
+		{
+			name:      "small waste",
+			chunkHuge: []bool{false},
+			existing: []existingSegment{
+				{0, page, existingUsed},
+				{page, 3 * page, existingWaste},
+				{3 * page, 4 * page, existingUsed},
+			},
+			wantFree: []memmap.FileRange{{page, 3 * page}},
+		},
+		{
+			name:      "small waste spanning small chunks",
+			chunkHuge: []bool{false, false},
+			existing: []existingSegment{
+				{chunkSize - 3*page, chunkSize - 2*page, existingUsed},
+				{chunkSize - 2*page, chunkSize + 2*page, existingWaste},
+				{chunkSize + 2*page, chunkSize + 3*page, existingUsed},
+			},
+			wantFree: []memmap.FileRange{{chunkSize - 2*page, chunkSize + 2*page}},
+		},
+		{
+			name:      "waste spanning small and huge chunks",
+			chunkHuge: []bool{false, true},
+			existing: []existingSegment{
+				{chunkSize - 2*page, chunkSize - page, existingUsed},
+				{chunkSize - page, chunkSize + hugepage, existingWaste},
+				{chunkSize + hugepage, chunkSize + 2*hugepage, existingUsed},
+			},
+			wantFree: []memmap.FileRange{{chunkSize - page, chunkSize + hugepage}},
+		},
+		{
+			name:      "huge waste spanning huge chunks",
+			chunkHuge: []bool{true, true},
+			existing: []existingSegment{
+				{chunkSize - 2*hugepage, chunkSize - hugepage, existingUsed},
+				{chunkSize - hugepage, chunkSize + hugepage, existingWaste},
+				{chunkSize + hugepage, chunkSize + 2*hugepage, existingUsed},
+			},
+			wantFree: []memmap.FileRange{{chunkSize - hugepage, chunkSize + hugepage}},
+		},
+		{
+			name:      "small waste in huge page at end of chunk",
+			chunkHuge: []bool{true, true},
+			existing: []existingSegment{
+				{chunkSize - hugepage, chunkSize - page, existingUsed},
+				{chunkSize - page, chunkSize + page, existingWaste},
+				{chunkSize + page, chunkSize + hugepage, existingUsed},
+			},
+			wantSubreleased: map[uint64]uint64{
+				chunkSize - hugepage: 1,
+				chunkSize:            1,
+			},
+		},
+		{
+			name:      "small waste completing sub-released huge page",
+			chunkHuge: []bool{true},
+			existing: []existingSegment{
+				{0, page, existingReleasing},
+				{page, hugepage, existingWaste},
+			},
+			wantFree: []memmap.FileRange{{0, hugepage}},
+		},
+		{
+			name:      "waste spanning huge pages completing sub-released huge page",
+			chunkHuge: []bool{true, true},
+			existing: []existingSegment{
+				{chunkSize - hugepage, chunkSize - page, existingReleasing},
+				{chunkSize - page, chunkSize + page, existingWaste},
+				{chunkSize + page, chunkSize + hugepage, existingUsed},
+			},
+			wantFree: []memmap.FileRange{{chunkSize - hugepage, chunkSize}},
+			wantSubreleased: map[uint64]uint64{
+				chunkSize: 1,
+			},
+		},
+		{
+			name:      "more waste than is released at once",
+			chunkHuge: []bool{false},
+			existing: []existingSegment{
+				{0, 300 << 20, existingWaste},
+			},
+			wantFree: []memmap.FileRange{{0, 300 << 20}},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			f := newFakeMemoryFile(t, test.chunkHuge, test.existing)
+			for _, es := range test.existing {
+				if es.state == existingReleasing {
+					// Releasing pages in these tests are the sub-released
+					// pages of their huge page.
+					f.subreleased[hostarch.HugePageRoundDown(es.start)] += (es.end - es.start) / page
+				}
+			}
+			fd, err := unix.MemfdCreate("pgalloc_test", 0)
+			if err != nil {
+				t.Fatalf("MemfdCreate: %v", err)
+			}
+			f.file = os.NewFile(uintptr(fd), "pgalloc_test")
+			defer f.file.Close()
+			if err := f.file.Truncate(int64(len(test.chunkHuge)) * chunkSize); err != nil {
+				t.Fatalf("Truncate: %v", err)
+			}
+			// Mark the first and last page of every existing segment.
+			for _, es := range test.existing {
+				for _, off := range []uint64{es.start, es.end - page} {
+					if _, err := f.file.WriteAt([]byte{1}, int64(off)); err != nil {
+						t.Fatalf("WriteAt(%#x): %v", off, err)
+					}
+				}
+			}
+
+			f.ReleaseWaste()
+
+			for _, unwaste := range []*unwasteSet{&f.unwasteSmall, &f.unwasteHuge} {
+				if uwgap := unwaste.LastLargeEnoughGap(1); uwgap.Ok() {
+					t.Errorf("waste pages %v remain after ReleaseWaste\n%v", uwgap.Range(), f)
+				}
+			}
+			for _, fr := range test.wantFree {
+				f.forEachChunk(fr, func(chunk *chunkInfo, chunkFR memmap.FileRange) bool {
+					unfree := &f.unfreeSmall
+					if chunk.huge {
+						unfree = &f.unfreeHuge
+					}
+					if !unfree.IsEmptyRange(chunkFR) {
+						t.Errorf("pages %v are not free after ReleaseWaste\n%v", chunkFR, f)
+					}
+					return true
+				})
+			}
+			for _, es := range test.existing {
+				if es.state != existingWaste {
+					continue
+				}
+				if !f.memAcct.IsEmptyRange(memmap.FileRange{es.start, es.end}) {
+					t.Errorf("waste pages [%#x, %#x) are still accounted for after ReleaseWaste\n%v", es.start, es.end, f)
+				}
+			}
+			if len(f.subreleased) != len(test.wantSubreleased) {
+				t.Errorf("subreleased: got %v, want %v", f.subreleased, test.wantSubreleased)
+			}
+			for start, want := range test.wantSubreleased {
+				if got := f.subreleased[start]; got != want {
+					t.Errorf("subreleased[%#x]: got %d, want %d", start, got, want)
+				}
+			}
+			// Released pages must have been decommitted, while used pages
+			// keep their contents.
+			for _, es := range test.existing {
+				var want byte
+				if es.state == existingUsed {
+					want = 1
+				}
+				for _, off := range []uint64{es.start, es.end - page} {
+					if es.state == existingReleasing {
+						continue
+					}
+					var b [1]byte
+					if _, err := f.file.ReadAt(b[:], int64(off)); err != nil {
+						t.Fatalf("ReadAt(%#x): %v", off, err)
+					}
+					if b[0] != want {
+						t.Errorf("byte at %#x: got %d, want %d", off, b[0], want)
+					}
+				}
+			}
+		})
+	}
+}
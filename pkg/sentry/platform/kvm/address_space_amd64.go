@@ -14,6 +14,10 @@
 
 package kvm
 
+import (
+	"github.com/wilinz/gvisor/pkg/hostarch"
+)
+
 // invalidate is the implementation for Invalidate.
 func (as *addressSpace) invalidate() {
 	timer := asInvalidateDuration.Start()
@@ -24,3 +28,33 @@ func (as *addressSpace) invalidate() {
 	})
 	timer.Finish()
 }
+
+// TestAndClearAccessed implements
+// platform.AddressSpaceAccessTracker.TestAndClearAccessed.
+//
+// On x86, hardware sets accessed bits in the guest page tables, so they can be
+// sampled directly. This is only implemented on amd64; see
+// pagetables.PTE.testAndClearAccessed on arm64.
+func (as *addressSpace) TestAndClearAccessed(ar hostarch.AddrRange, fn func(ar hostarch.AddrRange)) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	// Page table modifications must be made in guest mode; see
+	// bluepill_allocator.go.
+	as.pageTables.Allocator.(*allocator).cpu = as.machine.Get()
+	defer as.machine.Put(as.pageTables.Allocator.(*allocator).cpu)
+	bluepill(as.pageTables.Allocator.(*allocator).cpu)
+
+	var accessed []hostarch.AddrRange
+	as.pageTables.TestAndClearAccessed(ar.Start, uintptr(ar.Length()), func(start, length uintptr) {
+		accessed = append(accessed, hostarch.AddrRange{hostarch.Addr(start), hostarch.Addr(start + length)}.Intersect(ar))
+	})
+	if len(accessed) != 0 {
+		// Flush TLBs so that subsequent accesses through cached translations
+		// set accessed bits again.
+		as.invalidate()
+	}
+	for _, accessedAR := range accessed {
+		fn(accessedAR)
+	}
+}
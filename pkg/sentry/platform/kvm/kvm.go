@@ -25,6 +25,7 @@ import (
 	"github.com/wilinz/gvisor/pkg/ring0"
 	"github.com/wilinz/gvisor/pkg/ring0/pagetables"
 	"github.com/wilinz/gvisor/pkg/sentry/platform"
+	ktime "github.com/wilinz/gvisor/pkg/sentry/time"
 	"github.com/wilinz/gvisor/pkg/sync"
 )
 
@@ -182,6 +183,15 @@ func (k *KVM) NewContext(pkgcontext.Context) platform.Context {
 	}
 }
 
+// WrapClocks implements platform.ClocksWrapper.WrapClocks.
+//
+// The sentry reads its clocks from guest mode, where a blocked lock or a
+// host syscall requires an exit from the guest. The clocks are read from a
+// kvmclock-style parameter page instead, which only needs the TSC.
+func (*KVM) WrapClocks(c ktime.Clocks) ktime.Clocks {
+	return ktime.NewPVClocks(c)
+}
+
 type constructor struct{}
 
 func (*constructor) New(f *fd.FD) (platform.Platform, error) {
@@ -30,6 +30,7 @@ import (
 	"github.com/wilinz/gvisor/pkg/sentry/arch"
 	"github.com/wilinz/gvisor/pkg/sentry/hostmm"
 	"github.com/wilinz/gvisor/pkg/sentry/memmap"
+	sentrytime "github.com/wilinz/gvisor/pkg/sentry/time"
 	"github.com/wilinz/gvisor/pkg/usermem"
 )
 
@@ -126,6 +127,24 @@ type Platform interface {
 	SeccompInfo() SeccompInfo
 }
 
+// ClocksWrapper is an optional interface implemented by Platforms that
+// require the sentry's clocks to be read in a specific way, e.g. without host
+// syscalls.
+type ClocksWrapper interface {
+	// WrapClocks returns the clocks the sentry should use, which are backed
+	// by c.
+	WrapClocks(c sentrytime.Clocks) sentrytime.Clocks
+}
+
+// WrapClocks returns c wrapped by p, if p implements ClocksWrapper, or c
+// otherwise.
+func WrapClocks(p Platform, c sentrytime.Clocks) sentrytime.Clocks {
+	if w, ok := p.(ClocksWrapper); ok {
+		return w.WrapClocks(c)
+	}
+	return c
+}
+
 // NoCPUPreemptionDetection implements Platform.DetectsCPUPreemption and
 // dependent methods for Platforms that do not support this feature.
 type NoCPUPreemptionDetection struct{}
@@ -367,6 +386,18 @@ type AddressSpace interface {
 	AddressSpaceIO
 }
 
+// AddressSpaceAccessTracker is an optional interface implemented by
+// AddressSpaces that can observe whether their mappings have been accessed,
+// e.g. using hardware accessed bits.
+type AddressSpaceAccessTracker interface {
+	// TestAndClearAccessed clears the accessed state of all mappings in ar,
+	// and calls fn with each subrange of ar that has been accessed since the
+	// previous call to TestAndClearAccessed or since it was mapped.
+	//
+	// Preconditions: ar must be page-aligned.
+	TestAndClearAccessed(ar hostarch.AddrRange, fn func(ar hostarch.AddrRange))
+}
+
 // AddressSpaceIO supports IO through the memory mappings installed in an
 // AddressSpace.
 //
@@ -559,6 +590,15 @@ type Constructor interface {
 	PrecompiledSeccompInfo() []SeccompInfo
 }
 
+// HostSupportChecker is implemented by Constructors that can check whether
+// the host supports their platform without creating it.
+type HostSupportChecker interface {
+	// CheckHostSupport returns an error describing the first host feature
+	// required by the platform that is missing, or nil if the platform can
+	// be used on this host.
+	CheckHostSupport() error
+}
+
 // platforms contains all available platform types.
 var platforms = map[string]Constructor{}
 
@@ -34,14 +34,21 @@ const (
 
 // resetSysemuRegs sets up emulation registers.
 //
-// This should be called prior to calling sysemu.
+// This should be called prior to calling sysemu. The code segment of 32-bit
+// compatibility mode tasks is kept, along with the data segments they need.
 func (t *thread) resetSysemuRegs(regs *arch.Registers) {
+	compat := regs.Cs == arch.User32CS
 	regs.Cs = t.initRegs.Cs
 	regs.Ss = t.initRegs.Ss
 	regs.Ds = t.initRegs.Ds
 	regs.Es = t.initRegs.Es
 	regs.Fs = t.initRegs.Fs
 	regs.Gs = t.initRegs.Gs
+	if compat {
+		regs.Cs = arch.User32CS
+		regs.Ds = arch.UserDS
+		regs.Es = arch.UserDS
+	}
 }
 
 // createSyscallRegs sets up syscall registers.
@@ -0,0 +1,57 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systrap
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/hostsyscall"
+	"github.com/wilinz/gvisor/pkg/seccomp"
+)
+
+// CheckHostSupport implements platform.HostSupportChecker.CheckHostSupport.
+//
+// Systrap stubs trap application syscalls with a seccomp filter returning
+// SECCOMP_RET_TRAP, so the host kernel must support seccomp filters and that
+// action. Like the ptrace platform, systrap also requires CAP_SYS_PTRACE,
+// which is not checked here.
+func (*constructor) CheckHostSupport() error {
+	// A filter with a NULL program fails with EFAULT if filters are
+	// supported at all.
+	switch errno := hostsyscall.RawSyscallErrno(seccomp.SYS_SECCOMP, linux.SECCOMP_SET_MODE_FILTER, 0, 0); errno {
+	case unix.EFAULT:
+	case unix.ENOSYS:
+		return fmt.Errorf("the host kernel doesn't support seccomp(2) (requires CONFIG_SECCOMP)")
+	case unix.EINVAL:
+		return fmt.Errorf("the host kernel doesn't support seccomp filters (requires CONFIG_SECCOMP_FILTER)")
+	default:
+		return fmt.Errorf("probing seccomp filter support: %v", errno)
+	}
+
+	switch errno := seccompActionAvailable(linux.SECCOMP_RET_TRAP); errno {
+	case 0:
+	case unix.EINVAL:
+		// SECCOMP_GET_ACTION_AVAIL was added in Linux 4.14, and
+		// SECCOMP_RET_TRAP has been available since seccomp filters
+		// were added.
+	case unix.EOPNOTSUPP:
+		return fmt.Errorf("the host kernel doesn't support the SECCOMP_RET_TRAP seccomp action")
+	default:
+		return fmt.Errorf("probing SECCOMP_RET_TRAP support: %v", errno)
+	}
+	return nil
+}
@@ -37,14 +37,21 @@ const (
 
 // resetSysemuRegs sets up emulation registers.
 //
-// This should be called prior to calling sysemu.
+// This should be called prior to calling sysemu. The code segment of 32-bit
+// compatibility mode tasks is kept, along with the data segments they need.
 func (s *subprocess) resetSysemuRegs(regs *arch.Registers) {
+	compat := regs.Cs == arch.User32CS
 	regs.Cs = s.sysmsgInitRegs.Cs
 	regs.Ss = s.sysmsgInitRegs.Ss
 	regs.Ds = s.sysmsgInitRegs.Ds
 	regs.Es = s.sysmsgInitRegs.Es
 	regs.Fs = s.sysmsgInitRegs.Fs
 	regs.Gs = s.sysmsgInitRegs.Gs
+	if compat {
+		regs.Cs = arch.User32CS
+		regs.Ds = arch.UserDS
+		regs.Es = arch.UserDS
+	}
 }
 
 // createSyscallRegs sets up syscall registers.
@@ -34,6 +34,9 @@
 
 #ifndef X86_TRAP_PF
 #define X86_TRAP_PF 14
+
+// USER32_CS is the code segment selector of 32-bit compatibility mode.
+#define USER32_CS 0x23
 #endif
 
 // TODO(b/271631387): These globals are shared between AMD64 and ARM64; move to
@@ -131,6 +134,14 @@ static void ptregs_to_gregs(ucontext_t *ucontext,
   csgsfs.gs = ptregs->gs;
 
   ucontext->uc_mcontext.gregs[REG_CSGSFS] = csgsfs.csgsfs;
+
+  if (ptregs->cs == USER32_CS) {
+    // Data segments aren't a part of 64-bit signal frames, but 32-bit
+    // compatibility mode code can't access memory with null ones.
+    asm volatile("movw %w0, %%ds\n\tmovw %w0, %%es"
+                 :
+                 : "r"((uint16_t)ptregs->ds));
+  }
 }
 
 // get_fsbase writes the current thread's fsbase value to ptregs.
@@ -305,9 +316,12 @@ void __export_sighandler(int signo, siginfo_t *siginfo, void *_ucontext) {
       }
       ctx->ptregs.orig_rax = ctx->ptregs.rax;
       ctx->ptregs.rax = (unsigned long)-ENOSYS;
-      if (siginfo->si_arch != AUDIT_ARCH_X86_64)
+      if (siginfo->si_arch != AUDIT_ARCH_X86_64 &&
+          !(siginfo->si_arch == AUDIT_ARCH_I386 &&
+            ctx->ptregs.cs == USER32_CS))
         // gVisor doesn't support x32 system calls, so let's change the syscall
-        // number so that it returns ENOSYS.
+        // number so that it returns ENOSYS. i386 system calls of 32-bit
+        // compatibility mode code are handled by the Sentry.
         ctx->ptregs.orig_rax += 0x86000000;
       break;
     }
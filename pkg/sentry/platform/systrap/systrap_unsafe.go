@@ -21,6 +21,7 @@ import (
 	"github.com/wilinz/gvisor/pkg/abi/linux"
 	"github.com/wilinz/gvisor/pkg/hostarch"
 	"github.com/wilinz/gvisor/pkg/hostsyscall"
+	"github.com/wilinz/gvisor/pkg/seccomp"
 	"github.com/wilinz/gvisor/pkg/sentry/arch"
 )
 
@@ -139,3 +140,9 @@ func (t *thread) getEventMessage() (uintptr, error) {
 	}
 	return msg, nil
 }
+
+// seccompActionAvailable calls seccomp(SECCOMP_GET_ACTION_AVAIL) for action.
+func seccompActionAvailable(action linux.BPFAction) unix.Errno {
+	a := uint32(action)
+	return hostsyscall.RawSyscallErrno(seccomp.SYS_SECCOMP, linux.SECCOMP_GET_ACTION_AVAIL, 0, uintptr(unsafe.Pointer(&a)))
+}
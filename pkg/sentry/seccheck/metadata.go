@@ -30,6 +30,7 @@ const (
 	PointExecve
 	PointExitNotifyParent
 	PointTaskExit
+	PointStrace
 
 	// Add new Points above this line.
 	pointLengthBeforeSyscalls
@@ -294,6 +295,11 @@ func genericInit() {
 		Name:          "sentry/task_exit",
 		ContextFields: defaultContextFields,
 	})
+	registerPoint(PointDesc{
+		ID:            PointStrace,
+		Name:          "sentry/strace",
+		ContextFields: defaultContextFields,
+	})
 }
 
 var initOnce sync.Once
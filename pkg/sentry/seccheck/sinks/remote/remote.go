@@ -265,6 +265,12 @@ func (r *remote) TaskExit(_ context.Context, _ seccheck.FieldSet, info *pb.TaskE
 	return nil
 }
 
+// Strace implements seccheck.Sink.
+func (r *remote) Strace(_ context.Context, _ seccheck.FieldSet, info *pb.StraceInfo) error {
+	r.write(info, pb.MessageType_MESSAGE_SENTRY_STRACE)
+	return nil
+}
+
 // ContainerStart implements seccheck.Sink.
 func (r *remote) ContainerStart(_ context.Context, _ seccheck.FieldSet, info *pb.Start) error {
 	r.write(info, pb.MessageType_MESSAGE_CONTAINER_START)
@@ -207,6 +207,20 @@ func PackTimestamp(t *kernel.Task, timestamp time.Time, buf []byte) []byte {
 	)
 }
 
+// PackTimestamping packs a SCM_TIMESTAMPING socket control message carrying a
+// software timestamp.
+func PackTimestamping(t *kernel.Task, timestamp time.Time, buf []byte) []byte {
+	var ts linux.ScmTimestamping
+	ts.Ts[0] = linux.NsecToTimespec(timestamp.UnixNano())
+	return putCmsgStruct(
+		buf,
+		linux.SOL_SOCKET,
+		linux.SCM_TIMESTAMPING,
+		t.Arch().Width(),
+		&ts,
+	)
+}
+
 // PackInq packs a TCP_INQ socket control message.
 func PackInq(t *kernel.Task, inq int32, buf []byte) []byte {
 	return putCmsgStruct(
@@ -313,6 +327,39 @@ func PackSockExtendedErr(t *kernel.Task, sockErr linux.SockErrCMsg, buf []byte)
 	)
 }
 
+// PackTLSRecordType packs a TLS_GET_RECORD_TYPE socket control message.
+func PackTLSRecordType(t *kernel.Task, recordType uint8, buf []byte) []byte {
+	return putCmsgStruct(
+		buf,
+		linux.SOL_TLS,
+		linux.TLS_GET_RECORD_TYPE,
+		t.Arch().Width(),
+		primitive.AllocateUint8(recordType),
+	)
+}
+
+// PackUDPGRO packs a UDP_GRO socket control message.
+func PackUDPGRO(t *kernel.Task, groSize uint16, buf []byte) []byte {
+	return putCmsgStruct(
+		buf,
+		linux.SOL_UDP,
+		linux.UDP_GRO,
+		t.Arch().Width(),
+		primitive.AllocateInt32(int32(groSize)),
+	)
+}
+
+// PackDropCount packs a SO_RXQ_OVFL socket control message.
+func PackDropCount(t *kernel.Task, dropCount uint32, buf []byte) []byte {
+	return putCmsgStruct(
+		buf,
+		linux.SOL_SOCKET,
+		linux.SO_RXQ_OVFL,
+		t.Arch().Width(),
+		primitive.AllocateUint32(dropCount),
+	)
+}
+
 // PackControlMessages packs control messages into the given buffer.
 //
 // We skip control messages specific to Unix domain sockets.
@@ -324,6 +371,16 @@ func PackControlMessages(t *kernel.Task, cmsgs socket.ControlMessages, buf []byt
 		buf = PackTimestamp(t, cmsgs.IP.Timestamp, buf)
 	}
 
+	if cmsgs.IP.HasTimestamping {
+		// In Linux, SCM_TIMESTAMPING is added after SO_TIMESTAMP.
+		buf = PackTimestamping(t, cmsgs.IP.Timestamping, buf)
+	}
+
+	if cmsgs.IP.HasDropCount {
+		// In Linux, SO_RXQ_OVFL is added after SO_TIMESTAMP.
+		buf = PackDropCount(t, cmsgs.IP.DropCount, buf)
+	}
+
 	if cmsgs.IP.HasInq {
 		// In Linux, TCP_CM_INQ is added after SO_TIMESTAMP.
 		buf = PackInq(t, cmsgs.IP.Inq, buf)
@@ -361,6 +418,14 @@ func PackControlMessages(t *kernel.Task, cmsgs socket.ControlMessages, buf []byt
 		buf = PackSockExtendedErr(t, cmsgs.IP.SockErr, buf)
 	}
 
+	if cmsgs.IP.HasTLSRecordType {
+		buf = PackTLSRecordType(t, cmsgs.IP.TLSRecordType, buf)
+	}
+
+	if cmsgs.IP.HasGROSize {
+		buf = PackUDPGRO(t, cmsgs.IP.GROSize, buf)
+	}
+
 	return buf
 }
 
@@ -378,6 +443,14 @@ func CmsgsSpace(t *kernel.Task, cmsgs socket.ControlMessages) int {
 		space += cmsgSpace(t, linux.SizeOfTimeval)
 	}
 
+	if cmsgs.IP.HasTimestamping {
+		space += cmsgSpace(t, linux.SizeOfScmTimestamping)
+	}
+
+	if cmsgs.IP.HasDropCount {
+		space += cmsgSpace(t, 4)
+	}
+
 	if cmsgs.IP.HasInq {
 		space += cmsgSpace(t, linux.SizeOfControlMessageInq)
 	}
@@ -414,6 +487,14 @@ func CmsgsSpace(t *kernel.Task, cmsgs socket.ControlMessages) int {
 		space += cmsgSpace(t, cmsgs.IP.SockErr.SizeBytes())
 	}
 
+	if cmsgs.IP.HasTLSRecordType {
+		space += cmsgSpace(t, 1)
+	}
+
+	if cmsgs.IP.HasGROSize {
+		space += cmsgSpace(t, 4)
+	}
+
 	return space
 }
 
@@ -589,6 +670,32 @@ func Parse(t *kernel.Task, socketOrEndpoint any, buf []byte, width uint) (socket
 				errCmsg.UnmarshalBytes(buf)
 				cmsgs.IP.SockErr = &errCmsg
 
+			default:
+				return socket.ControlMessages{}, linuxerr.EINVAL
+			}
+		case linux.SOL_UDP:
+			switch h.Type {
+			case linux.UDP_SEGMENT:
+				var gsoSize primitive.Uint16
+				if length < gsoSize.SizeBytes() {
+					return socket.ControlMessages{}, linuxerr.EINVAL
+				}
+				gsoSize.UnmarshalUnsafe(buf)
+				cmsgs.IP.HasGSOSize = true
+				cmsgs.IP.GSOSize = uint16(gsoSize)
+
+			default:
+				return socket.ControlMessages{}, linuxerr.EINVAL
+			}
+		case linux.SOL_TLS:
+			switch h.Type {
+			case linux.TLS_SET_RECORD_TYPE:
+				if length < 1 {
+					return socket.ControlMessages{}, linuxerr.EINVAL
+				}
+				cmsgs.IP.HasTLSRecordType = true
+				cmsgs.IP.TLSRecordType = buf[0]
+
 			default:
 				return socket.ControlMessages{}, linuxerr.EINVAL
 			}
@@ -146,7 +146,7 @@ func extractRoutes(routeMsgs []syscall.NetlinkMessage) ([]inet.Route, error) {
 			DstLen:   ifRoute.DstLen,
 			SrcLen:   ifRoute.SrcLen,
 			TOS:      ifRoute.TOS,
-			Table:    ifRoute.Table,
+			Table:    uint32(ifRoute.Table),
 			Protocol: ifRoute.Protocol,
 			Scope:    ifRoute.Scope,
 			Type:     ifRoute.Type,
@@ -169,6 +169,14 @@ func extractRoutes(routeMsgs []syscall.NetlinkMessage) ([]inet.Route, error) {
 				inetRoute.SrcAddr = attr.Value
 			case unix.RTA_GATEWAY:
 				inetRoute.GatewayAddr = attr.Value
+			case unix.RTA_TABLE:
+				expected := int(binary.Size(inetRoute.Table))
+				if len(attr.Value) != expected {
+					return nil, fmt.Errorf("RTM_GETROUTE returned RTM_NEWROUTE message with invalid attribute data length (%d bytes, expected %d bytes)", len(attr.Value), expected)
+				}
+				var table primitive.Uint32
+				table.UnmarshalUnsafe(attr.Value)
+				inetRoute.Table = uint32(table)
 			case unix.RTA_OIF:
 				expected := int(binary.Size(inetRoute.OutputInterface))
 				if len(attr.Value) != expected {
@@ -0,0 +1,163 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hostinet
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/fdnotifier"
+	"github.com/wilinz/gvisor/pkg/log"
+)
+
+// RawSocketSavePolicy determines how raw and packet sockets are handled by
+// checkpoint/restore. Other host sockets can't be saved.
+type RawSocketSavePolicy int
+
+const (
+	// RawSocketSaveFail fails checkpoints while raw or packet sockets are
+	// open.
+	RawSocketSaveFail RawSocketSavePolicy = iota
+
+	// RawSocketSaveDrop saves raw and packet sockets without their host
+	// socket. After restore, they report EventHUp and operations on them
+	// fail with EBADF.
+	RawSocketSaveDrop
+
+	// RawSocketSaveReopen reopens raw and packet sockets on restore, and
+	// reapplies their bound address and socket options. Packets received by
+	// the host socket but not yet read are lost.
+	RawSocketSaveReopen
+)
+
+// String implements fmt.Stringer.
+func (p RawSocketSavePolicy) String() string {
+	switch p {
+	case RawSocketSaveFail:
+		return "fail"
+	case RawSocketSaveDrop:
+		return "drop"
+	case RawSocketSaveReopen:
+		return "reopen"
+	default:
+		return fmt.Sprintf("RawSocketSavePolicy(%d)", int(p))
+	}
+}
+
+// savedSockOpt is a socket option set on a raw or packet socket.
+//
+// +stateify savable
+type savedSockOpt struct {
+	level int
+	name  int
+	val   []byte
+
+	// afterBind is true if the option was set after the socket was bound.
+	afterBind bool
+}
+
+// recordSockOptLocked records that the socket option (level, name) was set to
+// val, so that it can be reapplied if s is reopened on restore. Only the last
+// value set for each option is kept, in the order in which options were last
+// set.
+//
+// Preconditions: s.mu must be locked.
+func (s *Socket) recordSockOptLocked(level, name int, val []byte) {
+	for i := range s.sockOpts {
+		if s.sockOpts[i].level == level && s.sockOpts[i].name == name {
+			s.sockOpts = append(s.sockOpts[:i], s.sockOpts[i+1:]...)
+			break
+		}
+	}
+	s.sockOpts = append(s.sockOpts, savedSockOpt{
+		level:     level,
+		name:      name,
+		val:       append([]byte(nil), val...),
+		afterBind: s.boundAddr != nil,
+	})
+}
+
+// isRaw returns true if s is a raw or packet socket.
+func (s *Socket) isRaw() bool {
+	return s.stype == linux.SOCK_RAW || s.family == linux.AF_PACKET
+}
+
+// beforeSave is invoked by stateify.
+func (s *Socket) beforeSave() {
+	if !s.isRaw() {
+		panic("hostinet TCP, UDP and ICMP sockets cannot be saved")
+	}
+	if s.savePolicy == RawSocketSaveFail {
+		panic(fmt.Sprintf("hostinet raw socket (family %d, type %d, protocol %d) cannot be saved with save policy %q", s.family, s.stype, s.protocol, s.savePolicy))
+	}
+	// The host socket is left open, since the sandbox may keep running after
+	// the checkpoint. It is closed when the sandbox exits.
+}
+
+// afterLoad is invoked by stateify.
+func (s *Socket) afterLoad(context.Context) {
+	s.fd = -1
+	if s.savePolicy != RawSocketSaveReopen {
+		log.Infof("Dropping restored hostinet raw socket (family %d, type %d, protocol %d)", s.family, s.stype, s.protocol)
+		return
+	}
+	fd, err := s.reopen()
+	if err != nil {
+		log.Warningf("Dropping restored hostinet raw socket (family %d, type %d, protocol %d) that failed to reopen: %v", s.family, s.stype, s.protocol, err)
+		return
+	}
+	s.fd = fd
+}
+
+// reopen creates a new host socket for s, with the same bound address and
+// socket options.
+func (s *Socket) reopen() (int, error) {
+	fd, err := unix.Socket(s.family, int(s.stype)|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, s.protocol)
+	if err != nil {
+		return -1, fmt.Errorf("socket: %w", err)
+	}
+	setSockOpts := func(afterBind bool) error {
+		for _, opt := range s.sockOpts {
+			if opt.afterBind != afterBind {
+				continue
+			}
+			if _, _, errno := unix.Syscall6(unix.SYS_SETSOCKOPT, uintptr(fd), uintptr(opt.level), uintptr(opt.name), uintptr(firstBytePtr(opt.val)), uintptr(len(opt.val)), 0); errno != 0 {
+				return fmt.Errorf("setsockopt(%d, %d): %w", opt.level, opt.name, errno)
+			}
+		}
+		return nil
+	}
+	if err := setSockOpts(false /* afterBind */); err != nil {
+		_ = unix.Close(fd)
+		return -1, err
+	}
+	if s.boundAddr != nil {
+		if _, _, errno := unix.Syscall(unix.SYS_BIND, uintptr(fd), uintptr(firstBytePtr(s.boundAddr)), uintptr(len(s.boundAddr))); errno != 0 {
+			_ = unix.Close(fd)
+			return -1, fmt.Errorf("bind: %w", errno)
+		}
+	}
+	if err := setSockOpts(true /* afterBind */); err != nil {
+		_ = unix.Close(fd)
+		return -1, err
+	}
+	if err := fdnotifier.AddFD(int32(fd), &s.queue); err != nil {
+		_ = unix.Close(fd)
+		return -1, fmt.Errorf("fdnotifier.AddFD: %w", err)
+	}
+	return fd, nil
+}
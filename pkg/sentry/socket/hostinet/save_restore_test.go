@@ -0,0 +1,156 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hostinet
+
+import (
+	"context"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"golang.org/x/sys/unix"
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/fdnotifier"
+)
+
+func TestRecordSockOpt(t *testing.T) {
+	s := &Socket{family: linux.AF_PACKET, stype: linux.SOCK_RAW}
+	s.recordSockOptLocked(1, 1, []byte{1})
+	s.recordSockOptLocked(1, 2, []byte{2})
+	s.boundAddr = []byte{0}
+	// Replacing an option moves it after options that were set since.
+	s.recordSockOptLocked(1, 1, []byte{3})
+	s.recordSockOptLocked(2, 1, []byte{4})
+	s.recordSockOptLocked(1, 1, []byte{5})
+	want := []savedSockOpt{
+		{level: 1, name: 2, val: []byte{2}},
+		{level: 2, name: 1, val: []byte{4}, afterBind: true},
+		{level: 1, name: 1, val: []byte{5}, afterBind: true},
+	}
+	if !reflect.DeepEqual(s.sockOpts, want) {
+		t.Errorf("sockOpts: got %+v, want %+v", s.sockOpts, want)
+	}
+}
+
+func TestRecordSockOptCopiesValue(t *testing.T) {
+	s := &Socket{family: linux.AF_PACKET, stype: linux.SOCK_RAW}
+	val := []byte{1}
+	s.recordSockOptLocked(1, 1, val)
+	val[0] = 2
+	if got := s.sockOpts[0].val[0]; got != 1 {
+		t.Errorf("recorded value changed with caller's buffer: got %d, want 1", got)
+	}
+}
+
+func TestBeforeSave(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		stype     linux.SockType
+		policy    RawSocketSavePolicy
+		wantPanic bool
+	}{
+		{
+			name:      "datagram",
+			stype:     linux.SOCK_DGRAM,
+			policy:    RawSocketSaveReopen,
+			wantPanic: true,
+		},
+		{
+			name:      "raw fail",
+			stype:     linux.SOCK_RAW,
+			policy:    RawSocketSaveFail,
+			wantPanic: true,
+		},
+		{
+			name:   "raw drop",
+			stype:  linux.SOCK_RAW,
+			policy: RawSocketSaveDrop,
+		},
+		{
+			name:   "raw reopen",
+			stype:  linux.SOCK_RAW,
+			policy: RawSocketSaveReopen,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s := &Socket{family: linux.AF_INET, stype: test.stype, savePolicy: test.policy}
+			panicked := func() (panicked bool) {
+				defer func() {
+					panicked = recover() != nil
+				}()
+				s.beforeSave()
+				return false
+			}()
+			if panicked != test.wantPanic {
+				t.Errorf("beforeSave panicked: got %t, want %t", panicked, test.wantPanic)
+			}
+		})
+	}
+}
+
+func TestAfterLoadDrop(t *testing.T) {
+	s := &Socket{family: linux.AF_PACKET, stype: linux.SOCK_RAW, savePolicy: RawSocketSaveDrop, fd: 100}
+	s.afterLoad(context.Background())
+	if s.fd != -1 {
+		t.Errorf("fd after restore with drop policy: got %d, want -1", s.fd)
+	}
+}
+
+// TestAfterLoadReopen checks that reopening a socket restores its bound
+// address and socket options. A UDP socket is used since raw and packet
+// sockets require CAP_NET_RAW; reopen doesn't depend on the socket type.
+func TestAfterLoadReopen(t *testing.T) {
+	// struct sockaddr_in for 127.0.0.1, with a port chosen by the host.
+	addr := make([]byte, unix.SizeofSockaddrInet4)
+	binary.NativeEndian.PutUint16(addr[0:], unix.AF_INET)
+	copy(addr[4:], []byte{127, 0, 0, 1})
+
+	const rcvBuf = 8192
+	rcvBufVal := make([]byte, 4)
+	binary.NativeEndian.PutUint32(rcvBufVal, rcvBuf)
+	s := &Socket{
+		family:     unix.AF_INET,
+		stype:      unix.SOCK_DGRAM,
+		savePolicy: RawSocketSaveReopen,
+	}
+	s.recordSockOptLocked(unix.SOL_SOCKET, unix.SO_RCVBUF, []byte{0, 0, 0, 0})
+	s.recordSockOptLocked(unix.SOL_SOCKET, unix.SO_RCVBUF, rcvBufVal)
+	s.boundAddr = addr
+	s.recordSockOptLocked(unix.SOL_SOCKET, unix.SO_BROADCAST, []byte{1, 0, 0, 0})
+
+	s.afterLoad(context.Background())
+	if s.fd < 0 {
+		t.Fatalf("socket wasn't reopened")
+	}
+	defer func() {
+		fdnotifier.RemoveFD(int32(s.fd))
+		unix.Close(s.fd)
+	}()
+
+	sa, err := unix.Getsockname(s.fd)
+	if err != nil {
+		t.Fatalf("getsockname: %v", err)
+	}
+	if sa4, ok := sa.(*unix.SockaddrInet4); !ok || sa4.Addr != [4]byte{127, 0, 0, 1} {
+		t.Errorf("getsockname: got %+v, want 127.0.0.1", sa)
+	}
+	// Linux doubles the requested receive buffer size.
+	if got, err := unix.GetsockoptInt(s.fd, unix.SOL_SOCKET, unix.SO_RCVBUF); err != nil || got != 2*rcvBuf {
+		t.Errorf("SO_RCVBUF: got (%d, %v), want (%d, nil)", got, err, 2*rcvBuf)
+	}
+	if got, err := unix.GetsockoptInt(s.fd, unix.SOL_SOCKET, unix.SO_BROADCAST); err != nil || got != 1 {
+		t.Errorf("SO_BROADCAST: got (%d, %v), want (1, nil)", got, err)
+	}
+}
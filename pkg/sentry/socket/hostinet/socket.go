@@ -35,6 +35,7 @@ import (
 	"github.com/wilinz/gvisor/pkg/sentry/socket"
 	"github.com/wilinz/gvisor/pkg/sentry/socket/control"
 	"github.com/wilinz/gvisor/pkg/sentry/vfs"
+	"github.com/wilinz/gvisor/pkg/sync"
 	"github.com/wilinz/gvisor/pkg/syserr"
 	"github.com/wilinz/gvisor/pkg/usermem"
 	"github.com/wilinz/gvisor/pkg/waiter"
@@ -119,25 +120,44 @@ type Socket struct {
 	// fd is the host socket fd. It must have O_NONBLOCK, so that operations
 	// will return EWOULDBLOCK instead of blocking on the host. This allows us to
 	// handle blocking behavior independently in the sentry.
-	fd int
+	//
+	// fd is -1 if the socket was dropped on restore.
+	fd int `state:"nosave"`
 
 	// recvClosed indicates that the socket has been shutdown for reading
 	// (SHUT_RD or SHUT_RDWR).
 	recvClosed atomicbitops.Bool
+
+	// savePolicy determines how raw and packet sockets are handled by
+	// checkpoint/restore. It is immutable.
+	savePolicy RawSocketSavePolicy
+
+	// mu protects the fields below.
+	mu sync.Mutex `state:"nosave"`
+
+	// boundAddr is the address that a raw or packet socket was bound to, if
+	// any. It is reapplied when the socket is reopened on restore.
+	boundAddr []byte
+
+	// sockOpts are the socket options successfully set on a raw or packet
+	// socket, in order. They are reapplied when the socket is reopened on
+	// restore.
+	sockOpts []savedSockOpt
 }
 
 var _ = socket.Socket(&Socket{})
 
-func newSocket(t *kernel.Task, family int, stype linux.SockType, protocol int, fd int, flags uint32) (*vfs.FileDescription, *syserr.Error) {
+func newSocket(t *kernel.Task, family int, stype linux.SockType, protocol int, fd int, flags uint32, savePolicy RawSocketSavePolicy) (*vfs.FileDescription, *syserr.Error) {
 	mnt := t.Kernel().SocketMount()
 	d := sockfs.NewDentry(t, mnt)
 	defer d.DecRef(t)
 
 	s := &Socket{
-		family:   family,
-		stype:    stype,
-		protocol: protocol,
-		fd:       fd,
+		family:     family,
+		stype:      stype,
+		protocol:   protocol,
+		fd:         fd,
+		savePolicy: savePolicy,
 	}
 	s.LockFD.Init(&vfs.FileLocks{})
 	if err := fdnotifier.AddFD(int32(fd), &s.queue); err != nil {
@@ -158,6 +178,9 @@ func newSocket(t *kernel.Task, family int, stype linux.SockType, protocol int, f
 // Release implements vfs.FileDescriptionImpl.Release.
 func (s *Socket) Release(ctx context.Context) {
 	kernel.KernelFromContext(ctx).DeleteSocket(&s.vfsfd)
+	if s.fd < 0 {
+		return
+	}
 	fdnotifier.RemoveFD(int32(s.fd))
 	_ = unix.Close(s.fd)
 }
@@ -215,6 +238,20 @@ func (s *Socket) Write(ctx context.Context, src usermem.IOSequence, opts vfs.Wri
 	return int64(n), err
 }
 
+// SendfileFromHostFD implements socket.HostFileSender.SendfileFromHostFD.
+func (s *Socket) SendfileFromHostFD(t *kernel.Task, hostFD int32, offset, count int64) (int64, error) {
+	if s.family == linux.AF_PACKET {
+		return 0, linuxerr.EACCES
+	}
+	t.UninterruptibleSleepStart(false)
+	n, err := unix.Sendfile(s.fd, int(hostFD), &offset, int(count))
+	t.UninterruptibleSleepFinish(false)
+	if err != nil {
+		return 0, translateIOSyscallError(err)
+	}
+	return int64(n), nil
+}
+
 type socketProvider struct {
 	family int
 }
@@ -275,7 +312,7 @@ func (p *socketProvider) Socket(t *kernel.Task, stypeflags linux.SockType, proto
 	if err != nil {
 		return nil, syserr.FromError(err)
 	}
-	return newSocket(t, p.family, stype, protocol, fd, uint32(stypeflags&unix.SOCK_NONBLOCK))
+	return newSocket(t, p.family, stype, protocol, fd, uint32(stypeflags&unix.SOCK_NONBLOCK), stack.rawSocketSavePolicy)
 }
 
 // Pair implements socket.Provider.Pair.
@@ -286,6 +323,10 @@ func (p *socketProvider) Pair(t *kernel.Task, stype linux.SockType, protocol int
 
 // Readiness implements waiter.Waitable.Readiness.
 func (s *Socket) Readiness(mask waiter.EventMask) waiter.EventMask {
+	if s.fd < 0 {
+		// The socket was dropped on restore.
+		return mask & (waiter.EventHUp | waiter.EventErr)
+	}
 	return fdnotifier.NonBlockingPoll(int32(s.fd), mask)
 }
 
@@ -414,7 +455,7 @@ func (s *Socket) Accept(t *kernel.Task, peerRequested bool, flags int, blocking
 		kfd  int32
 		kerr error
 	)
-	f, err := newSocket(t, s.family, s.stype, s.protocol, fd, uint32(flags&unix.SOCK_NONBLOCK))
+	f, err := newSocket(t, s.family, s.stype, s.protocol, fd, uint32(flags&unix.SOCK_NONBLOCK), s.savePolicy)
 	if err != nil {
 		_ = unix.Close(fd)
 		return 0, nil, 0, err
@@ -439,6 +480,11 @@ func (s *Socket) Bind(_ *kernel.Task, sockaddr []byte) *syserr.Error {
 	if errno != 0 {
 		return syserr.FromError(errno)
 	}
+	if s.isRaw() {
+		s.mu.Lock()
+		s.boundAddr = append([]byte(nil), sockaddr...)
+		s.mu.Unlock()
+	}
 	return nil
 }
 
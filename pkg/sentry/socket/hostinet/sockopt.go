@@ -261,5 +261,10 @@ func (s *Socket) SetSockOpt(t *kernel.Task, level, name int, opt []byte) *syserr
 	if _, _, errno := unix.Syscall6(unix.SYS_SETSOCKOPT, uintptr(s.fd), uintptr(level), uintptr(name), uintptr(firstBytePtr(opt)), uintptr(len(opt)), 0); errno != 0 {
 		return syserr.FromError(errno)
 	}
+	if s.isRaw() {
+		s.mu.Lock()
+		s.recordSockOptLocked(level, name, opt)
+		s.mu.Unlock()
+	}
 	return nil
 }
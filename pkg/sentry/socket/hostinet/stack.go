@@ -54,10 +54,14 @@ type Stack struct {
 	tcpRecvBufSize inet.TCPBufferSize
 	tcpSendBufSize inet.TCPBufferSize
 	tcpSACKEnabled bool
+	tcpSynCookies  int32
+	sysctls        map[inet.Sysctl]int64
 	netDevFile     *os.File
 	netSNMPFile    *os.File
 	// allowedSocketTypes is the list of allowed socket types
 	allowedSocketTypes []AllowedSocketType
+	// rawSocketSavePolicy is the save policy of new raw and packet sockets.
+	rawSocketSavePolicy RawSocketSavePolicy
 }
 
 // Destroy implements inet.Stack.Destroy.
@@ -98,6 +102,29 @@ func (s *Stack) Configure(allowRawSockets bool) error {
 		log.Warningf("Failed to read if TCP SACK if enabled, setting to true")
 	}
 
+	// SYN cookies are used when the SYN backlog overflows by default.
+	s.tcpSynCookies = 1
+	if v, err := os.ReadFile("/proc/sys/net/ipv4/tcp_syncookies"); err == nil {
+		if n, err := strconv.ParseInt(strings.TrimSpace(string(v)), 10, 32); err == nil {
+			s.tcpSynCookies = int32(n)
+		}
+	} else {
+		log.Warningf("Failed to read TCP SYN cookies setting, setting to 1")
+	}
+
+	s.sysctls = make(map[inet.Sysctl]int64)
+	for sysctl := inet.Sysctl(0); sysctl.Path() != ""; sysctl++ {
+		path := "/proc/sys/net/" + sysctl.Path()
+		v, err := os.ReadFile(path)
+		if err != nil {
+			log.Warningf("Failed to read %s: %v", path, err)
+			continue
+		}
+		if n, err := strconv.ParseInt(strings.TrimSpace(string(v)), 10, 64); err == nil {
+			s.sysctls[sysctl] = n
+		}
+	}
+
 	if f, err := os.Open("/proc/net/dev"); err != nil {
 		log.Warningf("Failed to open /proc/net/dev: %v", err)
 	} else {
@@ -118,6 +145,13 @@ func (s *Stack) Configure(allowRawSockets bool) error {
 	return nil
 }
 
+// SetRawSocketSavePolicy sets how raw and packet sockets created after this
+// call are handled by checkpoint/restore. It must be called before the stack
+// is used, like Configure.
+func (s *Stack) SetRawSocketSavePolicy(p RawSocketSavePolicy) {
+	s.rawSocketSavePolicy = p
+}
+
 func readTCPBufferSizeFile(filename string) (inet.TCPBufferSize, error) {
 	contents, err := os.ReadFile(filename)
 	if err != nil {
@@ -279,6 +313,30 @@ func (*Stack) SetTCPRecovery(inet.TCPLossRecovery) error {
 	return linuxerr.EACCES
 }
 
+// TCPSynCookies implements inet.Stack.TCPSynCookies.
+func (s *Stack) TCPSynCookies() (int32, error) {
+	return s.tcpSynCookies, nil
+}
+
+// SetTCPSynCookies implements inet.Stack.SetTCPSynCookies.
+func (*Stack) SetTCPSynCookies(int32) error {
+	return linuxerr.EACCES
+}
+
+// Sysctl implements inet.Stack.Sysctl.
+func (s *Stack) Sysctl(sysctl inet.Sysctl) (int64, error) {
+	v, ok := s.sysctls[sysctl]
+	if !ok {
+		return 0, linuxerr.ENOENT
+	}
+	return v, nil
+}
+
+// SetSysctl implements inet.Stack.SetSysctl.
+func (*Stack) SetSysctl(inet.Sysctl, int64) error {
+	return linuxerr.EACCES
+}
+
 // getLine reads one line from proc file, with specified prefix.
 // The last argument, withHeader, specifies if it contains line header.
 func getLine(f *os.File, prefix string, withHeader bool) string {
@@ -392,12 +450,60 @@ func (*Stack) RemoveRoute(context.Context, *nlmsg.Message) *syserr.Error {
 	return syserr.ErrNotSupported
 }
 
+// RoutingRules implements inet.Stack.RoutingRules.
+func (*Stack) RoutingRules() []inet.Rule {
+	return nil
+}
+
+// NewRule implements inet.Stack.NewRule.
+func (*Stack) NewRule(context.Context, *nlmsg.Message) *syserr.Error {
+	return syserr.ErrNotSupported
+}
+
+// RemoveRule implements inet.Stack.RemoveRule.
+func (*Stack) RemoveRule(context.Context, *nlmsg.Message) *syserr.Error {
+	return syserr.ErrNotSupported
+}
+
+// QDiscs implements inet.Stack.QDiscs.
+func (*Stack) QDiscs() []inet.QDisc {
+	return nil
+}
+
+// NewQDisc implements inet.Stack.NewQDisc.
+func (*Stack) NewQDisc(context.Context, *nlmsg.Message) *syserr.Error {
+	return syserr.ErrNotSupported
+}
+
+// RemoveQDisc implements inet.Stack.RemoveQDisc.
+func (*Stack) RemoveQDisc(context.Context, *nlmsg.Message) *syserr.Error {
+	return syserr.ErrNotSupported
+}
+
+// Neighbors implements inet.Stack.Neighbors.
+func (*Stack) Neighbors() []inet.Neighbor {
+	return nil
+}
+
+// NewNeighbor implements inet.Stack.NewNeighbor.
+func (*Stack) NewNeighbor(context.Context, *nlmsg.Message) *syserr.Error {
+	return syserr.ErrNotSupported
+}
+
+// RemoveNeighbor implements inet.Stack.RemoveNeighbor.
+func (*Stack) RemoveNeighbor(context.Context, *nlmsg.Message) *syserr.Error {
+	return syserr.ErrNotSupported
+}
+
 // Pause implements inet.Stack.Pause.
 func (*Stack) Pause() {}
 
 // Restore implements inet.Stack.Restore.
 func (*Stack) Restore() {}
 
+// MoveHostDevices implements inet.Stack.MoveHostDevices.
+func (*Stack) MoveHostDevices(inet.Stack) {}
+
 // ReplaceConfig implements inet.Stack.ReplaceConfig.
 func (s *Stack) ReplaceConfig(_ inet.Stack) {}
 
@@ -0,0 +1,134 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/marshal"
+	"github.com/wilinz/gvisor/pkg/syserr"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/stack"
+)
+
+// MasqueradeTargetName is used to mark targets as MASQUERADE targets.
+// MASQUERADE targets should be reached for only the POSTROUTING chain of the
+// NAT table. These targets change the source IP of packets to an address of
+// the outgoing interface, and the source port if needed.
+const MasqueradeTargetName = "MASQUERADE"
+
+type masqueradeTarget struct {
+	stack.MasqueradeTarget
+}
+
+func (mt *masqueradeTarget) id() targetID {
+	return targetID{
+		name:            MasqueradeTargetName,
+		networkProtocol: mt.NetworkProtocol,
+	}
+}
+
+// masqueradeTargetMakerV4 makes IPv4 MASQUERADE targets, which take a
+// nf_nat_ipv4_multi_range_compat. See net/netfilter/xt_MASQUERADE.c.
+type masqueradeTargetMakerV4 struct {
+	NetworkProtocol tcpip.NetworkProtocolNumber
+}
+
+func (mt *masqueradeTargetMakerV4) id() targetID {
+	return targetID{
+		name:            MasqueradeTargetName,
+		networkProtocol: mt.NetworkProtocol,
+	}
+}
+
+func (*masqueradeTargetMakerV4) marshal(target target) []byte {
+	xt := linux.XTNATTargetV0{
+		Target: linux.XTEntryTarget{
+			TargetSize: linux.SizeOfXTNATTargetV0,
+		},
+	}
+	copy(xt.Target.Name[:], MasqueradeTargetName)
+	xt.NfRange.RangeSize = 1
+	return marshal.Marshal(&xt)
+}
+
+func (*masqueradeTargetMakerV4) unmarshal(buf []byte, filter stack.IPHeaderFilter) (target, *syserr.Error) {
+	if len(buf) < linux.SizeOfXTNATTargetV0 {
+		nflog("masqueradeTargetMakerV4: buf has insufficient size for masquerade target %d", len(buf))
+		return nil, syserr.ErrInvalidArgument
+	}
+
+	var mt linux.XTNATTargetV0
+	mt.UnmarshalUnsafe(buf)
+
+	// RangeSize should be 1.
+	nfRange := mt.NfRange
+	if nfRange.RangeSize != 1 {
+		nflog("masqueradeTargetMakerV4: bad rangesize %d", nfRange.RangeSize)
+		return nil, syserr.ErrInvalidArgument
+	}
+
+	// Port ranges and random port selection are not supported yet.
+	if nfRange.RangeIPV4.Flags != 0 {
+		nflog("masqueradeTargetMakerV4: unsupported flags used (%x)", nfRange.RangeIPV4.Flags)
+		return nil, syserr.ErrInvalidArgument
+	}
+
+	return &masqueradeTarget{stack.MasqueradeTarget{
+		NetworkProtocol: filter.NetworkProtocol(),
+	}}, nil
+}
+
+// masqueradeTargetMakerV6 makes IPv6 MASQUERADE targets, which take a
+// nf_nat_range. See net/netfilter/xt_MASQUERADE.c.
+type masqueradeTargetMakerV6 struct {
+	NetworkProtocol tcpip.NetworkProtocolNumber
+}
+
+func (mt *masqueradeTargetMakerV6) id() targetID {
+	return targetID{
+		name:            MasqueradeTargetName,
+		networkProtocol: mt.NetworkProtocol,
+	}
+}
+
+func (*masqueradeTargetMakerV6) marshal(target target) []byte {
+	nt := linux.XTNATTargetV1{
+		Target: linux.XTEntryTarget{
+			TargetSize: linux.SizeOfXTNATTargetV1,
+		},
+	}
+	copy(nt.Target.Name[:], MasqueradeTargetName)
+	return marshal.Marshal(&nt)
+}
+
+func (*masqueradeTargetMakerV6) unmarshal(buf []byte, filter stack.IPHeaderFilter) (target, *syserr.Error) {
+	if size := linux.SizeOfXTNATTargetV1; len(buf) < size {
+		nflog("masqueradeTargetMakerV6: buf has insufficient size (%d) for masquerade target (%d)", len(buf), size)
+		return nil, syserr.ErrInvalidArgument
+	}
+
+	var natRange linux.NFNATRange
+	natRange.UnmarshalUnsafe(buf[linux.SizeOfXTEntryTarget:])
+
+	// Port ranges and random port selection are not supported yet.
+	if natRange.Flags != 0 {
+		nflog("masqueradeTargetMakerV6: unsupported flags used (%x)", natRange.Flags)
+		return nil, syserr.ErrInvalidArgument
+	}
+
+	return &masqueradeTarget{stack.MasqueradeTarget{
+		NetworkProtocol: filter.NetworkProtocol(),
+	}}, nil
+}
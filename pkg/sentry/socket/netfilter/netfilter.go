@@ -192,6 +192,8 @@ func SetEntries(mapper IDMapper, stk *stack.Stack, optVal []byte, ipv6 bool) *sy
 		table = stack.EmptyFilterTable()
 	case natTable:
 		table = stack.EmptyNATTable()
+	case mangleTable:
+		table = stack.EmptyMangleTable()
 	default:
 		nflog("unknown iptables table %q", replace.Name.String())
 		return syserr.ErrInvalidArgument
@@ -238,6 +240,16 @@ func SetEntries(mapper IDMapper, stk *stack.Stack, optVal []byte, ipv6 bool) *sy
 		}
 	}
 
+	// TPROXY targets are only allowed in the mangle table.
+	if replace.Name.String() != mangleTable {
+		for _, rule := range table.Rules {
+			if _, ok := rule.Target.(*tproxyTarget); ok {
+				nflog("TPROXY target used outside of the mangle table")
+				return syserr.ErrInvalidArgument
+			}
+		}
+	}
+
 	// Check the user chains.
 	for ruleIdx, rule := range table.Rules {
 		if _, ok := rule.Target.(*stack.UserChainTarget); !ok {
@@ -95,6 +95,25 @@ func init() {
 	registerTargetMaker(&dnatTargetMakerR2{
 		NetworkProtocol: header.IPv6ProtocolNumber,
 	})
+
+	// MASQUERADE targets.
+	registerTargetMaker(&masqueradeTargetMakerV4{
+		NetworkProtocol: header.IPv4ProtocolNumber,
+	})
+	registerTargetMaker(&masqueradeTargetMakerV6{
+		NetworkProtocol: header.IPv6ProtocolNumber,
+	})
+
+	// TPROXY targets.
+	registerTargetMaker(&tproxyTargetMakerV0{
+		NetworkProtocol: header.IPv4ProtocolNumber,
+	})
+	registerTargetMaker(&tproxyTargetMakerR1{
+		NetworkProtocol: header.IPv4ProtocolNumber,
+	})
+	registerTargetMaker(&tproxyTargetMakerR1{
+		NetworkProtocol: header.IPv6ProtocolNumber,
+	})
 }
 
 // The stack package provides some basic, useful targets for us. The following
@@ -0,0 +1,173 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"fmt"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/marshal"
+	"github.com/wilinz/gvisor/pkg/syserr"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/header"
+	"github.com/wilinz/gvisor/pkg/tcpip/stack"
+)
+
+// TProxyTargetName is used to mark targets as TPROXY targets. TPROXY targets
+// should be reached for only the mangle table's PREROUTING chain. These
+// targets redirect packets to a local socket without changing them.
+const TProxyTargetName = "TPROXY"
+
+// +stateify savable
+type tproxyTarget struct {
+	stack.TProxyTarget
+	revision uint8
+}
+
+func (tt *tproxyTarget) id() targetID {
+	return targetID{
+		name:            TProxyTargetName,
+		networkProtocol: tt.NetworkProtocol,
+		revision:        tt.revision,
+	}
+}
+
+// checkTProxyFilter returns an error if a TPROXY target can't be used with
+// filter. Like Linux, TPROXY targets require a TCP or UDP protocol match.
+func checkTProxyFilter(filter stack.IPHeaderFilter) *syserr.Error {
+	if !filter.CheckProtocol {
+		nflog("tproxyTargetMaker: TPROXY target requires a protocol")
+		return syserr.ErrInvalidArgument
+	}
+	if p := filter.Protocol; p != header.TCPProtocolNumber && p != header.UDPProtocolNumber {
+		nflog("tproxyTargetMaker: bad proto %d", p)
+		return syserr.ErrInvalidArgument
+	}
+	return nil
+}
+
+// +stateify savable
+type tproxyTargetMakerV0 struct {
+	NetworkProtocol tcpip.NetworkProtocolNumber
+}
+
+func (tm *tproxyTargetMakerV0) id() targetID {
+	return targetID{
+		name:            TProxyTargetName,
+		networkProtocol: tm.NetworkProtocol,
+	}
+}
+
+func (*tproxyTargetMakerV0) marshal(target target) []byte {
+	tt := target.(*tproxyTarget)
+	xt := linux.XTTProxyTargetV0{
+		Target: linux.XTEntryTarget{
+			TargetSize: linux.SizeOfXTTProxyTargetV0,
+		},
+		MarkMask:  tt.Mask,
+		MarkValue: tt.Mark,
+		LPort:     htons(tt.Port),
+	}
+	copy(xt.Target.Name[:], TProxyTargetName)
+	copy(xt.LAddr[:], tt.Addr.AsSlice())
+	return marshal.Marshal(&xt)
+}
+
+func (*tproxyTargetMakerV0) unmarshal(buf []byte, filter stack.IPHeaderFilter) (target, *syserr.Error) {
+	if len(buf) < linux.SizeOfXTTProxyTargetV0 {
+		nflog("tproxyTargetMakerV0: buf has insufficient size for TPROXY target %d", len(buf))
+		return nil, syserr.ErrInvalidArgument
+	}
+	if err := checkTProxyFilter(filter); err != nil {
+		return nil, err
+	}
+
+	var xt linux.XTTProxyTargetV0
+	xt.UnmarshalUnsafe(buf)
+
+	target := tproxyTarget{TProxyTarget: stack.TProxyTarget{
+		Port:            ntohs(xt.LPort),
+		Mark:            xt.MarkValue,
+		Mask:            xt.MarkMask,
+		NetworkProtocol: filter.NetworkProtocol(),
+	}}
+	if xt.LAddr != (linux.InetAddr{}) {
+		target.Addr = tcpip.AddrFrom4(xt.LAddr)
+	}
+	return &target, nil
+}
+
+// +stateify savable
+type tproxyTargetMakerR1 struct {
+	NetworkProtocol tcpip.NetworkProtocolNumber
+}
+
+func (tm *tproxyTargetMakerR1) id() targetID {
+	return targetID{
+		name:            TProxyTargetName,
+		networkProtocol: tm.NetworkProtocol,
+		revision:        1,
+	}
+}
+
+func (*tproxyTargetMakerR1) marshal(target target) []byte {
+	tt := target.(*tproxyTarget)
+	xt := linux.XTTProxyTargetV1{
+		Target: linux.XTEntryTarget{
+			TargetSize: linux.SizeOfXTTProxyTargetV1,
+			Revision:   1,
+		},
+		MarkMask:  tt.Mask,
+		MarkValue: tt.Mark,
+		LPort:     htons(tt.Port),
+	}
+	copy(xt.Target.Name[:], TProxyTargetName)
+	copy(xt.LAddr[:], tt.Addr.AsSlice())
+	return marshal.Marshal(&xt)
+}
+
+func (tm *tproxyTargetMakerR1) unmarshal(buf []byte, filter stack.IPHeaderFilter) (target, *syserr.Error) {
+	if size := linux.SizeOfXTTProxyTargetV1; len(buf) < size {
+		nflog("tproxyTargetMakerR1: buf has insufficient size (%d) for TPROXY target (%d)", len(buf), size)
+		return nil, syserr.ErrInvalidArgument
+	}
+	if err := checkTProxyFilter(filter); err != nil {
+		return nil, err
+	}
+
+	var xt linux.XTTProxyTargetV1
+	xt.UnmarshalUnsafe(buf)
+
+	target := tproxyTarget{
+		TProxyTarget: stack.TProxyTarget{
+			Port:            ntohs(xt.LPort),
+			Mark:            xt.MarkValue,
+			Mask:            xt.MarkMask,
+			NetworkProtocol: filter.NetworkProtocol(),
+		},
+		revision: 1,
+	}
+	if xt.LAddr != (linux.Inet6Addr{}) {
+		switch tm.NetworkProtocol {
+		case header.IPv4ProtocolNumber:
+			target.Addr = tcpip.AddrFrom4Slice(xt.LAddr[:4])
+		case header.IPv6ProtocolNumber:
+			target.Addr = tcpip.AddrFrom16(xt.LAddr)
+		default:
+			panic(fmt.Sprintf("invalid protocol number: %d", tm.NetworkProtocol))
+		}
+	}
+	return &target, nil
+}
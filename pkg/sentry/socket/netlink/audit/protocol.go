@@ -0,0 +1,236 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit provides a NETLINK_AUDIT socket protocol.
+//
+// NETLINK_AUDIT sockets configure the audit subsystem (see
+// pkg/sentry/kernel/audit), relay audit messages from userspace, and deliver
+// audit records to the registered audit daemon.
+package audit
+
+import (
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/log"
+	"github.com/wilinz/gvisor/pkg/marshal/primitive"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/audit"
+	"github.com/wilinz/gvisor/pkg/sentry/socket/netlink"
+	"github.com/wilinz/gvisor/pkg/sentry/socket/netlink/nlmsg"
+	"github.com/wilinz/gvisor/pkg/sync"
+	"github.com/wilinz/gvisor/pkg/syserr"
+)
+
+// Protocol implements netlink.Protocol.
+//
+// A Protocol also implements audit.Daemon, delivering records to its socket
+// once it has been registered as the audit daemon via AUDIT_SET.
+//
+// +stateify savable
+type Protocol struct {
+	// mu protects the fields below.
+	mu sync.Mutex `state:"nosave"`
+
+	// socket is the socket using this Protocol, set once the socket has
+	// successfully registered itself as the audit daemon.
+	socket *netlink.Socket
+
+	// released is set once the socket has been released, after which
+	// records can no longer be delivered.
+	released bool
+}
+
+var _ netlink.Protocol = (*Protocol)(nil)
+var _ netlink.ReleaseNotifier = (*Protocol)(nil)
+var _ audit.Daemon = (*Protocol)(nil)
+
+// NewProtocol creates a NETLINK_AUDIT netlink.Protocol.
+func NewProtocol(t *kernel.Task) (netlink.Protocol, *syserr.Error) {
+	return &Protocol{}, nil
+}
+
+// Protocol implements netlink.Protocol.Protocol.
+func (p *Protocol) Protocol() int {
+	return linux.NETLINK_AUDIT
+}
+
+// CanSend implements netlink.Protocol.CanSend.
+func (p *Protocol) CanSend() bool {
+	return true
+}
+
+// OnRelease implements netlink.ReleaseNotifier.OnRelease.
+func (p *Protocol) OnRelease(ctx context.Context, s *netlink.Socket) {
+	p.mu.Lock()
+	p.released = true
+	p.socket = nil
+	p.mu.Unlock()
+	kernel.KernelFromContext(ctx).Audit().UnregisterDaemon(p)
+}
+
+// Deliver implements audit.Daemon.Deliver.
+func (p *Protocol) Deliver(ctx context.Context, typ uint16, text string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.released {
+		return linuxerr.ECONNREFUSED
+	}
+	if p.socket == nil {
+		// The AUDIT_SET that registered p hasn't returned yet. Like
+		// records generated without a daemon, log it rather than
+		// unregistering p.
+		log.Infof("audit: type=%d %s", typ, text)
+		return nil
+	}
+	// Records are not sent in response to any request, so like Linux they
+	// carry no port ID or sequence number.
+	ms := nlmsg.NewMessageSet(0, 0)
+	m := ms.AddMessage(linux.NetlinkMessageHeader{
+		Type: typ,
+	})
+	m.Put(primitive.AsByteSlice([]byte(text)))
+	if err := p.socket.SendMessages(ctx, ms); err != nil {
+		return err.ToError()
+	}
+	return nil
+}
+
+// isUserMessage returns true if typ is a message type that userspace may
+// send to be relayed to the audit daemon.
+func isUserMessage(typ uint16) bool {
+	return typ == linux.AUDIT_USER ||
+		(typ >= linux.AUDIT_FIRST_USER_MSG && typ <= linux.AUDIT_LAST_USER_MSG) ||
+		(typ >= linux.AUDIT_FIRST_USER_MSG2 && typ <= linux.AUDIT_LAST_USER_MSG2)
+}
+
+// checkPermission checks that the sender may send a message of type typ.
+//
+// See kernel/audit.c:audit_netlink_ok.
+func checkPermission(t *kernel.Task, typ uint16) *syserr.Error {
+	creds := t.Credentials()
+	switch typ {
+	case linux.AUDIT_LIST, linux.AUDIT_ADD, linux.AUDIT_DEL:
+		// Deprecated.
+		return syserr.ErrNotSupported
+	case linux.AUDIT_GET, linux.AUDIT_SET, linux.AUDIT_GET_FEATURE,
+		linux.AUDIT_SET_FEATURE, linux.AUDIT_LIST_RULES,
+		linux.AUDIT_ADD_RULE, linux.AUDIT_DEL_RULE, linux.AUDIT_SIGNAL_INFO,
+		linux.AUDIT_TTY_GET, linux.AUDIT_TTY_SET, linux.AUDIT_TRIM,
+		linux.AUDIT_MAKE_EQUIV:
+		if !creds.HasCapabilityIn(linux.CAP_AUDIT_CONTROL, creds.UserNamespace.Root()) {
+			return syserr.ErrPermissionDenied
+		}
+	default:
+		if !isUserMessage(typ) {
+			return syserr.ErrInvalidArgument
+		}
+		if !creds.HasCapabilityIn(linux.CAP_AUDIT_WRITE, creds.UserNamespace.Root()) {
+			return syserr.ErrPermissionDenied
+		}
+	}
+	return nil
+}
+
+// ProcessMessage implements netlink.Protocol.ProcessMessage.
+func (p *Protocol) ProcessMessage(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	t := kernel.TaskFromContext(ctx)
+	hdr := msg.Header()
+	if err := checkPermission(t, hdr.Type); err != nil {
+		return err
+	}
+	a := t.Kernel().Audit()
+
+	switch hdr.Type {
+	case linux.AUDIT_GET:
+		status := a.Status()
+		ms.AddMessage(linux.NetlinkMessageHeader{
+			Type: linux.AUDIT_GET,
+		}).Put(&status)
+		return nil
+
+	case linux.AUDIT_SET:
+		// Older versions of userspace send a shorter struct audit_status;
+		// missing fields are zero.
+		var status linux.AuditStatus
+		buf := make([]byte, linux.SizeOfAuditStatus)
+		copy(buf, msg.Payload())
+		status.UnmarshalUnsafe(buf)
+		if err := a.SetStatus(ctx, t.AuditContext(), &status, p); err != nil {
+			return syserr.FromError(err)
+		}
+		if status.Mask&linux.AUDIT_STATUS_PID != 0 && status.PID != 0 {
+			p.mu.Lock()
+			if !p.released {
+				p.socket = s
+			}
+			p.mu.Unlock()
+		}
+		return nil
+
+	case linux.AUDIT_GET_FEATURE:
+		ms.AddMessage(linux.NetlinkMessageHeader{
+			Type: linux.AUDIT_GET_FEATURE,
+		}).Put(&linux.AuditFeatures{
+			Vers: linux.AUDIT_FEATURE_VERSION,
+		})
+		return nil
+
+	case linux.AUDIT_SET_FEATURE:
+		// No features (loginuid_immutable, etc.) are supported, but they
+		// have no effect in the absence of loginuid support anyway.
+		return nil
+
+	case linux.AUDIT_SIGNAL_INFO:
+		// gVisor does not track which task signalled the audit daemon.
+		ms.AddMessage(linux.NetlinkMessageHeader{
+			Type: linux.AUDIT_SIGNAL_INFO,
+		}).Put(&linux.AuditSigInfo{
+			UID: audit.LoginUIDUnset,
+		})
+		return nil
+
+	case linux.AUDIT_LIST_RULES:
+		ms.Multi = true
+		for _, r := range a.Rules() {
+			ms.AddMessage(linux.NetlinkMessageHeader{
+				Type: linux.AUDIT_LIST_RULES,
+			}).Put(primitive.AsByteSlice(r.Marshal()))
+		}
+		return nil
+
+	case linux.AUDIT_ADD_RULE, linux.AUDIT_DEL_RULE:
+		r, err := audit.ParseRule(msg.Payload())
+		if err != nil {
+			return syserr.FromError(err)
+		}
+		if hdr.Type == linux.AUDIT_ADD_RULE {
+			return syserr.FromError(a.AddRule(ctx, t.AuditContext(), r))
+		}
+		return syserr.FromError(a.DeleteRule(ctx, t.AuditContext(), r))
+
+	case linux.AUDIT_TTY_GET, linux.AUDIT_TTY_SET, linux.AUDIT_TRIM, linux.AUDIT_MAKE_EQUIV:
+		// TTY auditing and directory watches are not supported.
+		return syserr.ErrNotSupported
+
+	default:
+		a.UserMessage(ctx, t.AuditContext(), hdr.Type, string(msg.Payload()))
+		return nil
+	}
+}
+
+// init registers the NETLINK_AUDIT provider.
+func init() {
+	netlink.RegisterProvider(linux.NETLINK_AUDIT, NewProtocol)
+}
@@ -0,0 +1,225 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package connector provides a NETLINK_CONNECTOR socket protocol.
+//
+// Only the process events connector (CN_IDX_PROC) is supported. Sockets that
+// join the CN_IDX_PROC multicast group receive fork, exec and exit events
+// for all tasks in the sandbox once any socket has sent PROC_CN_MCAST_LISTEN.
+// See drivers/connector/cn_proc.c.
+package connector
+
+import (
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/abi/linux/errno"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/hostarch"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+	"github.com/wilinz/gvisor/pkg/sentry/socket/netlink"
+	"github.com/wilinz/gvisor/pkg/sentry/socket/netlink/nlmsg"
+	"github.com/wilinz/gvisor/pkg/sync"
+	"github.com/wilinz/gvisor/pkg/syserr"
+)
+
+// Protocol implements netlink.Protocol.
+//
+// A Protocol also implements kernel.ProcEventSubscriber, delivering events to
+// its socket while the socket is a member of the CN_IDX_PROC group.
+//
+// +stateify savable
+type Protocol struct {
+	// mu protects the fields below.
+	mu sync.Mutex `state:"nosave"`
+
+	// socket is the socket using this Protocol, set while it is a member of
+	// the CN_IDX_PROC group.
+	socket *netlink.Socket
+
+	// listening is true if the socket has sent PROC_CN_MCAST_LISTEN without
+	// a subsequent PROC_CN_MCAST_IGNORE.
+	listening bool
+}
+
+var _ netlink.Protocol = (*Protocol)(nil)
+var _ netlink.MulticastProtocol = (*Protocol)(nil)
+var _ netlink.RawMessageProcessor = (*Protocol)(nil)
+var _ netlink.ReleaseNotifier = (*Protocol)(nil)
+var _ kernel.ProcEventSubscriber = (*Protocol)(nil)
+
+// NewProtocol creates a NETLINK_CONNECTOR netlink.Protocol.
+func NewProtocol(t *kernel.Task) (netlink.Protocol, *syserr.Error) {
+	// Like Linux, the connector only exists in the root network namespace.
+	if t.NetworkNamespace() != t.Kernel().RootNetworkNamespace() {
+		return nil, syserr.ErrProtocolNotSupported
+	}
+	return &Protocol{}, nil
+}
+
+// Protocol implements netlink.Protocol.Protocol.
+func (p *Protocol) Protocol() int {
+	return linux.NETLINK_CONNECTOR
+}
+
+// CanSend implements netlink.Protocol.CanSend.
+func (p *Protocol) CanSend() bool {
+	return true
+}
+
+// ProcessMessage implements netlink.Protocol.ProcessMessage.
+func (p *Protocol) ProcessMessage(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	// All messages are handled by ProcessRawMessage.
+	return nil
+}
+
+// SetGroups implements netlink.MulticastProtocol.SetGroups.
+func (p *Protocol) SetGroups(t *kernel.Task, s *netlink.Socket, groups uint32) *syserr.Error {
+	// The connector doesn't permit unprivileged sockets to join multicast
+	// groups (NL_CFG_F_NONROOT_RECV). See
+	// net/netlink/af_netlink.c:netlink_bind.
+	k := t.Kernel()
+	if groups != 0 && !t.HasCapabilityIn(linux.CAP_NET_ADMIN, k.RootUserNamespace()) {
+		return syserr.ErrPermissionDenied
+	}
+
+	pe := k.ProcEvents()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if groups&(1<<(linux.CN_IDX_PROC-1)) != 0 {
+		if p.socket == nil {
+			p.socket = s
+			pe.Subscribe(p)
+		}
+	} else if p.socket != nil {
+		pe.Unsubscribe(p)
+		p.socket = nil
+	}
+	return nil
+}
+
+// OnRelease implements netlink.ReleaseNotifier.OnRelease.
+func (p *Protocol) OnRelease(ctx context.Context, s *netlink.Socket) {
+	pe := kernel.KernelFromContext(ctx).ProcEvents()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.socket != nil {
+		pe.Unsubscribe(p)
+		p.socket = nil
+	}
+	if p.listening {
+		pe.Ignore()
+		p.listening = false
+	}
+}
+
+// DeliverProcEvent implements kernel.ProcEventSubscriber.DeliverProcEvent.
+func (p *Protocol) DeliverProcEvent(ctx context.Context, seq, ack uint32, ev *linux.ProcEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.socket == nil {
+		return
+	}
+	// See drivers/connector/connector.c:cn_netlink_send_mult.
+	ms := nlmsg.NewMessageSet(0, seq)
+	m := ms.AddMessage(linux.NetlinkMessageHeader{
+		Type: linux.NLMSG_DONE,
+	})
+	m.Put(&linux.CnMsg{
+		ID: linux.CbID{
+			Idx: linux.CN_IDX_PROC,
+			Val: linux.CN_VAL_PROC,
+		},
+		Seq: seq,
+		Ack: ack,
+		Len: linux.SizeOfProcEvent,
+	})
+	m.Put(ev)
+	// Like Linux, events are dropped if the socket's receive buffer is full.
+	p.socket.SendMessages(ctx, ms)
+}
+
+// ProcessRawMessage implements netlink.RawMessageProcessor.ProcessRawMessage.
+//
+// Invalid messages are silently ignored, as in
+// drivers/connector/connector.c:cn_rx_skb.
+func (p *Protocol) ProcessRawMessage(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message) {
+	payload := msg.Payload()
+	if len(payload) < linux.SizeOfCnMsg {
+		return
+	}
+	var cn linux.CnMsg
+	cn.UnmarshalUnsafe(payload)
+	data := payload[linux.SizeOfCnMsg:]
+	if int(cn.Len) != len(data) {
+		return
+	}
+	if cn.ID.Idx != linux.CN_IDX_PROC || cn.ID.Val != linux.CN_VAL_PROC {
+		return
+	}
+	p.mcastCtl(kernel.TaskFromContext(ctx), &cn, data)
+}
+
+// mcastCtl handles a process events control message.
+//
+// See drivers/connector/cn_proc.c:proc_cn_mcast_ctl.
+func (p *Protocol) mcastCtl(t *kernel.Task, cn *linux.CnMsg, data []byte) {
+	var op uint32
+	switch len(data) {
+	case linux.SizeOfProcInput:
+		// Per-socket event type filtering is not supported; all events are
+		// delivered.
+		var in linux.ProcInput
+		in.UnmarshalUnsafe(data)
+		op = in.MCastOp
+	case 4:
+		op = hostarch.ByteOrder.Uint32(data)
+	default:
+		return
+	}
+
+	// Only tasks in the root user and PID namespaces may listen for events,
+	// since events report IDs in the root PID namespace.
+	k := t.Kernel()
+	if t.UserNamespace() != k.RootUserNamespace() || t.PIDNamespace() != k.RootPIDNamespace() {
+		return
+	}
+
+	pe := k.ProcEvents()
+	var e uint32
+	if !t.HasCapabilityIn(linux.CAP_NET_ADMIN, k.RootUserNamespace()) {
+		e = uint32(errno.EPERM)
+	} else {
+		p.mu.Lock()
+		switch op {
+		case linux.PROC_CN_MCAST_LISTEN:
+			if !p.listening {
+				p.listening = true
+				pe.Listen()
+			}
+		case linux.PROC_CN_MCAST_IGNORE:
+			if p.listening {
+				p.listening = false
+				pe.Ignore()
+			}
+		default:
+			e = uint32(errno.EINVAL)
+		}
+		p.mu.Unlock()
+	}
+	pe.Ack(t, e, cn.Seq, cn.Ack)
+}
+
+// init registers the NETLINK_CONNECTOR provider.
+func init() {
+	netlink.RegisterProvider(linux.NETLINK_CONNECTOR, NewProtocol)
+}
@@ -0,0 +1,171 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"encoding/binary"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/bits"
+	"github.com/wilinz/gvisor/pkg/sentry/socket/netlink/nlmsg"
+)
+
+// attrMap maps the types of netlink attributes, without the NLA_F_* flags, to
+// their values. nftables attributes are in network byte order.
+type attrMap map[uint16]nlmsg.BytesView
+
+// parseAttrs parses the netlink attributes in v.
+func parseAttrs(v nlmsg.AttrsView) (attrMap, bool) {
+	attrs := make(attrMap)
+	for !v.Empty() {
+		hdr, value, rest, ok := v.ParseFirst()
+		if !ok {
+			return nil, false
+		}
+		v = rest
+		attrs[hdr.Type&linux.NLA_TYPE_MASK] = nlmsg.BytesView(value)
+	}
+	return attrs, true
+}
+
+// nested parses the attributes nested in attribute typ, which must be present.
+func (a attrMap) nested(typ uint16) (attrMap, bool) {
+	v, ok := a[typ]
+	if !ok {
+		return nil, false
+	}
+	return parseAttrs(nlmsg.AttrsView(v))
+}
+
+// list returns the values of the NFTA_LIST_ELEM attributes nested in attribute
+// typ, in order. It returns an empty list if typ isn't present.
+func (a attrMap) list(typ uint16) ([]attrMap, bool) {
+	var elems []attrMap
+	v := nlmsg.AttrsView(a[typ])
+	for !v.Empty() {
+		hdr, value, rest, ok := v.ParseFirst()
+		if !ok || hdr.Type&linux.NLA_TYPE_MASK != linux.NFTA_LIST_ELEM {
+			return nil, false
+		}
+		v = rest
+		elem, ok := parseAttrs(nlmsg.AttrsView(value))
+		if !ok {
+			return nil, false
+		}
+		elems = append(elems, elem)
+	}
+	return elems, true
+}
+
+// string returns the value of the string attribute typ, which must be present.
+func (a attrMap) string(typ uint16) (string, bool) {
+	v, ok := a[typ]
+	if !ok {
+		return "", false
+	}
+	return v.String(), true
+}
+
+// uint32 returns the value of the big-endian 32-bit attribute typ, which must
+// be present.
+func (a attrMap) uint32(typ uint16) (uint32, bool) {
+	v, ok := a[typ]
+	if !ok || len(v) != 4 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(v), true
+}
+
+// uint64 returns the value of the big-endian 64-bit attribute typ, which must
+// be present.
+func (a attrMap) uint64(typ uint16) (uint64, bool) {
+	v, ok := a[typ]
+	if !ok || len(v) != 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(v), true
+}
+
+// uint16 returns the value of the big-endian 16-bit attribute typ, which must
+// be present.
+func (a attrMap) uint16(typ uint16) (uint16, bool) {
+	v, ok := a[typ]
+	if !ok || len(v) != 2 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint16(v), true
+}
+
+// byte returns the value of the 8-bit attribute typ, which must be present.
+func (a attrMap) byte(typ uint16) (uint8, bool) {
+	v, ok := a[typ]
+	if !ok || len(v) != 1 {
+		return 0, false
+	}
+	return v[0], true
+}
+
+// uint8 returns the value of the big-endian 32-bit attribute typ, which must
+// be present and fit in a byte. Registers, lengths and offsets are passed as
+// 32-bit attributes.
+func (a attrMap) uint8(typ uint16) (uint8, bool) {
+	v, ok := a.uint32(typ)
+	if !ok || v > 0xff {
+		return 0, false
+	}
+	return uint8(v), true
+}
+
+// attrBuilder serializes netlink attributes, for nesting in other attributes.
+type attrBuilder []byte
+
+// put appends attribute typ with value v.
+func (b *attrBuilder) put(typ uint16, v []byte) {
+	l := linux.NetlinkAttrHeaderSize + len(v)
+	*b = binary.NativeEndian.AppendUint16(*b, uint16(l))
+	*b = binary.NativeEndian.AppendUint16(*b, typ)
+	*b = append(*b, v...)
+	*b = append(*b, make([]byte, bits.AlignUp(l, linux.NLA_ALIGNTO)-l)...)
+}
+
+// putString appends the string attribute typ with value s.
+func (b *attrBuilder) putString(typ uint16, s string) {
+	b.put(typ, append([]byte(s), 0))
+}
+
+// putNested appends the attribute typ, with the attributes of nested as value.
+func (b *attrBuilder) putNested(typ uint16, nested attrBuilder) {
+	b.put(typ|linux.NLA_F_NESTED, nested)
+}
+
+// putByte appends the 8-bit attribute typ with value v.
+func (b *attrBuilder) putByte(typ uint16, v uint8) {
+	b.put(typ, []byte{v})
+}
+
+// putUint16 appends the big-endian 16-bit attribute typ with value v.
+func (b *attrBuilder) putUint16(typ uint16, v uint16) {
+	b.put(typ, binary.BigEndian.AppendUint16(nil, v))
+}
+
+// putUint32 appends the big-endian 32-bit attribute typ with value v.
+func (b *attrBuilder) putUint32(typ uint16, v uint32) {
+	b.put(typ, binary.BigEndian.AppendUint32(nil, v))
+}
+
+// putUint64 appends the big-endian 64-bit attribute typ with value v.
+func (b *attrBuilder) putUint64(typ uint16, v uint64) {
+	b.put(typ, binary.BigEndian.AppendUint64(nil, v))
+}
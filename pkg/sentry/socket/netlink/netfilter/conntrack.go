@@ -0,0 +1,270 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/syserr"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/header"
+	"github.com/wilinz/gvisor/pkg/tcpip/stack"
+	"github.com/wilinz/gvisor/pkg/tcpip/transport/tcpconntrack"
+)
+
+// processConnTrack handles NFNL_SUBSYS_CTNETLINK requests.
+func (r *request) processConnTrack(it *stack.IPTables, msgType uint16) *syserr.Error {
+	netProto, ok := ctNetProtos[r.family]
+	if !ok {
+		return syserr.ErrNotSupported
+	}
+	dump := r.hdr.Flags&linux.NLM_F_DUMP == linux.NLM_F_DUMP
+	if dump {
+		r.ms.Multi = true
+	}
+
+	switch msgType {
+	case linux.IPCTNL_MSG_CT_GET:
+		if dump {
+			for _, e := range it.ConnTrackEntries() {
+				if netProto == 0 || e.Original.NetProto == netProto {
+					r.putConnTrackEntry(&e)
+				}
+			}
+			return nil
+		}
+		tuple, err := r.connTrackTuple()
+		if err != nil {
+			return err
+		}
+		e, ok := it.ConnTrackEntry(tuple)
+		if !ok {
+			return syserr.ErrNoFileOrDir
+		}
+		r.putConnTrackEntry(&e)
+		return nil
+
+	case linux.IPCTNL_MSG_CT_DELETE:
+		// Without a tuple, all connections of the family are deleted.
+		_, orig := r.attrs[linux.CTA_TUPLE_ORIG]
+		_, reply := r.attrs[linux.CTA_TUPLE_REPLY]
+		if !orig && !reply {
+			it.FlushConnTrack(netProto)
+			return nil
+		}
+		tuple, err := r.connTrackTuple()
+		if err != nil {
+			return err
+		}
+		if !it.DeleteConnTrackEntry(tuple) {
+			return syserr.ErrNoFileOrDir
+		}
+		return nil
+
+	case linux.IPCTNL_MSG_CT_GET_DYING, linux.IPCTNL_MSG_CT_GET_UNCONFIRMED:
+		// Connections are removed as soon as they time out, and
+		// unconfirmed connections aren't visible outside of the stack.
+		if dump {
+			return nil
+		}
+		return syserr.ErrNotSupported
+
+	default:
+		// Connections can't be created or updated, and counters can't be
+		// zeroed.
+		return syserr.ErrNotSupported
+	}
+}
+
+// ctNetProtos maps the families of conntrack requests to network protocols.
+// AF_UNSPEC selects all protocols.
+var ctNetProtos = map[uint8]tcpip.NetworkProtocolNumber{
+	linux.AF_UNSPEC: 0,
+	linux.AF_INET:   header.IPv4ProtocolNumber,
+	linux.AF_INET6:  header.IPv6ProtocolNumber,
+}
+
+// ctTCPStates maps the states of tracked TCP connections to TCP_CONNTRACK_*
+// states. gVisor tracks fewer states than Linux, so this is approximate.
+var ctTCPStates = map[tcpconntrack.Result]uint8{
+	tcpconntrack.ResultConnecting:         linux.TCP_CONNTRACK_SYN_SENT,
+	tcpconntrack.ResultAlive:              linux.TCP_CONNTRACK_ESTABLISHED,
+	tcpconntrack.ResultReset:              linux.TCP_CONNTRACK_CLOSE,
+	tcpconntrack.ResultClosedByResponder:  linux.TCP_CONNTRACK_TIME_WAIT,
+	tcpconntrack.ResultClosedByOriginator: linux.TCP_CONNTRACK_TIME_WAIT,
+}
+
+// putConnTrackEntry adds a IPCTNL_MSG_CT_NEW message describing e.
+func (r *request) putConnTrackEntry(e *stack.ConnTrackEntry) {
+	family := uint8(linux.AF_INET)
+	if e.Original.NetProto == header.IPv6ProtocolNumber {
+		family = linux.AF_INET6
+	}
+	m := r.addMessage(linux.IPCTNL_MSG_CT_NEW, family)
+	putNested(m, linux.CTA_TUPLE_ORIG, connTrackTupleAttrs(&e.Original, false /* reply */))
+	putNested(m, linux.CTA_TUPLE_REPLY, connTrackTupleAttrs(&e.Reply, true /* reply */))
+
+	status := uint32(linux.IPS_CONFIRMED)
+	if e.SeenReply {
+		status |= linux.IPS_SEEN_REPLY
+		if e.Original.TransProto != header.TCPProtocolNumber || e.TCPState == tcpconntrack.ResultAlive {
+			status |= linux.IPS_ASSURED
+		}
+	}
+	if e.SourceNAT {
+		status |= linux.IPS_SRC_NAT
+	}
+	if e.DestinationNAT {
+		status |= linux.IPS_DST_NAT
+	}
+	m.PutAttr(linux.CTA_STATUS, be32(status))
+	m.PutAttr(linux.CTA_TIMEOUT, be32(uint32(e.Timeout.Seconds())))
+
+	if e.Original.TransProto == header.TCPProtocolNumber {
+		var tcp attrBuilder
+		tcp.putByte(linux.CTA_PROTOINFO_TCP_STATE, ctTCPStates[e.TCPState])
+		var protoInfo attrBuilder
+		protoInfo.putNested(linux.CTA_PROTOINFO_TCP, tcp)
+		putNested(m, linux.CTA_PROTOINFO, protoInfo)
+	}
+
+	for i, typ := range [...]uint16{linux.CTA_COUNTERS_ORIG, linux.CTA_COUNTERS_REPLY} {
+		var counters attrBuilder
+		counters.putUint64(linux.CTA_COUNTERS_PACKETS, e.Packets[i])
+		counters.putUint64(linux.CTA_COUNTERS_BYTES, e.Bytes[i])
+		putNested(m, typ, counters)
+	}
+}
+
+// isICMP returns true if t is an ICMP or ICMPv6 tuple.
+func isICMP(t *stack.ConnTrackTuple) bool {
+	return t.TransProto == header.ICMPv4ProtocolNumber || t.TransProto == header.ICMPv6ProtocolNumber
+}
+
+// connTrackTupleAttrs returns the CTA_TUPLE_* attributes describing t. reply is
+// true for the tuple of the reply direction.
+func connTrackTupleAttrs(t *stack.ConnTrackTuple, reply bool) attrBuilder {
+	var ip attrBuilder
+	if t.NetProto == header.IPv6ProtocolNumber {
+		ip.put(linux.CTA_IP_V6_SRC, t.SrcAddr.AsSlice())
+		ip.put(linux.CTA_IP_V6_DST, t.DstAddr.AsSlice())
+	} else {
+		ip.put(linux.CTA_IP_V4_SRC, t.SrcAddr.AsSlice())
+		ip.put(linux.CTA_IP_V4_DST, t.DstAddr.AsSlice())
+	}
+
+	var proto attrBuilder
+	proto.putByte(linux.CTA_PROTO_NUM, uint8(t.TransProto))
+	switch {
+	case isICMP(t):
+		// Echo requests are tracked in the original direction, and replies
+		// in the reply direction.
+		id, typ := t.SrcPort, uint8(header.ICMPv4Echo)
+		if reply {
+			id, typ = t.DstPort, uint8(header.ICMPv4EchoReply)
+		}
+		if t.TransProto == header.ICMPv6ProtocolNumber {
+			typ = uint8(header.ICMPv6EchoRequest)
+			if reply {
+				typ = uint8(header.ICMPv6EchoReply)
+			}
+			proto.putUint16(linux.CTA_PROTO_ICMPV6_ID, id)
+			proto.putByte(linux.CTA_PROTO_ICMPV6_TYPE, typ)
+			proto.putByte(linux.CTA_PROTO_ICMPV6_CODE, 0)
+		} else {
+			proto.putUint16(linux.CTA_PROTO_ICMP_ID, id)
+			proto.putByte(linux.CTA_PROTO_ICMP_TYPE, typ)
+			proto.putByte(linux.CTA_PROTO_ICMP_CODE, 0)
+		}
+	default:
+		proto.putUint16(linux.CTA_PROTO_SRC_PORT, t.SrcPort)
+		proto.putUint16(linux.CTA_PROTO_DST_PORT, t.DstPort)
+	}
+
+	var tuple attrBuilder
+	tuple.putNested(linux.CTA_TUPLE_IP, ip)
+	tuple.putNested(linux.CTA_TUPLE_PROTO, proto)
+	return tuple
+}
+
+// connTrackTuple returns the tuple in the CTA_TUPLE_ORIG or, if it isn't
+// present, CTA_TUPLE_REPLY attribute of the request.
+func (r *request) connTrackTuple() (stack.ConnTrackTuple, *syserr.Error) {
+	typ := uint16(linux.CTA_TUPLE_ORIG)
+	if _, ok := r.attrs[typ]; !ok {
+		typ = linux.CTA_TUPLE_REPLY
+	}
+	tupleAttrs, ok := r.attrs.nested(typ)
+	if !ok {
+		return stack.ConnTrackTuple{}, syserr.ErrInvalidArgument
+	}
+	ip, ok := tupleAttrs.nested(linux.CTA_TUPLE_IP)
+	if !ok {
+		return stack.ConnTrackTuple{}, syserr.ErrInvalidArgument
+	}
+	proto, ok := tupleAttrs.nested(linux.CTA_TUPLE_PROTO)
+	if !ok {
+		return stack.ConnTrackTuple{}, syserr.ErrInvalidArgument
+	}
+
+	var t stack.ConnTrackTuple
+	src, dst := uint16(linux.CTA_IP_V4_SRC), uint16(linux.CTA_IP_V4_DST)
+	addrLen := header.IPv4AddressSize
+	t.NetProto = header.IPv4ProtocolNumber
+	if _, ok := ip[linux.CTA_IP_V6_SRC]; ok {
+		src, dst = linux.CTA_IP_V6_SRC, linux.CTA_IP_V6_DST
+		addrLen = header.IPv6AddressSize
+		t.NetProto = header.IPv6ProtocolNumber
+	}
+	if len(ip[src]) != addrLen || len(ip[dst]) != addrLen {
+		return stack.ConnTrackTuple{}, syserr.ErrInvalidArgument
+	}
+	t.SrcAddr = tcpip.AddrFromSlice(ip[src])
+	t.DstAddr = tcpip.AddrFromSlice(ip[dst])
+
+	protoNum, ok := proto.byte(linux.CTA_PROTO_NUM)
+	if !ok {
+		return stack.ConnTrackTuple{}, syserr.ErrInvalidArgument
+	}
+	t.TransProto = tcpip.TransportProtocolNumber(protoNum)
+	if isICMP(&t) {
+		idTyp, typeTyp := uint16(linux.CTA_PROTO_ICMP_ID), uint16(linux.CTA_PROTO_ICMP_TYPE)
+		request := uint8(header.ICMPv4Echo)
+		if t.TransProto == header.ICMPv6ProtocolNumber {
+			idTyp, typeTyp = linux.CTA_PROTO_ICMPV6_ID, linux.CTA_PROTO_ICMPV6_TYPE
+			request = uint8(header.ICMPv6EchoRequest)
+		}
+		id, ok := proto.uint16(idTyp)
+		if !ok {
+			return stack.ConnTrackTuple{}, syserr.ErrInvalidArgument
+		}
+		icmpType, ok := proto.byte(typeTyp)
+		if !ok {
+			return stack.ConnTrackTuple{}, syserr.ErrInvalidArgument
+		}
+		if icmpType == request {
+			t.SrcPort = id
+		} else {
+			t.DstPort = id
+		}
+		return t, nil
+	}
+	if t.SrcPort, ok = proto.uint16(linux.CTA_PROTO_SRC_PORT); !ok {
+		return stack.ConnTrackTuple{}, syserr.ErrInvalidArgument
+	}
+	if t.DstPort, ok = proto.uint16(linux.CTA_PROTO_DST_PORT); !ok {
+		return stack.ConnTrackTuple{}, syserr.ErrInvalidArgument
+	}
+	return t, nil
+}
@@ -0,0 +1,291 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package netfilter provides a NETLINK_NETFILTER socket protocol.
+//
+// The nftables (NFNL_SUBSYS_NFTABLES) and conntrack (NFNL_SUBSYS_CTNETLINK)
+// subsystems are supported, for netstack network namespaces.
+//
+// Tables, chains and rules configured through nftables are kept in the
+// nftables.Ruleset of the namespace's stack, which evaluates packets at the
+// stack's netfilter hooks after iptables. Unlike Linux, the messages of a batch
+// are applied one at a time rather than atomically, and rules can't be listed
+// or deleted individually.
+//
+// Connections tracked by the stack can be listed and deleted through
+// conntrack, but not created or updated.
+package netfilter
+
+import (
+	"encoding/binary"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/marshal"
+	"github.com/wilinz/gvisor/pkg/marshal/primitive"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
+	"github.com/wilinz/gvisor/pkg/sentry/socket"
+	"github.com/wilinz/gvisor/pkg/sentry/socket/netlink"
+	"github.com/wilinz/gvisor/pkg/sentry/socket/netlink/nlmsg"
+	"github.com/wilinz/gvisor/pkg/sentry/socket/netstack"
+	"github.com/wilinz/gvisor/pkg/syserr"
+	"github.com/wilinz/gvisor/pkg/tcpip/nftables"
+)
+
+// Protocol implements netlink.Protocol.
+//
+// +stateify savable
+type Protocol struct{}
+
+var _ netlink.Protocol = (*Protocol)(nil)
+
+// NewProtocol creates a NETLINK_NETFILTER netlink.Protocol.
+func NewProtocol(t *kernel.Task) (netlink.Protocol, *syserr.Error) {
+	return &Protocol{}, nil
+}
+
+// Protocol implements netlink.Protocol.Protocol.
+func (p *Protocol) Protocol() int {
+	return linux.NETLINK_NETFILTER
+}
+
+// CanSend implements netlink.Protocol.CanSend.
+func (p *Protocol) CanSend() bool {
+	return true
+}
+
+// isGetMessage returns true if the nftables message type msgType only reads
+// the ruleset.
+func isGetMessage(msgType uint16) bool {
+	switch msgType {
+	case linux.NFT_MSG_GETTABLE, linux.NFT_MSG_GETCHAIN, linux.NFT_MSG_GETRULE,
+		linux.NFT_MSG_GETSET, linux.NFT_MSG_GETSETELEM, linux.NFT_MSG_GETGEN,
+		linux.NFT_MSG_GETOBJ, linux.NFT_MSG_GETFLOWTABLE:
+		return true
+	default:
+		return false
+	}
+}
+
+// ProcessMessage implements netlink.Protocol.ProcessMessage.
+func (p *Protocol) ProcessMessage(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	hdr := msg.Header()
+
+	// All messages start with a nfgenmsg.
+	var genMsg linux.NetFilterGenMsg
+	attrs, ok := msg.GetData(&genMsg)
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+
+	// Batches delimit messages which Linux applies atomically. Here,
+	// messages are applied as they are received.
+	if hdr.Type == linux.NFNL_MSG_BATCH_BEGIN || hdr.Type == linux.NFNL_MSG_BATCH_END {
+		return nil
+	}
+	subsys := linux.NFNL_SUBSYS_ID(hdr.Type)
+	if subsys != linux.NFNL_SUBSYS_NFTABLES && subsys != linux.NFNL_SUBSYS_CTNETLINK {
+		return syserr.ErrNotSupported
+	}
+	msgType := linux.NFNL_MSG_TYPE(hdr.Type)
+
+	// Like Linux, conntrack requires CAP_NET_ADMIN to read the connection
+	// table.
+	if subsys == linux.NFNL_SUBSYS_CTNETLINK || !isGetMessage(msgType) {
+		creds := auth.CredentialsFromContext(ctx)
+		if !creds.HasCapability(linux.CAP_NET_ADMIN) {
+			return syserr.ErrPermissionDenied
+		}
+	}
+
+	stk, ok := s.Stack().(*netstack.Stack)
+	if !ok {
+		// netfilter is only supported by netstack.
+		return syserr.ErrProtocolNotSupported
+	}
+	a, ok := parseAttrs(attrs)
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	req := &request{
+		hdr:    hdr,
+		subsys: subsys,
+		family: genMsg.Family,
+		attrs:  a,
+		ms:     ms,
+	}
+
+	if subsys == linux.NFNL_SUBSYS_CTNETLINK {
+		return req.processConnTrack(stk.Stack.IPTables(), msgType)
+	}
+
+	rs := rulesetFromStack(stk)
+	if msgType == linux.NFT_MSG_GETGEN {
+		return req.getGen(ctx, rs)
+	}
+	if isGetMessage(msgType) {
+		var err *syserr.Error
+		rs.View(func(nf *nftables.NFTables, genID uint32) {
+			req.genID = genID
+			err = req.get(nf, msgType)
+		})
+		return err
+	}
+	return update(rs, func(nf *nftables.NFTables) *syserr.Error {
+		return req.update(nf, msgType)
+	})
+}
+
+// rulesetFromStack returns the nftables ruleset of stk, creating it if needed.
+func rulesetFromStack(stk *netstack.Stack) *nftables.Ruleset {
+	it := stk.Stack.IPTables()
+	if rs, ok := it.NFTables().(*nftables.Ruleset); ok {
+		return rs
+	}
+	rs := nftables.NewRuleset(nftables.NewNFTables(stk.Stack.Clock(), stk.Stack.SecureRNG()))
+	return it.SetNFTablesIfUnset(rs).(*nftables.Ruleset)
+}
+
+// update calls fn to change the ruleset rs.
+func update(rs *nftables.Ruleset, fn func(nf *nftables.NFTables) *syserr.Error) *syserr.Error {
+	var serr *syserr.Error
+	rs.Update(func(nf *nftables.NFTables) error {
+		serr = fn(nf)
+		if serr != nil {
+			return serr.ToError()
+		}
+		return nil
+	})
+	return serr
+}
+
+// request is an nftables request being processed.
+type request struct {
+	// hdr is the header of the request.
+	hdr linux.NetlinkMessageHeader
+
+	// subsys is the NFNL_SUBSYS_* subsystem of the request.
+	subsys uint16
+
+	// family is the NFPROTO_* family of the request.
+	family uint8
+
+	// attrs are the attributes of the request.
+	attrs attrMap
+
+	// ms is the set of response messages.
+	ms *nlmsg.MessageSet
+
+	// genID is the generation of the ruleset when the request was processed.
+	genID uint32
+}
+
+// addMessage adds a response message of type msgType for an object of the
+// NFPROTO_* family. If the request is a dump, the message is part of a
+// multipart response.
+func (r *request) addMessage(msgType uint16, family uint8) *nlmsg.Message {
+	var flags uint16
+	if r.hdr.Flags&linux.NLM_F_DUMP == linux.NLM_F_DUMP {
+		flags = linux.NLM_F_MULTI
+	}
+	m := r.ms.AddMessage(linux.NetlinkMessageHeader{
+		Type:  r.subsys<<8 | msgType,
+		Flags: flags,
+	})
+	m.Put(&linux.NetFilterGenMsg{
+		Family:     family,
+		Version:    linux.NFNETLINK_V0,
+		ResourceID: socket.Htons(uint16(r.genID)),
+	})
+	return m
+}
+
+// getGen handles NFT_MSG_GETGEN requests.
+func (r *request) getGen(ctx context.Context, rs *nftables.Ruleset) *syserr.Error {
+	rs.View(func(nf *nftables.NFTables, genID uint32) {
+		r.genID = genID
+	})
+	m := r.addMessage(linux.NFT_MSG_NEWGEN, linux.NFPROTO_UNSPEC)
+	m.PutAttr(linux.NFTA_GEN_ID, be32(r.genID))
+	if t := kernel.TaskFromContext(ctx); t != nil {
+		m.PutAttr(linux.NFTA_GEN_PROC_PID, be32(uint32(t.PIDNamespace().IDOfThreadGroup(t.ThreadGroup()))))
+		m.PutAttrString(linux.NFTA_GEN_PROC_NAME, t.Name())
+	}
+	return nil
+}
+
+// get handles requests reading the ruleset.
+func (r *request) get(nf *nftables.NFTables, msgType uint16) *syserr.Error {
+	dump := r.hdr.Flags&linux.NLM_F_DUMP == linux.NLM_F_DUMP
+	if dump {
+		r.ms.Multi = true
+	}
+	switch msgType {
+	case linux.NFT_MSG_GETTABLE:
+		if dump {
+			return r.dumpTables(nf)
+		}
+		return r.getTable(nf)
+	case linux.NFT_MSG_GETCHAIN:
+		if dump {
+			return r.dumpChains(nf)
+		}
+		return r.getChain(nf)
+	case linux.NFT_MSG_GETSET, linux.NFT_MSG_GETOBJ, linux.NFT_MSG_GETFLOWTABLE:
+		// Sets, stateful objects and flowtables aren't supported, so
+		// there are none to dump.
+		if dump {
+			return nil
+		}
+		return syserr.ErrNoFileOrDir
+	default:
+		return syserr.ErrNotSupported
+	}
+}
+
+// update handles requests changing the ruleset.
+func (r *request) update(nf *nftables.NFTables, msgType uint16) *syserr.Error {
+	switch msgType {
+	case linux.NFT_MSG_NEWTABLE:
+		return r.newTable(nf)
+	case linux.NFT_MSG_DELTABLE, linux.NFT_MSG_DESTROYTABLE:
+		return r.delTable(nf, msgType == linux.NFT_MSG_DESTROYTABLE)
+	case linux.NFT_MSG_NEWCHAIN:
+		return r.newChain(nf)
+	case linux.NFT_MSG_DELCHAIN, linux.NFT_MSG_DESTROYCHAIN:
+		return r.delChain(nf, msgType == linux.NFT_MSG_DESTROYCHAIN)
+	case linux.NFT_MSG_NEWRULE:
+		return r.newRule(nf)
+	case linux.NFT_MSG_DELRULE, linux.NFT_MSG_DESTROYRULE:
+		return r.delRule(nf, msgType == linux.NFT_MSG_DESTROYRULE)
+	default:
+		return syserr.ErrNotSupported
+	}
+}
+
+// be32 returns v as a big-endian netlink attribute value.
+func be32(v uint32) marshal.Marshallable {
+	return primitive.AsByteSlice(binary.BigEndian.AppendUint32(nil, v))
+}
+
+// putNested adds the attribute typ to m, with the attributes of nested as
+// value.
+func putNested(m *nlmsg.Message, typ uint16, nested attrBuilder) {
+	m.PutAttr(typ|linux.NLA_F_NESTED, primitive.AsByteSlice(nested))
+}
+
+func init() {
+	netlink.RegisterProvider(linux.NETLINK_NETFILTER, NewProtocol)
+}
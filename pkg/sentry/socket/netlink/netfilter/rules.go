@@ -0,0 +1,347 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"encoding/binary"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/syserr"
+	"github.com/wilinz/gvisor/pkg/tcpip/nftables"
+)
+
+// newRule handles NFT_MSG_NEWRULE requests. Rules are appended to their chain
+// with NLM_F_APPEND and prepended otherwise.
+func (r *request) newRule(nf *nftables.NFTables) *syserr.Error {
+	c, err := r.lookupChain(nf, linux.NFTA_RULE_TABLE, linux.NFTA_RULE_CHAIN)
+	if err != nil {
+		return err
+	}
+	// Rules are not identified by handles, so they can't be replaced or
+	// inserted relative to another rule.
+	if _, ok := r.attrs[linux.NFTA_RULE_HANDLE]; ok {
+		return syserr.ErrNotSupported
+	}
+	if _, ok := r.attrs[linux.NFTA_RULE_POSITION]; ok {
+		return syserr.ErrNotSupported
+	}
+
+	exprs, ok := r.attrs.list(linux.NFTA_RULE_EXPRESSIONS)
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	rule := &nftables.Rule{}
+	for _, expr := range exprs {
+		if err := addExpression(rule, expr); err != nil {
+			return err
+		}
+	}
+
+	index := 0
+	if r.hdr.Flags&linux.NLM_F_APPEND != 0 {
+		index = -1
+	}
+	if rerr := c.RegisterRule(rule, index); rerr != nil {
+		return syserr.ErrInvalidArgument
+	}
+	return nil
+}
+
+// delRule handles NFT_MSG_DELRULE and NFT_MSG_DESTROYRULE requests. Only
+// flushing a chain, or all chains of a table, is supported.
+func (r *request) delRule(nf *nftables.NFTables, destroy bool) *syserr.Error {
+	if _, ok := r.attrs[linux.NFTA_RULE_HANDLE]; ok {
+		return syserr.ErrNotSupported
+	}
+	t, err := r.lookupTable(nf, linux.NFTA_RULE_TABLE)
+	if err != nil {
+		if err == syserr.ErrNoFileOrDir && destroy {
+			return nil
+		}
+		return err
+	}
+	if _, ok := r.attrs[linux.NFTA_RULE_CHAIN]; !ok {
+		for _, c := range t.Chains() {
+			c.Flush()
+		}
+		return nil
+	}
+	c, err := r.lookupChain(nf, linux.NFTA_RULE_TABLE, linux.NFTA_RULE_CHAIN)
+	if err != nil {
+		if err == syserr.ErrNoFileOrDir && destroy {
+			return nil
+		}
+		return err
+	}
+	c.Flush()
+	return nil
+}
+
+// addExpression adds the operation described by the NFTA_EXPR_* attributes
+// expr to rule.
+func addExpression(rule *nftables.Rule, expr attrMap) *syserr.Error {
+	name, ok := expr.string(linux.NFTA_EXPR_NAME)
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	var a attrMap
+	if _, ok := expr[linux.NFTA_EXPR_DATA]; ok {
+		if a, ok = expr.nested(linux.NFTA_EXPR_DATA); !ok {
+			return syserr.ErrInvalidArgument
+		}
+	}
+
+	var err error
+	switch name {
+	case "immediate":
+		err = addImmediate(rule, a)
+	case "cmp":
+		err = addComparison(rule, a)
+	case "range":
+		err = addRange(rule, a)
+	case "payload":
+		err = addPayload(rule, a)
+	case "bitwise":
+		err = addBitwise(rule, a)
+	case "byteorder":
+		err = addByteorder(rule, a)
+	case "meta":
+		err = addMeta(rule, a)
+	case "rt":
+		err = addRoute(rule, a)
+	case "counter":
+		err = addCounter(rule, a)
+	default:
+		return syserr.ErrNoFileOrDir
+	}
+	if err == errUnsupportedExpr {
+		return syserr.ErrNotSupported
+	}
+	if err != nil {
+		return syserr.ErrInvalidArgument
+	}
+	return nil
+}
+
+var (
+	// errInvalidExpr is returned for expressions with missing or malformed
+	// attributes.
+	errInvalidExpr = syserr.ErrInvalidArgument.ToError()
+
+	// errUnsupportedExpr is returned for valid expressions which aren't
+	// supported.
+	errUnsupportedExpr = syserr.ErrNotSupported.ToError()
+)
+
+// dataValue returns the NFTA_DATA_VALUE nested in attribute typ.
+func dataValue(a attrMap, typ uint16) ([]byte, bool) {
+	data, ok := a.nested(typ)
+	if !ok {
+		return nil, false
+	}
+	v, ok := data[linux.NFTA_DATA_VALUE]
+	return v, ok
+}
+
+func addImmediate(rule *nftables.Rule, a attrMap) error {
+	dreg, ok := a.uint8(linux.NFTA_IMMEDIATE_DREG)
+	if !ok {
+		return errInvalidExpr
+	}
+	data, ok := a.nested(linux.NFTA_IMMEDIATE_DATA)
+	if !ok {
+		return errInvalidExpr
+	}
+	if v, ok := data[linux.NFTA_DATA_VALUE]; ok {
+		return rule.AddImmediate(dreg, v)
+	}
+	verdict, ok := data.nested(linux.NFTA_DATA_VERDICT)
+	if !ok || dreg != linux.NFT_REG_VERDICT {
+		return errInvalidExpr
+	}
+	code, ok := verdict.uint32(linux.NFTA_VERDICT_CODE)
+	if !ok {
+		return errInvalidExpr
+	}
+	v := nftables.Verdict{Code: code}
+	if _, ok := verdict[linux.NFTA_VERDICT_CHAIN]; ok {
+		v.ChainName, _ = verdict.string(linux.NFTA_VERDICT_CHAIN)
+	}
+	return rule.AddImmediateVerdict(v)
+}
+
+func addComparison(rule *nftables.Rule, a attrMap) error {
+	sreg, ok := a.uint8(linux.NFTA_CMP_SREG)
+	if !ok {
+		return errInvalidExpr
+	}
+	op, ok := a.uint32(linux.NFTA_CMP_OP)
+	if !ok {
+		return errInvalidExpr
+	}
+	data, ok := dataValue(a, linux.NFTA_CMP_DATA)
+	if !ok {
+		return errInvalidExpr
+	}
+	return rule.AddComparison(sreg, int(op), data)
+}
+
+func addRange(rule *nftables.Rule, a attrMap) error {
+	sreg, ok := a.uint8(linux.NFTA_RANGE_SREG)
+	if !ok {
+		return errInvalidExpr
+	}
+	op, ok := a.uint32(linux.NFTA_RANGE_OP)
+	if !ok {
+		return errInvalidExpr
+	}
+	low, ok := dataValue(a, linux.NFTA_RANGE_FROM_DATA)
+	if !ok {
+		return errInvalidExpr
+	}
+	high, ok := dataValue(a, linux.NFTA_RANGE_TO_DATA)
+	if !ok {
+		return errInvalidExpr
+	}
+	return rule.AddRange(sreg, int(op), low, high)
+}
+
+func addPayload(rule *nftables.Rule, a attrMap) error {
+	base, ok := a.uint8(linux.NFTA_PAYLOAD_BASE)
+	if !ok {
+		return errInvalidExpr
+	}
+	offset, ok := a.uint8(linux.NFTA_PAYLOAD_OFFSET)
+	if !ok {
+		return errInvalidExpr
+	}
+	blen, ok := a.uint8(linux.NFTA_PAYLOAD_LEN)
+	if !ok {
+		return errInvalidExpr
+	}
+	if dreg, ok := a.uint8(linux.NFTA_PAYLOAD_DREG); ok {
+		return rule.AddPayloadLoad(base, offset, blen, dreg)
+	}
+	sreg, ok := a.uint8(linux.NFTA_PAYLOAD_SREG)
+	if !ok {
+		return errInvalidExpr
+	}
+	// The checksum attributes are optional.
+	csumType, _ := a.uint8(linux.NFTA_PAYLOAD_CSUM_TYPE)
+	csumOffset, _ := a.uint8(linux.NFTA_PAYLOAD_CSUM_OFFSET)
+	csumFlags, _ := a.uint8(linux.NFTA_PAYLOAD_CSUM_FLAGS)
+	return rule.AddPayloadSet(base, offset, blen, sreg, csumType, csumOffset, csumFlags)
+}
+
+func addBitwise(rule *nftables.Rule, a attrMap) error {
+	sreg, ok := a.uint8(linux.NFTA_BITWISE_SREG)
+	if !ok {
+		return errInvalidExpr
+	}
+	dreg, ok := a.uint8(linux.NFTA_BITWISE_DREG)
+	if !ok {
+		return errInvalidExpr
+	}
+	op := uint32(linux.NFT_BITWISE_BOOL)
+	if _, ok := a[linux.NFTA_BITWISE_OP]; ok {
+		if op, ok = a.uint32(linux.NFTA_BITWISE_OP); !ok {
+			return errInvalidExpr
+		}
+	}
+	switch op {
+	case linux.NFT_BITWISE_BOOL:
+		mask, ok := dataValue(a, linux.NFTA_BITWISE_MASK)
+		if !ok {
+			return errInvalidExpr
+		}
+		xor, ok := dataValue(a, linux.NFTA_BITWISE_XOR)
+		if !ok {
+			return errInvalidExpr
+		}
+		return rule.AddBitwiseBool(sreg, dreg, mask, xor)
+	case linux.NFT_BITWISE_LSHIFT, linux.NFT_BITWISE_RSHIFT:
+		blen, ok := a.uint8(linux.NFTA_BITWISE_LEN)
+		if !ok {
+			return errInvalidExpr
+		}
+		// Like Linux, the shift is a host-endian 32-bit value.
+		data, ok := dataValue(a, linux.NFTA_BITWISE_DATA)
+		if !ok || len(data) != 4 {
+			return errInvalidExpr
+		}
+		shift := binary.NativeEndian.Uint32(data)
+		return rule.AddBitwiseShift(sreg, dreg, blen, shift, op == linux.NFT_BITWISE_RSHIFT)
+	default:
+		return errUnsupportedExpr
+	}
+}
+
+func addByteorder(rule *nftables.Rule, a attrMap) error {
+	sreg, ok := a.uint8(linux.NFTA_BYTEORDER_SREG)
+	if !ok {
+		return errInvalidExpr
+	}
+	dreg, ok := a.uint8(linux.NFTA_BYTEORDER_DREG)
+	if !ok {
+		return errInvalidExpr
+	}
+	op, ok := a.uint32(linux.NFTA_BYTEORDER_OP)
+	if !ok {
+		return errInvalidExpr
+	}
+	blen, ok := a.uint8(linux.NFTA_BYTEORDER_LEN)
+	if !ok {
+		return errInvalidExpr
+	}
+	size, ok := a.uint8(linux.NFTA_BYTEORDER_SIZE)
+	if !ok {
+		return errInvalidExpr
+	}
+	return rule.AddByteorder(sreg, dreg, int(op), blen, size)
+}
+
+func addMeta(rule *nftables.Rule, a attrMap) error {
+	key, ok := a.uint32(linux.NFTA_META_KEY)
+	if !ok {
+		return errInvalidExpr
+	}
+	if dreg, ok := a.uint8(linux.NFTA_META_DREG); ok {
+		return rule.AddMetaLoad(int(key), dreg)
+	}
+	sreg, ok := a.uint8(linux.NFTA_META_SREG)
+	if !ok {
+		return errInvalidExpr
+	}
+	return rule.AddMetaSet(int(key), sreg)
+}
+
+func addRoute(rule *nftables.Rule, a attrMap) error {
+	key, ok := a.uint32(linux.NFTA_RT_KEY)
+	if !ok {
+		return errInvalidExpr
+	}
+	dreg, ok := a.uint8(linux.NFTA_RT_DREG)
+	if !ok {
+		return errInvalidExpr
+	}
+	return rule.AddRoute(int(key), dreg)
+}
+
+func addCounter(rule *nftables.Rule, a attrMap) error {
+	// The initial counts are optional.
+	bytes, _ := a.uint64(linux.NFTA_COUNTER_BYTES)
+	packets, _ := a.uint64(linux.NFTA_COUNTER_PACKETS)
+	return rule.AddCounter(int64(bytes), int64(packets))
+}
@@ -0,0 +1,431 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/syserr"
+	"github.com/wilinz/gvisor/pkg/tcpip/nftables"
+)
+
+// families maps NFPROTO_* families to nftables address families.
+var families = map[uint8]nftables.AddressFamily{
+	linux.NFPROTO_IPV4:   nftables.IP,
+	linux.NFPROTO_IPV6:   nftables.IP6,
+	linux.NFPROTO_INET:   nftables.Inet,
+	linux.NFPROTO_ARP:    nftables.Arp,
+	linux.NFPROTO_BRIDGE: nftables.Bridge,
+	linux.NFPROTO_NETDEV: nftables.Netdev,
+}
+
+// nfprotos maps nftables address families to NFPROTO_* families.
+var nfprotos = map[nftables.AddressFamily]uint8{
+	nftables.IP:     linux.NFPROTO_IPV4,
+	nftables.IP6:    linux.NFPROTO_IPV6,
+	nftables.Inet:   linux.NFPROTO_INET,
+	nftables.Arp:    linux.NFPROTO_ARP,
+	nftables.Bridge: linux.NFPROTO_BRIDGE,
+	nftables.Netdev: linux.NFPROTO_NETDEV,
+}
+
+// chainTypes maps the names of chain types to base chain types.
+var chainTypes = map[string]nftables.BaseChainType{
+	"filter": nftables.BaseChainTypeFilter,
+	"nat":    nftables.BaseChainTypeNat,
+	"route":  nftables.BaseChainTypeRoute,
+}
+
+// addressFamily returns the address family of the request, which must be a
+// single family.
+func (r *request) addressFamily() (nftables.AddressFamily, *syserr.Error) {
+	family, ok := families[r.family]
+	if !ok {
+		return 0, syserr.ErrNotSupported
+	}
+	return family, nil
+}
+
+// addressFamilies returns the address families of the request. NFPROTO_UNSPEC
+// selects all families.
+func (r *request) addressFamilies() ([]nftables.AddressFamily, *syserr.Error) {
+	if r.family == linux.NFPROTO_UNSPEC {
+		return []nftables.AddressFamily{nftables.IP, nftables.IP6, nftables.Inet, nftables.Arp, nftables.Bridge, nftables.Netdev}, nil
+	}
+	family, err := r.addressFamily()
+	if err != nil {
+		return nil, err
+	}
+	return []nftables.AddressFamily{family}, nil
+}
+
+// hookFromLinux returns the nftables hook of the NF_* hook number of family.
+func hookFromLinux(family nftables.AddressFamily, hooknum uint32) (nftables.Hook, bool) {
+	switch family {
+	case nftables.Netdev:
+		switch hooknum {
+		case linux.NF_NETDEV_INGRESS:
+			return nftables.Ingress, true
+		case linux.NF_NETDEV_EGRESS:
+			return nftables.Egress, true
+		}
+	case nftables.Arp:
+		switch hooknum {
+		case linux.NF_ARP_IN:
+			return nftables.Input, true
+		case linux.NF_ARP_OUT:
+			return nftables.Output, true
+		}
+	default:
+		switch hooknum {
+		case linux.NF_INET_PRE_ROUTING:
+			return nftables.Prerouting, true
+		case linux.NF_INET_LOCAL_IN:
+			return nftables.Input, true
+		case linux.NF_INET_FORWARD:
+			return nftables.Forward, true
+		case linux.NF_INET_LOCAL_OUT:
+			return nftables.Output, true
+		case linux.NF_INET_POST_ROUTING:
+			return nftables.Postrouting, true
+		case linux.NF_INET_INGRESS:
+			return nftables.Ingress, true
+		}
+	}
+	return 0, false
+}
+
+// hookToLinux returns the NF_* hook number of the nftables hook of family.
+func hookToLinux(family nftables.AddressFamily, hook nftables.Hook) uint32 {
+	switch family {
+	case nftables.Netdev:
+		if hook == nftables.Egress {
+			return linux.NF_NETDEV_EGRESS
+		}
+		return linux.NF_NETDEV_INGRESS
+	case nftables.Arp:
+		if hook == nftables.Output {
+			return linux.NF_ARP_OUT
+		}
+		return linux.NF_ARP_IN
+	default:
+		switch hook {
+		case nftables.Prerouting:
+			return linux.NF_INET_PRE_ROUTING
+		case nftables.Input:
+			return linux.NF_INET_LOCAL_IN
+		case nftables.Forward:
+			return linux.NF_INET_FORWARD
+		case nftables.Output:
+			return linux.NF_INET_LOCAL_OUT
+		case nftables.Postrouting:
+			return linux.NF_INET_POST_ROUTING
+		default:
+			return linux.NF_INET_INGRESS
+		}
+	}
+}
+
+// putTable adds a NFT_MSG_NEWTABLE message describing t.
+func (r *request) putTable(t *nftables.Table) {
+	m := r.addMessage(linux.NFT_MSG_NEWTABLE, nfprotos[t.GetAddressFamily()])
+	m.PutAttrString(linux.NFTA_TABLE_NAME, t.GetName())
+	var flags uint32
+	if t.IsDormant() {
+		flags |= linux.NFT_TABLE_F_DORMANT
+	}
+	m.PutAttr(linux.NFTA_TABLE_FLAGS, be32(flags))
+	m.PutAttr(linux.NFTA_TABLE_USE, be32(uint32(t.ChainCount())))
+}
+
+// dumpTables handles NFT_MSG_GETTABLE dump requests.
+func (r *request) dumpTables(nf *nftables.NFTables) *syserr.Error {
+	families, err := r.addressFamilies()
+	if err != nil {
+		return err
+	}
+	for _, family := range families {
+		for _, t := range nf.Tables(family) {
+			r.putTable(t)
+		}
+	}
+	return nil
+}
+
+// lookupTable returns the table named by attribute typ of the request.
+func (r *request) lookupTable(nf *nftables.NFTables, typ uint16) (*nftables.Table, *syserr.Error) {
+	family, err := r.addressFamily()
+	if err != nil {
+		return nil, err
+	}
+	name, ok := r.attrs.string(typ)
+	if !ok {
+		return nil, syserr.ErrInvalidArgument
+	}
+	t, terr := nf.GetTable(family, name)
+	if terr != nil {
+		return nil, syserr.ErrNoFileOrDir
+	}
+	return t, nil
+}
+
+// getTable handles NFT_MSG_GETTABLE requests.
+func (r *request) getTable(nf *nftables.NFTables) *syserr.Error {
+	t, err := r.lookupTable(nf, linux.NFTA_TABLE_NAME)
+	if err != nil {
+		return err
+	}
+	r.putTable(t)
+	return nil
+}
+
+// newTable handles NFT_MSG_NEWTABLE requests.
+func (r *request) newTable(nf *nftables.NFTables) *syserr.Error {
+	family, err := r.addressFamily()
+	if err != nil {
+		return err
+	}
+	name, ok := r.attrs.string(linux.NFTA_TABLE_NAME)
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	var flags uint32
+	if _, ok := r.attrs[linux.NFTA_TABLE_FLAGS]; ok {
+		if flags, ok = r.attrs.uint32(linux.NFTA_TABLE_FLAGS); !ok {
+			return syserr.ErrInvalidArgument
+		}
+	}
+	if flags&^linux.NFT_TABLE_F_DORMANT != 0 {
+		return syserr.ErrNotSupported
+	}
+
+	if t, terr := nf.GetTable(family, name); terr == nil {
+		if r.hdr.Flags&linux.NLM_F_EXCL != 0 {
+			return syserr.ErrExists
+		}
+		t.SetDormant(flags&linux.NFT_TABLE_F_DORMANT != 0)
+		return nil
+	}
+	t, terr := nf.AddTable(family, name, "", true /* errorOnDuplicate */)
+	if terr != nil {
+		return syserr.ErrInvalidArgument
+	}
+	t.SetDormant(flags&linux.NFT_TABLE_F_DORMANT != 0)
+	return nil
+}
+
+// delTable handles NFT_MSG_DELTABLE and NFT_MSG_DESTROYTABLE requests. Without
+// a table name, all tables of the family are deleted. destroy ignores missing
+// tables.
+func (r *request) delTable(nf *nftables.NFTables, destroy bool) *syserr.Error {
+	families, err := r.addressFamilies()
+	if err != nil {
+		return err
+	}
+	name, ok := r.attrs.string(linux.NFTA_TABLE_NAME)
+	if !ok {
+		for _, family := range families {
+			for _, t := range nf.Tables(family) {
+				nf.DeleteTable(family, t.GetName())
+			}
+		}
+		return nil
+	}
+	if len(families) != 1 {
+		return syserr.ErrNotSupported
+	}
+	if deleted, _ := nf.DeleteTable(families[0], name); !deleted && !destroy {
+		return syserr.ErrNoFileOrDir
+	}
+	return nil
+}
+
+// putChain adds a NFT_MSG_NEWCHAIN message describing c.
+func (r *request) putChain(c *nftables.Chain) {
+	family := c.GetAddressFamily()
+	m := r.addMessage(linux.NFT_MSG_NEWCHAIN, nfprotos[family])
+	m.PutAttrString(linux.NFTA_CHAIN_TABLE, c.GetTable().GetName())
+	m.PutAttrString(linux.NFTA_CHAIN_NAME, c.GetName())
+	if c.IsBaseChain() {
+		info := c.GetBaseChainInfo()
+		var hook attrBuilder
+		hook.putUint32(linux.NFTA_HOOK_HOOKNUM, hookToLinux(family, info.Hook))
+		hook.putUint32(linux.NFTA_HOOK_PRIORITY, uint32(int32(info.Priority.GetValue())))
+		if info.Device != "" {
+			hook.putString(linux.NFTA_HOOK_DEV, info.Device)
+		}
+		putNested(m, linux.NFTA_CHAIN_HOOK, hook)
+		policy := uint32(linux.NF_ACCEPT)
+		if info.PolicyDrop {
+			policy = linux.NF_DROP
+		}
+		m.PutAttr(linux.NFTA_CHAIN_POLICY, be32(policy))
+		m.PutAttrString(linux.NFTA_CHAIN_TYPE, info.BcType.String())
+	}
+	m.PutAttr(linux.NFTA_CHAIN_USE, be32(uint32(c.RuleCount())))
+}
+
+// dumpChains handles NFT_MSG_GETCHAIN dump requests.
+func (r *request) dumpChains(nf *nftables.NFTables) *syserr.Error {
+	families, err := r.addressFamilies()
+	if err != nil {
+		return err
+	}
+	for _, family := range families {
+		for _, t := range nf.Tables(family) {
+			for _, c := range t.Chains() {
+				r.putChain(c)
+			}
+		}
+	}
+	return nil
+}
+
+// lookupChain returns the chain named by attribute chainTyp in the table named
+// by attribute tableTyp of the request.
+func (r *request) lookupChain(nf *nftables.NFTables, tableTyp, chainTyp uint16) (*nftables.Chain, *syserr.Error) {
+	t, err := r.lookupTable(nf, tableTyp)
+	if err != nil {
+		return nil, err
+	}
+	name, ok := r.attrs.string(chainTyp)
+	if !ok {
+		return nil, syserr.ErrInvalidArgument
+	}
+	c, cerr := t.GetChain(name)
+	if cerr != nil {
+		return nil, syserr.ErrNoFileOrDir
+	}
+	return c, nil
+}
+
+// getChain handles NFT_MSG_GETCHAIN requests.
+func (r *request) getChain(nf *nftables.NFTables) *syserr.Error {
+	c, err := r.lookupChain(nf, linux.NFTA_CHAIN_TABLE, linux.NFTA_CHAIN_NAME)
+	if err != nil {
+		return err
+	}
+	r.putChain(c)
+	return nil
+}
+
+// chainPolicy returns whether the NFTA_CHAIN_POLICY attribute of the request,
+// if any, is NF_DROP.
+func (r *request) chainPolicy() (policyDrop bool, err *syserr.Error) {
+	if _, ok := r.attrs[linux.NFTA_CHAIN_POLICY]; !ok {
+		return false, nil
+	}
+	policy, ok := r.attrs.uint32(linux.NFTA_CHAIN_POLICY)
+	if !ok {
+		return false, syserr.ErrInvalidArgument
+	}
+	switch policy {
+	case linux.NF_ACCEPT:
+		return false, nil
+	case linux.NF_DROP:
+		return true, nil
+	default:
+		return false, syserr.ErrInvalidArgument
+	}
+}
+
+// baseChainInfo returns the base chain described by the NFTA_CHAIN_HOOK
+// attribute of the request, or nil if there is none.
+func (r *request) baseChainInfo(family nftables.AddressFamily, policyDrop bool) (*nftables.BaseChainInfo, *syserr.Error) {
+	if _, ok := r.attrs[linux.NFTA_CHAIN_HOOK]; !ok {
+		return nil, nil
+	}
+	hookAttrs, ok := r.attrs.nested(linux.NFTA_CHAIN_HOOK)
+	if !ok {
+		return nil, syserr.ErrInvalidArgument
+	}
+	hooknum, ok := hookAttrs.uint32(linux.NFTA_HOOK_HOOKNUM)
+	if !ok {
+		return nil, syserr.ErrInvalidArgument
+	}
+	hook, ok := hookFromLinux(family, hooknum)
+	if !ok {
+		return nil, syserr.ErrNotSupported
+	}
+	priority, ok := hookAttrs.uint32(linux.NFTA_HOOK_PRIORITY)
+	if !ok {
+		return nil, syserr.ErrInvalidArgument
+	}
+	var dev string
+	if _, ok := hookAttrs[linux.NFTA_HOOK_DEV]; ok {
+		dev, _ = hookAttrs.string(linux.NFTA_HOOK_DEV)
+	}
+	bcType := nftables.BaseChainTypeFilter
+	if name, ok := r.attrs.string(linux.NFTA_CHAIN_TYPE); ok {
+		if bcType, ok = chainTypes[name]; !ok {
+			return nil, syserr.ErrNoFileOrDir
+		}
+	}
+	return nftables.NewBaseChainInfo(bcType, hook, nftables.NewIntPriority(int(int32(priority))), dev, policyDrop), nil
+}
+
+// newChain handles NFT_MSG_NEWCHAIN requests.
+func (r *request) newChain(nf *nftables.NFTables) *syserr.Error {
+	t, err := r.lookupTable(nf, linux.NFTA_CHAIN_TABLE)
+	if err != nil {
+		return err
+	}
+	name, ok := r.attrs.string(linux.NFTA_CHAIN_NAME)
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	policyDrop, err := r.chainPolicy()
+	if err != nil {
+		return err
+	}
+
+	if c, cerr := t.GetChain(name); cerr == nil {
+		if r.hdr.Flags&linux.NLM_F_EXCL != 0 {
+			return syserr.ErrExists
+		}
+		// Only the policy of existing chains can be changed.
+		if _, ok := r.attrs[linux.NFTA_CHAIN_POLICY]; ok {
+			if !c.IsBaseChain() {
+				return syserr.ErrNotSupported
+			}
+			c.GetBaseChainInfo().PolicyDrop = policyDrop
+		}
+		return nil
+	}
+	info, err := r.baseChainInfo(t.GetAddressFamily(), policyDrop)
+	if err != nil {
+		return err
+	}
+	if _, cerr := t.AddChain(name, info, "", true /* errorOnDuplicate */); cerr != nil {
+		return syserr.ErrNotSupported
+	}
+	return nil
+}
+
+// delChain handles NFT_MSG_DELCHAIN and NFT_MSG_DESTROYCHAIN requests. Chains
+// with rules can't be deleted. destroy ignores missing chains.
+func (r *request) delChain(nf *nftables.NFTables, destroy bool) *syserr.Error {
+	c, err := r.lookupChain(nf, linux.NFTA_CHAIN_TABLE, linux.NFTA_CHAIN_NAME)
+	if err != nil {
+		if err == syserr.ErrNoFileOrDir && destroy {
+			return nil
+		}
+		return err
+	}
+	if c.RuleCount() != 0 {
+		return syserr.ErrBusy
+	}
+	c.GetTable().DeleteChain(c.GetName())
+	return nil
+}
@@ -124,6 +124,12 @@ func (m *Message) GetData(msg marshal.Marshallable) (AttrsView, bool) {
 	return AttrsView(b), true
 }
 
+// Payload returns the payload of this netlink message, i.e. everything
+// following the header.
+func (m *Message) Payload() []byte {
+	return m.buf[linux.NetlinkMessageHeaderSize:]
+}
+
 // Finalize returns the []byte containing the entire message, with the total
 // length set in the message header. The Message must not be modified after
 // calling Finalize.
@@ -190,6 +196,26 @@ func (m *Message) PutAttrString(atype uint16, s string) {
 	m.putZeros(aligned - l)
 }
 
+// PutNestedAttr adds a netlink attribute containing the attributes added to
+// the message by put.
+//
+// Preconditions: The serialized attribute fits in math.MaxUint16 bytes.
+func (m *Message) PutNestedAttr(atype uint16, put func()) {
+	start := len(m.buf)
+	m.Put(&linux.NetlinkAttrHeader{Type: atype})
+	put()
+
+	l := len(m.buf) - start
+	if l > math.MaxUint16 {
+		panic(fmt.Sprintf("attribute too large: %d", l))
+	}
+	hdr := linux.NetlinkAttrHeader{
+		Type:   atype,
+		Length: uint16(l),
+	}
+	hdr.MarshalUnsafe(m.buf[start:])
+}
+
 // MessageSet contains a series of netlink messages.
 type MessageSet struct {
 	// Multi indicates that this a multi-part message, to be terminated by
@@ -312,6 +338,17 @@ func (v *BytesView) String() string {
 	return string(b)
 }
 
+// Uint16 converts the raw attribute value to uint16.
+func (v *BytesView) Uint16() (uint16, bool) {
+	attr := []byte(*v)
+	val := primitive.Uint16(0)
+	if len(attr) != val.SizeBytes() {
+		return 0, false
+	}
+	val.UnmarshalBytes(attr)
+	return uint16(val), true
+}
+
 // Uint32 converts the raw attribute value to uint32.
 func (v *BytesView) Uint32() (uint32, bool) {
 	attr := []byte(*v)
@@ -323,6 +360,17 @@ func (v *BytesView) Uint32() (uint32, bool) {
 	return uint32(val), true
 }
 
+// Uint64 converts the raw attribute value to uint64.
+func (v *BytesView) Uint64() (uint64, bool) {
+	attr := []byte(*v)
+	val := primitive.Uint64(0)
+	if len(attr) != val.SizeBytes() {
+		return 0, false
+	}
+	val.UnmarshalBytes(attr)
+	return uint64(val), true
+}
+
 // Int32 converts the raw attribute value to int32.
 func (v *BytesView) Int32() (int32, bool) {
 	attr := []byte(*v)
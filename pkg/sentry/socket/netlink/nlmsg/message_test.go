@@ -302,6 +302,36 @@ func TestAttrView(t *testing.T) {
 	}
 }
 
+func TestPutNestedAttr(t *testing.T) {
+	m := nlmsg.NewMessage(linux.NetlinkMessageHeader{})
+	m.PutNestedAttr(1, func() {
+		m.PutAttrString(2, "abc")
+		m.PutAttr(3, primitive.AllocateUint32(7))
+	})
+
+	attrs := nlmsg.AttrsView(m.Finalize()[linux.NetlinkMessageHeaderSize:])
+	hdr, value, rest, ok := attrs.ParseFirst()
+	if !ok {
+		t.Fatalf("failed to parse nested attribute")
+	}
+	if !rest.Empty() {
+		t.Errorf("got %d bytes after the nested attribute, want 0", len(rest))
+	}
+	if want := (linux.NetlinkAttrHeader{Type: 1, Length: 4 + 8 + 8}); hdr != want {
+		t.Errorf("got nested attribute header %+v, want %+v", hdr, want)
+	}
+	nested, ok := nlmsg.AttrsView(value).Parse()
+	if !ok {
+		t.Fatalf("failed to parse attributes in the nested attribute")
+	}
+	if s := nested[2]; s.String() != "abc" {
+		t.Errorf("got attribute 2 = %q, want %q", s.String(), "abc")
+	}
+	if v := nested[3]; len(v) != 4 || v[0] != 7 {
+		t.Errorf("got attribute 3 = %v, want 7", v)
+	}
+}
+
 type bytesViewTest[T any] struct {
 	desc  string
 	input nlmsg.BytesView
@@ -329,6 +359,18 @@ func TestBytesView(t *testing.T) {
 			ok:    false,
 			value: 0,
 		},
+		bytesViewTest[uint64]{
+			desc:  "Convert BytesView to uint64",
+			input: nlmsg.BytesView([]byte{9, 0, 0, 0, 1, 0, 0, 0}),
+			ok:    true,
+			value: 1<<32 + 9,
+		},
+		bytesViewTest[uint64]{
+			desc:  "Failed to convert BytesView to uint64",
+			input: nlmsg.BytesView([]byte{9, 0, 0, 0}),
+			ok:    false,
+			value: 0,
+		},
 		bytesViewTest[int32]{
 			desc:  "Convert BytesView to int32",
 			input: nlmsg.BytesView([]byte{8, 0, 0, 0}),
@@ -359,6 +401,15 @@ func TestBytesView(t *testing.T) {
 			if ok && value != tst.value {
 				t.Errorf("%v: BytesView.Uint32() got %v, want %v", tst.desc, value, tst.value)
 			}
+		case bytesViewTest[uint64]:
+			tst := test.(bytesViewTest[uint64])
+			value, ok := tst.input.Uint64()
+			if ok != tst.ok {
+				t.Errorf("%v: BytesView.Uint64() got ok = %v, want %v", tst.desc, ok, tst.ok)
+			}
+			if ok && value != tst.value {
+				t.Errorf("%v: BytesView.Uint64() got %v, want %v", tst.desc, value, tst.value)
+			}
 		case bytesViewTest[int32]:
 			tst := test.(bytesViewTest[int32])
 			value, ok := tst.input.Int32()
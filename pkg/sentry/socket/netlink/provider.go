@@ -47,6 +47,35 @@ type Protocol interface {
 	ProcessMessage(ctx context.Context, s *Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error
 }
 
+// ReleaseNotifier is optionally implemented by a Protocol that needs to be
+// notified when a socket using it is released.
+type ReleaseNotifier interface {
+	// OnRelease is called when s is released, before its connection is
+	// closed.
+	OnRelease(ctx context.Context, s *Socket)
+}
+
+// RawMessageProcessor is optionally implemented by a Protocol that processes
+// messages from userspace without the generic handling done by
+// net/netlink/af_netlink.c:netlink_rcv_skb in Linux, such as
+// NETLINK_CONNECTOR. ProcessRawMessage is then called instead of
+// ProcessMessage for every message, including control messages, and no
+// acknowledgements or error messages are generated.
+type RawMessageProcessor interface {
+	// ProcessRawMessage processes a single message from userspace.
+	ProcessRawMessage(ctx context.Context, s *Socket, msg *nlmsg.Message)
+}
+
+// MulticastProtocol is optionally implemented by a Protocol that supports
+// multicast groups. Sockets using other protocols can't join any groups.
+type MulticastProtocol interface {
+	// SetGroups is called when the set of multicast groups that s belongs to
+	// changes, via bind(2) or NETLINK_ADD_MEMBERSHIP/NETLINK_DROP_MEMBERSHIP.
+	// groups is the new set of groups, where bit n-1 represents group n. If
+	// SetGroups returns an error, s's groups are unchanged.
+	SetGroups(t *kernel.Task, s *Socket, groups uint32) *syserr.Error
+}
+
 // Provider is a function that creates a new Protocol for a specific netlink
 // protocol.
 //
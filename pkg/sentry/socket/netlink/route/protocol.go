@@ -17,6 +17,7 @@ package route
 
 import (
 	"bytes"
+	"math"
 
 	"github.com/wilinz/gvisor/pkg/abi/linux"
 	"github.com/wilinz/gvisor/pkg/context"
@@ -28,6 +29,7 @@ import (
 	"github.com/wilinz/gvisor/pkg/sentry/socket/netlink"
 	"github.com/wilinz/gvisor/pkg/sentry/socket/netlink/nlmsg"
 	"github.com/wilinz/gvisor/pkg/syserr"
+	"github.com/wilinz/gvisor/pkg/tcpip/link/qdisc/tc"
 )
 
 // commandKind describes the operational class of a message type.
@@ -245,6 +247,11 @@ func addNewLinkMessage(ms *nlmsg.MessageSet, idx int32, i inet.Interface) {
 
 	m.PutAttrString(linux.IFLA_IFNAME, i.Name)
 	m.PutAttr(linux.IFLA_MTU, primitive.AllocateUint32(i.MTU))
+	carrier := uint8(0)
+	if i.Flags&linux.IFF_LOWER_UP != 0 {
+		carrier = 1
+	}
+	m.PutAttr(linux.IFLA_CARRIER, primitive.AllocateUint8(carrier))
 
 	mac := make([]byte, 6)
 	brd := mac
@@ -328,7 +335,8 @@ func commonPrefixLen(a, b []byte) (cpl int) {
 }
 
 // fillRoute returns the Route using LPM algorithm. Refer to Linux's
-// net/ipv4/route.c:rt_fill_info().
+// net/ipv4/route.c:rt_fill_info(). Only routes in the main table are
+// considered.
 func fillRoute(routes []inet.Route, addr []byte) (inet.Route, *syserr.Error) {
 	family := uint8(linux.AF_INET)
 	if len(addr) != 4 {
@@ -339,7 +347,7 @@ func fillRoute(routes []inet.Route, addr []byte) (inet.Route, *syserr.Error) {
 	idxDef := -1 // Index of the default route rule.
 	prefix := 0  // Current longest prefix.
 	for i, route := range routes {
-		if route.Family != family {
+		if route.Family != family || route.Table != linux.RT_TABLE_MAIN {
 			continue
 		}
 
@@ -468,9 +476,9 @@ func (p *Protocol) dumpRoutes(ctx context.Context, s *netlink.Socket, msg *nlmsg
 			SrcLen: rt.SrcLen,
 			TOS:    rt.TOS,
 
-			// Always return the main table since we don't have multiple
-			// routing tables.
-			Table:    linux.RT_TABLE_MAIN,
+			// Like Linux, tables that don't fit in the header are only
+			// reported in RTA_TABLE.
+			Table:    rtmTable(rt.Table),
 			Protocol: rt.Protocol,
 			Scope:    rt.Scope,
 			Type:     rt.Type,
@@ -491,6 +499,7 @@ func (p *Protocol) dumpRoutes(ctx context.Context, s *netlink.Socket, msg *nlmsg
 		if len(rt.GatewayAddr) > 0 {
 			m.PutAttr(linux.RTA_GATEWAY, primitive.AsByteSlice(rt.GatewayAddr))
 		}
+		m.PutAttr(linux.RTA_TABLE, primitive.AllocateUint32(rt.Table))
 
 		// TODO(gvisor.dev/issue/578): There are many more attributes.
 	}
@@ -498,6 +507,246 @@ func (p *Protocol) dumpRoutes(ctx context.Context, s *netlink.Socket, msg *nlmsg
 	return nil
 }
 
+// rtmTable returns the value of the table field of route and rule message
+// headers for the given table.
+func rtmTable(table uint32) uint8 {
+	if table > 0xff {
+		return linux.RT_TABLE_COMPAT
+	}
+	return uint8(table)
+}
+
+// newRule handles RTM_NEWRULE requests.
+func (p *Protocol) newRule(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	stack := s.Stack()
+	if stack == nil {
+		// No network stack.
+		return syserr.ErrProtocolNotSupported
+	}
+	return stack.NewRule(ctx, msg)
+}
+
+// deleteRule handles RTM_DELRULE requests.
+func (p *Protocol) deleteRule(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	stack := s.Stack()
+	if stack == nil {
+		return syserr.ErrNoNet
+	}
+	return stack.RemoveRule(ctx, msg)
+}
+
+// dumpRules handles RTM_GETRULE dump requests.
+func (p *Protocol) dumpRules(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	// We always send back an NLMSG_DONE.
+	ms.Multi = true
+
+	stack := s.Stack()
+	if stack == nil {
+		// No routing rules.
+		return nil
+	}
+
+	var family primitive.Uint8
+	if _, ok := msg.GetData(&family); !ok {
+		return syserr.ErrInvalidArgument
+	}
+
+	for _, r := range stack.RoutingRules() {
+		if family != linux.AF_UNSPEC && uint8(family) != r.Family {
+			continue
+		}
+		m := ms.AddMessage(linux.NetlinkMessageHeader{
+			Type: linux.RTM_NEWRULE,
+		})
+
+		m.Put(&linux.FibRuleHdr{
+			Family: r.Family,
+			DstLen: r.DstLen,
+			SrcLen: r.SrcLen,
+			Table:  rtmTable(r.Table),
+			Action: r.Action,
+			Flags:  r.Flags,
+		})
+
+		m.PutAttr(linux.FRA_TABLE, primitive.AllocateUint32(r.Table))
+		m.PutAttr(linux.FRA_PRIORITY, primitive.AllocateUint32(r.Priority))
+		if r.SuppressPrefixLen >= 0 {
+			m.PutAttr(linux.FRA_SUPPRESS_PREFIXLEN, primitive.AllocateUint32(uint32(r.SuppressPrefixLen)))
+		}
+		if r.DstLen > 0 {
+			m.PutAttr(linux.FRA_DST, primitive.AsByteSlice(r.DstAddr))
+		}
+		if r.SrcLen > 0 {
+			m.PutAttr(linux.FRA_SRC, primitive.AsByteSlice(r.SrcAddr))
+		}
+		if r.Mask != 0 {
+			m.PutAttr(linux.FRA_FWMARK, primitive.AllocateUint32(r.Mark))
+			m.PutAttr(linux.FRA_FWMASK, primitive.AllocateUint32(r.Mask))
+		}
+		if r.OutputInterface != "" {
+			m.PutAttrString(linux.FRA_OIFNAME, r.OutputInterface)
+		}
+	}
+	return nil
+}
+
+// newQDisc handles RTM_NEWQDISC requests.
+func (p *Protocol) newQDisc(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	stack := s.Stack()
+	if stack == nil {
+		// No network stack.
+		return syserr.ErrProtocolNotSupported
+	}
+	return stack.NewQDisc(ctx, msg)
+}
+
+// deleteQDisc handles RTM_DELQDISC requests.
+func (p *Protocol) deleteQDisc(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	stack := s.Stack()
+	if stack == nil {
+		return syserr.ErrNoNet
+	}
+	return stack.RemoveQDisc(ctx, msg)
+}
+
+// dumpQDiscs handles RTM_GETQDISC dump requests.
+func (p *Protocol) dumpQDiscs(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	// We always send back an NLMSG_DONE.
+	ms.Multi = true
+
+	stack := s.Stack()
+	if stack == nil {
+		// No queueing disciplines.
+		return nil
+	}
+
+	var tcm linux.TcMsg
+	if _, ok := msg.GetData(&tcm); !ok {
+		return syserr.ErrInvalidArgument
+	}
+
+	for _, q := range stack.QDiscs() {
+		if tcm.Ifindex != 0 && tcm.Ifindex != q.Ifindex {
+			continue
+		}
+		m := ms.AddMessage(linux.NetlinkMessageHeader{
+			Type: linux.RTM_NEWQDISC,
+		})
+
+		m.Put(&linux.TcMsg{
+			Family:  linux.AF_UNSPEC,
+			Ifindex: q.Ifindex,
+			Handle:  q.Handle,
+			Parent:  q.Parent,
+			Info:    1, // Reference count.
+		})
+		m.PutAttrString(linux.TCA_KIND, q.Kind)
+		switch q.Kind {
+		case tc.TBFKind:
+			m.PutNestedAttr(linux.TCA_OPTIONS, func() {
+				putTBFOptions(m, q.TBF)
+			})
+		case tc.FQCoDelKind:
+			m.PutNestedAttr(linux.TCA_OPTIONS, func() {
+				putFQCoDelOptions(m, q.FQCoDel)
+			})
+		}
+	}
+	return nil
+}
+
+// putTBFOptions adds the options of a tbf queueing discipline to m.
+func putTBFOptions(m *nlmsg.Message, p tc.TBFParams) {
+	m.PutAttr(linux.TCA_TBF_PARMS, &linux.TcTbfQopt{
+		Rate: linux.TcRateSpec{
+			Linklayer: linux.TC_LINKLAYER_ETHERNET,
+			Rate:      uint32(min(p.Rate, math.MaxUint32)),
+		},
+		Limit:  p.Limit,
+		Buffer: uint32(p.Buffer().Nanoseconds() >> linux.PSCHED_SHIFT),
+	})
+	if p.Rate > math.MaxUint32 {
+		m.PutAttr(linux.TCA_TBF_RATE64, primitive.AllocateUint64(p.Rate))
+	}
+}
+
+// putFQCoDelOptions adds the options of an fq_codel queueing discipline to m.
+func putFQCoDelOptions(m *nlmsg.Message, p tc.FQCoDelParams) {
+	ecn := uint32(0)
+	if p.ECN {
+		ecn = 1
+	}
+	m.PutAttr(linux.TCA_FQ_CODEL_TARGET, primitive.AllocateUint32(uint32(p.Target.Microseconds())))
+	m.PutAttr(linux.TCA_FQ_CODEL_LIMIT, primitive.AllocateUint32(p.Limit))
+	m.PutAttr(linux.TCA_FQ_CODEL_INTERVAL, primitive.AllocateUint32(uint32(p.Interval.Microseconds())))
+	m.PutAttr(linux.TCA_FQ_CODEL_ECN, primitive.AllocateUint32(ecn))
+	m.PutAttr(linux.TCA_FQ_CODEL_QUANTUM, primitive.AllocateUint32(p.Quantum))
+	m.PutAttr(linux.TCA_FQ_CODEL_DROP_BATCH_SIZE, primitive.AllocateUint32(p.DropBatchSize))
+	m.PutAttr(linux.TCA_FQ_CODEL_MEMORY_LIMIT, primitive.AllocateUint32(p.MemoryLimit))
+	m.PutAttr(linux.TCA_FQ_CODEL_FLOWS, primitive.AllocateUint32(p.Flows))
+	if p.CEThreshold != 0 {
+		m.PutAttr(linux.TCA_FQ_CODEL_CE_THRESHOLD, primitive.AllocateUint32(uint32(p.CEThreshold.Microseconds())))
+	}
+}
+
+// newNeighbor handles RTM_NEWNEIGH requests.
+func (p *Protocol) newNeighbor(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	stack := s.Stack()
+	if stack == nil {
+		// No network stack.
+		return syserr.ErrProtocolNotSupported
+	}
+	return stack.NewNeighbor(ctx, msg)
+}
+
+// deleteNeighbor handles RTM_DELNEIGH requests.
+func (p *Protocol) deleteNeighbor(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	stack := s.Stack()
+	if stack == nil {
+		return syserr.ErrNoNet
+	}
+	return stack.RemoveNeighbor(ctx, msg)
+}
+
+// dumpNeighbors handles RTM_GETNEIGH dump requests.
+func (p *Protocol) dumpNeighbors(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	// We always send back an NLMSG_DONE.
+	ms.Multi = true
+
+	stack := s.Stack()
+	if stack == nil {
+		// No neighbors.
+		return nil
+	}
+
+	var family primitive.Uint8
+	if _, ok := msg.GetData(&family); !ok {
+		return syserr.ErrInvalidArgument
+	}
+
+	for _, n := range stack.Neighbors() {
+		if family != linux.AF_UNSPEC && uint8(family) != n.Family {
+			continue
+		}
+		m := ms.AddMessage(linux.NetlinkMessageHeader{
+			Type: linux.RTM_NEWNEIGH,
+		})
+
+		m.Put(&linux.NdMsg{
+			Family:  n.Family,
+			Ifindex: n.Ifindex,
+			State:   n.State,
+			Flags:   n.Flags,
+			Type:    linux.RTN_UNICAST,
+		})
+		m.PutAttr(linux.NDA_DST, primitive.AsByteSlice(n.Addr))
+		if len(n.LinkAddr) > 0 {
+			m.PutAttr(linux.NDA_LLADDR, primitive.AsByteSlice(n.LinkAddr))
+		}
+	}
+	return nil
+}
+
 // newAddr handles RTM_NEWADDR requests.
 func (p *Protocol) newAddr(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
 	stack := s.Stack()
@@ -629,6 +878,12 @@ func (p *Protocol) ProcessMessage(ctx context.Context, s *netlink.Socket, msg *n
 			return p.dumpAddrs(ctx, s, msg, ms)
 		case linux.RTM_GETROUTE:
 			return p.dumpRoutes(ctx, s, msg, ms)
+		case linux.RTM_GETNEIGH:
+			return p.dumpNeighbors(ctx, s, msg, ms)
+		case linux.RTM_GETRULE:
+			return p.dumpRules(ctx, s, msg, ms)
+		case linux.RTM_GETQDISC:
+			return p.dumpQDiscs(ctx, s, msg, ms)
 		default:
 			return syserr.ErrNotSupported
 		}
@@ -653,6 +908,18 @@ func (p *Protocol) ProcessMessage(ctx context.Context, s *netlink.Socket, msg *n
 			return p.newAddr(ctx, s, msg, ms)
 		case linux.RTM_DELADDR:
 			return p.delAddr(ctx, s, msg, ms)
+		case linux.RTM_NEWNEIGH:
+			return p.newNeighbor(ctx, s, msg, ms)
+		case linux.RTM_DELNEIGH:
+			return p.deleteNeighbor(ctx, s, msg, ms)
+		case linux.RTM_NEWRULE:
+			return p.newRule(ctx, s, msg, ms)
+		case linux.RTM_DELRULE:
+			return p.deleteRule(ctx, s, msg, ms)
+		case linux.RTM_NEWQDISC:
+			return p.newQDisc(ctx, s, msg, ms)
+		case linux.RTM_DELQDISC:
+			return p.deleteQDisc(ctx, s, msg, ms)
 		default:
 			return syserr.ErrNotSupported
 		}
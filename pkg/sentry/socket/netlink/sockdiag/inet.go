@@ -0,0 +1,123 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sockdiag
+
+import (
+	"bytes"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+	"github.com/wilinz/gvisor/pkg/sentry/socket"
+	"github.com/wilinz/gvisor/pkg/sentry/socket/netlink/nlmsg"
+	"github.com/wilinz/gvisor/pkg/syserr"
+)
+
+// inetDiag handles inet_diag requests, for TCP and UDP sockets. See
+// net/ipv4/inet_diag.c.
+//
+// Request attributes, such as INET_DIAG_REQ_BYTECODE filters, are ignored:
+// all sockets matching the request's family, protocol and states are
+// reported. Only the INET_DIAG_INFO extension is supported.
+func inetDiag(t *kernel.Task, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	var req linux.InetDiagReqV2
+	if _, ok := msg.GetData(&req); !ok {
+		return syserr.ErrInvalidArgument
+	}
+
+	var isProtocol func(socket.Socket) bool
+	switch req.Protocol {
+	case linux.IPPROTO_TCP:
+		isProtocol = socket.IsTCP
+	case linux.IPPROTO_UDP:
+		isProtocol = socket.IsUDP
+	default:
+		// Like Linux when there is no handler for the protocol. See
+		// net/ipv4/inet_diag.c:inet_diag_lock_handler.
+		return syserr.ErrNoFileOrDir
+	}
+
+	dump := isDump(msg)
+	if dump {
+		// We always send back an NLMSG_DONE.
+		ms.Multi = true
+	}
+	found := false
+	forEachSocket(t, int(req.Family), func(ds *diagSocket) {
+		if !isProtocol(ds.sock) || (!dump && found) {
+			return
+		}
+		state := ds.sock.State()
+		if dump && req.States&(1<<state) == 0 {
+			return
+		}
+
+		diagMsg := linux.InetDiagMsg{
+			Family: req.Family,
+			State:  uint8(state),
+			UID:    ds.uid,
+			Inode:  uint32(ds.ino),
+		}
+		if local, _, err := ds.sock.GetSockName(t); err == nil {
+			diagMsg.ID.Sport, diagMsg.ID.Src = inetAddr(local)
+		}
+		if remote, _, err := ds.sock.GetPeerName(t); err == nil {
+			diagMsg.ID.Dport, diagMsg.ID.Dst = inetAddr(remote)
+		}
+		diagMsg.ID.Cookie = ds.cookie()
+		if !dump && !(sameInetSocket(int(req.Family), &req.ID, &diagMsg.ID) && ds.matchesCookie(req.ID.Cookie)) {
+			return
+		}
+		found = true
+
+		m := ms.AddMessage(linux.NetlinkMessageHeader{
+			Type: linux.SOCK_DIAG_BY_FAMILY,
+		})
+		m.Put(&diagMsg)
+		if req.Ext&(1<<(linux.INET_DIAG_INFO-1)) != 0 && socket.IsTCP(ds.sock) {
+			if info, err := ds.sock.GetSockOpt(t, linux.SOL_TCP, linux.TCP_INFO, 0, linux.SizeOfTCPInfo); err == nil {
+				m.PutAttr(linux.INET_DIAG_INFO, info)
+			}
+		}
+	})
+	if !dump && !found {
+		return syserr.ErrNoFileOrDir
+	}
+	return nil
+}
+
+// inetAddr returns the port and address of addr, in network byte order.
+func inetAddr(addr linux.SockAddr) (port uint16, ip [16]byte) {
+	switch addr := addr.(type) {
+	case *linux.SockAddrInet:
+		copy(ip[:], addr.Addr[:])
+		return addr.Port, ip
+	case *linux.SockAddrInet6:
+		return addr.Port, addr.Addr
+	default:
+		return 0, ip
+	}
+}
+
+// sameInetSocket returns true if the ports and addresses of req, given by a
+// request, match id. Only the first 4 bytes of IPv4 addresses are compared.
+func sameInetSocket(family int, req, id *linux.InetDiagSockID) bool {
+	addrLen := 16
+	if family == linux.AF_INET {
+		addrLen = 4
+	}
+	return req.Sport == id.Sport && req.Dport == id.Dport &&
+		bytes.Equal(req.Src[:addrLen], id.Src[:addrLen]) &&
+		bytes.Equal(req.Dst[:addrLen], id.Dst[:addrLen])
+}
@@ -0,0 +1,189 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sockdiag provides a NETLINK_SOCK_DIAG socket protocol.
+//
+// SOCK_DIAG_BY_FAMILY requests report the TCP and UDP sockets (inet_diag) and
+// the unix domain sockets (unix_diag) of the sandbox, as used by ss(8). Only
+// sockets in the requesting task's network namespace are reported. See
+// net/core/sock_diag.c.
+package sockdiag
+
+import (
+	"sort"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/sentry/inet"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
+	"github.com/wilinz/gvisor/pkg/sentry/socket"
+	"github.com/wilinz/gvisor/pkg/sentry/socket/netlink"
+	"github.com/wilinz/gvisor/pkg/sentry/socket/netlink/nlmsg"
+	"github.com/wilinz/gvisor/pkg/sentry/vfs"
+	"github.com/wilinz/gvisor/pkg/syserr"
+)
+
+// Protocol implements netlink.Protocol.
+//
+// +stateify savable
+type Protocol struct{}
+
+var _ netlink.Protocol = (*Protocol)(nil)
+
+// NewProtocol creates a NETLINK_SOCK_DIAG netlink.Protocol.
+func NewProtocol(t *kernel.Task) (netlink.Protocol, *syserr.Error) {
+	return &Protocol{}, nil
+}
+
+// Protocol implements netlink.Protocol.Protocol.
+func (p *Protocol) Protocol() int {
+	return linux.NETLINK_SOCK_DIAG
+}
+
+// CanSend implements netlink.Protocol.CanSend.
+func (p *Protocol) CanSend() bool {
+	return true
+}
+
+// ProcessMessage implements netlink.Protocol.ProcessMessage.
+func (p *Protocol) ProcessMessage(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		return syserr.ErrInvalidArgument
+	}
+
+	switch msg.Header().Type {
+	case linux.SOCK_DIAG_BY_FAMILY:
+	case linux.SOCK_DESTROY:
+		// Destroying sockets isn't supported.
+		return syserr.ErrNotSupported
+	default:
+		// Legacy TCPDIAG_GETSOCK and DCCPDIAG_GETSOCK requests aren't
+		// supported.
+		return syserr.ErrInvalidArgument
+	}
+
+	var req linux.SockDiagReq
+	if _, ok := msg.GetData(&req); !ok {
+		return syserr.ErrInvalidArgument
+	}
+	switch req.Family {
+	case linux.AF_INET, linux.AF_INET6:
+		return inetDiag(t, msg, ms)
+	case linux.AF_UNIX:
+		return unixDiag(t, msg, ms)
+	default:
+		// Like Linux when there is no handler for the family. See
+		// net/core/sock_diag.c:sock_diag_cmd.
+		return syserr.ErrNoFileOrDir
+	}
+}
+
+// isDump returns true if msg requests a dump rather than a single socket.
+func isDump(msg *nlmsg.Message) bool {
+	return msg.Header().Flags&linux.NLM_F_DUMP == linux.NLM_F_DUMP
+}
+
+// namespacedSocket is implemented by sockets that belong to a network
+// namespace.
+type namespacedSocket interface {
+	NetworkNamespace() *inet.Namespace
+}
+
+// diagSocket is a socket reported by a sock_diag request.
+type diagSocket struct {
+	fd   *vfs.FileDescription
+	sock socket.Socket
+
+	// id is the socket's entry number in the kernel's socket table, which
+	// is reported as its cookie.
+	id uint64
+
+	// ino is the socket's inode number, which identifies the file
+	// descriptors referring to it in /proc/[pid]/fd.
+	ino uint64
+
+	// uid is the socket's owner in the requesting task's user namespace.
+	uid uint32
+}
+
+// cookie returns the socket's cookie, as reported by sock_diag.
+func (ds *diagSocket) cookie() [2]uint32 {
+	return [2]uint32{uint32(ds.id), uint32(ds.id >> 32)}
+}
+
+// matchesCookie returns true if cookie, given by a request, matches the
+// socket. See net/core/sock_diag.c:sock_diag_check_cookie.
+func (ds *diagSocket) matchesCookie(cookie [2]uint32) bool {
+	if cookie[0] == linux.INET_DIAG_NOCOOKIE && cookie[1] == linux.INET_DIAG_NOCOOKIE {
+		return true
+	}
+	return cookie == ds.cookie()
+}
+
+// forEachSocket calls fn for every socket of the given family in t's network
+// namespace, ordered by socket table entry. fn must not retain ds.
+func forEachSocket(t *kernel.Task, family int, fn func(ds *diagSocket)) {
+	k := t.Kernel()
+	ns := t.NetworkNamespace()
+	creds := auth.CredentialsFromContext(t)
+
+	records := k.ListSockets()
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	for _, se := range records {
+		fd := se.Sock
+		if !fd.TryIncRef() {
+			// Racing with socket destruction, this is ok.
+			continue
+		}
+		sock := fd.Impl().(socket.Socket)
+		if fam, _, _ := sock.Type(); fam != family {
+			fd.DecRef(t)
+			continue
+		}
+		// Sockets created outside of any network namespace, such as host
+		// sockets, belong to the root network namespace.
+		sockNS := k.RootNetworkNamespace()
+		if nss, ok := sock.(namespacedSocket); ok && nss.NetworkNamespace() != nil {
+			sockNS = nss.NetworkNamespace()
+		}
+		if sockNS != ns {
+			fd.DecRef(t)
+			continue
+		}
+
+		ds := diagSocket{
+			fd:   fd,
+			sock: sock,
+			id:   se.ID,
+		}
+		stat, err := fd.Stat(t, vfs.StatOptions{Mask: linux.STATX_UID | linux.STATX_INO})
+		if err == nil {
+			if stat.Mask&linux.STATX_INO != 0 {
+				ds.ino = stat.Ino
+			}
+			if stat.Mask&linux.STATX_UID != 0 {
+				ds.uid = uint32(auth.KUID(stat.UID).In(creds.UserNamespace).OrOverflow())
+			}
+		}
+		fn(&ds)
+		fd.DecRef(t)
+	}
+}
+
+// init registers the NETLINK_SOCK_DIAG provider.
+func init() {
+	netlink.RegisterProvider(linux.NETLINK_SOCK_DIAG, NewProtocol)
+}
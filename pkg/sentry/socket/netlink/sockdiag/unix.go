@@ -0,0 +1,119 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sockdiag
+
+import (
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/marshal/primitive"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+	"github.com/wilinz/gvisor/pkg/sentry/socket/netlink/nlmsg"
+	"github.com/wilinz/gvisor/pkg/sentry/socket/unix"
+	"github.com/wilinz/gvisor/pkg/sentry/socket/unix/transport"
+	"github.com/wilinz/gvisor/pkg/syserr"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+)
+
+// unixDiag handles unix_diag requests. See net/unix/diag.c.
+//
+// UNIX_DIAG_NAME, UNIX_DIAG_RQLEN and UNIX_DIAG_UID are reported when
+// requested. Peers, bound inodes, pending connections and memory usage are
+// not.
+func unixDiag(t *kernel.Task, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	var req linux.UnixDiagReq
+	if _, ok := msg.GetData(&req); !ok {
+		return syserr.ErrInvalidArgument
+	}
+
+	dump := isDump(msg)
+	if dump {
+		// We always send back an NLMSG_DONE.
+		ms.Multi = true
+	}
+	found := false
+	forEachSocket(t, linux.AF_UNIX, func(ds *diagSocket) {
+		if !dump && (found || ds.ino != uint64(req.Ino) || !ds.matchesCookie(req.Cookie)) {
+			return
+		}
+		ep := ds.sock.(*unix.Socket).Endpoint()
+		listening := false
+		if ce, ok := ep.(transport.ConnectingEndpoint); ok {
+			ce.Lock()
+			listening = ce.ListeningLocked()
+			ce.Unlock()
+		}
+		_, peerErr := ep.GetRemoteAddress()
+
+		// Linux reports the states of unix domain sockets as TCP states.
+		var state uint32
+		switch {
+		case listening:
+			state = linux.TCP_LISTEN
+		case peerErr == nil:
+			state = linux.TCP_ESTABLISHED
+		default:
+			state = linux.TCP_CLOSE
+		}
+		if dump && req.States&(1<<state) == 0 {
+			return
+		}
+		found = true
+
+		m := ms.AddMessage(linux.NetlinkMessageHeader{
+			Type: linux.SOCK_DIAG_BY_FAMILY,
+		})
+		m.Put(&linux.UnixDiagMsg{
+			Family: linux.AF_UNIX,
+			Type:   uint8(ep.Type()),
+			State:  uint8(state),
+			Ino:    uint32(ds.ino),
+			Cookie: ds.cookie(),
+		})
+		if req.Show&linux.UDIAG_SHOW_NAME != 0 {
+			if addr, err := ep.GetLocalAddress(); err == nil && len(addr.Addr) > 0 {
+				name := []byte(addr.Addr)
+				if name[0] != 0 {
+					// Like Linux, include the terminating NUL of
+					// filesystem paths.
+					name = append(name, 0)
+				}
+				m.PutAttr(linux.UNIX_DIAG_NAME, primitive.AsByteSlice(name))
+			}
+		}
+		if req.Show&linux.UDIAG_SHOW_RQLEN != 0 {
+			var rqlen linux.UnixDiagRQLen
+			if !listening {
+				rqlen.RQueue = queueSize(ep, tcpip.ReceiveQueueSizeOption)
+				rqlen.WQueue = queueSize(ep, tcpip.SendQueueSizeOption)
+			}
+			m.PutAttr(linux.UNIX_DIAG_RQLEN, &rqlen)
+		}
+		if req.Show&linux.UDIAG_SHOW_UID != 0 {
+			m.PutAttr(linux.UNIX_DIAG_UID, primitive.AllocateUint32(ds.uid))
+		}
+	})
+	if !dump && !found {
+		return syserr.ErrNoFileOrDir
+	}
+	return nil
+}
+
+// queueSize returns the size of one of ep's queues, or 0 if it is unknown.
+func queueSize(ep transport.Endpoint, opt tcpip.SockOptInt) uint32 {
+	v, err := ep.GetSockOptInt(opt)
+	if err != nil {
+		return 0
+	}
+	return uint32(v)
+}
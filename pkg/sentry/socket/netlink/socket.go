@@ -101,6 +101,11 @@ type Socket struct {
 	// portID is the port ID allocated for this socket.
 	portID int32
 
+	// groups is the set of multicast groups this socket belongs to, where
+	// bit n-1 represents group n. groups is always 0 unless protocol
+	// implements MulticastProtocol.
+	groups uint32
+
 	// sendBufferSize is the send buffer "size". We don't actually have a
 	// fixed buffer but only consume this many bytes.
 	sendBufferSize uint32
@@ -159,6 +164,9 @@ func (s *Socket) Stack() inet.Stack {
 func (s *Socket) Release(ctx context.Context) {
 	t := kernel.TaskFromContext(ctx)
 	t.Kernel().DeleteSocket(&s.vfsfd)
+	if n, ok := s.protocol.(ReleaseNotifier); ok {
+		n.OnRelease(ctx, s)
+	}
 	s.connection.Release(ctx)
 	s.ep.Close(ctx)
 
@@ -311,15 +319,36 @@ func (s *Socket) Bind(t *kernel.Task, sockaddr []byte) *syserr.Error {
 		return err
 	}
 
-	// No support for multicast groups yet.
-	if a.Groups != 0 {
+	mp, multicast := s.protocol.(MulticastProtocol)
+	if a.Groups != 0 && !multicast {
 		return syserr.ErrPermissionDenied
 	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	return s.bindPort(t, int32(a.PortID))
+	if err := s.bindPort(t, int32(a.PortID)); err != nil {
+		return err
+	}
+	if multicast {
+		// Like Linux, bind(2) replaces the set of groups.
+		return s.setGroupsLocked(t, mp, a.Groups)
+	}
+	return nil
+}
+
+// setGroupsLocked changes the set of multicast groups that s belongs to.
+//
+// Preconditions: s.mu is held.
+func (s *Socket) setGroupsLocked(t *kernel.Task, mp MulticastProtocol, groups uint32) *syserr.Error {
+	if groups == s.groups {
+		return nil
+	}
+	if err := mp.SetGroups(t, s, groups); err != nil {
+		return err
+	}
+	s.groups = groups
+	return nil
 }
 
 // Connect implements socket.Socket.Connect.
@@ -528,10 +557,33 @@ func (s *Socket) SetSockOpt(t *kernel.Task, level int, name int, opt []byte) *sy
 		}
 	case linux.SOL_NETLINK:
 		switch name {
-		case linux.NETLINK_ADD_MEMBERSHIP,
-			linux.NETLINK_BROADCAST_ERROR,
+		case linux.NETLINK_ADD_MEMBERSHIP, linux.NETLINK_DROP_MEMBERSHIP:
+			mp, ok := s.protocol.(MulticastProtocol)
+			if !ok {
+				// Not supported.
+				break
+			}
+			if len(opt) < sizeOfInt32 {
+				return syserr.ErrInvalidArgument
+			}
+			// Only the groups that fit in the bind(2) bitmask are
+			// supported.
+			group := hostarch.ByteOrder.Uint32(opt)
+			if group == 0 || group > 32 {
+				return syserr.ErrInvalidArgument
+			}
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			groups := s.groups
+			if name == linux.NETLINK_ADD_MEMBERSHIP {
+				groups |= 1 << (group - 1)
+			} else {
+				groups &^= 1 << (group - 1)
+			}
+			return s.setGroupsLocked(t, mp, groups)
+
+		case linux.NETLINK_BROADCAST_ERROR,
 			linux.NETLINK_CAP_ACK,
-			linux.NETLINK_DROP_MEMBERSHIP,
 			linux.NETLINK_DUMP_STRICT_CHK,
 			linux.NETLINK_EXT_ACK,
 			linux.NETLINK_LISTEN_ALL_NSID,
@@ -553,6 +605,7 @@ func (s *Socket) GetSockName(t *kernel.Task) (linux.SockAddr, uint32, *syserr.Er
 	sa := &linux.SockAddrNetlink{
 		Family: linux.AF_NETLINK,
 		PortID: uint32(s.portID),
+		Groups: s.groups,
 	}
 	return sa, uint32(sa.SizeBytes()), nil
 }
@@ -661,6 +714,13 @@ func (kernelSCM) Credentials(*kernel.Task) (kernel.ThreadID, auth.UID, auth.GID)
 // kernelCreds is the concrete version of kernelSCM used in all creds.
 var kernelCreds = &kernelSCM{}
 
+// SendMessages sends the messages in ms to userspace, outside of any request
+// from userspace. Like responses, messages are dropped if the socket's receive
+// buffer is full.
+func (s *Socket) SendMessages(ctx context.Context, ms *nlmsg.MessageSet) *syserr.Error {
+	return s.sendResponse(ctx, ms)
+}
+
 // sendResponse sends the response messages in ms back to userspace.
 func (s *Socket) sendResponse(ctx context.Context, ms *nlmsg.MessageSet) *syserr.Error {
 	// Linux combines multiple netlink messages into a single datagram.
@@ -749,6 +809,11 @@ func (s *Socket) processMessages(ctx context.Context, buf []byte) *syserr.Error
 		buf = rest
 		hdr := msg.Header()
 
+		if rp, ok := s.protocol.(RawMessageProcessor); ok {
+			rp.ProcessRawMessage(ctx, s, msg)
+			continue
+		}
+
 		// Ignore control messages.
 		if hdr.Type < linux.NLMSG_MIN_TYPE {
 			continue
@@ -0,0 +1,559 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netstack
+
+import (
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/buffer"
+	"github.com/wilinz/gvisor/pkg/hostarch"
+	"github.com/wilinz/gvisor/pkg/marshal"
+	"github.com/wilinz/gvisor/pkg/marshal/primitive"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
+	"github.com/wilinz/gvisor/pkg/sync"
+	"github.com/wilinz/gvisor/pkg/syserr"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/header"
+	"github.com/wilinz/gvisor/pkg/tcpip/network/ipv4"
+	"github.com/wilinz/gvisor/pkg/tcpip/stack"
+)
+
+// multicastVIF is a virtual interface added with MRT_ADD_VIF.
+//
+// +stateify savable
+type multicastVIF struct {
+	// nic is the NIC that the VIF refers to. It is zero for unused VIFs.
+	nic tcpip.NICID
+
+	// static is true if the VIF was added by a socket other than the
+	// multicast routing socket, in which case it isn't removed by MRT_DONE.
+	static bool
+}
+
+// multicastMFC is a multicast forwarding cache entry added with MRT_ADD_MFC.
+//
+// +stateify savable
+type multicastMFC struct {
+	parent uint16
+	ttls   [linux.MAXVIFS]uint8
+
+	// static has the same meaning as multicastVIF.static.
+	static bool
+}
+
+// multicastRouter implements the IPv4 multicast routing API of
+// net/ipv4/ipmr.c for a network namespace, on top of netstack's multicast
+// forwarding. VIFs are mapped to NICs, and MFC entries to multicast routes.
+//
+// Unlike Linux, tunnel and PIM register VIFs, (*,G) entries, and multiple
+// routing tables aren't supported, and IGMPMSG_WRONGVIF messages aren't rate
+// limited.
+//
+// +stateify savable
+type multicastRouter struct {
+	// opMu serializes changes to the routing configuration. Unlike mu, it
+	// may be held while calling into the stack.
+	opMu sync.Mutex `state:"nosave"`
+
+	// mfcs are the multicast forwarding cache entries.
+	//
+	// +checklocks:opMu
+	mfcs map[stack.UnicastSourceAndMulticastDestination]multicastMFC
+
+	// mu protects the fields below, which are used to send messages to the
+	// multicast routing socket. The stack sends multicast forwarding events
+	// with its own locks held, so mu must not be held while calling into the
+	// stack.
+	mu sync.Mutex `state:"nosave"`
+
+	// sock is the multicast routing socket set with MRT_INIT, or nil.
+	//
+	// +checklocks:mu
+	sock *sock
+
+	// vifs are the virtual interfaces, indexed by vifctl.vifc_vifi.
+	//
+	// +checklocks:mu
+	vifs [linux.MAXVIFS]multicastVIF
+
+	// assert is the value set with MRT_ASSERT.
+	//
+	// +checklocks:mu
+	assert bool
+
+	// pim is the value set with MRT_PIM.
+	//
+	// +checklocks:mu
+	pim bool
+}
+
+// isMulticastRoutingOption returns true if name is one of the SOL_IP
+// multicast routing options.
+func isMulticastRoutingOption(name int) bool {
+	return name >= linux.MRT_BASE && name <= linux.MRT_MAX
+}
+
+// multicastRouter returns the multicast router of s's network namespace, or
+// an error if s can't be used with the multicast routing options.
+func (s *sock) multicastRouter() (*Stack, *syserr.Error) {
+	if s.family != linux.AF_INET || s.skType != linux.SOCK_RAW || s.protocol != linux.IPPROTO_IGMP {
+		return nil, syserr.ErrNotSupported
+	}
+	st, ok := s.namespace.Stack().(*Stack)
+	if !ok {
+		return nil, syserr.ErrNotSupported
+	}
+	return st, nil
+}
+
+// getSockOptMulticastRouting implements GetSockOpt for the multicast routing
+// options.
+func (s *sock) getSockOptMulticastRouting(name, outLen int) (marshal.Marshallable, *syserr.Error) {
+	st, err := s.multicastRouter()
+	if err != nil {
+		return nil, err
+	}
+	if outLen < sizeOfInt32 {
+		return nil, syserr.ErrInvalidArgument
+	}
+	r := &st.mroute
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var v primitive.Int32
+	switch name {
+	case linux.MRT_VERSION:
+		v = linux.MRTVersion
+	case linux.MRT_ASSERT:
+		v = primitive.Int32(boolToInt32(r.assert))
+	case linux.MRT_PIM:
+		v = primitive.Int32(boolToInt32(r.pim))
+	default:
+		return nil, syserr.ErrProtocolNotAvailable
+	}
+	return &v, nil
+}
+
+// setSockOptMulticastRouting implements SetSockOpt for the multicast routing
+// options.
+func (s *sock) setSockOptMulticastRouting(t *kernel.Task, name int, optVal []byte) *syserr.Error {
+	st, err := s.multicastRouter()
+	if err != nil {
+		return err
+	}
+	r := &st.mroute
+	r.opMu.Lock()
+	defer r.opMu.Unlock()
+
+	r.mu.Lock()
+	isRoutingSock := r.sock == s
+	hasRoutingSock := r.sock != nil
+	r.mu.Unlock()
+	// Like Linux, sockets other than the multicast routing socket may
+	// change the routing configuration with CAP_NET_ADMIN. Their changes
+	// are static: they outlive the multicast routing socket.
+	if name != linux.MRT_INIT && !isRoutingSock && !auth.CredentialsFromContext(t).HasCapability(linux.CAP_NET_ADMIN) {
+		return syserr.ErrPermissionDenied
+	}
+
+	switch name {
+	case linux.MRT_INIT:
+		if len(optVal) != sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+		if hasRoutingSock {
+			return syserr.ErrAddressInUse
+		}
+		if _, err := st.Stack.EnableMulticastForwardingForProtocol(ipv4.ProtocolNumber, r); err != nil {
+			return syserr.TranslateNetstackError(err)
+		}
+		r.mu.Lock()
+		r.sock = s
+		r.mu.Unlock()
+		return nil
+
+	case linux.MRT_DONE:
+		if !isRoutingSock {
+			return syserr.ErrPermissionDenied
+		}
+		r.resetLocked(st.Stack)
+		return nil
+
+	case linux.MRT_ADD_VIF, linux.MRT_DEL_VIF:
+		if len(optVal) != linux.SizeOfVIFCtl {
+			return syserr.ErrInvalidArgument
+		}
+		var vif linux.VIFCtl
+		vif.UnmarshalUnsafe(optVal)
+		if vif.VIFI >= linux.MAXVIFS {
+			return syserr.ErrFileTableOverflow
+		}
+		if name == linux.MRT_ADD_VIF {
+			return r.addVIFLocked(st.Stack, &vif, !isRoutingSock)
+		}
+		return r.delVIFLocked(st.Stack, vif.VIFI)
+
+	case linux.MRT_ADD_MFC, linux.MRT_DEL_MFC:
+		if len(optVal) != linux.SizeOfMFCCtl {
+			return syserr.ErrInvalidArgument
+		}
+		var mfc linux.MFCCtl
+		mfc.UnmarshalUnsafe(optVal)
+		if mfc.Parent >= linux.MAXVIFS {
+			return syserr.ErrFileTableOverflow
+		}
+		key := stack.UnicastSourceAndMulticastDestination{
+			Source:      tcpip.AddrFrom4(mfc.Origin),
+			Destination: tcpip.AddrFrom4(mfc.McastGrp),
+		}
+		if name == linux.MRT_ADD_MFC {
+			return r.addMFCLocked(st.Stack, key, &mfc, !isRoutingSock)
+		}
+		return r.delMFCLocked(st.Stack, key)
+
+	case linux.MRT_ASSERT, linux.MRT_PIM:
+		if len(optVal) != sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+		v := hostarch.ByteOrder.Uint32(optVal) != 0
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if name == linux.MRT_PIM {
+			r.pim = v
+		}
+		// As in Linux, setting MRT_PIM also sets MRT_ASSERT.
+		r.assert = v
+		return nil
+
+	case linux.MRT_FLUSH:
+		if len(optVal) != sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+		r.flushLocked(st.Stack, hostarch.ByteOrder.Uint32(optVal))
+		return nil
+
+	default:
+		return syserr.ErrProtocolNotAvailable
+	}
+}
+
+// releaseMulticastRouting resets the multicast routing configuration if s is
+// the multicast routing socket. It is called when s is released.
+func (s *sock) releaseMulticastRouting() {
+	st, err := s.multicastRouter()
+	if err != nil {
+		return
+	}
+	r := &st.mroute
+	r.opMu.Lock()
+	defer r.opMu.Unlock()
+	r.mu.Lock()
+	isRoutingSock := r.sock == s
+	r.mu.Unlock()
+	if isRoutingSock {
+		r.resetLocked(st.Stack)
+	}
+}
+
+// resetLocked implements MRT_DONE: it unsets the multicast routing socket and
+// removes all non-static VIFs and MFC entries.
+//
+// +checklocks:r.opMu
+func (r *multicastRouter) resetLocked(st *stack.Stack) {
+	r.mu.Lock()
+	r.sock = nil
+	r.assert = false
+	r.pim = false
+	r.mu.Unlock()
+	r.flushLocked(st, linux.MRT_FLUSH_VIFS|linux.MRT_FLUSH_MFC)
+}
+
+// flushLocked implements MRT_FLUSH.
+//
+// +checklocks:r.opMu
+func (r *multicastRouter) flushLocked(st *stack.Stack, flags uint32) {
+	for key, mfc := range r.mfcs {
+		if (mfc.static && flags&linux.MRT_FLUSH_MFC_STATIC != 0) || (!mfc.static && flags&linux.MRT_FLUSH_MFC != 0) {
+			delete(r.mfcs, key)
+			_ = st.RemoveMulticastRoute(ipv4.ProtocolNumber, key)
+		}
+	}
+	var nics []tcpip.NICID
+	r.mu.Lock()
+	for i := range r.vifs {
+		vif := &r.vifs[i]
+		if vif.nic == 0 {
+			continue
+		}
+		if (vif.static && flags&linux.MRT_FLUSH_VIFS_STATIC != 0) || (!vif.static && flags&linux.MRT_FLUSH_VIFS != 0) {
+			nics = append(nics, vif.nic)
+			*vif = multicastVIF{}
+		}
+	}
+	r.mu.Unlock()
+	for _, nic := range nics {
+		r.vifRemovedLocked(st, nic)
+	}
+	r.syncLocked(st)
+}
+
+// addVIFLocked implements MRT_ADD_VIF.
+//
+// +checklocks:r.opMu
+func (r *multicastRouter) addVIFLocked(st *stack.Stack, vif *linux.VIFCtl, static bool) *syserr.Error {
+	if vif.Flags&(linux.VIFF_TUNNEL|linux.VIFF_REGISTER) != 0 {
+		return syserr.ErrNotSupported
+	}
+	r.mu.Lock()
+	inUse := r.vifs[vif.VIFI].nic != 0
+	r.mu.Unlock()
+	if inUse {
+		return syserr.ErrAddressInUse
+	}
+
+	var nic tcpip.NICID
+	if vif.Flags&linux.VIFF_USE_IFINDEX != 0 {
+		nic = tcpip.NICID(vif.LclIfindex())
+		if nic <= 0 || !st.HasNIC(nic) {
+			return syserr.ErrAddressNotAvailable
+		}
+	} else {
+		nic = st.CheckLocalAddress(0 /* nicID */, ipv4.ProtocolNumber, tcpip.AddrFrom4(vif.LclAddr))
+		if nic == 0 {
+			return syserr.ErrAddressNotAvailable
+		}
+	}
+
+	// Multicast forwarding must be enabled for the protocol before it can
+	// be enabled on the NIC.
+	if _, err := st.EnableMulticastForwardingForProtocol(ipv4.ProtocolNumber, r); err != nil {
+		return syserr.TranslateNetstackError(err)
+	}
+	if _, err := st.SetNICMulticastForwarding(nic, ipv4.ProtocolNumber, true); err != nil {
+		return syserr.TranslateNetstackError(err)
+	}
+	r.mu.Lock()
+	r.vifs[vif.VIFI] = multicastVIF{
+		nic:    nic,
+		static: static,
+	}
+	r.mu.Unlock()
+	r.syncLocked(st)
+	return nil
+}
+
+// delVIFLocked implements MRT_DEL_VIF.
+//
+// +checklocks:r.opMu
+func (r *multicastRouter) delVIFLocked(st *stack.Stack, vifi uint16) *syserr.Error {
+	r.mu.Lock()
+	nic := r.vifs[vifi].nic
+	r.vifs[vifi] = multicastVIF{}
+	r.mu.Unlock()
+	if nic == 0 {
+		return syserr.ErrAddressNotAvailable
+	}
+	r.vifRemovedLocked(st, nic)
+	r.syncLocked(st)
+	return nil
+}
+
+// vifRemovedLocked disables multicast forwarding on nic if it is no longer
+// used by any VIF.
+//
+// +checklocks:r.opMu
+func (r *multicastRouter) vifRemovedLocked(st *stack.Stack, nic tcpip.NICID) {
+	r.mu.Lock()
+	_, inUse := r.vifIndexLocked(nic)
+	r.mu.Unlock()
+	if !inUse {
+		_, _ = st.SetNICMulticastForwarding(nic, ipv4.ProtocolNumber, false)
+	}
+}
+
+// addMFCLocked implements MRT_ADD_MFC.
+//
+// +checklocks:r.opMu
+func (r *multicastRouter) addMFCLocked(st *stack.Stack, key stack.UnicastSourceAndMulticastDestination, mfc *linux.MFCCtl, static bool) *syserr.Error {
+	src, dst := key.Source, key.Destination
+	if !header.IsV4MulticastAddress(dst) || header.IsV4LinkLocalMulticastAddress(dst) {
+		return syserr.ErrInvalidArgument
+	}
+	if src == header.IPv4Any || src == header.IPv4Broadcast || header.IsV4MulticastAddress(src) || header.IsV4LinkLocalUnicastAddress(src) {
+		return syserr.ErrInvalidArgument
+	}
+	if r.mfcs == nil {
+		r.mfcs = make(map[stack.UnicastSourceAndMulticastDestination]multicastMFC)
+	}
+	r.mfcs[key] = multicastMFC{
+		parent: mfc.Parent,
+		ttls:   mfc.TTLs,
+		static: static,
+	}
+	r.syncLocked(st)
+	return nil
+}
+
+// delMFCLocked implements MRT_DEL_MFC.
+//
+// +checklocks:r.opMu
+func (r *multicastRouter) delMFCLocked(st *stack.Stack, key stack.UnicastSourceAndMulticastDestination) *syserr.Error {
+	if _, ok := r.mfcs[key]; !ok {
+		return syserr.ErrNoSuchFile
+	}
+	delete(r.mfcs, key)
+	_ = st.RemoveMulticastRoute(ipv4.ProtocolNumber, key)
+	r.syncLocked(st)
+	return nil
+}
+
+// syncLocked updates the stack's multicast routes to match the MFC entries
+// and VIFs, and disables multicast forwarding if there is no multicast
+// routing configuration left.
+//
+// MFC entries whose parent VIF doesn't exist, or that have no outgoing VIFs,
+// have no equivalent route, so they are removed from the stack.
+//
+// +checklocks:r.opMu
+func (r *multicastRouter) syncLocked(st *stack.Stack) {
+	type update struct {
+		key   stack.UnicastSourceAndMulticastDestination
+		route stack.MulticastRoute
+		ok    bool
+	}
+	updates := make([]update, 0, len(r.mfcs))
+	r.mu.Lock()
+	active := r.sock != nil
+	for key, mfc := range r.mfcs {
+		route, ok := r.routeLocked(&mfc)
+		updates = append(updates, update{key, route, ok})
+	}
+	for i := range r.vifs {
+		active = active || r.vifs[i].nic != 0
+	}
+	r.mu.Unlock()
+
+	if !active && len(r.mfcs) == 0 {
+		_ = st.DisableMulticastForwardingForProtocol(ipv4.ProtocolNumber)
+		return
+	}
+	if len(updates) == 0 {
+		return
+	}
+	if _, err := st.EnableMulticastForwardingForProtocol(ipv4.ProtocolNumber, r); err != nil {
+		return
+	}
+	for _, u := range updates {
+		if u.ok {
+			_ = st.AddMulticastRoute(ipv4.ProtocolNumber, u.key, u.route)
+		} else {
+			_ = st.RemoveMulticastRoute(ipv4.ProtocolNumber, u.key)
+		}
+	}
+}
+
+// routeLocked returns the multicast route equivalent to mfc.
+//
+// +checklocks:r.mu
+func (r *multicastRouter) routeLocked(mfc *multicastMFC) (stack.MulticastRoute, bool) {
+	route := stack.MulticastRoute{
+		ExpectedInputInterface: r.vifs[mfc.parent].nic,
+	}
+	if route.ExpectedInputInterface == 0 {
+		return route, false
+	}
+	for i, ttl := range mfc.ttls {
+		nic := r.vifs[i].nic
+		// Linux forwards packets whose TTL is greater than the threshold;
+		// netstack forwards those whose TTL is at least MinTTL.
+		if nic == 0 || ttl == 0 || ttl == 255 {
+			continue
+		}
+		route.OutgoingInterfaces = append(route.OutgoingInterfaces, stack.MulticastRouteOutgoingInterface{
+			ID:     nic,
+			MinTTL: ttl + 1,
+		})
+	}
+	return route, len(route.OutgoingInterfaces) != 0
+}
+
+// vifIndexLocked returns the index of the VIF for nic.
+//
+// +checklocks:r.mu
+func (r *multicastRouter) vifIndexLocked(nic tcpip.NICID) (int, bool) {
+	for i := range r.vifs {
+		if r.vifs[i].nic == nic {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// OnMissingRoute implements stack.MulticastForwardingEventDispatcher.
+func (r *multicastRouter) OnMissingRoute(context stack.MulticastPacketContext) {
+	r.sendMessage(linux.IGMPMSG_NOCACHE, context, true)
+}
+
+// OnUnexpectedInputInterface implements
+// stack.MulticastForwardingEventDispatcher.
+func (r *multicastRouter) OnUnexpectedInputInterface(context stack.MulticastPacketContext, _ tcpip.NICID) {
+	r.sendMessage(linux.IGMPMSG_WRONGVIF, context, false)
+}
+
+// sendMessage queues a struct igmpmsg of the given type on the multicast
+// routing socket. Like Linux, IGMPMSG_WRONGVIF messages are only sent if
+// MRT_ASSERT is enabled.
+func (r *multicastRouter) sendMessage(msgType uint8, context stack.MulticastPacketContext, always bool) {
+	r.mu.Lock()
+	s := r.sock
+	vifi, ok := r.vifIndexLocked(context.InputInterface)
+	send := always || r.assert
+	r.mu.Unlock()
+	if s == nil || !ok || !send {
+		return
+	}
+	ep, ok := s.Endpoint.(stack.RawTransportEndpoint)
+	if !ok {
+		return
+	}
+
+	msg := linux.IGMPMsg{
+		MsgType: msgType,
+		VIF:     uint8(vifi),
+		VIFHi:   uint8(vifi >> 8),
+		Src:     context.SourceAndDestination.Source.As4(),
+		Dst:     context.SourceAndDestination.Destination.As4(),
+	}
+	// As in Linux, the message takes the place of an IPv4 header, and is
+	// followed by an IGMP header.
+	buf := make([]byte, linux.SizeOfIGMPMsg+header.IGMPMinimumSize)
+	msg.MarshalUnsafe(buf)
+	ip := header.IPv4(buf)
+	ip.SetHeaderLength(header.IPv4MinimumSize)
+	ip.SetTotalLength(uint16(len(buf)))
+	buf[linux.SizeOfIGMPMsg] = msgType
+
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		Payload: buffer.MakeWithData(buf),
+	})
+	defer pkt.DecRef()
+	pkt.NetworkProtocolNumber = header.IPv4ProtocolNumber
+	pkt.NICID = context.InputInterface
+	if _, ok := pkt.NetworkHeader().Consume(header.IPv4MinimumSize); !ok {
+		return
+	}
+	ep.HandlePacket(pkt)
+}
+
+var _ stack.MulticastForwardingEventDispatcher = (*multicastRouter)(nil)
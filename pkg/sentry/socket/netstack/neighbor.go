@@ -0,0 +1,235 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netstack
+
+import (
+	"sort"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/sentry/inet"
+	"github.com/wilinz/gvisor/pkg/sentry/socket/netlink/nlmsg"
+	"github.com/wilinz/gvisor/pkg/syserr"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/header"
+	"github.com/wilinz/gvisor/pkg/tcpip/network/ipv4"
+	"github.com/wilinz/gvisor/pkg/tcpip/network/ipv6"
+	"github.com/wilinz/gvisor/pkg/tcpip/stack"
+)
+
+// Neighbor tables are the neighbor caches of NICs, which are filled by ARP for
+// IPv4 and NDP for IPv6. Netlink requests can only add static entries, which
+// Linux reports as permanent, and remove entries. NICs without link address
+// resolution, such as loopback, have no neighbor table.
+
+// linuxNeighborState returns the Linux NUD_* state of a neighbor entry.
+func linuxNeighborState(state stack.NeighborState) uint16 {
+	switch state {
+	case stack.Incomplete:
+		return linux.NUD_INCOMPLETE
+	case stack.Reachable:
+		return linux.NUD_REACHABLE
+	case stack.Stale:
+		return linux.NUD_STALE
+	case stack.Delay:
+		return linux.NUD_DELAY
+	case stack.Probe:
+		return linux.NUD_PROBE
+	case stack.Static:
+		return linux.NUD_PERMANENT
+	case stack.Unreachable:
+		return linux.NUD_FAILED
+	default:
+		return linux.NUD_NONE
+	}
+}
+
+// Neighbors implements inet.Stack.Neighbors.
+func (s *Stack) Neighbors() []inet.Neighbor {
+	var ids []tcpip.NICID
+	for id := range s.Stack.NICInfo() {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var neighbors []inet.Neighbor
+	for _, id := range ids {
+		for _, p := range []struct {
+			family   uint8
+			protocol tcpip.NetworkProtocolNumber
+		}{
+			{linux.AF_INET, ipv4.ProtocolNumber},
+			{linux.AF_INET6, ipv6.ProtocolNumber},
+		} {
+			entries, err := s.Stack.Neighbors(id, p.protocol)
+			if err != nil {
+				continue
+			}
+			for _, e := range entries {
+				neighbors = append(neighbors, inet.Neighbor{
+					Family:   p.family,
+					Ifindex:  int32(id),
+					State:    linuxNeighborState(e.State),
+					Addr:     e.Addr.AsSlice(),
+					LinkAddr: []byte(e.LinkAddr),
+				})
+			}
+		}
+	}
+	return neighbors
+}
+
+// neighborRequest is an RTM_NEWNEIGH or RTM_DELNEIGH request.
+type neighborRequest struct {
+	nicID    tcpip.NICID
+	protocol tcpip.NetworkProtocolNumber
+	state    uint16
+	addr     tcpip.Address
+	linkAddr tcpip.LinkAddress
+}
+
+// parseNeighborRequest parses an RTM_NEWNEIGH or RTM_DELNEIGH request.
+func (s *Stack) parseNeighborRequest(msg *nlmsg.Message) (neighborRequest, *syserr.Error) {
+	var hdr linux.NdMsg
+	attrs, ok := msg.GetData(&hdr)
+	if !ok {
+		return neighborRequest{}, syserr.ErrInvalidArgument
+	}
+
+	req := neighborRequest{
+		nicID: tcpip.NICID(hdr.Ifindex),
+		state: hdr.State,
+	}
+	var addrLen int
+	switch hdr.Family {
+	case linux.AF_INET:
+		req.protocol = ipv4.ProtocolNumber
+		addrLen = header.IPv4AddressSize
+	case linux.AF_INET6:
+		req.protocol = ipv6.ProtocolNumber
+		addrLen = header.IPv6AddressSize
+	default:
+		return neighborRequest{}, syserr.ErrAddressFamilyNotSupported
+	}
+	if !s.Stack.CheckNetworkProtocol(req.protocol) {
+		return neighborRequest{}, syserr.ErrAddressFamilyNotSupported
+	}
+	if hdr.Flags&^linux.NTF_SELF != 0 {
+		// Proxy entries and bridge flags aren't supported.
+		return neighborRequest{}, syserr.ErrNotSupported
+	}
+	if req.nicID == 0 {
+		return neighborRequest{}, syserr.ErrInvalidArgument
+	}
+	nicInfo, ok := s.Stack.NICInfo()[req.nicID]
+	if !ok {
+		return neighborRequest{}, syserr.ErrNoDevice
+	}
+
+	for !attrs.Empty() {
+		ahdr, value, rest, ok := attrs.ParseFirst()
+		if !ok {
+			return neighborRequest{}, syserr.ErrInvalidArgument
+		}
+		attrs = rest
+
+		switch ahdr.Type {
+		case linux.NDA_DST:
+			if len(value) != addrLen {
+				return neighborRequest{}, syserr.ErrInvalidArgument
+			}
+			req.addr = tcpip.AddrFromSlice(value)
+		case linux.NDA_LLADDR:
+			if len(value) != len(nicInfo.LinkAddress) {
+				return neighborRequest{}, syserr.ErrInvalidArgument
+			}
+			req.linkAddr = tcpip.LinkAddress(value)
+		case linux.NDA_CACHEINFO, linux.NDA_PROBES:
+			// Read-only attributes, ignored like Linux does.
+		default:
+			return neighborRequest{}, syserr.ErrNotSupported
+		}
+	}
+	if req.addr.BitLen() == 0 {
+		return neighborRequest{}, syserr.ErrInvalidArgument
+	}
+	return req, nil
+}
+
+// findNeighbor returns the neighbor entry of addr on the NIC, if there is one.
+func (s *Stack) findNeighbor(nicID tcpip.NICID, protocol tcpip.NetworkProtocolNumber, addr tcpip.Address) (stack.NeighborEntry, *syserr.Error) {
+	entries, err := s.Stack.Neighbors(nicID, protocol)
+	if err != nil {
+		return stack.NeighborEntry{}, syserr.TranslateNetstackError(err)
+	}
+	for _, e := range entries {
+		if e.Addr == addr {
+			return e, nil
+		}
+	}
+	return stack.NeighborEntry{}, syserr.ErrNoFileOrDir
+}
+
+// NewNeighbor implements inet.Stack.NewNeighbor.
+func (s *Stack) NewNeighbor(ctx context.Context, msg *nlmsg.Message) *syserr.Error {
+	req, err := s.parseNeighborRequest(msg)
+	if err != nil {
+		return err
+	}
+	// Only static entries can be added; the states of other entries are
+	// managed by neighbor unreachability detection.
+	if req.state&^linux.NUD_NOARP != linux.NUD_PERMANENT {
+		return syserr.ErrNotSupported
+	}
+	if len(req.linkAddr) == 0 {
+		return syserr.ErrInvalidArgument
+	}
+
+	// Like Linux, the request's flags decide whether an existing entry can
+	// be replaced. See net/core/neighbour.c:neigh_add.
+	flags := msg.Header().Flags
+	switch _, err := s.findNeighbor(req.nicID, req.protocol, req.addr); err {
+	case nil:
+		if flags&linux.NLM_F_EXCL != 0 || flags&linux.NLM_F_REPLACE == 0 {
+			return syserr.ErrExists
+		}
+	case syserr.ErrNoFileOrDir:
+		if flags&linux.NLM_F_CREATE == 0 {
+			return syserr.ErrNoFileOrDir
+		}
+	default:
+		return err
+	}
+	if err := s.Stack.AddStaticNeighbor(req.nicID, req.protocol, req.addr, req.linkAddr); err != nil {
+		return syserr.TranslateNetstackError(err)
+	}
+	return nil
+}
+
+// RemoveNeighbor implements inet.Stack.RemoveNeighbor.
+func (s *Stack) RemoveNeighbor(ctx context.Context, msg *nlmsg.Message) *syserr.Error {
+	req, err := s.parseNeighborRequest(msg)
+	if err != nil {
+		return err
+	}
+	switch err := s.Stack.RemoveNeighbor(req.nicID, req.protocol, req.addr); err.(type) {
+	case nil:
+		return nil
+	case *tcpip.ErrBadAddress:
+		return syserr.ErrNoFileOrDir
+	default:
+		return syserr.TranslateNetstackError(err)
+	}
+}
@@ -37,6 +37,7 @@ import (
 	"google.golang.org/protobuf/proto"
 	"github.com/wilinz/gvisor/pkg/abi/linux"
 	"github.com/wilinz/gvisor/pkg/abi/linux/errno"
+	"github.com/wilinz/gvisor/pkg/buffer"
 	"github.com/wilinz/gvisor/pkg/context"
 	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
 	"github.com/wilinz/gvisor/pkg/eventchannel"
@@ -280,6 +281,8 @@ var Metrics = tcpip.Stats{
 		ListenOverflowSynCookieSent:        mustCreateMetric("/netstack/tcp/listen_overflow_syn_cookie_sent", "Number of times a SYN cookie was sent."),
 		ListenOverflowSynCookieRcvd:        mustCreateMetric("/netstack/tcp/listen_overflow_syn_cookie_rcvd", "Number of times a SYN cookie was received."),
 		ListenOverflowInvalidSynCookieRcvd: mustCreateMetric("/netstack/tcp/listen_overflow_invalid_syn_cookie_rcvd", "Number of times an invalid SYN cookie was received."),
+		ListenSynBacklogDrop:               mustCreateMetric("/netstack/tcp/listen_syn_backlog_drop", "Number of SYNs dropped because the SYN backlog was full and SYN cookies were disabled."),
+		DeferAcceptDrop:                    mustCreateMetric("/netstack/tcp/defer_accept_drop", "Number of ACKs completing a handshake dropped because of TCP_DEFER_ACCEPT."),
 		FailedConnectionAttempts:           mustCreateMetric("/netstack/tcp/failed_connection_attempts", "Number of calls to Connect or Listen (active and passive openings, respectively) that end in an error."),
 		ValidSegmentsReceived:              mustCreateMetric("/netstack/tcp/valid_segments_received", "Number of TCP segments received that the transport layer successfully parsed."),
 		InvalidSegmentsReceived:            mustCreateMetric("/netstack/tcp/invalid_segments_received", "Number of TCP segments received that the transport layer could not parse."),
@@ -376,7 +379,7 @@ type sock struct {
 	namespace *inet.Namespace
 
 	mu sync.Mutex `state:"nosave"`
-	// readWriter is an optimization to avoid allocations.
+	// readWriter is an optimization to avoid allocations in the write path.
 	// +checklocks:mu
 	readWriter usermem.IOSequenceReadWriter `state:"nosave"`
 
@@ -394,10 +397,24 @@ type sock struct {
 	// timestamp holds the timestamp to use with SIOCTSTAMP. It is only
 	// valid when timestampValid is true. It is protected by readMu.
 	timestamp time.Time `state:".(int64)"`
+	// recvWriter is an optimization to avoid allocations in the read path.
+	// Reading through it copies received data directly into the
+	// destination IOSequence, one packet at a time rather than one buffer
+	// view at a time.
+	// +checklocks:readMu
+	recvWriter usermem.IOSequenceReadWriter `state:"nosave"`
 
 	// TODO(b/153685824): Move this to SocketOptions.
 	// sockOptInq corresponds to TCP_INQ.
 	sockOptInq bool
+
+	// tls is the kernel TLS state, set up by setsockopt(TCP_ULP) and
+	// setsockopt(SOL_TLS).
+	tls tlsState
+
+	// zeroCopy holds the mappings of TCP sockets used by
+	// getsockopt(TCP_ZEROCOPY_RECEIVE).
+	zeroCopy zeroCopyState
 }
 
 var _ = socket.Socket(&sock{})
@@ -441,7 +458,9 @@ func (s *sock) Release(ctx context.Context) {
 	s.EventRegister(&e)
 	defer s.EventUnregister(&e)
 
+	s.releaseMulticastRouting()
 	s.Endpoint.Close()
+	s.zeroCopy.release(ctx)
 
 	// SO_LINGER option is valid only for TCP. For other socket types
 	// return after endpoint close.
@@ -478,6 +497,9 @@ func (s *sock) Read(ctx context.Context, dst usermem.IOSequence, opts vfs.ReadOp
 	if dst.NumBytes() == 0 {
 		return 0, nil
 	}
+	if s.tls.rxEnabled.Load() {
+		return s.tlsRead(ctx, dst)
+	}
 	n, _, _, _, _, err := s.nonBlockingRead(ctx, dst, false, false, false)
 	if err == syserr.ErrWouldBlock {
 		return int64(n), linuxerr.ErrWouldBlock
@@ -500,6 +522,10 @@ func (s *sock) Write(ctx context.Context, src usermem.IOSequence, opts vfs.Write
 	var err tcpip.Error
 	switch s.Endpoint.(type) {
 	case *tcp.Endpoint:
+		if s.tls.txEnabled.Load() {
+			n, err = s.tlsWrite(ctx, src, linux.TLS_RECORD_TYPE_DATA)
+			break
+		}
 		s.mu.Lock()
 		s.readWriter.Init(ctx, src)
 		n, err = s.Endpoint.Write(&s.readWriter, tcpip.WriteOptions{})
@@ -521,6 +547,28 @@ func (s *sock) Write(ctx context.Context, src usermem.IOSequence, opts vfs.Write
 	return n, nil
 }
 
+// WriteBuffer implements socket.BufferWriter.WriteBuffer.
+func (s *sock) WriteBuffer(t *kernel.Task, buf *buffer.Buffer) (int64, error) {
+	// Only TCP endpoints queue payloads without copying them, and TLS
+	// records must be sealed into fresh buffers anyway.
+	if _, ok := s.Endpoint.(*tcp.Endpoint); !ok || s.tls.txEnabled.Load() {
+		return 0, linuxerr.EOPNOTSUPP
+	}
+	size := buf.Size()
+	r := buf.AsBufferReader()
+	n, err := s.Endpoint.Write(&r, tcpip.WriteOptions{})
+	if _, ok := err.(*tcpip.ErrWouldBlock); ok {
+		return 0, linuxerr.ErrWouldBlock
+	}
+	if err != nil {
+		return 0, syserr.TranslateNetstackError(err).ToError()
+	}
+	if n < size {
+		return n, linuxerr.ErrWouldBlock
+	}
+	return n, nil
+}
+
 // Accept implements the linux syscall accept(2) for sockets backed by
 // tcpip.Endpoint.
 func (s *sock) Accept(t *kernel.Task, peerRequested bool, flags int, blocking bool) (int32, linux.SockAddr, uint32, *syserr.Error) {
@@ -600,6 +648,20 @@ func (s *sock) GetSockOpt(t *kernel.Task, level, name int, outPtr hostarch.Addr,
 		}
 		return &val, nil
 	}
+	if level == linux.SOL_IP && isMulticastRoutingOption(name) {
+		return s.getSockOptMulticastRouting(name, outLen)
+	}
+	if socket.IsTCP(s) {
+		if level == linux.SOL_TCP && name == linux.TCP_ULP {
+			return s.getSockOptTCPULP(outLen)
+		}
+		if level == linux.SOL_TCP && name == linux.TCP_ZEROCOPY_RECEIVE {
+			return s.getSockOptTCPZeroCopyReceive(t, outPtr, outLen)
+		}
+		if level == linux.SOL_TLS {
+			return s.getSockOptTLS(name, outLen)
+		}
+	}
 
 	return GetSockOpt(t, s, s.Endpoint, s.family, s.skType, level, name, outPtr, outLen)
 }
@@ -630,6 +692,17 @@ func (s *sock) SetSockOpt(t *kernel.Task, level int, name int, optVal []byte) *s
 		s.sockOptInq = hostarch.ByteOrder.Uint32(optVal) != 0
 		return nil
 	}
+	if level == linux.SOL_IP && isMulticastRoutingOption(name) {
+		return s.setSockOptMulticastRouting(t, name, optVal)
+	}
+	if socket.IsTCP(s) {
+		if level == linux.SOL_TCP && name == linux.TCP_ULP {
+			return s.setSockOptTCPULP(optVal)
+		}
+		if level == linux.SOL_TLS {
+			return s.setSockOptTLS(name, optVal)
+		}
+	}
 
 	return SetSockOpt(t, s, s.Endpoint, level, name, optVal)
 }
@@ -665,7 +738,18 @@ func (s *sock) isPacketBased() bool {
 
 // Readiness returns a mask of ready events for socket s.
 func (s *sock) Readiness(mask waiter.EventMask) waiter.EventMask {
-	return s.Endpoint.Readiness(mask)
+	r := s.Endpoint.Readiness(mask)
+	// Decrypted TLS data may be buffered in the socket rather than the
+	// endpoint.
+	if s.tls.rxReady.Load() {
+		r |= mask & waiter.ReadableEvents
+	}
+	// Transmit timestamps are queued onto the error queue without setting
+	// the endpoint's last error.
+	if mask&waiter.EventErr != 0 && s.Endpoint.SocketOptions().PeekErr() != nil {
+		r |= waiter.EventErr
+	}
+	return r
 }
 
 // checkFamily returns true iff the specified address family may be used with
@@ -898,6 +982,9 @@ func GetSockOpt(t *kernel.Task, s socket.Socket, ep commonEndpoint, family int,
 	case linux.SOL_TCP:
 		return getSockOptTCP(t, s, ep, name, outLen)
 
+	case linux.SOL_MPTCP:
+		return getSockOptMPTCP(t, s, ep, name, outLen)
+
 	case linux.SOL_IPV6:
 		return getSockOptIPv6(t, s, ep, name, outPtr, outLen)
 
@@ -909,7 +996,11 @@ func GetSockOpt(t *kernel.Task, s socket.Socket, ep commonEndpoint, family int,
 
 	case linux.SOL_PACKET:
 		return getSockOptPacket(t, s, ep, name, outPtr, outLen)
-	case linux.SOL_UDP, linux.SOL_RAW:
+
+	case linux.SOL_UDP:
+		return getSockOptUDP(t, s, ep, name, outLen)
+
+	case linux.SOL_RAW:
 		// Not supported.
 	}
 
@@ -1094,6 +1185,22 @@ func getSockOptSocket(t *kernel.Task, s socket.Socket, ep commonEndpoint, family
 		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetNoChecksum()))
 		return &v, nil
 
+	case linux.SO_RXQ_OVFL:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetReceiveDropCount()))
+		return &v, nil
+
+	case linux.SO_TIMESTAMPING:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(ep.SocketOptions().GetTimestamping())
+		return &v, nil
+
 	case linux.SO_ACCEPTCONN:
 		if outLen < sizeOfInt32 {
 			return nil, syserr.ErrInvalidArgument
@@ -1109,6 +1216,32 @@ func getSockOptSocket(t *kernel.Task, s socket.Socket, ep commonEndpoint, family
 
 		v := primitive.Int32(ep.SocketOptions().GetRcvlowat())
 		return &v, nil
+
+	case linux.SO_INCOMING_CPU:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		// Like Linux before a packet is received, report -1 if the
+		// socket has no flow.
+		v := primitive.Int32(-1)
+		if cpu, ok := incomingCPU(t, ep); ok {
+			v = primitive.Int32(cpu)
+		}
+		return &v, nil
+
+	case linux.SO_INCOMING_NAPI_ID:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		// Like Linux, report 0 if the socket has no NAPI ID.
+		v := primitive.Int32(0)
+		if cpu, ok := incomingCPU(t, ep); ok {
+			v = primitive.Int32(minNAPIID + cpu)
+		}
+		return &v, nil
+
 	default:
 		if v, err, handled := getSockOptSocketCustom(t, s, ep, name, outLen); handled {
 			return v, err
@@ -1117,6 +1250,25 @@ func getSockOptSocket(t *kernel.Task, s socket.Socket, ep commonEndpoint, family
 	return nil, syserr.ErrProtocolNotAvailable
 }
 
+// minNAPIID is the first NAPI ID reported by SO_INCOMING_NAPI_ID. Linux
+// assigns NAPI IDs above the CPU numbers, from MIN_NAPI_ID.
+const minNAPIID = 8193
+
+// incomingCPU returns the application CPU that the flow of ep is associated
+// with, if ep has a flow.
+//
+// Packets aren't processed on application CPUs, so the CPU is derived from
+// the stack's hash of the flow instead. This gives every flow a stable CPU,
+// and a NAPI ID per CPU, which is all that applications sharding flows across
+// CPUs with SO_INCOMING_CPU or SO_INCOMING_NAPI_ID rely on.
+func incomingCPU(t *kernel.Task, ep commonEndpoint) (int32, bool) {
+	hash, err := ep.GetSockOptInt(tcpip.FlowHashOption)
+	if err != nil {
+		return 0, false
+	}
+	return int32(uint(uint32(hash)) % t.Kernel().ApplicationCores()), true
+}
+
 // getSockOptTCP implements GetSockOpt when level is SOL_TCP.
 func getSockOptTCP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name, outLen int) (marshal.Marshallable, *syserr.Error) {
 	if !socket.IsTCP(s) {
@@ -1215,12 +1367,45 @@ func getSockOptTCP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name, out
 		}
 
 		info := linux.TCPInfo{
-			State:       uint8(v.State),
-			RTO:         uint32(v.RTO / time.Microsecond),
-			RTT:         uint32(v.RTT / time.Microsecond),
-			RTTVar:      uint32(v.RTTVar / time.Microsecond),
-			SndSsthresh: v.SndSsthresh,
-			SndCwnd:     v.SndCwnd,
+			State:         uint8(v.State),
+			WindowScale:   v.SndWndScale&0xf | v.RcvWndScale<<4,
+			RTO:           uint32(v.RTO / time.Microsecond),
+			SndMss:        v.SndMSS,
+			Unacked:       v.Unacked,
+			Sacked:        v.Sacked,
+			LastDataSent:  uint32(v.LastDataSent / time.Millisecond),
+			LastAckRecv:   uint32(v.LastAckRecv / time.Millisecond),
+			RTT:           uint32(v.RTT / time.Microsecond),
+			RTTVar:        uint32(v.RTTVar / time.Microsecond),
+			SndSsthresh:   v.SndSsthresh,
+			SndCwnd:       v.SndCwnd,
+			Advmss:        v.AdvMSS,
+			TotalRetrans:  v.TotalRetrans,
+			PacingRate:    v.PacingRate,
+			MaxPacingRate: math.MaxUint64,
+			BytesAcked:    v.BytesAcked,
+			BytesReceived: v.BytesReceived,
+			SegsOut:       v.SegsOut,
+			SegsIn:        v.SegsIn,
+			NotSentBytes:  v.NotSentBytes,
+			MinRTT:        uint32(v.MinRTT / time.Microsecond),
+			DataSegsIn:    v.DataSegsIn,
+			DataSegsOut:   v.DataSegsOut,
+			DeliveryRate:  v.DeliveryRate,
+			BytesSent:     v.BytesSent,
+			BytesRetrans:  v.BytesRetrans,
+		}
+		if v.TimestampsEnabled {
+			info.Options |= linux.TCPI_OPT_TIMESTAMPS
+		}
+		if v.SACKPermitted {
+			info.Options |= linux.TCPI_OPT_SACK
+		}
+		if v.SndWndScale != 0 || v.RcvWndScale != 0 {
+			info.Options |= linux.TCPI_OPT_WSCALE
+		}
+		if v.DeliveryRateAppLimited {
+			info.DeliveryRateAppLimited = 1
 		}
 		switch v.CcState {
 		case tcpip.RTORecovery:
@@ -1251,8 +1436,7 @@ func getSockOptTCP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name, out
 		return &bufP, nil
 
 	case linux.TCP_CC_INFO,
-		linux.TCP_NOTSENT_LOWAT,
-		linux.TCP_ZEROCOPY_RECEIVE:
+		linux.TCP_NOTSENT_LOWAT:
 
 		// Not supported.
 
@@ -1335,6 +1519,30 @@ func getSockOptTCP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name, out
 		}
 		vP := primitive.Int32(v)
 		return &vP, nil
+
+	case linux.TCP_FASTOPEN:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v, err := ep.GetSockOptInt(tcpip.TCPFastOpenOption)
+		if err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+		vP := primitive.Int32(v)
+		return &vP, nil
+
+	case linux.TCP_FASTOPEN_CONNECT:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v, err := ep.GetSockOptInt(tcpip.TCPFastOpenConnectOption)
+		if err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+		vP := primitive.Int32(v)
+		return &vP, nil
 	}
 	return nil, syserr.ErrProtocolNotAvailable
 }
@@ -1370,6 +1578,91 @@ func getSockOptICMPv6(t *kernel.Task, s socket.Socket, ep commonEndpoint, name i
 	return nil, syserr.ErrProtocolNotAvailable
 }
 
+// isUDPSocket returns true if s is a UDP socket.
+func isUDPSocket(s socket.Socket) bool {
+	_, skType, protocol := s.Type()
+	return skType == linux.SOCK_DGRAM && (protocol == 0 || protocol == linux.IPPROTO_UDP)
+}
+
+// getSockOptUDP implements GetSockOpt when level is SOL_UDP.
+func getSockOptUDP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name, outLen int) (marshal.Marshallable, *syserr.Error) {
+	if !isUDPSocket(s) {
+		return nil, syserr.ErrProtocolNotAvailable
+	}
+
+	switch name {
+	case linux.UDP_SEGMENT:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v, err := ep.GetSockOptInt(tcpip.UDPSegmentOption)
+		if err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+		vP := primitive.Int32(v)
+		return &vP, nil
+
+	case linux.UDP_GRO:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v, err := ep.GetSockOptInt(tcpip.UDPGROOption)
+		if err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+		vP := primitive.Int32(v)
+		return &vP, nil
+	}
+	return nil, syserr.ErrProtocolNotAvailable
+}
+
+// getSockOptMPTCP implements GetSockOpt when level is SOL_MPTCP.
+func getSockOptMPTCP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name, outLen int) (marshal.Marshallable, *syserr.Error) {
+	if _, _, protocol := s.Type(); protocol != linux.IPPROTO_MPTCP {
+		return nil, syserr.ErrUnknownProtocolOption
+	}
+
+	switch name {
+	case linux.MPTCP_INFO:
+		var v tcpip.MPTCPInfoOption
+		if err := ep.GetSockOpt(&v); err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+		// Like Linux, options of sockets which fell back to TCP are
+		// handled by the TCP subflow, which doesn't know SOL_MPTCP.
+		if v.Fallback {
+			return nil, syserr.ErrUnknownProtocolOption
+		}
+
+		info := linux.MPTCPInfo{
+			Subflows:      v.Subflows,
+			SubflowsTotal: v.Subflows + 1,
+			Token:         v.Token,
+			WriteSeq:      v.WriteSeq,
+			SndUna:        v.SndUna,
+			RcvNxt:        v.RcvNxt,
+			BytesSent:     v.BytesSent,
+			BytesReceived: v.BytesReceived,
+			BytesAcked:    v.SndUna - (v.WriteSeq - v.BytesSent),
+		}
+		if v.RemoteKeyReceived {
+			info.Flags |= linux.MPTCP_INFO_FLAG_REMOTE_KEY_RECEIVED
+		}
+
+		// Linux truncates the output binary to outLen.
+		buf := t.CopyScratchBuffer(info.SizeBytes())
+		info.MarshalUnsafe(buf)
+		if len(buf) > outLen {
+			buf = buf[:outLen]
+		}
+		bufP := primitive.ByteSlice(buf)
+		return &bufP, nil
+	}
+	return nil, syserr.ErrNotSupported
+}
+
 func defaultTTL(t *kernel.Task, network tcpip.NetworkProtocolNumber) (primitive.Int32, tcpip.Error) {
 	var opt tcpip.DefaultTTLOption
 	stack := inet.StackFromContext(t)
@@ -1442,6 +1735,14 @@ func getSockOptIPv6(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int
 		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetReceiveHopLimit()))
 		return &v, nil
 
+	case linux.IPV6_MTU_DISCOVER:
+		return getSockOptMTUDiscover(ep, outLen)
+
+	case linux.IPV6_MTU:
+		// Like Linux, this returns the path MTU of connected sockets
+		// rather than the value set with setsockopt.
+		return getSockOptPathMTU(ep, outLen)
+
 	case linux.IPV6_PATHMTU:
 		// Not supported.
 
@@ -1490,6 +1791,14 @@ func getSockOptIPv6(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int
 		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetReceiveOriginalDstAddress()))
 		return &v, nil
 
+	case linux.IPV6_TRANSPARENT:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetTransparent()))
+		return &v, nil
+
 	case linux.IPV6_RECVPKTINFO:
 		if outLen < sizeOfInt32 {
 			return nil, syserr.ErrInvalidArgument
@@ -1726,6 +2035,14 @@ func getSockOptIP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int,
 		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetReceiveOriginalDstAddress()))
 		return &v, nil
 
+	case linux.IP_TRANSPARENT:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetTransparent()))
+		return &v, nil
+
 	case linux.SO_ORIGINAL_DST:
 		if outLen < sockAddrInetSize {
 			return nil, syserr.ErrInvalidArgument
@@ -1824,32 +2141,56 @@ func getSockOptIP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int,
 		return &ret, nil
 
 	case linux.IP_MTU_DISCOVER:
-		if outLen < sizeOfInt32 {
-			return nil, syserr.ErrInvalidArgument
-		}
+		return getSockOptMTUDiscover(ep, outLen)
 
-		v, err := ep.GetSockOptInt(tcpip.MTUDiscoverOption)
-		if err != nil {
-			return nil, syserr.TranslateNetstackError(err)
-		}
-		switch tcpip.PMTUDStrategy(v) {
-		case tcpip.PMTUDiscoveryWant:
-			v = linux.IP_PMTUDISC_WANT
-		case tcpip.PMTUDiscoveryDont:
-			v = linux.IP_PMTUDISC_DONT
-		case tcpip.PMTUDiscoveryDo:
-			v = linux.IP_PMTUDISC_DO
-		case tcpip.PMTUDiscoveryProbe:
-			v = linux.IP_PMTUDISC_PROBE
-		default:
-			panic(fmt.Errorf("unknown PMTUD option: %d", v))
-		}
-		vP := primitive.Int32(v)
-		return &vP, nil
+	case linux.IP_MTU:
+		return getSockOptPathMTU(ep, outLen)
 	}
 	return nil, syserr.ErrProtocolNotAvailable
 }
 
+// getSockOptMTUDiscover implements GetSockOpt for IP_MTU_DISCOVER and
+// IPV6_MTU_DISCOVER, which share their values.
+func getSockOptMTUDiscover(ep commonEndpoint, outLen int) (marshal.Marshallable, *syserr.Error) {
+	if outLen < sizeOfInt32 {
+		return nil, syserr.ErrInvalidArgument
+	}
+
+	v, err := ep.GetSockOptInt(tcpip.MTUDiscoverOption)
+	if err != nil {
+		return nil, syserr.TranslateNetstackError(err)
+	}
+	switch tcpip.PMTUDStrategy(v) {
+	case tcpip.PMTUDiscoveryWant:
+		v = linux.IP_PMTUDISC_WANT
+	case tcpip.PMTUDiscoveryDont:
+		v = linux.IP_PMTUDISC_DONT
+	case tcpip.PMTUDiscoveryDo:
+		v = linux.IP_PMTUDISC_DO
+	case tcpip.PMTUDiscoveryProbe:
+		v = linux.IP_PMTUDISC_PROBE
+	default:
+		panic(fmt.Errorf("unknown PMTUD option: %d", v))
+	}
+	vP := primitive.Int32(v)
+	return &vP, nil
+}
+
+// getSockOptPathMTU implements GetSockOpt for IP_MTU and IPV6_MTU, which
+// return the path MTU of connected sockets.
+func getSockOptPathMTU(ep commonEndpoint, outLen int) (marshal.Marshallable, *syserr.Error) {
+	if outLen < sizeOfInt32 {
+		return nil, syserr.ErrInvalidArgument
+	}
+
+	v, err := ep.GetSockOptInt(tcpip.PathMTUOption)
+	if err != nil {
+		return nil, syserr.TranslateNetstackError(err)
+	}
+	vP := primitive.Int32(v)
+	return &vP, nil
+}
+
 func getSockOptPacket(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int, outPtr hostarch.Addr, outLen int) (marshal.Marshallable, *syserr.Error) {
 	if _, ok := ep.(tcpip.Endpoint); !ok {
 		log.Warningf("SOL_PACKET options not supported on endpoints other than tcpip.Endpoint: option = %d, endpoint = %T", name, ep)
@@ -1866,6 +2207,9 @@ func getSockOptPacket(t *kernel.Task, s socket.Socket, ep commonEndpoint, name i
 		case linux.TPACKET_V2:
 			v := primitive.Int32(uint32((*linux.Tpacket2Hdr)(nil).SizeBytes()))
 			return &v, nil
+		case linux.TPACKET_V3:
+			v := primitive.Int32(uint32((*linux.Tpacket3Hdr)(nil).SizeBytes()))
+			return &v, nil
 		default:
 			return nil, syserr.ErrInvalidArgument
 		}
@@ -1874,6 +2218,18 @@ func getSockOptPacket(t *kernel.Task, s socket.Socket, ep commonEndpoint, name i
 		if err := ep.GetSockOpt(&tps); err != nil {
 			return nil, syserr.TranslateNetstackError(err)
 		}
+		version, err := ep.GetSockOptInt(tcpip.PacketMMapVersionOption)
+		if err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+		if version == linux.TPACKET_V3 {
+			v := linux.TpacketStatsV3{
+				Packets:    tps.Packets,
+				Dropped:    tps.Dropped,
+				FreezeQCnt: tps.FreezeQueueCount,
+			}
+			return &v, nil
+		}
 		v := linux.TpacketStats{
 			Packets: tps.Packets,
 			Dropped: tps.Dropped,
@@ -1905,8 +2261,10 @@ func SetSockOpt(t *kernel.Task, s socket.Socket, ep commonEndpoint, level int, n
 	case linux.SOL_PACKET:
 		return setSockOptPacket(t, s, ep, name, optVal)
 
-	case linux.SOL_UDP,
-		linux.SOL_RAW:
+	case linux.SOL_UDP:
+		return setSockOptUDP(t, s, ep, name, optVal)
+
+	case linux.SOL_RAW:
 		// Not supported.
 	}
 
@@ -2082,6 +2440,39 @@ func setSockOptSocket(t *kernel.Task, s socket.Socket, ep commonEndpoint, name i
 		ep.SocketOptions().SetNoChecksum(v != 0)
 		return nil
 
+	case linux.SO_INCOMING_CPU:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+
+		// Linux uses the CPU to pick among sockets bound with
+		// SO_REUSEPORT, but flows are dispatched by their hash here, so
+		// the hint is accepted and ignored.
+		return nil
+
+	case linux.SO_RXQ_OVFL:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+
+		v := hostarch.ByteOrder.Uint32(optVal)
+		ep.SocketOptions().SetReceiveDropCount(v != 0)
+		return nil
+
+	case linux.SO_TIMESTAMPING:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+
+		// Hardware timestamps are accepted but never generated, as if no
+		// NIC supported them.
+		v := hostarch.ByteOrder.Uint32(optVal)
+		if v&^linux.SOF_TIMESTAMPING_MASK != 0 {
+			return syserr.ErrInvalidArgument
+		}
+		ep.SocketOptions().SetTimestamping(tcpip.TimestampingFlags(v))
+		return nil
+
 	case linux.SO_LINGER:
 		if len(optVal) < linux.SizeOfLinger {
 			return syserr.ErrInvalidArgument
@@ -2101,6 +2492,29 @@ func setSockOptSocket(t *kernel.Task, s socket.Socket, ep commonEndpoint, name i
 		var v tcpip.SocketDetachFilterOption
 		return syserr.TranslateNetstackError(ep.SetSockOpt(&v))
 
+	case linux.SO_ATTACH_REUSEPORT_CBPF:
+		family, skType, _ := s.Type()
+		if (family != linux.AF_INET && family != linux.AF_INET6) || (skType != linux.SOCK_STREAM && skType != linux.SOCK_DGRAM) {
+			return syserr.ErrNotSupported
+		}
+		if !ep.SocketOptions().GetReusePort() {
+			return syserr.ErrInvalidArgument
+		}
+		f, err := copyInReusePortCBPF(t, optVal)
+		if err != nil {
+			return err
+		}
+		ep.SocketOptions().SetReusePortFilter(f)
+		return nil
+
+	case linux.SO_DETACH_REUSEPORT_BPF:
+		// optval is ignored.
+		if ep.SocketOptions().GetReusePortFilter() == nil {
+			return syserr.ErrNoFileOrDir
+		}
+		ep.SocketOptions().SetReusePortFilter(nil)
+		return nil
+
 	// TODO(b/226603727): Add support for SO_RCVLOWAT option. For now, only
 	// the unsupported syscall message is removed.
 	case linux.SO_RCVLOWAT:
@@ -2252,6 +2666,22 @@ func setSockOptTCP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int,
 
 		return syserr.TranslateNetstackError(ep.SetSockOptInt(tcpip.TCPWindowClampOption, int(v)))
 
+	case linux.TCP_FASTOPEN:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+		v := int32(hostarch.ByteOrder.Uint32(optVal))
+
+		return syserr.TranslateNetstackError(ep.SetSockOptInt(tcpip.TCPFastOpenOption, int(v)))
+
+	case linux.TCP_FASTOPEN_CONNECT:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+		v := int32(hostarch.ByteOrder.Uint32(optVal))
+
+		return syserr.TranslateNetstackError(ep.SetSockOptInt(tcpip.TCPFastOpenConnectOption, int(v)))
+
 	case linux.TCP_REPAIR_OPTIONS:
 		// Not supported.
 	}
@@ -2259,6 +2689,32 @@ func setSockOptTCP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int,
 	return nil
 }
 
+// setSockOptUDP implements SetSockOpt when level is SOL_UDP.
+func setSockOptUDP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int, optVal []byte) *syserr.Error {
+	if !isUDPSocket(s) {
+		return syserr.ErrProtocolNotAvailable
+	}
+
+	switch name {
+	case linux.UDP_SEGMENT:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+		v := int32(hostarch.ByteOrder.Uint32(optVal))
+
+		return syserr.TranslateNetstackError(ep.SetSockOptInt(tcpip.UDPSegmentOption, int(v)))
+
+	case linux.UDP_GRO:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+		v := hostarch.ByteOrder.Uint32(optVal)
+
+		return syserr.TranslateNetstackError(ep.SetSockOptInt(tcpip.UDPGROOption, int(v)))
+	}
+	return nil
+}
+
 func setSockOptICMPv6(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int, optVal []byte) *syserr.Error {
 	if _, ok := ep.(tcpip.Endpoint); !ok {
 		log.Warningf("SOL_ICMPV6 options not supported on endpoints other than tcpip.Endpoint: option = %d", name)
@@ -2305,6 +2761,18 @@ func setSockOptIPv6(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int
 		// to an int.
 		return syserr.TranslateNetstackError(ep.SetSockOptInt(tcpip.IPv6Checksum, int(int32(hostarch.ByteOrder.Uint32(optVal)))))
 
+	case linux.IPV6_MTU_DISCOVER:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+		return setSockOptMTUDiscover(ep, int32(hostarch.ByteOrder.Uint32(optVal)))
+
+	case linux.IPV6_MTU:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+		return syserr.TranslateNetstackError(ep.SetSockOptInt(tcpip.IPv6MTUOption, int(int32(hostarch.ByteOrder.Uint32(optVal)))))
+
 	case linux.IPV6_V6ONLY:
 		if len(optVal) < sizeOfInt32 {
 			return syserr.ErrInvalidArgument
@@ -2366,6 +2834,14 @@ func setSockOptIPv6(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int
 		ep.SocketOptions().SetReceiveOriginalDstAddress(v != 0)
 		return nil
 
+	case linux.IPV6_TRANSPARENT:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+		v := int32(hostarch.ByteOrder.Uint32(optVal))
+
+		return setTransparent(t, ep, v != 0)
+
 	case linux.IPV6_RECVPKTINFO:
 		if len(optVal) < sizeOfInt32 {
 			return syserr.ErrInvalidArgument
@@ -2513,6 +2989,37 @@ func parseIntOrChar(buf []byte) (int32, *syserr.Error) {
 	return int32(buf[0]), nil
 }
 
+// setTransparent implements setting IP_TRANSPARENT and IPV6_TRANSPARENT.
+// Like Linux, changing the option requires CAP_NET_ADMIN or CAP_NET_RAW.
+func setTransparent(t *kernel.Task, ep commonEndpoint, v bool) *syserr.Error {
+	creds := auth.CredentialsFromContext(t)
+	if !creds.HasCapability(linux.CAP_NET_ADMIN) && !creds.HasCapability(linux.CAP_NET_RAW) {
+		return syserr.ErrNotPermitted
+	}
+	ep.SocketOptions().SetTransparent(v)
+	return nil
+}
+
+// setSockOptMTUDiscover implements SetSockOpt for IP_MTU_DISCOVER and
+// IPV6_MTU_DISCOVER, which share their values.
+func setSockOptMTUDiscover(ep commonEndpoint, v int32) *syserr.Error {
+	switch v {
+	case linux.IP_PMTUDISC_DONT:
+		v = int32(tcpip.PMTUDiscoveryDont)
+	case linux.IP_PMTUDISC_WANT:
+		v = int32(tcpip.PMTUDiscoveryWant)
+	case linux.IP_PMTUDISC_DO:
+		v = int32(tcpip.PMTUDiscoveryDo)
+	case linux.IP_PMTUDISC_PROBE:
+		v = int32(tcpip.PMTUDiscoveryProbe)
+	case linux.IP_PMTUDISC_INTERFACE, linux.IP_PMTUDISC_OMIT:
+		return nil // Noop.
+	default:
+		return syserr.ErrNotSupported
+	}
+	return syserr.TranslateNetstackError(ep.SetSockOptInt(tcpip.MTUDiscoverOption, int(v)))
+}
+
 // setSockOptIP implements SetSockOpt when level is SOL_IP.
 func setSockOptIP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int, optVal []byte) *syserr.Error {
 	if _, ok := ep.(tcpip.Endpoint); !ok {
@@ -2673,6 +3180,17 @@ func setSockOptIP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int,
 		ep.SocketOptions().SetReceiveOriginalDstAddress(v != 0)
 		return nil
 
+	case linux.IP_TRANSPARENT:
+		if len(optVal) == 0 {
+			return nil
+		}
+		v, err := parseIntOrChar(optVal)
+		if err != nil {
+			return err
+		}
+
+		return setTransparent(t, ep, v != 0)
+
 	case linux.IPT_SO_SET_REPLACE:
 		if len(optVal) < linux.SizeOfIPTReplace {
 			return syserr.ErrInvalidArgument
@@ -2702,21 +3220,7 @@ func setSockOptIP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int,
 		if err != nil {
 			return err
 		}
-		switch v {
-		case linux.IP_PMTUDISC_DONT:
-			v = int32(tcpip.PMTUDiscoveryDont)
-		case linux.IP_PMTUDISC_WANT:
-			v = int32(tcpip.PMTUDiscoveryWant)
-		case linux.IP_PMTUDISC_DO:
-			v = int32(tcpip.PMTUDiscoveryDo)
-		case linux.IP_PMTUDISC_PROBE:
-			v = int32(tcpip.PMTUDiscoveryProbe)
-		case linux.IP_PMTUDISC_INTERFACE, linux.IP_PMTUDISC_OMIT:
-			return nil // Noop.
-		default:
-			return syserr.ErrNotSupported
-		}
-		return syserr.TranslateNetstackError(ep.SetSockOptInt(tcpip.MTUDiscoverOption, int(v)))
+		return setSockOptMTUDiscover(ep, v)
 
 	case linux.IP_ADD_SOURCE_MEMBERSHIP,
 		linux.IP_BIND_ADDRESS_NO_PORT,
@@ -2734,7 +3238,6 @@ func setSockOptIP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int,
 		linux.IP_RECVFRAGSIZE,
 		linux.IP_RECVOPTS,
 		linux.IP_RETOPTS,
-		linux.IP_TRANSPARENT,
 		linux.IP_UNBLOCK_SOURCE,
 		linux.IP_UNICAST_IF,
 		linux.IP_XFRM_POLICY,
@@ -2752,20 +3255,45 @@ func setSockOptIP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int,
 
 func setSockOptPacket(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int, optVal []byte) *syserr.Error {
 	switch name {
-	case linux.PACKET_RX_RING:
-		var tpacketReq linux.TpacketReq
-		if len(optVal) < tpacketReq.SizeBytes() {
-			return syserr.ErrInvalidArgument
+	case linux.PACKET_RX_RING, linux.PACKET_TX_RING:
+		version, err := ep.GetSockOptInt(tcpip.PacketMMapVersionOption)
+		if err != nil {
+			return syserr.TranslateNetstackError(err)
 		}
-		tpacketReq.UnmarshalBytes(optVal)
-		req := tcpip.TpacketReq{
-			TpBlockSize: tpacketReq.TpBlockSize,
-			TpBlockNr:   tpacketReq.TpBlockNr,
-			TpFrameSize: tpacketReq.TpFrameSize,
-			TpFrameNr:   tpacketReq.TpFrameNr,
+		var req tcpip.TpacketReq
+		if version == linux.TPACKET_V3 {
+			var tpacketReq linux.TpacketReq3
+			if len(optVal) < tpacketReq.SizeBytes() {
+				return syserr.ErrInvalidArgument
+			}
+			tpacketReq.UnmarshalBytes(optVal)
+			req = tcpip.TpacketReq{
+				TpBlockSize:      tpacketReq.TpBlockSize,
+				TpBlockNr:        tpacketReq.TpBlockNr,
+				TpFrameSize:      tpacketReq.TpFrameSize,
+				TpFrameNr:        tpacketReq.TpFrameNr,
+				TpRetireBlkTov:   tpacketReq.TpRetireBlkTov,
+				TpSizeofPriv:     tpacketReq.TpSizeofPriv,
+				TpFeatureReqWord: tpacketReq.TpFeatureReqWord,
+			}
+		} else {
+			var tpacketReq linux.TpacketReq
+			if len(optVal) < tpacketReq.SizeBytes() {
+				return syserr.ErrInvalidArgument
+			}
+			tpacketReq.UnmarshalBytes(optVal)
+			req = tcpip.TpacketReq{
+				TpBlockSize: tpacketReq.TpBlockSize,
+				TpBlockNr:   tpacketReq.TpBlockNr,
+				TpFrameSize: tpacketReq.TpFrameSize,
+				TpFrameNr:   tpacketReq.TpFrameNr,
+			}
 		}
-		if err := ep.SetSockOpt(&req); err != nil {
-			return syserr.TranslateNetstackError(err)
+		isRx := name == linux.PACKET_RX_RING
+		if isRx {
+			if err := ep.SetSockOpt(&req); err != nil {
+				return syserr.TranslateNetstackError(err)
+			}
 		}
 		if ep, ok := ep.(stack.MappablePacketEndpoint); ok {
 			var pme *packetmmap.Endpoint
@@ -2777,7 +3305,7 @@ func setSockOptPacket(t *kernel.Task, s socket.Socket, ep commonEndpoint, name i
 			} else {
 				pme = &packetmmap.Endpoint{}
 			}
-			opts := ep.GetPacketMMapOpts(&req, true /* isRx */)
+			opts := ep.GetPacketMMapOpts(&req, isRx)
 			if opts.Req.TpFrameNr != 0 || opts.Req.TpBlockNr != 0 {
 				if err := pme.Init(t, opts); err != nil {
 					return syserr.FromError(err)
@@ -2894,15 +3422,8 @@ func (s *sock) nonBlockingRead(ctx context.Context, dst usermem.IOSequence, peek
 		}
 		res, err = s.Endpoint.Read(w, readOptions)
 	} else {
-		switch s.Endpoint.(type) {
-		case *tcp.Endpoint:
-			s.mu.Lock()
-			s.readWriter.Init(ctx, dst)
-			res, err = s.Endpoint.Read(&s.readWriter, readOptions)
-			s.mu.Unlock()
-		default:
-			res, err = s.Endpoint.Read(dst.Writer(ctx), readOptions)
-		}
+		s.recvWriter.Init(ctx, dst)
+		res, err = s.Endpoint.Read(&s.recvWriter, readOptions)
 	}
 
 	if _, ok := err.(*tcpip.ErrBadBuffer); ok && dst.NumBytes() == 0 {
@@ -2966,8 +3487,11 @@ func (s *sock) nonBlockingRead(ctx context.Context, dst usermem.IOSequence, peek
 
 func (s *sock) netstackToLinuxControlMessages(cm tcpip.ReceivableControlMessages) socket.ControlMessages {
 	readCM := socket.NewIPControlMessages(s.family, cm)
+	const rxTimestamping = tcpip.TimestampingRXSoftware | tcpip.TimestampingSoftware
 	return socket.ControlMessages{
 		IP: socket.IPControlMessages{
+			HasTimestamping:    readCM.HasTimestamp && s.Endpoint.SocketOptions().GetTimestamping()&rxTimestamping == rxTimestamping,
+			Timestamping:       readCM.Timestamp,
 			HasTimestamp:       readCM.HasTimestamp && s.sockOptTimestamp,
 			Timestamp:          readCM.Timestamp,
 			HasInq:             readCM.HasInq,
@@ -2986,6 +3510,10 @@ func (s *sock) netstackToLinuxControlMessages(cm tcpip.ReceivableControlMessages
 			IPv6PacketInfo:     readCM.IPv6PacketInfo,
 			OriginalDstAddress: readCM.OriginalDstAddress,
 			SockErr:            readCM.SockErr,
+			HasGROSize:         readCM.HasGROSize,
+			GROSize:            readCM.GROSize,
+			HasDropCount:       readCM.HasDropCount,
+			DropCount:          readCM.DropCount,
 		},
 	}
 }
@@ -2996,6 +3524,8 @@ func (s *sock) linuxToNetstackControlMessages(cm socket.ControlMessages) tcpip.S
 		TTL:         uint8(cm.IP.TTL),
 		HasHopLimit: cm.IP.HasHopLimit,
 		HopLimit:    uint8(cm.IP.HopLimit),
+		HasGSOSize:  cm.IP.HasGSOSize,
+		GSOSize:     cm.IP.GSOSize,
 	}
 }
 
@@ -3060,19 +3590,33 @@ func (s *sock) recvErr(t *kernel.Task, dst usermem.IOSequence) (int, int, linux.
 	}
 	n, err := dst.CopyOut(t, sockErr.Payload.AsSlice())
 
+	cmgs := socket.ControlMessages{IP: socket.NewIPControlMessages(s.family, tcpip.ReceivableControlMessages{SockErr: sockErr})}
+	if sockErr.Cause.Origin() == tcpip.SockExtErrorOriginTimestamping {
+		// Transmit timestamps don't carry an address, and the timestamp
+		// itself is only reported if SOF_TIMESTAMPING_SOFTWARE is set.
+		// See net/socket.c:__sock_recv_timestamp().
+		if s.Endpoint.SocketOptions().GetTimestamping()&tcpip.TimestampingSoftware != 0 {
+			cmgs.IP.HasTimestamping = true
+			cmgs.IP.Timestamping = sockErr.Timestamp
+		}
+		return n, msgFlags, nil, 0, cmgs, syserr.FromError(err)
+	}
+
 	// The original destination address of the datagram that caused the error is
 	// supplied via msg_name.  -- recvmsg(2)
 	dstAddr, dstAddrLen := socket.ConvertAddress(addrFamilyFromNetProto(sockErr.NetProto), sockErr.Dst)
-	cmgs := socket.ControlMessages{IP: socket.NewIPControlMessages(s.family, tcpip.ReceivableControlMessages{SockErr: sockErr})}
 	return n, msgFlags, dstAddr, dstAddrLen, cmgs, syserr.FromError(err)
 }
 
 // RecvMsg implements the linux syscall recvmsg(2) for sockets backed by
 // tcpip.Endpoint.
-func (s *sock) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags int, haveDeadline bool, deadline ktime.Time, senderRequested bool, _ uint64) (n int, msgFlags int, senderAddr linux.SockAddr, senderAddrLen uint32, controlMessages socket.ControlMessages, err *syserr.Error) {
+func (s *sock) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags int, haveDeadline bool, deadline ktime.Time, senderRequested bool, controlDataLen uint64) (n int, msgFlags int, senderAddr linux.SockAddr, senderAddrLen uint32, controlMessages socket.ControlMessages, err *syserr.Error) {
 	if flags&linux.MSG_ERRQUEUE != 0 {
 		return s.recvErr(t, dst)
 	}
+	if s.tls.rxEnabled.Load() {
+		return s.tlsRecvMsg(t, dst, flags, haveDeadline, deadline, controlDataLen)
+	}
 
 	trunc := flags&linux.MSG_TRUNC != 0
 	peek := flags&linux.MSG_PEEK != 0
@@ -3146,6 +3690,9 @@ func (s *sock) SendMsg(t *kernel.Task, src usermem.IOSequence, to []byte, flags
 	if !controlMessages.Unix.Empty() {
 		return 0, syserr.ErrInvalidArgument
 	}
+	if s.tls.txEnabled.Load() {
+		return s.tlsSendMsg(t, src, flags, haveDeadline, deadline, controlMessages)
+	}
 
 	var addr *tcpip.FullAddress
 	if len(to) > 0 {
@@ -3168,6 +3715,16 @@ func (s *sock) SendMsg(t *kernel.Task, src usermem.IOSequence, to []byte, flags
 		ControlMessages: s.linuxToNetstackControlMessages(controlMessages),
 	}
 
+	// Packet sockets with a TX ring send the frames queued in the ring
+	// rather than src, so the number of bytes written is unrelated to the
+	// size of src. See net/packet/af_packet.c:tpacket_snd().
+	if ep, ok := s.Endpoint.(stack.MappablePacketEndpoint); ok {
+		if pme := ep.GetPacketMMapEndpoint(); pme != nil && pme.HasTxRing() {
+			n, err := s.Endpoint.Write(src.Reader(t), opts)
+			return int(n), syserr.TranslateNetstackError(err)
+		}
+	}
+
 	r := src.Reader(t)
 	var (
 		total int64
@@ -3543,9 +4100,12 @@ func interfaceStatusFlags(stack inet.Stack, name string) (uint32, *syserr.Error)
 func nicStateFlagsToLinux(f stack.NICStateFlags) uint32 {
 	var rv uint32
 	if f.Up {
-		rv |= linux.IFF_UP | linux.IFF_LOWER_UP
+		rv |= linux.IFF_UP
+		if !f.NoCarrier {
+			rv |= linux.IFF_LOWER_UP
+		}
 	}
-	if f.Running {
+	if f.Running && !f.NoCarrier {
 		rv |= linux.IFF_RUNNING
 	}
 	if f.Promiscuous {
@@ -3623,6 +4183,11 @@ func (s *sock) Type() (family int, skType linux.SockType, protocol int) {
 	return s.family, s.skType, s.protocol
 }
 
+// NetworkNamespace returns the network namespace the socket was created in.
+func (s *sock) NetworkNamespace() *inet.Namespace {
+	return s.namespace
+}
+
 // EventRegister implements waiter.Waitable.
 func (s *sock) EventRegister(e *waiter.Entry) error {
 	s.Queue.EventRegister(e)
@@ -3647,5 +4212,8 @@ func (s *sock) ConfigureMMap(ctx context.Context, opts *memmap.MMapOpts) error {
 		}
 		return ep.ConfigureMMap(ctx, opts)
 	}
+	if socket.IsTCP(s) {
+		return s.configureZeroCopyMMap(ctx, opts)
+	}
 	return linuxerr.ENODEV
 }
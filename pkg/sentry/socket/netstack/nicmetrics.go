@@ -0,0 +1,164 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netstack
+
+import (
+	"strconv"
+	"sync/atomic"
+
+	"github.com/wilinz/gvisor/pkg/metric"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/network/ipv4"
+	"github.com/wilinz/gvisor/pkg/tcpip/network/ipv6"
+	"github.com/wilinz/gvisor/pkg/tcpip/stack"
+)
+
+// maxNICMetrics is the number of NIC IDs for which per-NIC metrics are
+// exported. Metric field values must be declared before metrics are
+// initialized, long before any NIC exists, so per-NIC metrics are keyed by
+// NIC ID and NICs with larger IDs only show up in the stack-wide totals.
+const maxNICMetrics = 16
+
+// metricsStack is the stack whose NICs are reported by the per-NIC metrics.
+var metricsStack atomic.Pointer[stack.Stack]
+
+// SetMetricsStack makes the per-NIC metrics report the NICs of s. Stack-wide
+// counters are exported through Metrics, which s must be created with.
+func SetMetricsStack(s *stack.Stack) {
+	metricsStack.Store(s)
+}
+
+var (
+	// nicFieldValues holds the values of the "nic" field, indexed by NIC ID
+	// minus one.
+	nicFieldValues = func() []*metric.FieldValue {
+		values := make([]*metric.FieldValue, maxNICMetrics)
+		for i := range values {
+			values[i] = &metric.FieldValue{strconv.Itoa(i + 1)}
+		}
+		return values
+	}()
+	nicField = metric.NewField("nic", nicFieldValues...)
+
+	protocolIPv4  = &metric.FieldValue{"ipv4"}
+	protocolIPv6  = &metric.FieldValue{"ipv6"}
+	protocolField = metric.NewField("protocol", protocolIPv4, protocolIPv6)
+)
+
+// nicFieldValueID returns the NIC ID that v stands for.
+func nicFieldValueID(v *metric.FieldValue) tcpip.NICID {
+	id, err := strconv.Atoi(v.Value)
+	if err != nil {
+		panic(err)
+	}
+	return tcpip.NICID(id)
+}
+
+// protocolFieldValueNumber returns the network protocol number that v stands
+// for.
+func protocolFieldValueNumber(v *metric.FieldValue) tcpip.NetworkProtocolNumber {
+	switch v {
+	case protocolIPv4:
+		return ipv4.ProtocolNumber
+	case protocolIPv6:
+		return ipv6.ProtocolNumber
+	default:
+		panic("unknown protocol field value " + v.Value)
+	}
+}
+
+// mustCreateNICMetric registers a cumulative metric broken down by NIC whose
+// value is read from the NIC's stats by counter. NICs that don't exist report
+// zero.
+func mustCreateNICMetric(name, description string, counter func(*tcpip.NICStats) *tcpip.StatCounter) {
+	metric.MustRegisterCustomUint64Metric(name,
+		metric.Uint64Metadata{
+			Cumulative:  true,
+			Description: description,
+			Fields:      []metric.Field{nicField},
+		}, func(fields ...*metric.FieldValue) uint64 {
+			s := metricsStack.Load()
+			if s == nil {
+				return 0
+			}
+			stats, ok := s.NICStats(nicFieldValueID(fields[0]))
+			if !ok {
+				return 0
+			}
+			return counter(&stats).Value()
+		})
+}
+
+// mustCreateNICIPMetric registers a cumulative metric broken down by NIC and
+// IP version whose value is read from the stats of the NIC's IP endpoint by
+// counter.
+func mustCreateNICIPMetric(name, description string, counter func(*tcpip.IPStats) *tcpip.StatCounter) {
+	metric.MustRegisterCustomUint64Metric(name,
+		metric.Uint64Metadata{
+			Cumulative:  true,
+			Description: description,
+			Fields:      []metric.Field{nicField, protocolField},
+		}, func(fields ...*metric.FieldValue) uint64 {
+			s := metricsStack.Load()
+			if s == nil {
+				return 0
+			}
+			stats, ok := s.NICNetworkEndpointStats(nicFieldValueID(fields[0]), protocolFieldValueNumber(fields[1]))
+			if !ok {
+				return 0
+			}
+			ipStats, ok := stats.(stack.IPNetworkEndpointStats)
+			if !ok {
+				return 0
+			}
+			return counter(ipStats.IPStats()).Value()
+		})
+}
+
+func init() {
+	mustCreateNICMetric("/netstack/per_nic/rx/packets", "Number of packets received, by NIC.",
+		func(s *tcpip.NICStats) *tcpip.StatCounter { return s.Rx.Packets })
+	mustCreateNICMetric("/netstack/per_nic/rx/bytes", "Number of bytes received, by NIC.",
+		func(s *tcpip.NICStats) *tcpip.StatCounter { return s.Rx.Bytes })
+	mustCreateNICMetric("/netstack/per_nic/tx/packets", "Number of packets transmitted, by NIC.",
+		func(s *tcpip.NICStats) *tcpip.StatCounter { return s.Tx.Packets })
+	mustCreateNICMetric("/netstack/per_nic/tx/bytes", "Number of bytes transmitted, by NIC.",
+		func(s *tcpip.NICStats) *tcpip.StatCounter { return s.Tx.Bytes })
+	mustCreateNICMetric("/netstack/per_nic/disabled_rx/packets", "Number of packets received while the NIC was disabled, by NIC.",
+		func(s *tcpip.NICStats) *tcpip.StatCounter { return s.DisabledRx.Packets })
+	mustCreateNICMetric("/netstack/per_nic/tx_packets_dropped_no_buffer_space", "Number of TX packets dropped as a result of no buffer space errors, by NIC.",
+		func(s *tcpip.NICStats) *tcpip.StatCounter { return s.TxPacketsDroppedNoBufferSpace })
+	mustCreateNICMetric("/netstack/per_nic/malformed_l4_received_packets", "Number of packets received that failed L4 header parsing, by NIC.",
+		func(s *tcpip.NICStats) *tcpip.StatCounter { return s.MalformedL4RcvdPackets })
+
+	mustCreateNICIPMetric("/netstack/per_nic/ip/packets_received", "Number of IP packets received from the link layer, by NIC and IP version.",
+		func(s *tcpip.IPStats) *tcpip.StatCounter { return s.PacketsReceived })
+	mustCreateNICIPMetric("/netstack/per_nic/ip/packets_delivered", "Number of IP packets delivered to the transport layer, by NIC and IP version.",
+		func(s *tcpip.IPStats) *tcpip.StatCounter { return s.PacketsDelivered })
+	mustCreateNICIPMetric("/netstack/per_nic/ip/packets_sent", "Number of IP packets sent, by NIC and IP version.",
+		func(s *tcpip.IPStats) *tcpip.StatCounter { return s.PacketsSent })
+	mustCreateNICIPMetric("/netstack/per_nic/ip/outgoing_packet_errors", "Number of IP packets which failed to write to the link layer, by NIC and IP version.",
+		func(s *tcpip.IPStats) *tcpip.StatCounter { return s.OutgoingPacketErrors })
+	mustCreateNICIPMetric("/netstack/per_nic/ip/malformed_packets_received", "Number of IP packets which failed IP header validation checks, by NIC and IP version.",
+		func(s *tcpip.IPStats) *tcpip.StatCounter { return s.MalformedPacketsReceived })
+	mustCreateNICIPMetric("/netstack/per_nic/ip/invalid_addresses_received", "Number of IP packets received with an unknown or invalid destination address, by NIC and IP version.",
+		func(s *tcpip.IPStats) *tcpip.StatCounter { return s.InvalidDestinationAddressesReceived })
+	mustCreateNICIPMetric("/netstack/per_nic/ip/iptables/prerouting_dropped", "Number of IP packets dropped in the Prerouting chain, by NIC and IP version.",
+		func(s *tcpip.IPStats) *tcpip.StatCounter { return s.IPTablesPreroutingDropped })
+	mustCreateNICIPMetric("/netstack/per_nic/ip/iptables/input_dropped", "Number of IP packets dropped in the Input chain, by NIC and IP version.",
+		func(s *tcpip.IPStats) *tcpip.StatCounter { return s.IPTablesInputDropped })
+	mustCreateNICIPMetric("/netstack/per_nic/ip/iptables/output_dropped", "Number of IP packets dropped in the Output chain, by NIC and IP version.",
+		func(s *tcpip.IPStats) *tcpip.StatCounter { return s.IPTablesOutputDropped })
+}
@@ -47,12 +47,24 @@ const (
 	txRingBuffer
 )
 
+// minMacLen is the minimum space reserved for the link header of a received
+// packet.
+const minMacLen = 16
+
 // Endpoint is a memmap.Mappable implementation for stack.PacketMMapEndpoint. It
 // implements the PACKET_MMAP interface as described in
 // https://docs.kernel.org/networking/packet_mmap.html.
 //
 // +stateify savable
 type Endpoint struct {
+	// txMu serializes transmission from the TX ring buffer and protects the
+	// head of txRingBuffer. It is not held by HandlePacket, which may be
+	// called synchronously by the writes of Transmit. The lock order is:
+	//
+	//	txMu
+	//	  mu
+	txMu sync.Mutex `state:"nosave"`
+
 	// mu protects specific fields within ringBuffer in addition to those marked
 	// with checklocks annotations in Endpoint. See the ringBuffer type for more
 	// details. The lock order for the ring buffers is:
@@ -80,6 +92,9 @@ type Endpoint struct {
 
 	received atomicbitops.Uint32
 	dropped  atomicbitops.Uint32
+	// freezes is the number of times a TPACKET_V3 RX ring buffer ran out of
+	// blocks.
+	freezes atomicbitops.Uint32
 
 	stack *stack.Stack
 	wq    *waiter.Queue
@@ -93,6 +108,10 @@ type Endpoint struct {
 // during setsockopt(PACKET_(RX|TX)_RING) with the options retrieved from its
 // corresponding packet socket.
 func (m *Endpoint) Init(ctx context.Context, opts stack.PacketMMapOpts) error {
+	if !opts.IsRx {
+		m.txMu.Lock()
+		defer m.txMu.Unlock()
+	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.stack = opts.Stack
@@ -110,9 +129,16 @@ func (m *Endpoint) Init(ctx context.Context, opts stack.PacketMMapOpts) error {
 		m.headerLen = linux.TPACKET_HDRLEN
 	case linux.TPACKET_V2:
 		m.headerLen = linux.TPACKET2_HDRLEN
+	case linux.TPACKET_V3:
+		m.headerLen = linux.TPACKET3_HDRLEN
 	default:
 		panic(fmt.Sprintf("invalid version %d supplied to InitPacketMMap", m.version))
 	}
+	if m.version == linux.TPACKET_V3 {
+		if err := m.validateV3Req(opts.Req, opts.IsRx); err != nil {
+			return err
+		}
+	}
 	if opts.Req.TpBlockNr != 0 {
 		if opts.Req.TpBlockSize <= 0 {
 			return linuxerr.EINVAL
@@ -140,12 +166,12 @@ func (m *Endpoint) Init(ctx context.Context, opts stack.PacketMMapOpts) error {
 		return linuxerr.EINVAL
 	}
 	if opts.IsRx {
-		if err := m.rxRingBuffer.init(ctx, opts.Req); err != nil {
+		if err := m.rxRingBuffer.init(ctx, opts.Req, m.version); err != nil {
 			return err
 		}
 		m.mode |= rxRingBuffer
 	} else {
-		if err := m.txRingBuffer.init(ctx, opts.Req); err != nil {
+		if err := m.txRingBuffer.init(ctx, opts.Req, m.version); err != nil {
 			return err
 		}
 		m.mode |= txRingBuffer
@@ -158,11 +184,13 @@ func (m *Endpoint) Close() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	if m.mode&rxRingBuffer != 0 {
+		m.rxRingBuffer.stopRetireTimer()
 		m.rxRingBuffer.destroy()
 	}
 	if m.mode&txRingBuffer != 0 {
 		m.txRingBuffer.destroy()
 	}
+	m.mode = 0
 	m.mapped.Store(0)
 }
 
@@ -172,7 +200,15 @@ func (m *Endpoint) Readiness(mask waiter.EventMask) waiter.EventMask {
 	defer m.mu.Unlock()
 	result := waiter.WritableEvents & mask
 	if m.mode&rxRingBuffer != 0 {
-		st, err := m.rxRingBuffer.prevFrameStatus()
+		var (
+			st  uint32
+			err error
+		)
+		if m.version == linux.TPACKET_V3 {
+			st, err = m.rxRingBuffer.prevBlockStatus()
+		} else {
+			st, err = m.rxRingBuffer.prevFrameStatus()
+		}
 		if err != nil {
 			return result
 		}
@@ -185,52 +221,37 @@ func (m *Endpoint) Readiness(mask waiter.EventMask) waiter.EventMask {
 
 // HandlePacket implements stack.PacketMMapEndpoint.HandlePacket.
 func (m *Endpoint) HandlePacket(nicID tcpip.NICID, netProto tcpip.NetworkProtocolNumber, pkt *stack.PacketBuffer) {
-	const minMacLen = 16
 	var (
-		status                           = uint32(linux.TP_STATUS_USER)
 		macOffset, netOffset, dataLength uint32
 		clone                            *stack.PacketBuffer
 	)
 
 	m.mu.Lock()
+	if m.mode&rxRingBuffer == 0 {
+		// Only a TX ring buffer is set up, so packets are received through
+		// the packet endpoint's receive queue.
+		m.mu.Unlock()
+		m.packetEP.HandlePacketMMapCopy(nicID, netProto, pkt)
+		m.wq.Notify(waiter.ReadableEvents)
+		return
+	}
+	if m.version == linux.TPACKET_V3 {
+		m.mu.Unlock()
+		m.handlePacketV3(pkt)
+		return
+	}
 	cooked := m.cooked
 	if !m.rxRingBuffer.hasRoom() {
 		m.mu.Unlock()
-		m.stack.Stats().DroppedPackets.Increment()
-		m.dropped.Add(1)
+		m.dropPacket()
 		return
 	}
 	m.mu.Unlock()
 
-	if pkt.GSOOptions.Type != stack.GSONone && pkt.GSOOptions.NeedsCsum {
-		status |= linux.TP_STATUS_CSUM_NOT_READY
-	}
-	if pkt.GSOOptions.Type == stack.GSOTCPv4 || pkt.GSOOptions.Type == stack.GSOTCPv6 {
-		status |= linux.TP_STATUS_GSO_TCP
-	}
-
-	pktBuf := pkt.ToBuffer()
-	if cooked {
-		pktBuf.TrimFront(int64(len(pkt.LinkHeader().Slice()) + len(pkt.VirtioNetHeader().Slice())))
-		// Cooked packet endpoints don't include the link-headers in received
-		// packets.
-		netOffset = linux.TPacketAlign(m.headerLen+minMacLen) + m.reserve
-		macOffset = netOffset
-	} else {
-		virtioNetHdrLen := uint32(len(pkt.VirtioNetHeader().Slice()))
-		macLen := uint32(len(pkt.LinkHeader().Slice())) + virtioNetHdrLen
-		netOffset = linux.TPacketAlign(m.headerLen+macLen) + m.reserve
-		if macLen < minMacLen {
-			netOffset = linux.TPacketAlign(m.headerLen+minMacLen) + m.reserve
-		}
-		if virtioNetHdrLen > 0 {
-			netOffset += virtioNetHdrLen
-		}
-		macOffset = netOffset - macLen
-	}
-	if netOffset > uint32(^uint16(0)) {
-		m.stack.Stats().DroppedPackets.Increment()
-		m.dropped.Add(1)
+	status := packetStatus(pkt)
+	pktBuf, macOffset, netOffset, ok := m.frameOffsets(pkt, cooked)
+	if !ok {
+		m.dropPacket()
 		return
 	}
 	dataLength = uint32(pktBuf.Size())
@@ -250,16 +271,14 @@ func (m *Endpoint) HandlePacket(nicID tcpip.NICID, netProto tcpip.NetworkProtoco
 	tpStatus, err := m.rxRingBuffer.currFrameStatus()
 	if err != nil || tpStatus != linux.TP_STATUS_KERNEL {
 		m.mu.Unlock()
-		m.stack.Stats().DroppedPackets.Increment()
-		m.dropped.Add(1)
+		m.dropPacket()
 		return
 	}
 
 	slot, ok := m.rxRingBuffer.testAndMarkHead()
 	if !ok {
 		m.mu.Unlock()
-		m.stack.Stats().DroppedPackets.Increment()
-		m.dropped.Add(1)
+		m.dropPacket()
 		return
 	}
 	m.rxRingBuffer.incHead()
@@ -278,22 +297,68 @@ func (m *Endpoint) HandlePacket(nicID tcpip.NICID, netProto tcpip.NetworkProtoco
 	m.marshalSockAddr(pkt, hdrView)
 
 	if err := m.rxRingBuffer.writeFrame(slot, hdrView, pktBuf); err != nil {
-		m.stack.Stats().DroppedPackets.Increment()
-		m.dropped.Add(1)
+		m.dropPacket()
 		return
 	}
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	if err := m.rxRingBuffer.writeStatus(slot, status); err != nil {
-		m.stack.Stats().DroppedPackets.Increment()
-		m.dropped.Add(1)
+		m.dropPacket()
 		return
 	}
 	m.received.Add(1)
 	m.wq.Notify(waiter.ReadableEvents)
 }
 
+// dropPacket records that a received packet was dropped.
+func (m *Endpoint) dropPacket() {
+	m.stack.Stats().DroppedPackets.Increment()
+	m.dropped.Add(1)
+}
+
+// packetStatus returns the status flags of a frame containing pkt.
+func packetStatus(pkt *stack.PacketBuffer) uint32 {
+	status := uint32(linux.TP_STATUS_USER)
+	if pkt.GSOOptions.Type != stack.GSONone && pkt.GSOOptions.NeedsCsum {
+		status |= linux.TP_STATUS_CSUM_NOT_READY
+	}
+	if pkt.GSOOptions.Type == stack.GSOTCPv4 || pkt.GSOOptions.Type == stack.GSOTCPv6 {
+		status |= linux.TP_STATUS_GSO_TCP
+	}
+	return status
+}
+
+// frameOffsets returns the data of pkt to be copied to a frame, and the
+// offsets of its link and network headers from the start of the frame. ok is
+// false if the headers don't fit in a frame header.
+func (m *Endpoint) frameOffsets(pkt *stack.PacketBuffer, cooked bool) (pktBuf buffer.Buffer, macOffset, netOffset uint32, ok bool) {
+	pktBuf = pkt.ToBuffer()
+	if cooked {
+		pktBuf.TrimFront(int64(len(pkt.LinkHeader().Slice()) + len(pkt.VirtioNetHeader().Slice())))
+		// Cooked packet endpoints don't include the link-headers in received
+		// packets.
+		netOffset = linux.TPacketAlign(m.headerLen+minMacLen) + m.reserve
+		macOffset = netOffset
+	} else {
+		virtioNetHdrLen := uint32(len(pkt.VirtioNetHeader().Slice()))
+		macLen := uint32(len(pkt.LinkHeader().Slice())) + virtioNetHdrLen
+		netOffset = linux.TPacketAlign(m.headerLen+macLen) + m.reserve
+		if macLen < minMacLen {
+			netOffset = linux.TPacketAlign(m.headerLen+minMacLen) + m.reserve
+		}
+		if virtioNetHdrLen > 0 {
+			netOffset += virtioNetHdrLen
+		}
+		macOffset = netOffset - macLen
+	}
+	if netOffset > uint32(^uint16(0)) {
+		pktBuf.Release()
+		return buffer.Buffer{}, 0, 0, false
+	}
+	return pktBuf, macOffset, netOffset, true
+}
+
 // AddMapping implements memmap.Mappable.AddMapping.
 func (m *Endpoint) AddMapping(ctx context.Context, ms memmap.MappingSpace, ar hostarch.AddrRange, offset uint64, writable bool) error {
 	m.mappingsMu.Lock()
@@ -385,8 +450,9 @@ func (m *Endpoint) Stats() tcpip.TpacketStats {
 	rcv := m.received.Swap(0)
 	drop := m.dropped.Swap(0)
 	return tcpip.TpacketStats{
-		Packets: uint32(rcv + drop),
-		Dropped: uint32(drop),
+		Packets:          uint32(rcv + drop),
+		Dropped:          uint32(drop),
+		FreezeQueueCount: m.freezes.Swap(0),
 	}
 }
 
@@ -419,13 +485,19 @@ func (m *Endpoint) marshalSockAddr(pkt *stack.PacketBuffer, view *buffer.View) {
 		hdr := header.Ethernet(pkt.LinkHeader().Slice())
 		copy(sll.HardwareAddr[:], hdr.SourceAddress())
 	}
-	var hdrSize uint32
-	if m.version == linux.TPACKET_V2 {
-		hdrSize = uint32((*linux.Tpacket2Hdr)(nil).SizeBytes())
-	} else {
-		hdrSize = uint32((*linux.TpacketHdr)(nil).SizeBytes())
+	sll.MarshalBytes(view.AsSlice()[linux.TPacketAlign(m.frameHeaderSize()):])
+}
+
+// frameHeaderSize returns the size of the frame header for m.version.
+func (m *Endpoint) frameHeaderSize() uint32 {
+	switch m.version {
+	case linux.TPACKET_V2:
+		return uint32((*linux.Tpacket2Hdr)(nil).SizeBytes())
+	case linux.TPACKET_V3:
+		return uint32((*linux.Tpacket3Hdr)(nil).SizeBytes())
+	default:
+		return uint32((*linux.TpacketHdr)(nil).SizeBytes())
 	}
-	sll.MarshalBytes(view.AsSlice()[linux.TPacketAlign(hdrSize):])
 }
 
 func (m *Endpoint) marshalFrameHeader(pktBuf buffer.Buffer, macOffset, netOffset, dataLength uint32, view *buffer.View) {
@@ -17,6 +17,7 @@ package packetmmap
 import (
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/wilinz/gvisor/pkg/abi/linux"
 	"github.com/wilinz/gvisor/pkg/bitmap"
@@ -40,10 +41,26 @@ type ringBuffer struct {
 	numBlocks      uint32
 	version        int
 
-	// The following fields are protected by the owning endpoint's mutex.
+	// The following fields are protected by the owning endpoint's mutex, or
+	// by its txMu for the TX ring buffer. For TPACKET_V3 RX ring buffers,
+	// head is the index of the current block rather than frame.
 	head       uint32
 	rxOwnerMap bitmap.Bitmap
 
+	// The following fields are only used by TPACKET_V3 RX ring buffers, and
+	// are protected by the owning endpoint's mutex. See tpacket_v3.go.
+	sizeofPriv    uint32
+	retireTimeout time.Duration
+	blockOpen     bool
+	blockFrozen   bool
+	blockNumPkts  uint32
+	blockLen      uint32
+	blockSeqNum   uint64
+	prevPktOffset uint32
+	firstPktTime  int64
+	lastPktTime   int64
+	retireTimer   tcpip.Timer `state:"nosave"`
+
 	dataMu sync.RWMutex `state:"nosave"`
 	// +checklocks:dataMu
 	size uint64
@@ -58,12 +75,18 @@ type ringBuffer struct {
 // init initializes a PacketRingBuffer.
 //
 // The owning endpoint must be locked when calling this function.
-func (rb *ringBuffer) init(ctx context.Context, req *tcpip.TpacketReq) error {
+func (rb *ringBuffer) init(ctx context.Context, req *tcpip.TpacketReq, version int) error {
 	rb.blockSize = req.TpBlockSize
 	rb.framesPerBlock = req.TpBlockSize / req.TpFrameSize
 	rb.frameMax = req.TpFrameNr - 1
 	rb.frameSize = req.TpFrameSize
 	rb.numBlocks = req.TpBlockNr
+	rb.version = version
+	rb.sizeofPriv = req.TpSizeofPriv
+	rb.retireTimeout = time.Duration(req.TpRetireBlkTov) * time.Millisecond
+	if rb.retireTimeout == 0 {
+		rb.retireTimeout = defaultRetireBlockTimeout
+	}
 
 	rb.rxOwnerMap = bitmap.New(req.TpFrameNr)
 	rb.head = 0
@@ -226,17 +249,79 @@ func (rb *ringBuffer) bufferSize() uint64 {
 }
 
 func (rb *ringBuffer) internalMappingsForFrame(frameNum uint32, at hostarch.AccessType) (safemem.BlockSeq, error) {
-	rb.dataMu.RLock()
-	defer rb.dataMu.RUnlock()
+	return rb.internalMappings(rb.frameOffset(frameNum), uint64(rb.frameSize), at)
+}
 
+// frameOffset returns the offset of a frame from the start of the ring buffer.
+func (rb *ringBuffer) frameOffset(frameNum uint32) uint64 {
 	blockIdx := uint32(frameNum / rb.framesPerBlock)
 	frameIdx := uint32(frameNum % rb.framesPerBlock)
+	return uint64(blockIdx)*uint64(rb.blockSize) + uint64(frameIdx)*uint64(rb.frameSize)
+}
 
-	frameStart := rb.data.Start + (uint64(blockIdx) * uint64(rb.blockSize)) + (uint64(frameIdx) * uint64(rb.frameSize))
-	frameEnd := frameStart + uint64(rb.frameSize)
+// blockOffset returns the offset of a block from the start of the ring buffer.
+func (rb *ringBuffer) blockOffset(blockNum uint32) uint64 {
+	return uint64(blockNum) * uint64(rb.blockSize)
+}
 
-	frameFR := memmap.FileRange{Start: frameStart, End: frameEnd}
-	return rb.mf.MapInternal(frameFR, at)
+// internalMappings returns the internal mappings of the length bytes at
+// offset off in the ring buffer.
+func (rb *ringBuffer) internalMappings(off, length uint64, at hostarch.AccessType) (safemem.BlockSeq, error) {
+	rb.dataMu.RLock()
+	defer rb.dataMu.RUnlock()
+	fr := memmap.FileRange{Start: rb.data.Start + off, End: rb.data.Start + off + length}
+	return rb.mf.MapInternal(fr, at)
+}
+
+// loadUint32 atomically loads the uint32 at offset off in the ring buffer.
+func (rb *ringBuffer) loadUint32(off uint64) (uint32, error) {
+	ims, err := rb.internalMappings(off, 4, hostarch.Read)
+	if err != nil {
+		return 0, err
+	}
+	return safemem.LoadUint32(ims.Head())
+}
+
+// storeUint32 atomically stores v to the uint32 at offset off in the ring
+// buffer.
+func (rb *ringBuffer) storeUint32(off uint64, v uint32) error {
+	ims, err := rb.internalMappings(off, 4, hostarch.Write)
+	if err != nil {
+		return err
+	}
+	_, err = safemem.SwapUint32(ims.Head(), v)
+	return err
+}
+
+// writeAt writes hdr followed by data at offset off in the ring buffer.
+func (rb *ringBuffer) writeAt(off uint64, hdr []byte, data buffer.Buffer) error {
+	ims, err := rb.internalMappings(off, uint64(len(hdr))+uint64(data.Size()), hostarch.Write)
+	if err != nil {
+		return err
+	}
+	n, err := safemem.CopySeq(ims, safemem.BlockSeqOf(safemem.BlockFromSafeSlice(hdr)))
+	if err != nil {
+		return err
+	}
+	br := data.AsBufferReader()
+	defer br.Close()
+	rdr := safemem.FromIOReader{Reader: &br}
+	_, err = rdr.ReadToBlocks(ims.DropFirst64(n))
+	return err
+}
+
+// readAt returns a copy of the length bytes at offset off in the ring buffer.
+func (rb *ringBuffer) readAt(off uint64, length uint32) (buffer.Buffer, error) {
+	ims, err := rb.internalMappings(off, uint64(length), hostarch.Read)
+	if err != nil {
+		return buffer.Buffer{}, err
+	}
+	v := buffer.NewViewSize(int(length))
+	if _, err := safemem.CopySeq(safemem.BlockSeqOf(safemem.BlockFromSafeSlice(v.AsSlice())), ims); err != nil {
+		v.Release()
+		return buffer.Buffer{}, err
+	}
+	return buffer.MakeWithView(v), nil
 }
 
 func (rb *ringBuffer) frameStatus(frameNum uint32) (uint32, error) {
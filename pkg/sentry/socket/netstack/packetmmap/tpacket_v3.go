@@ -0,0 +1,250 @@
+// Copyright 2025 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package packetmmap
+
+import (
+	"time"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/buffer"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/stack"
+	"github.com/wilinz/gvisor/pkg/waiter"
+)
+
+// TPACKET_V3 RX ring buffers don't have fixed size frames. Received packets
+// are instead packed into the current block, which is handed to the
+// application when it is full or when its retire timeout expires. Each block
+// starts with a struct tpacket_block_desc, followed by sizeof_priv bytes of
+// private space for the application, followed by the packets.
+//
+// See net/packet/af_packet.c:tpacket_rcv() and prb_*() in Linux.
+
+const (
+	// v3Alignment is the alignment of packets in a block, V3_ALIGNMENT in
+	// Linux.
+	v3Alignment = 8
+
+	// defaultRetireBlockTimeout is the retire timeout of blocks if the
+	// application doesn't set one. Linux computes it from the link speed of
+	// the bound interface, and uses 8ms if it is unknown.
+	defaultRetireBlockTimeout = 8 * time.Millisecond
+
+	// Offsets of fields in struct tpacket_block_desc and struct tpacket3_hdr.
+	blockStatusOffset  = 8
+	v3NextOffsetOffset = 0
+)
+
+// blockHeaderLen is the length of a block descriptor, BLK_HDR_LEN in Linux.
+var blockHeaderLen = alignV3(uint32((*linux.TpacketBlockDesc)(nil).SizeBytes()))
+
+func alignV3(x uint32) uint32 {
+	return (x + v3Alignment - 1) &^ (v3Alignment - 1)
+}
+
+// firstPacketOffset returns the offset of the first packet in a block,
+// BLK_PLUS_PRIV in Linux.
+func (rb *ringBuffer) firstPacketOffset() uint32 {
+	return blockHeaderLen + alignV3(rb.sizeofPriv)
+}
+
+// validateV3Req checks a request for a TPACKET_V3 ring buffer, in addition to
+// the checks made for all versions. See
+// net/packet/af_packet.c:packet_set_ring().
+func (m *Endpoint) validateV3Req(req *tcpip.TpacketReq, isRx bool) error {
+	if req.TpBlockNr == 0 {
+		return nil
+	}
+	if !isRx {
+		// TX ring buffers use frames like TPACKET_V2.
+		if req.TpRetireBlkTov != 0 || req.TpSizeofPriv != 0 || req.TpFeatureReqWord != 0 {
+			return linuxerr.EINVAL
+		}
+		return nil
+	}
+	if uint64(req.TpBlockSize) < uint64(blockHeaderLen)+uint64(alignV3(req.TpSizeofPriv))+uint64(m.headerLen+m.reserve) {
+		return linuxerr.EINVAL
+	}
+	return nil
+}
+
+// prevBlockStatus returns the status of the block before the current block.
+//
+// The owning endpoint must be locked when calling this method.
+func (rb *ringBuffer) prevBlockStatus() (uint32, error) {
+	prev := rb.head - 1
+	if rb.head == 0 {
+		prev = rb.numBlocks - 1
+	}
+	return rb.loadUint32(rb.blockOffset(prev) + blockStatusOffset)
+}
+
+// handlePacketV3 copies pkt to the current block of a TPACKET_V3 RX ring
+// buffer.
+func (m *Endpoint) handlePacketV3(pkt *stack.PacketBuffer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rb := &m.rxRingBuffer
+
+	status := packetStatus(pkt)
+	pktBuf, macOffset, netOffset, ok := m.frameOffsets(pkt, m.cooked)
+	if !ok {
+		m.dropPacket()
+		return
+	}
+	defer pktBuf.Release()
+	length := uint32(pktBuf.Size())
+
+	// Like Linux, truncate packets that don't fit in a block.
+	maxLen := rb.blockSize - rb.firstPacketOffset()
+	if macOffset >= maxLen {
+		m.dropPacket()
+		return
+	}
+	snaplen := length
+	if macOffset+snaplen > maxLen {
+		snaplen = maxLen - macOffset
+	}
+	totalLen := alignV3(macOffset + snaplen)
+
+	now := m.stack.Clock().Now()
+	if rb.blockOpen && rb.blockLen+totalLen > rb.blockSize {
+		m.closeBlockLocked(false /* timedOut */)
+	}
+	if !rb.blockOpen && !m.openBlockLocked(now) {
+		m.dropPacket()
+		return
+	}
+
+	hdrView := buffer.NewViewSize(int(macOffset))
+	defer hdrView.Release()
+	hdr := linux.Tpacket3Hdr{
+		TpNextOffset: totalLen,
+		TpSec:        uint32(now.Unix()),
+		TpNSec:       uint32(now.UnixNano() % 1e9),
+		TpSnaplen:    snaplen,
+		TpLen:        length,
+		TpStatus:     status,
+		TpMac:        uint16(macOffset),
+		TpNet:        uint16(netOffset),
+	}
+	hdr.MarshalBytes(hdrView.AsSlice())
+	m.marshalSockAddr(pkt, hdrView)
+	pktBuf.Truncate(int64(snaplen))
+
+	if err := rb.writeAt(rb.blockOffset(rb.head)+uint64(rb.blockLen), hdrView.AsSlice(), pktBuf); err != nil {
+		m.dropPacket()
+		return
+	}
+	rb.prevPktOffset = rb.blockLen
+	rb.blockLen += totalLen
+	rb.blockNumPkts++
+	rb.lastPktTime = now.UnixNano()
+	m.received.Add(1)
+}
+
+// openBlockLocked starts filling the current block, if the application has
+// released it. Otherwise, the ring buffer is frozen until it does, and all
+// received packets are dropped.
+//
+// Preconditions: m.mu must be locked.
+func (m *Endpoint) openBlockLocked(now time.Time) bool {
+	rb := &m.rxRingBuffer
+	status, err := rb.loadUint32(rb.blockOffset(rb.head) + blockStatusOffset)
+	if err != nil || status != linux.TP_STATUS_KERNEL {
+		if !rb.blockFrozen {
+			rb.blockFrozen = true
+			m.freezes.Add(1)
+		}
+		return false
+	}
+	rb.blockFrozen = false
+	rb.blockOpen = true
+	rb.blockNumPkts = 0
+	rb.blockLen = rb.firstPacketOffset()
+	rb.firstPktTime = now.UnixNano()
+	rb.lastPktTime = rb.firstPktTime
+
+	// Retire the block if it isn't filled before the timeout.
+	seq := rb.blockSeqNum
+	rb.stopRetireTimer()
+	rb.retireTimer = m.stack.Clock().AfterFunc(rb.retireTimeout, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.mode&rxRingBuffer != 0 && rb.blockOpen && rb.blockSeqNum == seq {
+			m.closeBlockLocked(true /* timedOut */)
+		}
+	})
+	return true
+}
+
+// closeBlockLocked hands the current block to the application and moves to
+// the next block.
+//
+// Preconditions: m.mu must be locked. The current block must be open.
+func (m *Endpoint) closeBlockLocked(timedOut bool) {
+	rb := &m.rxRingBuffer
+	blockOff := rb.blockOffset(rb.head)
+	if rb.blockNumPkts > 0 {
+		// The last packet in the block has no next packet.
+		_ = rb.storeUint32(blockOff+uint64(rb.prevPktOffset)+v3NextOffsetOffset, 0)
+	}
+	first := time.Unix(0, rb.firstPktTime)
+	last := time.Unix(0, rb.lastPktTime)
+	desc := linux.TpacketBlockDesc{
+		Version:          linux.TPACKET_V3,
+		OffsetToPriv:     blockHeaderLen,
+		BlockStatus:      linux.TP_STATUS_KERNEL,
+		NumPkts:          rb.blockNumPkts,
+		OffsetToFirstPkt: rb.firstPacketOffset(),
+		BlkLen:           rb.blockLen,
+		SeqNum:           rb.blockSeqNum,
+		TsFirstPktSec:    uint32(first.Unix()),
+		TsFirstPktNSec:   uint32(first.UnixNano() % 1e9),
+		TsLastPktSec:     uint32(last.Unix()),
+		TsLastPktNSec:    uint32(last.UnixNano() % 1e9),
+	}
+	descBuf := make([]byte, desc.SizeBytes())
+	desc.MarshalBytes(descBuf)
+	// The status is set separately to ensure the block is written before
+	// the application sees it.
+	status := uint32(linux.TP_STATUS_USER)
+	if timedOut {
+		status |= linux.TP_STATUS_BLK_TMO
+	}
+	if err := rb.writeAt(blockOff, descBuf, buffer.Buffer{}); err == nil {
+		_ = rb.storeUint32(blockOff+blockStatusOffset, status)
+	}
+
+	rb.stopRetireTimer()
+	rb.blockOpen = false
+	rb.blockSeqNum++
+	rb.head++
+	if rb.head == rb.numBlocks {
+		rb.head = 0
+	}
+	m.wq.Notify(waiter.ReadableEvents)
+}
+
+// stopRetireTimer stops the retire timer of the current block, if any.
+//
+// The owning endpoint must be locked when calling this method.
+func (rb *ringBuffer) stopRetireTimer() {
+	if rb.retireTimer != nil {
+		rb.retireTimer.Stop()
+		rb.retireTimer = nil
+	}
+}
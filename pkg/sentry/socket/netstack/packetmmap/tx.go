@@ -0,0 +1,116 @@
+// Copyright 2025 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package packetmmap
+
+import (
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/buffer"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/waiter"
+)
+
+// HasTxRing implements stack.PacketMMapEndpoint.HasTxRing.
+func (m *Endpoint) HasTxRing() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mode&txRingBuffer != 0
+}
+
+// txFrameLayout returns the offsets of the status and length fields of the
+// frame header, and of the packet data, in frames of the TX ring buffer.
+//
+// Like Linux without PACKET_TX_HAS_OFF, the packet data always immediately
+// follows the frame header, and the frame's tp_mac and tp_net are ignored.
+func (m *Endpoint) txFrameLayout() (statusOff, lenOff, dataOff uint64) {
+	dataOff = uint64(linux.TPacketAlign(m.frameHeaderSize()))
+	switch m.version {
+	case linux.TPACKET_V1:
+		// tp_status is an unsigned long, followed by tp_len.
+		return 0, 8, dataOff
+	case linux.TPACKET_V2:
+		return 0, 4, dataOff
+	default:
+		// tp_status follows tp_next_offset, tp_sec, tp_nsec, tp_snaplen
+		// and tp_len.
+		return 20, 16, dataOff
+	}
+}
+
+// Transmit implements stack.PacketMMapEndpoint.Transmit.
+//
+// Frames are sent in ring order starting at the head of the TX ring buffer,
+// until a frame that the application hasn't marked TP_STATUS_SEND_REQUEST.
+// Sent frames are marked TP_STATUS_AVAILABLE. If a frame can't be sent, it is
+// marked TP_STATUS_WRONG_FORMAT and the error is returned; the head isn't
+// advanced past it, so the application must fix or release the frame. See
+// net/packet/af_packet.c:tpacket_snd().
+func (m *Endpoint) Transmit(write func(payload buffer.Buffer) tcpip.Error) (int64, tcpip.Error) {
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+
+	m.mu.Lock()
+	hasTxRing := m.mode&txRingBuffer != 0
+	statusOff, lenOff, dataOff := m.txFrameLayout()
+	m.mu.Unlock()
+	if !hasTxRing {
+		return 0, &tcpip.ErrInvalidOptionValue{}
+	}
+
+	// m.mu isn't held while sending, since writes may deliver packets to
+	// this endpoint synchronously. The TX ring buffer can't be replaced
+	// concurrently since Init holds txMu, and Close is only called once the
+	// socket is released.
+	rb := &m.txRingBuffer
+	var total int64
+	for i := uint32(0); i <= rb.frameMax; i++ {
+		frameOff := rb.frameOffset(rb.head)
+		status, err := rb.loadUint32(frameOff + statusOff)
+		if err != nil {
+			return total, &tcpip.ErrBadBuffer{}
+		}
+		if status != linux.TP_STATUS_SEND_REQUEST {
+			break
+		}
+		length, err := rb.loadUint32(frameOff + lenOff)
+		if err != nil {
+			return total, &tcpip.ErrBadBuffer{}
+		}
+		if length == 0 || uint64(length) > uint64(rb.frameSize)-dataOff {
+			_ = rb.storeUint32(frameOff+statusOff, linux.TP_STATUS_WRONG_FORMAT)
+			return total, &tcpip.ErrInvalidOptionValue{}
+		}
+		if err := rb.storeUint32(frameOff+statusOff, linux.TP_STATUS_SENDING); err != nil {
+			return total, &tcpip.ErrBadBuffer{}
+		}
+		payload, err := rb.readAt(frameOff+dataOff, length)
+		if err != nil {
+			_ = rb.storeUint32(frameOff+statusOff, linux.TP_STATUS_WRONG_FORMAT)
+			return total, &tcpip.ErrBadBuffer{}
+		}
+		if err := write(payload); err != nil {
+			_ = rb.storeUint32(frameOff+statusOff, linux.TP_STATUS_WRONG_FORMAT)
+			return total, err
+		}
+		if err := rb.storeUint32(frameOff+statusOff, linux.TP_STATUS_AVAILABLE); err != nil {
+			return total, &tcpip.ErrBadBuffer{}
+		}
+		rb.incHead()
+		total += int64(length)
+	}
+	if total > 0 {
+		m.wq.Notify(waiter.WritableEvents)
+	}
+	return total, nil
+}
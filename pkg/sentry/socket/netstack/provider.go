@@ -30,6 +30,7 @@ import (
 	"github.com/wilinz/gvisor/pkg/tcpip/header"
 	"github.com/wilinz/gvisor/pkg/tcpip/network/ipv4"
 	"github.com/wilinz/gvisor/pkg/tcpip/network/ipv6"
+	"github.com/wilinz/gvisor/pkg/tcpip/transport/mptcp"
 	"github.com/wilinz/gvisor/pkg/tcpip/transport/tcp"
 	"github.com/wilinz/gvisor/pkg/tcpip/transport/udp"
 	"github.com/wilinz/gvisor/pkg/waiter"
@@ -44,16 +45,19 @@ type provider struct {
 var rawMissingLogger = log.BasicRateLimitedLogger(time.Minute)
 
 // getTransportProtocol figures out transport protocol. Currently only TCP,
-// UDP, and ICMP are supported. The bool return value is true when this socket
+// MPTCP, UDP, and ICMP are supported. The bool return value is true when this socket
 // is associated with a transport protocol. This is only false for SOCK_RAW,
 // IPPROTO_IP sockets.
 func getTransportProtocol(ctx context.Context, stype linux.SockType, protocol int) (tcpip.TransportProtocolNumber, bool, *syserr.Error) {
 	switch stype {
 	case linux.SOCK_STREAM:
-		if protocol != 0 && protocol != unix.IPPROTO_TCP {
-			return 0, true, syserr.ErrInvalidArgument
+		switch protocol {
+		case 0, unix.IPPROTO_TCP:
+			return tcp.ProtocolNumber, true, nil
+		case linux.IPPROTO_MPTCP:
+			return mptcp.ProtocolNumber, true, nil
 		}
-		return tcp.ProtocolNumber, true, nil
+		return 0, true, syserr.ErrInvalidArgument
 
 	case linux.SOCK_DGRAM:
 		switch protocol {
@@ -118,6 +122,11 @@ func (p *provider) Socket(t *kernel.Task, stype linux.SockType, protocol int) (*
 	if err != nil {
 		return nil, err
 	}
+	// MPTCP is optional; like Linux, fail with EPROTONOSUPPORT if the
+	// stack doesn't support it.
+	if transProto == mptcp.ProtocolNumber && eps.Stack.TransportProtocolInstance(transProto) == nil {
+		return nil, syserr.ErrProtocolNotSupported
+	}
 
 	// Create the endpoint.
 	var ep tcpip.Endpoint
@@ -0,0 +1,525 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netstack
+
+import (
+	"sort"
+	"time"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/log"
+	"github.com/wilinz/gvisor/pkg/sentry/inet"
+	"github.com/wilinz/gvisor/pkg/sentry/socket/netlink/nlmsg"
+	"github.com/wilinz/gvisor/pkg/syserr"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/header"
+	"github.com/wilinz/gvisor/pkg/tcpip/link/qdisc/tc"
+	"github.com/wilinz/gvisor/pkg/tcpip/stack"
+)
+
+// Queueing disciplines are installed on NICs as a tc.Root driving a tree of
+// tc.Qdiscs, which can't be modified once installed. Netlink requests are
+// applied to a qdiscSpec describing the tree, from which a new tree is built
+// and installed. This drops the packets queued by the previous tree, so
+// changing a queueing discipline drops its queue, unlike on Linux.
+//
+// Only queueing disciplines on the egress path are supported: there is no
+// ingress or clsact queueing discipline. The only classful queueing
+// discipline is tbf, whose single class can hold any queueing discipline.
+
+// qdiscSpec describes a queueing discipline, and its child if it is classful.
+type qdiscSpec struct {
+	handle  uint32
+	kind    string
+	tbf     tc.TBFParams
+	fqCoDel tc.FQCoDelParams
+
+	// child is the queueing discipline of a tbf's class, or nil if it uses
+	// the default queue.
+	child *qdiscSpec
+}
+
+// qdiscSpecOf returns the description of q.
+func qdiscSpecOf(q tc.Qdisc) *qdiscSpec {
+	spec := &qdiscSpec{
+		handle: q.Handle(),
+		kind:   q.Kind(),
+	}
+	switch q := q.(type) {
+	case *tc.TBF:
+		spec.tbf = q.Params()
+		if child := q.Child(); child != nil {
+			spec.child = qdiscSpecOf(child)
+		}
+	case *tc.FQCoDel:
+		spec.fqCoDel = q.Params()
+	}
+	return spec
+}
+
+// findQDisc returns the queueing discipline with the given handle in the tree
+// rooted at spec, or nil if there is none.
+func findQDisc(spec *qdiscSpec, handle uint32) *qdiscSpec {
+	for ; spec != nil; spec = spec.child {
+		if spec.handle == handle {
+			return spec
+		}
+	}
+	return nil
+}
+
+// qdiscSlot returns where the queueing discipline whose parent is parent is
+// in the tree rooted at *root.
+func qdiscSlot(root **qdiscSpec, parent uint32) (**qdiscSpec, *syserr.Error) {
+	switch parent {
+	case linux.TC_H_ROOT:
+		return root, nil
+	case linux.TC_H_INGRESS:
+		// Ingress and clsact queueing disciplines aren't supported.
+		return nil, syserr.ErrNotSupported
+	case linux.TC_H_UNSPEC:
+		return nil, syserr.ErrInvalidArgument
+	}
+	spec := findQDisc(*root, parent&linux.TC_H_MAJ_MASK)
+	if spec == nil {
+		return nil, syserr.ErrNoFileOrDir
+	}
+	if spec.kind != tc.TBFKind {
+		// Classless queueing discipline.
+		return nil, syserr.ErrInvalidArgument
+	}
+	if parent&linux.TC_H_MIN_MASK != 1 {
+		return nil, syserr.ErrNoFileOrDir
+	}
+	return &spec.child, nil
+}
+
+// qdiscRequest is an RTM_NEWQDISC or RTM_DELQDISC request.
+type qdiscRequest struct {
+	nicID  tcpip.NICID
+	handle uint32
+	parent uint32
+	kind   string
+
+	// options is the value of TCA_OPTIONS, which is nil if it wasn't given.
+	options nlmsg.AttrsView
+
+	// mtu is the maximum size of packets on the NIC, including the link
+	// header.
+	mtu uint32
+}
+
+// parseQDiscRequest parses an RTM_NEWQDISC or RTM_DELQDISC request.
+func (s *Stack) parseQDiscRequest(msg *nlmsg.Message) (qdiscRequest, *syserr.Error) {
+	var hdr linux.TcMsg
+	attrs, ok := msg.GetData(&hdr)
+	if !ok {
+		return qdiscRequest{}, syserr.ErrInvalidArgument
+	}
+	req := qdiscRequest{
+		nicID:  tcpip.NICID(hdr.Ifindex),
+		handle: hdr.Handle,
+		parent: hdr.Parent,
+	}
+	nicInfo, ok := s.Stack.NICInfo()[req.nicID]
+	if !ok {
+		return qdiscRequest{}, syserr.ErrNoDevice
+	}
+	req.mtu = nicInfo.MTU
+	switch nicInfo.ARPHardwareType {
+	case header.ARPHardwareEther, header.ARPHardwareLoopback:
+		req.mtu += header.EthernetMinimumSize
+	}
+	if req.handle&linux.TC_H_MIN_MASK != 0 {
+		return qdiscRequest{}, syserr.ErrInvalidArgument
+	}
+
+	for !attrs.Empty() {
+		ahdr, value, rest, ok := attrs.ParseFirst()
+		if !ok {
+			return qdiscRequest{}, syserr.ErrInvalidArgument
+		}
+		attrs = rest
+
+		switch ahdr.Type {
+		case linux.TCA_KIND:
+			v := nlmsg.BytesView(value)
+			req.kind = v.String()
+		case linux.TCA_OPTIONS:
+			req.options = nlmsg.AttrsView(value)
+			if req.options == nil {
+				req.options = nlmsg.AttrsView{}
+			}
+		default:
+			log.Warningf("Unknown qdisc attribute: %v", ahdr.Type)
+			return qdiscRequest{}, syserr.ErrNotSupported
+		}
+	}
+	return req, nil
+}
+
+// rootQDiscSpec returns the description of the queueing disciplines of a NIC,
+// or nil if it has none.
+func (s *Stack) rootQDiscSpec(id tcpip.NICID) (*qdiscSpec, *syserr.Error) {
+	qDisc, err := s.Stack.NICRootQueueingDiscipline(id)
+	if err != nil {
+		return nil, syserr.ErrNoDevice
+	}
+	root, ok := qDisc.(*tc.Root)
+	if !ok {
+		return nil, nil
+	}
+	return qdiscSpecOf(root.Qdisc()), nil
+}
+
+// buildQDisc returns the queueing discipline described by spec, for a NIC
+// whose packets are up to mtu bytes long.
+func (s *Stack) buildQDisc(spec *qdiscSpec, mtu uint32) tc.Qdisc {
+	switch spec.kind {
+	case tc.TBFKind:
+		var child tc.Qdisc
+		if spec.child != nil {
+			child = s.buildQDisc(spec.child, mtu)
+		}
+		return tc.NewTBF(spec.handle, spec.tbf, child)
+	case tc.FQCoDelKind:
+		return tc.NewFQCoDel(spec.handle, spec.fqCoDel, mtu, s.Stack.Seed())
+	default:
+		panic("unknown qdisc kind: " + spec.kind)
+	}
+}
+
+// setRootQDisc installs the queueing disciplines described by root on a NIC,
+// or removes them if root is nil.
+func (s *Stack) setRootQDisc(id tcpip.NICID, root *qdiscSpec, mtu uint32) *syserr.Error {
+	var newQDisc func(lower stack.LinkWriter) stack.QueueingDiscipline
+	if root != nil {
+		qdisc := s.buildQDisc(root, mtu)
+		clock := s.Stack.Clock()
+		newQDisc = func(lower stack.LinkWriter) stack.QueueingDiscipline {
+			return tc.NewRoot(clock, lower, qdisc)
+		}
+	}
+	if err := s.Stack.SetNICRootQueueingDiscipline(id, newQDisc); err != nil {
+		return syserr.TranslateNetstackError(err)
+	}
+	return nil
+}
+
+// QDiscs implements inet.Stack.QDiscs.
+func (s *Stack) QDiscs() []inet.QDisc {
+	var ids []tcpip.NICID
+	for id := range s.Stack.NICInfo() {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var qdiscs []inet.QDisc
+	for _, id := range ids {
+		root, err := s.rootQDiscSpec(id)
+		if err != nil {
+			continue
+		}
+		if root == nil {
+			// Like Linux virtual devices, NICs without queueing
+			// disciplines are reported as using noqueue.
+			qdiscs = append(qdiscs, inet.QDisc{
+				Ifindex: int32(id),
+				Parent:  linux.TC_H_ROOT,
+				Kind:    "noqueue",
+			})
+			continue
+		}
+		parent := uint32(linux.TC_H_ROOT)
+		for spec := root; spec != nil; spec = spec.child {
+			qdiscs = append(qdiscs, inet.QDisc{
+				Ifindex: int32(id),
+				Handle:  spec.handle,
+				Parent:  parent,
+				Kind:    spec.kind,
+				TBF:     spec.tbf,
+				FQCoDel: spec.fqCoDel,
+			})
+			parent = spec.handle | 1
+		}
+	}
+	return qdiscs
+}
+
+// NewQDisc implements inet.Stack.NewQDisc.
+func (s *Stack) NewQDisc(ctx context.Context, msg *nlmsg.Message) *syserr.Error {
+	req, err := s.parseQDiscRequest(msg)
+	if err != nil {
+		return err
+	}
+
+	s.qdiscMu.Lock()
+	defer s.qdiscMu.Unlock()
+	root, err := s.rootQDiscSpec(req.nicID)
+	if err != nil {
+		return err
+	}
+	slot, err := qdiscSlot(&root, req.parent)
+	if err != nil {
+		return err
+	}
+
+	// Like Linux, decide whether to create a new queueing discipline or to
+	// change the existing one based on the request's handle and flags. See
+	// net/sched/sch_api.c:tc_modify_qdisc.
+	flags := msg.Header().Flags
+	old := *slot
+	create := false
+	switch {
+	case old == nil:
+		create = true
+	case req.handle != 0 && req.handle != old.handle:
+		if flags&linux.NLM_F_REPLACE == 0 {
+			return syserr.ErrExists
+		}
+		create = true
+	case req.handle == 0 && flags&linux.NLM_F_CREATE != 0 && flags&linux.NLM_F_REPLACE != 0:
+		create = flags&linux.NLM_F_EXCL != 0 || (req.kind != "" && req.kind != old.kind)
+	}
+
+	var spec *qdiscSpec
+	if create {
+		if flags&linux.NLM_F_CREATE == 0 {
+			return syserr.ErrNoFileOrDir
+		}
+		spec = &qdiscSpec{
+			handle: req.handle,
+			kind:   req.kind,
+		}
+		if spec.handle == 0 {
+			spec.handle = allocQDiscHandle(root)
+		} else if q := findQDisc(root, spec.handle); q != nil && q != old {
+			return syserr.ErrExists
+		}
+		switch spec.kind {
+		case tc.TBFKind:
+		case tc.FQCoDelKind:
+			spec.fqCoDel = tc.DefaultFQCoDelParams(req.mtu)
+		case "":
+			return syserr.ErrInvalidArgument
+		default:
+			log.Warningf("Unsupported qdisc kind: %q", spec.kind)
+			return syserr.ErrNotSupported
+		}
+	} else {
+		if flags&linux.NLM_F_EXCL != 0 {
+			return syserr.ErrExists
+		}
+		if req.kind != "" && req.kind != old.kind {
+			return syserr.ErrInvalidArgument
+		}
+		changed := *old
+		spec = &changed
+	}
+	if err := parseQDiscOptions(spec, req.options, create); err != nil {
+		return err
+	}
+	*slot = spec
+	return s.setRootQDisc(req.nicID, root, req.mtu)
+}
+
+// RemoveQDisc implements inet.Stack.RemoveQDisc.
+func (s *Stack) RemoveQDisc(ctx context.Context, msg *nlmsg.Message) *syserr.Error {
+	req, err := s.parseQDiscRequest(msg)
+	if err != nil {
+		return err
+	}
+
+	s.qdiscMu.Lock()
+	defer s.qdiscMu.Unlock()
+	root, err := s.rootQDiscSpec(req.nicID)
+	if err != nil {
+		return err
+	}
+	slot, err := qdiscSlot(&root, req.parent)
+	if err != nil {
+		return err
+	}
+	old := *slot
+	if old == nil || (req.handle != 0 && req.handle != old.handle) {
+		return syserr.ErrNoFileOrDir
+	}
+	if req.kind != "" && req.kind != old.kind {
+		return syserr.ErrInvalidArgument
+	}
+	*slot = nil
+	return s.setRootQDisc(req.nicID, root, req.mtu)
+}
+
+// allocQDiscHandle returns an unused handle for a queueing discipline in the
+// tree rooted at root. Like Linux, allocated handles start at 8001:.
+func allocQDiscHandle(root *qdiscSpec) uint32 {
+	for major := uint32(0x8001); ; major++ {
+		if handle := major << 16; findQDisc(root, handle) == nil {
+			return handle
+		}
+	}
+}
+
+// parseQDiscOptions parses the TCA_OPTIONS attribute of a request into spec.
+// options is nil if the attribute wasn't given. create is set if spec is a new
+// queueing discipline.
+func parseQDiscOptions(spec *qdiscSpec, options nlmsg.AttrsView, create bool) *syserr.Error {
+	switch spec.kind {
+	case tc.TBFKind:
+		return parseTBFOptions(&spec.tbf, options)
+	case tc.FQCoDelKind:
+		return parseFQCoDelOptions(&spec.fqCoDel, options, create)
+	default:
+		panic("unknown qdisc kind: " + spec.kind)
+	}
+}
+
+// parseTBFOptions parses the options of a tbf queueing discipline. Like Linux,
+// all parameters must be given, even when the queueing discipline is changed.
+func parseTBFOptions(params *tc.TBFParams, options nlmsg.AttrsView) *syserr.Error {
+	if options == nil {
+		return syserr.ErrInvalidArgument
+	}
+	var (
+		qopt     linux.TcTbfQopt
+		hasQopt  bool
+		rate64   uint64
+		burst    uint32
+		hasBurst bool
+	)
+	for !options.Empty() {
+		ahdr, value, rest, ok := options.ParseFirst()
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+		options = rest
+
+		v := nlmsg.BytesView(value)
+		switch ahdr.Type {
+		case linux.TCA_TBF_PARMS:
+			if len(value) < linux.SizeOfTcTbfQopt {
+				return syserr.ErrInvalidArgument
+			}
+			qopt.UnmarshalUnsafe(value)
+			hasQopt = true
+		case linux.TCA_TBF_RATE64:
+			rate64, ok = v.Uint64()
+		case linux.TCA_TBF_BURST:
+			burst, ok = v.Uint32()
+			hasBurst = true
+		case linux.TCA_TBF_PRATE64:
+			var peakrate uint64
+			if peakrate, ok = v.Uint64(); ok && peakrate != 0 {
+				return syserr.ErrNotSupported
+			}
+		case linux.TCA_TBF_RTAB, linux.TCA_TBF_PTAB, linux.TCA_TBF_PBURST, linux.TCA_TBF_PAD:
+			// Rate tables are only used by old kernels, and peak rate
+			// bursts are ignored without peak rates.
+		default:
+			log.Warningf("Unknown tbf attribute: %v", ahdr.Type)
+			return syserr.ErrNotSupported
+		}
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+	}
+	if !hasQopt {
+		return syserr.ErrInvalidArgument
+	}
+	if qopt.Peakrate.Rate != 0 {
+		log.Warningf("tbf peak rates are not supported")
+		return syserr.ErrNotSupported
+	}
+
+	p := tc.TBFParams{
+		Rate:  uint64(qopt.Rate.Rate),
+		Limit: qopt.Limit,
+	}
+	if rate64 != 0 {
+		p.Rate = rate64
+	}
+	if p.Rate == 0 {
+		return syserr.ErrInvalidArgument
+	}
+	if hasBurst {
+		p.Burst = burst
+	} else {
+		// The bucket is given as the time it takes to send it.
+		buffer := time.Duration(qopt.Buffer) << linux.PSCHED_SHIFT
+		p.Burst = uint32(min(uint64(buffer)*p.Rate/uint64(time.Second), uint64(^uint32(0))))
+	}
+	if p.Burst == 0 {
+		return syserr.ErrInvalidArgument
+	}
+	*params = p
+	return nil
+}
+
+// parseFQCoDelOptions parses the options of an fq_codel queueing discipline
+// into params, which holds the current or default parameters.
+func parseFQCoDelOptions(params *tc.FQCoDelParams, options nlmsg.AttrsView, create bool) *syserr.Error {
+	p := *params
+	for !options.Empty() {
+		ahdr, value, rest, ok := options.ParseFirst()
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+		options = rest
+
+		v := nlmsg.BytesView(value)
+		val, ok := v.Uint32()
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+		switch ahdr.Type {
+		case linux.TCA_FQ_CODEL_TARGET:
+			p.Target = time.Duration(val) * time.Microsecond
+		case linux.TCA_FQ_CODEL_LIMIT:
+			p.Limit = val
+		case linux.TCA_FQ_CODEL_INTERVAL:
+			p.Interval = time.Duration(val) * time.Microsecond
+		case linux.TCA_FQ_CODEL_ECN:
+			p.ECN = val != 0
+		case linux.TCA_FQ_CODEL_FLOWS:
+			// Like Linux, the number of flows can't be changed.
+			if !create || val == 0 || val > 65536 {
+				return syserr.ErrInvalidArgument
+			}
+			p.Flows = val
+		case linux.TCA_FQ_CODEL_QUANTUM:
+			// Like Linux, quantums are at least 256 bytes.
+			if val > 1<<20 {
+				return syserr.ErrInvalidArgument
+			}
+			p.Quantum = max(val, 256)
+		case linux.TCA_FQ_CODEL_CE_THRESHOLD:
+			p.CEThreshold = time.Duration(val) * time.Microsecond
+		case linux.TCA_FQ_CODEL_DROP_BATCH_SIZE:
+			p.DropBatchSize = max(val, 1)
+		case linux.TCA_FQ_CODEL_MEMORY_LIMIT:
+			p.MemoryLimit = min(val, 1<<31)
+		default:
+			log.Warningf("Unknown fq_codel attribute: %v", ahdr.Type)
+			return syserr.ErrNotSupported
+		}
+	}
+	if p.Limit == 0 {
+		return syserr.ErrInvalidArgument
+	}
+	*params = p
+	return nil
+}
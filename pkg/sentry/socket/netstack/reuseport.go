@@ -0,0 +1,78 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netstack
+
+import (
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/bpf"
+	"github.com/wilinz/gvisor/pkg/hostarch"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+	"github.com/wilinz/gvisor/pkg/syserr"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+)
+
+// sizeOfSockFprog is the size of struct sock_fprog on 64-bit architectures.
+const sizeOfSockFprog = 16
+
+// reusePortCBPF is a classic BPF program attached to a reuseport group with
+// SO_ATTACH_REUSEPORT_CBPF.
+//
+// +stateify savable
+type reusePortCBPF struct {
+	prog bpf.Program
+}
+
+// SelectEndpoint implements tcpip.ReusePortFilter.SelectEndpoint.
+//
+// As in Linux, the program is run on the transport payload and its return
+// value is the index of the selected socket.
+func (f *reusePortCBPF) SelectEndpoint(payload []byte) uint32 {
+	idx, err := bpf.Exec[bpf.BigEndian](f.prog, bpf.Input(payload))
+	if err != nil {
+		// Linux programs return 0 when they read past the end of the
+		// packet.
+		return 0
+	}
+	return idx
+}
+
+var _ tcpip.ReusePortFilter = (*reusePortCBPF)(nil)
+
+// copyInReusePortCBPF copies in and compiles the classic BPF program
+// described by the struct sock_fprog in optVal.
+func copyInReusePortCBPF(t *kernel.Task, optVal []byte) (*reusePortCBPF, *syserr.Error) {
+	if len(optVal) < sizeOfSockFprog {
+		return nil, syserr.ErrInvalidArgument
+	}
+	length := hostarch.ByteOrder.Uint16(optVal)
+	addr := hostarch.Addr(hostarch.ByteOrder.Uint64(optVal[8:]))
+	if length == 0 || length > bpf.MaxInstructions {
+		return nil, syserr.ErrInvalidArgument
+	}
+	insns := make([]linux.BPFInstruction, int(length))
+	if _, err := linux.CopyBPFInstructionSliceIn(t, addr, insns); err != nil {
+		return nil, syserr.FromError(err)
+	}
+	bpfInsns := make([]bpf.Instruction, len(insns))
+	for i, ins := range insns {
+		bpfInsns[i] = bpf.Instruction(ins)
+	}
+	prog, err := bpf.Compile(bpfInsns, true /* optimize */)
+	if err != nil {
+		t.Debugf("Invalid reuseport BPF program: %v", err)
+		return nil, syserr.ErrInvalidArgument
+	}
+	return &reusePortCBPF{prog: prog}, nil
+}
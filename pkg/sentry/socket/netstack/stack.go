@@ -15,6 +15,7 @@
 package netstack
 
 import (
+	"encoding/binary"
 	"fmt"
 
 	"github.com/wilinz/gvisor/pkg/abi/linux"
@@ -24,6 +25,7 @@ import (
 	"github.com/wilinz/gvisor/pkg/refs"
 	"github.com/wilinz/gvisor/pkg/sentry/inet"
 	"github.com/wilinz/gvisor/pkg/sentry/socket/netlink/nlmsg"
+	"github.com/wilinz/gvisor/pkg/sync"
 	"github.com/wilinz/gvisor/pkg/syserr"
 	"github.com/wilinz/gvisor/pkg/tcpip"
 	"github.com/wilinz/gvisor/pkg/tcpip/header"
@@ -41,6 +43,21 @@ import (
 // +stateify savable
 type Stack struct {
 	Stack *stack.Stack `state:".(*stack.Stack)"`
+
+	// mroute implements the IPv4 multicast routing socket options.
+	mroute multicastRouter
+
+	// qdiscMu serializes changes to the queueing disciplines of NICs.
+	qdiscMu sync.Mutex `state:"nosave"`
+
+	// sysctlMu protects somaxconn.
+	sysctlMu sync.Mutex `state:"nosave"`
+
+	// somaxconn is net.core.somaxconn, or nil if it has the default value
+	// inet.DefaultSomaxconn.
+	//
+	// +checklocks:sysctlMu
+	somaxconn *int32
 }
 
 // EnableSaveRestore enables netstack s/r.
@@ -67,6 +84,38 @@ func (s *Stack) Destroy() {
 	}()
 }
 
+// HostDevice is the NIC context of network devices that are backed by host
+// network devices. Unlike virtual devices, they are moved back to the root
+// network namespace when their network namespace is destroyed, as physical
+// devices are in Linux.
+//
+// +stateify savable
+type HostDevice struct{}
+
+// MoveHostDevices implements inet.Stack.MoveHostDevices.
+func (s *Stack) MoveHostDevices(root inet.Stack) {
+	rs, ok := root.(*Stack)
+	if !ok || rs.Stack == s.Stack {
+		return
+	}
+	for id, ni := range s.Stack.NICInfo() {
+		if _, ok := ni.Context.(HostDevice); !ok {
+			continue
+		}
+		_, err := s.Stack.SetNICStack(id, rs.Stack)
+		if _, ok := err.(*tcpip.ErrDuplicateNICID); ok {
+			// The name is taken in the root namespace, so the device
+			// is renamed like Linux does in default_device_exit_net.
+			if err = s.Stack.SetNICName(id, fmt.Sprintf("dev%d", id)); err == nil {
+				_, err = s.Stack.SetNICStack(id, rs.Stack)
+			}
+		}
+		if err != nil {
+			log.Warningf("Failed to move network device %q to the root network namespace: %s", ni.Name, err)
+		}
+	}
+}
+
 // SupportsIPv6 implements Stack.SupportsIPv6.
 func (s *Stack) SupportsIPv6() bool {
 	return s.Stack.CheckNetworkProtocol(ipv6.ProtocolNumber)
@@ -147,10 +196,12 @@ func (s *Stack) SetInterface(ctx context.Context, msg *nlmsg.Message) *syserr.Er
 				}
 			}
 		case linux.IFLA_MASTER:
+		case linux.IFLA_LINK:
 		case linux.IFLA_LINKINFO:
 		case linux.IFLA_ADDRESS:
 		case linux.IFLA_MTU:
 		case linux.IFLA_NET_NS_FD:
+		case linux.IFLA_NET_NS_PID:
 		case linux.IFLA_TXQLEN:
 		default:
 			ctx.Warningf("unexpected attribute: %x", attr)
@@ -184,28 +235,24 @@ func (s *Stack) SetInterface(ctx context.Context, msg *nlmsg.Message) *syserr.Er
 }
 
 func (s *Stack) setLink(ctx context.Context, id tcpip.NICID, linkAttrs map[uint16]nlmsg.BytesView) *syserr.Error {
-	// IFLA_NET_NS_FD has to be handled first, because other parameters may be reset.
-	if v, ok := linkAttrs[linux.IFLA_NET_NS_FD]; ok {
-		fd, ok := v.Uint32()
-		if !ok {
-			return syserr.ErrInvalidArgument
-		}
-		f := inet.NamespaceByFDFromContext(ctx)
-		if f == nil {
+	// IFLA_NET_NS_FD and IFLA_NET_NS_PID have to be handled first, because
+	// other parameters may be reset.
+	ns, peer, err := namespaceFromLinkAttrs(ctx, linkAttrs)
+	if err != nil {
+		return err
+	}
+	if ns != nil {
+		defer ns.DecRef(ctx)
+	}
+	if peer != nil && peer.Stack != s.Stack {
+		if nicInfo, ok := s.Stack.NICInfo()[id]; ok && nicInfo.Flags.Loopback {
+			// The loopback device is local to its network namespace.
 			return syserr.ErrInvalidArgument
 		}
-		ns, err := f(int32(fd))
+		var err tcpip.Error
+		id, err = s.Stack.SetNICStack(id, peer.Stack)
 		if err != nil {
-			return syserr.FromError(err)
-		}
-		defer ns.DecRef(ctx)
-		peer := ns.Stack().(*Stack)
-		if peer.Stack != s.Stack {
-			var err tcpip.Error
-			id, err = s.Stack.SetNICStack(id, peer.Stack)
-			if err != nil {
-				return syserr.TranslateNetstackError(err)
-			}
+			return syserr.TranslateNetstackError(err)
 		}
 	}
 	for t, v := range linkAttrs {
@@ -247,6 +294,49 @@ func (s *Stack) setLink(ctx context.Context, id tcpip.NICID, linkAttrs map[uint1
 	return nil
 }
 
+// namespaceFromLinkAttrs returns the network namespace specified by the
+// IFLA_NET_NS_FD or IFLA_NET_NS_PID attribute and its network stack, or nil
+// if attrs has neither of them. The caller must drop the reference on the
+// returned namespace.
+func namespaceFromLinkAttrs(ctx context.Context, attrs map[uint16]nlmsg.BytesView) (*inet.Namespace, *Stack, *syserr.Error) {
+	var (
+		ns  *inet.Namespace
+		err error
+	)
+	if v, ok := attrs[linux.IFLA_NET_NS_FD]; ok {
+		fd, ok := v.Uint32()
+		if !ok {
+			return nil, nil, syserr.ErrInvalidArgument
+		}
+		f := inet.NamespaceByFDFromContext(ctx)
+		if f == nil {
+			return nil, nil, syserr.ErrInvalidArgument
+		}
+		ns, err = f(int32(fd))
+	} else if v, ok := attrs[linux.IFLA_NET_NS_PID]; ok {
+		pid, ok := v.Uint32()
+		if !ok {
+			return nil, nil, syserr.ErrInvalidArgument
+		}
+		f := inet.NamespaceByPIDFromContext(ctx)
+		if f == nil {
+			return nil, nil, syserr.ErrInvalidArgument
+		}
+		ns, err = f(int32(pid))
+	} else {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, syserr.FromError(err)
+	}
+	peer, ok := ns.Stack().(*Stack)
+	if !ok {
+		ns.DecRef(ctx)
+		return nil, nil, syserr.ErrInvalidArgument
+	}
+	return ns, peer, nil
+}
+
 const defaultMTU = 1500
 
 func (s *Stack) newVeth(ctx context.Context, linkAttrs map[uint16]nlmsg.BytesView, linkInfoAttrs map[uint16]nlmsg.BytesView) *syserr.Error {
@@ -280,25 +370,26 @@ func (s *Stack) newVeth(ctx context.Context, linkAttrs map[uint16]nlmsg.BytesVie
 			if v, ok = peerLinkAttrs[linux.IFLA_IFNAME]; ok {
 				peerName = v.String()
 			}
-			if v, ok = peerLinkAttrs[linux.IFLA_NET_NS_FD]; ok {
-				fd, ok := v.Uint32()
-				if !ok {
-					return syserr.ErrInvalidArgument
-				}
-				f := inet.NamespaceByFDFromContext(ctx)
-				if f == nil {
-					return syserr.ErrInvalidArgument
-				}
-				ns, err := f(int32(fd))
-				if err != nil {
-					return syserr.FromError(err)
-				}
+			ns, peer, err := namespaceFromLinkAttrs(ctx, peerLinkAttrs)
+			if err != nil {
+				return err
+			}
+			if ns != nil {
 				defer ns.DecRef(ctx)
-				peerStack = ns.Stack().(*Stack)
+				peerStack = peer
 			}
 		}
 	}
-	ep, peerEP := veth.NewPair(defaultMTU, veth.DefaultBacklogSize)
+	// As in Linux, the peer is created with the attributes of the device
+	// unless its own attributes are specified, so it starts with the same
+	// MTU. setLink only changes the MTU of the device.
+	mtu := uint32(defaultMTU)
+	if v, ok := linkAttrs[linux.IFLA_MTU]; ok && peerLinkAttrs == nil {
+		if mtu, ok = v.Uint32(); !ok {
+			return syserr.ErrInvalidArgument
+		}
+	}
+	ep, peerEP := veth.NewPair(mtu, veth.DefaultBacklogSize)
 	id := s.Stack.NextNICID()
 	peerID := peerStack.Stack.NextNICID()
 	if ifname == "" {
@@ -357,6 +448,62 @@ func (s *Stack) newBridge(ctx context.Context, linkAttrs map[uint16]nlmsg.BytesV
 	return nil
 }
 
+func (s *Stack) newVLAN(ctx context.Context, linkAttrs map[uint16]nlmsg.BytesView, linkInfoAttrs map[uint16]nlmsg.BytesView) *syserr.Error {
+	v, ok := linkAttrs[linux.IFLA_LINK]
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	parent, ok := v.Uint32()
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	v, ok = linkInfoAttrs[linux.IFLA_INFO_DATA]
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	linkInfoData, ok := nlmsg.AttrsView(v).Parse()
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	var vid uint16
+	hasID := false
+	for attr, value := range linkInfoData {
+		switch attr {
+		case linux.IFLA_VLAN_ID:
+			vid, ok = value.Uint16()
+			if !ok {
+				return syserr.ErrInvalidArgument
+			}
+			hasID = true
+		case linux.IFLA_VLAN_PROTOCOL:
+			// The protocol is in network byte order. Only 802.1Q is
+			// supported.
+			if len(value) != 2 || binary.BigEndian.Uint16(value) != uint16(header.VLANProtocolNumber) {
+				return syserr.ErrNotSupported
+			}
+		default:
+			ctx.Warningf("unexpected VLAN attribute: %x", attr)
+			return syserr.ErrNotSupported
+		}
+	}
+	if !hasID {
+		return syserr.ErrInvalidArgument
+	}
+
+	id := s.Stack.NextNICID()
+	ifname := fmt.Sprintf("vlan%d", id)
+	if v, ok := linkAttrs[linux.IFLA_IFNAME]; ok {
+		ifname = v.String()
+	}
+	err := s.Stack.CreateVLANNIC(id, tcpip.NICID(parent), vid, stack.NICOptions{
+		Name: ifname,
+	})
+	if err != nil {
+		return syserr.TranslateNetstackError(err)
+	}
+	return s.setLink(ctx, id, linkAttrs)
+}
+
 func (s *Stack) newInterface(ctx context.Context, msg *nlmsg.Message, linkAttrs map[uint16]nlmsg.BytesView) *syserr.Error {
 	var (
 		linkInfoAttrs map[uint16]nlmsg.BytesView
@@ -388,6 +535,8 @@ func (s *Stack) newInterface(ctx context.Context, msg *nlmsg.Message, linkAttrs
 		return s.newBridge(ctx, linkAttrs, linkInfoAttrs)
 	case "veth":
 		return s.newVeth(ctx, linkAttrs, linkInfoAttrs)
+	case "vlan":
+		return s.newVLAN(ctx, linkAttrs, linkInfoAttrs)
 	}
 	return syserr.ErrNotSupported
 }
@@ -590,6 +739,21 @@ func (s *Stack) SetTCPRecovery(recovery inet.TCPLossRecovery) error {
 	return syserr.TranslateNetstackError(s.Stack.SetTransportProtocolOption(tcp.ProtocolNumber, &opt)).ToError()
 }
 
+// TCPSynCookies implements inet.Stack.TCPSynCookies.
+func (s *Stack) TCPSynCookies() (int32, error) {
+	var v tcpip.TCPSynCookiesOption
+	if err := s.Stack.TransportProtocolOption(tcp.ProtocolNumber, &v); err != nil {
+		return 0, syserr.TranslateNetstackError(err).ToError()
+	}
+	return int32(v), nil
+}
+
+// SetTCPSynCookies implements inet.Stack.SetTCPSynCookies.
+func (s *Stack) SetTCPSynCookies(v int32) error {
+	opt := tcpip.TCPSynCookiesOption(v)
+	return syserr.TranslateNetstackError(s.Stack.SetTransportProtocolOption(tcp.ProtocolNumber, &opt)).ToError()
+}
+
 // Statistics implements inet.Stack.Statistics.
 func (s *Stack) Statistics(stat any, arg string) error {
 	netStats := s.Stats()
@@ -712,6 +876,26 @@ func (s *Stack) Statistics(stat any, arg string) error {
 			udp.ChecksumErrors.Value(),      // Udp/InCsumErrors.
 			0,                               // Udp/IgnoredMulti.
 		}
+	case *inet.StatNetstatTCPExt:
+		tcp := netStats.TCP
+		listenOverflows := tcp.ListenOverflowSynDrop.Value() + tcp.ListenOverflowAckDrop.Value()
+		*stats = inet.StatNetstatTCPExt{
+			"SyncookiesSent":       tcp.ListenOverflowSynCookieSent.Value(),
+			"SyncookiesRecv":       tcp.ListenOverflowSynCookieRcvd.Value(),
+			"SyncookiesFailed":     tcp.ListenOverflowInvalidSynCookieRcvd.Value(),
+			"ListenOverflows":      listenOverflows,
+			"ListenDrops":          listenOverflows + tcp.ListenSynBacklogDrop.Value(),
+			"TCPTimeouts":          tcp.Timeouts.Value(),
+			"TCPRenoRecovery":      tcp.FastRecovery.Value(),
+			"TCPSackRecovery":      tcp.SACKRecovery.Value(),
+			"TCPLossProbeRecovery": tcp.TLPRecovery.Value(),
+			"TCPFastRetrans":       tcp.FastRetransmit.Value(),
+			"TCPSlowStartRetrans":  tcp.SlowStartRetransmits.Value(),
+			"TCPDSACKRecv":         tcp.SegmentsAckedWithDSACK.Value(),
+			"TCPSpuriousRTOs":      tcp.SpuriousRTORecovery.Value(),
+			"TCPDeferAcceptDrop":   tcp.DeferAcceptDrop.Value(),
+			"TCPReqQFullDrop":      tcp.ListenSynBacklogDrop.Value(),
+		}
 	default:
 		return syserr.ErrEndpointOperation.ToError()
 	}
@@ -752,6 +936,7 @@ func (s *Stack) RouteTable() []inet.Route {
 			// TODO(gvisor.dev/issue/595): Set scope for routes.
 			Scope: linux.RT_SCOPE_LINK,
 			Type:  linux.RTN_UNICAST,
+			Table: linuxRouteTable(rt.Table),
 
 			DstAddr:         dstAddr.AsSlice(),
 			OutputInterface: int32(rt.NIC),
@@ -775,7 +960,7 @@ func (s *Stack) localRoute(msg *nlmsg.Message) (tcpip.Route, *syserr.Error) {
 		DstLen:   rtMsg.DstLen,
 		SrcLen:   rtMsg.SrcLen,
 		TOS:      rtMsg.TOS,
-		Table:    rtMsg.Table,
+		Table:    uint32(rtMsg.Table),
 		Protocol: rtMsg.Protocol,
 		Scope:    rtMsg.Scope,
 		Type:     rtMsg.Type,
@@ -815,6 +1000,13 @@ func (s *Stack) localRoute(msg *nlmsg.Message) (tcpip.Route, *syserr.Error) {
 				return tcpip.Route{}, syserr.ErrInvalidArgument
 			}
 			route.GatewayAddr = value
+		case linux.RTA_TABLE:
+			v := nlmsg.BytesView(value)
+			table, ok := v.Uint32()
+			if !ok {
+				return tcpip.Route{}, syserr.ErrInvalidArgument
+			}
+			route.Table = table
 		case linux.RTA_PRIORITY:
 		default:
 			log.Warningf("Unknown attribute: %v", ahdr.Type)
@@ -853,6 +1045,7 @@ func (s *Stack) localRoute(msg *nlmsg.Message) (tcpip.Route, *syserr.Error) {
 		Destination: dest,
 		Gateway:     tcpip.AddrFromSlice(route.GatewayAddr),
 		NIC:         tcpip.NICID(route.OutputInterface),
+		Table:       routeTableID(route.Table),
 	}
 
 	if len(route.SrcAddr) != 0 {
@@ -877,7 +1070,7 @@ func (s *Stack) RemoveRoute(ctx context.Context, msg *nlmsg.Message) *syserr.Err
 		if localRoute.NIC > 0 && localRoute.NIC != rt.NIC {
 			return false
 		}
-		return rt.Destination.Equal(localRoute.Destination)
+		return rt.Table == localRoute.Table && rt.Destination.Equal(localRoute.Destination)
 	}); removed == 0 {
 		return syserr.ErrNoProcess
 	}
@@ -910,6 +1103,282 @@ func (s *Stack) NewRoute(ctx context.Context, msg *nlmsg.Message) *syserr.Error
 	return nil
 }
 
+// routeTableID converts a Linux route table ID to a netstack one. Like Linux,
+// RT_TABLE_UNSPEC refers to the main table.
+func routeTableID(table uint32) tcpip.RouteTableID {
+	if table == linux.RT_TABLE_UNSPEC || table == linux.RT_TABLE_MAIN {
+		return tcpip.MainRouteTable
+	}
+	return tcpip.RouteTableID(table)
+}
+
+// linuxRouteTable converts a netstack route table ID to a Linux one.
+func linuxRouteTable(table tcpip.RouteTableID) uint32 {
+	if table == tcpip.MainRouteTable {
+		return linux.RT_TABLE_MAIN
+	}
+	return uint32(table)
+}
+
+// RoutingRules implements inet.Stack.RoutingRules.
+func (s *Stack) RoutingRules() []inet.Rule {
+	var rules []inet.Rule
+	nics := s.Stack.NICInfo()
+	for _, r := range s.Stack.GetRoutingRules() {
+		rule := inet.Rule{
+			Table:             linuxRouteTable(r.Table),
+			Priority:          r.Priority,
+			Mark:              r.Mark,
+			Mask:              r.Mask,
+			SuppressPrefixLen: int32(r.MinPrefixLen) - 1,
+		}
+		switch r.Protocol {
+		case ipv4.ProtocolNumber:
+			rule.Family = linux.AF_INET
+		case ipv6.ProtocolNumber:
+			rule.Family = linux.AF_INET6
+		default:
+			continue
+		}
+		switch r.Action {
+		case tcpip.RoutingRuleLookup:
+			rule.Action = linux.FR_ACT_TO_TBL
+		case tcpip.RoutingRuleUnreachable:
+			rule.Action = linux.FR_ACT_UNREACHABLE
+		case tcpip.RoutingRuleProhibit:
+			rule.Action = linux.FR_ACT_PROHIBIT
+		}
+		if r.Invert {
+			rule.Flags |= linux.FIB_RULE_INVERT
+		}
+		if prefix := r.Source.Prefix(); prefix != 0 {
+			srcAddr := r.Source.ID()
+			rule.SrcLen = uint8(prefix)
+			rule.SrcAddr = srcAddr.AsSlice()
+		}
+		if prefix := r.Destination.Prefix(); prefix != 0 {
+			dstAddr := r.Destination.ID()
+			rule.DstLen = uint8(prefix)
+			rule.DstAddr = dstAddr.AsSlice()
+		}
+		if r.OutputNIC != 0 {
+			rule.OutputInterface = nics[r.OutputNIC].Name
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// netlinkRule is a routing rule parsed from a netlink message, along with
+// which of its fields were given.
+type netlinkRule struct {
+	tcpip.RoutingRule
+
+	hasPriority bool
+	hasAction   bool
+	hasTable    bool
+	hasMark     bool
+	hasMask     bool
+	hasSuppress bool
+}
+
+// matches returns true if r has the values of all given fields of nr, as
+// required by RTM_DELRULE.
+func (nr *netlinkRule) matches(r tcpip.RoutingRule) bool {
+	switch {
+	case r.Protocol != nr.Protocol:
+		return false
+	case nr.hasPriority && r.Priority != nr.Priority:
+		return false
+	case nr.hasAction && r.Action != nr.Action:
+		return false
+	case nr.hasTable && r.Table != nr.Table:
+		return false
+	case nr.hasMark && r.Mark != nr.Mark:
+		return false
+	case nr.hasMask && r.Mask != nr.Mask:
+		return false
+	case nr.hasSuppress && r.MinPrefixLen != nr.MinPrefixLen:
+		return false
+	case nr.Source.Prefix() != 0 && !r.Source.Equal(nr.Source):
+		return false
+	case nr.Destination.Prefix() != 0 && !r.Destination.Equal(nr.Destination):
+		return false
+	case nr.OutputNIC != 0 && r.OutputNIC != nr.OutputNIC:
+		return false
+	case nr.Invert && !r.Invert:
+		return false
+	}
+	return true
+}
+
+// routingRule parses a routing rule from an RTM_NEWRULE or RTM_DELRULE
+// message.
+func (s *Stack) routingRule(msg *nlmsg.Message) (netlinkRule, *syserr.Error) {
+	var hdr linux.FibRuleHdr
+	attrs, ok := msg.GetData(&hdr)
+	if !ok {
+		return netlinkRule{}, syserr.ErrInvalidArgument
+	}
+
+	var nr netlinkRule
+	var addrLen int
+	switch hdr.Family {
+	case linux.AF_INET:
+		nr.Protocol = ipv4.ProtocolNumber
+		addrLen = header.IPv4AddressSize
+	case linux.AF_INET6:
+		nr.Protocol = ipv6.ProtocolNumber
+		addrLen = header.IPv6AddressSize
+	default:
+		return netlinkRule{}, syserr.ErrAddressFamilyNotSupported
+	}
+	if !s.Stack.CheckNetworkProtocol(nr.Protocol) {
+		return netlinkRule{}, syserr.ErrAddressFamilyNotSupported
+	}
+	if hdr.TOS != 0 {
+		return netlinkRule{}, syserr.ErrNotSupported
+	}
+	nr.Invert = hdr.Flags&linux.FIB_RULE_INVERT != 0
+	nr.hasAction = hdr.Action != linux.FR_ACT_UNSPEC
+	switch hdr.Action {
+	case linux.FR_ACT_UNSPEC, linux.FR_ACT_TO_TBL:
+		nr.Action = tcpip.RoutingRuleLookup
+	case linux.FR_ACT_UNREACHABLE:
+		nr.Action = tcpip.RoutingRuleUnreachable
+	case linux.FR_ACT_PROHIBIT:
+		nr.Action = tcpip.RoutingRuleProhibit
+	default:
+		return netlinkRule{}, syserr.ErrNotSupported
+	}
+	table := uint32(hdr.Table)
+
+	// prefix returns the subnet described by an FRA_SRC or FRA_DST value.
+	prefix := func(value []byte, prefixLen uint8) (tcpip.Subnet, *syserr.Error) {
+		if len(value) != addrLen || int(prefixLen) > addrLen*8 {
+			return tcpip.Subnet{}, syserr.ErrInvalidArgument
+		}
+		return tcpip.AddressWithPrefix{
+			Address:   tcpip.AddrFromSlice(value),
+			PrefixLen: int(prefixLen),
+		}.Subnet(), nil
+	}
+	for !attrs.Empty() {
+		ahdr, value, rest, ok := attrs.ParseFirst()
+		if !ok {
+			return netlinkRule{}, syserr.ErrInvalidArgument
+		}
+		attrs = rest
+
+		v := nlmsg.BytesView(value)
+		var err *syserr.Error
+		switch ahdr.Type {
+		case linux.FRA_SRC:
+			nr.Source, err = prefix(value, hdr.SrcLen)
+		case linux.FRA_DST:
+			nr.Destination, err = prefix(value, hdr.DstLen)
+		case linux.FRA_PRIORITY:
+			nr.Priority, ok = v.Uint32()
+			nr.hasPriority = true
+		case linux.FRA_TABLE:
+			table, ok = v.Uint32()
+		case linux.FRA_FWMARK:
+			nr.Mark, ok = v.Uint32()
+			nr.hasMark = true
+		case linux.FRA_FWMASK:
+			nr.Mask, ok = v.Uint32()
+			nr.hasMask = true
+		case linux.FRA_SUPPRESS_PREFIXLEN:
+			var suppress uint32
+			suppress, ok = v.Uint32()
+			// Linux uses -1 to mean that no routes are suppressed.
+			nr.MinPrefixLen = int(int32(suppress)) + 1
+			nr.hasSuppress = true
+		case linux.FRA_OIFNAME:
+			name := v.String()
+			for id, ni := range s.Stack.NICInfo() {
+				if ni.Name == name {
+					nr.OutputNIC = id
+					break
+				}
+			}
+			if nr.OutputNIC == 0 {
+				return netlinkRule{}, syserr.ErrNoDevice
+			}
+		case linux.FRA_PROTOCOL:
+			// Rule origins are not used for matching, so they are ignored
+			// like they are for routes.
+		default:
+			log.Warningf("Unknown rule attribute: %v", ahdr.Type)
+			return netlinkRule{}, syserr.ErrNotSupported
+		}
+		if err != nil {
+			return netlinkRule{}, err
+		}
+		if !ok {
+			return netlinkRule{}, syserr.ErrInvalidArgument
+		}
+	}
+	if nr.hasMark && !nr.hasMask && nr.Mark != 0 {
+		// Like Linux, marks without masks are matched exactly.
+		nr.Mask = 0xffffffff
+	}
+	nr.hasTable = table != linux.RT_TABLE_UNSPEC
+	nr.Table = routeTableID(table)
+	return nr, nil
+}
+
+// NewRule implements inet.Stack.NewRule.
+func (s *Stack) NewRule(ctx context.Context, msg *nlmsg.Message) *syserr.Error {
+	nr, err := s.routingRule(msg)
+	if err != nil {
+		return err
+	}
+	if nr.Action == tcpip.RoutingRuleLookup && !nr.hasTable {
+		return syserr.ErrInvalidArgument
+	}
+	rules := s.Stack.GetRoutingRules()
+	if !nr.hasPriority {
+		// Like Linux, rules without a priority are added before the first
+		// rule with a non-zero priority.
+		for _, r := range rules {
+			if r.Protocol == nr.Protocol && r.Priority != 0 {
+				nr.Priority = r.Priority - 1
+				break
+			}
+		}
+	}
+	if msg.Header().Flags&linux.NLM_F_EXCL != 0 {
+		for _, r := range rules {
+			if r == nr.RoutingRule {
+				return syserr.ErrExists
+			}
+		}
+	}
+	s.Stack.AddRoutingRule(nr.RoutingRule)
+	return nil
+}
+
+// RemoveRule implements inet.Stack.RemoveRule.
+func (s *Stack) RemoveRule(ctx context.Context, msg *nlmsg.Message) *syserr.Error {
+	nr, err := s.routingRule(msg)
+	if err != nil {
+		return err
+	}
+	// Like Linux, only remove the first matching rule.
+	removed := false
+	if s.Stack.RemoveRoutingRules(func(r tcpip.RoutingRule) bool {
+		if removed || !nr.matches(r) {
+			return false
+		}
+		removed = true
+		return true
+	}) == 0 {
+		return syserr.ErrNoFileOrDir
+	}
+	return nil
+}
+
 // IPTables returns the stack's iptables.
 func (s *Stack) IPTables() (*stack.IPTables, error) {
 	return s.Stack.IPTables(), nil
@@ -0,0 +1,167 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netstack
+
+import (
+	"math"
+	"time"
+
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/sentry/inet"
+	"github.com/wilinz/gvisor/pkg/syserr"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/transport/tcp"
+)
+
+// maxTCPSynRetries is the maximum value of net.ipv4.tcp_syn_retries,
+// MAX_TCP_SYNCNT in Linux.
+const maxTCPSynRetries = 127
+
+// Sysctl implements inet.Stack.Sysctl.
+func (s *Stack) Sysctl(sysctl inet.Sysctl) (int64, error) {
+	switch sysctl {
+	case inet.SysctlSomaxconn:
+		s.sysctlMu.Lock()
+		defer s.sysctlMu.Unlock()
+		if s.somaxconn == nil {
+			return inet.DefaultSomaxconn, nil
+		}
+		return int64(*s.somaxconn), nil
+
+	case inet.SysctlRmemDefault, inet.SysctlRmemMax:
+		var opt tcpip.ReceiveBufferSizeOption
+		if err := s.Stack.Option(&opt); err != nil {
+			return 0, syserr.TranslateNetstackError(err).ToError()
+		}
+		if sysctl == inet.SysctlRmemDefault {
+			return int64(opt.Default), nil
+		}
+		return int64(opt.Max), nil
+
+	case inet.SysctlWmemDefault, inet.SysctlWmemMax:
+		var opt tcpip.SendBufferSizeOption
+		if err := s.Stack.Option(&opt); err != nil {
+			return 0, syserr.TranslateNetstackError(err).ToError()
+		}
+		if sysctl == inet.SysctlWmemDefault {
+			return int64(opt.Default), nil
+		}
+		return int64(opt.Max), nil
+
+	case inet.SysctlTCPFinTimeout:
+		var opt tcpip.TCPLingerTimeoutOption
+		if err := s.Stack.TransportProtocolOption(tcp.ProtocolNumber, &opt); err != nil {
+			return 0, syserr.TranslateNetstackError(err).ToError()
+		}
+		return int64(time.Duration(opt) / time.Second), nil
+
+	case inet.SysctlTCPModerateRcvbuf:
+		var opt tcpip.TCPModerateReceiveBufferOption
+		if err := s.Stack.TransportProtocolOption(tcp.ProtocolNumber, &opt); err != nil {
+			return 0, syserr.TranslateNetstackError(err).ToError()
+		}
+		if opt {
+			return 1, nil
+		}
+		return 0, nil
+
+	case inet.SysctlTCPRetries2:
+		var opt tcpip.TCPMaxRetriesOption
+		if err := s.Stack.TransportProtocolOption(tcp.ProtocolNumber, &opt); err != nil {
+			return 0, syserr.TranslateNetstackError(err).ToError()
+		}
+		return int64(opt), nil
+
+	case inet.SysctlTCPSynRetries:
+		var opt tcpip.TCPSynRetriesOption
+		if err := s.Stack.TransportProtocolOption(tcp.ProtocolNumber, &opt); err != nil {
+			return 0, syserr.TranslateNetstackError(err).ToError()
+		}
+		return int64(opt), nil
+
+	default:
+		return 0, linuxerr.ENOENT
+	}
+}
+
+// SetSysctl implements inet.Stack.SetSysctl.
+//
+// Netstack requires the default socket buffer sizes to be no larger than
+// the maximum sizes, so lowering net.core.rmem_max or net.core.wmem_max below
+// the default size lowers the default size too. Linux keeps them
+// independent.
+func (s *Stack) SetSysctl(sysctl inet.Sysctl, v int64) error {
+	if v < 0 || v > math.MaxInt32 {
+		return linuxerr.EINVAL
+	}
+	var err tcpip.Error
+	switch sysctl {
+	case inet.SysctlSomaxconn:
+		s.sysctlMu.Lock()
+		defer s.sysctlMu.Unlock()
+		somaxconn := int32(v)
+		s.somaxconn = &somaxconn
+		return nil
+
+	case inet.SysctlRmemDefault, inet.SysctlRmemMax:
+		var opt tcpip.ReceiveBufferSizeOption
+		if err := s.Stack.Option(&opt); err != nil {
+			return syserr.TranslateNetstackError(err).ToError()
+		}
+		if sysctl == inet.SysctlRmemDefault {
+			opt.Default = int(v)
+		} else {
+			opt.Max = int(v)
+			opt.Default = min(opt.Default, opt.Max)
+		}
+		err = s.Stack.SetOption(opt)
+
+	case inet.SysctlWmemDefault, inet.SysctlWmemMax:
+		var opt tcpip.SendBufferSizeOption
+		if err := s.Stack.Option(&opt); err != nil {
+			return syserr.TranslateNetstackError(err).ToError()
+		}
+		if sysctl == inet.SysctlWmemDefault {
+			opt.Default = int(v)
+		} else {
+			opt.Max = int(v)
+			opt.Default = min(opt.Default, opt.Max)
+		}
+		err = s.Stack.SetOption(opt)
+
+	case inet.SysctlTCPFinTimeout:
+		opt := tcpip.TCPLingerTimeoutOption(time.Duration(v) * time.Second)
+		err = s.Stack.SetTransportProtocolOption(tcp.ProtocolNumber, &opt)
+
+	case inet.SysctlTCPModerateRcvbuf:
+		opt := tcpip.TCPModerateReceiveBufferOption(v != 0)
+		err = s.Stack.SetTransportProtocolOption(tcp.ProtocolNumber, &opt)
+
+	case inet.SysctlTCPRetries2:
+		opt := tcpip.TCPMaxRetriesOption(v)
+		err = s.Stack.SetTransportProtocolOption(tcp.ProtocolNumber, &opt)
+
+	case inet.SysctlTCPSynRetries:
+		if v < 1 || v > maxTCPSynRetries {
+			return linuxerr.EINVAL
+		}
+		opt := tcpip.TCPSynRetriesOption(v)
+		err = s.Stack.SetTransportProtocolOption(tcp.ProtocolNumber, &opt)
+
+	default:
+		return linuxerr.ENOENT
+	}
+	return syserr.TranslateNetstackError(err).ToError()
+}
@@ -0,0 +1,426 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netstack
+
+import (
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/hostarch"
+	"github.com/wilinz/gvisor/pkg/marshal"
+	"github.com/wilinz/gvisor/pkg/marshal/primitive"
+	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/tmpfs"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
+	"github.com/wilinz/gvisor/pkg/sentry/memmap"
+	"github.com/wilinz/gvisor/pkg/sentry/vfs"
+	"github.com/wilinz/gvisor/pkg/sync"
+	"github.com/wilinz/gvisor/pkg/syserr"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/transport/tcp"
+	"github.com/wilinz/gvisor/pkg/usermem"
+	"github.com/wilinz/gvisor/pkg/waiter"
+)
+
+// TCP_ZEROCOPY_RECEIVE lets applications receive TCP data by having it placed
+// in a read-only mapping of the socket, created with mmap(2), instead of
+// copying it to a buffer. See net/ipv4/tcp.c:tcp_zerocopy_receive() in Linux.
+//
+// Netstack's receive buffers aren't backed by a memmap.File, so they can't be
+// mapped into the application address space as is. Instead, each mapping of a
+// TCP socket is backed by an unlinked tmpfs file, like shared anonymous
+// mappings, and received data is moved to the pages of the file backing the
+// requested range. This still costs a copy, like recvmsg(2), but supports
+// applications that have adopted the Linux API. Unlike Linux, pages of the
+// mapping that never received data read as zeroes instead of raising SIGBUS.
+
+// zeroCopyMappable implements memmap.Mappable for a mapping of a TCP socket. It
+// delegates to the tmpfs file backing the mapping, and tracks where it is
+// mapped so that getsockopt(TCP_ZEROCOPY_RECEIVE) can find it.
+//
+// +stateify savable
+type zeroCopyMappable struct {
+	// file is the tmpfs file backing the mapping. It is immutable.
+	file *vfs.FileDescription
+
+	// impl is the memmap.Mappable of file. It is immutable.
+	impl memmap.Mappable
+
+	mu sync.Mutex `state:"nosave"`
+
+	// mapped is set once the mappable has been mapped.
+	//
+	// +checklocks:mu
+	mapped bool
+
+	// mappings are the ranges of address spaces the mappable is mapped in.
+	//
+	// +checklocks:mu
+	mappings []zeroCopyMapping
+}
+
+// zeroCopyMapping is a range of an address space where a zeroCopyMappable is
+// mapped.
+//
+// +stateify savable
+type zeroCopyMapping struct {
+	ms     memmap.MappingSpace
+	ar     hostarch.AddrRange
+	offset uint64
+}
+
+// AddMapping implements memmap.Mappable.AddMapping.
+func (m *zeroCopyMappable) AddMapping(ctx context.Context, ms memmap.MappingSpace, ar hostarch.AddrRange, offset uint64, writable bool) error {
+	if err := m.impl.AddMapping(ctx, ms, ar, offset, writable); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mapped = true
+	m.mappings = append(m.mappings, zeroCopyMapping{ms: ms, ar: ar, offset: offset})
+	return nil
+}
+
+// RemoveMapping implements memmap.Mappable.RemoveMapping.
+func (m *zeroCopyMappable) RemoveMapping(ctx context.Context, ms memmap.MappingSpace, ar hostarch.AddrRange, offset uint64, writable bool) {
+	m.impl.RemoveMapping(ctx, ms, ar, offset, writable)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// ar may be any part of a mapping, e.g. after a partial munmap.
+	var kept []zeroCopyMapping
+	for _, zm := range m.mappings {
+		if zm.ms != ms || !zm.ar.Overlaps(ar) {
+			kept = append(kept, zm)
+			continue
+		}
+		if zm.ar.Start < ar.Start {
+			kept = append(kept, zeroCopyMapping{
+				ms:     ms,
+				ar:     hostarch.AddrRange{Start: zm.ar.Start, End: ar.Start},
+				offset: zm.offset,
+			})
+		}
+		if ar.End < zm.ar.End {
+			kept = append(kept, zeroCopyMapping{
+				ms:     ms,
+				ar:     hostarch.AddrRange{Start: ar.End, End: zm.ar.End},
+				offset: zm.offset + uint64(ar.End-zm.ar.Start),
+			})
+		}
+	}
+	m.mappings = kept
+}
+
+// CopyMapping implements memmap.Mappable.CopyMapping.
+func (m *zeroCopyMappable) CopyMapping(ctx context.Context, ms memmap.MappingSpace, srcAR, dstAR hostarch.AddrRange, offset uint64, writable bool) error {
+	if err := m.impl.CopyMapping(ctx, ms, srcAR, dstAR, offset, writable); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mappings = append(m.mappings, zeroCopyMapping{ms: ms, ar: dstAR, offset: offset})
+	return nil
+}
+
+// Translate implements memmap.Mappable.Translate.
+func (m *zeroCopyMappable) Translate(ctx context.Context, required, optional memmap.MappableRange, at hostarch.AccessType) ([]memmap.Translation, error) {
+	return m.impl.Translate(ctx, required, optional, at)
+}
+
+// InvalidateUnsavable implements memmap.Mappable.InvalidateUnsavable.
+func (m *zeroCopyMappable) InvalidateUnsavable(ctx context.Context) error {
+	return m.impl.InvalidateUnsavable(ctx)
+}
+
+// find returns the offset in m.file that addr in ms maps, and the number of
+// bytes mapped from addr on.
+func (m *zeroCopyMappable) find(ms memmap.MappingSpace, addr hostarch.Addr) (uint64, uint64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, zm := range m.mappings {
+		if zm.ms == ms && zm.ar.Contains(addr) {
+			return zm.offset + uint64(addr-zm.ar.Start), uint64(zm.ar.End - addr), true
+		}
+	}
+	return 0, 0, false
+}
+
+// unmapped returns true if m was mapped, but isn't anymore.
+func (m *zeroCopyMappable) unmapped() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mapped && len(m.mappings) == 0
+}
+
+// zeroCopyState holds the mappings of a TCP socket used by
+// TCP_ZEROCOPY_RECEIVE.
+//
+// +stateify savable
+type zeroCopyState struct {
+	mu sync.Mutex `state:"nosave"`
+
+	// mappables are the mappables created by mmap(2) of the socket, which
+	// hold a reference on their file until they are unmapped.
+	//
+	// +checklocks:mu
+	mappables []*zeroCopyMappable
+}
+
+// add adds m to the mappables of the socket, and releases the mappables that
+// are no longer mapped.
+func (zs *zeroCopyState) add(ctx context.Context, m *zeroCopyMappable) {
+	zs.mu.Lock()
+	defer zs.mu.Unlock()
+	kept := zs.mappables[:0]
+	for _, old := range zs.mappables {
+		if old.unmapped() {
+			old.file.DecRef(ctx)
+			continue
+		}
+		kept = append(kept, old)
+	}
+	zs.mappables = append(kept, m)
+}
+
+// find returns the mappable mapped at addr in ms, the offset of its file that
+// addr maps, and the number of bytes mapped from addr on.
+func (zs *zeroCopyState) find(ms memmap.MappingSpace, addr hostarch.Addr) (*zeroCopyMappable, uint64, uint64, bool) {
+	zs.mu.Lock()
+	defer zs.mu.Unlock()
+	for _, m := range zs.mappables {
+		if off, n, ok := m.find(ms, addr); ok {
+			return m, off, n, true
+		}
+	}
+	return nil, 0, 0, false
+}
+
+// release releases the files of all mappables. Since mappings hold a
+// reference on the socket, it is only called once the socket is unmapped.
+func (zs *zeroCopyState) release(ctx context.Context) {
+	zs.mu.Lock()
+	defer zs.mu.Unlock()
+	for _, m := range zs.mappables {
+		m.file.DecRef(ctx)
+	}
+	zs.mappables = nil
+}
+
+// configureZeroCopyMMap implements vfs.FileDescriptionImpl.ConfigureMMap for
+// TCP sockets.
+func (s *sock) configureZeroCopyMMap(ctx context.Context, opts *memmap.MMapOpts) error {
+	// Like Linux, the mapping can never be made writable or executable.
+	if opts.Perms.Write || opts.Perms.Execute {
+		return linuxerr.EPERM
+	}
+	opts.MaxPerms.Write = false
+	opts.MaxPerms.Execute = false
+
+	k := kernel.KernelFromContext(ctx)
+	file, err := tmpfs.NewZeroFile(ctx, auth.CredentialsFromContext(ctx), k.ShmMount(), opts.Length)
+	if err != nil {
+		return err
+	}
+	// The offset of the socket is meaningless, so the mapping always starts
+	// at the beginning of its file.
+	opts.Offset = 0
+	fileOpts := *opts
+	if err := file.ConfigureMMap(ctx, &fileOpts); err != nil {
+		file.DecRef(ctx)
+		return err
+	}
+	// The mapping is identified by the socket rather than the file.
+	fileOpts.MappingIdentity.DecRef(ctx)
+	opts.SentryOwnedContent = fileOpts.SentryOwnedContent
+
+	m := &zeroCopyMappable{
+		file: file,
+		impl: fileOpts.Mappable,
+	}
+	if err := vfs.GenericConfigureMMap(&s.vfsfd, m, opts); err != nil {
+		file.DecRef(ctx)
+		return err
+	}
+	s.zeroCopy.add(ctx, m)
+	return nil
+}
+
+// zeroCopyFileWriter is an io.Writer writing to a file at increasing offsets.
+type zeroCopyFileWriter struct {
+	ctx  context.Context
+	file *vfs.FileDescription
+	off  int64
+}
+
+// Write implements io.Writer.Write.
+func (w *zeroCopyFileWriter) Write(p []byte) (int, error) {
+	n, err := w.file.PWrite(w.ctx, usermem.BytesIOSequence(p), w.off, vfs.WriteOptions{})
+	w.off += n
+	return int(n), err
+}
+
+// getSockOptTCPZeroCopyReceive implements getsockopt(TCP_ZEROCOPY_RECEIVE).
+// Like Linux, it accepts the shorter versions of struct tcp_zerocopy_receive
+// used by older applications, and only writes back the fields they include.
+// See net/ipv4/tcp.c:do_tcp_getsockopt().
+func (s *sock) getSockOptTCPZeroCopyReceive(t *kernel.Task, outPtr hostarch.Addr, outLen int) (marshal.Marshallable, *syserr.Error) {
+	var zc linux.TCPZeroCopyReceive
+	size := zc.SizeBytes()
+	if outLen < linux.TCPZeroCopyReceiveLengthEnd {
+		return nil, syserr.ErrInvalidArgument
+	}
+	if outLen > size {
+		// Newer versions of the struct are accepted if the fields unknown
+		// to us are zero.
+		extra := make([]byte, outLen-size)
+		if _, err := t.CopyInBytes(outPtr+hostarch.Addr(size), extra); err != nil {
+			return nil, syserr.FromError(err)
+		}
+		for _, b := range extra {
+			if b != 0 {
+				return nil, syserr.ErrInvalidArgument
+			}
+		}
+		outLen = size
+	}
+	buf := make([]byte, size)
+	if _, err := t.CopyInBytes(outPtr, buf[:outLen]); err != nil {
+		return nil, syserr.FromError(err)
+	}
+	zc.UnmarshalBytes(buf)
+	if zc.Reserved != 0 || zc.MsgFlags&^linux.TCP_CMSG_TS != 0 {
+		return nil, syserr.ErrInvalidArgument
+	}
+
+	if err := s.tcpZeroCopyReceive(t, &zc); err != nil {
+		return nil, err
+	}
+
+	if outLen >= linux.TCPZeroCopyReceiveErrEnd {
+		if err := s.Endpoint.LastError(); err != nil {
+			zc.Err = -int32(syserr.TranslateNetstackError(err).ToLinux())
+		}
+	}
+	if outLen >= linux.TCPZeroCopyReceiveInqEnd {
+		inq, err := s.Endpoint.GetSockOptInt(tcpip.ReceiveQueueSizeOption)
+		if err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+		zc.Inq = uint32(inq)
+	}
+	zc.MarshalBytes(buf)
+	out := primitive.ByteSlice(buf[:outLen])
+	return &out, nil
+}
+
+// tcpZeroCopyReceive moves received data to the mapping of the socket at
+// zc.Address, and copies what can't be mapped to zc.CopybufAddress. See
+// net/ipv4/tcp.c:tcp_zerocopy_receive() in Linux.
+func (s *sock) tcpZeroCopyReceive(t *kernel.Task, zc *linux.TCPZeroCopyReceive) *syserr.Error {
+	if zc.Address%hostarch.PageSize != 0 {
+		return syserr.ErrInvalidArgument
+	}
+	if tcp.EndpointState(s.Endpoint.State()) == tcp.StateListen {
+		return syserr.ErrNotConnected
+	}
+	if s.tls.rxEnabled.Load() {
+		// The mapped data would bypass decryption.
+		return syserr.ErrInvalidArgument
+	}
+
+	s.readMu.Lock()
+	defer s.readMu.Unlock()
+
+	m, fileOff, mappedLen, ok := s.zeroCopy.find(t.MemoryManager(), hostarch.Addr(zc.Address))
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	v, terr := s.Endpoint.GetSockOptInt(tcpip.ReceiveQueueSizeOption)
+	if terr != nil {
+		return syserr.TranslateNetstackError(terr)
+	}
+	inq := uint64(v)
+
+	zc.RecvSkipHint = 0
+	copybufLen := uint64(0)
+	if zc.CopybufAddress != 0 && zc.CopybufLen > 0 {
+		copybufLen = uint64(zc.CopybufLen)
+	}
+	if inq > 0 && inq <= copybufLen {
+		// Like Linux, copy small amounts of data rather than mapping them.
+		n, err := s.zeroCopyReadToCopybuf(t, zc, inq)
+		if err != nil {
+			return err
+		}
+		zc.Length = 0
+		zc.CopybufLen = int32(n)
+		return nil
+	}
+	if inq < hostarch.PageSize {
+		zc.Length = 0
+		zc.RecvSkipHint = uint32(inq)
+		if inq == 0 && s.Endpoint.Readiness(waiter.EventRdHUp)&waiter.EventRdHUp != 0 {
+			return syserr.ErrIO
+		}
+		return nil
+	}
+
+	availLen := min(mappedLen, uint64(zc.Length), inq)
+	toMap := availLen &^ (hostarch.PageSize - 1)
+	if toMap == 0 {
+		zc.Length = 0
+		zc.RecvSkipHint = uint32(availLen)
+		return nil
+	}
+	w := zeroCopyFileWriter{ctx: t, file: m.file, off: int64(fileOff)}
+	res, terr := s.Endpoint.Read(&tcpip.LimitedWriter{W: &w, N: int64(toMap)}, tcpip.ReadOptions{})
+	if terr != nil {
+		return syserr.TranslateNetstackError(terr)
+	}
+	zc.Length = uint32(res.Count)
+
+	// Data at the end that doesn't fill a page can't be mapped, and must be
+	// received with recvmsg(2) or copied to copybuf.
+	if left := inq - uint64(res.Count); left < hostarch.PageSize {
+		zc.RecvSkipHint = uint32(left)
+	}
+	if zc.RecvSkipHint > 0 && copybufLen > 0 {
+		n, err := s.zeroCopyReadToCopybuf(t, zc, min(uint64(zc.RecvSkipHint), copybufLen))
+		if err != nil {
+			return err
+		}
+		zc.CopybufLen = int32(n)
+		zc.RecvSkipHint -= uint32(n)
+	}
+	return nil
+}
+
+// zeroCopyReadToCopybuf reads up to n bytes to zc.CopybufAddress.
+//
+// +checklocks:s.readMu
+func (s *sock) zeroCopyReadToCopybuf(t *kernel.Task, zc *linux.TCPZeroCopyReceive, n uint64) (int, *syserr.Error) {
+	dst, err := t.SingleIOSequence(hostarch.Addr(zc.CopybufAddress), int(n), usermem.IOOpts{
+		AddressSpaceActive: true,
+	})
+	if err != nil {
+		return 0, syserr.FromError(err)
+	}
+	s.recvWriter.Init(t, dst)
+	res, terr := s.Endpoint.Read(&s.recvWriter, tcpip.ReadOptions{})
+	if terr != nil {
+		return 0, syserr.TranslateNetstackError(terr)
+	}
+	return res.Count, nil
+}
@@ -0,0 +1,771 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netstack
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/atomicbitops"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/marshal"
+	"github.com/wilinz/gvisor/pkg/marshal/primitive"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+	"github.com/wilinz/gvisor/pkg/sentry/ktime"
+	"github.com/wilinz/gvisor/pkg/sentry/socket"
+	"github.com/wilinz/gvisor/pkg/sync"
+	"github.com/wilinz/gvisor/pkg/syserr"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/transport/tcp"
+	"github.com/wilinz/gvisor/pkg/usermem"
+	"github.com/wilinz/gvisor/pkg/waiter"
+)
+
+const (
+	// tlsULPName is the name of the kernel TLS upper layer protocol, as set
+	// with setsockopt(TCP_ULP).
+	tlsULPName = "tls"
+
+	// tcpULPNameMax is Linux's net/tcp.h TCP_ULP_NAME_MAX.
+	tcpULPNameMax = 16
+
+	// tlsTagSize is the size of the AES-GCM authentication tag.
+	tlsTagSize = 16
+
+	// tlsExplicitIVSize is the size of the explicit nonce sent with each
+	// TLS 1.2 AES-GCM record.
+	tlsExplicitIVSize = 8
+
+	// tlsNonceSize is the size of the AES-GCM nonce.
+	tlsNonceSize = 12
+)
+
+// tlsCipherState is the crypto state of one direction of a kernel TLS socket.
+// It mirrors struct cipher_context in Linux.
+//
+// +stateify savable
+type tlsCipherState struct {
+	version    uint16
+	cipherType uint16
+	key        []byte
+	salt       [linux.TLS_CIPHER_AES_GCM_128_SALT_SIZE]byte
+	iv         [linux.TLS_CIPHER_AES_GCM_128_IV_SIZE]byte
+	recSeq     uint64
+
+	// aead is created from key on first use.
+	aead cipher.AEAD `state:"nosave"`
+}
+
+// newTLSCipherState parses the struct tls12_crypto_info_* passed to
+// setsockopt(SOL_TLS).
+func newTLSCipherState(optVal []byte) (*tlsCipherState, *syserr.Error) {
+	if len(optVal) < linux.SizeOfTLSCryptoInfo {
+		return nil, syserr.ErrInvalidArgument
+	}
+	var info linux.TLSCryptoInfo
+	info.UnmarshalBytes(optVal)
+	if info.Version != linux.TLS_1_2_VERSION && info.Version != linux.TLS_1_3_VERSION {
+		return nil, syserr.ErrInvalidArgument
+	}
+
+	c := &tlsCipherState{
+		version:    info.Version,
+		cipherType: info.CipherType,
+	}
+	switch info.CipherType {
+	case linux.TLS_CIPHER_AES_GCM_128:
+		if len(optVal) != linux.SizeOfTLS12CryptoInfoAESGCM128 {
+			return nil, syserr.ErrInvalidArgument
+		}
+		var ci linux.TLS12CryptoInfoAESGCM128
+		ci.UnmarshalBytes(optVal)
+		c.key = append([]byte(nil), ci.Key[:]...)
+		c.salt = ci.Salt
+		c.iv = ci.IV
+		c.recSeq = binary.BigEndian.Uint64(ci.RecSeq[:])
+	case linux.TLS_CIPHER_AES_GCM_256:
+		if len(optVal) != linux.SizeOfTLS12CryptoInfoAESGCM256 {
+			return nil, syserr.ErrInvalidArgument
+		}
+		var ci linux.TLS12CryptoInfoAESGCM256
+		ci.UnmarshalBytes(optVal)
+		c.key = append([]byte(nil), ci.Key[:]...)
+		c.salt = ci.Salt
+		c.iv = ci.IV
+		c.recSeq = binary.BigEndian.Uint64(ci.RecSeq[:])
+	default:
+		return nil, syserr.ErrInvalidArgument
+	}
+	if _, err := c.getAEAD(); err != nil {
+		return nil, syserr.ErrInvalidArgument
+	}
+	return c, nil
+}
+
+// cryptoInfo returns the struct tls12_crypto_info_* describing c, including
+// the current record sequence number.
+func (c *tlsCipherState) cryptoInfo() marshal.Marshallable {
+	info := linux.TLSCryptoInfo{
+		Version:    c.version,
+		CipherType: c.cipherType,
+	}
+	var recSeq [linux.TLS_CIPHER_AES_GCM_128_REC_SEQ_SIZE]byte
+	binary.BigEndian.PutUint64(recSeq[:], c.recSeq)
+	switch c.cipherType {
+	case linux.TLS_CIPHER_AES_GCM_128:
+		ci := &linux.TLS12CryptoInfoAESGCM128{
+			Info:   info,
+			IV:     c.iv,
+			Salt:   c.salt,
+			RecSeq: recSeq,
+		}
+		copy(ci.Key[:], c.key)
+		return ci
+	default:
+		ci := &linux.TLS12CryptoInfoAESGCM256{
+			Info:   info,
+			IV:     c.iv,
+			Salt:   c.salt,
+			RecSeq: recSeq,
+		}
+		copy(ci.Key[:], c.key)
+		return ci
+	}
+}
+
+// cryptoInfoSize returns the size of the struct returned by cryptoInfo.
+func (c *tlsCipherState) cryptoInfoSize() int {
+	if c.cipherType == linux.TLS_CIPHER_AES_GCM_128 {
+		return linux.SizeOfTLS12CryptoInfoAESGCM128
+	}
+	return linux.SizeOfTLS12CryptoInfoAESGCM256
+}
+
+func (c *tlsCipherState) getAEAD() (cipher.AEAD, error) {
+	if c.aead != nil {
+		return c.aead, nil
+	}
+	block, err := aes.NewCipher(c.key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	c.aead = aead
+	return aead, nil
+}
+
+// overhead returns the number of bytes that a record adds to its plaintext.
+func (c *tlsCipherState) overhead() int {
+	if c.version == linux.TLS_1_2_VERSION {
+		return linux.TLS_HEADER_SIZE + tlsExplicitIVSize + tlsTagSize
+	}
+	// TLS 1.3 appends the real content type to the plaintext.
+	return linux.TLS_HEADER_SIZE + 1 + tlsTagSize
+}
+
+// nonce returns the AES-GCM nonce for the current record. For TLS 1.2, it is
+// the salt followed by the explicit nonce. For TLS 1.3, it is the salt and IV
+// XORed with the record sequence number, as per RFC 8446 section 5.3.
+func (c *tlsCipherState) nonce() []byte {
+	nonce := make([]byte, tlsNonceSize)
+	copy(nonce, c.salt[:])
+	copy(nonce[len(c.salt):], c.iv[:])
+	if c.version == linux.TLS_1_3_VERSION {
+		seq := nonce[tlsNonceSize-8:]
+		binary.BigEndian.PutUint64(seq, binary.BigEndian.Uint64(seq)^c.recSeq)
+	}
+	return nonce
+}
+
+// additionalData returns the TLS 1.2 additional authenticated data for a
+// record with the given type and plaintext length, as per RFC 5246 section
+// 6.2.3.3.
+func (c *tlsCipherState) additionalData(recordType uint8, length int) []byte {
+	aad := make([]byte, 13)
+	binary.BigEndian.PutUint64(aad, c.recSeq)
+	aad[8] = recordType
+	binary.BigEndian.PutUint16(aad[9:], linux.TLS_1_2_VERSION)
+	binary.BigEndian.PutUint16(aad[11:], uint16(length))
+	return aad
+}
+
+// advance moves c to the next record.
+func (c *tlsCipherState) advance() {
+	c.recSeq++
+	if c.version == linux.TLS_1_2_VERSION {
+		// Like Linux, use the record sequence as the explicit nonce.
+		binary.BigEndian.PutUint64(c.iv[:], binary.BigEndian.Uint64(c.iv[:])+1)
+	}
+}
+
+// putTLSHeader writes a TLS record header to b.
+func putTLSHeader(b []byte, recordType uint8, length int) {
+	b[0] = recordType
+	binary.BigEndian.PutUint16(b[1:], linux.TLS_1_2_VERSION)
+	binary.BigEndian.PutUint16(b[3:], uint16(length))
+}
+
+// seal encrypts plaintext into a record of the given type.
+//
+// Preconditions: len(plaintext) <= linux.TLS_MAX_PAYLOAD_SIZE.
+func (c *tlsCipherState) seal(recordType uint8, plaintext []byte) []byte {
+	aead, err := c.getAEAD()
+	if err != nil {
+		// The key was validated by newTLSCipherState.
+		panic("invalid TLS key: " + err.Error())
+	}
+	nonce := c.nonce()
+	record := make([]byte, linux.TLS_HEADER_SIZE, len(plaintext)+c.overhead())
+	var aad []byte
+	if c.version == linux.TLS_1_2_VERSION {
+		putTLSHeader(record, recordType, tlsExplicitIVSize+len(plaintext)+tlsTagSize)
+		record = append(record, c.iv[:]...)
+		aad = c.additionalData(recordType, len(plaintext))
+	} else {
+		// TLS 1.3 records always have the application data type on the
+		// wire, with the real type hidden in the encrypted content.
+		putTLSHeader(record, linux.TLS_RECORD_TYPE_DATA, len(plaintext)+1+tlsTagSize)
+		plaintext = append(plaintext[:len(plaintext):len(plaintext)], recordType)
+		aad = append([]byte(nil), record...)
+	}
+	record = aead.Seal(record, nonce, plaintext, aad)
+	c.advance()
+	return record
+}
+
+// open authenticates and decrypts record, which must contain a complete TLS
+// record including its header. It returns the record type and plaintext.
+func (c *tlsCipherState) open(record []byte) (uint8, []byte, *syserr.Error) {
+	aead, err := c.getAEAD()
+	if err != nil {
+		panic("invalid TLS key: " + err.Error())
+	}
+	recordType := record[0]
+	payload := record[linux.TLS_HEADER_SIZE:]
+	if len(payload) < c.overhead()-linux.TLS_HEADER_SIZE {
+		return 0, nil, syserr.ErrInvalidDataMessage
+	}
+
+	var (
+		nonce      []byte
+		ciphertext []byte
+		aad        []byte
+	)
+	if c.version == linux.TLS_1_2_VERSION {
+		nonce = make([]byte, tlsNonceSize)
+		copy(nonce, c.salt[:])
+		copy(nonce[len(c.salt):], payload[:tlsExplicitIVSize])
+		ciphertext = payload[tlsExplicitIVSize:]
+		aad = c.additionalData(recordType, len(ciphertext)-tlsTagSize)
+	} else {
+		nonce = c.nonce()
+		ciphertext = payload
+		aad = record[:linux.TLS_HEADER_SIZE]
+	}
+	plaintext, err := aead.Open(ciphertext[:0], nonce, ciphertext, aad)
+	if err != nil {
+		return 0, nil, syserr.ErrInvalidDataMessage
+	}
+	if c.version == linux.TLS_1_3_VERSION {
+		// Strip the padding and recover the real content type.
+		i := len(plaintext) - 1
+		for i >= 0 && plaintext[i] == 0 {
+			i--
+		}
+		if i < 0 {
+			return 0, nil, syserr.ErrInvalidDataMessage
+		}
+		recordType = plaintext[i]
+		plaintext = plaintext[:i]
+	}
+	c.advance()
+	return recordType, plaintext, nil
+}
+
+// maxRecordSize returns the maximum size of a received record, including its
+// header.
+func (c *tlsCipherState) maxRecordSize() int {
+	return linux.TLS_MAX_PAYLOAD_SIZE + c.overhead()
+}
+
+// tlsState is the kernel TLS state of a TCP socket, analogous to struct
+// tls_context in Linux.
+//
+// +stateify savable
+type tlsState struct {
+	// ulp is set by setsockopt(TCP_ULP, "tls"). It is required before
+	// setting any SOL_TLS option.
+	ulp atomicbitops.Bool
+
+	// txEnabled and rxEnabled are set once tx and rx are configured, so
+	// that sockets without kernel TLS don't need to take locks.
+	txEnabled atomicbitops.Bool
+	rxEnabled atomicbitops.Bool
+
+	// rxReady is set when decrypted data is buffered in rxPlain, in which
+	// case the socket is readable even if the endpoint is not.
+	rxReady atomicbitops.Bool
+
+	// txMu serializes transmission of records.
+	txMu sync.Mutex `state:"nosave"`
+
+	// tx is the transmit crypto state.
+	// +checklocks:txMu
+	tx *tlsCipherState
+
+	// txPending holds the unsent part of the last record, which must be
+	// sent before any other data.
+	// +checklocks:txMu
+	txPending []byte
+
+	// rx is the receive crypto state. It and the below fields are protected
+	// by sock.readMu.
+	rx *tlsCipherState
+
+	// rxBuf holds a partially received record.
+	rxBuf []byte
+
+	// rxPlain holds the unread plaintext of the last decrypted record, whose
+	// type is rxType.
+	rxPlain []byte
+	rxType  uint8
+}
+
+// setSockOptTCPULP implements setsockopt(SOL_TCP, TCP_ULP).
+func (s *sock) setSockOptTCPULP(optVal []byte) *syserr.Error {
+	name := optVal[:min(len(optVal), tcpULPNameMax-1)]
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	if string(name) != tlsULPName {
+		return syserr.ErrNoFileOrDir
+	}
+
+	s.tls.txMu.Lock()
+	defer s.tls.txMu.Unlock()
+	if s.tls.ulp.Load() {
+		return syserr.ErrExists
+	}
+	if tcp.EndpointState(s.Endpoint.State()) != tcp.StateEstablished {
+		return syserr.ErrNotConnected
+	}
+	s.tls.ulp.Store(true)
+	return nil
+}
+
+// getSockOptTCPULP implements getsockopt(SOL_TCP, TCP_ULP).
+func (s *sock) getSockOptTCPULP(outLen int) (marshal.Marshallable, *syserr.Error) {
+	if outLen < 0 {
+		return nil, syserr.ErrInvalidArgument
+	}
+	var name primitive.ByteSlice
+	if s.tls.ulp.Load() {
+		name = primitive.ByteSlice(tlsULPName)
+	}
+	name = name[:min(len(name), outLen)]
+	return &name, nil
+}
+
+// setSockOptTLS implements setsockopt(SOL_TLS).
+func (s *sock) setSockOptTLS(name int, optVal []byte) *syserr.Error {
+	if !s.tls.ulp.Load() {
+		return syserr.ErrProtocolNotAvailable
+	}
+	switch name {
+	case linux.TLS_TX:
+		c, err := newTLSCipherState(optVal)
+		if err != nil {
+			return err
+		}
+		s.tls.txMu.Lock()
+		defer s.tls.txMu.Unlock()
+		if s.tls.tx != nil {
+			return syserr.ErrBusy
+		}
+		s.tls.tx = c
+		s.tls.txEnabled.Store(true)
+		return nil
+
+	case linux.TLS_RX:
+		c, err := newTLSCipherState(optVal)
+		if err != nil {
+			return err
+		}
+		s.readMu.Lock()
+		defer s.readMu.Unlock()
+		if s.tls.rx != nil {
+			return syserr.ErrBusy
+		}
+		// Data already received is interpreted as TLS records, so the
+		// caller must not have consumed part of a record.
+		s.tls.rx = c
+		s.tls.rxEnabled.Store(true)
+		return nil
+
+	default:
+		return syserr.ErrProtocolNotAvailable
+	}
+}
+
+// getSockOptTLS implements getsockopt(SOL_TLS).
+func (s *sock) getSockOptTLS(name int, outLen int) (marshal.Marshallable, *syserr.Error) {
+	if !s.tls.ulp.Load() {
+		return nil, syserr.ErrProtocolNotAvailable
+	}
+	if outLen < linux.SizeOfTLSCryptoInfo {
+		return nil, syserr.ErrInvalidArgument
+	}
+
+	var c *tlsCipherState
+	switch name {
+	case linux.TLS_TX:
+		s.tls.txMu.Lock()
+		defer s.tls.txMu.Unlock()
+		c = s.tls.tx
+	case linux.TLS_RX:
+		s.readMu.Lock()
+		defer s.readMu.Unlock()
+		c = s.tls.rx
+	default:
+		return nil, syserr.ErrProtocolNotAvailable
+	}
+	if c == nil {
+		return nil, syserr.ErrBusy
+	}
+
+	// Like Linux, return only the version and cipher if that's all the
+	// caller asked for.
+	if outLen == linux.SizeOfTLSCryptoInfo {
+		return &linux.TLSCryptoInfo{
+			Version:    c.version,
+			CipherType: c.cipherType,
+		}, nil
+	}
+	if outLen != c.cryptoInfoSize() {
+		return nil, syserr.ErrInvalidArgument
+	}
+	return c.cryptoInfo(), nil
+}
+
+// tlsSendSpace returns the free space in the endpoint's send buffer.
+func (s *sock) tlsSendSpace() (int, tcpip.Error) {
+	used, err := s.Endpoint.GetSockOptInt(tcpip.SendQueueSizeOption)
+	if err != nil {
+		return 0, err
+	}
+	return int(s.Endpoint.SocketOptions().GetSendBufferSize()) - used, nil
+}
+
+// tlsFlushLocked sends the unsent part of the last record.
+//
+// +checklocks:s.tls.txMu
+func (s *sock) tlsFlushLocked() tcpip.Error {
+	if len(s.tls.txPending) == 0 {
+		return nil
+	}
+	n, err := s.Endpoint.Write(bytes.NewReader(s.tls.txPending), tcpip.WriteOptions{Atomic: true})
+	s.tls.txPending = s.tls.txPending[n:]
+	if err != nil {
+		return err
+	}
+	if len(s.tls.txPending) != 0 {
+		return &tcpip.ErrWouldBlock{}
+	}
+	s.tls.txPending = nil
+	return nil
+}
+
+// tlsWrite encrypts data from src into records of the given type and queues
+// them for transmission. It returns the number of bytes consumed from src.
+//
+// Records are sized to fit in the free space of the send buffer, so that a
+// record is rarely left partially sent.
+func (s *sock) tlsWrite(ctx context.Context, src usermem.IOSequence, recordType uint8) (int64, tcpip.Error) {
+	s.tls.txMu.Lock()
+	defer s.tls.txMu.Unlock()
+
+	if err := s.tlsFlushLocked(); err != nil {
+		return 0, err
+	}
+	tx := s.tls.tx
+	var total int64
+	for src.NumBytes() > 0 {
+		space, err := s.tlsSendSpace()
+		if err != nil {
+			return total, err
+		}
+		size := min(int64(space-tx.overhead()), linux.TLS_MAX_PAYLOAD_SIZE, src.NumBytes())
+		if size <= 0 {
+			if total == 0 {
+				return 0, &tcpip.ErrWouldBlock{}
+			}
+			break
+		}
+		plaintext := make([]byte, size)
+		if _, err := src.CopyIn(ctx, plaintext); err != nil {
+			if total == 0 {
+				return 0, &tcpip.ErrBadBuffer{}
+			}
+			break
+		}
+		// Once sealed, the record consumes a sequence number and must be
+		// sent, so its data is reported as written even if the endpoint
+		// only accepts part of it.
+		s.tls.txPending = tx.seal(recordType, plaintext)
+		total += size
+		src = src.DropFirst64(size)
+		if err := s.tlsFlushLocked(); err != nil {
+			if _, ok := err.(*tcpip.ErrWouldBlock); ok {
+				break
+			}
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// tlsSendMsg implements sendmsg(2) for sockets with TLS_TX configured. The
+// record type may be set with a TLS_SET_RECORD_TYPE control message.
+func (s *sock) tlsSendMsg(t *kernel.Task, src usermem.IOSequence, flags int, haveDeadline bool, deadline ktime.Time, controlMessages socket.ControlMessages) (int, *syserr.Error) {
+	recordType := uint8(linux.TLS_RECORD_TYPE_DATA)
+	if controlMessages.IP.HasTLSRecordType {
+		recordType = controlMessages.IP.TLSRecordType
+	}
+
+	var (
+		total int64
+		entry waiter.Entry
+		ch    <-chan struct{}
+	)
+	for {
+		n, err := s.tlsWrite(t, src, recordType)
+		total += n
+		src = src.DropFirst64(n)
+		if flags&linux.MSG_DONTWAIT != 0 {
+			if total > 0 {
+				return int(total), nil
+			}
+			return 0, syserr.TranslateNetstackError(err)
+		}
+		block := true
+		switch err.(type) {
+		case nil:
+			block = src.NumBytes() != 0
+		case *tcpip.ErrWouldBlock:
+		default:
+			block = false
+		}
+		if block {
+			if ch == nil {
+				entry, ch = waiter.NewChannelEntry(waiter.WritableEvents)
+				s.EventRegister(&entry)
+				defer s.EventUnregister(&entry)
+			} else if err := t.BlockWithDeadline(ch, haveDeadline, deadline); err != nil {
+				if linuxerr.Equals(linuxerr.ETIMEDOUT, err) {
+					return int(total), syserr.ErrTryAgain
+				}
+				return int(total), syserr.FromError(err)
+			}
+			continue
+		}
+		if total > 0 {
+			return int(total), nil
+		}
+		return 0, syserr.TranslateNetstackError(err)
+	}
+}
+
+// tlsReceiveRecordLocked reads a complete record from the endpoint and
+// decrypts it into s.tls.rxPlain.
+//
+// Preconditions: s.readMu must be locked.
+func (s *sock) tlsReceiveRecordLocked() *syserr.Error {
+	rx := s.tls.rx
+	for {
+		need := linux.TLS_HEADER_SIZE
+		if len(s.tls.rxBuf) >= linux.TLS_HEADER_SIZE {
+			hdr := s.tls.rxBuf[:linux.TLS_HEADER_SIZE]
+			if binary.BigEndian.Uint16(hdr[1:]) != linux.TLS_1_2_VERSION {
+				return syserr.ErrInvalidArgument
+			}
+			need += int(binary.BigEndian.Uint16(hdr[3:]))
+			if need > rx.maxRecordSize() {
+				return syserr.ErrMessageTooLong
+			}
+			if len(s.tls.rxBuf) == need {
+				break
+			}
+		}
+
+		var buf bytes.Buffer
+		w := tcpip.LimitedWriter{
+			W: &buf,
+			N: int64(need - len(s.tls.rxBuf)),
+		}
+		_, err := s.Endpoint.Read(&w, tcpip.ReadOptions{})
+		if buf.Len() != 0 {
+			s.tls.rxBuf = append(s.tls.rxBuf, buf.Bytes()...)
+			s.Endpoint.ModerateRecvBuf(buf.Len())
+		}
+		if err != nil {
+			return syserr.TranslateNetstackError(err)
+		}
+	}
+
+	recordType, plaintext, err := rx.open(s.tls.rxBuf)
+	s.tls.rxBuf = nil
+	if err != nil {
+		return err
+	}
+	s.tls.rxType = recordType
+	s.tls.rxPlain = plaintext
+	return nil
+}
+
+// tlsNonBlockingRead copies decrypted data into dst. Records of different
+// types are never returned together, so that the type can be reported to
+// the caller. If wantType is non-zero, only records of that type are read.
+//
+// Records other than application data may only be read if allowControl is
+// true, i.e. if the caller can receive a TLS_GET_RECORD_TYPE control message.
+func (s *sock) tlsNonBlockingRead(ctx context.Context, dst usermem.IOSequence, peek, allowControl bool, wantType uint8) (int, uint8, *syserr.Error) {
+	s.readMu.Lock()
+	defer s.readMu.Unlock()
+	defer func() {
+		s.tls.rxReady.Store(len(s.tls.rxPlain) != 0)
+	}()
+
+	var n int
+	recordType := wantType
+	for dst.NumBytes() > 0 {
+		if len(s.tls.rxPlain) == 0 {
+			if err := s.tlsReceiveRecordLocked(); err != nil {
+				if n > 0 {
+					break
+				}
+				return 0, 0, err
+			}
+			continue
+		}
+		if recordType == 0 {
+			recordType = s.tls.rxType
+		} else if recordType != s.tls.rxType {
+			break
+		}
+		if recordType != linux.TLS_RECORD_TYPE_DATA && !allowControl {
+			return 0, 0, syserr.ErrIO
+		}
+
+		c, err := dst.CopyOut(ctx, s.tls.rxPlain[:min(int64(len(s.tls.rxPlain)), dst.NumBytes())])
+		n += c
+		if err != nil {
+			return n, recordType, syserr.FromError(err)
+		}
+		if peek {
+			break
+		}
+		s.tls.rxPlain = s.tls.rxPlain[c:]
+		dst = dst.DropFirst(c)
+		if recordType != linux.TLS_RECORD_TYPE_DATA {
+			// Like Linux, return one control record at a time.
+			break
+		}
+	}
+	return n, recordType, nil
+}
+
+// tlsRead implements read(2) for sockets with TLS_RX configured.
+func (s *sock) tlsRead(ctx context.Context, dst usermem.IOSequence) (int64, error) {
+	n, _, err := s.tlsNonBlockingRead(ctx, dst, false /* peek */, false /* allowControl */, 0 /* wantType */)
+	if err == syserr.ErrWouldBlock {
+		return int64(n), linuxerr.ErrWouldBlock
+	}
+	if err != nil {
+		return 0, err.ToError()
+	}
+	return int64(n), nil
+}
+
+// tlsRecvMsg implements recvmsg(2) for sockets with TLS_RX configured. The
+// type of the returned records is reported with a TLS_GET_RECORD_TYPE control
+// message.
+func (s *sock) tlsRecvMsg(t *kernel.Task, dst usermem.IOSequence, flags int, haveDeadline bool, deadline ktime.Time, controlDataLen uint64) (int, int, linux.SockAddr, uint32, socket.ControlMessages, *syserr.Error) {
+	peek := flags&linux.MSG_PEEK != 0
+	dontWait := flags&linux.MSG_DONTWAIT != 0
+	waitAll := flags&linux.MSG_WAITALL != 0
+	allowControl := controlDataLen >= uint64(linux.SizeOfControlMessageHeader+1)
+
+	cmsgs := func(recordType uint8) socket.ControlMessages {
+		if recordType == 0 || !allowControl {
+			return socket.ControlMessages{}
+		}
+		return socket.ControlMessages{
+			IP: socket.IPControlMessages{
+				HasTLSRecordType: true,
+				TLSRecordType:    recordType,
+			},
+		}
+	}
+
+	n, recordType, err := s.tlsNonBlockingRead(t, dst, peek, allowControl, 0 /* wantType */)
+	if err != nil && (err != syserr.ErrWouldBlock || dontWait) {
+		return 0, 0, nil, 0, socket.ControlMessages{}, err
+	}
+	if err == nil && (dontWait || !waitAll || recordType != linux.TLS_RECORD_TYPE_DATA || int64(n) >= dst.NumBytes()) {
+		return n, 0, nil, 0, cmsgs(recordType), nil
+	}
+	dst = dst.DropFirst(n)
+
+	e, ch := waiter.NewChannelEntry(waiter.ReadableEvents)
+	s.EventRegister(&e)
+	defer s.EventUnregister(&e)
+
+	for {
+		rn, rt, err := s.tlsNonBlockingRead(t, dst, peek, allowControl, recordType)
+		n += rn
+		if recordType == 0 {
+			recordType = rt
+		}
+		if err != nil && err != syserr.ErrWouldBlock {
+			if n > 0 {
+				err = nil
+			}
+			return n, 0, nil, 0, cmsgs(recordType), err
+		}
+		// A read of zero bytes means that the next record has a different
+		// type.
+		if err == nil && (rn == 0 || !waitAll || recordType != linux.TLS_RECORD_TYPE_DATA || int64(rn) >= dst.NumBytes()) {
+			return n, 0, nil, 0, cmsgs(recordType), nil
+		}
+		dst = dst.DropFirst(rn)
+
+		if err := t.BlockWithDeadline(ch, haveDeadline, deadline); err != nil {
+			if n > 0 {
+				return n, 0, nil, 0, cmsgs(recordType), nil
+			}
+			if linuxerr.Equals(linuxerr.ETIMEDOUT, err) {
+				return 0, 0, nil, 0, socket.ControlMessages{}, syserr.ErrTryAgain
+			}
+			return 0, 0, nil, 0, socket.ControlMessages{}, syserr.FromError(err)
+		}
+	}
+}
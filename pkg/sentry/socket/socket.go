@@ -25,6 +25,7 @@ import (
 	"golang.org/x/sys/unix"
 	"github.com/wilinz/gvisor/pkg/abi/linux"
 	"github.com/wilinz/gvisor/pkg/atomicbitops"
+	"github.com/wilinz/gvisor/pkg/buffer"
 	"github.com/wilinz/gvisor/pkg/context"
 	"github.com/wilinz/gvisor/pkg/hostarch"
 	"github.com/wilinz/gvisor/pkg/marshal"
@@ -76,6 +77,8 @@ func errOriginToLinux(origin tcpip.SockErrOrigin) uint8 {
 		return linux.SO_EE_ORIGIN_ICMP
 	case tcpip.SockExtErrorOriginICMP6:
 		return linux.SO_EE_ORIGIN_ICMP6
+	case tcpip.SockExtErrorOriginTimestamping:
+		return linux.SO_EE_ORIGIN_TIMESTAMPING
 	default:
 		panic(fmt.Sprintf("unknown socket origin: %d", origin))
 	}
@@ -89,12 +92,19 @@ func sockErrCmsgToLinux(sockErr *tcpip.SockError) linux.SockErrCMsg {
 	}
 
 	ee := linux.SockExtendedErr{
-		Errno:  uint32(syserr.TranslateNetstackError(sockErr.Err).ToLinux()),
 		Origin: errOriginToLinux(sockErr.Cause.Origin()),
 		Type:   sockErr.Cause.Type(),
 		Code:   sockErr.Cause.Code(),
 		Info:   sockErr.Cause.Info(),
 	}
+	if ts, ok := sockErr.Cause.(*tcpip.TimestampingSockError); ok {
+		// Transmit timestamps are reported as ENOMSG errors, with the
+		// SOF_TIMESTAMPING_OPT_ID key as data.
+		ee.Errno = uint32(syserr.ErrNoMessage.ToLinux())
+		ee.Data = ts.Key
+	} else {
+		ee.Errno = uint32(syserr.TranslateNetstackError(sockErr.Err).ToLinux())
+	}
 
 	switch sockErr.NetProto {
 	case header.IPv4ProtocolNumber:
@@ -141,6 +151,10 @@ func NewIPControlMessages(family int, cmgs tcpip.ReceivableControlMessages) IPCo
 		HasIPv6PacketInfo:  cmgs.HasIPv6PacketInfo,
 		OriginalDstAddress: orgDstAddr,
 		SockErr:            sockErrCmsgToLinux(cmgs.SockErr),
+		HasGROSize:         cmgs.HasGROSize,
+		GROSize:            cmgs.GROSize,
+		HasDropCount:       cmgs.HasDropCount,
+		DropCount:          cmgs.DropCount,
 	}
 
 	if cm.HasIPv6PacketInfo {
@@ -210,6 +224,38 @@ type IPControlMessages struct {
 
 	// SockErr is the dequeued socket error on recvmsg(MSG_ERRQUEUE).
 	SockErr linux.SockErrCMsg
+
+	// HasTLSRecordType indicates whether TLSRecordType is valid/set.
+	HasTLSRecordType bool
+
+	// TLSRecordType is the content type of a kernel TLS record.
+	TLSRecordType uint8
+
+	// HasGSOSize indicates whether GSOSize is valid/set.
+	HasGSOSize bool
+
+	// GSOSize is the size of the UDP segments an outgoing datagram is split
+	// into.
+	GSOSize uint16
+
+	// HasGROSize indicates whether GROSize is valid/set.
+	HasGROSize bool
+
+	// GROSize is the size of the UDP datagrams coalesced into the read data.
+	GROSize uint16
+
+	// HasDropCount indicates whether DropCount is valid/set.
+	HasDropCount bool
+
+	// DropCount is the number of packets dropped by the socket.
+	DropCount uint32
+
+	// HasTimestamping indicates whether Timestamping is valid/set.
+	HasTimestamping bool
+
+	// Timestamping is the software timestamp reported by an
+	// SCM_TIMESTAMPING control message.
+	Timestamping time.Time `state:".(int64)"`
 }
 
 // Release releases Unix domain socket credentials and rights.
@@ -300,6 +346,27 @@ type Socket interface {
 	Type() (family int, skType linux.SockType, protocol int)
 }
 
+// BufferWriter may be implemented by Sockets that can send data held in a
+// buffer.Buffer without copying it, e.g. for sendfile(2).
+type BufferWriter interface {
+	// WriteBuffer sends a prefix of buf without blocking, removes the bytes
+	// sent from the front of buf, and returns their number. The contents of
+	// buf must not be modified; the socket may hold references to them until
+	// they have been acknowledged by the peer.
+	//
+	// WriteBuffer returns EOPNOTSUPP if the socket can't currently send data
+	// this way, in which case nothing is sent.
+	WriteBuffer(t *kernel.Task, buf *buffer.Buffer) (int64, error)
+}
+
+// HostFileSender may be implemented by Sockets backed by a host socket, which
+// can send data directly from a host file descriptor.
+type HostFileSender interface {
+	// SendfileFromHostFD sends up to count bytes read from hostFD at offset
+	// without blocking, and returns the number of bytes sent.
+	SendfileFromHostFD(t *kernel.Task, hostFD int32, offset, count int64) (int64, error)
+}
+
 // Provider is the interface implemented by providers of sockets for
 // specific address families (e.g., AF_INET).
 type Provider interface {
@@ -583,13 +650,14 @@ func AddressAndFamily(addr []byte) (tcpip.FullAddress, uint16, *syserr.Error) {
 	}
 }
 
-// IsTCP returns true if the socket is a TCP socket.
+// IsTCP returns true if the socket is a TCP socket. MPTCP sockets are TCP
+// sockets as well.
 func IsTCP(s Socket) bool {
 	fam, typ, proto := s.Type()
 	if fam != linux.AF_INET && fam != linux.AF_INET6 {
 		return false
 	}
-	return typ == linux.SOCK_STREAM && (proto == 0 || proto == linux.IPPROTO_TCP)
+	return typ == linux.SOCK_STREAM && (proto == 0 || proto == linux.IPPROTO_TCP || proto == linux.IPPROTO_MPTCP)
 }
 
 // IsUDP returns true if the socket is a UDP socket.
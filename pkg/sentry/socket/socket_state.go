@@ -26,3 +26,11 @@ func (i *IPControlMessages) saveTimestamp() int64 {
 func (i *IPControlMessages) loadTimestamp(_ context.Context, nsec int64) {
 	i.Timestamp = time.Unix(0, nsec)
 }
+
+func (i *IPControlMessages) saveTimestamping() int64 {
+	return i.Timestamping.UnixNano()
+}
+
+func (i *IPControlMessages) loadTimestamping(_ context.Context, nsec int64) {
+	i.Timestamping = time.Unix(0, nsec)
+}
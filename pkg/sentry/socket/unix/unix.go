@@ -864,6 +864,12 @@ func (s *Socket) Type() (family int, skType linux.SockType, protocol int) {
 	return linux.AF_UNIX, s.stype, 0
 }
 
+// NetworkNamespace returns the network namespace the socket was created in,
+// which is nil for sockets created outside of any task.
+func (s *Socket) NetworkNamespace() *inet.Namespace {
+	return s.namespace
+}
+
 func convertAddress(addr transport.Address) (linux.SockAddr, uint32) {
 	var out linux.SockAddrUnix
 	out.Family = linux.AF_UNIX
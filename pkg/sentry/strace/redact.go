@@ -0,0 +1,194 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package strace
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/wilinz/gvisor/pkg/abi"
+	"github.com/wilinz/gvisor/pkg/hostarch"
+	"github.com/wilinz/gvisor/pkg/sentry/arch"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+)
+
+// RedactAction is applied to a syscall argument before it is sent to seccheck
+// sinks.
+type RedactAction int
+
+const (
+	// RedactNone sends the argument as formatted in strace logs.
+	RedactNone RedactAction = iota
+
+	// RedactOmit replaces the argument with a placeholder.
+	RedactOmit
+
+	// RedactHash replaces the argument with the SHA-256 hash of its value.
+	// For data buffers, e.g. the buffer of write(2), the hash is computed
+	// over the contents of the buffer rather than its formatted value.
+	RedactHash
+)
+
+// redactedArg replaces arguments redacted with RedactOmit.
+const redactedArg = "<redacted>"
+
+// redactHashMaximumSize is the maximum number of bytes of a data buffer that
+// are hashed by RedactHash. Larger buffers are truncated.
+const redactHashMaximumSize = 64 << 10
+
+// allSyscalls is the syscall name of rules that apply to all syscalls.
+const allSyscalls = "*"
+
+var redactActions = map[string]RedactAction{
+	"none": RedactNone,
+	"omit": RedactOmit,
+	"hash": RedactHash,
+}
+
+// RedactionPolicy determines how the arguments of straces sent to seccheck
+// sinks are redacted.
+type RedactionPolicy struct {
+	// rules maps syscall names, or "*" for all syscalls, to the actions for
+	// their arguments, by argument index.
+	rules map[string]map[int]RedactAction
+}
+
+// ParseRedactionPolicy parses a comma-separated list of redaction rules of the
+// form "syscall:arg=action", where arg is the 0-based index of the argument
+// and action is one of "none", "omit" or "hash". The syscall "*" matches all
+// syscalls, and rules naming a syscall take precedence over it. For example,
+// "write:1=hash,*:0=omit" hashes the contents of write(2) buffers and omits
+// the first argument of every other syscall.
+func ParseRedactionPolicy(s string) (*RedactionPolicy, error) {
+	p := &RedactionPolicy{rules: make(map[string]map[int]RedactAction)}
+	if s == "" {
+		return p, nil
+	}
+	table, _ := Lookup(abi.Host, arch.Host)
+	for _, rule := range strings.Split(s, ",") {
+		name, rest, ok := strings.Cut(rule, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid redaction rule %q: want syscall:arg=action", rule)
+		}
+		argStr, actionStr, ok := strings.Cut(rest, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid redaction rule %q: want syscall:arg=action", rule)
+		}
+		if name != allSyscalls {
+			if _, ok := table.ConvertToSysno(name); !ok {
+				return nil, fmt.Errorf("invalid redaction rule %q: syscall %q not found", rule, name)
+			}
+		}
+		arg, err := strconv.Atoi(argStr)
+		if err != nil || arg < 0 || arg >= len(arch.SyscallArguments{}) {
+			return nil, fmt.Errorf("invalid redaction rule %q: invalid argument %q", rule, argStr)
+		}
+		action, ok := redactActions[actionStr]
+		if !ok {
+			return nil, fmt.Errorf("invalid redaction rule %q: invalid action %q", rule, actionStr)
+		}
+		if p.rules[name] == nil {
+			p.rules[name] = make(map[int]RedactAction)
+		}
+		p.rules[name][arg] = action
+	}
+	return p, nil
+}
+
+// action returns the action for argument arg of the syscall name.
+func (p *RedactionPolicy) action(name string, arg int) RedactAction {
+	if action, ok := p.rules[name][arg]; ok {
+		return action
+	}
+	return p.rules[allSyscalls][arg]
+}
+
+// redactionPolicy is the policy applied to straces sent to seccheck sinks. If
+// nil, arguments are sent unredacted.
+var redactionPolicy atomic.Pointer[RedactionPolicy]
+
+// SetRedactionPolicy sets the policy applied to the arguments of straces sent
+// to seccheck sinks. A nil policy disables redaction.
+func SetRedactionPolicy(p *RedactionPolicy) {
+	redactionPolicy.Store(p)
+}
+
+// redact returns output, the formatted arguments of a syscall, with the
+// current redaction policy applied. output is never modified, since it is
+// reused on syscall exit. filled is true if the arguments formatted after
+// syscall execution have been filled in by post.
+func (i *SyscallInfo) redact(t *kernel.Task, args arch.SyscallArguments, output []string, rval uintptr, filled bool) []string {
+	p := redactionPolicy.Load()
+	if p == nil {
+		return output
+	}
+	var redacted []string
+	for arg := range output {
+		action := p.action(i.name, arg)
+		if action == RedactNone {
+			continue
+		}
+		if redacted == nil {
+			redacted = append([]string(nil), output...)
+		}
+		switch action {
+		case RedactOmit:
+			redacted[arg] = redactedArg
+		case RedactHash:
+			redacted[arg] = i.hashArg(t, args, arg, output[arg], rval, filled)
+		}
+	}
+	if redacted == nil {
+		return output
+	}
+	return redacted
+}
+
+// hashArg returns the SHA-256 hash of argument arg, whose formatted value is
+// formatted.
+func (i *SyscallInfo) hashArg(t *kernel.Task, args arch.SyscallArguments, arg int, formatted string, rval uintptr, filled bool) string {
+	var format FormatSpecifier
+	if arg < len(i.format) {
+		format = i.format[arg]
+	}
+	switch {
+	case format == WriteBuffer:
+		return hashBuffer(t, args[arg].Pointer(), args[arg+1].SizeT())
+	case format == ReadBuffer && filled:
+		return hashBuffer(t, args[arg].Pointer(), uint(rval))
+	default:
+		sum := sha256.Sum256([]byte(formatted))
+		return "sha256:" + hex.EncodeToString(sum[:])
+	}
+}
+
+// hashBuffer returns the SHA-256 hash of the size bytes at addr, truncated to
+// redactHashMaximumSize.
+func hashBuffer(t *kernel.Task, addr hostarch.Addr, size uint) string {
+	if size > redactHashMaximumSize {
+		size = redactHashMaximumSize
+	}
+	b := make([]byte, size)
+	n, err := t.CopyInBytes(addr, b)
+	if err != nil {
+		return fmt.Sprintf("%#x (error reading buffer: %s)", addr, err)
+	}
+	sum := sha256.Sum256(b[:n])
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
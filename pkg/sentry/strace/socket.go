@@ -158,9 +158,10 @@ var SocketProtocol = map[int32]abi.ValueSet{
 }
 
 var controlMessageType = map[int32]string{
-	linux.SCM_RIGHTS:      "SCM_RIGHTS",
-	linux.SCM_CREDENTIALS: "SCM_CREDENTIALS",
-	linux.SO_TIMESTAMP:    "SO_TIMESTAMP",
+	linux.SCM_RIGHTS:       "SCM_RIGHTS",
+	linux.SCM_CREDENTIALS:  "SCM_CREDENTIALS",
+	linux.SO_TIMESTAMP:     "SO_TIMESTAMP",
+	linux.SCM_TIMESTAMPING: "SCM_TIMESTAMPING",
 }
 
 func unmarshalControlMessageRights(src []byte) []primitive.Int32 {
@@ -547,6 +548,7 @@ var sockOptNames = map[uint64]abi.ValueSet{
 		linux.SO_RCVTIMEO:     "SO_RCVTIMEO",
 		linux.SO_OOBINLINE:    "SO_OOBINLINE",
 		linux.SO_TIMESTAMP:    "SO_TIMESTAMP",
+		linux.SO_TIMESTAMPING: "SO_TIMESTAMPING",
 		linux.SO_ACCEPTCONN:   "SO_ACCEPTCONN",
 	},
 	linux.SOL_TCP: {
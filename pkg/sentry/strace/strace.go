@@ -30,6 +30,8 @@ import (
 	"github.com/wilinz/gvisor/pkg/seccomp"
 	"github.com/wilinz/gvisor/pkg/sentry/arch"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+	"github.com/wilinz/gvisor/pkg/sentry/seccheck"
+	spb "github.com/wilinz/gvisor/pkg/sentry/seccheck/points/points_go_proto"
 	pb "github.com/wilinz/gvisor/pkg/sentry/strace/strace_go_proto"
 	slinux "github.com/wilinz/gvisor/pkg/sentry/syscalls/linux"
 
@@ -48,6 +50,11 @@ var LogMaximumSize uint = DefaultLogMaximumSize
 // do anything useful with binary text dump of byte array arguments.
 var EventMaximumSize uint
 
+// SeccheckMaximumSize determines the maximum size for data blobs (read, write,
+// etc.) sent to seccheck sinks. Default is 0 so that application data is not
+// sent unless requested.
+var SeccheckMaximumSize uint
+
 // LogAppDataAllowed is set to true when printing application data in strace
 // logs is allowed.
 var LogAppDataAllowed = true
@@ -661,13 +668,61 @@ func (i *SyscallInfo) sendExit(t *kernel.Task, elapsed time.Duration, output []s
 	eventchannel.Emit(&event)
 }
 
+// sendSeccheckEnter sends the syscall enter to seccheck sinks.
+func (i *SyscallInfo) sendSeccheckEnter(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) []string {
+	output := i.pre(t, args, SeccheckMaximumSize)
+
+	info := &spb.StraceInfo{
+		Sysno: uint64(sysno),
+		Name:  i.name,
+		Args:  i.redact(t, args, output, 0 /* rval */, false /* filled */),
+	}
+	i.sendSeccheck(t, info)
+
+	return output
+}
+
+// sendSeccheckExit sends the syscall exit to seccheck sinks.
+func (i *SyscallInfo) sendSeccheckExit(t *kernel.Task, sysno uintptr, elapsed time.Duration, output []string, args arch.SyscallArguments, rval uintptr, err error, errno int) {
+	if err == nil {
+		// Fill in the output after successful execution.
+		i.post(t, args, rval, output, SeccheckMaximumSize)
+	}
+
+	info := &spb.StraceInfo{
+		Sysno:     uint64(sysno),
+		Name:      i.name,
+		Exit:      true,
+		Args:      i.redact(t, args, output, rval, err == nil /* filled */),
+		Return:    int64(rval),
+		ElapsedNs: elapsed.Nanoseconds(),
+	}
+	if err != nil {
+		info.Errorno = int32(errno)
+	}
+	i.sendSeccheck(t, info)
+}
+
+// sendSeccheck sends info to the seccheck sinks.
+func (i *SyscallInfo) sendSeccheck(t *kernel.Task, info *spb.StraceInfo) {
+	fields := seccheck.Global.GetFieldSet(seccheck.PointStrace)
+	if !fields.Context.Empty() {
+		info.ContextData = &spb.ContextData{}
+		kernel.LoadSeccheckData(t, fields.Context, info.ContextData)
+	}
+	seccheck.Global.SentToSinks(func(c seccheck.Sink) error {
+		return c.Strace(t, fields, info)
+	})
+}
+
 type syscallContext struct {
-	info        SyscallInfo
-	args        arch.SyscallArguments
-	start       time.Time
-	logOutput   []string
-	eventOutput []string
-	flags       uint32
+	info           SyscallInfo
+	args           arch.SyscallArguments
+	start          time.Time
+	logOutput      []string
+	eventOutput    []string
+	seccheckOutput []string
+	flags          uint32
 }
 
 // SyscallEnter implements kernel.Stracer.SyscallEnter. It logs the syscall
@@ -681,21 +736,28 @@ func (s SyscallMap) SyscallEnter(t *kernel.Task, sysno uintptr, args arch.Syscal
 		}
 	}
 
-	var output, eventOutput []string
+	var output, eventOutput, seccheckOutput []string
 	if bits.IsOn32(flags, kernel.StraceEnableLog) {
 		output = info.printEnter(t, args)
 	}
 	if bits.IsOn32(flags, kernel.StraceEnableEvent) {
 		eventOutput = info.sendEnter(t, args)
 	}
+	if bits.IsOn32(flags, kernel.StraceEnableSeccheck) && seccheck.Global.Enabled(seccheck.PointStrace) {
+		seccheckOutput = info.sendSeccheckEnter(t, sysno, args)
+	} else {
+		// Don't send an exit without the corresponding enter.
+		flags &^= kernel.StraceEnableSeccheck
+	}
 
 	return &syscallContext{
-		info:        info,
-		args:        args,
-		start:       time.Now(),
-		logOutput:   output,
-		eventOutput: eventOutput,
-		flags:       flags,
+		info:           info,
+		args:           args,
+		start:          time.Now(),
+		logOutput:      output,
+		eventOutput:    eventOutput,
+		seccheckOutput: seccheckOutput,
+		flags:          flags,
 	}
 }
 
@@ -712,6 +774,9 @@ func (s SyscallMap) SyscallExit(context any, t *kernel.Task, sysno, rval uintptr
 	if bits.IsOn32(c.flags, kernel.StraceEnableEvent) {
 		c.info.sendExit(t, elapsed, c.eventOutput, c.args, rval, err, errno)
 	}
+	if bits.IsOn32(c.flags, kernel.StraceEnableSeccheck) && seccheck.Global.Enabled(seccheck.PointStrace) {
+		c.info.sendSeccheckExit(t, sysno, elapsed, c.seccheckOutput, c.args, rval, err, errno)
+	}
 }
 
 // ConvertToSysnoMap converts the names to a map keyed on the syscall number
@@ -782,6 +847,10 @@ const (
 
 	// SinkTypeEvent sends strace to event log
 	SinkTypeEvent
+
+	// SinkTypeSeccheck sends straces to the seccheck sinks configured for
+	// the sentry/strace point.
+	SinkTypeSeccheck
 )
 
 func convertToSyscallFlag(sinks SinkType) uint32 {
@@ -792,6 +861,9 @@ func convertToSyscallFlag(sinks SinkType) uint32 {
 	if bits.IsOn32(uint32(sinks), uint32(SinkTypeEvent)) {
 		ret |= kernel.StraceEnableEvent
 	}
+	if bits.IsOn32(uint32(sinks), uint32(SinkTypeSeccheck)) {
+		ret |= kernel.StraceEnableSeccheck
+	}
 	return ret
 }
 
@@ -0,0 +1,209 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+import (
+	"github.com/wilinz/gvisor/pkg/abi"
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/hostarch"
+	"github.com/wilinz/gvisor/pkg/sentry/arch"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+	"github.com/wilinz/gvisor/pkg/sentry/syscalls"
+)
+
+// IA32 is a table of the Linux i386 syscall API, used by 32-bit binaries that
+// run in the compatibility mode of amd64, with the corresponding syscall
+// numbers from arch/x86/entry/syscalls/syscall_32.tbl.
+//
+// Only syscalls whose arguments and structures have the same layout in both
+// ABIs, or that are translated in sys_compat.go, are included. Syscalls that
+// are missing from the table fail with ENOSYS. Seccheck points are keyed by
+// amd64 syscall numbers, so none of the syscalls below have points.
+var IA32 = &kernel.SyscallTable{
+	OS:   abi.Linux,
+	Arch: arch.AMD64,
+	Version: kernel.Version{
+		Sysname: LinuxSysname,
+		Release: LinuxRelease,
+		Version: LinuxVersion,
+	},
+	AuditNumber: linux.AUDIT_ARCH_I386,
+	Table: map[uintptr]kernel.Syscall{
+		1:   syscalls.Supported("exit", Exit),
+		2:   syscalls.Supported("fork", Fork),
+		3:   syscalls.Supported("read", Read),
+		4:   syscalls.Supported("write", Write),
+		5:   syscalls.Supported("open", Open),
+		6:   syscalls.Supported("close", Close),
+		7:   syscalls.Supported("waitpid", WaitPid),
+		8:   syscalls.Supported("creat", Creat),
+		9:   syscalls.Supported("link", Link),
+		10:  syscalls.Supported("unlink", Unlink),
+		11:  syscalls.Supported("execve", Execve),
+		12:  syscalls.Supported("chdir", Chdir),
+		13:  syscalls.Supported("time", Time32),
+		14:  syscalls.Supported("mknod", Mknod),
+		15:  syscalls.Supported("chmod", Chmod),
+		19:  syscalls.Supported("lseek", Lseek32),
+		20:  syscalls.Supported("getpid", Getpid),
+		27:  syscalls.Supported("alarm", Alarm),
+		29:  syscalls.Supported("pause", Pause),
+		33:  syscalls.Supported("access", Access),
+		36:  syscalls.Supported("sync", Sync),
+		37:  syscalls.Supported("kill", Kill),
+		38:  syscalls.Supported("rename", Rename),
+		39:  syscalls.Supported("mkdir", Mkdir),
+		40:  syscalls.Supported("rmdir", Rmdir),
+		41:  syscalls.Supported("dup", Dup),
+		42:  syscalls.Supported("pipe", Pipe),
+		45:  syscalls.Supported("brk", Brk),
+		54:  syscalls.PartiallySupported("ioctl", Ioctl, "Requests whose structures differ in the 32-bit ABI are not translated.", nil),
+		55:  syscalls.PartiallySupported("fcntl", Fcntl32, "Record locks are not supported.", nil),
+		57:  syscalls.Supported("setpgid", Setpgid),
+		60:  syscalls.Supported("umask", Umask),
+		61:  syscalls.Supported("chroot", Chroot),
+		63:  syscalls.Supported("dup2", Dup2),
+		64:  syscalls.Supported("getppid", Getppid),
+		65:  syscalls.Supported("getpgrp", Getpgrp),
+		66:  syscalls.Supported("setsid", Setsid),
+		74:  syscalls.Supported("sethostname", Sethostname),
+		75:  syscalls.PartiallySupported("setrlimit", Setrlimit, "Not all rlimits are enforced.", nil),
+		77:  syscalls.PartiallySupported("getrusage", Getrusage, "Fields ru_maxrss, ru_minflt, ru_majflt, ru_inblock, ru_oublock are not supported. Fields ru_utime and ru_stime have low precision.", nil),
+		78:  syscalls.Supported("gettimeofday", Gettimeofday),
+		83:  syscalls.Supported("symlink", Symlink),
+		85:  syscalls.Supported("readlink", Readlink),
+		91:  syscalls.Supported("munmap", Munmap),
+		94:  syscalls.Supported("fchmod", Fchmod),
+		96:  syscalls.PartiallySupported("getpriority", Getpriority, "Stub implementation.", nil),
+		97:  syscalls.PartiallySupported("setpriority", Setpriority, "Stub implementation.", nil),
+		101: syscalls.PartiallySupported("ioperm", Ioperm, "Only grants access to the I/O ports emulated with --emulated-ioports.", nil),
+		110: syscalls.PartiallySupported("iopl", Iopl, "Only grants access to the I/O ports emulated with --emulated-ioports.", nil),
+		114: syscalls.Supported("wait4", Wait4),
+		118: syscalls.Supported("fsync", Fsync),
+		119: syscalls.Supported("sigreturn", Sigreturn),
+		120: syscalls.PartiallySupported("clone", Clone32, "Option CLONE_SETTLS is not supported, in addition to the options that clone(2) doesn't support on amd64.", nil),
+		122: syscalls.Supported("uname", Uname),
+		125: syscalls.Supported("mprotect", Mprotect),
+		132: syscalls.Supported("getpgid", Getpgid),
+		133: syscalls.Supported("fchdir", Fchdir),
+		140: syscalls.Supported("_llseek", Llseek),
+		143: syscalls.Supported("flock", Flock),
+		145: syscalls.Supported("readv", Readv),
+		146: syscalls.Supported("writev", Writev),
+		147: syscalls.Supported("getsid", Getsid),
+		148: syscalls.Supported("fdatasync", Fdatasync),
+		158: syscalls.Supported("sched_yield", SchedYield),
+		162: syscalls.Supported("nanosleep", Nanosleep),
+		163: syscalls.Supported("mremap", Mremap),
+		168: syscalls.Supported("poll", Poll),
+		172: syscalls.PartiallySupported("prctl", Prctl, "Not all options are supported.", nil),
+		173: syscalls.Supported("rt_sigreturn", RtSigreturn),
+		174: syscalls.Supported("rt_sigaction", RtSigaction32),
+		175: syscalls.Supported("rt_sigprocmask", RtSigprocmask),
+		176: syscalls.Supported("rt_sigpending", RtSigpending),
+		179: syscalls.Supported("rt_sigsuspend", RtSigsuspend),
+		180: syscalls.Supported("pread64", Pread64Compat),
+		181: syscalls.Supported("pwrite64", Pwrite64Compat),
+		183: syscalls.Supported("getcwd", Getcwd),
+		184: syscalls.Supported("capget", Capget),
+		185: syscalls.Supported("capset", Capset),
+		190: syscalls.Supported("vfork", Vfork),
+		191: syscalls.Supported("ugetrlimit", Getrlimit),
+		192: syscalls.Supported("mmap2", Mmap2),
+		193: syscalls.Supported("truncate64", Truncate64),
+		194: syscalls.Supported("ftruncate64", Ftruncate64),
+		195: syscalls.Supported("stat64", Stat),
+		196: syscalls.Supported("lstat64", Lstat),
+		197: syscalls.Supported("fstat64", Fstat),
+		198: syscalls.Supported("lchown32", Lchown),
+		199: syscalls.Supported("getuid32", Getuid),
+		200: syscalls.Supported("getgid32", Getgid),
+		201: syscalls.Supported("geteuid32", Geteuid),
+		202: syscalls.Supported("getegid32", Getegid),
+		203: syscalls.Supported("setreuid32", Setreuid),
+		204: syscalls.Supported("setregid32", Setregid),
+		205: syscalls.Supported("getgroups32", Getgroups),
+		206: syscalls.Supported("setgroups32", Setgroups),
+		207: syscalls.Supported("fchown32", Fchown),
+		208: syscalls.Supported("setresuid32", Setresuid),
+		209: syscalls.Supported("getresuid32", Getresuid),
+		210: syscalls.Supported("setresgid32", Setresgid),
+		211: syscalls.Supported("getresgid32", Getresgid),
+		212: syscalls.Supported("chown32", Chown),
+		213: syscalls.Supported("setuid32", Setuid),
+		214: syscalls.Supported("setgid32", Setgid),
+		219: syscalls.PartiallySupported("madvise", Madvise, "Options MADV_DONTNEED, MADV_DONTFORK are supported. Other advice is ignored.", nil),
+		220: syscalls.Supported("getdents64", Getdents64),
+		221: syscalls.PartiallySupported("fcntl64", Fcntl32, "Record locks are not supported.", nil),
+		224: syscalls.Supported("gettid", Gettid),
+		238: syscalls.Supported("tkill", Tkill),
+		240: syscalls.Supported("futex", Futex),
+		242: syscalls.PartiallySupported("sched_getaffinity", SchedGetaffinity, "Stub implementation.", nil),
+		243: syscalls.ErrorWithEvent("set_thread_area", linuxerr.ENOSYS, "TLS segments are not supported in 32-bit compatibility mode.", nil),
+		244: syscalls.ErrorWithEvent("get_thread_area", linuxerr.ENOSYS, "TLS segments are not supported in 32-bit compatibility mode.", nil),
+		252: syscalls.Supported("exit_group", ExitGroup),
+		254: syscalls.Supported("epoll_create", EpollCreate),
+		255: syscalls.Supported("epoll_ctl", EpollCtl),
+		256: syscalls.Supported("epoll_wait", EpollWait),
+		258: syscalls.Supported("set_tid_address", SetTidAddress),
+		265: syscalls.Supported("clock_gettime", ClockGettime),
+		266: syscalls.Supported("clock_getres", ClockGetres),
+		270: syscalls.Supported("tgkill", Tgkill),
+		295: syscalls.Supported("openat", Openat),
+		296: syscalls.Supported("mkdirat", Mkdirat),
+		297: syscalls.Supported("mknodat", Mknodat),
+		298: syscalls.Supported("fchownat", Fchownat),
+		300: syscalls.Supported("fstatat64", Newfstatat),
+		301: syscalls.Supported("unlinkat", Unlinkat),
+		302: syscalls.Supported("renameat", Renameat),
+		303: syscalls.Supported("linkat", Linkat),
+		304: syscalls.Supported("symlinkat", Symlinkat),
+		305: syscalls.Supported("readlinkat", Readlinkat),
+		306: syscalls.Supported("fchmodat", Fchmodat),
+		307: syscalls.Supported("faccessat", Faccessat),
+		328: syscalls.Supported("eventfd2", Eventfd2),
+		329: syscalls.Supported("epoll_create1", EpollCreate1),
+		330: syscalls.Supported("dup3", Dup3),
+		331: syscalls.Supported("pipe2", Pipe2),
+		340: syscalls.Supported("prlimit64", Prlimit64),
+		353: syscalls.Supported("renameat2", Renameat2),
+		355: syscalls.Supported("getrandom", GetRandom),
+		356: syscalls.Supported("memfd_create", MemfdCreate),
+		359: syscalls.Supported("socket", Socket),
+		360: syscalls.Supported("socketpair", SocketPair),
+		361: syscalls.Supported("bind", Bind),
+		362: syscalls.Supported("connect", Connect),
+		363: syscalls.Supported("listen", Listen),
+		364: syscalls.Supported("accept4", Accept4),
+		365: syscalls.PartiallySupported("getsockopt", GetSockOpt, "Options whose values differ in the 32-bit ABI, such as SO_RCVTIMEO, are not translated.", nil),
+		366: syscalls.PartiallySupported("setsockopt", SetSockOpt, "Options whose values differ in the 32-bit ABI, such as SO_RCVTIMEO, are not translated.", nil),
+		367: syscalls.Supported("getsockname", GetSockName),
+		368: syscalls.Supported("getpeername", GetPeerName),
+		369: syscalls.Supported("sendto", SendTo),
+		370: syscalls.Supported("recvfrom", RecvFrom),
+		373: syscalls.Supported("shutdown", Shutdown),
+		383: syscalls.Supported("statx", Statx),
+		436: syscalls.Supported("close_range", CloseRange),
+		439: syscalls.Supported("faccessat2", Faccessat2),
+	},
+	Emulate: map[hostarch.Addr]uintptr{},
+	Missing: func(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+		// Unimplemented events are reported with amd64 syscall numbers,
+		// so don't emit them for i386 ones.
+		t.Debugf("Unsupported i386 syscall %d", sysno)
+		return 0, linuxerr.ENOSYS
+	},
+}
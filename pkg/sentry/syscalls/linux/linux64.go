@@ -194,12 +194,12 @@ var AMD64 = &kernel.SyscallTable{
 		139: syscalls.ErrorWithEvent("sysfs", linuxerr.ENOSYS, "", []string{"gvisor.dev/issue/165"}),
 		140: syscalls.PartiallySupported("getpriority", Getpriority, "Stub implementation.", nil),
 		141: syscalls.PartiallySupported("setpriority", Setpriority, "Stub implementation.", nil),
-		142: syscalls.CapError("sched_setparam", linux.CAP_SYS_NICE, "", nil),
-		143: syscalls.PartiallySupported("sched_getparam", SchedGetparam, "Stub implementation.", nil),
-		144: syscalls.PartiallySupported("sched_setscheduler", SchedSetscheduler, "Stub implementation.", nil),
-		145: syscalls.PartiallySupported("sched_getscheduler", SchedGetscheduler, "Stub implementation.", nil),
-		146: syscalls.PartiallySupported("sched_get_priority_max", SchedGetPriorityMax, "Stub implementation.", nil),
-		147: syscalls.PartiallySupported("sched_get_priority_min", SchedGetPriorityMin, "Stub implementation.", nil),
+		142: syscalls.PartiallySupported("sched_setparam", SchedSetparam, "Scheduling policies and priorities are recorded but not enforced.", nil),
+		143: syscalls.PartiallySupported("sched_getparam", SchedGetparam, "Scheduling policies and priorities are recorded but not enforced.", nil),
+		144: syscalls.PartiallySupported("sched_setscheduler", SchedSetscheduler, "Scheduling policies and priorities are recorded but not enforced.", nil),
+		145: syscalls.PartiallySupported("sched_getscheduler", SchedGetscheduler, "Scheduling policies and priorities are recorded but not enforced.", nil),
+		146: syscalls.Supported("sched_get_priority_max", SchedGetPriorityMax),
+		147: syscalls.Supported("sched_get_priority_min", SchedGetPriorityMin),
 		148: syscalls.ErrorWithEvent("sched_rr_get_interval", linuxerr.EPERM, "", nil),
 		149: syscalls.PartiallySupported("mlock", Mlock, "Stub implementation. The sandbox lacks appropriate permissions.", nil),
 		150: syscalls.PartiallySupported("munlock", Munlock, "Stub implementation. The sandbox lacks appropriate permissions.", nil),
@@ -215,7 +215,7 @@ var AMD64 = &kernel.SyscallTable{
 		160: syscalls.PartiallySupported("setrlimit", Setrlimit, "Not all rlimits are enforced.", nil),
 		161: syscalls.SupportedPoint("chroot", Chroot, PointChroot),
 		162: syscalls.Supported("sync", Sync),
-		163: syscalls.CapError("acct", linux.CAP_SYS_PACCT, "", nil),
+		163: syscalls.Supported("acct", Acct),
 		164: syscalls.CapError("settimeofday", linux.CAP_SYS_TIME, "", nil),
 		165: syscalls.Supported("mount", Mount),
 		166: syscalls.Supported("umount2", Umount2),
@@ -224,8 +224,8 @@ var AMD64 = &kernel.SyscallTable{
 		169: syscalls.CapError("reboot", linux.CAP_SYS_BOOT, "", nil),
 		170: syscalls.Supported("sethostname", Sethostname),
 		171: syscalls.Supported("setdomainname", Setdomainname),
-		172: syscalls.CapError("iopl", linux.CAP_SYS_RAWIO, "", nil),
-		173: syscalls.CapError("ioperm", linux.CAP_SYS_RAWIO, "", nil),
+		172: syscalls.PartiallySupportedPoint("iopl", Iopl, PointIopl, "Only grants access to the I/O ports emulated with --emulated-ioports.", nil),
+		173: syscalls.PartiallySupportedPoint("ioperm", Ioperm, PointIoperm, "Only grants access to the I/O ports emulated with --emulated-ioports.", nil),
 		174: syscalls.CapError("create_module", linux.CAP_SYS_MODULE, "", nil),
 		175: syscalls.CapError("init_module", linux.CAP_SYS_MODULE, "", nil),
 		176: syscalls.CapError("delete_module", linux.CAP_SYS_MODULE, "", nil),
@@ -254,7 +254,7 @@ var AMD64 = &kernel.SyscallTable{
 		199: syscalls.Supported("fremovexattr", Fremovexattr),
 		200: syscalls.Supported("tkill", Tkill),
 		201: syscalls.Supported("time", Time),
-		202: syscalls.PartiallySupported("futex", Futex, "Robust futexes not supported.", nil),
+		202: syscalls.Supported("futex", Futex),
 		203: syscalls.PartiallySupported("sched_setaffinity", SchedSetaffinity, "Stub implementation.", nil),
 		204: syscalls.PartiallySupported("sched_getaffinity", SchedGetaffinity, "Stub implementation.", nil),
 		205: syscalls.Error("set_thread_area", linuxerr.ENOSYS, "Expected to return ENOSYS on 64-bit", nil),
@@ -330,8 +330,8 @@ var AMD64 = &kernel.SyscallTable{
 		275: syscalls.Supported("splice", Splice),
 		276: syscalls.Supported("tee", Tee),
 		277: syscalls.Supported("sync_file_range", SyncFileRange),
-		278: syscalls.ErrorWithEvent("vmsplice", linuxerr.ENOSYS, "", []string{"gvisor.dev/issue/138"}), // TODO(b/29354098)
-		279: syscalls.CapError("move_pages", linux.CAP_SYS_NICE, "", nil),                               // requires cap_sys_nice (mostly)
+		278: syscalls.Supported("vmsplice", Vmsplice),
+		279: syscalls.CapError("move_pages", linux.CAP_SYS_NICE, "", nil), // requires cap_sys_nice (mostly)
 		280: syscalls.Supported("utimensat", Utimensat),
 		281: syscalls.Supported("epoll_pwait", EpollPwait),
 		282: syscalls.SupportedPoint("signalfd", Signalfd, PointSignalfd),
@@ -355,8 +355,8 @@ var AMD64 = &kernel.SyscallTable{
 		300: syscalls.ErrorWithEvent("fanotify_init", linuxerr.ENOSYS, "Needs CONFIG_FANOTIFY", nil),
 		301: syscalls.ErrorWithEvent("fanotify_mark", linuxerr.ENOSYS, "Needs CONFIG_FANOTIFY", nil),
 		302: syscalls.SupportedPoint("prlimit64", Prlimit64, PointPrlimit64),
-		303: syscalls.Error("name_to_handle_at", linuxerr.EOPNOTSUPP, "Not supported by gVisor filesystems", nil),
-		304: syscalls.Error("open_by_handle_at", linuxerr.EOPNOTSUPP, "Not supported by gVisor filesystems", nil),
+		303: syscalls.PartiallySupported("name_to_handle_at", NameToHandleAt, "Only supported on tmpfs, overlay and gofer filesystems.", nil),
+		304: syscalls.PartiallySupported("open_by_handle_at", OpenByHandleAt, "Only supported on tmpfs, overlay and gofer filesystems.", nil),
 		305: syscalls.CapError("clock_adjtime", linux.CAP_SYS_TIME, "", nil),
 		306: syscalls.Supported("syncfs", Syncfs),
 		307: syscalls.Supported("sendmmsg", SendMMsg),
@@ -395,7 +395,7 @@ var AMD64 = &kernel.SyscallTable{
 		424: syscalls.ErrorWithEvent("pidfd_send_signal", linuxerr.ENOSYS, "", nil),
 		425: syscalls.PartiallySupported("io_uring_setup", IOUringSetup, "Not all flags and functionality supported.", nil),
 		426: syscalls.PartiallySupported("io_uring_enter", IOUringEnter, "Not all flags and functionality supported.", nil),
-		427: syscalls.ErrorWithEvent("io_uring_register", linuxerr.ENOSYS, "", nil),
+		427: syscalls.PartiallySupported("io_uring_register", IOUringRegister, "Only buffer and file registration supported.", nil),
 		428: syscalls.ErrorWithEvent("open_tree", linuxerr.ENOSYS, "", nil),
 		429: syscalls.ErrorWithEvent("move_mount", linuxerr.ENOSYS, "", nil),
 		430: syscalls.ErrorWithEvent("fsopen", linuxerr.ENOSYS, "", nil),
@@ -403,16 +403,18 @@ var AMD64 = &kernel.SyscallTable{
 		432: syscalls.ErrorWithEvent("fsmount", linuxerr.ENOSYS, "", nil),
 		433: syscalls.ErrorWithEvent("fspick", linuxerr.ENOSYS, "", nil),
 		434: syscalls.ErrorWithEvent("pidfd_open", linuxerr.ENOSYS, "", nil),
-		435: syscalls.PartiallySupported("clone3", Clone3, "Options CLONE_PIDFD, CLONE_NEWCGROUP, CLONE_INTO_CGROUP, CLONE_NEWTIME, CLONE_CLEAR_SIGHAND, CLONE_PARENT, CLONE_SYSVSEM and, SetTid are not supported.", nil),
+		435: syscalls.PartiallySupported("clone3", Clone3, "Options CLONE_PIDFD, CLONE_NEWCGROUP, CLONE_NEWTIME, CLONE_CLEAR_SIGHAND, CLONE_PARENT and CLONE_SYSVSEM are not supported. CLONE_INTO_CGROUP accepts cgroupfs (v1) directories.", nil),
 		436: syscalls.Supported("close_range", CloseRange),
 		439: syscalls.Supported("faccessat2", Faccessat2),
 		441: syscalls.Supported("epoll_pwait2", EpollPwait2),
+		449: syscalls.Supported("futex_waitv", FutexWaitv),
 	},
 	Emulate: map[hostarch.Addr]uintptr{
 		0xffffffffff600000: 96,  // vsyscall gettimeofday(2)
 		0xffffffffff600400: 201, // vsyscall time(2)
 		0xffffffffff600800: 309, // vsyscall getcpu(2)
 	},
+	Compat: IA32,
 	Missing: func(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
 		t.Kernel().EmitUnimplementedEvent(t, sysno)
 		return 0, linuxerr.ENOSYS
@@ -506,7 +508,7 @@ var ARM64 = &kernel.SyscallTable{
 		72:  syscalls.Supported("pselect6", Pselect6),
 		73:  syscalls.Supported("ppoll", Ppoll),
 		74:  syscalls.SupportedPoint("signalfd4", Signalfd4, PointSignalfd4),
-		75:  syscalls.ErrorWithEvent("vmsplice", linuxerr.ENOSYS, "", []string{"gvisor.dev/issue/138"}), // TODO(b/29354098)
+		75:  syscalls.Supported("vmsplice", Vmsplice),
 		76:  syscalls.Supported("splice", Splice),
 		77:  syscalls.Supported("tee", Tee),
 		78:  syscalls.Supported("readlinkat", Readlinkat),
@@ -520,7 +522,7 @@ var ARM64 = &kernel.SyscallTable{
 		86:  syscalls.SupportedPoint("timerfd_settime", TimerfdSettime, PointTimerfdSettime),
 		87:  syscalls.SupportedPoint("timerfd_gettime", TimerfdGettime, PointTimerfdGettime),
 		88:  syscalls.Supported("utimensat", Utimensat),
-		89:  syscalls.CapError("acct", linux.CAP_SYS_PACCT, "", nil),
+		89:  syscalls.Supported("acct", Acct),
 		90:  syscalls.Supported("capget", Capget),
 		91:  syscalls.Supported("capset", Capset),
 		92:  syscalls.ErrorWithEvent("personality", linuxerr.EINVAL, "Unable to change personality.", nil),
@@ -529,7 +531,7 @@ var ARM64 = &kernel.SyscallTable{
 		95:  syscalls.Supported("waitid", Waitid),
 		96:  syscalls.Supported("set_tid_address", SetTidAddress),
 		97:  syscalls.PartiallySupported("unshare", Unshare, "Time, cgroup namespaces not supported.", nil),
-		98:  syscalls.PartiallySupported("futex", Futex, "Robust futexes not supported.", nil),
+		98:  syscalls.Supported("futex", Futex),
 		99:  syscalls.Supported("set_robust_list", SetRobustList),
 		100: syscalls.Supported("get_robust_list", GetRobustList),
 		101: syscalls.Supported("nanosleep", Nanosleep),
@@ -549,15 +551,15 @@ var ARM64 = &kernel.SyscallTable{
 		115: syscalls.Supported("clock_nanosleep", ClockNanosleep),
 		116: syscalls.PartiallySupported("syslog", Syslog, "Outputs a dummy message for security reasons.", nil),
 		117: syscalls.PartiallySupported("ptrace", Ptrace, "Options PTRACE_PEEKSIGINFO, PTRACE_SECCOMP_GET_FILTER not supported.", nil),
-		118: syscalls.CapError("sched_setparam", linux.CAP_SYS_NICE, "", nil),
-		119: syscalls.PartiallySupported("sched_setscheduler", SchedSetscheduler, "Stub implementation.", nil),
-		120: syscalls.PartiallySupported("sched_getscheduler", SchedGetscheduler, "Stub implementation.", nil),
-		121: syscalls.PartiallySupported("sched_getparam", SchedGetparam, "Stub implementation.", nil),
+		118: syscalls.PartiallySupported("sched_setparam", SchedSetparam, "Scheduling policies and priorities are recorded but not enforced.", nil),
+		119: syscalls.PartiallySupported("sched_setscheduler", SchedSetscheduler, "Scheduling policies and priorities are recorded but not enforced.", nil),
+		120: syscalls.PartiallySupported("sched_getscheduler", SchedGetscheduler, "Scheduling policies and priorities are recorded but not enforced.", nil),
+		121: syscalls.PartiallySupported("sched_getparam", SchedGetparam, "Scheduling policies and priorities are recorded but not enforced.", nil),
 		122: syscalls.PartiallySupported("sched_setaffinity", SchedSetaffinity, "Stub implementation.", nil),
 		123: syscalls.PartiallySupported("sched_getaffinity", SchedGetaffinity, "Stub implementation.", nil),
 		124: syscalls.Supported("sched_yield", SchedYield),
-		125: syscalls.PartiallySupported("sched_get_priority_max", SchedGetPriorityMax, "Stub implementation.", nil),
-		126: syscalls.PartiallySupported("sched_get_priority_min", SchedGetPriorityMin, "Stub implementation.", nil),
+		125: syscalls.Supported("sched_get_priority_max", SchedGetPriorityMax),
+		126: syscalls.Supported("sched_get_priority_min", SchedGetPriorityMin),
 		127: syscalls.ErrorWithEvent("sched_rr_get_interval", linuxerr.EPERM, "", nil),
 		128: syscalls.Supported("restart_syscall", RestartSyscall),
 		129: syscalls.Supported("kill", Kill),
@@ -679,8 +681,8 @@ var ARM64 = &kernel.SyscallTable{
 		261: syscalls.SupportedPoint("prlimit64", Prlimit64, PointPrlimit64),
 		262: syscalls.ErrorWithEvent("fanotify_init", linuxerr.ENOSYS, "Needs CONFIG_FANOTIFY", nil),
 		263: syscalls.ErrorWithEvent("fanotify_mark", linuxerr.ENOSYS, "Needs CONFIG_FANOTIFY", nil),
-		264: syscalls.Error("name_to_handle_at", linuxerr.EOPNOTSUPP, "Not supported by gVisor filesystems", nil),
-		265: syscalls.Error("open_by_handle_at", linuxerr.EOPNOTSUPP, "Not supported by gVisor filesystems", nil),
+		264: syscalls.PartiallySupported("name_to_handle_at", NameToHandleAt, "Only supported on tmpfs, overlay and gofer filesystems.", nil),
+		265: syscalls.PartiallySupported("open_by_handle_at", OpenByHandleAt, "Only supported on tmpfs, overlay and gofer filesystems.", nil),
 		266: syscalls.CapError("clock_adjtime", linux.CAP_SYS_TIME, "", nil),
 		267: syscalls.Supported("syncfs", Syncfs),
 		268: syscalls.Supported("setns", Setns),
@@ -716,7 +718,7 @@ var ARM64 = &kernel.SyscallTable{
 		424: syscalls.ErrorWithEvent("pidfd_send_signal", linuxerr.ENOSYS, "", nil),
 		425: syscalls.PartiallySupported("io_uring_setup", IOUringSetup, "Not all flags and functionality supported.", nil),
 		426: syscalls.PartiallySupported("io_uring_enter", IOUringEnter, "Not all flags and functionality supported.", nil),
-		427: syscalls.ErrorWithEvent("io_uring_register", linuxerr.ENOSYS, "", nil),
+		427: syscalls.PartiallySupported("io_uring_register", IOUringRegister, "Only buffer and file registration supported.", nil),
 		428: syscalls.ErrorWithEvent("open_tree", linuxerr.ENOSYS, "", nil),
 		429: syscalls.ErrorWithEvent("move_mount", linuxerr.ENOSYS, "", nil),
 		430: syscalls.ErrorWithEvent("fsopen", linuxerr.ENOSYS, "", nil),
@@ -724,10 +726,11 @@ var ARM64 = &kernel.SyscallTable{
 		432: syscalls.ErrorWithEvent("fsmount", linuxerr.ENOSYS, "", nil),
 		433: syscalls.ErrorWithEvent("fspick", linuxerr.ENOSYS, "", nil),
 		434: syscalls.ErrorWithEvent("pidfd_open", linuxerr.ENOSYS, "", nil),
-		435: syscalls.PartiallySupported("clone3", Clone3, "Options CLONE_PIDFD, CLONE_NEWCGROUP, CLONE_INTO_CGROUP, CLONE_NEWTIME, CLONE_CLEAR_SIGHAND, CLONE_PARENT, CLONE_SYSVSEM and clone_args.set_tid are not supported.", nil),
+		435: syscalls.PartiallySupported("clone3", Clone3, "Options CLONE_PIDFD, CLONE_NEWCGROUP, CLONE_NEWTIME, CLONE_CLEAR_SIGHAND, CLONE_PARENT and CLONE_SYSVSEM are not supported. CLONE_INTO_CGROUP accepts cgroupfs (v1) directories.", nil),
 		436: syscalls.Supported("close_range", CloseRange),
 		439: syscalls.Supported("faccessat2", Faccessat2),
 		441: syscalls.Supported("epoll_pwait2", EpollPwait2),
+		449: syscalls.Supported("futex_waitv", FutexWaitv),
 	},
 	Emulate: map[hostarch.Addr]uintptr{},
 	Missing: func(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
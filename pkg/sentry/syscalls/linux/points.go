@@ -730,6 +730,30 @@ func PointChroot(t *kernel.Task, fields seccheck.FieldSet, cxtData *pb.ContextDa
 	return p, pb.MessageType_MESSAGE_SYSCALL_CHROOT
 }
 
+// PointIopl converts iopl(2) syscall to proto.
+func PointIopl(t *kernel.Task, fields seccheck.FieldSet, cxtData *pb.ContextData, info kernel.SyscallInfo) (proto.Message, pb.MessageType) {
+	p := &pb.Iopl{
+		ContextData: cxtData,
+		Sysno:       uint64(info.Sysno),
+		Level:       info.Args[0].Uint(),
+	}
+	p.Exit = newExitMaybe(info)
+	return p, pb.MessageType_MESSAGE_SYSCALL_IOPL
+}
+
+// PointIoperm converts ioperm(2) syscall to proto.
+func PointIoperm(t *kernel.Task, fields seccheck.FieldSet, cxtData *pb.ContextData, info kernel.SyscallInfo) (proto.Message, pb.MessageType) {
+	p := &pb.Ioperm{
+		ContextData: cxtData,
+		Sysno:       uint64(info.Sysno),
+		From:        info.Args[0].Uint64(),
+		Num:         info.Args[1].Uint64(),
+		TurnOn:      info.Args[2].Int(),
+	}
+	p.Exit = newExitMaybe(info)
+	return p, pb.MessageType_MESSAGE_SYSCALL_IOPERM
+}
+
 // PointClone converts clone(2) syscall to proto.
 func PointClone(t *kernel.Task, fields seccheck.FieldSet, cxtData *pb.ContextData, info kernel.SyscallInfo) (proto.Message, pb.MessageType) {
 	p := &pb.Clone{
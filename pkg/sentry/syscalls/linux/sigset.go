@@ -61,6 +61,14 @@ func copyInSigSetWithSize(t *kernel.Task, addr hostarch.Addr) (hostarch.Addr, ui
 		maskAddr := hostarch.Addr(hostarch.ByteOrder.Uint64(in[0:]))
 		maskSize := uint(hostarch.ByteOrder.Uint64(in[8:]))
 		return maskAddr, maskSize, nil
+	case 4:
+		in := t.CopyScratchBuffer(8)
+		if _, err := t.CopyInBytes(addr, in); err != nil {
+			return 0, 0, err
+		}
+		maskAddr := hostarch.Addr(hostarch.ByteOrder.Uint32(in[0:]))
+		maskSize := uint(hostarch.ByteOrder.Uint32(in[4:]))
+		return maskAddr, maskSize, nil
 	default:
 		return 0, 0, linuxerr.ENOSYS
 	}
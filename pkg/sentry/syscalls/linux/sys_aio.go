@@ -45,7 +45,7 @@ func IoSetup(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr
 		return 0, nil, linuxerr.EINVAL
 	}
 
-	id, err := t.MemoryManager().NewAIOContext(t, uint32(nrEvents))
+	id, err := t.MemoryManager().NewAIOContext(t, uint32(nrEvents), &t.Kernel().AIOEvents)
 	if err != nil {
 		return 0, nil, err
 	}
@@ -0,0 +1,235 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+import (
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/hostarch"
+	"github.com/wilinz/gvisor/pkg/sentry/arch"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+)
+
+// This file contains the syscalls and structures of the 32-bit compatibility
+// mode (ia32) ABI that differ from their 64-bit counterparts. Arguments of
+// compat syscalls are zero-extended from 32 bits; signed arguments are
+// sign-extended here when the 64-bit syscall reads them as 64-bit values.
+
+// compatOffset returns the 64-bit file offset passed as a pair of 32-bit
+// arguments, as done by arch/x86/kernel/sys_ia32.c in Linux.
+func compatOffset(lo, hi arch.SyscallArgument) uintptr {
+	return uintptr(uint64(lo.Uint()) | uint64(hi.Uint())<<32)
+}
+
+// compatSignExtend returns arg sign-extended from 32 bits.
+func compatSignExtend(arg arch.SyscallArgument) uintptr {
+	return uintptr(int64(arg.Int()))
+}
+
+// Time32 implements Linux syscall time(2) for 32-bit compatibility mode tasks,
+// which have a 32-bit time_t.
+func Time32(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	addr := args[0].Pointer()
+
+	r := int32(t.Kernel().RealtimeClock().Now().TimeT())
+	if addr != 0 {
+		b := t.CopyScratchBuffer(4)
+		hostarch.ByteOrder.PutUint32(b, uint32(r))
+		if _, err := t.CopyOutBytes(addr, b); err != nil {
+			return 0, nil, err
+		}
+	}
+	return uintptr(r), nil, nil
+}
+
+// Lseek32 implements Linux syscall lseek(2) for 32-bit compatibility mode
+// tasks.
+func Lseek32(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	args[1].Value = compatSignExtend(args[1])
+	off, ctrl, err := Lseek(t, sysno, args)
+	if err == nil && off > 0x7fffffff {
+		// The offset can't be represented by the 32-bit off_t.
+		return 0, nil, linuxerr.EOVERFLOW
+	}
+	return off, ctrl, err
+}
+
+// Llseek implements Linux syscall _llseek(2).
+func Llseek(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	fd := args[0]
+	offset := compatOffset(args[2], args[1])
+	resultAddr := args[3].Pointer()
+	whence := args[4]
+
+	off, _, err := Lseek(t, sysno, arch.SyscallArguments{fd, {Value: offset}, whence})
+	if err != nil {
+		return 0, nil, err
+	}
+	b := t.CopyScratchBuffer(8)
+	hostarch.ByteOrder.PutUint64(b, uint64(off))
+	if _, err := t.CopyOutBytes(resultAddr, b); err != nil {
+		return 0, nil, err
+	}
+	return 0, nil, nil
+}
+
+// Pread64Compat implements Linux syscall pread64(2) for 32-bit compatibility
+// mode tasks, which pass the offset as two 32-bit arguments.
+func Pread64Compat(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	args[3].Value = compatOffset(args[3], args[4])
+	return Pread64(t, sysno, args)
+}
+
+// Pwrite64Compat implements Linux syscall pwrite64(2) for 32-bit
+// compatibility mode tasks, which pass the offset as two 32-bit arguments.
+func Pwrite64Compat(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	args[3].Value = compatOffset(args[3], args[4])
+	return Pwrite64(t, sysno, args)
+}
+
+// Truncate64 implements Linux syscall truncate64(2).
+func Truncate64(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	args[1].Value = compatOffset(args[1], args[2])
+	return Truncate(t, sysno, args)
+}
+
+// Ftruncate64 implements Linux syscall ftruncate64(2).
+func Ftruncate64(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	args[1].Value = compatOffset(args[1], args[2])
+	return Ftruncate(t, sysno, args)
+}
+
+// Mmap2 implements Linux syscall mmap2(2), which takes the file offset in
+// pages.
+func Mmap2(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	args[5].Value = uintptr(uint64(args[5].Uint()) << hostarch.PageShift)
+	return Mmap(t, sysno, args)
+}
+
+// Fcntl32 implements Linux syscall fcntl(2) and fcntl64(2) for 32-bit
+// compatibility mode tasks.
+func Fcntl32(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	switch args[1].Int() {
+	case linux.F_GETLK, linux.F_SETLK, linux.F_SETLKW, linux.F_OFD_GETLK, linux.F_OFD_SETLK, linux.F_OFD_SETLKW:
+		// struct compat_flock and struct compat_flock64 are not translated.
+		return 0, nil, linuxerr.EINVAL
+	}
+	return Fcntl(t, sysno, args)
+}
+
+// Clone32 implements Linux syscall clone(2) for 32-bit compatibility mode
+// tasks, which pass the TLS argument before the child TID address
+// (CONFIG_CLONE_BACKWARDS).
+func Clone32(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	flags := int(args[0].Int())
+	stack := args[1].Pointer()
+	parentTID := args[2].Pointer()
+	childTID := args[4].Pointer()
+	if flags&linux.CLONE_SETTLS != 0 {
+		// The TLS argument is a struct user_desc for set_thread_area(2),
+		// which isn't supported.
+		return 0, nil, linuxerr.EINVAL
+	}
+	return clone(t, flags, stack, parentTID, childTID, 0)
+}
+
+// RtSigaction32 implements Linux syscall rt_sigaction(2) for 32-bit
+// compatibility mode tasks, which use struct compat_sigaction.
+func RtSigaction32(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	sig := linux.Signal(args[0].Int())
+	newactarg := args[1].Pointer()
+	oldactarg := args[2].Pointer()
+	sigsetsize := args[3].SizeT()
+
+	if sigsetsize != linux.SignalSetSize {
+		return 0, nil, linuxerr.EINVAL
+	}
+
+	// struct compat_sigaction is packed: the 64-bit mask follows three
+	// 32-bit fields.
+	const sigaction32Size = 20
+	var newactptr *linux.SigAction
+	if newactarg != 0 {
+		b := t.CopyScratchBuffer(sigaction32Size)
+		if _, err := t.CopyInBytes(newactarg, b); err != nil {
+			return 0, nil, err
+		}
+		newactptr = &linux.SigAction{
+			Handler:  uint64(hostarch.ByteOrder.Uint32(b[0:])),
+			Flags:    uint64(hostarch.ByteOrder.Uint32(b[4:])),
+			Restorer: uint64(hostarch.ByteOrder.Uint32(b[8:])),
+			Mask:     linux.SignalSet(hostarch.ByteOrder.Uint64(b[12:])),
+		}
+	}
+	oldact, err := t.ThreadGroup().SetSigAction(sig, newactptr)
+	if err != nil {
+		return 0, nil, err
+	}
+	if oldactarg != 0 {
+		b := t.CopyScratchBuffer(sigaction32Size)
+		hostarch.ByteOrder.PutUint32(b[0:], uint32(oldact.Handler))
+		hostarch.ByteOrder.PutUint32(b[4:], uint32(oldact.Flags))
+		hostarch.ByteOrder.PutUint32(b[8:], uint32(oldact.Restorer))
+		hostarch.ByteOrder.PutUint64(b[12:], uint64(oldact.Mask))
+		if _, err := t.CopyOutBytes(oldactarg, b); err != nil {
+			return 0, nil, err
+		}
+	}
+	return 0, nil, nil
+}
+
+// copyOutStat64 copies out stat as the packed struct stat64 of i386, see
+// arch/x86/include/uapi/asm/stat.h in Linux.
+func copyOutStat64(t *kernel.Task, addr hostarch.Addr, stat *linux.Stat) error {
+	b := t.CopyScratchBuffer(96)
+	for i := range b {
+		b[i] = 0
+	}
+	hostarch.ByteOrder.PutUint64(b[0:], stat.Dev)
+	hostarch.ByteOrder.PutUint32(b[12:], uint32(stat.Ino))
+	hostarch.ByteOrder.PutUint32(b[16:], stat.Mode)
+	hostarch.ByteOrder.PutUint32(b[20:], uint32(stat.Nlink))
+	hostarch.ByteOrder.PutUint32(b[24:], stat.UID)
+	hostarch.ByteOrder.PutUint32(b[28:], stat.GID)
+	hostarch.ByteOrder.PutUint64(b[32:], stat.Rdev)
+	hostarch.ByteOrder.PutUint64(b[44:], uint64(stat.Size))
+	hostarch.ByteOrder.PutUint32(b[52:], uint32(stat.Blksize))
+	hostarch.ByteOrder.PutUint64(b[56:], uint64(stat.Blocks))
+	for i, ts := range []linux.Timespec{stat.ATime, stat.MTime, stat.CTime} {
+		hostarch.ByteOrder.PutUint32(b[64+8*i:], uint32(ts.Sec))
+		hostarch.ByteOrder.PutUint32(b[68+8*i:], uint32(ts.Nsec))
+	}
+	hostarch.ByteOrder.PutUint64(b[88:], stat.Ino)
+	_, err := t.CopyOutBytes(addr, b)
+	return err
+}
+
+// copyOutRusage32 copies out ru as a struct compat_rusage.
+func copyOutRusage32(t *kernel.Task, addr hostarch.Addr, ru *linux.Rusage) error {
+	fields := []int64{
+		ru.UTime.Sec, ru.UTime.Usec,
+		ru.STime.Sec, ru.STime.Usec,
+		ru.MaxRSS, ru.IXRSS, ru.IDRSS, ru.ISRSS,
+		ru.MinFlt, ru.MajFlt, ru.NSwap, ru.InBlock,
+		ru.OuBlock, ru.MsgSnd, ru.MsgRcv, ru.NSignals,
+		ru.NVCSw, ru.NIvCSw,
+	}
+	b := t.CopyScratchBuffer(4 * len(fields))
+	for i, f := range fields {
+		hostarch.ByteOrder.PutUint32(b[4*i:], uint32(f))
+	}
+	_, err := t.CopyOutBytes(addr, b)
+	return err
+}
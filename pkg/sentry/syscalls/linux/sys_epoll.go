@@ -135,13 +135,22 @@ func waitEpoll(t *kernel.Task, epfd int32, eventsAddr hostarch.Addr, maxEvents i
 		return 0, nil, linuxerr.EINVAL
 	}
 
+	// Like Linux, convert the timeout to a deadline on entry, so that the time
+	// taken to register with the epoll instance and spurious wakeups don't
+	// extend it. See fs/eventpoll.c:do_epoll_wait().
+	var (
+		haveDeadline = timeoutInNanos > 0
+		deadline     ktime.Time
+	)
+	if haveDeadline {
+		deadline = t.Kernel().MonotonicClock().Now().Add(time.Duration(timeoutInNanos))
+	}
+
 	// Allocate space for a few events on the stack for the common case in
 	// which we don't have too many events.
 	var (
-		eventsArr    [16]linux.EpollEvent
-		ch           chan struct{}
-		haveDeadline bool
-		deadline     ktime.Time
+		eventsArr [16]linux.EpollEvent
+		ch        chan struct{}
 	)
 	for {
 		events := ep.ReadEvents(eventsArr[:0], maxEvents)
@@ -169,12 +178,6 @@ func waitEpoll(t *kernel.Task, epfd int32, eventsAddr hostarch.Addr, maxEvents i
 			}
 			defer epfile.EventUnregister(&w)
 		} else {
-			// Set up the timer if a timeout was specified.
-			if timeoutInNanos > 0 && !haveDeadline {
-				timeoutDur := time.Duration(timeoutInNanos) * time.Nanosecond
-				deadline = t.Kernel().MonotonicClock().Now().Add(timeoutDur)
-				haveDeadline = true
-			}
 			if err := t.BlockWithDeadline(ch, haveDeadline, deadline); err != nil {
 				if linuxerr.Equals(linuxerr.ETIMEDOUT, err) {
 					err = nil
@@ -216,16 +219,14 @@ func EpollPwait2(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uin
 	timeoutPtr := args[3].Pointer()
 	maskAddr := args[4].Pointer()
 	maskSize := uint(args[5].Uint())
-	haveTimeout := timeoutPtr != 0
 
-	var timeoutInNanos int64 = -1
-	if haveTimeout {
-		var timeout linux.Timespec
-		if _, err := timeout.CopyIn(t, timeoutPtr); err != nil {
-			return 0, nil, err
-		}
-		timeoutInNanos = timeout.ToNsec()
+	// A null timeout blocks indefinitely. Timeouts have nanosecond
+	// resolution, and are capped rather than overflowing.
+	timeout, err := copyTimespecInToDuration(t, timeoutPtr)
+	if err != nil {
+		return 0, nil, err
 	}
+	timeoutInNanos := timeout.Nanoseconds()
 
 	if err := setTempSignalSet(t, maskAddr, maskSize); err != nil {
 		return 0, nil, err
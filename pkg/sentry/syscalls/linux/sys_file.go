@@ -667,7 +667,13 @@ func Fcntl(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 		if !ok {
 			return 0, nil, linuxerr.EBADF
 		}
-		n, err := pipefile.SetPipeSize(int64(args[2].Int()))
+		// Like Linux, only tasks with CAP_SYS_RESOURCE may exceed
+		// /proc/sys/fs/pipe-max-size. See fs/pipe.c:pipe_set_size.
+		max := int64(t.Kernel().PipeMaxSize.Load())
+		if t.HasCapability(linux.CAP_SYS_RESOURCE) {
+			max = pipe.MaximumPipeSizeLimit
+		}
+		n, err := pipefile.SetPipeSize(int64(args[2].Int()), max)
 		if err != nil {
 			return 0, nil, err
 		}
@@ -15,6 +15,7 @@
 package linux
 
 import (
+	"math"
 	"time"
 
 	"github.com/wilinz/gvisor/pkg/abi/linux"
@@ -22,6 +23,7 @@ import (
 	"github.com/wilinz/gvisor/pkg/hostarch"
 	"github.com/wilinz/gvisor/pkg/sentry/arch"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/futex"
 	"github.com/wilinz/gvisor/pkg/sentry/ktime"
 )
 
@@ -118,8 +120,7 @@ func futexWaitDuration(t *kernel.Task, duration time.Duration, forever bool, add
 }
 
 func futexLockPI(t *kernel.Task, ts linux.Timespec, forever bool, addr hostarch.Addr, private bool) error {
-	w := t.FutexWaiter()
-	locked, err := t.Futex().LockPI(w, t, addr, uint32(t.ThreadID()), private, false)
+	locked, err := t.FutexLockPIPrepare(addr, private)
 	if err != nil {
 		return err
 	}
@@ -128,19 +129,24 @@ func futexLockPI(t *kernel.Task, ts linux.Timespec, forever bool, addr hostarch.
 		return nil
 	}
 
+	w := t.FutexWaiter()
 	if forever {
 		err = t.Block(w.C)
 	} else {
 		err = t.BlockWithDeadlineFrom(w.C, t.Kernel().RealtimeClock(), true, ktime.FromTimespec(ts))
 	}
 
-	t.Futex().WaitComplete(w, t)
+	if t.FutexLockPIComplete() {
+		// The futex was handed off to us, even if we were interrupted or
+		// timed out in the meantime.
+		return nil
+	}
 	return linuxerr.ConvertIntr(err, linuxerr.ERESTARTSYS)
 }
 
 func tryLockPI(t *kernel.Task, addr hostarch.Addr, private bool) error {
 	w := t.FutexWaiter()
-	locked, err := t.Futex().LockPI(w, t, addr, uint32(t.ThreadID()), private, true)
+	locked, err := t.Futex().LockPI(w, t, addr, uint32(t.ThreadID()), 0 /* prio */, private, true)
 	if err != nil {
 		return err
 	}
@@ -150,6 +156,45 @@ func tryLockPI(t *kernel.Task, addr hostarch.Addr, private bool) error {
 	return nil
 }
 
+// futexWaitRequeuePI performs a FUTEX_WAIT_REQUEUE_PI, blocking until the
+// task acquires the PI futex at naddr or the wait is otherwise complete.
+//
+// The wait blocks forever if forever is true, otherwise it blocks until ts.
+func futexWaitRequeuePI(t *kernel.Task, clockRealtime bool, ts linux.Timespec, forever bool, addr hostarch.Addr, val uint32, naddr hostarch.Addr, private bool) error {
+	if err := t.FutexWaitRequeuePIPrepare(addr, val, naddr, private); err != nil {
+		return err
+	}
+
+	w := t.FutexWaiter()
+	var err error
+	if forever {
+		err = t.Block(w.C)
+	} else if clockRealtime {
+		err = t.BlockWithDeadlineFrom(w.C, t.Kernel().RealtimeClock(), true, ktime.FromTimespec(ts))
+	} else {
+		err = t.BlockWithDeadline(w.C, true, ktime.FromTimespec(ts))
+	}
+
+	acquired, requeued := t.FutexWaitRequeuePIComplete()
+	switch {
+	case acquired:
+		return nil
+	case requeued:
+		// We were requeued onto the PI futex but didn't acquire it before
+		// the wait ended. As in Linux, we can't restart the syscall since
+		// we're no longer waiting on addr.
+		if err == linuxerr.ETIMEDOUT {
+			return err
+		}
+		return linuxerr.EWOULDBLOCK
+	case err == nil:
+		// Woken by FUTEX_WAKE rather than FUTEX_CMP_REQUEUE_PI.
+		return linuxerr.EAGAIN
+	default:
+		return linuxerr.ConvertIntr(err, linuxerr.ERESTARTNOINTR)
+	}
+}
+
 // Futex implements linux syscall futex(2).
 // It provides a method for a program to wait for a value at a given address to
 // change, and a method to wake up anyone waiting on a particular address.
@@ -260,12 +305,34 @@ func Futex(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 		return 0, nil, err
 
 	case linux.FUTEX_UNLOCK_PI:
-		err := t.Futex().UnlockPI(t, addr, uint32(t.ThreadID()), private)
+		err := t.FutexUnlockPI(addr, private)
 		return 0, nil, err
 
-	case linux.FUTEX_WAIT_REQUEUE_PI, linux.FUTEX_CMP_REQUEUE_PI:
-		t.Kernel().EmitUnimplementedEvent(t, sysno)
-		return 0, nil, linuxerr.ENOSYS
+	case linux.FUTEX_WAIT_REQUEUE_PI:
+		// WAIT_REQUEUE_PI uses an absolute timeout which is either
+		// CLOCK_MONOTONIC or CLOCK_REALTIME.
+		forever := (timeout == 0)
+
+		var timespec linux.Timespec
+		if !forever {
+			var err error
+			timespec, err = copyTimespecIn(t, timeout)
+			if err != nil {
+				return 0, nil, err
+			}
+		}
+		err := futexWaitRequeuePI(t, clockRealtime, timespec, forever, addr, uint32(val), naddr, private)
+		return 0, nil, err
+
+	case linux.FUTEX_CMP_REQUEUE_PI:
+		// As in Linux, at most one waiter may be woken, by acquiring the PI
+		// futex on its behalf. 'val3' contains the value to be checked at
+		// 'addr'.
+		if val != 1 || nreq < 0 {
+			return 0, nil, linuxerr.EINVAL
+		}
+		n, err := t.FutexCmpRequeuePI(addr, naddr, private, uint32(val3), nreq)
+		return uintptr(n), nil, err
 
 	default:
 		// We don't even know about this command.
@@ -273,6 +340,84 @@ func Futex(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 	}
 }
 
+// FutexWaitv implements linux syscall futex_waitv(2).
+// It waits on several futexes at once, returning the index of one that was
+// woken.
+func FutexWaitv(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	waitersAddr := args[0].Pointer()
+	nr := args[1].Uint()
+	flags := args[2].Uint()
+	timeout := args[3].Pointer()
+	clockID := args[4].Int()
+
+	if flags != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	if nr == 0 || nr > linux.FUTEX_WAITV_MAX || waitersAddr == 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+
+	// futex_waitv uses an absolute timeout which is either CLOCK_MONOTONIC
+	// or CLOCK_REALTIME.
+	forever := timeout == 0
+	var ts linux.Timespec
+	if !forever {
+		if clockID != linux.CLOCK_MONOTONIC && clockID != linux.CLOCK_REALTIME {
+			return 0, nil, linuxerr.EINVAL
+		}
+		var err error
+		if ts, err = copyTimespecIn(t, timeout); err != nil {
+			return 0, nil, err
+		}
+		if !ts.Valid() {
+			return 0, nil, linuxerr.EINVAL
+		}
+	}
+
+	waiters := make([]linux.FutexWaitv, nr)
+	if _, err := linux.CopyFutexWaitvSliceIn(t, waitersAddr, waiters); err != nil {
+		return 0, nil, err
+	}
+	entries := make([]futex.WaitvEntry, nr)
+	for i, w := range waiters {
+		if w.Flags&^(linux.FUTEX2_SIZE_MASK|linux.FUTEX2_PRIVATE) != 0 || w.Reserved != 0 {
+			return 0, nil, linuxerr.EINVAL
+		}
+		if w.Flags&linux.FUTEX2_SIZE_MASK != linux.FUTEX_32 {
+			return 0, nil, linuxerr.EINVAL
+		}
+		if w.Val > math.MaxUint32 || w.Uaddr%4 != 0 {
+			return 0, nil, linuxerr.EINVAL
+		}
+		entries[i] = futex.WaitvEntry{
+			Addr:    hostarch.Addr(w.Uaddr),
+			Private: w.Flags&linux.FUTEX2_PRIVATE != 0,
+			Val:     uint32(w.Val),
+		}
+	}
+
+	mw := futex.NewMultiWaiter()
+	if woken, err := t.Futex().WaitMultiplePrepare(mw, t, entries); err != nil || woken >= 0 {
+		return uintptr(woken), nil, err
+	}
+
+	var err error
+	if forever {
+		err = t.Block(mw.C)
+	} else if clockID == linux.CLOCK_REALTIME {
+		err = t.BlockWithDeadlineFrom(mw.C, t.Kernel().RealtimeClock(), true, ktime.FromTimespec(ts))
+	} else {
+		err = t.BlockWithDeadline(mw.C, true, ktime.FromTimespec(ts))
+	}
+
+	// A wakeup may race with a timeout or interruption; if any futex was
+	// woken, report it rather than the error, as Linux does.
+	if woken := t.Futex().WaitMultipleComplete(mw, t); woken >= 0 {
+		return uintptr(woken), nil, nil
+	}
+	return 0, nil, linuxerr.ConvertIntr(err, linuxerr.ERESTARTSYS)
+}
+
 // SetRobustList implements linux syscall set_robust_list(2).
 func SetRobustList(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	// Despite the syscall using the name 'pid' for this variable, it is
@@ -0,0 +1,72 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+import (
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/sentry/arch"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+)
+
+// Tasks never access the I/O ports of the host. Instead, iopl(2) and ioperm(2)
+// grant access to the ports emulated by the kernel, if any, and in and out
+// instructions that use them are emulated (see kernel.InitKernelArgs).
+// Requests for other ports fail with EPERM, as if the kernel was locked down.
+
+// Iopl implements Linux syscall iopl(2).
+func Iopl(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	level := args[0].Uint()
+
+	if level > 3 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	// Only raising the I/O privilege level requires privileges.
+	if int32(level) > t.IOPL() {
+		if !t.HasCapabilityIn(linux.CAP_SYS_RAWIO, t.Kernel().RootUserNamespace()) {
+			return 0, nil, linuxerr.EPERM
+		}
+		// Level 3 grants access to all emulated ports, but doesn't allow
+		// interrupts to be disabled.
+		if !t.Kernel().HasEmulatedIOPorts() {
+			t.Debugf("iopl(%d) denied: no I/O ports are emulated", level)
+			return 0, nil, linuxerr.EPERM
+		}
+	}
+	t.SetIOPL(int32(level))
+	return 0, nil, nil
+}
+
+// Ioperm implements Linux syscall ioperm(2).
+func Ioperm(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	from := args[0].Uint64()
+	num := args[1].Uint64()
+	turnOn := args[2].Int() != 0
+
+	if from+num <= from || from+num > kernel.MaxIOPort+1 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	if turnOn {
+		if !t.HasCapabilityIn(linux.CAP_SYS_RAWIO, t.Kernel().RootUserNamespace()) {
+			return 0, nil, linuxerr.EPERM
+		}
+		if !t.Kernel().EmulatedIOPorts(uint32(from), uint32(num)) {
+			t.Debugf("ioperm(%#x, %d) denied: I/O ports are not emulated", from, num)
+			return 0, nil, linuxerr.EPERM
+		}
+	}
+	t.SetIOPerm(uint32(from), uint32(num), turnOn)
+	return 0, nil, nil
+}
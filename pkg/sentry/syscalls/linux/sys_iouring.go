@@ -127,3 +127,45 @@ func IOUringEnter(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (ui
 
 	return uintptr(ret), nil, nil
 }
+
+// IOUringRegister implements linux syscall io_uring_register(2).
+func IOUringRegister(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	if !kernel.IOUringEnabled {
+		return 0, nil, linuxerr.ENOSYS
+	}
+
+	fd := int32(args[0].Int())
+	opcode := args[1].Uint()
+	arg := args[2].Pointer()
+	nrArgs := args[3].Uint()
+
+	file := t.GetFile(fd)
+	if file == nil {
+		return 0, nil, linuxerr.EBADF
+	}
+	defer file.DecRef(t)
+	iouringfd, ok := file.Impl().(*iouringfs.FileDescription)
+	if !ok {
+		// See io_uring/register.c:__do_sys_io_uring_register().
+		return 0, nil, linuxerr.EOPNOTSUPP
+	}
+
+	switch opcode {
+	case linux.IORING_REGISTER_BUFFERS:
+		return 0, nil, iouringfd.RegisterBuffers(t, arg, nrArgs)
+	case linux.IORING_UNREGISTER_BUFFERS:
+		if arg != 0 || nrArgs != 0 {
+			return 0, nil, linuxerr.EINVAL
+		}
+		return 0, nil, iouringfd.UnregisterBuffers(t)
+	case linux.IORING_REGISTER_FILES:
+		return 0, nil, iouringfd.RegisterFiles(t, arg, nrArgs)
+	case linux.IORING_UNREGISTER_FILES:
+		if arg != 0 || nrArgs != 0 {
+			return 0, nil, linuxerr.EINVAL
+		}
+		return 0, nil, iouringfd.UnregisterFiles(t)
+	default:
+		return 0, nil, linuxerr.EINVAL
+	}
+}
@@ -39,10 +39,15 @@ func Membarrier(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uint
 				linux.MEMBARRIER_CMD_PRIVATE_EXPEDITED |
 				linux.MEMBARRIER_CMD_REGISTER_PRIVATE_EXPEDITED
 		}
+		if haveMembarrierSyncCore(t) {
+			supportedCommands |= linux.MEMBARRIER_CMD_PRIVATE_EXPEDITED_SYNC_CORE |
+				linux.MEMBARRIER_CMD_REGISTER_PRIVATE_EXPEDITED_SYNC_CORE
+		}
 		if t.RSeqAvailable() {
 			supportedCommands |= linux.MEMBARRIER_CMD_PRIVATE_EXPEDITED_RSEQ |
 				linux.MEMBARRIER_CMD_REGISTER_PRIVATE_EXPEDITED_RSEQ
 		}
+		supportedCommands |= linux.MEMBARRIER_CMD_GET_REGISTRATIONS
 		return supportedCommands, nil, nil
 	case linux.MEMBARRIER_CMD_GLOBAL, linux.MEMBARRIER_CMD_GLOBAL_EXPEDITED, linux.MEMBARRIER_CMD_PRIVATE_EXPEDITED:
 		if flags != 0 {
@@ -62,7 +67,9 @@ func Membarrier(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uint
 		if !t.Kernel().Platform.HaveGlobalMemoryBarrier() {
 			return 0, nil, linuxerr.EINVAL
 		}
-		// no-op
+		// MEMBARRIER_CMD_GLOBAL_EXPEDITED reaches all threads regardless of
+		// registration, so this only affects MEMBARRIER_CMD_GET_REGISTRATIONS.
+		t.MemoryManager().EnableMembarrierGlobal()
 		return 0, nil, nil
 	case linux.MEMBARRIER_CMD_REGISTER_PRIVATE_EXPEDITED:
 		if flags != 0 {
@@ -73,6 +80,34 @@ func Membarrier(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uint
 		}
 		t.MemoryManager().EnableMembarrierPrivate()
 		return 0, nil, nil
+	case linux.MEMBARRIER_CMD_PRIVATE_EXPEDITED_SYNC_CORE:
+		if flags != 0 {
+			return 0, nil, linuxerr.EINVAL
+		}
+		if !haveMembarrierSyncCore(t) {
+			return 0, nil, linuxerr.EINVAL
+		}
+		if !t.MemoryManager().IsMembarrierSyncCoreEnabled() {
+			return 0, nil, linuxerr.EPERM
+		}
+		if err := t.Kernel().Platform.GlobalMemoryBarrier(); err != nil {
+			return 0, nil, err
+		}
+		// Preempting all CPUs forces every thread executing application code
+		// to return to the sentry before it can execute further application
+		// instructions. Re-entering application mode is core serializing on
+		// all supported architectures (IRET on amd64, ERET on arm64), which
+		// satisfies the SYNC_CORE guarantee.
+		return 0, nil, t.Kernel().Platform.PreemptAllCPUs()
+	case linux.MEMBARRIER_CMD_REGISTER_PRIVATE_EXPEDITED_SYNC_CORE:
+		if flags != 0 {
+			return 0, nil, linuxerr.EINVAL
+		}
+		if !haveMembarrierSyncCore(t) {
+			return 0, nil, linuxerr.EINVAL
+		}
+		t.MemoryManager().EnableMembarrierSyncCore()
+		return 0, nil, nil
 	case linux.MEMBARRIER_CMD_PRIVATE_EXPEDITED_RSEQ:
 		if flags&^linux.MEMBARRIER_CMD_FLAG_CPU != 0 {
 			return 0, nil, linuxerr.EINVAL
@@ -95,9 +130,37 @@ func Membarrier(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uint
 		}
 		t.MemoryManager().EnableMembarrierRSeq()
 		return 0, nil, nil
+	case linux.MEMBARRIER_CMD_GET_REGISTRATIONS:
+		if flags != 0 {
+			return 0, nil, linuxerr.EINVAL
+		}
+		mm := t.MemoryManager()
+		var registrations uintptr
+		if mm.IsMembarrierGlobalEnabled() {
+			registrations |= linux.MEMBARRIER_CMD_REGISTER_GLOBAL_EXPEDITED
+		}
+		if mm.IsMembarrierPrivateEnabled() {
+			registrations |= linux.MEMBARRIER_CMD_REGISTER_PRIVATE_EXPEDITED
+		}
+		if mm.IsMembarrierSyncCoreEnabled() {
+			registrations |= linux.MEMBARRIER_CMD_REGISTER_PRIVATE_EXPEDITED_SYNC_CORE
+		}
+		if mm.IsMembarrierRSeqEnabled() {
+			registrations |= linux.MEMBARRIER_CMD_REGISTER_PRIVATE_EXPEDITED_RSEQ
+		}
+		return registrations, nil, nil
 	default:
 		// Probably a command we don't implement.
 		t.Kernel().EmitUnimplementedEvent(t, sysno)
 		return 0, nil, linuxerr.EINVAL
 	}
 }
+
+// haveMembarrierSyncCore returns true if
+// MEMBARRIER_CMD_PRIVATE_EXPEDITED_SYNC_CORE is supported. This requires both a
+// global memory barrier and the ability to force all threads running
+// application code back into the sentry.
+func haveMembarrierSyncCore(t *kernel.Task) bool {
+	p := t.Kernel().Platform
+	return p.HaveGlobalMemoryBarrier() && p.DetectsCPUPreemption()
+}
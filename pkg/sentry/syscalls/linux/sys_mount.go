@@ -20,6 +20,8 @@ import (
 	"github.com/wilinz/gvisor/pkg/hostarch"
 	"github.com/wilinz/gvisor/pkg/sentry/arch"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
+	"github.com/wilinz/gvisor/pkg/sentry/lsm"
 	"github.com/wilinz/gvisor/pkg/sentry/vfs"
 )
 
@@ -92,6 +94,11 @@ func Mount(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 		}
 	}
 	opts.GetFilesystemOptions.Data = data
+	if lsm.Enabled() {
+		if err := checkMountLSM(t, creds, sourceAddr, typeAddr, &target.pop, flags); err != nil {
+			return 0, nil, err
+		}
+	}
 	switch {
 	case flags&linux.MS_REMOUNT != 0:
 		// When MS_REMOUNT is specified, the flags and data should match the values used in the original mount() call,
@@ -131,6 +138,32 @@ func Mount(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 	return 0, nil, err
 }
 
+// checkMountLSM calls the LSM hook for mounting onto target.
+func checkMountLSM(t *kernel.Task, creds *auth.Credentials, sourceAddr, typeAddr hostarch.Addr, target *vfs.PathOperation, flags uint64) error {
+	vfsObj := t.Kernel().VFS()
+	vd, err := vfsObj.GetDentryAt(t, creds, target, &vfs.GetDentryOptions{})
+	if err != nil {
+		return err
+	}
+	defer vd.DecRef(t)
+	root := t.FSContext().RootDirectory()
+	defer root.DecRef(t)
+	targetPath, err := vfsObj.PathnameWithDeleted(t, root, vd)
+	if err != nil {
+		return err
+	}
+	// The source and filesystem type are only informational, and may
+	// legitimately be unset (e.g. for MS_REMOUNT).
+	var source, fsType string
+	if sourceAddr != 0 {
+		source, _ = t.CopyInString(sourceAddr, hostarch.PageSize)
+	}
+	if typeAddr != 0 {
+		fsType, _ = t.CopyInString(typeAddr, hostarch.PageSize)
+	}
+	return lsm.SBMount(t, creds, source, targetPath, fsType, flags)
+}
+
 // Umount2 implements Linux syscall umount2(2).
 func Umount2(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	addr := args[0].Pointer()
@@ -102,11 +102,19 @@ func releaseState(t *kernel.Task, state []pollState) {
 //
 // pollBlock returns the remaining timeout, which is always 0 on a timeout; and 0 or
 // positive if interrupted by a signal.
+//
+// Like Linux, the timeout is converted to a deadline on entry, so that neither
+// the time taken to register with the files nor spurious wakeups extend it.
 func pollBlock(t *kernel.Task, pfd []linux.PollFD, timeout time.Duration) (time.Duration, uintptr, error) {
 	var ch chan struct{}
 	if timeout != 0 {
 		ch = make(chan struct{}, 1)
 	}
+	haveDeadline := timeout > 0
+	var deadline ktime.Time
+	if haveDeadline {
+		deadline = t.Kernel().MonotonicClock().Now().Add(timeout)
+	}
 
 	// Register for event notification in the files involved if we may
 	// block (timeout not zero). Once we find a file that has a non-zero
@@ -129,17 +137,13 @@ func pollBlock(t *kernel.Task, pfd []linux.PollFD, timeout time.Duration) (time.
 		return timeout, n, nil
 	}
 
-	haveTimeout := timeout >= 0
-
 	for n == 0 {
-		var err error
 		// Wait for a notification.
-		timeout, err = t.BlockWithTimeout(ch, haveTimeout, timeout)
-		if err != nil {
+		if err := t.BlockWithDeadline(ch, haveDeadline, deadline); err != nil {
 			if linuxerr.Equals(linuxerr.ETIMEDOUT, err) {
-				err = nil
+				return 0, 0, nil
 			}
-			return timeout, 0, err
+			return deadlineRemaining(t, haveDeadline, deadline, timeout), 0, err
 		}
 
 		// We got notified, count how many files are ready. If none,
@@ -159,7 +163,20 @@ func pollBlock(t *kernel.Task, pfd []linux.PollFD, timeout time.Duration) (time.
 		}
 	}
 
-	return timeout, n, nil
+	return deadlineRemaining(t, haveDeadline, deadline, timeout), n, nil
+}
+
+// deadlineRemaining returns the time remaining until deadline, capped to 0, or
+// timeout if there is no deadline.
+func deadlineRemaining(t *kernel.Task, haveDeadline bool, deadline ktime.Time, timeout time.Duration) time.Duration {
+	if !haveDeadline {
+		return timeout
+	}
+	remaining := deadline.Sub(t.Kernel().MonotonicClock().Now())
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining
 }
 
 // CopyInPollFDs copies an array of struct pollfd unless nfds exceeds the max.
@@ -391,7 +408,14 @@ func copyOutTimevalRemaining(t *kernel.Task, startNs ktime.Time, timeout time.Du
 		return nil
 	}
 	remaining := timeoutRemaining(t, startNs, timeout)
-	tvRemaining := linux.NsecToTimeval(remaining.Nanoseconds())
+	// Unlike linux.NsecToTimeval, Linux truncates the remaining time to
+	// microseconds rather than rounding it up, so that a timeout that has
+	// nearly expired isn't reported as a full microsecond. See
+	// fs/select.c:poll_select_finish().
+	tvRemaining := linux.Timeval{
+		Sec:  remaining.Nanoseconds() / 1e9,
+		Usec: remaining.Nanoseconds() % 1e9 / 1e3,
+	}
 	_, err := tvRemaining.CopyOut(t, timevalAddr)
 	return err
 }
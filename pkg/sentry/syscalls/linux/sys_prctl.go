@@ -16,6 +16,7 @@ package linux
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/wilinz/gvisor/pkg/abi/linux"
 	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
@@ -204,6 +205,20 @@ func Prctl(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 	case linux.PR_GET_SECCOMP:
 		return uintptr(t.SeccompMode()), nil, nil
 
+	case linux.PR_SET_SYSCALL_USER_DISPATCH:
+		switch args[1].Int() {
+		case linux.PR_SYS_DISPATCH_OFF:
+			if args[2].Uint64() != 0 || args[3].Uint64() != 0 || args[4].Uint64() != 0 {
+				return 0, nil, linuxerr.EINVAL
+			}
+			t.DisableSyscallUserDispatch()
+			return 0, nil, nil
+		case linux.PR_SYS_DISPATCH_ON:
+			return 0, nil, t.EnableSyscallUserDispatch(args[2].Pointer(), args[3].Uint64(), args[4].Pointer())
+		default:
+			return 0, nil, linuxerr.EINVAL
+		}
+
 	case linux.PR_CAPBSET_READ:
 		cp := linux.Capability(args[1].Uint64())
 		if !cp.Ok() {
@@ -256,14 +271,20 @@ func Prctl(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 		}
 		return 0, nil, t.MemoryManager().SetVMAAnonName(args[2].Pointer(), args[3].Uint64(), name, nameIsNil)
 
+	case linux.PR_GET_TIMERSLACK:
+		return uintptr(t.TimerSlack().Nanoseconds()), nil, nil
+
+	case linux.PR_SET_TIMERSLACK:
+		// As in Linux, a slack of 0 restores the task's default slack.
+		t.SetTimerSlack(time.Duration(args[1].Uint64()))
+		return 0, nil, nil
+
 	case linux.PR_GET_TIMING,
 		linux.PR_SET_TIMING,
 		linux.PR_GET_TSC,
 		linux.PR_SET_TSC,
 		linux.PR_TASK_PERF_EVENTS_DISABLE,
 		linux.PR_TASK_PERF_EVENTS_ENABLE,
-		linux.PR_GET_TIMERSLACK,
-		linux.PR_SET_TIMERSLACK,
 		linux.PR_MCE_KILL,
 		linux.PR_MCE_KILL_GET,
 		linux.PR_GET_TID_ADDRESS,
@@ -19,7 +19,6 @@ import (
 
 	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
 	"github.com/wilinz/gvisor/pkg/hostarch"
-	"github.com/wilinz/gvisor/pkg/rand"
 	"github.com/wilinz/gvisor/pkg/safemem"
 	"github.com/wilinz/gvisor/pkg/sentry/arch"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel"
@@ -35,9 +34,9 @@ const (
 //
 // In a multi-tenant/shared environment, the only valid implementation is to
 // fetch data from the urandom pool, otherwise starvation attacks become
-// possible. The urandom pool is also expected to have plenty of entropy, thus
-// the GRND_RANDOM flag is ignored. The GRND_NONBLOCK flag does not apply, as
-// the pool will already be initialized.
+// possible. The kernel's entropy pool is backed by the urandom pool and never
+// blocks, thus the GRND_RANDOM flag is ignored. The GRND_NONBLOCK flag does
+// not apply, as the pool will already be initialized.
 func GetRandom(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	addr := args[0].Pointer()
 	length := args[1].SizeT()
@@ -56,7 +55,7 @@ func GetRandom(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintp
 		return 0, nil, linuxerr.EFAULT
 	}
 
-	n, err := t.MemoryManager().CopyOutFrom(t, hostarch.AddrRangeSeqOf(ar), safemem.FromIOReader{rand.Reader}, usermem.IOOpts{
+	n, err := t.MemoryManager().CopyOutFrom(t, hostarch.AddrRangeSeqOf(ar), safemem.FromIOReader{t.Kernel().EntropyPool()}, usermem.IOOpts{
 		AddressSpaceActive: true,
 	})
 	if n > 0 {
@@ -15,6 +15,8 @@
 package linux
 
 import (
+	"math"
+
 	"github.com/wilinz/gvisor/pkg/abi/linux"
 	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
 	"github.com/wilinz/gvisor/pkg/hostarch"
@@ -42,6 +44,8 @@ func newRlimit(t *kernel.Task) (rlimit, error) {
 	case 8:
 		// On 64-bit system, struct rlimit and struct rlimit64 are identical.
 		return &rlimit64{}, nil
+	case 4:
+		return &rlimit32{}, nil
 	default:
 		return nil, linuxerr.ENOSYS
 	}
@@ -77,6 +81,49 @@ func (r *rlimit64) copyOut(t *kernel.Task, addr hostarch.Addr) error {
 	return err
 }
 
+// rlimit32 is struct compat_rlimit, used by 32-bit compatibility mode tasks.
+//
+// +marshal
+type rlimit32 struct {
+	Cur uint32
+	Max uint32
+}
+
+// compatRLimInfinity is COMPAT_RLIM_INFINITY in Linux.
+const compatRLimInfinity = math.MaxUint32
+
+// fromCompatRlimit converts a compat rlimit value to a sentry Limit value.
+func fromCompatRlimit(rl uint32) uint64 {
+	if rl == compatRLimInfinity {
+		return limits.Infinity
+	}
+	return uint64(rl)
+}
+
+// toCompatRlimit converts a sentry Limit value to a compat rlimit value,
+// clamping values that don't fit like Linux's
+// kernel/sys.c:COMPAT_SYSCALL_DEFINE2(getrlimit).
+func toCompatRlimit(l uint64) uint32 {
+	if l > compatRLimInfinity {
+		return compatRLimInfinity
+	}
+	return uint32(l)
+}
+
+func (r *rlimit32) toLimit() *limits.Limit {
+	return &limits.Limit{
+		Cur: fromCompatRlimit(r.Cur),
+		Max: fromCompatRlimit(r.Max),
+	}
+}
+
+func (r *rlimit32) fromLimit(lim limits.Limit) {
+	*r = rlimit32{
+		Cur: toCompatRlimit(lim.Cur),
+		Max: toCompatRlimit(lim.Max),
+	}
+}
+
 func makeRlimit64(lim limits.Limit) *rlimit64 {
 	return &rlimit64{Cur: lim.Cur, Max: lim.Max}
 }
@@ -17,6 +17,7 @@ package linux
 import (
 	"github.com/wilinz/gvisor/pkg/abi/linux"
 	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/hostarch"
 	"github.com/wilinz/gvisor/pkg/sentry/arch"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel"
 	"github.com/wilinz/gvisor/pkg/sentry/ktime"
@@ -81,8 +82,16 @@ func Getrusage(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintp
 	}
 
 	ru := getrusage(t, which)
+	return 0, nil, copyOutRusage(t, addr, &ru)
+}
+
+// copyOutRusage copies out ru as the struct rusage of t.
+func copyOutRusage(t *kernel.Task, addr hostarch.Addr, ru *linux.Rusage) error {
+	if t.Arch().Width() == 4 {
+		return copyOutRusage32(t, addr, ru)
+	}
 	_, err := ru.CopyOut(t, addr)
-	return 0, nil, err
+	return err
 }
 
 // Times implements linux syscall times(2).
@@ -17,13 +17,10 @@ package linux
 import (
 	"github.com/wilinz/gvisor/pkg/abi/linux"
 	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/hostarch"
 	"github.com/wilinz/gvisor/pkg/sentry/arch"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel"
-)
-
-const (
-	onlyScheduler = linux.SCHED_NORMAL
-	onlyPriority  = 0
+	"github.com/wilinz/gvisor/pkg/sentry/limits"
 )
 
 // SchedParam replicates struct sched_param in sched.h.
@@ -33,6 +30,103 @@ type SchedParam struct {
 	schedPriority int32
 }
 
+// Real-time priority bounds, as for Linux's MAX_RT_PRIO.
+const (
+	minRTPriority = 1
+	maxRTPriority = 99
+)
+
+// isRTPolicy returns true if policy is a real-time scheduling policy.
+func isRTPolicy(policy int32) bool {
+	return policy == linux.SCHED_FIFO || policy == linux.SCHED_RR
+}
+
+// isValidPolicy returns true if policy is a scheduling policy that may be set
+// by sched_setscheduler(2).
+func isValidPolicy(policy int32) bool {
+	switch policy {
+	case linux.SCHED_NORMAL, linux.SCHED_FIFO, linux.SCHED_RR, linux.SCHED_BATCH, linux.SCHED_IDLE:
+		return true
+	default:
+		return false
+	}
+}
+
+// schedTarget returns the task identified by pid for the sched_* syscalls.
+func schedTarget(t *kernel.Task, pid int32) (*kernel.Task, error) {
+	if pid < 0 {
+		return nil, linuxerr.EINVAL
+	}
+	if pid == 0 {
+		return t, nil
+	}
+	target := t.PIDNamespace().TaskWithID(kernel.ThreadID(pid))
+	if target == nil {
+		return nil, linuxerr.ESRCH
+	}
+	return target, nil
+}
+
+// setScheduler implements sched_setscheduler(2) and sched_setparam(2). If
+// policy is -1, target's current policy is retained.
+func setScheduler(t *kernel.Task, pid, policy int32, param hostarch.Addr) error {
+	if param == 0 {
+		return linuxerr.EINVAL
+	}
+	target, err := schedTarget(t, pid)
+	if err != nil {
+		return err
+	}
+	var r SchedParam
+	if _, err := r.CopyIn(t, param); err != nil {
+		return linuxerr.EFAULT
+	}
+
+	oldPolicy, oldPriority, oldResetOnFork := target.SchedPolicy()
+	resetOnFork := oldResetOnFork
+	if policy < 0 {
+		policy = oldPolicy
+	} else {
+		resetOnFork = policy&linux.SCHED_RESET_ON_FORK != 0
+		policy &^= linux.SCHED_RESET_ON_FORK
+		if !isValidPolicy(policy) {
+			return linuxerr.EINVAL
+		}
+	}
+
+	// Real-time policies require a priority in [1, 99]; other policies
+	// require priority 0.
+	prio := r.schedPriority
+	if prio < 0 || prio > maxRTPriority || isRTPolicy(policy) != (prio != 0) {
+		return linuxerr.EINVAL
+	}
+
+	// Permission checks, as in Linux's __sched_setscheduler().
+	if !t.HasCapabilityIn(linux.CAP_SYS_NICE, target.UserNamespace()) {
+		if isRTPolicy(policy) {
+			rlimit := int32(t.ThreadGroup().Limits().Get(limits.RealTimePriority).Cur)
+			if policy != oldPolicy && rlimit == 0 {
+				return linuxerr.EPERM
+			}
+			if prio > oldPriority && prio > rlimit {
+				return linuxerr.EPERM
+			}
+		}
+		if target != t {
+			creds, tcreds := t.Credentials(), target.Credentials()
+			if creds.EffectiveKUID != tcreds.EffectiveKUID && creds.EffectiveKUID != tcreds.RealKUID {
+				return linuxerr.EPERM
+			}
+		}
+		if oldResetOnFork && !resetOnFork {
+			return linuxerr.EPERM
+		}
+	}
+
+	target.SetSchedPolicy(policy, prio, resetOnFork)
+	return nil
+}
+
 // SchedGetparam implements linux syscall sched_getparam(2).
 func SchedGetparam(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	pid := args[0].Int()
@@ -40,13 +134,12 @@ func SchedGetparam(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (u
 	if param == 0 {
 		return 0, nil, linuxerr.EINVAL
 	}
-	if pid < 0 {
-		return 0, nil, linuxerr.EINVAL
-	}
-	if pid != 0 && t.PIDNamespace().TaskWithID(kernel.ThreadID(pid)) == nil {
-		return 0, nil, linuxerr.ESRCH
+	target, err := schedTarget(t, pid)
+	if err != nil {
+		return 0, nil, err
 	}
-	r := SchedParam{schedPriority: onlyPriority}
+	_, prio, _ := target.SchedPolicy()
+	r := SchedParam{schedPriority: prio}
 	if _, err := r.CopyOut(t, param); err != nil {
 		return 0, nil, err
 	}
@@ -54,16 +147,25 @@ func SchedGetparam(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (u
 	return 0, nil, nil
 }
 
+// SchedSetparam implements linux syscall sched_setparam(2).
+func SchedSetparam(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	pid := args[0].Int()
+	param := args[1].Pointer()
+	return 0, nil, setScheduler(t, pid, -1, param)
+}
+
 // SchedGetscheduler implements linux syscall sched_getscheduler(2).
 func SchedGetscheduler(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	pid := args[0].Int()
-	if pid < 0 {
-		return 0, nil, linuxerr.EINVAL
+	target, err := schedTarget(t, pid)
+	if err != nil {
+		return 0, nil, err
 	}
-	if pid != 0 && t.PIDNamespace().TaskWithID(kernel.ThreadID(pid)) == nil {
-		return 0, nil, linuxerr.ESRCH
+	policy, _, resetOnFork := target.SchedPolicy()
+	if resetOnFork {
+		policy |= linux.SCHED_RESET_ON_FORK
 	}
-	return onlyScheduler, nil, nil
+	return uintptr(policy), nil, nil
 }
 
 // SchedSetscheduler implements linux syscall sched_setscheduler(2).
@@ -71,31 +173,32 @@ func SchedSetscheduler(t *kernel.Task, sysno uintptr, args arch.SyscallArguments
 	pid := args[0].Int()
 	policy := args[1].Int()
 	param := args[2].Pointer()
-	if pid < 0 {
-		return 0, nil, linuxerr.EINVAL
-	}
-	if policy != onlyScheduler {
+	if policy < 0 {
 		return 0, nil, linuxerr.EINVAL
 	}
-	if pid != 0 && t.PIDNamespace().TaskWithID(kernel.ThreadID(pid)) == nil {
-		return 0, nil, linuxerr.ESRCH
-	}
-	var r SchedParam
-	if _, err := r.CopyIn(t, param); err != nil {
-		return 0, nil, linuxerr.EINVAL
-	}
-	if r.schedPriority != onlyPriority {
-		return 0, nil, linuxerr.EINVAL
-	}
-	return 0, nil, nil
+	return 0, nil, setScheduler(t, pid, policy, param)
 }
 
 // SchedGetPriorityMax implements linux syscall sched_get_priority_max(2).
 func SchedGetPriorityMax(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
-	return onlyPriority, nil, nil
+	policy := args[0].Int()
+	if !isValidPolicy(policy) {
+		return 0, nil, linuxerr.EINVAL
+	}
+	if isRTPolicy(policy) {
+		return maxRTPriority, nil, nil
+	}
+	return 0, nil, nil
 }
 
 // SchedGetPriorityMin implements linux syscall sched_get_priority_min(2).
 func SchedGetPriorityMin(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
-	return onlyPriority, nil, nil
+	policy := args[0].Int()
+	if !isValidPolicy(policy) {
+		return 0, nil, linuxerr.EINVAL
+	}
+	if isRTPolicy(policy) {
+		return minRTPriority, nil, nil
+	}
+	return 0, nil, nil
 }
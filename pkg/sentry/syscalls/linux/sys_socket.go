@@ -27,9 +27,11 @@ import (
 	"github.com/wilinz/gvisor/pkg/marshal/primitive"
 	"github.com/wilinz/gvisor/pkg/sentry/arch"
 	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/host"
+	"github.com/wilinz/gvisor/pkg/sentry/inet"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
 	"github.com/wilinz/gvisor/pkg/sentry/ktime"
+	"github.com/wilinz/gvisor/pkg/sentry/lsm"
 	"github.com/wilinz/gvisor/pkg/sentry/socket"
 	"github.com/wilinz/gvisor/pkg/sentry/socket/control"
 	"github.com/wilinz/gvisor/pkg/sentry/socket/unix/transport"
@@ -49,8 +51,9 @@ const maxOptLen = 1024 * 8
 // buffers upto INT_MAX.
 const maxControlLen = 10 * 1024 * 1024
 
-// maxListenBacklog is the maximum limit of listen backlog supported.
-const maxListenBacklog = 1024
+// maxListenBacklog is the maximum limit of listen backlog supported when
+// net.core.somaxconn can't be read from the network stack.
+const maxListenBacklog = inet.DefaultSomaxconn
 
 // nameLenOffset is the offset from the start of the MessageHeader64 struct to
 // the NameLen field.
@@ -275,6 +278,13 @@ func Connect(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr
 		return 0, nil, err
 	}
 
+	if lsm.Enabled() {
+		family, _, _ := s.Type()
+		if err := lsm.SocketConnect(t, t.Credentials(), family, lsm.FormatAddress(family, a)); err != nil {
+			return 0, nil, err
+		}
+	}
+
 	blocking := (file.StatusFlags() & linux.SOCK_NONBLOCK) == 0
 	return 0, nil, linuxerr.ConvertIntr(s.Connect(t, a, blocking).ToError(), linuxerr.ERESTARTSYS)
 }
@@ -386,11 +396,17 @@ func Listen(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 		return 0, nil, linuxerr.ENOTSOCK
 	}
 
-	if backlog > maxListenBacklog {
-		// Linux treats incoming backlog as uint with a limit defined by
-		// sysctl_somaxconn.
-		// https://github.com/torvalds/linux/blob/7acac4b3196/net/socket.c#L1666
-		backlog = maxListenBacklog
+	// Linux treats incoming backlog as uint with a limit defined by
+	// sysctl_somaxconn.
+	// https://github.com/torvalds/linux/blob/7acac4b3196/net/socket.c#L1666
+	somaxconn := uint32(maxListenBacklog)
+	if stack := t.NetworkNamespace().Stack(); stack != nil {
+		if v, err := stack.Sysctl(inet.SysctlSomaxconn); err == nil {
+			somaxconn = uint32(v)
+		}
+	}
+	if backlog > somaxconn {
+		backlog = somaxconn
 	}
 
 	// Accept one more than the configured listen backlog to keep in parity with
@@ -18,12 +18,14 @@ import (
 	"io"
 
 	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/buffer"
 	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
 	"github.com/wilinz/gvisor/pkg/log"
 	"github.com/wilinz/gvisor/pkg/marshal/primitive"
 	"github.com/wilinz/gvisor/pkg/sentry/arch"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel/pipe"
+	"github.com/wilinz/gvisor/pkg/sentry/socket"
 	"github.com/wilinz/gvisor/pkg/sentry/vfs"
 	"github.com/wilinz/gvisor/pkg/usermem"
 	"github.com/wilinz/gvisor/pkg/waiter"
@@ -266,6 +268,101 @@ func Tee(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *k
 	return uintptr(n), nil, HandleIOError(t, n != 0, err, linuxerr.ERESTARTSYS, "tee", inFile)
 }
 
+// Vmsplice implements Linux syscall vmsplice(2).
+func Vmsplice(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	fd := args[0].Int()
+	addr := args[1].Pointer()
+	nrSegs := args[2].Uint64()
+	flags := args[3].Int()
+
+	// Check for invalid flags.
+	if flags&^(linux.SPLICE_F_MOVE|linux.SPLICE_F_NONBLOCK|linux.SPLICE_F_MORE|linux.SPLICE_F_GIFT) != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+
+	file := t.GetFile(fd)
+	if file == nil {
+		return 0, nil, linuxerr.EBADF
+	}
+	defer file.DecRef(t)
+
+	// As in Linux, a pipe that is open for writing is spliced into, even if
+	// it is also open for reading.
+	toPipe := file.IsWritable()
+	if !toPipe && !file.IsReadable() {
+		return 0, nil, linuxerr.EBADF
+	}
+
+	if nrSegs > linux.UIO_MAXIOV {
+		return 0, nil, linuxerr.EINVAL
+	}
+	iovecs, err := t.IovecsIOSequence(addr, int(nrSegs), usermem.IOOpts{
+		AddressSpaceActive: true,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if _, ok := file.Impl().(*pipe.VFSPipeFD); !ok {
+		return 0, nil, linuxerr.EBADF
+	}
+	if iovecs.NumBytes() == 0 {
+		return 0, nil, nil
+	}
+
+	// Unlike read(2) and write(2), vmsplice only honors SPLICE_F_NONBLOCK,
+	// and not O_NONBLOCK on the pipe.
+	nonBlock := flags&linux.SPLICE_F_NONBLOCK != 0
+
+	// Transfer what we can once data or space is available in the pipe;
+	// unlike write(2), vmsplice doesn't wait to transfer everything.
+	//
+	// Pipes hold a copy of the spliced data rather than referencing the
+	// caller's pages, so SPLICE_F_GIFT needs no special handling: changes
+	// to gifted pages can't affect data already in the pipe.
+	mask := eventMaskRead
+	if toPipe {
+		mask = eventMaskWrite
+	}
+	var (
+		n  int64
+		w  waiter.Entry
+		ch chan struct{}
+	)
+	for {
+		if toPipe {
+			n, err = file.Write(t, iovecs, vfs.WriteOptions{})
+		} else {
+			n, err = file.Read(t, iovecs, vfs.ReadOptions{})
+		}
+		if n != 0 || !linuxerr.Equals(linuxerr.ErrWouldBlock, err) || nonBlock {
+			break
+		}
+		if ch == nil {
+			w, ch = waiter.NewChannelEntry(mask)
+			if err = file.EventRegister(&w); err != nil {
+				break
+			}
+			defer file.EventUnregister(&w)
+			// We might be ready now. Try again before blocking.
+			continue
+		}
+		if err = t.Block(ch); err != nil {
+			break
+		}
+	}
+
+	if n != 0 {
+		// If a partial transfer is completed, the error is dropped. Log it
+		// here.
+		if err != nil && err != io.EOF && !linuxerr.Equals(linuxerr.ErrWouldBlock, err) {
+			log.Debugf("vmsplice completed a partial transfer with error: %v", err)
+			err = nil
+		}
+	}
+	return uintptr(n), nil, HandleIOError(t, n != 0, err, linuxerr.ERESTARTSYS, "vmsplice", file)
+}
+
 // Sendfile implements linux system call sendfile(2).
 func Sendfile(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	outFD := args[0].Int()
@@ -355,6 +452,10 @@ func Sendfile(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintpt
 	// block device. We only need to check if writing to the output file
 	// can block.
 	nonBlock := outFile.StatusFlags()&linux.O_NONBLOCK != 0
+	zeroCopy := false
+	if !outIsPipe {
+		total, offset, zeroCopy, err = sendfileZeroCopy(t, &dw, inFile, outFile, offset, count, nonBlock)
+	}
 	if outIsPipe {
 		for {
 			var n int64
@@ -377,7 +478,7 @@ func Sendfile(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintpt
 				break
 			}
 		}
-	} else {
+	} else if !zeroCopy {
 		// Read inFile to buffer, then write the contents to outFile.
 		//
 		// The buffer size has to be limited to avoid large memory
@@ -471,6 +572,95 @@ func Sendfile(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintpt
 	return uintptr(total), nil, HandleIOError(t, total != 0, err, linuxerr.ERESTARTSYS, "sendfile", inFile)
 }
 
+// sendfileZeroCopy sends up to count bytes from inFile, starting at offset or
+// at inFile's file offset if offset is -1, to outFile without copying them
+// through an intermediate buffer. It returns the number of bytes sent, the
+// updated offset, and whether the transfer could be done without copying; if
+// it couldn't, nothing was sent and the caller must fall back to copying.
+//
+// Data is taken from inFile's page cache, or read by the host directly from
+// inFile's host file descriptor when outFile is a host socket, so that
+// sending it to a socket doesn't require a copy through sentry memory.
+func sendfileZeroCopy(t *kernel.Task, dw *dualWaiter, inFile, outFile *vfs.FileDescription, offset, count int64, nonBlock bool) (int64, int64, bool, error) {
+	var send func(off, n int64) (int64, error)
+	switch out := outFile.Impl().(type) {
+	case socket.HostFileSender:
+		send = func(off, n int64) (int64, error) {
+			return inFile.WithHostFDForRead(t, func(hostFD int32) (int64, error) {
+				return out.SendfileFromHostFD(t, hostFD, off, n)
+			})
+		}
+	case socket.BufferWriter:
+		send = func(off, n int64) (int64, error) {
+			var buf buffer.Buffer
+			defer buf.Release()
+			// Errors after a partial read will recur on the next call.
+			if readN, err := inFile.PReadBuffer(t, &buf, off, n); readN == 0 {
+				return 0, err
+			}
+			return out.WriteBuffer(t, &buf)
+		}
+	default:
+		return 0, offset, false, nil
+	}
+
+	fileOffset := offset == -1
+	if fileOffset {
+		off, err := inFile.Seek(t, 0, linux.SEEK_CUR)
+		if err != nil {
+			return 0, offset, false, nil
+		}
+		offset = off
+	}
+
+	var (
+		total int64
+		err   error
+	)
+	for total < count {
+		// As with copying, limit the amount of data sent at once to the size
+		// of a pipe.
+		n := count - total
+		if n > pipe.MaximumPipeSize {
+			n = pipe.MaximumPipeSize
+		}
+		var sent int64
+		sent, err = send(offset, n)
+		if total == 0 && linuxerr.Equals(linuxerr.EOPNOTSUPP, err) {
+			if fileOffset {
+				offset = -1
+			}
+			return 0, offset, false, nil
+		}
+		offset += sent
+		total += sent
+		if sent == 0 && err == nil {
+			// EOF.
+			break
+		}
+		if err == nil && t.Interrupted() {
+			err = linuxerr.ErrInterrupted
+			break
+		}
+		if linuxerr.Equals(linuxerr.ErrWouldBlock, err) && !nonBlock {
+			err = dw.waitForOut(t)
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	if fileOffset {
+		if total != 0 {
+			if _, seekErr := inFile.Seek(t, offset, linux.SEEK_SET); seekErr != nil {
+				log.Warningf("failed to advance input file offset: %v", seekErr)
+			}
+		}
+		offset = -1
+	}
+	return total, offset, true, err
+}
+
 // dualWaiter is used to wait on one or both vfs.FileDescriptions. It is not
 // thread-safe, and does not take a reference on the vfs.FileDescriptions.
 //
@@ -93,8 +93,7 @@ func fstatat(t *kernel.Task, dirfd int32, pathAddr, statAddr hostarch.Addr, flag
 				}
 				var stat linux.Stat
 				convertStatxToUserStat(t, &statx, &stat)
-				_, err = stat.CopyOut(t, statAddr)
-				return err
+				return copyOutStat(t, statAddr, &stat)
 			}
 			start = dirfile.VirtualDentry()
 			start.IncRef()
@@ -114,7 +113,16 @@ func fstatat(t *kernel.Task, dirfd int32, pathAddr, statAddr hostarch.Addr, flag
 	}
 	var stat linux.Stat
 	convertStatxToUserStat(t, &statx, &stat)
-	_, err = stat.CopyOut(t, statAddr)
+	return copyOutStat(t, statAddr, &stat)
+}
+
+// copyOutStat copies out stat as the struct stat of t: struct stat64 for 32-bit
+// compatibility mode tasks, which have no 64-bit struct stat.
+func copyOutStat(t *kernel.Task, addr hostarch.Addr, stat *linux.Stat) error {
+	if t.Arch().Width() == 4 {
+		return copyOutStat64(t, addr, stat)
+	}
+	_, err := stat.CopyOut(t, addr)
 	return err
 }
 
@@ -144,8 +152,7 @@ func Fstat(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 	}
 	var stat linux.Stat
 	convertStatxToUserStat(t, &statx, &stat)
-	_, err = stat.CopyOut(t, statAddr)
-	return 0, nil, err
+	return 0, nil, copyOutStat(t, statAddr, &stat)
 }
 
 // Statx implements Linux syscall statx(2).
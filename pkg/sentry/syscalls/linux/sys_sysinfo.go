@@ -39,13 +39,26 @@ func Sysinfo(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr
 		memFree = 0
 	}
 
+	// The monotonic clock is virtualized and doesn't go backward across
+	// save/restore. Like Linux, round partial seconds up.
+	k := t.Kernel()
+	now := k.MonotonicClock().Now()
+	uptime := now.Seconds()
+	if now.Nanoseconds()%1e9 != 0 {
+		uptime++
+	}
+
 	// Only a subset of the fields in sysinfo_t make sense to return.
 	si := linux.Sysinfo{
-		Procs:    uint16(t.Kernel().TaskSet().Root.NumTasks()),
-		Uptime:   t.Kernel().MonotonicClock().Now().Seconds(),
-		TotalRAM: totalSize,
-		FreeRAM:  memFree,
-		Unit:     1,
+		Procs:     uint16(k.TaskSet().Root.NumTasks()),
+		Uptime:    uptime,
+		TotalRAM:  totalSize,
+		FreeRAM:   memFree,
+		SharedRAM: memStats.Tmpfs,
+		Unit:      1,
+	}
+	for i, load := range k.LoadAvg() {
+		si.Loads[i] = load << (linux.SI_LOAD_SHIFT - kernel.LoadAvgShift)
 	}
 	_, err = si.CopyOut(t, addr)
 	return 0, nil, err
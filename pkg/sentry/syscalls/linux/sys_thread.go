@@ -15,6 +15,10 @@
 package linux
 
 import (
+	"fmt"
+	"math"
+	"strings"
+
 	"github.com/wilinz/gvisor/pkg/abi/linux"
 	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
 	"github.com/wilinz/gvisor/pkg/fspath"
@@ -114,6 +118,9 @@ func execveat(t *kernel.Task, dirfd int32, pathnameAddr, argvAddr, envvAddr host
 		}
 	}()
 	closeOnExec := false
+	// filename and name are passed to the loader; see loader.LoadArgs.
+	filename := pathname
+	var name string
 	if path := fspath.Parse(pathname); dirfd != linux.AT_FDCWD && !path.Absolute {
 		// We must open the executable ourselves since dirfd is used as the
 		// starting point while resolving path, but the task working directory
@@ -147,6 +154,21 @@ func execveat(t *kernel.Task, dirfd int32, pathnameAddr, argvAddr, envvAddr host
 		}
 		executable = file
 		pathname = executable.MappedName(t)
+
+		// As in Linux (fs/exec.c:alloc_bprm()), the executable is named by
+		// a path through /dev/fd, so that interpreter scripts run from a
+		// file descriptor (e.g. a memfd or an O_PATH descriptor) can be
+		// opened by the interpreter as long as the descriptor isn't
+		// close-on-exec.
+		filename = fmt.Sprintf("/dev/fd/%d", dirfd)
+		if path.HasComponents() {
+			filename += "/" + path.String()
+		} else {
+			// fexecve(3): the task command name is taken from the
+			// executable's name rather than the /dev/fd path. Compare
+			// Linux's fs/exec.c:begin_new_exec() (bprm->comm_from_dentry).
+			name = strings.TrimSuffix(pathname[strings.LastIndexByte(pathname, '/')+1:], " (deleted)")
+		}
 	}
 
 	// Load the new TaskImage.
@@ -158,7 +180,8 @@ func execveat(t *kernel.Task, dirfd int32, pathnameAddr, argvAddr, envvAddr host
 		WorkingDir:          wd,
 		RemainingTraversals: &remainingTraversals,
 		ResolveFinal:        flags&linux.AT_SYMLINK_NOFOLLOW == 0,
-		Filename:            pathname,
+		Filename:            filename,
+		Name:                name,
 		File:                executable,
 		CloseOnExec:         closeOnExec,
 		Argv:                argv,
@@ -249,6 +272,17 @@ func Clone3(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 		}
 	}
 
+	// See Linux kernel/fork.c:copy_clone_args_from_user().
+	if cloneArgs.SetTIDSize > linux.MAX_PID_NS_LEVEL {
+		return 0, nil, linuxerr.EINVAL
+	}
+	if (cloneArgs.SetTID == 0) != (cloneArgs.SetTIDSize == 0) {
+		return 0, nil, linuxerr.EINVAL
+	}
+	if cloneArgs.Flags&linux.CLONE_INTO_CGROUP != 0 && (cloneArgs.Cgroup > math.MaxInt32 || int(size) < linux.CLONE_ARGS_SIZE_VER2) {
+		return 0, nil, linuxerr.EINVAL
+	}
+
 	ntid, ctrl, err := t.Clone(&cloneArgs)
 	if err != nil {
 		return 0, nil, err
@@ -329,7 +363,7 @@ func wait4(t *kernel.Task, pid int, statusAddr hostarch.Addr, options int, rusag
 	}
 	if rusageAddr != 0 {
 		ru := getrusage(wr.Task, linux.RUSAGE_BOTH)
-		if _, err := ru.CopyOut(t, rusageAddr); err != nil {
+		if err := copyOutRusage(t, rusageAddr, &ru); err != nil {
 			return 0, err
 		}
 	}
@@ -414,7 +448,7 @@ func Waitid(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 	}
 	if rusageAddr != 0 {
 		ru := getrusage(wr.Task, linux.RUSAGE_BOTH)
-		if _, err := ru.CopyOut(t, rusageAddr); err != nil {
+		if err := copyOutRusage(t, rusageAddr, &ru); err != nil {
 			return 0, nil, err
 		}
 	}
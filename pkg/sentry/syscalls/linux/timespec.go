@@ -36,6 +36,16 @@ func copyTimespecIn(t *kernel.Task, addr hostarch.Addr) (linux.Timespec, error)
 		ts.Sec = int64(hostarch.ByteOrder.Uint64(in[0:]))
 		ts.Nsec = int64(hostarch.ByteOrder.Uint64(in[8:]))
 		return ts, nil
+	case 4:
+		ts := linux.Timespec{}
+		in := t.CopyScratchBuffer(8)
+		_, err := t.CopyInBytes(addr, in)
+		if err != nil {
+			return ts, err
+		}
+		ts.Sec = int64(int32(hostarch.ByteOrder.Uint32(in[0:])))
+		ts.Nsec = int64(int32(hostarch.ByteOrder.Uint32(in[4:])))
+		return ts, nil
 	default:
 		return linux.Timespec{}, linuxerr.ENOSYS
 	}
@@ -50,6 +60,12 @@ func copyTimespecOut(t *kernel.Task, addr hostarch.Addr, ts *linux.Timespec) err
 		hostarch.ByteOrder.PutUint64(out[8:], uint64(ts.Nsec))
 		_, err := t.CopyOutBytes(addr, out)
 		return err
+	case 4:
+		out := t.CopyScratchBuffer(8)
+		hostarch.ByteOrder.PutUint32(out[0:], uint32(ts.Sec))
+		hostarch.ByteOrder.PutUint32(out[4:], uint32(ts.Nsec))
+		_, err := t.CopyOutBytes(addr, out)
+		return err
 	default:
 		return linuxerr.ENOSYS
 	}
@@ -68,6 +84,16 @@ func copyTimevalIn(t *kernel.Task, addr hostarch.Addr) (linux.Timeval, error) {
 		tv.Sec = int64(hostarch.ByteOrder.Uint64(in[0:]))
 		tv.Usec = int64(hostarch.ByteOrder.Uint64(in[8:]))
 		return tv, nil
+	case 4:
+		tv := linux.Timeval{}
+		in := t.CopyScratchBuffer(8)
+		_, err := t.CopyInBytes(addr, in)
+		if err != nil {
+			return tv, err
+		}
+		tv.Sec = int64(int32(hostarch.ByteOrder.Uint32(in[0:])))
+		tv.Usec = int64(int32(hostarch.ByteOrder.Uint32(in[4:])))
+		return tv, nil
 	default:
 		return linux.Timeval{}, linuxerr.ENOSYS
 	}
@@ -82,6 +108,12 @@ func copyTimevalOut(t *kernel.Task, addr hostarch.Addr, tv *linux.Timeval) error
 		hostarch.ByteOrder.PutUint64(out[8:], uint64(tv.Usec))
 		_, err := t.CopyOutBytes(addr, out)
 		return err
+	case 4:
+		out := t.CopyScratchBuffer(8)
+		hostarch.ByteOrder.PutUint32(out[0:], uint32(tv.Sec))
+		hostarch.ByteOrder.PutUint32(out[4:], uint32(tv.Usec))
+		_, err := t.CopyOutBytes(addr, out)
+		return err
 	default:
 		return linuxerr.ENOSYS
 	}
@@ -98,8 +130,8 @@ func copyTimespecInToDuration(t *kernel.Task, timespecAddr hostarch.Addr) (time.
 	// Use a negative Duration to indicate "no timeout".
 	timeout := time.Duration(-1)
 	if timespecAddr != 0 {
-		var timespec linux.Timespec
-		if _, err := timespec.CopyIn(t, timespecAddr); err != nil {
+		timespec, err := copyTimespecIn(t, timespecAddr)
+		if err != nil {
 			return 0, err
 		}
 		if !timespec.Valid() {
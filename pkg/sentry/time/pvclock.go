@@ -0,0 +1,157 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package time
+
+import (
+	"math/bits"
+
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/sync"
+)
+
+// pvclockParams are the parameters of a clock in the format of Linux's
+// struct pvclock_vcpu_time_info, as used by kvmclock. Unlike Parameters,
+// computing the time from them only takes a multiplication and shifts.
+type pvclockParams struct {
+	// ready indicates that the parameters are valid.
+	ready bool
+
+	// tscTimestamp is the TSC value when the time was systemTime.
+	tscTimestamp TSCValue
+
+	// systemTime is the time in nanoseconds corresponding to tscTimestamp.
+	systemTime int64
+
+	// tscToSystemMul and tscShift scale TSC cycles to nanoseconds:
+	//
+	//	ns = ((cycles << tscShift) * tscToSystemMul) >> 32
+	//
+	// where a negative tscShift shifts right.
+	tscToSystemMul uint32
+	tscShift       int8
+}
+
+// newPVClockParams converts p to pvclockParams. The scale is computed like
+// arch/x86/kvm/x86.c:kvm_get_time_scale() in Linux.
+func newPVClockParams(p Parameters) pvclockParams {
+	if p.Frequency == 0 {
+		return pvclockParams{}
+	}
+	const nsPerSec = 1000000000
+	const high = 0xffffffff00000000
+
+	var shift int8
+	tps64 := p.Frequency
+	scaled64 := uint64(nsPerSec)
+	for tps64 > scaled64*2 || tps64&high != 0 {
+		tps64 >>= 1
+		shift--
+	}
+	tps32 := uint32(tps64)
+	for uint64(tps32) <= scaled64 || scaled64&high != 0 {
+		if scaled64&high != 0 || tps32&0x80000000 != 0 {
+			scaled64 >>= 1
+		} else {
+			tps32 <<= 1
+		}
+		shift++
+	}
+	return pvclockParams{
+		ready:          true,
+		tscTimestamp:   p.BaseCycles,
+		systemTime:     int64(p.BaseRef),
+		tscToSystemMul: uint32((scaled64 << 32) / uint64(tps32)),
+		tscShift:       shift,
+	}
+}
+
+// computeTime returns the time in nanoseconds at TSC value now. Like
+// Parameters.ComputeTime, time doesn't go back before tscTimestamp.
+func (p *pvclockParams) computeTime(now TSCValue) int64 {
+	delta := uint64(0)
+	if now > p.tscTimestamp {
+		delta = uint64(now - p.tscTimestamp)
+	}
+	if p.tscShift < 0 {
+		delta >>= uint(-p.tscShift)
+	} else {
+		delta <<= uint(p.tscShift)
+	}
+	hi, lo := bits.Mul64(delta, uint64(p.tscToSystemMul))
+	return p.systemTime + int64(hi<<32|lo>>32)
+}
+
+// pvclockPage holds the pvclockParams of the monotonic and realtime clocks.
+type pvclockPage struct {
+	monotonic pvclockParams
+	realtime  pvclockParams
+}
+
+// PVClocks are Clocks whose time is computed from a kvmclock-style parameter
+// page, which is updated from the wrapped Clocks on each Update. Reading the
+// time takes no lock and makes no syscall, so it never causes the sentry to
+// block or exit to the host, which is costly on platforms where the sentry
+// runs in guest mode.
+//
+// Until the wrapped Clocks are calibrated, GetTime falls back to them.
+type PVClocks struct {
+	// clocks are the wrapped Clocks.
+	clocks Clocks
+
+	// seq protects page.
+	seq sync.SeqCount
+
+	// page holds the current clock parameters.
+	page pvclockPage
+}
+
+// NewPVClocks returns PVClocks that wrap c.
+func NewPVClocks(c Clocks) *PVClocks {
+	return &PVClocks{clocks: c}
+}
+
+// Update implements Clocks.Update.
+func (c *PVClocks) Update() (Parameters, bool, Parameters, bool) {
+	monotonicParams, monotonicOk, realtimeParams, realtimeOk := c.clocks.Update()
+
+	var page pvclockPage
+	if monotonicOk {
+		page.monotonic = newPVClockParams(monotonicParams)
+	}
+	if realtimeOk {
+		page.realtime = newPVClockParams(realtimeParams)
+	}
+	SeqAtomicStorePVClockPage(&c.seq, &c.page, page)
+
+	return monotonicParams, monotonicOk, realtimeParams, realtimeOk
+}
+
+// GetTime implements Clocks.GetTime.
+func (c *PVClocks) GetTime(id ClockID) (int64, error) {
+	page := SeqAtomicLoadPVClockPage(&c.seq, &c.page)
+	var p *pvclockParams
+	switch id {
+	case Monotonic:
+		p = &page.monotonic
+	case Realtime:
+		p = &page.realtime
+	default:
+		return 0, linuxerr.EINVAL
+	}
+	if !p.ready {
+		return c.clocks.GetTime(id)
+	}
+	return p.computeTime(Rdtsc()), nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package time
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPVClockParamsComputeTime(t *testing.T) {
+	for _, freq := range []uint64{
+		10000,
+		2400000000,
+		3999999999,
+		1000000000,
+		5000000000,
+	} {
+		params := Parameters{
+			BaseCycles: 10000,
+			BaseRef:    ReferenceNS(5000 * time.Millisecond.Nanoseconds()),
+			Frequency:  freq,
+		}
+		pv := newPVClockParams(params)
+		if !pv.ready {
+			t.Fatalf("newPVClockParams(%+v) is not ready", params)
+		}
+		for _, cycles := range []TSCValue{
+			0,
+			1,
+			TSCValue(freq / 1000),
+			TSCValue(freq),
+			TSCValue(2 * freq),
+		} {
+			now := params.BaseCycles + cycles
+			want, ok := params.ComputeTime(now)
+			if !ok {
+				t.Fatalf("%+v.ComputeTime(%d) overflowed", params, now)
+			}
+			got := pv.computeTime(now)
+			// The scale is truncated to 32 bits, so allow an error
+			// of a few nanoseconds per second.
+			maxErr := 1 + 10*int64(cycles)/int64(freq)
+			if diff := got - want; diff < -maxErr || diff > maxErr {
+				t.Errorf("frequency %d: computeTime(%d) = %d, want %d", freq, now, got, want)
+			}
+		}
+
+		// Time doesn't go back before the base cycles.
+		if got, want := pv.computeTime(params.BaseCycles-1), int64(params.BaseRef); got != want {
+			t.Errorf("frequency %d: computeTime(%d) = %d, want %d", freq, params.BaseCycles-1, got, want)
+		}
+	}
+}
+
+func TestPVClockParamsNotReady(t *testing.T) {
+	if pv := newPVClockParams(Parameters{}); pv.ready {
+		t.Errorf("newPVClockParams with zero frequency is ready: %+v", pv)
+	}
+}
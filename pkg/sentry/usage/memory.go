@@ -16,6 +16,7 @@ package usage
 
 import (
 	"fmt"
+	"math"
 	"os"
 
 	"golang.org/x/sys/unix"
@@ -238,6 +239,11 @@ func Init() error {
 	return initErr
 }
 
+// SharedMemCgID is the memory cgroup id to which memory shared between
+// containers is accounted, instead of being charged to any one of them. It is
+// never allocated to a real cgroup.
+const SharedMemCgID = math.MaxUint32
+
 // MemoryAccounting is the global memory stats.
 //
 // There is no need to save or restore the global memory accounting object,
@@ -319,6 +325,25 @@ func (m *MemoryLocked) Move(val uint64, to MemoryKind, from MemoryKind, memCgID
 	}
 }
 
+// MoveCgroup moves a usage of 'val' bytes of memory category 'kind' from the
+// cgroup with id 'fromCgID' to the cgroup with id 'toCgID'. A zero cgroup id
+// denotes memory that is accounted only for the total memory usage.
+//
+// This method is thread-safe.
+func (m *MemoryLocked) MoveCgroup(val uint64, kind MemoryKind, fromCgID, toCgID uint32) {
+	if fromCgID == toCgID {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if fromCgID != 0 {
+		m.decLockedPerCg(val, kind, fromCgID)
+	}
+	if toCgID != 0 {
+		m.incLockedPerCg(val, kind, toCgID)
+	}
+}
+
 // Total returns a total memory usage.
 //
 // This method is thread-safe.
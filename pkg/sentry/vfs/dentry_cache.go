@@ -0,0 +1,117 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfs
+
+import (
+	"math/bits"
+
+	"github.com/wilinz/gvisor/pkg/context"
+)
+
+// DentryCacheReclaimer is an optional interface implemented by FilesystemImpls
+// that cache dentries with no references.
+//
+// Such filesystems register the size of their caches with
+// VirtualFilesystem.AddDentryCache, bound them by
+// VirtualFilesystem.DentryCacheLimit, and report the dentries they add to and
+// remove from their caches with VirtualFilesystem.DentryCached and
+// VirtualFilesystem.DentryUncached, so that VFS can bound the total number of
+// cached dentries across all filesystems.
+type DentryCacheReclaimer interface {
+	// ReclaimCachedDentries removes up to n dentries from the filesystem's
+	// cache, least recently used first, evicting those which are still
+	// unreferenced. It returns the number of dentries removed from the
+	// cache.
+	//
+	// ReclaimCachedDentries is called without any VFS or filesystem locks
+	// held.
+	ReclaimCachedDentries(ctx context.Context, n uint64) uint64
+}
+
+// SetMaxCachedDentries sets the maximum number of dentries cached by all
+// filesystems. Zero means that only the limits of individual filesystems
+// apply.
+func (vfs *VirtualFilesystem) SetMaxCachedDentries(max uint64) {
+	vfs.maxCachedDentries.Store(max)
+}
+
+// CachedDentries returns the number of dentries cached by all filesystems.
+func (vfs *VirtualFilesystem) CachedDentries() uint64 {
+	return vfs.cachedDentries.Load()
+}
+
+// AddDentryCache records that a filesystem has a dentry cache holding up to
+// max dentries. It must be balanced by a call to RemoveDentryCache with the
+// same max when the cache is released.
+func (vfs *VirtualFilesystem) AddDentryCache(max uint64) {
+	vfs.dentryCacheLimits.Add(max)
+}
+
+// RemoveDentryCache undoes a previous call to AddDentryCache.
+func (vfs *VirtualFilesystem) RemoveDentryCache(max uint64) {
+	vfs.dentryCacheLimits.Add(-max)
+}
+
+// DentryCacheLimit returns the number of dentries that a cache registered
+// with AddDentryCache(max) may hold.
+//
+// If the limits of all registered caches add up to more than the limit set by
+// SetMaxCachedDentries, each cache's limit is scaled down proportionally so
+// that they add up to at most the VFS-wide limit. This way, each filesystem
+// only evicts its own dentries, without taking locks across filesystems, and a
+// filesystem with a large cache can't take up the VFS-wide limit at the
+// expense of the others.
+func (vfs *VirtualFilesystem) DentryCacheLimit(max uint64) uint64 {
+	global := vfs.maxCachedDentries.Load()
+	total := vfs.dentryCacheLimits.Load()
+	if global == 0 || total <= global {
+		return max
+	}
+	if max >= total {
+		// Only possible if the cache wasn't registered.
+		return min(max, global)
+	}
+	// max * global / total, which is less than global.
+	hi, lo := bits.Mul64(max, global)
+	limit, _ := bits.Div64(hi, lo, total)
+	return limit
+}
+
+// DentryCached records that a filesystem added a dentry to its cache.
+func (vfs *VirtualFilesystem) DentryCached() {
+	vfs.cachedDentries.Add(1)
+}
+
+// DentryUncached records that a filesystem removed a dentry from its cache.
+func (vfs *VirtualFilesystem) DentryUncached() {
+	vfs.cachedDentries.Add(^uint64(0))
+}
+
+// ReclaimCachedDentries asks all filesystems implementing
+// DentryCacheReclaimer to evict cached dentries until at most
+// (100-percent)% of the currently cached dentries remain. It is intended to
+// be called in response to memory pressure. It returns the number of dentries
+// removed from caches.
+func (vfs *VirtualFilesystem) ReclaimCachedDentries(ctx context.Context, percent uint64) uint64 {
+	want := vfs.cachedDentries.Load() * min(percent, 100) / 100
+	var reclaimed uint64
+	for fs := range vfs.getFilesystems() {
+		if r, ok := fs.impl.(DentryCacheReclaimer); ok && reclaimed < want {
+			reclaimed += r.ReclaimCachedDentries(ctx, want-reclaimed)
+		}
+		fs.DecRef(ctx)
+	}
+	return reclaimed
+}
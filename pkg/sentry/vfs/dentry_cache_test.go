@@ -0,0 +1,89 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfs
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDentryCacheLimit(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		global uint64
+		caches []uint64
+		max    uint64
+		want   uint64
+	}{
+		{
+			name:   "no global limit",
+			caches: []uint64{1000, 1000},
+			max:    1000,
+			want:   1000,
+		},
+		{
+			name:   "under global limit",
+			global: 2000,
+			caches: []uint64{1000, 1000},
+			max:    1000,
+			want:   1000,
+		},
+		{
+			name:   "scaled evenly",
+			global: 1000,
+			caches: []uint64{1000, 1000},
+			max:    1000,
+			want:   500,
+		},
+		{
+			name:   "scaled proportionally",
+			global: 1000,
+			caches: []uint64{3000, 1000},
+			max:    1000,
+			want:   250,
+		},
+		{
+			name:   "large limits",
+			global: math.MaxUint64 / 2,
+			caches: []uint64{math.MaxUint64 / 2, math.MaxUint64 / 2},
+			max:    math.MaxUint64 / 2,
+			want:   math.MaxUint64 / 4,
+		},
+		{
+			name:   "unregistered cache",
+			global: 1000,
+			caches: []uint64{1500},
+			max:    5000,
+			want:   1000,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var vfs VirtualFilesystem
+			vfs.SetMaxCachedDentries(test.global)
+			for _, max := range test.caches {
+				vfs.AddDentryCache(max)
+			}
+			if got := vfs.DentryCacheLimit(test.max); got != test.want {
+				t.Errorf("DentryCacheLimit(%d) = %d, want %d", test.max, got, test.want)
+			}
+			for _, max := range test.caches {
+				vfs.RemoveDentryCache(max)
+			}
+			if got := vfs.DentryCacheLimit(test.max); got != test.max {
+				t.Errorf("DentryCacheLimit(%d) after RemoveDentryCache = %d, want %d", test.max, got, test.max)
+			}
+		})
+	}
+}
@@ -17,8 +17,10 @@ package vfs
 import (
 	"fmt"
 
+	"github.com/wilinz/gvisor/pkg/abi/linux"
 	"github.com/wilinz/gvisor/pkg/context"
 	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
 )
 
 // DeviceKind indicates whether a device is a block or character device.
@@ -59,6 +61,32 @@ type Device interface {
 	Open(ctx context.Context, mnt *Mount, d *Dentry, opts OpenOptions) (*FileDescription, error)
 }
 
+// A BlockDeviceOpener is a Device whose contents may be accessed directly by
+// filesystem implementations, e.g. to mount a filesystem image stored on the
+// device.
+type BlockDeviceOpener interface {
+	Device
+
+	// OpenBlockDevice returns a BlockDeviceFile providing access to the
+	// contents of the device. If the device has no backing storage,
+	// OpenBlockDevice returns ENXIO.
+	OpenBlockDevice(ctx context.Context) (BlockDeviceFile, error)
+}
+
+// BlockDeviceFile provides access to the contents of a BlockDeviceOpener.
+type BlockDeviceFile interface {
+	// ReadAt reads up to len(dst) bytes from the device starting at byte
+	// offset off, with the semantics of io.ReaderAt.ReadAt.
+	ReadAt(ctx context.Context, dst []byte, off int64) (int, error)
+
+	// Size returns the size of the device in bytes.
+	Size(ctx context.Context) (int64, error)
+
+	// Release releases the BlockDeviceFile. The device may not be accessed
+	// through the BlockDeviceFile after Release is called.
+	Release(ctx context.Context)
+}
+
 // +stateify savable
 type registeredDevice struct {
 	dev  Device
@@ -132,6 +160,41 @@ func (vfs *VirtualFilesystem) OpenDeviceSpecialFile(ctx context.Context, mnt *Mo
 	return rd.dev.Open(ctx, mnt, d, *opts)
 }
 
+// OpenBlockDeviceAt returns a BlockDeviceFile for the block device
+// represented by the device special file at the given path. This is analogous
+// to Linux's fs/block_dev.c:lookup_bdev() followed by blkdev_get_by_dev().
+func (vfs *VirtualFilesystem) OpenBlockDeviceAt(ctx context.Context, creds *auth.Credentials, pop *PathOperation) (BlockDeviceFile, error) {
+	vd, err := vfs.GetDentryAt(ctx, creds, pop, &GetDentryOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer vd.DecRef(ctx)
+	stat, err := vfs.StatAt(ctx, creds, pop, &StatOptions{
+		Mask: linux.STATX_TYPE,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if stat.Mode&linux.S_IFMT != linux.S_IFBLK {
+		return nil, linuxerr.ENOTBLK
+	}
+	if vd.Mount().MountFlags()&linux.ST_NODEV != 0 {
+		return nil, linuxerr.EACCES
+	}
+
+	vfs.devicesMu.RLock()
+	rd, ok := vfs.devices[devTuple{BlockDevice, stat.RdevMajor, stat.RdevMinor}]
+	vfs.devicesMu.RUnlock()
+	if !ok {
+		return nil, linuxerr.ENXIO
+	}
+	bd, ok := rd.dev.(BlockDeviceOpener)
+	if !ok {
+		return nil, linuxerr.ENOTBLK
+	}
+	return bd.OpenBlockDevice(ctx)
+}
+
 // GetDynamicCharDevMajor allocates and returns an unused major device number
 // for a character device or set of character devices.
 func (vfs *VirtualFilesystem) GetDynamicCharDevMajor() (uint32, error) {
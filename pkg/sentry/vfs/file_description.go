@@ -19,6 +19,7 @@ import (
 
 	"github.com/wilinz/gvisor/pkg/abi/linux"
 	"github.com/wilinz/gvisor/pkg/atomicbitops"
+	"github.com/wilinz/gvisor/pkg/buffer"
 	"github.com/wilinz/gvisor/pkg/context"
 	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
 	"github.com/wilinz/gvisor/pkg/sentry/arch"
@@ -130,10 +131,17 @@ const FileCreationFlags = linux.O_CREAT | linux.O_EXCL | linux.O_NOCTTY | linux.
 // Init must be called before first use of fd. If it succeeds, it takes
 // references on mnt and d. flags is the initial file description flags, which
 // is usually the full set of flags passed to open(2).
+//
+// Init returns ENFILE if the number of open file descriptions would exceed
+// the limit set by VirtualFilesystem.SetMaxOpenFiles.
 func (fd *FileDescription) Init(impl FileDescriptionImpl, flags uint32, mnt *Mount, d *Dentry, opts *FileDescriptionOptions) error {
+	if !mnt.vfs.incOpenFiles() {
+		return linuxerr.ENFILE
+	}
 	writable := MayWriteFileWithOpenFlags(flags)
 	if writable {
 		if err := mnt.CheckBeginWrite(); err != nil {
+			mnt.vfs.decOpenFiles()
 			return err
 		}
 	}
@@ -198,6 +206,7 @@ func (fd *FileDescription) DecRef(ctx context.Context) {
 		if fd.writable {
 			fd.vd.mount.EndWrite()
 		}
+		fd.vd.mount.vfs.decOpenFiles()
 		fd.vd.DecRef(ctx)
 		fd.flagsMu.Lock()
 		if fd.statusFlags.RacyLoad()&linux.O_ASYNC != 0 && fd.asyncHandler != nil {
@@ -657,6 +666,78 @@ func (fd *FileDescription) Read(ctx context.Context, dst usermem.IOSequence, opt
 	return n, err
 }
 
+// BufferReader may be implemented by FileDescriptionImpls that can provide
+// their contents as a buffer.Buffer without copying them, e.g. from a page
+// cache.
+type BufferReader interface {
+	// PReadBuffer appends up to count bytes, starting at offset, to dst. It
+	// returns the number of bytes appended, which is 0 with a nil error at
+	// end of file. Appended views may alias file data, so they must be
+	// treated as read-only.
+	//
+	// PReadBuffer returns EOPNOTSUPP if the file can't currently be read this
+	// way, in which case nothing is appended.
+	PReadBuffer(ctx context.Context, dst *buffer.Buffer, offset, count int64) (int64, error)
+}
+
+// PReadBuffer is similar to PRead, but appends the data read to dst. It
+// returns EOPNOTSUPP if fd's implementation doesn't support BufferReader.
+func (fd *FileDescription) PReadBuffer(ctx context.Context, dst *buffer.Buffer, offset, count int64) (int64, error) {
+	if fd.opts.DenyPRead {
+		return 0, linuxerr.ESPIPE
+	}
+	if !fd.readable {
+		return 0, linuxerr.EBADF
+	}
+	br, ok := fd.impl.(BufferReader)
+	if !ok {
+		return 0, linuxerr.EOPNOTSUPP
+	}
+	start := fsmetric.StartReadWait()
+	n, err := br.PReadBuffer(ctx, dst, offset, count)
+	if n > 0 {
+		fd.Dentry().InotifyWithParent(ctx, linux.IN_ACCESS, 0, PathEvent)
+	}
+	fsmetric.Reads.Increment()
+	fsmetric.FinishReadWait(fsmetric.ReadWait, start)
+	return n, err
+}
+
+// HostFDReader may be implemented by FileDescriptionImpls whose reads are
+// served directly from a host file descriptor.
+type HostFDReader interface {
+	// WithHostFDForRead calls fn with a host file descriptor from which the
+	// file's contents may be read, and returns fn's results. The file
+	// descriptor is only valid for the duration of the call, and must only
+	// be used with positional reads.
+	//
+	// WithHostFDForRead returns EOPNOTSUPP without calling fn if the file's
+	// reads aren't currently served from a host file descriptor, e.g.
+	// because they go through a sentry page cache.
+	WithHostFDForRead(fn func(hostFD int32) (int64, error)) (int64, error)
+}
+
+// WithHostFDForRead calls fn with a host file descriptor for reading fd's
+// contents; see HostFDReader. It returns EOPNOTSUPP if fd's implementation
+// doesn't support HostFDReader.
+func (fd *FileDescription) WithHostFDForRead(ctx context.Context, fn func(hostFD int32) (int64, error)) (int64, error) {
+	if fd.opts.DenyPRead {
+		return 0, linuxerr.ESPIPE
+	}
+	if !fd.readable {
+		return 0, linuxerr.EBADF
+	}
+	hr, ok := fd.impl.(HostFDReader)
+	if !ok {
+		return 0, linuxerr.EOPNOTSUPP
+	}
+	n, err := hr.WithHostFDForRead(fn)
+	if n > 0 {
+		fd.Dentry().InotifyWithParent(ctx, linux.IN_ACCESS, 0, PathEvent)
+	}
+	return n, err
+}
+
 // PWrite writes src to the file represented by fd, starting at the given
 // offset, and returns the number of bytes written. PWrite is permitted to
 // return partial writes with a nil error.
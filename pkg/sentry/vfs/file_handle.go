@@ -0,0 +1,93 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfs
+
+import (
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
+)
+
+// FilesystemImplFileHandleExtension is an optional extension to
+// FilesystemImpl, implemented by filesystems that support file handles as
+// used by name_to_handle_at(2) and open_by_handle_at(2). It is analogous to
+// Linux's struct export_operations.
+type FilesystemImplFileHandleExtension interface {
+	// EncodeFileHandle returns the type and contents of a handle that
+	// identifies the file represented by d for as long as the file exists.
+	// The handle must be at most linux.MAX_HANDLE_SZ bytes long.
+	EncodeFileHandle(ctx context.Context, d *Dentry) (int32, []byte, error)
+
+	// DecodeFileHandle returns the file identified by a handle previously
+	// returned by EncodeFileHandle, with a reference taken on the returned
+	// dentry.
+	//
+	// Handles are provided by applications and must not be trusted.
+	// DecodeFileHandle returns ESTALE if the handle does not identify an
+	// existing file, or if the file is not mntRoot or one of its descendants
+	// and mntRoot is not the root of the filesystem (as in Linux's
+	// fs/fhandle.c:vfs_dentry_acceptable()).
+	DecodeFileHandle(ctx context.Context, mntRoot *Dentry, handleType int32, handle []byte) (*Dentry, error)
+}
+
+// NameToHandleAt returns the type and contents of a handle for the file at
+// the given path, along with the ID of the mount containing it.
+func (vfs *VirtualFilesystem) NameToHandleAt(ctx context.Context, creds *auth.Credentials, pop *PathOperation) (int32, []byte, uint64, error) {
+	vd, err := vfs.GetDentryAt(ctx, creds, pop, &GetDentryOptions{})
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	defer vd.DecRef(ctx)
+	ext, ok := vd.mount.fs.impl.(FilesystemImplFileHandleExtension)
+	if !ok {
+		return 0, nil, 0, linuxerr.EOPNOTSUPP
+	}
+	handleType, handle, err := ext.EncodeFileHandle(ctx, vd.dentry)
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	if len(handle) > linux.MAX_HANDLE_SZ {
+		ctx.Warningf("VirtualFilesystem.NameToHandleAt: %T.EncodeFileHandle() returned a %d-byte handle", vd.mount.fs.impl, len(handle))
+		return 0, nil, 0, linuxerr.EOVERFLOW
+	}
+	return handleType, handle, vd.mount.ID, nil
+}
+
+// OpenByHandleAt opens the file identified by the given handle on the mount
+// mnt. Since the file is not reached by path resolution, no permission checks
+// are performed on its ancestors; callers are responsible for checking that
+// this is permitted.
+func (vfs *VirtualFilesystem) OpenByHandleAt(ctx context.Context, creds *auth.Credentials, mnt *Mount, handleType int32, handle []byte, opts *OpenOptions) (*FileDescription, error) {
+	ext, ok := mnt.fs.impl.(FilesystemImplFileHandleExtension)
+	if !ok {
+		return nil, linuxerr.ESTALE
+	}
+	d, err := ext.DecodeFileHandle(ctx, mnt.root, handleType, handle)
+	if err != nil {
+		return nil, err
+	}
+	mnt.IncRef()
+	vd := VirtualDentry{
+		mount:  mnt,
+		dentry: d,
+	}
+	defer vd.DecRef(ctx)
+	// Like Linux, open the file itself rather than any symlink target.
+	return vfs.OpenAt(ctx, creds, &PathOperation{
+		Root:  vd,
+		Start: vd,
+	}, opts)
+}
@@ -0,0 +1,64 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfs
+
+import (
+	"math"
+)
+
+// DefaultMaxOpenFiles is the default limit on the number of open file
+// descriptions. Like Linux systems running systemd, it is effectively
+// unlimited.
+const DefaultMaxOpenFiles = math.MaxInt64
+
+// SetMaxOpenFiles sets the maximum number of open file descriptions, as for
+// /proc/sys/fs/file-max. Open file descriptions in excess of the new limit
+// are not closed, but no more can be opened until enough are released.
+//
+// Unlike Linux, the limit also applies to tasks with CAP_SYS_ADMIN, since
+// FileDescription.Init doesn't know which task is opening the file.
+func (vfs *VirtualFilesystem) SetMaxOpenFiles(max uint64) {
+	vfs.maxOpenFiles.Store(max)
+}
+
+// MaxOpenFiles returns the maximum number of open file descriptions.
+func (vfs *VirtualFilesystem) MaxOpenFiles() uint64 {
+	return vfs.maxOpenFiles.Load()
+}
+
+// OpenFiles returns the number of open file descriptions.
+func (vfs *VirtualFilesystem) OpenFiles() uint64 {
+	return vfs.openFiles.Load()
+}
+
+// incOpenFiles records a new open file description. It returns false if this
+// would exceed the limit on open file descriptions, in which case the count is
+// unchanged.
+func (vfs *VirtualFilesystem) incOpenFiles() bool {
+	for {
+		n := vfs.openFiles.Load()
+		if n >= vfs.maxOpenFiles.Load() {
+			return false
+		}
+		if vfs.openFiles.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// decOpenFiles records the release of an open file description.
+func (vfs *VirtualFilesystem) decOpenFiles() {
+	vfs.openFiles.Add(^uint64(0))
+}
@@ -63,7 +63,20 @@ type FilesystemImplSaveRestoreExtension interface {
 	CompleteRestore(ctx context.Context, opts CompleteRestoreOptions) error
 }
 
-// PrepareSave prepares all filesystems for serialization.
+// DeviceSaveRestoreExtension is an optional extension to Device, for devices
+// with state outside of the sentry (e.g. in a host driver) that isn't
+// captured by serialization.
+type DeviceSaveRestoreExtension interface {
+	// PrepareSave checks that the device can be serialized. If PrepareSave
+	// returns an error, the save is aborted.
+	PrepareSave(ctx context.Context) error
+
+	// CompleteRestore completes restoration from checkpoint for this device
+	// after deserialization.
+	CompleteRestore(ctx context.Context) error
+}
+
+// PrepareSave prepares all filesystems and devices for serialization.
 func (vfs *VirtualFilesystem) PrepareSave(ctx context.Context) error {
 	for fs := range vfs.getFilesystems() {
 		if ext, ok := fs.impl.(FilesystemImplSaveRestoreExtension); ok {
@@ -74,9 +87,28 @@ func (vfs *VirtualFilesystem) PrepareSave(ctx context.Context) error {
 		}
 		fs.DecRef(ctx)
 	}
+	for _, ext := range vfs.deviceSaveRestoreExtensions() {
+		if err := ext.PrepareSave(ctx); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// deviceSaveRestoreExtensions returns all registered devices that implement
+// DeviceSaveRestoreExtension.
+func (vfs *VirtualFilesystem) deviceSaveRestoreExtensions() []DeviceSaveRestoreExtension {
+	vfs.devicesMu.RLock()
+	defer vfs.devicesMu.RUnlock()
+	var exts []DeviceSaveRestoreExtension
+	for _, rd := range vfs.devices {
+		if ext, ok := rd.dev.(DeviceSaveRestoreExtension); ok {
+			exts = append(exts, ext)
+		}
+	}
+	return exts
+}
+
 // BeforeResume is called before the kernel is resumed after save and allows
 // filesystems to clean up S/R state.
 func (vfs *VirtualFilesystem) BeforeResume(ctx context.Context) {
@@ -89,7 +121,7 @@ func (vfs *VirtualFilesystem) BeforeResume(ctx context.Context) {
 }
 
 // CompleteRestore completes restoration from checkpoint for all filesystems
-// after deserialization.
+// and devices after deserialization.
 func (vfs *VirtualFilesystem) CompleteRestore(ctx context.Context, opts *CompleteRestoreOptions) error {
 	for fs := range vfs.getFilesystems() {
 		if ext, ok := fs.impl.(FilesystemImplSaveRestoreExtension); ok {
@@ -100,6 +132,11 @@ func (vfs *VirtualFilesystem) CompleteRestore(ctx context.Context, opts *Complet
 		}
 		fs.DecRef(ctx)
 	}
+	for _, ext := range vfs.deviceSaveRestoreExtensions() {
+		if err := ext.CompleteRestore(ctx); err != nil {
+			return fmt.Errorf("failed to complete restore for device %T: %w", ext, err)
+		}
+	}
 	return nil
 }
 
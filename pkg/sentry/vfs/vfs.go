@@ -52,6 +52,7 @@ import (
 	"github.com/wilinz/gvisor/pkg/refs"
 	"github.com/wilinz/gvisor/pkg/sentry/fsmetric"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
+	"github.com/wilinz/gvisor/pkg/sentry/lsm"
 	"github.com/wilinz/gvisor/pkg/sentry/socket/unix/transport"
 	epb "github.com/wilinz/gvisor/pkg/sentry/vfs/events_go_proto"
 	"github.com/wilinz/gvisor/pkg/sync"
@@ -146,6 +147,26 @@ type VirtualFilesystem struct {
 	filesystemsMu sync.Mutex `state:"nosave"`
 	filesystems   map[*Filesystem]struct{}
 
+	// cachedDentries is the number of dentries cached by filesystems, as
+	// reported by DentryCached and DentryUncached.
+	cachedDentries atomicbitops.Uint64
+
+	// maxCachedDentries is the limit on cachedDentries, or zero if there is
+	// none.
+	maxCachedDentries atomicbitops.Uint64
+
+	// dentryCacheLimits is the sum of the limits of all dentry caches, as
+	// reported by AddDentryCache and RemoveDentryCache.
+	dentryCacheLimits atomicbitops.Uint64
+
+	// openFiles is the number of FileDescriptions that have been initialized
+	// and not yet released.
+	openFiles atomicbitops.Uint64
+
+	// maxOpenFiles is the limit on openFiles, as set by
+	// /proc/sys/fs/file-max.
+	maxOpenFiles atomicbitops.Uint64
+
 	// groupIDBitmap tracks which mount group IDs are available for allocation.
 	groupIDBitmap bitmap.Bitmap
 
@@ -174,6 +195,7 @@ func (vfs *VirtualFilesystem) Init(ctx context.Context) error {
 	vfs.filesystems = make(map[*Filesystem]struct{})
 	vfs.mounts.Init()
 	vfs.groupIDBitmap = bitmap.New(1024)
+	vfs.maxOpenFiles.Store(DefaultMaxOpenFiles)
 	vfs.mountMu.Lock()
 	vfs.toDecRef = make(map[refs.RefCounter]int)
 	vfs.mountMu.Unlock()
@@ -494,6 +516,13 @@ func (vfs *VirtualFilesystem) OpenAt(ctx context.Context, creds *auth.Credential
 				}
 			}
 
+			if lsm.Enabled() {
+				if err := vfs.checkOpenLSM(ctx, creds, fd, opts); err != nil {
+					fd.DecRef(ctx)
+					return nil, err
+				}
+			}
+
 			fd.Dentry().InotifyWithParent(ctx, linux.IN_OPEN, 0, PathEvent)
 			return fd, nil
 		}
@@ -504,6 +533,22 @@ func (vfs *VirtualFilesystem) OpenAt(ctx context.Context, creds *auth.Credential
 	}
 }
 
+// checkOpenLSM calls the LSM hook for opening or executing fd.
+func (vfs *VirtualFilesystem) checkOpenLSM(ctx context.Context, creds *auth.Credentials, fd *FileDescription, opts *OpenOptions) error {
+	root := RootFromContext(ctx)
+	if root.Ok() {
+		defer root.DecRef(ctx)
+	}
+	path, err := vfs.PathnameWithDeleted(ctx, root, fd.VirtualDentry())
+	if err != nil {
+		return err
+	}
+	if opts.FileExec {
+		return lsm.BprmCheck(ctx, creds, path)
+	}
+	return lsm.FileOpen(ctx, creds, path, opts.Flags)
+}
+
 // ReadlinkAt returns the target of the symbolic link at the given path.
 func (vfs *VirtualFilesystem) ReadlinkAt(ctx context.Context, creds *auth.Credentials, pop *PathOperation) (string, error) {
 	rp := vfs.getResolvingPath(creds, pop)
@@ -157,6 +157,63 @@ type Watchdog struct {
 	// startCalled is true if Start has ever been called. It remains true
 	// even if Stop is called.
 	startCalled bool
+
+	// statusMu protects status. It is separate from mu because Stop holds mu
+	// while waiting for the monitoring loop, which updates status.
+	statusMu sync.Mutex
+
+	// status is returned by Status.
+	status Status
+}
+
+// Status describes what the watchdog last observed.
+type Status struct {
+	// Enabled is false if the watchdog doesn't monitor tasks, i.e. if
+	// TaskTimeout is 0.
+	Enabled bool
+
+	// Running is true if the watchdog is monitoring tasks. It is false before
+	// Start is called and while the watchdog is stopped, e.g. during save.
+	Running bool
+
+	// LastActive is the time at which the watchdog last completed a pass over
+	// all tasks, or started if it hasn't completed one since.
+	LastActive time.Time
+
+	// StuckTasks is the number of tasks that were found stuck in the kernel
+	// during the last pass.
+	StuckTasks int
+
+	// Stalled is true if the watchdog itself took longer than TaskTimeout to
+	// list tasks during the last pass, which usually indicates a deadlock.
+	Stalled bool
+
+	// Period is the interval between passes, and TaskTimeout the time after
+	// which a task is considered stuck. A watchdog that hasn't been active
+	// for much longer than Period is likely stuck itself.
+	Period      time.Duration
+	TaskTimeout time.Duration
+}
+
+// Status returns what the watchdog last observed.
+func (w *Watchdog) Status() Status {
+	w.statusMu.Lock()
+	defer w.statusMu.Unlock()
+	s := w.status
+	s.Enabled = w.TaskTimeout != 0
+	s.Period = w.period
+	s.TaskTimeout = w.TaskTimeout
+	return s
+}
+
+// setRunning records whether the watchdog is running in its status.
+func (w *Watchdog) setRunning(running bool) {
+	w.statusMu.Lock()
+	defer w.statusMu.Unlock()
+	w.status = Status{Running: running}
+	if running {
+		w.status.LastActive = time.Now()
+	}
 }
 
 type offender struct {
@@ -204,6 +261,7 @@ func (w *Watchdog) Start() {
 	log.Infof("Starting watchdog, period: %v, timeout: %v, action: %v", w.period, w.TaskTimeout, w.TaskTimeoutAction)
 	go w.loop() // S/R-SAFE: watchdog is stopped during save and restarted after restore.
 	w.running = true
+	w.setRunning(true)
 }
 
 // Stop requests the watchdog to stop and wait for it.
@@ -221,6 +279,7 @@ func (w *Watchdog) Stop() {
 	w.stop <- struct{}{}
 	<-w.done
 	w.running = false
+	w.setRunning(false)
 	log.Infof("Watchdog stopped")
 }
 
@@ -268,11 +327,13 @@ func (w *Watchdog) runTurn() {
 		close(done)
 	}()
 
+	stalled := false
 	select {
 	case <-done:
 	case <-time.After(w.TaskTimeout):
 		// Report if the watchdog is not making progress.
 		// No one is watching the watchdog watcher though.
+		stalled = true
 		w.reportStuckWatchdog()
 		<-done
 	}
@@ -319,6 +380,12 @@ func (w *Watchdog) runTurn() {
 
 	// Remember which tasks have been reported.
 	w.offenders = newOffenders
+
+	w.statusMu.Lock()
+	w.status.LastActive = time.Now()
+	w.status.StuckTasks = len(newOffenders)
+	w.status.Stalled = stalled
+	w.statusMu.Unlock()
 }
 
 // report takes appropriate action when a stuck task is detected.
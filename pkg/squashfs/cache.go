@@ -0,0 +1,74 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package squashfs
+
+import (
+	"github.com/wilinz/gvisor/pkg/sync"
+)
+
+// blockCacheSize is the number of decompressed blocks cached by an Image.
+const blockCacheSize = 32
+
+// blockCache is a small cache of decompressed blocks, indexed by their
+// location in the image. Eviction is FIFO, which is sufficient for the
+// sequential access patterns that dominate squashfs reads.
+type blockCache struct {
+	mu sync.Mutex
+
+	// blocks maps block locations to decompressed data, which must not be
+	// mutated.
+	// +checklocks:mu
+	blocks map[uint64]cachedBlock
+
+	// order contains the locations of cached blocks, oldest first.
+	// +checklocks:mu
+	order []uint64
+}
+
+// cachedBlock is a decompressed block.
+type cachedBlock struct {
+	data []byte
+
+	// next is the location of the block following this one in the image.
+	next uint64
+}
+
+func (c *blockCache) init() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.blocks = make(map[uint64]cachedBlock)
+	c.order = nil
+}
+
+func (c *blockCache) get(off uint64) (cachedBlock, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.blocks[off]
+	return b, ok
+}
+
+func (c *blockCache) add(off uint64, b cachedBlock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.blocks[off]; ok {
+		return
+	}
+	if len(c.order) >= blockCacheSize {
+		delete(c.blocks, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.blocks[off] = b
+	c.order = append(c.order, off)
+}
@@ -0,0 +1,94 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package squashfs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+)
+
+// decompressor decompresses squashfs blocks.
+type decompressor interface {
+	// decompress decompresses src into dst, and returns the number of bytes
+	// written to dst. dst is at least as large as the maximum uncompressed
+	// size of the block; larger outputs are corrupt.
+	decompress(dst, src []byte) (int, error)
+}
+
+// newDecompressor returns a decompressor for the given compression algorithm.
+func newDecompressor(compressor uint16) (decompressor, error) {
+	switch compressor {
+	case CompressorGzip:
+		return zlibDecompressor{}, nil
+	case CompressorZstd:
+		d, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true))
+		if err != nil {
+			return nil, err
+		}
+		return &zstdDecompressor{d: d}, nil
+	default:
+		return nil, fmt.Errorf("unsupported compressor %d", compressor)
+	}
+}
+
+// zlibDecompressor implements decompressor for CompressorGzip, which
+// despite its name uses the zlib format.
+type zlibDecompressor struct{}
+
+// decompress implements decompressor.decompress.
+func (zlibDecompressor) decompress(dst, src []byte) (int, error) {
+	r, err := zlib.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return 0, linuxerr.EUCLEAN
+	}
+	defer r.Close()
+	n, err := io.ReadFull(r, dst)
+	switch err {
+	case nil:
+		// Make sure that there is no more data.
+		var b [1]byte
+		if m, _ := r.Read(b[:]); m != 0 {
+			return 0, linuxerr.EUCLEAN
+		}
+	case io.EOF, io.ErrUnexpectedEOF:
+	default:
+		return 0, linuxerr.EUCLEAN
+	}
+	return n, nil
+}
+
+// zstdDecompressor implements decompressor for CompressorZstd.
+type zstdDecompressor struct {
+	// d is safe for concurrent use by DecodeAll.
+	d *zstd.Decoder
+}
+
+// decompress implements decompressor.decompress.
+func (z *zstdDecompressor) decompress(dst, src []byte) (int, error) {
+	out, err := z.d.DecodeAll(src, dst[:0])
+	if err != nil || len(out) > len(dst) {
+		return 0, linuxerr.EUCLEAN
+	}
+	if len(out) != 0 && &out[0] != &dst[0] {
+		// DecodeAll reallocated the output buffer.
+		copy(dst, out)
+	}
+	return len(out), nil
+}
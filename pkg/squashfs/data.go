@@ -0,0 +1,112 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package squashfs
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+)
+
+// fragmentEntrySize is the size of a fragment table entry.
+const fragmentEntrySize = 16
+
+// fragmentBlock returns the decompressed fragment block with the given index.
+func (i *Image) fragmentBlock(idx uint32) ([]byte, error) {
+	var ent [fragmentEntrySize]byte
+	if err := i.readTableEntry(i.fragmentBlocks, uint64(idx), ent[:]); err != nil {
+		return nil, err
+	}
+	start := binary.LittleEndian.Uint64(ent[0:])
+	size := binary.LittleEndian.Uint32(ent[8:])
+	return i.readDataBlock(start, size)
+}
+
+// block returns the decompressed contents of the file's data block with the
+// given index, which contains the file's data at offset idx*BlockSize. The
+// returned slice must not be mutated. A nil slice with a nil error represents
+// a sparse block.
+func (in *Inode) block(idx uint64) ([]byte, error) {
+	bs := uint64(in.image.sb.BlockSize)
+	want := in.size - idx*bs
+	if want > bs {
+		want = bs
+	}
+	var data []byte
+	if idx < uint64(len(in.blockSizes)) {
+		size := in.blockSizes[idx]
+		if size&^dataUncompressed == 0 {
+			return nil, nil
+		}
+		var err error
+		if data, err = in.image.readDataBlock(in.blockOffsets[idx], size); err != nil {
+			return nil, err
+		}
+	} else {
+		if in.fragment == invalidFragment {
+			return nil, linuxerr.EUCLEAN
+		}
+		frag, err := in.image.fragmentBlock(in.fragment)
+		if err != nil {
+			return nil, err
+		}
+		if uint64(in.fragOffset) > uint64(len(frag)) {
+			return nil, linuxerr.EUCLEAN
+		}
+		data = frag[in.fragOffset:]
+	}
+	if uint64(len(data)) < want {
+		return nil, linuxerr.EUCLEAN
+	}
+	return data[:want], nil
+}
+
+// ReadAt reads the inode's data at offset off into dst, with the semantics of
+// io.ReaderAt.ReadAt.
+func (in *Inode) ReadAt(dst []byte, off uint64) (int, error) {
+	if !in.IsRegular() {
+		return 0, linuxerr.EINVAL
+	}
+	if off >= in.size {
+		return 0, io.EOF
+	}
+	var eof error
+	if rem := in.size - off; uint64(len(dst)) > rem {
+		dst = dst[:rem]
+		eof = io.EOF
+	}
+
+	bs := uint64(in.image.sb.BlockSize)
+	done := 0
+	for done < len(dst) {
+		pos := off + uint64(done)
+		data, err := in.block(pos / bs)
+		if err != nil {
+			return done, err
+		}
+		chunk := dst[done:]
+		if n := bs - pos%bs; uint64(len(chunk)) > n {
+			chunk = chunk[:n]
+		}
+		if data == nil {
+			clear(chunk)
+		} else {
+			copy(chunk, data[pos%bs:])
+		}
+		done += len(chunk)
+	}
+	return done, eof
+}
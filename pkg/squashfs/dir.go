@@ -0,0 +1,158 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package squashfs
+
+import (
+	"encoding/binary"
+
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+)
+
+// File types reported by IterDirents. These match Linux's FT_* values.
+const (
+	FileTypeUnknown = 0
+	FileTypeRegular = 1
+	FileTypeDir     = 2
+	FileTypeChar    = 3
+	FileTypeBlock   = 4
+	FileTypeFIFO    = 5
+	FileTypeSocket  = 6
+	FileTypeSymlink = 7
+)
+
+// fileTypes maps the basic inode types stored in directory entries to file
+// types.
+var fileTypes = [numBasicTypes + 1]uint8{
+	inodeBasicDir:     FileTypeDir,
+	inodeBasicFile:    FileTypeRegular,
+	inodeBasicSymlink: FileTypeSymlink,
+	inodeBasicBlock:   FileTypeBlock,
+	inodeBasicChar:    FileTypeChar,
+	inodeBasicFIFO:    FileTypeFIFO,
+	inodeBasicSocket:  FileTypeSocket,
+}
+
+const (
+	// dirHeaderSize is the size of a directory header, which precedes a run
+	// of entries whose inodes are in the same inode table metadata block.
+	dirHeaderSize = 12
+
+	// dirEntrySize is the size of a directory entry, excluding the name.
+	dirEntrySize = 8
+
+	// maxDirEntries is the maximum number of entries following a directory
+	// header.
+	maxDirEntries = 256
+)
+
+// forEachDirent invokes cb on each entry stored in the directory until cb
+// returns false. ref is the location of the entry's inode.
+func (in *Inode) forEachDirent(cb func(name []byte, typ uint8, ref uint64, ino uint32) bool) error {
+	if !in.IsDir() {
+		return linuxerr.ENOTDIR
+	}
+	if in.size <= dirSizeAdjustment {
+		return nil
+	}
+	rem := in.size - dirSizeAdjustment
+	r := in.image.newMetadataReader(in.image.sb.DirectoryTableStart+uint64(in.dirBlock), uint64(in.dirOffset))
+	le := binary.LittleEndian
+	var name [MaxNameLen]byte
+	for rem > 0 {
+		if rem < dirHeaderSize {
+			return linuxerr.EUCLEAN
+		}
+		var hdr [dirHeaderSize]byte
+		if err := r.read(hdr[:]); err != nil {
+			return err
+		}
+		rem -= dirHeaderSize
+		count := uint64(le.Uint32(hdr[0:])) + 1
+		start := uint64(le.Uint32(hdr[4:]))
+		base := le.Uint32(hdr[8:])
+		if count > maxDirEntries {
+			return linuxerr.EUCLEAN
+		}
+		for ; count > 0; count-- {
+			if rem < dirEntrySize {
+				return linuxerr.EUCLEAN
+			}
+			var ent [dirEntrySize]byte
+			if err := r.read(ent[:]); err != nil {
+				return err
+			}
+			offset := uint64(le.Uint16(ent[0:]))
+			ino := uint32(int64(base) + int64(int16(le.Uint16(ent[2:]))))
+			typ := le.Uint16(ent[4:])
+			nameLen := uint64(le.Uint16(ent[6:])) + 1
+			if typ < inodeBasicDir || typ > numBasicTypes || nameLen > MaxNameLen || rem < dirEntrySize+nameLen {
+				return linuxerr.EUCLEAN
+			}
+			if err := r.read(name[:nameLen]); err != nil {
+				return err
+			}
+			rem -= dirEntrySize + nameLen
+			if !cb(name[:nameLen], fileTypes[typ], start<<16|offset, ino) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// IterDirents invokes cb on each entry in the directory. Squashfs doesn't
+// store "." and ".." entries, so they are not included; callers can
+// synthesize them using Ino and ParentIno. ref is the location of the
+// entry's inode, to be passed to Image.Inode.
+func (in *Inode) IterDirents(cb func(name string, typ uint8, ref uint64, ino uint32) error) error {
+	var cbErr error
+	err := in.forEachDirent(func(name []byte, typ uint8, ref uint64, ino uint32) bool {
+		cbErr = cb(string(name), typ, ref, ino)
+		return cbErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return cbErr
+}
+
+// Lookup returns the location of the inode of the directory's child with the
+// given name.
+func (in *Inode) Lookup(name string) (uint64, error) {
+	if !in.IsDir() {
+		return 0, linuxerr.ENOTDIR
+	}
+	if len(name) == 0 || len(name) > MaxNameLen {
+		return 0, linuxerr.ENOENT
+	}
+	var (
+		found bool
+		ref   uint64
+	)
+	if err := in.forEachDirent(func(n []byte, _ uint8, r uint64, _ uint32) bool {
+		if string(n) == name {
+			found = true
+			ref = r
+			return false
+		}
+		return true
+	}); err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, linuxerr.ENOENT
+	}
+	return ref, nil
+}
@@ -0,0 +1,416 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package squashfs
+
+import (
+	"encoding/binary"
+
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+)
+
+// Inode types.
+const (
+	inodeBasicDir     = 1
+	inodeBasicFile    = 2
+	inodeBasicSymlink = 3
+	inodeBasicBlock   = 4
+	inodeBasicChar    = 5
+	inodeBasicFIFO    = 6
+	inodeBasicSocket  = 7
+	inodeExtDir       = 8
+	inodeExtFile      = 9
+	inodeExtSymlink   = 10
+	inodeExtBlock     = 11
+	inodeExtChar      = 12
+	inodeExtFIFO      = 13
+	inodeExtSocket    = 14
+
+	// numBasicTypes is the difference between extended and basic inode
+	// types.
+	numBasicTypes = 7
+)
+
+// File mode bits.
+const (
+	modeTypeMask = 0170000
+	modeSocket   = 0140000
+	modeSymlink  = 0120000
+	modeRegular  = 0100000
+	modeBlock    = 0060000
+	modeDir      = 0040000
+	modeChar     = 0020000
+	modeFIFO     = 0010000
+	modePermMask = 0007777
+)
+
+const (
+	// inodeHeaderSize is the size of the header common to all inodes.
+	inodeHeaderSize = 16
+
+	// noXattrs is the xattr index of inodes without extended attributes.
+	noXattrs = 0xffffffff
+
+	// dirSizeAdjustment is the difference between the size of a directory
+	// recorded in its inode and the size of its listing, which accounts for
+	// the "." and ".." entries that aren't stored.
+	dirSizeAdjustment = 3
+
+	// maxSymlinkLen is the maximum length of a symbolic link target.
+	maxSymlinkLen = 4096
+)
+
+// modeTypes maps basic inode types to file type mode bits.
+var modeTypes = [numBasicTypes + 1]uint16{
+	inodeBasicDir:     modeDir,
+	inodeBasicFile:    modeRegular,
+	inodeBasicSymlink: modeSymlink,
+	inodeBasicBlock:   modeBlock,
+	inodeBasicChar:    modeChar,
+	inodeBasicFIFO:    modeFIFO,
+	inodeBasicSocket:  modeSocket,
+}
+
+// Inode represents a squashfs inode.
+//
+// +stateify savable
+type Inode struct {
+	image *Image
+
+	// ref is the inode's location in the inode table.
+	ref uint64
+
+	ino      uint32
+	mode     uint16
+	uid      uint32
+	gid      uint32
+	mtime    uint32
+	nlink    uint32
+	size     uint64
+	rdev     uint32
+	xattrIdx uint32
+
+	// For directories, dirBlock and dirOffset locate the listing in the
+	// directory table, and parent is the parent's inode number.
+	dirBlock  uint32
+	dirOffset uint16
+	parent    uint32
+
+	// For regular files, blockOffsets contains the location of each data
+	// block, followed by the end of the last block; blockSizes contains the
+	// on-disk size field of each data block; and fragment and fragOffset
+	// locate the file's tail-end in the fragment table. sparse is the number
+	// of bytes in sparse blocks, if known.
+	blockOffsets []uint64
+	blockSizes   []uint32
+	fragment     uint32
+	fragOffset   uint32
+	sparse       uint64
+
+	// For symbolic links, target is the link target.
+	target string
+}
+
+// RootInode returns the image's root directory.
+func (i *Image) RootInode() (Inode, error) {
+	return i.Inode(i.sb.RootInode)
+}
+
+// Inode returns the inode at the given reference.
+func (i *Image) Inode(ref uint64) (Inode, error) {
+	block, offset := metadataRef(ref)
+	if offset >= metadataBlockSize {
+		return Inode{}, linuxerr.EUCLEAN
+	}
+	r := i.newMetadataReader(i.sb.InodeTableStart+block, offset)
+	var hdr [inodeHeaderSize]byte
+	if err := r.read(hdr[:]); err != nil {
+		return Inode{}, err
+	}
+	le := binary.LittleEndian
+	typ := le.Uint16(hdr[0:])
+	if typ < inodeBasicDir || typ > inodeExtSocket {
+		return Inode{}, linuxerr.EUCLEAN
+	}
+	uid, err := i.id(le.Uint16(hdr[4:]))
+	if err != nil {
+		return Inode{}, err
+	}
+	gid, err := i.id(le.Uint16(hdr[6:]))
+	if err != nil {
+		return Inode{}, err
+	}
+	basicType := typ
+	if typ > numBasicTypes {
+		basicType -= numBasicTypes
+	}
+	in := Inode{
+		image:    i,
+		ref:      ref,
+		mode:     modeTypes[basicType] | le.Uint16(hdr[2:])&modePermMask,
+		uid:      uid,
+		gid:      gid,
+		mtime:    le.Uint32(hdr[8:]),
+		ino:      le.Uint32(hdr[12:]),
+		xattrIdx: noXattrs,
+	}
+	if in.ino == 0 || in.ino > i.sb.InodeCount {
+		return Inode{}, linuxerr.EUCLEAN
+	}
+	if err := in.parse(typ, &r); err != nil {
+		return Inode{}, err
+	}
+	return in, nil
+}
+
+// parse decodes the type-specific part of the inode.
+func (in *Inode) parse(typ uint16, r *metadataReader) error {
+	var err error
+	// Each field is decoded in order; errors are sticky.
+	u16 := func() uint16 {
+		if err != nil {
+			return 0
+		}
+		var v uint16
+		v, err = r.u16()
+		return v
+	}
+	u32 := func() uint32 {
+		if err != nil {
+			return 0
+		}
+		var v uint32
+		v, err = r.u32()
+		return v
+	}
+	u64 := func() uint64 {
+		if err != nil {
+			return 0
+		}
+		var v uint64
+		v, err = r.u64()
+		return v
+	}
+
+	switch typ {
+	case inodeBasicDir:
+		in.dirBlock = u32()
+		in.nlink = u32()
+		in.size = uint64(u16())
+		in.dirOffset = u16()
+		in.parent = u32()
+	case inodeExtDir:
+		in.nlink = u32()
+		in.size = uint64(u32())
+		in.dirBlock = u32()
+		in.parent = u32()
+		u16() // Directory index count; the index is unused.
+		in.dirOffset = u16()
+		in.xattrIdx = u32()
+	case inodeBasicFile:
+		start := uint64(u32())
+		in.fragment = u32()
+		in.fragOffset = u32()
+		in.size = uint64(u32())
+		in.nlink = 1
+		if err == nil {
+			err = in.parseBlockList(start, r)
+		}
+	case inodeExtFile:
+		start := u64()
+		in.size = u64()
+		in.sparse = u64()
+		in.nlink = u32()
+		in.fragment = u32()
+		in.fragOffset = u32()
+		in.xattrIdx = u32()
+		if err == nil {
+			err = in.parseBlockList(start, r)
+		}
+	case inodeBasicSymlink, inodeExtSymlink:
+		in.nlink = u32()
+		size := u32()
+		if err == nil {
+			if size == 0 || size > maxSymlinkLen {
+				return linuxerr.EUCLEAN
+			}
+			buf := make([]byte, size)
+			err = r.read(buf)
+			in.target = string(buf)
+			in.size = uint64(size)
+		}
+		if typ == inodeExtSymlink {
+			in.xattrIdx = u32()
+		}
+	case inodeBasicBlock, inodeBasicChar:
+		in.nlink = u32()
+		in.rdev = u32()
+	case inodeExtBlock, inodeExtChar:
+		in.nlink = u32()
+		in.rdev = u32()
+		in.xattrIdx = u32()
+	case inodeBasicFIFO, inodeBasicSocket:
+		in.nlink = u32()
+	case inodeExtFIFO, inodeExtSocket:
+		in.nlink = u32()
+		in.xattrIdx = u32()
+	}
+	return err
+}
+
+// parseBlockList decodes the data block sizes of a regular file whose data
+// blocks start at start.
+func (in *Inode) parseBlockList(start uint64, r *metadataReader) error {
+	sb := &in.image.sb
+	nblocks := in.size >> sb.BlockLog
+	if in.fragment == invalidFragment {
+		if in.size&uint64(sb.BlockSize-1) != 0 {
+			nblocks++
+		}
+	} else if in.fragment >= sb.FragmentCount {
+		return linuxerr.EUCLEAN
+	}
+	// Each block's size occupies 4 bytes of metadata, which bounds the
+	// number of blocks that can be recorded in the image. Check this before
+	// allocating anything, since in.size is untrusted.
+	if nblocks > sb.BytesUsed/4 {
+		return linuxerr.EUCLEAN
+	}
+	buf := make([]byte, nblocks*4)
+	if err := r.read(buf); err != nil {
+		return err
+	}
+	in.blockSizes = make([]uint32, nblocks)
+	in.blockOffsets = make([]uint64, nblocks+1)
+	off := start
+	for j := range in.blockSizes {
+		size := binary.LittleEndian.Uint32(buf[j*4:])
+		in.blockSizes[j] = size
+		in.blockOffsets[j] = off
+		off += uint64(size &^ dataUncompressed)
+	}
+	in.blockOffsets[nblocks] = off
+	if off > sb.BytesUsed {
+		return linuxerr.EUCLEAN
+	}
+	return nil
+}
+
+// InodeByNumber returns the inode with the given inode number, using the
+// export table. It returns EOPNOTSUPP if the image is not exportable.
+func (i *Image) InodeByNumber(ino uint32) (Inode, error) {
+	if i.exportBlocks == nil {
+		return Inode{}, linuxerr.EOPNOTSUPP
+	}
+	if ino == 0 || ino > i.sb.InodeCount {
+		return Inode{}, linuxerr.ENOENT
+	}
+	var b [8]byte
+	if err := i.readTableEntry(i.exportBlocks, uint64(ino-1), b[:]); err != nil {
+		return Inode{}, err
+	}
+	in, err := i.Inode(binary.LittleEndian.Uint64(b[:]))
+	if err != nil {
+		return Inode{}, err
+	}
+	if in.ino != ino {
+		return Inode{}, linuxerr.EUCLEAN
+	}
+	return in, nil
+}
+
+// Ref returns the inode's location in the inode table, which uniquely
+// identifies it.
+func (in *Inode) Ref() uint64 {
+	return in.ref
+}
+
+// Ino returns the inode number.
+func (in *Inode) Ino() uint32 {
+	return in.ino
+}
+
+// Mode returns the file type and mode.
+func (in *Inode) Mode() uint16 {
+	return in.mode
+}
+
+// UID returns the owner's user ID.
+func (in *Inode) UID() uint32 {
+	return in.uid
+}
+
+// GID returns the owner's group ID.
+func (in *Inode) GID() uint32 {
+	return in.gid
+}
+
+// Mtime returns the last modification time, in seconds since the epoch.
+func (in *Inode) Mtime() uint32 {
+	return in.mtime
+}
+
+// Nlink returns the number of hard links.
+func (in *Inode) Nlink() uint32 {
+	return in.nlink
+}
+
+// Size returns the file size in bytes.
+func (in *Inode) Size() uint64 {
+	return in.size
+}
+
+// Blocks returns the number of 512-byte blocks used by the file's data.
+// Compare Linux's fs/squashfs/inode.c:squashfs_read_inode().
+func (in *Inode) Blocks() uint64 {
+	if !in.IsRegular() || in.sparse > in.size {
+		return 0
+	}
+	return (in.size - in.sparse + 511) >> 9
+}
+
+// DeviceNumber returns the device number of a character or block device,
+// encoded as by Linux's new_encode_dev().
+func (in *Inode) DeviceNumber() uint32 {
+	return in.rdev
+}
+
+// IsDir returns true if the inode is a directory.
+func (in *Inode) IsDir() bool {
+	return in.mode&modeTypeMask == modeDir
+}
+
+// IsRegular returns true if the inode is a regular file.
+func (in *Inode) IsRegular() bool {
+	return in.mode&modeTypeMask == modeRegular
+}
+
+// IsSymlink returns true if the inode is a symbolic link.
+func (in *Inode) IsSymlink() bool {
+	return in.mode&modeTypeMask == modeSymlink
+}
+
+// Readlink returns the target of a symbolic link.
+func (in *Inode) Readlink() (string, error) {
+	if !in.IsSymlink() {
+		return "", linuxerr.EINVAL
+	}
+	return in.target, nil
+}
+
+// ParentIno returns the inode number of a directory's parent. For the root
+// directory, this is an inode number that doesn't exist in the image.
+func (in *Inode) ParentIno() uint32 {
+	return in.parent
+}
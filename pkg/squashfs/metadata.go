@@ -0,0 +1,172 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package squashfs
+
+import (
+	"encoding/binary"
+
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+)
+
+// readMetadataBlock returns the decompressed metadata block at off.
+func (i *Image) readMetadataBlock(off uint64) (cachedBlock, error) {
+	if b, ok := i.cache.get(off); ok {
+		return b, nil
+	}
+	var hdr [2]byte
+	if err := i.readAt(hdr[:], off); err != nil {
+		return cachedBlock{}, err
+	}
+	h := binary.LittleEndian.Uint16(hdr[:])
+	size := uint64(h &^ metadataUncompressed)
+	if size == 0 || size > metadataBlockSize || off+2+size > i.sb.BytesUsed {
+		return cachedBlock{}, linuxerr.EUCLEAN
+	}
+	raw := make([]byte, size)
+	if err := i.readAt(raw, off+2); err != nil {
+		return cachedBlock{}, err
+	}
+	b := cachedBlock{
+		data: raw,
+		next: off + 2 + size,
+	}
+	if h&metadataUncompressed == 0 {
+		data := make([]byte, metadataBlockSize)
+		n, err := i.decomp.decompress(data, raw)
+		if err != nil {
+			return cachedBlock{}, err
+		}
+		b.data = data[:n]
+	}
+	i.cache.add(off, b)
+	return b, nil
+}
+
+// readDataBlock returns the decompressed data block or fragment block at off
+// with the given on-disk size field.
+func (i *Image) readDataBlock(off uint64, sizeField uint32) ([]byte, error) {
+	if b, ok := i.cache.get(off); ok {
+		return b.data, nil
+	}
+	size := uint64(sizeField &^ dataUncompressed)
+	if size == 0 || size > uint64(i.sb.BlockSize) || off+size > i.sb.BytesUsed {
+		return nil, linuxerr.EUCLEAN
+	}
+	raw := make([]byte, size)
+	if err := i.readAt(raw, off); err != nil {
+		return nil, err
+	}
+	data := raw
+	if sizeField&dataUncompressed == 0 {
+		data = make([]byte, i.sb.BlockSize)
+		n, err := i.decomp.decompress(data, raw)
+		if err != nil {
+			return nil, err
+		}
+		data = data[:n]
+	}
+	i.cache.add(off, cachedBlock{data: data, next: off + size})
+	return data, nil
+}
+
+// metadataReader reads consecutive bytes from a sequence of metadata blocks.
+type metadataReader struct {
+	image *Image
+
+	// block is the location of the current metadata block.
+	block uint64
+
+	// offset is the offset into the current (decompressed) metadata block.
+	offset uint64
+}
+
+// newMetadataReader returns a metadataReader that starts at the given offset
+// into the metadata block at the given location.
+func (i *Image) newMetadataReader(block, offset uint64) metadataReader {
+	return metadataReader{
+		image:  i,
+		block:  block,
+		offset: offset,
+	}
+}
+
+// metadataRef encodes the location of an object in a metadata table: the
+// high 48 bits are the location of a metadata block relative to the start of
+// the table, and the low 16 bits are an offset into the decompressed block.
+func metadataRef(ref uint64) (block, offset uint64) {
+	return ref >> 16, ref & 0xffff
+}
+
+// read fills dst.
+func (r *metadataReader) read(dst []byte) error {
+	for len(dst) > 0 {
+		b, err := r.image.readMetadataBlock(r.block)
+		if err != nil {
+			return err
+		}
+		if r.offset >= uint64(len(b.data)) {
+			if r.offset > uint64(len(b.data)) {
+				return linuxerr.EUCLEAN
+			}
+			r.block = b.next
+			r.offset = 0
+			continue
+		}
+		n := copy(dst, b.data[r.offset:])
+		r.offset += uint64(n)
+		dst = dst[n:]
+	}
+	return nil
+}
+
+// skip advances the reader by n bytes.
+func (r *metadataReader) skip(n uint64) error {
+	for n > 0 {
+		b, err := r.image.readMetadataBlock(r.block)
+		if err != nil {
+			return err
+		}
+		if r.offset > uint64(len(b.data)) {
+			return linuxerr.EUCLEAN
+		}
+		rem := uint64(len(b.data)) - r.offset
+		if n < rem {
+			r.offset += n
+			return nil
+		}
+		n -= rem
+		r.block = b.next
+		r.offset = 0
+	}
+	return nil
+}
+
+func (r *metadataReader) u16() (uint16, error) {
+	var b [2]byte
+	err := r.read(b[:])
+	return binary.LittleEndian.Uint16(b[:]), err
+}
+
+func (r *metadataReader) u32() (uint32, error) {
+	var b [4]byte
+	err := r.read(b[:])
+	return binary.LittleEndian.Uint32(b[:]), err
+}
+
+func (r *metadataReader) u64() (uint64, error) {
+	var b [8]byte
+	err := r.read(b[:])
+	return binary.LittleEndian.Uint64(b[:]), err
+}
@@ -0,0 +1,31 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package squashfs
+
+import (
+	"context"
+	"fmt"
+)
+
+// afterLoad is called by stateify.
+func (i *Image) afterLoad(context.Context) {
+	decomp, err := newDecompressor(i.sb.Compressor)
+	if err != nil {
+		// The compressor was validated by OpenImage.
+		panic(fmt.Sprintf("failed to restore squashfs decompressor: %v", err))
+	}
+	i.decomp = decomp
+	i.cache.init()
+}
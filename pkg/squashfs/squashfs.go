@@ -0,0 +1,323 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package squashfs provides read-only access to the contents of a squashfs
+// 4.0 [1] filesystem image.
+//
+// Unlike packages erofs and ext4, squashfs images store metadata and data in
+// compressed blocks, so Image keeps a small cache of recently decompressed
+// blocks. Callers are still expected to cache the objects that they need.
+//
+// [1] https://docs.kernel.org/filesystems/squashfs.html
+package squashfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+)
+
+const (
+	// SuperBlockMagic is the value of SuperBlock.Magic ("hsqs").
+	SuperBlockMagic = 0x73717368
+
+	// SuperBlockSize is the size of the on-disk superblock in bytes. The
+	// superblock is at the start of the image.
+	SuperBlockSize = 96
+
+	// MaxNameLen is the maximum length of a file name.
+	MaxNameLen = 256
+
+	// metadataBlockSize is the maximum uncompressed size of a metadata block.
+	metadataBlockSize = 8192
+
+	// metadataUncompressed is set in metadata block headers if the block is
+	// stored uncompressed.
+	metadataUncompressed = 1 << 15
+
+	// dataUncompressed is set in data block and fragment sizes if the block
+	// is stored uncompressed.
+	dataUncompressed = 1 << 24
+
+	// minBlockLog and maxBlockLog bound SuperBlock.BlockLog.
+	minBlockLog = 12
+	maxBlockLog = 20
+
+	// invalidFragment is the fragment index of files without a tail-end
+	// fragment.
+	invalidFragment = 0xffffffff
+
+	// invalidTable is the location of absent tables.
+	invalidTable = 0xffffffffffffffff
+)
+
+// Compression algorithms (SuperBlock.Compressor).
+const (
+	CompressorGzip = 1
+	CompressorLZMA = 2
+	CompressorLZO  = 3
+	CompressorXZ   = 4
+	CompressorLZ4  = 5
+	CompressorZstd = 6
+)
+
+// Superblock flags (SuperBlock.Flags).
+const (
+	FlagUncompressedInodes    = 0x0001
+	FlagUncompressedData      = 0x0002
+	FlagUncompressedFragments = 0x0008
+	FlagNoFragments           = 0x0010
+	FlagAlwaysFragments       = 0x0020
+	FlagDuplicates            = 0x0040
+	FlagExportable            = 0x0080
+	FlagUncompressedXattrs    = 0x0100
+	FlagNoXattrs              = 0x0200
+	FlagCompressorOptions     = 0x0400
+	FlagUncompressedIDs       = 0x0800
+)
+
+// SuperBlock is the on-disk superblock.
+//
+// +stateify savable
+type SuperBlock struct {
+	Magic               uint32
+	InodeCount          uint32
+	ModTime             uint32
+	BlockSize           uint32
+	FragmentCount       uint32
+	Compressor          uint16
+	BlockLog            uint16
+	Flags               uint16
+	IDCount             uint16
+	VersionMajor        uint16
+	VersionMinor        uint16
+	RootInode           uint64
+	BytesUsed           uint64
+	IDTableStart        uint64
+	XattrIDTableStart   uint64
+	InodeTableStart     uint64
+	DirectoryTableStart uint64
+	FragmentTableStart  uint64
+	ExportTableStart    uint64
+}
+
+// parseSuperBlock decodes the on-disk superblock in b.
+func parseSuperBlock(b []byte) SuperBlock {
+	le := binary.LittleEndian
+	return SuperBlock{
+		Magic:               le.Uint32(b[0:]),
+		InodeCount:          le.Uint32(b[4:]),
+		ModTime:             le.Uint32(b[8:]),
+		BlockSize:           le.Uint32(b[12:]),
+		FragmentCount:       le.Uint32(b[16:]),
+		Compressor:          le.Uint16(b[20:]),
+		BlockLog:            le.Uint16(b[22:]),
+		Flags:               le.Uint16(b[24:]),
+		IDCount:             le.Uint16(b[26:]),
+		VersionMajor:        le.Uint16(b[28:]),
+		VersionMinor:        le.Uint16(b[30:]),
+		RootInode:           le.Uint64(b[32:]),
+		BytesUsed:           le.Uint64(b[40:]),
+		IDTableStart:        le.Uint64(b[48:]),
+		XattrIDTableStart:   le.Uint64(b[56:]),
+		InodeTableStart:     le.Uint64(b[64:]),
+		DirectoryTableStart: le.Uint64(b[72:]),
+		FragmentTableStart:  le.Uint64(b[80:]),
+		ExportTableStart:    le.Uint64(b[88:]),
+	}
+}
+
+// Image represents an open squashfs image.
+//
+// +stateify savable
+type Image struct {
+	// dev is the device containing the image.
+	dev io.ReaderAt
+
+	// sb is the image's superblock.
+	sb SuperBlock
+
+	// decomp decompresses blocks. decomp is recreated on restore.
+	decomp decompressor `state:"nosave"`
+
+	// ids is the ID table, which maps the UID and GID indexes stored in
+	// inodes to IDs.
+	ids []uint32
+
+	// fragmentBlocks, exportBlocks and xattrIDBlocks contain the locations
+	// of the metadata blocks of the fragment, export and xattr ID tables
+	// respectively. Each is nil if the corresponding table is absent.
+	fragmentBlocks []uint64
+	exportBlocks   []uint64
+	xattrIDBlocks  []uint64
+
+	// xattrTableStart is the location of the xattr key/value table.
+	xattrTableStart uint64
+
+	// cache caches recently decompressed blocks.
+	cache blockCache `state:"nosave"`
+}
+
+// OpenImage returns an Image for the filesystem on dev, which is size bytes
+// long.
+func OpenImage(dev io.ReaderAt, size int64) (*Image, error) {
+	buf := make([]byte, SuperBlockSize)
+	if _, err := dev.ReadAt(buf, 0); err != nil {
+		return nil, fmt.Errorf("failed to read superblock: %w", err)
+	}
+	sb := parseSuperBlock(buf)
+	if sb.Magic != SuperBlockMagic {
+		return nil, fmt.Errorf("unknown magic: 0x%x", sb.Magic)
+	}
+	if sb.VersionMajor != 4 || sb.VersionMinor != 0 {
+		return nil, fmt.Errorf("unsupported version: %d.%d", sb.VersionMajor, sb.VersionMinor)
+	}
+	if sb.BlockLog < minBlockLog || sb.BlockLog > maxBlockLog || sb.BlockSize != 1<<sb.BlockLog {
+		return nil, fmt.Errorf("invalid block size: %d (log %d)", sb.BlockSize, sb.BlockLog)
+	}
+	// BytesUsed bounds every offset and size read from the image, including
+	// those used to size allocations, so it must not exceed the device.
+	if sb.BytesUsed < SuperBlockSize || size < 0 || sb.BytesUsed > uint64(size) {
+		return nil, fmt.Errorf("image claims to use %d bytes, but the device is %d bytes", sb.BytesUsed, size)
+	}
+	decomp, err := newDecompressor(sb.Compressor)
+	if err != nil {
+		return nil, err
+	}
+
+	i := &Image{
+		dev:    dev,
+		sb:     sb,
+		decomp: decomp,
+	}
+	i.cache.init()
+	if err := i.readTables(); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// readTables reads the locations of the image's lookup tables, and the ID
+// table itself.
+func (i *Image) readTables() error {
+	var err error
+	if i.sb.IDCount == 0 {
+		return fmt.Errorf("invalid superblock: no IDs")
+	}
+	idBlocks, err := i.readTableIndex(i.sb.IDTableStart, uint64(i.sb.IDCount), 4)
+	if err != nil {
+		return fmt.Errorf("failed to read ID table index: %w", err)
+	}
+	i.ids = make([]uint32, i.sb.IDCount)
+	for j := range i.ids {
+		var b [4]byte
+		if err := i.readTableEntry(idBlocks, uint64(j), b[:]); err != nil {
+			return fmt.Errorf("failed to read ID table: %w", err)
+		}
+		i.ids[j] = binary.LittleEndian.Uint32(b[:])
+	}
+
+	if i.sb.Flags&FlagNoFragments == 0 && i.sb.FragmentCount != 0 {
+		if i.fragmentBlocks, err = i.readTableIndex(i.sb.FragmentTableStart, uint64(i.sb.FragmentCount), fragmentEntrySize); err != nil {
+			return fmt.Errorf("failed to read fragment table index: %w", err)
+		}
+	}
+
+	if i.sb.Flags&FlagExportable != 0 && i.sb.ExportTableStart != invalidTable {
+		if i.exportBlocks, err = i.readTableIndex(i.sb.ExportTableStart, uint64(i.sb.InodeCount), 8); err != nil {
+			return fmt.Errorf("failed to read export table index: %w", err)
+		}
+	}
+
+	if i.sb.XattrIDTableStart != invalidTable {
+		var hdr [xattrIDTableHeaderSize]byte
+		if err := i.readAt(hdr[:], i.sb.XattrIDTableStart); err != nil {
+			return fmt.Errorf("failed to read xattr ID table header: %w", err)
+		}
+		i.xattrTableStart = binary.LittleEndian.Uint64(hdr[0:])
+		count := uint64(binary.LittleEndian.Uint32(hdr[8:]))
+		if i.xattrIDBlocks, err = i.readTableIndex(i.sb.XattrIDTableStart+xattrIDTableHeaderSize, count, xattrIDEntrySize); err != nil {
+			return fmt.Errorf("failed to read xattr ID table index: %w", err)
+		}
+	}
+	return nil
+}
+
+// readTableIndex reads the array of metadata block locations at off for a
+// lookup table with the given number of entries of the given size.
+func (i *Image) readTableIndex(off, entries, entrySize uint64) ([]uint64, error) {
+	nblocks := (entries*entrySize + metadataBlockSize - 1) / metadataBlockSize
+	if off == invalidTable || off+nblocks*8 > i.sb.BytesUsed {
+		return nil, linuxerr.EUCLEAN
+	}
+	buf := make([]byte, nblocks*8)
+	if err := i.readAt(buf, off); err != nil {
+		return nil, err
+	}
+	blocks := make([]uint64, nblocks)
+	for j := range blocks {
+		blocks[j] = binary.LittleEndian.Uint64(buf[j*8:])
+	}
+	return blocks, nil
+}
+
+// readTableEntry reads entry idx of a lookup table with metadata blocks at
+// the given locations into dst, whose length is the table's entry size.
+func (i *Image) readTableEntry(blocks []uint64, idx uint64, dst []byte) error {
+	off := idx * uint64(len(dst))
+	blk := off / metadataBlockSize
+	if blk >= uint64(len(blocks)) {
+		return linuxerr.EUCLEAN
+	}
+	r := i.newMetadataReader(blocks[blk], off%metadataBlockSize)
+	return r.read(dst)
+}
+
+// SuperBlock returns a copy of the image's superblock.
+func (i *Image) SuperBlock() SuperBlock {
+	return i.sb
+}
+
+// BlockSize returns the data block size of the image.
+func (i *Image) BlockSize() uint32 {
+	return i.sb.BlockSize
+}
+
+// Blocks returns the size of the image in units of BlockSize, rounded up.
+func (i *Image) Blocks() uint64 {
+	return (i.sb.BytesUsed + uint64(i.sb.BlockSize) - 1) >> i.sb.BlockLog
+}
+
+// id returns the ID with the given index in the ID table.
+func (i *Image) id(idx uint16) (uint32, error) {
+	if int(idx) >= len(i.ids) {
+		return 0, linuxerr.EUCLEAN
+	}
+	return i.ids[idx], nil
+}
+
+// readAt fills buf from the device at offset off.
+func (i *Image) readAt(buf []byte, off uint64) error {
+	n, err := i.dev.ReadAt(buf, int64(off))
+	if n == len(buf) {
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		// The image is truncated.
+		return linuxerr.EUCLEAN
+	}
+	return err
+}
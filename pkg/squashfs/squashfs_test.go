@@ -0,0 +1,155 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package squashfs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+)
+
+// metadataBlock returns an on-disk metadata block containing data, compressed
+// with zlib if compress is true.
+func metadataBlock(t *testing.T, data []byte, compress bool) []byte {
+	t.Helper()
+	hdr := uint16(len(data)) | metadataUncompressed
+	if compress {
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			t.Fatalf("zlib write failed: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("zlib close failed: %v", err)
+		}
+		data = buf.Bytes()
+		hdr = uint16(len(data))
+	}
+	return append(binary.LittleEndian.AppendUint16(nil, hdr), data...)
+}
+
+func TestMetadataReader(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		// Two metadata blocks containing consecutive bytes, so that reads at
+		// the end of the first block continue into the second.
+		first := make([]byte, metadataBlockSize)
+		for j := range first {
+			first[j] = byte(j)
+		}
+		second := []byte{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff, 0x11, 0x22}
+		img := append(metadataBlock(t, first, compress), metadataBlock(t, second, compress)...)
+
+		i := &Image{
+			dev:    bytes.NewReader(img),
+			sb:     SuperBlock{BytesUsed: uint64(len(img))},
+			decomp: zlibDecompressor{},
+		}
+		i.cache.init()
+
+		r := i.newMetadataReader(0, metadataBlockSize-2)
+		got, err := r.u32()
+		if err != nil {
+			t.Fatalf("compress=%t: u32 failed: %v", compress, err)
+		}
+		if want := uint32(0xbbaafffe); got != want {
+			t.Errorf("compress=%t: u32 got %#x, want %#x", compress, got, want)
+		}
+		if err := r.skip(2); err != nil {
+			t.Fatalf("compress=%t: skip failed: %v", compress, err)
+		}
+		if got, err := r.u16(); err != nil || got != 0xffee {
+			t.Errorf("compress=%t: u16 got (%#x, %v), want (0xffee, nil)", compress, got, err)
+		}
+
+		// Reading past the end of the last block fails.
+		r = i.newMetadataReader(0, metadataBlockSize-2)
+		if err := r.skip(4); err != nil {
+			t.Fatalf("compress=%t: skip failed: %v", compress, err)
+		}
+		if _, err := r.u64(); err == nil {
+			t.Errorf("compress=%t: u64 past end of image succeeded", compress)
+		}
+	}
+}
+
+func TestMetadataRef(t *testing.T) {
+	block, offset := metadataRef(0x1234_5678_9abc)
+	if block != 0x1234_5678 || offset != 0x9abc {
+		t.Errorf("metadataRef got (%#x, %#x), want (0x12345678, 0x9abc)", block, offset)
+	}
+}
+
+func TestZlibDecompressTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(make([]byte, 100))
+	w.Close()
+
+	dst := make([]byte, 100)
+	if n, err := (zlibDecompressor{}).decompress(dst, buf.Bytes()); err != nil || n != 100 {
+		t.Errorf("decompress into exact buffer got (%d, %v), want (100, nil)", n, err)
+	}
+	if _, err := (zlibDecompressor{}).decompress(dst[:99], buf.Bytes()); err == nil {
+		t.Errorf("decompress into short buffer succeeded")
+	}
+}
+
+func TestOpenImageCraftedBytesUsed(t *testing.T) {
+	le := binary.LittleEndian
+	img := make([]byte, 4096)
+	le.PutUint32(img[0:], SuperBlockMagic)
+	le.PutUint32(img[12:], 4096) // BlockSize
+	le.PutUint16(img[20:], 1)    // Compressor: zlib
+	le.PutUint16(img[22:], 12)   // BlockLog
+	le.PutUint16(img[28:], 4)    // VersionMajor
+	for _, bytesUsed := range []uint64{0, SuperBlockSize - 1, uint64(len(img)) + 1, 1 << 62, ^uint64(0)} {
+		le.PutUint64(img[40:], bytesUsed)
+		_, err := OpenImage(bytes.NewReader(img), int64(len(img)))
+		if err == nil || !strings.Contains(err.Error(), "device") {
+			t.Errorf("OpenImage with BytesUsed %d: got error %v, want device size error", bytesUsed, err)
+		}
+	}
+}
+
+func TestParseBlockListCraftedSize(t *testing.T) {
+	// A metadata block holding the sizes of two blocks.
+	img := metadataBlock(t, make([]byte, 8), false)
+	i := &Image{
+		dev:    bytes.NewReader(img),
+		sb:     SuperBlock{BlockSize: 4096, BlockLog: 12, BytesUsed: uint64(len(img))},
+		decomp: zlibDecompressor{},
+	}
+	i.cache.init()
+
+	for _, test := range []struct {
+		size    uint64
+		wantErr error
+	}{
+		{size: 8192},
+		{size: 1 << 40, wantErr: linuxerr.EUCLEAN},
+		{size: ^uint64(0), wantErr: linuxerr.EUCLEAN},
+	} {
+		in := &Inode{image: i, size: test.size, fragment: invalidFragment}
+		r := i.newMetadataReader(0, 0)
+		err := in.parseBlockList(0, &r)
+		if err != test.wantErr {
+			t.Errorf("parseBlockList for size %d: got error %v, want %v", test.size, err, test.wantErr)
+		}
+	}
+}
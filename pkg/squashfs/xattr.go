@@ -0,0 +1,169 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package squashfs
+
+import (
+	"encoding/binary"
+
+	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+)
+
+const (
+	// xattrIDTableHeaderSize is the size of the header of the xattr ID
+	// table, which precedes the locations of its metadata blocks.
+	xattrIDTableHeaderSize = 16
+
+	// xattrIDEntrySize is the size of an xattr ID table entry.
+	xattrIDEntrySize = 16
+
+	// xattrKeySize is the size of an xattr key, excluding its name.
+	xattrKeySize = 4
+
+	// xattrTypeMask masks the name prefix index in an xattr key's type.
+	xattrTypeMask = 0xff
+
+	// xattrValueOutOfLine is set in an xattr key's type if the value is
+	// stored elsewhere in the xattr table, and the inline value is a
+	// reference to it.
+	xattrValueOutOfLine = 0x100
+
+	// xattrMaxValueSize is the maximum size of an xattr value. Compare
+	// Linux's XATTR_SIZE_MAX.
+	xattrMaxValueSize = 65536
+)
+
+// xattrPrefixes maps xattr key types to name prefixes.
+var xattrPrefixes = []string{
+	0: "user.",
+	1: "trusted.",
+	2: "security.",
+}
+
+// forEachXattr invokes cb on each of the inode's extended attributes until cb
+// returns false. The value function reads the attribute's value; it may only
+// be called during cb.
+func (in *Inode) forEachXattr(cb func(name string, value func() ([]byte, error)) bool) error {
+	i := in.image
+	if in.xattrIdx == noXattrs || i.xattrIDBlocks == nil {
+		return nil
+	}
+	var ent [xattrIDEntrySize]byte
+	if err := i.readTableEntry(i.xattrIDBlocks, uint64(in.xattrIdx), ent[:]); err != nil {
+		return err
+	}
+	le := binary.LittleEndian
+	block, offset := metadataRef(le.Uint64(ent[0:]))
+	count := le.Uint32(ent[8:])
+	r := i.newMetadataReader(i.xattrTableStart+block, offset)
+	for ; count > 0; count-- {
+		var key [xattrKeySize]byte
+		if err := r.read(key[:]); err != nil {
+			return err
+		}
+		typ := le.Uint16(key[0:])
+		nameLen := le.Uint16(key[2:])
+		if nameLen == 0 || nameLen > MaxNameLen {
+			return linuxerr.EUCLEAN
+		}
+		name := make([]byte, nameLen)
+		if err := r.read(name); err != nil {
+			return err
+		}
+		valueLen, err := r.u32()
+		if err != nil {
+			return err
+		}
+		if valueLen > xattrMaxValueSize {
+			return linuxerr.EUCLEAN
+		}
+		consumed := false
+		value := func() ([]byte, error) {
+			consumed = true
+			if typ&xattrValueOutOfLine == 0 {
+				val := make([]byte, valueLen)
+				return val, r.read(val)
+			}
+			if valueLen != 8 {
+				return nil, linuxerr.EUCLEAN
+			}
+			ref, err := r.u64()
+			if err != nil {
+				return nil, err
+			}
+			block, offset := metadataRef(ref)
+			vr := i.newMetadataReader(i.xattrTableStart+block, offset)
+			size, err := vr.u32()
+			if err != nil {
+				return nil, err
+			}
+			if size > xattrMaxValueSize {
+				return nil, linuxerr.EUCLEAN
+			}
+			val := make([]byte, size)
+			return val, vr.read(val)
+		}
+		// Attributes with unknown prefixes are skipped, as in Linux.
+		if idx := int(typ & xattrTypeMask); idx < len(xattrPrefixes) {
+			if !cb(xattrPrefixes[idx]+string(name), value) {
+				return nil
+			}
+		}
+		if !consumed {
+			if err := r.skip(uint64(valueLen)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ListXattrs returns the names of the inode's extended attributes.
+func (in *Inode) ListXattrs() ([]string, error) {
+	var names []string
+	if err := in.forEachXattr(func(name string, _ func() ([]byte, error)) bool {
+		names = append(names, name)
+		return true
+	}); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// Xattr returns the value of the inode's extended attribute with the given
+// name, or ENODATA if no such attribute exists.
+func (in *Inode) Xattr(name string) ([]byte, error) {
+	var (
+		found bool
+		val   []byte
+		err   error
+	)
+	if ferr := in.forEachXattr(func(n string, value func() ([]byte, error)) bool {
+		if n != name {
+			return true
+		}
+		found = true
+		val, err = value()
+		return false
+	}); ferr != nil {
+		return nil, ferr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, linuxerr.ENODATA
+	}
+	return val, nil
+}
@@ -26,6 +26,14 @@ const (
 	ethType = 12
 )
 
+const (
+	vlanTCI  = 0
+	vlanType = 2
+
+	vlanIDMask        = 0x0fff
+	vlanPriorityShift = 13
+)
+
 // EthernetFields contains the fields of an ethernet frame header. It is used to
 // describe the fields of a frame that needs to be encoded.
 type EthernetFields struct {
@@ -87,8 +95,40 @@ const (
 
 	// EthernetProtocolPUP is the PARC Universal Packet protocol ethertype.
 	EthernetProtocolPUP tcpip.NetworkProtocolNumber = 0x0200
+
+	// VLANProtocolNumber is the ethertype of IEEE 802.1Q VLAN tagged frames.
+	VLANProtocolNumber tcpip.NetworkProtocolNumber = 0x8100
 )
 
+const (
+	// VLANTagSize is the size of the IEEE 802.1Q tag that follows the
+	// ethertype of a VLAN tagged frame, holding the tag control information
+	// and the ethertype of the encapsulated payload.
+	VLANTagSize = 4
+
+	// VLANIDMax is the largest VLAN ID that can be assigned to a VLAN. IDs 0
+	// and 4095 are reserved.
+	VLANIDMax = 4094
+)
+
+// VLANFields contains the fields of an IEEE 802.1Q tag. It is used to describe
+// the fields of a tag that needs to be encoded.
+type VLANFields struct {
+	// Priority is the "priority code point" field of the tag.
+	Priority uint8
+
+	// ID is the "VLAN identifier" field of the tag.
+	ID uint16
+
+	// Type is the ethertype of the encapsulated payload.
+	Type tcpip.NetworkProtocolNumber
+}
+
+// VLAN represents an IEEE 802.1Q tag stored in a byte array. In a tagged
+// ethernet frame, it immediately follows the ethernet header, whose ethertype
+// is VLANProtocolNumber.
+type VLAN []byte
+
 // Ethertypes holds the protocol numbers describing the payload of an ethernet
 // frame. These types aren't necessarily supported by netstack, but can be used
 // to catch all traffic of a type via packet endpoints.
@@ -120,6 +160,28 @@ func (b Ethernet) Encode(e *EthernetFields) {
 	copy(b[dstMAC:][:EthernetAddressSize], e.DstAddr)
 }
 
+// ID returns the "VLAN identifier" field of the tag.
+func (b VLAN) ID() uint16 {
+	return binary.BigEndian.Uint16(b[vlanTCI:]) & vlanIDMask
+}
+
+// Priority returns the "priority code point" field of the tag.
+func (b VLAN) Priority() uint8 {
+	return uint8(binary.BigEndian.Uint16(b[vlanTCI:]) >> vlanPriorityShift)
+}
+
+// Type returns the ethertype of the payload encapsulated by the tag.
+func (b VLAN) Type() tcpip.NetworkProtocolNumber {
+	return tcpip.NetworkProtocolNumber(binary.BigEndian.Uint16(b[vlanType:]))
+}
+
+// Encode encodes all the fields of the tag. The drop eligible indicator is
+// always cleared.
+func (b VLAN) Encode(v *VLANFields) {
+	binary.BigEndian.PutUint16(b[vlanTCI:], uint16(v.Priority)<<vlanPriorityShift|v.ID&vlanIDMask)
+	binary.BigEndian.PutUint16(b[vlanType:], uint16(v.Type))
+}
+
 // IsMulticastEthernetAddress returns true if the address is a multicast
 // ethernet address.
 func IsMulticastEthernetAddress(addr tcpip.LinkAddress) bool {
@@ -148,3 +148,24 @@ func TestEthernetAddressFromMulticastIPv6Address(t *testing.T) {
 		t.Fatalf("got EthernetAddressFromMulticastIPv6Address(%s) = %s, want = %s", addr, got, want)
 	}
 }
+
+func TestVLANEncode(t *testing.T) {
+	b := VLAN(make([]byte, VLANTagSize))
+	b.Encode(&VLANFields{
+		Priority: 5,
+		ID:       100,
+		Type:     IPv4ProtocolNumber,
+	})
+	if got, want := []byte(b), []byte("\xa0\x64\x08\x00"); string(got) != string(want) {
+		t.Fatalf("got encoded tag = %x, want = %x", got, want)
+	}
+	if got, want := b.Priority(), uint8(5); got != want {
+		t.Errorf("got b.Priority() = %d, want = %d", got, want)
+	}
+	if got, want := b.ID(), uint16(100); got != want {
+		t.Errorf("got b.ID() = %d, want = %d", got, want)
+	}
+	if got, want := b.Type(), IPv4ProtocolNumber; got != want {
+		t.Errorf("got b.Type() = %d, want = %d", got, want)
+	}
+}
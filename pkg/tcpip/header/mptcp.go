@@ -0,0 +1,552 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// TCPOptionMPTCP is the TCP option kind used by all Multipath TCP options, as
+// defined in RFC 8684 section 3.
+const TCPOptionMPTCP = 30
+
+// MPTCPSubtype is the subtype of a Multipath TCP option.
+type MPTCPSubtype uint8
+
+// Multipath TCP option subtypes, see RFC 8684 section 7.4.
+const (
+	MPTCPSubtypeCapable    MPTCPSubtype = 0
+	MPTCPSubtypeJoin       MPTCPSubtype = 1
+	MPTCPSubtypeDSS        MPTCPSubtype = 2
+	MPTCPSubtypeAddAddr    MPTCPSubtype = 3
+	MPTCPSubtypeRemoveAddr MPTCPSubtype = 4
+	MPTCPSubtypePrio       MPTCPSubtype = 5
+	MPTCPSubtypeFail       MPTCPSubtype = 6
+	MPTCPSubtypeFastClose  MPTCPSubtype = 7
+	MPTCPSubtypeTCPRST     MPTCPSubtype = 8
+)
+
+// MPTCPVersion is the version of Multipath TCP implemented, as carried in the
+// MP_CAPABLE option.
+const MPTCPVersion = 1
+
+// MP_CAPABLE option flags, see RFC 8684 section 3.1.
+const (
+	// MPTCPCapableFlagChecksum (A) indicates that the sender requires DSS
+	// checksums.
+	MPTCPCapableFlagChecksum = 0x80
+
+	// MPTCPCapableFlagExtensibility (B) is reserved for extensibility.
+	MPTCPCapableFlagExtensibility = 0x40
+
+	// MPTCPCapableFlagNoSrcAddr (C) indicates that the sender will not
+	// accept additional subflows to its source address.
+	MPTCPCapableFlagNoSrcAddr = 0x20
+
+	// MPTCPCapableFlagHMACSHA256 (H) indicates the use of HMAC-SHA256.
+	MPTCPCapableFlagHMACSHA256 = 0x01
+)
+
+// DSS option flags, see RFC 8684 section 3.3.
+const (
+	MPTCPDSSFlagDataFin = 0x10
+	MPTCPDSSFlagDSN8    = 0x08
+	MPTCPDSSFlagMapping = 0x04
+	MPTCPDSSFlagAck8    = 0x02
+	MPTCPDSSFlagAck     = 0x01
+)
+
+// Multipath TCP option lengths.
+const (
+	// MPTCPCapableSynLength is the length of the MP_CAPABLE option in a
+	// SYN.
+	MPTCPCapableSynLength = 4
+
+	// MPTCPCapableSynAckLength is the length of the MP_CAPABLE option in a
+	// SYN-ACK, which carries the sender's key.
+	MPTCPCapableSynAckLength = 12
+
+	// MPTCPCapableAckLength is the length of the MP_CAPABLE option in the
+	// third ACK, which carries both keys.
+	MPTCPCapableAckLength = 20
+
+	// MPTCPCapableDataLength is the length of the MP_CAPABLE option in the
+	// first data segment, which also carries the data-level length.
+	MPTCPCapableDataLength = 22
+
+	// MPTCPCapableDataChecksumLength is MPTCPCapableDataLength with a DSS
+	// checksum.
+	MPTCPCapableDataChecksumLength = 24
+
+	// MPTCPJoinSynLength is the length of the MP_JOIN option in a SYN.
+	MPTCPJoinSynLength = 12
+
+	// MPTCPJoinSynAckLength is the length of the MP_JOIN option in a
+	// SYN-ACK.
+	MPTCPJoinSynAckLength = 16
+
+	// MPTCPJoinAckLength is the length of the MP_JOIN option in the third
+	// ACK.
+	MPTCPJoinAckLength = 24
+
+	// MPTCPJoinTruncatedHMACSize is the size of the truncated HMAC carried
+	// in the MP_JOIN SYN-ACK.
+	MPTCPJoinTruncatedHMACSize = 8
+
+	// MPTCPJoinHMACSize is the size of the HMAC carried in the MP_JOIN
+	// third ACK.
+	MPTCPJoinHMACSize = 20
+
+	// MPTCPDSSMaximumLength is the maximum length of a DSS option.
+	MPTCPDSSMaximumLength = 28
+)
+
+// MPCapableOption is a parsed MP_CAPABLE option. Which fields are valid
+// depends on Length.
+type MPCapableOption struct {
+	// Length is the length of the option, which determines its variant.
+	Length uint8
+
+	// Version is the Multipath TCP version.
+	Version uint8
+
+	// Flags are the MPTCPCapableFlag* flags.
+	Flags uint8
+
+	// SenderKey is the key of the sender of the segment. It is present in
+	// all variants but the SYN.
+	SenderKey uint64
+
+	// ReceiverKey is the key of the receiver of the segment. It is present
+	// in the third ACK and data variants.
+	ReceiverKey uint64
+
+	// DataLen is the data-level length of the mapping carried by the data
+	// variant.
+	DataLen uint16
+
+	// Checksum is the DSS checksum carried by the data variant when
+	// checksums are in use.
+	Checksum uint16
+}
+
+// MPJoinOption is a parsed MP_JOIN option. Which fields are valid depends on
+// Length.
+type MPJoinOption struct {
+	// Length is the length of the option, which determines its variant.
+	Length uint8
+
+	// Backup is true if the subflow should be used only as a backup. It is
+	// valid in the SYN and SYN-ACK variants.
+	Backup bool
+
+	// AddrID is the address ID of the sender's address. It is valid in
+	// the SYN and SYN-ACK variants.
+	AddrID uint8
+
+	// Token is the receiver's token, identifying the connection to join.
+	// It is valid in the SYN variant.
+	Token uint32
+
+	// Nonce is the sender's random number. It is valid in the SYN and
+	// SYN-ACK variants.
+	Nonce uint32
+
+	// TruncatedHMAC is the leftmost 64 bits of the sender's HMAC. It is
+	// valid in the SYN-ACK variant.
+	TruncatedHMAC uint64
+
+	// HMAC is the leftmost 160 bits of the sender's HMAC. It is valid in
+	// the ACK variant.
+	HMAC [MPTCPJoinHMACSize]byte
+}
+
+// DSSOption is a parsed Data Sequence Signal option.
+type DSSOption struct {
+	// DataFin is true if the DATA_FIN flag is set. The DATA_FIN
+	// occupies the last data sequence number of the mapping.
+	DataFin bool
+
+	// HasAck is true if the option carries a Data ACK.
+	HasAck bool
+
+	// Ack64 is true if Ack was carried as 8 octets.
+	Ack64 bool
+
+	// Ack is the Data ACK. If Ack64 is false only the low 32 bits are
+	// valid.
+	Ack uint64
+
+	// HasMapping is true if the option carries a data sequence mapping.
+	HasMapping bool
+
+	// DSN64 is true if DSN was carried as 8 octets.
+	DSN64 bool
+
+	// DSN is the data sequence number of the first byte of the mapping.
+	// If DSN64 is false only the low 32 bits are valid.
+	DSN uint64
+
+	// SSN is the subflow sequence number of the first byte of the
+	// mapping, relative to the subflow's initial sequence number.
+	SSN uint32
+
+	// DataLen is the data-level length of the mapping.
+	DataLen uint16
+
+	// HasChecksum is true if the mapping carries a checksum.
+	HasChecksum bool
+
+	// Checksum is the DSS checksum.
+	Checksum uint16
+}
+
+// MPTCPOptions holds the Multipath TCP options found in a segment.
+type MPTCPOptions struct {
+	// HasCapable is true if Capable is present.
+	HasCapable bool
+	Capable    MPCapableOption
+
+	// HasJoin is true if Join is present.
+	HasJoin bool
+	Join    MPJoinOption
+
+	// HasDSS is true if DSS is present.
+	HasDSS bool
+	DSS    DSSOption
+}
+
+// ParseMPTCPOptions extracts the Multipath TCP options from the options part
+// of a TCP header. Malformed options are ignored.
+func ParseMPTCPOptions(b []byte) MPTCPOptions {
+	var opts MPTCPOptions
+	limit := len(b)
+	for i := 0; i < limit; {
+		switch b[i] {
+		case TCPOptionEOL:
+			i = limit
+		case TCPOptionNOP:
+			i++
+		default:
+			if i+2 > limit {
+				return opts
+			}
+			l := int(b[i+1])
+			if l < 2 || i+l > limit {
+				return opts
+			}
+			if b[i] == TCPOptionMPTCP && l >= 3 {
+				opts.parse(b[i : i+l])
+			}
+			i += l
+		}
+	}
+	return opts
+}
+
+// parse parses a single Multipath TCP option.
+func (opts *MPTCPOptions) parse(o []byte) {
+	l := len(o)
+	switch MPTCPSubtype(o[2] >> 4) {
+	case MPTCPSubtypeCapable:
+		if l < MPTCPCapableSynLength {
+			return
+		}
+		c := MPCapableOption{
+			Length:  uint8(l),
+			Version: o[2] & 0xf,
+			Flags:   o[3],
+		}
+		switch l {
+		case MPTCPCapableSynLength:
+		case MPTCPCapableSynAckLength:
+			c.SenderKey = binary.BigEndian.Uint64(o[4:])
+		case MPTCPCapableAckLength, MPTCPCapableDataLength, MPTCPCapableDataChecksumLength:
+			c.SenderKey = binary.BigEndian.Uint64(o[4:])
+			c.ReceiverKey = binary.BigEndian.Uint64(o[12:])
+			if l >= MPTCPCapableDataLength {
+				c.DataLen = binary.BigEndian.Uint16(o[20:])
+			}
+			if l == MPTCPCapableDataChecksumLength {
+				c.Checksum = binary.BigEndian.Uint16(o[22:])
+			}
+		default:
+			return
+		}
+		opts.HasCapable = true
+		opts.Capable = c
+
+	case MPTCPSubtypeJoin:
+		j := MPJoinOption{Length: uint8(l)}
+		switch l {
+		case MPTCPJoinSynLength:
+			j.Backup = o[2]&1 != 0
+			j.AddrID = o[3]
+			j.Token = binary.BigEndian.Uint32(o[4:])
+			j.Nonce = binary.BigEndian.Uint32(o[8:])
+		case MPTCPJoinSynAckLength:
+			j.Backup = o[2]&1 != 0
+			j.AddrID = o[3]
+			j.TruncatedHMAC = binary.BigEndian.Uint64(o[4:])
+			j.Nonce = binary.BigEndian.Uint32(o[12:])
+		case MPTCPJoinAckLength:
+			copy(j.HMAC[:], o[4:])
+		default:
+			return
+		}
+		opts.HasJoin = true
+		opts.Join = j
+
+	case MPTCPSubtypeDSS:
+		if l < 4 {
+			return
+		}
+		flags := o[3]
+		d := DSSOption{
+			DataFin:    flags&MPTCPDSSFlagDataFin != 0,
+			HasAck:     flags&MPTCPDSSFlagAck != 0,
+			Ack64:      flags&MPTCPDSSFlagAck8 != 0,
+			HasMapping: flags&MPTCPDSSFlagMapping != 0,
+			DSN64:      flags&MPTCPDSSFlagDSN8 != 0,
+		}
+		want := 4
+		if d.HasAck {
+			want += 4
+			if d.Ack64 {
+				want += 4
+			}
+		}
+		if d.HasMapping {
+			want += 4 + 4 + 2
+			if d.DSN64 {
+				want += 4
+			}
+		}
+		switch l {
+		case want:
+		case want + 2:
+			if !d.HasMapping {
+				return
+			}
+			d.HasChecksum = true
+		default:
+			return
+		}
+		off := 4
+		if d.HasAck {
+			if d.Ack64 {
+				d.Ack = binary.BigEndian.Uint64(o[off:])
+				off += 8
+			} else {
+				d.Ack = uint64(binary.BigEndian.Uint32(o[off:]))
+				off += 4
+			}
+		}
+		if d.HasMapping {
+			if d.DSN64 {
+				d.DSN = binary.BigEndian.Uint64(o[off:])
+				off += 8
+			} else {
+				d.DSN = uint64(binary.BigEndian.Uint32(o[off:]))
+				off += 4
+			}
+			d.SSN = binary.BigEndian.Uint32(o[off:])
+			d.DataLen = binary.BigEndian.Uint16(o[off+4:])
+			off += 6
+			if d.HasChecksum {
+				d.Checksum = binary.BigEndian.Uint16(o[off:])
+			}
+		}
+		opts.HasDSS = true
+		opts.DSS = d
+	}
+}
+
+// EncodeMPCapableOption encodes an MP_CAPABLE option of length c.Length into
+// b. It returns the number of bytes written, which is zero if b is too small
+// or c.Length is not a valid length.
+func EncodeMPCapableOption(c MPCapableOption, b []byte) int {
+	l := int(c.Length)
+	switch l {
+	case MPTCPCapableSynLength, MPTCPCapableSynAckLength, MPTCPCapableAckLength, MPTCPCapableDataLength, MPTCPCapableDataChecksumLength:
+	default:
+		return 0
+	}
+	if len(b) < l {
+		return 0
+	}
+	b[0], b[1] = TCPOptionMPTCP, byte(l)
+	b[2] = byte(MPTCPSubtypeCapable)<<4 | c.Version&0xf
+	b[3] = c.Flags
+	if l >= MPTCPCapableSynAckLength {
+		binary.BigEndian.PutUint64(b[4:], c.SenderKey)
+	}
+	if l >= MPTCPCapableAckLength {
+		binary.BigEndian.PutUint64(b[12:], c.ReceiverKey)
+	}
+	if l >= MPTCPCapableDataLength {
+		binary.BigEndian.PutUint16(b[20:], c.DataLen)
+	}
+	if l == MPTCPCapableDataChecksumLength {
+		binary.BigEndian.PutUint16(b[22:], c.Checksum)
+	}
+	return l
+}
+
+// EncodeMPJoinOption encodes an MP_JOIN option of length j.Length into b. It
+// returns the number of bytes written, which is zero if b is too small or
+// j.Length is not a valid length.
+func EncodeMPJoinOption(j MPJoinOption, b []byte) int {
+	l := int(j.Length)
+	switch l {
+	case MPTCPJoinSynLength, MPTCPJoinSynAckLength, MPTCPJoinAckLength:
+	default:
+		return 0
+	}
+	if len(b) < l {
+		return 0
+	}
+	b[0], b[1] = TCPOptionMPTCP, byte(l)
+	b[2] = byte(MPTCPSubtypeJoin) << 4
+	switch l {
+	case MPTCPJoinSynLength:
+		if j.Backup {
+			b[2] |= 1
+		}
+		b[3] = j.AddrID
+		binary.BigEndian.PutUint32(b[4:], j.Token)
+		binary.BigEndian.PutUint32(b[8:], j.Nonce)
+	case MPTCPJoinSynAckLength:
+		if j.Backup {
+			b[2] |= 1
+		}
+		b[3] = j.AddrID
+		binary.BigEndian.PutUint64(b[4:], j.TruncatedHMAC)
+		binary.BigEndian.PutUint32(b[12:], j.Nonce)
+	case MPTCPJoinAckLength:
+		b[3] = 0
+		copy(b[4:], j.HMAC[:])
+	}
+	return l
+}
+
+// DSSOptionLength returns the encoded length of d.
+func DSSOptionLength(d DSSOption) int {
+	l := 4
+	if d.HasAck {
+		l += 4
+		if d.Ack64 {
+			l += 4
+		}
+	}
+	if d.HasMapping {
+		l += 4 + 4 + 2
+		if d.DSN64 {
+			l += 4
+		}
+		if d.HasChecksum {
+			l += 2
+		}
+	}
+	return l
+}
+
+// EncodeDSSOption encodes d as a DSS option into b. It returns the number of
+// bytes written, which is zero if b is too small.
+func EncodeDSSOption(d DSSOption, b []byte) int {
+	l := DSSOptionLength(d)
+	if len(b) < l {
+		return 0
+	}
+	var flags byte
+	if d.DataFin {
+		flags |= MPTCPDSSFlagDataFin
+	}
+	b[0], b[1] = TCPOptionMPTCP, byte(l)
+	b[2] = byte(MPTCPSubtypeDSS) << 4
+	off := 4
+	if d.HasAck {
+		flags |= MPTCPDSSFlagAck
+		if d.Ack64 {
+			flags |= MPTCPDSSFlagAck8
+			binary.BigEndian.PutUint64(b[off:], d.Ack)
+			off += 8
+		} else {
+			binary.BigEndian.PutUint32(b[off:], uint32(d.Ack))
+			off += 4
+		}
+	}
+	if d.HasMapping {
+		flags |= MPTCPDSSFlagMapping
+		if d.DSN64 {
+			flags |= MPTCPDSSFlagDSN8
+			binary.BigEndian.PutUint64(b[off:], d.DSN)
+			off += 8
+		} else {
+			binary.BigEndian.PutUint32(b[off:], uint32(d.DSN))
+			off += 4
+		}
+		binary.BigEndian.PutUint32(b[off:], d.SSN)
+		binary.BigEndian.PutUint16(b[off+4:], d.DataLen)
+		off += 6
+		if d.HasChecksum {
+			binary.BigEndian.PutUint16(b[off:], d.Checksum)
+		}
+	}
+	b[3] = flags
+	return l
+}
+
+// MPTCPKeyHash returns the token and initial data sequence number derived
+// from an MPTCP key, as described in RFC 8684 section 3.1: the token is the
+// most significant 32 bits and the IDSN the least significant 64 bits of the
+// SHA-256 hash of the key.
+func MPTCPKeyHash(key uint64) (token uint32, idsn uint64) {
+	var k [8]byte
+	binary.BigEndian.PutUint64(k[:], key)
+	sum := sha256.Sum256(k[:])
+	return binary.BigEndian.Uint32(sum[:]), binary.BigEndian.Uint64(sum[sha256.Size-8:])
+}
+
+// MPTCPJoinHMAC returns the HMAC-SHA256 computed by a host with key localKey
+// and nonce localNonce to authenticate an MP_JOIN handshake with a peer using
+// remoteKey and remoteNonce, as described in RFC 8684 section 3.2.
+func MPTCPJoinHMAC(localKey, remoteKey uint64, localNonce, remoteNonce uint32) [sha256.Size]byte {
+	var key [16]byte
+	binary.BigEndian.PutUint64(key[:], localKey)
+	binary.BigEndian.PutUint64(key[8:], remoteKey)
+	var msg [8]byte
+	binary.BigEndian.PutUint32(msg[:], localNonce)
+	binary.BigEndian.PutUint32(msg[4:], remoteNonce)
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write(msg[:])
+	var sum [sha256.Size]byte
+	mac.Sum(sum[:0])
+	return sum
+}
+
+// ExpandMPTCPSeq expands the 32-bit data sequence number seq32 carried in a
+// DSS option to 64 bits, picking the value closest to ref.
+func ExpandMPTCPSeq(ref uint64, seq32 uint32) uint64 {
+	seq := ref&^0xffffffff | uint64(seq32)
+	if d := int32(seq32 - uint32(ref)); d < 0 && seq > ref && seq >= 1<<32 {
+		seq -= 1 << 32
+	} else if d >= 0 && seq < ref {
+		seq += 1 << 32
+	}
+	return seq
+}
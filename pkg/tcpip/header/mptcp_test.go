@@ -0,0 +1,146 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wilinz/gvisor/pkg/tcpip/header"
+)
+
+func TestMPCapableOptionRoundTrip(t *testing.T) {
+	for _, c := range []header.MPCapableOption{
+		{Length: header.MPTCPCapableSynLength, Version: header.MPTCPVersion, Flags: header.MPTCPCapableFlagHMACSHA256},
+		{Length: header.MPTCPCapableSynAckLength, Version: header.MPTCPVersion, SenderKey: 0x0102030405060708},
+		{Length: header.MPTCPCapableAckLength, Version: header.MPTCPVersion, SenderKey: 1, ReceiverKey: 2},
+		{Length: header.MPTCPCapableDataLength, Version: header.MPTCPVersion, SenderKey: 1, ReceiverKey: 2, DataLen: 1000},
+		{Length: header.MPTCPCapableDataChecksumLength, Version: header.MPTCPVersion, Flags: header.MPTCPCapableFlagChecksum, SenderKey: 1, ReceiverKey: 2, DataLen: 1000, Checksum: 0xabcd},
+	} {
+		// Prefix a NOP to check that other options are skipped.
+		b := make([]byte, 1+c.Length)
+		b[0] = header.TCPOptionNOP
+		if n := header.EncodeMPCapableOption(c, b[1:]); n != int(c.Length) {
+			t.Fatalf("header.EncodeMPCapableOption(%+v, _) = %d, want %d", c, n, c.Length)
+		}
+		got := header.ParseMPTCPOptions(b)
+		want := header.MPTCPOptions{HasCapable: true, Capable: c}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("header.ParseMPTCPOptions mismatch (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestMPJoinOptionRoundTrip(t *testing.T) {
+	hmac := header.MPTCPJoinHMAC(1, 2, 3, 4)
+	var ackHMAC [header.MPTCPJoinHMACSize]byte
+	copy(ackHMAC[:], hmac[:])
+	for _, j := range []header.MPJoinOption{
+		{Length: header.MPTCPJoinSynLength, Backup: true, AddrID: 3, Token: 0xdeadbeef, Nonce: 42},
+		{Length: header.MPTCPJoinSynAckLength, AddrID: 1, TruncatedHMAC: 0x0102030405060708, Nonce: 43},
+		{Length: header.MPTCPJoinAckLength, HMAC: ackHMAC},
+	} {
+		b := make([]byte, j.Length)
+		if n := header.EncodeMPJoinOption(j, b); n != int(j.Length) {
+			t.Fatalf("header.EncodeMPJoinOption(%+v, _) = %d, want %d", j, n, j.Length)
+		}
+		got := header.ParseMPTCPOptions(b)
+		want := header.MPTCPOptions{HasJoin: true, Join: j}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("header.ParseMPTCPOptions mismatch (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestDSSOptionRoundTrip(t *testing.T) {
+	for _, d := range []header.DSSOption{
+		{HasAck: true, Ack: 0x12345678},
+		{HasAck: true, Ack64: true, Ack: 0x123456789abcdef0},
+		{HasMapping: true, DSN: 100, SSN: 1, DataLen: 1460},
+		{HasAck: true, Ack: 7, HasMapping: true, DSN64: true, DSN: 1 << 40, SSN: 2, DataLen: 10, HasChecksum: true, Checksum: 0xffff},
+		{DataFin: true, HasAck: true, Ack: 8, HasMapping: true, DSN: 200, DataLen: 1},
+	} {
+		l := header.DSSOptionLength(d)
+		if l > header.MPTCPDSSMaximumLength {
+			t.Fatalf("header.DSSOptionLength(%+v) = %d, want <= %d", d, l, header.MPTCPDSSMaximumLength)
+		}
+		b := make([]byte, l)
+		if n := header.EncodeDSSOption(d, b); n != l {
+			t.Fatalf("header.EncodeDSSOption(%+v, _) = %d, want %d", d, n, l)
+		}
+		got := header.ParseMPTCPOptions(b)
+		want := header.MPTCPOptions{HasDSS: true, DSS: d}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("header.ParseMPTCPOptions mismatch (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestParseMPTCPOptionsMalformed(t *testing.T) {
+	for _, b := range [][]byte{
+		// Truncated option.
+		{header.TCPOptionMPTCP, 12, byte(header.MPTCPSubtypeCapable) << 4, 0},
+		// Invalid MP_CAPABLE length.
+		{header.TCPOptionMPTCP, 5, byte(header.MPTCPSubtypeCapable) << 4, 0, 0},
+		// Invalid MP_JOIN length.
+		{header.TCPOptionMPTCP, 4, byte(header.MPTCPSubtypeJoin) << 4, 0},
+	} {
+		if got := header.ParseMPTCPOptions(b); got != (header.MPTCPOptions{}) {
+			t.Errorf("header.ParseMPTCPOptions(%v) = %+v, want no options", b, got)
+		}
+	}
+}
+
+func TestMPTCPKeyHash(t *testing.T) {
+	token1, idsn1 := header.MPTCPKeyHash(0x0102030405060708)
+	token2, idsn2 := header.MPTCPKeyHash(0x0102030405060709)
+	if token1 == token2 || idsn1 == idsn2 {
+		t.Errorf("different keys hash to the same token or IDSN: (%#x, %#x), (%#x, %#x)", token1, idsn1, token2, idsn2)
+	}
+	if t2, i2 := header.MPTCPKeyHash(0x0102030405060708); t2 != token1 || i2 != idsn1 {
+		t.Errorf("header.MPTCPKeyHash is not deterministic")
+	}
+}
+
+func TestMPTCPJoinHMAC(t *testing.T) {
+	// Each side computes its HMAC with its own key and nonce first, so the
+	// two HMACs of a handshake differ.
+	a := header.MPTCPJoinHMAC(1, 2, 3, 4)
+	b := header.MPTCPJoinHMAC(2, 1, 4, 3)
+	if a == b {
+		t.Errorf("header.MPTCPJoinHMAC returned the same HMAC for both sides")
+	}
+	if a != header.MPTCPJoinHMAC(1, 2, 3, 4) {
+		t.Errorf("header.MPTCPJoinHMAC is not deterministic")
+	}
+}
+
+func TestExpandMPTCPSeq(t *testing.T) {
+	for _, tc := range []struct {
+		ref   uint64
+		seq32 uint32
+		want  uint64
+	}{
+		{ref: 100, seq32: 200, want: 200},
+		{ref: 200, seq32: 100, want: 100},
+		{ref: 0x1_fffffff0, seq32: 0x10, want: 0x2_00000010},
+		{ref: 0x2_00000010, seq32: 0xfffffff0, want: 0x1_fffffff0},
+		{ref: 0x10, seq32: 0xfffffff0, want: 0xfffffff0},
+	} {
+		if got := header.ExpandMPTCPSeq(tc.ref, tc.seq32); got != tc.want {
+			t.Errorf("header.ExpandMPTCPSeq(%#x, %#x) = %#x, want %#x", tc.ref, tc.seq32, got, tc.want)
+		}
+	}
+}
@@ -91,6 +91,7 @@ const (
 	TCPOptionTS            = 8
 	TCPOptionSACKPermitted = 4
 	TCPOptionSACK          = 5
+	TCPOptionFastOpen      = 34
 )
 
 // Option Lengths.
@@ -99,6 +100,16 @@ const (
 	TCPOptionTSLength            = 10
 	TCPOptionWSLength            = 3
 	TCPOptionSackPermittedLength = 2
+
+	// TCPOptionFastOpenMinLength is the length of a TCP Fast Open option
+	// without a cookie, i.e. a cookie request.
+	TCPOptionFastOpenMinLength = 2
+)
+
+// TCP Fast Open cookie lengths, as per RFC 7413 section 4.1.1.
+const (
+	TCPFastOpenMinCookieLength = 4
+	TCPFastOpenMaxCookieLength = 16
 )
 
 // TCPFields contains the fields of a TCP packet. It is used to describe the
@@ -158,6 +169,14 @@ type TCPSynOptions struct {
 	// SACKPermitted is true if the SACK option was provided in the SYN/SYN-ACK.
 	SACKPermitted bool
 
+	// FastOpen is true if the TCP Fast Open option was provided in the
+	// SYN/SYN-ACK.
+	FastOpen bool
+
+	// FastOpenCookie is the cookie carried by the TCP Fast Open option. It
+	// is empty if the option is a cookie request.
+	FastOpenCookie []byte
+
 	// Flags if specified are set on the outgoing SYN. The SYN flag is
 	// always set.
 	Flags TCPFlags
@@ -507,6 +526,22 @@ func ParseSynOptions(opts []byte, isAck bool) TCPSynOptions {
 			synOpts.SACKPermitted = true
 			i += 2
 
+		case TCPOptionFastOpen:
+			if i+2 > limit {
+				return synOpts
+			}
+			l := int(opts[i+1])
+			if l < TCPOptionFastOpenMinLength || i+l > limit {
+				return synOpts
+			}
+			synOpts.FastOpen = true
+			// Cookies of invalid length are ignored, which turns the
+			// option into a cookie request.
+			if cookieLen := l - TCPOptionFastOpenMinLength; cookieLen >= TCPFastOpenMinCookieLength && cookieLen <= TCPFastOpenMaxCookieLength && cookieLen%2 == 0 {
+				synOpts.FastOpenCookie = append([]byte(nil), opts[i+2:i+l]...)
+			}
+			i += l
+
 		default:
 			// We don't recognize this option, just skip over it.
 			if i+2 > limit {
@@ -633,6 +668,20 @@ func EncodeSACKPermittedOption(b []byte) int {
 	return int(b[1])
 }
 
+// EncodeFastOpenOption encodes a TCP Fast Open option with the provided
+// cookie into the provided buffer. An empty cookie encodes a cookie request.
+// If the buffer is smaller than required it just returns without encoding
+// anything. It returns the number of bytes written to the provided buffer.
+func EncodeFastOpenOption(cookie []byte, b []byte) int {
+	l := TCPOptionFastOpenMinLength + len(cookie)
+	if len(b) < l {
+		return 0
+	}
+	b[0], b[1] = TCPOptionFastOpen, byte(l)
+	copy(b[2:], cookie)
+	return l
+}
+
 // EncodeSACKBlocks encodes the provided SACK blocks as a TCP SACK option block
 // in the provided slice. It tries to fit in as many blocks as possible based on
 // number of bytes available in the provided buffer. It returns the number of
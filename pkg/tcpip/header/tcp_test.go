@@ -148,6 +148,40 @@ func TestTCPParseOptions(t *testing.T) {
 	}
 }
 
+func TestParseSynOptionsFastOpen(t *testing.T) {
+	encode := func(cookie []byte) []byte {
+		b := make([]byte, header.TCPOptionFastOpenMinLength+len(cookie))
+		if n := header.EncodeFastOpenOption(cookie, b); n != len(b) {
+			t.Fatalf("header.EncodeFastOpenOption(%v, _) = %d, want = %d", cookie, n, len(b))
+		}
+		return b
+	}
+	for _, tc := range []struct {
+		name       string
+		b          []byte
+		wantOpt    bool
+		wantCookie []byte
+	}{
+		{"no option", nil, false, nil},
+		{"cookie request", encode(nil), true, nil},
+		{"cookie", encode([]byte{1, 2, 3, 4, 5, 6, 7, 8}), true, []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+		{"maximum cookie", encode(make([]byte, header.TCPFastOpenMaxCookieLength)), true, make([]byte, header.TCPFastOpenMaxCookieLength)},
+		{"short cookie", encode([]byte{1, 2}), true, nil},
+		{"odd cookie", encode([]byte{1, 2, 3, 4, 5}), true, nil},
+		{"truncated", []byte{header.TCPOptionFastOpen, 10, 1, 2, 3, 4}, false, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := header.ParseSynOptions(tc.b, false /* isAck */)
+			if opts.FastOpen != tc.wantOpt {
+				t.Errorf("got FastOpen = %t, want = %t", opts.FastOpen, tc.wantOpt)
+			}
+			if !slices.Equal(opts.FastOpenCookie, tc.wantCookie) {
+				t.Errorf("got FastOpenCookie = %v, want = %v", opts.FastOpenCookie, tc.wantCookie)
+			}
+		})
+	}
+}
+
 func TestTCPFlags(t *testing.T) {
 	for _, tt := range []struct {
 		flags header.TCPFlags
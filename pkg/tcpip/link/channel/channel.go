@@ -290,6 +290,11 @@ func (e *Endpoint) WritePackets(pkts stack.PacketBufferList) (int, tcpip.Error)
 	return n, nil
 }
 
+// WritePacket stores an outbound packet into the channel.
+func (e *Endpoint) WritePacket(pkt *stack.PacketBuffer) tcpip.Error {
+	return e.q.Write(pkt)
+}
+
 // Wait implements stack.LinkEndpoint.Wait.
 func (*Endpoint) Wait() {}
 
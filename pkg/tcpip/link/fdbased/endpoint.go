@@ -60,6 +60,7 @@ type linkDispatcher interface {
 	Stop()
 	dispatch() (bool, tcpip.Error)
 	release()
+	enableGRO()
 }
 
 // PacketDispatchMode are the various supported methods of receiving and
@@ -106,6 +107,7 @@ func (p PacketDispatchMode) String() string {
 
 var _ stack.LinkEndpoint = (*endpoint)(nil)
 var _ stack.GSOEndpoint = (*endpoint)(nil)
+var _ stack.OffloadEndpoint = (*endpoint)(nil)
 
 // +stateify savable
 type fdInfo struct {
@@ -544,8 +546,9 @@ func (h *virtioNetHdr) marshal() []byte {
 const (
 	_VIRTIO_NET_HDR_F_NEEDS_CSUM = 1
 
-	_VIRTIO_NET_HDR_GSO_TCPV4 = 1
-	_VIRTIO_NET_HDR_GSO_TCPV6 = 4
+	_VIRTIO_NET_HDR_GSO_TCPV4  = 1
+	_VIRTIO_NET_HDR_GSO_TCPV6  = 4
+	_VIRTIO_NET_HDR_GSO_UDP_L4 = 5
 )
 
 // AddHeader implements stack.LinkEndpoint.AddHeader.
@@ -618,6 +621,8 @@ func (e *endpoint) writePacket(pkt *stack.PacketBuffer) tcpip.Error {
 					vnetHdr.gsoType = _VIRTIO_NET_HDR_GSO_TCPV4
 				case stack.GSOTCPv6:
 					vnetHdr.gsoType = _VIRTIO_NET_HDR_GSO_TCPV6
+				case stack.GSOUDPL4:
+					vnetHdr.gsoType = _VIRTIO_NET_HDR_GSO_UDP_L4
 				default:
 					panic(fmt.Sprintf("Unknown gso type: %v", pkt.GSOOptions.Type))
 				}
@@ -691,6 +696,8 @@ func (e *endpoint) sendBatch(batchFDInfo fdInfo, pkts []*stack.PacketBuffer) (in
 							vnetHdr.gsoType = _VIRTIO_NET_HDR_GSO_TCPV4
 						case stack.GSOTCPv6:
 							vnetHdr.gsoType = _VIRTIO_NET_HDR_GSO_TCPV6
+						case stack.GSOUDPL4:
+							vnetHdr.gsoType = _VIRTIO_NET_HDR_GSO_UDP_L4
 						default:
 							panic(fmt.Sprintf("Unknown gso type: %v", pkt.GSOOptions.Type))
 						}
@@ -844,6 +851,22 @@ func (e *endpoint) SupportedGSO() stack.SupportedGSO {
 	return e.gsoKind
 }
 
+// EnableGRO implements stack.OffloadEndpoint.EnableGRO.
+func (e *endpoint) EnableGRO() {
+	for _, d := range e.inboundDispatchers {
+		d.enableGRO()
+	}
+}
+
+// EnableGVisorGSO implements stack.OffloadEndpoint.EnableGVisorGSO.
+func (e *endpoint) EnableGVisorGSO() {
+	if e.gsoKind == stack.HostGSOSupported {
+		return
+	}
+	e.gsoKind = stack.GVisorGSOSupported
+	e.gsoMaxSize = stack.GVisorGSOMaxSize
+}
+
 // ARPHardwareType implements stack.LinkEndpoint.ARPHardwareType.
 func (e *endpoint) ARPHardwareType() header.ARPHardwareType {
 	if e.hdrSize > 0 {
@@ -193,6 +193,41 @@ func TestSetAddress(t *testing.T) {
 	}
 }
 
+func TestEnableGVisorGSO(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		opts       Options
+		wantGSO    stack.SupportedGSO
+		wantMaxLen uint32
+	}{
+		{
+			name:       "no GSO",
+			opts:       Options{MTU: mtu},
+			wantGSO:    stack.GVisorGSOSupported,
+			wantMaxLen: stack.GVisorGSOMaxSize,
+		},
+		{
+			name:       "host GSO",
+			opts:       Options{MTU: mtu, GSOMaxSize: 1 << 15},
+			wantGSO:    stack.HostGSOSupported,
+			wantMaxLen: 1 << 15,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newContext(t, &tc.opts)
+			defer c.cleanup()
+			c.ep.(stack.OffloadEndpoint).EnableGVisorGSO()
+			gso := c.ep.(stack.GSOEndpoint)
+			if got := gso.SupportedGSO(); got != tc.wantGSO {
+				t.Errorf("SupportedGSO() = %v, want %v", got, tc.wantGSO)
+			}
+			if got := gso.GSOMaxSize(); got != tc.wantMaxLen {
+				t.Errorf("GSOMaxSize() = %d, want %d", got, tc.wantMaxLen)
+			}
+		})
+	}
+}
+
 func TestMTU(t *testing.T) {
 	mtus := []uint32{200, 300}
 	c := newContext(t, &Options{MTU: mtu})
@@ -139,8 +139,12 @@ func (d *packetMMapDispatcher) release() {
 	d.mgr.close()
 }
 
-func (d *packetMMapDispatcher) readMMappedPackets() (stack.PacketBufferList, bool, tcpip.Error) {
-	var pkts stack.PacketBufferList
+func (d *packetMMapDispatcher) enableGRO() {
+	d.mgr.enableGRO()
+}
+
+func (d *packetMMapDispatcher) readMMappedPackets() (*stack.PacketBufferList, bool, tcpip.Error) {
+	pkts := stack.NewPacketBufferList(MaxMsgsPerRecv)
 	hdr := tPacketHdr(d.ringBuffer[d.ringOffset*tpFrameSize:])
 	for hdr.tpStatus()&tpStatusUser == 0 {
 		stopped, errno := rawfile.BlockingPollUntilStopped(d.EFD, d.fd, unix.POLLIN|unix.POLLERR)
@@ -180,6 +184,7 @@ func (d *packetMMapDispatcher) readMMappedPackets() (stack.PacketBufferList, boo
 // network stack.
 func (d *packetMMapDispatcher) dispatch() (bool, tcpip.Error) {
 	pkts, stopped, err := d.readMMappedPackets()
+	defer pkts.Release()
 	defer pkts.Reset()
 	if err != nil || stopped {
 		return false, err
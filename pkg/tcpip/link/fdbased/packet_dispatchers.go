@@ -184,6 +184,10 @@ func (d *readVDispatcher) release() {
 	d.mgr.close()
 }
 
+func (d *readVDispatcher) enableGRO() {
+	d.mgr.enableGRO()
+}
+
 // dispatch reads one packet from the file descriptor and dispatches it.
 func (d *readVDispatcher) dispatch() (bool, tcpip.Error) {
 	n, errno := rawfile.BlockingReadvUntilStopped(d.EFD, d.fd, d.buf.nextIovecs())
@@ -274,6 +278,10 @@ func (d *recvMMsgDispatcher) release() {
 	d.mgr.close()
 }
 
+func (d *recvMMsgDispatcher) enableGRO() {
+	d.mgr.enableGRO()
+}
+
 // recvMMsgDispatch reads more than one packet at a time from the file
 // descriptor and dispatches it.
 func (d *recvMMsgDispatcher) dispatch() (bool, tcpip.Error) {
@@ -259,6 +259,14 @@ func (m *processorManager) close() {
 	}
 }
 
+// enableGRO enables GRO on all processors. It must be called before packets
+// are delivered.
+func (m *processorManager) enableGRO() {
+	for i := range m.processors {
+		m.processors[i].gro.Enable()
+	}
+}
+
 // wakeReady wakes up all processors that have a packet queued. If there is only
 // one processor, the method delivers the packet inline without waking a
 // goroutine.
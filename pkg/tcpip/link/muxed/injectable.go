@@ -118,10 +118,11 @@ func (m *InjectableEndpoint) WritePackets(pkts stack.PacketBufferList) (int, tcp
 			return i, &tcpip.ErrHostUnreachable{}
 		}
 
-		var tmpPkts stack.PacketBufferList
+		tmpPkts := stack.NewPacketBufferList(1)
 		tmpPkts.PushBack(pkt)
 
-		n, err := endpoint.WritePackets(tmpPkts)
+		n, err := endpoint.WritePackets(*tmpPkts)
+		tmpPkts.Release()
 		if err != nil {
 			return i, err
 		}
@@ -152,6 +152,28 @@ func (e *Endpoint) SupportedGSO() stack.SupportedGSO {
 	return stack.GSONotSupported
 }
 
+// EnableGRO implements stack.OffloadEndpoint.
+func (e *Endpoint) EnableGRO() {
+	if e, ok := e.child.(stack.OffloadEndpoint); ok {
+		e.EnableGRO()
+	}
+}
+
+// EnableGVisorGSO implements stack.OffloadEndpoint.
+func (e *Endpoint) EnableGVisorGSO() {
+	if e, ok := e.child.(stack.OffloadEndpoint); ok {
+		e.EnableGVisorGSO()
+	}
+}
+
+// Carrier implements stack.CarrierEndpoint.
+func (e *Endpoint) Carrier() bool {
+	if e, ok := e.child.(stack.CarrierEndpoint); ok {
+		return e.Carrier()
+	}
+	return true
+}
+
 // ARPHardwareType implements stack.LinkEndpoint.ARPHardwareType
 func (e *Endpoint) ARPHardwareType() header.ARPHardwareType {
 	return e.child.ARPHardwareType()
@@ -0,0 +1,80 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tc
+
+import (
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/stack"
+)
+
+// bfifo is a FIFO queue limited in bytes, like Linux's bfifo queueing
+// discipline. It is the default child of classful Qdiscs.
+type bfifo struct {
+	limit uint32
+	bytes uint32
+	queue []*stack.PacketBuffer
+}
+
+func newBFIFO(limit uint32) *bfifo {
+	return &bfifo{limit: limit}
+}
+
+// Kind implements Qdisc.Kind.
+func (*bfifo) Kind() string {
+	return "bfifo"
+}
+
+// Handle implements Qdisc.Handle.
+func (*bfifo) Handle() uint32 {
+	return 0
+}
+
+// Enqueue implements Qdisc.Enqueue.
+func (q *bfifo) Enqueue(pkt *stack.PacketBuffer, now tcpip.MonotonicTime) bool {
+	size := uint32(pkt.Size())
+	if q.bytes+size > q.limit {
+		pkt.DecRef()
+		return false
+	}
+	q.bytes += size
+	q.queue = append(q.queue, pkt)
+	return true
+}
+
+// Dequeue implements Qdisc.Dequeue.
+func (q *bfifo) Dequeue(now tcpip.MonotonicTime) (*stack.PacketBuffer, tcpip.MonotonicTime) {
+	if len(q.queue) == 0 {
+		return nil, tcpip.MonotonicTime{}
+	}
+	pkt := q.queue[0]
+	q.queue[0] = nil
+	q.queue = q.queue[1:]
+	q.bytes -= uint32(pkt.Size())
+	return pkt, tcpip.MonotonicTime{}
+}
+
+// Len implements Qdisc.Len.
+func (q *bfifo) Len() int {
+	return len(q.queue)
+}
+
+// Reset implements Qdisc.Reset.
+func (q *bfifo) Reset() {
+	for _, pkt := range q.queue {
+		pkt.DecRef()
+	}
+	q.queue = nil
+	q.bytes = 0
+}
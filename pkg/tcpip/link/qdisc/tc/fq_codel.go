@@ -0,0 +1,491 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tc
+
+import (
+	"math"
+	"time"
+
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/hash/jenkins"
+	"github.com/wilinz/gvisor/pkg/tcpip/header"
+	"github.com/wilinz/gvisor/pkg/tcpip/stack"
+)
+
+// FQCoDelKind is the kind of FQ-CoDel queues.
+const FQCoDelKind = "fq_codel"
+
+// FQCoDelParams are the parameters of an FQ-CoDel queue.
+type FQCoDelParams struct {
+	// Limit is the maximum number of packets in the queue.
+	Limit uint32
+
+	// MemoryLimit is the maximum memory used by packets in the queue, in
+	// bytes.
+	MemoryLimit uint32
+
+	// Flows is the number of flow queues that packets are hashed to.
+	Flows uint32
+
+	// Quantum is the number of bytes that a flow can send in each round of
+	// the deficit round-robin scheduler.
+	Quantum uint32
+
+	// Target is the acceptable minimum queueing delay.
+	Target time.Duration
+
+	// Interval is the time over which the queueing delay must exceed Target
+	// before packets start being dropped.
+	Interval time.Duration
+
+	// CEThreshold is the queueing delay over which ECN-capable packets are
+	// marked with CE, regardless of CoDel's state. It is disabled if zero.
+	CEThreshold time.Duration
+
+	// ECN causes CoDel to mark ECN-capable packets with CE, rather than to
+	// drop them.
+	ECN bool
+
+	// DropBatchSize is the maximum number of packets dropped at once when
+	// the queue is over its limits.
+	DropBatchSize uint32
+}
+
+// DefaultFQCoDelParams returns the default parameters of FQ-CoDel queues,
+// which are those of Linux, for a link whose packets are up to mtu bytes long,
+// including the link header.
+func DefaultFQCoDelParams(mtu uint32) FQCoDelParams {
+	return FQCoDelParams{
+		Limit:         10240,
+		MemoryLimit:   32 << 20,
+		Flows:         1024,
+		Quantum:       mtu,
+		Target:        5 * time.Millisecond,
+		Interval:      100 * time.Millisecond,
+		ECN:           true,
+		DropBatchSize: 64,
+	}
+}
+
+// FQCoDelStats are statistics of an FQ-CoDel queue.
+type FQCoDelStats struct {
+	// Drops is the number of packets dropped, by CoDel or because the queue
+	// was over its limits.
+	Drops uint64
+
+	// ECNMarks is the number of packets marked with CE instead of being
+	// dropped by CoDel.
+	ECNMarks uint64
+
+	// CEMarks is the number of packets marked with CE because their queueing
+	// delay exceeded CEThreshold.
+	CEMarks uint64
+
+	// NewFlows is the number of times a flow queue became active.
+	NewFlows uint64
+}
+
+// fqCoDelPacket is a packet in a flow queue.
+type fqCoDelPacket struct {
+	pkt      *stack.PacketBuffer
+	enqueued tcpip.MonotonicTime
+}
+
+// codelState is the state of CoDel for a flow queue, as described in RFC 8289.
+type codelState struct {
+	// count is the number of packets dropped since entering the dropping
+	// state, and lastCount its value when the dropping state was last
+	// entered.
+	count     uint32
+	lastCount uint32
+
+	// dropping is set in the dropping state.
+	dropping bool
+
+	// firstAbove is the time at which the queueing delay will have been
+	// above the target for an interval, or zero if it is below the target.
+	firstAbove tcpip.MonotonicTime
+
+	// dropNext is the time at which the next packet is dropped in the
+	// dropping state.
+	dropNext tcpip.MonotonicTime
+
+	// delay is the queueing delay of the last dequeued packet.
+	delay time.Duration
+}
+
+// fqCoDelFlow is a flow queue.
+type fqCoDelFlow struct {
+	queue   []fqCoDelPacket
+	backlog uint32
+
+	// deficit is the number of bytes the flow can send in the current
+	// round.
+	deficit int
+
+	// active is set if the flow is in the list of new or old flows.
+	active bool
+
+	codel codelState
+}
+
+var _ Qdisc = (*FQCoDel)(nil)
+
+// FQCoDel is a Fair Queuing Controlled Delay queue, as described in RFC 8290
+// and implemented by Linux's fq_codel queueing discipline.
+//
+// Packets are hashed to flow queues by addresses, transport protocol and
+// ports, and flow queues are served by a deficit round-robin scheduler which
+// favors new flows. CoDel drops or marks packets of each flow queue to keep
+// its queueing delay around the target.
+type FQCoDel struct {
+	handle uint32
+	params FQCoDelParams
+
+	// mtu is the maximum size of packets. CoDel doesn't drop packets when
+	// less than that is queued.
+	mtu uint32
+
+	// seed perturbs the hash of packets to flow queues.
+	seed uint32
+
+	flows    []fqCoDelFlow
+	newFlows []*fqCoDelFlow
+	oldFlows []*fqCoDelFlow
+
+	// len, backlog and memory are the number of packets, bytes and memory
+	// used by the packets in all flow queues.
+	len     int
+	backlog uint32
+	memory  int
+
+	stats FQCoDelStats
+}
+
+// NewFQCoDel returns an FQ-CoDel queue with the given handle and parameters,
+// for a link whose packets are up to mtu bytes long, including the link
+// header. seed perturbs the hash of packets to flow queues.
+//
+// Preconditions: params.Flows and params.Quantum are non-zero.
+func NewFQCoDel(handle uint32, params FQCoDelParams, mtu, seed uint32) *FQCoDel {
+	return &FQCoDel{
+		handle: handle,
+		params: params,
+		mtu:    mtu,
+		seed:   seed,
+		flows:  make([]fqCoDelFlow, params.Flows),
+	}
+}
+
+// Kind implements Qdisc.Kind.
+func (*FQCoDel) Kind() string {
+	return FQCoDelKind
+}
+
+// Handle implements Qdisc.Handle.
+func (q *FQCoDel) Handle() uint32 {
+	return q.handle
+}
+
+// Params returns the queue's parameters.
+func (q *FQCoDel) Params() FQCoDelParams {
+	return q.params
+}
+
+// Stats returns the queue's statistics.
+func (q *FQCoDel) Stats() FQCoDelStats {
+	return q.stats
+}
+
+// Enqueue implements Qdisc.Enqueue.
+func (q *FQCoDel) Enqueue(pkt *stack.PacketBuffer, now tcpip.MonotonicTime) bool {
+	f := &q.flows[q.classify(pkt)]
+	f.queue = append(f.queue, fqCoDelPacket{pkt: pkt, enqueued: now})
+	size := uint32(pkt.Size())
+	f.backlog += size
+	q.backlog += size
+	q.len++
+	q.memory += pkt.MemSize()
+	if !f.active {
+		f.active = true
+		f.deficit = int(q.params.Quantum)
+		q.newFlows = append(q.newFlows, f)
+		q.stats.NewFlows++
+	}
+	if uint32(q.len) > q.params.Limit || q.memory > int(q.params.MemoryLimit) {
+		q.dropFattest()
+	}
+	// Like Linux, the packet is considered enqueued even if packets of its
+	// own flow were dropped.
+	return true
+}
+
+// classify returns the index of the flow queue of pkt.
+func (q *FQCoDel) classify(pkt *stack.PacketBuffer) uint32 {
+	h := jenkins.Sum32(q.seed)
+	hdr := pkt.NetworkHeader().Slice()
+	switch proto := pkt.NetworkProtocolNumber; {
+	case proto == header.IPv4ProtocolNumber && len(hdr) >= header.IPv4MinimumSize,
+		proto == header.IPv6ProtocolNumber && len(hdr) >= header.IPv6MinimumSize:
+		netHdr := pkt.Network()
+		src, dst := netHdr.SourceAddress(), netHdr.DestinationAddress()
+		h.Write(src.AsSlice())
+		h.Write(dst.AsSlice())
+		h.Write([]byte{byte(netHdr.TransportProtocol())})
+		if ports := pkt.TransportHeader().Slice(); len(ports) >= 4 {
+			h.Write(ports[:4])
+		}
+	default:
+		h.Write([]byte{byte(proto >> 8), byte(proto)})
+	}
+	return h.Sum32() % q.params.Flows
+}
+
+// dropFattest drops packets from the head of the flow queue with the largest
+// backlog, until half its backlog or DropBatchSize packets are dropped.
+func (q *FQCoDel) dropFattest() {
+	var fattest *fqCoDelFlow
+	for i := range q.flows {
+		if f := &q.flows[i]; fattest == nil || f.backlog > fattest.backlog {
+			fattest = f
+		}
+	}
+	threshold := fattest.backlog / 2
+	var dropped uint32
+	for i := uint32(0); i < max(q.params.DropBatchSize, 1) && dropped < threshold; i++ {
+		p, ok := q.dequeueHead(fattest)
+		if !ok {
+			break
+		}
+		dropped += uint32(p.pkt.Size())
+		q.drop(p.pkt)
+	}
+}
+
+// dequeueHead removes the packet at the head of f.
+func (q *FQCoDel) dequeueHead(f *fqCoDelFlow) (fqCoDelPacket, bool) {
+	if len(f.queue) == 0 {
+		return fqCoDelPacket{}, false
+	}
+	p := f.queue[0]
+	f.queue[0] = fqCoDelPacket{}
+	f.queue = f.queue[1:]
+	size := uint32(p.pkt.Size())
+	f.backlog -= size
+	q.backlog -= size
+	q.len--
+	q.memory -= p.pkt.MemSize()
+	return p, true
+}
+
+func (q *FQCoDel) drop(pkt *stack.PacketBuffer) {
+	pkt.DecRef()
+	q.stats.Drops++
+}
+
+// Dequeue implements Qdisc.Dequeue.
+func (q *FQCoDel) Dequeue(now tcpip.MonotonicTime) (*stack.PacketBuffer, tcpip.MonotonicTime) {
+	for {
+		var f *fqCoDelFlow
+		isNew := len(q.newFlows) != 0
+		switch {
+		case isNew:
+			f = q.newFlows[0]
+		case len(q.oldFlows) != 0:
+			f = q.oldFlows[0]
+		default:
+			return nil, tcpip.MonotonicTime{}
+		}
+		if f.deficit <= 0 {
+			// The flow has used its quantum: move it to the end of the old
+			// flows for the next round.
+			f.deficit += int(q.params.Quantum)
+			q.popFlow(isNew)
+			q.oldFlows = append(q.oldFlows, f)
+			continue
+		}
+		pkt := q.codelDequeue(f, now)
+		if pkt == nil {
+			q.popFlow(isNew)
+			// Like Linux, an emptied new flow is moved to the old flows
+			// rather than removed, if there are any, so that a flow can't
+			// keep being served as new by sending one packet at a time.
+			if isNew && len(q.oldFlows) != 0 {
+				q.oldFlows = append(q.oldFlows, f)
+			} else {
+				f.active = false
+			}
+			continue
+		}
+		f.deficit -= pkt.Size()
+		return pkt, tcpip.MonotonicTime{}
+	}
+}
+
+// popFlow removes the flow at the head of the list of new or old flows.
+func (q *FQCoDel) popFlow(isNew bool) {
+	list := &q.oldFlows
+	if isNew {
+		list = &q.newFlows
+	}
+	(*list)[0] = nil
+	*list = (*list)[1:]
+}
+
+// codelDequeue dequeues a packet from f, dropping or marking packets as
+// required by CoDel. It returns nil if f is empty.
+func (q *FQCoDel) codelDequeue(f *fqCoDelFlow, now tcpip.MonotonicTime) *stack.PacketBuffer {
+	c := &f.codel
+	p, ok := q.dequeueHead(f)
+	if !ok {
+		c.dropping = false
+		return nil
+	}
+	drop := q.shouldDrop(c, p, ok, now)
+	switch {
+	case c.dropping && !drop:
+		c.dropping = false
+	case c.dropping:
+		for c.dropping && !now.Before(c.dropNext) {
+			c.count++
+			if q.params.ECN && markCE(p.pkt) {
+				q.stats.ECNMarks++
+				c.dropNext = q.controlLaw(c.dropNext, c.count)
+				break
+			}
+			q.drop(p.pkt)
+			p, ok = q.dequeueHead(f)
+			if !q.shouldDrop(c, p, ok, now) {
+				c.dropping = false
+			} else {
+				c.dropNext = q.controlLaw(c.dropNext, c.count)
+			}
+		}
+	case drop:
+		if q.params.ECN && markCE(p.pkt) {
+			q.stats.ECNMarks++
+		} else {
+			q.drop(p.pkt)
+			p, ok = q.dequeueHead(f)
+			q.shouldDrop(c, p, ok, now)
+		}
+		c.dropping = true
+		// If the dropping state was left recently, resume dropping at the
+		// rate it was left at.
+		if delta := c.count - c.lastCount; delta > 1 && now.Sub(c.dropNext) < 16*q.params.Interval {
+			c.count = delta
+		} else {
+			c.count = 1
+		}
+		c.lastCount = c.count
+		c.dropNext = q.controlLaw(now, c.count)
+	}
+	if !ok {
+		return nil
+	}
+	if q.params.CEThreshold != 0 && c.delay > q.params.CEThreshold && markCE(p.pkt) {
+		q.stats.CEMarks++
+	}
+	return p.pkt
+}
+
+// shouldDrop returns whether CoDel should drop the dequeued packet p, which
+// is valid if ok is set.
+func (q *FQCoDel) shouldDrop(c *codelState, p fqCoDelPacket, ok bool, now tcpip.MonotonicTime) bool {
+	if !ok {
+		c.firstAbove = tcpip.MonotonicTime{}
+		return false
+	}
+	c.delay = now.Sub(p.enqueued)
+	if c.delay < q.params.Target || q.backlog <= q.mtu {
+		c.firstAbove = tcpip.MonotonicTime{}
+		return false
+	}
+	if c.firstAbove == (tcpip.MonotonicTime{}) {
+		c.firstAbove = now.Add(q.params.Interval)
+		return false
+	}
+	return !now.Before(c.firstAbove)
+}
+
+// controlLaw returns the time at which to drop the next packet, after
+// dropping count packets since t.
+func (q *FQCoDel) controlLaw(t tcpip.MonotonicTime, count uint32) tcpip.MonotonicTime {
+	return t.Add(time.Duration(float64(q.params.Interval) / math.Sqrt(float64(count))))
+}
+
+// Len implements Qdisc.Len.
+func (q *FQCoDel) Len() int {
+	return q.len
+}
+
+// Reset implements Qdisc.Reset.
+func (q *FQCoDel) Reset() {
+	for i := range q.flows {
+		f := &q.flows[i]
+		for _, p := range f.queue {
+			p.pkt.DecRef()
+		}
+		*f = fqCoDelFlow{}
+	}
+	q.newFlows = nil
+	q.oldFlows = nil
+	q.len = 0
+	q.backlog = 0
+	q.memory = 0
+}
+
+// ECN codepoints, from RFC 3168.
+const (
+	ecnMask   = 0x3
+	ecnNotECT = 0x0
+	ecnCE     = 0x3
+)
+
+// markCE marks pkt with the CE codepoint if it is ECN-capable, and returns
+// whether it is.
+func markCE(pkt *stack.PacketBuffer) bool {
+	hdr := pkt.NetworkHeader().Slice()
+	switch pkt.NetworkProtocolNumber {
+	case header.IPv4ProtocolNumber:
+		if len(hdr) < header.IPv4MinimumSize {
+			return false
+		}
+		h := header.IPv4(hdr)
+		tos, _ := h.TOS()
+		if tos&ecnMask == ecnNotECT {
+			return false
+		}
+		if tos&ecnMask != ecnCE {
+			h.SetTOS(tos|ecnCE, 0)
+			h.SetChecksum(0)
+			h.SetChecksum(^h.CalculateChecksum())
+		}
+		return true
+	case header.IPv6ProtocolNumber:
+		if len(hdr) < header.IPv6MinimumSize {
+			return false
+		}
+		h := header.IPv6(hdr)
+		tc, flowLabel := h.TOS()
+		if tc&ecnMask == ecnNotECT {
+			return false
+		}
+		h.SetTOS(tc|ecnCE, flowLabel)
+		return true
+	default:
+		return false
+	}
+}
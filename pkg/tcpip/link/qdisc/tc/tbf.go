@@ -0,0 +1,175 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tc
+
+import (
+	"time"
+
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/stack"
+)
+
+// TBFKind is the kind of token bucket filters.
+const TBFKind = "tbf"
+
+// TBFParams are the parameters of a token bucket filter.
+type TBFParams struct {
+	// Rate is the rate at which packets are sent, in bytes per second.
+	Rate uint64
+
+	// Burst is the size of the bucket, in bytes: it is the number of bytes
+	// that can be sent at once after the filter has been idle. Packets
+	// larger than Burst are dropped, unless they are GSO packets.
+	Burst uint32
+
+	// Limit is the number of bytes that can be queued waiting for tokens.
+	// It only applies to the default queue: when a child Qdisc is given, it
+	// decides which packets to queue.
+	Limit uint32
+}
+
+// Buffer returns the time it takes to send a full bucket at the filter's
+// rate.
+func (p TBFParams) Buffer() time.Duration {
+	return p.duration(uint64(p.Burst))
+}
+
+// duration returns the time it takes to send size bytes at the filter's rate.
+func (p TBFParams) duration(size uint64) time.Duration {
+	return time.Duration(size * uint64(time.Second) / p.Rate)
+}
+
+var _ Qdisc = (*TBF)(nil)
+
+// TBF is a token bucket filter, which limits the rate at which packets are
+// sent, like Linux's tbf queueing discipline. It has a single class, with
+// minor number 1, which holds a child Qdisc queuing packets waiting for
+// tokens.
+//
+// Tokens are accounted as the time it takes to send a byte at the filter's
+// rate, like in Linux. A GSO packet larger than the bucket is sent once the
+// bucket is full, leaving a negative amount of tokens, so that the filter's
+// average rate isn't exceeded.
+type TBF struct {
+	handle uint32
+	params TBFParams
+
+	// child holds packets waiting for tokens. It is a byte FIFO limited to
+	// params.Limit bytes, unless hasChild is set.
+	child    Qdisc
+	hasChild bool
+
+	// buffer is params.Buffer(), the maximum amount of tokens.
+	buffer time.Duration
+
+	// tokens is the amount of tokens at last, which may be negative after
+	// sending a packet larger than the bucket.
+	tokens time.Duration
+	last   tcpip.MonotonicTime
+
+	// peeked is the next packet to send, which has been dequeued from child
+	// and is waiting for tokens.
+	peeked *stack.PacketBuffer
+}
+
+// NewTBF returns a token bucket filter with the given handle and parameters.
+// Packets waiting for tokens are queued by child if it isn't nil.
+//
+// Preconditions: params.Rate and params.Burst are non-zero.
+func NewTBF(handle uint32, params TBFParams, child Qdisc) *TBF {
+	t := &TBF{
+		handle:   handle,
+		params:   params,
+		child:    child,
+		hasChild: child != nil,
+		buffer:   params.Buffer(),
+	}
+	if child == nil {
+		t.child = newBFIFO(params.Limit)
+	}
+	t.tokens = t.buffer
+	return t
+}
+
+// Kind implements Qdisc.Kind.
+func (*TBF) Kind() string {
+	return TBFKind
+}
+
+// Handle implements Qdisc.Handle.
+func (t *TBF) Handle() uint32 {
+	return t.handle
+}
+
+// Params returns the filter's parameters.
+func (t *TBF) Params() TBFParams {
+	return t.params
+}
+
+// Child returns the child Qdisc given to NewTBF.
+func (t *TBF) Child() Qdisc {
+	if !t.hasChild {
+		return nil
+	}
+	return t.child
+}
+
+// Enqueue implements Qdisc.Enqueue.
+func (t *TBF) Enqueue(pkt *stack.PacketBuffer, now tcpip.MonotonicTime) bool {
+	if pkt.Size() > int(t.params.Burst) && pkt.GSOOptions.Type == stack.GSONone {
+		pkt.DecRef()
+		return false
+	}
+	return t.child.Enqueue(pkt, now)
+}
+
+// Dequeue implements Qdisc.Dequeue.
+func (t *TBF) Dequeue(now tcpip.MonotonicTime) (*stack.PacketBuffer, tcpip.MonotonicTime) {
+	if t.peeked == nil {
+		pkt, wake := t.child.Dequeue(now)
+		if pkt == nil {
+			return nil, wake
+		}
+		t.peeked = pkt
+	}
+	cost := t.params.duration(uint64(t.peeked.Size()))
+	tokens := min(t.tokens+now.Sub(t.last), t.buffer)
+	if need := min(cost, t.buffer); tokens < need {
+		return nil, now.Add(need - tokens)
+	}
+	t.tokens = tokens - cost
+	t.last = now
+	pkt := t.peeked
+	t.peeked = nil
+	return pkt, tcpip.MonotonicTime{}
+}
+
+// Len implements Qdisc.Len.
+func (t *TBF) Len() int {
+	n := t.child.Len()
+	if t.peeked != nil {
+		n++
+	}
+	return n
+}
+
+// Reset implements Qdisc.Reset.
+func (t *TBF) Reset() {
+	t.child.Reset()
+	if t.peeked != nil {
+		t.peeked.DecRef()
+		t.peeked = nil
+	}
+}
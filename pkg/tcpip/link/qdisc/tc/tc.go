@@ -0,0 +1,201 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tc provides traffic control queueing disciplines, as configured by
+// tc(8) on Linux.
+//
+// Unlike stack.QueueingDiscipline, which packets are pushed through, the
+// queueing disciplines in this package are trees of Qdiscs that packets are
+// enqueued to and dequeued from. A Root drives such a tree: it enqueues
+// outgoing packets to it, and dequeues packets from it whenever they can be
+// sent, writing them to a lower stack.LinkWriter.
+package tc
+
+import (
+	"time"
+
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/stack"
+)
+
+// BatchSize is the maximum number of packets written to the lower LinkWriter
+// at once.
+const BatchSize = 47
+
+// Qdisc is a queueing discipline.
+//
+// Qdiscs are not thread-safe: they are only used with the lock of the Root
+// they belong to held.
+type Qdisc interface {
+	// Kind returns the name of the queueing discipline, as used by tc(8).
+	Kind() string
+
+	// Handle returns the handle of the queueing discipline, whose minor
+	// number is zero.
+	Handle() uint32
+
+	// Enqueue adds pkt to the queue, taking ownership of a reference on it.
+	// It returns false if pkt was dropped rather than enqueued.
+	Enqueue(pkt *stack.PacketBuffer, now tcpip.MonotonicTime) bool
+
+	// Dequeue removes the next packet to be sent from the queue and
+	// transfers ownership of a reference on it to the caller.
+	//
+	// If no packet can be sent at now, Dequeue returns nil. If packets are
+	// being held back, it also returns the time at which they can be sent;
+	// otherwise, it returns the zero time.
+	Dequeue(now tcpip.MonotonicTime) (*stack.PacketBuffer, tcpip.MonotonicTime)
+
+	// Len returns the number of packets in the queue.
+	Len() int
+
+	// Reset drops all packets in the queue.
+	Reset()
+}
+
+var _ stack.QueueingDiscipline = (*Root)(nil)
+
+// Root is a stack.QueueingDiscipline that sends packets through a tree of
+// Qdiscs.
+type Root struct {
+	clock tcpip.Clock
+	lower stack.LinkWriter
+	qdisc Qdisc
+
+	mu rootMutex
+
+	// running is set while a goroutine is dequeuing packets and writing them
+	// to lower. It makes sure that packets are written in the order in which
+	// they are dequeued.
+	//
+	// +checklocks:mu
+	running bool
+
+	// closed is set once Close is called.
+	//
+	// +checklocks:mu
+	closed bool
+
+	// timer runs the queue when packets held back by qdisc can be sent. It is
+	// created on first use.
+	//
+	// +checklocks:mu
+	timer tcpip.Timer
+}
+
+// NewRoot returns a Root that sends packets through qdisc to lower.
+func NewRoot(clock tcpip.Clock, lower stack.LinkWriter, qdisc Qdisc) *Root {
+	return &Root{
+		clock: clock,
+		lower: lower,
+		qdisc: qdisc,
+	}
+}
+
+// Qdisc returns the root of the tree of Qdiscs. The tree must not be modified.
+func (r *Root) Qdisc() Qdisc {
+	return r.qdisc
+}
+
+// WritePacket implements stack.QueueingDiscipline.WritePacket.
+func (r *Root) WritePacket(pkt *stack.PacketBuffer) tcpip.Error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return &tcpip.ErrClosedForSend{}
+	}
+	if !r.qdisc.Enqueue(pkt.IncRef(), r.clock.NowMonotonic()) {
+		r.mu.Unlock()
+		return &tcpip.ErrNoBufferSpace{}
+	}
+	r.runLocked()
+	return nil
+}
+
+// Close implements stack.QueueingDiscipline.Close. Packets still in the queue
+// are dropped.
+func (r *Root) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	r.qdisc.Reset()
+}
+
+// runLocked writes packets from the queue to the lower LinkWriter until no
+// packet can be sent, unless another goroutine is already doing so.
+//
+// +checklocksrelease:r.mu
+func (r *Root) runLocked() {
+	if r.running {
+		r.mu.Unlock()
+		return
+	}
+	r.running = true
+	var batch stack.PacketBufferList
+	for {
+		now := r.clock.NowMonotonic()
+		var wake tcpip.MonotonicTime
+		for batch.Len() < BatchSize {
+			var pkt *stack.PacketBuffer
+			if pkt, wake = r.qdisc.Dequeue(now); pkt == nil {
+				break
+			}
+			batch.PushBack(pkt)
+		}
+		if batch.Len() == 0 {
+			r.running = false
+			if wake != (tcpip.MonotonicTime{}) {
+				r.scheduleLocked(wake.Sub(now))
+			}
+			r.mu.Unlock()
+			return
+		}
+		r.mu.Unlock()
+		// Like with other queueing disciplines, errors writing to the link
+		// are not reported to senders.
+		_, _ = r.lower.WritePackets(batch)
+		batch.Reset()
+		r.mu.Lock()
+		if r.closed {
+			r.running = false
+			r.mu.Unlock()
+			return
+		}
+	}
+}
+
+// scheduleLocked makes the queue run after d.
+//
+// +checklocks:r.mu
+func (r *Root) scheduleLocked(d time.Duration) {
+	if r.timer == nil {
+		r.timer = r.clock.AfterFunc(d, r.onTimer)
+		return
+	}
+	r.timer.Stop()
+	r.timer.Reset(d)
+}
+
+// onTimer runs the queue when packets held back by the qdisc can be sent.
+func (r *Root) onTimer() {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.runLocked()
+}
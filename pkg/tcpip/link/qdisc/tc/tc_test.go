@@ -0,0 +1,366 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tc_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/wilinz/gvisor/pkg/buffer"
+	"github.com/wilinz/gvisor/pkg/refs"
+	"github.com/wilinz/gvisor/pkg/sync"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/faketime"
+	"github.com/wilinz/gvisor/pkg/tcpip/header"
+	"github.com/wilinz/gvisor/pkg/tcpip/link/qdisc/tc"
+	"github.com/wilinz/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	ecnECT0 = 0x2
+	ecnCE   = 0x3
+)
+
+// newPacket returns a UDP packet from srcPort with a payload of size bytes,
+// and the given IPv4 TOS.
+func newPacket(srcPort uint16, size int, tos uint8) *stack.PacketBuffer {
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		ReserveHeaderBytes: header.IPv4MinimumSize + header.UDPMinimumSize,
+		Payload:            buffer.MakeWithData(make([]byte, size)),
+	})
+	udp := header.UDP(pkt.TransportHeader().Push(header.UDPMinimumSize))
+	udp.Encode(&header.UDPFields{
+		SrcPort: srcPort,
+		DstPort: 80,
+		Length:  uint16(header.UDPMinimumSize + size),
+	})
+	pkt.TransportProtocolNumber = header.UDPProtocolNumber
+	ip := header.IPv4(pkt.NetworkHeader().Push(header.IPv4MinimumSize))
+	ip.Encode(&header.IPv4Fields{
+		TOS:         tos,
+		TotalLength: uint16(pkt.Size()),
+		TTL:         64,
+		Protocol:    uint8(header.UDPProtocolNumber),
+		SrcAddr:     tcpip.AddrFrom4([4]byte{10, 0, 0, 1}),
+		DstAddr:     tcpip.AddrFrom4([4]byte{10, 0, 0, 2}),
+	})
+	ip.SetChecksum(^ip.CalculateChecksum())
+	pkt.NetworkProtocolNumber = header.IPv4ProtocolNumber
+	return pkt
+}
+
+// srcPort returns the UDP source port of pkt.
+func srcPort(pkt *stack.PacketBuffer) uint16 {
+	return header.UDP(pkt.TransportHeader().Slice()).SourcePort()
+}
+
+var _ stack.LinkWriter = (*recordWriter)(nil)
+
+// recordWriter is a LinkWriter that records when packets are written.
+type recordWriter struct {
+	clock tcpip.Clock
+
+	mu    sync.Mutex
+	times []tcpip.MonotonicTime
+}
+
+// WritePackets implements stack.LinkWriter.WritePackets.
+func (w *recordWriter) WritePackets(pkts stack.PacketBufferList) (int, tcpip.Error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for range pkts.AsSlice() {
+		w.times = append(w.times, w.clock.NowMonotonic())
+	}
+	return pkts.Len(), nil
+}
+
+func (w *recordWriter) written() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.times)
+}
+
+func TestTBFRate(t *testing.T) {
+	clock := faketime.NewManualClock()
+	lower := &recordWriter{clock: clock}
+	// Packets are 128 bytes long, and the bucket holds two of them.
+	const size = 100
+	pktSize := header.IPv4MinimumSize + header.UDPMinimumSize + size
+	root := tc.NewRoot(clock, lower, tc.NewTBF(1<<16, tc.TBFParams{
+		Rate:  uint64(pktSize) * 10,
+		Burst: uint32(pktSize) * 2,
+		Limit: uint32(pktSize) * 5,
+	}, nil))
+	defer root.Close()
+
+	for i := 0; i < 9; i++ {
+		pkt := newPacket(1000, size, 0)
+		err := root.WritePacket(pkt)
+		pkt.DecRef()
+		// Two packets are sent immediately, one waits for tokens and five
+		// are queued.
+		if i < 8 && err != nil {
+			t.Fatalf("WritePacket #%d failed: %s", i, err)
+		}
+		if i == 8 {
+			if _, ok := err.(*tcpip.ErrNoBufferSpace); !ok {
+				t.Fatalf("WritePacket over the limit returned %v, want %s", err, &tcpip.ErrNoBufferSpace{})
+			}
+		}
+	}
+	if got, want := lower.written(), 2; got != want {
+		t.Fatalf("got %d packets written immediately, want %d", got, want)
+	}
+	// Packets are sent every 100ms.
+	for i := 1; i <= 6; i++ {
+		clock.Advance(100 * time.Millisecond)
+		if got, want := lower.written(), 2+i; got != want {
+			t.Fatalf("got %d packets written after %dms, want %d", got, i*100, want)
+		}
+	}
+	clock.Advance(time.Second)
+	if got, want := lower.written(), 8; got != want {
+		t.Fatalf("got %d packets written, want %d", got, want)
+	}
+}
+
+func TestTBFOversizedPacket(t *testing.T) {
+	clock := faketime.NewManualClock()
+	lower := &recordWriter{clock: clock}
+	root := tc.NewRoot(clock, lower, tc.NewTBF(1<<16, tc.TBFParams{
+		Rate:  1000,
+		Burst: 100,
+		Limit: 1000,
+	}, nil))
+	defer root.Close()
+
+	pkt := newPacket(1000, 100, 0)
+	defer pkt.DecRef()
+	if err := root.WritePacket(pkt); err == nil {
+		t.Fatalf("WritePacket succeeded for a packet larger than the bucket")
+	}
+
+	// GSO packets are sent once the bucket is full, and delay packets sent
+	// after them.
+	gsoPkt := newPacket(1000, 172, 0)
+	defer gsoPkt.DecRef()
+	gsoPkt.GSOOptions.Type = stack.GSOTCPv4
+	if err := root.WritePacket(gsoPkt); err != nil {
+		t.Fatalf("WritePacket failed: %s", err)
+	}
+	if err := root.WritePacket(newPacketRef(t, 10)); err != nil {
+		t.Fatalf("WritePacket failed: %s", err)
+	}
+	if got, want := lower.written(), 1; got != want {
+		t.Fatalf("got %d packets written immediately, want %d", got, want)
+	}
+	// The GSO packet took 200ms worth of tokens, leaving -100ms. The next
+	// packet needs 38ms worth of tokens.
+	clock.Advance(137 * time.Millisecond)
+	if got, want := lower.written(), 1; got != want {
+		t.Fatalf("got %d packets written after 137ms, want %d", got, want)
+	}
+	clock.Advance(time.Millisecond)
+	if got, want := lower.written(), 2; got != want {
+		t.Fatalf("got %d packets written after 138ms, want %d", got, want)
+	}
+}
+
+// newPacketRef returns a packet with a payload of size bytes, which is released
+// at the end of the test.
+func newPacketRef(t *testing.T, size int) *stack.PacketBuffer {
+	pkt := newPacket(1000, size, 0)
+	t.Cleanup(pkt.DecRef)
+	return pkt
+}
+
+func TestTBFChild(t *testing.T) {
+	clock := faketime.NewManualClock()
+	lower := &recordWriter{clock: clock}
+	fq := tc.NewFQCoDel(2<<16, tc.DefaultFQCoDelParams(1514), 1514, 0)
+	tbf := tc.NewTBF(1<<16, tc.TBFParams{Rate: 1000, Burst: 1000}, fq)
+	if tbf.Child() != fq {
+		t.Errorf("got child %v, want %v", tbf.Child(), fq)
+	}
+	root := tc.NewRoot(clock, lower, tbf)
+	defer root.Close()
+
+	// The child queue isn't limited by the filter's limit.
+	for i := 0; i < 10; i++ {
+		if err := root.WritePacket(newPacketRef(t, 72)); err != nil {
+			t.Fatalf("WritePacket #%d failed: %s", i, err)
+		}
+	}
+	if got, want := lower.written(), 10; got != want {
+		t.Fatalf("got %d packets written, want %d", got, want)
+	}
+	if got := tbf.Len(); got != 0 {
+		t.Errorf("got %d packets queued, want 0", got)
+	}
+}
+
+func TestRootClose(t *testing.T) {
+	clock := faketime.NewManualClock()
+	lower := &recordWriter{clock: clock}
+	tbf := tc.NewTBF(1<<16, tc.TBFParams{Rate: 1000, Burst: 1000, Limit: 10000}, nil)
+	root := tc.NewRoot(clock, lower, tbf)
+	for i := 0; i < 5; i++ {
+		if err := root.WritePacket(newPacketRef(t, 472)); err != nil {
+			t.Fatalf("WritePacket #%d failed: %s", i, err)
+		}
+	}
+	root.Close()
+	if got := tbf.Len(); got != 0 {
+		t.Errorf("got %d packets queued after Close, want 0", got)
+	}
+	if _, ok := root.WritePacket(newPacketRef(t, 1)).(*tcpip.ErrClosedForSend); !ok {
+		t.Errorf("WritePacket after Close didn't return %s", &tcpip.ErrClosedForSend{})
+	}
+	clock.Advance(time.Second)
+	if got, want := lower.written(), 2; got != want {
+		t.Errorf("got %d packets written, want %d", got, want)
+	}
+}
+
+func TestFQCoDelFairness(t *testing.T) {
+	clock := faketime.NewManualClock()
+	q := tc.NewFQCoDel(1<<16, tc.DefaultFQCoDelParams(1514), 1514, 0)
+	defer q.Reset()
+
+	// A bulk flow fills the queue, then a sparse flow sends a packet.
+	now := clock.NowMonotonic()
+	for i := 0; i < 10; i++ {
+		q.Enqueue(newPacket(1, 1000, 0), now)
+	}
+	q.Enqueue(newPacket(2, 100, 0), now)
+
+	// The bulk flow sends its quantum, then the sparse flow's packet is sent.
+	var ports []uint16
+	for i := 0; i < 4; i++ {
+		pkt, _ := q.Dequeue(now)
+		if pkt == nil {
+			t.Fatalf("Dequeue #%d returned no packet", i)
+		}
+		ports = append(ports, srcPort(pkt))
+		pkt.DecRef()
+	}
+	if want := []uint16{1, 1, 2, 1}; !equal(ports, want) {
+		t.Errorf("got packets from ports %v, want %v", ports, want)
+	}
+	if got, want := q.Len(), 7; got != want {
+		t.Errorf("got %d packets queued, want %d", got, want)
+	}
+	if got, want := q.Stats().NewFlows, uint64(2); got != want {
+		t.Errorf("got %d new flows, want %d", got, want)
+	}
+}
+
+func equal(a, b []uint16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFQCoDelLimit(t *testing.T) {
+	clock := faketime.NewManualClock()
+	params := tc.DefaultFQCoDelParams(1514)
+	params.Limit = 10
+	q := tc.NewFQCoDel(1<<16, params, 1514, 0)
+	defer q.Reset()
+
+	now := clock.NowMonotonic()
+	for i := 0; i < 20; i++ {
+		if !q.Enqueue(newPacket(1, 100, 0), now) {
+			t.Fatalf("Enqueue #%d failed", i)
+		}
+	}
+	if got := q.Len(); got > 10 {
+		t.Errorf("got %d packets queued, want at most 10", got)
+	}
+	if got, want := q.Stats().Drops, uint64(20-q.Len()); got != want {
+		t.Errorf("got %d drops, want %d", got, want)
+	}
+}
+
+// codelTest sends packets of a single flow through an FQ-CoDel queue which
+// receives them twice as fast as it sends them, and returns the sent packets
+// and the queue's statistics.
+func codelTest(tos uint8) ([]*stack.PacketBuffer, tc.FQCoDelStats) {
+	clock := faketime.NewManualClock()
+	q := tc.NewFQCoDel(1<<16, tc.DefaultFQCoDelParams(1514), 1514, 0)
+	defer q.Reset()
+
+	var sent []*stack.PacketBuffer
+	for i := 0; i < 1000; i++ {
+		now := clock.NowMonotonic()
+		q.Enqueue(newPacket(1, 1000, tos), now)
+		q.Enqueue(newPacket(1, 1000, tos), now)
+		if pkt, _ := q.Dequeue(now); pkt != nil {
+			sent = append(sent, pkt)
+		}
+		clock.Advance(time.Millisecond)
+	}
+	return sent, q.Stats()
+}
+
+func TestFQCoDelDrop(t *testing.T) {
+	sent, stats := codelTest(0)
+	defer func() {
+		for _, pkt := range sent {
+			pkt.DecRef()
+		}
+	}()
+	if stats.Drops == 0 {
+		t.Errorf("no packets were dropped")
+	}
+	if stats.ECNMarks != 0 {
+		t.Errorf("got %d packets marked, want 0", stats.ECNMarks)
+	}
+}
+
+func TestFQCoDelECN(t *testing.T) {
+	sent, stats := codelTest(ecnECT0)
+	marked := 0
+	for _, pkt := range sent {
+		h := header.IPv4(pkt.NetworkHeader().Slice())
+		if tos, _ := h.TOS(); tos&ecnCE == ecnCE {
+			marked++
+		}
+		if !h.IsChecksumValid() {
+			t.Errorf("packet has an invalid checksum after marking")
+		}
+		pkt.DecRef()
+	}
+	if stats.Drops != 0 {
+		t.Errorf("got %d packets dropped, want 0", stats.Drops)
+	}
+	if stats.ECNMarks == 0 || uint64(marked) != stats.ECNMarks {
+		t.Errorf("got %d packets marked, stats report %d, want as many and more than 0", marked, stats.ECNMarks)
+	}
+}
+
+func TestMain(m *testing.M) {
+	refs.SetLeakMode(refs.LeaksPanic)
+	code := m.Run()
+	refs.DoLeakCheck()
+	os.Exit(code)
+}
@@ -0,0 +1,265 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sniffer
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/wilinz/gvisor/pkg/sync"
+	"github.com/wilinz/gvisor/pkg/tcpip/stack"
+)
+
+// pcapng block types and options. See
+// https://datatracker.ietf.org/doc/draft-ietf-opsawg-pcapng/.
+const (
+	pcapngSectionHeaderBlock        = 0x0a0d0d0a
+	pcapngInterfaceDescriptionBlock = 0x00000001
+	pcapngEnhancedPacketBlock       = 0x00000006
+
+	pcapngByteOrderMagic = 0x1a2b3c4d
+
+	pcapngOptEndOfOpt = 0
+	pcapngOptIfName   = 2
+	pcapngOptEPBFlags = 2
+
+	// pcapngEPBFlagsInbound and pcapngEPBFlagsOutbound are the direction
+	// bits of the epb_flags option.
+	pcapngEPBFlagsInbound  = 1
+	pcapngEPBFlagsOutbound = 2
+
+	// pcapngLinkTypeRaw is LINKTYPE_RAW. Like the pcap format, link
+	// headers are not captured.
+	pcapngLinkTypeRaw = 101
+)
+
+// Capture writes the packets traversing any number of sniffer endpoints to a
+// writer in the pcapng format. Unlike the pcap format written by endpoints
+// created with NewWithWriter, pcapng records the interface and direction of
+// every packet, so a single Capture can be shared by all endpoints of a stack.
+// Captures are started and stopped on each endpoint with
+// Endpoint.StartCapture and Endpoint.StopCapture.
+type Capture struct {
+	snapLen uint32
+
+	// mu serializes writes of blocks.
+	mu sync.Mutex
+
+	// w is the writer blocks are written to.
+	//
+	// +checklocks:mu
+	w io.Writer
+
+	// err is the first error returned by w. Once it is set, no further
+	// blocks are written.
+	//
+	// +checklocks:mu
+	err error
+
+	// numInterfaces is the number of interface description blocks written,
+	// which is the next interface ID.
+	//
+	// +checklocks:mu
+	numInterfaces uint32
+
+	// closed is set by Close, after which no further blocks are written.
+	//
+	// +checklocks:mu
+	closed bool
+}
+
+// errCaptureClosed is returned when starting a capture on an endpoint with a
+// closed Capture.
+var errCaptureClosed = errors.New("capture closed")
+
+// NewCapture creates a new Capture writing to w, and writes the pcapng
+// section header to w.
+//
+// snapLen is the maximum amount of a packet to be saved. Packets with a
+// length less than or equal to snapLen will be saved in their entirety.
+// Longer packets will be truncated to snapLen.
+func NewCapture(w io.Writer, snapLen uint32) (*Capture, error) {
+	b := newPcapngBlock(pcapngSectionHeaderBlock)
+	b.putUint32(pcapngByteOrderMagic)
+	b.putUint16(1) // Major version.
+	b.putUint16(0) // Minor version.
+	// The section length is unspecified.
+	b.putUint32(0xffffffff)
+	b.putUint32(0xffffffff)
+	if _, err := w.Write(b.finish()); err != nil {
+		return nil, err
+	}
+	return &Capture{
+		snapLen: snapLen,
+		w:       w,
+	}, nil
+}
+
+// Err returns the first error encountered writing to the capture's writer,
+// after which packets are no longer captured.
+func (c *Capture) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close stops writing packets to the capture's writer, and closes the writer
+// if it is an io.Closer. Packets of endpoints still attached to the capture
+// are dropped.
+func (c *Capture) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	if closer, ok := c.w.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// addInterface writes an interface description block for the interface name
+// and returns its ID.
+func (c *Capture) addInterface(name string) (uint32, error) {
+	b := newPcapngBlock(pcapngInterfaceDescriptionBlock)
+	b.putUint16(pcapngLinkTypeRaw)
+	b.putUint16(0) // Reserved.
+	b.putUint32(c.snapLen)
+	if name != "" {
+		b.putOption(pcapngOptIfName, []byte(name))
+	}
+	b.putOption(pcapngOptEndOfOpt, nil)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.writeLocked(b.finish()); err != nil {
+		return 0, err
+	}
+	id := c.numInterfaces
+	c.numInterfaces++
+	return id, nil
+}
+
+// writePacket writes an enhanced packet block for pkt, which traversed the
+// interface ifID in direction dir at ts.
+func (c *Capture) writePacket(ifID uint32, dir Direction, pkt *stack.PacketBuffer, ts time.Time) {
+	clone := trimmedClone(pkt)
+	defer clone.DecRef()
+	packetSize := clone.Size()
+	captureLen := packetSize
+	if captureLen > int(c.snapLen) {
+		captureLen = int(c.snapLen)
+	}
+
+	// Timestamps have the default resolution of microseconds.
+	usec := uint64(ts.UnixMicro())
+	b := newPcapngBlock(pcapngEnhancedPacketBlock)
+	b.putUint32(ifID)
+	b.putUint32(uint32(usec >> 32))
+	b.putUint32(uint32(usec))
+	b.putUint32(uint32(captureLen))
+	b.putUint32(uint32(packetSize))
+	for _, v := range clone.AsSlices() {
+		if captureLen == 0 {
+			break
+		}
+		if len(v) > captureLen {
+			v = v[:captureLen]
+		}
+		b.buf = append(b.buf, v...)
+		captureLen -= len(v)
+	}
+	b.pad()
+	flags := make([]byte, 4)
+	if dir == DirectionRecv {
+		binary.LittleEndian.PutUint32(flags, pcapngEPBFlagsInbound)
+	} else {
+		binary.LittleEndian.PutUint32(flags, pcapngEPBFlagsOutbound)
+	}
+	b.putOption(pcapngOptEPBFlags, flags)
+	b.putOption(pcapngOptEndOfOpt, nil)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Errors are reported by Err.
+	_ = c.writeLocked(b.finish())
+}
+
+// writeLocked writes a block to c.w.
+//
+// +checklocks:c.mu
+func (c *Capture) writeLocked(b []byte) error {
+	if c.closed {
+		return errCaptureClosed
+	}
+	if c.err != nil {
+		return c.err
+	}
+	if _, err := c.w.Write(b); err != nil {
+		c.err = err
+		return err
+	}
+	return nil
+}
+
+// pcapngBlock builds a pcapng block. All fields are written in little endian
+// byte order, as indicated by the byte order magic of the section header.
+type pcapngBlock struct {
+	buf []byte
+}
+
+// newPcapngBlock starts a block of type blockType.
+func newPcapngBlock(blockType uint32) *pcapngBlock {
+	b := &pcapngBlock{}
+	b.putUint32(blockType)
+	// The block total length is filled in by finish.
+	b.putUint32(0)
+	return b
+}
+
+func (b *pcapngBlock) putUint16(v uint16) {
+	b.buf = binary.LittleEndian.AppendUint16(b.buf, v)
+}
+
+func (b *pcapngBlock) putUint32(v uint32) {
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, v)
+}
+
+// pad pads the block to a 32-bit boundary.
+func (b *pcapngBlock) pad() {
+	for len(b.buf)%4 != 0 {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+// putOption appends an option with the given code and value.
+func (b *pcapngBlock) putOption(code uint16, value []byte) {
+	b.putUint16(code)
+	b.putUint16(uint16(len(value)))
+	b.buf = append(b.buf, value...)
+	b.pad()
+}
+
+// finish fills in the block total length at both ends of the block and
+// returns it.
+func (b *pcapngBlock) finish() []byte {
+	length := uint32(len(b.buf) + 4)
+	binary.LittleEndian.PutUint32(b.buf[4:8], length)
+	b.putUint32(length)
+	return b.buf
+}
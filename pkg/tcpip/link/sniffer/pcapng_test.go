@@ -0,0 +1,132 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sniffer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/wilinz/gvisor/pkg/buffer"
+	"github.com/wilinz/gvisor/pkg/tcpip/stack"
+)
+
+// splitBlocks splits a pcapng stream into blocks, checking that the block
+// total length at both ends of every block match.
+func splitBlocks(t *testing.T, b []byte) [][]byte {
+	t.Helper()
+	var blocks [][]byte
+	for len(b) > 0 {
+		if len(b) < 12 {
+			t.Fatalf("truncated block: %x", b)
+		}
+		length := binary.LittleEndian.Uint32(b[4:8])
+		if length%4 != 0 || int(length) > len(b) {
+			t.Fatalf("invalid block total length %d with %d bytes remaining", length, len(b))
+		}
+		if trailing := binary.LittleEndian.Uint32(b[length-4 : length]); trailing != length {
+			t.Fatalf("block total lengths don't match: %d and %d", length, trailing)
+		}
+		blocks = append(blocks, b[:length])
+		b = b[length:]
+	}
+	return blocks
+}
+
+func TestCapture(t *testing.T) {
+	var out bytes.Buffer
+	const snapLen = 6
+	c, err := NewCapture(&out, snapLen)
+	if err != nil {
+		t.Fatalf("NewCapture: %v", err)
+	}
+	for _, name := range []string{"lo", "eth0"} {
+		if _, err := c.addInterface(name); err != nil {
+			t.Fatalf("addInterface(%q): %v", name, err)
+		}
+	}
+
+	payload := []byte("0123456789")
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		Payload: buffer.MakeWithData(payload),
+	})
+	defer pkt.DecRef()
+	ts := time.Unix(1, 2000)
+	c.writePacket(1, DirectionSend, pkt, ts)
+	c.writePacket(0, DirectionRecv, pkt, ts)
+	if err := c.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	blocks := splitBlocks(t, out.Bytes())
+	wantTypes := []uint32{
+		pcapngSectionHeaderBlock,
+		pcapngInterfaceDescriptionBlock,
+		pcapngInterfaceDescriptionBlock,
+		pcapngEnhancedPacketBlock,
+		pcapngEnhancedPacketBlock,
+	}
+	if len(blocks) != len(wantTypes) {
+		t.Fatalf("got %d blocks, want %d", len(blocks), len(wantTypes))
+	}
+	for i, block := range blocks {
+		if got := binary.LittleEndian.Uint32(block[0:4]); got != wantTypes[i] {
+			t.Errorf("block %d: got type %#x, want %#x", i, got, wantTypes[i])
+		}
+	}
+
+	if got := binary.LittleEndian.Uint32(blocks[0][8:12]); got != pcapngByteOrderMagic {
+		t.Errorf("got byte order magic %#x, want %#x", got, pcapngByteOrderMagic)
+	}
+	if got := string(blocks[2][20:24]); got != "eth0" {
+		t.Errorf("got second interface name %q, want %q", got, "eth0")
+	}
+
+	for i, want := range []struct {
+		ifID  uint32
+		flags uint32
+	}{
+		{ifID: 1, flags: pcapngEPBFlagsOutbound},
+		{ifID: 0, flags: pcapngEPBFlagsInbound},
+	} {
+		epb := blocks[3+i]
+		if got := binary.LittleEndian.Uint32(epb[8:12]); got != want.ifID {
+			t.Errorf("packet %d: got interface ID %d, want %d", i, got, want.ifID)
+		}
+		usec := uint64(binary.LittleEndian.Uint32(epb[12:16]))<<32 | uint64(binary.LittleEndian.Uint32(epb[16:20]))
+		if usec != uint64(ts.UnixMicro()) {
+			t.Errorf("packet %d: got timestamp %d, want %d", i, usec, ts.UnixMicro())
+		}
+		if got := binary.LittleEndian.Uint32(epb[20:24]); got != snapLen {
+			t.Errorf("packet %d: got captured length %d, want %d", i, got, snapLen)
+		}
+		if got := binary.LittleEndian.Uint32(epb[24:28]); got != uint32(len(payload)) {
+			t.Errorf("packet %d: got original length %d, want %d", i, got, len(payload))
+		}
+		if got := epb[28 : 28+snapLen]; !bytes.Equal(got, payload[:snapLen]) {
+			t.Errorf("packet %d: got data %q, want %q", i, got, payload[:snapLen])
+		}
+		// The data is padded to 8 bytes, and followed by the epb_flags
+		// option.
+		opt := epb[28+8:]
+		if code, length := binary.LittleEndian.Uint16(opt[0:2]), binary.LittleEndian.Uint16(opt[2:4]); code != pcapngOptEPBFlags || length != 4 {
+			t.Fatalf("packet %d: got option %d with length %d, want epb_flags", i, code, length)
+		}
+		if got := binary.LittleEndian.Uint32(opt[4:8]); got != want.flags {
+			t.Errorf("packet %d: got flags %#x, want %#x", i, got, want.flags)
+		}
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"sync/atomic"
 	"time"
 
 	"github.com/wilinz/gvisor/pkg/atomicbitops"
@@ -47,6 +48,15 @@ type Endpoint struct {
 	writer     io.Writer
 	maxPCAPLen uint32
 	logPrefix  string
+
+	// capture is the pcapng capture started by StartCapture, if any.
+	capture atomic.Pointer[endpointCapture] `state:"nosave"`
+}
+
+// endpointCapture is a Capture of the packets traversing an Endpoint.
+type endpointCapture struct {
+	c    *Capture
+	ifID uint32
 }
 
 var _ stack.GSOEndpoint = (*Endpoint)(nil)
@@ -139,6 +149,26 @@ func NewWithWriter(lower stack.LinkEndpoint, writer io.Writer, snapLen uint32) (
 	return sniffer, nil
 }
 
+// StartCapture starts writing the packets traversing e to c, identifying the
+// interface by name. It replaces any capture previously started on e.
+func (e *Endpoint) StartCapture(c *Capture, name string) error {
+	ifID, err := c.addInterface(name)
+	if err != nil {
+		return err
+	}
+	e.capture.Store(&endpointCapture{c: c, ifID: ifID})
+	return nil
+}
+
+// StopCapture stops the capture started by StartCapture, and returns it. It
+// returns nil if no capture was started.
+func (e *Endpoint) StopCapture() *Capture {
+	if ec := e.capture.Swap(nil); ec != nil {
+		return ec.c
+	}
+	return nil
+}
+
 // DeliverNetworkPacket implements the stack.NetworkDispatcher interface. It is
 // called by the link-layer endpoint being wrapped when a packet arrives, and
 // logs the packet before forwarding to the actual dispatcher.
@@ -147,12 +177,19 @@ func (e *Endpoint) DeliverNetworkPacket(protocol tcpip.NetworkProtocolNumber, pk
 	e.Endpoint.DeliverNetworkPacket(protocol, pkt)
 }
 
-// DumpPacket logs a packet, depending on configuration, to stderr and/or a
-// pcap file. ts is an optional timestamp for the packet.
+// DumpPacket logs a packet, depending on configuration, to stderr, a pcap
+// file and/or a pcapng capture. ts is an optional timestamp for the packet.
 func (e *Endpoint) DumpPacket(dir Direction, protocol tcpip.NetworkProtocolNumber, pkt *stack.PacketBuffer, ts *time.Time) {
 	if LogPackets.Load() == 1 {
 		LogPacket(e.logPrefix, dir, protocol, pkt)
 	}
+	if ec := e.capture.Load(); ec != nil {
+		timestamp := time.Now()
+		if ts != nil {
+			timestamp = *ts
+		}
+		ec.c.writePacket(ec.ifID, dir, pkt, timestamp)
+	}
 	if e.writer != nil {
 		packet := pcapPacket{
 			packet:        pkt,
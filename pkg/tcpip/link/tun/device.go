@@ -20,6 +20,7 @@ import (
 	"github.com/wilinz/gvisor/pkg/buffer"
 	"github.com/wilinz/gvisor/pkg/context"
 	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
+	"github.com/wilinz/gvisor/pkg/sync"
 	"github.com/wilinz/gvisor/pkg/tcpip"
 	"github.com/wilinz/gvisor/pkg/tcpip/header"
 	"github.com/wilinz/gvisor/pkg/tcpip/link/channel"
@@ -35,8 +36,15 @@ const (
 	// Queue length for outbound packet, arriving at fd side for read. Overflow
 	// causes packet drops. gVisor implementation-specific.
 	defaultDevOutQueueLen = 1024
+
+	// include/linux/if_tap.h:MAX_TAP_QUEUES
+	maxQueues = 256
 )
 
+// NoID is the owner or group of an interface that has none, like an invalid
+// kuid_t or kgid_t in Linux.
+const NoID = ^uint32(0)
+
 var zeroMAC [6]byte
 
 // Device is an opened /dev/net/tun device.
@@ -45,8 +53,12 @@ var zeroMAC [6]byte
 type Device struct {
 	waiter.Queue
 
-	mu           deviceRWMutex `state:"nosave"`
-	endpoint     *tunEndpoint
+	mu       deviceRWMutex `state:"nosave"`
+	endpoint *tunEndpoint
+	// queue holds the outbound packets to be read from d. endpoint only
+	// delivers packets to it while d isn't detached by SetQueue.
+	queue        *channel.Endpoint
+	detached     bool
 	notifyHandle *channel.NotificationHandle
 	flags        Flags
 }
@@ -58,6 +70,10 @@ type Flags struct {
 	TUN          bool
 	TAP          bool
 	NoPacketInfo bool
+
+	// MultiQueue allows several devices to be attached to the same
+	// interface, each with its own queue of outbound packets.
+	MultiQueue bool
 }
 
 // beforeSave is invoked by stateify.
@@ -78,15 +94,23 @@ func (d *Device) Release(ctx context.Context) {
 
 	// Decrease refcount if there is an endpoint associated with this file.
 	if d.endpoint != nil {
-		d.endpoint.Drain()
-		d.endpoint.RemoveNotify(d.notifyHandle)
+		if !d.detached {
+			d.endpoint.detachQueue(d.queue)
+		}
+		d.queue.RemoveNotify(d.notifyHandle)
+		d.queue.Close()
 		d.endpoint.DecRef(ctx)
 		d.endpoint = nil
+		d.queue = nil
 	}
 }
 
 // SetIff services TUNSETIFF ioctl(2) request.
-func (d *Device) SetIff(s *stack.Stack, name string, flags Flags) error {
+//
+// capable reports whether the caller is allowed to create an interface, or to
+// attach to an existing one owned by the given user and group (NoID if
+// unset), like tun_not_capable() in Linux.
+func (d *Device) SetIff(s *stack.Stack, name string, flags Flags, capable func(owner, group uint32) bool) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
@@ -109,43 +133,57 @@ func (d *Device) SetIff(s *stack.Stack, name string, flags Flags) error {
 		linkCaps |= stack.CapabilityResolutionRequired
 	}
 
-	endpoint, err := attachOrCreateNIC(s, name, prefix, linkCaps)
+	queue := channel.New(defaultDevOutQueueLen, 0, "")
+	endpoint, err := attachOrCreateNIC(s, name, prefix, linkCaps, flags, queue, capable)
 	if err != nil {
-		return linuxerr.EINVAL
+		queue.Close()
+		return err
 	}
 
 	d.endpoint = endpoint
-	d.notifyHandle = d.endpoint.AddNotify(d)
+	d.queue = queue
+	d.detached = false
+	d.notifyHandle = d.queue.AddNotify(d)
 	d.flags = flags
 	return nil
 }
 
-func attachOrCreateNIC(s *stack.Stack, name, prefix string, linkCaps stack.LinkEndpointCapabilities) (*tunEndpoint, error) {
+func attachOrCreateNIC(s *stack.Stack, name, prefix string, linkCaps stack.LinkEndpointCapabilities, flags Flags, queue *channel.Endpoint, capable func(owner, group uint32) bool) (*tunEndpoint, error) {
 	for {
 		// 1. Try to attach to an existing NIC.
 		if name != "" {
-			if linkEP := s.GetLinkEndpointByName(name); linkEP != nil {
-				endpoint, ok := linkEP.(*tunEndpoint)
-				if !ok {
+			if endpoint, ok := endpointByName(s, name); ok {
+				if endpoint == nil {
 					// Not a NIC created by tun device.
-					return nil, linuxerr.EOPNOTSUPP
+					return nil, linuxerr.EINVAL
 				}
 				if !endpoint.TryIncRef() {
 					// Race detected: NIC got deleted in between.
 					continue
 				}
+				if err := endpoint.attachQueue(queue, flags, capable); err != nil {
+					endpoint.DecRef(context.Background())
+					return nil, err
+				}
 				return endpoint, nil
 			}
 		}
 
 		// 2. Creating a new NIC.
+		if !capable(NoID, NoID) {
+			return nil, linuxerr.EPERM
+		}
 		id := s.NextNICID()
 		endpoint := &tunEndpoint{
-			Endpoint: channel.New(defaultDevOutQueueLen, defaultDevMtu, ""),
-			stack:    s,
-			nicID:    id,
-			name:     name,
-			isTap:    prefix == "tap",
+			Endpoint:   channel.New(0, defaultDevMtu, ""),
+			stack:      s,
+			nicID:      id,
+			name:       name,
+			isTap:      prefix == "tap",
+			multiQueue: flags.MultiQueue,
+			queues:     []*channel.Endpoint{queue},
+			owner:      NoID,
+			group:      NoID,
 		}
 		endpoint.InitRefs()
 		endpoint.Endpoint.LinkEPCapabilities = linkCaps
@@ -153,7 +191,8 @@ func attachOrCreateNIC(s *stack.Stack, name, prefix string, linkCaps stack.LinkE
 			endpoint.name = fmt.Sprintf("%s%d", prefix, id)
 		}
 		err := s.CreateNICWithOptions(endpoint.nicID, packetsocket.New(endpoint), stack.NICOptions{
-			Name: endpoint.name,
+			Name:    endpoint.name,
+			Context: endpoint,
 		})
 		switch err.(type) {
 		case nil:
@@ -167,11 +206,112 @@ func attachOrCreateNIC(s *stack.Stack, name, prefix string, linkCaps stack.LinkE
 	}
 }
 
+// endpointByName returns the endpoint of the NIC of s with the given name. It
+// returns nil and true if the NIC exists but wasn't created by a tun device.
+func endpointByName(s *stack.Stack, name string) (*tunEndpoint, bool) {
+	for _, info := range s.NICInfo() {
+		if info.Name == name {
+			endpoint, _ := info.Context.(*tunEndpoint)
+			return endpoint, true
+		}
+	}
+	return nil, false
+}
+
+// SetQueue services TUNSETQUEUE ioctl(2) request. A multi-queue device can be
+// detached from its interface, so that it doesn't receive packets, and
+// attached again later.
+func (d *Device) SetQueue(attach bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.endpoint == nil {
+		return linuxerr.EINVAL
+	}
+	if attach {
+		if !d.detached {
+			return linuxerr.EINVAL
+		}
+		// The device already passed the permission checks when it was
+		// attached by SetIff.
+		capable := func(owner, group uint32) bool { return true }
+		if err := d.endpoint.attachQueue(d.queue, d.flags, capable); err != nil {
+			return err
+		}
+		d.detached = false
+		return nil
+	}
+	if d.detached || !d.endpoint.multiQueue {
+		return linuxerr.EINVAL
+	}
+	d.endpoint.detachQueue(d.queue)
+	d.queue.Drain()
+	d.detached = true
+	return nil
+}
+
+// attachedEndpoint returns the endpoint d is attached to, or nil if there is
+// none or d is detached.
+func (d *Device) attachedEndpoint() *tunEndpoint {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.detached {
+		return nil
+	}
+	return d.endpoint
+}
+
+// SetPersist services TUNSETPERSIST ioctl(2) request. A persistent interface
+// isn't removed when the last device attached to it is released.
+func (d *Device) SetPersist(persist bool) error {
+	endpoint := d.attachedEndpoint()
+	if endpoint == nil {
+		return linuxerr.EBADFD
+	}
+	endpoint.setPersist(persist)
+	return nil
+}
+
+// Persistent returns true if d is attached to a persistent interface.
+func (d *Device) Persistent() bool {
+	endpoint := d.attachedEndpoint()
+	if endpoint == nil {
+		return false
+	}
+	endpoint.mu.RLock()
+	defer endpoint.mu.RUnlock()
+	return endpoint.persist
+}
+
+// SetOwner services TUNSETOWNER ioctl(2) request. The owner of an interface
+// can attach devices to it without CAP_NET_ADMIN.
+func (d *Device) SetOwner(owner uint32) error {
+	endpoint := d.attachedEndpoint()
+	if endpoint == nil {
+		return linuxerr.EBADFD
+	}
+	endpoint.mu.Lock()
+	defer endpoint.mu.Unlock()
+	endpoint.owner = owner
+	return nil
+}
+
+// SetGroup services TUNSETGROUP ioctl(2) request. Members of the group of an
+// interface can attach devices to it without CAP_NET_ADMIN.
+func (d *Device) SetGroup(group uint32) error {
+	endpoint := d.attachedEndpoint()
+	if endpoint == nil {
+		return linuxerr.EBADFD
+	}
+	endpoint.mu.Lock()
+	defer endpoint.mu.Unlock()
+	endpoint.group = group
+	return nil
+}
+
 // MTU returns the tun endpoint MTU (maximum transmission unit).
 func (d *Device) MTU() (uint32, error) {
-	d.mu.RLock()
-	endpoint := d.endpoint
-	d.mu.RUnlock()
+	endpoint := d.attachedEndpoint()
 	if endpoint == nil {
 		return 0, linuxerr.EBADFD
 	}
@@ -183,9 +323,7 @@ func (d *Device) MTU() (uint32, error) {
 
 // Write inject one inbound packet to the network interface.
 func (d *Device) Write(data *buffer.View) (int64, error) {
-	d.mu.RLock()
-	endpoint := d.endpoint
-	d.mu.RUnlock()
+	endpoint := d.attachedEndpoint()
 	if endpoint == nil {
 		return 0, linuxerr.EBADFD
 	}
@@ -254,13 +392,14 @@ func (d *Device) Write(data *buffer.View) (int64, error) {
 // Read reads one outgoing packet from the network interface.
 func (d *Device) Read() (*buffer.View, error) {
 	d.mu.RLock()
-	endpoint := d.endpoint
+	queue := d.queue
+	detached := d.detached
 	d.mu.RUnlock()
-	if endpoint == nil {
+	if queue == nil || detached {
 		return nil, linuxerr.EBADFD
 	}
 
-	pkt := endpoint.Read()
+	pkt := queue.Read()
 	if pkt == nil {
 		return nil, linuxerr.ErrWouldBlock
 	}
@@ -313,9 +452,9 @@ func (d *Device) Flags() Flags {
 func (d *Device) Readiness(mask waiter.EventMask) waiter.EventMask {
 	if mask&waiter.ReadableEvents != 0 {
 		d.mu.RLock()
-		endpoint := d.endpoint
+		queue := d.queue
 		d.mu.RUnlock()
-		if endpoint != nil && endpoint.NumQueued() == 0 {
+		if queue != nil && queue.NumQueued() == 0 {
 			mask &= ^waiter.ReadableEvents
 		}
 	}
@@ -329,24 +468,133 @@ func (d *Device) WriteNotify() {
 
 // tunEndpoint is the link endpoint for the NIC created by the tun device.
 //
-// It is ref-counted as multiple opening files can attach to the same NIC.
-// The last owner is responsible for deleting the NIC.
+// It is ref-counted as multiple opening files can attach to the same NIC, and
+// a persistent NIC holds a reference to itself. The last owner is responsible
+// for deleting the NIC.
+//
+// Outbound packets aren't stored in the queue of the embedded channel
+// endpoint, but in the queues of the attached devices.
 //
 // +stateify savable
 type tunEndpoint struct {
 	tunEndpointRefs
 	*channel.Endpoint
 
-	stack *stack.Stack
-	nicID tcpip.NICID
-	name  string
-	isTap bool
+	stack      *stack.Stack
+	nicID      tcpip.NICID
+	name       string
+	isTap      bool
+	multiQueue bool
+
+	mu sync.RWMutex `state:"nosave"`
+
+	// queues are the queues of the attached devices. The slice is
+	// replaced, not modified, so that it can be used without holding mu.
+	//
+	// +checklocks:mu
+	queues []*channel.Endpoint
+
+	// +checklocks:mu
+	persist bool
+
+	// owner and group are the KUID and KGID allowed to attach devices to
+	// the NIC, or NoID.
+	//
+	// +checklocks:mu
+	owner uint32
+	// +checklocks:mu
+	group uint32
+}
+
+// attachQueue attaches the queue of a device with the given flags to e.
+func (e *tunEndpoint) attachQueue(queue *channel.Endpoint, flags Flags, capable func(owner, group uint32) bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if flags.TAP != e.isTap || flags.MultiQueue != e.multiQueue {
+		return linuxerr.EINVAL
+	}
+	if !capable(e.owner, e.group) {
+		return linuxerr.EPERM
+	}
+	if !e.multiQueue && len(e.queues) > 0 {
+		return linuxerr.EBUSY
+	}
+	if len(e.queues) >= maxQueues {
+		return linuxerr.E2BIG
+	}
+	queues := make([]*channel.Endpoint, 0, len(e.queues)+1)
+	e.queues = append(append(queues, e.queues...), queue)
+	return nil
+}
+
+// detachQueue detaches the queue of a device from e.
+func (e *tunEndpoint) detachQueue(queue *channel.Endpoint) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	queues := make([]*channel.Endpoint, 0, len(e.queues))
+	for _, q := range e.queues {
+		if q != queue {
+			queues = append(queues, q)
+		}
+	}
+	e.queues = queues
+}
+
+// setPersist makes e persistent or not.
+func (e *tunEndpoint) setPersist(persist bool) {
+	e.mu.Lock()
+	changed := e.persist != persist
+	e.persist = persist
+	e.mu.Unlock()
+	if !changed {
+		return
+	}
+	if persist {
+		e.IncRef()
+	} else {
+		e.DecRef(context.Background())
+	}
+}
+
+// WritePackets implements stack.LinkEndpoint.WritePackets. Packets are
+// distributed among the attached queues by their transport layer hash, so
+// that all packets of a flow are read from the same queue.
+func (e *tunEndpoint) WritePackets(pkts stack.PacketBufferList) (int, tcpip.Error) {
+	e.mu.RLock()
+	queues := e.queues
+	e.mu.RUnlock()
+
+	n := 0
+	for _, pkt := range pkts.AsSlice() {
+		if len(queues) == 0 {
+			// As in Linux, packets sent to a persistent NIC without
+			// attached devices are dropped.
+			n++
+			continue
+		}
+		q := queues[pkt.Hash%uint32(len(queues))]
+		if err := q.WritePacket(pkt); err != nil {
+			if _, ok := err.(*tcpip.ErrNoBufferSpace); !ok && n == 0 {
+				return 0, err
+			}
+			break
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Close implements stack.LinkEndpoint.Close. It is called when the NIC is
+// removed, which drops the reference held by a persistent NIC.
+func (e *tunEndpoint) Close() {
+	e.Endpoint.Close()
+	e.setPersist(false)
 }
 
 // DecRef decrements refcount of e, removing NIC if it reaches 0.
 func (e *tunEndpoint) DecRef(ctx context.Context) {
 	e.tunEndpointRefs.DecRef(func() {
-		e.Close()
+		e.Endpoint.Close()
 		e.stack.RemoveNIC(e.nicID)
 	})
 }
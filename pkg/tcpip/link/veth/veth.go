@@ -26,13 +26,13 @@ const DefaultBacklogSize = 1000
 
 var _ stack.LinkEndpoint = (*Endpoint)(nil)
 var _ stack.GSOEndpoint = (*Endpoint)(nil)
+var _ stack.CarrierEndpoint = (*Endpoint)(nil)
 
 // +stateify savable
 type veth struct {
 	mu           vethRWMutex `state:"nosave"`
 	closed       bool
 	backlogQueue chan vethPacket `state:"nosave"`
-	mtu          uint32
 	endpoints    [2]Endpoint
 }
 
@@ -80,21 +80,29 @@ type Endpoint struct {
 	//
 	// +checklocks:mu
 	linkAddr tcpip.LinkAddress
+	// mtu is the MTU of this endpoint. As in Linux, the two endpoints of a
+	// pair have independent MTUs, and packets larger than the MTU of the
+	// receiving endpoint are dropped.
+	//
+	// +checklocks:mu
+	mtu uint32
 	// +checklocks:mu
 	onCloseAction func() `state:"nosave"`
 }
 
-// NewPair creates a new veth pair.
+// NewPair creates a new veth pair. Both endpoints start with the specified
+// MTU.
 func NewPair(mtu, backlogQueueSize uint32) (*Endpoint, *Endpoint) {
 	veth := veth{
 		backlogQueue: make(chan vethPacket, backlogQueueSize),
-		mtu:          mtu,
 		endpoints: [2]Endpoint{
 			{
 				linkAddr: tcpip.GetRandMacAddr(),
+				mtu:      mtu,
 			},
 			{
 				linkAddr: tcpip.GetRandMacAddr(),
+				mtu:      mtu,
 			},
 		},
 	}
@@ -148,16 +156,26 @@ func (e *Endpoint) IsAttached() bool {
 
 // MTU implements stack.LinkEndpoint.MTU.
 func (e *Endpoint) MTU() uint32 {
-	e.veth.mu.RLock()
-	defer e.veth.mu.RUnlock()
-	return e.veth.mtu
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.mtu
 }
 
-// SetMTU implements stack.LinkEndpoint.SetMTU.
+// SetMTU implements stack.LinkEndpoint.SetMTU. It only changes the MTU of e,
+// not the one of its peer.
 func (e *Endpoint) SetMTU(mtu uint32) {
-	e.veth.mu.Lock()
-	defer e.veth.mu.Unlock()
-	e.veth.mtu = mtu
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.mtu = mtu
+}
+
+// Carrier implements stack.CarrierEndpoint.Carrier. A veth endpoint has a
+// carrier if the pair isn't closed and its peer is attached to a NIC, like a
+// Linux veth device whose peer is up.
+func (e *Endpoint) Carrier() bool {
+	e.veth.mu.RLock()
+	defer e.veth.mu.RUnlock()
+	return !e.veth.closed && e.peer.IsAttached()
 }
 
 // Capabilities implements stack.LinkEndpoint.Capabilities.
@@ -206,8 +224,19 @@ func (e *Endpoint) WritePackets(pkts stack.PacketBufferList) (int, tcpip.Error)
 		return 0, nil
 	}
 
+	// Packets are forwarded only if they fit in the MTU of the peer, see
+	// is_skb_forwardable() in Linux. They are counted as written, since
+	// dropping them isn't an error for the sender.
+	e.peer.mu.RLock()
+	maxSize := int(e.peer.mtu) + header.EthernetMinimumSize + header.VLANTagSize
+	e.peer.mu.RUnlock()
+
 	n := 0
 	for _, pkt := range pkts.AsSlice() {
+		if pkt.GSOOptions.Type == stack.GSONone && pkt.Size() > maxSize {
+			n++
+			continue
+		}
 		// In order to properly loop back to the inbound side we must create a
 		// fresh packet that only contains the underlying payload with no headers
 		// or struct fields set. We must deep clone the payload to avoid
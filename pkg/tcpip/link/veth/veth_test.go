@@ -191,6 +191,69 @@ func TestMTU(t *testing.T) {
 		if want, v := mtu, e.MTU(); want != v {
 			t.Errorf("MTU() = %v, want %v", v, want)
 		}
+		// The MTU of the peer doesn't change.
+		if want, v := uint32(1500), e2.MTU(); want != v {
+			t.Errorf("peer MTU() = %v, want %v", v, want)
+		}
+	}
+}
+
+func TestWritePacketTooBig(t *testing.T) {
+	const (
+		localLinkAddr  = tcpip.LinkAddress("\x02\x02\x03\x04\x05\x06")
+		remoteLinkAddr = tcpip.LinkAddress("\x02\x02\x03\x04\x05\x07")
+
+		netProto = 55
+		nicID    = 5
+		peerMTU  = 100
+	)
+
+	veth1, veth2 := veth.NewPair(1500, veth.DefaultBacklogSize)
+	veth1.SetLinkAddress(localLinkAddr)
+	veth2.SetLinkAddress(remoteLinkAddr)
+	veth2.SetMTU(peerMTU)
+
+	s := stack.New(stack.Options{})
+	if err := s.CreateNIC(nicID, ethernet.New(veth1)); err != nil {
+		t.Fatalf("s.CreateNIC(%d, _): %s", nicID, err)
+	}
+
+	var wg sync.WaitGroup
+	sink := &testNetworkDispatcher{ch: make(chan *stack.PacketBuffer, 2), wg: &wg}
+	veth2Ethernet := ethernet.New(veth2)
+	veth2Ethernet.Attach(sink)
+
+	// The first packet doesn't fit in the MTU of veth2 and is dropped
+	// silently, the second one is delivered.
+	for _, size := range []int{peerMTU + 1, peerMTU} {
+		payload := buffer.MakeWithData(make([]byte, size))
+		if err := s.WritePacketToRemote(nicID, remoteLinkAddr, netProto, payload); err != nil {
+			t.Fatalf("s.WritePacketToRemote(%d, %s, _): %s", nicID, remoteLinkAddr, err)
+		}
+	}
+	pkt := <-sink.ch
+	defer pkt.DecRef()
+	if got, want := pkt.Data().Size(), peerMTU; got != want {
+		t.Errorf("got packet of %d bytes, want %d", got, want)
+	}
+}
+
+func TestCarrier(t *testing.T) {
+	veth1, veth2 := veth.NewPair(1500, veth.DefaultBacklogSize)
+	defer veth2.Close()
+
+	var wg sync.WaitGroup
+	sink := &testNetworkDispatcher{ch: make(chan *stack.PacketBuffer, 1), wg: &wg}
+	if veth1.Carrier() {
+		t.Errorf("Carrier() = true before the peer is attached")
+	}
+	veth2.Attach(sink)
+	if !veth1.Carrier() {
+		t.Errorf("Carrier() = false after the peer is attached")
+	}
+	veth1.Close()
+	if veth2.Carrier() {
+		t.Errorf("Carrier() = true after the pair is closed")
 	}
 }
 
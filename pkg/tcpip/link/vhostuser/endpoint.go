@@ -0,0 +1,543 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+// Package vhostuser provides a link layer endpoint backed by a vhost-user
+// backend, such as DPDK or OVS-DPDK.
+//
+// The endpoint is a vhost-user frontend driving a virtio-net device: it
+// negotiates virtio features with the backend over a Unix domain socket and
+// shares a memory region holding a receive and a transmit virtqueue and their
+// buffers. Packets are then exchanged through the virtqueues, with eventfds
+// used for the notifications that aren't suppressed.
+package vhostuser
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+	"github.com/wilinz/gvisor/pkg/buffer"
+	"github.com/wilinz/gvisor/pkg/eventfd"
+	"github.com/wilinz/gvisor/pkg/memutil"
+	"github.com/wilinz/gvisor/pkg/rawfile"
+	"github.com/wilinz/gvisor/pkg/sync"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/header"
+	"github.com/wilinz/gvisor/pkg/tcpip/link/stopfd"
+	"github.com/wilinz/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	// DefaultMTU is the MTU used if Options.MTU is zero.
+	DefaultMTU = 1500
+
+	// DefaultQueueSize is the number of descriptors of each virtqueue if
+	// Options.QueueSize is zero.
+	DefaultQueueSize = 256
+
+	// bufSize is the size of the buffer of each descriptor. Buffers hold a
+	// whole frame, since VIRTIO_NET_F_MRG_RXBUF isn't negotiated.
+	bufSize = 2048
+
+	// virtioNetHdrSize is the size of struct virtio_net_hdr with
+	// VIRTIO_F_VERSION_1, which precedes each frame.
+	virtioNetHdrSize = 12
+
+	// MaxMTU is the largest MTU supported by the endpoint.
+	MaxMTU = bufSize - virtioNetHdrSize - header.EthernetMinimumSize
+
+	// maxQueueSize is the largest virtqueue size allowed by the virtio
+	// specification.
+	maxQueueSize = 32768
+)
+
+// Indexes of the virtio-net virtqueues used by the endpoint.
+const (
+	rxQueueIndex = 0
+	txQueueIndex = 1
+)
+
+var _ stack.LinkEndpoint = (*endpoint)(nil)
+
+// endpoint is not savable, since its virtqueues live in memory shared with
+// the backend.
+type endpoint struct {
+	// fd is the socket connected to the backend.
+	fd int
+
+	// mtu is the maximum transmission unit of the endpoint.
+	mtu uint32
+
+	// caps holds the endpoint capabilities.
+	caps stack.LinkEndpointCapabilities
+
+	// closed is a function to be called when the endpoint stops receiving
+	// packets because of an error.
+	closed func(tcpip.Error)
+
+	mu endpointRWMutex
+	// +checklocks:mu
+	networkDispatcher stack.NetworkDispatcher
+	// +checklocks:mu
+	addr tcpip.LinkAddress
+
+	// wg keeps track of running goroutines.
+	wg sync.WaitGroup
+
+	// stopFD is used to stop the dispatch loop.
+	stopFD stopfd.StopFD
+
+	// memFD backs mem, the memory shared with the backend. mem is nil once
+	// the endpoint is closed.
+	memFD int
+	// +checklocks:txMu
+	mem []byte
+
+	// rx is the receive virtqueue. It is only used by the dispatch loop
+	// once the endpoint is created.
+	rx     virtqueue
+	rxKick eventfd.Eventfd
+	rxCall eventfd.Eventfd
+
+	txMu sync.Mutex
+	// +checklocks:txMu
+	tx     virtqueue
+	txKick eventfd.Eventfd
+	txCall eventfd.Eventfd
+}
+
+// Options specify the details about the vhost-user endpoint to be created.
+type Options struct {
+	// FD is a Unix domain socket connected to the vhost-user backend. The
+	// endpoint doesn't take ownership of FD, which must remain open until
+	// the endpoint is closed.
+	FD int
+
+	// MTU is the MTU of the endpoint. It must not exceed MaxMTU. If zero,
+	// DefaultMTU is used.
+	MTU uint32
+
+	// QueueSize is the number of descriptors of each virtqueue. It must be
+	// a power of 2. If zero, DefaultQueueSize is used.
+	QueueSize uint16
+
+	// ClosedFunc is a function to be called when the endpoint stops
+	// receiving packets because of an error.
+	ClosedFunc func(tcpip.Error)
+
+	// Address is the link address for this endpoint.
+	Address tcpip.LinkAddress
+
+	// DisconnectOk if true, indicates that this NIC capability set should
+	// include CapabilityDisconnectOk.
+	DisconnectOk bool
+}
+
+// New creates a new endpoint connected to a vhost-user backend. It negotiates
+// features with the backend and sets up the virtqueues before returning.
+func New(opts *Options) (stack.LinkEndpoint, error) {
+	mtu := opts.MTU
+	if mtu == 0 {
+		mtu = DefaultMTU
+	}
+	if mtu > MaxMTU {
+		return nil, fmt.Errorf("MTU %d exceeds the maximum of %d", mtu, MaxMTU)
+	}
+	queueSize := opts.QueueSize
+	if queueSize == 0 {
+		queueSize = DefaultQueueSize
+	}
+	if queueSize&(queueSize-1) != 0 || queueSize > maxQueueSize {
+		return nil, fmt.Errorf("queue size %d isn't a power of 2 up to %d", queueSize, maxQueueSize)
+	}
+
+	caps := stack.CapabilityResolutionRequired
+	if opts.DisconnectOk {
+		caps |= stack.CapabilityDisconnectOk
+	}
+
+	// Requests are sent synchronously.
+	if err := unix.SetNonblock(opts.FD, false); err != nil {
+		return nil, fmt.Errorf("unix.SetNonblock(%v) failed: %v", opts.FD, err)
+	}
+
+	e := &endpoint{
+		fd:     opts.FD,
+		mtu:    mtu,
+		caps:   caps,
+		closed: opts.ClosedFunc,
+		addr:   opts.Address,
+		stopFD: stopfd.StopFD{EFD: -1},
+		memFD:  -1,
+		rxKick: eventfd.Wrap(-1),
+		rxCall: eventfd.Wrap(-1),
+		txKick: eventfd.Wrap(-1),
+		txCall: eventfd.Wrap(-1),
+	}
+	e.txMu.Lock()
+	defer e.txMu.Unlock()
+	if err := e.init(queueSize); err != nil {
+		e.release()
+		return nil, err
+	}
+	return e, nil
+}
+
+// init allocates the shared memory, eventfds and virtqueues of e, and sets
+// them up with the backend.
+//
+// +checklocks:e.txMu
+func (e *endpoint) init(queueSize uint16) error {
+	var err error
+	if e.stopFD, err = stopfd.New(); err != nil {
+		return err
+	}
+	for _, ev := range []*eventfd.Eventfd{&e.rxKick, &e.rxCall, &e.txKick, &e.txCall} {
+		if *ev, err = eventfd.Create(); err != nil {
+			return err
+		}
+	}
+
+	layout := newVirtqueueLayout(queueSize, bufSize)
+	size := 2 * layout.total
+	if e.memFD, err = memutil.CreateMemFD("vhost-user", 0); err != nil {
+		return fmt.Errorf("creating memfd: %w", err)
+	}
+	if err := unix.Ftruncate(e.memFD, int64(size)); err != nil {
+		return fmt.Errorf("ftruncate of memfd: %w", err)
+	}
+	if e.mem, err = memutil.MapSlice(0, uintptr(size), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED, uintptr(e.memFD), 0); err != nil {
+		return fmt.Errorf("mapping memfd: %w", err)
+	}
+
+	// Addresses shared with the backend are offsets in mem.
+	e.rx.init(e.mem[:layout.total], 0, layout)
+	e.tx.init(e.mem[layout.total:], layout.total, layout)
+	e.tx.availFlags = availFlagNoInterrupt
+	for id := uint16(0); id < queueSize; id++ {
+		e.tx.free = append(e.tx.free, id)
+	}
+	e.tx.publish()
+	for id := uint16(0); id < queueSize; id++ {
+		e.rx.push(id, bufSize, descFlagWrite)
+	}
+	e.rx.publish()
+
+	f := frontend{fd: e.fd}
+	enableRings, err := f.negotiateFeatures()
+	if err != nil {
+		return err
+	}
+	region := memoryRegion{
+		guestPhysAddr: 0,
+		size:          size,
+		userAddr:      memAddr(e.mem),
+		mmapOffset:    0,
+	}
+	if err := f.setMemTable(region, e.memFD); err != nil {
+		return err
+	}
+	for _, vq := range []struct {
+		index      uint32
+		q          *virtqueue
+		kick, call eventfd.Eventfd
+	}{
+		{rxQueueIndex, &e.rx, e.rxKick, e.rxCall},
+		{txQueueIndex, &e.tx, e.txKick, e.txCall},
+	} {
+		if err := f.setVringState(reqSetVringNum, vq.index, uint32(queueSize)); err != nil {
+			return err
+		}
+		if err := f.setVringState(reqSetVringBase, vq.index, 0); err != nil {
+			return err
+		}
+		desc, used, avail := memAddr(vq.q.mem[vq.q.descOff:]), memAddr(vq.q.mem[vq.q.usedOff:]), memAddr(vq.q.mem[vq.q.availOff:])
+		if err := f.setVringAddr(vq.index, desc, used, avail); err != nil {
+			return err
+		}
+		if err := f.setVringFD(reqSetVringCall, vq.index, vq.call.FD()); err != nil {
+			return err
+		}
+		if err := f.setVringFD(reqSetVringKick, vq.index, vq.kick.FD()); err != nil {
+			return err
+		}
+		if enableRings {
+			if err := f.setVringState(reqSetVringEnable, vq.index, 1); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Tell the backend about the receive buffers.
+	return e.rxKick.Notify()
+}
+
+// release releases the resources of e. It must not be called while the
+// dispatch loop is running.
+//
+// +checklocks:e.txMu
+func (e *endpoint) release() {
+	for _, ev := range []*eventfd.Eventfd{&e.rxKick, &e.rxCall, &e.txKick, &e.txCall} {
+		if ev.FD() >= 0 {
+			ev.Close()
+			*ev = eventfd.Wrap(-1)
+		}
+	}
+	if e.mem != nil {
+		memutil.UnmapSlice(e.mem)
+		e.mem = nil
+	}
+	if e.memFD >= 0 {
+		unix.Close(e.memFD)
+		e.memFD = -1
+	}
+	if e.stopFD.EFD >= 0 {
+		unix.Close(e.stopFD.EFD)
+		e.stopFD.EFD = -1
+	}
+}
+
+// Attach launches the goroutine that receives packets from the backend and
+// dispatches them via the provided dispatcher. If one is already attached,
+// then nothing happens.
+//
+// Attach implements stack.LinkEndpoint.Attach.
+func (e *endpoint) Attach(networkDispatcher stack.NetworkDispatcher) {
+	e.mu.Lock()
+	// nil means the NIC is being removed.
+	if networkDispatcher == nil && e.networkDispatcher != nil {
+		e.networkDispatcher = nil
+		e.mu.Unlock()
+		// The dispatch loop takes e.mu, so it must be waited for
+		// without holding it.
+		e.stopFD.Stop()
+		e.wg.Wait()
+		return
+	}
+	defer e.mu.Unlock()
+	if networkDispatcher != nil && e.networkDispatcher == nil {
+		e.networkDispatcher = networkDispatcher
+		e.wg.Add(1)
+		go func() { // S/R-SAFE: The endpoint isn't savable.
+			defer e.wg.Done()
+			if err := e.dispatchLoop(); err != nil && e.closed != nil {
+				e.closed(err)
+			}
+		}()
+	}
+}
+
+// IsAttached implements stack.LinkEndpoint.IsAttached.
+func (e *endpoint) IsAttached() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.networkDispatcher != nil
+}
+
+// MTU implements stack.LinkEndpoint.MTU.
+func (e *endpoint) MTU() uint32 {
+	return e.mtu
+}
+
+// SetMTU implements stack.LinkEndpoint.SetMTU. It has no impact, since the
+// buffers shared with the backend are sized for the MTU given at creation.
+func (*endpoint) SetMTU(uint32) {}
+
+// Capabilities implements stack.LinkEndpoint.Capabilities.
+func (e *endpoint) Capabilities() stack.LinkEndpointCapabilities {
+	return e.caps
+}
+
+// MaxHeaderLength returns the maximum size of the link-layer header.
+func (*endpoint) MaxHeaderLength() uint16 {
+	return uint16(header.EthernetMinimumSize)
+}
+
+// LinkAddress returns the link address of this endpoint.
+func (e *endpoint) LinkAddress() tcpip.LinkAddress {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.addr
+}
+
+// SetLinkAddress implements stack.LinkEndpoint.SetLinkAddress.
+func (e *endpoint) SetLinkAddress(addr tcpip.LinkAddress) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.addr = addr
+}
+
+// Wait implements stack.LinkEndpoint.Wait. It waits for the endpoint to stop
+// receiving packets.
+func (e *endpoint) Wait() {
+	e.wg.Wait()
+}
+
+// AddHeader implements stack.LinkEndpoint.AddHeader.
+func (*endpoint) AddHeader(pkt *stack.PacketBuffer) {
+	eth := header.Ethernet(pkt.LinkHeader().Push(header.EthernetMinimumSize))
+	eth.Encode(&header.EthernetFields{
+		SrcAddr: pkt.EgressRoute.LocalLinkAddress,
+		DstAddr: pkt.EgressRoute.RemoteLinkAddress,
+		Type:    pkt.NetworkProtocolNumber,
+	})
+}
+
+// ParseHeader implements stack.LinkEndpoint.ParseHeader.
+func (*endpoint) ParseHeader(pkt *stack.PacketBuffer) bool {
+	_, ok := pkt.LinkHeader().Consume(header.EthernetMinimumSize)
+	return ok
+}
+
+// ARPHardwareType implements stack.LinkEndpoint.ARPHardwareType.
+func (*endpoint) ARPHardwareType() header.ARPHardwareType {
+	return header.ARPHardwareEther
+}
+
+// WritePackets copies outbound packets to the buffers of the transmit
+// virtqueue and notifies the backend. Packets that don't fit in the free
+// buffers aren't written.
+//
+// Each packet in pkts should have the following fields populated:
+//   - pkt.EgressRoute
+//   - pkt.NetworkProtocolNumber
+//
+// GSO isn't supported, so pkt.GSOOptions should not be populated.
+func (e *endpoint) WritePackets(pkts stack.PacketBufferList) (int, tcpip.Error) {
+	e.txMu.Lock()
+	defer e.txMu.Unlock()
+	if e.mem == nil {
+		return 0, &tcpip.ErrClosedForSend{}
+	}
+
+	// Reclaim the buffers the backend is done with.
+	for {
+		id, _, ok := e.tx.pop()
+		if !ok {
+			break
+		}
+		e.tx.free = append(e.tx.free, id)
+	}
+
+	written := 0
+	var err tcpip.Error
+	for _, pkt := range pkts.AsSlice() {
+		if len(e.tx.free) == 0 {
+			err = &tcpip.ErrNoBufferSpace{}
+			break
+		}
+		size := virtioNetHdrSize + pkt.Size()
+		if size > bufSize {
+			err = &tcpip.ErrMessageTooLong{}
+			break
+		}
+		id := e.tx.free[len(e.tx.free)-1]
+		e.tx.free = e.tx.free[:len(e.tx.free)-1]
+		buf := e.tx.buffer(id)
+		// No offloads are negotiated, so the virtio-net header is
+		// zeroed.
+		clear(buf[:virtioNetHdrSize])
+		off := virtioNetHdrSize
+		for _, s := range pkt.AsSlices() {
+			off += copy(buf[off:], s)
+		}
+		e.tx.push(id, uint32(size), 0 /* flags */)
+		written++
+	}
+	if written > 0 {
+		e.tx.publish()
+		if e.tx.needsKick() {
+			if err := e.txKick.Notify(); err != nil {
+				return written, &tcpip.ErrClosedForSend{}
+			}
+		}
+		return written, nil
+	}
+	return 0, err
+}
+
+// dispatchLoop delivers the packets received from the backend until the
+// endpoint is stopped.
+func (e *endpoint) dispatchLoop() tcpip.Error {
+	for {
+		stopped, errno := rawfile.BlockingPollUntilStopped(e.stopFD.EFD, e.rxCall.FD(), unix.POLLIN)
+		if errno != 0 {
+			if errno == unix.EINTR {
+				continue
+			}
+			return tcpip.TranslateErrno(errno)
+		}
+		if stopped {
+			return nil
+		}
+		// Consume the notification before checking the used ring, so
+		// that buffers used afterwards are notified again.
+		if _, err := e.rxCall.Read(); err != nil {
+			return &tcpip.ErrClosedForReceive{}
+		}
+		e.deliverPackets()
+	}
+}
+
+// deliverPackets delivers the packets in the used buffers of the receive
+// virtqueue and makes the buffers available to the backend again.
+func (e *endpoint) deliverPackets() {
+	e.mu.RLock()
+	d := e.networkDispatcher
+	e.mu.RUnlock()
+
+	n := 0
+	for {
+		id, size, ok := e.rx.pop()
+		if !ok {
+			break
+		}
+		if d != nil && size >= virtioNetHdrSize+header.EthernetMinimumSize {
+			data := e.rx.buffer(id)[virtioNetHdrSize:size]
+			netProto := header.Ethernet(data).Type()
+			view := buffer.NewView(len(data))
+			view.Write(data)
+			pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+				Payload: buffer.MakeWithView(view),
+			})
+			if e.ParseHeader(pkt) {
+				d.DeliverNetworkPacket(netProto, pkt)
+			}
+			pkt.DecRef()
+		}
+		e.rx.push(id, bufSize, descFlagWrite)
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	e.rx.publish()
+	if e.rx.needsKick() {
+		e.rxKick.Notify()
+	}
+}
+
+// Close implements stack.LinkEndpoint.Close. It releases the memory shared
+// with the backend, which stops using it once the socket is closed.
+func (e *endpoint) Close() {
+	e.Attach(nil)
+	e.txMu.Lock()
+	defer e.txMu.Unlock()
+	e.release()
+}
+
+// SetOnCloseAction implements stack.LinkEndpoint.SetOnCloseAction.
+func (*endpoint) SetOnCloseAction(func()) {}
@@ -0,0 +1,282 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package vhostuser
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"github.com/wilinz/gvisor/pkg/buffer"
+	"github.com/wilinz/gvisor/pkg/hostarch"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/header"
+	"github.com/wilinz/gvisor/pkg/tcpip/stack"
+)
+
+// testVring is the state of a vring set up by the frontend.
+type testVring struct {
+	num                    uint32
+	desc, used, avail      uint64
+	kickFD, callFD         int
+	enabled                bool
+	lastAvail, nextUsedIdx uint16
+}
+
+// testBackend is a minimal vhost-user backend, acting as a virtio-net device.
+type testBackend struct {
+	fd       int
+	features uint64
+	region   memoryRegion
+	mem      []byte
+	vrings   [2]testVring
+}
+
+// serve handles requests until both vrings are enabled.
+func (b *testBackend) serve() error {
+	for !b.vrings[rxQueueIndex].enabled || !b.vrings[txQueueIndex].enabled {
+		buf := make([]byte, 256)
+		oob := make([]byte, unix.CmsgSpace(4))
+		n, oobn, _, _, err := unix.Recvmsg(b.fd, buf, oob, 0)
+		if err != nil {
+			return err
+		}
+		if n < msgHeaderSize {
+			return fmt.Errorf("short message of %d bytes", n)
+		}
+		req := hostarch.ByteOrder.Uint32(buf[0:])
+		payload := buf[msgHeaderSize:n]
+		var fd = -1
+		if oobn > 0 {
+			msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+			if err != nil {
+				return err
+			}
+			fds, err := unix.ParseUnixRights(&msgs[0])
+			if err != nil {
+				return err
+			}
+			fd = fds[0]
+		}
+		switch req {
+		case reqGetFeatures:
+			b.reply(req, featureVersion1|featureProtocolFeatures)
+		case reqGetProtocolFeatures:
+			b.reply(req, 0)
+		case reqSetFeatures:
+			b.features = hostarch.ByteOrder.Uint64(payload)
+		case reqSetOwner, reqSetProtocolFeatures:
+		case reqSetMemTable:
+			b.region = memoryRegion{
+				guestPhysAddr: hostarch.ByteOrder.Uint64(payload[8:]),
+				size:          hostarch.ByteOrder.Uint64(payload[16:]),
+				userAddr:      hostarch.ByteOrder.Uint64(payload[24:]),
+				mmapOffset:    hostarch.ByteOrder.Uint64(payload[32:]),
+			}
+			b.mem, err = unix.Mmap(fd, int64(b.region.mmapOffset), int(b.region.size), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+			if err != nil {
+				return err
+			}
+			unix.Close(fd)
+		case reqSetVringNum:
+			b.vrings[hostarch.ByteOrder.Uint32(payload)].num = hostarch.ByteOrder.Uint32(payload[4:])
+		case reqSetVringBase:
+		case reqSetVringAddr:
+			v := &b.vrings[hostarch.ByteOrder.Uint32(payload)]
+			v.desc = hostarch.ByteOrder.Uint64(payload[8:])
+			v.used = hostarch.ByteOrder.Uint64(payload[16:])
+			v.avail = hostarch.ByteOrder.Uint64(payload[24:])
+		case reqSetVringKick:
+			b.vrings[hostarch.ByteOrder.Uint64(payload)].kickFD = fd
+		case reqSetVringCall:
+			b.vrings[hostarch.ByteOrder.Uint64(payload)].callFD = fd
+		case reqSetVringEnable:
+			b.vrings[hostarch.ByteOrder.Uint32(payload)].enabled = hostarch.ByteOrder.Uint32(payload[4:]) == 1
+		default:
+			return fmt.Errorf("unexpected request %d", req)
+		}
+	}
+	return nil
+}
+
+func (b *testBackend) reply(req uint32, v uint64) {
+	var msg [msgHeaderSize + 8]byte
+	hostarch.ByteOrder.PutUint32(msg[0:], req)
+	hostarch.ByteOrder.PutUint32(msg[4:], msgVersion|msgFlagReply)
+	hostarch.ByteOrder.PutUint32(msg[8:], 8)
+	hostarch.ByteOrder.PutUint64(msg[12:], v)
+	unix.Write(b.fd, msg[:])
+}
+
+// slice returns the shared memory at the frontend address addr.
+func (b *testBackend) slice(addr uint64, n int) []byte {
+	off := addr - b.region.userAddr
+	return b.mem[off : off+uint64(n)]
+}
+
+// buffer returns the shared memory at the guest physical address addr.
+func (b *testBackend) buffer(addr uint64, n uint32) []byte {
+	off := addr - b.region.guestPhysAddr
+	return b.mem[off : off+uint64(n)]
+}
+
+// popAvail returns the next available descriptor of the vring.
+func (b *testBackend) popAvail(v *testVring) (uint16, virtqDesc, bool) {
+	avail := b.slice(v.avail, ringHeaderSize+2*int(v.num))
+	if hostarch.ByteOrder.Uint16(avail[2:]) == v.lastAvail {
+		return 0, virtqDesc{}, false
+	}
+	id := hostarch.ByteOrder.Uint16(avail[ringHeaderSize+2*int(v.lastAvail%uint16(v.num)):])
+	v.lastAvail++
+	d := b.slice(v.desc+uint64(id)*descSize, descSize)
+	return id, virtqDesc{
+		addr:  hostarch.ByteOrder.Uint64(d[0:]),
+		len:   hostarch.ByteOrder.Uint32(d[8:]),
+		flags: hostarch.ByteOrder.Uint16(d[12:]),
+	}, true
+}
+
+// pushUsed marks descriptor id of the vring used, with n bytes written.
+func (b *testBackend) pushUsed(v *testVring, id uint16, n uint32) {
+	used := b.slice(v.used, ringHeaderSize+usedElemSize*int(v.num))
+	e := used[ringHeaderSize+usedElemSize*int(v.nextUsedIdx%uint16(v.num)):]
+	hostarch.ByteOrder.PutUint32(e[0:], uint32(id))
+	hostarch.ByteOrder.PutUint32(e[4:], n)
+	v.nextUsedIdx++
+	hostarch.ByteOrder.PutUint16(used[2:], v.nextUsedIdx)
+}
+
+type testDispatcher struct {
+	pkts chan []byte
+}
+
+func (d *testDispatcher) DeliverNetworkPacket(protocol tcpip.NetworkProtocolNumber, pkt *stack.PacketBuffer) {
+	if protocol != header.IPv4ProtocolNumber {
+		return
+	}
+	d.pkts <- pkt.Data().AsRange().ToSlice()
+}
+
+func (*testDispatcher) DeliverLinkPacket(tcpip.NetworkProtocolNumber, *stack.PacketBuffer) {}
+
+func waitEventfd(t *testing.T, fd int) {
+	t.Helper()
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+	if n, err := unix.Poll(fds, 5000); err != nil || n != 1 {
+		t.Fatalf("eventfd wasn't notified: %d, %v", n, err)
+	}
+	var buf [8]byte
+	unix.Read(fd, buf[:])
+}
+
+func TestEndpoint(t *testing.T) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatalf("Socketpair: %v", err)
+	}
+	defer unix.Close(fds[0])
+	defer unix.Close(fds[1])
+
+	b := &testBackend{fd: fds[1]}
+	errCh := make(chan error, 1)
+	go func() { errCh <- b.serve() }()
+
+	linkAddr := tcpip.LinkAddress("\x02\x02\x03\x04\x05\x06")
+	ep, err := New(&Options{FD: fds[0], Address: linkAddr})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer ep.Close()
+	if err := <-errCh; err != nil {
+		t.Fatalf("backend: %v", err)
+	}
+	if got, want := b.features, uint64(featureVersion1|featureProtocolFeatures); got != want {
+		t.Errorf("got features %#x, want %#x", got, want)
+	}
+	for i := range b.vrings {
+		if got, want := b.vrings[i].num, uint32(DefaultQueueSize); got != want {
+			t.Errorf("got vring %d size %d, want %d", i, got, want)
+		}
+	}
+	// Receive buffers are made available during setup.
+	rx, tx := &b.vrings[rxQueueIndex], &b.vrings[txQueueIndex]
+	waitEventfd(t, rx.kickFD)
+
+	// Transmit a frame.
+	frame := make([]byte, header.EthernetMinimumSize+4)
+	header.Ethernet(frame).Encode(&header.EthernetFields{
+		SrcAddr: linkAddr,
+		DstAddr: "\x02\x0a\x0b\x0c\x0d\x0e",
+		Type:    header.IPv4ProtocolNumber,
+	})
+	copy(frame[header.EthernetMinimumSize:], "ping")
+	var pkts stack.PacketBufferList
+	pkts.PushBack(stack.NewPacketBuffer(stack.PacketBufferOptions{
+		Payload: buffer.MakeWithData(frame),
+	}))
+	n, tcpipErr := ep.WritePackets(pkts)
+	pkts.Reset()
+	if n != 1 || tcpipErr != nil {
+		t.Fatalf("WritePackets(_) = %d, %v, want 1, nil", n, tcpipErr)
+	}
+	waitEventfd(t, tx.kickFD)
+	id, desc, ok := b.popAvail(tx)
+	if !ok {
+		t.Fatalf("no transmit buffer is available")
+	}
+	if got, want := b.buffer(desc.addr, desc.len), append(make([]byte, virtioNetHdrSize), frame...); !bytes.Equal(got, want) {
+		t.Errorf("got transmitted buffer %x, want %x", got, want)
+	}
+	b.pushUsed(tx, id, 0)
+
+	// Receive a frame.
+	d := &testDispatcher{pkts: make(chan []byte, 1)}
+	ep.Attach(d)
+	id, desc, ok = b.popAvail(rx)
+	if !ok {
+		t.Fatalf("no receive buffer is available")
+	}
+	if desc.flags&descFlagWrite == 0 || desc.len != bufSize {
+		t.Fatalf("got receive descriptor %+v, want a writable buffer of %d bytes", desc, bufSize)
+	}
+	copy(frame[header.EthernetMinimumSize:], "pong")
+	buf := b.buffer(desc.addr, desc.len)
+	clear(buf[:virtioNetHdrSize])
+	copy(buf[virtioNetHdrSize:], frame)
+	b.pushUsed(rx, id, uint32(virtioNetHdrSize+len(frame)))
+	var one [8]byte
+	hostarch.ByteOrder.PutUint64(one[:], 1)
+	unix.Write(rx.callFD, one[:])
+	select {
+	case got := <-d.pkts:
+		if want := []byte("pong"); !bytes.Equal(got, want) {
+			t.Errorf("got received packet %q, want %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the received packet")
+	}
+
+	// The receive buffer is made available again.
+	waitEventfd(t, rx.kickFD)
+	avail := b.slice(rx.avail, ringHeaderSize)
+	if got, want := hostarch.ByteOrder.Uint16(avail[2:]), uint16(DefaultQueueSize+1); got != want {
+		t.Errorf("got receive available index %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package vhostuser
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+	"github.com/wilinz/gvisor/pkg/hostarch"
+)
+
+// Vhost-user requests sent by the frontend. See the vhost-user protocol
+// specification in QEMU's docs/interop/vhost-user.rst.
+const (
+	reqGetFeatures         = 1
+	reqSetFeatures         = 2
+	reqSetOwner            = 3
+	reqSetMemTable         = 5
+	reqSetVringNum         = 8
+	reqSetVringAddr        = 9
+	reqSetVringBase        = 10
+	reqSetVringKick        = 12
+	reqSetVringCall        = 13
+	reqGetProtocolFeatures = 15
+	reqSetProtocolFeatures = 16
+	reqSetVringEnable      = 18
+)
+
+const (
+	// msgHeaderSize is the size of the header of vhost-user messages: the
+	// request, flags and payload size, each a 32-bit integer.
+	msgHeaderSize = 12
+
+	// msgVersion is the version of the protocol, set in the flags of every
+	// message.
+	msgVersion = 0x1
+
+	// msgFlagReply is set in the flags of replies.
+	msgFlagReply = 0x4
+
+	// maxReplySize bounds the payload of replies. The frontend only
+	// requests 64-bit values.
+	maxReplySize = 8
+)
+
+// Feature bits negotiated with the backend.
+const (
+	// featureProtocolFeatures is VHOST_USER_F_PROTOCOL_FEATURES. When it
+	// is negotiated, rings start disabled and must be enabled with
+	// VHOST_USER_SET_VRING_ENABLE.
+	featureProtocolFeatures = 1 << 30
+
+	// featureVersion1 is VIRTIO_F_VERSION_1. It is required, so that the
+	// virtio-net header always has the same size and rings are
+	// little-endian.
+	featureVersion1 = 1 << 32
+)
+
+// memoryRegion is a region of the frontend's memory shared with the backend,
+// as described in VHOST_USER_SET_MEM_TABLE messages.
+type memoryRegion struct {
+	guestPhysAddr uint64
+	size          uint64
+	userAddr      uint64
+	mmapOffset    uint64
+}
+
+// frontend sends vhost-user requests to a backend over a connected Unix
+// domain socket.
+type frontend struct {
+	fd int
+}
+
+// send sends a request with the given payload. fds are passed to the backend
+// with SCM_RIGHTS.
+func (f *frontend) send(req uint32, payload []byte, fds ...int) error {
+	msg := make([]byte, msgHeaderSize+len(payload))
+	hostarch.ByteOrder.PutUint32(msg[0:], req)
+	hostarch.ByteOrder.PutUint32(msg[4:], msgVersion)
+	hostarch.ByteOrder.PutUint32(msg[8:], uint32(len(payload)))
+	copy(msg[msgHeaderSize:], payload)
+	var oob []byte
+	if len(fds) > 0 {
+		oob = unix.UnixRights(fds...)
+	}
+	for {
+		n, err := unix.SendmsgN(f.fd, msg, oob, nil, unix.MSG_NOSIGNAL)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("sending vhost-user request %d: %w", req, err)
+		}
+		if n != len(msg) {
+			return fmt.Errorf("sending vhost-user request %d: short write of %d bytes, want %d", req, n, len(msg))
+		}
+		return nil
+	}
+}
+
+// recv receives the reply to req.
+func (f *frontend) recv(req uint32) ([]byte, error) {
+	var hdr [msgHeaderSize]byte
+	if err := f.readFull(hdr[:]); err != nil {
+		return nil, fmt.Errorf("receiving reply to vhost-user request %d: %w", req, err)
+	}
+	gotReq := hostarch.ByteOrder.Uint32(hdr[0:])
+	flags := hostarch.ByteOrder.Uint32(hdr[4:])
+	size := hostarch.ByteOrder.Uint32(hdr[8:])
+	if gotReq != req || flags&msgFlagReply == 0 {
+		return nil, fmt.Errorf("got vhost-user message %d with flags %#x, want reply to request %d", gotReq, flags, req)
+	}
+	if size > maxReplySize {
+		return nil, fmt.Errorf("reply to vhost-user request %d has %d bytes, want at most %d", req, size, maxReplySize)
+	}
+	payload := make([]byte, size)
+	if err := f.readFull(payload); err != nil {
+		return nil, fmt.Errorf("receiving reply to vhost-user request %d: %w", req, err)
+	}
+	return payload, nil
+}
+
+func (f *frontend) readFull(b []byte) error {
+	for len(b) > 0 {
+		n, err := unix.Read(f.fd, b)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("backend closed the connection")
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// getU64 sends req and returns the 64-bit value of its reply.
+func (f *frontend) getU64(req uint32) (uint64, error) {
+	if err := f.send(req, nil); err != nil {
+		return 0, err
+	}
+	payload, err := f.recv(req)
+	if err != nil {
+		return 0, err
+	}
+	if len(payload) != 8 {
+		return 0, fmt.Errorf("reply to vhost-user request %d has %d bytes, want 8", req, len(payload))
+	}
+	return hostarch.ByteOrder.Uint64(payload), nil
+}
+
+// setU64 sends req with a 64-bit value.
+func (f *frontend) setU64(req uint32, v uint64, fds ...int) error {
+	var payload [8]byte
+	hostarch.ByteOrder.PutUint64(payload[:], v)
+	return f.send(req, payload[:], fds...)
+}
+
+// setVringState sends req with a vring state: the index of a vring and a
+// value, like its size or base.
+func (f *frontend) setVringState(req uint32, index, num uint32) error {
+	var payload [8]byte
+	hostarch.ByteOrder.PutUint32(payload[0:], index)
+	hostarch.ByteOrder.PutUint32(payload[4:], num)
+	return f.send(req, payload[:])
+}
+
+// setVringAddr sends VHOST_USER_SET_VRING_ADDR. The addresses are in the
+// frontend's address space.
+func (f *frontend) setVringAddr(index uint32, desc, used, avail uint64) error {
+	var payload [40]byte
+	hostarch.ByteOrder.PutUint32(payload[0:], index)
+	hostarch.ByteOrder.PutUint32(payload[4:], 0 /* flags */)
+	hostarch.ByteOrder.PutUint64(payload[8:], desc)
+	hostarch.ByteOrder.PutUint64(payload[16:], used)
+	hostarch.ByteOrder.PutUint64(payload[24:], avail)
+	hostarch.ByteOrder.PutUint64(payload[32:], 0 /* log */)
+	return f.send(reqSetVringAddr, payload[:])
+}
+
+// setVringFD sends VHOST_USER_SET_VRING_KICK or VHOST_USER_SET_VRING_CALL
+// with an eventfd for the vring.
+func (f *frontend) setVringFD(req uint32, index uint32, fd int) error {
+	return f.setU64(req, uint64(index), fd)
+}
+
+// setMemTable sends VHOST_USER_SET_MEM_TABLE with a single region backed by
+// fd.
+func (f *frontend) setMemTable(r memoryRegion, fd int) error {
+	var payload [40]byte
+	hostarch.ByteOrder.PutUint32(payload[0:], 1 /* nregions */)
+	hostarch.ByteOrder.PutUint64(payload[8:], r.guestPhysAddr)
+	hostarch.ByteOrder.PutUint64(payload[16:], r.size)
+	hostarch.ByteOrder.PutUint64(payload[24:], r.userAddr)
+	hostarch.ByteOrder.PutUint64(payload[32:], r.mmapOffset)
+	return f.send(reqSetMemTable, payload[:], fd)
+}
+
+// negotiateFeatures takes ownership of the backend and negotiates the
+// features the endpoint requires. It returns whether rings must be enabled
+// explicitly.
+func (f *frontend) negotiateFeatures() (bool, error) {
+	features, err := f.getU64(reqGetFeatures)
+	if err != nil {
+		return false, err
+	}
+	if features&featureVersion1 == 0 {
+		return false, fmt.Errorf("vhost-user backend doesn't offer VIRTIO_F_VERSION_1 (features %#x)", features)
+	}
+	want := uint64(featureVersion1)
+	protocolFeatures := features&featureProtocolFeatures != 0
+	if protocolFeatures {
+		want |= featureProtocolFeatures
+		// None of the protocol features are needed, but the backend
+		// expects the frontend to acknowledge them.
+		if _, err := f.getU64(reqGetProtocolFeatures); err != nil {
+			return false, err
+		}
+		if err := f.setU64(reqSetProtocolFeatures, 0); err != nil {
+			return false, err
+		}
+	}
+	if err := f.send(reqSetOwner, nil); err != nil {
+		return false, err
+	}
+	if err := f.setU64(reqSetFeatures, want); err != nil {
+		return false, err
+	}
+	return protocolFeatures, nil
+}
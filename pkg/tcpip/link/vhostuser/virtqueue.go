@@ -0,0 +1,187 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package vhostuser
+
+import (
+	"github.com/wilinz/gvisor/pkg/atomicbitops"
+	"github.com/wilinz/gvisor/pkg/hostarch"
+)
+
+// Flags of virtqueue descriptors and rings, from the virtio specification.
+const (
+	// descFlagWrite marks buffers that are written by the device.
+	descFlagWrite = 2
+
+	// availFlagNoInterrupt asks the device not to notify the driver when
+	// it uses buffers.
+	availFlagNoInterrupt = 1
+
+	// usedFlagNoNotify tells the driver that the device doesn't need to be
+	// notified when buffers are made available.
+	usedFlagNoNotify = 1
+)
+
+const (
+	descSize     = 16
+	usedElemSize = 8
+
+	// ringHeaderSize is the size of the flags and index at the start of
+	// the available and used rings.
+	ringHeaderSize = 4
+
+	// ringEventSize is the size of the event index at the end of the
+	// available and used rings. It is only used with
+	// VIRTIO_F_EVENT_IDX, but space is reserved for it regardless.
+	ringEventSize = 2
+)
+
+// virtqDesc is struct virtq_desc.
+type virtqDesc struct {
+	addr  uint64
+	len   uint32
+	flags uint16
+	next  uint16
+}
+
+// virtqUsedElem is struct virtq_used_elem.
+type virtqUsedElem struct {
+	id  uint32
+	len uint32
+}
+
+// virtqueueLayout is the layout of a split virtqueue and its buffers in
+// shared memory. Each descriptor always points to the same buffer. Offsets
+// are relative to the start of the virtqueue.
+type virtqueueLayout struct {
+	// size is the number of descriptors. It is a power of 2.
+	size uint16
+
+	// bufSize is the size of each buffer.
+	bufSize uint32
+
+	descOff  uint64
+	availOff uint64
+	usedOff  uint64
+	bufOff   uint64
+
+	// total is the size of the virtqueue and its buffers. It is a
+	// multiple of the page size.
+	total uint64
+}
+
+func newVirtqueueLayout(size uint16, bufSize uint32) virtqueueLayout {
+	l := virtqueueLayout{
+		size:    size,
+		bufSize: bufSize,
+	}
+	n := uint64(size)
+	l.availOff = l.descOff + descSize*n
+	l.usedOff = hostarch.MustPageRoundUp(l.availOff + ringHeaderSize + 2*n + ringEventSize)
+	l.bufOff = hostarch.MustPageRoundUp(l.usedOff + ringHeaderSize + usedElemSize*n + ringEventSize)
+	l.total = hostarch.MustPageRoundUp(l.bufOff + uint64(bufSize)*n)
+	return l
+}
+
+// virtqueue is the driver side of a split virtqueue. It is not thread-safe.
+type virtqueue struct {
+	virtqueueLayout
+
+	// mem is the memory of the virtqueue and its buffers, shared with the
+	// device.
+	mem []byte
+
+	// addr is the address of mem in the memory region shared with the
+	// device.
+	addr uint64
+
+	// desc is the descriptor table.
+	desc []virtqDesc
+
+	// avail points to the flags and index of the available ring, which
+	// are only written by the driver. The flags are in the low 16 bits
+	// and the index in the high 16 bits.
+	avail *atomicbitops.Uint32
+
+	// availRing holds the available ring entries.
+	availRing []uint16
+
+	// used points to the flags and index of the used ring, which are only
+	// written by the device.
+	used *atomicbitops.Uint32
+
+	// usedRing holds the used ring entries.
+	usedRing []virtqUsedElem
+
+	// availFlags are the flags of the available ring.
+	availFlags uint16
+
+	// availIdx is the index of the next available ring entry.
+	availIdx uint16
+
+	// lastUsedIdx is the index of the next used ring entry to consume.
+	lastUsedIdx uint16
+
+	// free holds the descriptors that are neither available nor used. It
+	// is only used for queues whose buffers are written by the driver.
+	free []uint16
+}
+
+// buffer returns the buffer of descriptor id.
+func (q *virtqueue) buffer(id uint16) []byte {
+	off := q.bufOff + uint64(id)*uint64(q.bufSize)
+	return q.mem[off : off+uint64(q.bufSize)]
+}
+
+// push makes the first n bytes of the buffer of descriptor id available to
+// the device. It is only visible to the device once published.
+func (q *virtqueue) push(id uint16, n uint32, flags uint16) {
+	q.desc[id] = virtqDesc{
+		addr:  q.addr + q.bufOff + uint64(id)*uint64(q.bufSize),
+		len:   n,
+		flags: flags,
+	}
+	q.availRing[q.availIdx&(q.size-1)] = id
+	q.availIdx++
+}
+
+// publish makes pushed buffers visible to the device.
+func (q *virtqueue) publish() {
+	q.avail.Store(uint32(q.availFlags) | uint32(q.availIdx)<<16)
+}
+
+// needsKick returns whether the device must be notified of published
+// buffers.
+func (q *virtqueue) needsKick() bool {
+	return q.used.Load()&usedFlagNoNotify == 0
+}
+
+// pop returns the next buffer used by the device and the number of bytes
+// the device wrote to it. ok is false if there is none. Entries with an
+// invalid descriptor are skipped, since the device isn't trusted.
+func (q *virtqueue) pop() (id uint16, n uint32, ok bool) {
+	usedIdx := uint16(q.used.Load() >> 16)
+	for q.lastUsedIdx != usedIdx {
+		e := q.usedRing[q.lastUsedIdx&(q.size-1)]
+		q.lastUsedIdx++
+		if e.id >= uint32(q.size) {
+			continue
+		}
+		return uint16(e.id), min(e.len, q.bufSize), true
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,43 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package vhostuser
+
+import (
+	"unsafe"
+
+	"github.com/wilinz/gvisor/pkg/atomicbitops"
+)
+
+// init initializes q to use mem, which is at addr in the memory region shared
+// with the device and is l.total bytes long.
+func (q *virtqueue) init(mem []byte, addr uint64, l virtqueueLayout) {
+	q.virtqueueLayout = l
+	q.mem = mem
+	q.addr = addr
+	n := int(l.size)
+	q.desc = unsafe.Slice((*virtqDesc)(unsafe.Pointer(&mem[l.descOff])), n)
+	q.avail = (*atomicbitops.Uint32)(unsafe.Pointer(&mem[l.availOff]))
+	q.availRing = unsafe.Slice((*uint16)(unsafe.Pointer(&mem[l.availOff+ringHeaderSize])), n)
+	q.used = (*atomicbitops.Uint32)(unsafe.Pointer(&mem[l.usedOff]))
+	q.usedRing = unsafe.Slice((*virtqUsedElem)(unsafe.Pointer(&mem[l.usedOff+ringHeaderSize])), n)
+}
+
+// memAddr returns the address of b in the frontend's address space.
+func memAddr(b []byte) uint64 {
+	return uint64(uintptr(unsafe.Pointer(&b[0])))
+}
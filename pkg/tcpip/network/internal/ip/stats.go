@@ -171,6 +171,10 @@ type MultiCounterIPStats struct {
 	// the Postrouting chain.
 	IPTablesPostroutingDropped tcpip.MultiCounterStat
 
+	// NetworkPolicyDropped is the number of outgoing or forwarded IP
+	// packets dropped by the stack's network policy.
+	NetworkPolicyDropped tcpip.MultiCounterStat
+
 	// TODO(https://gvisor.dev/issues/5529): Move the IPv4-only option
 	// stats out of IPStats.
 
@@ -209,6 +213,7 @@ func (m *MultiCounterIPStats) Init(a, b *tcpip.IPStats) {
 	m.IPTablesForwardDropped.Init(a.IPTablesForwardDropped, b.IPTablesForwardDropped)
 	m.IPTablesOutputDropped.Init(a.IPTablesOutputDropped, b.IPTablesOutputDropped)
 	m.IPTablesPostroutingDropped.Init(a.IPTablesPostroutingDropped, b.IPTablesPostroutingDropped)
+	m.NetworkPolicyDropped.Init(a.NetworkPolicyDropped, b.NetworkPolicyDropped)
 	m.OptionTimestampReceived.Init(a.OptionTimestampReceived, b.OptionTimestampReceived)
 	m.OptionRecordRouteReceived.Init(a.OptionRecordRouteReceived, b.OptionRecordRouteReceived)
 	m.OptionRouterAlertReceived.Init(a.OptionRouterAlertReceived, b.OptionRouterAlertReceived)
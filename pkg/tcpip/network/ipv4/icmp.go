@@ -227,6 +227,44 @@ func (*icmpv4FragmentationNeededSockError) Kind() stack.TransportErrorKind {
 	return stack.PacketTooBigTransportError
 }
 
+var _ stack.TransportError = (*icmpv4TimeExceededSockError)(nil)
+
+// icmpv4TimeExceededSockError is an ICMPv4 Time Exceeded error.
+//
+// It indicates that a packet was discarded before reaching its destination
+// because its TTL was exceeded (e.g. when probed by traceroute), or because it
+// could not be reassembled in time.
+//
+// +stateify savable
+type icmpv4TimeExceededSockError struct {
+	code header.ICMPv4Code
+}
+
+// Origin implements tcpip.SockErrorCause.
+func (*icmpv4TimeExceededSockError) Origin() tcpip.SockErrOrigin {
+	return tcpip.SockExtErrorOriginICMP
+}
+
+// Type implements tcpip.SockErrorCause.
+func (*icmpv4TimeExceededSockError) Type() uint8 {
+	return uint8(header.ICMPv4TimeExceeded)
+}
+
+// Code implements tcpip.SockErrorCause.
+func (e *icmpv4TimeExceededSockError) Code() uint8 {
+	return uint8(e.code)
+}
+
+// Info implements tcpip.SockErrorCause.
+func (*icmpv4TimeExceededSockError) Info() uint32 {
+	return 0
+}
+
+// Kind implements stack.TransportError.
+func (*icmpv4TimeExceededSockError) Kind() stack.TransportErrorKind {
+	return stack.TimeExceededTransportError
+}
+
 func (e *endpoint) checkLocalAddress(addr tcpip.Address) bool {
 	if e.nic.Spoofing() {
 		return true
@@ -272,6 +310,11 @@ func (e *endpoint) handleControl(errInfo stack.TransportError, pkt *stack.Packet
 	// Keep needed information before trimming header.
 	p := hdr.TransportProtocol()
 	dstAddr := hdr.DestinationAddress()
+	if fragNeeded, ok := errInfo.(*icmpv4FragmentationNeededSockError); ok && fragNeeded.mtu != 0 {
+		// Remember the path MTU, so that later connections to the
+		// destination don't need to learn it again.
+		e.protocol.stack.UpdatePathMTU(dstAddr, fragNeeded.mtu+header.IPv4MinimumSize)
+	}
 	// Skip the ip header, then deliver the error.
 	if _, ok := pkt.Data().Consume(hlen); !ok {
 		panic(fmt.Sprintf("could not consume the IP header of %d bytes", hlen))
@@ -502,6 +545,7 @@ func (e *endpoint) handleICMP(pkt *stack.PacketBuffer) {
 
 	case header.ICMPv4TimeExceeded:
 		received.timeExceeded.Increment()
+		e.handleControl(&icmpv4TimeExceededSockError{code: h.Code()}, pkt)
 
 	case header.ICMPv4ParamProblem:
 		received.paramProblem.Increment()
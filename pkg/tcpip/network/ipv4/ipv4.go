@@ -530,6 +530,12 @@ func (e *endpoint) writePacket(r *stack.Route, pkt *stack.PacketBuffer) tcpip.Er
 	netHeader := header.IPv4(pkt.NetworkHeader().Slice())
 	dstAddr := netHeader.DestinationAddress()
 
+	// The sandbox's network policy is enforced before iptables.
+	if ok := e.protocol.stack.CheckNetworkPolicy(r, pkt); !ok {
+		e.stats.ip.NetworkPolicyDropped.Increment()
+		return nil
+	}
+
 	// iptables filtering. All packets that reach here are locally
 	// generated.
 	outNicName := e.protocol.stack.FindNICNameFromID(e.nic.ID())
@@ -666,6 +672,11 @@ func (e *endpoint) WriteHeaderIncludedPacket(r *stack.Route, pkt *stack.PacketBu
 		return &tcpip.ErrMalformedHeader{}
 	}
 
+	if ok := e.protocol.stack.CheckNetworkPolicy(r, pkt); !ok {
+		e.stats.ip.NetworkPolicyDropped.Increment()
+		return nil
+	}
+
 	return e.writePacketPostRouting(r, pkt, true /* headerIncluded */)
 }
 
@@ -680,6 +691,11 @@ func (e *endpoint) forwardPacketWithRoute(route *stack.Route, pkt *stack.PacketB
 	h := header.IPv4(pkt.NetworkHeader().Slice())
 	stk := e.protocol.stack
 
+	if ok := stk.CheckNetworkPolicy(route, pkt); !ok {
+		e.stats.ip.NetworkPolicyDropped.Increment()
+		return nil
+	}
+
 	inNicName := stk.FindNICNameFromID(e.nic.ID())
 	outNicName := stk.FindNICNameFromID(route.NICID())
 	if ok := stk.IPTables().CheckForward(pkt, inNicName, outNicName); !ok {
@@ -1168,7 +1184,12 @@ func (e *endpoint) handleValidatedPacket(h header.IPv4, pkt *stack.PacketBuffer,
 	//
 	// If the packet is destined for this device, then it should be delivered
 	// locally. Otherwise, if forwarding is enabled, it should be forwarded.
-	if addressEndpoint := e.AcquireAssignedAddress(dstAddr, e.nic.Promiscuous(), stack.CanBePrimaryEndpoint, true /* readOnly */); addressEndpoint != nil {
+	//
+	// Packets redirected by a TPROXY target are delivered locally regardless
+	// of their destination.
+	if pkt.NetworkPacketInfo.TProxy.Port != 0 {
+		e.deliverPacketLocally(h, pkt, inNICName)
+	} else if addressEndpoint := e.AcquireAssignedAddress(dstAddr, e.nic.Promiscuous(), stack.CanBePrimaryEndpoint, true /* readOnly */); addressEndpoint != nil {
 		subnet := addressEndpoint.AddressWithPrefix().Subnet()
 		pkt.NetworkPacketInfo.LocalAddressBroadcast = subnet.IsBroadcast(dstAddr) || dstAddr == header.IPv4Broadcast
 		e.deliverPacketLocally(h, pkt, inNICName)
@@ -3512,6 +3512,125 @@ func TestWriteStats(t *testing.T) {
 	}
 }
 
+func TestNetworkPolicyWrite(t *testing.T) {
+	dstSubnet := func(prefixLen int) tcpip.Subnet {
+		return tcpip.AddressWithPrefix{
+			Address:   tcpip.AddrFromSlice([]byte("\x10\x00\x00\x02")),
+			PrefixLen: prefixLen,
+		}.Subnet()
+	}
+
+	tests := []struct {
+		name          string
+		policy        *stack.NetworkPolicy
+		dstPort       uint16
+		expectSent    int
+		expectDropped int
+	}{
+		{
+			name:       "No policy",
+			dstPort:    80,
+			expectSent: 1,
+		}, {
+			name: "Deny subnet",
+			policy: &stack.NetworkPolicy{
+				Egress: []stack.NetworkPolicyRule{
+					{Action: stack.NetworkPolicyDeny, Destination: dstSubnet(8)},
+				},
+			},
+			dstPort:       80,
+			expectDropped: 1,
+		}, {
+			name: "Default deny",
+			policy: &stack.NetworkPolicy{
+				DefaultEgress: stack.NetworkPolicyDeny,
+			},
+			dstPort:       80,
+			expectDropped: 1,
+		}, {
+			name: "Allow matching port",
+			policy: &stack.NetworkPolicy{
+				Egress: []stack.NetworkPolicyRule{
+					{
+						Action:      stack.NetworkPolicyAllow,
+						Destination: dstSubnet(32),
+						Protocol:    header.UDPProtocolNumber,
+						StartPort:   53,
+						EndPort:     53,
+					},
+				},
+				DefaultEgress: stack.NetworkPolicyDeny,
+			},
+			dstPort:    53,
+			expectSent: 1,
+		}, {
+			name: "Deny non-matching port",
+			policy: &stack.NetworkPolicy{
+				Egress: []stack.NetworkPolicyRule{
+					{
+						Action:      stack.NetworkPolicyAllow,
+						Destination: dstSubnet(32),
+						Protocol:    header.UDPProtocolNumber,
+						StartPort:   53,
+						EndPort:     53,
+					},
+				},
+				DefaultEgress: stack.NetworkPolicyDeny,
+			},
+			dstPort:       80,
+			expectDropped: 1,
+		}, {
+			name: "Deny other protocol",
+			policy: &stack.NetworkPolicy{
+				Egress: []stack.NetworkPolicyRule{
+					{Action: stack.NetworkPolicyDeny, Destination: dstSubnet(8), Protocol: header.TCPProtocolNumber},
+				},
+			},
+			dstPort:    80,
+			expectSent: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := newTestContext()
+			defer ctx.cleanup()
+
+			ep := iptestutil.NewMockLinkEndpoint(header.IPv4MinimumMTU, &tcpip.ErrInvalidEndpointState{}, math.MaxInt32)
+			defer ep.Close()
+			rt := buildRoute(t, ctx, ep)
+			defer rt.Release()
+
+			if err := rt.Stack().SetNetworkPolicy(test.policy); err != nil {
+				t.Fatalf("SetNetworkPolicy(%+v): %s", test.policy, err)
+			}
+
+			pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+				ReserveHeaderBytes: header.UDPMinimumSize + int(rt.MaxHeaderLength()),
+				Payload:            buffer.Buffer{},
+			})
+			defer pkt.DecRef()
+			udp := header.UDP(pkt.TransportHeader().Push(header.UDPMinimumSize))
+			udp.Encode(&header.UDPFields{
+				SrcPort: 1234,
+				DstPort: test.dstPort,
+				Length:  header.UDPMinimumSize,
+			})
+			pkt.TransportProtocolNumber = header.UDPProtocolNumber
+			if err := rt.WritePacket(stack.NetworkHeaderParams{Protocol: header.UDPProtocolNumber, TTL: 64}, pkt); err != nil {
+				t.Fatalf("WritePacket(...): %s", err)
+			}
+
+			if got := int(rt.Stats().IP.PacketsSent.Value()); got != test.expectSent {
+				t.Errorf("got rt.Stats().IP.PacketsSent.Value() = %d, want = %d", got, test.expectSent)
+			}
+			if got := int(rt.Stats().IP.NetworkPolicyDropped.Value()); got != test.expectDropped {
+				t.Errorf("got rt.Stats().IP.NetworkPolicyDropped.Value() = %d, want = %d", got, test.expectDropped)
+			}
+		})
+	}
+}
+
 func buildRoute(t *testing.T, c testContext, ep stack.LinkEndpoint) *stack.Route {
 	s := c.s
 	if err := s.CreateNIC(1, ep); err != nil {
@@ -148,6 +148,44 @@ func (*icmpv6PacketTooBigSockError) Kind() stack.TransportErrorKind {
 	return stack.PacketTooBigTransportError
 }
 
+var _ stack.TransportError = (*icmpv6TimeExceededSockError)(nil)
+
+// icmpv6TimeExceededSockError is an ICMPv6 Time Exceeded error.
+//
+// It indicates that a packet was discarded before reaching its destination
+// because its hop limit was exceeded (e.g. when probed by traceroute), or
+// because it could not be reassembled in time.
+//
+// +stateify savable
+type icmpv6TimeExceededSockError struct {
+	code header.ICMPv6Code
+}
+
+// Origin implements tcpip.SockErrorCause.
+func (*icmpv6TimeExceededSockError) Origin() tcpip.SockErrOrigin {
+	return tcpip.SockExtErrorOriginICMP6
+}
+
+// Type implements tcpip.SockErrorCause.
+func (*icmpv6TimeExceededSockError) Type() uint8 {
+	return uint8(header.ICMPv6TimeExceeded)
+}
+
+// Code implements tcpip.SockErrorCause.
+func (e *icmpv6TimeExceededSockError) Code() uint8 {
+	return uint8(e.code)
+}
+
+// Info implements tcpip.SockErrorCause.
+func (*icmpv6TimeExceededSockError) Info() uint32 {
+	return 0
+}
+
+// Kind implements stack.TransportError.
+func (*icmpv6TimeExceededSockError) Kind() stack.TransportErrorKind {
+	return stack.TimeExceededTransportError
+}
+
 func (e *endpoint) checkLocalAddress(addr tcpip.Address) bool {
 	if e.nic.Spoofing() {
 		return true
@@ -184,6 +222,11 @@ func (e *endpoint) handleControl(transErr stack.TransportError, pkt *stack.Packe
 	// Keep needed information before trimming header.
 	p := hdr.TransportProtocol()
 	dstAddr := hdr.DestinationAddress()
+	if tooBig, ok := transErr.(*icmpv6PacketTooBigSockError); ok && tooBig.mtu != 0 {
+		// Remember the path MTU, so that later connections to the
+		// destination don't need to learn it again.
+		e.protocol.stack.UpdatePathMTU(dstAddr, tooBig.mtu+header.IPv6MinimumSize)
+	}
 
 	// Skip the IP header, then handle the fragmentation header if there
 	// is one.
@@ -337,6 +380,8 @@ func (e *endpoint) handleICMP(pkt *stack.PacketBuffer, hasFragmentHeader bool, r
 		switch h.Code() {
 		case header.ICMPv6NetworkUnreachable:
 			e.handleControl(&icmpv6DestinationNetworkUnreachableSockError{}, pkt)
+		case header.ICMPv6AddressUnreachable:
+			e.handleControl(&icmpv6DestinationAddressUnreachableSockError{}, pkt)
 		case header.ICMPv6PortUnreachable:
 			e.handleControl(&icmpv6DestinationPortUnreachableSockError{}, pkt)
 		}
@@ -714,6 +759,7 @@ func (e *endpoint) handleICMP(pkt *stack.PacketBuffer, hasFragmentHeader bool, r
 
 	case header.ICMPv6TimeExceeded:
 		received.timeExceeded.Increment()
+		e.handleControl(&icmpv6TimeExceededSockError{code: h.Code()}, pkt)
 
 	case header.ICMPv6ParamProblem:
 		received.paramProblem.Increment()
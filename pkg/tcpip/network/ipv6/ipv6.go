@@ -817,6 +817,12 @@ func (e *endpoint) WritePacket(r *stack.Route, params stack.NetworkHeaderParams,
 		return err
 	}
 
+	// The sandbox's network policy is enforced before iptables.
+	if ok := e.protocol.stack.CheckNetworkPolicy(r, pkt); !ok {
+		e.stats.ip.NetworkPolicyDropped.Increment()
+		return nil
+	}
+
 	// iptables filtering. All packets that reach here are locally
 	// generated.
 	outNicName := e.protocol.stack.FindNICNameFromID(e.nic.ID())
@@ -929,6 +935,11 @@ func (e *endpoint) WriteHeaderIncludedPacket(r *stack.Route, pkt *stack.PacketBu
 		return &tcpip.ErrMalformedHeader{}
 	}
 
+	if ok := e.protocol.stack.CheckNetworkPolicy(r, pkt); !ok {
+		e.stats.ip.NetworkPolicyDropped.Increment()
+		return nil
+	}
+
 	return e.writePacket(r, pkt, proto, true /* headerIncluded */)
 }
 
@@ -1040,6 +1051,11 @@ func (e *endpoint) forwardPacketWithRoute(route *stack.Route, pkt *stack.PacketB
 	h := header.IPv6(pkt.NetworkHeader().Slice())
 	stk := e.protocol.stack
 
+	if ok := stk.CheckNetworkPolicy(route, pkt); !ok {
+		e.stats.ip.NetworkPolicyDropped.Increment()
+		return nil
+	}
+
 	inNicName := stk.FindNICNameFromID(e.nic.ID())
 	outNicName := stk.FindNICNameFromID(route.NICID())
 	if ok := stk.IPTables().CheckForward(pkt, inNicName, outNicName); !ok {
@@ -1375,7 +1391,12 @@ func (e *endpoint) handleValidatedPacket(h header.IPv6, pkt *stack.PacketBuffer,
 
 	// The destination address should be an address we own for us to receive the
 	// packet. Otherwise, attempt to forward the packet.
-	if addressEndpoint := e.AcquireAssignedAddress(dstAddr, e.nic.Promiscuous(), stack.CanBePrimaryEndpoint, true /* readOnly */); addressEndpoint != nil {
+	//
+	// Packets redirected by a TPROXY target are delivered locally regardless
+	// of their destination.
+	if pkt.NetworkPacketInfo.TProxy.Port != 0 {
+		e.deliverPacketLocally(h, pkt, inNICName)
+	} else if addressEndpoint := e.AcquireAssignedAddress(dstAddr, e.nic.Promiscuous(), stack.CanBePrimaryEndpoint, true /* readOnly */); addressEndpoint != nil {
 		e.deliverPacketLocally(h, pkt, inNICName)
 	} else if e.Forwarding() {
 		e.handleForwardingError(e.forwardUnicastPacket(pkt))
@@ -3630,6 +3630,73 @@ func TestMaxNestedJumps(t *testing.T) {
 
 // checkPacketEquality checks that the given packets are equal for all fields
 // and data relevant to our testing. This is not an exhaustive check.
+// TestRulesetCheckHook tests that rules built with the public rule
+// construction functions filter packets through Ruleset.CheckHook.
+func TestRulesetCheckHook(t *testing.T) {
+	rs := NewRuleset(newNFTablesStd())
+	if err := rs.Update(func(nf *NFTables) error {
+		tab, err := nf.AddTable(Inet, "filter", "", false)
+		if err != nil {
+			return err
+		}
+		bc, err := tab.AddChain("input", NewBaseChainInfo(BaseChainTypeFilter, Input, NewIntPriority(0), "", false), "", false)
+		if err != nil {
+			return err
+		}
+		// Drops UDP packets.
+		rule := &Rule{}
+		if err := rule.AddPayloadLoad(linux.NFT_PAYLOAD_NETWORK_HEADER, 9, 1, linux.NFT_REG_1); err != nil {
+			return err
+		}
+		if err := rule.AddComparison(linux.NFT_REG_1, linux.NFT_CMP_EQ, []byte{uint8(header.UDPProtocolNumber)}); err != nil {
+			return err
+		}
+		if err := rule.AddCounter(0, 0); err != nil {
+			return err
+		}
+		if err := rule.AddImmediateVerdict(Verdict{Code: VC(linux.NF_DROP)}); err != nil {
+			return err
+		}
+		return bc.RegisterRule(rule, -1)
+	}); err != nil {
+		t.Fatalf("failed to set up ruleset: %v", err)
+	}
+	rs.View(func(nf *NFTables, genID uint32) {
+		if genID != 1 {
+			t.Errorf("got generation %d, want 1", genID)
+		}
+		if tables := nf.Tables(Inet); len(tables) != 1 || tables[0].GetName() != "filter" {
+			t.Errorf("got Inet tables %v, want [filter]", tables)
+		}
+	})
+
+	for _, test := range []struct {
+		name   string
+		hook   stack.Hook
+		proto  tcpip.TransportProtocolNumber
+		accept bool
+	}{
+		{name: "input tcp", hook: stack.Input, proto: header.TCPProtocolNumber, accept: true},
+		{name: "input udp", hook: stack.Input, proto: header.UDPProtocolNumber, accept: false},
+		{name: "output udp", hook: stack.Output, proto: header.UDPProtocolNumber, accept: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			pkt := makeIPv4Packet(arbitraryReservedHeaderBytes, &header.IPv4Fields{
+				TOS:         0,
+				TotalLength: header.IPv4MinimumSize,
+				TTL:         64,
+				Protocol:    uint8(test.proto),
+				SrcAddr:     tcpip.AddrFrom4([4]byte{10, 0, 0, 1}),
+				DstAddr:     tcpip.AddrFrom4([4]byte{10, 0, 0, 2}),
+			})
+			defer pkt.DecRef()
+			if got := rs.CheckHook(test.hook, pkt); got != test.accept {
+				t.Errorf("CheckHook(%v) = %t, want %t", test.hook, got, test.accept)
+			}
+		})
+	}
+}
+
 func checkPacketEquality(t *testing.T, expected, actual *stack.PacketBuffer) {
 	if expected.PktType != actual.PktType {
 		t.Fatalf("expected packet type %d for resulting packet, got %d", int(expected.PktType), int(actual.PktType))
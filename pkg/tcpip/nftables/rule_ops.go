@@ -0,0 +1,199 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nftables
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+)
+
+//
+// Public Rule Construction Functions
+// Note: these build rules from the expressions of NFT_MSG_NEWRULE messages,
+// where register numbers, operators and keys are the ones defined by Linux.
+//
+
+// AddImmediate adds an immediate operation setting register dreg to data.
+func (r *Rule) AddImmediate(dreg uint8, data []byte) error {
+	op, err := newImmediate(dreg, newBytesData(data))
+	if err != nil {
+		return err
+	}
+	return r.addOperation(op)
+}
+
+// AddImmediateVerdict adds an immediate operation setting the verdict register
+// to v.
+func (r *Rule) AddImmediateVerdict(v Verdict) error {
+	switch int32(v.Code) {
+	case linux.NF_DROP, linux.NF_ACCEPT, linux.NF_QUEUE, linux.NFT_CONTINUE,
+		linux.NFT_BREAK, linux.NFT_RETURN:
+		if v.ChainName != "" {
+			return fmt.Errorf("verdict %s can't have a target chain", VerdictCodeToString(v.Code))
+		}
+	case linux.NFT_JUMP, linux.NFT_GOTO:
+		if v.ChainName == "" {
+			return fmt.Errorf("verdict %s must have a target chain", VerdictCodeToString(v.Code))
+		}
+	default:
+		return fmt.Errorf("invalid verdict: %d", int32(v.Code))
+	}
+	op, err := newImmediate(linux.NFT_REG_VERDICT, newVerdictData(v))
+	if err != nil {
+		return err
+	}
+	return r.addOperation(op)
+}
+
+// AddComparison adds a comparison operation of register sreg with data using
+// the NFT_CMP_* operator cmpOp.
+func (r *Rule) AddComparison(sreg uint8, cmpOp int, data []byte) error {
+	op, err := newComparison(sreg, cmpOp, data)
+	if err != nil {
+		return err
+	}
+	return r.addOperation(op)
+}
+
+// AddRange adds a range operation checking register sreg against [low, high]
+// using the NFT_RANGE_* operator rngOp.
+func (r *Rule) AddRange(sreg uint8, rngOp int, low, high []byte) error {
+	op, err := newRanged(sreg, rngOp, low, high)
+	if err != nil {
+		return err
+	}
+	return r.addOperation(op)
+}
+
+// AddPayloadLoad adds an operation loading blen bytes at offset from the
+// NFT_PAYLOAD_* header base into register dreg.
+func (r *Rule) AddPayloadLoad(base, offset, blen, dreg uint8) error {
+	op, err := newPayloadLoad(payloadBase(base), offset, blen, dreg)
+	if err != nil {
+		return err
+	}
+	return r.addOperation(op)
+}
+
+// AddPayloadSet adds an operation writing blen bytes from register sreg at
+// offset from the NFT_PAYLOAD_* header base, updating checksums as described
+// by csumType, csumOffset and csumFlags.
+func (r *Rule) AddPayloadSet(base, offset, blen, sreg, csumType, csumOffset, csumFlags uint8) error {
+	op, err := newPayloadSet(payloadBase(base), offset, blen, sreg, csumType, csumOffset, csumFlags)
+	if err != nil {
+		return err
+	}
+	return r.addOperation(op)
+}
+
+// AddBitwiseBool adds an operation setting register dreg to
+// (sreg & mask) ^ xor.
+func (r *Rule) AddBitwiseBool(sreg, dreg uint8, mask, xor []byte) error {
+	op, err := newBitwiseBool(sreg, dreg, mask, xor)
+	if err != nil {
+		return err
+	}
+	return r.addOperation(op)
+}
+
+// AddBitwiseShift adds an operation setting register dreg to the blen bytes
+// of register sreg shifted by shift bits.
+func (r *Rule) AddBitwiseShift(sreg, dreg, blen uint8, shift uint32, right bool) error {
+	op, err := newBitwiseShift(sreg, dreg, blen, shift, right)
+	if err != nil {
+		return err
+	}
+	return r.addOperation(op)
+}
+
+// AddByteorder adds an operation converting the blen bytes of register sreg,
+// made of size byte words, with the NFT_BYTEORDER_* operator bop into register
+// dreg.
+func (r *Rule) AddByteorder(sreg, dreg uint8, bop int, blen, size uint8) error {
+	op, err := newByteorder(sreg, dreg, byteorderOp(bop), blen, size)
+	if err != nil {
+		return err
+	}
+	return r.addOperation(op)
+}
+
+// AddMetaLoad adds an operation loading the NFT_META_* key into register dreg.
+func (r *Rule) AddMetaLoad(key int, dreg uint8) error {
+	op, err := newMetaLoad(metaKey(key), dreg)
+	if err != nil {
+		return err
+	}
+	return r.addOperation(op)
+}
+
+// AddMetaSet adds an operation setting the NFT_META_* key from register sreg.
+func (r *Rule) AddMetaSet(key int, sreg uint8) error {
+	op, err := newMetaSet(metaKey(key), sreg)
+	if err != nil {
+		return err
+	}
+	return r.addOperation(op)
+}
+
+// AddRoute adds an operation loading the NFT_RT_* key into register dreg.
+func (r *Rule) AddRoute(key int, dreg uint8) error {
+	op, err := newRoute(routeKey(key), dreg)
+	if err != nil {
+		return err
+	}
+	return r.addOperation(op)
+}
+
+// AddCounter adds a counter operation starting at the given counts.
+func (r *Rule) AddCounter(bytes, packets int64) error {
+	return r.addOperation(newCounter(bytes, packets))
+}
+
+//
+// Public Ruleset Listing Functions
+//
+
+// Tables returns the tables of the address family, sorted by name.
+func (nf *NFTables) Tables(family AddressFamily) []*Table {
+	if err := validateAddressFamily(family); err != nil || nf.filters[family] == nil {
+		return nil
+	}
+	tables := make([]*Table, 0, len(nf.filters[family].tables))
+	for _, t := range nf.filters[family].tables {
+		tables = append(tables, t)
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].name < tables[j].name })
+	return tables
+}
+
+// Chains returns the chains of the table, sorted by name.
+func (t *Table) Chains() []*Chain {
+	chains := make([]*Chain, 0, len(t.chains))
+	for _, c := range t.chains {
+		chains = append(chains, c)
+	}
+	sort.Slice(chains, func(i, j int) bool { return chains[i].name < chains[j].name })
+	return chains
+}
+
+// Flush removes all rules from the chain.
+func (c *Chain) Flush() {
+	for _, rule := range c.rules {
+		rule.chain = nil
+	}
+	c.rules = nil
+}
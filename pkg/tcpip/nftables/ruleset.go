@@ -0,0 +1,103 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nftables
+
+import (
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/sync"
+	"github.com/wilinz/gvisor/pkg/tcpip/header"
+	"github.com/wilinz/gvisor/pkg/tcpip/stack"
+)
+
+// Ruleset is the NFTables state of a network stack. Since NFTables isn't
+// thread-safe, Ruleset serializes changes to it with the evaluation of
+// packets traversing the stack.
+type Ruleset struct {
+	mu sync.RWMutex
+
+	// nf is the ruleset.
+	//
+	// +checklocks:mu
+	nf *NFTables
+
+	// genID is the generation of the ruleset, incremented with every change.
+	//
+	// +checklocks:mu
+	genID uint32
+}
+
+var _ stack.NFTablesFilter = (*Ruleset)(nil)
+
+// NewRuleset returns a Ruleset for nf.
+func NewRuleset(nf *NFTables) *Ruleset {
+	return &Ruleset{nf: nf}
+}
+
+// Update calls fn with the ruleset locked for writing. The generation of the
+// ruleset is incremented unless fn returns an error.
+func (rs *Ruleset) Update(fn func(nf *NFTables) error) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if err := fn(rs.nf); err != nil {
+		return err
+	}
+	rs.genID++
+	return nil
+}
+
+// View calls fn with the ruleset and its generation, locked for reading. fn
+// must not change the ruleset.
+func (rs *Ruleset) View(fn func(nf *NFTables, genID uint32)) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	fn(rs.nf, rs.genID)
+}
+
+// hooks maps stack hooks to nftables hooks.
+var hooks = [stack.NumHooks]Hook{
+	stack.Prerouting:  Prerouting,
+	stack.Input:       Input,
+	stack.Forward:     Forward,
+	stack.Output:      Output,
+	stack.Postrouting: Postrouting,
+}
+
+// CheckHook implements stack.NFTablesFilter.CheckHook.
+//
+// IPv4 and IPv6 packets are evaluated by the base chains of their own address
+// family, then by those of the Inet family. Unlike Linux, base chains of the
+// two families aren't interleaved by priority.
+func (rs *Ruleset) CheckHook(hook stack.Hook, pkt *stack.PacketBuffer) bool {
+	var family AddressFamily
+	switch pkt.NetworkProtocolNumber {
+	case header.IPv4ProtocolNumber:
+		family = IP
+	case header.IPv6ProtocolNumber:
+		family = IP6
+	default:
+		return true
+	}
+
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	for _, f := range [...]AddressFamily{family, Inet} {
+		v, err := rs.nf.EvaluateHook(f, hooks[hook], pkt)
+		// Queueing isn't supported, so only accepted packets continue.
+		if err != nil || v.Code != VC(linux.NF_ACCEPT) {
+			return false
+		}
+	}
+	return true
+}
@@ -15,6 +15,8 @@
 package tcpip
 
 import (
+	"time"
+
 	"github.com/wilinz/gvisor/pkg/atomicbitops"
 	"github.com/wilinz/gvisor/pkg/buffer"
 	"github.com/wilinz/gvisor/pkg/sync"
@@ -30,6 +32,10 @@ type SocketOptionsHandler interface {
 	// OnReusePortSet is invoked when SO_REUSEPORT is set for an endpoint.
 	OnReusePortSet(v bool)
 
+	// OnReusePortFilterSet is invoked when a reuseport selection filter is
+	// attached to or detached (f == nil) from an endpoint.
+	OnReusePortFilterSet(f ReusePortFilter)
+
 	// OnKeepAliveSet is invoked when SO_KEEPALIVE is set for an endpoint.
 	OnKeepAliveSet(v bool)
 
@@ -81,6 +87,9 @@ func (*DefaultSocketOptionsHandler) OnReuseAddressSet(bool) {}
 // OnReusePortSet implements SocketOptionsHandler.OnReusePortSet.
 func (*DefaultSocketOptionsHandler) OnReusePortSet(bool) {}
 
+// OnReusePortFilterSet implements SocketOptionsHandler.OnReusePortFilterSet.
+func (*DefaultSocketOptionsHandler) OnReusePortFilterSet(ReusePortFilter) {}
+
 // OnKeepAliveSet implements SocketOptionsHandler.OnKeepAliveSet.
 func (*DefaultSocketOptionsHandler) OnKeepAliveSet(bool) {}
 
@@ -132,6 +141,31 @@ type StackHandler interface {
 	TransportProtocolOption(proto TransportProtocolNumber, option GettableTransportProtocolOption) Error
 }
 
+// TimestampingFlags are the flags of the SO_TIMESTAMPING option. Their values
+// match Linux's SOF_TIMESTAMPING_* flags; flags other than the following are
+// stored but have no effect.
+type TimestampingFlags uint32
+
+const (
+	// TimestampingTXSoftware requests transmit timestamps taken when
+	// packets are passed to the link layer.
+	TimestampingTXSoftware TimestampingFlags = 1 << 1
+
+	// TimestampingRXSoftware requests receive timestamps taken when packets
+	// are received by the stack.
+	TimestampingRXSoftware TimestampingFlags = 1 << 3
+
+	// TimestampingSoftware reports software timestamps in control messages.
+	TimestampingSoftware TimestampingFlags = 1 << 4
+
+	// TimestampingOptID identifies transmit timestamps with a per-socket
+	// counter.
+	TimestampingOptID TimestampingFlags = 1 << 7
+
+	// TimestampingOptTSOnly omits the packet from transmit timestamps.
+	TimestampingOptTSOnly TimestampingFlags = 1 << 11
+)
+
 // SocketOptions contains all the variables which store values for SOL_SOCKET,
 // SOL_IP, SOL_IPV6 and SOL_TCP level options.
 //
@@ -222,6 +256,22 @@ type SocketOptions struct {
 	// the incoming packet should be returned as an ancillary message.
 	receiveOriginalDstAddress atomicbitops.Uint32
 
+	// transparent is used to specify if the endpoint may bind to non-local
+	// addresses and receive packets redirected to it by a TPROXY iptables
+	// target.
+	transparent atomicbitops.Uint32
+
+	// receiveDropCount is used to specify if the number of packets dropped by
+	// the endpoint should be returned as an ancillary message.
+	receiveDropCount atomicbitops.Uint32
+
+	// timestamping holds the TimestampingFlags set by SO_TIMESTAMPING.
+	timestamping atomicbitops.Uint32
+
+	// timestampingKey is the key of the next transmit timestamp if
+	// TimestampingOptID is set.
+	timestampingKey atomicbitops.Uint32
+
 	// ipv4RecvErrEnabled determines whether extended reliable error message
 	// passing is enabled for IPv4.
 	ipv4RecvErrEnabled atomicbitops.Uint32
@@ -260,6 +310,10 @@ type SocketOptions struct {
 	// close. We currently implement this option for TCP socket only.
 	linger LingerOption
 
+	// reusePortFilter is the filter used to select an endpoint from this
+	// socket's reuseport group, as set by SO_ATTACH_REUSEPORT_CBPF.
+	reusePortFilter ReusePortFilter
+
 	// rcvlowat specifies the minimum number of bytes which should be
 	// received to indicate the socket as readable.
 	rcvlowat atomicbitops.Int32
@@ -488,6 +542,40 @@ func (so *SocketOptions) SetReceiveOriginalDstAddress(v bool) {
 	storeAtomicBool(&so.receiveOriginalDstAddress, v)
 }
 
+// GetTransparent gets value for IP(V6)_TRANSPARENT option.
+func (so *SocketOptions) GetTransparent() bool {
+	return so.transparent.Load() != 0
+}
+
+// SetTransparent sets value for IP(V6)_TRANSPARENT option.
+func (so *SocketOptions) SetTransparent(v bool) {
+	storeAtomicBool(&so.transparent, v)
+}
+
+// GetReceiveDropCount gets value for SO_RXQ_OVFL option.
+func (so *SocketOptions) GetReceiveDropCount() bool {
+	return so.receiveDropCount.Load() != 0
+}
+
+// SetReceiveDropCount sets value for SO_RXQ_OVFL option.
+func (so *SocketOptions) SetReceiveDropCount(v bool) {
+	storeAtomicBool(&so.receiveDropCount, v)
+}
+
+// GetTimestamping gets value for SO_TIMESTAMPING option.
+func (so *SocketOptions) GetTimestamping() TimestampingFlags {
+	return TimestampingFlags(so.timestamping.Load())
+}
+
+// SetTimestamping sets value for SO_TIMESTAMPING option.
+func (so *SocketOptions) SetTimestamping(v TimestampingFlags) {
+	old := TimestampingFlags(so.timestamping.Swap(uint32(v)))
+	if v&TimestampingOptID != 0 && old&TimestampingOptID == 0 {
+		// Like Linux, restart numbering sends when OPT_ID is enabled.
+		so.timestampingKey.Store(0)
+	}
+}
+
 // GetIPv4RecvError gets value for IP_RECVERR option.
 func (so *SocketOptions) GetIPv4RecvError() bool {
 	return so.ipv4RecvErrEnabled.Load() != 0
@@ -543,6 +631,24 @@ func (so *SocketOptions) SetLinger(linger LingerOption) {
 	so.mu.Unlock()
 }
 
+// GetReusePortFilter gets the reuseport selection filter attached to the
+// socket, if any.
+func (so *SocketOptions) GetReusePortFilter() ReusePortFilter {
+	so.mu.Lock()
+	f := so.reusePortFilter
+	so.mu.Unlock()
+	return f
+}
+
+// SetReusePortFilter sets the reuseport selection filter for the socket. A
+// nil filter detaches the current one.
+func (so *SocketOptions) SetReusePortFilter(f ReusePortFilter) {
+	so.mu.Lock()
+	so.reusePortFilter = f
+	so.mu.Unlock()
+	so.handler.OnReusePortFilterSet(f)
+}
+
 // GetExperimentOptionValue gets value for the experiment IP option header.
 func (so *SocketOptions) GetExperimentOptionValue() uint16 {
 	v := so.experimentOptionValue.Load()
@@ -554,6 +660,15 @@ func (so *SocketOptions) SetExperimentOptionValue(v uint16) {
 	so.experimentOptionValue.Store(uint32(v))
 }
 
+// ReusePortFilter selects the endpoint that receives a packet from a group of
+// endpoints bound with SO_REUSEPORT.
+type ReusePortFilter interface {
+	// SelectEndpoint returns the index, in bind order, of the endpoint in the
+	// group that should receive a packet with the given transport payload.
+	// An out of range index falls back to hash-based selection.
+	SelectEndpoint(payload []byte) uint32
+}
+
 // SockErrOrigin represents the constants for error origin.
 type SockErrOrigin uint8
 
@@ -569,6 +684,10 @@ const (
 
 	// SockExtErrorOriginICMP6 indicates an IPv6 ICMP error.
 	SockExtErrorOriginICMP6
+
+	// SockExtErrorOriginTimestamping indicates a transmit timestamp rather
+	// than an error.
+	SockExtErrorOriginTimestamping
 )
 
 // IsICMPErr indicates if the error originated from an ICMP error.
@@ -618,6 +737,38 @@ func (l *LocalSockError) Info() uint32 {
 	return l.info
 }
 
+// TimestampingSockError is a transmit timestamp reported through the error
+// queue, as requested by SO_TIMESTAMPING.
+//
+// +stateify savable
+type TimestampingSockError struct {
+	// Key identifies the timestamped send if TimestampingOptID is set.
+	Key uint32
+}
+
+// Origin implements SockErrorCause.
+func (*TimestampingSockError) Origin() SockErrOrigin {
+	return SockExtErrorOriginTimestamping
+}
+
+// Type implements SockErrorCause.
+func (*TimestampingSockError) Type() uint8 {
+	return 0
+}
+
+// Code implements SockErrorCause.
+func (*TimestampingSockError) Code() uint8 {
+	return 0
+}
+
+// Info implements SockErrorCause.
+//
+// Only timestamps taken when packets are passed to the link layer
+// (SCM_TSTAMP_SND) are supported.
+func (*TimestampingSockError) Info() uint32 {
+	return 0
+}
+
 // SockError represents a queue entry in the per-socket error queue.
 //
 // +stateify savable
@@ -637,6 +788,9 @@ type SockError struct {
 	Offender FullAddress
 	// NetProto is the network protocol being used to transmit the packet.
 	NetProto NetworkProtocolNumber
+	// Timestamp is the time at which the packet was transmitted. It is only
+	// set for transmit timestamps.
+	Timestamp time.Time `state:".(int64)"`
 }
 
 // pruneErrQueue resets the queue.
@@ -669,7 +823,8 @@ func (so *SocketOptions) PeekErr() *SockError {
 
 // QueueErr inserts the error at the back of the error queue.
 //
-// Preconditions: so.GetIPv4RecvError() or so.GetIPv6RecvError() is true.
+// Preconditions: so.GetIPv4RecvError() or so.GetIPv6RecvError() is true, or
+// err is a transmit timestamp.
 func (so *SocketOptions) QueueErr(err *SockError) {
 	so.errQueueMu.Lock()
 	defer so.errQueueMu.Unlock()
@@ -687,6 +842,21 @@ func (so *SocketOptions) QueueLocalErr(err Error, net NetworkProtocolNumber, inf
 	})
 }
 
+// QueueTXTimestamp queues a transmit timestamp for a packet sent at time now
+// onto the error queue, as per SO_TIMESTAMPING.
+func (so *SocketOptions) QueueTXTimestamp(net NetworkProtocolNumber, now time.Time, payload *buffer.View) {
+	var key uint32
+	if so.GetTimestamping()&TimestampingOptID != 0 {
+		key = so.timestampingKey.Add(1) - 1
+	}
+	so.QueueErr(&SockError{
+		Cause:     &TimestampingSockError{Key: key},
+		Payload:   payload,
+		NetProto:  net,
+		Timestamp: now,
+	})
+}
+
 // GetBindToDevice gets value for SO_BINDTODEVICE option.
 func (so *SocketOptions) GetBindToDevice() int32 {
 	return so.bindToDevice.Load()
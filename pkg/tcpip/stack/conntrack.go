@@ -161,6 +161,13 @@ type conn struct {
 	//
 	// +checklocks:stateMu
 	lastUsed tcpip.MonotonicTime
+	// packets and bytes count the packets seen on the connection and their
+	// total size, in the original (index 0) and reply (index 1) directions.
+	//
+	// +checklocks:stateMu
+	packets [2]uint64
+	// +checklocks:stateMu
+	bytes [2]uint64
 }
 
 // timedOut returns whether the connection timed out based on its state.
@@ -185,6 +192,13 @@ func (cn *conn) update(pkt *PacketBuffer, reply bool) {
 	// Mark the connection as having been used recently so it isn't reaped.
 	cn.lastUsed = cn.ct.clock.NowMonotonic()
 
+	dir := 0
+	if reply {
+		dir = 1
+	}
+	cn.packets[dir]++
+	cn.bytes[dir] += uint64(pkt.Size())
+
 	if pkt.TransportProtocolNumber != header.TCPProtocolNumber {
 		return
 	}
@@ -888,7 +902,7 @@ func (cn *conn) handlePacket(pkt *PacketBuffer, hook Hook, rt *Route) bool {
 		dnat = true
 		fallthrough
 	case Postrouting:
-		if pkt.TransportProtocolNumber == header.TCPProtocolNumber && pkt.GSOOptions.Type != GSONone && pkt.GSOOptions.NeedsCsum {
+		if (pkt.TransportProtocolNumber == header.TCPProtocolNumber || pkt.TransportProtocolNumber == header.UDPProtocolNumber) && pkt.GSOOptions.Type != GSONone && pkt.GSOOptions.NeedsCsum {
 			updatePseudoHeader = true
 		} else if rt.RequiresTXTransportChecksum() {
 			fullChecksum = true
@@ -1167,3 +1181,201 @@ func (ct *ConnTrack) originalDst(epID TransportEndpointID, netProto tcpip.Networ
 	id := t.conn.original.tupleID
 	return id.dstAddr, id.dstPortOrEchoReplyIdent, nil
 }
+
+// ConnTrackTuple describes a tracked connection in one direction.
+type ConnTrackTuple struct {
+	SrcAddr tcpip.Address
+
+	// SrcPort is the source port, or the ident of ICMP echo requests.
+	SrcPort uint16
+
+	DstAddr tcpip.Address
+
+	// DstPort is the destination port, or the ident of ICMP echo replies.
+	DstPort uint16
+
+	TransProto tcpip.TransportProtocolNumber
+	NetProto   tcpip.NetworkProtocolNumber
+}
+
+func (ti tupleID) connTrackTuple() ConnTrackTuple {
+	return ConnTrackTuple{
+		SrcAddr:    ti.srcAddr,
+		SrcPort:    ti.srcPortOrEchoRequestIdent,
+		DstAddr:    ti.dstAddr,
+		DstPort:    ti.dstPortOrEchoReplyIdent,
+		TransProto: ti.transProto,
+		NetProto:   ti.netProto,
+	}
+}
+
+func (t ConnTrackTuple) tupleID() tupleID {
+	return tupleID{
+		srcAddr:                   t.SrcAddr,
+		srcPortOrEchoRequestIdent: t.SrcPort,
+		dstAddr:                   t.DstAddr,
+		dstPortOrEchoReplyIdent:   t.DstPort,
+		transProto:                t.TransProto,
+		netProto:                  t.NetProto,
+	}
+}
+
+// ConnTrackEntry describes a tracked connection.
+type ConnTrackEntry struct {
+	// Original and Reply are the tuples of the connection in each direction.
+	Original ConnTrackTuple
+	Reply    ConnTrackTuple
+
+	// SeenReply is true if packets were seen in the reply direction.
+	SeenReply bool
+
+	// SourceNAT and DestinationNAT are true if the source or destination of
+	// the connection is rewritten.
+	SourceNAT      bool
+	DestinationNAT bool
+
+	// TCPState is the state of TCP connections.
+	TCPState tcpconntrack.Result
+
+	// Timeout is the time left before the connection is reaped, unless more
+	// packets are seen.
+	Timeout time.Duration
+
+	// Packets and Bytes count the packets and bytes in the original (index
+	// 0) and reply (index 1) directions.
+	Packets [2]uint64
+	Bytes   [2]uint64
+}
+
+// entry returns a description of cn.
+func (cn *conn) entry(now tcpip.MonotonicTime) ConnTrackEntry {
+	cn.mu.RLock()
+	e := ConnTrackEntry{
+		Original:       cn.original.tupleID.connTrackTuple(),
+		Reply:          cn.reply.tupleID.connTrackTuple(),
+		SourceNAT:      cn.sourceManip == manipPerformed,
+		DestinationNAT: cn.destinationManip == manipPerformed,
+	}
+	cn.mu.RUnlock()
+
+	cn.stateMu.RLock()
+	defer cn.stateMu.RUnlock()
+	timeout := unestablishedTimeout
+	if cn.tcb.State() == tcpconntrack.ResultAlive {
+		timeout = establishedTimeout
+	}
+	e.Timeout = max(timeout-now.Sub(cn.lastUsed), 0)
+	if e.Original.TransProto == header.TCPProtocolNumber {
+		e.TCPState = cn.tcb.State()
+	}
+	e.SeenReply = cn.packets[1] != 0
+	e.Packets = cn.packets
+	e.Bytes = cn.bytes
+	return e
+}
+
+// entries returns the connections which haven't timed out.
+func (ct *ConnTrack) entries() []ConnTrackEntry {
+	now := ct.clock.NowMonotonic()
+	var entries []ConnTrackEntry
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	for i := range ct.buckets {
+		bkt := &ct.buckets[i]
+		bkt.mu.RLock()
+		for t := bkt.tuples.Front(); t != nil; t = t.Next() {
+			// Only report each connection once.
+			if t.reply || t.conn.timedOut(now) {
+				continue
+			}
+			entries = append(entries, t.conn.entry(now))
+		}
+		bkt.mu.RUnlock()
+	}
+	return entries
+}
+
+// entry returns the connection with a tuple matching tid in either direction.
+func (ct *ConnTrack) entry(tid tupleID) (ConnTrackEntry, bool) {
+	t := ct.connForTID(tid)
+	if t == nil {
+		return ConnTrackEntry{}, false
+	}
+	return t.conn.entry(ct.clock.NowMonotonic()), true
+}
+
+// deleteConn removes the connection with a tuple matching tid in either
+// direction. It returns false if there is no such connection.
+func (ct *ConnTrack) deleteConn(tid tupleID) bool {
+	t := ct.connForTID(tid)
+	if t == nil {
+		return false
+	}
+	ct.removeConn(t.conn)
+	return true
+}
+
+// flush removes all connections of netProto, or all connections if netProto
+// is 0.
+func (ct *ConnTrack) flush(netProto tcpip.NetworkProtocolNumber) {
+	var conns []*conn
+	ct.mu.RLock()
+	for i := range ct.buckets {
+		bkt := &ct.buckets[i]
+		bkt.mu.RLock()
+		for t := bkt.tuples.Front(); t != nil; t = t.Next() {
+			if !t.reply && (netProto == 0 || t.tupleID.netProto == netProto) {
+				conns = append(conns, t.conn)
+			}
+		}
+		bkt.mu.RUnlock()
+	}
+	ct.mu.RUnlock()
+
+	for _, cn := range conns {
+		ct.removeConn(cn)
+	}
+}
+
+// removeConn removes the tuples of cn from the table, if they are present.
+//
+// +checklocksignore: the bucket locks are taken dynamically.
+func (ct *ConnTrack) removeConn(cn *conn) {
+	cn.mu.RLock()
+	replyTID := cn.reply.tupleID
+	cn.mu.RUnlock()
+
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+
+	// Lock the buckets in order.
+	first, second := ct.bucket(cn.original.tupleID), ct.bucket(replyTID)
+	if first > second {
+		first, second = second, first
+	}
+	firstBkt := &ct.buckets[first]
+	firstBkt.mu.Lock()
+	defer firstBkt.mu.Unlock()
+	firstBkt.removeLocked(&cn.original)
+	firstBkt.removeLocked(&cn.reply)
+	if first == second {
+		return
+	}
+	secondBkt := &ct.buckets[second]
+	secondBkt.mu.NestedLock(bucketLockOthertuple)
+	defer secondBkt.mu.NestedUnlock(bucketLockOthertuple)
+	secondBkt.removeLocked(&cn.original)
+	secondBkt.removeLocked(&cn.reply)
+}
+
+// removeLocked removes t from bkt if it is present.
+//
+// +checklocks:bkt.mu
+func (bkt *bucket) removeLocked(t *tuple) {
+	for other := bkt.tuples.Front(); other != nil; other = other.Next() {
+		if other == t {
+			bkt.tuples.Remove(t)
+			return
+		}
+	}
+}
@@ -73,6 +73,90 @@ func TestReap(t *testing.T) {
 	ct.checkNumTuples(t, 0)
 }
 
+func TestEntries(t *testing.T) {
+	// Initialize conntrack.
+	clock := faketime.NewManualClock()
+	ct := ConnTrack{
+		clock: clock,
+	}
+	ct.init()
+
+	// We set rt.routeInfo.Loop to avoid a panic when handlePacket calls
+	// rt.RequiresTXTransportChecksum.
+	var rt Route
+	rt.routeInfo.Loop = PacketLoop
+
+	// Send two SYNs and finalize the connection.
+	var size int
+	for i := 0; i < 2; i++ {
+		pkt := genTCPPacket(genTCPOpts{})
+		size = pkt.Size()
+		pkt.tuple = ct.getConnAndUpdate(pkt, true /* skipChecksumValidation */)
+		if pkt.tuple.conn.handlePacket(pkt, Output, &rt) {
+			t.Fatal("handlePacket() shouldn't perform any NAT")
+		}
+		pkt.tuple.conn.finalize()
+	}
+	ct.checkNumTuples(t, 2)
+
+	entries := ct.entries()
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	e := entries[0]
+	wantOriginal := ConnTrackTuple{
+		SrcAddr:    testutil.MustParse4("1.0.0.1"),
+		SrcPort:    5555,
+		DstAddr:    testutil.MustParse4("1.0.0.2"),
+		DstPort:    6666,
+		TransProto: header.TCPProtocolNumber,
+		NetProto:   header.IPv4ProtocolNumber,
+	}
+	if e.Original != wantOriginal {
+		t.Errorf("got original tuple %+v, want %+v", e.Original, wantOriginal)
+	}
+	if want := wantOriginal.tupleID().reply().connTrackTuple(); e.Reply != want {
+		t.Errorf("got reply tuple %+v, want %+v", e.Reply, want)
+	}
+	if e.Packets != [2]uint64{2, 0} {
+		t.Errorf("got packet counts %v, want [2 0]", e.Packets)
+	}
+	if want := [2]uint64{2 * uint64(size), 0}; e.Bytes != want {
+		t.Errorf("got byte counts %v, want %v", e.Bytes, want)
+	}
+	if e.SeenReply {
+		t.Errorf("SeenReply is true, but no reply was sent")
+	}
+	if e.TCPState != tcpconntrack.ResultConnecting {
+		t.Errorf("got TCP state %v, want %v", e.TCPState, tcpconntrack.ResultConnecting)
+	}
+	if e.Timeout != unestablishedTimeout {
+		t.Errorf("got timeout %v, want %v", e.Timeout, unestablishedTimeout)
+	}
+
+	// The connection can be found and deleted with its reply tuple.
+	if _, ok := ct.entry(e.Reply.tupleID()); !ok {
+		t.Errorf("entry(%+v) didn't find the connection", e.Reply)
+	}
+	if !ct.deleteConn(e.Reply.tupleID()) {
+		t.Errorf("deleteConn(%+v) didn't find the connection", e.Reply)
+	}
+	ct.checkNumTuples(t, 0)
+	if ct.deleteConn(e.Reply.tupleID()) {
+		t.Errorf("deleteConn(%+v) found a deleted connection", e.Reply)
+	}
+
+	// Flushing removes the connections of the network protocol.
+	pkt := genTCPPacket(genTCPOpts{})
+	pkt.tuple = ct.getConnAndUpdate(pkt, true /* skipChecksumValidation */)
+	pkt.tuple.conn.finalize()
+	ct.checkNumTuples(t, 2)
+	ct.flush(header.IPv6ProtocolNumber)
+	ct.checkNumTuples(t, 2)
+	ct.flush(header.IPv4ProtocolNumber)
+	ct.checkNumTuples(t, 0)
+}
+
 func TestWindowScaling(t *testing.T) {
 	tcs := []struct {
 		name        string
@@ -327,6 +327,11 @@ func (gd *GRO) Init(enabled bool) {
 	}
 }
 
+// Enable enables GRO. It must not be called concurrently with Enqueue.
+func (gd *GRO) Enable() {
+	gd.enabled = true
+}
+
 // Enqueue the packet in GRO. This does not flush packets; Flush() must be
 // called explicitly for that.
 //
@@ -215,6 +215,14 @@ func EmptyNATTable() Table {
 	}
 }
 
+// EmptyMangleTable returns a Table with no rules and all of the mangle table
+// chains valid.
+func EmptyMangleTable() Table {
+	return Table{
+		Rules: []Rule{},
+	}
+}
+
 // GetTable returns a table with the given id and IP version. It panics when an
 // invalid id is provided.
 func (it *IPTables) GetTable(id TableID, ipv6 bool) Table {
@@ -325,6 +333,33 @@ func (it *IPTables) shouldSkipOrPopulateTables(tables []checkTable, pkt *PacketB
 	return false
 }
 
+// checkNFTables returns true iff the nftables ruleset of the stack, if any,
+// accepts pkt at hook.
+func (it *IPTables) checkNFTables(hook Hook, pkt *PacketBuffer) bool {
+	it.mu.RLock()
+	nft := it.nft
+	it.mu.RUnlock()
+	return nft == nil || nft.CheckHook(hook, pkt)
+}
+
+// NFTables returns the nftables ruleset of the stack, or nil if none was set.
+func (it *IPTables) NFTables() NFTablesFilter {
+	it.mu.RLock()
+	defer it.mu.RUnlock()
+	return it.nft
+}
+
+// SetNFTablesIfUnset sets the nftables ruleset of the stack to nft unless one
+// was set already, and returns the ruleset in use.
+func (it *IPTables) SetNFTablesIfUnset(nft NFTablesFilter) NFTablesFilter {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	if it.nft == nil {
+		it.nft = nft
+	}
+	return it.nft
+}
+
 // CheckPrerouting performs the prerouting hook on the packet.
 //
 // Returns true iff the packet may continue traversing the stack; the packet
@@ -349,7 +384,7 @@ func (it *IPTables) CheckPrerouting(pkt *PacketBuffer, addressEP AddressableEndp
 	}
 
 	if it.shouldSkipOrPopulateTables(tables[:], pkt) {
-		return true
+		return it.checkNFTables(Prerouting, pkt)
 	}
 
 	pkt.tuple = it.connections.getConnAndUpdate(pkt, false /* skipChecksumValidation */)
@@ -360,7 +395,7 @@ func (it *IPTables) CheckPrerouting(pkt *PacketBuffer, addressEP AddressableEndp
 		}
 	}
 
-	return true
+	return it.checkNFTables(Prerouting, pkt)
 }
 
 // CheckInput performs the input hook on the packet.
@@ -387,7 +422,7 @@ func (it *IPTables) CheckInput(pkt *PacketBuffer, inNicName string) bool {
 	}
 
 	if it.shouldSkipOrPopulateTables(tables[:], pkt) {
-		return true
+		return it.checkNFTables(Input, pkt)
 	}
 
 	for _, table := range tables {
@@ -396,6 +431,10 @@ func (it *IPTables) CheckInput(pkt *PacketBuffer, inNicName string) bool {
 		}
 	}
 
+	if !it.checkNFTables(Input, pkt) {
+		return false
+	}
+
 	if t := pkt.tuple; t != nil {
 		pkt.tuple = nil
 		return t.conn.finalize()
@@ -423,7 +462,7 @@ func (it *IPTables) CheckForward(pkt *PacketBuffer, inNicName, outNicName string
 	}
 
 	if it.shouldSkipOrPopulateTables(tables[:], pkt) {
-		return true
+		return it.checkNFTables(Forward, pkt)
 	}
 
 	for _, table := range tables {
@@ -432,7 +471,7 @@ func (it *IPTables) CheckForward(pkt *PacketBuffer, inNicName, outNicName string
 		}
 	}
 
-	return true
+	return it.checkNFTables(Forward, pkt)
 }
 
 // CheckOutput performs the output hook on the packet.
@@ -463,7 +502,7 @@ func (it *IPTables) CheckOutput(pkt *PacketBuffer, r *Route, outNicName string)
 	}
 
 	if it.shouldSkipOrPopulateTables(tables[:], pkt) {
-		return true
+		return it.checkNFTables(Output, pkt)
 	}
 
 	// We don't need to validate the checksum in the Output path: we can assume
@@ -476,7 +515,7 @@ func (it *IPTables) CheckOutput(pkt *PacketBuffer, r *Route, outNicName string)
 		}
 	}
 
-	return true
+	return it.checkNFTables(Output, pkt)
 }
 
 // CheckPostrouting performs the postrouting hook on the packet.
@@ -503,7 +542,7 @@ func (it *IPTables) CheckPostrouting(pkt *PacketBuffer, r *Route, addressEP Addr
 	}
 
 	if it.shouldSkipOrPopulateTables(tables[:], pkt) {
-		return true
+		return it.checkNFTables(Postrouting, pkt)
 	}
 
 	for _, table := range tables {
@@ -512,6 +551,10 @@ func (it *IPTables) CheckPostrouting(pkt *PacketBuffer, r *Route, addressEP Addr
 		}
 	}
 
+	if !it.checkNFTables(Postrouting, pkt) {
+		return false
+	}
+
 	if t := pkt.tuple; t != nil {
 		pkt.tuple = nil
 		return t.conn.finalize()
@@ -715,3 +758,45 @@ func (it *IPTables) OriginalDst(epID TransportEndpointID, netProto tcpip.Network
 	}
 	return it.connections.originalDst(epID, netProto, transProto)
 }
+
+// ConnTrackEntries returns the connections tracked by the connection tracker.
+func (it *IPTables) ConnTrackEntries() []ConnTrackEntry {
+	it.mu.RLock()
+	defer it.mu.RUnlock()
+	if !it.modified {
+		return nil
+	}
+	return it.connections.entries()
+}
+
+// ConnTrackEntry returns the tracked connection with a tuple matching tuple in
+// either direction. It returns false if there is no such connection.
+func (it *IPTables) ConnTrackEntry(tuple ConnTrackTuple) (ConnTrackEntry, bool) {
+	it.mu.RLock()
+	defer it.mu.RUnlock()
+	if !it.modified {
+		return ConnTrackEntry{}, false
+	}
+	return it.connections.entry(tuple.tupleID())
+}
+
+// DeleteConnTrackEntry stops tracking the connection with a tuple matching
+// tuple in either direction. It returns false if there is no such connection.
+func (it *IPTables) DeleteConnTrackEntry(tuple ConnTrackTuple) bool {
+	it.mu.RLock()
+	defer it.mu.RUnlock()
+	if !it.modified {
+		return false
+	}
+	return it.connections.deleteConn(tuple.tupleID())
+}
+
+// FlushConnTrack stops tracking the connections of netProto, or all
+// connections if netProto is 0.
+func (it *IPTables) FlushConnTrack(netProto tcpip.NetworkProtocolNumber) {
+	it.mu.RLock()
+	defer it.mu.RUnlock()
+	if it.modified {
+		it.connections.flush(netProto)
+	}
+}
@@ -275,6 +275,73 @@ func (rt *RedirectTarget) Action(pkt *PacketBuffer, hook Hook, r *Route, address
 	return dnatAction(pkt, hook, r, rt.Port, address, true /* changePort */, true /* changeAddress */)
 }
 
+// TProxyTarget redirects incoming packets to a local socket without modifying
+// their destination, for transparent proxying. The socket must have the
+// IP_TRANSPARENT option set. TProxyTarget is only valid in the mangle table's
+// Prerouting chain, for TCP and UDP packets.
+//
+// +stateify savable
+type TProxyTarget struct {
+	// Addr is the address of the socket to redirect to. If Addr is empty, the
+	// packet's destination address is used. It is immutable.
+	Addr tcpip.Address
+
+	// Port is the port of the socket to redirect to. If Port is zero, the
+	// packet's destination port is used. It is immutable.
+	Port uint16
+
+	// Mark and Mask describe the packet mark set on redirected packets.
+	// Netstack doesn't support packet marks, so they are only kept so that
+	// the rule can be read back. They are immutable.
+	Mark uint32
+	Mask uint32
+
+	// NetworkProtocol is the network protocol the target is used with. It
+	// is immutable.
+	NetworkProtocol tcpip.NetworkProtocolNumber
+}
+
+// Action implements Target.Action.
+func (tt *TProxyTarget) Action(pkt *PacketBuffer, hook Hook, _ *Route, _ AddressableEndpoint) (RuleVerdict, int) {
+	// Sanity check.
+	if tt.NetworkProtocol != pkt.NetworkProtocolNumber {
+		panic(fmt.Sprintf(
+			"TProxyTarget.Action with NetworkProtocol %d called on packet with NetworkProtocolNumber %d",
+			tt.NetworkProtocol, pkt.NetworkProtocolNumber))
+	}
+
+	// Only incoming packets can be delivered to a socket other than the one
+	// they are addressed to.
+	if hook != Prerouting {
+		return RuleDrop, 0
+	}
+
+	var dstPort uint16
+	switch transHdr := pkt.TransportHeader().Slice(); pkt.TransportProtocolNumber {
+	case header.TCPProtocolNumber:
+		if len(transHdr) < header.TCPMinimumSize {
+			return RuleDrop, 0
+		}
+		dstPort = header.TCP(transHdr).DestinationPort()
+	case header.UDPProtocolNumber:
+		if len(transHdr) < header.UDPMinimumSize {
+			return RuleDrop, 0
+		}
+		dstPort = header.UDP(transHdr).DestinationPort()
+	default:
+		return RuleDrop, 0
+	}
+
+	pkt.NetworkPacketInfo.TProxy = tcpip.FullAddress{
+		Addr: tt.Addr,
+		Port: tt.Port,
+	}
+	if tt.Port == 0 {
+		pkt.NetworkPacketInfo.TProxy.Port = dstPort
+	}
+	return RuleAccept, 0
+}
+
 // SNATTarget modifies the source port/IP in the outgoing packets.
 //
 // +stateify savable
@@ -401,6 +468,13 @@ func (mt *MasqueradeTarget) Action(pkt *PacketBuffer, hook Hook, r *Route, addre
 		panic(fmt.Sprintf("%s unrecognized", hook))
 	}
 
+	// Unlike SNAT, masquerade rules commonly match all protocols. Packets of
+	// protocols that aren't tracked can't be NATed, so let them through as
+	// they are rather than dropping them.
+	if pkt.tuple == nil {
+		return RuleAccept, 0
+	}
+
 	// addressEP is expected to be set for the postrouting hook.
 	ep := addressEP.AcquireOutgoingPrimaryAddress(pkt.Network().DestinationAddress(), tcpip.Address{} /* srcHint */, false /* allowExpired */)
 	if ep == nil {
@@ -101,6 +101,21 @@ type IPTables struct {
 	//
 	// +checklocks:mu
 	modified bool
+
+	// nft is the nftables ruleset evaluated after the iptables tables, or
+	// nil if nftables was never configured. Like Linux, packets must be
+	// accepted by both. The ruleset isn't saved.
+	//
+	// +checklocks:mu
+	nft NFTablesFilter `state:"nosave"`
+}
+
+// NFTablesFilter evaluates packets against an nftables ruleset. It is
+// implemented by the nftables package.
+type NFTablesFilter interface {
+	// CheckHook returns true iff the ruleset accepts pkt at hook. The
+	// ruleset may modify pkt.
+	CheckHook(hook Hook, pkt *PacketBuffer) bool
 }
 
 // Modified returns whether iptables has been modified. It is inherently racy
@@ -0,0 +1,342 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"fmt"
+
+	"github.com/wilinz/gvisor/pkg/atomicbitops"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/header"
+)
+
+// NetworkPolicyAction is the verdict of a network policy for a packet.
+type NetworkPolicyAction int
+
+const (
+	// NetworkPolicyAllow lets the packet continue through the stack.
+	NetworkPolicyAllow NetworkPolicyAction = iota
+
+	// NetworkPolicyDeny drops the packet.
+	NetworkPolicyDeny
+)
+
+// String implements fmt.Stringer.
+func (a NetworkPolicyAction) String() string {
+	switch a {
+	case NetworkPolicyAllow:
+		return "allow"
+	case NetworkPolicyDeny:
+		return "deny"
+	default:
+		return fmt.Sprintf("NetworkPolicyAction(%d)", int(a))
+	}
+}
+
+// NetworkPolicyRule matches packets by destination subnet, transport
+// protocol and destination port.
+//
+// +stateify savable
+type NetworkPolicyRule struct {
+	// Action is the verdict for packets matching this rule.
+	Action NetworkPolicyAction
+
+	// Destination is the subnet that the destination address must be in.
+	Destination tcpip.Subnet
+
+	// Protocol is the transport protocol to match. Zero matches any protocol.
+	Protocol tcpip.TransportProtocolNumber
+
+	// StartPort and EndPort are the inclusive range of destination ports to
+	// match. If both are zero, any port matches. Ports are only meaningful for
+	// TCP and UDP.
+	StartPort uint16
+	EndPort   uint16
+}
+
+// hasPorts returns true if r is restricted to a range of ports.
+func (r *NetworkPolicyRule) hasPorts() bool {
+	return r.StartPort != 0 || r.EndPort != 0
+}
+
+// match returns true if r matches a packet to dst with the given transport
+// protocol and destination port. portKnown is false if the destination port
+// could not be determined, e.g. for a raw packet without a parsed transport
+// header.
+func (r *NetworkPolicyRule) match(dst tcpip.Address, proto tcpip.TransportProtocolNumber, port uint16, portKnown bool) bool {
+	if !r.Destination.Contains(dst) {
+		return false
+	}
+	if r.Protocol != 0 && r.Protocol != proto {
+		return false
+	}
+	if !r.hasPorts() {
+		return true
+	}
+	if !portKnown {
+		// Fail closed: a packet whose port is unknown may be headed to any
+		// port, so it is covered by deny rules but not by allow rules.
+		return r.Action == NetworkPolicyDeny
+	}
+	return r.StartPort <= port && port <= r.EndPort
+}
+
+// NetworkPolicy is a set of rules restricting the traffic that may leave the
+// stack. It is evaluated against every locally generated or forwarded packet
+// before iptables, and therefore matches the destination chosen by the sender
+// rather than one rewritten by NAT. Packets sent over loopback interfaces or
+// delivered locally are not subject to the policy.
+//
+// Packets written by packet sockets are also subject to the policy. Since
+// they bypass the network layer, they are only sent if they are IPv4 or IPv6
+// packets allowed by the rules, or ARP packets allowed by DefaultEgress.
+//
+// +stateify savable
+type NetworkPolicy struct {
+	// Egress is the ordered list of rules for outgoing packets. The first
+	// matching rule determines the verdict.
+	Egress []NetworkPolicyRule
+
+	// DefaultEgress is the verdict for outgoing packets that match no rule.
+	DefaultEgress NetworkPolicyAction
+}
+
+// Validate returns an error if p is malformed.
+func (p *NetworkPolicy) Validate() error {
+	for i, r := range p.Egress {
+		if r.Action != NetworkPolicyAllow && r.Action != NetworkPolicyDeny {
+			return fmt.Errorf("egress rule %d: invalid action %d", i, r.Action)
+		}
+		if r.StartPort > r.EndPort {
+			return fmt.Errorf("egress rule %d: invalid port range %d-%d", i, r.StartPort, r.EndPort)
+		}
+		if r.hasPorts() && r.Protocol != header.TCPProtocolNumber && r.Protocol != header.UDPProtocolNumber {
+			return fmt.Errorf("egress rule %d: ports require TCP or UDP protocol", i)
+		}
+	}
+	if p.DefaultEgress != NetworkPolicyAllow && p.DefaultEgress != NetworkPolicyDeny {
+		return fmt.Errorf("invalid default egress action %d", p.DefaultEgress)
+	}
+	return nil
+}
+
+// networkPolicyState holds the network policy of a Stack.
+//
+// +stateify savable
+type networkPolicyState struct {
+	// enabled is set when a policy is installed, so that stacks without a
+	// policy don't pay for locking on every packet.
+	enabled atomicbitops.Bool
+
+	mu networkPolicyRWMutex `state:"nosave"`
+	// +checklocks:mu
+	policy NetworkPolicy
+}
+
+// SetNetworkPolicy installs p as the stack's network policy, replacing any
+// previous policy. A nil p removes the policy.
+func (s *Stack) SetNetworkPolicy(p *NetworkPolicy) error {
+	if p != nil {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+	}
+	np := &s.networkPolicy
+	np.mu.Lock()
+	defer np.mu.Unlock()
+	if p == nil {
+		np.policy = NetworkPolicy{}
+		np.enabled.Store(false)
+		return nil
+	}
+	np.policy = NetworkPolicy{
+		Egress:        append([]NetworkPolicyRule(nil), p.Egress...),
+		DefaultEgress: p.DefaultEgress,
+	}
+	np.enabled.Store(true)
+	return nil
+}
+
+// NetworkPolicy returns a copy of the stack's network policy, or nil if none
+// is installed.
+func (s *Stack) NetworkPolicy() *NetworkPolicy {
+	np := &s.networkPolicy
+	np.mu.RLock()
+	defer np.mu.RUnlock()
+	if !np.enabled.Load() {
+		return nil
+	}
+	return &NetworkPolicy{
+		Egress:        append([]NetworkPolicyRule(nil), np.policy.Egress...),
+		DefaultEgress: np.policy.DefaultEgress,
+	}
+}
+
+// CheckNetworkPolicy evaluates the stack's network policy for a locally
+// generated or forwarded packet about to be sent using r.
+//
+// Returns true iff the packet may continue traversing the stack; the packet
+// must be dropped if false is returned.
+//
+// Precondition: The packet's network header must be set.
+func (s *Stack) CheckNetworkPolicy(r *Route, pkt *PacketBuffer) bool {
+	np := &s.networkPolicy
+	if !np.enabled.Load() {
+		return true
+	}
+	// Packets that don't leave the stack are not subject to the policy.
+	if r.outgoingNIC.IsLoopback() || r.Loop()&PacketOut == 0 {
+		return true
+	}
+
+	// Header-included packets from raw sockets may not have their transport
+	// protocol set, so fall back to the one in the network header.
+	var (
+		dst   tcpip.Address
+		proto = pkt.TransportProtocolNumber
+	)
+	switch pkt.NetworkProtocolNumber {
+	case header.IPv4ProtocolNumber:
+		h := header.IPv4(pkt.NetworkHeader().Slice())
+		dst = h.DestinationAddress()
+		if proto == 0 {
+			proto = h.TransportProtocol()
+		}
+	case header.IPv6ProtocolNumber:
+		h := header.IPv6(pkt.NetworkHeader().Slice())
+		dst = h.DestinationAddress()
+		if proto == 0 {
+			proto = h.TransportProtocol()
+		}
+	default:
+		return true
+	}
+
+	var (
+		port      uint16
+		portKnown bool
+	)
+	switch proto {
+	case header.TCPProtocolNumber:
+		if th := header.TCP(pkt.TransportHeader().Slice()); len(th) >= header.TCPMinimumSize {
+			port, portKnown = th.DestinationPort(), true
+		}
+	case header.UDPProtocolNumber:
+		if uh := header.UDP(pkt.TransportHeader().Slice()); len(uh) >= header.UDPMinimumSize {
+			port, portKnown = uh.DestinationPort(), true
+		}
+	}
+
+	return np.allowed(dst, proto, port, portKnown)
+}
+
+// allowed returns true if the policy allows a packet to dst with the given
+// transport protocol and destination port.
+func (np *networkPolicyState) allowed(dst tcpip.Address, proto tcpip.TransportProtocolNumber, port uint16, portKnown bool) bool {
+	np.mu.RLock()
+	defer np.mu.RUnlock()
+	for i := range np.policy.Egress {
+		if r := &np.policy.Egress[i]; r.match(dst, proto, port, portKnown) {
+			return r.Action == NetworkPolicyAllow
+		}
+	}
+	return np.policy.DefaultEgress == NetworkPolicyAllow
+}
+
+// checkLinkNetworkPolicy evaluates the stack's network policy for a packet
+// written directly to n by a packet socket, bypassing the network layer. The
+// packet's link header, if n uses one, must be set.
+//
+// Returns true iff the packet may be sent.
+func (s *Stack) checkLinkNetworkPolicy(n *nic, pkt *PacketBuffer) bool {
+	np := &s.networkPolicy
+	if !np.enabled.Load() || n.IsLoopback() {
+		return true
+	}
+
+	// The protocol that the receiver sees is determined by the packet's
+	// contents rather than by the protocol the socket was bound to.
+	var netProto tcpip.NetworkProtocolNumber
+	if eth := header.Ethernet(pkt.LinkHeader().Slice()); len(eth) >= header.EthernetMinimumSize {
+		netProto = eth.Type()
+	} else if b, ok := pkt.Data().PullUp(1); ok {
+		switch header.IPVersion(b) {
+		case header.IPv4Version:
+			netProto = header.IPv4ProtocolNumber
+		case header.IPv6Version:
+			netProto = header.IPv6ProtocolNumber
+		}
+	}
+
+	var (
+		dst       tcpip.Address
+		proto     tcpip.TransportProtocolNumber
+		transOff  int
+		port      uint16
+		portKnown bool
+	)
+	switch netProto {
+	case header.IPv4ProtocolNumber:
+		b, ok := pkt.Data().PullUp(header.IPv4MinimumSize)
+		if !ok {
+			return false
+		}
+		h := header.IPv4(b)
+		if int(h.HeaderLength()) < header.IPv4MinimumSize {
+			return false
+		}
+		dst = h.DestinationAddress()
+		proto = h.TransportProtocol()
+		if h.FragmentOffset() != 0 {
+			// Only the first fragment carries the transport header.
+			return np.allowed(dst, proto, 0, false)
+		}
+		transOff = int(h.HeaderLength())
+	case header.IPv6ProtocolNumber:
+		b, ok := pkt.Data().PullUp(header.IPv6MinimumSize)
+		if !ok {
+			return false
+		}
+		h := header.IPv6(b)
+		dst = h.DestinationAddress()
+		proto = h.TransportProtocol()
+		switch proto {
+		case header.TCPProtocolNumber, header.UDPProtocolNumber, header.ICMPv6ProtocolNumber:
+		default:
+			// Extension headers would hide the transport protocol from
+			// the rules, so fail closed.
+			return false
+		}
+		transOff = header.IPv6MinimumSize
+	case header.ARPProtocolNumber:
+		np.mu.RLock()
+		defer np.mu.RUnlock()
+		return np.policy.DefaultEgress == NetworkPolicyAllow
+	default:
+		return false
+	}
+
+	switch proto {
+	case header.TCPProtocolNumber:
+		if b, ok := pkt.Data().PullUp(transOff + header.TCPDstPortOffset + 2); ok {
+			port, portKnown = header.TCP(b[transOff:]).DestinationPort(), true
+		}
+	case header.UDPProtocolNumber:
+		if b, ok := pkt.Data().PullUp(transOff + header.UDPMinimumSize); ok {
+			port, portKnown = header.UDP(b[transOff:]).DestinationPort(), true
+		}
+	}
+	return np.allowed(dst, proto, port, portKnown)
+}
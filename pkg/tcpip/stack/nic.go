@@ -81,6 +81,16 @@ type nic struct {
 
 	qDisc QueueingDiscipline
 
+	// rootQDiscMu protects rootQDisc.
+	rootQDiscMu rootQDiscRWMutex `state:"nosave"`
+
+	// rootQDisc, if set, is the queueing discipline that outgoing packets go
+	// through before qDisc. It is set by Stack.SetNICRootQueueingDiscipline
+	// and is not saved.
+	//
+	// +checklocks:rootQDiscMu
+	rootQDisc QueueingDiscipline `state:"nosave"`
+
 	// deliverLinkPackets specifies whether this NIC delivers packets to
 	// packet sockets. It is immutable.
 	//
@@ -91,9 +101,22 @@ type nic struct {
 	// Primary is the main controlling interface in a bonded setup.
 	Primary *nic
 
+	// vlansMu protects vlans and the dispatchers of the endpoints in it.
+	vlansMu vlansRWMutex `state:"nosave"`
+
+	// vlans maps VLAN IDs to the endpoints of the VLAN sub-interfaces stacked
+	// on the NIC.
+	//
+	// +checklocks:vlansMu
+	vlans map[uint16]*VLANEndpoint
+
 	// experimentIPOptionEnabled indicates whether the NIC supports the
 	// experiment IP option.
 	experimentIPOptionEnabled bool
+
+	// rxQueues, if not nil, are the receive queues that inbound packets are
+	// steered to. See Options.RXQueues. It is immutable.
+	rxQueues *rxQueues
 }
 
 // makeNICStats initializes the NIC statistics and associates them to the global
@@ -158,12 +181,31 @@ func (*delegatingQueueingDiscipline) Close() {}
 
 // WritePacket passes the packet through to the underlying LinkWriter's WritePackets.
 func (qDisc *delegatingQueueingDiscipline) WritePacket(pkt *PacketBuffer) tcpip.Error {
-	var pkts PacketBufferList
+	pkts := NewPacketBufferList(1)
 	pkts.PushBack(pkt)
-	_, err := qDisc.LinkWriter.WritePackets(pkts)
+	_, err := qDisc.LinkWriter.WritePackets(*pkts)
+	pkts.Release()
 	return err
 }
 
+var _ LinkWriter = (*queueingDisciplineWriter)(nil)
+
+// queueingDisciplineWriter is a LinkWriter that writes packets to a
+// QueueingDiscipline.
+type queueingDisciplineWriter struct {
+	qDisc QueueingDiscipline
+}
+
+// WritePackets implements LinkWriter.WritePackets.
+func (w *queueingDisciplineWriter) WritePackets(pkts PacketBufferList) (int, tcpip.Error) {
+	for i, pkt := range pkts.AsSlice() {
+		if err := w.qDisc.WritePacket(pkt); err != nil {
+			return i, err
+		}
+	}
+	return pkts.Len(), nil
+}
+
 // newNIC returns a new NIC using the default NDP configurations from stack.
 func newNIC(stack *Stack, id tcpip.NICID, ep LinkEndpoint, opts NICOptions) *nic {
 	// TODO(b/141011931): Validate a LinkEndpoint (ep) is valid. For
@@ -195,6 +237,10 @@ func newNIC(stack *Stack, id tcpip.NICID, ep LinkEndpoint, opts NICOptions) *nic
 		experimentIPOptionEnabled: opts.EnableExperimentIPOption,
 	}
 	nic.linkResQueue.init(nic)
+	if stack.rxQueues > 1 && ep.Capabilities()&CapabilityLoopback == 0 {
+		nic.rxQueues = newRXQueues(nic, stack.rxQueues, stack.seed)
+		nic.rxQueues.start()
+	}
 
 	nic.packetEPsMu.Lock()
 	defer nic.packetEPsMu.Unlock()
@@ -336,6 +382,7 @@ func (n *nic) remove(closeLinkEndpoint bool) (func(), tcpip.Error) {
 
 	var deferAct func()
 	// Prevent packets from going down to the link before shutting the link down.
+	n.setRootQDisc(nil)
 	n.qDisc.Close()
 	n.NetworkLinkEndpoint.Attach(nil)
 	if closeLinkEndpoint {
@@ -346,6 +393,18 @@ func (n *nic) remove(closeLinkEndpoint bool) (func(), tcpip.Error) {
 		// operations.
 		deferAct = ep.Close
 	}
+	if rxQueues := n.rxQueues; rxQueues != nil {
+		// Packets being delivered by the queues can take netstack
+		// locks, so they must also be waited for without holding any.
+		rxQueues.close()
+		closeEP := deferAct
+		deferAct = func() {
+			rxQueues.wait()
+			if closeEP != nil {
+				closeEP()
+			}
+		}
+	}
 
 	return deferAct, nil
 }
@@ -398,6 +457,13 @@ func (n *nic) WritePacket(r *Route, pkt *PacketBuffer) tcpip.Error {
 
 // WritePacketToRemote implements NetworkInterface.
 func (n *nic) WritePacketToRemote(remoteLinkAddr tcpip.LinkAddress, pkt *PacketBuffer) tcpip.Error {
+	return n.writePacketToRemote(remoteLinkAddr, pkt, false /* checkPolicy */)
+}
+
+// writePacketToRemote writes pkt to remoteLinkAddr. If checkPolicy is true,
+// the packet was written by a packet socket and is subject to the stack's
+// network policy.
+func (n *nic) writePacketToRemote(remoteLinkAddr tcpip.LinkAddress, pkt *PacketBuffer, checkPolicy bool) tcpip.Error {
 	pkt.EgressRoute = RouteInfo{
 		routeInfo: routeInfo{
 			NetProto:         pkt.NetworkProtocolNumber,
@@ -405,7 +471,12 @@ func (n *nic) WritePacketToRemote(remoteLinkAddr tcpip.LinkAddress, pkt *PacketB
 		},
 		RemoteLinkAddress: remoteLinkAddr,
 	}
-	return n.writePacket(pkt)
+	n.NetworkLinkEndpoint.AddHeader(pkt)
+	if checkPolicy && !n.stack.checkLinkNetworkPolicy(n, pkt) {
+		n.stack.stats.IP.NetworkPolicyDropped.Increment()
+		return nil
+	}
+	return n.writeRawPacket(pkt)
 }
 
 func (n *nic) writePacket(pkt *PacketBuffer) tcpip.Error {
@@ -417,6 +488,10 @@ func (n *nic) writeRawPacketWithLinkHeaderInPayload(pkt *PacketBuffer) tcpip.Err
 	if !n.NetworkLinkEndpoint.ParseHeader(pkt) {
 		return &tcpip.ErrMalformedHeader{}
 	}
+	if !n.stack.checkLinkNetworkPolicy(n, pkt) {
+		n.stack.stats.IP.NetworkPolicyDropped.Increment()
+		return nil
+	}
 	return n.writeRawPacket(pkt)
 }
 
@@ -428,7 +503,13 @@ func (n *nic) writeRawPacket(pkt *PacketBuffer) tcpip.Error {
 		n.DeliverLinkPacket(pkt.NetworkProtocolNumber, pkt)
 	}
 
-	if err := n.qDisc.WritePacket(pkt); err != nil {
+	n.rootQDiscMu.RLock()
+	qDisc := n.rootQDisc
+	n.rootQDiscMu.RUnlock()
+	if qDisc == nil {
+		qDisc = n.qDisc
+	}
+	if err := qDisc.WritePacket(pkt); err != nil {
 		if _, ok := err.(*tcpip.ErrNoBufferSpace); ok {
 			n.stats.txPacketsDroppedNoBufferSpace.Increment()
 		}
@@ -440,6 +521,18 @@ func (n *nic) writeRawPacket(pkt *PacketBuffer) tcpip.Error {
 	return nil
 }
 
+// setRootQDisc replaces the NIC's root queueing discipline with qDisc, which
+// may be nil, and closes the previous one.
+func (n *nic) setRootQDisc(qDisc QueueingDiscipline) {
+	n.rootQDiscMu.Lock()
+	old := n.rootQDisc
+	n.rootQDisc = qDisc
+	n.rootQDiscMu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+}
+
 // setSpoofing enables or disables address spoofing.
 func (n *nic) setSpoofing(enable bool) {
 	n.spoofing.Store(enable)
@@ -747,7 +840,18 @@ func (n *nic) isInGroup(addr tcpip.Address) bool {
 // DeliverNetworkPacket finds the appropriate network protocol endpoint and
 // hands the packet over for further processing. This function is called when
 // the NIC receives a packet from the link endpoint.
+//
+// If the NIC has receive queues, the packet is queued and processed by the
+// goroutine of its queue instead.
 func (n *nic) DeliverNetworkPacket(protocol tcpip.NetworkProtocolNumber, pkt *PacketBuffer) {
+	if n.rxQueues != nil {
+		n.rxQueues.queuePacket(protocol, pkt)
+		return
+	}
+	n.deliverNetworkPacket(protocol, pkt)
+}
+
+func (n *nic) deliverNetworkPacket(protocol tcpip.NetworkProtocolNumber, pkt *PacketBuffer) {
 	enabled := n.Enabled()
 	// If the NIC is not yet enabled, don't receive any packets.
 	if !enabled {
@@ -759,6 +863,10 @@ func (n *nic) DeliverNetworkPacket(protocol tcpip.NetworkProtocolNumber, pkt *Pa
 	n.stats.rx.packets.Increment()
 	n.stats.rx.bytes.IncrementBy(uint64(pkt.Data().Size()))
 
+	if protocol == header.VLANProtocolNumber && n.deliverVLANPacket(pkt) {
+		return
+	}
+
 	networkEndpoint := n.getNetworkEndpoint(protocol)
 	if networkEndpoint == nil {
 		n.stats.unknownL3ProtocolRcvdPacketCounts.Increment(uint64(protocol))
@@ -550,12 +550,21 @@ func (d PacketData) Consume(size int) ([]byte, bool) {
 
 // ReadTo reads bytes from d to dst. It also removes these bytes from d
 // unless peek is true.
+//
+// If dst implements buffer.Writer, all of d is written with a single call.
 func (d PacketData) ReadTo(dst io.Writer, peek bool) (int, error) {
 	var (
 		err  error
 		done int
 	)
 	offset := d.pk.dataOffset()
+	if w, ok := dst.(buffer.Writer); ok {
+		done, err = w.WriteFromBuffer(&d.pk.buf, offset, int(d.pk.buf.Size())-offset)
+		if !peek {
+			d.pk.buf.TrimFront(int64(done))
+		}
+		return done, err
+	}
 	d.pk.buf.SubApply(offset, int(d.pk.buf.Size())-offset, func(v *buffer.View) {
 		if err != nil {
 			return
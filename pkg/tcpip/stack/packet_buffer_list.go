@@ -13,6 +13,10 @@
 
 package stack
 
+import (
+	"github.com/wilinz/gvisor/pkg/sync"
+)
+
 // PacketBufferList is a slice-backed list. All operations are O(1) unless
 // otherwise noted.
 //
@@ -85,3 +89,47 @@ func (pl PacketBufferList) DecRef() {
 		pb.DecRef()
 	}
 }
+
+// pbListTierCapacities are the capacities of the tiers of pooled
+// PacketBufferLists. The smallest tier serves lists built to write a single
+// packet, the larger ones the batches built by link endpoints and queueing
+// disciplines.
+var pbListTierCapacities = [...]int{1, 8, 64}
+
+// pbListPools are the pools of PacketBufferLists, one per tier in
+// pbListTierCapacities.
+var pbListPools [len(pbListTierCapacities)]sync.Pool
+
+// NewPacketBufferList returns an empty PacketBufferList that can hold at least
+// capacity packets without allocating. The list is taken from a pool, so that
+// lists that only live for the duration of a call or a batch don't allocate,
+// and should be returned to it with Release.
+func NewPacketBufferList(capacity int) *PacketBufferList {
+	for i, c := range pbListTierCapacities {
+		if capacity > c {
+			continue
+		}
+		if pl, ok := pbListPools[i].Get().(*PacketBufferList); ok {
+			return pl
+		}
+		return &PacketBufferList{pbs: make([]*PacketBuffer, 0, c)}
+	}
+	return &PacketBufferList{pbs: make([]*PacketBuffer, 0, capacity)}
+}
+
+// Release empties pl and returns it to the pool of the largest tier that its
+// storage can hold. It does not decrement the reference count of the packets
+// in pl; call Reset first if pl holds references to them.
+//
+// Preconditions: pl was returned by NewPacketBufferList and is not used
+// after Release.
+func (pl *PacketBufferList) Release() {
+	clear(pl.pbs)
+	pl.pbs = pl.pbs[:0]
+	for i := len(pbListTierCapacities) - 1; i >= 0; i-- {
+		if cap(pl.pbs) >= pbListTierCapacities[i] {
+			pbListPools[i].Put(pl)
+			return
+		}
+	}
+}
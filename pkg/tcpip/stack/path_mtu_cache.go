@@ -0,0 +1,193 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"bytes"
+	"sort"
+	"time"
+
+	"github.com/wilinz/gvisor/pkg/atomicbitops"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/header"
+)
+
+const (
+	// PathMTUExpiry is how long a path MTU learned from an ICMP message is
+	// used. Once it expires, the MTU of the outgoing interface is used again
+	// until the path MTU is learned again. This matches Linux's
+	// net.ipv4.route.mtu_expires.
+	PathMTUExpiry = 10 * time.Minute
+
+	// minIPv4PathMTU is the smallest path MTU learned for IPv4 destinations.
+	// Smaller values reported by ICMP messages are raised to it, like Linux's
+	// net.ipv4.route.min_pmtu. IPv6 destinations use header.IPv6MinimumMTU,
+	// per RFC 8201 section 4.
+	minIPv4PathMTU = 552
+
+	// maxPathMTUCacheEntries bounds the number of destinations in the path
+	// MTU cache.
+	maxPathMTUCacheEntries = 4096
+)
+
+// PathMTUEntry is an entry of the stack's path MTU cache.
+type PathMTUEntry struct {
+	// Destination is the remote address the path MTU applies to.
+	Destination tcpip.Address
+
+	// MTU is the size of the largest IP packet that can be sent to
+	// Destination without being fragmented.
+	MTU uint32
+
+	// Expires is the time left until the entry expires.
+	Expires time.Duration
+}
+
+type pathMTUCacheEntry struct {
+	mtu     uint32
+	expires tcpip.MonotonicTime
+}
+
+// pathMTUCache caches the path MTU of destinations, as learned from ICMP
+// Fragmentation Needed and ICMPv6 Packet Too Big messages (RFC 1191 and RFC
+// 8201). Unlike the MTU tracked by each TCP endpoint, entries outlive
+// connections, so that new connections to a destination start with its
+// path MTU instead of relearning it. Entries are keyed by destination
+// address, so the IPv4 and IPv6 addresses of a dual-stack host are tracked
+// separately.
+type pathMTUCache struct {
+	// size is the number of entries, so that lookups don't take any lock
+	// while the cache is empty.
+	size atomicbitops.Int32
+
+	mu pathMTUCacheRWMutex
+	// +checklocks:mu
+	entries map[tcpip.Address]pathMTUCacheEntry
+}
+
+// lookup returns the path MTU of addr, if it is known.
+func (c *pathMTUCache) lookup(clock tcpip.Clock, addr tcpip.Address) (uint32, bool) {
+	if c.size.Load() == 0 {
+		return 0, false
+	}
+	c.mu.RLock()
+	e, ok := c.entries[addr]
+	c.mu.RUnlock()
+	if !ok || !clock.NowMonotonic().Before(e.expires) {
+		return 0, false
+	}
+	return e.mtu, true
+}
+
+// evictLocked makes room for a new entry by removing expired entries, or the
+// entry expiring soonest if none has expired.
+//
+// +checklocks:c.mu
+func (c *pathMTUCache) evictLocked(now tcpip.MonotonicTime) {
+	var oldest tcpip.Address
+	var oldestExpires tcpip.MonotonicTime
+	found := false
+	for addr, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, addr)
+			continue
+		}
+		if !found || e.expires.Before(oldestExpires) {
+			oldest, oldestExpires, found = addr, e.expires, true
+		}
+	}
+	if len(c.entries) >= maxPathMTUCacheEntries && found {
+		delete(c.entries, oldest)
+	}
+}
+
+// UpdatePathMTU records that the path MTU to addr is mtu, as reported by an
+// ICMP Fragmentation Needed or ICMPv6 Packet Too Big message for a packet
+// sent by the stack. mtu is the size of the largest IP packet that can be
+// sent to addr, and is raised to the minimum MTU of addr's protocol.
+//
+// As required by RFC 1191 section 3 and RFC 8201 section 4, a valid entry is
+// never increased by a message; it must expire first.
+func (s *Stack) UpdatePathMTU(addr tcpip.Address, mtu uint32) {
+	minMTU := uint32(minIPv4PathMTU)
+	if addr.Len() == header.IPv6AddressSize {
+		minMTU = header.IPv6MinimumMTU
+	}
+	mtu = max(mtu, minMTU)
+
+	c := &s.pathMTUCache
+	now := s.clock.NowMonotonic()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[addr]
+	if ok && now.Before(e.expires) && e.mtu < mtu {
+		return
+	}
+	if c.entries == nil {
+		c.entries = make(map[tcpip.Address]pathMTUCacheEntry)
+	}
+	if !ok && len(c.entries) >= maxPathMTUCacheEntries {
+		c.evictLocked(now)
+	}
+	c.entries[addr] = pathMTUCacheEntry{
+		mtu:     mtu,
+		expires: now.Add(PathMTUExpiry),
+	}
+	c.size.Store(int32(len(c.entries)))
+}
+
+// PathMTU returns the path MTU of addr, if it is known.
+func (s *Stack) PathMTU(addr tcpip.Address) (uint32, bool) {
+	return s.pathMTUCache.lookup(s.clock, addr)
+}
+
+// PathMTUCache returns the valid entries of the stack's path MTU cache,
+// ordered by destination.
+func (s *Stack) PathMTUCache() []PathMTUEntry {
+	c := &s.pathMTUCache
+	now := s.clock.NowMonotonic()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entries := make([]PathMTUEntry, 0, len(c.entries))
+	for addr, e := range c.entries {
+		if !now.Before(e.expires) {
+			continue
+		}
+		entries = append(entries, PathMTUEntry{
+			Destination: addr,
+			MTU:         e.mtu,
+			Expires:     e.expires.Sub(now),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].Destination, entries[j].Destination
+		if a.Len() != b.Len() {
+			return a.Len() < b.Len()
+		}
+		return bytes.Compare(a.AsSlice(), b.AsSlice()) < 0
+	})
+	return entries
+}
+
+// FlushPathMTUCache removes all entries of the stack's path MTU cache, so
+// that path MTUs are relearned. Established TCP connections keep the MTU they
+// learned.
+func (s *Stack) FlushPathMTUCache() {
+	c := &s.pathMTUCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = nil
+	c.size.Store(0)
+}
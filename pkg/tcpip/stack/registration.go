@@ -60,6 +60,13 @@ type NetworkPacketInfo struct {
 
 	// IsForwardedPacket is true if the packet is being forwarded.
 	IsForwardedPacket bool
+
+	// TProxy is set by a TPROXY iptables target to the local address and
+	// port of the socket that should receive the packet, without changing
+	// the packet's destination. TProxy.Port is zero if the packet wasn't
+	// redirected, and TProxy.Addr is empty if the packet should be received
+	// by a socket bound to its destination address.
+	TProxy tcpip.FullAddress
 }
 
 // TransportErrorKind enumerates error types that are handled by the transport
@@ -99,6 +106,11 @@ const (
 	// DestinationHostDownTransportError indicates that the destination host is
 	// down.
 	DestinationHostDownTransportError
+
+	// TimeExceededTransportError indicates that a packet was discarded before
+	// reaching its destination because its TTL or hop limit was exceeded, or
+	// because it could not be reassembled in time.
+	TimeExceededTransportError
 )
 
 // TransportError is a marker interface for errors that may be handled by the
@@ -119,10 +131,12 @@ type TransportEndpoint interface {
 	// HandlePacket may modify the packet.
 	HandlePacket(TransportEndpointID, *PacketBuffer)
 
-	// HandleError is called when the transport endpoint receives an error.
+	// HandleError is called when the transport endpoint receives an error for
+	// a packet it sent. The TransportEndpointID identifies that packet, such
+	// that its remote address and port are the packet's destination.
 	//
 	// HandleError takes may modify the packet buffer.
-	HandleError(TransportError, *PacketBuffer)
+	HandleError(TransportEndpointID, TransportError, *PacketBuffer)
 
 	// Abort initiates an expedited endpoint teardown. It puts the endpoint
 	// in a closed state and frees all resources associated with it. This
@@ -235,6 +249,15 @@ type PacketMMapEndpoint interface {
 	// Stats returns the statistics for the endpoint that can be used for
 	// getsockopt(PACKET_STATISTICS).
 	Stats() tcpip.TpacketStats
+
+	// HasTxRing returns true if the endpoint has a TX ring buffer, in which
+	// case packets are sent from the ring with Transmit rather than from the
+	// payload passed to write calls.
+	HasTxRing() bool
+
+	// Transmit sends the frames queued in the TX ring buffer, passing each of
+	// them to write. It returns the total number of bytes sent.
+	Transmit(write func(payload buffer.Buffer) tcpip.Error) (int64, tcpip.Error)
 }
 
 // UnknownDestinationPacketDisposition enumerates the possible return values from
@@ -1148,6 +1171,8 @@ type LinkWriter interface {
 	//
 	// WritePackets may modify the packet buffers, and takes ownership of the PacketBufferList.
 	// it is not safe to use the PacketBufferList after a call to WritePackets.
+	// Implementations must not retain the PacketBufferList once WritePackets
+	// returns, as callers may reuse its storage.
 	WritePackets(PacketBufferList) (int, tcpip.Error)
 }
 
@@ -1426,6 +1451,9 @@ const (
 	// Hardware GSO types:
 	GSOTCPv4
 	GSOTCPv6
+	// GSOUDPL4 is used for UDP segmentation offload (UDP_SEGMENT), for
+	// both IPv4 and IPv6.
+	GSOUDPL4
 
 	// GSOGvisor is used for gVisor GSO segments which have to be sent by
 	// endpoint.WritePackets.
@@ -1479,6 +1507,26 @@ type GSOEndpoint interface {
 	SupportedGSO() SupportedGSO
 }
 
+// OffloadEndpoint is a LinkEndpoint on which the stack can enable offloads, as
+// configured by Options.GRO and Options.GVisorGSO. The methods are called
+// before the endpoint is attached.
+type OffloadEndpoint interface {
+	// EnableGRO enables generic receive offload of inbound packets.
+	EnableGRO()
+
+	// EnableGVisorGSO enables gVisor segmentation offload of outbound
+	// packets, unless the endpoint supports host segmentation offload.
+	EnableGVisorGSO()
+}
+
+// CarrierEndpoint is a LinkEndpoint that can lose its carrier, i.e. the
+// connection to the other end of its link, like a veth device whose peer is
+// gone. LinkEndpoints that don't implement it always have a carrier.
+type CarrierEndpoint interface {
+	// Carrier returns true if the link has a carrier.
+	Carrier() bool
+}
+
 // GVisorGSOMaxSize is a maximum allowed size of a software GSO segment.
 // This isn't a hard limit, because it is never set into packet headers.
 const GVisorGSOMaxSize = 1 << 16
@@ -523,11 +523,23 @@ func (r *Route) DefaultTTL() uint8 {
 }
 
 // MTU returns the MTU of the route if present, otherwise the MTU of the underlying network endpoint.
+// It is lowered to the path MTU of the remote address if the stack learned it.
 func (r *Route) MTU() uint32 {
-	if r.mtu > 0 {
-		return r.mtu
+	mtu := r.mtu
+	if mtu == 0 {
+		mtu = r.outgoingNIC.getNetworkEndpoint(r.NetProto()).MTU()
+	}
+	if pathMTU, ok := r.outgoingNIC.stack.PathMTU(r.RemoteAddress()); ok {
+		// The path MTU includes the network header.
+		hdrLen := uint32(header.IPv4MinimumSize)
+		if r.NetProto() == header.IPv6ProtocolNumber {
+			hdrLen = header.IPv6MinimumSize
+		}
+		if pathMTU > hdrLen {
+			mtu = min(mtu, pathMTU-hdrLen)
+		}
 	}
-	return r.outgoingNIC.getNetworkEndpoint(r.NetProto()).MTU()
+	return mtu
 }
 
 // Release decrements the reference counter of the resources associated with the
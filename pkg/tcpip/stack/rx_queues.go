@@ -0,0 +1,207 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"context"
+	"encoding/binary"
+
+	"github.com/wilinz/gvisor/pkg/sleep"
+	"github.com/wilinz/gvisor/pkg/sync"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/hash/jenkins"
+	"github.com/wilinz/gvisor/pkg/tcpip/header"
+)
+
+// rxQueue is a receive queue of a NIC, whose packets are delivered by a
+// dedicated goroutine.
+//
+// +stateify savable
+type rxQueue struct {
+	mu rxQueueMutex `state:"nosave"`
+	// +checklocks:mu
+	pkts PacketBufferList
+	// +checklocks:mu
+	closed bool
+
+	nic         *nic
+	sleeper     sleep.Sleeper
+	packetWaker sleep.Waker
+	closeWaker  sleep.Waker
+}
+
+func (q *rxQueue) start(wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer q.sleeper.Done()
+	for {
+		switch w := q.sleeper.Fetch(true); {
+		case w == &q.packetWaker:
+			q.deliverPackets()
+		case w == &q.closeWaker:
+			q.mu.Lock()
+			q.pkts.Reset()
+			q.mu.Unlock()
+			return
+		}
+	}
+}
+
+func (q *rxQueue) deliverPackets() {
+	q.mu.Lock()
+	for q.pkts.Len() > 0 {
+		pkt := q.pkts.PopFront()
+		q.mu.Unlock()
+		q.nic.deliverNetworkPacket(pkt.NetworkProtocolNumber, pkt)
+		pkt.DecRef()
+		q.mu.Lock()
+	}
+	q.mu.Unlock()
+}
+
+// rxQueues implements receive-side scaling for a NIC: inbound packets are
+// steered to one of several receive queues by a hash of their flow, and each
+// queue is processed by its own goroutine. Packets of a flow are always
+// steered to the same queue, so they are delivered in order.
+//
+// +stateify savable
+type rxQueues struct {
+	queues []rxQueue
+	seed   uint32
+	wg     sync.WaitGroup `state:"nosave"`
+}
+
+// newRXQueues returns n receive queues for nic. Their goroutines are started
+// by start.
+func newRXQueues(nic *nic, n int, seed uint32) *rxQueues {
+	r := &rxQueues{
+		queues: make([]rxQueue, n),
+		seed:   seed,
+	}
+	for i := range r.queues {
+		q := &r.queues[i]
+		q.nic = nic
+		q.sleeper.AddWaker(&q.packetWaker)
+		q.sleeper.AddWaker(&q.closeWaker)
+	}
+	return r
+}
+
+// start starts the goroutines of the queues.
+func (r *rxQueues) start() {
+	r.wg.Add(len(r.queues))
+	for i := range r.queues {
+		go r.queues[i].start(&r.wg)
+	}
+}
+
+// afterLoad is invoked by stateify.
+func (r *rxQueues) afterLoad(context.Context) {
+	r.start()
+}
+
+// close stops the goroutines of the queues. Packets that are still queued are
+// dropped, and packets queued afterwards are ignored.
+func (r *rxQueues) close() {
+	for i := range r.queues {
+		q := &r.queues[i]
+		q.mu.Lock()
+		q.closed = true
+		q.mu.Unlock()
+		q.closeWaker.Assert()
+	}
+}
+
+// wait waits for the goroutines of the queues to stop.
+func (r *rxQueues) wait() {
+	r.wg.Wait()
+}
+
+// queuePacket queues pkt to the receive queue of its flow.
+func (r *rxQueues) queuePacket(protocol tcpip.NetworkProtocolNumber, pkt *PacketBuffer) {
+	q := &r.queues[r.flowHash(protocol, pkt)%uint32(len(r.queues))]
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	pkt.NetworkProtocolNumber = protocol
+	q.pkts.PushBack(pkt.IncRef())
+	q.mu.Unlock()
+	q.packetWaker.Assert()
+}
+
+// flowHash returns the hash of the flow of pkt, which holds a packet of the
+// given network protocol. The flow is identified by the IP addresses and,
+// for TCP and UDP packets that aren't fragments, by the ports. Packets that
+// aren't IP packets, such as ARP packets, all hash to 0.
+func (r *rxQueues) flowHash(protocol tcpip.NetworkProtocolNumber, pkt *PacketBuffer) uint32 {
+	const portsLen = 4
+	var src, dst, ports []byte
+	switch protocol {
+	case header.IPv4ProtocolNumber:
+		h, ok := pkt.Data().PullUp(header.IPv4MinimumSize)
+		if !ok {
+			return 0
+		}
+		hdrLen := int(header.IPv4(h).HeaderLength())
+		if hdrLen < header.IPv4MinimumSize {
+			return 0
+		}
+		h, ok = pkt.Data().PullUp(hdrLen)
+		if !ok {
+			return 0
+		}
+		ipHdr := header.IPv4(h)
+		src, dst = ipHdr.SourceAddressSlice(), ipHdr.DestinationAddressSlice()
+		// All fragments of a packet must be reassembled by the same
+		// queue, so only hash the ports of packets that aren't fragments.
+		if hasPorts(ipHdr.TransportProtocol()) && !ipHdr.More() && ipHdr.FragmentOffset() == 0 {
+			if h, ok := pkt.Data().PullUp(hdrLen + portsLen); ok {
+				ports = h[hdrLen:]
+			}
+		}
+	case header.IPv6ProtocolNumber:
+		h, ok := pkt.Data().PullUp(header.IPv6MinimumSize)
+		if !ok {
+			return 0
+		}
+		ipHdr := header.IPv6(h)
+		src, dst = ipHdr.SourceAddressSlice(), ipHdr.DestinationAddressSlice()
+		// Packets with extension headers, including fragments, are only
+		// hashed by address.
+		if hasPorts(ipHdr.TransportProtocol()) {
+			if h, ok := pkt.Data().PullUp(header.IPv6MinimumSize + portsLen); ok {
+				ports = h[header.IPv6MinimumSize:]
+			}
+		}
+	default:
+		return 0
+	}
+
+	var p [2]byte
+	binary.LittleEndian.PutUint16(p[:], uint16(protocol))
+	h := jenkins.Sum32(r.seed)
+	h.Write(p[:])
+	h.Write(src)
+	h.Write(dst)
+	h.Write(ports)
+	return h.Sum32()
+}
+
+// hasPorts returns whether packets of the transport protocol start with
+// 16-bit source and destination ports.
+func hasPorts(proto tcpip.TransportProtocolNumber) bool {
+	return proto == header.TCPProtocolNumber || proto == header.UDPProtocolNumber
+}
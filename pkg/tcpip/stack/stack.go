@@ -25,6 +25,8 @@ import (
 	"fmt"
 	"io"
 	"math/rand"
+	"slices"
+	"sort"
 	"time"
 
 	"golang.org/x/time/rate"
@@ -92,6 +94,11 @@ type Stack struct {
 	// +checklocks:routeMu
 	routeTable tcpip.RouteList `state:"nosave"`
 
+	// routingRules is a list of routing rules sorted by priority, which
+	// select the route tables used by route lookups.
+	// +checklocks:routeMu
+	routingRules []tcpip.RoutingRule
+
 	mu stackRWMutex `state:"nosave"`
 	// +checklocks:mu
 	nics map[tcpip.NICID]*nic `state:"nosave"`
@@ -118,6 +125,12 @@ type Stack struct {
 	// TODO(gvisor.dev/issue/4595): S/R this field.
 	tables *IPTables `state:"nosave"`
 
+	// networkPolicy restricts outgoing traffic independently of tables.
+	networkPolicy networkPolicyState
+
+	// pathMTUCache holds the path MTUs learned from ICMP messages.
+	pathMTUCache pathMTUCache `state:"nosave"`
+
 	// restoredEndpoints is a list of endpoints that need to be restored if the
 	// stack is being restored.
 	restoredEndpoints []RestoredEndpoint
@@ -176,6 +189,15 @@ type Stack struct {
 
 	// saveRestoreEnabled indicates whether the stack is saved and restored.
 	saveRestoreEnabled bool
+
+	// gro and gvisorGSO are the offloads enabled on new NICs. See
+	// Options.GRO and Options.GVisorGSO.
+	gro       bool
+	gvisorGSO bool
+
+	// rxQueues is the number of receive queues of new NICs. See
+	// Options.RXQueues.
+	rxQueues int
 }
 
 // NetworkProtocolFactory instantiates a network protocol.
@@ -245,6 +267,26 @@ type Options struct {
 
 	// SecureRNG is a cryptographically secure random number generator.
 	SecureRNG io.Reader
+
+	// GRO enables generic receive offload on NICs whose link endpoint
+	// implements OffloadEndpoint.
+	GRO bool
+
+	// GVisorGSO enables gVisor segmentation offload on NICs whose link
+	// endpoint implements OffloadEndpoint.
+	GVisorGSO bool
+
+	// RXQueues, if greater than 1, is the number of receive queues of
+	// non-loopback NICs. Inbound packets are steered to a queue by a hash
+	// of their IP addresses and TCP or UDP ports, and each queue is
+	// processed by its own goroutine, so that packets of different flows
+	// can be processed on different cores. Otherwise, packets are
+	// processed by the goroutine of the link endpoint that delivers them.
+	//
+	// Link endpoints that already dispatch packets from several
+	// goroutines, like fdbased endpoints with several FDs or processors,
+	// don't need receive queues.
+	RXQueues int
 }
 
 // TransportEndpointInfo holds useful information about a transport endpoint
@@ -408,13 +450,24 @@ func New(opts Options) *Stack {
 		},
 		tcpInvalidRateLimit: defaultTCPInvalidRateLimit,
 		tsOffsetSecret:      secureRNG.Uint32(),
+		gro:                 opts.GRO,
+		gvisorGSO:           opts.GVisorGSO,
+		rxQueues:            opts.RXQueues,
 	}
 
-	// Add specified network protocols.
+	// Add specified network protocols, along with their default routing rules.
+	s.routeMu.Lock()
 	for _, netProtoFactory := range opts.NetworkProtocols {
 		netProto := netProtoFactory(s)
 		s.networkProtocols[netProto.Number()] = netProto
+		s.addRoutingRuleLocked(tcpip.RoutingRule{
+			Priority: MainRoutingRulePriority,
+			Protocol: netProto.Number(),
+			Action:   tcpip.RoutingRuleLookup,
+			Table:    tcpip.MainRouteTable,
+		})
 	}
+	s.routeMu.Unlock()
 
 	// Add specified transport protocols.
 	for _, transProtoFactory := range opts.TransportProtocols {
@@ -812,6 +865,55 @@ func (s *Stack) ReplaceRoute(route tcpip.Route) {
 	s.addRouteLocked(&route)
 }
 
+// MainRoutingRulePriority is the priority of the default routing rules, which
+// look up routes in the main route table. It is the priority that Linux uses
+// for the same rules.
+const MainRoutingRulePriority = 32766
+
+// SetRoutingRules replaces the stack's routing rules with rules.
+func (s *Stack) SetRoutingRules(rules []tcpip.RoutingRule) {
+	s.routeMu.Lock()
+	defer s.routeMu.Unlock()
+	s.routingRules = nil
+	for _, r := range rules {
+		s.addRoutingRuleLocked(r)
+	}
+}
+
+// GetRoutingRules returns the stack's routing rules, in the order they are
+// tried.
+func (s *Stack) GetRoutingRules() []tcpip.RoutingRule {
+	s.routeMu.RLock()
+	defer s.routeMu.RUnlock()
+	return append([]tcpip.RoutingRule(nil), s.routingRules...)
+}
+
+// AddRoutingRule adds a routing rule. It is tried after existing rules with the
+// same priority.
+func (s *Stack) AddRoutingRule(rule tcpip.RoutingRule) {
+	s.routeMu.Lock()
+	defer s.routeMu.Unlock()
+	s.addRoutingRuleLocked(rule)
+}
+
+// +checklocks:s.routeMu
+func (s *Stack) addRoutingRuleLocked(rule tcpip.RoutingRule) {
+	i := sort.Search(len(s.routingRules), func(i int) bool {
+		return s.routingRules[i].Priority > rule.Priority
+	})
+	s.routingRules = slices.Insert(s.routingRules, i, rule)
+}
+
+// RemoveRoutingRules removes matching routing rules, and returns the number of
+// rules that are removed.
+func (s *Stack) RemoveRoutingRules(match func(tcpip.RoutingRule) bool) int {
+	s.routeMu.Lock()
+	defer s.routeMu.Unlock()
+	n := len(s.routingRules)
+	s.routingRules = slices.DeleteFunc(s.routingRules, match)
+	return n - len(s.routingRules)
+}
+
 // NewEndpoint creates a new transport layer endpoint of the given protocol.
 func (s *Stack) NewEndpoint(transport tcpip.TransportProtocolNumber, network tcpip.NetworkProtocolNumber, waiterQueue *waiter.Queue) (tcpip.Endpoint, tcpip.Error) {
 	t, ok := s.transportProtocols[transport]
@@ -904,7 +1006,14 @@ func (s *Stack) GetNICByID(id tcpip.NICID) (*nic, tcpip.Error) {
 func (s *Stack) CreateNICWithOptions(id tcpip.NICID, ep LinkEndpoint, opts NICOptions) tcpip.Error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.createNICLocked(id, ep, opts)
+}
 
+// createNICLocked creates a NIC with the provided id, LinkEndpoint, and
+// NICOptions.
+//
+// +checklocks:s.mu
+func (s *Stack) createNICLocked(id tcpip.NICID, ep LinkEndpoint, opts NICOptions) tcpip.Error {
 	if id == 0 {
 		return &tcpip.ErrInvalidNICID{}
 	}
@@ -922,6 +1031,15 @@ func (s *Stack) CreateNICWithOptions(id tcpip.NICID, ep LinkEndpoint, opts NICOp
 		}
 	}
 
+	if oep, ok := ep.(OffloadEndpoint); ok {
+		if s.gro {
+			oep.EnableGRO()
+		}
+		if s.gvisorGSO {
+			oep.EnableGVisorGSO()
+		}
+	}
+
 	n := newNIC(s, id, ep, opts)
 	for proto := range s.defaultForwardingEnabled {
 		if _, err := n.setForwarding(proto, true); err != nil {
@@ -1030,6 +1148,29 @@ func (s *Stack) removeNICLocked(id tcpip.NICID) (func(), tcpip.Error) {
 		}
 	}
 
+	if ep, ok := nic.NetworkLinkEndpoint.(*VLANEndpoint); ok {
+		ep.parent.vlansMu.Lock()
+		delete(ep.parent.vlans, ep.id)
+		ep.parent.vlansMu.Unlock()
+	}
+
+	// Like Linux, remove the VLAN sub-interfaces stacked on the NIC along
+	// with it.
+	var deferActs []func()
+	if nic.hasVLANs() {
+		for vid, v := range s.nics {
+			if ep, ok := v.NetworkLinkEndpoint.(*VLANEndpoint); ok && ep.parent == nic {
+				deferAct, err := s.removeNICLocked(vid)
+				if err != nil {
+					return nil, err
+				}
+				if deferAct != nil {
+					deferActs = append(deferActs, deferAct)
+				}
+			}
+		}
+	}
+
 	// Remove routes in-place. n tracks the number of routes written.
 	s.routeMu.Lock()
 	for r := s.routeTable.Front(); r != nil; {
@@ -1041,7 +1182,18 @@ func (s *Stack) removeNICLocked(id tcpip.NICID) (func(), tcpip.Error) {
 	}
 	s.routeMu.Unlock()
 
-	return nic.remove(true /* closeLinkEndpoint */)
+	deferAct, err := nic.remove(true /* closeLinkEndpoint */)
+	if len(deferActs) == 0 {
+		return deferAct, err
+	}
+	if deferAct != nil {
+		deferActs = append(deferActs, deferAct)
+	}
+	return func() {
+		for _, deferAct := range deferActs {
+			deferAct()
+		}
+	}, err
 }
 
 // SetNICCoordinator sets a coordinator device.
@@ -1111,6 +1263,44 @@ func (s *Stack) SetNICMTU(id tcpip.NICID, mtu uint32) tcpip.Error {
 	return nil
 }
 
+// SetNICRootQueueingDiscipline sets the root queueing discipline of a NIC,
+// which outgoing packets go through before the queueing discipline the NIC was
+// created with. newQDisc is passed a LinkWriter that writes packets to the
+// latter. If newQDisc is nil, the root queueing discipline is removed.
+//
+// The previous root queueing discipline is closed, which drops the packets it
+// holds.
+func (s *Stack) SetNICRootQueueingDiscipline(id tcpip.NICID, newQDisc func(lower LinkWriter) QueueingDiscipline) tcpip.Error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nic, ok := s.nics[id]
+	if !ok {
+		return &tcpip.ErrUnknownNICID{}
+	}
+	var qDisc QueueingDiscipline
+	if newQDisc != nil {
+		qDisc = newQDisc(&queueingDisciplineWriter{qDisc: nic.qDisc})
+	}
+	nic.setRootQDisc(qDisc)
+	return nil
+}
+
+// NICRootQueueingDiscipline returns the root queueing discipline of a NIC set
+// by SetNICRootQueueingDiscipline, or nil if there is none.
+func (s *Stack) NICRootQueueingDiscipline(id tcpip.NICID) (QueueingDiscipline, tcpip.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nic, ok := s.nics[id]
+	if !ok {
+		return nil, &tcpip.ErrUnknownNICID{}
+	}
+	nic.rootQDiscMu.RLock()
+	defer nic.rootQDiscMu.RUnlock()
+	return nic.rootQDisc, nil
+}
+
 // NICInfo captures the name and addresses assigned to a NIC.
 type NICInfo struct {
 	Name              string
@@ -1146,6 +1336,35 @@ type NICInfo struct {
 	MulticastForwarding map[tcpip.NetworkProtocolNumber]bool
 }
 
+// NICStats returns the statistics of the NIC with the given ID. Unlike
+// NICInfo, it does not copy the rest of the NIC's state, so it is cheap enough
+// to call on every metrics scrape.
+func (s *Stack) NICStats(id tcpip.NICID) (tcpip.NICStats, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	nic, ok := s.nics[id]
+	if !ok {
+		return tcpip.NICStats{}, false
+	}
+	return nic.stats.local, true
+}
+
+// NICNetworkEndpointStats returns the statistics of the network endpoint for
+// proto bound to the NIC with the given ID.
+func (s *Stack) NICNetworkEndpointStats(id tcpip.NICID, proto tcpip.NetworkProtocolNumber) (NetworkEndpointStats, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	nic, ok := s.nics[id]
+	if !ok {
+		return nil, false
+	}
+	ep := nic.getNetworkEndpoint(proto)
+	if ep == nil {
+		return nil, false
+	}
+	return ep.Stats(), true
+}
+
 // HasNIC returns true if the NICID is defined in the stack.
 func (s *Stack) HasNIC(id tcpip.NICID) bool {
 	s.mu.RLock()
@@ -1182,6 +1401,9 @@ func (s *Stack) NICInfo() map[tcpip.NICID]NICInfo {
 			Promiscuous: nic.Promiscuous(),
 			Loopback:    nic.IsLoopback(),
 		}
+		if ep, ok := nic.NetworkLinkEndpoint.(CarrierEndpoint); ok {
+			flags.NoCarrier = !ep.Carrier()
+		}
 
 		netStats := make(map[tcpip.NetworkProtocolNumber]NetworkEndpointStats)
 		for proto, netEP := range nic.networkEndpoints {
@@ -1230,6 +1452,10 @@ type NICStateFlags struct {
 
 	// Loopback indicates whether the interface is a loopback.
 	Loopback bool
+
+	// NoCarrier indicates whether the link of the interface has lost its
+	// carrier. See CarrierEndpoint.
+	NoCarrier bool
 }
 
 // AddProtocolAddress adds an address to the specified NIC, possibly with extra
@@ -1301,10 +1527,13 @@ func (s *Stack) GetMainNICAddress(id tcpip.NICID, protocol tcpip.NetworkProtocol
 	return nic.PrimaryAddress(protocol)
 }
 
-func (s *Stack) getAddressEP(nic *nic, localAddr, remoteAddr, srcHint tcpip.Address, netProto tcpip.NetworkProtocolNumber) AssignableAddressEndpoint {
+func (s *Stack) getAddressEP(nic *nic, localAddr, remoteAddr, srcHint tcpip.Address, netProto tcpip.NetworkProtocolNumber, transparent bool) AssignableAddressEndpoint {
 	if localAddr.BitLen() == 0 {
 		return nic.primaryEndpoint(netProto, remoteAddr, srcHint)
 	}
+	if transparent {
+		return nic.getAddressOrCreateTempInner(netProto, localAddr, true /* createTemp */, CanBePrimaryEndpoint)
+	}
 	return nic.findEndpoint(netProto, localAddr, CanBePrimaryEndpoint)
 }
 
@@ -1321,7 +1550,7 @@ func (s *Stack) NewRouteForMulticast(nicID tcpip.NICID, remoteAddr tcpip.Address
 		return nil
 	}
 
-	if addressEndpoint := s.getAddressEP(nic, tcpip.Address{} /* localAddr */, remoteAddr, tcpip.Address{} /* srcHint */, netProto); addressEndpoint != nil {
+	if addressEndpoint := s.getAddressEP(nic, tcpip.Address{} /* localAddr */, remoteAddr, tcpip.Address{} /* srcHint */, netProto, false /* transparent */); addressEndpoint != nil {
 		return constructAndValidateRoute(netProto, addressEndpoint, nic, nic, tcpip.Address{} /* gateway */, tcpip.Address{} /* localAddr */, remoteAddr, s.handleLocal, false /* multicastLoop */, 0 /* mtu */)
 	}
 	return nil
@@ -1433,9 +1662,9 @@ func isNICForwarding(nic *nic, proto tcpip.NetworkProtocolNumber) bool {
 // endpoint.
 //
 // +checklocksread:s.mu
-func (s *Stack) findRouteWithLocalAddrFromAnyInterfaceRLocked(outgoingNIC *nic, localAddr, remoteAddr, srcHint, gateway tcpip.Address, netProto tcpip.NetworkProtocolNumber, multicastLoop bool, mtu uint32) *Route {
+func (s *Stack) findRouteWithLocalAddrFromAnyInterfaceRLocked(outgoingNIC *nic, localAddr, remoteAddr, srcHint, gateway tcpip.Address, netProto tcpip.NetworkProtocolNumber, multicastLoop, transparent bool, mtu uint32) *Route {
 	for _, aNIC := range s.nics {
-		addressEndpoint := s.getAddressEP(aNIC, localAddr, remoteAddr, srcHint, netProto)
+		addressEndpoint := s.getAddressEP(aNIC, localAddr, remoteAddr, srcHint, netProto, transparent)
 		if addressEndpoint == nil {
 			continue
 		}
@@ -1459,6 +1688,21 @@ func (s *Stack) findRouteWithLocalAddrFromAnyInterfaceRLocked(outgoingNIC *nic,
 // remote address is provided, the stack will use a remote address equal to the
 // local address.
 func (s *Stack) FindRoute(id tcpip.NICID, localAddr, remoteAddr tcpip.Address, netProto tcpip.NetworkProtocolNumber, multicastLoop bool) (*Route, tcpip.Error) {
+	return s.findRoute(id, localAddr, remoteAddr, netProto, multicastLoop, false /* transparent */)
+}
+
+// FindTransparentRoute is like FindRoute, but localAddr may be an address that
+// isn't assigned to any NIC, as is allowed for endpoints with the
+// IP_TRANSPARENT option set. Such routes use a temporary address endpoint on
+// the NIC that would be used to reach remoteAddr.
+func (s *Stack) FindTransparentRoute(id tcpip.NICID, localAddr, remoteAddr tcpip.Address, netProto tcpip.NetworkProtocolNumber, multicastLoop bool) (*Route, tcpip.Error) {
+	if localAddr.BitLen() == 0 || s.CheckLocalAddress(id, netProto, localAddr) != 0 {
+		return s.FindRoute(id, localAddr, remoteAddr, netProto, multicastLoop)
+	}
+	return s.findRoute(id, localAddr, remoteAddr, netProto, multicastLoop, true /* transparent */)
+}
+
+func (s *Stack) findRoute(id tcpip.NICID, localAddr, remoteAddr tcpip.Address, netProto tcpip.NetworkProtocolNumber, multicastLoop, transparent bool) (*Route, tcpip.Error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -1483,7 +1727,7 @@ func (s *Stack) FindRoute(id tcpip.NICID, localAddr, remoteAddr tcpip.Address, n
 	// through the interface if the interface is valid and enabled.
 	if id != 0 && !needRoute {
 		if nic, ok := s.nics[id]; ok && nic.Enabled() {
-			if addressEndpoint := s.getAddressEP(nic, localAddr, remoteAddr, tcpip.Address{} /* srcHint */, netProto); addressEndpoint != nil {
+			if addressEndpoint := s.getAddressEP(nic, localAddr, remoteAddr, tcpip.Address{} /* srcHint */, netProto, transparent); addressEndpoint != nil {
 				return makeRoute(
 					netProto,
 					tcpip.Address{}, /* gateway */
@@ -1507,65 +1751,45 @@ func (s *Stack) FindRoute(id tcpip.NICID, localAddr, remoteAddr tcpip.Address, n
 
 	onlyGlobalAddresses := !header.IsV6LinkLocalUnicastAddress(localAddr) && !isLinkLocal
 
-	// Find a route to the remote with the route table.
-	var chosenRoute tcpip.Route
+	// Find a route to the remote with the route tables selected by the routing
+	// rules.
+	var (
+		chosenRoute tcpip.Route
+		ruleErr     tcpip.Error
+	)
 	if r := func() *Route {
 		s.routeMu.RLock()
 		defer s.routeMu.RUnlock()
 
-		for route := s.routeTable.Front(); route != nil; route = route.Next() {
-			if remoteAddr.BitLen() != 0 && !route.Destination.Contains(remoteAddr) {
+		for i := range s.routingRules {
+			rule := &s.routingRules[i]
+			// Netstack doesn't support packet marks.
+			if !rule.Match(netProto, id, localAddr, remoteAddr, 0 /* mark */) {
 				continue
 			}
-
-			nic, ok := s.nics[route.NIC]
-			if !ok || !nic.Enabled() {
-				continue
+			switch rule.Action {
+			case tcpip.RoutingRuleUnreachable:
+				ruleErr = &tcpip.ErrNetworkUnreachable{}
+				return nil
+			case tcpip.RoutingRuleProhibit:
+				ruleErr = &tcpip.ErrNotPermitted{}
+				return nil
 			}
-
-			if id == 0 || id == route.NIC {
-				if addressEndpoint := s.getAddressEP(nic, localAddr, remoteAddr, route.SourceHint, netProto); addressEndpoint != nil {
-					var gateway tcpip.Address
-					if needRoute {
-						gateway = route.Gateway
-					}
-					r := constructAndValidateRoute(netProto, addressEndpoint, nic /* outgoingNIC */, nic /* outgoingNIC */, gateway, localAddr, remoteAddr, s.handleLocal, multicastLoop, route.MTU)
-					if r == nil {
-						panic(fmt.Sprintf("non-forwarding route validation failed with route table entry = %#v, id = %d, localAddr = %s, remoteAddr = %s", route, id, localAddr, remoteAddr))
-					}
-					return r
-				}
+			if r := s.findRouteInTableRLocked(rule, id, localAddr, remoteAddr, netProto, multicastLoop, transparent, needRoute, onlyGlobalAddresses, &chosenRoute); r != nil {
+				return r
 			}
-
-			// If the stack has forwarding enabled, we haven't found a valid route to
-			// the remote address yet, and we are routing locally generated traffic,
-			// keep track of the first valid route. We keep iterating because we
-			// prefer routes that let us use a local address that is assigned to the
-			// outgoing interface. There is no requirement to do this from any RFC
-			// but simply a choice made to better follow a strong host model which
-			// the netstack follows at the time of writing.
-			//
-			// Note that for incoming traffic that we are forwarding (for which the
-			// NIC and local address are unspecified), we do not keep iterating, as
-			// there is no reason to prefer routes that let us use a local address
-			// when routing forwarded (as opposed to locally-generated) traffic.
-			locallyGenerated := (id != 0 || localAddr != tcpip.Address{})
-			if onlyGlobalAddresses && chosenRoute.Equal(tcpip.Route{}) && isNICForwarding(nic, netProto) {
-				if locallyGenerated {
-					chosenRoute = *route
-					continue
-				}
-
-				if r := s.findRouteWithLocalAddrFromAnyInterfaceRLocked(nic, localAddr, remoteAddr, route.SourceHint, route.Gateway, netProto, multicastLoop, route.MTU); r != nil {
-					return r
-				}
+			// Like Linux, stop at the first table with a route to remoteAddr.
+			if !chosenRoute.Equal(tcpip.Route{}) {
+				return nil
 			}
 		}
-
 		return nil
 	}(); r != nil {
 		return r, nil
 	}
+	if ruleErr != nil {
+		return nil, ruleErr
+	}
 
 	if !chosenRoute.Equal(tcpip.Route{}) {
 		// At this point we know the stack has forwarding enabled since chosenRoute is
@@ -1584,7 +1808,7 @@ func (s *Stack) FindRoute(id tcpip.NICID, localAddr, remoteAddr tcpip.Address, n
 		// Use the specified NIC to get the local address endpoint.
 		if id != 0 {
 			if aNIC, ok := s.nics[id]; ok {
-				if addressEndpoint := s.getAddressEP(aNIC, localAddr, remoteAddr, chosenRoute.SourceHint, netProto); addressEndpoint != nil {
+				if addressEndpoint := s.getAddressEP(aNIC, localAddr, remoteAddr, chosenRoute.SourceHint, netProto, transparent); addressEndpoint != nil {
 					if r := constructAndValidateRoute(netProto, addressEndpoint, aNIC /* localAddressNIC */, nic /* outgoingNIC */, gateway, localAddr, remoteAddr, s.handleLocal, multicastLoop, chosenRoute.MTU); r != nil {
 						return r, nil
 					}
@@ -1598,7 +1822,7 @@ func (s *Stack) FindRoute(id tcpip.NICID, localAddr, remoteAddr tcpip.Address, n
 		if id == 0 {
 			// If an interface is not specified, try to find a NIC that holds the local
 			// address endpoint to construct a route.
-			if r := s.findRouteWithLocalAddrFromAnyInterfaceRLocked(nic, localAddr, remoteAddr, chosenRoute.SourceHint, gateway, netProto, multicastLoop, chosenRoute.MTU); r != nil {
+			if r := s.findRouteWithLocalAddrFromAnyInterfaceRLocked(nic, localAddr, remoteAddr, chosenRoute.SourceHint, gateway, netProto, multicastLoop, transparent, chosenRoute.MTU); r != nil {
 				return r, nil
 			}
 		}
@@ -1615,6 +1839,70 @@ func (s *Stack) FindRoute(id tcpip.NICID, localAddr, remoteAddr tcpip.Address, n
 	return nil, &tcpip.ErrNetworkUnreachable{}
 }
 
+// findRouteInTableRLocked looks for a route to remoteAddr in the table looked
+// up by rule. It returns the route if it finds one that uses a local address
+// assigned to the outgoing NIC. Otherwise, if chosenRoute is empty, it may set
+// it to the first route through a forwarding NIC, which findRoute uses if no
+// table yields a route.
+//
+// +checklocksread:s.mu
+// +checklocksread:s.routeMu
+func (s *Stack) findRouteInTableRLocked(rule *tcpip.RoutingRule, id tcpip.NICID, localAddr, remoteAddr tcpip.Address, netProto tcpip.NetworkProtocolNumber, multicastLoop, transparent, needRoute, onlyGlobalAddresses bool, chosenRoute *tcpip.Route) *Route {
+	for route := s.routeTable.Front(); route != nil; route = route.Next() {
+		if route.Table != rule.Table || route.Destination.Prefix() < rule.MinPrefixLen {
+			continue
+		}
+		if remoteAddr.BitLen() != 0 && !route.Destination.Contains(remoteAddr) {
+			continue
+		}
+
+		nic, ok := s.nics[route.NIC]
+		if !ok || !nic.Enabled() {
+			continue
+		}
+
+		if id == 0 || id == route.NIC {
+			if addressEndpoint := s.getAddressEP(nic, localAddr, remoteAddr, route.SourceHint, netProto, transparent); addressEndpoint != nil {
+				var gateway tcpip.Address
+				if needRoute {
+					gateway = route.Gateway
+				}
+				r := constructAndValidateRoute(netProto, addressEndpoint, nic /* outgoingNIC */, nic /* outgoingNIC */, gateway, localAddr, remoteAddr, s.handleLocal, multicastLoop, route.MTU)
+				if r == nil {
+					panic(fmt.Sprintf("non-forwarding route validation failed with route table entry = %#v, id = %d, localAddr = %s, remoteAddr = %s", route, id, localAddr, remoteAddr))
+				}
+				return r
+			}
+		}
+
+		// If the stack has forwarding enabled, we haven't found a valid route to
+		// the remote address yet, and we are routing locally generated traffic,
+		// keep track of the first valid route. We keep iterating because we
+		// prefer routes that let us use a local address that is assigned to the
+		// outgoing interface. There is no requirement to do this from any RFC
+		// but simply a choice made to better follow a strong host model which
+		// the netstack follows at the time of writing.
+		//
+		// Note that for incoming traffic that we are forwarding (for which the
+		// NIC and local address are unspecified), we do not keep iterating, as
+		// there is no reason to prefer routes that let us use a local address
+		// when routing forwarded (as opposed to locally-generated) traffic.
+		locallyGenerated := (id != 0 || localAddr != tcpip.Address{})
+		if onlyGlobalAddresses && chosenRoute.Equal(tcpip.Route{}) && isNICForwarding(nic, netProto) {
+			if locallyGenerated {
+				*chosenRoute = *route
+				continue
+			}
+
+			if r := s.findRouteWithLocalAddrFromAnyInterfaceRLocked(nic, localAddr, remoteAddr, route.SourceHint, route.Gateway, netProto, multicastLoop, transparent, route.MTU); r != nil {
+				return r
+			}
+		}
+	}
+
+	return nil
+}
+
 // CheckNetworkProtocol checks if a given network protocol is enabled in the
 // stack.
 func (s *Stack) CheckNetworkProtocol(protocol tcpip.NetworkProtocolNumber) bool {
@@ -1809,6 +2097,13 @@ func (s *Stack) UnregisterTransportEndpoint(netProtos []tcpip.NetworkProtocolNum
 	s.demux.unregisterEndpoint(netProtos, protocol, id, ep, flags, bindToDevice)
 }
 
+// SetReusePortFilter sets the filter used to select an endpoint from the
+// reuseport group that ep was registered in with the given id. A nil filter
+// restores hash-based selection.
+func (s *Stack) SetReusePortFilter(netProtos []tcpip.NetworkProtocolNumber, protocol tcpip.TransportProtocolNumber, id TransportEndpointID, ep TransportEndpoint, bindToDevice tcpip.NICID, f tcpip.ReusePortFilter) {
+	s.demux.setReusePortFilter(netProtos, protocol, id, ep, bindToDevice, f)
+}
+
 // StartTransportEndpointCleanup removes the endpoint with the given id from
 // the stack transport dispatcher. It also transitions it to the cleanup stage.
 func (s *Stack) StartTransportEndpointCleanup(netProtos []tcpip.NetworkProtocolNumber, protocol tcpip.TransportProtocolNumber, id TransportEndpointID, ep TransportEndpoint, flags ports.Flags, bindToDevice tcpip.NICID) {
@@ -1982,6 +2277,7 @@ func (s *Stack) ReplaceConfig(st *Stack) {
 
 	// Update route table.
 	s.SetRouteTable(st.GetRouteTable())
+	s.SetRoutingRules(st.GetRoutingRules())
 
 	// Update NICs.
 	nics := st.getNICs()
@@ -2089,7 +2385,8 @@ func (s *Stack) unregisterPacketEndpointLocked(nicID tcpip.NICID, netProto tcpip
 }
 
 // WritePacketToRemote writes a payload on the specified NIC using the provided
-// network protocol and remote link address.
+// network protocol and remote link address. The packet is subject to the
+// stack's network policy.
 func (s *Stack) WritePacketToRemote(nicID tcpip.NICID, remote tcpip.LinkAddress, netProto tcpip.NetworkProtocolNumber, payload buffer.Buffer) tcpip.Error {
 	s.mu.Lock()
 	nic, ok := s.nics[nicID]
@@ -2103,11 +2400,11 @@ func (s *Stack) WritePacketToRemote(nicID tcpip.NICID, remote tcpip.LinkAddress,
 	})
 	defer pkt.DecRef()
 	pkt.NetworkProtocolNumber = netProto
-	return nic.WritePacketToRemote(remote, pkt)
+	return nic.writePacketToRemote(remote, pkt, true /* checkPolicy */)
 }
 
 // WriteRawPacket writes data directly to the specified NIC without adding any
-// headers.
+// headers. The packet is subject to the stack's network policy.
 func (s *Stack) WriteRawPacket(nicID tcpip.NICID, proto tcpip.NetworkProtocolNumber, payload buffer.Buffer) tcpip.Error {
 	s.mu.RLock()
 	nic, ok := s.nics[nicID]
@@ -2263,6 +2560,14 @@ func (s *Stack) Seed() uint32 {
 	return s.seed
 }
 
+// FlowHash returns a hash of the flow identified by id, which is stable for
+// the lifetime of the stack. It is the hash used to dispatch the flow's
+// packets among endpoints bound with SO_REUSEPORT, so it can be used as a hint
+// by applications that shard flows, e.g. for SO_INCOMING_CPU.
+func (s *Stack) FlowHash(id TransportEndpointID) uint32 {
+	return flowHash(id, s.seed)
+}
+
 // InsecureRNG returns a reference to a pseudo random generator that can be used
 // to generate random numbers as required. It is not cryptographically secure
 // and should not be used for security sensitive work.
@@ -2378,17 +2683,46 @@ func (s *Stack) PacketEndpointWriteSupported() bool {
 }
 
 // SetNICStack moves the network device to the specified network namespace.
+//
+// The device keeps its name, context and link packet delivery setting, but
+// its addresses and routes are dropped, as in Linux. The move fails with
+// ErrDuplicateNICID if peer already has a device with the same name, in which
+// case the device is left in s.
 func (s *Stack) SetNICStack(id tcpip.NICID, peer *Stack) (tcpip.NICID, tcpip.Error) {
-	s.mu.Lock()
+	s.mu.RLock()
 	nic, ok := s.nics[id]
 	if !ok {
-		s.mu.Unlock()
+		s.mu.RUnlock()
 		return 0, &tcpip.ErrUnknownNICID{}
 	}
+	opts := NICOptions{
+		Name:                     nic.Name(),
+		Context:                  nic.context,
+		DeliverLinkPackets:       nic.deliverLinkPackets,
+		EnableExperimentIPOption: nic.experimentIPOptionEnabled,
+	}
+	s.mu.RUnlock()
 	if s == peer {
-		s.mu.Unlock()
 		return id, nil
 	}
+	// Check the name in peer before the NIC is removed from s, so that a
+	// conflict doesn't lose its configuration. The two stack locks are
+	// never held together to avoid lock order inversions between stacks.
+	if peer.hasNICName(opts.Name) {
+		return 0, &tcpip.ErrDuplicateNICID{}
+	}
+
+	s.mu.Lock()
+	if s.nics[id] != nic || nic.Name() != opts.Name {
+		// The NIC has been removed or renamed concurrently.
+		s.mu.Unlock()
+		return 0, &tcpip.ErrUnknownNICID{}
+	}
+	// VLAN sub-interfaces must be in the same stack as their parent.
+	if _, ok := nic.NetworkLinkEndpoint.(*VLANEndpoint); ok || nic.hasVLANs() {
+		s.mu.Unlock()
+		return 0, &tcpip.ErrNotSupported{}
+	}
 	delete(s.nics, id)
 
 	// Remove routes in-place. n tracks the number of routes written.
@@ -2403,8 +2737,31 @@ func (s *Stack) SetNICStack(id tcpip.NICID, peer *Stack) (tcpip.NICID, tcpip.Err
 		return 0, err
 	}
 
-	id = tcpip.NICID(peer.NextNICID())
-	return id, peer.CreateNICWithOptions(id, ne, NICOptions{Name: nic.Name()})
+	peerID := tcpip.NICID(peer.NextNICID())
+	if err := peer.CreateNICWithOptions(peerID, ne, opts); err != nil {
+		// A device with the same name has been added to peer
+		// concurrently. Put the device back, so that it isn't lost.
+		if rerr := s.CreateNICWithOptions(id, ne, opts); rerr != nil {
+			log.Warningf("failed to restore NIC %d (%s) after a failed move: %s", id, opts.Name, rerr)
+		}
+		return 0, err
+	}
+	return peerID, nil
+}
+
+// hasNICName returns true if the stack has a NIC with the specified name.
+func (s *Stack) hasNICName(name string) bool {
+	if name == "" {
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, n := range s.nics {
+		if n.Name() == name {
+			return true
+		}
+	}
+	return false
 }
 
 // EnableSaveRestore marks the saveRestoreEnabled to true.
@@ -42,6 +42,7 @@ import (
 	"github.com/wilinz/gvisor/pkg/tcpip/stack"
 	"github.com/wilinz/gvisor/pkg/tcpip/testutil"
 	"github.com/wilinz/gvisor/pkg/tcpip/transport/udp"
+	"github.com/wilinz/gvisor/pkg/waiter"
 )
 
 const (
@@ -1021,6 +1022,82 @@ func TestRemoveNIC(t *testing.T) {
 	}
 }
 
+// countingQDisc is a QueueingDiscipline that counts packets and writes them
+// to a lower LinkWriter.
+type countingQDisc struct {
+	lower   stack.LinkWriter
+	packets int
+	closed  bool
+}
+
+// WritePacket implements stack.QueueingDiscipline.WritePacket.
+func (q *countingQDisc) WritePacket(pkt *stack.PacketBuffer) tcpip.Error {
+	q.packets++
+	var pkts stack.PacketBufferList
+	pkts.PushBack(pkt)
+	_, err := q.lower.WritePackets(pkts)
+	return err
+}
+
+// Close implements stack.QueueingDiscipline.Close.
+func (q *countingQDisc) Close() {
+	q.closed = true
+}
+
+func TestNICRootQueueingDiscipline(t *testing.T) {
+	const nicID = 1
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocolFactory{fakeNetFactory},
+	})
+	ep := channel.New(10, defaultMTU, "")
+	if err := s.CreateNIC(nicID, ep); err != nil {
+		t.Fatalf("CreateNIC(%d, _) = %s", nicID, err)
+	}
+	write := func() {
+		t.Helper()
+		if err := s.WriteRawPacket(nicID, fakeNetNumber, buffer.MakeWithData([]byte{1, 2, 3})); err != nil {
+			t.Fatalf("WriteRawPacket(%d, ...) = %s", nicID, err)
+		}
+		if got := ep.Drain(); got != 1 {
+			t.Fatalf("got %d packets written to the link endpoint, want 1", got)
+		}
+	}
+
+	var qDisc *countingQDisc
+	if err := s.SetNICRootQueueingDiscipline(nicID, func(lower stack.LinkWriter) stack.QueueingDiscipline {
+		qDisc = &countingQDisc{lower: lower}
+		return qDisc
+	}); err != nil {
+		t.Fatalf("SetNICRootQueueingDiscipline(%d, _) = %s", nicID, err)
+	}
+	if got, err := s.NICRootQueueingDiscipline(nicID); err != nil || got != qDisc {
+		t.Fatalf("NICRootQueueingDiscipline(%d) = (%v, %v), want (%v, nil)", nicID, got, err, qDisc)
+	}
+	write()
+	if qDisc.packets != 1 {
+		t.Errorf("got %d packets through the root queueing discipline, want 1", qDisc.packets)
+	}
+
+	// Removing the root queueing discipline closes it.
+	if err := s.SetNICRootQueueingDiscipline(nicID, nil); err != nil {
+		t.Fatalf("SetNICRootQueueingDiscipline(%d, nil) = %s", nicID, err)
+	}
+	if !qDisc.closed {
+		t.Errorf("root queueing discipline not closed after being removed")
+	}
+	if got, err := s.NICRootQueueingDiscipline(nicID); err != nil || got != nil {
+		t.Fatalf("NICRootQueueingDiscipline(%d) = (%v, %v), want (nil, nil)", nicID, got, err)
+	}
+	write()
+	if qDisc.packets != 1 {
+		t.Errorf("got %d packets through the removed root queueing discipline, want 1", qDisc.packets)
+	}
+
+	if err := s.SetNICRootQueueingDiscipline(nicID+1, nil); err == nil {
+		t.Errorf("SetNICRootQueueingDiscipline succeeded for an unknown NIC")
+	}
+}
+
 func TestRouteWithDownNIC(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -2618,6 +2695,27 @@ func TestNICStats(t *testing.T) {
 		}
 		txPacketsTotal += want
 		txBytesTotal += actualTxLength
+
+		// NICStats must return the same counters as NICInfo.
+		stats, ok := s.NICStats(nicid)
+		if !ok {
+			t.Fatalf("s.NICStats(%d) not found", nicid)
+		}
+		if got, want := stats.Rx.Bytes.Value(), uint64(nic.rxByteCount); got != want {
+			t.Errorf("got s.NICStats(%d).Rx.Bytes.Value() = %d, want = %d", nicid, got, want)
+		}
+		if got, want := stats.Tx.Bytes.Value(), uint64(actualTxLength); got != want {
+			t.Errorf("got s.NICStats(%d).Tx.Bytes.Value() = %d, want = %d", nicid, got, want)
+		}
+		if _, ok := s.NICNetworkEndpointStats(nicid, fakeNetNumber); !ok {
+			t.Errorf("s.NICNetworkEndpointStats(%d, %d) not found", nicid, fakeNetNumber)
+		}
+		if _, ok := s.NICNetworkEndpointStats(nicid, fakeNetNumber-1); ok {
+			t.Errorf("s.NICNetworkEndpointStats(%d, %d) found for an unregistered protocol", nicid, fakeNetNumber-1)
+		}
+	}
+	if _, ok := s.NICStats(tcpip.NICID(len(nics) + 1)); ok {
+		t.Errorf("s.NICStats(%d) found for a nonexistent NIC", len(nics)+1)
 	}
 
 	// Now verify that each NIC stats was correctly aggregated at the stack level.
@@ -2675,6 +2773,57 @@ func TestNICContextPreservation(t *testing.T) {
 	}
 }
 
+func TestSetNICStack(t *testing.T) {
+	s := stack.New(stack.Options{})
+	peer := stack.New(stack.Options{})
+	defer func() {
+		s.Close()
+		s.Wait()
+		peer.Close()
+		peer.Wait()
+	}()
+
+	ctx := new(int)
+	ep := channel.New(0, 0, "\x00\x00\x00\x00\x00\x00")
+	opts := stack.NICOptions{Name: "eth0", Context: ctx}
+	if err := s.CreateNICWithOptions(1, ep, opts); err != nil {
+		t.Fatalf("s.CreateNICWithOptions(1, _, %+v) = %s", opts, err)
+	}
+
+	// A device with the same name in peer prevents the move.
+	peerEP := channel.New(0, 0, "\x00\x00\x00\x00\x00\x00")
+	if err := peer.CreateNICWithOptions(peer.NextNICID(), peerEP, stack.NICOptions{Name: "eth0"}); err != nil {
+		t.Fatalf("peer.CreateNICWithOptions(_, _, {Name: eth0}) = %s", err)
+	}
+	if _, err := s.SetNICStack(1, peer); !cmp.Equal(err, &tcpip.ErrDuplicateNICID{}) {
+		t.Fatalf("got s.SetNICStack(1, peer) = %v, want %s", err, &tcpip.ErrDuplicateNICID{})
+	}
+	if !s.HasNIC(1) {
+		t.Fatalf("NIC 1 was removed from s after a failed move")
+	}
+
+	if err := s.SetNICName(1, "eth1"); err != nil {
+		t.Fatalf("s.SetNICName(1, eth1) = %s", err)
+	}
+	id, err := s.SetNICStack(1, peer)
+	if err != nil {
+		t.Fatalf("s.SetNICStack(1, peer) = %s", err)
+	}
+	if s.HasNIC(1) {
+		t.Errorf("NIC 1 is still in s after the move")
+	}
+	info, ok := peer.NICInfo()[id]
+	if !ok {
+		t.Fatalf("NIC %d not found in peer", id)
+	}
+	if info.Name != "eth1" {
+		t.Errorf("got info.Name = %q, want eth1", info.Name)
+	}
+	if info.Context != ctx {
+		t.Errorf("got info.Context = %p, want %p", info.Context, ctx)
+	}
+}
+
 // TestNICAutoGenLinkLocalAddr tests the auto-generation of IPv6 link-local
 // addresses.
 func TestNICAutoGenLinkLocalAddr(t *testing.T) {
@@ -5816,3 +5965,316 @@ func TestFindRoute(t *testing.T) {
 		})
 	}
 }
+
+func TestRoutingRules(t *testing.T) {
+	const table = 100
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+	})
+	nicAddrs := map[tcpip.NICID]string{
+		1: "192.168.1.1",
+		2: "10.0.0.1",
+	}
+	for id, addr := range nicAddrs {
+		if err := s.CreateNIC(id, channel.New(1, defaultMTU, "")); err != nil {
+			t.Fatalf("CreateNIC(%d, _): %s", id, err)
+		}
+		protocolAddr := tcpip.ProtocolAddress{
+			Protocol: header.IPv4ProtocolNumber,
+			AddressWithPrefix: tcpip.AddressWithPrefix{
+				Address:   testutil.MustParse4(addr),
+				PrefixLen: 24,
+			},
+		}
+		if err := s.AddProtocolAddress(id, protocolAddr, stack.AddressProperties{}); err != nil {
+			t.Fatalf("AddProtocolAddress(%d, %+v, {}): %s", id, protocolAddr, err)
+		}
+	}
+	s.SetRouteTable([]tcpip.Route{
+		{Destination: testutil.MustParseSubnet4("192.168.1.0/24"), NIC: 1},
+		{Destination: testutil.MustParseSubnet4("0.0.0.0/0"), Gateway: testutil.MustParse4("192.168.1.254"), NIC: 1},
+		{Destination: testutil.MustParseSubnet4("0.0.0.0/0"), Gateway: testutil.MustParse4("10.0.0.254"), NIC: 2, Table: table},
+	})
+
+	// checkRoute checks that a route from local to remote goes through nic, or
+	// fails with wantErr if nic is zero.
+	checkRoute := func(t *testing.T, local, remote string, nic tcpip.NICID, wantErr tcpip.Error) {
+		t.Helper()
+		var localAddr tcpip.Address
+		if local != "" {
+			localAddr = testutil.MustParse4(local)
+		}
+		r, err := s.FindRoute(0, localAddr, testutil.MustParse4(remote), header.IPv4ProtocolNumber, false /* multicastLoop */)
+		if nic == 0 {
+			if !cmp.Equal(err, wantErr) {
+				t.Errorf("FindRoute(0, %q, %q, _, _) = (_, %v), want = (_, %v)", local, remote, err, wantErr)
+			}
+			if r != nil {
+				r.Release()
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("FindRoute(0, %q, %q, _, _): %s", local, remote, err)
+		}
+		defer r.Release()
+		if got := r.OutgoingNIC(); got != nic {
+			t.Errorf("FindRoute(0, %q, %q, _, _) got outgoing NIC %d, want %d", local, remote, got, nic)
+		}
+	}
+
+	t.Run("default rules use the main table", func(t *testing.T) {
+		checkRoute(t, "", "8.8.8.8", 1, nil)
+		checkRoute(t, "10.0.0.1", "8.8.8.8", 0, &tcpip.ErrHostUnreachable{})
+	})
+
+	t.Run("source rule", func(t *testing.T) {
+		s.AddRoutingRule(tcpip.RoutingRule{
+			Priority: 100,
+			Protocol: header.IPv4ProtocolNumber,
+			Source:   testutil.MustParseSubnet4("10.0.0.0/24"),
+			Table:    table,
+		})
+		checkRoute(t, "", "8.8.8.8", 1, nil)
+		checkRoute(t, "10.0.0.1", "8.8.8.8", 2, nil)
+	})
+
+	t.Run("empty table falls through", func(t *testing.T) {
+		s.AddRoutingRule(tcpip.RoutingRule{
+			Priority: 10,
+			Protocol: header.IPv4ProtocolNumber,
+			Table:    table + 1,
+		})
+		checkRoute(t, "", "8.8.8.8", 1, nil)
+	})
+
+	t.Run("marks", func(t *testing.T) {
+		// Lookups are done with a zero mark, so only the inverted rule matches.
+		s.AddRoutingRule(tcpip.RoutingRule{
+			Priority: 50,
+			Protocol: header.IPv4ProtocolNumber,
+			Mark:     0xca6c,
+			Mask:     0xffffffff,
+			Action:   tcpip.RoutingRuleProhibit,
+		})
+		checkRoute(t, "", "8.8.8.8", 1, nil)
+		s.AddRoutingRule(tcpip.RoutingRule{
+			Priority: 50,
+			Protocol: header.IPv4ProtocolNumber,
+			Mark:     0xca6c,
+			Mask:     0xffffffff,
+			Invert:   true,
+			Table:    table,
+		})
+		checkRoute(t, "", "8.8.8.8", 2, nil)
+	})
+
+	t.Run("suppressed prefix", func(t *testing.T) {
+		// The default route in the main table is ignored, so the lookup
+		// continues with the default route of table.
+		s.AddRoutingRule(tcpip.RoutingRule{
+			Priority:     5,
+			Protocol:     header.IPv4ProtocolNumber,
+			Table:        tcpip.MainRouteTable,
+			MinPrefixLen: 1,
+		})
+		s.AddRoutingRule(tcpip.RoutingRule{
+			Priority: 6,
+			Protocol: header.IPv4ProtocolNumber,
+			Table:    table,
+		})
+		checkRoute(t, "", "8.8.8.8", 2, nil)
+		checkRoute(t, "", "192.168.1.2", 1, nil)
+	})
+
+	t.Run("unreachable rule", func(t *testing.T) {
+		s.AddRoutingRule(tcpip.RoutingRule{
+			Priority:    1,
+			Protocol:    header.IPv4ProtocolNumber,
+			Destination: testutil.MustParseSubnet4("1.2.3.0/24"),
+			Action:      tcpip.RoutingRuleUnreachable,
+		})
+		checkRoute(t, "", "1.2.3.4", 0, &tcpip.ErrNetworkUnreachable{})
+		checkRoute(t, "", "8.8.8.8", 2, nil)
+	})
+
+	t.Run("rule order", func(t *testing.T) {
+		var got []uint32
+		for _, r := range s.GetRoutingRules() {
+			got = append(got, r.Priority)
+		}
+		want := []uint32{1, 5, 6, 10, 50, 50, 100, stack.MainRoutingRulePriority}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("rule priorities mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("remove rules", func(t *testing.T) {
+		if got := s.RemoveRoutingRules(func(r tcpip.RoutingRule) bool {
+			return r.Priority < stack.MainRoutingRulePriority
+		}); got != 7 {
+			t.Errorf("RemoveRoutingRules(_) = %d, want = 7", got)
+		}
+		checkRoute(t, "", "1.2.3.4", 1, nil)
+		checkRoute(t, "10.0.0.1", "8.8.8.8", 0, &tcpip.ErrHostUnreachable{})
+	})
+}
+
+func TestPathMTUCache(t *testing.T) {
+	const (
+		nicID   = 1
+		linkMTU = 1500
+	)
+	clock := faketime.NewManualClock()
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+		Clock:            clock,
+	})
+	if err := s.CreateNIC(nicID, channel.New(0, linkMTU, "")); err != nil {
+		t.Fatalf("CreateNIC(%d, _): %s", nicID, err)
+	}
+	localAddr := testutil.MustParse4("10.0.0.1")
+	protocolAddr := tcpip.ProtocolAddress{
+		Protocol:          ipv4.ProtocolNumber,
+		AddressWithPrefix: localAddr.WithPrefix(),
+	}
+	if err := s.AddProtocolAddress(nicID, protocolAddr, stack.AddressProperties{}); err != nil {
+		t.Fatalf("AddProtocolAddress(%d, %+v, {}): %s", nicID, protocolAddr, err)
+	}
+	s.SetRouteTable([]tcpip.Route{{Destination: header.IPv4EmptySubnet, NIC: nicID}})
+
+	remoteAddr := testutil.MustParse4("10.0.0.2")
+	otherAddr := testutil.MustParse4("10.0.0.3")
+	routeMTU := func(addr tcpip.Address) uint32 {
+		t.Helper()
+		r, err := s.FindRoute(nicID, localAddr, addr, ipv4.ProtocolNumber, false /* multicastLoop */)
+		if err != nil {
+			t.Fatalf("FindRoute(%d, %s, %s, %d, false): %s", nicID, localAddr, addr, ipv4.ProtocolNumber, err)
+		}
+		defer r.Release()
+		return r.MTU()
+	}
+	if got, want := routeMTU(remoteAddr), uint32(linkMTU-header.IPv4MinimumSize); got != want {
+		t.Fatalf("got initial route MTU = %d, want = %d", got, want)
+	}
+
+	// Routes to the destination use the path MTU, including new ones.
+	s.UpdatePathMTU(remoteAddr, 1400)
+	if got, want := routeMTU(remoteAddr), uint32(1400-header.IPv4MinimumSize); got != want {
+		t.Errorf("got route MTU = %d, want = %d", got, want)
+	}
+	if got, want := routeMTU(otherAddr), uint32(linkMTU-header.IPv4MinimumSize); got != want {
+		t.Errorf("got route MTU to other destination = %d, want = %d", got, want)
+	}
+
+	// The path MTU is never increased, and doesn't go below the minimum.
+	s.UpdatePathMTU(remoteAddr, 1450)
+	if got, ok := s.PathMTU(remoteAddr); !ok || got != 1400 {
+		t.Errorf("got PathMTU(%s) = (%d, %t), want = (1400, true)", remoteAddr, got, ok)
+	}
+	s.UpdatePathMTU(remoteAddr, 68)
+	if got, ok := s.PathMTU(remoteAddr); !ok || got != 552 {
+		t.Errorf("got PathMTU(%s) = (%d, %t), want = (552, true)", remoteAddr, got, ok)
+	}
+
+	s.UpdatePathMTU(otherAddr, 1300)
+	want := []stack.PathMTUEntry{
+		{Destination: remoteAddr, MTU: 552, Expires: stack.PathMTUExpiry},
+		{Destination: otherAddr, MTU: 1300, Expires: stack.PathMTUExpiry},
+	}
+	if diff := cmp.Diff(want, s.PathMTUCache()); diff != "" {
+		t.Errorf("PathMTUCache() mismatch (-want +got):\n%s", diff)
+	}
+
+	// Entries expire.
+	clock.Advance(stack.PathMTUExpiry)
+	if got, ok := s.PathMTU(remoteAddr); ok {
+		t.Errorf("got PathMTU(%s) = (%d, true) after expiry, want = (_, false)", remoteAddr, got)
+	}
+	if got, want := routeMTU(remoteAddr), uint32(linkMTU-header.IPv4MinimumSize); got != want {
+		t.Errorf("got route MTU after expiry = %d, want = %d", got, want)
+	}
+
+	s.UpdatePathMTU(remoteAddr, 1400)
+	s.FlushPathMTUCache()
+	if got := s.PathMTUCache(); len(got) != 0 {
+		t.Errorf("got PathMTUCache() = %+v after flush, want = []", got)
+	}
+}
+
+func TestRXQueues(t *testing.T) {
+	const (
+		nicID      = 1
+		rxQueues   = 4
+		flows      = 8
+		flowPkts   = 16
+		srcPortMin = 1000
+	)
+	s := stack.New(stack.Options{
+		NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+		TransportProtocols: []stack.TransportProtocolFactory{udp.NewProtocol},
+		RXQueues:           rxQueues,
+	})
+	defer s.Destroy()
+	linkEP := channel.New(0, defaultMTU, "")
+	if err := s.CreateNIC(nicID, linkEP); err != nil {
+		t.Fatalf("CreateNIC(%d, _): %s", nicID, err)
+	}
+	protocolAddr := tcpip.ProtocolAddress{
+		Protocol:          ipv4.ProtocolNumber,
+		AddressWithPrefix: testDstAddrV4.WithPrefix(),
+	}
+	if err := s.AddProtocolAddress(nicID, protocolAddr, stack.AddressProperties{}); err != nil {
+		t.Fatalf("AddProtocolAddress(%d, %+v, {}): %s", nicID, protocolAddr, err)
+	}
+	c := &testContext{
+		s:       s,
+		linkEps: map[tcpip.NICID]*channel.Endpoint{nicID: linkEP},
+	}
+
+	ep, err := s.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &c.wq)
+	if err != nil {
+		t.Fatalf("NewEndpoint(...): %s", err)
+	}
+	defer ep.Close()
+	ep.SocketOptions().SetReceiveBufferSize(1<<20, false /* notify */)
+	if err := ep.Bind(tcpip.FullAddress{Port: testDstPort}); err != nil {
+		t.Fatalf("Bind(...): %s", err)
+	}
+	we, ch := waiter.NewChannelEntry(waiter.ReadableEvents)
+	c.wq.EventRegister(&we)
+	defer c.wq.EventUnregister(&we)
+
+	// Interleave the packets of the flows. Each payload holds the index of
+	// the packet in its flow.
+	for i := 0; i < flowPkts; i++ {
+		for f := 0; f < flows; f++ {
+			c.sendV4Packet([]byte{byte(i)}, &headers{srcPort: srcPortMin + uint16(f), dstPort: testDstPort}, nicID)
+		}
+	}
+
+	// The packets of each flow are received in order.
+	next := make(map[uint16]byte)
+	timeout := time.After(5 * time.Second)
+	for received := 0; received < flows*flowPkts; {
+		var buf bytes.Buffer
+		res, err := ep.Read(&buf, tcpip.ReadOptions{NeedRemoteAddr: true})
+		if _, ok := err.(*tcpip.ErrWouldBlock); ok {
+			select {
+			case <-ch:
+			case <-timeout:
+				t.Fatalf("timed out after receiving %d packets, want %d", received, flows*flowPkts)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Read(...): %s", err)
+		}
+		port := res.RemoteAddr.Port
+		if got, want := buf.Bytes(), []byte{next[port]}; !bytes.Equal(got, want) {
+			t.Fatalf("got packet %v from port %d, want %v", got, port, want)
+		}
+		next[port]++
+		received++
+	}
+}
@@ -136,6 +136,26 @@ func (eps *transportEndpoints) findEndpointLocked(id TransportEndpointID) *endpo
 	return matchedEP
 }
 
+// findTProxyEndpointLocked returns the endpoint that should receive a packet
+// with the given id that was redirected to tproxy by a TPROXY target. As in
+// Linux, an endpoint connected to the packet's source and destination takes
+// precedence, so that redirected connections keep reaching the endpoints they
+// were accepted by. Otherwise, the packet is delivered to the endpoint that
+// would receive packets addressed to tproxy.
+//
+// +checklocksread:eps.mu
+func (eps *transportEndpoints) findTProxyEndpointLocked(id TransportEndpointID, tproxy tcpip.FullAddress) *endpointsByNIC {
+	if ep, ok := eps.endpoints[id]; ok {
+		return ep
+	}
+	tid := id
+	tid.LocalPort = tproxy.Port
+	if tproxy.Addr.BitLen() != 0 {
+		tid.LocalAddress = tproxy.Addr
+	}
+	return eps.findEndpointLocked(tid)
+}
+
 // +stateify savable
 type endpointsByNIC struct {
 	// seed is a random secret for a jenkins hash.
@@ -178,7 +198,7 @@ func (epsByNIC *endpointsByNIC) handlePacket(id TransportEndpointID, pkt *Packet
 		return true
 	}
 	// multiPortEndpoints are guaranteed to have at least one element.
-	transEP := mpep.selectEndpoint(id, epsByNIC.seed)
+	transEP := mpep.selectEndpoint(id, epsByNIC.seed, pkt)
 	if queuedProtocol, mustQueue := mpep.demux.queuedProtocols[protocolIDs{mpep.netProto, mpep.transProto}]; mustQueue {
 		queuedProtocol.QueuePacket(transEP, id, pkt)
 		epsByNIC.mu.RUnlock()
@@ -207,10 +227,10 @@ func (epsByNIC *endpointsByNIC) handleError(n *nic, id TransportEndpointID, tran
 	// broadcast like we are doing with handlePacket above?
 
 	// multiPortEndpoints are guaranteed to have at least one element.
-	transEP := mpep.selectEndpoint(id, epsByNIC.seed)
+	transEP := mpep.selectEndpoint(id, epsByNIC.seed, nil /* pkt */)
 	epsByNIC.mu.RUnlock()
 
-	transEP.HandleError(transErr, pkt)
+	transEP.HandleError(id, transErr, pkt)
 }
 
 // registerEndpoint returns true if it succeeds. It fails and returns
@@ -251,6 +271,15 @@ func (epsByNIC *endpointsByNIC) checkEndpoint(flags ports.Flags, bindToDevice tc
 	return multiPortEp.singleCheckEndpoint(flags)
 }
 
+// setReusePortFilter sets the reuseport filter of the group containing t.
+func (epsByNIC *endpointsByNIC) setReusePortFilter(bindToDevice tcpip.NICID, t TransportEndpoint, f tcpip.ReusePortFilter) {
+	epsByNIC.mu.RLock()
+	defer epsByNIC.mu.RUnlock()
+	if multiPortEp, ok := epsByNIC.endpoints[bindToDevice]; ok {
+		multiPortEp.setReusePortFilter(t, f)
+	}
+}
+
 // unregisterEndpoint returns true if endpointsByNIC has to be unregistered.
 func (epsByNIC *endpointsByNIC) unregisterEndpoint(bindToDevice tcpip.NICID, t TransportEndpoint, flags ports.Flags) bool {
 	epsByNIC.mu.Lock()
@@ -357,6 +386,13 @@ type multiPortEndpoint struct {
 	//
 	// +checklocks:mu
 	endpoints []TransportEndpoint
+
+	// filter, if set, selects the endpoint that receives a packet when the
+	// endpoints are load balanced. Like in Linux, the filter belongs to the
+	// group rather than to the socket which attached it.
+	//
+	// +checklocks:mu
+	filter tcpip.ReusePortFilter
 }
 
 func (ep *multiPortEndpoint) transportEndpoints() []TransportEndpoint {
@@ -377,7 +413,10 @@ func reciprocalScale(val, n uint32) uint32 {
 // selectEndpoint calculates a hash of destination and source addresses and
 // ports then uses it to select a socket. In this case, all packets from one
 // address will be sent to same endpoint.
-func (ep *multiPortEndpoint) selectEndpoint(id TransportEndpointID, seed uint32) TransportEndpoint {
+//
+// If a reuseport filter is attached and pkt is not nil, the filter is run on
+// the packet's payload first, and its result is used if it is a valid index.
+func (ep *multiPortEndpoint) selectEndpoint(id TransportEndpointID, seed uint32, pkt *PacketBuffer) TransportEndpoint {
 	ep.mu.RLock()
 	defer ep.mu.RUnlock()
 
@@ -389,6 +428,19 @@ func (ep *multiPortEndpoint) selectEndpoint(id TransportEndpointID, seed uint32)
 		return ep.endpoints[len(ep.endpoints)-1]
 	}
 
+	if ep.filter != nil && pkt != nil {
+		if idx := ep.filter.SelectEndpoint(pkt.Data().AsRange().ToSlice()); idx < uint32(len(ep.endpoints)) {
+			return ep.endpoints[idx]
+		}
+	}
+
+	idx := reciprocalScale(flowHash(id, seed), uint32(len(ep.endpoints)))
+	return ep.endpoints[idx]
+}
+
+// flowHash returns the jenkins hash of the flow identified by id, which is
+// used to dispatch the flow's packets among endpoints bound with SO_REUSEPORT.
+func flowHash(id TransportEndpointID, seed uint32) uint32 {
 	payload := []byte{
 		byte(id.LocalPort),
 		byte(id.LocalPort >> 8),
@@ -400,10 +452,7 @@ func (ep *multiPortEndpoint) selectEndpoint(id TransportEndpointID, seed uint32)
 	h.Write(payload)
 	h.Write(id.LocalAddress.AsSlice())
 	h.Write(id.RemoteAddress.AsSlice())
-	hash := h.Sum32()
-
-	idx := reciprocalScale(hash, uint32(len(ep.endpoints)))
-	return ep.endpoints[idx]
+	return h.Sum32()
 }
 
 func (ep *multiPortEndpoint) handlePacketAll(id TransportEndpointID, pkt *PacketBuffer) {
@@ -464,6 +513,19 @@ func (ep *multiPortEndpoint) singleCheckEndpoint(flags ports.Flags) tcpip.Error
 	return nil
 }
 
+// setReusePortFilter sets the reuseport filter of the group if t is one of
+// its endpoints.
+func (ep *multiPortEndpoint) setReusePortFilter(t TransportEndpoint, f tcpip.ReusePortFilter) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	for _, endpoint := range ep.endpoints {
+		if endpoint == t {
+			ep.filter = f
+			return
+		}
+	}
+}
+
 // unregisterEndpoint returns true if multiPortEndpoint has to be unregistered.
 func (ep *multiPortEndpoint) unregisterEndpoint(t TransportEndpoint, flags ports.Flags) bool {
 	ep.mu.Lock()
@@ -549,6 +611,23 @@ func (d *transportDemuxer) unregisterEndpoint(netProtos []tcpip.NetworkProtocolN
 	}
 }
 
+// setReusePortFilter sets the reuseport filter of the group that ep was
+// registered in with the given id.
+func (d *transportDemuxer) setReusePortFilter(netProtos []tcpip.NetworkProtocolNumber, protocol tcpip.TransportProtocolNumber, id TransportEndpointID, ep TransportEndpoint, bindToDevice tcpip.NICID, f tcpip.ReusePortFilter) {
+	for _, n := range netProtos {
+		eps, ok := d.protocol[protocolIDs{n, protocol}]
+		if !ok {
+			continue
+		}
+		eps.mu.RLock()
+		epsByNIC, ok := eps.endpoints[id]
+		eps.mu.RUnlock()
+		if ok {
+			epsByNIC.setReusePortFilter(bindToDevice, ep, f)
+		}
+	}
+}
+
 // deliverPacket attempts to find one or more matching transport endpoints, and
 // then, if matches are found, delivers the packet to them. Returns true if
 // the packet no longer needs to be handled.
@@ -592,7 +671,12 @@ func (d *transportDemuxer) deliverPacket(protocol tcpip.TransportProtocolNumber,
 	}
 
 	eps.mu.RLock()
-	ep := eps.findEndpointLocked(id)
+	var ep *endpointsByNIC
+	if pkt.NetworkPacketInfo.TProxy.Port != 0 {
+		ep = eps.findTProxyEndpointLocked(id, pkt.NetworkPacketInfo.TProxy)
+	} else {
+		ep = eps.findEndpointLocked(id)
+	}
 	eps.mu.RUnlock()
 	if ep == nil {
 		if protocol == header.UDPProtocolNumber {
@@ -681,7 +765,7 @@ func (d *transportDemuxer) findTransportEndpoint(netProto tcpip.NetworkProtocolN
 		}
 	}
 
-	ep := mpep.selectEndpoint(id, epsByNIC.seed)
+	ep := mpep.selectEndpoint(id, epsByNIC.seed, nil /* pkt */)
 	epsByNIC.mu.RUnlock()
 	return ep
 }
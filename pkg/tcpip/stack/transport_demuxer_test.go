@@ -455,3 +455,89 @@ func TestBindToDeviceDistribution(t *testing.T) {
 		}
 	}
 }
+
+// firstByteFilter is a tcpip.ReusePortFilter which selects the endpoint whose
+// index is the first byte of the payload.
+type firstByteFilter struct{}
+
+// SelectEndpoint implements tcpip.ReusePortFilter.SelectEndpoint.
+func (firstByteFilter) SelectEndpoint(payload []byte) uint32 {
+	if len(payload) == 0 {
+		return 0
+	}
+	return uint32(payload[0])
+}
+
+func TestReusePortFilter(t *testing.T) {
+	const nEndpoints = 3
+	for _, test := range []struct {
+		name string
+		// attachBeforeBind attaches the filter to the first endpoint before it
+		// is bound.
+		attachBeforeBind bool
+	}{
+		{name: "AttachAfterBind"},
+		{name: "AttachBeforeBind", attachBeforeBind: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := newDualTestContextMultiNIC(t, defaultMTU, []tcpip.NICID{1})
+
+			var eps []tcpip.Endpoint
+			var wqs [nEndpoints]waiter.Queue
+			for i := range wqs {
+				ep, err := c.s.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &wqs[i])
+				if err != nil {
+					t.Fatalf("NewEndpoint failed: %s", err)
+				}
+				t.Cleanup(ep.Close)
+				ep.SocketOptions().SetReusePort(true)
+				if i == 0 && test.attachBeforeBind {
+					ep.SocketOptions().SetReusePortFilter(firstByteFilter{})
+				}
+				if err := ep.Bind(tcpip.FullAddress{Addr: testDstAddrV4, Port: testDstPort}); err != nil {
+					t.Fatalf("ep.Bind(...) on endpoint %d failed: %s", i, err)
+				}
+				eps = append(eps, ep)
+			}
+			if !test.attachBeforeBind {
+				eps[nEndpoints-1].SocketOptions().SetReusePortFilter(firstByteFilter{})
+			}
+
+			for i := 0; i < 3*nEndpoints; i++ {
+				payload := newPayload()
+				payload[0] = byte(i % nEndpoints)
+				c.sendV4Packet(payload, &headers{
+					srcPort: testSrcPort + uint16(i),
+					dstPort: testDstPort,
+				}, 1)
+				for j, ep := range eps {
+					_, err := ep.Read(io.Discard, tcpip.ReadOptions{})
+					if j == i%nEndpoints {
+						if err != nil {
+							t.Errorf("packet %d: Read on endpoint %d failed: %s", i, j, err)
+						}
+					} else if _, ok := err.(*tcpip.ErrWouldBlock); !ok {
+						t.Errorf("packet %d: Read on endpoint %d = %v, want %s", i, j, err, &tcpip.ErrWouldBlock{})
+					}
+				}
+			}
+
+			// An out of range index falls back to hash-based selection.
+			payload := newPayload()
+			payload[0] = nEndpoints
+			c.sendV4Packet(payload, &headers{
+				srcPort: testSrcPort,
+				dstPort: testDstPort,
+			}, 1)
+			received := 0
+			for _, ep := range eps {
+				if _, err := ep.Read(io.Discard, tcpip.ReadOptions{}); err == nil {
+					received++
+				}
+			}
+			if received != 1 {
+				t.Errorf("got packet received by %d endpoints, want 1", received)
+			}
+		})
+	}
+}
@@ -0,0 +1,306 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"github.com/wilinz/gvisor/pkg/atomicbitops"
+	"github.com/wilinz/gvisor/pkg/buffer"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/header"
+)
+
+var _ LinkEndpoint = (*VLANEndpoint)(nil)
+
+// VLANEndpoint is the link endpoint of an IEEE 802.1Q VLAN sub-interface. It
+// sends and receives frames through the ethernet NIC it is stacked on (its
+// parent), inserting the VLAN tag into outgoing frames and stripping it from
+// incoming ones. The NIC using a VLANEndpoint therefore only sees untagged
+// ethernet frames, as with Linux VLAN devices.
+//
+// Like packetsocket endpoints, a VLANEndpoint delivers incoming and outgoing
+// packets to the packet sockets bound to its NIC.
+//
+// VLANEndpoints are created by Stack.CreateVLANNIC.
+//
+// +stateify savable
+type VLANEndpoint struct {
+	// parent is the NIC that tagged frames are sent and received through. It
+	// is immutable.
+	parent *nic
+
+	// id is the VLAN ID. It is immutable.
+	id uint16
+
+	// dispatcher is the NIC using the endpoint.
+	//
+	// +checklocks:parent.vlansMu
+	dispatcher NetworkDispatcher
+
+	// mtu is the MTU of the endpoint, which is capped by the MTU of parent.
+	mtu atomicbitops.Uint32
+}
+
+// ID returns the VLAN ID of the endpoint.
+func (e *VLANEndpoint) ID() uint16 {
+	return e.id
+}
+
+// ParentID returns the ID of the NIC the endpoint is stacked on.
+func (e *VLANEndpoint) ParentID() tcpip.NICID {
+	return e.parent.id
+}
+
+// deliverPacket strips the VLAN tag from pkt, a frame received by the parent
+// NIC, and delivers it to d.
+func (e *VLANEndpoint) deliverPacket(d NetworkDispatcher, pkt *PacketBuffer) {
+	eth := header.Ethernet(pkt.LinkHeader().Slice())
+	hdr, ok := pkt.Data().PullUp(header.VLANTagSize)
+	if !ok {
+		return
+	}
+	proto := header.VLAN(hdr).Type()
+
+	untagged := buffer.MakeWithData(make([]byte, header.EthernetMinimumSize))
+	untagged.Apply(func(v *buffer.View) {
+		header.Ethernet(v.AsSlice()).Encode(&header.EthernetFields{
+			SrcAddr: eth.SourceAddress(),
+			DstAddr: eth.DestinationAddress(),
+			Type:    proto,
+		})
+	})
+	payload := pkt.Data().ToBuffer()
+	payload.TrimFront(header.VLANTagSize)
+	untagged.Merge(&payload)
+
+	newPkt := NewPacketBuffer(PacketBufferOptions{
+		Payload: untagged,
+	})
+	defer newPkt.DecRef()
+	if !e.ParseHeader(newPkt) {
+		return
+	}
+	newPkt.PktType = pkt.PktType
+
+	d.DeliverLinkPacket(proto, newPkt)
+	d.DeliverNetworkPacket(proto, newPkt)
+}
+
+// tagPacket returns a copy of pkt, an untagged frame, with the VLAN tag
+// inserted after its ethernet header.
+func (e *VLANEndpoint) tagPacket(pkt *PacketBuffer) *PacketBuffer {
+	eth := header.Ethernet(pkt.LinkHeader().Slice())
+	payload := pkt.ToBuffer()
+	payload.TrimFront(header.EthernetMinimumSize)
+
+	newPkt := NewPacketBuffer(PacketBufferOptions{
+		ReserveHeaderBytes: int(e.MaxHeaderLength()),
+		Payload:            payload,
+	})
+	hdr := newPkt.LinkHeader().Push(header.EthernetMinimumSize + header.VLANTagSize)
+	header.Ethernet(hdr).Encode(&header.EthernetFields{
+		SrcAddr: eth.SourceAddress(),
+		DstAddr: eth.DestinationAddress(),
+		Type:    header.VLANProtocolNumber,
+	})
+	header.VLAN(hdr[header.EthernetMinimumSize:]).Encode(&header.VLANFields{
+		ID:   e.id,
+		Type: eth.Type(),
+	})
+	newPkt.EgressRoute = pkt.EgressRoute
+	newPkt.NetworkProtocolNumber = pkt.NetworkProtocolNumber
+	return newPkt
+}
+
+// WritePackets implements LinkEndpoint.WritePackets.
+func (e *VLANEndpoint) WritePackets(pkts PacketBufferList) (int, tcpip.Error) {
+	e.parent.vlansMu.RLock()
+	d := e.dispatcher
+	e.parent.vlansMu.RUnlock()
+
+	n := 0
+	for _, pkt := range pkts.AsSlice() {
+		if d != nil {
+			d.DeliverLinkPacket(pkt.NetworkProtocolNumber, pkt)
+		}
+		tagged := e.tagPacket(pkt)
+		err := e.parent.writeRawPacket(tagged)
+		tagged.DecRef()
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// MTU implements LinkEndpoint.MTU.
+func (e *VLANEndpoint) MTU() uint32 {
+	return min(e.mtu.Load(), e.parent.MTU())
+}
+
+// SetMTU implements LinkEndpoint.SetMTU.
+func (e *VLANEndpoint) SetMTU(mtu uint32) {
+	e.mtu.Store(mtu)
+}
+
+// MaxHeaderLength implements LinkEndpoint.MaxHeaderLength.
+func (e *VLANEndpoint) MaxHeaderLength() uint16 {
+	return e.parent.MaxHeaderLength() + header.VLANTagSize
+}
+
+// LinkAddress implements LinkEndpoint.LinkAddress.
+func (e *VLANEndpoint) LinkAddress() tcpip.LinkAddress {
+	return e.parent.LinkAddress()
+}
+
+// SetLinkAddress implements LinkEndpoint.SetLinkAddress. VLAN sub-interfaces
+// always use the link address of their parent, so this is a no-op.
+func (e *VLANEndpoint) SetLinkAddress(tcpip.LinkAddress) {}
+
+// Capabilities implements LinkEndpoint.Capabilities.
+func (e *VLANEndpoint) Capabilities() LinkEndpointCapabilities {
+	return CapabilityResolutionRequired | e.parent.Capabilities()&(CapabilityRXChecksumOffload|CapabilitySaveRestore)
+}
+
+// Attach implements LinkEndpoint.Attach.
+func (e *VLANEndpoint) Attach(dispatcher NetworkDispatcher) {
+	e.parent.vlansMu.Lock()
+	defer e.parent.vlansMu.Unlock()
+	e.dispatcher = dispatcher
+}
+
+// IsAttached implements LinkEndpoint.IsAttached.
+func (e *VLANEndpoint) IsAttached() bool {
+	e.parent.vlansMu.RLock()
+	defer e.parent.vlansMu.RUnlock()
+	return e.dispatcher != nil
+}
+
+// Wait implements LinkEndpoint.Wait.
+func (e *VLANEndpoint) Wait() {}
+
+// ARPHardwareType implements LinkEndpoint.ARPHardwareType.
+func (e *VLANEndpoint) ARPHardwareType() header.ARPHardwareType {
+	return header.ARPHardwareEther
+}
+
+// AddHeader implements LinkEndpoint.AddHeader. The VLAN tag is inserted when
+// the packet is written to the parent NIC.
+func (e *VLANEndpoint) AddHeader(pkt *PacketBuffer) {
+	eth := header.Ethernet(pkt.LinkHeader().Push(header.EthernetMinimumSize))
+	eth.Encode(&header.EthernetFields{
+		SrcAddr: pkt.EgressRoute.LocalLinkAddress,
+		DstAddr: pkt.EgressRoute.RemoteLinkAddress,
+		Type:    pkt.NetworkProtocolNumber,
+	})
+}
+
+// ParseHeader implements LinkEndpoint.ParseHeader.
+func (e *VLANEndpoint) ParseHeader(pkt *PacketBuffer) bool {
+	_, ok := pkt.LinkHeader().Consume(header.EthernetMinimumSize)
+	return ok
+}
+
+// Close implements LinkEndpoint.Close.
+func (e *VLANEndpoint) Close() {}
+
+// SetOnCloseAction implements LinkEndpoint.SetOnCloseAction.
+func (e *VLANEndpoint) SetOnCloseAction(func()) {}
+
+// deliverVLANPacket delivers pkt, a frame received with the VLAN tag
+// ethertype, to the VLAN sub-interface of n it is tagged for. It returns false
+// if there is no such sub-interface.
+func (n *nic) deliverVLANPacket(pkt *PacketBuffer) bool {
+	hdr, ok := pkt.Data().PullUp(header.VLANTagSize)
+	if !ok {
+		return false
+	}
+	n.vlansMu.RLock()
+	ep, ok := n.vlans[header.VLAN(hdr).ID()]
+	var d NetworkDispatcher
+	if ok {
+		d = ep.dispatcher
+	}
+	n.vlansMu.RUnlock()
+	if !ok {
+		return false
+	}
+	if d != nil {
+		// The dispatcher may acquire Stack.mu, which is ordered above
+		// nic.vlansMu, so call it without holding nic.vlansMu.
+		ep.deliverPacket(d, pkt)
+	}
+	return true
+}
+
+// hasVLANs returns true if any VLAN sub-interface is stacked on n.
+func (n *nic) hasVLANs() bool {
+	n.vlansMu.RLock()
+	defer n.vlansMu.RUnlock()
+	return len(n.vlans) != 0
+}
+
+// CreateVLANNIC creates a NIC for the VLAN sub-interface with VLAN ID vid of
+// the ethernet NIC parentID.
+//
+// Frames received by the parent NIC with the VLAN's tag are delivered to the
+// new NIC with the tag stripped, and frames sent through the new NIC are sent
+// through the parent NIC with the tag inserted. The new NIC is removed along
+// with its parent.
+func (s *Stack) CreateVLANNIC(id, parentID tcpip.NICID, vid uint16, opts NICOptions) tcpip.Error {
+	if vid == 0 || vid > header.VLANIDMax {
+		return &tcpip.ErrInvalidOptionValue{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	parent, ok := s.nics[parentID]
+	if !ok {
+		return &tcpip.ErrUnknownNICID{}
+	}
+	if parent.ARPHardwareType() != header.ARPHardwareEther || parent.IsLoopback() {
+		return &tcpip.ErrNotSupported{}
+	}
+	if _, ok := parent.NetworkLinkEndpoint.(*VLANEndpoint); ok {
+		// Stacked (QinQ) VLANs are not supported.
+		return &tcpip.ErrNotSupported{}
+	}
+
+	ep := &VLANEndpoint{
+		parent: parent,
+		id:     vid,
+	}
+	ep.mtu.Store(parent.MTU())
+
+	parent.vlansMu.Lock()
+	if _, ok := parent.vlans[vid]; ok {
+		parent.vlansMu.Unlock()
+		return &tcpip.ErrDuplicateNICID{}
+	}
+	if parent.vlans == nil {
+		parent.vlans = make(map[uint16]*VLANEndpoint)
+	}
+	parent.vlans[vid] = ep
+	parent.vlansMu.Unlock()
+
+	if err := s.createNICLocked(id, ep, opts); err != nil {
+		parent.vlansMu.Lock()
+		delete(parent.vlans, vid)
+		parent.vlansMu.Unlock()
+		return err
+	}
+	return nil
+}
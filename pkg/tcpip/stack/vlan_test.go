@@ -0,0 +1,201 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack_test
+
+import (
+	"testing"
+
+	"github.com/wilinz/gvisor/pkg/buffer"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/header"
+	"github.com/wilinz/gvisor/pkg/tcpip/link/channel"
+	"github.com/wilinz/gvisor/pkg/tcpip/link/ethernet"
+	"github.com/wilinz/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	vlanLinkAddr   = tcpip.LinkAddress("\x02\x02\x03\x04\x05\x06")
+	vlanRemoteAddr = tcpip.LinkAddress("\x02\x02\x03\x04\x05\x07")
+
+	vlanNetProto = 55
+	vlanParentID = 1
+	vlanNICID1   = 2
+	vlanNICID2   = 3
+	vlanID1      = 100
+	vlanID2      = 200
+)
+
+func newVLANStack(t *testing.T) (*stack.Stack, *channel.Endpoint) {
+	t.Helper()
+	ch := channel.New(1, 1500, vlanLinkAddr)
+	s := stack.New(stack.Options{})
+	if err := s.CreateNIC(vlanParentID, ethernet.New(ch)); err != nil {
+		t.Fatalf("s.CreateNIC(%d, _): %s", vlanParentID, err)
+	}
+	if err := s.CreateVLANNIC(vlanNICID1, vlanParentID, vlanID1, stack.NICOptions{}); err != nil {
+		t.Fatalf("s.CreateVLANNIC(%d, %d, %d, _): %s", vlanNICID1, vlanParentID, vlanID1, err)
+	}
+	if err := s.CreateVLANNIC(vlanNICID2, vlanParentID, vlanID2, stack.NICOptions{}); err != nil {
+		t.Fatalf("s.CreateVLANNIC(%d, %d, %d, _): %s", vlanNICID2, vlanParentID, vlanID2, err)
+	}
+	return s, ch
+}
+
+func TestVLANWritePacket(t *testing.T) {
+	s, ch := newVLANStack(t)
+	defer s.Close()
+
+	payload := []byte{1, 2, 3, 4}
+	if err := s.WritePacketToRemote(vlanNICID1, vlanRemoteAddr, vlanNetProto, buffer.MakeWithData(payload)); err != nil {
+		t.Fatalf("s.WritePacketToRemote(%d, %s, _): %s", vlanNICID1, vlanRemoteAddr, err)
+	}
+	pkt := ch.Read()
+	if pkt == nil {
+		t.Fatal("expected to read a packet")
+	}
+	defer pkt.DecRef()
+
+	frame := pkt.ToView().AsSlice()
+	if got, want := len(frame), header.EthernetMinimumSize+header.VLANTagSize+len(payload); got != want {
+		t.Fatalf("got len(frame) = %d, want = %d", got, want)
+	}
+	eth := header.Ethernet(frame)
+	if got := eth.SourceAddress(); got != vlanLinkAddr {
+		t.Errorf("got eth.SourceAddress() = %s, want = %s", got, vlanLinkAddr)
+	}
+	if got := eth.DestinationAddress(); got != vlanRemoteAddr {
+		t.Errorf("got eth.DestinationAddress() = %s, want = %s", got, vlanRemoteAddr)
+	}
+	if got := eth.Type(); got != header.VLANProtocolNumber {
+		t.Errorf("got eth.Type() = %d, want = %d", got, header.VLANProtocolNumber)
+	}
+	tag := header.VLAN(frame[header.EthernetMinimumSize:])
+	if got := tag.ID(); got != vlanID1 {
+		t.Errorf("got tag.ID() = %d, want = %d", got, vlanID1)
+	}
+	if got := tag.Type(); got != vlanNetProto {
+		t.Errorf("got tag.Type() = %d, want = %d", got, vlanNetProto)
+	}
+
+	stats := s.NICInfo()[vlanNICID1].Stats
+	if got := stats.Tx.Packets.Value(); got != 1 {
+		t.Errorf("got VLAN NIC Tx.Packets = %d, want = 1", got)
+	}
+}
+
+func TestVLANDeliverPacket(t *testing.T) {
+	s, ch := newVLANStack(t)
+	defer s.Close()
+
+	payload := []byte{1, 2, 3, 4}
+	inject := func(vid uint16) {
+		frame := make([]byte, header.EthernetMinimumSize+header.VLANTagSize, header.EthernetMinimumSize+header.VLANTagSize+len(payload))
+		header.Ethernet(frame).Encode(&header.EthernetFields{
+			SrcAddr: vlanRemoteAddr,
+			DstAddr: vlanLinkAddr,
+			Type:    header.VLANProtocolNumber,
+		})
+		header.VLAN(frame[header.EthernetMinimumSize:]).Encode(&header.VLANFields{
+			ID:   vid,
+			Type: vlanNetProto,
+		})
+		frame = append(frame, payload...)
+		pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+			Payload: buffer.MakeWithData(frame),
+		})
+		ch.InjectInbound(0, pkt)
+		pkt.DecRef()
+	}
+
+	inject(vlanID1)
+	inject(vlanID1)
+	inject(vlanID2)
+	// Frames for VLANs without a sub-interface are handled by the parent.
+	inject(300)
+
+	nics := s.NICInfo()
+	for _, test := range []struct {
+		id      tcpip.NICID
+		packets uint64
+	}{
+		{vlanNICID1, 2},
+		{vlanNICID2, 1},
+	} {
+		stats := nics[test.id].Stats
+		if got := stats.Rx.Packets.Value(); got != test.packets {
+			t.Errorf("got NIC %d Rx.Packets = %d, want = %d", test.id, got, test.packets)
+		}
+		// The tag must have been stripped.
+		if got, want := stats.Rx.Bytes.Value(), test.packets*uint64(len(payload)); got != want {
+			t.Errorf("got NIC %d Rx.Bytes = %d, want = %d", test.id, got, want)
+		}
+		if got, ok := stats.UnknownL3ProtocolRcvdPacketCounts.Get(vlanNetProto); !ok || got.Value() != test.packets {
+			t.Errorf("got NIC %d unknown protocol %d packets = %v, want = %d", test.id, vlanNetProto, got, test.packets)
+		}
+	}
+	parentStats := nics[vlanParentID].Stats
+	if got := parentStats.Rx.Packets.Value(); got != 4 {
+		t.Errorf("got parent Rx.Packets = %d, want = 4", got)
+	}
+	if got, ok := parentStats.UnknownL3ProtocolRcvdPacketCounts.Get(uint64(header.VLANProtocolNumber)); !ok || got.Value() != 1 {
+		t.Errorf("got parent unknown VLAN protocol packets = %v, want = 1", got)
+	}
+}
+
+func TestVLANCreateErrors(t *testing.T) {
+	s, _ := newVLANStack(t)
+	defer s.Close()
+
+	for _, test := range []struct {
+		name     string
+		parentID tcpip.NICID
+		vid      uint16
+		want     tcpip.Error
+	}{
+		{"ReservedID", vlanParentID, 0, &tcpip.ErrInvalidOptionValue{}},
+		{"IDTooLarge", vlanParentID, header.VLANIDMax + 1, &tcpip.ErrInvalidOptionValue{}},
+		{"UnknownParent", 10, vlanID1, &tcpip.ErrUnknownNICID{}},
+		{"DuplicateID", vlanParentID, vlanID1, &tcpip.ErrDuplicateNICID{}},
+		{"StackedVLAN", vlanNICID1, vlanID2, &tcpip.ErrNotSupported{}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if err := s.CreateVLANNIC(10, test.parentID, test.vid, stack.NICOptions{}); err != test.want {
+				t.Errorf("got s.CreateVLANNIC(10, %d, %d, _) = %v, want = %s", test.parentID, test.vid, err, test.want)
+			}
+		})
+	}
+}
+
+func TestVLANRemovedWithParent(t *testing.T) {
+	s, _ := newVLANStack(t)
+	defer s.Close()
+
+	if err := s.RemoveNIC(vlanNICID1); err != nil {
+		t.Fatalf("s.RemoveNIC(%d): %s", vlanNICID1, err)
+	}
+	// The VLAN ID can be reused once its sub-interface is removed.
+	if err := s.CreateVLANNIC(vlanNICID1, vlanParentID, vlanID1, stack.NICOptions{}); err != nil {
+		t.Fatalf("s.CreateVLANNIC(%d, %d, %d, _): %s", vlanNICID1, vlanParentID, vlanID1, err)
+	}
+
+	if err := s.RemoveNIC(vlanParentID); err != nil {
+		t.Fatalf("s.RemoveNIC(%d): %s", vlanParentID, err)
+	}
+	for _, id := range []tcpip.NICID{vlanParentID, vlanNICID1, vlanNICID2} {
+		if s.HasNIC(id) {
+			t.Errorf("got s.HasNIC(%d) = true, want = false", id)
+		}
+	}
+}
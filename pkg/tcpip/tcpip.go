@@ -42,6 +42,7 @@ import (
 	"time"
 
 	"github.com/wilinz/gvisor/pkg/atomicbitops"
+	"github.com/wilinz/gvisor/pkg/buffer"
 	"github.com/wilinz/gvisor/pkg/rand"
 	"github.com/wilinz/gvisor/pkg/sync"
 	"github.com/wilinz/gvisor/pkg/waiter"
@@ -563,6 +564,18 @@ type Payloader interface {
 var _ Payloader = (*bytes.Buffer)(nil)
 var _ Payloader = (*bytes.Reader)(nil)
 
+// BufferPayloader is a Payloader that can hand its data over as a
+// buffer.Buffer, which endpoints may queue without copying.
+type BufferPayloader interface {
+	Payloader
+
+	// ReadBuffer removes up to count bytes from the front of the payloader
+	// and returns them. The caller owns the returned Buffer.
+	ReadBuffer(count int64) buffer.Buffer
+}
+
+var _ BufferPayloader = (*buffer.BufferReader)(nil)
+
 var _ io.Writer = (*SliceWriter)(nil)
 
 // SliceWriter implements io.Writer for slices.
@@ -623,6 +636,13 @@ type SendableControlMessages struct {
 
 	// IPv6PacketInfo holds interface and address data on an incoming packet.
 	IPv6PacketInfo IPv6PacketInfo
+
+	// HasGSOSize indicates whether GSOSize is set.
+	HasGSOSize bool
+
+	// GSOSize is the size of the UDP datagrams the written data is split
+	// into, as with UDP_SEGMENT. Zero disables segmentation.
+	GSOSize uint16
 }
 
 // ReceivableControlMessages contains socket control messages that can be
@@ -689,6 +709,20 @@ type ReceivableControlMessages struct {
 
 	// SockErr is the dequeued socket error on recvmsg(MSG_ERRQUEUE).
 	SockErr *SockError
+
+	// HasGROSize indicates whether GROSize is valid/set.
+	HasGROSize bool
+
+	// GROSize is the size of the UDP datagrams coalesced into the read data,
+	// as with UDP_GRO.
+	GROSize uint16
+
+	// HasDropCount indicates whether DropCount is valid/set.
+	HasDropCount bool
+
+	// DropCount is the number of packets dropped by the endpoint before the
+	// read packet was received, as with SO_RXQ_OVFL.
+	DropCount uint32
 }
 
 // PacketOwner is used to get UID and GID of the packet.
@@ -947,11 +981,8 @@ const (
 	// TCP_MAXSEG option.
 	MaxSegOption
 
-	// MTUDiscoverOption is used to set/get the path MTU discovery setting.
-	//
-	// NOTE: Setting this option to any other value than PMTUDiscoveryDont
-	// is not supported and will fail as such, and getting this option will
-	// always return PMTUDiscoveryDont.
+	// MTUDiscoverOption is used to set/get the path MTU discovery setting,
+	// as a PMTUDStrategy. Datagram endpoints default to PMTUDiscoveryDont.
 	MTUDiscoverOption
 
 	// MulticastTTLOption is used by SetSockOptInt/GetSockOptInt to control
@@ -1003,6 +1034,40 @@ const (
 	// PacketMMapReserveOption is used to set the packet mmap reserved space
 	// between the aligned header and the payload.
 	PacketMMapReserveOption
+
+	// TCPFastOpenOption is used by SetSockOptInt/GetSockOptInt to specify
+	// the maximum number of pending TCP Fast Open connections of a
+	// listening endpoint. Zero disables TCP Fast Open for passive opens.
+	TCPFastOpenOption
+
+	// TCPFastOpenConnectOption is used by SetSockOptInt/GetSockOptInt to
+	// enable TCP Fast Open for active opens. When enabled, connecting
+	// completes immediately and the SYN is sent with the first write.
+	TCPFastOpenConnectOption
+
+	// UDPSegmentOption is used by SetSockOptInt/GetSockOptInt to specify the
+	// size of the UDP datagrams that writes are split into. Zero disables
+	// segmentation.
+	UDPSegmentOption
+
+	// UDPGROOption is used by SetSockOptInt/GetSockOptInt to specify whether
+	// received UDP datagrams of the same flow may be coalesced into a
+	// single read.
+	UDPGROOption
+
+	// FlowHashOption is used by GetSockOptInt to get the stack's hash of the
+	// endpoint's flow (see stack.Stack.FlowHash), as an unsigned 32-bit
+	// value. ErrNotConnected is returned if the endpoint has no peer.
+	FlowHashOption
+
+	// PathMTUOption is used by GetSockOptInt to get the MTU of the path to
+	// the endpoint's peer, as for Linux's IP_MTU and IPV6_MTU.
+	// ErrNotConnected is returned if the endpoint has no peer.
+	PathMTUOption
+
+	// IPv6MTUOption is used by SetSockOptInt/GetSockOptInt to cap the MTU of
+	// outgoing IPv6 packets, as for Linux's IPV6_MTU. Zero uses the path MTU.
+	IPv6MTUOption
 )
 
 const (
@@ -1093,6 +1158,30 @@ func (*TCPAlwaysUseSynCookies) isGettableTransportProtocolOption() {}
 
 func (*TCPAlwaysUseSynCookies) isSettableTransportProtocolOption() {}
 
+// TCPSynCookiesOption is used by SetTransportProtocolOption and
+// TransportProtocolOption to specify when listening endpoints reply to SYNs
+// with SYN cookies instead of keeping state for the handshake, like Linux's
+// net.ipv4.tcp_syncookies.
+type TCPSynCookiesOption int32
+
+const (
+	// TCPSynCookiesNever disables SYN cookies. SYNs received when the SYN
+	// backlog of a listening endpoint is full are dropped.
+	TCPSynCookiesNever TCPSynCookiesOption = 0
+
+	// TCPSynCookiesOnOverflow uses SYN cookies when the SYN backlog of a
+	// listening endpoint is full.
+	TCPSynCookiesOnOverflow TCPSynCookiesOption = 1
+
+	// TCPSynCookiesAlways uses SYN cookies for all SYNs. It is equivalent to
+	// TCPAlwaysUseSynCookies.
+	TCPSynCookiesAlways TCPSynCookiesOption = 2
+)
+
+func (*TCPSynCookiesOption) isGettableTransportProtocolOption() {}
+
+func (*TCPSynCookiesOption) isSettableTransportProtocolOption() {}
+
 const (
 	// TCPRACKLossDetection indicates RACK is used for loss detection and
 	// recovery.
@@ -1157,6 +1246,17 @@ func (*TCPModerateReceiveBufferOption) isGettableTransportProtocolOption() {}
 
 func (*TCPModerateReceiveBufferOption) isSettableTransportProtocolOption() {}
 
+// TCPLoopbackFastPathOption enables/disables the TCP loopback fast path. When
+// enabled, connections whose packets never leave the stack, such as
+// connections to an address assigned to a non-loopback NIC of the stack, size
+// their segments like connections over a loopback interface instead of by the
+// MTU of the NIC, and don't use segmentation offload.
+type TCPLoopbackFastPathOption bool
+
+func (*TCPLoopbackFastPathOption) isGettableTransportProtocolOption() {}
+
+func (*TCPLoopbackFastPathOption) isSettableTransportProtocolOption() {}
+
 // GettableSocketOption is a marker interface for socket options that may be
 // queried.
 type GettableSocketOption interface {
@@ -1201,6 +1301,12 @@ type TpacketReq struct {
 	TpBlockNr   uint32
 	TpFrameSize uint32
 	TpFrameNr   uint32
+
+	// The following fields are only used by TPACKET_V3 ring buffers, see
+	// struct tpacket_req3.
+	TpRetireBlkTov   uint32
+	TpSizeofPriv     uint32
+	TpFeatureReqWord uint32
 }
 
 func (*TpacketReq) isSettableSocketOption() {}
@@ -1212,6 +1318,10 @@ func (*TpacketReq) isSettableSocketOption() {}
 type TpacketStats struct {
 	Packets uint32
 	Dropped uint32
+
+	// FreezeQueueCount is the number of times a TPACKET_V3 receive ring
+	// buffer ran out of blocks.
+	FreezeQueueCount uint32
 }
 
 func (*TpacketStats) isGettableSocketOption() {}
@@ -1268,10 +1378,119 @@ type TCPInfoOption struct {
 
 	// ReorderSeen indicates if reordering is seen in the endpoint.
 	ReorderSeen bool
+
+	// TimestampsEnabled indicates if the TCP timestamp option was
+	// negotiated.
+	TimestampsEnabled bool
+
+	// SACKPermitted indicates if SACK was negotiated.
+	SACKPermitted bool
+
+	// SndWndScale and RcvWndScale are the send and receive window scales.
+	SndWndScale uint8
+	RcvWndScale uint8
+
+	// SndMSS is the maximum size of the payload of a sent segment.
+	SndMSS uint32
+
+	// AdvMSS is the MSS advertised to the peer.
+	AdvMSS uint32
+
+	// Unacked is the number of segments sent but not yet acknowledged.
+	Unacked uint32
+
+	// Sacked is the number of segments selectively acknowledged.
+	Sacked uint32
+
+	// TotalRetrans is the number of segments retransmitted.
+	TotalRetrans uint32
+
+	// MinRTT is the minimum round trip time observed.
+	MinRTT time.Duration
+
+	// LastDataSent is the time since the last segment was sent.
+	LastDataSent time.Duration
+
+	// LastAckRecv is the time since the last ACK was received.
+	LastAckRecv time.Duration
+
+	// PacingRate is the pacing rate in bytes per second, or zero if
+	// the endpoint is not paced.
+	PacingRate uint64
+
+	// DeliveryRate is the most recently sampled delivery rate in bytes
+	// per second.
+	DeliveryRate uint64
+
+	// DeliveryRateAppLimited indicates if DeliveryRate was sampled while
+	// the endpoint was application limited.
+	DeliveryRateAppLimited bool
+
+	// BytesSent is the number of payload bytes sent, including
+	// retransmissions.
+	BytesSent uint64
+
+	// BytesRetrans is the number of payload bytes retransmitted.
+	BytesRetrans uint64
+
+	// BytesAcked is the number of bytes cumulatively acknowledged by the
+	// peer.
+	BytesAcked uint64
+
+	// BytesReceived is the number of payload bytes received in order.
+	BytesReceived uint64
+
+	// SegsOut and SegsIn are the number of segments sent and received.
+	SegsOut uint32
+	SegsIn  uint32
+
+	// DataSegsOut and DataSegsIn are the number of segments carrying
+	// payload sent and received.
+	DataSegsOut uint32
+	DataSegsIn  uint32
+
+	// NotSentBytes is the number of bytes queued for sending but not yet
+	// sent.
+	NotSentBytes uint32
 }
 
 func (*TCPInfoOption) isGettableSocketOption() {}
 
+// MPTCPInfoOption is used by GetSockOpt to expose Multipath TCP statistics.
+type MPTCPInfoOption struct {
+	// Fallback indicates if the connection fell back to regular TCP.
+	Fallback bool
+
+	// RemoteKeyReceived indicates if the peer's key has been received.
+	RemoteKeyReceived bool
+
+	// Subflows is the number of subflows besides the initial one.
+	Subflows uint8
+
+	// Token is the local token of the connection.
+	Token uint32
+
+	// WriteSeq is the data sequence number of the next byte to be sent.
+	WriteSeq uint64
+
+	// SndUna is the data sequence number of the oldest unacknowledged
+	// byte.
+	SndUna uint64
+
+	// RcvNxt is the data sequence number of the next byte expected from
+	// the peer.
+	RcvNxt uint64
+
+	// BytesSent is the number of bytes sent at the connection level.
+	BytesSent uint64
+
+	// BytesReceived is the number of bytes received at the connection
+	// level.
+	BytesReceived uint64
+}
+
+func (*MPTCPInfoOption) isGettableSocketOption() {}
+
 // KeepaliveIdleOption is used by SetSockOpt/GetSockOpt to specify the time a
 // connection must remain idle before the first TCP keepalive packet is sent.
 // Once this time is reached, KeepaliveIntervalOption is used instead.
@@ -1346,6 +1565,24 @@ func (*TCPDeferAcceptOption) isGettableSocketOption() {}
 
 func (*TCPDeferAcceptOption) isSettableSocketOption() {}
 
+// TCPListenQueueOption is used by GetSockOpt to get the queue lengths of a
+// listening TCP endpoint.
+type TCPListenQueueOption struct {
+	// SynBacklog is the number of connections whose handshake is in
+	// progress, excluding those answered with SYN cookies.
+	SynBacklog int
+
+	// AcceptQueue is the number of established connections waiting to be
+	// accepted.
+	AcceptQueue int
+
+	// Backlog is the backlog the endpoint is listening with, which bounds
+	// both queues.
+	Backlog int
+}
+
+func (*TCPListenQueueOption) isGettableSocketOption() {}
+
 // TCPMinRTOOption is use by SetSockOpt/GetSockOpt to allow overriding
 // default MinRTO used by the Stack.
 type TCPMinRTOOption time.Duration
@@ -1574,6 +1811,10 @@ type Route struct {
 	// If MTU is 0, this field is ignored and the MTU of the NIC for which this route
 	// is configured is used for egress packets.
 	MTU uint32
+
+	// Table is the ID of the route table that contains this route. The zero
+	// value is MainRouteTable.
+	Table RouteTableID
 }
 
 // String implements the fmt.Stringer interface.
@@ -1584,13 +1825,104 @@ func (r Route) String() string {
 		_, _ = fmt.Fprintf(&out, " via %s", r.Gateway)
 	}
 	_, _ = fmt.Fprintf(&out, " nic %d", r.NIC)
+	if r.Table != MainRouteTable {
+		_, _ = fmt.Fprintf(&out, " table %d", r.Table)
+	}
 	return out.String()
 }
 
 // Equal returns true if the given Route is equal to this Route.
 func (r Route) Equal(to Route) bool {
 	// NOTE: This relies on the fact that r.Destination == to.Destination
-	return r.Destination.Equal(to.Destination) && r.NIC == to.NIC
+	return r.Destination.Equal(to.Destination) && r.NIC == to.NIC && r.Table == to.Table
+}
+
+// RouteTableID identifies a route table.
+type RouteTableID uint32
+
+// MainRouteTable is the route table that routes are added to unless another
+// table is given, and the only table used by the default routing rules.
+const MainRouteTable RouteTableID = 0
+
+// RoutingRuleAction is the action taken by a routing rule.
+type RoutingRuleAction int
+
+const (
+	// RoutingRuleLookup looks up the route in the rule's table. If the table
+	// has no route to the destination, the next matching rule is used.
+	RoutingRuleLookup RoutingRuleAction = iota
+
+	// RoutingRuleUnreachable fails route lookups with ErrNetworkUnreachable.
+	RoutingRuleUnreachable
+
+	// RoutingRuleProhibit fails route lookups with ErrNotPermitted.
+	RoutingRuleProhibit
+)
+
+// RoutingRule is a policy routing rule. Route lookups try the rules that match
+// the packet in order of priority, and the first rule that yields a route or
+// an error ends the lookup.
+//
+// +stateify savable
+type RoutingRule struct {
+	// Priority orders rules; rules with lower priorities are tried first.
+	// Rules with the same priority are tried in the order they were added.
+	Priority uint32
+
+	// Protocol is the network protocol that the rule applies to.
+	Protocol NetworkProtocolNumber
+
+	// Source, if its prefix is not empty, must contain the local address of
+	// the route.
+	Source Subnet
+
+	// Destination, if its prefix is not empty, must contain the remote address
+	// of the route.
+	Destination Subnet
+
+	// Mark and Mask, if Mask is not zero, match packets whose mark masked
+	// with Mask is Mark. Netstack doesn't support packet marks, so all lookups
+	// are done with a zero mark.
+	Mark uint32
+	Mask uint32
+
+	// OutputNIC, if not zero, must be the NIC that the route is looked up
+	// for, e.g. the NIC an endpoint is bound to.
+	OutputNIC NICID
+
+	// Invert inverts the result of matching the fields above.
+	Invert bool
+
+	// Action is the action taken for matching lookups.
+	Action RoutingRuleAction
+
+	// Table is the route table to look up, if Action is RoutingRuleLookup.
+	Table RouteTableID
+
+	// MinPrefixLen causes routes in Table whose destination prefix is shorter
+	// than MinPrefixLen to be ignored, so that lookups that would use them
+	// continue with the next rule.
+	MinPrefixLen int
+}
+
+// Match returns true if the rule matches a lookup of a route for protocol from
+// localAddr to remoteAddr through nic, for a packet with the given mark.
+func (r *RoutingRule) Match(protocol NetworkProtocolNumber, nic NICID, localAddr, remoteAddr Address, mark uint32) bool {
+	if r.Protocol != protocol {
+		return false
+	}
+	match := true
+	switch {
+	case r.Source.Prefix() != 0 && !r.Source.Contains(localAddr):
+		match = false
+	case r.Destination.Prefix() != 0 && !r.Destination.Contains(remoteAddr):
+		match = false
+	case r.Mask != 0 && mark&r.Mask != r.Mark:
+		match = false
+	case r.OutputNIC != 0 && r.OutputNIC != nic:
+		match = false
+	}
+	return match != r.Invert
 }
 
 // TransportProtocolNumber is the number of a transport protocol.
@@ -2083,6 +2415,11 @@ type IPStats struct {
 	// Postrouting chain.
 	IPTablesPostroutingDropped *StatCounter
 
+	// NetworkPolicyDropped is the number of outgoing or forwarded IP packets,
+	// and of packets written by packet sockets, dropped by the stack's network
+	// policy.
+	NetworkPolicyDropped *StatCounter
+
 	// TODO(https://gvisor.dev/issues/5529): Move the IPv4-only option stats out
 	// of IPStats.
 	// OptionTimestampReceived is the number of Timestamp options seen.
@@ -2210,6 +2547,15 @@ type TCPStats struct {
 	// was received.
 	ListenOverflowInvalidSynCookieRcvd *StatCounter
 
+	// ListenSynBacklogDrop is the number of SYNs dropped because the SYN
+	// backlog of the listening endpoint was full and SYN cookies were
+	// disabled.
+	ListenSynBacklogDrop *StatCounter
+
+	// DeferAcceptDrop is the number of bare ACKs completing a passive
+	// handshake that were dropped because of TCP_DEFER_ACCEPT.
+	DeferAcceptDrop *StatCounter
+
 	// FailedConnectionAttempts is the number of calls to Connect or Listen
 	// (active and passive openings, respectively) that end in an error.
 	FailedConnectionAttempts *StatCounter
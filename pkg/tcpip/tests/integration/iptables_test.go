@@ -3728,3 +3728,167 @@ func genUDP6(offset int8) *stack.PacketBuffer {
 	buf := buffer.MakeWithData(append([]byte{}, hdr.View()...))
 	return stack.NewPacketBuffer(stack.PacketBufferOptions{Payload: buf})
 }
+
+func TestTProxy(t *testing.T) {
+	const (
+		srcPort    = 343
+		origPort   = 80
+		tproxyPort = 8080
+		dataSize   = 4
+	)
+
+	tests := []struct {
+		name        string
+		netProto    tcpip.NetworkProtocolNumber
+		genStack    func(*testing.T) (*stack.Stack, *channel.Endpoint)
+		genPacket   func(srcAddr, dstAddr tcpip.Address, srcPort, dstPort uint16, dataSize int) []byte
+		checker     func(*testing.T, *buffer.View, ...checker.NetworkChecker)
+		subnet      tcpip.Subnet
+		srcAddr     tcpip.Address
+		origDstAddr tcpip.Address
+	}{
+		{
+			name:        "IPv4",
+			netProto:    header.IPv4ProtocolNumber,
+			genStack:    genStackV4,
+			genPacket:   udpv4Packet,
+			checker:     checker.IPv4,
+			subnet:      header.IPv4EmptySubnet,
+			srcAddr:     srcAddrV4,
+			origDstAddr: tcpip.AddrFrom4([4]byte{192, 0, 2, 1}),
+		},
+		{
+			name:        "IPv6",
+			netProto:    header.IPv6ProtocolNumber,
+			genStack:    genStackV6,
+			genPacket:   udpv6Packet,
+			checker:     checker.IPv6,
+			subnet:      header.IPv6EmptySubnet,
+			srcAddr:     srcAddrV6,
+			origDstAddr: tcpip.AddrFrom16([16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 1}),
+		},
+	}
+
+	for _, test := range tests {
+		for _, transparent := range []bool{true, false} {
+			t.Run(fmt.Sprintf("%s/transparent=%t", test.name, transparent), func(t *testing.T) {
+				s, e := test.genStack(t)
+				defer s.Close()
+				s.SetRouteTable([]tcpip.Route{{Destination: test.subnet, NIC: nicID}})
+
+				// Redirect all incoming UDP packets to tproxyPort.
+				ipv6 := test.netProto == header.IPv6ProtocolNumber
+				ipt := s.IPTables()
+				ipt.ForceReplaceTable(stack.MangleID, stack.Table{
+					Rules: []stack.Rule{
+						{
+							Filter: stack.IPHeaderFilter{
+								Protocol:      header.UDPProtocolNumber,
+								CheckProtocol: true,
+							},
+							Target: &stack.TProxyTarget{Port: tproxyPort, NetworkProtocol: test.netProto},
+						},
+						{
+							Target: &stack.AcceptTarget{},
+						},
+					},
+					BuiltinChains: [stack.NumHooks]int{
+						stack.Prerouting:  0,
+						stack.Input:       1,
+						stack.Forward:     1,
+						stack.Output:      1,
+						stack.Postrouting: 1,
+					},
+					Underflows: [stack.NumHooks]int{
+						stack.Prerouting:  1,
+						stack.Input:       1,
+						stack.Forward:     1,
+						stack.Output:      1,
+						stack.Postrouting: 1,
+					},
+				}, ipv6)
+
+				var wq waiter.Queue
+				ep, err := s.NewEndpoint(udp.ProtocolNumber, test.netProto, &wq)
+				if err != nil {
+					t.Fatalf("s.NewEndpoint(%d, %d, _): %s", udp.ProtocolNumber, test.netProto, err)
+				}
+				defer ep.Close()
+				ep.SocketOptions().SetTransparent(transparent)
+				ep.SocketOptions().SetReceiveOriginalDstAddress(true)
+				bindAddr := tcpip.FullAddress{Port: tproxyPort}
+				if err := ep.Bind(bindAddr); err != nil {
+					t.Fatalf("ep.Bind(%#v): %s", bindAddr, err)
+				}
+
+				e.InjectInbound(test.netProto, stack.NewPacketBuffer(stack.PacketBufferOptions{
+					Payload: buffer.MakeWithData(test.genPacket(test.srcAddr, test.origDstAddr, srcPort, origPort, dataSize)),
+				}))
+
+				var buf bytes.Buffer
+				res, err := ep.Read(&buf, tcpip.ReadOptions{NeedRemoteAddr: true})
+				if !transparent {
+					// Redirected packets are dropped if the socket isn't
+					// transparent.
+					if _, ok := err.(*tcpip.ErrWouldBlock); !ok {
+						t.Fatalf("got ep.Read(_, _) = (%+v, %v), want = (_, %s)", res, err, &tcpip.ErrWouldBlock{})
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("ep.Read(_, _): %s", err)
+				}
+				if diff := cmp.Diff(
+					tcpip.ReadResult{
+						Count:      dataSize,
+						Total:      dataSize,
+						RemoteAddr: tcpip.FullAddress{Addr: test.srcAddr, Port: srcPort, NIC: nicID},
+					},
+					res,
+					checker.IgnoreCmpPath("ControlMessages"),
+				); diff != "" {
+					t.Errorf("ep.Read: unexpected result (-want +got):\n%s", diff)
+				}
+				if got, want := res.ControlMessages.OriginalDstAddress, (tcpip.FullAddress{Addr: test.origDstAddr, Port: origPort}); !res.ControlMessages.HasOriginalDstAddress || got.Addr != want.Addr || got.Port != want.Port {
+					t.Errorf("got original destination %+v, want %+v", got, want)
+				}
+
+				// A transparent endpoint can reply from the original
+				// destination, even though it isn't a local address.
+				replyEP, err := s.NewEndpoint(udp.ProtocolNumber, test.netProto, &wq)
+				if err != nil {
+					t.Fatalf("s.NewEndpoint(%d, %d, _): %s", udp.ProtocolNumber, test.netProto, err)
+				}
+				defer replyEP.Close()
+				replyEP.SocketOptions().SetTransparent(true)
+				bindAddr = tcpip.FullAddress{Addr: test.origDstAddr, Port: origPort}
+				if err := replyEP.Bind(bindAddr); err != nil {
+					t.Fatalf("replyEP.Bind(%#v): %s", bindAddr, err)
+				}
+				data := []byte{1, 2, 3, 4}
+				var r bytes.Reader
+				r.Reset(data)
+				wOpts := tcpip.WriteOptions{To: &tcpip.FullAddress{Addr: test.srcAddr, Port: srcPort}}
+				if _, err := replyEP.Write(&r, wOpts); err != nil {
+					t.Fatalf("replyEP.Write(_, %#v): %s", wOpts, err)
+				}
+				pkt := e.Read()
+				if pkt == nil {
+					t.Fatal("expected to read a reply")
+				}
+				pktView := stack.PayloadSince(pkt.NetworkHeader())
+				defer pktView.Release()
+				pkt.DecRef()
+				test.checker(t, pktView,
+					checker.SrcAddr(test.origDstAddr),
+					checker.DstAddr(test.srcAddr),
+					checker.UDP(
+						checker.SrcPort(origPort),
+						checker.DstPort(srcPort),
+						checker.Payload(data),
+					),
+				)
+			})
+		}
+	}
+}
@@ -791,3 +791,174 @@ func TestExternalLoopbackTraffic(t *testing.T) {
 		})
 	}
 }
+
+// TestLoopbackFastPathTCP tests that TCP connections to an address assigned to
+// a non-loopback NIC use loopback-sized segments only when the loopback fast
+// path is enabled.
+func TestLoopbackFastPathTCP(t *testing.T) {
+	const (
+		nicID     = 1
+		nicMTU    = 1500
+		localPort = 80
+	)
+
+	tests := []struct {
+		name        string
+		protoAddr   tcpip.ProtocolAddress
+		fastPath    bool
+		wantMSSOver uint32
+		wantMSSMax  uint32
+	}{
+		{
+			name: "IPv4 without fast path",
+			protoAddr: tcpip.ProtocolAddress{
+				Protocol:          header.IPv4ProtocolNumber,
+				AddressWithPrefix: utils.Ipv4Addr,
+			},
+			fastPath:   false,
+			wantMSSMax: nicMTU - header.IPv4MinimumSize - header.TCPMinimumSize,
+		},
+		{
+			name: "IPv4 with fast path",
+			protoAddr: tcpip.ProtocolAddress{
+				Protocol:          header.IPv4ProtocolNumber,
+				AddressWithPrefix: utils.Ipv4Addr,
+			},
+			fastPath:    true,
+			wantMSSOver: nicMTU,
+			wantMSSMax:  65535 - header.IPv4MinimumSize - header.TCPMinimumSize,
+		},
+		{
+			name: "IPv6 without fast path",
+			protoAddr: tcpip.ProtocolAddress{
+				Protocol:          header.IPv6ProtocolNumber,
+				AddressWithPrefix: utils.Ipv6Addr,
+			},
+			fastPath:   false,
+			wantMSSMax: nicMTU - header.IPv6MinimumSize - header.TCPMinimumSize,
+		},
+		{
+			name: "IPv6 with fast path",
+			protoAddr: tcpip.ProtocolAddress{
+				Protocol:          header.IPv6ProtocolNumber,
+				AddressWithPrefix: utils.Ipv6Addr,
+			},
+			fastPath:    true,
+			wantMSSOver: nicMTU,
+			wantMSSMax:  header.IPv6MaximumPayloadSize - header.TCPMinimumSize,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := stack.New(stack.Options{
+				NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol, ipv6.NewProtocol},
+				TransportProtocols: []stack.TransportProtocolFactory{tcp.NewProtocol},
+				HandleLocal:        true,
+			})
+			defer s.Destroy()
+			opt := tcpip.TCPLoopbackFastPathOption(test.fastPath)
+			if err := s.SetTransportProtocolOption(tcp.ProtocolNumber, &opt); err != nil {
+				t.Fatalf("SetTransportProtocolOption(%d, &%T(%t)): %s", tcp.ProtocolNumber, opt, opt, err)
+			}
+			if err := s.CreateNIC(nicID, channel.New(0, nicMTU, "")); err != nil {
+				t.Fatalf("CreateNIC(%d, _): %s", nicID, err)
+			}
+			if err := s.AddProtocolAddress(nicID, test.protoAddr, stack.AddressProperties{}); err != nil {
+				t.Fatalf("AddProtocolAddress(%d, %+v, {}): %s", nicID, test.protoAddr, err)
+			}
+			s.SetRouteTable([]tcpip.Route{
+				{
+					Destination: header.IPv4EmptySubnet,
+					NIC:         nicID,
+				},
+				{
+					Destination: header.IPv6EmptySubnet,
+					NIC:         nicID,
+				},
+			})
+
+			var listenerWQ waiter.Queue
+			listenerWE, listenerCH := waiter.NewChannelEntry(waiter.ReadableEvents)
+			listenerWQ.EventRegister(&listenerWE)
+			defer listenerWQ.EventUnregister(&listenerWE)
+			listeningEndpoint, err := s.NewEndpoint(tcp.ProtocolNumber, test.protoAddr.Protocol, &listenerWQ)
+			if err != nil {
+				t.Fatalf("NewEndpoint(%d, %d, _): %s", tcp.ProtocolNumber, test.protoAddr.Protocol, err)
+			}
+			defer listeningEndpoint.Close()
+			bindAddr := tcpip.FullAddress{Port: localPort}
+			if err := listeningEndpoint.Bind(bindAddr); err != nil {
+				t.Fatalf("listeningEndpoint.Bind(%#v): %s", bindAddr, err)
+			}
+			if err := listeningEndpoint.Listen(1); err != nil {
+				t.Fatalf("listeningEndpoint.Listen(1): %s", err)
+			}
+
+			var connectingWQ waiter.Queue
+			connectingWE, connectingCH := waiter.NewChannelEntry(waiter.WritableEvents)
+			connectingWQ.EventRegister(&connectingWE)
+			defer connectingWQ.EventUnregister(&connectingWE)
+			connectingEndpoint, err := s.NewEndpoint(tcp.ProtocolNumber, test.protoAddr.Protocol, &connectingWQ)
+			if err != nil {
+				t.Fatalf("NewEndpoint(%d, %d, _): %s", tcp.ProtocolNumber, test.protoAddr.Protocol, err)
+			}
+			defer connectingEndpoint.Close()
+			connectAddr := tcpip.FullAddress{
+				Addr: test.protoAddr.AddressWithPrefix.Address,
+				Port: localPort,
+			}
+			{
+				err := connectingEndpoint.Connect(connectAddr)
+				if _, ok := err.(*tcpip.ErrConnectStarted); !ok {
+					t.Fatalf("connectingEndpoint.Connect(%#v): %s", connectAddr, err)
+				}
+			}
+			<-connectingCH
+			<-listenerCH
+			acceptedEndpoint, _, err := listeningEndpoint.Accept(nil)
+			if err != nil {
+				t.Fatalf("listeningEndpoint.Accept(nil): %s", err)
+			}
+			defer acceptedEndpoint.Close()
+
+			for _, ep := range []struct {
+				name string
+				ep   tcpip.Endpoint
+			}{
+				{name: "connecting", ep: connectingEndpoint},
+				{name: "accepted", ep: acceptedEndpoint},
+			} {
+				var info tcpip.TCPInfoOption
+				if err := ep.ep.GetSockOpt(&info); err != nil {
+					t.Fatalf("%s endpoint GetSockOpt(&%T): %s", ep.name, info, err)
+				}
+				if info.SndMSS <= test.wantMSSOver || info.SndMSS > test.wantMSSMax {
+					t.Errorf("got %s endpoint SndMSS = %d, want in (%d, %d]", ep.name, info.SndMSS, test.wantMSSOver, test.wantMSSMax)
+				}
+			}
+
+			// Data larger than the NIC's MTU still makes it across.
+			data := bytes.Repeat([]byte{1, 2, 3, 4}, nicMTU)
+			var r bytes.Reader
+			r.Reset(data)
+			if n, err := connectingEndpoint.Write(&r, tcpip.WriteOptions{}); err != nil {
+				t.Fatalf("connectingEndpoint.Write(_, {}): %s", err)
+			} else if n != int64(len(data)) {
+				t.Fatalf("got connectingEndpoint.Write(_, {}) = %d, want = %d", n, len(data))
+			}
+			var got bytes.Buffer
+			for got.Len() < len(data) {
+				if _, err := acceptedEndpoint.Read(&got, tcpip.ReadOptions{}); err != nil {
+					if _, ok := err.(*tcpip.ErrWouldBlock); !ok {
+						t.Fatalf("acceptedEndpoint.Read(_, {}): %s", err)
+					}
+					time.Sleep(time.Millisecond)
+				}
+			}
+			if diff := cmp.Diff(data, got.Bytes()); diff != "" {
+				t.Errorf("received data mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
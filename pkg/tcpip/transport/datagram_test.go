@@ -22,8 +22,10 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/wilinz/gvisor/pkg/buffer"
 	"github.com/wilinz/gvisor/pkg/tcpip"
 	"github.com/wilinz/gvisor/pkg/tcpip/checker"
+	"github.com/wilinz/gvisor/pkg/tcpip/checksum"
 	"github.com/wilinz/gvisor/pkg/tcpip/header"
 	"github.com/wilinz/gvisor/pkg/tcpip/link/channel"
 	"github.com/wilinz/gvisor/pkg/tcpip/link/loopback"
@@ -1122,3 +1124,228 @@ func TestIPv6PacketInfo(t *testing.T) {
 		})
 	}
 }
+
+func TestICMPErrorQueue(t *testing.T) {
+	const nicID = 1
+
+	var (
+		localAddr  = testutil.MustParse4("10.0.0.1")
+		routerAddr = testutil.MustParse4("10.0.0.254")
+		remoteAddr = testutil.MustParse4("10.0.1.1")
+	)
+
+	buf := make([]byte, header.ICMPv4MinimumSize)
+	header.ICMPv4(buf).SetType(header.ICMPv4Echo)
+
+	for _, test := range []struct {
+		name           string
+		createEndpoint func(*stack.Stack, *waiter.Queue) (tcpip.Endpoint, error)
+		wantDstPort    uint16
+	}{
+		{
+			name: "UDP",
+			createEndpoint: func(s *stack.Stack, wq *waiter.Queue) (tcpip.Endpoint, error) {
+				ep, err := s.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, wq)
+				if err != nil {
+					return nil, fmt.Errorf("s.NewEndpoint(%d, %d, _) failed: %s", udp.ProtocolNumber, ipv4.ProtocolNumber, err)
+				}
+				return ep, nil
+			},
+			wantDstPort: 33434,
+		},
+		{
+			name: "ICMP",
+			createEndpoint: func(s *stack.Stack, wq *waiter.Queue) (tcpip.Endpoint, error) {
+				ep, err := s.NewEndpoint(icmp.ProtocolNumber4, ipv4.ProtocolNumber, wq)
+				if err != nil {
+					return nil, fmt.Errorf("s.NewEndpoint(%d, %d, _) failed: %s", icmp.ProtocolNumber4, ipv4.ProtocolNumber, err)
+				}
+				return ep, nil
+			},
+		},
+	} {
+		for _, recvErr := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/RecvErr=%t", test.name, recvErr), func(t *testing.T) {
+				s := stack.New(stack.Options{
+					NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+					TransportProtocols: []stack.TransportProtocolFactory{udp.NewProtocol, icmp.NewProtocol4},
+				})
+				defer s.Destroy()
+				e := channel.New(1, header.IPv4MinimumMTU, "")
+				defer e.Close()
+				if err := s.CreateNIC(nicID, e); err != nil {
+					t.Fatalf("s.CreateNIC(%d, _) failed: %s", nicID, err)
+				}
+				protocolAddr := tcpip.ProtocolAddress{
+					Protocol:          ipv4.ProtocolNumber,
+					AddressWithPrefix: tcpip.AddressWithPrefix{Address: localAddr, PrefixLen: 24},
+				}
+				if err := s.AddProtocolAddress(nicID, protocolAddr, stack.AddressProperties{}); err != nil {
+					t.Fatalf("s.AddProtocolAddress(%d, %+v, {}): %s", nicID, protocolAddr, err)
+				}
+				s.SetRouteTable([]tcpip.Route{{Destination: header.IPv4EmptySubnet, Gateway: routerAddr, NIC: nicID}})
+
+				var wq waiter.Queue
+				ep, err := test.createEndpoint(s, &wq)
+				if err != nil {
+					t.Fatalf("test.createEndpoint(_) failed: %s", err)
+				}
+				defer ep.Close()
+				ep.SocketOptions().SetIPv4RecvError(recvErr)
+
+				// Send a packet and have the router report that its TTL was
+				// exceeded, as when probed by traceroute.
+				to := tcpip.FullAddress{Addr: remoteAddr, Port: test.wantDstPort}
+				var r bytes.Reader
+				r.Reset(buf)
+				if _, err := ep.Write(&r, tcpip.WriteOptions{To: &to}); err != nil {
+					t.Fatalf("ep.Write(_, _): %s", err)
+				}
+				pkt := e.Read()
+				if pkt == nil {
+					t.Fatal("expected a packet to be sent")
+				}
+				sent := stack.PayloadSince(pkt.NetworkHeader())
+				pkt.DecRef()
+				defer sent.Release()
+
+				icmpBuf := make([]byte, header.IPv4MinimumSize+header.ICMPv4MinimumSize+sent.Size())
+				ip := header.IPv4(icmpBuf)
+				ip.Encode(&header.IPv4Fields{
+					TotalLength: uint16(len(icmpBuf)),
+					TTL:         64,
+					Protocol:    uint8(header.ICMPv4ProtocolNumber),
+					SrcAddr:     routerAddr,
+					DstAddr:     localAddr,
+				})
+				ip.SetChecksum(^ip.CalculateChecksum())
+				icmpHdr := header.ICMPv4(icmpBuf[header.IPv4MinimumSize:])
+				icmpHdr.SetType(header.ICMPv4TimeExceeded)
+				icmpHdr.SetCode(header.ICMPv4TTLExceeded)
+				copy(icmpHdr[header.ICMPv4MinimumSize:], sent.AsSlice())
+				icmpHdr.SetChecksum(0)
+				icmpHdr.SetChecksum(^checksum.Checksum(icmpHdr, 0))
+				e.InjectInbound(ipv4.ProtocolNumber, stack.NewPacketBuffer(stack.PacketBufferOptions{
+					Payload: buffer.MakeWithData(icmpBuf),
+				}))
+
+				// Without IP_RECVERR, soft errors are not reported.
+				if !recvErr {
+					if err := ep.LastError(); err != nil {
+						t.Errorf("got ep.LastError() = %s, want = nil", err)
+					}
+					if sockErr := ep.SocketOptions().DequeueErr(); sockErr != nil {
+						t.Errorf("got ep.SocketOptions().DequeueErr() = %#v, want = nil", sockErr)
+					}
+					return
+				}
+
+				if err := ep.LastError(); !cmp.Equal(&tcpip.ErrHostUnreachable{}, err) {
+					t.Errorf("got ep.LastError() = %v, want = %s", err, &tcpip.ErrHostUnreachable{})
+				}
+				sockErr := ep.SocketOptions().DequeueErr()
+				if sockErr == nil {
+					t.Fatal("expected a socket error to be queued")
+				}
+				defer sockErr.Payload.Release()
+				if got, want := sockErr.Dst, (tcpip.FullAddress{NIC: nicID, Addr: remoteAddr, Port: test.wantDstPort}); got != want {
+					t.Errorf("got sockErr.Dst = %+v, want = %+v", got, want)
+				}
+				if got, want := sockErr.Offender, (tcpip.FullAddress{NIC: nicID, Addr: routerAddr}); got != want {
+					t.Errorf("got sockErr.Offender = %+v, want = %+v", got, want)
+				}
+				if got, want := sockErr.Cause.Type(), uint8(header.ICMPv4TimeExceeded); got != want {
+					t.Errorf("got sockErr.Cause.Type() = %d, want = %d", got, want)
+				}
+				if got, want := sockErr.Cause.Code(), uint8(header.ICMPv4TTLExceeded); got != want {
+					t.Errorf("got sockErr.Cause.Code() = %d, want = %d", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestTXTimestamp(t *testing.T) {
+	const nicID = 1
+
+	var (
+		localAddr  = testutil.MustParse4("10.0.0.1")
+		remoteAddr = testutil.MustParse4("10.0.0.2")
+	)
+
+	for _, tsOnly := range []bool{false, true} {
+		t.Run(fmt.Sprintf("TSOnly=%t", tsOnly), func(t *testing.T) {
+			s := stack.New(stack.Options{
+				NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+				TransportProtocols: []stack.TransportProtocolFactory{udp.NewProtocol},
+			})
+			defer s.Destroy()
+			e := channel.New(2, defaultMTU, "")
+			defer e.Close()
+			if err := s.CreateNIC(nicID, e); err != nil {
+				t.Fatalf("s.CreateNIC(%d, _) failed: %s", nicID, err)
+			}
+			protocolAddr := tcpip.ProtocolAddress{
+				Protocol:          ipv4.ProtocolNumber,
+				AddressWithPrefix: tcpip.AddressWithPrefix{Address: localAddr, PrefixLen: 24},
+			}
+			if err := s.AddProtocolAddress(nicID, protocolAddr, stack.AddressProperties{}); err != nil {
+				t.Fatalf("s.AddProtocolAddress(%d, %+v, {}): %s", nicID, protocolAddr, err)
+			}
+			s.SetRouteTable([]tcpip.Route{{Destination: header.IPv4EmptySubnet, NIC: nicID}})
+
+			var wq waiter.Queue
+			ep, err := s.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &wq)
+			if err != nil {
+				t.Fatalf("s.NewEndpoint(%d, %d, _) failed: %s", udp.ProtocolNumber, ipv4.ProtocolNumber, err)
+			}
+			defer ep.Close()
+			flags := tcpip.TimestampingTXSoftware | tcpip.TimestampingSoftware | tcpip.TimestampingOptID
+			if tsOnly {
+				flags |= tcpip.TimestampingOptTSOnly
+			}
+			ep.SocketOptions().SetTimestamping(flags)
+
+			data := []byte{1, 2, 3, 4}
+			to := tcpip.FullAddress{Addr: remoteAddr, Port: 1234}
+			before := s.Clock().Now()
+			for i := 0; i < 2; i++ {
+				var r bytes.Reader
+				r.Reset(data)
+				if _, err := ep.Write(&r, tcpip.WriteOptions{To: &to}); err != nil {
+					t.Fatalf("ep.Write(_, _): %s", err)
+				}
+				e.Read().DecRef()
+			}
+			after := s.Clock().Now()
+
+			for key := uint32(0); key < 2; key++ {
+				sockErr := ep.SocketOptions().DequeueErr()
+				if sockErr == nil {
+					t.Fatalf("expected timestamp %d to be queued", key)
+				}
+				if got, want := sockErr.Cause, (&tcpip.TimestampingSockError{Key: key}); !cmp.Equal(got, want) {
+					t.Errorf("got sockErr.Cause = %#v, want = %#v", got, want)
+				}
+				if ts := sockErr.Timestamp; ts.Before(before) || ts.After(after) {
+					t.Errorf("got sockErr.Timestamp = %s, want in [%s, %s]", ts, before, after)
+				}
+				if tsOnly {
+					if sockErr.Payload != nil {
+						t.Errorf("got sockErr.Payload = %v, want = nil", sockErr.Payload.AsSlice())
+					}
+					continue
+				}
+				if got, want := sockErr.Payload.Size(), header.UDPMinimumSize+len(data); got != want {
+					t.Errorf("got sockErr.Payload.Size() = %d, want = %d", got, want)
+				} else if got := sockErr.Payload.AsSlice()[header.UDPMinimumSize:]; !bytes.Equal(got, data) {
+					t.Errorf("got payload data = %v, want = %v", got, data)
+				}
+				sockErr.Payload.Release()
+			}
+			if sockErr := ep.SocketOptions().DequeueErr(); sockErr != nil {
+				t.Errorf("got ep.SocketOptions().DequeueErr() = %#v, want = nil", sockErr)
+			}
+		})
+	}
+}
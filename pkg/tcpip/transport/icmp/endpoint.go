@@ -78,6 +78,11 @@ type endpoint struct {
 	// during restore.
 	frozen bool
 	ident  uint16
+
+	// lastError is the error reported by the last ICMP error received for a
+	// packet sent by the endpoint, and is protected by lastErrorMu.
+	lastErrorMu sync.Mutex `state:"nosave"`
+	lastError   tcpip.Error
 }
 
 func newEndpoint(s *stack.Stack, netProto tcpip.NetworkProtocolNumber, transProto tcpip.TransportProtocolNumber, waiterQueue *waiter.Queue) (tcpip.Endpoint, tcpip.Error) {
@@ -684,6 +689,12 @@ func (e *endpoint) Readiness(mask waiter.EventMask) waiter.EventMask {
 		e.rcvMu.Unlock()
 	}
 
+	e.lastErrorMu.Lock()
+	hasError := e.lastError != nil
+	e.lastErrorMu.Unlock()
+	if hasError {
+		result |= waiter.EventErr
+	}
 	return result
 }
 
@@ -777,7 +788,34 @@ func (e *endpoint) HandlePacket(id stack.TransportEndpointID, pkt *stack.PacketB
 }
 
 // HandleError implements stack.TransportEndpoint.
-func (*endpoint) HandleError(stack.TransportError, *stack.PacketBuffer) {}
+func (e *endpoint) HandleError(id stack.TransportEndpointID, transErr stack.TransportError, pkt *stack.PacketBuffer) {
+	err, recvErr := e.net.ICMPError(transErr, pkt)
+	if err == nil {
+		return
+	}
+
+	e.lastErrorMu.Lock()
+	e.lastError = err
+	e.lastErrorMu.Unlock()
+
+	if recvErr {
+		// Linux passes the payload with the ICMP header of the echo request,
+		// and no port.
+		e.ops.QueueErr(&tcpip.SockError{
+			Err:     err,
+			Cause:   transErr,
+			Payload: pkt.Data().AsRange().ToView(),
+			Dst: tcpip.FullAddress{
+				NIC:  pkt.NICID,
+				Addr: id.RemoteAddress,
+			},
+			Offender: network.ICMPErrorOffender(id, pkt),
+			NetProto: pkt.NetworkProtocolNumber,
+		})
+	}
+
+	e.waiterQueue.Notify(waiter.EventErr)
+}
 
 // State implements tcpip.Endpoint.State. The ICMP endpoint currently doesn't
 // expose internal socket state.
@@ -803,8 +841,20 @@ func (e *endpoint) Stats() tcpip.EndpointStats {
 func (*endpoint) Wait() {}
 
 // LastError implements tcpip.Endpoint.LastError.
-func (*endpoint) LastError() tcpip.Error {
-	return nil
+func (e *endpoint) LastError() tcpip.Error {
+	e.lastErrorMu.Lock()
+	defer e.lastErrorMu.Unlock()
+
+	err := e.lastError
+	e.lastError = nil
+	return err
+}
+
+// UpdateLastError implements tcpip.SocketOptionsHandler.UpdateLastError.
+func (e *endpoint) UpdateLastError(err tcpip.Error) {
+	e.lastErrorMu.Lock()
+	e.lastError = err
+	e.lastErrorMu.Unlock()
 }
 
 // SocketOptions implements tcpip.Endpoint.SocketOptions.
@@ -87,14 +87,23 @@ func (p *protocol) MinimumPacketSize() int {
 	panic(fmt.Sprint("unknown protocol number: ", p.number))
 }
 
-// ParsePorts in case of ICMP sets src to 0, dst to ICMP ID, and err to nil.
+// ParsePorts in case of ICMP sets the port of the endpoint that sent the echo
+// request to the ICMP ID, and the other port to 0. That is, src is the ICMP ID
+// of echo requests (e.g. those quoted by ICMP errors), and dst is the ICMP ID
+// of other messages (e.g. echo replies).
 func (p *protocol) ParsePorts(v []byte) (src, dst uint16, err tcpip.Error) {
 	switch p.number {
 	case ProtocolNumber4:
 		hdr := header.ICMPv4(v)
+		if hdr.Type() == header.ICMPv4Echo {
+			return hdr.Ident(), 0, nil
+		}
 		return 0, hdr.Ident(), nil
 	case ProtocolNumber6:
 		hdr := header.ICMPv6(v)
+		if hdr.Type() == header.ICMPv6EchoRequest {
+			return hdr.Ident(), 0, nil
+		}
 		return 0, hdr.Ident(), nil
 	}
 	panic(fmt.Sprint("unknown protocol number: ", p.number))
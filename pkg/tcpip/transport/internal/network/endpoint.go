@@ -73,6 +73,14 @@ type Endpoint struct {
 	ipv4TOS uint8
 	// +checklocks:mu
 	ipv6TClass uint8
+	// pmtud is the path MTU discovery strategy of the endpoint.
+	//
+	// +checklocks:mu
+	pmtud tcpip.PMTUDStrategy
+	// ipv6MTU caps the MTU of outgoing IPv6 packets if it isn't zero.
+	//
+	// +checklocks:mu
+	ipv6MTU uint32
 
 	// Lock ordering: mu > infoMu.
 	infoMu sync.RWMutex `state:"nosave"`
@@ -143,6 +151,7 @@ func (e *Endpoint) Init(s *stack.Stack, netProto tcpip.NetworkProtocolNumber, tr
 	e.effectiveNetProto = netProto
 	e.ipv4TTL = tcpip.UseDefaultIPv4TTL
 	e.ipv6HopLimit = tcpip.UseDefaultIPv6HopLimit
+	e.pmtud = tcpip.PMTUDiscoveryDont
 
 	// Linux defaults to TTL=1.
 	e.multicastTTL = 1
@@ -223,16 +232,65 @@ func (e *Endpoint) calculateTTL(route *stack.Route) uint8 {
 	}
 }
 
+// capIPv6MTU returns mtu, the maximum payload size of IPv6 packets, capped by
+// the MTU set with IPv6MTUOption.
+//
+// +checklocksread:e.mu
+func (e *Endpoint) capIPv6MTU(mtu uint32) uint32 {
+	if e.ipv6MTU != 0 {
+		mtu = min(mtu, e.ipv6MTU-header.IPv6MinimumSize)
+	}
+	return mtu
+}
+
 // WriteContext holds the context for a write.
 type WriteContext struct {
 	e     *Endpoint
 	route *stack.Route
 	ttl   uint8
 	tos   uint8
+	pmtud tcpip.PMTUDStrategy
+	mtu   uint32
 }
 
+// MTU returns the maximum size of the transport packets written by the
+// context that don't need to be fragmented.
 func (c *WriteContext) MTU() uint32 {
-	return c.route.MTU()
+	return c.mtu
+}
+
+// MustNotFragment returns true if packets larger than MTU must fail with
+// ErrMessageTooLong instead of being fragmented, as for Linux's
+// IP_PMTUDISC_DO and IP_PMTUDISC_PROBE. Unlike Linux, PMTUDiscoveryProbe
+// doesn't ignore the path MTU learned by the stack.
+func (c *WriteContext) MustNotFragment() bool {
+	return c.pmtud == tcpip.PMTUDiscoveryDo || c.pmtud == tcpip.PMTUDiscoveryProbe
+}
+
+// dontFragment returns true if the DF bit should be set on an IPv4 packet
+// with a transport packet of the given size. Like Linux, PMTUDiscoveryWant
+// only sets DF on packets that don't need to be fragmented.
+func (c *WriteContext) dontFragment(size int) bool {
+	if c.route.NetProto() != header.IPv4ProtocolNumber {
+		return false
+	}
+	switch c.pmtud {
+	case tcpip.PMTUDiscoveryDo, tcpip.PMTUDiscoveryProbe:
+		return true
+	case tcpip.PMTUDiscoveryWant:
+		return size <= int(c.mtu)
+	default:
+		return false
+	}
+}
+
+// HostGSOMaxSize returns the maximum size of packets whose segmentation may be
+// offloaded to the host, or zero if the route doesn't support host GSO.
+func (c *WriteContext) HostGSOMaxSize() uint32 {
+	if c.route.Loop()&stack.PacketLoop != 0 || !c.route.HasHostGSOCapability() {
+		return 0
+	}
+	return c.route.GSOMaxSize()
 }
 
 // Release releases held resources.
@@ -342,7 +400,34 @@ func (c *WriteContext) newPacketBufferLocked(reserveHdrBytes int, data buffer.Bu
 }
 
 // WritePacket attempts to write the packet.
+//
+// If SO_TIMESTAMPING requests it, a transmit timestamp is queued onto the
+// error queue once the packet is passed to the link layer.
 func (c *WriteContext) WritePacket(pkt *stack.PacketBuffer, headerIncluded bool) tcpip.Error {
+	flags := c.e.ops.GetTimestamping()
+	if flags&tcpip.TimestampingTXSoftware == 0 {
+		return c.writePacket(pkt, headerIncluded)
+	}
+
+	// Unlike Linux which loops back the whole frame, the timestamp carries
+	// the packet from its transport header (or network header if included)
+	// onward. It must be copied before the packet is handed off.
+	var payload *buffer.View
+	if flags&tcpip.TimestampingOptTSOnly == 0 {
+		payload = pkt.ToView()
+	}
+	if err := c.writePacket(pkt, headerIncluded); err != nil {
+		if payload != nil {
+			payload.Release()
+		}
+		return err
+	}
+	c.e.ops.QueueTXTimestamp(c.route.NetProto(), c.e.stack.Clock().Now(), payload)
+	c.e.waiterQueue.Notify(waiter.EventErr)
+	return nil
+}
+
+func (c *WriteContext) writePacket(pkt *stack.PacketBuffer, headerIncluded bool) tcpip.Error {
 	c.e.mu.RLock()
 	pkt.Owner = c.e.owner
 	c.e.mu.RUnlock()
@@ -360,6 +445,7 @@ func (c *WriteContext) WritePacket(pkt *stack.PacketBuffer, headerIncluded bool)
 		Protocol:              c.e.transProto,
 		TTL:                   c.ttl,
 		TOS:                   c.tos,
+		DF:                    c.dontFragment(pkt.Size()),
 		ExperimentOptionValue: expOptVal,
 	}, pkt)
 
@@ -547,6 +633,7 @@ func (e *Endpoint) AcquireContextForWrite(opts tcpip.WriteOptions) (WriteContext
 
 	var tos uint8
 	var ttl uint8
+	mtu := route.MTU()
 	switch netProto := route.NetProto(); netProto {
 	case header.IPv4ProtocolNumber:
 		tos = e.ipv4TOS
@@ -562,6 +649,7 @@ func (e *Endpoint) AcquireContextForWrite(opts tcpip.WriteOptions) (WriteContext
 		} else {
 			ttl = e.calculateTTL(route)
 		}
+		mtu = e.capIPv6MTU(mtu)
 	default:
 		panic(fmt.Sprintf("invalid protocol number = %d", netProto))
 	}
@@ -571,6 +659,8 @@ func (e *Endpoint) AcquireContextForWrite(opts tcpip.WriteOptions) (WriteContext
 		route: route,
 		ttl:   ttl,
 		tos:   tos,
+		pmtud: e.pmtud,
+		mtu:   mtu,
 	}, nil
 }
 
@@ -624,13 +714,22 @@ func (e *Endpoint) connectRouteRLocked(nicID tcpip.NICID, localAddr tcpip.Addres
 	}
 
 	// Find a route to the desired destination.
-	r, err := e.stack.FindRoute(nicID, localAddr, addr.Addr, netProto, e.ops.GetMulticastLoop())
+	r, err := e.findRoute(nicID, localAddr, addr.Addr, netProto)
 	if err != nil {
 		return nil, 0, err
 	}
 	return r, nicID, nil
 }
 
+// findRoute returns a route from localAddr to remoteAddr. If the endpoint is
+// transparent, localAddr doesn't need to be a local address.
+func (e *Endpoint) findRoute(nicID tcpip.NICID, localAddr, remoteAddr tcpip.Address, netProto tcpip.NetworkProtocolNumber) (*stack.Route, tcpip.Error) {
+	if e.ops.GetTransparent() {
+		return e.stack.FindTransparentRoute(nicID, localAddr, remoteAddr, netProto, e.ops.GetMulticastLoop())
+	}
+	return e.stack.FindRoute(nicID, localAddr, remoteAddr, netProto, e.ops.GetMulticastLoop())
+}
+
 // Connect connects the endpoint to the address.
 func (e *Endpoint) Connect(addr tcpip.FullAddress) tcpip.Error {
 	return e.ConnectAndThen(addr, func(_ tcpip.NetworkProtocolNumber, _, _ stack.TransportEndpointID) tcpip.Error {
@@ -769,7 +868,11 @@ func (e *Endpoint) BindAndThen(addr tcpip.FullAddress, f func(tcpip.NetworkProto
 	if addr.Addr.BitLen() != 0 && !e.isBroadcastOrMulticast(addr.NIC, netProto, addr.Addr) {
 		nicID = e.stack.CheckLocalAddress(nicID, netProto, addr.Addr)
 		if nicID == 0 {
-			return &tcpip.ErrBadLocalAddress{}
+			// Transparent endpoints may bind to non-local addresses.
+			if !e.ops.GetTransparent() {
+				return &tcpip.ErrBadLocalAddress{}
+			}
+			nicID = addr.NIC
 		}
 	}
 
@@ -835,12 +938,24 @@ func (e *Endpoint) GetRemoteAddress() (tcpip.FullAddress, bool) {
 func (e *Endpoint) SetSockOptInt(opt tcpip.SockOptInt, v int) tcpip.Error {
 	switch opt {
 	case tcpip.MTUDiscoverOption:
-		// Return not supported if the value is not disabling path
-		// MTU discovery.
-		if tcpip.PMTUDStrategy(v) != tcpip.PMTUDiscoveryDont {
-			return &tcpip.ErrNotSupported{}
+		switch v := tcpip.PMTUDStrategy(v); v {
+		case tcpip.PMTUDiscoveryWant, tcpip.PMTUDiscoveryDont, tcpip.PMTUDiscoveryDo, tcpip.PMTUDiscoveryProbe:
+			e.mu.Lock()
+			e.pmtud = v
+			e.mu.Unlock()
+		default:
+			return &tcpip.ErrInvalidOptionValue{}
 		}
 
+	case tcpip.IPv6MTUOption:
+		// Like Linux, the MTU can't be lower than the IPv6 minimum MTU.
+		if v != 0 && v < header.IPv6MinimumMTU {
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+		e.mu.Lock()
+		e.ipv6MTU = uint32(v)
+		e.mu.Unlock()
+
 	case tcpip.MulticastTTLOption:
 		e.mu.Lock()
 		e.multicastTTL = uint8(v)
@@ -874,8 +989,30 @@ func (e *Endpoint) SetSockOptInt(opt tcpip.SockOptInt, v int) tcpip.Error {
 func (e *Endpoint) GetSockOptInt(opt tcpip.SockOptInt) (int, tcpip.Error) {
 	switch opt {
 	case tcpip.MTUDiscoverOption:
-		// The only supported setting is path MTU discovery disabled.
-		return int(tcpip.PMTUDiscoveryDont), nil
+		e.mu.RLock()
+		v := int(e.pmtud)
+		e.mu.RUnlock()
+		return v, nil
+
+	case tcpip.IPv6MTUOption:
+		e.mu.RLock()
+		v := int(e.ipv6MTU)
+		e.mu.RUnlock()
+		return v, nil
+
+	case tcpip.PathMTUOption:
+		e.mu.RLock()
+		defer e.mu.RUnlock()
+		if e.State() != transport.DatagramEndpointStateConnected {
+			return -1, &tcpip.ErrNotConnected{}
+		}
+		// The path MTU includes the network header, like the MTU of
+		// a link.
+		r := e.connectedRoute
+		if r.NetProto() == header.IPv6ProtocolNumber {
+			return int(e.capIPv6MTU(r.MTU())) + header.IPv6MinimumSize, nil
+		}
+		return int(r.MTU()) + header.IPv4MinimumSize, nil
 
 	case tcpip.MulticastTTLOption:
 		e.mu.Lock()
@@ -1063,3 +1200,70 @@ func (e *Endpoint) setInfo(info stack.TransportEndpointInfo) {
 	defer e.infoMu.Unlock()
 	e.info = info
 }
+
+// ICMPError returns the error reported to the endpoint by an ICMP error
+// received for a packet it sent, or nil if the ICMP error is ignored. recvErr
+// is true if the error must also be queued to the endpoint's error queue.
+//
+// As in Linux's __udp4_lib_err() and ping_err(), all errors are reported if
+// IP_RECVERR (or IPV6_RECVERR) is set; otherwise, only hard errors are
+// reported, and only to connected endpoints.
+func (e *Endpoint) ICMPError(transErr stack.TransportError, pkt *stack.PacketBuffer) (err tcpip.Error, recvErr bool) {
+	switch pkt.NetworkProtocolNumber {
+	case header.IPv4ProtocolNumber:
+		recvErr = e.ops.GetIPv4RecvError()
+	case header.IPv6ProtocolNumber:
+		recvErr = e.ops.GetIPv6RecvError()
+	default:
+		panic(fmt.Sprintf("unhandled network protocol number = %d", pkt.NetworkProtocolNumber))
+	}
+
+	err, hard := icmpErrorToError(transErr)
+	if !recvErr && (!hard || e.State() != transport.DatagramEndpointStateConnected) {
+		return nil, false
+	}
+	return err, recvErr
+}
+
+// icmpErrorToError returns the error corresponding to an ICMP error, and
+// whether it is a hard error. This matches Linux's icmp_err_convert and
+// icmpv6_err_convert tables.
+func icmpErrorToError(transErr stack.TransportError) (err tcpip.Error, hard bool) {
+	switch kind := transErr.Kind(); kind {
+	case stack.PacketTooBigTransportError:
+		return &tcpip.ErrMessageTooLong{}, true
+	case stack.DestinationHostUnreachableTransportError:
+		return &tcpip.ErrHostUnreachable{}, false
+	case stack.DestinationPortUnreachableTransportError:
+		return &tcpip.ErrConnectionRefused{}, true
+	case stack.DestinationNetworkUnreachableTransportError:
+		return &tcpip.ErrNetworkUnreachable{}, false
+	case stack.DestinationProtoUnreachableTransportError:
+		return &tcpip.ErrUnknownProtocolOption{}, true
+	case stack.SourceRouteFailedTransportError:
+		return &tcpip.ErrNotSupported{}, false
+	case stack.SourceHostIsolatedTransportError:
+		return &tcpip.ErrNoNet{}, true
+	case stack.DestinationHostDownTransportError:
+		return &tcpip.ErrHostDown{}, true
+	case stack.TimeExceededTransportError:
+		return &tcpip.ErrHostUnreachable{}, false
+	default:
+		panic(fmt.Sprintf("unhandled transport error kind = %d", kind))
+	}
+}
+
+// ICMPErrorOffender returns the address of the node that sent an ICMP error
+// for the packet identified by id.
+func ICMPErrorOffender(id stack.TransportEndpointID, pkt *stack.PacketBuffer) tcpip.FullAddress {
+	// Errors generated locally (e.g. on link resolution failures) carry no
+	// ICMP packet, and are reported by the local node.
+	addr := id.LocalAddress
+	if len(pkt.NetworkHeader().Slice()) != 0 {
+		addr = pkt.Network().SourceAddress()
+	}
+	return tcpip.FullAddress{
+		NIC:  pkt.NICID,
+		Addr: addr,
+	}
+}
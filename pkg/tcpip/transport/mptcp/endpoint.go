@@ -0,0 +1,759 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mptcp
+
+import (
+	"bytes"
+	"io"
+	"sort"
+
+	"github.com/wilinz/gvisor/pkg/atomicbitops"
+	"github.com/wilinz/gvisor/pkg/buffer"
+	"github.com/wilinz/gvisor/pkg/sync"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/seqnum"
+	"github.com/wilinz/gvisor/pkg/tcpip/transport/tcp"
+	"github.com/wilinz/gvisor/pkg/waiter"
+)
+
+// subflow is a TCP subflow of a connection.
+//
+// +stateify savable
+type subflow struct {
+	ep *tcp.Endpoint
+
+	// rcvSSN is the relative subflow sequence number of the next byte to
+	// be read from ep.
+	rcvSSN seqnum.Value
+
+	// rcvClosed is true once nothing more can be read from ep.
+	rcvClosed bool
+
+	// wq is the waiter queue of ep, and entry forwards its events to the
+	// connection's queue. They are only set for joined subflows, as the
+	// initial subflow uses the connection's queue.
+	wq    *waiter.Queue
+	entry waiter.Entry
+}
+
+// rcvChunk is data received ahead of the data sequence number expected next.
+//
+// +stateify savable
+type rcvChunk struct {
+	dsn  uint64
+	data []byte
+}
+
+// Endpoint is an MPTCP endpoint.
+//
+// The endpoint is backed by its initial subflow: its addresses, socket
+// options and TCP state are those of the initial subflow. Until the initial
+// subflow has negotiated MPTCP, or once it falls back to regular TCP, the
+// endpoint forwards all operations to it.
+//
+// +stateify savable
+type Endpoint struct {
+	waiterQueue *waiter.Queue
+	initial     *tcp.Endpoint
+
+	mu sync.Mutex `state:"nosave"`
+
+	// mptcp is true if the connection uses MPTCP.
+	//
+	// +checklocks:mu
+	mptcp bool
+
+	// fallback is true if the connection fell back to regular TCP.
+	//
+	// +checklocks:mu
+	fallback bool
+
+	// subflows are the subflows of the connection. Data is sent on the
+	// first one.
+	//
+	// +checklocks:mu
+	subflows []*subflow
+
+	// rcvNxt is the data sequence number of the next byte expected from
+	// the peer, i.e. the Data ACK. It is read by the subflows without mu.
+	rcvNxt atomicbitops.Uint64
+
+	// rcvBuf holds the data received in order and not read yet.
+	//
+	// +checklocks:mu
+	rcvBuf buffer.Buffer
+
+	// rcvOOO holds data received out of order, sorted by data sequence
+	// number.
+	//
+	// +checklocks:mu
+	rcvOOO []rcvChunk
+
+	// rcvClosed is true once the peer's DATA_FIN has been received.
+	//
+	// +checklocks:mu
+	rcvClosed bool
+
+	// sndUna is the latest Data ACK received from the peer. It is updated
+	// by the subflows without mu.
+	sndUna atomicbitops.Uint64
+
+	// sndBuf holds the data sent from data sequence number sndBufDSN up to
+	// sndNxt, which is kept until the peer acknowledges it at the data
+	// level so that it can be retransmitted on another subflow.
+	//
+	// +checklocks:mu
+	sndBuf buffer.Buffer
+	// +checklocks:mu
+	sndBufDSN uint64
+
+	// sndQueued is the data sequence number up to which data was written
+	// to the first subflow. It is behind sndNxt after a subflow failed,
+	// until the data is retransmitted.
+	//
+	// +checklocks:mu
+	sndQueued uint64
+
+	// sndNxt is the data sequence number of the next byte to be written.
+	//
+	// +checklocks:mu
+	sndNxt uint64
+
+	// sndClosed is true once the DATA_FIN has been queued.
+	//
+	// +checklocks:mu
+	sndClosed bool
+
+	// bytesSent and bytesReceived count the data sent and received at the
+	// connection level.
+	//
+	// +checklocks:mu
+	bytesSent uint64
+	// +checklocks:mu
+	bytesReceived uint64
+
+	// joinMu protects joined and closed, which are accessed by the
+	// subflows while their mutex is held.
+	joinMu sync.Mutex `state:"nosave"`
+
+	// joined are the subflows which joined the connection and haven't
+	// been added to subflows yet.
+	//
+	// +checklocks:joinMu
+	joined []*subflow
+
+	// closed is true once the endpoint has been closed.
+	//
+	// +checklocks:joinMu
+	closed bool
+}
+
+var _ tcp.MPTCPConn = (*Endpoint)(nil)
+
+func newEndpoint(waiterQueue *waiter.Queue, initial *tcp.Endpoint) *Endpoint {
+	return &Endpoint{
+		waiterQueue: waiterQueue,
+		initial:     initial,
+	}
+}
+
+// sendable returns true if data can be sent in state s.
+func sendable(s tcp.EndpointState) bool {
+	return s == tcp.StateEstablished || s == tcp.StateCloseWait
+}
+
+// connected returns true if s is a connected state.
+func connected(s tcp.EndpointState) bool {
+	switch s {
+	case tcp.StateEstablished, tcp.StateFinWait1, tcp.StateFinWait2, tcp.StateTimeWait, tcp.StateCloseWait, tcp.StateLastAck, tcp.StateClosing:
+		return true
+	default:
+		return false
+	}
+}
+
+// storeMax sets v to x if x is larger.
+func storeMax(v *atomicbitops.Uint64, x uint64) {
+	for {
+		old := v.Load()
+		if x <= old || v.CompareAndSwap(old, x) {
+			return
+		}
+	}
+}
+
+// syncLocked switches e to MPTCP or regular TCP once the initial subflow
+// has negotiated it.
+//
+// +checklocks:e.mu
+func (e *Endpoint) syncLocked() {
+	if e.fallback || !connected(e.initial.EndpointState()) {
+		return
+	}
+	info := e.initial.MPTCPInfo()
+	switch {
+	case info.Fallback:
+		// Connections can still fall back after the handshake if the
+		// peer's first data carries no mapping, before any data was
+		// read through a mapping.
+		e.fallback = true
+		e.mptcp = false
+		e.sndBuf.Release()
+		e.sndBuf = buffer.Buffer{}
+	case info.Established && !e.mptcp:
+		e.mptcp = true
+		storeMax(&e.rcvNxt, info.RemoteIDSN+1)
+		storeMax(&e.sndUna, info.LocalIDSN+1)
+		e.sndNxt = info.LocalIDSN + 1
+		e.sndQueued = e.sndNxt
+		e.sndBufDSN = e.sndNxt
+		e.subflows = []*subflow{{ep: e.initial, rcvSSN: 1}}
+	}
+}
+
+// adoptJoinedLocked adds the subflows which joined the connection to
+// e.subflows.
+//
+// +checklocks:e.mu
+func (e *Endpoint) adoptJoinedLocked() {
+	e.joinMu.Lock()
+	joined := e.joined
+	e.joined = nil
+	e.joinMu.Unlock()
+	e.subflows = append(e.subflows, joined...)
+}
+
+// closeSubflow closes a joined subflow.
+func closeSubflow(sf *subflow, abort bool) {
+	sf.wq.EventUnregister(&sf.entry)
+	if abort {
+		sf.ep.Abort()
+	} else {
+		sf.ep.Close()
+	}
+}
+
+// activeLocked returns the subflow to send data on, after retiring subflows
+// which can't send anymore. It returns nil if no subflow can send.
+//
+// +checklocks:e.mu
+func (e *Endpoint) activeLocked() *subflow {
+	e.adoptJoinedLocked()
+	for len(e.subflows) > 0 {
+		sf := e.subflows[0]
+		if sendable(sf.ep.EndpointState()) {
+			return sf
+		}
+		// The subflow failed. Retransmit the data which the peer
+		// didn't acknowledge at the data level on the next subflow.
+		e.subflows = e.subflows[1:]
+		if sf.ep != e.initial {
+			closeSubflow(sf, false /* abort */)
+		}
+		e.trimLocked()
+		e.sndQueued = e.sndBufDSN
+		if len(e.subflows) > 0 {
+			e.subflows[0].ep.MPTCPStartSending(e.sndQueued)
+		}
+	}
+	return nil
+}
+
+// trimLocked releases the data acknowledged by the peer.
+//
+// +checklocks:e.mu
+func (e *Endpoint) trimLocked() {
+	una := min(e.sndUna.Load(), e.sndQueued)
+	if una > e.sndBufDSN {
+		e.sndBuf.TrimFront(int64(una - e.sndBufDSN))
+		e.sndBufDSN = una
+	}
+}
+
+// flushLocked retransmits the data which was queued on a failed subflow on
+// sf.
+//
+// +checklocks:e.mu
+func (e *Endpoint) flushLocked(sf *subflow) tcpip.Error {
+	e.trimLocked()
+	for e.sndQueued < e.sndNxt {
+		b := e.sndBuf.Clone()
+		b.TrimFront(int64(e.sndQueued - e.sndBufDSN))
+		r := bytes.NewReader(b.Flatten())
+		b.Release()
+		n, err := sf.ep.Write(r, tcpip.WriteOptions{})
+		e.sndQueued += uint64(n)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return &tcpip.ErrWouldBlock{}
+		}
+	}
+	return nil
+}
+
+// pullLocked reads the data received on the subflows and reassembles it.
+//
+// +checklocks:e.mu
+func (e *Endpoint) pullLocked() {
+	e.adoptJoinedLocked()
+	limit := e.initial.SocketOptions().GetReceiveBufferSize()
+	for _, sf := range e.subflows {
+		if sf.rcvClosed || e.rcvBuf.Size() >= limit {
+			continue
+		}
+		var b bytes.Buffer
+		switch _, err := sf.ep.Read(&b, tcpip.ReadOptions{}); err.(type) {
+		case nil:
+			before := e.rcvNxt.Load()
+			e.deliverLocked(sf, b.Bytes())
+			if e.rcvNxt.Load() != before {
+				sf.ep.MPTCPSendDataAck()
+			}
+		case *tcpip.ErrWouldBlock:
+		default:
+			sf.rcvClosed = true
+		}
+	}
+	if e.rcvClosed {
+		return
+	}
+	for _, sf := range e.subflows {
+		if dsn, ok := sf.ep.MPTCPDataFin(); ok && dsn == e.rcvNxt.Load() {
+			// The DATA_FIN occupies a data sequence number.
+			e.rcvClosed = true
+			e.rcvNxt.Store(dsn + 1)
+			sf.ep.MPTCPSendDataAck()
+			return
+		}
+	}
+}
+
+// deliverLocked places data read from sf in the data stream.
+//
+// +checklocks:e.mu
+func (e *Endpoint) deliverLocked(sf *subflow, data []byte) {
+	for len(data) > 0 {
+		dsn, n, ok := sf.ep.MPTCPMapping(sf.rcvSSN)
+		if !ok {
+			// Data which can't be placed in the data stream makes
+			// the subflow unusable, see RFC 8684 section 3.7.
+			sf.rcvClosed = true
+			sf.ep.Abort()
+			return
+		}
+		l := min(len(data), int(n))
+		e.insertLocked(dsn, data[:l])
+		sf.rcvSSN = sf.rcvSSN.Add(seqnum.Size(l))
+		data = data[l:]
+	}
+}
+
+// insertLocked inserts data with data sequence number dsn in the data
+// stream.
+//
+// +checklocks:e.mu
+func (e *Endpoint) insertLocked(dsn uint64, data []byte) {
+	next := e.rcvNxt.Load()
+	if end := dsn + uint64(len(data)); end <= next {
+		// Data retransmitted on another subflow.
+		return
+	}
+	if dsn > next {
+		i := sort.Search(len(e.rcvOOO), func(i int) bool {
+			return e.rcvOOO[i].dsn >= dsn
+		})
+		e.rcvOOO = append(e.rcvOOO, rcvChunk{})
+		copy(e.rcvOOO[i+1:], e.rcvOOO[i:])
+		e.rcvOOO[i] = rcvChunk{dsn: dsn, data: bytes.Clone(data)}
+		return
+	}
+	data = data[next-dsn:]
+	for {
+		e.rcvBuf.Append(buffer.NewViewWithData(data))
+		e.bytesReceived += uint64(len(data))
+		next += uint64(len(data))
+
+		// Pull the out of order data which became contiguous.
+		for len(e.rcvOOO) > 0 && e.rcvOOO[0].dsn+uint64(len(e.rcvOOO[0].data)) <= next {
+			e.rcvOOO = e.rcvOOO[1:]
+		}
+		if len(e.rcvOOO) == 0 || e.rcvOOO[0].dsn > next {
+			break
+		}
+		data = e.rcvOOO[0].data[next-e.rcvOOO[0].dsn:]
+		e.rcvOOO = e.rcvOOO[1:]
+	}
+	e.rcvNxt.Store(next)
+}
+
+// DataAck implements tcp.MPTCPConn.DataAck.
+func (e *Endpoint) DataAck() uint64 {
+	return e.rcvNxt.Load()
+}
+
+// HandleDataAck implements tcp.MPTCPConn.HandleDataAck.
+func (e *Endpoint) HandleDataAck(ack uint64) {
+	storeMax(&e.sndUna, ack)
+}
+
+// JoinSubflow implements tcp.MPTCPConn.JoinSubflow.
+func (e *Endpoint) JoinSubflow(ep *tcp.Endpoint, wq *waiter.Queue) bool {
+	e.joinMu.Lock()
+	defer e.joinMu.Unlock()
+
+	if e.closed {
+		return false
+	}
+	sf := &subflow{
+		ep:     ep,
+		rcvSSN: 1,
+		wq:     wq,
+	}
+	sf.entry.Init(e, waiter.ReadableEvents|waiter.WritableEvents|waiter.EventErr|waiter.EventHUp)
+	wq.EventRegister(&sf.entry)
+	e.joined = append(e.joined, sf)
+	return true
+}
+
+// NotifyEvent implements waiter.EventListener.NotifyEvent. It forwards the
+// events of joined subflows to the endpoint's waiter queue.
+func (e *Endpoint) NotifyEvent(mask waiter.EventMask) {
+	e.waiterQueue.Notify(mask)
+}
+
+// shutdown closes all subflows.
+func (e *Endpoint) shutdown(abort bool) {
+	e.joinMu.Lock()
+	e.closed = true
+	joined := e.joined
+	e.joined = nil
+	e.joinMu.Unlock()
+
+	e.mu.Lock()
+	e.syncLocked()
+	if e.mptcp && !e.sndClosed && !abort {
+		if sf := e.activeLocked(); sf != nil {
+			e.flushLocked(sf)
+			sf.ep.MPTCPSetDataFin(e.sndNxt)
+		}
+		e.sndClosed = true
+	}
+	subflows := append(e.subflows, joined...)
+	e.subflows = nil
+	e.rcvBuf.Release()
+	e.sndBuf.Release()
+	e.rcvOOO = nil
+	e.mu.Unlock()
+
+	for _, sf := range subflows {
+		if sf.ep != e.initial {
+			closeSubflow(sf, abort)
+		}
+	}
+	e.initial.ReleaseMPTCPToken()
+}
+
+// Close implements tcpip.Endpoint.Close.
+func (e *Endpoint) Close() {
+	e.shutdown(false /* abort */)
+	e.initial.Close()
+}
+
+// Abort implements tcpip.Endpoint.Abort.
+func (e *Endpoint) Abort() {
+	e.shutdown(true /* abort */)
+	e.initial.Abort()
+}
+
+// Read implements tcpip.Endpoint.Read.
+func (e *Endpoint) Read(dst io.Writer, opts tcpip.ReadOptions) (tcpip.ReadResult, tcpip.Error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.syncLocked()
+	if !e.mptcp {
+		return e.initial.Read(dst, opts)
+	}
+
+	e.pullLocked()
+	size := e.rcvBuf.Size()
+	if size == 0 {
+		if e.rcvClosed {
+			return tcpip.ReadResult{}, &tcpip.ErrClosedForReceive{}
+		}
+		for _, sf := range e.subflows {
+			if !sf.rcvClosed {
+				return tcpip.ReadResult{}, &tcpip.ErrWouldBlock{}
+			}
+		}
+		// All subflows closed without a DATA_FIN; report the error of
+		// the initial subflow.
+		return e.initial.Read(dst, opts)
+	}
+
+	var n int64
+	var err error
+	if opts.Peek {
+		b := e.rcvBuf.Clone()
+		n, err = b.ReadToWriter(dst, size)
+		b.Release()
+	} else {
+		n, err = e.rcvBuf.ReadToWriter(dst, size)
+		e.rcvBuf.TrimFront(n)
+	}
+	if n == 0 && err != nil {
+		return tcpip.ReadResult{}, &tcpip.ErrBadBuffer{}
+	}
+	return tcpip.ReadResult{
+		Count: int(n),
+		Total: int(n),
+	}, nil
+}
+
+// sndRecorder is a tcpip.Payloader which records the data read from it.
+type sndRecorder struct {
+	p   tcpip.Payloader
+	buf buffer.Buffer
+}
+
+// Read implements io.Reader.Read.
+func (r *sndRecorder) Read(b []byte) (int, error) {
+	n, err := r.p.Read(b)
+	if n > 0 {
+		r.buf.Append(buffer.NewViewWithData(b[:n]))
+	}
+	return n, err
+}
+
+// Len implements tcpip.Payloader.Len.
+func (r *sndRecorder) Len() int {
+	return r.p.Len()
+}
+
+// Write implements tcpip.Endpoint.Write.
+func (e *Endpoint) Write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, tcpip.Error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.syncLocked()
+	if !e.mptcp {
+		return e.initial.Write(p, opts)
+	}
+	if e.sndClosed {
+		return 0, &tcpip.ErrClosedForSend{}
+	}
+	sf := e.activeLocked()
+	if sf == nil {
+		// Report the error of the initial subflow.
+		return e.initial.Write(p, opts)
+	}
+	if err := e.flushLocked(sf); err != nil {
+		return 0, err
+	}
+
+	r := sndRecorder{p: p}
+	n, err := sf.ep.Write(&r, opts)
+	e.sndBuf.Merge(&r.buf)
+	e.sndNxt += uint64(n)
+	e.sndQueued = e.sndNxt
+	e.bytesSent += uint64(n)
+	e.trimLocked()
+	return n, err
+}
+
+// Connect implements tcpip.Endpoint.Connect.
+func (e *Endpoint) Connect(addr tcpip.FullAddress) tcpip.Error {
+	// EnableMPTCP fails if a connection attempt is already in progress,
+	// in which case MPTCP is already enabled.
+	_ = e.initial.EnableMPTCP(e)
+	return e.initial.Connect(addr)
+}
+
+// Disconnect implements tcpip.Endpoint.Disconnect.
+func (e *Endpoint) Disconnect() tcpip.Error {
+	return e.initial.Disconnect()
+}
+
+// Shutdown implements tcpip.Endpoint.Shutdown.
+func (e *Endpoint) Shutdown(flags tcpip.ShutdownFlags) tcpip.Error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.syncLocked()
+	if !e.mptcp {
+		return e.initial.Shutdown(flags)
+	}
+	if flags&tcpip.ShutdownWrite != 0 && !e.sndClosed {
+		e.sndClosed = true
+		if sf := e.activeLocked(); sf != nil {
+			e.flushLocked(sf)
+			sf.ep.MPTCPSetDataFin(e.sndNxt)
+			if err := sf.ep.Shutdown(tcpip.ShutdownWrite); err != nil {
+				return err
+			}
+		}
+	}
+	if flags&tcpip.ShutdownRead != 0 {
+		for _, sf := range e.subflows {
+			sf.ep.Shutdown(tcpip.ShutdownRead)
+		}
+		e.rcvClosed = true
+		e.rcvBuf.Release()
+		e.rcvBuf = buffer.Buffer{}
+		e.rcvOOO = nil
+	}
+	return nil
+}
+
+// Listen implements tcpip.Endpoint.Listen.
+func (e *Endpoint) Listen(backlog int) tcpip.Error {
+	// EnableMPTCP fails if e is already listening, in which case MPTCP is
+	// already enabled.
+	_ = e.initial.EnableMPTCP(nil)
+	return e.initial.Listen(backlog)
+}
+
+// Accept implements tcpip.Endpoint.Accept.
+func (e *Endpoint) Accept(peerAddr *tcpip.FullAddress) (tcpip.Endpoint, *waiter.Queue, tcpip.Error) {
+	ep, wq, err := e.initial.Accept(peerAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+	n := newEndpoint(wq, ep.(*tcp.Endpoint))
+	n.initial.SetMPTCPConn(n)
+	return n, wq, nil
+}
+
+// Bind implements tcpip.Endpoint.Bind.
+func (e *Endpoint) Bind(addr tcpip.FullAddress) tcpip.Error {
+	return e.initial.Bind(addr)
+}
+
+// GetLocalAddress implements tcpip.Endpoint.GetLocalAddress.
+func (e *Endpoint) GetLocalAddress() (tcpip.FullAddress, tcpip.Error) {
+	return e.initial.GetLocalAddress()
+}
+
+// GetRemoteAddress implements tcpip.Endpoint.GetRemoteAddress.
+func (e *Endpoint) GetRemoteAddress() (tcpip.FullAddress, tcpip.Error) {
+	return e.initial.GetRemoteAddress()
+}
+
+// Readiness implements tcpip.Endpoint.Readiness.
+func (e *Endpoint) Readiness(mask waiter.EventMask) waiter.EventMask {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.syncLocked()
+	if !e.mptcp {
+		return e.initial.Readiness(mask)
+	}
+
+	var ready waiter.EventMask
+	if mask&waiter.ReadableEvents != 0 {
+		e.pullLocked()
+		if e.rcvBuf.Size() > 0 || e.rcvClosed {
+			ready |= waiter.ReadableEvents
+		}
+	}
+	sf := e.activeLocked()
+	if sf == nil {
+		return ready | e.initial.Readiness(mask)
+	}
+	if mask&waiter.WritableEvents != 0 && !e.sndClosed && e.flushLocked(sf) == nil {
+		ready |= sf.ep.Readiness(waiter.WritableEvents)
+	}
+	return ready & mask
+}
+
+// SetSockOpt implements tcpip.Endpoint.SetSockOpt.
+func (e *Endpoint) SetSockOpt(opt tcpip.SettableSocketOption) tcpip.Error {
+	return e.initial.SetSockOpt(opt)
+}
+
+// SetSockOptInt implements tcpip.Endpoint.SetSockOptInt.
+func (e *Endpoint) SetSockOptInt(opt tcpip.SockOptInt, v int) tcpip.Error {
+	return e.initial.SetSockOptInt(opt, v)
+}
+
+// GetSockOpt implements tcpip.Endpoint.GetSockOpt.
+func (e *Endpoint) GetSockOpt(opt tcpip.GettableSocketOption) tcpip.Error {
+	switch o := opt.(type) {
+	case *tcpip.MPTCPInfoOption:
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		e.syncLocked()
+		e.adoptJoinedLocked()
+		*o = tcpip.MPTCPInfoOption{
+			Fallback:          e.fallback,
+			RemoteKeyReceived: e.mptcp,
+		}
+		if e.mptcp {
+			o.Subflows = uint8(max(len(e.subflows)-1, 0))
+			o.Token = e.initial.MPTCPInfo().Token
+			o.WriteSeq = e.sndNxt
+			o.SndUna = min(e.sndUna.Load(), e.sndNxt)
+			o.RcvNxt = e.rcvNxt.Load()
+			o.BytesSent = e.bytesSent
+			o.BytesReceived = e.bytesReceived
+		}
+		return nil
+	default:
+		return e.initial.GetSockOpt(opt)
+	}
+}
+
+// GetSockOptInt implements tcpip.Endpoint.GetSockOptInt.
+func (e *Endpoint) GetSockOptInt(opt tcpip.SockOptInt) (int, tcpip.Error) {
+	return e.initial.GetSockOptInt(opt)
+}
+
+// State implements tcpip.Endpoint.State.
+func (e *Endpoint) State() uint32 {
+	return e.initial.State()
+}
+
+// ModerateRecvBuf implements tcpip.Endpoint.ModerateRecvBuf.
+func (e *Endpoint) ModerateRecvBuf(copied int) {
+	e.initial.ModerateRecvBuf(copied)
+}
+
+// Info implements tcpip.Endpoint.Info.
+func (e *Endpoint) Info() tcpip.EndpointInfo {
+	return e.initial.Info()
+}
+
+// Stats implements tcpip.Endpoint.Stats.
+func (e *Endpoint) Stats() tcpip.EndpointStats {
+	return e.initial.Stats()
+}
+
+// SetOwner implements tcpip.Endpoint.SetOwner.
+func (e *Endpoint) SetOwner(owner tcpip.PacketOwner) {
+	e.initial.SetOwner(owner)
+}
+
+// LastError implements tcpip.Endpoint.LastError.
+func (e *Endpoint) LastError() tcpip.Error {
+	return e.initial.LastError()
+}
+
+// SocketOptions implements tcpip.Endpoint.SocketOptions.
+func (e *Endpoint) SocketOptions() *tcpip.SocketOptions {
+	return e.initial.SocketOptions()
+}
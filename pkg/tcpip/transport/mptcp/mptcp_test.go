@@ -0,0 +1,233 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mptcp_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/header"
+	"github.com/wilinz/gvisor/pkg/tcpip/link/loopback"
+	"github.com/wilinz/gvisor/pkg/tcpip/network/ipv4"
+	"github.com/wilinz/gvisor/pkg/tcpip/stack"
+	"github.com/wilinz/gvisor/pkg/tcpip/transport/mptcp"
+	"github.com/wilinz/gvisor/pkg/tcpip/transport/tcp"
+	"github.com/wilinz/gvisor/pkg/waiter"
+)
+
+const (
+	nicID   = 1
+	port    = 8080
+	timeout = 5 * time.Second
+)
+
+var addr = tcpip.AddrFrom4([4]byte{127, 0, 0, 1})
+
+func newStack(t *testing.T) *stack.Stack {
+	t.Helper()
+
+	s := stack.New(stack.Options{
+		NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+		TransportProtocols: []stack.TransportProtocolFactory{tcp.NewProtocol, mptcp.NewProtocol},
+	})
+	t.Cleanup(s.Destroy)
+	if err := s.CreateNIC(nicID, loopback.New()); err != nil {
+		t.Fatalf("s.CreateNIC(%d, _): %s", nicID, err)
+	}
+	protoAddr := tcpip.ProtocolAddress{
+		Protocol:          ipv4.ProtocolNumber,
+		AddressWithPrefix: addr.WithPrefix(),
+	}
+	if err := s.AddProtocolAddress(nicID, protoAddr, stack.AddressProperties{}); err != nil {
+		t.Fatalf("s.AddProtocolAddress(%d, %+v, {}): %s", nicID, protoAddr, err)
+	}
+	s.SetRouteTable([]tcpip.Route{
+		{
+			Destination: header.IPv4EmptySubnet,
+			NIC:         nicID,
+		},
+	})
+	return s
+}
+
+func newEndpoint(t *testing.T, s *stack.Stack, proto tcpip.TransportProtocolNumber) (tcpip.Endpoint, *waiter.Queue) {
+	t.Helper()
+
+	var wq waiter.Queue
+	ep, err := s.NewEndpoint(proto, ipv4.ProtocolNumber, &wq)
+	if err != nil {
+		t.Fatalf("s.NewEndpoint(%d, %d, _): %s", proto, ipv4.ProtocolNumber, err)
+	}
+	t.Cleanup(ep.Close)
+	return ep, &wq
+}
+
+// connect connects a new endpoint of protocol proto to an MPTCP listener and
+// returns both ends of the connection.
+func connect(t *testing.T, s *stack.Stack, proto tcpip.TransportProtocolNumber) (client, server tcpip.Endpoint, clientWQ, serverWQ *waiter.Queue) {
+	t.Helper()
+
+	listener, listenerWQ := newEndpoint(t, s, mptcp.ProtocolNumber)
+	fullAddr := tcpip.FullAddress{Addr: addr, Port: port}
+	if err := listener.Bind(fullAddr); err != nil {
+		t.Fatalf("listener.Bind(%#v): %s", fullAddr, err)
+	}
+	if err := listener.Listen(1); err != nil {
+		t.Fatalf("listener.Listen(1): %s", err)
+	}
+
+	client, clientWQ = newEndpoint(t, s, proto)
+	connEntry, connCh := waiter.NewChannelEntry(waiter.WritableEvents)
+	clientWQ.EventRegister(&connEntry)
+	defer clientWQ.EventUnregister(&connEntry)
+	switch err := client.Connect(fullAddr); err.(type) {
+	case nil, *tcpip.ErrConnectStarted:
+	default:
+		t.Fatalf("client.Connect(%#v): %s", fullAddr, err)
+	}
+
+	acceptEntry, acceptCh := waiter.NewChannelEntry(waiter.ReadableEvents)
+	listenerWQ.EventRegister(&acceptEntry)
+	defer listenerWQ.EventUnregister(&acceptEntry)
+	for {
+		var err tcpip.Error
+		server, serverWQ, err = listener.Accept(nil)
+		if err == nil {
+			break
+		}
+		if _, ok := err.(*tcpip.ErrWouldBlock); !ok {
+			t.Fatalf("listener.Accept(nil): %s", err)
+		}
+		select {
+		case <-acceptCh:
+		case <-time.After(timeout):
+			t.Fatalf("timed out waiting for a connection")
+		}
+	}
+	t.Cleanup(server.Close)
+
+	for client.Readiness(waiter.WritableEvents) == 0 {
+		select {
+		case <-connCh:
+		case <-time.After(timeout):
+			t.Fatalf("timed out waiting for the client to connect")
+		}
+	}
+	if err := client.LastError(); err != nil {
+		t.Fatalf("client.LastError(): %s", err)
+	}
+	return client, server, clientWQ, serverWQ
+}
+
+func write(t *testing.T, ep tcpip.Endpoint, data []byte) {
+	t.Helper()
+
+	var r bytes.Reader
+	r.Reset(data)
+	if n, err := ep.Write(&r, tcpip.WriteOptions{}); err != nil || n != int64(len(data)) {
+		t.Fatalf("ep.Write(_, {}) = (%d, %v), want (%d, nil)", n, err, len(data))
+	}
+}
+
+func read(t *testing.T, ep tcpip.Endpoint, wq *waiter.Queue, n int) []byte {
+	t.Helper()
+
+	entry, ch := waiter.NewChannelEntry(waiter.ReadableEvents)
+	wq.EventRegister(&entry)
+	defer wq.EventUnregister(&entry)
+
+	var buf bytes.Buffer
+	for buf.Len() < n {
+		_, err := ep.Read(&buf, tcpip.ReadOptions{})
+		if err == nil {
+			continue
+		}
+		if _, ok := err.(*tcpip.ErrWouldBlock); !ok {
+			t.Fatalf("ep.Read(_, {}): %s", err)
+		}
+		select {
+		case <-ch:
+		case <-time.After(timeout):
+			t.Fatalf("timed out reading: got %d bytes, want %d", buf.Len(), n)
+		}
+	}
+	return buf.Bytes()
+}
+
+func mptcpInfo(t *testing.T, ep tcpip.Endpoint) tcpip.MPTCPInfoOption {
+	t.Helper()
+
+	var info tcpip.MPTCPInfoOption
+	if err := ep.GetSockOpt(&info); err != nil {
+		t.Fatalf("ep.GetSockOpt(%T): %s", &info, err)
+	}
+	return info
+}
+
+func TestDataTransfer(t *testing.T) {
+	s := newStack(t)
+	client, server, clientWQ, serverWQ := connect(t, s, mptcp.ProtocolNumber)
+
+	clientData := bytes.Repeat([]byte("client"), 10000)
+	serverData := bytes.Repeat([]byte("server"), 10000)
+	write(t, client, clientData)
+	if got := read(t, server, serverWQ, len(clientData)); !bytes.Equal(got, clientData) {
+		t.Errorf("server read %d bytes which don't match the %d bytes written by the client", len(got), len(clientData))
+	}
+	write(t, server, serverData)
+	if got := read(t, client, clientWQ, len(serverData)); !bytes.Equal(got, serverData) {
+		t.Errorf("client read %d bytes which don't match the %d bytes written by the server", len(got), len(serverData))
+	}
+
+	for _, ep := range []struct {
+		name string
+		ep   tcpip.Endpoint
+	}{
+		{name: "client", ep: client},
+		{name: "server", ep: server},
+	} {
+		info := mptcpInfo(t, ep.ep)
+		if info.Fallback || !info.RemoteKeyReceived {
+			t.Errorf("%s: got MPTCP info %+v, want MPTCP without fallback", ep.name, info)
+		}
+	}
+	if got, want := mptcpInfo(t, client).BytesSent, uint64(len(clientData)); got != want {
+		t.Errorf("got client BytesSent = %d, want %d", got, want)
+	}
+	if got, want := mptcpInfo(t, server).BytesReceived, uint64(len(clientData)); got != want {
+		t.Errorf("got server BytesReceived = %d, want %d", got, want)
+	}
+}
+
+func TestFallback(t *testing.T) {
+	s := newStack(t)
+	client, server, clientWQ, serverWQ := connect(t, s, tcp.ProtocolNumber)
+
+	data := []byte("hello")
+	write(t, client, data)
+	if got := read(t, server, serverWQ, len(data)); !bytes.Equal(got, data) {
+		t.Errorf("server read %q, want %q", got, data)
+	}
+	write(t, server, data)
+	if got := read(t, client, clientWQ, len(data)); !bytes.Equal(got, data) {
+		t.Errorf("client read %q, want %q", got, data)
+	}
+
+	if info := mptcpInfo(t, server); !info.Fallback {
+		t.Errorf("got server MPTCP info %+v, want fallback", info)
+	}
+}
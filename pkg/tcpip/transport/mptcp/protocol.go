@@ -0,0 +1,118 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mptcp contains the implementation of Multipath TCP (RFC 8684).
+//
+// An MPTCP connection is made of TCP subflows, implemented by the tcp
+// package, which carry MPTCP options. Connections start with a single
+// subflow negotiating MPTCP with the MP_CAPABLE option; peers may then open
+// additional subflows to a listening endpoint with the MP_JOIN option. Data
+// is sent on one subflow at a time and retransmitted on another one if that
+// subflow fails. If the peer doesn't support MPTCP, connections fall back to
+// regular TCP.
+//
+// The tcp protocol must be registered with the stack as well.
+package mptcp
+
+import (
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/header"
+	"github.com/wilinz/gvisor/pkg/tcpip/stack"
+	"github.com/wilinz/gvisor/pkg/tcpip/transport/tcp"
+	"github.com/wilinz/gvisor/pkg/waiter"
+)
+
+// ProtocolNumber is the mptcp protocol number. MPTCP segments are TCP
+// segments on the wire; the number only identifies the protocol when
+// creating endpoints, and matches Linux's IPPROTO_MPTCP.
+const ProtocolNumber tcpip.TransportProtocolNumber = 262
+
+// +stateify savable
+type protocol struct {
+	stack *stack.Stack
+}
+
+// Number returns the mptcp protocol number.
+func (*protocol) Number() tcpip.TransportProtocolNumber {
+	return ProtocolNumber
+}
+
+// NewEndpoint creates a new mptcp endpoint.
+func (p *protocol) NewEndpoint(netProto tcpip.NetworkProtocolNumber, waiterQueue *waiter.Queue) (tcpip.Endpoint, tcpip.Error) {
+	ep, err := p.stack.NewEndpoint(tcp.ProtocolNumber, netProto, waiterQueue)
+	if err != nil {
+		return nil, err
+	}
+	return newEndpoint(waiterQueue, ep.(*tcp.Endpoint)), nil
+}
+
+// NewRawEndpoint implements stack.TransportProtocol.NewRawEndpoint. Raw MPTCP
+// endpoints are not supported.
+func (*protocol) NewRawEndpoint(tcpip.NetworkProtocolNumber, *waiter.Queue) (tcpip.Endpoint, tcpip.Error) {
+	return nil, &tcpip.ErrUnknownProtocol{}
+}
+
+// MinimumPacketSize returns the minimum valid mptcp packet size.
+func (*protocol) MinimumPacketSize() int {
+	return header.TCPMinimumSize
+}
+
+// ParsePorts returns the source and destination ports stored in the given
+// packet.
+func (*protocol) ParsePorts(v []byte) (src, dst uint16, err tcpip.Error) {
+	h := header.TCP(v)
+	return h.SourcePort(), h.DestinationPort(), nil
+}
+
+// HandleUnknownDestinationPacket implements
+// stack.TransportProtocol.HandleUnknownDestinationPacket. MPTCP segments are
+// delivered to the tcp protocol, so this is never called.
+func (*protocol) HandleUnknownDestinationPacket(stack.TransportEndpointID, *stack.PacketBuffer) stack.UnknownDestinationPacketDisposition {
+	return stack.UnknownDestinationPacketUnhandled
+}
+
+// SetOption implements stack.TransportProtocol.SetOption.
+func (*protocol) SetOption(tcpip.SettableTransportProtocolOption) tcpip.Error {
+	return &tcpip.ErrUnknownProtocolOption{}
+}
+
+// Option implements stack.TransportProtocol.Option.
+func (*protocol) Option(tcpip.GettableTransportProtocolOption) tcpip.Error {
+	return &tcpip.ErrUnknownProtocolOption{}
+}
+
+// Close implements stack.TransportProtocol.Close.
+func (*protocol) Close() {}
+
+// Wait implements stack.TransportProtocol.Wait.
+func (*protocol) Wait() {}
+
+// Pause implements stack.TransportProtocol.Pause.
+func (*protocol) Pause() {}
+
+// Resume implements stack.TransportProtocol.Resume.
+func (*protocol) Resume() {}
+
+// Restore implements stack.TransportProtocol.Restore.
+func (*protocol) Restore() {}
+
+// Parse implements stack.TransportProtocol.Parse.
+func (*protocol) Parse(*stack.PacketBuffer) bool {
+	return false
+}
+
+// NewProtocol returns an MPTCP transport protocol.
+func NewProtocol(s *stack.Stack) stack.TransportProtocol {
+	return &protocol{stack: s}
+}
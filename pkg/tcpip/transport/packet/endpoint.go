@@ -41,6 +41,7 @@ type tpacketVersion int
 const (
 	tpacketVersion1 tpacketVersion = iota
 	tpacketVersion2
+	tpacketVersion3
 )
 
 var _ stack.MappablePacketEndpoint = (*endpoint)(nil)
@@ -232,6 +233,7 @@ func (ep *endpoint) Write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, tc
 	closed := ep.closed
 	nicID := ep.boundNIC
 	proto := ep.boundNetProto
+	packetMMapEp := ep.packetMMapEp
 	ep.mu.Unlock()
 	if closed {
 		return 0, &tcpip.ErrClosedForSend{}
@@ -254,6 +256,19 @@ func (ep *endpoint) Write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, tc
 		return 0, &tcpip.ErrInvalidOptionValue{}
 	}
 
+	write := func(payload buffer.Buffer) tcpip.Error {
+		if ep.cooked {
+			return ep.stack.WritePacketToRemote(nicID, remote, proto, payload)
+		}
+		return ep.stack.WriteRawPacket(nicID, proto, payload)
+	}
+
+	// If the endpoint has a TX ring, the frames queued in the ring are sent
+	// and p is ignored, as in Linux.
+	if packetMMapEp != nil && packetMMapEp.HasTxRing() {
+		return packetMMapEp.Transmit(write)
+	}
+
 	// Prevents giant buffer allocations.
 	if p.Len() > header.DatagramMaximumSize {
 		return 0, &tcpip.ErrMessageTooLong{}
@@ -265,12 +280,7 @@ func (ep *endpoint) Write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, tc
 	}
 	payloadSz := payload.Size()
 
-	if err := func() tcpip.Error {
-		if ep.cooked {
-			return ep.stack.WritePacketToRemote(nicID, remote, proto, payload)
-		}
-		return ep.stack.WriteRawPacket(nicID, proto, payload)
-	}(); err != nil {
+	if err := write(payload); err != nil {
 		return 0, err
 	}
 	return payloadSz, nil
@@ -408,10 +418,9 @@ func (ep *endpoint) SetSockOptInt(opt tcpip.SockOptInt, v int) tcpip.Error {
 	defer ep.mu.Unlock()
 	switch opt {
 	case tcpip.PacketMMapVersionOption:
-		// We support up to TPACKET_V2.
 		version := tpacketVersion(v)
 		switch version {
-		case tpacketVersion1, tpacketVersion2:
+		case tpacketVersion1, tpacketVersion2, tpacketVersion3:
 			if ep.packetMMapEp != nil {
 				return &tcpip.ErrEndpointBusy{}
 			}
@@ -476,6 +485,11 @@ func (ep *endpoint) GetSockOptInt(opt tcpip.SockOptInt) (int, tcpip.Error) {
 		ep.rcvMu.Unlock()
 		return v, nil
 
+	case tcpip.PacketMMapVersionOption:
+		ep.mu.RLock()
+		defer ep.mu.RUnlock()
+		return int(ep.packetMMapVersion), nil
+
 	default:
 		return -1, &tcpip.ErrUnknownProtocolOption{}
 	}
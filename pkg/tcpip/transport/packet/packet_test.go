@@ -25,6 +25,7 @@ import (
 	"github.com/wilinz/gvisor/pkg/tcpip/link/channel"
 	"github.com/wilinz/gvisor/pkg/tcpip/link/ethernet"
 	"github.com/wilinz/gvisor/pkg/tcpip/stack"
+	"github.com/wilinz/gvisor/pkg/tcpip/testutil"
 	"github.com/wilinz/gvisor/pkg/tcpip/transport/raw"
 	"github.com/wilinz/gvisor/pkg/waiter"
 )
@@ -112,3 +113,150 @@ func TestWriteRaw(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteNetworkPolicy(t *testing.T) {
+	const nicID = 1
+
+	var (
+		srcAddr = testutil.MustParse4("10.0.0.1")
+		dstAddr = testutil.MustParse4("10.0.0.2")
+	)
+
+	// udpPacket returns an IPv4 packet carrying an empty UDP datagram to
+	// dstAddr:dstPort.
+	udpPacket := func(dstPort uint16) []byte {
+		b := make([]byte, header.IPv4MinimumSize+header.UDPMinimumSize)
+		header.IPv4(b).Encode(&header.IPv4Fields{
+			TotalLength: uint16(len(b)),
+			TTL:         64,
+			Protocol:    uint8(header.UDPProtocolNumber),
+			SrcAddr:     srcAddr,
+			DstAddr:     dstAddr,
+		})
+		header.UDP(b[header.IPv4MinimumSize:]).Encode(&header.UDPFields{
+			SrcPort: 1234,
+			DstPort: dstPort,
+			Length:  header.UDPMinimumSize,
+		})
+		return b
+	}
+	// frame returns an Ethernet frame of the given type carrying payload.
+	frame := func(ethType tcpip.NetworkProtocolNumber, payload []byte) []byte {
+		b := make([]byte, header.EthernetMinimumSize+len(payload))
+		header.Ethernet(b).Encode(&header.EthernetFields{
+			SrcAddr: "\x02\x00\x00\x00\x00\x01",
+			DstAddr: "\x02\x00\x00\x00\x00\x02",
+			Type:    ethType,
+		})
+		copy(b[header.EthernetMinimumSize:], payload)
+		return b
+	}
+
+	// The policy only allows DNS to dstAddr.
+	policy := &stack.NetworkPolicy{
+		Egress: []stack.NetworkPolicyRule{
+			{
+				Action: stack.NetworkPolicyAllow,
+				Destination: tcpip.AddressWithPrefix{
+					Address:   dstAddr,
+					PrefixLen: 32,
+				}.Subnet(),
+				Protocol:  header.UDPProtocolNumber,
+				StartPort: 53,
+				EndPort:   53,
+			},
+		},
+		DefaultEgress: stack.NetworkPolicyDeny,
+	}
+
+	tests := []struct {
+		name     string
+		cooked   bool
+		netProto tcpip.NetworkProtocolNumber
+		data     []byte
+		sent     bool
+	}{
+		{
+			name: "raw allowed",
+			data: frame(header.IPv4ProtocolNumber, udpPacket(53)),
+			sent: true,
+		},
+		{
+			name: "raw denied",
+			data: frame(header.IPv4ProtocolNumber, udpPacket(80)),
+		},
+		{
+			name:     "raw denied with mismatched protocol",
+			netProto: header.ARPProtocolNumber,
+			data:     frame(header.IPv4ProtocolNumber, udpPacket(80)),
+		},
+		{
+			name: "raw ARP",
+			data: frame(header.ARPProtocolNumber, make([]byte, header.ARPSize)),
+		},
+		{
+			name: "raw VLAN",
+			data: frame(0x8100, udpPacket(80)),
+		},
+		{
+			name:     "cooked allowed",
+			cooked:   true,
+			netProto: header.IPv4ProtocolNumber,
+			data:     udpPacket(53),
+			sent:     true,
+		},
+		{
+			name:     "cooked denied",
+			cooked:   true,
+			netProto: header.IPv4ProtocolNumber,
+			data:     udpPacket(80),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := stack.New(stack.Options{
+				RawFactory:               &raw.EndpointFactory{},
+				AllowPacketEndpointWrite: true,
+				Clock:                    &faketime.NullClock{},
+			})
+			defer s.Destroy()
+
+			chEP := channel.New(1, header.IPv6MinimumMTU, "")
+			if err := s.CreateNIC(nicID, ethernet.New(chEP)); err != nil {
+				t.Fatalf("CreateNIC(%d, _) failed: %s", nicID, err)
+			}
+			if err := s.SetNetworkPolicy(policy); err != nil {
+				t.Fatalf("SetNetworkPolicy(%+v): %s", policy, err)
+			}
+
+			var wq waiter.Queue
+			ep, err := s.NewPacketEndpoint(test.cooked, test.netProto, &wq)
+			if err != nil {
+				t.Fatalf("s.NewPacketEndpoint(%t, %d, _): %s", test.cooked, test.netProto, err)
+			}
+			defer ep.Close()
+			to := tcpip.FullAddress{NIC: nicID, LinkAddr: "\x02\x00\x00\x00\x00\x02", Port: uint16(test.netProto)}
+
+			var r bytes.Reader
+			r.Reset(test.data)
+			if _, err := ep.Write(&r, tcpip.WriteOptions{To: &to}); err != nil {
+				t.Fatalf("ep.Write(..): %s", err)
+			}
+			pkt := chEP.Read()
+			if sent := pkt != nil; sent != test.sent {
+				t.Errorf("got sent = %t, want = %t", sent, test.sent)
+			}
+			if pkt != nil {
+				pkt.DecRef()
+			}
+			wantDropped := uint64(1)
+			if test.sent {
+				wantDropped = 0
+			}
+			if got := s.Stats().IP.NetworkPolicyDropped.Value(); got != wantDropped {
+				t.Errorf("got s.Stats().IP.NetworkPolicyDropped.Value() = %d, want = %d", got, wantDropped)
+			}
+		})
+	}
+}
@@ -190,7 +190,13 @@ func (l *listenContext) createConnectingEndpoint(s *segment, rcvdSynOpts header.
 		netProto = s.pkt.NetworkProtocolNumber
 	}
 
-	route, err := l.stack.FindRoute(s.pkt.NICID, s.pkt.Network().DestinationAddress(), s.pkt.Network().SourceAddress(), s.pkt.NetworkProtocolNumber, false /* multicastLoop */)
+	findRoute := l.stack.FindRoute
+	if l.listenEP != nil && l.listenEP.ops.GetTransparent() {
+		// The packet may have been redirected by a TPROXY target, in which
+		// case its destination isn't a local address.
+		findRoute = l.stack.FindTransparentRoute
+	}
+	route, err := findRoute(s.pkt.NICID, s.pkt.Network().DestinationAddress(), s.pkt.Network().SourceAddress(), s.pkt.NetworkProtocolNumber, false /* multicastLoop */)
 	if err != nil {
 		return nil, err // +checklocksignore
 	}
@@ -203,7 +209,7 @@ func (l *listenContext) createConnectingEndpoint(s *segment, rcvdSynOpts header.
 	n.route = route
 	n.effectiveNetProtos = []tcpip.NetworkProtocolNumber{s.pkt.NetworkProtocolNumber}
 	n.ops.SetReceiveBufferSize(int64(l.rcvWnd), false /* notify */)
-	n.amss = calculateAdvertisedMSS(n.userMSS, n.route)
+	n.amss = calculateAdvertisedMSS(n.userMSS, n.protocol.routeMTU(n.route))
 	n.setEndpointState(StateConnecting)
 
 	n.maybeEnableTimestamp(rcvdSynOpts)
@@ -227,13 +233,15 @@ func (l *listenContext) createConnectingEndpoint(s *segment, rcvdSynOpts header.
 // handshake in progress, which includes the new endpoint in the SYN-RCVD
 // state.
 //
+// fo describes how the TCP Fast Open option of the SYN is handled.
+//
 // On success, a handshake h is returned.
 //
 // NOTE: h.ep.mu is not held and must be acquired if any state needs to be
 // modified.
 //
 // Precondition: if l.listenEP != nil, l.listenEP.mu must be locked.
-func (l *listenContext) startHandshake(s *segment, opts header.TCPSynOptions, queue *waiter.Queue, owner tcpip.PacketOwner) (h *handshake, _ tcpip.Error) {
+func (l *listenContext) startHandshake(s *segment, opts header.TCPSynOptions, queue *waiter.Queue, owner tcpip.PacketOwner, fo fastOpenResult) (h *handshake, _ tcpip.Error) {
 	// Create new endpoint.
 	irs := s.sequenceNumber
 	isn := generateSecureISN(s.id, l.stack.Clock(), l.protocol.seqnumSecret)
@@ -269,6 +277,10 @@ func (l *listenContext) startHandshake(s *segment, opts header.TCPSynOptions, qu
 		}
 
 		deferAccept = l.listenEP.deferAccept
+
+		if l.listenEP.mp != nil {
+			ep.mptcpInitPassive(s)
+		}
 	}
 
 	// Register new endpoint so that packets are routed to it.
@@ -293,6 +305,10 @@ func (l *listenContext) startHandshake(s *segment, opts header.TCPSynOptions, qu
 	// Initialize and start the handshake.
 	h = ep.newPassiveHandshake(isn, irs, opts, deferAccept)
 	h.listenEP = l.listenEP
+	if fo.acceptData {
+		h.acceptFastOpenDataLocked(s)
+	}
+	h.fastOpenCookie = fo.cookie
 	h.start()
 	h.ep.mu.Unlock()
 	return h, nil
@@ -307,7 +323,7 @@ func (l *listenContext) performHandshake(s *segment, opts header.TCPSynOptions,
 	queue.EventRegister(&waitEntry)
 	defer queue.EventUnregister(&waitEntry)
 
-	h, err := l.startHandshake(s, opts, queue, owner)
+	h, err := l.startHandshake(s, opts, queue, owner, fastOpenResult{})
 	if err != nil {
 		return nil, err
 	}
@@ -363,6 +379,7 @@ func (e *Endpoint) propagateInheritableOptionsLocked(n *Endpoint) {
 	n.boundBindToDevice = e.boundBindToDevice
 	n.boundPortFlags = e.boundPortFlags
 	n.userMSS = e.userMSS
+	n.ops.SetTransparent(e.ops.GetTransparent())
 }
 
 // reserveTupleLocked reserves an accepted endpoint's tuple.
@@ -462,12 +479,25 @@ func (e *Endpoint) handleListenSegment(ctx *listenContext, s *segment) tcpip.Err
 
 		opts := parseSynSegmentOptions(s)
 
+		// An MP_JOIN SYN asks to add a subflow to an existing MPTCP
+		// connection. Reset it if the connection is unknown, as per
+		// RFC 8684 section 3.2.
+		isJoin := false
+		if e.mp != nil {
+			if mpOpts := header.ParseMPTCPOptions(s.options); mpOpts.HasJoin {
+				if _, ok := e.protocol.lookupMPTCPToken(mpOpts.Join.Token); !ok {
+					return replyWithReset(e.stack, s, e.sendTOS, e.ipv4TTL, e.ipv6HopLimit)
+				}
+				isJoin = true
+			}
+		}
+
 		useSynCookies, err := func() (bool, tcpip.Error) {
-			var alwaysUseSynCookies tcpip.TCPAlwaysUseSynCookies
-			if err := e.stack.TransportProtocolOption(header.TCPProtocolNumber, &alwaysUseSynCookies); err != nil {
-				panic(fmt.Sprintf("TransportProtocolOption(%d, %T) = %s", header.TCPProtocolNumber, alwaysUseSynCookies, err))
+			var synCookies tcpip.TCPSynCookiesOption
+			if err := e.stack.TransportProtocolOption(header.TCPProtocolNumber, &synCookies); err != nil {
+				panic(fmt.Sprintf("TransportProtocolOption(%d, %T) = %s", header.TCPProtocolNumber, synCookies, err))
 			}
-			if alwaysUseSynCookies {
+			if synCookies == tcpip.TCPSynCookiesAlways {
 				return true, nil
 			}
 			e.acceptMu.Lock()
@@ -477,11 +507,19 @@ func (e *Endpoint) handleListenSegment(ctx *listenContext, s *segment) tcpip.Err
 			// listen backlog. But, the SYNRCVD connections count is always checked
 			// against the listen backlog value for Linux parity reason.
 			// https://github.com/torvalds/linux/blob/7acac4b3196/include/net/inet_connection_sock.h#L280
-			if len(e.acceptQueue.pendingEndpoints) == e.acceptQueue.capacity-1 {
+			if len(e.acceptQueue.pendingEndpoints) >= e.acceptQueue.capacity-1 {
+				if synCookies == tcpip.TCPSynCookiesNever {
+					// Like Linux's TCPReqQFullDrop, drop the
+					// SYN and let the peer retransmit it.
+					e.stack.Stats().TCP.ListenSynBacklogDrop.Increment()
+					e.stats.ReceiveErrors.ListenSynBacklogDrop.Increment()
+					e.stack.Stats().DroppedPackets.Increment()
+					return false, nil
+				}
 				return true, nil
 			}
 
-			h, err := ctx.startHandshake(s, opts, &waiter.Queue{}, e.owner)
+			h, err := ctx.startHandshake(s, opts, &waiter.Queue{}, e.owner, e.fastOpenSynLocked(s, opts))
 			if err != nil {
 				e.stack.Stats().TCP.FailedConnectionAttempts.Increment()
 				e.stats.FailedConnectionAttempts.Increment()
@@ -497,9 +535,15 @@ func (e *Endpoint) handleListenSegment(ctx *listenContext, s *segment) tcpip.Err
 		if !useSynCookies {
 			return nil
 		}
+		if isJoin {
+			// The MP_JOIN handshake state can't be encoded in a
+			// cookie; let the peer retry.
+			e.stack.Stats().DroppedPackets.Increment()
+			return nil
+		}
 
 		net := s.pkt.Network()
-		route, err := e.stack.FindRoute(s.pkt.NICID, net.DestinationAddress(), net.SourceAddress(), s.pkt.NetworkProtocolNumber, false /* multicastLoop */)
+		route, err := e.findRoute(s.pkt.NICID, net.DestinationAddress(), net.SourceAddress(), s.pkt.NetworkProtocolNumber)
 		if err != nil {
 			return err
 		}
@@ -517,7 +561,7 @@ func (e *Endpoint) handleListenSegment(ctx *listenContext, s *segment) tcpip.Err
 			WS:    -1,
 			TS:    opts.TS,
 			TSEcr: opts.TSVal,
-			MSS:   calculateAdvertisedMSS(e.userMSS, route),
+			MSS:   calculateAdvertisedMSS(e.userMSS, e.protocol.routeMTU(route)),
 		}
 		if opts.TS {
 			offset := e.protocol.tsOffset(net.DestinationAddress(), net.SourceAddress())
@@ -539,6 +583,7 @@ func (e *Endpoint) handleListenSegment(ctx *listenContext, s *segment) tcpip.Err
 			return err
 		}
 		e.stack.Stats().TCP.ListenOverflowSynCookieSent.Increment()
+		e.stats.SynCookiesSent.Increment()
 		return nil
 
 	case s.flags.Contains(header.TCPFlagAck):
@@ -591,6 +636,7 @@ func (e *Endpoint) handleListenSegment(ctx *listenContext, s *segment) tcpip.Err
 		data, ok := ctx.isCookieValid(s.id, iss, irs)
 		if !ok || int(data) >= len(mssTable) {
 			e.stack.Stats().TCP.ListenOverflowInvalidSynCookieRcvd.Increment()
+			e.stats.InvalidSynCookiesRcvd.Increment()
 			e.stack.Stats().DroppedPackets.Increment()
 
 			// When not using SYN cookies, as per RFC 793, section 3.9, page 64:
@@ -629,6 +675,7 @@ func (e *Endpoint) handleListenSegment(ctx *listenContext, s *segment) tcpip.Err
 		}
 
 		e.stack.Stats().TCP.ListenOverflowSynCookieRcvd.Increment()
+		e.stats.SynCookiesRcvd.Increment()
 		// Create newly accepted endpoint and deliver it.
 		rcvdSynOptions := header.TCPSynOptions{
 			MSS: mssTable[data],
@@ -0,0 +1,902 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp
+
+import (
+	"math"
+	"time"
+
+	"github.com/wilinz/gvisor/pkg/tcpip"
+)
+
+// bbrMode is a state of the BBR state machine.
+type bbrMode uint8
+
+const (
+	bbrStartup bbrMode = iota
+	bbrDrain
+	bbrProbeBWDown
+	bbrProbeBWCruise
+	bbrProbeBWRefill
+	bbrProbeBWUp
+	bbrProbeRTT
+)
+
+// bbrAckPhase tracks which part of the bandwidth probing cycle the ACKs
+// currently being received correspond to.
+type bbrAckPhase uint8
+
+const (
+	bbrAcksInit bbrAckPhase = iota
+	bbrAcksRefilling
+	bbrAcksProbeStarting
+	bbrAcksProbeFeedback
+	bbrAcksProbeStopping
+)
+
+const (
+	// bbrStartupPacingGain is 4*ln(2), the smallest gain that allows the
+	// sending rate to double each round during Startup.
+	bbrStartupPacingGain = 2.77
+
+	// bbrStartupCwndGain is the cwnd gain used during Startup and Drain.
+	bbrStartupCwndGain = 2.0
+
+	// bbrDrainPacingGain is the pacing gain used to drain the queue built
+	// during Startup.
+	bbrDrainPacingGain = 1 / 2.885
+
+	// bbrDefaultCwndGain is the cwnd gain used in ProbeBW.
+	bbrDefaultCwndGain = 2.0
+
+	// bbrProbeBWDownPacingGain and bbrProbeBWUpPacingGain are the pacing
+	// gains used in the ProbeBW DOWN and UP phases.
+	bbrProbeBWDownPacingGain = 0.9
+	bbrProbeBWUpPacingGain   = 1.25
+
+	// bbrProbeRTTCwndGain is the fraction of the estimated BDP that the
+	// inflight is reduced to in ProbeRTT.
+	bbrProbeRTTCwndGain = 0.5
+
+	// bbrPacingMarginPercent is how far below the estimated bandwidth the
+	// connection is paced, to reduce queueing at the bottleneck.
+	bbrPacingMarginPercent = 1
+
+	// bbrStartupFullBWThresh and bbrStartupFullBWCount define when Startup
+	// considers the pipe full: the bandwidth estimate didn't grow by at least
+	// 25% for 3 non-application-limited rounds.
+	bbrStartupFullBWThresh = 1.25
+	bbrStartupFullBWCount  = 3
+
+	// bbrStartupFullLossCount is the number of discontiguous loss events
+	// in a round that, together with a high loss rate, ends Startup.
+	bbrStartupFullLossCount = 6
+
+	// bbrLossThresh is the maximum tolerated loss rate per round.
+	bbrLossThresh = 0.02
+
+	// bbrBeta is the multiplicative decrease applied to the lower bounds
+	// upon loss.
+	bbrBeta = 0.7
+
+	// bbrHeadroom is the fraction of inflightHi left unused while cruising
+	// so that other flows can grab bandwidth.
+	bbrHeadroom = 0.15
+
+	// bbrMinPipeCwnd is the minimum congestion window, in packets.
+	bbrMinPipeCwnd = 4
+
+	// bbrProbeRTTDuration is the minimum time spent at the reduced inflight
+	// in ProbeRTT.
+	bbrProbeRTTDuration = 200 * time.Millisecond
+
+	// bbrProbeRTTInterval is how often ProbeRTT is entered if the minimum
+	// RTT has not been refreshed.
+	bbrProbeRTTInterval = 5 * time.Second
+
+	// bbrMinRTTFilterLen is the length of the min RTT filter window.
+	bbrMinRTTFilterLen = 10 * time.Second
+
+	// bbrProbeWaitBase and bbrProbeWaitRand bound the randomized wall clock
+	// time between bandwidth probes.
+	bbrProbeWaitBase = 2 * time.Second
+	bbrProbeWaitRand = time.Second
+
+	// bbrMaxRenoRounds caps the number of rounds between bandwidth probes
+	// used for coexistence with Reno and CUBIC flows.
+	bbrMaxRenoRounds = 63
+
+	// bbrMaxProbeUpRounds caps the exponential growth of inflightHi in the
+	// ProbeBW UP phase.
+	bbrMaxProbeUpRounds = 30
+
+	// bbrInfinite is used for unset bounds.
+	bbrInfinite = math.MaxUint64
+)
+
+// bbrState stores the variables related to the TCP BBRv2 congestion control
+// algorithm. Bandwidths are in bytes per second and volumes of data are in
+// bytes.
+//
+// See: https://datatracker.ietf.org/doc/html/draft-cardwell-iccrg-bbr-congestion-control-02
+//
+// +stateify savable
+type bbrState struct {
+	s *sender
+
+	mode       bbrMode
+	pacingGain float64
+	cwndGain   float64
+
+	// Round counting.
+	nextRoundDelivered uint64
+	roundCount         uint64
+	roundStart         bool
+
+	// bwHi is the windowed max filter for maxBW, spanning the current and
+	// previous bandwidth probing cycles.
+	bwHi       [2]uint64
+	cycleCount uint64
+	maxBW      uint64
+	bwLo       uint64
+	bw         uint64
+
+	minRTT           time.Duration
+	minRTTStamp      tcpip.MonotonicTime
+	probeRTTMinDelay time.Duration
+	probeRTTMinStamp tcpip.MonotonicTime
+	probeRTTExpired  bool
+
+	probeRTTDoneStamp tcpip.MonotonicTime
+	probeRTTRoundDone bool
+	priorCwnd         int
+
+	// Startup.
+	filledPipe  bool
+	fullBW      uint64
+	fullBWCount int
+
+	// Lower and upper bounds on the volume of data in flight.
+	inflightHi  uint64
+	inflightLo  uint64
+	maxInflight uint64
+
+	// Latest delivery signals, and per round loss signals.
+	bwLatest           uint64
+	inflightLatest     uint64
+	lossRoundDelivered uint64
+	lossRoundStart     bool
+	lossInRound        bool
+	lossEventsInRound  int
+
+	// ProbeBW cycle.
+	cycleStamp         tcpip.MonotonicTime
+	ackPhase           bbrAckPhase
+	roundsSinceBWProbe uint64
+	bwProbeWait        time.Duration
+	bwProbeSamples     bool
+	bwProbeUpRounds    uint
+	bwProbeUpAcks      uint64
+	probeUpCnt         uint64
+
+	// packetConservation is set in the first round of fast recovery.
+	packetConservation bool
+}
+
+// newBBRCC initializes the state for the BBR congestion control algorithm.
+//
+// +checklocks:s.ep.mu
+func newBBRCC(s *sender) *bbrState {
+	now := s.ep.stack.Clock().NowMonotonic()
+	c := &bbrState{
+		s:                s,
+		minRTT:           effectivelyInfinity,
+		minRTTStamp:      now,
+		probeRTTMinDelay: effectivelyInfinity,
+		probeRTTMinStamp: now,
+		inflightHi:       bbrInfinite,
+		inflightLo:       bbrInfinite,
+		bwLo:             bbrInfinite,
+		probeUpCnt:       bbrInfinite,
+	}
+	c.initPacingRate()
+	c.enterStartup()
+	return c
+}
+
+// mss returns the sender maximum segment size in bytes.
+func (c *bbrState) mss() uint64 {
+	return uint64(c.s.MaxPayloadSize)
+}
+
+// inflight returns the estimated number of bytes in flight.
+func (c *bbrState) inflight() uint64 {
+	return c.s.inFlightBytes()
+}
+
+// cwnd returns the congestion window in bytes.
+func (c *bbrState) cwnd() uint64 {
+	return uint64(c.s.SndCwnd) * c.mss()
+}
+
+// setCwndBytes sets the sender congestion window to cwnd bytes.
+func (c *bbrState) setCwndBytes(cwnd uint64) {
+	pkts := (cwnd + c.mss() - 1) / c.mss()
+	c.s.SndCwnd = int(min(max(pkts, 1), math.MaxInt32))
+}
+
+// now returns the current monotonic time.
+func (c *bbrState) now() tcpip.MonotonicTime {
+	return c.s.ep.stack.Clock().NowMonotonic()
+}
+
+// inRecovery returns true if the sender is in fast or RTO recovery.
+func (c *bbrState) inRecovery() bool {
+	return c.s.FastRecovery.Active || c.s.state == tcpip.RTORecovery
+}
+
+// MinRTT implements rateSampleConsumer.MinRTT.
+func (c *bbrState) MinRTT() time.Duration {
+	if c.minRTT == effectivelyInfinity {
+		return 0
+	}
+	return c.minRTT
+}
+
+// OnRateSample implements rateSampleConsumer.OnRateSample.
+//
+// +checklocks:c.s.ep.mu
+func (c *bbrState) OnRateSample(rs *rateSample) {
+	c.updateModelAndState(rs)
+	c.updateControlParameters(rs)
+}
+
+// +checklocks:c.s.ep.mu
+func (c *bbrState) updateModelAndState(rs *rateSample) {
+	c.updateLatestDeliverySignals(rs)
+	c.updateCongestionSignals(rs)
+	c.checkStartupDone(rs)
+	c.checkDrain()
+	c.updateProbeBWCyclePhase(rs)
+	c.updateMinRTT(rs)
+	c.checkProbeRTT(rs)
+	c.advanceLatestDeliverySignals(rs)
+	c.boundBWForModel()
+}
+
+// +checklocks:c.s.ep.mu
+func (c *bbrState) updateControlParameters(rs *rateSample) {
+	c.setPacingRate()
+	c.setCwnd(rs)
+}
+
+// startRound marks the end of the current round trip.
+func (c *bbrState) startRound() {
+	c.nextRoundDelivered = c.s.rs.delivered
+}
+
+// updateRound tracks packet-timed round trips: a round ends when a segment
+// sent after the round started is delivered.
+func (c *bbrState) updateRound(rs *rateSample) {
+	if rs.priorTime != (tcpip.MonotonicTime{}) && rs.priorDelivered >= c.nextRoundDelivered {
+		c.startRound()
+		c.roundCount++
+		c.roundsSinceBWProbe++
+		c.roundStart = true
+	} else {
+		c.roundStart = false
+	}
+}
+
+// updateMaxBW feeds the delivery rate sample into the max bandwidth filter.
+func (c *bbrState) updateMaxBW(rs *rateSample) {
+	c.updateRound(rs)
+	if rs.deliveryRate == 0 {
+		return
+	}
+	if rs.deliveryRate >= c.maxBW || !rs.isAppLimited {
+		c.bwHi[1] = max(c.bwHi[1], rs.deliveryRate)
+		c.maxBW = max(c.bwHi[0], c.bwHi[1])
+	}
+}
+
+// advanceMaxBWFilter ages the max bandwidth filter by one probing cycle.
+func (c *bbrState) advanceMaxBWFilter() {
+	c.cycleCount++
+	if c.bwHi[1] == 0 {
+		return
+	}
+	c.bwHi[0] = c.bwHi[1]
+	c.bwHi[1] = 0
+	c.maxBW = c.bwHi[0]
+}
+
+func (c *bbrState) updateLatestDeliverySignals(rs *rateSample) {
+	c.lossRoundStart = false
+	c.bwLatest = max(c.bwLatest, rs.deliveryRate)
+	c.inflightLatest = max(c.inflightLatest, rs.delivered)
+	if rs.priorTime != (tcpip.MonotonicTime{}) && rs.priorDelivered >= c.lossRoundDelivered {
+		c.lossRoundDelivered = c.s.rs.delivered
+		c.lossRoundStart = true
+	}
+}
+
+func (c *bbrState) advanceLatestDeliverySignals(rs *rateSample) {
+	if c.lossRoundStart {
+		c.bwLatest = rs.deliveryRate
+		c.inflightLatest = rs.delivered
+	}
+}
+
+func (c *bbrState) resetCongestionSignals() {
+	c.lossInRound = false
+	c.lossEventsInRound = 0
+	c.bwLatest = 0
+	c.inflightLatest = 0
+}
+
+// +checklocks:c.s.ep.mu
+func (c *bbrState) updateCongestionSignals(rs *rateSample) {
+	c.updateMaxBW(rs)
+	if rs.newlyLost > 0 {
+		c.lossInRound = true
+		c.lossEventsInRound++
+	}
+	if !c.lossRoundStart {
+		return
+	}
+	c.checkStartupHighLoss(rs)
+	c.adaptLowerBoundsFromCongestion()
+	c.lossInRound = false
+	c.lossEventsInRound = 0
+}
+
+// adaptLowerBoundsFromCongestion reduces the lower bounds once per round in
+// which loss was observed, unless the loss was caused by probing.
+func (c *bbrState) adaptLowerBoundsFromCongestion() {
+	if c.isProbingBW() {
+		return
+	}
+	if c.lossInRound {
+		if c.bwLo == bbrInfinite {
+			c.bwLo = c.maxBW
+		}
+		if c.inflightLo == bbrInfinite {
+			c.inflightLo = c.cwnd()
+		}
+		c.bwLo = max(c.bwLatest, uint64(bbrBeta*float64(c.bwLo)))
+		c.inflightLo = max(c.inflightLatest, uint64(bbrBeta*float64(c.inflightLo)))
+	}
+}
+
+func (c *bbrState) resetLowerBounds() {
+	c.bwLo = bbrInfinite
+	c.inflightLo = bbrInfinite
+}
+
+func (c *bbrState) boundBWForModel() {
+	c.bw = min(c.maxBW, c.bwLo)
+}
+
+func (c *bbrState) isProbingBW() bool {
+	return c.mode == bbrStartup || c.mode == bbrProbeBWRefill || c.mode == bbrProbeBWUp
+}
+
+func (c *bbrState) isInProbeBW() bool {
+	return c.mode >= bbrProbeBWDown && c.mode <= bbrProbeBWUp
+}
+
+func (c *bbrState) enterStartup() {
+	c.mode = bbrStartup
+	c.pacingGain = bbrStartupPacingGain
+	c.cwndGain = bbrStartupCwndGain
+}
+
+// checkStartupDone leaves Startup once the pipe is estimated to be full.
+func (c *bbrState) checkStartupDone(rs *rateSample) {
+	c.checkStartupFullBandwidth(rs)
+	if c.mode == bbrStartup && c.filledPipe {
+		c.enterDrain()
+	}
+}
+
+func (c *bbrState) checkStartupFullBandwidth(rs *rateSample) {
+	if c.filledPipe || !c.roundStart || rs.isAppLimited {
+		return
+	}
+	if float64(c.maxBW) >= float64(c.fullBW)*bbrStartupFullBWThresh {
+		c.fullBW = c.maxBW
+		c.fullBWCount = 0
+		return
+	}
+	c.fullBWCount++
+	if c.fullBWCount >= bbrStartupFullBWCount {
+		c.filledPipe = true
+	}
+}
+
+// +checklocks:c.s.ep.mu
+func (c *bbrState) checkStartupHighLoss(rs *rateSample) {
+	if c.filledPipe || c.mode != bbrStartup {
+		return
+	}
+	if c.lossEventsInRound >= bbrStartupFullLossCount && c.isInflightTooHigh(rs) {
+		c.inflightHi = max(c.bdp(c.maxBW, 1), c.inflightLatest)
+		c.filledPipe = true
+	}
+}
+
+func (c *bbrState) enterDrain() {
+	c.mode = bbrDrain
+	c.pacingGain = bbrDrainPacingGain
+	c.cwndGain = bbrStartupCwndGain
+}
+
+// +checklocks:c.s.ep.mu
+func (c *bbrState) checkDrain() {
+	if c.mode == bbrDrain && c.inflight() <= c.inflightFor(c.maxBW, 1) {
+		c.enterProbeBW()
+	}
+}
+
+// +checklocks:c.s.ep.mu
+func (c *bbrState) enterProbeBW() {
+	c.cwndGain = bbrDefaultCwndGain
+	c.startProbeBWDown()
+}
+
+// +checklocks:c.s.ep.mu
+func (c *bbrState) startProbeBWDown() {
+	c.resetCongestionSignals()
+	c.probeUpCnt = bbrInfinite
+	c.pickProbeWait()
+	c.cycleStamp = c.now()
+	c.ackPhase = bbrAcksProbeStopping
+	c.startRound()
+	c.mode = bbrProbeBWDown
+	c.pacingGain = bbrProbeBWDownPacingGain
+}
+
+func (c *bbrState) startProbeBWCruise() {
+	c.mode = bbrProbeBWCruise
+	c.pacingGain = 1
+}
+
+func (c *bbrState) startProbeBWRefill() {
+	c.resetLowerBounds()
+	c.bwProbeUpRounds = 0
+	c.bwProbeUpAcks = 0
+	c.ackPhase = bbrAcksRefilling
+	c.startRound()
+	c.mode = bbrProbeBWRefill
+	c.pacingGain = 1
+}
+
+// +checklocks:c.s.ep.mu
+func (c *bbrState) startProbeBWUp() {
+	c.ackPhase = bbrAcksProbeStarting
+	c.startRound()
+	c.cycleStamp = c.now()
+	c.mode = bbrProbeBWUp
+	c.pacingGain = bbrProbeBWUpPacingGain
+	c.raiseInflightHiSlope()
+}
+
+// pickProbeWait randomizes the time until the next bandwidth probe so that
+// competing BBR flows don't probe in lockstep.
+//
+// +checklocks:c.s.ep.mu
+func (c *bbrState) pickProbeWait() {
+	rng := c.s.ep.stack.InsecureRNG()
+	c.roundsSinceBWProbe = uint64(rng.Intn(2))
+	c.bwProbeWait = bbrProbeWaitBase + time.Duration(rng.Int63n(int64(bbrProbeWaitRand)))
+}
+
+func (c *bbrState) hasElapsedInPhase(d time.Duration) bool {
+	return c.now().Sub(c.cycleStamp) > d
+}
+
+// updateProbeBWCyclePhase advances the ProbeBW state machine.
+//
+// +checklocks:c.s.ep.mu
+func (c *bbrState) updateProbeBWCyclePhase(rs *rateSample) {
+	if !c.filledPipe {
+		return
+	}
+	c.adaptUpperBounds(rs)
+	if !c.isInProbeBW() {
+		return
+	}
+	switch c.mode {
+	case bbrProbeBWDown:
+		if c.checkTimeToProbeBW() {
+			return
+		}
+		if c.checkTimeToCruise() {
+			c.startProbeBWCruise()
+		}
+	case bbrProbeBWCruise:
+		c.checkTimeToProbeBW()
+	case bbrProbeBWRefill:
+		// After one round of refilling, start probing.
+		if c.roundStart {
+			c.bwProbeSamples = true
+			c.startProbeBWUp()
+		}
+	case bbrProbeBWUp:
+		if c.hasElapsedInPhase(c.minRTT) && c.inflight() > c.inflightFor(c.maxBW, bbrProbeBWUpPacingGain) {
+			c.startProbeBWDown()
+		}
+	}
+}
+
+// checkTimeToCruise returns true once the queue built while probing has
+// drained.
+//
+// +checklocks:c.s.ep.mu
+func (c *bbrState) checkTimeToCruise() bool {
+	inflight := c.inflight()
+	if inflight > c.inflightWithHeadroom() {
+		return false
+	}
+	return inflight <= c.inflightFor(c.maxBW, 1)
+}
+
+// checkTimeToProbeBW starts refilling the pipe if it is time to probe for
+// more bandwidth.
+//
+// +checklocks:c.s.ep.mu
+func (c *bbrState) checkTimeToProbeBW() bool {
+	if c.hasElapsedInPhase(c.bwProbeWait) || c.isRenoCoexistenceProbeTime() {
+		c.startProbeBWRefill()
+		return true
+	}
+	return false
+}
+
+// isRenoCoexistenceProbeTime returns true if a Reno flow sharing the
+// bottleneck would have probed for bandwidth by now.
+func (c *bbrState) isRenoCoexistenceProbeTime() bool {
+	renoRounds := c.targetInflight() / c.mss()
+	return c.roundsSinceBWProbe >= min(renoRounds, bbrMaxRenoRounds)
+}
+
+func (c *bbrState) targetInflight() uint64 {
+	return min(c.bdp(c.bw, 1), c.cwnd())
+}
+
+// adaptUpperBounds updates inflightHi based on the loss observed while
+// probing for bandwidth.
+//
+// +checklocks:c.s.ep.mu
+func (c *bbrState) adaptUpperBounds(rs *rateSample) {
+	if c.ackPhase == bbrAcksProbeStarting && c.roundStart {
+		// ACKs for the data sent while probing are arriving.
+		c.ackPhase = bbrAcksProbeFeedback
+	}
+	if c.ackPhase == bbrAcksProbeStopping && c.roundStart {
+		// End of the bandwidth probing cycle.
+		if c.isInProbeBW() && !rs.isAppLimited {
+			c.advanceMaxBWFilter()
+		}
+	}
+	if c.checkInflightTooHigh(rs) {
+		return
+	}
+	if c.inflightHi == bbrInfinite {
+		return
+	}
+	if rs.txInFlight > c.inflightHi {
+		c.inflightHi = rs.txInFlight
+	}
+	if c.mode == bbrProbeBWUp {
+		c.probeInflightHiUpward(rs)
+	}
+}
+
+// +checklocks:c.s.ep.mu
+func (c *bbrState) checkInflightTooHigh(rs *rateSample) bool {
+	if !c.isInflightTooHigh(rs) {
+		return false
+	}
+	if c.bwProbeSamples {
+		c.handleInflightTooHigh(rs)
+	}
+	return true
+}
+
+// isInflightTooHigh returns true if the loss rate over the sample exceeds
+// bbrLossThresh.
+func (c *bbrState) isInflightTooHigh(rs *rateSample) bool {
+	return rs.lost > 0 && float64(rs.lost) > float64(rs.txInFlight)*bbrLossThresh
+}
+
+// +checklocks:c.s.ep.mu
+func (c *bbrState) handleInflightTooHigh(rs *rateSample) {
+	c.bwProbeSamples = false
+	if !rs.isAppLimited {
+		c.inflightHi = max(rs.txInFlight, uint64(float64(c.targetInflight())*bbrBeta))
+	}
+	if c.mode == bbrProbeBWUp {
+		c.startProbeBWDown()
+	}
+}
+
+// raiseInflightHiSlope doubles the growth rate of inflightHi each round
+// spent in ProbeBW UP.
+func (c *bbrState) raiseInflightHiSlope() {
+	growth := uint64(1) << c.bwProbeUpRounds
+	c.bwProbeUpRounds = min(c.bwProbeUpRounds+1, bbrMaxProbeUpRounds)
+	c.probeUpCnt = max(c.cwnd()/growth, c.mss())
+}
+
+func (c *bbrState) probeInflightHiUpward(rs *rateSample) {
+	if !c.s.rs.cwndLimited || c.cwnd() < c.inflightHi {
+		return
+	}
+	c.bwProbeUpAcks += rs.newlyAcked
+	if c.bwProbeUpAcks >= c.probeUpCnt {
+		delta := c.bwProbeUpAcks / c.probeUpCnt
+		c.bwProbeUpAcks -= delta * c.probeUpCnt
+		c.inflightHi += delta * c.mss()
+	}
+	if c.roundStart {
+		c.raiseInflightHiSlope()
+	}
+}
+
+// updateMinRTT maintains the min RTT filter and the shorter window used to
+// schedule ProbeRTT.
+//
+// +checklocks:c.s.ep.mu
+func (c *bbrState) updateMinRTT(rs *rateSample) {
+	now := c.now()
+	c.probeRTTExpired = now.Sub(c.probeRTTMinStamp) > bbrProbeRTTInterval
+	if rs.rtt >= 0 && (rs.rtt < c.probeRTTMinDelay || c.probeRTTExpired) {
+		c.probeRTTMinDelay = rs.rtt
+		c.probeRTTMinStamp = now
+	}
+	minRTTExpired := now.Sub(c.minRTTStamp) > bbrMinRTTFilterLen
+	if c.probeRTTMinDelay < c.minRTT || minRTTExpired {
+		c.minRTT = c.probeRTTMinDelay
+		c.minRTTStamp = c.probeRTTMinStamp
+	}
+}
+
+// +checklocks:c.s.ep.mu
+func (c *bbrState) checkProbeRTT(rs *rateSample) {
+	if c.mode != bbrProbeRTT && c.probeRTTExpired {
+		c.enterProbeRTT()
+		c.saveCwnd()
+		c.probeRTTDoneStamp = tcpip.MonotonicTime{}
+		c.ackPhase = bbrAcksProbeStopping
+		c.startRound()
+	}
+	if c.mode == bbrProbeRTT {
+		c.handleProbeRTT()
+	}
+}
+
+func (c *bbrState) enterProbeRTT() {
+	c.mode = bbrProbeRTT
+	c.pacingGain = 1
+	c.cwndGain = bbrProbeRTTCwndGain
+}
+
+// +checklocks:c.s.ep.mu
+func (c *bbrState) handleProbeRTT() {
+	// Ignore low rate samples taken while draining the pipe.
+	c.s.rs.markAppLimited(c.inflight())
+	if c.probeRTTDoneStamp == (tcpip.MonotonicTime{}) && c.inflight() <= c.probeRTTCwnd() {
+		// Wait for at least bbrProbeRTTDuration and one round trip
+		// at the reduced inflight.
+		c.probeRTTDoneStamp = c.now().Add(bbrProbeRTTDuration)
+		c.probeRTTRoundDone = false
+		c.startRound()
+	} else if c.probeRTTDoneStamp != (tcpip.MonotonicTime{}) {
+		if c.roundStart {
+			c.probeRTTRoundDone = true
+		}
+		if c.probeRTTRoundDone {
+			c.checkProbeRTTDone()
+		}
+	}
+}
+
+// +checklocks:c.s.ep.mu
+func (c *bbrState) checkProbeRTTDone() {
+	if now := c.now(); c.probeRTTDoneStamp != (tcpip.MonotonicTime{}) && now.After(c.probeRTTDoneStamp) {
+		// Schedule the next ProbeRTT.
+		c.probeRTTMinStamp = now
+		c.restoreCwnd()
+		c.exitProbeRTT()
+	}
+}
+
+// +checklocks:c.s.ep.mu
+func (c *bbrState) exitProbeRTT() {
+	c.resetLowerBounds()
+	if c.filledPipe {
+		c.enterProbeBW()
+		c.startProbeBWCruise()
+	} else {
+		c.enterStartup()
+	}
+}
+
+func (c *bbrState) probeRTTCwnd() uint64 {
+	return max(c.bdp(c.bw, bbrProbeRTTCwndGain), bbrMinPipeCwnd*c.mss())
+}
+
+// saveCwnd remembers the congestion window before it is reduced for loss
+// recovery or ProbeRTT.
+//
+// +checklocks:c.s.ep.mu
+func (c *bbrState) saveCwnd() {
+	if !c.inRecovery() && c.mode != bbrProbeRTT {
+		c.priorCwnd = c.s.SndCwnd
+	} else {
+		c.priorCwnd = max(c.priorCwnd, c.s.SndCwnd)
+	}
+}
+
+// +checklocks:c.s.ep.mu
+func (c *bbrState) restoreCwnd() {
+	c.s.SndCwnd = max(c.s.SndCwnd, c.priorCwnd)
+}
+
+// initPacingRate sets the initial pacing rate from the initial congestion
+// window and the smoothed RTT, if known.
+//
+// +checklocks:c.s.ep.mu
+func (c *bbrState) initPacingRate() {
+	c.s.rtt.Lock()
+	srtt := c.s.rtt.TCPRTTState.SRTT
+	c.s.rtt.Unlock()
+	if srtt <= 0 {
+		srtt = time.Millisecond
+	}
+	nominalBW := float64(InitialCwnd*c.mss()) / srtt.Seconds()
+	c.s.pacingRate = uint64(bbrStartupPacingGain * nominalBW)
+}
+
+// +checklocks:c.s.ep.mu
+func (c *bbrState) setPacingRate() {
+	rate := uint64(c.pacingGain * float64(c.bw) * (100 - bbrPacingMarginPercent) / 100)
+	if rate == 0 {
+		return
+	}
+	if c.filledPipe || rate > c.s.pacingRate {
+		c.s.pacingRate = rate
+	}
+}
+
+// bdp returns gain times the estimated bandwidth-delay product.
+func (c *bbrState) bdp(bw uint64, gain float64) uint64 {
+	if c.minRTT == effectivelyInfinity {
+		// No valid RTT sample yet.
+		return InitialCwnd * c.mss()
+	}
+	return uint64(gain * float64(bw) * c.minRTT.Seconds())
+}
+
+// quantizationBudget adds allowances for segmentation offload and delayed
+// ACKs to the given inflight.
+func (c *bbrState) quantizationBudget(inflight uint64) uint64 {
+	inflight = max(inflight, 3*c.mss(), bbrMinPipeCwnd*c.mss())
+	if c.mode == bbrProbeBWUp {
+		inflight += 2 * c.mss()
+	}
+	return inflight
+}
+
+func (c *bbrState) inflightFor(bw uint64, gain float64) uint64 {
+	return c.quantizationBudget(c.bdp(bw, gain))
+}
+
+// inflightWithHeadroom returns inflightHi less bbrHeadroom.
+func (c *bbrState) inflightWithHeadroom() uint64 {
+	if c.inflightHi == bbrInfinite {
+		return bbrInfinite
+	}
+	headroom := max(c.mss(), uint64(bbrHeadroom*float64(c.inflightHi)))
+	if c.inflightHi < headroom+bbrMinPipeCwnd*c.mss() {
+		return bbrMinPipeCwnd * c.mss()
+	}
+	return c.inflightHi - headroom
+}
+
+// setCwnd grows the congestion window towards the model target and bounds
+// it by the model's inflight limits.
+//
+// +checklocks:c.s.ep.mu
+func (c *bbrState) setCwnd(rs *rateSample) {
+	c.maxInflight = c.inflightFor(c.bw, c.cwndGain)
+	cwnd := c.cwnd()
+
+	if c.s.FastRecovery.Active {
+		// Modulate cwnd for recovery: reduce it by the newly lost data,
+		// and in the first round keep sending one segment per segment
+		// delivered.
+		if rs.newlyLost > 0 {
+			cwnd = max(cwnd-min(cwnd, rs.newlyLost), c.mss())
+		}
+		if c.roundStart {
+			c.packetConservation = false
+		}
+		if c.packetConservation {
+			cwnd = max(cwnd, c.inflight()+rs.newlyAcked)
+		}
+	}
+
+	if c.filledPipe {
+		cwnd = min(cwnd+rs.newlyAcked, c.maxInflight)
+	} else if cwnd < c.maxInflight || c.s.rs.delivered < InitialCwnd*c.mss() {
+		cwnd += rs.newlyAcked
+	}
+	cwnd = max(cwnd, bbrMinPipeCwnd*c.mss())
+
+	// Bound cwnd for ProbeRTT.
+	if c.mode == bbrProbeRTT {
+		cwnd = min(cwnd, c.probeRTTCwnd())
+	}
+
+	// Bound cwnd for the model.
+	bound := uint64(bbrInfinite)
+	if c.isInProbeBW() && c.mode != bbrProbeBWCruise {
+		bound = c.inflightHi
+	} else if c.mode == bbrProbeRTT || c.mode == bbrProbeBWCruise {
+		bound = c.inflightWithHeadroom()
+	}
+	bound = max(min(bound, c.inflightLo), bbrMinPipeCwnd*c.mss())
+	c.setCwndBytes(min(cwnd, bound))
+}
+
+// Update implements congestionControl.Update. BBR is driven by rate samples
+// instead, see OnRateSample.
+func (c *bbrState) Update(int, time.Duration) {}
+
+// HandleLossDetected implements congestionControl.HandleLossDetected.
+//
+// +checklocks:c.s.ep.mu
+func (c *bbrState) HandleLossDetected() {
+	c.saveCwnd()
+	c.lossInRound = true
+	c.packetConservation = true
+	c.startRound()
+
+	// Enter recovery with cwnd set to the data in flight, which the sender
+	// derives from Ssthresh.
+	c.s.Ssthresh = max(c.s.Outstanding, bbrMinPipeCwnd)
+}
+
+// HandleRTOExpired implements congestionControl.HandleRTOExpired.
+//
+// +checklocks:c.s.ep.mu
+func (c *bbrState) HandleRTOExpired() {
+	c.saveCwnd()
+	c.lossInRound = true
+	c.packetConservation = false
+	c.s.SndCwnd = 1
+}
+
+// PostRecovery implements congestionControl.PostRecovery.
+//
+// +checklocks:c.s.ep.mu
+func (c *bbrState) PostRecovery() {
+	c.packetConservation = false
+	c.restoreCwnd()
+	c.s.Ssthresh = InitialSsthresh
+}
@@ -0,0 +1,210 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wilinz/gvisor/pkg/buffer"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/faketime"
+	"github.com/wilinz/gvisor/pkg/tcpip/seqnum"
+	"github.com/wilinz/gvisor/pkg/tcpip/stack"
+)
+
+const bbrTestMSS = 1000
+
+func newBBRTestSender(clock tcpip.Clock) *sender {
+	s := stack.New(stack.Options{
+		TransportProtocols: []stack.TransportProtocolFactory{NewProtocol},
+		Clock:              clock,
+	})
+	ep := &Endpoint{
+		stack: s,
+		cc:    tcpip.CongestionControlOption("bbr"),
+	}
+	iss := seqnum.Value(0)
+	return &sender{
+		ep: ep,
+		TCPSenderState: TCPSenderState{
+			SndUna:         iss + 1,
+			SndNxt:         iss + 1,
+			SndCwnd:        InitialCwnd,
+			Ssthresh:       InitialSsthresh,
+			MaxPayloadSize: bbrTestMSS,
+		},
+	}
+}
+
+// ackRound feeds uut a rate sample that ends the current round trip.
+func ackRound(uut *bbrState, clock *faketime.ManualClock, rate uint64, rtt time.Duration) {
+	clock.Advance(rtt)
+	prior := uut.s.rs.delivered
+	uut.s.rs.delivered += 10 * bbrTestMSS
+	uut.OnRateSample(&rateSample{
+		priorDelivered: max(prior, uut.nextRoundDelivered),
+		priorTime:      clock.NowMonotonic(),
+		interval:       rtt,
+		delivered:      10 * bbrTestMSS,
+		deliveryRate:   rate,
+		newlyAcked:     10 * bbrTestMSS,
+		rtt:            rtt,
+	})
+}
+
+func TestBBRStartupToProbeBW(t *testing.T) {
+	clock := faketime.NewManualClock()
+	snd := newBBRTestSender(clock)
+	snd.ep.mu.Lock()
+	defer snd.ep.mu.Unlock()
+	uut := newBBRCC(snd)
+
+	if uut.mode != bbrStartup {
+		t.Fatalf("got initial mode = %d, want bbrStartup", uut.mode)
+	}
+	if snd.pacingRate == 0 {
+		t.Fatalf("pacing is not enabled")
+	}
+
+	// The bandwidth grows for a few rounds, then stays flat. Keep lots of
+	// data in flight so that Drain doesn't complete right away.
+	const rtt = 10 * time.Millisecond
+	snd.Outstanding = 1000
+	for _, rate := range []uint64{1e6, 2e6, 4e6} {
+		ackRound(uut, clock, rate, rtt)
+		if uut.mode != bbrStartup {
+			t.Fatalf("left Startup while bandwidth was growing, mode = %d", uut.mode)
+		}
+	}
+	for i := 0; i < bbrStartupFullBWCount; i++ {
+		ackRound(uut, clock, 4e6, rtt)
+	}
+	if !uut.filledPipe {
+		t.Fatalf("pipe not filled after %d rounds without bandwidth growth", bbrStartupFullBWCount)
+	}
+	if uut.mode != bbrDrain {
+		t.Fatalf("got mode = %d, want bbrDrain", uut.mode)
+	}
+	if got, want := uut.maxBW, uint64(4e6); got != want {
+		t.Errorf("got maxBW = %d, want %d", got, want)
+	}
+	if got, want := uut.minRTT, rtt; got != want {
+		t.Errorf("got minRTT = %s, want %s", got, want)
+	}
+	if snd.pacingRate >= 4e6 {
+		t.Errorf("got pacing rate = %d while draining, want < %d", snd.pacingRate, uint64(4e6))
+	}
+
+	// Once the queue has drained, BBR starts probing for bandwidth.
+	snd.Outstanding = 0
+	ackRound(uut, clock, 4e6, rtt)
+	if !uut.isInProbeBW() {
+		t.Fatalf("got mode = %d, want a ProbeBW mode", uut.mode)
+	}
+	// The cwnd is bound by 2*BDP plus the quantization budget.
+	if got, max := uint64(snd.SndCwnd)*bbrTestMSS, uut.inflightFor(uut.bw, bbrDefaultCwndGain); got > max {
+		t.Errorf("got cwnd = %d bytes, want <= %d", got, max)
+	}
+}
+
+func TestBBRProbeRTT(t *testing.T) {
+	clock := faketime.NewManualClock()
+	snd := newBBRTestSender(clock)
+	snd.ep.mu.Lock()
+	defer snd.ep.mu.Unlock()
+	uut := newBBRCC(snd)
+
+	const rtt = 10 * time.Millisecond
+	for i := 0; i < 5; i++ {
+		ackRound(uut, clock, 4e6, rtt)
+	}
+	if !uut.isInProbeBW() {
+		t.Fatalf("got mode = %d, want a ProbeBW mode", uut.mode)
+	}
+	priorCwnd := snd.SndCwnd
+
+	// Without a lower RTT sample for bbrProbeRTTInterval, ProbeRTT is
+	// entered and the cwnd is reduced.
+	clock.Advance(bbrProbeRTTInterval)
+	snd.Outstanding = priorCwnd
+	ackRound(uut, clock, 4e6, 2*rtt)
+	if uut.mode != bbrProbeRTT {
+		t.Fatalf("got mode = %d, want bbrProbeRTT", uut.mode)
+	}
+	if got, max := uint64(snd.SndCwnd)*bbrTestMSS, uut.probeRTTCwnd(); got > max {
+		t.Errorf("got cwnd = %d bytes in ProbeRTT, want <= %d", got, max)
+	}
+
+	// ProbeRTT ends after bbrProbeRTTDuration and a round trip at the
+	// reduced inflight, restoring the cwnd.
+	snd.Outstanding = 0
+	ackRound(uut, clock, 4e6, rtt)
+	clock.Advance(bbrProbeRTTDuration)
+	ackRound(uut, clock, 4e6, rtt)
+	if uut.mode != bbrProbeBWCruise {
+		t.Fatalf("got mode = %d, want bbrProbeBWCruise", uut.mode)
+	}
+	if snd.SndCwnd < priorCwnd {
+		t.Errorf("got cwnd = %d after ProbeRTT, want >= %d", snd.SndCwnd, priorCwnd)
+	}
+}
+
+func TestRateSamplerDeliveryRate(t *testing.T) {
+	clock := faketime.NewManualClock()
+	clock.Advance(time.Millisecond)
+	var rs rateSampler
+	var segs []*segment
+	for i := 0; i < 4; i++ {
+		seg := newOutgoingSegment(stack.TransportEndpointID{}, clock, buffer.MakeWithView(buffer.NewViewSize(bbrTestMSS)))
+		defer seg.DecRef()
+		seg.xmitTime = clock.NowMonotonic()
+		seg.xmitCount = 1
+		rs.onSent(seg, seg.xmitTime, uint64(i*bbrTestMSS))
+		segs = append(segs, seg)
+		clock.Advance(time.Millisecond)
+	}
+
+	// All segments are acknowledged 10ms after the last one was sent.
+	clock.Advance(10 * time.Millisecond)
+	rs.beginAck()
+	for _, seg := range segs {
+		rs.onDelivered(seg, seg.payloadSize(), clock.NowMonotonic())
+	}
+	rs.generate(0)
+
+	sample := rs.sample
+	if got, want := sample.delivered, uint64(4*bbrTestMSS); got != want {
+		t.Errorf("got delivered = %d, want %d", got, want)
+	}
+	// The interval spans from the first transmission to the last ACK.
+	if got, want := sample.interval, 14*time.Millisecond; got != want {
+		t.Errorf("got interval = %s, want %s", got, want)
+	}
+	if got, want := sample.deliveryRate, uint64(4*bbrTestMSS*1000/14); got != want {
+		t.Errorf("got delivery rate = %d, want %d", got, want)
+	}
+	if got, want := sample.rtt, 11*time.Millisecond; got != want {
+		t.Errorf("got rtt = %s, want %s", got, want)
+	}
+
+	// Samples shorter than the min RTT are discarded.
+	rs.beginAck()
+	rs.sample.priorTime = clock.NowMonotonic()
+	rs.generate(time.Second)
+	if rs.sample.deliveryRate != 0 || rs.sample.interval >= 0 {
+		t.Errorf("got sample %+v, want an invalid sample", rs.sample)
+	}
+}
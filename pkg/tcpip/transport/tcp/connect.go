@@ -21,6 +21,7 @@ import (
 	"math"
 	"time"
 
+	"github.com/wilinz/gvisor/pkg/buffer"
 	"github.com/wilinz/gvisor/pkg/sync"
 	"github.com/wilinz/gvisor/pkg/tcpip"
 	"github.com/wilinz/gvisor/pkg/tcpip/checksum"
@@ -120,6 +121,29 @@ type handshake struct {
 	// retransmitTimer is used to retransmit SYN/SYN-ACK with exponential backoff
 	// till handshake is either completed or timesout.
 	retransmitTimer *backoffTimer `state:"nosave"`
+
+	// fastOpen is true if the active handshake uses TCP Fast Open.
+	fastOpen bool
+
+	// fastOpenData is the data written before an active TCP Fast Open
+	// handshake completed. It is sent in the SYN if a cookie is cached for
+	// the peer.
+	fastOpenData buffer.Buffer
+
+	// fastOpenSent is the number of bytes of fastOpenData sent in the SYN.
+	fastOpenSent seqnum.Size
+
+	// fastOpenAcked is the number of bytes of fastOpenData acknowledged by
+	// the SYN-ACK.
+	fastOpenAcked seqnum.Size
+
+	// fastOpenCookie, if not nil, is the TCP Fast Open cookie sent in a
+	// passive handshake's SYN-ACK.
+	fastOpenCookie []byte
+
+	// fastOpenSeg, if not nil, is the SYN whose data was accepted by a
+	// passive TCP Fast Open handshake.
+	fastOpenSeg *segment
 }
 
 // timerHandler takes a handler function for a timer and returns a function that
@@ -275,9 +299,10 @@ func (h *handshake) resetToSynRcvd(iss seqnum.Value, irs seqnum.Value, opts head
 }
 
 // checkAck checks if the ACK number, if present, of a segment received during
-// a TCP 3-way handshake is valid.
+// a TCP 3-way handshake is valid. It may also acknowledge data sent in a TCP
+// Fast Open SYN.
 func (h *handshake) checkAck(s *segment) bool {
-	return !(s.flags.Contains(header.TCPFlagAck) && s.ackNumber != h.iss+1)
+	return !(s.flags.Contains(header.TCPFlagAck) && !s.ackNumber.InRange(h.iss+1, h.iss.Add(h.fastOpenSent+2)))
 }
 
 // synSentState handles a segment received when the TCP 3-way handshake is in
@@ -287,7 +312,7 @@ func (h *handshake) synSentState(s *segment) tcpip.Error {
 	// RFC 793, page 37, states that in the SYN-SENT state, a reset is
 	// acceptable if the ack field acknowledges the SYN.
 	if s.flags.Contains(header.TCPFlagRst) {
-		if s.flags.Contains(header.TCPFlagAck) && s.ackNumber == h.iss+1 {
+		if s.flags.Contains(header.TCPFlagAck) && h.checkAck(s) {
 			// RFC 793, page 67, states that "If the RST bit is set [and] If the ACK
 			// was acceptable then signal the user "error: connection reset", drop
 			// the segment, enter CLOSED state, delete TCB, and return."
@@ -322,6 +347,9 @@ func (h *handshake) synSentState(s *segment) tcpip.Error {
 	// Remember if the Timestamp option was negotiated.
 	h.ep.maybeEnableTimestamp(rcvSynOpts)
 
+	// Remember if MPTCP was negotiated.
+	h.ep.mptcpHandleSynAck(s, h.iss, s.sequenceNumber)
+
 	// Remember if the SACKPermitted option was negotiated.
 	h.ep.maybeEnableSACKPermitted(rcvSynOpts)
 
@@ -335,9 +363,13 @@ func (h *handshake) synSentState(s *segment) tcpip.Error {
 	// and the handshake is completed.
 	if s.flags.Contains(header.TCPFlagAck) {
 		h.state = handshakeCompleted
+		if h.fastOpen {
+			h.fastOpenSynAckLocked(s, rcvSynOpts)
+		}
 		h.transitionToStateEstablishedLocked(s)
 
-		h.ep.sendEmptyRaw(header.TCPFlagAck, h.iss+1, h.ackNum, h.rcvWnd>>h.effectiveRcvWndScale())
+		h.ep.sendEmptyRaw(header.TCPFlagAck, h.iss.Add(1+h.fastOpenAcked), h.ackNum, h.rcvWnd>>h.effectiveRcvWndScale())
+		h.sendFastOpenDataLocked()
 		return nil
 	}
 
@@ -470,6 +502,10 @@ func (h *handshake) synRcvdState(s *segment) tcpip.Error {
 		// timeout is not hit then drop the ACK.
 		if h.deferAccept != 0 && s.payloadSize() == 0 && h.ep.stack.Clock().NowMonotonic().Sub(h.startTime) < h.deferAccept {
 			h.acked = true
+			h.ep.stack.Stats().TCP.DeferAcceptDrop.Increment()
+			if h.listenEP != nil {
+				h.listenEP.stats.ReceiveErrors.DeferAcceptDrop.Increment()
+			}
 			h.ep.stack.Stats().DroppedPackets.Increment()
 			return nil
 		}
@@ -491,6 +527,13 @@ func (h *handshake) synRcvdState(s *segment) tcpip.Error {
 			return nil
 		}
 
+		// Verify the MPTCP option, and reset joining subflows which fail
+		// to authenticate as per RFC 8684 section 3.2.
+		if !h.ep.mptcpHandleHandshakeAck(s, h.iss, h.ackNum-1) {
+			h.ep.sendEmptyRaw(header.TCPFlagRst, s.ackNumber, 0, 0)
+			return &tcpip.ErrConnectionAborted{}
+		}
+
 		// Update timestamp if required. See RFC7323, section-4.3.
 		if h.ep.SendTSOk && s.parsedOptions.TS {
 			h.ep.updateRecentTimestamp(s.parsedOptions.TSVal, h.ackNum, s.sequenceNumber)
@@ -499,6 +542,12 @@ func (h *handshake) synRcvdState(s *segment) tcpip.Error {
 		h.state = handshakeCompleted
 		h.transitionToStateEstablishedLocked(s)
 
+		// A joining subflow acknowledges the third ACK, which carries
+		// its HMAC, as the peer retransmits it until it does.
+		if h.ep.mp != nil && h.ep.mp.join {
+			h.ep.snd.sendAck()
+		}
+
 		// Requeue the segment if the ACK completing the handshake has more info
 		// to be processed by the newly established endpoint.
 		if (s.flags.Contains(header.TCPFlagFin) || s.payloadSize() > 0) && h.ep.enqueueSegment(s) {
@@ -558,7 +607,7 @@ func (h *handshake) processSegments() tcpip.Error {
 // resolution is required.
 func (h *handshake) start() {
 	h.startTime = h.ep.stack.Clock().NowMonotonic()
-	h.ep.amss = calculateAdvertisedMSS(h.ep.userMSS, h.ep.route)
+	h.ep.amss = calculateAdvertisedMSS(h.ep.userMSS, h.ep.protocol.routeMTU(h.ep.route))
 	var sackEnabled tcpip.TCPSACKEnabled
 	if err := h.ep.stack.TransportProtocolOption(ProtocolNumber, &sackEnabled); err != nil {
 		// If stack returned an error when checking for SACKEnabled
@@ -587,8 +636,24 @@ func (h *handshake) start() {
 		}
 	}
 
+	// Request a TCP Fast Open cookie, or send the SYN data along with the
+	// cached one. Retransmitted SYNs carry the cookie but not the data.
+	var data buffer.Buffer
+	if h.state == handshakeSynSent && h.fastOpen {
+		synOpts.FastOpen = true
+		if cookie := h.ep.protocol.cachedFastOpenCookie(h.ep.TransportEndpointInfo.ID.RemoteAddress); cookie != nil {
+			synOpts.FastOpenCookie = cookie
+			data = h.fastOpenData
+			h.fastOpenSent = seqnum.Size(data.Size())
+		}
+	}
+	if h.state == handshakeSynRcvd && h.fastOpenCookie != nil {
+		synOpts.FastOpen = true
+		synOpts.FastOpenCookie = h.fastOpenCookie
+	}
+
 	h.sendSYNOpts = synOpts
-	h.ep.sendSynTCP(h.ep.route, tcpFields{
+	h.ep.sendSynDataTCP(h.ep.route, tcpFields{
 		id:        h.ep.TransportEndpointInfo.ID,
 		ttl:       calculateTTL(h.ep.route, h.ep.ipv4TTL, h.ep.ipv6HopLimit),
 		tos:       h.ep.sendTOS,
@@ -597,7 +662,7 @@ func (h *handshake) start() {
 		ack:       h.ackNum,
 		rcvWnd:    h.rcvWnd,
 		expOptVal: h.ep.getExperimentOptionValue(h.ep.route),
-	}, synOpts)
+	}, synOpts, data)
 }
 
 // retransmitHandler handles retransmissions of un-acked SYNs.
@@ -656,8 +721,9 @@ func (h *handshake) transitionToStateEstablishedLocked(s *segment) {
 
 	// Transfer handshake state to TCP connection. We disable
 	// receive window scaling if the peer doesn't support it
-	// (indicated by a negative send window scale).
-	h.ep.snd = newSender(h.ep, h.iss, h.ackNum-1, h.sndWnd, h.mss, h.sndWndScale)
+	// (indicated by a negative send window scale). SYN data acknowledged
+	// by the peer is accounted for as part of the SYN.
+	h.ep.snd = newSender(h.ep, h.iss.Add(h.fastOpenAcked), h.ackNum-1, h.sndWnd, h.mss, h.sndWndScale)
 
 	now := h.ep.stack.Clock().NowMonotonic()
 
@@ -680,6 +746,7 @@ func (h *handshake) transitionToStateEstablishedLocked(s *segment) {
 	// tuning adjustment.
 	h.ep.RcvAutoParams.PrevCopiedBytes = int(h.rcvWnd)
 	h.ep.rcvQueueMu.Unlock()
+	h.deliverFastOpenDataLocked()
 
 	h.ep.setEndpointState(StateEstablished)
 
@@ -766,6 +833,7 @@ func makeSynOptions(opts header.TCPSynOptions) []byte {
 	// 	else: FASTOPEN (2 + len(cookie))
 	//	cookie(variable) [padding to four bytes]
 	//
+	// The experimental fastopen option is never sent.
 	options := getOptions()
 
 	// Always encode the mss.
@@ -793,12 +861,15 @@ func makeSynOptions(opts header.TCPSynOptions) []byte {
 		offset += header.EncodeWSOption(opts.WS, options[offset:])
 	}
 
-	// Padding to the end; note that this never apply unless we add a
-	// fastopen option, we always expect the offset to remain the same.
-	if delta := header.AddTCPOptionPadding(options, offset); delta != 0 {
-		panic("unexpected option encoding")
+	// Initialize the fastopen option.
+	if opts.FastOpen {
+		offset += header.EncodeFastOpenOption(opts.FastOpenCookie, options[offset:])
 	}
 
+	// Padding to the end; note that this only applies to the fastopen
+	// option, all other options are already aligned.
+	offset += header.AddTCPOptionPadding(options, offset)
+
 	return options[:offset]
 }
 
@@ -819,13 +890,25 @@ type tcpFields struct {
 }
 
 func (e *Endpoint) sendSynTCP(r *stack.Route, tf tcpFields, opts header.TCPSynOptions) tcpip.Error {
+	return e.sendSynDataTCP(r, tf, opts, buffer.Buffer{})
+}
+
+// sendSynDataTCP is like sendSynTCP, but the SYN also carries data, as with
+// TCP Fast Open. It doesn't take ownership of data.
+func (e *Endpoint) sendSynDataTCP(r *stack.Route, tf tcpFields, opts header.TCPSynOptions, data buffer.Buffer) tcpip.Error {
 	tf.opts = makeSynOptions(opts)
+	if e.mp != nil && e.EndpointState().connecting() {
+		tf.opts = tf.opts[:len(tf.opts)+e.mptcpSynOption(tf.opts[len(tf.opts):cap(tf.opts)])]
+	}
 	// We ignore SYN send errors and let the callers re-attempt send.
 	hdrSize := header.TCPMinimumSize + int(r.MaxHeaderLength()) + len(tf.opts)
 	if r.NetProto() == header.IPv6ProtocolNumber && tf.expOptVal != 0 {
 		hdrSize += header.IPv6ExperimentHdrLength
 	}
-	p := stack.NewPacketBuffer(stack.PacketBufferOptions{ReserveHeaderBytes: hdrSize})
+	p := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		ReserveHeaderBytes: hdrSize,
+		Payload:            data.Clone(),
+	})
 	defer p.DecRef()
 	if err := e.sendTCP(r, tf, p, stack.GSO{}); err != nil {
 		e.stats.SendErrors.SynSendToNetworkFailed.Increment()
@@ -860,15 +943,16 @@ func buildTCPHdr(r *stack.Route, tf tcpFields, pkt *stack.PacketBuffer, gso stac
 	})
 	copy(tcp[header.TCPMinimumSize:], tf.opts)
 
-	xsum := r.PseudoHeaderChecksum(ProtocolNumber, uint16(pkt.Size()))
-	// Only calculate the checksum if offloading isn't supported.
+	// Only calculate the checksum if offloading isn't supported. Packets on
+	// local routes aren't checksummed at all, not even the pseudo-header.
 	if gso.Type != stack.GSONone && gso.NeedsCsum {
 		// This is called CHECKSUM_PARTIAL in the Linux kernel. We
 		// calculate a checksum of the pseudo-header and save it in the
 		// TCP header, then the kernel calculate a checksum of the
 		// header and data and get the right sum of the TCP packet.
-		tcp.SetChecksum(xsum)
+		tcp.SetChecksum(r.PseudoHeaderChecksum(ProtocolNumber, uint16(pkt.Size())))
 	} else if r.RequiresTXTransportChecksum() {
+		xsum := r.PseudoHeaderChecksum(ProtocolNumber, uint16(pkt.Size()))
 		xsum = checksum.Combine(xsum, pkt.Data().Checksum())
 		tcp.SetChecksum(^tcp.CalculateChecksum(xsum))
 	}
@@ -966,8 +1050,9 @@ func sendTCP(r *stack.Route, tf tcpFields, pkt *stack.PacketBuffer, gso stack.GS
 	return nil
 }
 
-// makeOptions makes an options slice.
-func (e *Endpoint) makeOptions(sackBlocks []header.SACKBlock) []byte {
+// makeOptions makes an options slice. mptcpOpt is an encoded MPTCP option to
+// include, if any.
+func (e *Endpoint) makeOptions(sackBlocks []header.SACKBlock, mptcpOpt []byte) []byte {
 	options := getOptions()
 	offset := 0
 
@@ -991,7 +1076,14 @@ func (e *Endpoint) makeOptions(sackBlocks []header.SACKBlock) []byte {
 		offset += header.EncodeNOP(options[offset:])
 		offset += header.EncodeTSOption(e.tsValNow(), e.recentTimestamp(), options[offset:])
 	}
-	if e.SACKPermitted && len(sackBlocks) > 0 {
+	if len(mptcpOpt) > 0 {
+		for (offset+len(mptcpOpt))%4 != 0 {
+			offset += header.EncodeNOP(options[offset:])
+		}
+		offset += copy(options[offset:], mptcpOpt)
+	}
+	// Only add SACK blocks if there is room for at least one of them.
+	if e.SACKPermitted && len(sackBlocks) > 0 && len(options)-offset >= 4+8 {
 		offset += header.EncodeNOP(options[offset:])
 		offset += header.EncodeNOP(options[offset:])
 		offset += header.EncodeSACKBlocks(sackBlocks, options[offset:])
@@ -1025,7 +1117,12 @@ func (e *Endpoint) sendRaw(pkt *stack.PacketBuffer, flags header.TCPFlags, seq,
 	if e.EndpointState() == StateEstablished && e.rcv.pendingRcvdSegments.Len() > 0 && (flags&header.TCPFlagAck != 0) {
 		sackBlocks = e.sack.Blocks[:e.sack.NumBlocks]
 	}
-	options := e.makeOptions(sackBlocks)
+	var mptcpOpt []byte
+	if e.mp != nil {
+		var b [mptcpMaxOptionSize]byte
+		mptcpOpt = b[:e.mptcpOption(b[:], flags, seq, pkt.Data().Size())]
+	}
+	options := e.makeOptions(sackBlocks, mptcpOpt)
 	defer putOptions(options)
 	hdrSize := header.TCPMinimumSize + int(e.route.MaxHeaderLength()) + len(options)
 	expOptVal := e.getExperimentOptionValue(e.route)
@@ -1303,6 +1400,10 @@ func (e *Endpoint) handleSegmentLocked(s *segment) (cont bool, err tcpip.Error)
 		// send window scale.
 		s.window <<= e.snd.SndWndScale
 
+		// Record the MPTCP data mappings and Data ACK before the
+		// payload is queued.
+		e.mptcpHandleSegment(s)
+
 		// RFC 793, page 41 states that "once in the ESTABLISHED
 		// state all segments must carry current acknowledgment
 		// information."
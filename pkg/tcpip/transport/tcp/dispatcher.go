@@ -108,6 +108,13 @@ func deliverAccepted(ep *Endpoint) bool {
 	// Remove endpoint from list of pendingEndpoints as the handshake is now
 	// complete.
 	delete(lEP.acceptQueue.pendingEndpoints, ep)
+
+	// Subflows joining an MPTCP connection are handed to the connection
+	// rather than accepted.
+	if ep.mp != nil && ep.mp.join {
+		lEP.acceptMu.Unlock()
+		return ep.mp.conn.JoinSubflow(ep, ep.waiterQueue)
+	}
 	// Deliver this endpoint to the listening socket's accept queue.
 	if lEP.acceptQueue.capacity == 0 {
 		lEP.acceptMu.Unlock()
@@ -442,6 +449,13 @@ func (d *dispatcher) queuePacket(stackEP stack.TransportEndpoint, id stack.Trans
 
 	ep := stackEP.(*Endpoint)
 
+	// Only transparent endpoints may receive packets redirected by a TPROXY
+	// target.
+	if pkt.NetworkPacketInfo.TProxy.Port != 0 && !ep.ops.GetTransparent() {
+		ep.stack.Stats().DroppedPackets.Increment()
+		return
+	}
+
 	s, err := newIncomingSegment(id, clock, pkt)
 	if err != nil {
 		ep.stack.Stats().TCP.InvalidSegmentsReceived.Increment()
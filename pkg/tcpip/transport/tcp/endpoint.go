@@ -213,6 +213,14 @@ type ReceiveErrors struct {
 	// in the handshake was dropped due to overflow.
 	ListenOverflowAckDrop tcpip.StatCounter
 
+	// ListenSynBacklogDrop is the number of SYNs dropped because the SYN
+	// backlog was full and SYN cookies were disabled.
+	ListenSynBacklogDrop tcpip.StatCounter
+
+	// DeferAcceptDrop is the number of bare ACKs completing a handshake
+	// that were dropped because of TCP_DEFER_ACCEPT.
+	DeferAcceptDrop tcpip.StatCounter
+
 	// ZeroRcvWindowState is the number of times we advertised
 	// a zero receive window when rcvQueue is full.
 	ZeroRcvWindowState tcpip.StatCounter
@@ -263,6 +271,18 @@ type Stats struct {
 	// Accept errors.
 	FailedConnectionAttempts tcpip.StatCounter
 
+	// SynCookiesSent is the number of SYN cookies sent by a listening
+	// endpoint.
+	SynCookiesSent tcpip.StatCounter
+
+	// SynCookiesRcvd is the number of valid SYN cookies received by a
+	// listening endpoint.
+	SynCookiesRcvd tcpip.StatCounter
+
+	// InvalidSynCookiesRcvd is the number of invalid SYN cookies received
+	// by a listening endpoint.
+	InvalidSynCookiesRcvd tcpip.StatCounter
+
 	// ReceiveErrors collects segment receive errors within the
 	// transport layer.
 	ReceiveErrors ReceiveErrors
@@ -602,16 +622,45 @@ type Endpoint struct {
 	//
 	// +checklocks:mu
 	pmtud tcpip.PMTUDStrategy
+
+	// mp is the Multipath TCP state of the endpoint if it is a subflow of
+	// an MPTCP connection or an MPTCP listener, nil otherwise.
+	//
+	// +checklocks:mu
+	mp *mptcpSubflow `state:"nosave"`
+
+	// fastOpenQLen is the maximum number of pending TCP Fast Open
+	// connections of a listening endpoint, as set by TCP_FASTOPEN. Zero
+	// disables TCP Fast Open for passive opens.
+	//
+	// +checklocks:mu
+	fastOpenQLen int
+
+	// fastOpenConnect is true if TCP Fast Open is used for active opens, as
+	// set by TCP_FASTOPEN_CONNECT.
+	//
+	// +checklocks:mu
+	fastOpenConnect bool
+
+	// fastOpenPassive is true if the endpoint was created by a passive open
+	// which accepted data from the peer's SYN. It is immutable once the
+	// endpoint is pending acceptance.
+	fastOpenPassive bool
+
+	// fastOpenDeferred is true if sending the SYN is deferred until the
+	// first write, as done for TCP_FASTOPEN_CONNECT.
+	fastOpenDeferred atomicbitops.Bool
 }
 
 // calculateAdvertisedMSS calculates the MSS to advertise.
 //
 // If userMSS is non-zero and is not greater than the maximum possible MSS for
-// r, it will be used; otherwise, the maximum possible MSS will be used.
-func calculateAdvertisedMSS(userMSS uint16, r *stack.Route) uint16 {
+// a route with the given MTU, it will be used; otherwise, the maximum possible
+// MSS will be used.
+func calculateAdvertisedMSS(userMSS uint16, mtu uint32) uint16 {
 	// The maximum possible MSS is dependent on the route.
 	// TODO(b/143359391): Respect TCP Min and Max size.
-	maxMSS := uint16(r.MTU() - header.TCPMinimumSize)
+	maxMSS := uint16(mtu - header.TCPMinimumSize)
 
 	if userMSS != 0 && userMSS < maxMSS {
 		return userMSS
@@ -931,7 +980,11 @@ func (e *Endpoint) Readiness(mask waiter.EventMask) waiter.EventMask {
 		result |= waiter.EventHUp
 
 	case StateConnecting, StateSynSent, StateSynRecv:
-		// Ready for nothing.
+		// Ready for nothing, except for the first write if the SYN is
+		// deferred until then.
+		if e.fastOpenDeferred.Load() {
+			result |= mask & waiter.WritableEvents
+		}
 
 	case StateClose, StateError, StateTimeWait:
 		// Ready for anything.
@@ -1178,11 +1231,16 @@ func (e *Endpoint) closePendingAcceptableConnectionsLocked() {
 // cleanupLocked frees all resources associated with the endpoint.
 // +checklocks:e.mu
 func (e *Endpoint) cleanupLocked() {
+	if e.h != nil {
+		e.h.releaseFastOpen()
+	}
+
 	if e.snd != nil {
 		e.snd.resendTimer.cleanup()
 		e.snd.probeTimer.cleanup()
 		e.snd.reorderTimer.cleanup()
 		e.snd.corkTimer.cleanup()
+		e.snd.pacingTimer.cleanup()
 	}
 
 	if e.finWait2Timer != nil {
@@ -1193,6 +1251,10 @@ func (e *Endpoint) cleanupLocked() {
 		e.timeWaitTimer.Stop()
 	}
 
+	if e.mp != nil {
+		e.protocol.releaseMPTCPToken(e.mp)
+	}
+
 	// Close all endpoints that might have been accepted by TCP but not by
 	// the client.
 	e.closePendingAcceptableConnectionsLocked()
@@ -1250,7 +1312,7 @@ func (e *Endpoint) initialReceiveWindow() int {
 	}
 
 	// Use the user supplied MSS, if available.
-	routeWnd := InitialCwnd * int(calculateAdvertisedMSS(e.userMSS, e.route)) * 2
+	routeWnd := InitialCwnd * int(calculateAdvertisedMSS(e.userMSS, e.protocol.routeMTU(e.route))) * 2
 	if rcvWnd > routeWnd {
 		rcvWnd = routeWnd
 	}
@@ -1579,6 +1641,10 @@ func (e *Endpoint) readFromPayloader(p tcpip.Payloader, opts tcpip.WriteOptions,
 	if avail == 0 {
 		return payload, nil
 	}
+	// Take the payloader's buffer as-is when possible to avoid a copy.
+	if bp, ok := p.(tcpip.BufferPayloader); ok {
+		return bp.ReadBuffer(int64(avail)), nil
+	}
 	if _, err := payload.WriteFromReaderAndLimitedReader(p, int64(avail), limRdr); err != nil {
 		payload.Release()
 		return buffer.Buffer{}, &tcpip.ErrBadBuffer{}
@@ -1645,6 +1711,10 @@ func (e *Endpoint) Write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, tcp
 	e.LockUser()
 	defer e.UnlockUser()
 
+	if e.fastOpenDeferred.Load() && e.EndpointState() == StateSynSent {
+		return e.fastOpenWriteLocked(p, opts)
+	}
+
 	// Return if either we didn't queue anything or if an error occurred while
 	// attempting to queue data.
 	nextSeg, n, err := e.queueSegment(p, opts)
@@ -1743,6 +1813,18 @@ func (e *Endpoint) OnReusePortSet(v bool) {
 	e.UnlockUser()
 }
 
+// OnReusePortFilterSet implements
+// tcpip.SocketOptionsHandler.OnReusePortFilterSet.
+func (e *Endpoint) OnReusePortFilterSet(f tcpip.ReusePortFilter) {
+	e.LockUser()
+	defer e.UnlockUser()
+	// Only listening endpoints are registered in a reuseport group. A filter
+	// set before listen(2) is applied when the endpoint starts listening.
+	if e.EndpointState() == StateListen {
+		e.stack.SetReusePortFilter(e.effectiveNetProtos, ProtocolNumber, e.TransportEndpointInfo.ID, e, e.boundBindToDevice, f)
+	}
+}
+
 // OnKeepAliveSet implements tcpip.SocketOptionsHandler.OnKeepAliveSet.
 func (e *Endpoint) OnKeepAliveSet(bool) {
 	e.LockUser()
@@ -1913,6 +1995,28 @@ func (e *Endpoint) SetSockOptInt(opt tcpip.SockOptInt, v int) tcpip.Error {
 		e.maxSynRetries = uint8(v)
 		e.UnlockUser()
 
+	case tcpip.TCPFastOpenOption:
+		if v < 0 {
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+		e.LockUser()
+		e.fastOpenQLen = v
+		e.UnlockUser()
+
+	case tcpip.TCPFastOpenConnectOption:
+		if v != 0 && v != 1 {
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+		e.LockUser()
+		defer e.UnlockUser()
+		switch e.EndpointState() {
+		case StateInitial, StateBound, StateListen:
+			e.fastOpenConnect = v != 0
+		default:
+			// Linux only allows changing the option before connecting.
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+
 	case tcpip.TCPWindowClampOption:
 		if v == 0 {
 			e.LockUser()
@@ -2114,6 +2218,21 @@ func (e *Endpoint) GetSockOptInt(opt tcpip.SockOptInt) (int, tcpip.Error) {
 		e.UnlockUser()
 		return v, nil
 
+	case tcpip.TCPFastOpenOption:
+		e.LockUser()
+		v := e.fastOpenQLen
+		e.UnlockUser()
+		return v, nil
+
+	case tcpip.TCPFastOpenConnectOption:
+		e.LockUser()
+		v := 0
+		if e.fastOpenConnect {
+			v = 1
+		}
+		e.UnlockUser()
+		return v, nil
+
 	case tcpip.TCPWindowClampOption:
 		e.LockUser()
 		v := int(e.windowClamp)
@@ -2123,11 +2242,34 @@ func (e *Endpoint) GetSockOptInt(opt tcpip.SockOptInt) (int, tcpip.Error) {
 	case tcpip.MulticastTTLOption:
 		return 1, nil
 
+	case tcpip.FlowHashOption:
+		e.LockUser()
+		id := e.TransportEndpointInfo.ID
+		e.UnlockUser()
+		if id.RemotePort == 0 {
+			return -1, &tcpip.ErrNotConnected{}
+		}
+		return int(e.stack.FlowHash(id)), nil
+
 	default:
 		return -1, &tcpip.ErrUnknownProtocolOption{}
 	}
 }
 
+// listenQueueLocked returns the queue lengths of a listening endpoint.
+//
+// +checklocks:e.mu
+func (e *Endpoint) listenQueueLocked() tcpip.TCPListenQueueOption {
+	e.acceptMu.Lock()
+	defer e.acceptMu.Unlock()
+	return tcpip.TCPListenQueueOption{
+		SynBacklog:  len(e.acceptQueue.pendingEndpoints),
+		AcceptQueue: e.acceptQueue.endpoints.Len(),
+		// The accept queue holds one more endpoint than the backlog.
+		Backlog: max(e.acceptQueue.capacity-1, 0),
+	}
+}
+
 func (e *Endpoint) getTCPInfo() tcpip.TCPInfoOption {
 	info := tcpip.TCPInfoOption{}
 	e.LockUser()
@@ -2136,6 +2278,14 @@ func (e *Endpoint) getTCPInfo() tcpip.TCPInfoOption {
 	} else {
 		info.State = tcpip.EndpointState(state)
 	}
+	if info.State == tcpip.EndpointState(StateListen) {
+		// Like Linux, report the accept queue length and the backlog of
+		// listening endpoints in place of the unacked and sacked
+		// segments. See net/ipv4/tcp.c:tcp_get_info().
+		q := e.listenQueueLocked()
+		info.Unacked = uint32(q.AcceptQueue)
+		info.Sacked = uint32(q.Backlog)
+	}
 	snd := e.snd
 	if snd != nil {
 		// We do not calculate RTT before sending the data packets. If
@@ -2151,7 +2301,42 @@ func (e *Endpoint) getTCPInfo() tcpip.TCPInfoOption {
 		info.SndSsthresh = uint32(snd.Ssthresh)
 		info.SndCwnd = uint32(snd.SndCwnd)
 		info.ReorderSeen = snd.rc.Reord
+
+		now := e.stack.Clock().NowMonotonic()
+		info.SndWndScale = snd.SndWndScale
+		info.SndMSS = uint32(snd.MaxPayloadSize)
+		info.Unacked = uint32(max(snd.Outstanding, 0))
+		info.Sacked = uint32(max(snd.SackedOut, 0))
+		info.MinRTT = snd.minRTT
+		if snd.LastSendTime != (tcpip.MonotonicTime{}) {
+			info.LastDataSent = now.Sub(snd.LastSendTime)
+		}
+		info.PacingRate = snd.pacingRate
+		info.DeliveryRate = snd.rs.deliveryRate
+		info.DeliveryRateAppLimited = snd.rs.deliveryRateAppLimited
+		info.BytesSent = snd.bytesSent
+		info.BytesRetrans = snd.bytesRetrans
+		info.BytesAcked = snd.bytesAcked
+		info.DataSegsOut = snd.dataSegsOut
+
+		e.sndQueueInfo.sndQueueMu.Lock()
+		if notSent := e.sndQueueInfo.SndBufUsed - int(snd.SndUna.Size(snd.SndNxt)); notSent > 0 {
+			info.NotSentBytes = uint32(notSent)
+		}
+		e.sndQueueInfo.sndQueueMu.Unlock()
 	}
+	if rcv := e.rcv; rcv != nil {
+		info.RcvWndScale = rcv.RcvWndScale
+		info.LastAckRecv = e.stack.Clock().NowMonotonic().Sub(rcv.lastRcvdAckTime)
+		info.BytesReceived = rcv.bytesReceived
+		info.DataSegsIn = rcv.dataSegsIn
+	}
+	info.TimestampsEnabled = e.SendTSOk
+	info.SACKPermitted = e.SACKPermitted
+	info.AdvMSS = uint32(e.amss)
+	info.TotalRetrans = uint32(e.stats.SendErrors.Retransmits.Value())
+	info.SegsOut = uint32(e.stats.SegmentsSent.Value())
+	info.SegsIn = uint32(e.stats.SegmentsReceived.Value())
 	e.UnlockUser()
 	return info
 }
@@ -2192,6 +2377,14 @@ func (e *Endpoint) GetSockOpt(opt tcpip.GettableSocketOption) tcpip.Error {
 		*o = tcpip.TCPDeferAcceptOption(e.deferAccept)
 		e.UnlockUser()
 
+	case *tcpip.TCPListenQueueOption:
+		e.LockUser()
+		defer e.UnlockUser()
+		if e.EndpointState() != StateListen {
+			return &tcpip.ErrNotSupported{}
+		}
+		*o = e.listenQueueLocked()
+
 	case *tcpip.OriginalDestinationOption:
 		e.LockUser()
 		ipt := e.stack.IPTables()
@@ -2434,7 +2627,7 @@ func (e *Endpoint) connect(addr tcpip.FullAddress, handshake bool) tcpip.Error {
 	}
 
 	// Find a route to the desired destination.
-	r, err := e.stack.FindRoute(nicID, e.TransportEndpointInfo.ID.LocalAddress, addr.Addr, netProto, false /* multicastLoop */)
+	r, err := e.findRoute(nicID, e.TransportEndpointInfo.ID.LocalAddress, addr.Addr, netProto)
 	if err != nil {
 		return err
 	}
@@ -2473,7 +2666,7 @@ func (e *Endpoint) connect(addr tcpip.FullAddress, handshake bool) tcpip.Error {
 			}
 		}
 		e.segmentQueue.mu.Unlock()
-		e.snd.updateMaxPayloadSize(int(e.route.MTU()), 0)
+		e.snd.updateMaxPayloadSize(int(e.protocol.routeMTU(e.route)), 0)
 		e.setEndpointState(StateEstablished)
 		// Set the new auto tuned send buffer size after entering
 		// established state.
@@ -2484,6 +2677,15 @@ func (e *Endpoint) connect(addr tcpip.FullAddress, handshake bool) tcpip.Error {
 	// Start a new handshake.
 	h := e.newHandshake()
 	e.setEndpointState(StateSynSent)
+	if e.fastOpenConnect && e.mp == nil {
+		// Defer the SYN until the first write so that it can carry
+		// data. As on Linux, the connection is reported as established
+		// in the meantime.
+		h.fastOpen = true
+		h.retransmitTimer.stop()
+		e.fastOpenDeferred.Store(true)
+		return nil
+	}
 	h.start()
 	e.stack.Stats().TCP.ActiveConnectionOpenings.Increment()
 
@@ -2664,6 +2866,9 @@ func (e *Endpoint) listen(backlog int) tcpip.Error {
 	}
 
 	e.isRegistered = true
+	if f := e.ops.GetReusePortFilter(); f != nil {
+		e.stack.SetReusePortFilter(e.effectiveNetProtos, ProtocolNumber, e.TransportEndpointInfo.ID, e, e.boundBindToDevice, f)
+	}
 
 	// The queue may be non-zero when we're restoring the endpoint, and it
 	// may be pre-populated with some previously accepted (but not Accepted)
@@ -2758,7 +2963,11 @@ func (e *Endpoint) bindLocked(addr tcpip.FullAddress) (err tcpip.Error) {
 	if addr.Addr.Len() != 0 {
 		nic = e.stack.CheckLocalAddress(addr.NIC, netProto, addr.Addr)
 		if nic == 0 {
-			return &tcpip.ErrBadLocalAddress{}
+			// Transparent endpoints may bind to non-local addresses.
+			if !e.ops.GetTransparent() {
+				return &tcpip.ErrBadLocalAddress{}
+			}
+			nic = addr.NIC
 		}
 		e.TransportEndpointInfo.ID.LocalAddress = addr.Addr
 	}
@@ -2840,6 +3049,15 @@ func (e *Endpoint) getRemoteAddress() tcpip.FullAddress {
 	}
 }
 
+// findRoute returns a route from localAddr to remoteAddr. If the endpoint is
+// transparent, localAddr doesn't need to be a local address.
+func (e *Endpoint) findRoute(nicID tcpip.NICID, localAddr, remoteAddr tcpip.Address, netProto tcpip.NetworkProtocolNumber) (*stack.Route, tcpip.Error) {
+	if e.ops.GetTransparent() {
+		return e.stack.FindTransparentRoute(nicID, localAddr, remoteAddr, netProto, false /* multicastLoop */)
+	}
+	return e.stack.FindRoute(nicID, localAddr, remoteAddr, netProto, false /* multicastLoop */)
+}
+
 // HandlePacket implements stack.TransportEndpoint.HandlePacket.
 func (*Endpoint) HandlePacket(stack.TransportEndpointID, *stack.PacketBuffer) {
 	// TCP HandlePacket is not required anymore as inbound packets first
@@ -2916,7 +3134,7 @@ func (e *Endpoint) onICMPError(err tcpip.Error, transErr stack.TransportError, p
 }
 
 // HandleError implements stack.TransportEndpoint.
-func (e *Endpoint) HandleError(transErr stack.TransportError, pkt *stack.PacketBuffer) {
+func (e *Endpoint) HandleError(_ stack.TransportEndpointID, transErr stack.TransportError, pkt *stack.PacketBuffer) {
 	handlePacketTooBig := func(mtu uint32) {
 		e.sndQueueInfo.sndQueueMu.Lock()
 		update := false
@@ -3131,7 +3349,12 @@ func (e *Endpoint) maybeEnableSACKPermitted(synOpts header.TCPSynOptions) {
 // maxOptionSize return the maximum size of TCP options.
 func (e *Endpoint) maxOptionSize() (size int) {
 	var maxSackBlocks [header.TCPMaxSACKBlocks]header.SACKBlock
-	options := e.makeOptions(maxSackBlocks[:])
+	var mptcpOpt []byte
+	if e.mp != nil {
+		var maxMPTCPOpt [mptcpMaxOptionSize]byte
+		mptcpOpt = maxMPTCPOpt[:]
+	}
+	options := e.makeOptions(maxSackBlocks[:], mptcpOpt)
 	size = len(options)
 	putOptions(options)
 
@@ -3198,6 +3421,16 @@ func (e *Endpoint) initHostGSO() {
 }
 
 func (e *Endpoint) initGSO() {
+	// The MPTCP options differ from segment to segment, which GSO can't
+	// replicate.
+	if e.mp != nil {
+		return
+	}
+	// Segments that never leave the stack are already as large as GSO
+	// would make them.
+	if e.protocol.useLoopbackFastPath(e.route) {
+		return
+	}
 	if e.route.HasHostGSOCapability() {
 		e.initHostGSO()
 	} else if e.route.HasGVisorGSOCapability() {
@@ -148,6 +148,7 @@ func (e *Endpoint) Restore(s *stack.Stack) {
 		snd.reorderTimer.init(s.Clock(), timerHandler(e, e.snd.rc.reorderTimerExpired))
 		snd.probeTimer.init(s.Clock(), timerHandler(e, e.snd.probeTimerExpired))
 		snd.corkTimer.init(s.Clock(), timerHandler(e, e.snd.corkTimerExpired))
+		snd.pacingTimer.init(s.Clock(), timerHandler(e, e.snd.pacingTimerExpired))
 	}
 	saveRestoreEnabled := e.stack.IsSaveRestoreEnabled()
 	if !saveRestoreEnabled {
@@ -291,7 +292,7 @@ func (e *Endpoint) Restore(s *stack.Stack) {
 			e.mu.Lock()
 			defer e.mu.Unlock()
 			e.setEndpointState(epState)
-			r, err := e.stack.FindRoute(e.boundNICID, e.TransportEndpointInfo.ID.LocalAddress, e.TransportEndpointInfo.ID.RemoteAddress, e.effectiveNetProtos[0], false /* multicastLoop */)
+			r, err := e.findRoute(e.boundNICID, e.TransportEndpointInfo.ID.LocalAddress, e.TransportEndpointInfo.ID.RemoteAddress, e.effectiveNetProtos[0])
 			if err != nil {
 				panic(fmt.Sprintf("FindRoute failed when restoring endpoint w/ ID: %+v", e.ID))
 			}
@@ -0,0 +1,220 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+
+	"github.com/wilinz/gvisor/pkg/buffer"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/header"
+	"github.com/wilinz/gvisor/pkg/tcpip/seqnum"
+)
+
+const (
+	// fastOpenCookieLen is the length of the TCP Fast Open cookies issued
+	// by listening endpoints. This matches Linux.
+	fastOpenCookieLen = 8
+
+	// maxFastOpenCookies is the maximum number of TCP Fast Open cookies
+	// cached for active opens.
+	maxFastOpenCookies = 1024
+
+	// maxFastOpenSynData is the maximum amount of data sent in a SYN. The
+	// peer's MSS is not known yet, so use the default MSS which all peers
+	// must accept (RFC 1122, page 85).
+	maxFastOpenSynData = header.TCPDefaultMSS
+)
+
+// fastOpenCookie returns the TCP Fast Open cookie issued to remote by local.
+//
+// As on Linux, the cookie only depends on the addresses, so that it stays
+// valid across listening endpoints.
+func (p *protocol) fastOpenCookie(local, remote tcpip.Address) []byte {
+	h := sha256.New()
+
+	// Per hash.Hash.Writer:
+	//
+	// It never returns an error.
+	_, _ = h.Write(p.fastOpenSecret[:])
+	_, _ = h.Write(local.AsSlice())
+	_, _ = h.Write(remote.AsSlice())
+	return h.Sum(nil)[:fastOpenCookieLen]
+}
+
+// cachedFastOpenCookie returns the TCP Fast Open cookie issued by remote, or
+// nil if there is none.
+func (p *protocol) cachedFastOpenCookie(remote tcpip.Address) []byte {
+	p.fastOpenMu.Lock()
+	defer p.fastOpenMu.Unlock()
+	return p.fastOpenCookies[remote]
+}
+
+// cacheFastOpenCookie records the TCP Fast Open cookie issued by remote.
+func (p *protocol) cacheFastOpenCookie(remote tcpip.Address, cookie []byte) {
+	p.fastOpenMu.Lock()
+	defer p.fastOpenMu.Unlock()
+	if p.fastOpenCookies == nil {
+		p.fastOpenCookies = make(map[tcpip.Address][]byte)
+	}
+	if _, ok := p.fastOpenCookies[remote]; !ok && len(p.fastOpenCookies) >= maxFastOpenCookies {
+		// Evict an arbitrary cookie; the peer will issue it again on
+		// the next connection.
+		for addr := range p.fastOpenCookies {
+			delete(p.fastOpenCookies, addr)
+			break
+		}
+	}
+	p.fastOpenCookies[remote] = cookie
+}
+
+// fastOpenResult is the outcome of processing the TCP Fast Open option of a
+// SYN received by a listening endpoint.
+type fastOpenResult struct {
+	// cookie, if not nil, is sent to the peer in the SYN-ACK.
+	cookie []byte
+
+	// acceptData is true if the data carried by the SYN is accepted.
+	acceptData bool
+}
+
+// fastOpenSynLocked processes the TCP Fast Open option of a SYN received by a
+// listening endpoint, as per RFC 7413 section 4.2.2.
+//
+// +checklocks:e.mu
+// +checklocks:e.acceptMu
+func (e *Endpoint) fastOpenSynLocked(s *segment, opts header.TCPSynOptions) fastOpenResult {
+	if e.fastOpenQLen == 0 || e.mp != nil || !opts.FastOpen {
+		return fastOpenResult{}
+	}
+	cookie := e.protocol.fastOpenCookie(s.id.LocalAddress, s.id.RemoteAddress)
+	if subtle.ConstantTimeCompare(opts.FastOpenCookie, cookie) != 1 {
+		// Either the peer requested a cookie or its cookie is invalid:
+		// issue a valid one and fall back to the 3-way handshake.
+		return fastOpenResult{cookie: cookie}
+	}
+	if s.payloadSize() == 0 {
+		return fastOpenResult{}
+	}
+
+	// Limit the number of connections whose SYN data was accepted but which
+	// haven't completed the handshake yet, as per RFC 7413 section 5.1.
+	pending := 0
+	for n := range e.acceptQueue.pendingEndpoints {
+		if n.fastOpenPassive {
+			pending++
+		}
+	}
+	if pending >= e.fastOpenQLen {
+		return fastOpenResult{}
+	}
+	return fastOpenResult{acceptData: true}
+}
+
+// acceptFastOpenDataLocked accepts the data carried by the SYN s, which is
+// acknowledged by the SYN-ACK and made readable once the handshake completes.
+//
+// +checklocks:h.ep.mu
+func (h *handshake) acceptFastOpenDataLocked(s *segment) {
+	// Account for the data in the new endpoint's receive buffer rather
+	// than the listener's.
+	h.fastOpenSeg = s.clone()
+	h.fastOpenSeg.setOwner(h.ep, recvQ)
+	h.ackNum = h.ackNum.Add(seqnum.Size(s.payloadSize()))
+	h.ep.fastOpenPassive = true
+}
+
+// deliverFastOpenDataLocked makes the data accepted from the peer's SYN
+// readable.
+//
+// +checklocks:h.ep.mu
+func (h *handshake) deliverFastOpenDataLocked() {
+	if h.fastOpenSeg == nil {
+		return
+	}
+	h.ep.readyToRead(h.fastOpenSeg)
+	h.fastOpenSeg.DecRef()
+	h.fastOpenSeg = nil
+}
+
+// fastOpenSynAckLocked processes the TCP Fast Open option of the SYN-ACK s
+// received in response to a SYN which carried the option.
+//
+// +checklocks:h.ep.mu
+func (h *handshake) fastOpenSynAckLocked(s *segment, opts header.TCPSynOptions) {
+	if len(opts.FastOpenCookie) != 0 {
+		h.ep.protocol.cacheFastOpenCookie(h.ep.TransportEndpointInfo.ID.RemoteAddress, opts.FastOpenCookie)
+	}
+	// The peer may acknowledge all, some or none of the SYN data.
+	h.fastOpenAcked = (h.iss + 1).Size(s.ackNumber)
+}
+
+// sendFastOpenDataLocked queues and sends the data written before the
+// handshake completed that wasn't acknowledged with the SYN.
+//
+// +checklocks:h.ep.mu
+// +checklocksalias:h.ep.snd.ep.mu=h.ep.mu
+func (h *handshake) sendFastOpenDataLocked() {
+	data := h.fastOpenData
+	h.fastOpenData = buffer.Buffer{}
+	data.TrimFront(int64(h.fastOpenAcked))
+	if data.Size() == 0 {
+		data.Release()
+		return
+	}
+
+	e := h.ep
+	e.sndQueueInfo.sndQueueMu.Lock()
+	s := newOutgoingSegment(e.TransportEndpointInfo.ID, e.stack.Clock(), data)
+	e.sndQueueInfo.SndBufUsed += int(data.Size())
+	e.snd.writeList.PushBack(s)
+	e.sndQueueInfo.sndQueueMu.Unlock()
+	e.sendData(s)
+}
+
+// releaseFastOpen releases the TCP Fast Open data held by h, if any.
+func (h *handshake) releaseFastOpen() {
+	h.fastOpenData.Release()
+	if h.fastOpenSeg != nil {
+		h.fastOpenSeg.DecRef()
+		h.fastOpenSeg = nil
+	}
+}
+
+// fastOpenWriteLocked sends the SYN deferred by TCP_FASTOPEN_CONNECT, with the
+// first write's data if a cookie was cached for the peer. Data in excess of
+// what fits in the SYN must be written again once connected.
+//
+// +checklocks:e.mu
+func (e *Endpoint) fastOpenWriteLocked(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, tcpip.Error) {
+	// The SYN data is small enough to be copied with the locks held.
+	opts.Atomic = true
+	e.sndQueueInfo.sndQueueMu.Lock()
+	data, err := e.readFromPayloader(p, opts, maxFastOpenSynData)
+	e.sndQueueInfo.sndQueueMu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	e.fastOpenDeferred.Store(false)
+	n := data.Size()
+	h := e.h
+	h.fastOpenData = data
+	h.retransmitTimer.reinit(InitialRTO)
+	h.start()
+	e.stack.Stats().TCP.ActiveConnectionOpenings.Increment()
+	return n, nil
+}
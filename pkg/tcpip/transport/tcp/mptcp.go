@@ -0,0 +1,709 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"sort"
+
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/header"
+	"github.com/wilinz/gvisor/pkg/tcpip/seqnum"
+	"github.com/wilinz/gvisor/pkg/tcpip/stack"
+	"github.com/wilinz/gvisor/pkg/waiter"
+)
+
+// mptcpMaxOptionSize is the space reserved in every segment of a Multipath
+// TCP subflow for the MPTCP option: an MP_CAPABLE option carrying data,
+// padded to a multiple of 4 bytes.
+const mptcpMaxOptionSize = header.MPTCPCapableDataLength + 2
+
+// MPTCPConn is a Multipath TCP (RFC 8684) connection, as seen by its
+// subflows.
+//
+// Its methods are called while the calling subflow's mutex is held, and so
+// must not lock any subflow.
+type MPTCPConn interface {
+	// DataAck returns the data sequence number of the next byte expected
+	// from the peer.
+	DataAck() uint64
+
+	// HandleDataAck processes a Data ACK received on one of the subflows.
+	// ack is the data sequence number of the next byte expected by the
+	// peer.
+	HandleDataAck(ack uint64)
+
+	// JoinSubflow adds ep, a passively opened subflow whose MP_JOIN
+	// handshake has completed, to the connection. wq is the waiter queue
+	// of ep. It returns false if the connection doesn't accept new
+	// subflows, in which case ep is reset.
+	JoinSubflow(ep *Endpoint, wq *waiter.Queue) bool
+}
+
+// mptcpState is the Multipath TCP state of a subflow.
+type mptcpState uint8
+
+const (
+	// mptcpListen is the state of listening endpoints.
+	mptcpListen mptcpState = iota
+
+	// mptcpCapableSent is the state of an active initial subflow which has
+	// sent an MP_CAPABLE SYN.
+	mptcpCapableSent
+
+	// mptcpCapableRcvd is the state of a passive initial subflow which has
+	// received an MP_CAPABLE SYN.
+	mptcpCapableRcvd
+
+	// mptcpJoinRcvd is the state of a passive subflow which has received an
+	// MP_JOIN SYN.
+	mptcpJoinRcvd
+
+	// mptcpEstablished is the state of subflows which have completed the
+	// MP_CAPABLE or MP_JOIN handshake.
+	mptcpEstablished
+
+	// mptcpFallback is the state of subflows which fell back to regular
+	// TCP, because the peer doesn't support MPTCP or a middlebox interfered
+	// with the options.
+	mptcpFallback
+)
+
+// mptcpMapping maps a range of subflow sequence numbers to data sequence
+// numbers.
+type mptcpMapping struct {
+	// ssn is the first subflow sequence number of the mapping, relative to
+	// the subflow's initial sequence number.
+	ssn seqnum.Value
+
+	// dsn is the data sequence number of ssn.
+	dsn uint64
+
+	// len is the number of bytes covered by the mapping.
+	len seqnum.Size
+}
+
+// end returns the subflow sequence number following the mapping.
+func (m mptcpMapping) end() seqnum.Value {
+	return m.ssn.Add(m.len)
+}
+
+// mptcpSubflow holds the Multipath TCP state of an endpoint.
+type mptcpSubflow struct {
+	// conn is the connection the subflow belongs to. It is nil for
+	// listening endpoints, passive initial subflows which have not been
+	// accepted yet, and joining subflows whose token is unknown.
+	conn MPTCPConn
+
+	state mptcpState
+
+	// initiator is true if the subflow is an active initial subflow.
+	initiator bool
+
+	// join is true if the subflow was added with MP_JOIN.
+	join bool
+
+	// localKey and remoteKey are the keys of the connection.
+	localKey  uint64
+	remoteKey uint64
+
+	// localNonce and remoteNonce are the random numbers exchanged in the
+	// MP_JOIN handshake.
+	localNonce  uint32
+	remoteNonce uint32
+
+	// token is the local token of the connection, derived from localKey.
+	token uint32
+
+	// tokenRegistered is true if token is registered with the protocol so
+	// that other subflows can join the connection.
+	tokenRegistered bool
+
+	// localIDSN and remoteIDSN are the initial data sequence numbers of
+	// both directions, derived from the keys.
+	localIDSN  uint64
+	remoteIDSN uint64
+
+	// iss and irs are the initial sequence numbers of the subflow.
+	iss seqnum.Value
+	irs seqnum.Value
+
+	// dssSeen is true once a DSS option has been received on the subflow,
+	// which confirms that the peer has established the connection.
+	dssSeen bool
+
+	// sndMapped is true once the data sequence numbers of the data sent on
+	// the subflow are known. Data sent from then on is mapped linearly from
+	// sndMapSSN to sndMapDSN.
+	sndMapped bool
+	sndMapSSN seqnum.Value
+	sndMapDSN uint64
+
+	// sndDataAck is the latest Data ACK received on the subflow.
+	sndDataAck uint64
+
+	// sndDataFin is true if the FIN of the subflow carries a DATA_FIN with
+	// data sequence number sndDataFinDSN.
+	sndDataFin    bool
+	sndDataFinDSN uint64
+
+	// rcvMappings are the mappings of the received data which has not been
+	// consumed yet, sorted by subflow sequence number.
+	rcvMappings []mptcpMapping
+
+	// rcvMapped is true once a mapping has been received.
+	rcvMapped bool
+
+	// rcvDataFin is true if a DATA_FIN with data sequence number
+	// rcvDataFinDSN has been received.
+	rcvDataFin    bool
+	rcvDataFinDSN uint64
+}
+
+// establish moves m to the established state once the keys are known.
+func (m *mptcpSubflow) establish(iss, irs seqnum.Value) {
+	m.iss = iss
+	m.irs = irs
+	_, m.localIDSN = header.MPTCPKeyHash(m.localKey)
+	_, m.remoteIDSN = header.MPTCPKeyHash(m.remoteKey)
+	m.state = mptcpEstablished
+	if !m.join {
+		m.startSending(1, m.localIDSN+1)
+	}
+}
+
+// startSending maps the data sent on the subflow from the relative subflow
+// sequence number ssn onwards to the data sequence number dsn.
+func (m *mptcpSubflow) startSending(ssn seqnum.Value, dsn uint64) {
+	m.sndMapped = true
+	m.sndMapSSN = ssn
+	m.sndMapDSN = dsn
+	if m.sndDataAck < dsn {
+		m.sndDataAck = dsn
+	}
+}
+
+// addRcvMapping records a mapping received in a DSS option.
+func (m *mptcpSubflow) addRcvMapping(d header.DSSOption) {
+	ref := m.remoteIDSN + 1
+	if n := len(m.rcvMappings); n > 0 {
+		last := m.rcvMappings[n-1]
+		ref = last.dsn + uint64(last.len)
+	}
+	dsn := d.DSN
+	if !d.DSN64 {
+		dsn = header.ExpandMPTCPSeq(ref, uint32(dsn))
+	}
+	n := seqnum.Size(d.DataLen)
+	if d.DataFin && n > 0 {
+		// The DATA_FIN occupies the last data sequence number of the
+		// mapping.
+		m.rcvDataFin = true
+		m.rcvDataFinDSN = dsn + uint64(n) - 1
+		n--
+	}
+	if n == 0 || d.SSN == 0 {
+		return
+	}
+	m.addMapping(mptcpMapping{ssn: seqnum.Value(d.SSN), dsn: dsn, len: n})
+}
+
+// addMapping inserts mp in m.rcvMappings, ignoring mappings which were
+// already received.
+func (m *mptcpSubflow) addMapping(mp mptcpMapping) {
+	i := sort.Search(len(m.rcvMappings), func(i int) bool {
+		return mp.ssn.LessThan(m.rcvMappings[i].end())
+	})
+	if i < len(m.rcvMappings) && !mp.end().LessThanEq(m.rcvMappings[i].ssn) {
+		// The mapping overlaps with one we already have, which is
+		// the case of retransmitted segments.
+		return
+	}
+	if i > 0 {
+		if prev := &m.rcvMappings[i-1]; prev.end() == mp.ssn && prev.dsn+uint64(prev.len) == mp.dsn {
+			prev.len += mp.len
+			m.rcvMapped = true
+			return
+		}
+	}
+	m.rcvMapped = true
+	m.rcvMappings = append(m.rcvMappings, mptcpMapping{})
+	copy(m.rcvMappings[i+1:], m.rcvMappings[i:])
+	m.rcvMappings[i] = mp
+}
+
+// mptcpToken is an entry of the protocol's token table.
+type mptcpToken struct {
+	conn      MPTCPConn
+	localKey  uint64
+	remoteKey uint64
+}
+
+// newMPTCPKey returns a random key whose token is not in use.
+func (p *protocol) newMPTCPKey() (key uint64, token uint32) {
+	rng := p.stack.SecureRNG()
+	p.mptcpMu.Lock()
+	defer p.mptcpMu.Unlock()
+	for {
+		key = rng.Uint64()
+		token, _ = header.MPTCPKeyHash(key)
+		if _, ok := p.mptcpTokens[token]; !ok {
+			return key, token
+		}
+	}
+}
+
+// registerMPTCPToken registers the token of m's connection so that other
+// subflows can join it.
+func (p *protocol) registerMPTCPToken(m *mptcpSubflow) {
+	if m.conn == nil || m.join || m.tokenRegistered {
+		return
+	}
+	p.mptcpMu.Lock()
+	defer p.mptcpMu.Unlock()
+	if _, ok := p.mptcpTokens[m.token]; ok {
+		// Another connection picked the same key since m's was
+		// generated. Don't accept joins for either.
+		return
+	}
+	if p.mptcpTokens == nil {
+		p.mptcpTokens = make(map[uint32]mptcpToken)
+	}
+	p.mptcpTokens[m.token] = mptcpToken{
+		conn:      m.conn,
+		localKey:  m.localKey,
+		remoteKey: m.remoteKey,
+	}
+	m.tokenRegistered = true
+}
+
+// releaseMPTCPToken unregisters the token registered for m, if any.
+func (p *protocol) releaseMPTCPToken(m *mptcpSubflow) {
+	if !m.tokenRegistered {
+		return
+	}
+	p.mptcpMu.Lock()
+	delete(p.mptcpTokens, m.token)
+	p.mptcpMu.Unlock()
+	m.tokenRegistered = false
+}
+
+// lookupMPTCPToken returns the connection registered with token.
+func (p *protocol) lookupMPTCPToken(token uint32) (mptcpToken, bool) {
+	p.mptcpMu.Lock()
+	defer p.mptcpMu.Unlock()
+	t, ok := p.mptcpTokens[token]
+	return t, ok
+}
+
+// EnableMPTCP enables Multipath TCP on e, which must not be connected yet.
+//
+// If conn is nil, e is expected to become a listening endpoint: connections
+// it accepts negotiate MPTCP with peers that request it, and it accepts
+// subflows joining existing connections. Otherwise, e becomes the initial
+// subflow of conn and requests MPTCP when connecting.
+func (e *Endpoint) EnableMPTCP(conn MPTCPConn) tcpip.Error {
+	e.LockUser()
+	defer e.UnlockUser()
+
+	switch e.EndpointState() {
+	case StateInitial, StateBound:
+	default:
+		return &tcpip.ErrInvalidEndpointState{}
+	}
+	m := &mptcpSubflow{conn: conn}
+	if conn != nil {
+		m.state = mptcpCapableSent
+		m.initiator = true
+		m.localKey, m.token = e.protocol.newMPTCPKey()
+	}
+	e.mp = m
+	e.gso = stack.GSO{}
+	return nil
+}
+
+// SetMPTCPConn sets the connection of e, a passively opened initial subflow,
+// once it has been accepted.
+func (e *Endpoint) SetMPTCPConn(conn MPTCPConn) {
+	e.LockUser()
+	defer e.UnlockUser()
+
+	if e.mp == nil {
+		return
+	}
+	e.mp.conn = conn
+	if e.mp.state == mptcpEstablished {
+		e.protocol.registerMPTCPToken(e.mp)
+	}
+}
+
+// ReleaseMPTCPToken stops other subflows from joining the connection e
+// belongs to.
+func (e *Endpoint) ReleaseMPTCPToken() {
+	e.LockUser()
+	defer e.UnlockUser()
+
+	if e.mp != nil {
+		e.protocol.releaseMPTCPToken(e.mp)
+	}
+}
+
+// MPTCPSubflowInfo describes the Multipath TCP state of a subflow.
+type MPTCPSubflowInfo struct {
+	// Established is true if the subflow completed an MPTCP handshake.
+	Established bool
+
+	// Fallback is true if the subflow doesn't use MPTCP.
+	Fallback bool
+
+	// Token is the local token of the connection.
+	Token uint32
+
+	// LocalIDSN and RemoteIDSN are the initial data sequence numbers of
+	// the connection. They are valid if Established is true.
+	LocalIDSN  uint64
+	RemoteIDSN uint64
+}
+
+// MPTCPInfo returns the Multipath TCP state of e. A connected endpoint on
+// which MPTCP was not enabled is reported as having fallen back.
+func (e *Endpoint) MPTCPInfo() MPTCPSubflowInfo {
+	e.LockUser()
+	defer e.UnlockUser()
+
+	m := e.mp
+	if m == nil {
+		return MPTCPSubflowInfo{Fallback: true}
+	}
+	return MPTCPSubflowInfo{
+		Established: m.state == mptcpEstablished,
+		Fallback:    m.state == mptcpFallback,
+		Token:       m.token,
+		LocalIDSN:   m.localIDSN,
+		RemoteIDSN:  m.remoteIDSN,
+	}
+}
+
+// MPTCPMapping returns the data sequence number of the received byte with
+// relative subflow sequence number ssn, and how many bytes from ssn onwards
+// are mapped contiguously. Mappings for bytes before ssn are discarded, so
+// ssn must not decrease across calls.
+func (e *Endpoint) MPTCPMapping(ssn seqnum.Value) (dsn uint64, n seqnum.Size, ok bool) {
+	e.LockUser()
+	defer e.UnlockUser()
+
+	m := e.mp
+	if m == nil {
+		return 0, 0, false
+	}
+	i := 0
+	for i < len(m.rcvMappings) && m.rcvMappings[i].end().LessThanEq(ssn) {
+		i++
+	}
+	m.rcvMappings = m.rcvMappings[i:]
+	if len(m.rcvMappings) == 0 || ssn.LessThan(m.rcvMappings[0].ssn) {
+		return 0, 0, false
+	}
+	mp := m.rcvMappings[0]
+	off := mp.ssn.Size(ssn)
+	return mp.dsn + uint64(off), mp.len - off, true
+}
+
+// MPTCPDataFin returns the data sequence number of the DATA_FIN received on
+// e, if any.
+func (e *Endpoint) MPTCPDataFin() (dsn uint64, ok bool) {
+	e.LockUser()
+	defer e.UnlockUser()
+
+	if e.mp == nil || !e.mp.rcvDataFin {
+		return 0, false
+	}
+	return e.mp.rcvDataFinDSN, true
+}
+
+// MPTCPStartSending maps the data written to e from now on to data sequence
+// numbers starting at dsn. It must be called before writing to a joined
+// subflow, and only while e has no unsent data.
+func (e *Endpoint) MPTCPStartSending(dsn uint64) {
+	e.LockUser()
+	defer e.UnlockUser()
+
+	m := e.mp
+	if m == nil || m.state != mptcpEstablished {
+		return
+	}
+	m.startSending(seqnum.Value(m.iss.Size(e.snd.SndNxt)), dsn)
+}
+
+// MPTCPSendDataAck sends an ACK on e to let the peer know that the Data ACK
+// of the connection advanced.
+func (e *Endpoint) MPTCPSendDataAck() {
+	e.LockUser()
+	defer e.UnlockUser()
+
+	if e.mp != nil && e.mp.state == mptcpEstablished && e.EndpointState().connected() {
+		e.snd.sendAck()
+	}
+}
+
+// MPTCPSetDataFin makes the FIN of e carry a DATA_FIN with data sequence
+// number dsn.
+func (e *Endpoint) MPTCPSetDataFin(dsn uint64) {
+	e.LockUser()
+	defer e.UnlockUser()
+
+	if e.mp != nil {
+		e.mp.sndDataFin = true
+		e.mp.sndDataFinDSN = dsn
+	}
+}
+
+// mptcpSynOption encodes the MPTCP option of the SYN or SYN-ACK sent by e in
+// b and returns its length.
+//
+// +checklocks:e.mu
+func (e *Endpoint) mptcpSynOption(b []byte) int {
+	m := e.mp
+	switch m.state {
+	case mptcpCapableSent:
+		return header.EncodeMPCapableOption(header.MPCapableOption{
+			Length:  header.MPTCPCapableSynLength,
+			Version: header.MPTCPVersion,
+			Flags:   header.MPTCPCapableFlagHMACSHA256,
+		}, b)
+	case mptcpCapableRcvd:
+		return header.EncodeMPCapableOption(header.MPCapableOption{
+			Length:    header.MPTCPCapableSynAckLength,
+			Version:   header.MPTCPVersion,
+			Flags:     header.MPTCPCapableFlagHMACSHA256,
+			SenderKey: m.localKey,
+		}, b)
+	case mptcpJoinRcvd:
+		hmac := header.MPTCPJoinHMAC(m.localKey, m.remoteKey, m.localNonce, m.remoteNonce)
+		return header.EncodeMPJoinOption(header.MPJoinOption{
+			Length:        header.MPTCPJoinSynAckLength,
+			TruncatedHMAC: binary.BigEndian.Uint64(hmac[:]),
+			Nonce:         m.localNonce,
+		}, b)
+	}
+	return 0
+}
+
+// mptcpOption encodes the MPTCP option of a non-SYN segment sent by e in b
+// and returns its length.
+//
+// +checklocks:e.mu
+func (e *Endpoint) mptcpOption(b []byte, flags header.TCPFlags, seq seqnum.Value, payloadSize int) int {
+	m := e.mp
+	if m == nil || m.state != mptcpEstablished || flags&header.TCPFlagRst != 0 || flags&header.TCPFlagAck == 0 {
+		return 0
+	}
+
+	// The initiator repeats the keys until it knows that the peer has
+	// established the connection, including in the first data segment
+	// to cover for a lost third ACK. See RFC 8684 section 3.1.
+	if m.initiator && !m.dssSeen {
+		c := header.MPCapableOption{
+			Length:      header.MPTCPCapableAckLength,
+			Version:     header.MPTCPVersion,
+			Flags:       header.MPTCPCapableFlagHMACSHA256,
+			SenderKey:   m.localKey,
+			ReceiverKey: m.remoteKey,
+		}
+		switch {
+		case payloadSize == 0:
+			return header.EncodeMPCapableOption(c, b)
+		case seq == m.iss+1 && payloadSize <= 0xffff:
+			c.Length = header.MPTCPCapableDataLength
+			c.DataLen = uint16(payloadSize)
+			return header.EncodeMPCapableOption(c, b)
+		}
+	}
+
+	// The connection doesn't know the Data ACK until it has read from
+	// the subflow.
+	d := header.DSSOption{
+		HasAck: true,
+		Ack:    m.remoteIDSN + 1,
+	}
+	if m.conn != nil {
+		d.Ack = max(d.Ack, m.conn.DataAck())
+	}
+	if m.sndMapped && (payloadSize > 0 || flags&header.TCPFlagFin != 0 && m.sndDataFin) {
+		d.HasMapping = true
+		ssn := seqnum.Value(m.iss.Size(seq))
+		d.SSN = uint32(ssn)
+		d.DSN = m.sndMapDSN + uint64(m.sndMapSSN.Size(ssn))
+		d.DataLen = uint16(payloadSize)
+		if flags&header.TCPFlagFin != 0 && m.sndDataFin {
+			d.DataFin = true
+			if payloadSize == 0 {
+				// A DATA_FIN without data isn't mapped to the
+				// subflow sequence space.
+				d.SSN = 0
+				d.DSN = m.sndDataFinDSN
+			}
+			d.DataLen++
+		}
+	}
+	return header.EncodeDSSOption(d, b)
+}
+
+// mptcpHandleSynAck handles the MPTCP option of the SYN-ACK received by an
+// active subflow. iss and irs are the initial sequence numbers of the
+// subflow.
+//
+// +checklocks:e.mu
+func (e *Endpoint) mptcpHandleSynAck(s *segment, iss, irs seqnum.Value) {
+	m := e.mp
+	if m == nil || m.state != mptcpCapableSent {
+		return
+	}
+	opts := header.ParseMPTCPOptions(s.options)
+	c := opts.Capable
+	if !s.flags.Contains(header.TCPFlagAck) || !opts.HasCapable || c.Length != header.MPTCPCapableSynAckLength || c.Version != header.MPTCPVersion || c.Flags&header.MPTCPCapableFlagChecksum != 0 {
+		// The peer doesn't support MPTCP, requires DSS checksums
+		// which aren't supported, or this is a simultaneous open.
+		m.state = mptcpFallback
+		return
+	}
+	m.remoteKey = c.SenderKey
+	m.establish(iss, irs)
+	e.protocol.registerMPTCPToken(m)
+}
+
+// mptcpInitPassive initializes the MPTCP state of e, a passive endpoint
+// created by an MPTCP listener in response to the SYN s.
+//
+// +checklocks:e.mu
+func (e *Endpoint) mptcpInitPassive(s *segment) {
+	opts := header.ParseMPTCPOptions(s.options)
+	switch {
+	case opts.HasCapable:
+		c := opts.Capable
+		if c.Length != header.MPTCPCapableSynLength || c.Version != header.MPTCPVersion || c.Flags&header.MPTCPCapableFlagChecksum != 0 {
+			return
+		}
+		m := &mptcpSubflow{state: mptcpCapableRcvd}
+		m.localKey, m.token = e.protocol.newMPTCPKey()
+		e.mp = m
+	case opts.HasJoin:
+		if opts.Join.Length != header.MPTCPJoinSynLength {
+			return
+		}
+		rng := e.stack.SecureRNG()
+		m := &mptcpSubflow{
+			state:       mptcpJoinRcvd,
+			join:        true,
+			remoteNonce: opts.Join.Nonce,
+			localNonce:  rng.Uint32(),
+		}
+		// If the token is unknown, the handshake fails when the third
+		// ACK arrives.
+		if t, ok := e.protocol.lookupMPTCPToken(opts.Join.Token); ok {
+			m.conn = t.conn
+			m.localKey = t.localKey
+			m.remoteKey = t.remoteKey
+			m.token = opts.Join.Token
+		}
+		e.mp = m
+	default:
+		return
+	}
+	e.gso = stack.GSO{}
+}
+
+// mptcpHandleHandshakeAck handles the MPTCP option of the ACK completing the
+// handshake of a passive subflow. It returns false if the subflow must be
+// reset.
+//
+// +checklocks:e.mu
+func (e *Endpoint) mptcpHandleHandshakeAck(s *segment, iss, irs seqnum.Value) bool {
+	m := e.mp
+	if m == nil {
+		return true
+	}
+	opts := header.ParseMPTCPOptions(s.options)
+	switch m.state {
+	case mptcpCapableRcvd:
+		c := opts.Capable
+		if !opts.HasCapable || c.Length < header.MPTCPCapableAckLength || c.ReceiverKey != m.localKey {
+			// The options were stripped by a middlebox; fall back
+			// to regular TCP as per RFC 8684 section 3.7.
+			m.state = mptcpFallback
+			return true
+		}
+		m.remoteKey = c.SenderKey
+		m.establish(iss, irs)
+	case mptcpJoinRcvd:
+		if m.conn == nil || !opts.HasJoin || opts.Join.Length != header.MPTCPJoinAckLength {
+			return false
+		}
+		want := header.MPTCPJoinHMAC(m.remoteKey, m.localKey, m.remoteNonce, m.localNonce)
+		if subtle.ConstantTimeCompare(want[:header.MPTCPJoinHMACSize], opts.Join.HMAC[:]) != 1 {
+			return false
+		}
+		m.establish(iss, irs)
+	}
+	return true
+}
+
+// mptcpHandleSegment processes the MPTCP options of a segment received by a
+// connected subflow.
+//
+// +checklocks:e.mu
+func (e *Endpoint) mptcpHandleSegment(s *segment) {
+	m := e.mp
+	if m == nil || m.state != mptcpEstablished {
+		return
+	}
+	opts := header.ParseMPTCPOptions(s.options)
+	switch {
+	case opts.HasDSS:
+		m.dssSeen = true
+		d := opts.DSS
+		if d.HasAck && m.sndMapped {
+			ack := d.Ack
+			if !d.Ack64 {
+				ack = header.ExpandMPTCPSeq(m.sndDataAck, uint32(ack))
+			}
+			if ack > m.sndDataAck {
+				m.sndDataAck = ack
+				if m.conn != nil {
+					m.conn.HandleDataAck(ack)
+				}
+			}
+		}
+		if d.HasMapping {
+			m.addRcvMapping(d)
+		}
+
+	case opts.HasCapable:
+		// The first data segment of the initiator carries its mapping
+		// in the MP_CAPABLE option.
+		c := opts.Capable
+		if !m.join && !m.initiator && c.Length >= header.MPTCPCapableDataLength && s.sequenceNumber == m.irs+1 && s.payloadSize() > 0 {
+			m.addMapping(mptcpMapping{ssn: 1, dsn: m.remoteIDSN + 1, len: seqnum.Size(c.DataLen)})
+		}
+
+	case s.payloadSize() > 0 && !m.dssSeen && !m.rcvMapped && !m.join:
+		// Data without a mapping before any DSS was received means that
+		// a middlebox stripped the options. Fall back to regular TCP
+		// as per RFC 8684 section 3.7.
+		m.state = mptcpFallback
+		e.protocol.releaseMPTCPToken(m)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
+	"math"
 	"runtime"
 	"strings"
 	"time"
@@ -84,6 +85,7 @@ const (
 const (
 	ccReno  = "reno"
 	ccCubic = "cubic"
+	ccBBR   = "bbr"
 )
 
 // +stateify savable
@@ -94,12 +96,13 @@ type protocol struct {
 	sackEnabled                bool
 	recovery                   tcpip.TCPRecovery
 	delayEnabled               bool
-	alwaysUseSynCookies        bool
+	synCookies                 tcpip.TCPSynCookiesOption
 	sendBufferSize             tcpip.TCPSendBufferSizeRangeOption
 	recvBufferSize             tcpip.TCPReceiveBufferSizeRangeOption
 	congestionControl          string
 	availableCongestionControl []string
 	moderateReceiveBuffer      bool
+	loopbackFastPath           bool
 	lingerTimeout              time.Duration
 	timeWaitTimeout            time.Duration
 	timeWaitReuse              tcpip.TCPTimeWaitReuseOption
@@ -115,9 +118,28 @@ type protocol struct {
 	// This is immutable after creation.
 	probe TCPProbeFunc `state:"nosave"`
 
+	// mptcpMu protects mptcpTokens.
+	mptcpMu sync.Mutex `state:"nosave"`
+
+	// mptcpTokens maps the tokens of local Multipath TCP connections to
+	// the connections, for subflows joining them.
+	//
+	// +checklocks:mptcpMu
+	mptcpTokens map[uint32]mptcpToken `state:"nosave"`
+
+	// fastOpenMu protects fastOpenCookies.
+	fastOpenMu sync.Mutex `state:"nosave"`
+
+	// fastOpenCookies maps remote addresses to the TCP Fast Open cookies
+	// they issued, for use by active opens.
+	//
+	// +checklocks:fastOpenMu
+	fastOpenCookies map[tcpip.Address][]byte `state:"nosave"`
+
 	// The following secrets are initialized once and stay unchanged after.
 	seqnumSecret   [16]byte
 	tsOffsetSecret [16]byte
+	fastOpenSecret [16]byte
 }
 
 // Number returns the tcp protocol number.
@@ -314,6 +336,12 @@ func (p *protocol) SetOption(option tcpip.SettableTransportProtocolOption) tcpip
 		p.mu.Unlock()
 		return nil
 
+	case *tcpip.TCPLoopbackFastPathOption:
+		p.mu.Lock()
+		p.loopbackFastPath = bool(*v)
+		p.mu.Unlock()
+		return nil
+
 	case *tcpip.TCPLingerTimeoutOption:
 		p.mu.Lock()
 		if *v < 0 {
@@ -375,7 +403,22 @@ func (p *protocol) SetOption(option tcpip.SettableTransportProtocolOption) tcpip
 
 	case *tcpip.TCPAlwaysUseSynCookies:
 		p.mu.Lock()
-		p.alwaysUseSynCookies = bool(*v)
+		if *v {
+			p.synCookies = tcpip.TCPSynCookiesAlways
+		} else if p.synCookies == tcpip.TCPSynCookiesAlways {
+			p.synCookies = tcpip.TCPSynCookiesOnOverflow
+		}
+		p.mu.Unlock()
+		return nil
+
+	case *tcpip.TCPSynCookiesOption:
+		switch *v {
+		case tcpip.TCPSynCookiesNever, tcpip.TCPSynCookiesOnOverflow, tcpip.TCPSynCookiesAlways:
+		default:
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+		p.mu.Lock()
+		p.synCookies = *v
 		p.mu.Unlock()
 		return nil
 
@@ -444,6 +487,12 @@ func (p *protocol) Option(option tcpip.GettableTransportProtocolOption) tcpip.Er
 		p.mu.RUnlock()
 		return nil
 
+	case *tcpip.TCPLoopbackFastPathOption:
+		p.mu.RLock()
+		*v = tcpip.TCPLoopbackFastPathOption(p.loopbackFastPath)
+		p.mu.RUnlock()
+		return nil
+
 	case *tcpip.TCPLingerTimeoutOption:
 		p.mu.RLock()
 		*v = tcpip.TCPLingerTimeoutOption(p.lingerTimeout)
@@ -482,7 +531,13 @@ func (p *protocol) Option(option tcpip.GettableTransportProtocolOption) tcpip.Er
 
 	case *tcpip.TCPAlwaysUseSynCookies:
 		p.mu.RLock()
-		*v = tcpip.TCPAlwaysUseSynCookies(p.alwaysUseSynCookies)
+		*v = tcpip.TCPAlwaysUseSynCookies(p.synCookies == tcpip.TCPSynCookiesAlways)
+		p.mu.RUnlock()
+		return nil
+
+	case *tcpip.TCPSynCookiesOption:
+		p.mu.RLock()
+		*v = p.synCookies
 		p.mu.RUnlock()
 		return nil
 
@@ -504,6 +559,30 @@ func (p *protocol) SendBufferSize() tcpip.TCPSendBufferSizeRangeOption {
 	return p.sendBufferSize
 }
 
+// useLoopbackFastPath returns true if the loopback fast path applies to
+// connections over r, that is, if it is enabled and packets sent on r never
+// leave the stack. Routes over a loopback NIC are excluded as they already
+// have the NIC's MTU and no segmentation offload.
+func (p *protocol) useLoopbackFastPath(r *stack.Route) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.loopbackFastPath && r.Loop() == stack.PacketLoop
+}
+
+// routeMTU returns the MTU used to size the segments sent on r. With the
+// loopback fast path, it is the network MTU of a loopback interface with
+// Linux's default MTU of 64KiB, so that segments carry as much data as an IP
+// packet can.
+func (p *protocol) routeMTU(r *stack.Route) uint32 {
+	if !p.useLoopbackFastPath(r) {
+		return r.MTU()
+	}
+	if r.NetProto() == header.IPv6ProtocolNumber {
+		return header.IPv6MaximumPayloadSize
+	}
+	return math.MaxUint16 - header.IPv4MinimumSize
+}
+
 // Close implements stack.TransportProtocol.Close.
 func (p *protocol) Close() {
 	p.dispatcher.close()
@@ -563,12 +642,16 @@ func newProtocol(s *stack.Stack, cc string, probe TCPProbeFunc) stack.TransportP
 	rng := s.SecureRNG()
 	var seqnumSecret [16]byte
 	var tsOffsetSecret [16]byte
+	var fastOpenSecret [16]byte
 	if n, err := rng.Reader.Read(seqnumSecret[:]); err != nil || n != len(seqnumSecret) {
 		panic(fmt.Sprintf("Read() failed: %v", err))
 	}
 	if n, err := rng.Reader.Read(tsOffsetSecret[:]); err != nil || n != len(tsOffsetSecret) {
 		panic(fmt.Sprintf("Read() failed: %v", err))
 	}
+	if n, err := rng.Reader.Read(fastOpenSecret[:]); err != nil || n != len(fastOpenSecret) {
+		panic(fmt.Sprintf("Read() failed: %v", err))
+	}
 	p := protocol{
 		stack: s,
 		sendBufferSize: tcpip.TCPSendBufferSizeRangeOption{
@@ -582,8 +665,9 @@ func newProtocol(s *stack.Stack, cc string, probe TCPProbeFunc) stack.TransportP
 			Max:     MaxBufferSize,
 		},
 		sackEnabled:                true,
+		synCookies:                 tcpip.TCPSynCookiesOnOverflow,
 		congestionControl:          cc,
-		availableCongestionControl: []string{ccReno, ccCubic},
+		availableCongestionControl: []string{ccReno, ccCubic, ccBBR},
 		moderateReceiveBuffer:      true,
 		lingerTimeout:              DefaultTCPLingerTimeout,
 		timeWaitTimeout:            DefaultTCPTimeWaitTimeout,
@@ -595,6 +679,7 @@ func newProtocol(s *stack.Stack, cc string, probe TCPProbeFunc) stack.TransportP
 		recovery:                   tcpip.TCPRACKLossDetection,
 		seqnumSecret:               seqnumSecret,
 		tsOffsetSecret:             tsOffsetSecret,
+		fastOpenSecret:             fastOpenSecret,
 		probe:                      probe,
 	}
 	p.dispatcher.init(s.InsecureRNG(), runtime.GOMAXPROCS(0))
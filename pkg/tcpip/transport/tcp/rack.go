@@ -378,6 +378,7 @@ func (rc *rackControl) detectLoss(rcvTime tcpip.MonotonicTime) int {
 			timeRemaining := seg.xmitTime.Sub(rcvTime) + rc.RTT + rc.ReoWnd
 			if timeRemaining <= 0 {
 				seg.lost = true
+				rc.snd.rs.onLost(seg)
 				numLost++
 			} else if timeRemaining > timeout {
 				timeout = timeRemaining
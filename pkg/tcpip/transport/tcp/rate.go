@@ -0,0 +1,250 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp
+
+import (
+	"time"
+
+	"github.com/wilinz/gvisor/pkg/tcpip"
+)
+
+// txRateSnapshot is the connection delivery state recorded in a segment when
+// it is transmitted. It is used to compute a delivery rate sample when the
+// segment is later acknowledged.
+//
+// See: https://datatracker.ietf.org/doc/html/draft-cheng-iccrg-delivery-rate-estimation
+//
+// +stateify savable
+type txRateSnapshot struct {
+	// delivered is rateSampler.delivered at transmit time.
+	delivered uint64
+
+	// deliveredTime is rateSampler.deliveredTime at transmit time.
+	deliveredTime tcpip.MonotonicTime
+
+	// firstSentTime is rateSampler.firstSentTime at transmit time.
+	firstSentTime tcpip.MonotonicTime
+
+	// lost is rateSampler.lost at transmit time.
+	lost uint64
+
+	// inFlight is the number of bytes in flight, including this segment,
+	// right after it was transmitted.
+	inFlight uint64
+
+	// appLimited is true if the connection was application limited when
+	// the segment was transmitted.
+	appLimited bool
+}
+
+// rateSample is a delivery rate sample generated from a single ACK.
+//
+// +stateify savable
+type rateSample struct {
+	// priorDelivered is the value of rateSampler.delivered when the most
+	// recently transmitted segment acknowledged by this ACK was sent.
+	priorDelivered uint64
+
+	// priorTime is the value of rateSampler.deliveredTime when the most
+	// recently transmitted segment acknowledged by this ACK was sent. A zero
+	// value means the ACK did not acknowledge any segment that can be used
+	// for sampling.
+	priorTime tcpip.MonotonicTime
+
+	// priorLost is the value of rateSampler.lost when the most recently
+	// transmitted segment acknowledged by this ACK was sent.
+	priorLost uint64
+
+	// sendElapsed and ackElapsed are the send and ACK phases of the
+	// sampling interval.
+	sendElapsed time.Duration
+	ackElapsed  time.Duration
+
+	// interval is the length of the sampling interval, or negative if the
+	// sample is invalid.
+	interval time.Duration
+
+	// delivered is the number of bytes delivered over the interval.
+	delivered uint64
+
+	// lost is the number of bytes marked lost over the interval.
+	lost uint64
+
+	// deliveryRate is the delivery rate over the interval in bytes per
+	// second. It is zero if the sample is invalid.
+	deliveryRate uint64
+
+	// txInFlight is the number of bytes in flight when the most recently
+	// transmitted segment acknowledged by this ACK was sent.
+	txInFlight uint64
+
+	// newlyAcked is the number of bytes acknowledged (cumulatively or
+	// selectively) by this ACK.
+	newlyAcked uint64
+
+	// newlyLost is the number of bytes marked lost while processing this
+	// ACK.
+	newlyLost uint64
+
+	// rtt is the round-trip time of the most recently transmitted segment
+	// acknowledged by this ACK, or unknownRTT.
+	rtt time.Duration
+
+	// xmitTime is the transmit time of the segment the sample is taken
+	// from.
+	xmitTime tcpip.MonotonicTime
+
+	// isAppLimited is true if the sample was taken while the connection
+	// was application limited, and may thus underestimate the bandwidth.
+	isAppLimited bool
+}
+
+// rateSampler implements delivery rate estimation as described in
+// draft-cheng-iccrg-delivery-rate-estimation. All quantities are tracked in
+// bytes.
+//
+// +stateify savable
+type rateSampler struct {
+	// delivered is the total number of bytes delivered (cumulatively or
+	// selectively acknowledged) on the connection.
+	delivered uint64
+
+	// deliveredTime is the time at which delivered was last updated.
+	deliveredTime tcpip.MonotonicTime
+
+	// firstSentTime is the transmit time of the segment most recently
+	// marked as delivered, or the time the connection restarted from idle.
+	firstSentTime tcpip.MonotonicTime
+
+	// lost is the total number of bytes marked lost on the connection.
+	lost uint64
+
+	// appLimited is the value delivered must exceed for the connection to
+	// stop being considered application limited. Zero means the connection
+	// is not application limited.
+	appLimited uint64
+
+	// cwndLimited is true if the last attempt to send data stopped because
+	// the congestion window was full.
+	cwndLimited bool
+
+	// sample is the rate sample built for the ACK being processed.
+	sample rateSample
+
+	// deliveryRate is the delivery rate of the most recent valid sample, in
+	// bytes per second.
+	deliveryRate uint64
+
+	// deliveryRateAppLimited is true if the most recent valid sample was
+	// taken while the connection was application limited.
+	deliveryRateAppLimited bool
+}
+
+// onSent records the connection delivery state in seg as it is transmitted.
+// inFlight is the number of bytes in flight before seg was sent.
+func (r *rateSampler) onSent(seg *segment, now tcpip.MonotonicTime, inFlight uint64) {
+	if inFlight == 0 {
+		// Restarting from idle, the sampling interval starts now.
+		r.firstSentTime = now
+		r.deliveredTime = now
+	}
+	seg.txRate = txRateSnapshot{
+		delivered:     r.delivered,
+		deliveredTime: r.deliveredTime,
+		firstSentTime: r.firstSentTime,
+		lost:          r.lost,
+		inFlight:      inFlight + uint64(seg.payloadSize()),
+		appLimited:    r.appLimited != 0,
+	}
+}
+
+// beginAck resets the rate sample before an ACK is processed.
+func (r *rateSampler) beginAck() {
+	r.sample = rateSample{
+		interval: -1,
+		rtt:      unknownRTT,
+	}
+}
+
+// onDelivered updates the delivery state when size bytes of seg are
+// acknowledged for the first time by the ACK being processed.
+func (r *rateSampler) onDelivered(seg *segment, size int, now tcpip.MonotonicTime) {
+	r.delivered += uint64(size)
+	r.deliveredTime = now
+	r.sample.newlyAcked += uint64(size)
+
+	if seg.txRate.deliveredTime == (tcpip.MonotonicTime{}) {
+		return
+	}
+
+	// Use the most recently sent segment to take the sample, as it
+	// reflects the most recent state of the path.
+	if r.sample.priorTime == (tcpip.MonotonicTime{}) || seg.xmitTime.After(r.sample.xmitTime) {
+		r.sample.priorDelivered = seg.txRate.delivered
+		r.sample.priorTime = seg.txRate.deliveredTime
+		r.sample.priorLost = seg.txRate.lost
+		r.sample.txInFlight = seg.txRate.inFlight
+		r.sample.isAppLimited = seg.txRate.appLimited
+		r.sample.sendElapsed = seg.xmitTime.Sub(seg.txRate.firstSentTime)
+		r.sample.ackElapsed = r.deliveredTime.Sub(seg.txRate.deliveredTime)
+		r.sample.xmitTime = seg.xmitTime
+		if seg.xmitCount == 1 {
+			r.sample.rtt = now.Sub(seg.xmitTime)
+		}
+		r.firstSentTime = seg.xmitTime
+	}
+
+	// Only sample a segment once.
+	seg.txRate.deliveredTime = tcpip.MonotonicTime{}
+}
+
+// onLost records that seg has been marked lost.
+func (r *rateSampler) onLost(seg *segment) {
+	r.lost += uint64(seg.payloadSize())
+	r.sample.newlyLost += uint64(seg.payloadSize())
+}
+
+// generate completes the rate sample for the ACK being processed. minRTT is
+// the minimum round-trip time observed on the path; samples taken over a
+// shorter interval are discarded as they are likely to be inflated by ACK
+// compression.
+func (r *rateSampler) generate(minRTT time.Duration) {
+	// Clear the application-limited marker once the bubble has been
+	// acknowledged.
+	if r.appLimited != 0 && r.delivered > r.appLimited {
+		r.appLimited = 0
+	}
+
+	rs := &r.sample
+	if rs.priorTime == (tcpip.MonotonicTime{}) {
+		return
+	}
+	rs.interval = max(rs.sendElapsed, rs.ackElapsed)
+	rs.delivered = r.delivered - rs.priorDelivered
+	rs.lost = r.lost - rs.priorLost
+	if rs.interval <= 0 || rs.interval < minRTT {
+		rs.interval = -1
+		return
+	}
+	rs.deliveryRate = uint64(float64(rs.delivered) * float64(time.Second) / float64(rs.interval))
+	r.deliveryRate = rs.deliveryRate
+	r.deliveryRateAppLimited = rs.isAppLimited
+}
+
+// markAppLimited marks the connection as application limited until the data
+// currently in flight has been delivered.
+func (r *rateSampler) markAppLimited(inFlight uint64) {
+	r.appLimited = max(r.delivered+inFlight, 1)
+}
@@ -49,6 +49,12 @@ type receiver struct {
 
 	// Time when the last ack was received.
 	lastRcvdAckTime tcpip.MonotonicTime
+
+	// bytesReceived is the number of payload bytes consumed in order.
+	bytesReceived uint64
+
+	// dataSegsIn is the number of segments carrying payload consumed.
+	dataSegsIn uint32
 }
 
 func newReceiver(ep *Endpoint, irs seqnum.Value, rcvWnd seqnum.Size, rcvWndScale uint8) *receiver {
@@ -219,6 +225,9 @@ func (r *receiver) consumeSegment(s *segment, segSeq seqnum.Value, segLen seqnum
 			s.TrimFront(diff)
 		}
 
+		r.bytesReceived += uint64(segLen)
+		r.dataSegsIn++
+
 		// Move segment to ready-to-deliver list. Wakeup any waiters.
 		r.ep.readyToRead(s)
 
@@ -84,6 +84,19 @@ type congestionControl interface {
 	PostRecovery()
 }
 
+// rateSampleConsumer is implemented by congestion control algorithms that are
+// driven by delivery rate samples rather than by counting acked packets.
+type rateSampleConsumer interface {
+	// MinRTT returns the minimum round-trip time estimated by the
+	// algorithm, or zero if unknown. Rate samples taken over a shorter
+	// interval are discarded.
+	MinRTT() time.Duration
+
+	// OnRateSample is invoked for every ACK that delivers new data,
+	// including ACKs received during recovery.
+	OnRateSample(rs *rateSample)
+}
+
 // lossRecovery is an interface that must be implemented by any supported
 // loss recovery algorithm.
 type lossRecovery interface {
@@ -182,6 +195,38 @@ type sender struct {
 	// corkTimer is used to drain the segments which are held when TCP_CORK
 	// option is enabled.
 	corkTimer timer `state:"nosave"`
+
+	// rs tracks the connection delivery rate.
+	rs rateSampler
+
+	// pacingRate is the rate in bytes per second at which data segments
+	// are sent. Zero disables pacing.
+	pacingRate uint64
+
+	// nextSendTime is the earliest time at which the next data segment may
+	// be sent when pacing is enabled.
+	nextSendTime tcpip.MonotonicTime
+
+	// pacingTimer is used to resume sending once the pacing delay has
+	// elapsed.
+	pacingTimer timer `state:"nosave"`
+
+	// minRTT is the minimum round trip time measured, or zero if none has
+	// been measured yet.
+	minRTT time.Duration
+
+	// bytesSent is the number of payload bytes sent, including
+	// retransmissions.
+	bytesSent uint64
+
+	// bytesRetrans is the number of payload bytes retransmitted.
+	bytesRetrans uint64
+
+	// bytesAcked is the number of bytes cumulatively acknowledged.
+	bytesAcked uint64
+
+	// dataSegsOut is the number of segments carrying payload sent.
+	dataSegsOut uint32
 }
 
 // protectedWriteList wraps the write list, checking for invalid state when
@@ -298,8 +343,9 @@ func newSenderHelper(ep *Endpoint, iss, irs seqnum.Value, sndWnd seqnum.Size, ms
 	s.reorderTimer.init(s.ep.stack.Clock(), timerHandler(s.ep, s.rc.reorderTimerExpired))
 	s.probeTimer.init(s.ep.stack.Clock(), timerHandler(s.ep, s.probeTimerExpired))
 	s.corkTimer.init(s.ep.stack.Clock(), timerHandler(s.ep, s.corkTimerExpired))
+	s.pacingTimer.init(s.ep.stack.Clock(), timerHandler(s.ep, s.pacingTimerExpired))
 
-	s.updateMaxPayloadSize(int(ep.route.MTU()), 0)
+	s.updateMaxPayloadSize(int(ep.protocol.routeMTU(ep.route)), 0)
 	// Initialize SACK Scoreboard after updating max payload size as we use
 	// the maxPayloadSize as the smss when determining if a segment is lost
 	// etc.
@@ -339,6 +385,8 @@ func (s *sender) initCongestionControl(congestionControlName tcpip.CongestionCon
 	switch congestionControlName {
 	case ccCubic:
 		return newCubicCC(s)
+	case ccBBR:
+		return newBBRCC(s)
 	case ccReno:
 		fallthrough
 	default:
@@ -435,6 +483,9 @@ func (s *sender) sendAck() {
 //
 // +checklocks:s.ep.mu
 func (s *sender) updateRTO(rtt time.Duration) {
+	if s.minRTT == 0 || rtt < s.minRTT {
+		s.minRTT = rtt
+	}
 	s.rtt.Lock()
 	if !s.rtt.TCPRTTState.SRTTInited {
 		s.rtt.TCPRTTState.RTTVar = rtt / 2
@@ -678,6 +729,11 @@ func (s *sender) pCount(seg *segment, maxPayloadSize int) int {
 	return (size-1)/maxPayloadSize + 1
 }
 
+// inFlightBytes returns the estimated number of bytes in flight.
+func (s *sender) inFlightBytes() uint64 {
+	return uint64(max(s.Outstanding, 0)) * uint64(s.MaxPayloadSize)
+}
+
 // splitSeg splits a given segment at the size specified and inserts the
 // remainder as a new segment after the current one in the write list.
 //
@@ -1097,6 +1153,9 @@ func (s *sender) sendData() {
 
 	var dataSent bool
 	for seg := s.writeNext; seg != nil && s.Outstanding < s.SndCwnd; seg = seg.Next() {
+		if s.pacingDelayed() {
+			break
+		}
 		cwndLimit := (s.SndCwnd - s.Outstanding) * s.MaxPayloadSize
 		if cwndLimit < limit {
 			limit = cwndLimit
@@ -1112,12 +1171,66 @@ func (s *sender) sendData() {
 		}
 		dataSent = true
 		s.Outstanding += s.pCount(seg, s.MaxPayloadSize)
+		s.advancePacing(seg.payloadSize())
 		s.updateWriteNext(seg.Next())
 	}
 
+	// Record whether sending was limited by the congestion window or by
+	// the application for delivery rate estimation.
+	s.rs.cwndLimited = s.writeNext != nil && s.Outstanding >= s.SndCwnd
+	if s.writeNext == nil && s.Outstanding < s.SndCwnd {
+		s.rs.markAppLimited(s.inFlightBytes())
+	}
+
 	s.postXmit(dataSent, true /* shouldScheduleProbe */)
 }
 
+// pacingDelayed returns true if pacing doesn't allow a data segment to be sent
+// yet, in which case the pacing timer is armed to resume sending.
+//
+// +checklocks:s.ep.mu
+func (s *sender) pacingDelayed() bool {
+	if s.pacingRate == 0 {
+		return false
+	}
+	now := s.ep.stack.Clock().NowMonotonic()
+	if !now.Before(s.nextSendTime) {
+		return false
+	}
+	if !s.pacingTimer.enabled() {
+		s.pacingTimer.enable(s.nextSendTime.Sub(now))
+	}
+	return true
+}
+
+// advancePacing computes the earliest time at which the segment following
+// one of the given size may be sent.
+//
+// +checklocks:s.ep.mu
+func (s *sender) advancePacing(size int) {
+	if s.pacingRate == 0 {
+		return
+	}
+	next := s.ep.stack.Clock().NowMonotonic()
+	if next.Before(s.nextSendTime) {
+		next = s.nextSendTime
+	}
+	s.nextSendTime = next.Add(time.Duration(float64(size) * float64(time.Second) / float64(s.pacingRate)))
+}
+
+// pacingTimerExpired resumes sending data held back by pacing.
+//
+// +checklocks:s.ep.mu
+func (s *sender) pacingTimerExpired() tcpip.Error {
+	// Check if the timer actually expired or if it's a spurious wake due
+	// to a previously orphaned runtime timer.
+	if s.pacingTimer.isUninitialized() || !s.pacingTimer.checkExpiration() {
+		return nil
+	}
+	s.sendData()
+	return nil
+}
+
 // +checklocks:s.ep.mu
 func (s *sender) enterRecovery() {
 	// Initialize the variables used to detect spurious recovery after
@@ -1375,6 +1488,7 @@ func (s *sender) walkSACK(rcvdSeg *segment) bool {
 			if sb.Start.LessThanEq(seg.sequenceNumber) && !seg.acked {
 				s.rc.update(seg, rcvdSeg)
 				s.rc.detectReorder(seg)
+				s.rs.onDelivered(seg, seg.payloadSize(), rcvdSeg.rcvdTime)
 				seg.acked = true
 				s.SackedOut += s.pCount(seg, s.MaxPayloadSize)
 			}
@@ -1521,6 +1635,7 @@ func (s *sender) inRecovery() bool {
 // +checklocksalias:s.rc.snd.ep.mu=s.ep.mu
 func (s *sender) handleRcvdSegment(rcvdSeg *segment) {
 	bestRTT := unknownRTT
+	s.rs.beginAck()
 
 	// Check if we can extract an RTT measurement from this ack.
 	if !rcvdSeg.parsedOptions.TS && s.RTTMeasureSeqNum.LessThan(rcvdSeg.ackNumber) {
@@ -1651,6 +1766,7 @@ func (s *sender) handleRcvdSegment(rcvdSeg *segment) {
 		// Remove all acknowledged data from the write list.
 		acked := s.SndUna.Size(ack)
 		s.SndUna = ack
+		s.bytesAcked += uint64(acked)
 		ackLeft := acked
 		originalOutstanding := s.Outstanding
 		for ackLeft > 0 {
@@ -1664,6 +1780,9 @@ func (s *sender) handleRcvdSegment(rcvdSeg *segment) {
 			}
 
 			datalen := seg.logicalLen()
+			if !seg.acked {
+				s.rs.onDelivered(seg, int(min(datalen, ackLeft)), rcvdSeg.rcvdTime)
+			}
 			if datalen > ackLeft {
 				prevCount := s.pCount(seg, s.MaxPayloadSize)
 				seg.TrimFront(ackLeft)
@@ -1767,6 +1886,20 @@ func (s *sender) handleRcvdSegment(rcvdSeg *segment) {
 		}
 	}
 
+	// Generate the delivery rate sample for this ACK and feed it to rate
+	// based congestion control.
+	if s.rs.sample.newlyAcked > 0 {
+		rsc, ok := s.cc.(rateSampleConsumer)
+		minRTT := s.minRTT
+		if ok {
+			minRTT = rsc.MinRTT()
+		}
+		s.rs.generate(minRTT)
+		if ok {
+			rsc.OnRateSample(&s.rs.sample)
+		}
+	}
+
 	// Now that we've popped all acknowledged data from the retransmit
 	// queue, retransmit if needed.
 	if s.FastRecovery.Active && s.ep.tcpRecovery&tcpip.TCPRACKLossDetection == 0 {
@@ -1797,6 +1930,14 @@ func (s *sender) sendSegment(seg *segment) tcpip.Error {
 		}
 	}
 	seg.xmitTime = s.ep.stack.Clock().NowMonotonic()
+	if size := seg.payloadSize(); size != 0 {
+		s.rs.onSent(seg, seg.xmitTime, s.inFlightBytes())
+		s.bytesSent += uint64(size)
+		if seg.xmitCount > 0 {
+			s.bytesRetrans += uint64(size)
+		}
+		s.dataSegsOut++
+	}
 	seg.xmitCount++
 	seg.lost = false
 
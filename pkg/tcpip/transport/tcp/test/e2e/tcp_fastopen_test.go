@@ -0,0 +1,322 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp_fastopen_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wilinz/gvisor/pkg/refs"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/checker"
+	"github.com/wilinz/gvisor/pkg/tcpip/header"
+	"github.com/wilinz/gvisor/pkg/tcpip/network/ipv4"
+	"github.com/wilinz/gvisor/pkg/tcpip/seqnum"
+	"github.com/wilinz/gvisor/pkg/tcpip/transport/tcp"
+	"github.com/wilinz/gvisor/pkg/tcpip/transport/tcp/test/e2e"
+	"github.com/wilinz/gvisor/pkg/tcpip/transport/tcp/testing/context"
+	"github.com/wilinz/gvisor/pkg/waiter"
+)
+
+// fastOpenOption returns the encoded TCP Fast Open option carrying cookie,
+// padded to a multiple of four bytes. A nil cookie requests one.
+func fastOpenOption(cookie []byte) []byte {
+	opts := make([]byte, 20)
+	offset := header.EncodeFastOpenOption(cookie, opts)
+	offset += header.AddTCPOptionPadding(opts, offset)
+	return opts[:offset]
+}
+
+// createFastOpenListener creates a listening endpoint with TCP Fast Open
+// enabled.
+func createFastOpenListener(t *testing.T, c *context.Context) {
+	t.Helper()
+
+	ep, err := c.Stack().NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, &c.WQ)
+	if err != nil {
+		t.Fatalf("NewEndpoint failed: %s", err)
+	}
+	c.EP = ep
+	if err := ep.SetSockOptInt(tcpip.TCPFastOpenOption, 5); err != nil {
+		t.Fatalf("SetSockOptInt(TCPFastOpenOption, 5) failed: %s", err)
+	}
+	if err := ep.Bind(tcpip.FullAddress{Port: context.StackPort}); err != nil {
+		t.Fatalf("Bind failed: %s", err)
+	}
+	if err := ep.Listen(10); err != nil {
+		t.Fatalf("Listen failed: %s", err)
+	}
+}
+
+// sendFastOpenSyn sends a SYN with the TCP Fast Open option carrying cookie
+// and payload, and returns the SYN-ACK.
+func sendFastOpenSyn(t *testing.T, c *context.Context, srcPort uint16, cookie, payload []byte) header.TCP {
+	t.Helper()
+
+	irs := seqnum.Value(context.TestInitialSequenceNumber)
+	c.SendPacket(payload, &context.Headers{
+		SrcPort: srcPort,
+		DstPort: context.StackPort,
+		Flags:   header.TCPFlagSyn,
+		SeqNum:  irs,
+		RcvWnd:  30000,
+		TCPOpts: fastOpenOption(cookie),
+	})
+
+	v := c.GetPacket()
+	defer v.Release()
+	checker.IPv4(t, v, checker.TCP(
+		checker.SrcPort(context.StackPort),
+		checker.DstPort(srcPort),
+		checker.TCPFlags(header.TCPFlagSyn|header.TCPFlagAck),
+	))
+	return header.TCP(bytes.Clone(header.IPv4(v.AsSlice()).Payload()))
+}
+
+func TestFastOpenCookieRequest(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	createFastOpenListener(t, c)
+
+	synAck := sendFastOpenSyn(t, c, context.TestPort, nil /* cookie */, nil /* payload */)
+	if got, want := seqnum.Value(synAck.AckNumber()), seqnum.Value(context.TestInitialSequenceNumber).Add(1); got != want {
+		t.Errorf("got SYN-ACK ack = %d, want = %d", got, want)
+	}
+	opts := header.ParseSynOptions(synAck.Options(), true /* isAck */)
+	if !opts.FastOpen {
+		t.Fatalf("SYN-ACK has no TCP Fast Open option")
+	}
+	if got, want := len(opts.FastOpenCookie), 8; got != want {
+		t.Errorf("got len(cookie) = %d, want = %d", got, want)
+	}
+}
+
+func TestFastOpenSynData(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		validCookie bool
+	}{
+		{name: "valid cookie", validCookie: true},
+		{name: "invalid cookie", validCookie: false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := context.New(t, e2e.DefaultMTU)
+			defer c.Cleanup()
+
+			createFastOpenListener(t, c)
+
+			srcPort := uint16(context.TestPort)
+			synAck := sendFastOpenSyn(t, c, srcPort, nil /* cookie */, nil /* payload */)
+			cookie := header.ParseSynOptions(synAck.Options(), true /* isAck */).FastOpenCookie
+			if !test.validCookie {
+				cookie = []byte{1, 2, 3, 4, 5, 6, 7, 8}
+			}
+
+			data := []byte{1, 2, 3, 4, 5}
+			irs := seqnum.Value(context.TestInitialSequenceNumber)
+			srcPort++
+			synAck = sendFastOpenSyn(t, c, srcPort, cookie, data)
+			opts := header.ParseSynOptions(synAck.Options(), true /* isAck */)
+			ack := seqnum.Value(synAck.AckNumber())
+			wantAck := irs.Add(1)
+			if test.validCookie {
+				wantAck = wantAck.Add(seqnum.Size(len(data)))
+			}
+			if ack != wantAck {
+				t.Fatalf("got SYN-ACK ack = %d, want = %d", ack, wantAck)
+			}
+			if test.validCookie == (opts.FastOpenCookie != nil) {
+				t.Errorf("got SYN-ACK cookie = %x, want a cookie only if the data is rejected", opts.FastOpenCookie)
+			}
+			if !test.validCookie {
+				return
+			}
+
+			// Complete the handshake.
+			we, ch := waiter.NewChannelEntry(waiter.ReadableEvents)
+			c.WQ.EventRegister(&we)
+			defer c.WQ.EventUnregister(&we)
+			c.SendPacket(nil, &context.Headers{
+				SrcPort: srcPort,
+				DstPort: context.StackPort,
+				Flags:   header.TCPFlagAck,
+				SeqNum:  ack,
+				AckNum:  seqnum.Value(synAck.SequenceNumber()).Add(1),
+				RcvWnd:  30000,
+			})
+
+			// The data from the SYN is readable once accepted.
+			var ep tcpip.Endpoint
+			for ep == nil {
+				var err tcpip.Error
+				ep, _, err = c.EP.Accept(nil)
+				if cmp.Equal(&tcpip.ErrWouldBlock{}, err) {
+					select {
+					case <-ch:
+						continue
+					case <-time.After(1 * time.Second):
+						t.Fatalf("Timed out waiting for accept")
+					}
+				}
+				if err != nil {
+					t.Fatalf("Accept failed: %s", err)
+				}
+			}
+			defer ep.Close()
+
+			var buf bytes.Buffer
+			if _, err := ep.Read(&buf, tcpip.ReadOptions{}); err != nil {
+				t.Fatalf("Read failed: %s", err)
+			}
+			if got := buf.Bytes(); !bytes.Equal(got, data) {
+				t.Errorf("got data = %v, want = %v", got, data)
+			}
+		})
+	}
+}
+
+// connectFastOpen creates an endpoint with TCP_FASTOPEN_CONNECT, connects it
+// and writes data. It returns the SYN sent by the write.
+func connectFastOpen(t *testing.T, c *context.Context, data []byte) header.TCP {
+	t.Helper()
+
+	c.Create(-1)
+	if err := c.EP.SetSockOptInt(tcpip.TCPFastOpenConnectOption, 1); err != nil {
+		t.Fatalf("SetSockOptInt(TCPFastOpenConnectOption, 1) failed: %s", err)
+	}
+	if err := c.EP.Connect(tcpip.FullAddress{Addr: context.TestAddr, Port: context.TestPort}); err != nil {
+		t.Fatalf("Connect failed: %s", err)
+	}
+	if got, want := c.EP.Readiness(waiter.WritableEvents), waiter.WritableEvents; got != want {
+		t.Errorf("got Readiness(WritableEvents) = %v, want = %v", got, want)
+	}
+	c.CheckNoPacketTimeout("SYN sent before the first write", 100*time.Millisecond)
+
+	var r bytes.Reader
+	r.Reset(data)
+	if n, err := c.EP.Write(&r, tcpip.WriteOptions{}); err != nil || n != int64(len(data)) {
+		t.Fatalf("Write(...) = (%d, %s), want = (%d, nil)", n, err, len(data))
+	}
+
+	v := c.GetPacket()
+	defer v.Release()
+	checker.IPv4(t, v, checker.TCP(
+		checker.DstPort(context.TestPort),
+		checker.TCPFlags(header.TCPFlagSyn),
+	))
+	return header.TCP(bytes.Clone(header.IPv4(v.AsSlice()).Payload()))
+}
+
+func TestFastOpenConnect(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	data := []byte{1, 2, 3, 4, 5}
+	iss := seqnum.Value(context.TestInitialSequenceNumber)
+	cookie := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+	// Without a cookie, the SYN requests one and the data is sent once the
+	// connection is established.
+	syn := connectFastOpen(t, c, data)
+	if got := len(syn.Payload()); got != 0 {
+		t.Errorf("got SYN payload length = %d, want = 0", got)
+	}
+	synOpts := header.ParseSynOptions(syn.Options(), false /* isAck */)
+	if !synOpts.FastOpen || synOpts.FastOpenCookie != nil {
+		t.Errorf("got SYN options = %+v, want a cookie request", synOpts)
+	}
+	irs := seqnum.Value(syn.SequenceNumber())
+	c.SendPacket(nil, &context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: syn.SourcePort(),
+		Flags:   header.TCPFlagSyn | header.TCPFlagAck,
+		SeqNum:  iss,
+		AckNum:  irs.Add(1),
+		RcvWnd:  30000,
+		TCPOpts: fastOpenOption(cookie),
+	})
+	v := c.GetPacket()
+	checker.IPv4(t, v, checker.TCP(
+		checker.TCPFlags(header.TCPFlagAck),
+		checker.TCPSeqNum(uint32(irs)+1),
+		checker.TCPAckNum(uint32(iss)+1),
+	))
+	v.Release()
+	v = c.GetPacket()
+	checker.IPv4(t, v, checker.TCP(
+		checker.TCPSeqNum(uint32(irs)+1),
+		checker.TCPAckNum(uint32(iss)+1),
+		checker.Payload(data),
+	))
+	v.Release()
+
+	// Close the connection so that it doesn't send anything else.
+	c.EP.Close()
+	v = c.GetPacket()
+	checker.IPv4(t, v, checker.TCP(
+		checker.TCPFlags(header.TCPFlagFin|header.TCPFlagAck),
+		checker.TCPSeqNum(uint32(irs)+1+uint32(len(data))),
+	))
+	v.Release()
+	c.SendPacket(nil, &context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: syn.SourcePort(),
+		Flags:   header.TCPFlagAck,
+		SeqNum:  iss.Add(1),
+		AckNum:  irs.Add(2 + seqnum.Size(len(data))),
+		RcvWnd:  30000,
+	})
+
+	// With the cookie, the data is sent in the SYN.
+	syn = connectFastOpen(t, c, data)
+	if got := syn.Payload(); !bytes.Equal(got, data) {
+		t.Errorf("got SYN payload = %v, want = %v", got, data)
+	}
+	synOpts = header.ParseSynOptions(syn.Options(), false /* isAck */)
+	if !synOpts.FastOpen || !bytes.Equal(synOpts.FastOpenCookie, cookie) {
+		t.Errorf("got SYN options = %+v, want cookie %x", synOpts, cookie)
+	}
+	irs = seqnum.Value(syn.SequenceNumber())
+	c.SendPacket(nil, &context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: syn.SourcePort(),
+		Flags:   header.TCPFlagSyn | header.TCPFlagAck,
+		SeqNum:  iss,
+		AckNum:  irs.Add(1 + seqnum.Size(len(data))),
+		RcvWnd:  30000,
+	})
+	v = c.GetPacket()
+	defer v.Release()
+	checker.IPv4(t, v, checker.TCP(
+		checker.TCPFlags(header.TCPFlagAck),
+		checker.TCPSeqNum(uint32(irs)+1+uint32(len(data))),
+		checker.TCPAckNum(uint32(iss)+1),
+	))
+	c.CheckNoPacketTimeout("SYN data sent again", 100*time.Millisecond)
+}
+
+func TestMain(m *testing.M) {
+	refs.SetLeakMode(refs.LeaksPanic)
+	code := m.Run()
+	// Allow TCP async work to complete to avoid false reports of leaks.
+	// TODO(gvisor.dev/issue/5940): Use fake clock in tests.
+	time.Sleep(1 * time.Second)
+	refs.DoLeakCheck()
+	os.Exit(code)
+}
@@ -5823,6 +5823,7 @@ func TestStackSetCongestionControl(t *testing.T) {
 	}{
 		{"reno", nil},
 		{"cubic", nil},
+		{"bbr", nil},
 		{"blahblah", &tcpip.ErrNoSuchFile{}},
 	}
 
@@ -5875,7 +5876,7 @@ func TestStackAvailableCongestionControl(t *testing.T) {
 	if err := s.TransportProtocolOption(tcp.ProtocolNumber, &aCC); err != nil {
 		t.Fatalf("s.TransportProtocolOption(%v, %v) = %v", tcp.ProtocolNumber, &aCC, err)
 	}
-	if got, want := aCC, tcpip.TCPAvailableCongestionControlOption("reno cubic"); got != want {
+	if got, want := aCC, tcpip.TCPAvailableCongestionControlOption("reno cubic bbr"); got != want {
 		t.Fatalf("got tcpip.TCPAvailableCongestionControlOption: %v, want: %v", got, want)
 	}
 }
@@ -5897,7 +5898,7 @@ func TestStackSetAvailableCongestionControl(t *testing.T) {
 	if err := s.TransportProtocolOption(tcp.ProtocolNumber, &cc); err != nil {
 		t.Fatalf("s.TransportProtocolOptio(%d, &%T(%s)): %s", tcp.ProtocolNumber, cc, cc, err)
 	}
-	if got, want := cc, tcpip.TCPAvailableCongestionControlOption("reno cubic"); got != want {
+	if got, want := cc, tcpip.TCPAvailableCongestionControlOption("reno cubic bbr"); got != want {
 		t.Fatalf("got tcpip.TCPAvailableCongestionControlOption = %s, want = %s", got, want)
 	}
 }
@@ -5909,6 +5910,7 @@ func TestEndpointSetCongestionControl(t *testing.T) {
 	}{
 		{"reno", nil},
 		{"cubic", nil},
+		{"bbr", nil},
 		{"blahblah", &tcpip.ErrNoSuchFile{}},
 	}
 
@@ -6645,6 +6647,81 @@ func TestListenSynRcvdQueueFull(t *testing.T) {
 	}
 }
 
+func TestListenSynBacklogFullNoSynCookies(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	opt := tcpip.TCPSynCookiesNever
+	if err := c.Stack().SetTransportProtocolOption(tcp.ProtocolNumber, &opt); err != nil {
+		t.Fatalf("SetTransportProtocolOption(%d, &%T(%d)): %s", tcp.ProtocolNumber, opt, opt, err)
+	}
+
+	// Create TCP endpoint.
+	var err tcpip.Error
+	c.EP, err = c.Stack().NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, &c.WQ)
+	if err != nil {
+		t.Fatalf("NewEndpoint failed: %s", err)
+	}
+
+	// Bind to wildcard.
+	if err := c.EP.Bind(tcpip.FullAddress{Port: context.StackPort}); err != nil {
+		t.Fatalf("Bind failed: %s", err)
+	}
+
+	if err := c.EP.Listen(1); err != nil {
+		t.Fatalf("Listen failed: %s", err)
+	}
+
+	// The first SYN fills the SYN backlog and gets a SYN-ACK.
+	irs := seqnum.Value(context.TestInitialSequenceNumber)
+	c.SendPacket(nil, &context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: context.StackPort,
+		Flags:   header.TCPFlagSyn,
+		SeqNum:  irs,
+		RcvWnd:  30000,
+	})
+	b := c.GetPacket()
+	defer b.Release()
+	checker.IPv4(t, b, checker.TCP(
+		checker.SrcPort(context.StackPort),
+		checker.DstPort(context.TestPort),
+		checker.TCPFlags(header.TCPFlagAck|header.TCPFlagSyn),
+		checker.TCPAckNum(uint32(irs)+1),
+	))
+
+	// With SYN cookies disabled, the second SYN is dropped instead of
+	// being answered with a cookie.
+	c.SendPacket(nil, &context.Headers{
+		SrcPort: context.TestPort + 1,
+		DstPort: context.StackPort,
+		Flags:   header.TCPFlagSyn,
+		SeqNum:  irs,
+		RcvWnd:  30000,
+	})
+	c.CheckNoPacketTimeout("unexpected packet received", 50*time.Millisecond)
+
+	stats := c.Stack().Stats().TCP
+	if got := stats.ListenSynBacklogDrop.Value(); got != 1 {
+		t.Errorf("got stats.TCP.ListenSynBacklogDrop.Value() = %d, want = 1", got)
+	}
+	if got := stats.ListenOverflowSynCookieSent.Value(); got != 0 {
+		t.Errorf("got stats.TCP.ListenOverflowSynCookieSent.Value() = %d, want = 0", got)
+	}
+	if got := c.EP.Stats().(*tcp.Stats).ReceiveErrors.ListenSynBacklogDrop.Value(); got != 1 {
+		t.Errorf("got EP stats.ReceiveErrors.ListenSynBacklogDrop.Value() = %d, want = 1", got)
+	}
+
+	var q tcpip.TCPListenQueueOption
+	if err := c.EP.GetSockOpt(&q); err != nil {
+		t.Fatalf("GetSockOpt(&%T): %s", q, err)
+	}
+	want := tcpip.TCPListenQueueOption{SynBacklog: 1, AcceptQueue: 0, Backlog: 1}
+	if q != want {
+		t.Errorf("got GetSockOpt(&%T) = %+v, want = %+v", q, q, want)
+	}
+}
+
 func TestListenBacklogFullSynCookieInUse(t *testing.T) {
 	c := context.New(t, e2e.DefaultMTU)
 	defer c.Cleanup()
@@ -8879,6 +8956,73 @@ func TestHandshakeRTT(t *testing.T) {
 	}
 }
 
+func TestTCPInfoCounters(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	c.CreateConnected(context.TestInitialSequenceNumber, 30000, -1 /* epRcvBuf */)
+
+	// Send data and acknowledge it.
+	sent := []byte{1, 2, 3, 4, 5}
+	var r bytes.Reader
+	r.Reset(sent)
+	if _, err := c.EP.Write(&r, tcpip.WriteOptions{}); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	b := c.GetPacket()
+	b.Release()
+	iss := seqnum.Value(context.TestInitialSequenceNumber).Add(1)
+	c.SendPacket(nil, &context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: c.Port,
+		Flags:   header.TCPFlagAck,
+		SeqNum:  iss,
+		AckNum:  c.IRS.Add(1 + seqnum.Size(len(sent))),
+		RcvWnd:  30000,
+	})
+
+	// Receive data.
+	rcvd := []byte{1, 2, 3}
+	c.SendPacket(rcvd, &context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: c.Port,
+		Flags:   header.TCPFlagAck,
+		SeqNum:  iss,
+		AckNum:  c.IRS.Add(1 + seqnum.Size(len(sent))),
+		RcvWnd:  30000,
+	})
+	b = c.GetPacket()
+	b.Release()
+
+	var info tcpip.TCPInfoOption
+	if err := c.EP.GetSockOpt(&info); err != nil {
+		t.Fatalf("c.EP.GetSockOpt(&%T) = %s", info, err)
+	}
+	for _, test := range []struct {
+		name      string
+		got, want uint64
+	}{
+		{"BytesSent", info.BytesSent, uint64(len(sent))},
+		{"BytesRetrans", info.BytesRetrans, 0},
+		{"BytesAcked", info.BytesAcked, uint64(len(sent))},
+		{"BytesReceived", info.BytesReceived, uint64(len(rcvd))},
+		{"DataSegsOut", uint64(info.DataSegsOut), 1},
+		{"DataSegsIn", uint64(info.DataSegsIn), 1},
+		{"Unacked", uint64(info.Unacked), 0},
+		{"NotSentBytes", uint64(info.NotSentBytes), 0},
+	} {
+		if test.got != test.want {
+			t.Errorf("got info.%s = %d, want = %d", test.name, test.got, test.want)
+		}
+	}
+	if info.SegsOut < info.DataSegsOut || info.SegsIn < info.DataSegsIn {
+		t.Errorf("got info.SegsOut = %d, info.SegsIn = %d, want at least %d and %d", info.SegsOut, info.SegsIn, info.DataSegsOut, info.DataSegsIn)
+	}
+	if info.SndMSS == 0 {
+		t.Errorf("got info.SndMSS = 0, want non-zero")
+	}
+}
+
 func TestSetRTO(t *testing.T) {
 	c := context.New(t, e2e.DefaultMTU)
 	minRTO, maxRTO := tcpRTOMinMax(t, c)
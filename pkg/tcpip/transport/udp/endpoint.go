@@ -21,6 +21,7 @@ import (
 	"math"
 	"time"
 
+	"github.com/wilinz/gvisor/pkg/atomicbitops"
 	"github.com/wilinz/gvisor/pkg/sync"
 	"github.com/wilinz/gvisor/pkg/tcpip"
 	"github.com/wilinz/gvisor/pkg/tcpip/checksum"
@@ -46,8 +47,21 @@ type udpPacket struct {
 	tosOrTClass uint8
 	// ttlOrHopLimit stores either the TTL for IPv4 or the HopLimit for IPv6
 	ttlOrHopLimit uint8
+	// dropCount is the number of packets dropped by the endpoint when this
+	// packet was received.
+	dropCount uint32
 }
 
+const (
+	// maxSegments is the maximum number of datagrams a write can be split
+	// into with UDP_SEGMENT. This matches Linux's UDP_MAX_SEGMENTS.
+	maxSegments = 128
+
+	// maxGROSegments is the maximum number of datagrams coalesced into a
+	// single read with UDP_GRO. This matches Linux's UDP_GRO_CNT_MAX.
+	maxGROSegments = 64
+)
+
 // endpoint represents a UDP endpoint. This struct serves as the interface
 // between users of the endpoint and the protocol implementation; it is legal to
 // have concurrent goroutines make calls into the endpoint, they are properly
@@ -75,6 +89,17 @@ type endpoint struct {
 	rcvBufSize int
 	rcvClosed  bool
 
+	// drops is the number of received packets dropped by the endpoint.
+	drops atomicbitops.Uint32
+
+	// gsoSize is the size of the datagrams that writes are split into, as
+	// set by UDP_SEGMENT. Zero disables segmentation.
+	gsoSize atomicbitops.Uint32
+
+	// groEnabled indicates whether datagrams of the same flow may be
+	// coalesced into a single read, as set by UDP_GRO.
+	groEnabled atomicbitops.Bool
+
 	lastErrorMu sync.Mutex `state:"nosave"`
 	lastError   tcpip.Error
 
@@ -232,10 +257,19 @@ func (e *endpoint) Read(dst io.Writer, opts tcpip.ReadOptions) (tcpip.ReadResult
 	}
 
 	p := e.rcvList.Front()
+	var segs []*udpPacket
 	if !opts.Peek {
 		e.rcvList.Remove(p)
 		defer p.pkt.DecRef()
 		e.rcvBufSize -= p.pkt.Data().Size()
+		if e.groEnabled.Load() {
+			segs = e.groSegmentsLocked(p)
+			defer func() {
+				for _, s := range segs {
+					s.pkt.DecRef()
+				}
+			}()
+		}
 	}
 	e.rcvMu.Unlock()
 
@@ -286,11 +320,25 @@ func (e *endpoint) Read(dst io.Writer, opts tcpip.ReadOptions) (tcpip.ReadResult
 		cm.OriginalDstAddress = p.destinationAddress
 	}
 
+	// Linux only reports non-zero drop counts.
+	if e.ops.GetReceiveDropCount() && p.dropCount != 0 {
+		cm.HasDropCount = true
+		cm.DropCount = p.dropCount
+	}
+
+	if len(segs) != 0 {
+		cm.HasGROSize = true
+		cm.GROSize = uint16(p.pkt.Data().Size())
+	}
+
 	// Read Result
 	res := tcpip.ReadResult{
 		Total:           p.pkt.Data().Size(),
 		ControlMessages: cm,
 	}
+	for _, s := range segs {
+		res.Total += s.pkt.Data().Size()
+	}
 	if opts.NeedRemoteAddr {
 		res.RemoteAddr = p.senderAddress
 	}
@@ -300,9 +348,49 @@ func (e *endpoint) Read(dst io.Writer, opts tcpip.ReadOptions) (tcpip.ReadResult
 		return res, &tcpip.ErrBadBuffer{}
 	}
 	res.Count = n
+	for _, s := range segs {
+		if err != nil {
+			break
+		}
+		n, err = s.pkt.Data().ReadTo(dst, false /* peek */)
+		res.Count += n
+	}
 	return res, nil
 }
 
+// groSegmentsLocked removes the datagrams following p in the receive queue
+// that can be coalesced with it and returns them. As with Linux's UDP GRO,
+// these are datagrams of the same flow which have the size of p, except for
+// the last one which may be smaller.
+//
+// +checklocks:e.rcvMu
+func (e *endpoint) groSegmentsLocked(p *udpPacket) []*udpPacket {
+	size := p.pkt.Data().Size()
+	if size == 0 {
+		return nil
+	}
+	total := size
+	var segs []*udpPacket
+	for len(segs)+1 < maxGROSegments {
+		s := e.rcvList.Front()
+		if s == nil || s.senderAddress != p.senderAddress || s.destinationAddress != p.destinationAddress {
+			break
+		}
+		sSize := s.pkt.Data().Size()
+		if sSize == 0 || sSize > size || total+sSize > header.UDPMaximumSize-header.UDPMinimumSize {
+			break
+		}
+		e.rcvList.Remove(s)
+		e.rcvBufSize -= sSize
+		segs = append(segs, s)
+		total += sSize
+		if sSize < size {
+			break
+		}
+	}
+	return segs
+}
+
 // prepareForWriteInner prepares the endpoint for sending data. In particular,
 // it binds it if it's still in the initial state. To do so, it must first
 // reacquire the mutex in exclusive mode.
@@ -432,6 +520,31 @@ func (e *endpoint) prepareForWrite(p tcpip.Payloader, opts tcpip.WriteOptions) (
 		return udpPacketInfo{}, &tcpip.ErrMessageTooLong{}
 	}
 
+	// Datagrams that don't fit in the path MTU fail instead of being
+	// fragmented if path MTU discovery is in the "do" or "probe" mode. Like
+	// Linux, the error reports the MTU when IP_RECVERR is set.
+	if ctx.MustNotFragment() && header.UDPMinimumSize+p.Len() > int(ctx.MTU()) {
+		so := e.SocketOptions()
+		netProto := ctx.PacketInfo().NetProto
+		hdrLen := uint32(header.IPv4MinimumSize)
+		recvErr := so.GetIPv4RecvError()
+		if netProto == header.IPv6ProtocolNumber {
+			hdrLen = header.IPv6MinimumSize
+			recvErr = so.GetIPv6RecvError()
+		}
+		if recvErr {
+			so.QueueLocalErr(
+				&tcpip.ErrMessageTooLong{},
+				netProto,
+				ctx.MTU()+hdrLen,
+				dst,
+				nil,
+			)
+		}
+		ctx.Release()
+		return udpPacketInfo{}, &tcpip.ErrMessageTooLong{}
+	}
+
 	return udpPacketInfo{
 		ctx:        ctx,
 		localPort:  e.localPort,
@@ -463,12 +576,69 @@ func (e *endpoint) write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, tcp
 
 	dataSz := p.Len()
 	pktInfo := udpInfo.ctx.PacketInfo()
+	gsoSize := int(e.gsoSize.Load())
+	if opts.ControlMessages.HasGSOSize {
+		gsoSize = int(opts.ControlMessages.GSOSize)
+	}
+	if gsoSize != 0 && dataSz > gsoSize {
+		// As in Linux, segmentation requires segments which fit in the
+		// MTU, at most maxSegments of them and, for IPv4, checksums.
+		if header.UDPMinimumSize+gsoSize > int(udpInfo.ctx.MTU()) || dataSz > gsoSize*maxSegments {
+			return 0, &tcpip.ErrInvalidOptionValue{}
+		}
+		if e.ops.GetNoChecksum() && pktInfo.NetProto == header.IPv4ProtocolNumber {
+			return 0, &tcpip.ErrInvalidOptionValue{}
+		}
+	} else {
+		gsoSize = 0
+	}
+
 	pkt := udpInfo.ctx.TryNewPacketBufferFromPayloader(header.UDPMinimumSize+int(pktInfo.MaxHeaderLength), p)
 	if pkt == nil {
 		return 0, &tcpip.ErrWouldBlock{}
 	}
 	defer pkt.DecRef()
 
+	if gsoSize != 0 {
+		maxSize := udpInfo.ctx.HostGSOMaxSize()
+		if maxSize != 0 && header.UDPMinimumSize+dataSz <= int(maxSize) {
+			// Let the host split the datagram.
+			l3HdrLen := header.IPv4MinimumSize
+			if pktInfo.NetProto == header.IPv6ProtocolNumber {
+				l3HdrLen = header.IPv6MinimumSize
+			}
+			pkt.GSOOptions = stack.GSO{
+				Type:       stack.GSOUDPL4,
+				NeedsCsum:  true,
+				CsumOffset: header.UDPChecksumOffset,
+				MSS:        uint16(gsoSize),
+				L3HdrLen:   uint16(l3HdrLen),
+				MaxSize:    maxSize,
+			}
+		} else {
+			// Split the datagram in software. The original packet
+			// carries the last segment.
+			for pkt.Data().Size() > gsoSize {
+				seg := stack.NewPacketBuffer(stack.PacketBufferOptions{ReserveHeaderBytes: pkt.AvailableHeaderBytes()})
+				seg.Data().ReadFromPacketData(pkt.Data(), gsoSize)
+				err := e.writeDatagram(udpInfo, seg)
+				seg.DecRef()
+				if err != nil {
+					return 0, err
+				}
+			}
+		}
+	}
+	if err := e.writeDatagram(udpInfo, pkt); err != nil {
+		return 0, err
+	}
+	return int64(dataSz), nil
+}
+
+// writeDatagram adds the UDP header to pkt and writes it.
+func (e *endpoint) writeDatagram(udpInfo udpPacketInfo, pkt *stack.PacketBuffer) tcpip.Error {
+	pktInfo := udpInfo.ctx.PacketInfo()
+
 	// Initialize the UDP header.
 	udp := header.UDP(pkt.TransportHeader().Push(header.UDPMinimumSize))
 	pkt.TransportProtocolNumber = ProtocolNumber
@@ -480,12 +650,16 @@ func (e *endpoint) write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, tcp
 		Length:  length,
 	})
 
-	// Set the checksum field unless TX checksum offload is enabled.
-	// On IPv4, UDP checksum is optional, and a zero value indicates the
-	// transmitter skipped the checksum generation (RFC768).
-	// On IPv6, UDP checksum is not optional (RFC2460 Section 8.1).
-	if pktInfo.RequiresTXTransportChecksum &&
+	if pkt.GSOOptions.Type != stack.GSONone && pkt.GSOOptions.NeedsCsum {
+		// The checksum is completed for each segment by the host, which
+		// only expects the pseudo-header checksum.
+		udp.SetChecksum(header.PseudoHeaderChecksum(ProtocolNumber, pktInfo.LocalAddress, pktInfo.RemoteAddress, length))
+	} else if pktInfo.RequiresTXTransportChecksum &&
 		(!e.ops.GetNoChecksum() || pktInfo.NetProto == header.IPv6ProtocolNumber) {
+		// Set the checksum field unless TX checksum offload is enabled.
+		// On IPv4, UDP checksum is optional, and a zero value indicates the
+		// transmitter skipped the checksum generation (RFC768).
+		// On IPv6, UDP checksum is not optional (RFC2460 Section 8.1).
 		xsum := udp.CalculateChecksum(checksum.Combine(
 			header.PseudoHeaderChecksum(ProtocolNumber, pktInfo.LocalAddress, pktInfo.RemoteAddress, length),
 			pkt.Data().Checksum(),
@@ -516,12 +690,12 @@ func (e *endpoint) write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, tcp
 	}
 	if err := udpInfo.ctx.WritePacket(pkt, false /* headerIncluded */); err != nil {
 		e.stack.Stats().UDP.PacketSendErrors.Increment()
-		return 0, err
+		return err
 	}
 
 	// Track count of packets sent.
 	e.stack.Stats().UDP.PacketsSent.Increment()
-	return int64(dataSz), nil
+	return nil
 }
 
 // OnReuseAddressSet implements tcpip.SocketOptionsHandler.
@@ -538,9 +712,37 @@ func (e *endpoint) OnReusePortSet(v bool) {
 	e.mu.Unlock()
 }
 
+// OnReusePortFilterSet implements tcpip.SocketOptionsHandler.
+func (e *endpoint) OnReusePortFilterSet(f tcpip.ReusePortFilter) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.localPort == 0 {
+		// The filter is applied when the endpoint is bound.
+		return
+	}
+	id := e.net.Info().ID
+	id.LocalPort = e.localPort
+	id.RemotePort = e.remotePort
+	e.stack.SetReusePortFilter(e.effectiveNetProtos, ProtocolNumber, id, e, e.boundBindToDevice, f)
+}
+
 // SetSockOptInt implements tcpip.Endpoint.
 func (e *endpoint) SetSockOptInt(opt tcpip.SockOptInt, v int) tcpip.Error {
-	return e.net.SetSockOptInt(opt, v)
+	switch opt {
+	case tcpip.UDPSegmentOption:
+		if v < 0 || v > math.MaxUint16 {
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+		e.gsoSize.Store(uint32(v))
+		return nil
+
+	case tcpip.UDPGROOption:
+		e.groEnabled.Store(v != 0)
+		return nil
+
+	default:
+		return e.net.SetSockOptInt(opt, v)
+	}
 }
 
 var _ tcpip.SocketOptionsHandler = (*endpoint)(nil)
@@ -568,6 +770,21 @@ func (e *endpoint) GetSockOptInt(opt tcpip.SockOptInt) (int, tcpip.Error) {
 		e.rcvMu.Unlock()
 		return v, nil
 
+	case tcpip.UDPSegmentOption:
+		return int(e.gsoSize.Load()), nil
+
+	case tcpip.UDPGROOption:
+		if e.groEnabled.Load() {
+			return 1, nil
+		}
+		return 0, nil
+
+	case tcpip.FlowHashOption:
+		if e.net.State() != transport.DatagramEndpointStateConnected {
+			return -1, &tcpip.ErrNotConnected{}
+		}
+		return int(e.stack.FlowHash(e.net.Info().ID)), nil
+
 	default:
 		return e.net.GetSockOptInt(opt)
 	}
@@ -781,8 +998,12 @@ func (e *endpoint) registerWithStack(netProtos []tcpip.NetworkProtocolNumber, id
 		}
 		e.stack.ReleasePort(portRes)
 		e.boundPortFlags = ports.Flags{}
+		return id, bindToDevice, err
+	}
+	if f := e.ops.GetReusePortFilter(); f != nil {
+		e.stack.SetReusePortFilter(netProtos, ProtocolNumber, id, e, bindToDevice, f)
 	}
-	return id, bindToDevice, err
+	return id, bindToDevice, nil
 }
 
 func (e *endpoint) bindLocked(addr tcpip.FullAddress) tcpip.Error {
@@ -917,6 +1138,14 @@ func (e *endpoint) HandlePacket(id stack.TransportEndpointID, pkt *stack.PacketB
 	if !csumValid {
 		e.stack.Stats().UDP.ChecksumErrors.Increment()
 		e.stats.ReceiveErrors.ChecksumErrors.Increment()
+		e.drops.Add(1)
+		return
+	}
+
+	// Only transparent endpoints may receive packets redirected by a TPROXY
+	// target.
+	if pkt.NetworkPacketInfo.TProxy.Port != 0 && !e.ops.GetTransparent() {
+		e.stack.Stats().DroppedPackets.Increment()
 		return
 	}
 
@@ -929,6 +1158,7 @@ func (e *endpoint) HandlePacket(id stack.TransportEndpointID, pkt *stack.PacketB
 		e.rcvMu.Unlock()
 		e.stack.Stats().UDP.ReceiveBufferErrors.Increment()
 		e.stats.ReceiveErrors.ClosedReceiver.Increment()
+		e.drops.Add(1)
 		return
 	}
 
@@ -938,6 +1168,7 @@ func (e *endpoint) HandlePacket(id stack.TransportEndpointID, pkt *stack.PacketB
 		e.rcvMu.Unlock()
 		e.stack.Stats().UDP.ReceiveBufferErrors.Increment()
 		e.stats.ReceiveErrors.ReceiveBufferOverflow.Increment()
+		e.drops.Add(1)
 		return
 	}
 
@@ -958,7 +1189,8 @@ func (e *endpoint) HandlePacket(id stack.TransportEndpointID, pkt *stack.PacketB
 		},
 		// We need to clone the packet because ReadTo modifies the write index of
 		// the underlying buffer. Clone does not copy the data, just the metadata.
-		pkt: pkt.Clone(),
+		pkt:       pkt.Clone(),
+		dropCount: e.drops.Load(),
 	}
 	e.rcvList.PushBack(packet)
 	e.rcvBufSize += pkt.Data().Size()
@@ -989,22 +1221,18 @@ func (e *endpoint) HandlePacket(id stack.TransportEndpointID, pkt *stack.PacketB
 	}
 }
 
-func (e *endpoint) onICMPError(err tcpip.Error, transErr stack.TransportError, pkt *stack.PacketBuffer) {
+// HandleError implements stack.TransportEndpoint.
+func (e *endpoint) HandleError(id stack.TransportEndpointID, transErr stack.TransportError, pkt *stack.PacketBuffer) {
+	err, recvErr := e.net.ICMPError(transErr, pkt)
+	if err == nil {
+		return
+	}
+
 	// Update last error first.
 	e.lastErrorMu.Lock()
 	e.lastError = err
 	e.lastErrorMu.Unlock()
 
-	var recvErr bool
-	switch pkt.NetworkProtocolNumber {
-	case header.IPv4ProtocolNumber:
-		recvErr = e.SocketOptions().GetIPv4RecvError()
-	case header.IPv6ProtocolNumber:
-		recvErr = e.SocketOptions().GetIPv6RecvError()
-	default:
-		panic(fmt.Sprintf("unhandled network protocol number = %d", pkt.NetworkProtocolNumber))
-	}
-
 	if recvErr {
 		// Linux passes the payload without the UDP header.
 		payload := pkt.Data().AsRange().ToView()
@@ -1013,8 +1241,6 @@ func (e *endpoint) onICMPError(err tcpip.Error, transErr stack.TransportError, p
 			payload.TrimFront(header.UDPMinimumSize)
 		}
 
-		id := e.net.Info().ID
-		e.mu.RLock()
 		e.SocketOptions().QueueErr(&tcpip.SockError{
 			Err:     err,
 			Cause:   transErr,
@@ -1022,33 +1248,17 @@ func (e *endpoint) onICMPError(err tcpip.Error, transErr stack.TransportError, p
 			Dst: tcpip.FullAddress{
 				NIC:  pkt.NICID,
 				Addr: id.RemoteAddress,
-				Port: e.remotePort,
-			},
-			Offender: tcpip.FullAddress{
-				NIC:  pkt.NICID,
-				Addr: id.LocalAddress,
-				Port: e.localPort,
+				Port: id.RemotePort,
 			},
+			Offender: network.ICMPErrorOffender(id, pkt),
 			NetProto: pkt.NetworkProtocolNumber,
 		})
-		e.mu.RUnlock()
 	}
 
 	// Notify of the error.
 	e.waiterQueue.Notify(waiter.EventErr)
 }
 
-// HandleError implements stack.TransportEndpoint.
-func (e *endpoint) HandleError(transErr stack.TransportError, pkt *stack.PacketBuffer) {
-	// TODO(gvisor.dev/issues/5270): Handle all transport errors.
-	switch transErr.Kind() {
-	case stack.DestinationPortUnreachableTransportError:
-		if e.net.State() == transport.DatagramEndpointStateConnected {
-			e.onICMPError(&tcpip.ErrConnectionRefused{}, transErr, pkt)
-		}
-	}
-}
-
 // State implements tcpip.Endpoint.
 func (e *endpoint) State() uint32 {
 	return uint32(e.net.State())
@@ -2293,6 +2293,69 @@ func TestWritePayloadSizeTooBig(t *testing.T) {
 	}
 }
 
+func TestMTUDiscover(t *testing.T) {
+	const mtu = 1500
+	tests := []struct {
+		name     string
+		strategy tcpip.PMTUDStrategy
+		wantDF   bool
+		wantErr  tcpip.Error
+	}{
+		{name: "dont", strategy: tcpip.PMTUDiscoveryDont},
+		{name: "want", strategy: tcpip.PMTUDiscoveryWant, wantDF: true},
+		{name: "do", strategy: tcpip.PMTUDiscoveryDo, wantDF: true, wantErr: &tcpip.ErrMessageTooLong{}},
+		{name: "probe", strategy: tcpip.PMTUDiscoveryProbe, wantDF: true, wantErr: &tcpip.ErrMessageTooLong{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := context.NewWithOptions(t, []stack.TransportProtocolFactory{udp.NewProtocol, icmp.NewProtocol6, icmp.NewProtocol4}, context.Options{
+				MTU:         mtu,
+				HandleLocal: true,
+			})
+			defer c.Cleanup()
+
+			c.CreateEndpointForFlow(context.UnicastV4, udp.ProtocolNumber)
+
+			if err := c.EP.SetSockOptInt(tcpip.MTUDiscoverOption, int(test.strategy)); err != nil {
+				c.T.Fatalf("SetSockOptInt(MTUDiscoverOption, %d) failed: %s", test.strategy, err)
+			}
+			if v, err := c.EP.GetSockOptInt(tcpip.MTUDiscoverOption); err != nil || v != int(test.strategy) {
+				c.T.Fatalf("got GetSockOptInt(MTUDiscoverOption) = (%d, %v), want = (%d, nil)", v, err, test.strategy)
+			}
+
+			var flags uint8
+			if test.wantDF {
+				flags = header.IPv4FlagDontFragment
+			}
+			testWriteSucceedsAndGetReceivedSrcPort(c, context.UnicastV4, checker.FragmentFlags(flags))
+
+			if test.wantErr != nil {
+				testWriteFails(c, context.UnicastV4, mtu-header.IPv4MinimumSize-header.UDPMinimumSize+1, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestIPv6MTUOption(t *testing.T) {
+	c := context.New(t, []stack.TransportProtocolFactory{udp.NewProtocol, icmp.NewProtocol6, icmp.NewProtocol4})
+	defer c.Cleanup()
+
+	c.CreateEndpointForFlow(context.UnicastV6, udp.ProtocolNumber)
+
+	if err := c.EP.SetSockOptInt(tcpip.IPv6MTUOption, header.IPv6MinimumMTU-1); err != (&tcpip.ErrInvalidOptionValue{}) {
+		c.T.Fatalf("got SetSockOptInt(IPv6MTUOption, %d) = %v, want = %s", header.IPv6MinimumMTU-1, err, &tcpip.ErrInvalidOptionValue{})
+	}
+	if err := c.EP.SetSockOptInt(tcpip.IPv6MTUOption, header.IPv6MinimumMTU); err != nil {
+		c.T.Fatalf("SetSockOptInt(IPv6MTUOption, %d) failed: %s", header.IPv6MinimumMTU, err)
+	}
+	if err := c.EP.SetSockOptInt(tcpip.MTUDiscoverOption, int(tcpip.PMTUDiscoveryDo)); err != nil {
+		c.T.Fatalf("SetSockOptInt(MTUDiscoverOption, %d) failed: %s", tcpip.PMTUDiscoveryDo, err)
+	}
+
+	testWriteSucceedsAndGetReceivedSrcPort(c, context.UnicastV6)
+	testWriteFails(c, context.UnicastV6, header.IPv6MinimumMTU-header.IPv6MinimumSize-header.UDPMinimumSize+1, &tcpip.ErrMessageTooLong{})
+}
+
 func TestSetExperimentOption(t *testing.T) {
 	opts := context.Options{
 		EnableExperimentIPOption: true,
@@ -2372,6 +2435,162 @@ func TestSetExperimentOptionIPv6(t *testing.T) {
 	checker.IPv6WithExtHdr(t, v, checker.IPv6ExtHdr(checker.IPv6ExperimentHeader(expval)))
 }
 
+func TestUDPSegment(t *testing.T) {
+	const (
+		gsoSize     = 1000
+		payloadSize = 3*gsoSize + 123
+	)
+	for _, flow := range []context.TestFlow{context.UnicastV4, context.UnicastV6} {
+		for _, useCmsg := range []bool{false, true} {
+			t.Run(fmt.Sprintf("flow:%s/cmsg:%t", flow, useCmsg), func(t *testing.T) {
+				c := context.New(t, []stack.TransportProtocolFactory{udp.NewProtocol, icmp.NewProtocol6, icmp.NewProtocol4})
+				defer c.Cleanup()
+
+				c.CreateEndpointForFlow(flow, udp.ProtocolNumber)
+
+				writeOpts := getWriteOptionsForFlow(flow)
+				if useCmsg {
+					writeOpts.ControlMessages.HasGSOSize = true
+					writeOpts.ControlMessages.GSOSize = gsoSize
+				} else if err := c.EP.SetSockOptInt(tcpip.UDPSegmentOption, gsoSize); err != nil {
+					t.Fatalf("SetSockOptInt(UDPSegmentOption, %d): %s", gsoSize, err)
+				}
+
+				payload := newRandomPayload(payloadSize)
+				var r bytes.Reader
+				r.Reset(payload)
+				n, err := c.EP.Write(&r, writeOpts)
+				if err != nil {
+					t.Fatalf("Write failed: %s", err)
+				}
+				if n != payloadSize {
+					t.Fatalf("got Write(...) = %d, want = %d", n, payloadSize)
+				}
+
+				h := flow.MakeHeader4Tuple(context.Outgoing)
+				for len(payload) > 0 {
+					want := payload
+					if len(want) > gsoSize {
+						want = want[:gsoSize]
+					}
+					payload = payload[len(want):]
+
+					p := c.LinkEP.Read()
+					if p == nil {
+						t.Fatalf("Segment wasn't written out, %d bytes left", len(want)+len(payload))
+					}
+					v := p.ToView()
+					p.DecRef()
+					flow.CheckerFn()(t, v.AsSlice(),
+						checker.SrcAddr(h.Src.Addr),
+						checker.DstAddr(h.Dst.Addr),
+						checker.UDP(checker.DstPort(h.Dst.Port)),
+					)
+					var udpH header.UDP
+					if flow.IsV4() {
+						udpH = header.IPv4(v.AsSlice()).Payload()
+					} else {
+						udpH = header.IPv6(v.AsSlice()).Payload()
+					}
+					if !bytes.Equal(want, udpH.Payload()) {
+						t.Errorf("got segment payload = %x, want = %x", udpH.Payload(), want)
+					}
+					if !udpH.IsChecksumValid(h.Src.Addr, h.Dst.Addr, checksum.Checksum(udpH.Payload(), 0)) {
+						t.Errorf("segment has invalid checksum %#x", udpH.Checksum())
+					}
+					v.Release()
+				}
+				if p := c.LinkEP.Read(); p != nil {
+					p.DecRef()
+					t.Fatal("got unexpected extra segment")
+				}
+			})
+		}
+	}
+}
+
+func TestUDPSegmentInvalid(t *testing.T) {
+	c := context.New(t, []stack.TransportProtocolFactory{udp.NewProtocol, icmp.NewProtocol6, icmp.NewProtocol4})
+	defer c.Cleanup()
+
+	c.CreateEndpointForFlow(context.UnicastV4, udp.ProtocolNumber)
+
+	if err := c.EP.SetSockOptInt(tcpip.UDPSegmentOption, math.MaxUint16+1); err == nil {
+		t.Errorf("SetSockOptInt(UDPSegmentOption, %d) succeeded, want error", math.MaxUint16+1)
+	}
+
+	// Writes can't be split into more than 128 segments.
+	if err := c.EP.SetSockOptInt(tcpip.UDPSegmentOption, 10); err != nil {
+		t.Fatalf("SetSockOptInt(UDPSegmentOption, 10): %s", err)
+	}
+	testWriteFails(c, context.UnicastV4, 10*128+1, &tcpip.ErrInvalidOptionValue{})
+}
+
+func TestUDPGRO(t *testing.T) {
+	for _, flow := range []context.TestFlow{context.UnicastV4, context.UnicastV6} {
+		t.Run(fmt.Sprintf("flow:%s", flow), func(t *testing.T) {
+			c := context.New(t, []stack.TransportProtocolFactory{udp.NewProtocol, icmp.NewProtocol6, icmp.NewProtocol4})
+			defer c.Cleanup()
+
+			c.CreateEndpointForFlow(flow, udp.ProtocolNumber)
+			if err := c.EP.Bind(tcpip.FullAddress{Port: context.StackPort}); err != nil {
+				t.Fatalf("Bind failed: %s", err)
+			}
+			if err := c.EP.SetSockOptInt(tcpip.UDPGROOption, 1); err != nil {
+				t.Fatalf("SetSockOptInt(UDPGROOption, 1): %s", err)
+			}
+
+			// Datagrams of the same size, followed by a smaller one, are
+			// coalesced. The datagram following the smaller one isn't.
+			var payload []byte
+			for _, size := range []int{arbitraryPayloadSize, arbitraryPayloadSize, arbitraryPayloadSize / 2} {
+				p := newRandomPayload(size)
+				c.InjectPacket(flow.NetProto(), context.BuildUDPPacket(p, flow, context.Incoming, testTOS, testTTL, false))
+				payload = append(payload, p...)
+			}
+			last := newRandomPayload(arbitraryPayloadSize)
+			c.InjectPacket(flow.NetProto(), context.BuildUDPPacket(last, flow, context.Incoming, testTOS, testTTL, false))
+
+			c.ReadFromEndpointExpectSuccess(payload, flow, func(t *testing.T, cm tcpip.ReceivableControlMessages) {
+				t.Helper()
+				if !cm.HasGROSize || cm.GROSize != arbitraryPayloadSize {
+					t.Errorf("got (HasGROSize, GROSize) = (%t, %d), want = (true, %d)", cm.HasGROSize, cm.GROSize, arbitraryPayloadSize)
+				}
+			})
+			c.ReadFromEndpointExpectSuccess(last, flow, func(t *testing.T, cm tcpip.ReceivableControlMessages) {
+				t.Helper()
+				if cm.HasGROSize {
+					t.Errorf("got HasGROSize = true for a single datagram")
+				}
+			})
+		})
+	}
+}
+
+func TestReceiveDropCount(t *testing.T) {
+	c := context.New(t, []stack.TransportProtocolFactory{udp.NewProtocol, icmp.NewProtocol6, icmp.NewProtocol4})
+	defer c.Cleanup()
+
+	flow := context.UnicastV4
+	c.CreateEndpointForFlow(flow, udp.ProtocolNumber)
+	if err := c.EP.Bind(tcpip.FullAddress{Port: context.StackPort}); err != nil {
+		t.Fatalf("Bind failed: %s", err)
+	}
+	c.EP.SocketOptions().SetReceiveDropCount(true)
+
+	// Drop a datagram with an invalid checksum.
+	c.InjectPacket(flow.NetProto(), context.BuildUDPPacket(newRandomPayload(arbitraryPayloadSize), flow, context.Incoming, testTOS, testTTL, true))
+
+	payload := newRandomPayload(arbitraryPayloadSize)
+	c.InjectPacket(flow.NetProto(), context.BuildUDPPacket(payload, flow, context.Incoming, testTOS, testTTL, false))
+	c.ReadFromEndpointExpectSuccess(payload, flow, func(t *testing.T, cm tcpip.ReceivableControlMessages) {
+		t.Helper()
+		if !cm.HasDropCount || cm.DropCount != 1 {
+			t.Errorf("got (HasDropCount, DropCount) = (%t, %d), want = (true, 1)", cm.HasDropCount, cm.DropCount)
+		}
+	})
+}
+
 func TestMain(m *testing.M) {
 	refs.SetLeakMode(refs.LeaksPanic)
 	code := m.Run()
@@ -0,0 +1,484 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package urpc
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+
+	"github.com/wilinz/gvisor/pkg/log"
+	"github.com/wilinz/gvisor/pkg/sync"
+	"github.com/wilinz/gvisor/pkg/unet"
+)
+
+// streamWindow is the number of messages that a stream buffers on the
+// receiving side. It is the credit given to the sender when a stream starts,
+// and more credit is granted as the receiver consumes messages.
+const streamWindow = 16
+
+// maxFrameSize is the maximum size of a stream frame. This limit is arbitrary.
+const maxFrameSize = 16 << 20
+
+// ErrStreamClosed is returned when sending on a stream that has been closed.
+var ErrStreamClosed = errors.New("stream closed")
+
+// streamFrame is the unit of data exchanged on a streaming call, in both
+// directions.
+//
+// Unlike call and result messages, frames are prefixed with their length, so
+// that a peer can send several of them without waiting for a reply, and each
+// frame carries its own files.
+//
+// A stream ends with an End frame from the server, sent when the method
+// returns, which is answered by a Close frame from the client. Neither side
+// sends anything after that, and the connection can be used for other calls.
+type streamFrame struct {
+	// Data is the message, if any.
+	Data json.RawMessage `json:"data,omitempty"`
+
+	// Credit is the number of additional messages that the sender of the
+	// frame is ready to receive.
+	Credit int `json:"credit,omitempty"`
+
+	// End indicates that the sender won't send more messages.
+	End bool `json:"end,omitempty"`
+
+	// Cancel is sent by the client with End to ask the server to stop
+	// sending messages.
+	Cancel bool `json:"cancel,omitempty"`
+
+	// Close is the last frame of the client.
+	Close bool `json:"close,omitempty"`
+
+	// Err is the error returned by the method. It is only set on the End
+	// frame of the server.
+	Err string `json:"err,omitempty"`
+}
+
+// streamMessage is a received message.
+type streamMessage struct {
+	data  json.RawMessage
+	files []*os.File
+}
+
+// Stream is a sequence of messages exchanged in both directions during a
+// streaming call. Messages may embed a FilePayload to pass files, like call
+// arguments and results.
+//
+// A method is a streaming method if its second argument is a *Stream instead
+// of a result. The server side of the stream ends when the method returns.
+// The client gets a Stream from Client.CallStream.
+//
+// Send and Recv may be called concurrently, but messages are only ordered
+// with respect to a single sending goroutine.
+type Stream struct {
+	sock   *unet.Socket
+	client bool
+
+	// release is called by Close on the client to allow other calls.
+	release func()
+
+	// done is closed when the goroutine reading frames exits.
+	done chan struct{}
+
+	// wmu serializes frame writes.
+	wmu sync.Mutex
+
+	// finished is true once the last frame has been written.
+	//
+	// +checklocks:wmu
+	finished bool
+
+	mu   sync.Mutex
+	cond sync.Cond
+
+	// credit is the number of messages that can be sent before the peer
+	// grants more credit.
+	//
+	// +checklocks:mu
+	credit int
+
+	// consumed is the number of messages received since credit was last
+	// granted to the peer.
+	//
+	// +checklocks:mu
+	consumed int
+
+	// recvq is the queue of messages that have been received, but not yet
+	// returned by Recv.
+	//
+	// +checklocks:mu
+	recvq []streamMessage
+
+	// recvDone is true when the peer won't send more messages, and recvErr
+	// is the error that Recv returns after the queued messages.
+	//
+	// +checklocks:mu
+	recvDone bool
+	// +checklocks:mu
+	recvErr error
+
+	// sendDone is true when no more messages can be sent, and sendErr is
+	// the error that Send returns.
+	//
+	// +checklocks:mu
+	sendDone bool
+	// +checklocks:mu
+	sendErr error
+}
+
+// newStream returns a stream over sock, with the given initial credit.
+func newStream(sock *unet.Socket, client bool, credit int) *Stream {
+	s := &Stream{
+		sock:   sock,
+		client: client,
+		done:   make(chan struct{}),
+		credit: credit,
+	}
+	s.cond.L = &s.mu
+	return s
+}
+
+// Send sends a message to the peer. It blocks while the peer has too many
+// messages to process.
+func (s *Stream) Send(msg any) error {
+	var fs []*os.File
+	if fp, ok := msg.(filePayloader); ok {
+		fs = fp.filePayload()
+		if len(fs) > maxFiles {
+			return ErrTooManyFiles
+		}
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	for s.credit == 0 && !s.sendDone {
+		s.cond.Wait()
+	}
+	if s.sendDone {
+		err := s.sendErr
+		s.mu.Unlock()
+		return err
+	}
+	s.credit--
+	s.mu.Unlock()
+
+	return s.writeFrame(&streamFrame{Data: data}, fs)
+}
+
+// Recv receives the next message from the peer into msg. It returns io.EOF
+// once the peer has no more messages to send, or the error returned by the
+// method on the client.
+func (s *Stream) Recv(msg any) error {
+	s.mu.Lock()
+	for len(s.recvq) == 0 && !s.recvDone {
+		s.cond.Wait()
+	}
+	if len(s.recvq) == 0 {
+		err := s.recvErr
+		s.mu.Unlock()
+		return err
+	}
+	m := s.recvq[0]
+	s.recvq = s.recvq[1:]
+	grant := 0
+	if s.consumed++; s.consumed >= streamWindow/2 && !s.recvDone {
+		grant = s.consumed
+		s.consumed = 0
+	}
+	s.mu.Unlock()
+
+	if grant > 0 {
+		// If this fails, the stream is closing and the peer doesn't
+		// need credit anymore.
+		s.writeFrame(&streamFrame{Credit: grant}, nil)
+	}
+	if err := json.Unmarshal(m.data, msg); err != nil {
+		closeAll(m.files)
+		return err
+	}
+	if fp, ok := msg.(filePayloader); ok {
+		fp.setFilePayload(m.files)
+	} else {
+		closeAll(m.files)
+	}
+	return nil
+}
+
+// CloseSend tells the server that the client won't send more messages, after
+// which Recv returns io.EOF on the server. The client can still receive
+// messages. The server ends its side of the stream by returning from the
+// method instead.
+func (s *Stream) CloseSend() error {
+	if !s.client {
+		return fmt.Errorf("urpc: CloseSend called on the server side of a stream")
+	}
+	s.mu.Lock()
+	if s.sendDone {
+		s.mu.Unlock()
+		return nil
+	}
+	s.sendDone = true
+	s.sendErr = ErrStreamClosed
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	return s.writeFrame(&streamFrame{End: true}, nil)
+}
+
+// Close ends a stream on the client. If the method hasn't returned yet, it is
+// asked to stop sending messages, and Close waits for it to return. Messages
+// that haven't been received are discarded.
+//
+// Close returns the error returned by the method, if any. The client can make
+// other calls after Close returns.
+func (s *Stream) Close() error {
+	if !s.client {
+		return fmt.Errorf("urpc: Close called on the server side of a stream")
+	}
+	s.mu.Lock()
+	cancel := !s.recvDone
+	sendDone := s.sendDone
+	s.sendDone = true
+	if s.sendErr == nil {
+		s.sendErr = ErrStreamClosed
+	}
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	if cancel {
+		s.writeFrame(&streamFrame{End: !sendDone, Cancel: true}, nil)
+	}
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropMessagesLocked()
+	if s.release != nil {
+		s.release()
+		s.release = nil
+	}
+	if s.recvErr == io.EOF {
+		return nil
+	}
+	return s.recvErr
+}
+
+// finish ends a stream on the server after the method returned err. It
+// returns an error if the connection to the client failed.
+func (s *Stream) finish(err error) error {
+	s.mu.Lock()
+	s.sendDone = true
+	if s.sendErr == nil {
+		s.sendErr = ErrStreamClosed
+	}
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	end := streamFrame{End: true}
+	if err != nil {
+		end.Err = err.Error()
+	}
+	writeErr := s.writeFrame(&end, nil)
+	// Wait for the Close frame of the client.
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropMessagesLocked()
+	if writeErr != nil {
+		return writeErr
+	}
+	if s.recvErr != io.EOF && s.recvErr != ErrStreamClosed {
+		return s.recvErr
+	}
+	return nil
+}
+
+// dropMessagesLocked discards the messages that haven't been received.
+//
+// +checklocks:s.mu
+func (s *Stream) dropMessagesLocked() {
+	for _, m := range s.recvq {
+		closeAll(m.files)
+	}
+	s.recvq = nil
+}
+
+// shutdown interrupts the stream by shutting down the connection.
+func (s *Stream) shutdown() {
+	s.sock.Shutdown()
+}
+
+// writeFrame writes a frame to the peer, unless the last frame was already
+// written.
+func (s *Stream) writeFrame(f *streamFrame, fs []*os.File) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	if s.finished {
+		return ErrStreamClosed
+	}
+	if f.Close || (f.End && !s.client) {
+		s.finished = true
+	}
+	return marshalFrame(s.sock, f, fs)
+}
+
+// readFrames receives frames from the peer until the end of the stream.
+func (s *Stream) readFrames() {
+	defer close(s.done)
+	for {
+		var f streamFrame
+		fs, err := unmarshalFrame(s.sock, &f)
+		if err != nil {
+			if err == io.EOF {
+				// Streams end with a frame, not by closing the
+				// connection.
+				err = io.ErrUnexpectedEOF
+			}
+			s.mu.Lock()
+			s.recvDone = true
+			s.recvErr = err
+			s.sendDone = true
+			s.sendErr = err
+			s.cond.Broadcast()
+			s.mu.Unlock()
+			return
+		}
+
+		s.mu.Lock()
+		s.credit += f.Credit
+		if f.Data != nil && !s.recvDone {
+			s.recvq = append(s.recvq, streamMessage{data: f.Data, files: fs})
+		} else {
+			// Files are only sent with messages, and messages
+			// received after the end of the stream are discarded.
+			closeAll(fs)
+		}
+		if f.Cancel || (s.client && f.End) {
+			// Nobody will receive messages sent from now on.
+			s.sendDone = true
+			if s.sendErr == nil {
+				s.sendErr = ErrStreamClosed
+			}
+		}
+		if f.End && !s.recvDone {
+			s.recvDone = true
+			s.recvErr = io.EOF
+			if f.Err != "" {
+				s.recvErr = RemoteError{Message: f.Err}
+			}
+		}
+		s.cond.Broadcast()
+		s.mu.Unlock()
+
+		switch {
+		case s.client && f.End:
+			// The method returned. Let the server know that the
+			// connection is free again.
+			s.writeFrame(&streamFrame{Close: true}, nil)
+			return
+		case !s.client && f.Close:
+			return
+		}
+	}
+}
+
+// marshalFrame sends a frame and the given files.
+func marshalFrame(s *unet.Socket, f *streamFrame, fs []*os.File) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	var hdr [4]byte
+	binary.LittleEndian.PutUint32(hdr[:], uint32(len(data)))
+
+	w := s.Writer(true)
+	if fs != nil {
+		var fds []int
+		for _, f := range fs {
+			fds = append(fds, int(f.Fd()))
+		}
+		w.PackFDs(fds...)
+	}
+	bufs := [][]byte{hdr[:], data}
+	for len(bufs) > 0 {
+		n, err := w.WriteVec(bufs)
+		// Files are sent with the first bytes of the frame.
+		w.PackFDs()
+		if err != nil {
+			log.Warningf("urpc: error writing stream frame: %v", err)
+			return err
+		}
+		for n > 0 {
+			if n < len(bufs[0]) {
+				bufs[0] = bufs[0][n:]
+				break
+			}
+			n -= len(bufs[0])
+			bufs = bufs[1:]
+		}
+	}
+	// See marshal.
+	runtime.KeepAlive(fs)
+	return nil
+}
+
+// unmarshalFrame receives a frame and the files sent with it.
+func unmarshalFrame(s *unet.Socket, f *streamFrame) ([]*os.File, error) {
+	var hdr [4]byte
+	r := s.Reader(true)
+	r.EnableFDs(maxFiles)
+	n, err := r.ReadVec([][]byte{hdr[:]})
+	if err != nil {
+		return nil, err
+	}
+	fds, err := r.ExtractFDs()
+	if err != nil {
+		log.Warningf("urpc: error extracting fds: %s", err.Error())
+		return nil, err
+	}
+	var fs []*os.File
+	for _, fd := range fds {
+		fs = append(fs, os.NewFile(uintptr(fd), "urpc"))
+	}
+
+	if _, err := io.ReadFull(s, hdr[n:]); err != nil {
+		closeAll(fs)
+		return nil, err
+	}
+	size := binary.LittleEndian.Uint32(hdr[:])
+	if size > maxFrameSize {
+		closeAll(fs)
+		return nil, fmt.Errorf("urpc: stream frame of %d bytes is too large", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(s, data); err != nil {
+		closeAll(fs)
+		return nil, err
+	}
+	if err := json.Unmarshal(data, f); err != nil {
+		closeAll(fs)
+		return nil, err
+	}
+	return fs, nil
+}
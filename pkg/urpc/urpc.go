@@ -15,7 +15,8 @@
 // Package urpc provides a minimal RPC package based on unet.
 //
 // RPC requests are _not_ concurrent and methods must be explicitly
-// registered. However, files may be send as part of the payload.
+// registered. However, files may be send as part of the payload. Methods may
+// also stream messages in both directions, see Stream.
 package urpc
 
 import (
@@ -109,12 +110,14 @@ type filePayloader interface {
 type clientCall struct {
 	Method string `json:"method"`
 	Arg    any    `json:"arg"`
+	Stream bool   `json:"stream,omitempty"`
 }
 
 // serverCall is the client=>server method call on the server side.
 type serverCall struct {
 	Method string          `json:"method"`
 	Arg    json.RawMessage `json:"arg"`
+	Stream bool            `json:"stream,omitempty"`
 }
 
 // callResult is the server=>client method call result.
@@ -137,6 +140,9 @@ type registeredMethod struct {
 
 	// resultType is also a type result.
 	resultType reflect.Type
+
+	// stream is true if the method takes a *Stream instead of a result.
+	stream bool
 }
 
 // clientState is client metadata.
@@ -177,6 +183,9 @@ type Server struct {
 	// clients is a map of clients.
 	clients map[*unet.Socket]clientState
 
+	// streams are the streams of the clients making a streaming call.
+	streams map[*unet.Socket]*Stream
+
 	// wg is a wait group for all outstanding clients.
 	wg sync.WaitGroup
 
@@ -195,6 +204,7 @@ func NewServerWithCallback(afterRPCCallback func()) *Server {
 	return &Server{
 		methods:          make(map[string]registeredMethod),
 		clients:          make(map[*unet.Socket]clientState),
+		streams:          make(map[*unet.Socket]*Stream),
 		afterRPCCallback: afterRPCCallback,
 	}
 }
@@ -208,7 +218,8 @@ type Stopper interface {
 // Register registers the given object as an RPC receiver.
 //
 // This functions is the same way as the built-in RPC package, but it does not
-// tolerate any object with non-conforming methods. Any non-confirming methods
+// tolerate any object with non-conforming methods. Methods whose second
+// argument is a *Stream are streaming methods. Any non-confirming methods
 // will lead to an immediate panic, instead of being skipped or an error.
 // Panics will also be generated by anonymous objects and duplicate entries.
 func (s *Server) Register(obj any) {
@@ -277,6 +288,7 @@ func (s *Server) Register(obj any) {
 			rcvr:       reflect.ValueOf(obj),
 			argType:    argType,
 			resultType: resultType,
+			stream:     resultType == reflect.TypeOf((*Stream)(nil)),
 		}
 	}
 }
@@ -323,14 +335,22 @@ func (s *Server) handleOne(client *unet.Socket) error {
 	if !ok {
 		// Try to serialize the error.
 		result.Err = ErrUnknownMethod.Error()
-		return marshal(client, &result, nil)
+		return replyError(client, &c, &result)
+	}
+	if rm.stream != c.Stream {
+		if rm.stream {
+			result.Err = fmt.Sprintf("method %s is a streaming method", c.Method)
+		} else {
+			result.Err = fmt.Sprintf("method %s is not a streaming method", c.Method)
+		}
+		return replyError(client, &c, &result)
 	}
 
 	// Unmarshal the arguments now that we know the type.
 	na := reflect.New(rm.argType.Elem())
 	if err := json.Unmarshal(c.Arg, na.Interface()); err != nil {
 		result.Err = err.Error()
-		return marshal(client, &result, nil)
+		return replyError(client, &c, &result)
 	}
 
 	// Set the file payload as an argument.
@@ -338,6 +358,10 @@ func (s *Server) handleOne(client *unet.Socket) error {
 		fp.setFilePayload(newFs)
 	}
 
+	if rm.stream {
+		return s.handleStream(client, rm, na, &result)
+	}
+
 	// Call the method.
 	re := reflect.New(rm.resultType.Elem())
 	rValues := rm.fn.Call([]reflect.Value{rm.rcvr, na, re})
@@ -363,6 +387,43 @@ func (s *Server) handleOne(client *unet.Socket) error {
 	return marshal(client, &result, fs)
 }
 
+// handleStream handles a call to a streaming method.
+func (s *Server) handleStream(client *unet.Socket, rm registeredMethod, na reflect.Value, result *callResult) error {
+	// The client may send messages as soon as it received its credit.
+	stream := newStream(client, false /* client */, streamWindow)
+	if err := stream.writeFrame(&streamFrame{Credit: streamWindow}, nil); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.streams[client] = stream
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.streams, client)
+		s.mu.Unlock()
+	}()
+	go stream.readFrames() // S/R-SAFE: out of scope
+
+	rValues := rm.fn.Call([]reflect.Value{rm.rcvr, na, reflect.ValueOf(stream)})
+	var err error
+	if errVal := rValues[0].Interface(); errVal != nil {
+		err = errVal.(error)
+		result.Err = err.Error()
+	} else {
+		result.Success = true
+	}
+	return stream.finish(err)
+}
+
+// replyError sends result, which holds an error, to the client. Streaming
+// calls get the error in an End frame.
+func replyError(client *unet.Socket, c *serverCall, result *callResult) error {
+	if c.Stream {
+		return marshalFrame(client, &streamFrame{End: true, Err: result.Err}, nil)
+	}
+	return marshal(client, result, nil)
+}
+
 func logRequest(c serverCall, result *callResult) {
 	if result.Err != "" {
 		log.Warningf("urpc: RPC call for method %s failed: %s", c.Method, result.Err)
@@ -484,7 +545,8 @@ func (s *Server) StartHandling(client *unet.Socket) {
 // timeout is the time for clients to complete pending RPCs. After timeout
 // expires, all clients are drained (i.e. their ongoing RPC is allowed to
 // complete) and closed. Any new RPCs will not be processed. Note that ongoing
-// RPCs are *not* interrupted or cancelled.
+// RPCs are *not* interrupted or cancelled, except for streaming calls, whose
+// connection is shut down so that Stream.Send and Stream.Recv fail.
 func (s *Server) Stop(timeout time.Duration) {
 	// Call any Stop callbacks.
 	for _, stopper := range s.stoppers {
@@ -515,6 +577,10 @@ func (s *Server) Stop(timeout time.Duration) {
 			case processing:
 				// Request close when done.
 				s.clients[client] = closeRequested
+				// Streams may not end by themselves.
+				if stream, ok := s.streams[client]; ok {
+					stream.shutdown()
+				}
 			}
 		}
 	}()
@@ -684,6 +750,53 @@ func (c *Client) Call(method string, arg any, result any) error {
 	return nil
 }
 
+// CallStream calls a streaming method, which exchanges messages with the
+// client through the returned Stream. arg may embed a FilePayload, as with
+// Call.
+//
+// No other call can be made with c until Stream.Close is called.
+func (c *Client) CallStream(method string, arg any) (*Stream, error) {
+	c.mu.Lock()
+	unlock := true
+	defer func() {
+		if unlock {
+			c.mu.Unlock()
+		}
+	}()
+
+	if _, ok := arg.(FilePayload); ok {
+		return nil, fmt.Errorf("argument is a FilePayload, but should be a *FilePayload")
+	}
+	var fs []*os.File
+	if fp, ok := arg.(filePayloader); ok {
+		fs = fp.filePayload()
+		if len(fs) > maxFiles {
+			return nil, ErrTooManyFiles
+		}
+	}
+	if err := marshal(c.Socket, &clientCall{Method: method, Arg: arg, Stream: true}, fs); err != nil {
+		return nil, err
+	}
+
+	// The server grants credit to the client when the stream starts, or
+	// ends it right away if the call failed.
+	var f streamFrame
+	newFs, err := unmarshalFrame(c.Socket, &f)
+	if err != nil {
+		return nil, fmt.Errorf("urpc method %q failed: %v", method, err)
+	}
+	closeAll(newFs)
+	if f.End {
+		return nil, RemoteError{Message: f.Err}
+	}
+
+	stream := newStream(c.Socket, true /* client */, f.Credit)
+	stream.release = c.mu.Unlock
+	unlock = false
+	go stream.readFrames()
+	return stream, nil
+}
+
 // Close closes the underlying socket.
 //
 // Further calls to the client may result in undefined behavior.
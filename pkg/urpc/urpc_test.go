@@ -16,8 +16,10 @@ package urpc
 
 import (
 	"errors"
+	"io"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/wilinz/gvisor/pkg/unet"
 )
@@ -67,6 +69,53 @@ func (t test) TooManyFiles(a *testArg, r *testResult) error {
 	return nil
 }
 
+// Count streams IntArg messages, and sends a file with the first one.
+func (t test) Count(a *testArg, s *Stream) error {
+	for i := 0; i < a.IntArg; i++ {
+		r := testResult{IntResult: i}
+		if i == 0 {
+			r.Files = []*os.File{os.Stdin}
+		}
+		if err := s.Send(&r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Echo sends back the messages it receives, including their files, until the
+// client stops sending.
+func (t test) Echo(a *testArg, s *Stream) error {
+	for {
+		var m testArg
+		if err := s.Recv(&m); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := s.Send(&testResult{StringResult: m.StringArg, FilePayload: m.FilePayload}); err != nil {
+			return err
+		}
+	}
+}
+
+// Forever streams messages until the client cancels the call.
+func (t test) Forever(a *testArg, s *Stream) error {
+	for {
+		if err := s.Send(&testResult{}); err != nil {
+			return err
+		}
+	}
+}
+
+// StreamErr fails after sending a message.
+func (t test) StreamErr(a *testArg, s *Stream) error {
+	if err := s.Send(&testResult{}); err != nil {
+		return err
+	}
+	return errors.New("test error")
+}
+
 func startServer(socket *unet.Socket) {
 	s := NewServer()
 	s.Register(test{})
@@ -208,3 +257,181 @@ func TestTooManyFiles(t *testing.T) {
 		t.Errorf("expected too many files, got %v", err.Error())
 	}
 }
+
+func TestStream(t *testing.T) {
+	c, err := testClient()
+	if err != nil {
+		t.Fatalf("error creating test client: %v", err)
+	}
+	defer c.Close()
+
+	// Send more messages than the window to exercise flow control.
+	const count = 3*streamWindow + 1
+	s, err := c.CallStream("test.Count", &testArg{IntArg: count})
+	if err != nil {
+		t.Fatalf("CallStream failed: %v", err)
+	}
+	for i := 0; i < count; i++ {
+		var r testResult
+		if err := s.Recv(&r); err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		if r.IntResult != i {
+			t.Errorf("got message %d, want %d", r.IntResult, i)
+		}
+		if (i == 0) != (len(r.Files) == 1) {
+			t.Errorf("got %d files with message %d", len(r.Files), i)
+		}
+		closeAll(r.Files)
+	}
+	var r testResult
+	if err := s.Recv(&r); err != io.EOF {
+		t.Errorf("got Recv() = %v at the end of the stream, want EOF", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+
+	// The client can make other calls after the stream.
+	if err := c.Call("test.Func", &testArg{StringArg: "hello"}, &r); err != nil {
+		t.Errorf("basic call failed: %v", err)
+	} else if r.StringResult != "hello" {
+		t.Errorf("unexpected result, got %v expected hello", r.StringResult)
+	}
+}
+
+func TestStreamEcho(t *testing.T) {
+	c, err := testClient()
+	if err != nil {
+		t.Fatalf("error creating test client: %v", err)
+	}
+	defer c.Close()
+
+	s, err := c.CallStream("test.Echo", &testArg{})
+	if err != nil {
+		t.Fatalf("CallStream failed: %v", err)
+	}
+	for _, str := range []string{"a", "b", "c"} {
+		if err := s.Send(&testArg{StringArg: str, FilePayload: FilePayload{Files: []*os.File{os.Stdin}}}); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+		var r testResult
+		if err := s.Recv(&r); err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		if r.StringResult != str || len(r.Files) != 1 {
+			t.Errorf("got %q with %d files, want %q with 1 file", r.StringResult, len(r.Files), str)
+		}
+		closeAll(r.Files)
+	}
+	if err := s.CloseSend(); err != nil {
+		t.Fatalf("CloseSend failed: %v", err)
+	}
+	if err := s.Send(&testArg{}); err != ErrStreamClosed {
+		t.Errorf("got Send() = %v after CloseSend, want %v", err, ErrStreamClosed)
+	}
+	var r testResult
+	if err := s.Recv(&r); err != io.EOF {
+		t.Errorf("got Recv() = %v, want EOF", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+}
+
+func TestStreamCancel(t *testing.T) {
+	c, err := testClient()
+	if err != nil {
+		t.Fatalf("error creating test client: %v", err)
+	}
+	defer c.Close()
+
+	s, err := c.CallStream("test.Forever", &testArg{})
+	if err != nil {
+		t.Fatalf("CallStream failed: %v", err)
+	}
+	var r testResult
+	if err := s.Recv(&r); err != nil {
+		t.Fatalf("Recv failed: %v", err)
+	}
+	if err := s.Close(); err == nil || err.Error() != ErrStreamClosed.Error() {
+		t.Errorf("got Close() = %v, want %v", err, ErrStreamClosed)
+	}
+	if err := c.Call("test.Func", &testArg{}, &r); err != nil {
+		t.Errorf("basic call failed: %v", err)
+	}
+}
+
+func TestStreamErr(t *testing.T) {
+	c, err := testClient()
+	if err != nil {
+		t.Fatalf("error creating test client: %v", err)
+	}
+	defer c.Close()
+
+	s, err := c.CallStream("test.StreamErr", &testArg{})
+	if err != nil {
+		t.Fatalf("CallStream failed: %v", err)
+	}
+	var r testResult
+	if err := s.Recv(&r); err != nil {
+		t.Fatalf("Recv failed: %v", err)
+	}
+	if err := s.Recv(&r); err == nil || err.Error() != "test error" {
+		t.Errorf("got Recv() = %v, want test error", err)
+	}
+	if err := s.Close(); err == nil || err.Error() != "test error" {
+		t.Errorf("got Close() = %v, want test error", err)
+	}
+}
+
+func TestStreamMismatch(t *testing.T) {
+	c, err := testClient()
+	if err != nil {
+		t.Fatalf("error creating test client: %v", err)
+	}
+	defer c.Close()
+
+	if _, err := c.CallStream("test.Func", &testArg{}); err == nil {
+		t.Errorf("expected non-nil err for a streaming call to a regular method, got nil")
+	}
+	if _, err := c.CallStream("test.Unknown", &testArg{}); err == nil || err.Error() != ErrUnknownMethod.Error() {
+		t.Errorf("expected %v, got %v", ErrUnknownMethod, err)
+	}
+	var r testResult
+	if err := c.Call("test.Count", &testArg{}, &r); err == nil {
+		t.Errorf("expected non-nil err for a regular call to a streaming method, got nil")
+	}
+	if err := c.Call("test.Func", &testArg{}, &r); err != nil {
+		t.Errorf("basic call failed: %v", err)
+	}
+}
+
+func TestStreamStop(t *testing.T) {
+	serverSock, clientSock, err := unet.SocketPair(false)
+	if err != nil {
+		t.Fatalf("error creating socket pair: %v", err)
+	}
+	srv := NewServer()
+	srv.Register(test{})
+	srv.StartHandling(serverSock)
+	c := NewClient(clientSock)
+	defer c.Close()
+
+	s, err := c.CallStream("test.Forever", &testArg{})
+	if err != nil {
+		t.Fatalf("CallStream failed: %v", err)
+	}
+	// The method never returns by itself, but the stream is interrupted
+	// once the timeout expires.
+	srv.Stop(10 * time.Millisecond)
+	for {
+		var r testResult
+		if err := s.Recv(&r); err != nil {
+			break
+		}
+	}
+	if err := s.Close(); err == nil {
+		t.Errorf("expected non-nil err from Close, got nil")
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"strconv"
 
 	"github.com/wilinz/gvisor/pkg/binary"
+	"github.com/wilinz/gvisor/pkg/buffer"
 	"github.com/wilinz/gvisor/pkg/context"
 	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
 	"github.com/wilinz/gvisor/pkg/gohacks"
@@ -571,6 +572,59 @@ func (rw *IOSequenceReadWriter) Write(src []byte) (int, error) {
 	return n, err
 }
 
+// WriteFromBuffer implements buffer.Writer.WriteFromBuffer.
+//
+// Unlike successive calls to Write, it copies all of the range out with a
+// single call to CopyOutFrom, scattering the Buffer's views directly into the
+// IOSequence.
+func (rw *IOSequenceReadWriter) WriteFromBuffer(b *buffer.Buffer, offset, count int) (int, error) {
+	r := bufferReader{
+		b:      b,
+		offset: offset,
+		count:  count,
+	}
+	n, err := rw.s.CopyOutFrom(rw.ctx, &r)
+	rw.s = rw.s.DropFirst64(n)
+	if err == nil && int(n) < count {
+		err = ErrEndOfIOSequence
+	}
+	return int(n), err
+}
+
+// bufferReader implements safemem.Reader for a range of a buffer.Buffer.
+type bufferReader struct {
+	b      *buffer.Buffer
+	offset int
+	count  int
+}
+
+// ReadToBlocks implements safemem.Reader.ReadToBlocks.
+func (r *bufferReader) ReadToBlocks(dsts safemem.BlockSeq) (uint64, error) {
+	var done uint64
+	off := r.offset
+	views := r.b.AsViewList()
+	for v := views.Front(); v != nil && r.count > 0 && !dsts.IsEmpty(); v = v.Next() {
+		if off >= v.Size() {
+			off -= v.Size()
+			continue
+		}
+		src := v.AsSlice()[off:]
+		off = 0
+		if len(src) > r.count {
+			src = src[:r.count]
+		}
+		n, err := safemem.CopySeq(dsts, safemem.BlockSeqOf(safemem.BlockFromSafeSlice(src)))
+		done += n
+		r.offset += int(n)
+		r.count -= int(n)
+		if err != nil {
+			return done, err
+		}
+		dsts = dsts.DropFirst64(n)
+	}
+	return done, nil
+}
+
 // CopyObjectOut copies a fixed-size value or slice of fixed-size values from
 // src to the memory mapped at addr in uio. It returns the number of bytes
 // copied.
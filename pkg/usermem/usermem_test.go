@@ -21,6 +21,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/wilinz/gvisor/pkg/buffer"
 	"github.com/wilinz/gvisor/pkg/context"
 	"github.com/wilinz/gvisor/pkg/errors/linuxerr"
 	"github.com/wilinz/gvisor/pkg/hostarch"
@@ -405,3 +406,98 @@ func TestIOSequenceTakeFirst(t *testing.T) {
 		t.Errorf("NumBytes: got %v, wanted %v", got, want)
 	}
 }
+
+// newMultiViewBuffer returns a buffer.Buffer with a View for each slice in
+// data.
+func newMultiViewBuffer(data ...[]byte) buffer.Buffer {
+	var buf buffer.Buffer
+	for _, d := range data {
+		b := buffer.MakeWithData(d)
+		buf.Merge(&b)
+	}
+	return buf
+}
+
+func TestIOSequenceWriteFromBuffer(t *testing.T) {
+	src := newMultiViewBuffer([]byte("foo"), []byte("bar"), []byte("baz"))
+	defer src.Release()
+
+	// Scatter into two ranges separated by a gap.
+	mem := []byte("0123456789")
+	s := IOSequence{
+		IO: &BytesIO{mem},
+		Addrs: hostarch.AddrRangeSeqFromSlice([]hostarch.AddrRange{
+			{Start: 0, End: 4},
+			{Start: 6, End: 9},
+		}),
+	}
+	w := s.Writer(newContext())
+
+	// Write limited by count.
+	n, err := w.WriteFromBuffer(&src, 1, 6)
+	if wantN := 6; n != wantN || err != nil {
+		t.Errorf("WriteFromBuffer: got (%v, %v), wanted (%v, nil)", n, err, wantN)
+	}
+	if want := []byte("ooba45rb89"); !bytes.Equal(mem, want) {
+		t.Errorf("mem: got %q, wanted %q", mem, want)
+	}
+
+	// Write limited by the IOSequence.
+	n, err = w.WriteFromBuffer(&src, 7, 2)
+	if wantN := 1; n != wantN || err != ErrEndOfIOSequence {
+		t.Errorf("WriteFromBuffer: got (%v, %v), wanted (%v, %v)", n, err, wantN, ErrEndOfIOSequence)
+	}
+	if want := []byte("ooba45rbaa"); !bytes.Equal(mem, want) {
+		t.Errorf("mem: got %q, wanted %q", mem, want)
+	}
+}
+
+func benchmarkIOSequenceWrite(b *testing.B, viewSize, numViews int, write func(w *IOSequenceReadWriter, src *buffer.Buffer)) {
+	data := make([][]byte, numViews)
+	for i := range data {
+		data[i] = make([]byte, viewSize)
+	}
+	src := newMultiViewBuffer(data...)
+	defer src.Release()
+
+	// Scatter into iovecs of a different size than the views.
+	const iovSize = 4096
+	size := viewSize * numViews
+	mem := make([]byte, size)
+	var ars []hostarch.AddrRange
+	for start := 0; start < size; start += iovSize {
+		end := min(start+iovSize, size)
+		ars = append(ars, hostarch.AddrRange{Start: hostarch.Addr(start), End: hostarch.Addr(end)})
+	}
+	s := IOSequence{
+		IO:    &BytesIO{mem},
+		Addrs: hostarch.AddrRangeSeqFromSlice(ars),
+	}
+
+	b.SetBytes(int64(size))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		write(s.Writer(newContext()), &src)
+	}
+}
+
+func BenchmarkIOSequenceWrite(b *testing.B) {
+	for _, viewSize := range []int{1500, 9000, 65536} {
+		for _, numViews := range []int{1, 16} {
+			b.Run(fmt.Sprintf("view=%d/views=%d/Write", viewSize, numViews), func(b *testing.B) {
+				benchmarkIOSequenceWrite(b, viewSize, numViews, func(w *IOSequenceReadWriter, src *buffer.Buffer) {
+					if _, err := src.ReadToWriter(w, src.Size()); err != nil {
+						b.Fatalf("ReadToWriter failed: %v", err)
+					}
+				})
+			})
+			b.Run(fmt.Sprintf("view=%d/views=%d/WriteFromBuffer", viewSize, numViews), func(b *testing.B) {
+				benchmarkIOSequenceWrite(b, viewSize, numViews, func(w *IOSequenceReadWriter, src *buffer.Buffer) {
+					if _, err := w.WriteFromBuffer(src, 0, int(src.Size())); err != nil {
+						b.Fatalf("WriteFromBuffer failed: %v", err)
+					}
+				})
+			})
+		}
+	}
+}
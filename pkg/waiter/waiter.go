@@ -58,6 +58,13 @@
 package waiter
 
 import (
+	"context"
+	"math"
+	"math/bits"
+	"sync/atomic"
+
+	"github.com/wilinz/gvisor/pkg/atomicbitops"
+	"github.com/wilinz/gvisor/pkg/hostarch"
 	"github.com/wilinz/gvisor/pkg/sync"
 )
 
@@ -144,6 +151,12 @@ type Entry struct {
 
 	// mask should be immutable once queued.
 	mask EventMask
+
+	// shard is one plus the index of the queue shard the entry is in, or
+	// zero if the entry isn't in a queue. It is accessed atomically; it
+	// isn't an atomicbitops.Int32 because entries are copied by value
+	// before being registered.
+	shard int32
 }
 
 // Init initializes the Entry.
@@ -201,6 +214,101 @@ func NewFunctionEntry(mask EventMask, fn func(EventMask)) (e Entry) {
 	return e
 }
 
+// queueShards is the number of shards of a contended Queue. Entries are
+// spread over the shards so that registrations on a busy queue don't all
+// contend on the same lock.
+const queueShards = 4
+
+// countedEvents is the number of low event bits whose waiters each queue shard
+// counts. All events defined by this package and its users fit; entries with
+// higher bits are counted together.
+const countedEvents = 16
+
+// queueShard is a shard of a Queue.
+//
+// +stateify savable
+type queueShard struct {
+	// events is the union of the masks of the entries in list. It is only
+	// written with mu held, but may be read without it so that
+	// notifications skip shards without interested waiters.
+	events atomicbitops.Uint64
+
+	// counts[i] is the number of entries in list whose mask has bit i set,
+	// for i < countedEvents, and counts[countedEvents] is the number of
+	// entries whose mask has any higher bit set. A count that reaches
+	// math.MaxUint16 stays there, and its bits stay set in events, until
+	// list is empty. counts is protected by mu.
+	counts [countedEvents + 1]uint16
+
+	list waiterList
+	mu   sync.RWMutex `state:"nosave"`
+}
+
+// addLocked adds e to s.
+//
+// Preconditions: s.mu must be locked.
+func (s *queueShard) addLocked(e *Entry) {
+	s.list.PushBack(e)
+	for m := e.mask & (1<<countedEvents - 1); m != 0; m &= m - 1 {
+		if i := bits.TrailingZeros64(uint64(m)); s.counts[i] != math.MaxUint16 {
+			s.counts[i]++
+		}
+	}
+	if e.mask>>countedEvents != 0 && s.counts[countedEvents] != math.MaxUint16 {
+		s.counts[countedEvents]++
+	}
+	s.events.Store(s.events.RacyLoad() | uint64(e.mask))
+}
+
+// removeLocked removes e from s.
+//
+// Preconditions: s.mu must be locked. e must be in s.
+func (s *queueShard) removeLocked(e *Entry) {
+	s.list.Remove(e)
+	if s.list.Empty() {
+		s.counts = [countedEvents + 1]uint16{}
+		s.events.Store(0)
+		return
+	}
+	events := EventMask(s.events.RacyLoad())
+	for m := e.mask & (1<<countedEvents - 1); m != 0; m &= m - 1 {
+		i := bits.TrailingZeros64(uint64(m))
+		switch s.counts[i] {
+		case math.MaxUint16:
+			// Saturated, keep the bit set.
+		case 1:
+			s.counts[i] = 0
+			events &^= 1 << i
+		default:
+			s.counts[i]--
+		}
+	}
+	if e.mask>>countedEvents != 0 {
+		switch s.counts[countedEvents] {
+		case math.MaxUint16:
+		case 1:
+			s.counts[countedEvents] = 0
+			events &= 1<<countedEvents - 1
+		default:
+			s.counts[countedEvents]--
+		}
+	}
+	s.events.Store(uint64(events))
+}
+
+// paddedQueueShard is a queueShard on its own cache lines.
+//
+// +stateify savable
+type paddedQueueShard struct {
+	_ [hostarch.CacheLineSize]byte
+	queueShard
+}
+
+// moreQueueShards are the shards of a contended Queue beyond its first.
+//
+// +stateify savable
+type moreQueueShards [queueShards - 1]paddedQueueShard
+
 // Queue represents the wait queue where waiters can be added and
 // notifiers can notify them when events happen.
 //
@@ -208,55 +316,139 @@ func NewFunctionEntry(mask EventMask, fn func(EventMask)) (e Entry) {
 //
 // +stateify savable
 type Queue struct {
-	list waiterList
-	mu   sync.RWMutex `state:"nosave"`
+	// first is the shard that entries are registered in until registrations
+	// contend on its lock.
+	first queueShard
+
+	// more is nil until registrations first contend on first.mu, after
+	// which entries are spread over first and more.
+	more atomic.Pointer[moreQueueShards] `state:".(*moreQueueShards)"`
+
+	// next is used to pick the shard of registered entries round-robin once
+	// more is allocated.
+	next atomicbitops.Uint32
+}
+
+func (q *Queue) saveMore() *moreQueueShards {
+	return q.more.Load()
+}
+
+func (q *Queue) loadMore(_ context.Context, more *moreQueueShards) {
+	q.more.Store(more)
+}
+
+// shard returns the shard with the given index.
+func (q *Queue) shard(more *moreQueueShards, i int32) *queueShard {
+	if i == 0 {
+		return &q.first
+	}
+	return &more[i-1].queueShard
 }
 
 // EventRegister adds a waiter to the wait queue.
 func (q *Queue) EventRegister(e *Entry) {
-	q.mu.Lock()
-	q.list.PushBack(e)
-	q.mu.Unlock()
+	var i int32
+	more := q.more.Load()
+	switch {
+	case more == nil && q.first.mu.TryLock():
+		// Uncontended, which is the common case.
+	case more == nil:
+		// first is contended; spread entries over more shards from now on,
+		// starting with this one.
+		more = new(moreQueueShards)
+		if !q.more.CompareAndSwap(nil, more) {
+			more = q.more.Load()
+		}
+		i = 1 + int32(q.next.Add(1)%(queueShards-1))
+		more[i-1].mu.Lock()
+	default:
+		i = int32(q.next.Add(1) % queueShards)
+		q.shard(more, i).mu.Lock()
+	}
+	s := q.shard(more, i)
+	s.addLocked(e)
+	atomic.StoreInt32(&e.shard, i+1)
+	s.mu.Unlock()
 }
 
 // EventUnregister removes the given waiter entry from the wait queue.
 func (q *Queue) EventUnregister(e *Entry) {
-	q.mu.Lock()
-	q.list.Remove(e)
-	q.mu.Unlock()
+	i := atomic.LoadInt32(&e.shard) - 1
+	if i < 0 {
+		// Not registered.
+		return
+	}
+	s := q.shard(q.more.Load(), i)
+	s.mu.Lock()
+	s.removeLocked(e)
+	atomic.StoreInt32(&e.shard, 0)
+	s.mu.Unlock()
 }
 
 // Notify notifies all waiters in the queue whose masks have at least one bit
 // in common with the notification mask.
+//
+// Waiters in different shards are notified in no particular order.
 func (q *Queue) Notify(mask EventMask) {
-	q.mu.RLock()
-	for e := q.list.Front(); e != nil; e = e.Next() {
+	q.first.notify(mask)
+	if more := q.more.Load(); more != nil {
+		for i := range more {
+			more[i].notify(mask)
+		}
+	}
+}
+
+// notify notifies the waiters in s whose masks have at least one bit in
+// common with mask.
+func (s *queueShard) notify(mask EventMask) {
+	// Waiters check readiness after registering, so missing a registration
+	// that is still in progress is fine.
+	if EventMask(s.events.Load())&mask == 0 {
+		return
+	}
+	s.mu.RLock()
+	for e := s.list.Front(); e != nil; e = e.Next() {
 		m := mask & e.mask
 		if m == 0 {
 			continue
 		}
 		e.eventListener.NotifyEvent(m) // Skip intermediate call.
 	}
-	q.mu.RUnlock()
+	s.mu.RUnlock()
 }
 
 // Events returns the set of events being waited on. It is the union of the
 // masks of all registered entries.
 func (q *Queue) Events() EventMask {
-	q.mu.RLock()
-	defer q.mu.RUnlock()
-	ret := EventMask(0)
-	for e := q.list.Front(); e != nil; e = e.Next() {
-		ret |= e.mask
+	ret := EventMask(q.first.events.Load())
+	if more := q.more.Load(); more != nil {
+		for i := range more {
+			ret |= EventMask(more[i].events.Load())
+		}
 	}
 	return ret
 }
 
 // IsEmpty returns if the wait queue is empty or not.
 func (q *Queue) IsEmpty() bool {
-	q.mu.RLock()
-	defer q.mu.RUnlock()
-	return q.list.Front() == nil
+	if !q.first.isEmpty() {
+		return false
+	}
+	if more := q.more.Load(); more != nil {
+		for i := range more {
+			if !more[i].isEmpty() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isEmpty returns true if s has no entries.
+func (s *queueShard) isEmpty() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.list.Empty()
 }
 
 // NeverReady implements the Waitable interface but is never ready. Otherwise,
@@ -180,3 +180,156 @@ func TestConcurrentNotification(t *testing.T) {
 		t.Errorf("cnt = %d, want %d", cnt.Load(), concurrency*waiterCount)
 	}
 }
+
+func TestEvents(t *testing.T) {
+	var q Queue
+	entries := []Entry{
+		NewFunctionEntry(EventIn, func(EventMask) {}),
+		NewFunctionEntry(EventOut, func(EventMask) {}),
+		NewFunctionEntry(EventIn|EventErr, func(EventMask) {}),
+	}
+	for i := range entries {
+		q.EventRegister(&entries[i])
+	}
+	if got, want := q.Events(), EventIn|EventOut|EventErr; got != want {
+		t.Errorf("q.Events() = %#x, want %#x", got, want)
+	}
+
+	// Events must only drop the masks of unregistered entries.
+	q.EventUnregister(&entries[2])
+	if got, want := q.Events(), EventIn|EventOut; got != want {
+		t.Errorf("q.Events() = %#x, want %#x", got, want)
+	}
+	q.EventUnregister(&entries[0])
+	if got, want := q.Events(), EventOut; got != want {
+		t.Errorf("q.Events() = %#x, want %#x", got, want)
+	}
+	q.EventUnregister(&entries[1])
+	if got := q.Events(); got != 0 {
+		t.Errorf("q.Events() = %#x, want 0", got)
+	}
+	if !q.IsEmpty() {
+		t.Errorf("q.IsEmpty() = false, want true")
+	}
+
+	// Unregistering an entry twice is a no-op.
+	q.EventUnregister(&entries[1])
+	if !q.IsEmpty() {
+		t.Errorf("q.IsEmpty() = false, want true")
+	}
+}
+
+func TestEventsHighBits(t *testing.T) {
+	// Bits beyond countedEvents are counted together, so they are only
+	// dropped once no entry has any of them.
+	const high1, high2 = EventMask(1) << 40, EventMask(1) << 41
+	var q Queue
+	entries := []Entry{
+		NewFunctionEntry(EventIn|high1, func(EventMask) {}),
+		NewFunctionEntry(high2, func(EventMask) {}),
+	}
+	for i := range entries {
+		q.EventRegister(&entries[i])
+	}
+	if got, want := q.Events(), EventIn|high1|high2; got != want {
+		t.Errorf("q.Events() = %#x, want %#x", got, want)
+	}
+	q.EventUnregister(&entries[0])
+	if got := q.Events(); got&high2 == 0 || got&EventIn != 0 {
+		t.Errorf("q.Events() = %#x, want %#x without %#x", got, high2, EventIn)
+	}
+	q.EventUnregister(&entries[1])
+	if got := q.Events(); got != 0 {
+		t.Errorf("q.Events() = %#x, want 0", got)
+	}
+}
+
+func TestQueueShards(t *testing.T) {
+	var q Queue
+	entries := make([]Entry, 10)
+	for i := range entries {
+		entries[i] = NewFunctionEntry(EventIn, func(EventMask) {})
+		q.EventRegister(&entries[i])
+	}
+	if q.more.Load() != nil {
+		t.Fatalf("uncontended queue allocated more shards")
+	}
+
+	// Registering while first is locked must use another shard instead of
+	// blocking.
+	cnt := 0
+	e := NewFunctionEntry(EventOut, func(EventMask) { cnt++ })
+	q.first.mu.Lock()
+	q.EventRegister(&e)
+	q.first.mu.Unlock()
+	if q.more.Load() == nil {
+		t.Fatalf("contended queue didn't allocate more shards")
+	}
+	if e.shard <= 1 {
+		t.Errorf("entry registered in shard %d, want a shard other than first", e.shard-1)
+	}
+	if got, want := q.Events(), EventIn|EventOut; got != want {
+		t.Errorf("q.Events() = %#x, want %#x", got, want)
+	}
+	q.Notify(EventOut)
+	if cnt != 1 {
+		t.Errorf("entry in shard %d notified %d times, want 1", e.shard-1, cnt)
+	}
+
+	// Subsequent registrations are spread over all shards.
+	for i := range entries {
+		q.EventUnregister(&entries[i])
+		q.EventRegister(&entries[i])
+	}
+	shards := make(map[int32]bool)
+	for i := range entries {
+		shards[entries[i].shard] = true
+	}
+	if len(shards) != queueShards {
+		t.Errorf("entries registered in %d shards, want %d", len(shards), queueShards)
+	}
+
+	for i := range entries {
+		q.EventUnregister(&entries[i])
+	}
+	q.EventUnregister(&e)
+	if got := q.Events(); got != 0 {
+		t.Errorf("q.Events() = %#x, want 0", got)
+	}
+	if !q.IsEmpty() {
+		t.Errorf("q.IsEmpty() = false, want true")
+	}
+}
+
+func BenchmarkNotifyUninterested(b *testing.B) {
+	// Notifications for events nobody waits for are the common case for
+	// writable sockets, and must not take any lock.
+	var q Queue
+	e := NewFunctionEntry(EventIn, func(EventMask) {})
+	q.EventRegister(&e)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			q.Notify(EventOut)
+		}
+	})
+}
+
+func BenchmarkNotifyWithRegistrations(b *testing.B) {
+	// Waiters registering and unregistering concurrently with notifiers,
+	// as happens with many threads blocking on the same socket.
+	var q Queue
+	var cnt atomicbitops.Int32
+	b.RunParallel(func(pb *testing.PB) {
+		e := NewFunctionEntry(EventIn, func(EventMask) { cnt.Add(1) })
+		for i := 0; pb.Next(); i++ {
+			if i%2 == 0 {
+				q.EventRegister(&e)
+				q.Notify(EventIn)
+				q.EventUnregister(&e)
+			} else {
+				q.Notify(EventIn)
+			}
+		}
+	})
+}
@@ -0,0 +1,230 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+	"github.com/wilinz/gvisor/pkg/log"
+)
+
+// Listen returns a listener for address, which must be of the form
+// "unix:PATH" or "vsock:PORT", for a server configured with opts.
+//
+// Unix sockets are only accessible to, and only accept connections from, the
+// server's effective user. vsock peers can't be identified, so vsock requires
+// opts.AuthToken to be set.
+func Listen(address string, opts Options) (net.Listener, error) {
+	scheme, rest, ok := strings.Cut(address, ":")
+	if !ok || rest == "" {
+		return nil, fmt.Errorf("invalid address %q: must be unix:PATH or vsock:PORT", address)
+	}
+	switch scheme {
+	case "unix":
+		// Remove a stale socket left behind by a previous server.
+		if err := os.Remove(rest); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("removing %q: %w", rest, err)
+		}
+		return listenUnix(rest)
+	case "vsock":
+		if opts.AuthToken == "" {
+			return nil, fmt.Errorf("invalid address %q: listening on vsock requires an authentication token", address)
+		}
+		port, err := strconv.ParseUint(rest, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vsock port %q: %w", rest, err)
+		}
+		return listenVsock(uint32(port))
+	default:
+		return nil, fmt.Errorf("invalid address %q: unsupported scheme %q", address, scheme)
+	}
+}
+
+// peerCredListener is a Unix socket listener that only accepts connections
+// from peers running as uid.
+type peerCredListener struct {
+	*net.UnixListener
+	uid uint32
+}
+
+func listenUnix(path string) (net.Listener, error) {
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		_ = l.Close()
+		return nil, fmt.Errorf("chmod %q: %w", path, err)
+	}
+	return &peerCredListener{
+		UnixListener: l,
+		uid:          uint32(os.Geteuid()),
+	}, nil
+}
+
+// Accept implements net.Listener.Accept.
+func (l *peerCredListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.AcceptUnix()
+		if err != nil {
+			return nil, err
+		}
+		uid, err := peerUID(conn)
+		if err == nil && uid == l.uid {
+			return conn, nil
+		}
+		if err != nil {
+			log.Warningf("API: rejecting connection: getting peer credentials: %v", err)
+		} else {
+			log.Warningf("API: rejecting connection from uid %d", uid)
+		}
+		_ = conn.Close()
+	}
+}
+
+// peerUID returns the effective user ID of the peer of conn.
+func peerUID(conn *net.UnixConn) (uint32, error) {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var (
+		cred    *unix.Ucred
+		credErr error
+	)
+	if err := rc.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		return 0, err
+	}
+	if credErr != nil {
+		return 0, credErr
+	}
+	return cred.Uid, nil
+}
+
+// vsockAddr implements net.Addr for AF_VSOCK addresses.
+type vsockAddr struct {
+	cid  uint32
+	port uint32
+}
+
+// Network implements net.Addr.Network.
+func (*vsockAddr) Network() string {
+	return "vsock"
+}
+
+// String implements net.Addr.String.
+func (a *vsockAddr) String() string {
+	return fmt.Sprintf("%d:%d", a.cid, a.port)
+}
+
+func sockaddrToVsock(sa unix.Sockaddr) *vsockAddr {
+	if vm, ok := sa.(*unix.SockaddrVM); ok {
+		return &vsockAddr{cid: vm.CID, port: vm.Port}
+	}
+	return &vsockAddr{}
+}
+
+// vsockConn implements net.Conn for a connected AF_VSOCK socket. The
+// standard library does not support AF_VSOCK, so the socket is wrapped in an
+// os.File, which still integrates with the runtime poller.
+type vsockConn struct {
+	*os.File
+	local  *vsockAddr
+	remote *vsockAddr
+}
+
+// LocalAddr implements net.Conn.LocalAddr.
+func (c *vsockConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+// RemoteAddr implements net.Conn.RemoteAddr.
+func (c *vsockConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// vsockListener implements net.Listener for AF_VSOCK.
+type vsockListener struct {
+	file *os.File
+	addr *vsockAddr
+}
+
+func listenVsock(port uint32) (net.Listener, error) {
+	fd, err := unix.Socket(unix.AF_VSOCK, unix.SOCK_STREAM|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("creating vsock socket: %w", err)
+	}
+	if err := unix.Bind(fd, &unix.SockaddrVM{CID: unix.VMADDR_CID_ANY, Port: port}); err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("binding vsock port %d: %w", port, err)
+	}
+	if err := unix.Listen(fd, unix.SOMAXCONN); err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("listening on vsock port %d: %w", port, err)
+	}
+	sa, err := unix.Getsockname(fd)
+	if err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("getsockname: %w", err)
+	}
+	return &vsockListener{
+		file: os.NewFile(uintptr(fd), "vsock-listener"),
+		addr: sockaddrToVsock(sa),
+	}, nil
+}
+
+// Accept implements net.Listener.Accept.
+func (l *vsockListener) Accept() (net.Conn, error) {
+	rc, err := l.file.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		nfd       int
+		sa        unix.Sockaddr
+		acceptErr error
+	)
+	if err := rc.Read(func(fd uintptr) bool {
+		nfd, sa, acceptErr = unix.Accept4(int(fd), unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC)
+		return acceptErr != unix.EAGAIN
+	}); err != nil {
+		return nil, err
+	}
+	if acceptErr != nil {
+		return nil, acceptErr
+	}
+	return &vsockConn{
+		File:   os.NewFile(uintptr(nfd), "vsock-conn"),
+		local:  l.addr,
+		remote: sockaddrToVsock(sa),
+	}, nil
+}
+
+// Close implements net.Listener.Close.
+func (l *vsockListener) Close() error {
+	return l.file.Close()
+}
+
+// Addr implements net.Listener.Addr.
+func (l *vsockListener) Addr() net.Addr {
+	return l.addr
+}
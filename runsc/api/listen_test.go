@@ -0,0 +1,76 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenInvalidAddress(t *testing.T) {
+	for _, address := range []string{
+		"",
+		"unix:",
+		"tcp:localhost:1234",
+		"vsock:port",
+	} {
+		if l, err := Listen(address, Options{AuthToken: "token"}); err == nil {
+			l.Close()
+			t.Errorf("Listen(%q) succeeded, want error", address)
+		}
+	}
+}
+
+func TestListenVsockRequiresToken(t *testing.T) {
+	if l, err := Listen("vsock:1234", Options{}); err == nil {
+		l.Close()
+		t.Errorf("Listen(vsock) without an authentication token succeeded, want error")
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.sock")
+	// A stale socket must be replaced.
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatalf("WriteFile(%q): %v", path, err)
+	}
+	l, err := Listen("unix:"+path, Options{})
+	if err != nil {
+		t.Fatalf("Listen(%q): %v", path, err)
+	}
+	defer l.Close()
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat(%q): %v", path, err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0600 {
+		t.Errorf("socket permissions got %#o, want %#o", perm, 0600)
+	}
+
+	// Connections from the same user are accepted.
+	client, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("Dial(%q): %v", path, err)
+	}
+	defer client.Close()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatalf("Accept(): %v", err)
+	}
+	conn.Close()
+}
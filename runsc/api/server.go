@@ -0,0 +1,695 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package api implements the stable gRPC sandbox API defined in
+// sandbox.proto.
+//
+// The API is served by "runsc api-server" on the host, outside of any
+// sandbox, and translates requests into the same operations performed by the
+// runsc OCI commands. This allows third-party orchestrators to manage
+// sandboxes without depending on the internal urpc control protocol, which
+// may change between runsc versions.
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"github.com/wilinz/gvisor/pkg/log"
+	"github.com/wilinz/gvisor/pkg/sentry/control"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
+	"github.com/wilinz/gvisor/pkg/sentry/pgalloc"
+	"github.com/wilinz/gvisor/pkg/sentry/seccheck"
+	"github.com/wilinz/gvisor/pkg/state/statefile"
+	pb "github.com/wilinz/gvisor/runsc/api/sandbox_go_proto"
+	"github.com/wilinz/gvisor/runsc/boot"
+	"github.com/wilinz/gvisor/runsc/config"
+	"github.com/wilinz/gvisor/runsc/container"
+	"github.com/wilinz/gvisor/runsc/specutils"
+	"github.com/wilinz/gvisor/runsc/version"
+)
+
+// Version is the version of the API implemented by this package.
+const Version = "v1"
+
+// Options configures a Server.
+type Options struct {
+	// ImageRoot is the host directory under which checkpoint images are
+	// saved. If empty, Checkpoint is disabled.
+	ImageRoot string
+
+	// AuthToken, if not empty, must be presented by clients on every call.
+	// It is required to listen on vsock, which has no peer credentials.
+	AuthToken string
+}
+
+// Server implements the Sandbox gRPC service.
+type Server struct {
+	pb.UnimplementedSandboxServer
+
+	// conf is the runsc configuration, which determines the root directory
+	// in which containers are looked up.
+	conf *config.Config
+
+	opts Options
+}
+
+// NewServer returns a Server for the containers under conf.RootDir.
+func NewServer(conf *config.Config, opts Options) *Server {
+	return &Server{conf: conf, opts: opts}
+}
+
+// GRPCOptions returns the options with which the gRPC server serving s must
+// be created.
+func (s *Server) GRPCOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := s.authenticate(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := s.authenticate(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	}
+}
+
+// Register registers s with gs, which must have been created with
+// s.GRPCOptions().
+func (s *Server) Register(gs *grpc.Server) {
+	pb.RegisterSandboxServer(gs, s)
+}
+
+// authenticate checks that the call with the given context presents the
+// server's authentication token, if any.
+func (s *Server) authenticate(ctx context.Context) error {
+	if s.opts.AuthToken == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		token, ok := strings.CutPrefix(v, "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.opts.AuthToken)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "missing or invalid authentication token")
+}
+
+// load loads the container with the given ID.
+func (s *Server) load(id string, opts container.LoadOpts) (*container.Container, error) {
+	if id == "" {
+		return nil, status.Error(codes.InvalidArgument, "container_id must be set")
+	}
+	c, err := container.Load(s.conf.RootDir, container.FullID{ContainerID: id}, opts)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, status.Errorf(codes.NotFound, "container %q not found", id)
+		}
+		return nil, status.Errorf(codes.Internal, "loading container %q: %v", id, err)
+	}
+	return c, nil
+}
+
+// toStatus converts an error returned by a container operation to a gRPC
+// status error.
+func toStatus(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	log.Debugf("API %s failed: %v", op, err)
+	return status.Errorf(codes.FailedPrecondition, "%s: %v", op, err)
+}
+
+// GetVersion implements pb.SandboxServer.GetVersion.
+func (s *Server) GetVersion(ctx context.Context, req *pb.GetVersionRequest) (*pb.GetVersionResponse, error) {
+	return &pb.GetVersionResponse{
+		ApiVersion:   Version,
+		RunscVersion: version.Version(),
+	}, nil
+}
+
+// ListContainers implements pb.SandboxServer.ListContainers.
+func (s *Server) ListContainers(ctx context.Context, req *pb.ListContainersRequest) (*pb.ListContainersResponse, error) {
+	ids, err := container.List(s.conf.RootDir)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "listing containers: %v", err)
+	}
+	resp := &pb.ListContainersResponse{}
+	for _, id := range ids {
+		resp.Containers = append(resp.Containers, &pb.ContainerID{
+			SandboxId:   id.SandboxID,
+			ContainerId: id.ContainerID,
+		})
+	}
+	return resp, nil
+}
+
+// GetState implements pb.SandboxServer.GetState.
+func (s *Server) GetState(ctx context.Context, req *pb.GetStateRequest) (*pb.GetStateResponse, error) {
+	c, err := s.load(req.GetContainerId(), container.LoadOpts{})
+	if err != nil {
+		return nil, err
+	}
+	state := c.State()
+	return &pb.GetStateResponse{
+		OciVersion:  state.Version,
+		Id:          state.ID,
+		Status:      state.Status,
+		Pid:         int32(state.Pid),
+		Bundle:      state.Bundle,
+		Annotations: state.Annotations,
+	}, nil
+}
+
+// Pause implements pb.SandboxServer.Pause.
+func (s *Server) Pause(ctx context.Context, req *pb.PauseRequest) (*pb.PauseResponse, error) {
+	c, err := s.load(req.GetContainerId(), container.LoadOpts{})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Pause(); err != nil {
+		return nil, toStatus("pause", err)
+	}
+	return &pb.PauseResponse{}, nil
+}
+
+// Resume implements pb.SandboxServer.Resume.
+func (s *Server) Resume(ctx context.Context, req *pb.ResumeRequest) (*pb.ResumeResponse, error) {
+	c, err := s.load(req.GetContainerId(), container.LoadOpts{})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Resume(); err != nil {
+		return nil, toStatus("resume", err)
+	}
+	return &pb.ResumeResponse{}, nil
+}
+
+// Signal implements pb.SandboxServer.Signal.
+func (s *Server) Signal(ctx context.Context, req *pb.SignalRequest) (*pb.SignalResponse, error) {
+	if req.GetPid() != 0 && req.GetAll() {
+		return nil, status.Error(codes.InvalidArgument, "pid and all are mutually exclusive")
+	}
+	c, err := s.load(req.GetContainerId(), container.LoadOpts{})
+	if err != nil {
+		return nil, err
+	}
+	sig := unix.Signal(req.GetSignal())
+	if req.GetPid() != 0 {
+		err = c.SignalProcess(sig, req.GetPid())
+	} else {
+		err = c.SignalContainer(sig, req.GetAll())
+	}
+	if err != nil {
+		return nil, toStatus("signal", err)
+	}
+	return &pb.SignalResponse{}, nil
+}
+
+// Wait implements pb.SandboxServer.Wait.
+func (s *Server) Wait(ctx context.Context, req *pb.WaitRequest) (*pb.WaitResponse, error) {
+	// The container may be stopped already, in which case its exit status is
+	// still available.
+	c, err := s.load(req.GetContainerId(), container.LoadOpts{SkipCheck: true})
+	if err != nil {
+		return nil, err
+	}
+	var ws unix.WaitStatus
+	if req.GetPid() != 0 {
+		ws, err = c.WaitPID(req.GetPid())
+	} else {
+		ws, err = c.Wait()
+	}
+	if err != nil {
+		return nil, toStatus("wait", err)
+	}
+	return &pb.WaitResponse{WaitStatus: uint32(ws)}, nil
+}
+
+// Delete implements pb.SandboxServer.Delete.
+func (s *Server) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	c, err := s.load(req.GetContainerId(), container.LoadOpts{})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Destroy(); err != nil {
+		return nil, toStatus("delete", err)
+	}
+	return &pb.DeleteResponse{}, nil
+}
+
+// Exec implements pb.SandboxServer.Exec.
+func (s *Server) Exec(ctx context.Context, req *pb.ExecRequest) (*pb.ExecResponse, error) {
+	var stdio [3]*os.File
+	defer closeFiles(stdio[:])
+	for i, flag := range []int{os.O_RDONLY, os.O_WRONLY, os.O_WRONLY} {
+		f, err := os.OpenFile(os.DevNull, flag, 0)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "opening %s: %v", os.DevNull, err)
+		}
+		stdio[i] = f
+	}
+	_, pid, err := s.execute(req, stdio)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ExecResponse{Pid: pid}, nil
+}
+
+// ExecStream implements pb.SandboxServer.ExecStream.
+func (s *Server) ExecStream(stream pb.Sandbox_ExecStreamServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	req := first.GetStart()
+	if req == nil {
+		return status.Error(codes.InvalidArgument, "the first request must set start")
+	}
+
+	// The process' standard I/O are pipes whose other ends are kept by the
+	// server.
+	var stdio, pipes [3]*os.File
+	defer closeFiles(stdio[:])
+	defer closeFiles(pipes[:])
+	for i := range stdio {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return status.Errorf(codes.Internal, "creating pipe: %v", err)
+		}
+		if i == 0 {
+			stdio[i], pipes[i] = r, w
+		} else {
+			stdio[i], pipes[i] = w, r
+		}
+	}
+	c, pid, err := s.execute(req, stdio)
+	if err != nil {
+		return err
+	}
+	// The process holds its own copies of stdio now. Close ours so that
+	// reading its output ends once the process and its children are done.
+	closeFiles(stdio[:])
+
+	var (
+		sendMu  sync.Mutex
+		sendErr error
+	)
+	send := func(resp *pb.ExecStreamResponse) {
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		// Once the client is gone, output is still drained so that the
+		// process doesn't block writing it.
+		if sendErr == nil {
+			sendErr = stream.Send(resp)
+		}
+	}
+	send(&pb.ExecStreamResponse{Response: &pb.ExecStreamResponse_Pid{Pid: pid}})
+
+	stdin := pipes[0]
+	pipes[0] = nil
+	go func() {
+		defer stdin.Close()
+		for {
+			r, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			switch r := r.GetRequest().(type) {
+			case *pb.ExecStreamRequest_Stdin:
+				if _, err := stdin.Write(r.Stdin); err != nil {
+					return
+				}
+			case *pb.ExecStreamRequest_CloseStdin:
+				if r.CloseStdin {
+					return
+				}
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for _, out := range []struct {
+		f    *os.File
+		resp func([]byte) *pb.ExecStreamResponse
+	}{
+		{pipes[1], func(b []byte) *pb.ExecStreamResponse {
+			return &pb.ExecStreamResponse{Response: &pb.ExecStreamResponse_Stdout{Stdout: b}}
+		}},
+		{pipes[2], func(b []byte) *pb.ExecStreamResponse {
+			return &pb.ExecStreamResponse{Response: &pb.ExecStreamResponse_Stderr{Stderr: b}}
+		}},
+	} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, 32*1024)
+			for {
+				n, err := out.f.Read(buf)
+				if n > 0 {
+					send(out.resp(append([]byte(nil), buf[:n]...)))
+				}
+				if err != nil {
+					if err != io.EOF {
+						log.Warningf("API exec: reading output of PID %d: %v", pid, err)
+					}
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	ws, err := c.WaitPID(pid)
+	if err != nil {
+		return toStatus("wait", err)
+	}
+	send(&pb.ExecStreamResponse{Response: &pb.ExecStreamResponse_WaitStatus{WaitStatus: uint32(ws)}})
+	sendMu.Lock()
+	defer sendMu.Unlock()
+	return sendErr
+}
+
+// closeFiles closes and clears the non-nil files in fs.
+func closeFiles(fs []*os.File) {
+	for i, f := range fs {
+		if f != nil {
+			_ = f.Close()
+			fs[i] = nil
+		}
+	}
+}
+
+// execute starts the process described by req with the given standard I/O,
+// and returns its container and PID.
+func (s *Server) execute(req *pb.ExecRequest, stdio [3]*os.File) (*container.Container, int32, error) {
+	if len(req.GetArgv()) == 0 {
+		return nil, 0, status.Error(codes.InvalidArgument, "argv must be set")
+	}
+	c, err := s.load(req.GetContainerId(), container.LoadOpts{})
+	if err != nil {
+		return nil, 0, err
+	}
+	args, err := s.execArgs(c, req)
+	if err != nil {
+		return nil, 0, err
+	}
+	args.FilePayload = control.NewFilePayload(map[int]*os.File{
+		0: stdio[0],
+		1: stdio[1],
+		2: stdio[2],
+	}, nil /* execFile */)
+	pid, err := c.Execute(s.conf, args)
+	if err != nil {
+		return nil, 0, toStatus("exec", err)
+	}
+	return c, pid, nil
+}
+
+// checkUser returns an error if u may not be used to execute processes in a
+// container whose init process runs as initUID. Clients may not gain root in
+// a container that doesn't otherwise run as root.
+func checkUser(u *pb.User, initUID uint32) error {
+	if u.GetUid() == 0 && initUID != 0 {
+		return status.Error(codes.PermissionDenied, "uid 0 is only permitted if the container's init process runs as uid 0")
+	}
+	return nil
+}
+
+// execArgs returns the arguments for req, with defaults taken from the
+// container's init process as in "runsc exec". The caller must set the
+// standard I/O files.
+func (s *Server) execArgs(c *container.Container, req *pb.ExecRequest) (*control.ExecArgs, error) {
+	p := c.Spec.Process
+	caps, err := specutils.Capabilities(s.conf.EnableRaw, p.Capabilities)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "capabilities: %v", err)
+	}
+	args := &control.ExecArgs{
+		Argv:             req.GetArgv(),
+		Envv:             append(append([]string(nil), p.Env...), req.GetEnv()...),
+		WorkingDirectory: p.Cwd,
+		KUID:             auth.KUID(p.User.UID),
+		KGID:             auth.KGID(p.User.GID),
+		Capabilities:     caps,
+	}
+	for _, gid := range p.User.AdditionalGids {
+		args.ExtraKGIDs = append(args.ExtraKGIDs, auth.KGID(gid))
+	}
+	if cwd := req.GetCwd(); cwd != "" {
+		args.WorkingDirectory = cwd
+	}
+	if u := req.GetUser(); u != nil {
+		if err := checkUser(u, p.User.UID); err != nil {
+			return nil, err
+		}
+		args.KUID = auth.KUID(u.GetUid())
+		args.KGID = auth.KGID(u.GetGid())
+		args.ExtraKGIDs = nil
+		for _, gid := range u.GetAdditionalGids() {
+			args.ExtraKGIDs = append(args.ExtraKGIDs, auth.KGID(gid))
+		}
+	}
+	return args, nil
+}
+
+// Stats implements pb.SandboxServer.Stats.
+func (s *Server) Stats(ctx context.Context, req *pb.StatsRequest) (*pb.StatsResponse, error) {
+	c, err := s.load(req.GetContainerId(), container.LoadOpts{})
+	if err != nil {
+		return nil, err
+	}
+	ev, err := c.Event()
+	if err != nil {
+		return nil, toStatus("stats", err)
+	}
+	return statsToProto(&ev.Event.Data), nil
+}
+
+// statsToProto converts stats to their API representation.
+func statsToProto(stats *boot.Stats) *pb.StatsResponse {
+	resp := &pb.StatsResponse{
+		Cpu: &pb.CPUStats{
+			UsageTotal:  stats.CPU.Usage.Total,
+			UsageKernel: stats.CPU.Usage.Kernel,
+			UsageUser:   stats.CPU.Usage.User,
+			UsagePerCpu: stats.CPU.Usage.PerCPU,
+		},
+		Memory: &pb.MemoryStats{
+			Usage:    stats.Memory.Usage.Usage,
+			Limit:    stats.Memory.Usage.Limit,
+			MaxUsage: stats.Memory.Usage.Max,
+			Cache:    stats.Memory.Cache,
+			Raw:      stats.Memory.Raw,
+		},
+		Pids: &pb.PidsStats{
+			Current: stats.Pids.Current,
+			Limit:   stats.Pids.Limit,
+		},
+	}
+	for _, ni := range stats.NetworkInterfaces {
+		resp.NetworkInterfaces = append(resp.NetworkInterfaces, &pb.NetworkInterfaceStats{
+			Name:      ni.Name,
+			RxBytes:   ni.RxBytes,
+			RxPackets: ni.RxPackets,
+			RxErrors:  ni.RxErrors,
+			RxDropped: ni.RxDropped,
+			TxBytes:   ni.TxBytes,
+			TxPackets: ni.TxPackets,
+			TxErrors:  ni.TxErrors,
+			TxDropped: ni.TxDropped,
+		})
+	}
+	return resp
+}
+
+// Checkpoint implements pb.SandboxServer.Checkpoint.
+func (s *Server) Checkpoint(ctx context.Context, req *pb.CheckpointRequest) (*pb.CheckpointResponse, error) {
+	if _, err := s.imagePath(req.GetImagePath()); err != nil {
+		return nil, err
+	}
+	c, err := s.load(req.GetContainerId(), container.LoadOpts{})
+	if err != nil {
+		return nil, err
+	}
+	dir, err := s.openImageDir(req.GetImagePath())
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+	sfOpts := statefile.Options{
+		Compression: statefile.CompressionLevelDefault,
+		Resume:      req.GetLeaveRunning(),
+	}
+	// Create the image files through the directory resolved above, rather
+	// than by name, so that they can't be redirected out of the image root
+	// after it was checked.
+	dirPath := fmt.Sprintf("/proc/self/fd/%d", dir.Fd())
+	if err := c.Checkpoint(dirPath, false /* direct */, sfOpts, pgalloc.SaveOpts{}); err != nil {
+		return nil, toStatus("checkpoint", err)
+	}
+	return &pb.CheckpointResponse{}, nil
+}
+
+// imagePath returns the host path of the checkpoint image directory p, which
+// is relative to the image root.
+func (s *Server) imagePath(p string) (string, error) {
+	if s.opts.ImageRoot == "" {
+		return "", status.Error(codes.FailedPrecondition, "checkpoint is disabled: no image root is configured")
+	}
+	if p == "" {
+		return "", status.Error(codes.InvalidArgument, "image_path must be set")
+	}
+	if !filepath.IsLocal(p) {
+		return "", status.Errorf(codes.InvalidArgument, "image_path %q must be relative to the image root and stay within it", p)
+	}
+	return filepath.Join(s.opts.ImageRoot, p), nil
+}
+
+// openImageDir opens the checkpoint image directory p, which is relative to
+// the image root, creating it and its parents as needed. Every component is
+// resolved beneath the image root, so symlinks under the root can't redirect
+// the image elsewhere on the host.
+func (s *Server) openImageDir(p string) (*os.File, error) {
+	imagePath, err := s.imagePath(p)
+	if err != nil {
+		return nil, err
+	}
+	rootFD, err := unix.Open(s.opts.ImageRoot, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "opening image root %q: %v", s.opts.ImageRoot, err)
+	}
+	defer unix.Close(rootFD)
+	how := unix.OpenHow{
+		Flags:   unix.O_PATH | unix.O_DIRECTORY | unix.O_CLOEXEC,
+		Resolve: unix.RESOLVE_BENEATH | unix.RESOLVE_NO_MAGICLINKS,
+	}
+	dirFD, err := unix.Dup(rootFD)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "dup: %v", err)
+	}
+	var prefix string
+	for _, name := range strings.Split(filepath.Clean(p), "/") {
+		prefix = filepath.Join(prefix, name)
+		// mkdirat(2) doesn't follow a symlink in the last component, the
+		// following openat2(2) resolves it beneath the root.
+		if err := unix.Mkdirat(dirFD, name, 0755); err != nil && err != unix.EEXIST {
+			unix.Close(dirFD)
+			return nil, status.Errorf(codes.InvalidArgument, "making directory %q: %v", filepath.Join(s.opts.ImageRoot, prefix), err)
+		}
+		next, err := unix.Openat2(rootFD, prefix, &how)
+		unix.Close(dirFD)
+		if err != nil {
+			if err == unix.EXDEV {
+				return nil, status.Errorf(codes.InvalidArgument, "image_path %q resolves outside of the image root", p)
+			}
+			return nil, status.Errorf(codes.InvalidArgument, "opening directory %q: %v", filepath.Join(s.opts.ImageRoot, prefix), err)
+		}
+		dirFD = next
+	}
+	return os.NewFile(uintptr(dirFD), imagePath), nil
+}
+
+// CreateTraceSession implements pb.SandboxServer.CreateTraceSession.
+func (s *Server) CreateTraceSession(ctx context.Context, req *pb.CreateTraceSessionRequest) (*pb.CreateTraceSessionResponse, error) {
+	decoder := json.NewDecoder(bytes.NewReader(req.GetConfig()))
+	decoder.DisallowUnknownFields()
+	var sessionConfig seccheck.SessionConfig
+	if err := decoder.Decode(&sessionConfig); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid session config: %v", err)
+	}
+	if err := checkSinks(sessionConfig.Sinks); err != nil {
+		return nil, err
+	}
+	c, err := s.load(req.GetContainerId(), container.LoadOpts{SkipCheck: true, RootContainer: true})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Sandbox.CreateTraceSession(&sessionConfig, req.GetForce()); err != nil {
+		return nil, toStatus("creating trace session", err)
+	}
+	return &pb.CreateTraceSessionResponse{}, nil
+}
+
+// checkSinks returns an error if any of the sinks can't be created on behalf
+// of API clients. Sinks with a setup step run it in this process, outside of
+// the sandbox, e.g. the remote sink connects to a host unix socket named in
+// its config, so clients could otherwise make the server connect anywhere.
+func checkSinks(sinks []seccheck.SinkConfig) error {
+	for _, sink := range sinks {
+		desc, ok := seccheck.Sinks[sink.Name]
+		if !ok {
+			return status.Errorf(codes.InvalidArgument, "unknown sink %q", sink.Name)
+		}
+		if desc.Setup != nil {
+			return status.Errorf(codes.InvalidArgument, "sink %q requires host-side setup, which is not allowed through the API", sink.Name)
+		}
+	}
+	return nil
+}
+
+// ListTraceSessions implements pb.SandboxServer.ListTraceSessions.
+func (s *Server) ListTraceSessions(ctx context.Context, req *pb.ListTraceSessionsRequest) (*pb.ListTraceSessionsResponse, error) {
+	c, err := s.load(req.GetContainerId(), container.LoadOpts{SkipCheck: true, RootContainer: true})
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := c.Sandbox.ListTraceSessions()
+	if err != nil {
+		return nil, toStatus("listing trace sessions", err)
+	}
+	resp := &pb.ListTraceSessionsResponse{}
+	for _, session := range sessions {
+		b, err := json.Marshal(&session)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "encoding trace session %q: %v", session.Name, err)
+		}
+		resp.Sessions = append(resp.Sessions, b)
+	}
+	return resp, nil
+}
+
+// DeleteTraceSession implements pb.SandboxServer.DeleteTraceSession.
+func (s *Server) DeleteTraceSession(ctx context.Context, req *pb.DeleteTraceSessionRequest) (*pb.DeleteTraceSessionResponse, error) {
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "name must be set")
+	}
+	c, err := s.load(req.GetContainerId(), container.LoadOpts{SkipCheck: true, RootContainer: true})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Sandbox.DeleteTraceSession(req.GetName()); err != nil {
+		return nil, toStatus("deleting trace session", err)
+	}
+	return &pb.DeleteTraceSessionResponse{}, nil
+}
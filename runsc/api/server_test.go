@@ -0,0 +1,199 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"github.com/wilinz/gvisor/pkg/sentry/seccheck"
+	pb "github.com/wilinz/gvisor/runsc/api/sandbox_go_proto"
+)
+
+func TestImagePath(t *testing.T) {
+	const root = "/var/lib/runsc/images"
+	for _, tc := range []struct {
+		name string
+		root string
+		path string
+		want string
+		code codes.Code
+	}{
+		{name: "relative", root: root, path: "foo", want: filepath.Join(root, "foo")},
+		{name: "nested", root: root, path: "foo/bar", want: filepath.Join(root, "foo/bar")},
+		{name: "cleaned", root: root, path: "foo/../bar", want: filepath.Join(root, "bar")},
+		{name: "empty", root: root, path: "", code: codes.InvalidArgument},
+		{name: "absolute", root: root, path: "/etc", code: codes.InvalidArgument},
+		{name: "parent", root: root, path: "..", code: codes.InvalidArgument},
+		{name: "escape", root: root, path: "foo/../../etc", code: codes.InvalidArgument},
+		{name: "disabled", path: "foo", code: codes.FailedPrecondition},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewServer(nil, Options{ImageRoot: tc.root})
+			got, err := s.imagePath(tc.path)
+			if code := status.Code(err); code != tc.code {
+				t.Fatalf("imagePath(%q) got error %v, want code %v", tc.path, err, tc.code)
+			}
+			if got != tc.want {
+				t.Errorf("imagePath(%q) = %q, want %q", tc.path, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestOpenImageDir(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(root, "outside")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../outside", filepath.Join(root, "dotdot")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("dir", filepath.Join(root, "inside")); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name string
+		path string
+		want string
+		code codes.Code
+	}{
+		{name: "new", path: "foo/bar", want: "foo/bar"},
+		{name: "existing", path: "dir", want: "dir"},
+		{name: "symlink inside", path: "inside/foo", want: "dir/foo"},
+		{name: "symlink outside", path: "outside", code: codes.InvalidArgument},
+		{name: "symlink outside parent", path: "outside/foo", code: codes.InvalidArgument},
+		{name: "relative symlink outside", path: "dotdot/foo", code: codes.InvalidArgument},
+		{name: "escape", path: "foo/../../etc", code: codes.InvalidArgument},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewServer(nil, Options{ImageRoot: root})
+			f, err := s.openImageDir(tc.path)
+			if code := status.Code(err); code != tc.code {
+				t.Fatalf("openImageDir(%q) got error %v, want code %v", tc.path, err, tc.code)
+			}
+			if err != nil {
+				return
+			}
+			defer f.Close()
+			got, err := os.Stat(f.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := os.Stat(filepath.Join(root, tc.want))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !os.SameFile(got, want) {
+				t.Errorf("openImageDir(%q) opened %q, want %q", tc.path, f.Name(), tc.want)
+			}
+		})
+	}
+	entries, err := os.ReadDir(outside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("directories created outside of the image root: %v", entries)
+	}
+}
+
+func TestCheckSinks(t *testing.T) {
+	seccheck.RegisterSink(seccheck.SinkDesc{Name: "api-test-sink"})
+	seccheck.RegisterSink(seccheck.SinkDesc{
+		Name:  "api-test-setup-sink",
+		Setup: func(map[string]any) (*os.File, error) { return nil, nil },
+	})
+	for _, tc := range []struct {
+		name  string
+		sinks []string
+		code  codes.Code
+	}{
+		{name: "none"},
+		{name: "no setup", sinks: []string{"api-test-sink"}},
+		{name: "setup", sinks: []string{"api-test-sink", "api-test-setup-sink"}, code: codes.InvalidArgument},
+		{name: "unknown", sinks: []string{"api-test-unknown-sink"}, code: codes.InvalidArgument},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var sinks []seccheck.SinkConfig
+			for _, name := range tc.sinks {
+				sinks = append(sinks, seccheck.SinkConfig{Name: name})
+			}
+			if code := status.Code(checkSinks(sinks)); code != tc.code {
+				t.Errorf("checkSinks(%v) got code %v, want %v", tc.sinks, code, tc.code)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	const token = "secret"
+	for _, tc := range []struct {
+		name  string
+		token string
+		md    metadata.MD
+		code  codes.Code
+	}{
+		{name: "no token configured"},
+		{name: "no token configured with metadata", md: metadata.Pairs("authorization", "Bearer foo")},
+		{name: "valid", token: token, md: metadata.Pairs("authorization", "Bearer "+token)},
+		{name: "missing", token: token, code: codes.Unauthenticated},
+		{name: "wrong", token: token, md: metadata.Pairs("authorization", "Bearer other"), code: codes.Unauthenticated},
+		{name: "no scheme", token: token, md: metadata.Pairs("authorization", token), code: codes.Unauthenticated},
+		{name: "prefix", token: token, md: metadata.Pairs("authorization", "Bearer "+token[:3]), code: codes.Unauthenticated},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewServer(nil, Options{AuthToken: tc.token})
+			ctx := context.Background()
+			if tc.md != nil {
+				ctx = metadata.NewIncomingContext(ctx, tc.md)
+			}
+			if code := status.Code(s.authenticate(ctx)); code != tc.code {
+				t.Errorf("authenticate() got code %v, want %v", code, tc.code)
+			}
+		})
+	}
+}
+
+func TestCheckUser(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		uid     uint32
+		initUID uint32
+		code    codes.Code
+	}{
+		{name: "root in root container", uid: 0, initUID: 0},
+		{name: "user in root container", uid: 1000, initUID: 0},
+		{name: "same user", uid: 1000, initUID: 1000},
+		{name: "other user", uid: 1001, initUID: 1000},
+		{name: "root in user container", uid: 0, initUID: 1000, code: codes.PermissionDenied},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkUser(&pb.User{Uid: tc.uid}, tc.initUID)
+			if code := status.Code(err); code != tc.code {
+				t.Errorf("checkUser(uid %d, init uid %d) got error %v, want code %v", tc.uid, tc.initUID, err, tc.code)
+			}
+		})
+	}
+}
@@ -24,6 +24,7 @@ import (
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"golang.org/x/sys/unix"
+	"github.com/wilinz/gvisor/pkg/abi/linux"
 	"github.com/wilinz/gvisor/pkg/cleanup"
 	"github.com/wilinz/gvisor/pkg/context"
 	"github.com/wilinz/gvisor/pkg/control/server"
@@ -82,6 +83,9 @@ const (
 	// ContMgrSignal sends a signal to a container.
 	ContMgrSignal = "containerManager.Signal"
 
+	// ContMgrSetWinsize sets the window size of a container process TTY.
+	ContMgrSetWinsize = "containerManager.SetWinsize"
+
 	// ContMgrStartSubcontainer starts a sub-container inside a running sandbox.
 	ContMgrStartSubcontainer = "containerManager.StartSubcontainer"
 
@@ -120,6 +124,9 @@ const (
 
 	// ContMgrContainerRuntimeState returns the runtime state of a container.
 	ContMgrContainerRuntimeState = "containerManager.ContainerRuntimeState"
+
+	// ContMgrHealth runs the sandbox health checks.
+	ContMgrHealth = "containerManager.Health"
 )
 
 const (
@@ -129,6 +136,28 @@ const (
 	// NetworkInitPluginStack initializes third-party network stack.
 	NetworkInitPluginStack = "Network.InitPluginStack"
 
+	// NetworkSetNetworkPolicy sets the network policy of the sandbox.
+	NetworkSetNetworkPolicy = "Network.SetNetworkPolicy"
+
+	// NetworkStartPCAP starts capturing the packets of the sandbox's network
+	// interfaces to a host file.
+	NetworkStartPCAP = "Network.StartPCAP"
+
+	// NetworkStopPCAP stops the capture started by NetworkStartPCAP.
+	NetworkStopPCAP = "Network.StopPCAP"
+
+	// NetworkPathMTUCache returns the path MTU cache of the sandbox's network
+	// stack.
+	NetworkPathMTUCache = "Network.PathMTUCache"
+
+	// NetworkFlushPathMTUCache flushes the path MTU cache of the sandbox's
+	// network stack.
+	NetworkFlushPathMTUCache = "Network.FlushPathMTUCache"
+
+	// NetworkNeighbors returns the neighbor tables of the sandbox's network
+	// interfaces.
+	NetworkNeighbors = "Network.Neighbors"
+
 	// DebugStacks collects sandbox stacks for debugging.
 	DebugStacks = "debug.Stacks"
 )
@@ -150,6 +179,7 @@ const (
 // Usage related commands (see usage.go for more details).
 const (
 	UsageCollect = "Usage.Collect"
+	UsageReclaim = "Usage.Reclaim"
 	UsageUsageFD = "Usage.UsageFD"
 )
 
@@ -161,6 +191,7 @@ const (
 
 // Commands for interacting with cgroupfs within the sandbox.
 const (
+	CgroupsList              = "Cgroups.List"
 	CgroupsReadControlFiles  = "Cgroups.ReadControlFiles"
 	CgroupsWriteControlFiles = "Cgroups.WriteControlFiles"
 )
@@ -710,15 +741,26 @@ type WaitPIDArgs struct {
 	// PID is the PID in the container's PID namespace.
 	PID int32
 
+	// PGID, if non-zero, is the ID of a process group in the container's
+	// PID namespace to wait on instead of PID. All processes in the group
+	// must be part of the container.
+	PGID int32
+
 	// CID is the container ID.
 	CID string
 }
 
-// WaitPID waits for the process with PID 'pid' in the sandbox.
+// WaitPID waits for the process with PID 'pid' in the sandbox, or for all
+// processes of the process group 'pgid' if set.
 func (cm *containerManager) WaitPID(args *WaitPIDArgs, waitStatus *uint32) error {
-	log.Debugf("containerManager.Wait, cid: %s, pid: %d", args.CID, args.PID)
-	err := cm.l.waitPID(kernel.ThreadID(args.PID), args.CID, waitStatus)
-	log.Debugf("containerManager.Wait, cid: %s, pid: %d, waitStatus: %#x, err: %v", args.CID, args.PID, *waitStatus, err)
+	log.Debugf("containerManager.Wait, cid: %s, pid: %d, pgid: %d", args.CID, args.PID, args.PGID)
+	var err error
+	if args.PGID != 0 {
+		err = cm.l.waitPGID(kernel.ProcessGroupID(args.PGID), args.CID, waitStatus)
+	} else {
+		err = cm.l.waitPID(kernel.ThreadID(args.PID), args.CID, waitStatus)
+	}
+	log.Debugf("containerManager.Wait, cid: %s, pid: %d, pgid: %d, waitStatus: %#x, err: %v", args.CID, args.PID, args.PGID, *waitStatus, err)
 	return err
 }
 
@@ -789,6 +831,27 @@ func (cm *containerManager) Signal(args *SignalArgs, _ *struct{}) error {
 	return cm.l.signal(args.CID, args.PID, args.Signo, args.Mode)
 }
 
+// SetWinsizeArgs are arguments to the SetWinsize method.
+type SetWinsizeArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// PID is the process ID in the given container whose TTY is resized,
+	// relative to the root PID namespace, not the container's.
+	// If 0, the TTY of the container init process is resized.
+	PID int32
+
+	// Winsize is the new window size.
+	Winsize linux.Winsize
+}
+
+// SetWinsize sets the window size of the host TTY attached to a process in a
+// container, and notifies the foreground process group with SIGWINCH.
+func (cm *containerManager) SetWinsize(args *SetWinsizeArgs, _ *struct{}) error {
+	log.Debugf("containerManager.SetWinsize: cid: %s, PID: %d, winsize: %+v", args.CID, args.PID, args.Winsize)
+	return cm.l.setWinsize(args.CID, kernel.ThreadID(args.PID), &args.Winsize)
+}
+
 // CreateTraceSessionArgs are arguments to the CreateTraceSession method.
 type CreateTraceSessionArgs struct {
 	Config seccheck.SessionConfig
@@ -943,3 +1006,11 @@ func (cm *containerManager) ContainerRuntimeState(cid *string, state *ContainerR
 	*state = cm.l.containerRuntimeState(*cid)
 	return nil
 }
+
+// Health runs the sandbox health checks. Failed checks are reported in status,
+// not as an error.
+func (cm *containerManager) Health(args *HealthArgs, status *HealthStatus) error {
+	log.Debugf("containerManager.Health: probe: %t", args.Probe)
+	*status = *cm.l.health(args)
+	return nil
+}
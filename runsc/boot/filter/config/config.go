@@ -27,6 +27,7 @@ import (
 	"github.com/wilinz/gvisor/pkg/seccomp/precompiledseccomp"
 	"github.com/wilinz/gvisor/pkg/sentry/devices/nvproxy"
 	"github.com/wilinz/gvisor/pkg/sentry/devices/nvproxy/nvconf"
+	"github.com/wilinz/gvisor/pkg/sentry/devices/rdmaproxy"
 	"github.com/wilinz/gvisor/pkg/sentry/devices/tpuproxy"
 	"github.com/wilinz/gvisor/pkg/sentry/platform"
 	"github.com/wilinz/gvisor/pkg/sentry/socket/plugin"
@@ -42,6 +43,7 @@ type Options struct {
 	NVProxy               bool
 	NVProxyCaps           nvconf.DriverCaps
 	TPUProxy              bool
+	RDMAProxy             bool
 	ControllerFD          uint32
 	CgoEnabled            bool
 	PluginNetwork         bool
@@ -71,6 +73,7 @@ func (opt Options) ConfigKey() string {
 	sb.WriteString(fmt.Sprintf("NVProxy=%t ", opt.NVProxy))
 	sb.WriteString(fmt.Sprintf("NVProxyCaps=%v ", opt.NVProxyCaps))
 	sb.WriteString(fmt.Sprintf("TPUProxy=%t ", opt.TPUProxy))
+	sb.WriteString(fmt.Sprintf("RDMAProxy=%t ", opt.RDMAProxy))
 	sb.WriteString(fmt.Sprintf("CgoEnabled=%t ", opt.CgoEnabled))
 	sb.WriteString(fmt.Sprintf("PluginNetwork=%t ", opt.PluginNetwork))
 	return strings.TrimSpace(sb.String())
@@ -102,6 +105,9 @@ func Warnings(opt Options) []string {
 	if opt.TPUProxy {
 		warnings = append(warnings, "TPU device proxy enabled: syscall filters less restrictive!")
 	}
+	if opt.RDMAProxy {
+		warnings = append(warnings, "RDMA device proxy enabled: syscall filters less restrictive!")
+	}
 	if opt.CgoEnabled {
 		warnings = append(warnings, "CGO enabled: syscall filters less restrictive!")
 	}
@@ -155,6 +161,9 @@ func rules(opt Options, vars precompiledseccomp.Values) (seccomp.SyscallRules, s
 	if opt.TPUProxy {
 		s.Merge(tpuproxy.Filters())
 	}
+	if opt.RDMAProxy {
+		s.Merge(rdmaproxy.Filters())
+	}
 	if opt.CgoEnabled {
 		s.Merge(cgoFilters())
 	}
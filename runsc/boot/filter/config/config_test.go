@@ -48,6 +48,10 @@ func TestIoctlFirstArgumentIsNonNegativeFD(t *testing.T) {
 			Platform: (&systrap.Systrap{}).SeccompInfo(),
 			TPUProxy: true,
 		},
+		"rdmaproxy": {
+			Platform:  (&systrap.Systrap{}).SeccompInfo(),
+			RDMAProxy: true,
+		},
 		"host network": {
 			Platform:    (&systrap.Systrap{}).SeccompInfo(),
 			HostNetwork: true,
@@ -111,6 +115,7 @@ func TestOptionsConfigKey(t *testing.T) {
 		"NVProxy":               func(opt *Options) { opt.NVProxy = !opt.NVProxy },
 		"NVProxyCaps":           func(opt *Options) { opt.NVProxyCaps = ^opt.NVProxyCaps },
 		"TPUProxy":              func(opt *Options) { opt.TPUProxy = !opt.TPUProxy },
+		"RDMAProxy":             func(opt *Options) { opt.RDMAProxy = !opt.RDMAProxy },
 		"CgoEnabled":            func(opt *Options) { opt.CgoEnabled = !opt.CgoEnabled },
 		"PluginNetwork":         func(opt *Options) { opt.PluginNetwork = !opt.PluginNetwork },
 	}
@@ -80,6 +80,7 @@ func hostInetFilters(allowRawSockets bool) seccomp.SyscallRules {
 		unix.SYS_READV:    seccomp.MatchAll{},
 		unix.SYS_RECVFROM: seccomp.MatchAll{},
 		unix.SYS_RECVMSG:  seccomp.MatchAll{},
+		unix.SYS_SENDFILE: seccomp.MatchAll{},
 		unix.SYS_SENDMSG:  seccomp.MatchAll{},
 		unix.SYS_SENDTO:   seccomp.MatchAll{},
 		unix.SYS_SHUTDOWN: seccomp.Or{
@@ -0,0 +1,338 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/log"
+	"github.com/wilinz/gvisor/pkg/sentry/control"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
+	"github.com/wilinz/gvisor/pkg/sentry/vfs"
+	"github.com/wilinz/gvisor/pkg/sentry/watchdog"
+	"github.com/wilinz/gvisor/runsc/specutils"
+)
+
+// HealthProbeAnnotation is the annotation holding a container's health
+// probe, encoded as a JSON HealthProbe. For example:
+//
+//	{"command": ["/bin/sh", "-c", "test -e /tmp/ready"], "timeout": "5s"}
+const HealthProbeAnnotation = "dev.gvisor.spec.health-probe"
+
+const (
+	// healthCheckTimeout bounds each of the built-in health checks.
+	healthCheckTimeout = 5 * time.Second
+
+	// defaultHealthProbeTimeout is the timeout of health probes that don't
+	// specify one.
+	defaultHealthProbeTimeout = 10 * time.Second
+
+	// maxHealthProbeTimeout is the largest timeout a health probe may have.
+	maxHealthProbeTimeout = time.Minute
+)
+
+// HealthProbe is a command run inside a container to check that it is
+// healthy. The container is healthy if the command exits with status 0
+// within the timeout. The command runs as the container's init process user,
+// with its environment, working directory and capabilities, and without
+// stdin, stdout or stderr.
+type HealthProbe struct {
+	// Command is the command line to run. Command[0] is looked up in the
+	// container's PATH if it doesn't contain a slash.
+	Command []string `json:"command"`
+
+	// Timeout is the time after which the command is killed and the probe
+	// fails, as parsed by time.ParseDuration. Defaults to 10s.
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// timeout returns the parsed timeout of p.
+func (p *HealthProbe) timeout() (time.Duration, error) {
+	if p.Timeout == "" {
+		return defaultHealthProbeTimeout, nil
+	}
+	d, err := time.ParseDuration(p.Timeout)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 || d > maxHealthProbeTimeout {
+		return 0, fmt.Errorf("timeout %v must be positive and at most %v", d, maxHealthProbeTimeout)
+	}
+	return d, nil
+}
+
+// healthProbeFromSpec returns the health probe set in the spec annotations,
+// or nil if there is none.
+func healthProbeFromSpec(spec *specs.Spec) (*HealthProbe, error) {
+	val, ok := spec.Annotations[HealthProbeAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	decoder := json.NewDecoder(strings.NewReader(val))
+	decoder.DisallowUnknownFields()
+	var p HealthProbe
+	if err := decoder.Decode(&p); err != nil {
+		return nil, fmt.Errorf("invalid %q annotation: %w", HealthProbeAnnotation, err)
+	}
+	if len(p.Command) == 0 || p.Command[0] == "" {
+		return nil, fmt.Errorf("invalid %q annotation: command must not be empty", HealthProbeAnnotation)
+	}
+	if _, err := p.timeout(); err != nil {
+		return nil, fmt.Errorf("invalid %q annotation: %w", HealthProbeAnnotation, err)
+	}
+	return &p, nil
+}
+
+// HealthArgs are arguments to the Health RPC.
+type HealthArgs struct {
+	// Probe, if true, also runs the health probes configured with
+	// HealthProbeAnnotation in the sandbox's containers.
+	Probe bool
+}
+
+// HealthCheck is the outcome of one health check.
+type HealthCheck struct {
+	// Name identifies the check: "sentry", "watchdog", "gofer/<container ID>"
+	// or "probe/<container ID>".
+	Name string `json:"name"`
+
+	// Healthy is true if the check passed.
+	Healthy bool `json:"healthy"`
+
+	// Message describes the outcome of the check.
+	Message string `json:"message,omitempty"`
+
+	// Duration is how long the check took.
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// HealthStatus is the result of the Health RPC.
+type HealthStatus struct {
+	// Healthy is true if all checks passed.
+	Healthy bool `json:"healthy"`
+
+	// Checks are the individual checks that were run.
+	Checks []HealthCheck `json:"checks"`
+}
+
+// add runs check and records its outcome as name.
+func (s *HealthStatus) add(name string, check func() (string, error)) {
+	start := time.Now()
+	msg, err := check()
+	c := HealthCheck{
+		Name:     name,
+		Healthy:  err == nil,
+		Message:  msg,
+		Duration: time.Since(start),
+	}
+	if err != nil {
+		c.Message = err.Error()
+		log.Warningf("Health check %q failed: %v", name, err)
+	}
+	s.Checks = append(s.Checks, c)
+}
+
+// withTimeout runs f and returns its result, or an error if it doesn't return
+// within timeout. In the latter case f keeps running in the background.
+func withTimeout(timeout time.Duration, f func() (string, error)) (string, error) {
+	type result struct {
+		msg string
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() { // S/R-SAFE: only reads state, and the caller doesn't wait for it past the timeout.
+		msg, err := f()
+		ch <- result{msg, err}
+	}()
+	select {
+	case r := <-ch:
+		return r.msg, r.err
+	case <-time.After(timeout):
+		return "", fmt.Errorf("timed out after %v", timeout)
+	}
+}
+
+// healthContainer is a started container to run health checks on.
+type healthContainer struct {
+	cid  string
+	tg   *kernel.ThreadGroup
+	spec *specs.Spec
+}
+
+// health runs the sandbox's health checks.
+func (l *Loader) health(args *HealthArgs) *HealthStatus {
+	var containers []healthContainer
+	l.mu.Lock()
+	specByCID := make(map[string]*specs.Spec, len(l.containerIDs))
+	for name, cid := range l.containerIDs {
+		specByCID[cid] = l.containerSpecs[name]
+	}
+	for eid, ep := range l.processes {
+		if eid.pid != 0 || ep.tg == nil {
+			// Exec'd process, or container not started yet.
+			continue
+		}
+		containers = append(containers, healthContainer{cid: eid.cid, tg: ep.tg, spec: specByCID[eid.cid]})
+	}
+	k := l.k
+	l.mu.Unlock()
+	sort.Slice(containers, func(i, j int) bool { return containers[i].cid < containers[j].cid })
+
+	status := &HealthStatus{}
+	status.add("sentry", func() (string, error) {
+		return withTimeout(healthCheckTimeout, func() (string, error) {
+			// Listing tasks takes the root PID namespace lock, which most
+			// kernel deadlocks end up involving.
+			return fmt.Sprintf("%d tasks", k.TaskSet().Root.NumTasks()), nil
+		})
+	})
+	status.add("watchdog", func() (string, error) {
+		return watchdogHealth(l.watchdog.Status())
+	})
+	for _, c := range containers {
+		tg := c.tg
+		status.add("gofer/"+c.cid, func() (string, error) {
+			return withTimeout(healthCheckTimeout, func() (string, error) {
+				return "", statContainerRoot(k, tg)
+			})
+		})
+	}
+	if args.Probe {
+		for _, c := range containers {
+			if c.spec == nil {
+				continue
+			}
+			probe, err := healthProbeFromSpec(c.spec)
+			if err != nil {
+				status.add("probe/"+c.cid, func() (string, error) { return "", err })
+				continue
+			}
+			if probe == nil {
+				continue
+			}
+			status.add("probe/"+c.cid, func() (string, error) {
+				return l.runHealthProbe(c.cid, c.spec, probe)
+			})
+		}
+	}
+
+	status.Healthy = true
+	for _, c := range status.Checks {
+		status.Healthy = status.Healthy && c.Healthy
+	}
+	return status
+}
+
+// watchdogHealth checks the given watchdog status.
+func watchdogHealth(s watchdog.Status) (string, error) {
+	switch {
+	case !s.Enabled:
+		return "disabled", nil
+	case !s.Running:
+		return "", errors.New("not running")
+	case s.Stalled:
+		return "", fmt.Errorf("took longer than %v to list tasks", s.TaskTimeout)
+	case s.StuckTasks > 0:
+		return "", fmt.Errorf("%d task(s) stuck in the kernel for longer than %v", s.StuckTasks, s.TaskTimeout)
+	}
+	// The watchdog should complete a pass every period, give it some slack
+	// in case the sandbox is starved of CPU.
+	if since := time.Since(s.LastActive); since > 2*s.Period+s.TaskTimeout {
+		return "", fmt.Errorf("inactive for %v", since.Round(time.Second))
+	}
+	return "ok", nil
+}
+
+// statContainerRoot checks that the root filesystem of the container whose
+// init process is tg, which is usually served by a gofer, responds.
+func statContainerRoot(k *kernel.Kernel, tg *kernel.ThreadGroup) error {
+	// task.MountNamespace() does not take a ref, so we must do so ourselves.
+	mntns := tg.Leader().MountNamespace()
+	if mntns == nil || !mntns.TryIncRef() {
+		return errors.New("container has stopped")
+	}
+	ctx := k.SupervisorContext()
+	defer mntns.DecRef(ctx)
+	root := mntns.Root(ctx)
+	defer root.DecRef(ctx)
+	if _, err := k.VFS().StatFSAt(ctx, auth.CredentialsFromContext(ctx), &vfs.PathOperation{Root: root, Start: root}); err != nil {
+		return fmt.Errorf("statfs on root filesystem: %w", err)
+	}
+	return nil
+}
+
+// runHealthProbe runs probe in the container cid with the given spec, and
+// returns an error unless it exits with status 0 within its timeout.
+func (l *Loader) runHealthProbe(cid string, spec *specs.Spec, probe *HealthProbe) (string, error) {
+	timeout, err := probe.timeout()
+	if err != nil {
+		return "", err
+	}
+	caps, err := specutils.Capabilities(l.root.conf.EnableRaw, spec.Process.Capabilities)
+	if err != nil {
+		return "", fmt.Errorf("capabilities: %w", err)
+	}
+	extraKGIDs := make([]auth.KGID, 0, len(spec.Process.User.AdditionalGids))
+	for _, gid := range spec.Process.User.AdditionalGids {
+		extraKGIDs = append(extraKGIDs, auth.KGID(gid))
+	}
+	tgid, err := l.executeAsync(&control.ExecArgs{
+		Argv:             probe.Command,
+		Envv:             spec.Process.Env,
+		WorkingDirectory: spec.Process.Cwd,
+		KUID:             auth.KUID(spec.Process.User.UID),
+		KGID:             auth.KGID(spec.Process.User.GID),
+		ExtraKGIDs:       extraKGIDs,
+		Capabilities:     caps,
+		ContainerID:      cid,
+	})
+	if err != nil {
+		return "", fmt.Errorf("starting %q: %w", probe.Command[0], err)
+	}
+
+	done := make(chan error, 1)
+	var ws uint32
+	go func() { // S/R-SAFE: the probe is waited for before health returns.
+		done <- l.waitPID(tgid, cid, &ws)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return "", err
+		}
+	case <-time.After(timeout):
+		if err := l.signalProcess(cid, tgid, int32(linux.SIGKILL)); err != nil {
+			log.Warningf("Failed to kill health probe %d in container %q: %v", tgid, cid, err)
+		}
+		<-done
+		return "", fmt.Errorf("%q timed out after %v", probe.Command[0], timeout)
+	}
+	status := linux.WaitStatus(ws)
+	switch {
+	case status.Signaled():
+		return "", fmt.Errorf("%q killed by signal %v", probe.Command[0], status.TerminationSignal())
+	case status.ExitStatus() != 0:
+		return "", fmt.Errorf("%q exited with status %d", probe.Command[0], status.ExitStatus())
+	}
+	return "ok", nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"testing"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/wilinz/gvisor/pkg/sentry/watchdog"
+)
+
+func TestHealthProbeAnnotation(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		annotation  string
+		wantTimeout time.Duration
+		wantErr     bool
+	}{
+		{
+			name:        "default timeout",
+			annotation:  `{"command": ["/bin/true"]}`,
+			wantTimeout: defaultHealthProbeTimeout,
+		},
+		{
+			name:        "timeout",
+			annotation:  `{"command": ["/bin/sh", "-c", "exit 0"], "timeout": "3s"}`,
+			wantTimeout: 3 * time.Second,
+		},
+		{
+			name:       "no command",
+			annotation: `{"timeout": "3s"}`,
+			wantErr:    true,
+		},
+		{
+			name:       "empty command",
+			annotation: `{"command": [""]}`,
+			wantErr:    true,
+		},
+		{
+			name:       "unknown field",
+			annotation: `{"command": ["/bin/true"], "interval": "3s"}`,
+			wantErr:    true,
+		},
+		{
+			name:       "invalid timeout",
+			annotation: `{"command": ["/bin/true"], "timeout": "soon"}`,
+			wantErr:    true,
+		},
+		{
+			name:       "timeout too long",
+			annotation: `{"command": ["/bin/true"], "timeout": "1h"}`,
+			wantErr:    true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			spec := &specs.Spec{Annotations: map[string]string{HealthProbeAnnotation: tc.annotation}}
+			probe, err := healthProbeFromSpec(spec)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("healthProbeFromSpec() = %+v, want error", probe)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("healthProbeFromSpec(): %v", err)
+			}
+			timeout, err := probe.timeout()
+			if err != nil {
+				t.Fatalf("timeout(): %v", err)
+			}
+			if timeout != tc.wantTimeout {
+				t.Errorf("timeout() = %v, want %v", timeout, tc.wantTimeout)
+			}
+		})
+	}
+
+	probe, err := healthProbeFromSpec(&specs.Spec{})
+	if probe != nil || err != nil {
+		t.Errorf("healthProbeFromSpec() without annotation = %+v, %v, want nil, nil", probe, err)
+	}
+}
+
+func TestWatchdogHealth(t *testing.T) {
+	healthy := watchdog.Status{
+		Enabled:     true,
+		Running:     true,
+		LastActive:  time.Now(),
+		Period:      time.Minute,
+		TaskTimeout: 3 * time.Minute,
+	}
+	for _, tc := range []struct {
+		name    string
+		modify  func(*watchdog.Status)
+		healthy bool
+	}{
+		{name: "healthy", modify: func(*watchdog.Status) {}, healthy: true},
+		{name: "disabled", modify: func(s *watchdog.Status) { *s = watchdog.Status{} }, healthy: true},
+		{name: "stopped", modify: func(s *watchdog.Status) { s.Running = false }},
+		{name: "stalled", modify: func(s *watchdog.Status) { s.Stalled = true }},
+		{name: "stuck tasks", modify: func(s *watchdog.Status) { s.StuckTasks = 2 }},
+		{name: "inactive", modify: func(s *watchdog.Status) { s.LastActive = time.Now().Add(-time.Hour) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := healthy
+			tc.modify(&s)
+			if _, err := watchdogHealth(s); (err == nil) != tc.healthy {
+				t.Errorf("watchdogHealth(%+v) = %v, want healthy %t", s, err, tc.healthy)
+			}
+		})
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"os"
 	"runtime"
 	"strconv"
@@ -43,12 +44,15 @@ import (
 	"github.com/wilinz/gvisor/pkg/sentry/devices/nvproxy"
 	"github.com/wilinz/gvisor/pkg/sentry/devices/nvproxy/nvconf"
 	"github.com/wilinz/gvisor/pkg/sentry/fdimport"
+	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/gofer"
 	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/host"
 	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/tmpfs"
 	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/user"
+	"github.com/wilinz/gvisor/pkg/sentry/hostmm"
 	"github.com/wilinz/gvisor/pkg/sentry/inet"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel/auth"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel/pipe"
 	"github.com/wilinz/gvisor/pkg/sentry/loader"
 	"github.com/wilinz/gvisor/pkg/sentry/pgalloc"
 	"github.com/wilinz/gvisor/pkg/sentry/platform"
@@ -73,6 +77,7 @@ import (
 	"github.com/wilinz/gvisor/pkg/tcpip/network/ipv6"
 	"github.com/wilinz/gvisor/pkg/tcpip/stack"
 	"github.com/wilinz/gvisor/pkg/tcpip/transport/icmp"
+	"github.com/wilinz/gvisor/pkg/tcpip/transport/mptcp"
 	"github.com/wilinz/gvisor/pkg/tcpip/transport/raw"
 	"github.com/wilinz/gvisor/pkg/tcpip/transport/tcp"
 	"github.com/wilinz/gvisor/pkg/tcpip/transport/udp"
@@ -91,7 +96,11 @@ import (
 
 	// Include other supported socket providers.
 	_ "github.com/wilinz/gvisor/pkg/sentry/socket/netlink"
+	_ "github.com/wilinz/gvisor/pkg/sentry/socket/netlink/audit"
+	_ "github.com/wilinz/gvisor/pkg/sentry/socket/netlink/connector"
+	_ "github.com/wilinz/gvisor/pkg/sentry/socket/netlink/netfilter"
 	_ "github.com/wilinz/gvisor/pkg/sentry/socket/netlink/route"
+	_ "github.com/wilinz/gvisor/pkg/sentry/socket/netlink/sockdiag"
 	_ "github.com/wilinz/gvisor/pkg/sentry/socket/netlink/uevent"
 	_ "github.com/wilinz/gvisor/pkg/sentry/socket/unix"
 )
@@ -154,6 +163,13 @@ type containerInfo struct {
 	// nvidiaDriverVersion is the NVIDIA driver ABI version to use for
 	// communicating with NVIDIA devices on the host.
 	nvidiaDriverVersion nvconf.DriverVersion
+
+	// nvidiaCapsDevMajor is the device major number used for nvidia-caps.
+	nvidiaCapsDevMajor uint32
+
+	// nvidiaDriverFiles holds the contents of the host's /proc/driver/nvidia
+	// files exposed to containers, for all GPUs. See proc.InternalData.
+	nvidiaDriverFiles map[string]string
 }
 
 type loaderState int
@@ -185,6 +201,10 @@ type Loader struct {
 	// container. It should be called when a sandbox is destroyed.
 	stopSignalForwarding func()
 
+	// stopDentryReclaim stops shrinking dentry caches under memory pressure.
+	// It is nil if memory pressure notifications are unavailable.
+	stopDentryReclaim func()
+
 	// stopProfiling stops profiling started at container creation. It
 	// should be called when a sandbox is destroyed.
 	stopProfiling func()
@@ -208,6 +228,11 @@ type Loader struct {
 	// /sys/devices/virtual/dmi/id/product_name.
 	productName string
 
+	// goferContentCache caches the contents of files of the read-only lower
+	// layers of gofer-backed overlays. It is nil if --gofer-content-cache
+	// isn't set.
+	goferContentCache *gofer.ContentCache
+
 	hostTHP HostTHP
 
 	// mu guards the fields below.
@@ -346,6 +371,12 @@ type Args struct {
 	// SinkFDs is an ordered array of file descriptors to be used by seccheck
 	// sinks configured from the --pod-init-config file.
 	SinkFDs []int
+	// MACProfileFD is the file descriptor to a file passed in the
+	// --mac-profile flag.
+	MACProfileFD int
+	// GoferContentCacheFD is the file descriptor to the directory passed in
+	// the --gofer-content-cache flag.
+	GoferContentCacheFD int
 	// ProfileOpts contains the set of profiles to enable and the
 	// corresponding FDs where profile data will be written.
 	ProfileOpts profile.Opts
@@ -382,6 +413,14 @@ const (
 	// versionKey is the key used to add and pop runsc version to the kernel
 	// during save/restore.
 	versionKey = "runsc_version"
+
+	// dentryReclaimPercent is the percentage of cached dentries evicted
+	// upon each memory pressure notification.
+	dentryReclaimPercent = 50
+
+	// goferContentCacheMaxFileSize is the size of the largest file stored
+	// in the gofer content cache.
+	goferContentCacheMaxFileSize = 256 << 20
 )
 
 func getRootCredentials(spec *specs.Spec, conf *config.Config, userNs *auth.UserNamespace) *auth.Credentials {
@@ -439,6 +478,14 @@ func New(args Args) (*Loader, error) {
 
 	kernel.IOUringEnabled = args.Conf.IOUring
 
+	// The MAC policy must be in place before any filesystem is created or
+	// task started.
+	if args.MACProfileFD >= 0 {
+		if err := setupLSM(args.MACProfileFD); err != nil {
+			return nil, fmt.Errorf("setting up MAC profile: %w", err)
+		}
+	}
+
 	eid := execID{cid: args.ID}
 	l := &Loader{
 		sandboxID:      args.ID,
@@ -451,6 +498,9 @@ func New(args Args) (*Loader, error) {
 		containerSpecs: make(map[string]*specs.Spec),
 		saveFDs:        args.SaveFDs,
 	}
+	if args.GoferContentCacheFD >= 0 {
+		l.goferContentCache = gofer.NewContentCache(args.GoferContentCacheFD, goferContentCacheMaxFileSize)
+	}
 
 	containerName := l.registerContainer(args.Spec, args.ID)
 	l.root = containerInfo{
@@ -461,6 +511,15 @@ func New(args Args) (*Loader, error) {
 		goferMountConfs:     args.GoferMountConfs,
 		nvidiaDriverVersion: args.NvidiaDriverVersion,
 	}
+	if specutils.NVProxyEnabled(args.Spec, args.Conf) {
+		// Host procfs is no longer accessible once the sandbox is running,
+		// so read the driver's files now.
+		files, err := specutils.ReadNvidiaDriverFiles(specutils.NvidiaDriverProcPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading NVIDIA driver procfs files: %w", err)
+		}
+		l.root.nvidiaDriverFiles = files
+	}
 
 	// Make host FDs stable between invocations. Host FDs must map to the exact
 	// same number when the sandbox is restored. Otherwise the wrong FD will be
@@ -532,11 +591,17 @@ func New(args Args) (*Loader, error) {
 	// Create timekeeper.
 	tk := kernel.NewTimekeeper()
 	params := kernel.NewVDSOParamPage(l.k.MemoryFile(), vdso.ParamPage.FileRange())
-	tk.SetClocks(time.NewCalibratedClocks(), params)
+	tk.SetClocks(platform.WrapClocks(p, time.NewCalibratedClocks()), params)
 
 	if err := enableStrace(args.Conf); err != nil {
 		return nil, fmt.Errorf("enabling strace: %w", err)
 	}
+	enableSyscallProfile(args.Conf)
+	if args.Conf.SyscallLatencyMetrics {
+		if err := kernel.EnableSyscallLatencyMetric(); err != nil {
+			return nil, fmt.Errorf("enabling syscall latency metrics: %w", err)
+		}
+	}
 
 	creds := getRootCredentials(args.Spec, args.Conf, nil /* UserNamespace */)
 	if creds == nil {
@@ -547,6 +612,17 @@ func New(args Args) (*Loader, error) {
 	if err != nil {
 		return nil, fmt.Errorf("creating network: %w", err)
 	}
+	if policy, err := networkPolicyFromSpec(args.Spec); err != nil {
+		return nil, err
+	} else if policy != nil {
+		eps, ok := netns.Stack().(*netstack.Stack)
+		if !ok {
+			return nil, fmt.Errorf("%q annotation requires --network=sandbox or --network=none", NetworkPolicyAnnotation)
+		}
+		if err := setNetworkPolicy(eps.Stack, policy); err != nil {
+			return nil, fmt.Errorf("setting network policy: %w", err)
+		}
+	}
 
 	// S/R is not supported for hostinet.
 	if l.root.conf.Network != config.NetworkHost && args.Conf.TestOnlySaveRestoreNetstack {
@@ -576,18 +652,33 @@ func New(args Args) (*Loader, error) {
 		log.Infof("Setting total memory to %.2f GB", float64(args.TotalMem)/(1<<30))
 	}
 
-	maxFDLimit := kernel.MaxFdLimit
-	if args.Spec.Linux != nil && args.Spec.Linux.Sysctl != nil {
-		if val, ok := args.Spec.Linux.Sysctl["fs.nr_open"]; ok {
-			nrOpen, err := strconv.Atoi(val)
-			if err != nil {
-				return nil, fmt.Errorf("setting fs.nr_open=%s: %w", val, err)
-			}
-			if nrOpen <= 0 || nrOpen > int(kernel.MaxFdLimit) {
-				return nil, fmt.Errorf("setting fs.nr_open=%s", val)
-			}
-			maxFDLimit = int32(nrOpen)
-		}
+	maxFDLimit, err := sysctlUint(args.Spec, "fs.nr_open", uint64(kernel.MaxFdLimit), 1, uint64(kernel.MaxFdLimit))
+	if err != nil {
+		return nil, err
+	}
+	maxOpenFiles, err := sysctlUint(args.Spec, "fs.file-max", args.Conf.FileMax, 0, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+	pipeMaxSize, err := sysctlUint(args.Spec, "fs.pipe-max-size", args.Conf.PipeMaxSize, 0, pipe.MaximumPipeSizeLimit)
+	if err != nil {
+		return nil, err
+	}
+	aioMaxEvents, err := sysctlUint(args.Spec, "fs.aio-max-nr", args.Conf.AIOMaxNr, 0, math.MaxUint64)
+	if err != nil {
+		return nil, err
+	}
+	cpuFeatures, err := cpuid.ParseFeatureOverrides(args.Conf.CPUFeatures)
+	if err != nil {
+		return nil, fmt.Errorf("parsing --cpu-features: %w", err)
+	}
+	featureSet, err := cpuid.HostFeatureSet().Fixed().Override(cpuFeatures)
+	if err != nil {
+		return nil, fmt.Errorf("applying --cpu-features: %w", err)
+	}
+	emulatedIOPorts, err := kernel.ParseIOPortRanges(args.Conf.EmulatedIOPorts)
+	if err != nil {
+		return nil, fmt.Errorf("parsing --emulated-ioports: %w", err)
 	}
 	// Initiate the Kernel object, which is required by the Context passed
 	// to createVFS in order to mount (among other things) procfs.
@@ -595,7 +686,7 @@ func New(args Args) (*Loader, error) {
 		DisconnectOnSave: args.Conf.NetDisconnectOk,
 	}
 	if err = l.k.Init(kernel.InitKernelArgs{
-		FeatureSet:           cpuid.HostFeatureSet().Fixed(),
+		FeatureSet:           featureSet,
 		Timekeeper:           tk,
 		RootUserNamespace:    creds.UserNamespace,
 		RootNetworkNamespace: netns,
@@ -605,8 +696,13 @@ func New(args Args) (*Loader, error) {
 		RootUTSNamespace:     kernel.NewUTSNamespace(args.Spec.Hostname, args.Spec.Hostname, creds.UserNamespace),
 		RootIPCNamespace:     kernel.NewIPCNamespace(creds.UserNamespace),
 		PIDNamespace:         kernel.NewRootPIDNamespace(creds.UserNamespace),
-		MaxFDLimit:           maxFDLimit,
+		MaxFDLimit:           int32(maxFDLimit),
+		MaxOpenFiles:         maxOpenFiles,
+		PipeMaxSize:          int64(pipeMaxSize),
+		AIOMaxEvents:         aioMaxEvents,
 		UnixSocketOpts:       unixSocketOpts,
+		TimerSlack:           gtime.Duration(args.Conf.TimerSlack) * gtime.Microsecond,
+		EmulatedIOPorts:      emulatedIOPorts,
 	}); err != nil {
 		return nil, fmt.Errorf("initializing kernel: %w", err)
 	}
@@ -652,6 +748,20 @@ func New(args Args) (*Loader, error) {
 	defer hostFilesystem.DecRef(l.k.SupervisorContext())
 	l.k.SetHostMount(l.k.VFS().NewDisconnectedMount(hostFilesystem, nil, &vfs.MountOptions{}))
 
+	// Bound the number of dentries cached across all filesystems, and shrink
+	// the caches when the sandbox is under memory pressure.
+	if args.Conf.DCacheMax > 0 {
+		l.k.VFS().SetMaxCachedDentries(uint64(args.Conf.DCacheMax))
+	}
+	if stop, err := hostmm.NotifyCurrentMemcgPressureCallback(func() {
+		n := l.k.VFS().ReclaimCachedDentries(l.k.SupervisorContext(), dentryReclaimPercent)
+		log.Debugf("Reclaimed %d cached dentries due to memcg pressure", n)
+	}, "medium"); err != nil {
+		log.Infof("Dentry caches won't shrink under memory pressure: %v", err)
+	} else {
+		l.stopDentryReclaim = stop
+	}
+
 	if args.PodInitConfigFD >= 0 {
 		if err := setupSeccheck(args.PodInitConfigFD, args.SinkFDs); err != nil {
 			log.Warningf("unable to configure event session: %v", err)
@@ -691,6 +801,26 @@ func New(args Args) (*Loader, error) {
 	return l, nil
 }
 
+// sysctlUint returns the value of the sysctl name set by spec, or def if spec
+// doesn't set it. The value must be within [min, max].
+func sysctlUint(spec *specs.Spec, name string, def, min, max uint64) (uint64, error) {
+	if spec.Linux == nil {
+		return def, nil
+	}
+	val, ok := spec.Linux.Sysctl[name]
+	if !ok {
+		return def, nil
+	}
+	v, err := strconv.ParseUint(val, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("setting %s=%s: %w", name, val, err)
+	}
+	if v < min || v > max {
+		return 0, fmt.Errorf("setting %s=%s: must be between %d and %d", name, val, min, max)
+	}
+	return v, nil
+}
+
 // createProcessArgs creates args that can be used with kernel.CreateProcess.
 func createProcessArgs(id string, spec *specs.Spec, conf *config.Config, creds *auth.Credentials, k *kernel.Kernel, pidns *kernel.PIDNamespace) (kernel.CreateProcessArgs, error) {
 	// Create initial limits.
@@ -740,6 +870,9 @@ func (l *Loader) Destroy() {
 	if l.stopSignalForwarding != nil {
 		l.stopSignalForwarding()
 	}
+	if l.stopDentryReclaim != nil {
+		l.stopDentryReclaim()
+	}
 	l.watchdog.Stop()
 
 	ctx := l.k.SupervisorContext()
@@ -885,11 +1018,12 @@ func (l *Loader) installSeccompFilters() error {
 			Platform:              l.k.Platform.SeccompInfo(),
 			HostNetwork:           hostnet,
 			HostNetworkRawSockets: hostnet && l.root.conf.EnableRaw,
-			HostFilesystem:        l.root.conf.DirectFS,
+			HostFilesystem:        l.root.conf.DirectFS || l.goferContentCache != nil,
 			ProfileEnable:         l.root.conf.ProfileEnable,
 			NVProxy:               nvproxyEnabled,
 			NVProxyCaps:           nvproxyCaps,
 			TPUProxy:              specutils.TPUProxyIsEnabled(l.root.spec, l.root.conf),
+			RDMAProxy:             l.root.conf.RDMAProxy,
 			ControllerFD:          uint32(l.ctrl.srv.FD()),
 			CgoEnabled:            config.CgoEnabled,
 			PluginNetwork:         l.root.conf.Network == config.NetworkPlugin,
@@ -916,13 +1050,21 @@ func (l *Loader) Run() error {
 	return nil
 }
 
+// StartRoot starts the root container without waiting for a start request
+// from the control server. Unlike Run, it doesn't report the result to a
+// runtime, so it is only meant for programs that embed the Loader directly
+// instead of running it in a runsc sandbox process (see runsc/embedded).
+func (l *Loader) StartRoot() error {
+	return l.run()
+}
+
 func (l *Loader) run() error {
 	if l.root.conf.Network == config.NetworkHost {
 		// Delay host network configuration to this point because network namespace
 		// is configured after the loader is created and before Run() is called.
 		log.Debugf("Configuring host network")
 		s := l.k.RootNetworkNamespace().Stack().(*hostinet.Stack)
-		if err := s.Configure(l.root.conf.EnableRaw); err != nil {
+		if err := configureHostinet(s, l.root.conf); err != nil {
 			return err
 		}
 	}
@@ -1013,6 +1155,7 @@ func (l *Loader) run() error {
 	if err := l.k.Start(); err != nil {
 		return err
 	}
+	l.k.StartWorkingSetSampler(gtime.Duration(l.root.conf.WorkingSetSamplePeriod) * gtime.Millisecond)
 	l.state = started
 	return nil
 }
@@ -1083,6 +1226,8 @@ func (l *Loader) startSubcontainer(spec *specs.Spec, conf *config.Config, cid st
 		goferMountConfs:     goferMountConfs,
 		nvidiaUVMDevMajor:   l.root.nvidiaUVMDevMajor,
 		nvidiaDriverVersion: l.root.nvidiaDriverVersion,
+		nvidiaCapsDevMajor:  l.root.nvidiaCapsDevMajor,
+		nvidiaDriverFiles:   l.root.nvidiaDriverFiles,
 	}
 	var err error
 	info.procArgs, err = createProcessArgs(cid, spec, conf, creds, l.k, pidns)
@@ -1160,6 +1305,8 @@ func (l *Loader) createContainerProcess(info *containerInfo) (*kernel.ThreadGrou
 
 	if ttyFile != nil {
 		info.procArgs.TTY = ttyFile.TTY()
+		// The container's terminal also backs its /dev/console.
+		l.k.RegisterContainerConsole(info.containerName, ttyFile.TTY())
 	}
 
 	if info.execFD != nil {
@@ -1197,6 +1344,7 @@ func (l *Loader) createContainerProcess(info *containerInfo) (*kernel.ThreadGrou
 	// We can share l.sharedMounts with containerMounter since l.mu is locked.
 	// Hence, mntr must only be used within this function (while l.mu is locked).
 	mntr := newContainerMounter(info, l.k, l.mountHints, l.sharedMounts, l.productName, l.sandboxID)
+	mntr.contentCache = l.goferContentCache
 	if err := setupContainerVFS(ctx, info, mntr, &info.procArgs); err != nil {
 		return nil, nil, err
 	}
@@ -1334,8 +1482,9 @@ func (l *Loader) destroySubcontainer(cid string) error {
 			delete(l.processes, key)
 		}
 	}
-	// Cleanup the device gofer.
+	// Cleanup the device gofer and console.
 	l.k.RemoveDevGofer(l.k.ContainerName(cid))
+	l.k.UnregisterContainerConsole(l.k.ContainerName(cid))
 
 	log.Debugf("Container destroyed, cid: %s", cid)
 	return nil
@@ -1480,6 +1629,56 @@ func (l *Loader) waitPID(tgid kernel.ThreadID, cid string, waitStatus *uint32) e
 	return nil
 }
 
+// waitPGID waits for all processes of the process group with ID 'pgid' in the
+// container's PID namespace to exit. waitStatus is set to the exit status of
+// the process group leader if it is still part of the group, and to the exit
+// status of the last process waited on otherwise.
+//
+// Processes joining the group after waitPGID is called aren't waited on.
+func (l *Loader) waitPGID(pgid kernel.ProcessGroupID, cid string, waitStatus *uint32) error {
+	if pgid <= 0 {
+		return fmt.Errorf("PGID (%d) must be positive", pgid)
+	}
+	initTG, err := l.threadGroupFromID(execID{cid: cid})
+	if err != nil {
+		return fmt.Errorf("waiting for process group %d: %w", pgid, err)
+	}
+	pidns := initTG.PIDNamespace()
+	pg := pidns.ProcessGroupWithID(pgid)
+	if pg == nil {
+		return fmt.Errorf("waiting for process group %d: no such process group", pgid)
+	}
+
+	// The PID namespace may be shared with other containers, whose processes
+	// can't be waited on through this container.
+	var members []*kernel.ThreadGroup
+	var leader *kernel.ThreadGroup
+	for _, tg := range pidns.ThreadGroups() {
+		if tg.ProcessGroup() != pg {
+			continue
+		}
+		if tg.Leader().ContainerID() != cid {
+			return fmt.Errorf("process group %d has process %d of a different container: %q", pgid, pidns.IDOfThreadGroup(tg), tg.Leader().ContainerID())
+		}
+		if pidns.IDOfThreadGroup(tg) == kernel.ThreadID(pgid) {
+			leader = tg
+			continue
+		}
+		members = append(members, tg)
+	}
+	if leader != nil {
+		// Wait on the leader last, so that its exit status is returned.
+		members = append(members, leader)
+	}
+	if len(members) == 0 {
+		return fmt.Errorf("waiting for process group %d: no such process group", pgid)
+	}
+	for _, tg := range members {
+		*waitStatus = l.wait(tg)
+	}
+	return nil
+}
+
 // wait waits for the process with TGID 'tgid' in a container's PID namespace
 // to exit.
 func (l *Loader) wait(tg *kernel.ThreadGroup) uint32 {
@@ -1496,6 +1695,7 @@ func (l *Loader) WaitForStartSignal() {
 func (l *Loader) WaitExit() linux.WaitStatus {
 	// Wait for container.
 	l.k.WaitExited()
+	reportDeniedSyscalls()
 
 	return l.k.GlobalInit().ExitStatus()
 }
@@ -1517,13 +1717,19 @@ func newRootNetworkNamespace(conf *config.Config, clock tcpip.Clock, userns *aut
 		return inet.NewRootNamespace(hostinet.NewStack(), nil, userns), nil
 
 	case config.NetworkNone, config.NetworkSandbox:
-		s, err := newEmptySandboxNetworkStack(clock, conf.AllowPacketEndpointWrite)
+		s, err := newEmptySandboxNetworkStack(clock, conf.AllowPacketEndpointWrite, conf.GVisorGRO, conf.GVisorGSO)
 		if err != nil {
 			return nil, err
 		}
+		// Only the root namespace's NICs are broken down in the per-NIC
+		// metrics. Stacks of nested namespaces still count towards the
+		// stack-wide totals through netstack.Metrics.
+		netstack.SetMetricsStack(s.Stack)
 		creator := &sandboxNetstackCreator{
 			clock:                    clock,
 			allowPacketEndpointWrite: conf.AllowPacketEndpointWrite,
+			gro:                      conf.GVisorGRO,
+			gvisorGSO:                conf.GVisorGSO,
 		}
 		return inet.NewRootNamespace(s, creator, userns), nil
 	case config.NetworkPlugin:
@@ -1535,10 +1741,29 @@ func newRootNetworkNamespace(conf *config.Config, clock tcpip.Clock, userns *aut
 
 }
 
-func newEmptySandboxNetworkStack(clock tcpip.Clock, allowPacketEndpointWrite bool) (*netstack.Stack, error) {
+// configureHostinet configures the host network stack s according to conf.
+func configureHostinet(s *hostinet.Stack, conf *config.Config) error {
+	if err := s.Configure(conf.EnableRaw); err != nil {
+		return err
+	}
+	switch conf.HostinetRawSave {
+	case config.HostinetRawSaveFail:
+		s.SetRawSocketSavePolicy(hostinet.RawSocketSaveFail)
+	case config.HostinetRawSaveDrop:
+		s.SetRawSocketSavePolicy(hostinet.RawSocketSaveDrop)
+	case config.HostinetRawSaveReopen:
+		s.SetRawSocketSavePolicy(hostinet.RawSocketSaveReopen)
+	default:
+		return fmt.Errorf("invalid hostinet raw socket save policy: %v", conf.HostinetRawSave)
+	}
+	return nil
+}
+
+func newEmptySandboxNetworkStack(clock tcpip.Clock, allowPacketEndpointWrite, gro, gvisorGSO bool) (*netstack.Stack, error) {
 	netProtos := []stack.NetworkProtocolFactory{ipv4.NewProtocol, ipv6.NewProtocol, arp.NewProtocol}
 	transProtos := []stack.TransportProtocolFactory{
 		tcp.NewProtocol,
+		mptcp.NewProtocol,
 		udp.NewProtocol,
 		icmp.NewProtocol4,
 		icmp.NewProtocol6,
@@ -1554,6 +1779,8 @@ func newEmptySandboxNetworkStack(clock tcpip.Clock, allowPacketEndpointWrite boo
 		RawFactory:               raw.EndpointFactory{},
 		AllowPacketEndpointWrite: allowPacketEndpointWrite,
 		DefaultIPTables:          netfilter.DefaultLinuxTables,
+		GRO:                      gro,
+		GVisorGSO:                gvisorGSO,
 	})}
 
 	// Enable SACK Recovery.
@@ -1592,11 +1819,13 @@ func newEmptySandboxNetworkStack(clock tcpip.Clock, allowPacketEndpointWrite boo
 type sandboxNetstackCreator struct {
 	clock                    tcpip.Clock
 	allowPacketEndpointWrite bool
+	gro                      bool
+	gvisorGSO                bool
 }
 
 // CreateStack implements kernel.NetworkStackCreator.CreateStack.
 func (f *sandboxNetstackCreator) CreateStack() (inet.Stack, error) {
-	s, err := newEmptySandboxNetworkStack(f.clock, f.allowPacketEndpointWrite)
+	s, err := newEmptySandboxNetworkStack(f.clock, f.allowPacketEndpointWrite, f.gro, f.gvisorGSO)
 	if err != nil {
 		return nil, err
 	}
@@ -1608,7 +1837,9 @@ func (f *sandboxNetstackCreator) CreateStack() (inet.Stack, error) {
 		return nil, fmt.Errorf("loopback device should always have index %d, got %d", linux.LOOPBACK_IFINDEX, nicID)
 	}
 	link := DefaultLoopbackLink
-	linkEP := ethernet.New(loopback.New())
+	// Wrap the link in a sniffer so that packets can be captured at runtime
+	// with StartPCAP.
+	linkEP := sniffer.New(ethernet.New(loopback.New()))
 	opts := stack.NICOptions{
 		Name:               link.Name,
 		DeliverLinkPackets: true,
@@ -1725,6 +1956,24 @@ func (l *Loader) signalForegrondProcessGroup(cid string, tgid kernel.ThreadID, s
 	return l.k.SendExternalSignalProcessGroup(pg, si)
 }
 
+// setWinsize sets the window size of the TTY attached to "tgid" inside
+// container "cid".
+func (l *Loader) setWinsize(cid string, tgid kernel.ThreadID, ws *linux.Winsize) error {
+	if tgid < 0 {
+		return fmt.Errorf("PID (%d) must be positive", tgid)
+	}
+	l.mu.Lock()
+	tty, err := l.ttyFromIDLocked(execID{cid: cid, pid: tgid})
+	l.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("no process found: %w", err)
+	}
+	if tty == nil {
+		return fmt.Errorf("no TTY attached")
+	}
+	return tty.SetWinsize(ws)
+}
+
 // signalAllProcesses that belong to specified container. It's a noop if the
 // container hasn't started or has exited.
 func (l *Loader) signalAllProcesses(cid string, signo int32) error {
@@ -143,6 +143,7 @@ func createLoader(conf *config.Config, spec *specs.Spec) (*Loader, func(), error
 		StdioFDs:        stdio,
 		GoferMountConfs: []GoferMountConf{{Lower: Lisafs, Upper: NoOverlay}},
 		PodInitConfigFD: -1,
+		MACProfileFD:    -1,
 		ExecFD:          -1,
 	}
 	l, err := New(args)
@@ -278,6 +279,7 @@ func TestHostnetWithRawSockets(t *testing.T) {
 		Conf:            conf,
 		DevGoferFD:      -1,
 		PodInitConfigFD: -1,
+		MACProfileFD:    -1,
 		ExecFD:          -1,
 	})
 	if err == nil {
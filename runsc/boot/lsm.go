@@ -0,0 +1,68 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/context"
+	"github.com/wilinz/gvisor/pkg/fd"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+	"github.com/wilinz/gvisor/pkg/sentry/lsm"
+)
+
+// setupLSM installs the MAC profile read from profileFD.
+func setupLSM(profileFD int) error {
+	f := fd.New(profileFD)
+	defer f.Close()
+
+	p, err := loadMACProfile(f)
+	if err != nil {
+		return err
+	}
+	// Report denials as AVC audit records, attributed to the offending
+	// task.
+	p.Audit = func(ctx context.Context, text string) {
+		t := kernel.TaskFromContext(ctx)
+		if t == nil {
+			return
+		}
+		c := t.AuditContext()
+		t.Kernel().Audit().Log(ctx, c, linux.AUDIT_AVC, fmt.Sprintf("%s pid=%d comm=%q", text, c.PID, c.Comm))
+	}
+	lsm.SetModule(p)
+	return nil
+}
+
+// LoadMACProfile loads and validates the MAC profile at path.
+func LoadMACProfile(path string) (*lsm.Profile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return loadMACProfile(f)
+}
+
+func loadMACProfile(r io.Reader) (*lsm.Profile, error) {
+	p, err := lsm.ParseProfile(r)
+	if err != nil {
+		return nil, fmt.Errorf("parsing MAC profile: %w", err)
+	}
+	return p, nil
+}
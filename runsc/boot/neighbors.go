@@ -0,0 +1,90 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/network/ipv4"
+	"github.com/wilinz/gvisor/pkg/tcpip/network/ipv6"
+)
+
+// NeighborEntry is an entry of the neighbor tables (ARP and NDP) of the
+// sandbox's network interfaces.
+type NeighborEntry struct {
+	// Address is the network address of the neighbor.
+	Address string `json:"address"`
+
+	// Device is the name of the network interface.
+	Device string `json:"device"`
+
+	// LinkAddress is the link address of the neighbor, or empty if it isn't
+	// known.
+	LinkAddress string `json:"linkAddress,omitempty"`
+
+	// State is the neighbor unreachability detection state of the entry.
+	State string `json:"state"`
+}
+
+// String implements fmt.Stringer, in the style of "ip neigh show".
+func (e NeighborEntry) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s dev %s", e.Address, e.Device)
+	if e.LinkAddress != "" {
+		fmt.Fprintf(&b, " lladdr %s", e.LinkAddress)
+	}
+	fmt.Fprintf(&b, " %s", strings.ToUpper(e.State))
+	return b.String()
+}
+
+// Neighbors returns the entries of the neighbor tables of the sandbox's
+// network interfaces.
+func (n *Network) Neighbors(_ *struct{}, entries *[]NeighborEntry) error {
+	if n.Stack == nil {
+		return fmt.Errorf("neighbor tables require the sandbox network stack")
+	}
+	nics := n.Stack.NICInfo()
+	var ids []tcpip.NICID
+	for id := range nics {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	*entries = nil
+	for _, id := range ids {
+		for _, protocol := range []tcpip.NetworkProtocolNumber{ipv4.ProtocolNumber, ipv6.ProtocolNumber} {
+			neighbors, err := n.Stack.Neighbors(id, protocol)
+			if err != nil {
+				// The NIC doesn't resolve link addresses.
+				continue
+			}
+			for _, neigh := range neighbors {
+				e := NeighborEntry{
+					Address: neigh.Addr.String(),
+					Device:  nics[id].Name,
+					State:   neigh.State.String(),
+				}
+				if neigh.LinkAddr != "" {
+					e.LinkAddress = neigh.LinkAddr.String()
+				}
+				*entries = append(*entries, e)
+			}
+		}
+	}
+	return nil
+}
@@ -28,6 +28,7 @@ import (
 	"github.com/wilinz/gvisor/pkg/log"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel"
 	"github.com/wilinz/gvisor/pkg/sentry/socket/netfilter"
+	"github.com/wilinz/gvisor/pkg/sentry/socket/netstack"
 	"github.com/wilinz/gvisor/pkg/sentry/socket/plugin"
 	"github.com/wilinz/gvisor/pkg/tcpip"
 	"github.com/wilinz/gvisor/pkg/tcpip/link/ethernet"
@@ -296,10 +297,10 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 		nicids[link.Name] = nicID
 
 		var linkEP stack.LinkEndpoint
-		linkEP = ethernet.New(loopback.New())
-		if args.LogPackets {
-			linkEP = sniffer.New(linkEP)
-		}
+		// Always wrap the link in a sniffer so that packets can be captured
+		// at runtime with StartPCAP. Packets are only logged if enabled by
+		// sniffer.LogPackets.
+		linkEP = sniffer.New(ethernet.New(loopback.New()))
 
 		log.Infof("Enabling loopback interface %q with id %d on addresses %+v", link.Name, nicID, link.Addresses)
 		opts := stack.NICOptions{
@@ -387,7 +388,8 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 					return fmt.Errorf("failed to create PCAP logger: %v", err)
 				}
 				fdOffset++
-			} else if args.LogPackets {
+			} else {
+				// See the loopback links above.
 				linkEP = sniffer.New(linkEP)
 			}
 
@@ -402,6 +404,7 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 			log.Infof("Enabling interface %q with id %d on addresses %+v (%v) w/ %d channels", link.Name, nicID, link.Addresses, mac, link.NumChannels)
 			opts := stack.NICOptions{
 				Name:               link.Name,
+				Context:            netstack.HostDevice{},
 				QDisc:              qDisc,
 				DeliverLinkPackets: true,
 			}
@@ -480,7 +483,8 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 				return fmt.Errorf("failed to create PCAP logger: %v", err)
 			}
 			fdOffset++
-		} else if args.LogPackets {
+		} else {
+			// See the loopback links above.
 			linkEP = sniffer.New(linkEP)
 		}
 
@@ -495,6 +499,7 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 		log.Infof("Enabling interface %q with id %d on addresses %+v (%v) w/ %d channels", link.Name, nicID, link.Addresses, mac, link.NumChannels)
 		opts := stack.NICOptions{
 			Name:               link.Name,
+			Context:            netstack.HostDevice{},
 			QDisc:              qDisc,
 			DeliverLinkPackets: true,
 		}
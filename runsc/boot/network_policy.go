@@ -0,0 +1,210 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/wilinz/gvisor/pkg/log"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/header"
+	"github.com/wilinz/gvisor/pkg/tcpip/stack"
+)
+
+// NetworkPolicyAnnotation is the annotation holding the sandbox's network
+// policy, encoded as a JSON NetworkPolicy. For example:
+//
+//	{
+//	  "egress": [
+//	    {"action": "allow", "cidr": "10.0.0.0/8", "protocol": "tcp", "ports": "443"},
+//	    {"action": "allow", "cidr": "0.0.0.0/0", "protocol": "udp", "ports": "53"}
+//	  ],
+//	  "defaultEgress": "deny"
+//	}
+const NetworkPolicyAnnotation = "dev.gvisor.spec.network-policy"
+
+// NetworkPolicyRule is a rule matching outgoing traffic by destination.
+type NetworkPolicyRule struct {
+	// Action is either "allow" or "deny".
+	Action string `json:"action"`
+
+	// CIDR is the destination subnet, e.g. "10.0.0.0/8" or "::/0".
+	CIDR string `json:"cidr"`
+
+	// Protocol is one of "tcp", "udp", "icmp" or "icmpv6". Empty matches
+	// any protocol.
+	Protocol string `json:"protocol,omitempty"`
+
+	// Ports is a destination port, e.g. "443", or an inclusive range, e.g.
+	// "8000-8080". Empty matches any port. Requires Protocol to be "tcp" or
+	// "udp".
+	Ports string `json:"ports,omitempty"`
+}
+
+// NetworkPolicy is a set of allow/deny rules restricting the traffic that may
+// leave the sandbox. Rules are evaluated in order and the first match wins.
+type NetworkPolicy struct {
+	// Egress is the ordered list of rules for outgoing traffic.
+	Egress []NetworkPolicyRule `json:"egress,omitempty"`
+
+	// DefaultEgress is the action for traffic that matches no rule, either
+	// "allow" or "deny". Defaults to "allow".
+	DefaultEgress string `json:"defaultEgress,omitempty"`
+}
+
+func parsePolicyAction(action string) (stack.NetworkPolicyAction, error) {
+	switch action {
+	case "allow":
+		return stack.NetworkPolicyAllow, nil
+	case "deny":
+		return stack.NetworkPolicyDeny, nil
+	default:
+		return 0, fmt.Errorf("invalid action %q: must be \"allow\" or \"deny\"", action)
+	}
+}
+
+func parsePolicyProtocol(proto string) (tcpip.TransportProtocolNumber, error) {
+	switch proto {
+	case "":
+		return 0, nil
+	case "tcp":
+		return header.TCPProtocolNumber, nil
+	case "udp":
+		return header.UDPProtocolNumber, nil
+	case "icmp":
+		return header.ICMPv4ProtocolNumber, nil
+	case "icmpv6":
+		return header.ICMPv6ProtocolNumber, nil
+	default:
+		return 0, fmt.Errorf("invalid protocol %q", proto)
+	}
+}
+
+func parsePolicyPorts(ports string) (uint16, uint16, error) {
+	if ports == "" {
+		return 0, 0, nil
+	}
+	startStr, endStr, isRange := strings.Cut(ports, "-")
+	start, err := strconv.ParseUint(startStr, 10, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid ports %q: %w", ports, err)
+	}
+	end := start
+	if isRange {
+		if end, err = strconv.ParseUint(endStr, 10, 16); err != nil {
+			return 0, 0, fmt.Errorf("invalid ports %q: %w", ports, err)
+		}
+	}
+	if start == 0 || start > end {
+		return 0, 0, fmt.Errorf("invalid ports %q", ports)
+	}
+	return uint16(start), uint16(end), nil
+}
+
+// toStack converts p to the netstack representation.
+func (p *NetworkPolicy) toStack() (*stack.NetworkPolicy, error) {
+	sp := &stack.NetworkPolicy{DefaultEgress: stack.NetworkPolicyAllow}
+	if p.DefaultEgress != "" {
+		action, err := parsePolicyAction(p.DefaultEgress)
+		if err != nil {
+			return nil, fmt.Errorf("defaultEgress: %w", err)
+		}
+		sp.DefaultEgress = action
+	}
+	for i, r := range p.Egress {
+		action, err := parsePolicyAction(r.Action)
+		if err != nil {
+			return nil, fmt.Errorf("egress rule %d: %w", i, err)
+		}
+		_, ipNet, err := net.ParseCIDR(r.CIDR)
+		if err != nil {
+			return nil, fmt.Errorf("egress rule %d: invalid CIDR %q: %w", i, r.CIDR, err)
+		}
+		subnet, err := tcpip.NewSubnet(ipToAddress(ipNet.IP), ipMaskToAddressMask(ipNet.Mask))
+		if err != nil {
+			return nil, fmt.Errorf("egress rule %d: invalid CIDR %q: %w", i, r.CIDR, err)
+		}
+		proto, err := parsePolicyProtocol(r.Protocol)
+		if err != nil {
+			return nil, fmt.Errorf("egress rule %d: %w", i, err)
+		}
+		start, end, err := parsePolicyPorts(r.Ports)
+		if err != nil {
+			return nil, fmt.Errorf("egress rule %d: %w", i, err)
+		}
+		sp.Egress = append(sp.Egress, stack.NetworkPolicyRule{
+			Action:      action,
+			Destination: subnet,
+			Protocol:    proto,
+			StartPort:   start,
+			EndPort:     end,
+		})
+	}
+	if err := sp.Validate(); err != nil {
+		return nil, err
+	}
+	return sp, nil
+}
+
+// networkPolicyFromSpec returns the network policy set in the spec
+// annotations, or nil if there is none.
+func networkPolicyFromSpec(spec *specs.Spec) (*NetworkPolicy, error) {
+	val, ok := spec.Annotations[NetworkPolicyAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	decoder := json.NewDecoder(strings.NewReader(val))
+	decoder.DisallowUnknownFields()
+	var p NetworkPolicy
+	if err := decoder.Decode(&p); err != nil {
+		return nil, fmt.Errorf("invalid %q annotation: %w", NetworkPolicyAnnotation, err)
+	}
+	return &p, nil
+}
+
+// setNetworkPolicy installs p in s. A nil p removes the policy.
+func setNetworkPolicy(s *stack.Stack, p *NetworkPolicy) error {
+	if p == nil {
+		log.Infof("Removing network policy")
+		return s.SetNetworkPolicy(nil)
+	}
+	sp, err := p.toStack()
+	if err != nil {
+		return err
+	}
+	log.Infof("Setting network policy: %+v", p)
+	return s.SetNetworkPolicy(sp)
+}
+
+// SetNetworkPolicyArgs are arguments to SetNetworkPolicy.
+type SetNetworkPolicyArgs struct {
+	// Policy is the policy to install. If nil, the current policy is
+	// removed.
+	Policy *NetworkPolicy
+}
+
+// SetNetworkPolicy installs a network policy in the network stack, replacing
+// the one set by the spec annotation, if any.
+func (n *Network) SetNetworkPolicy(args *SetNetworkPolicyArgs, _ *struct{}) error {
+	if n.Stack == nil {
+		return fmt.Errorf("network policies require the sandbox network stack")
+	}
+	return setNetworkPolicy(n.Stack, args.Policy)
+}
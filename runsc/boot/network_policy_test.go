@@ -0,0 +1,126 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/header"
+	"github.com/wilinz/gvisor/pkg/tcpip/stack"
+)
+
+func TestNetworkPolicyAnnotation(t *testing.T) {
+	spec := &specs.Spec{
+		Annotations: map[string]string{
+			NetworkPolicyAnnotation: `{
+				"egress": [
+					{"action": "allow", "cidr": "10.0.0.0/8", "protocol": "tcp", "ports": "8000-8080"},
+					{"action": "deny", "cidr": "::/0"}
+				],
+				"defaultEgress": "deny"
+			}`,
+		},
+	}
+	policy, err := networkPolicyFromSpec(spec)
+	if err != nil {
+		t.Fatalf("networkPolicyFromSpec(): %v", err)
+	}
+	sp, err := policy.toStack()
+	if err != nil {
+		t.Fatalf("toStack(): %v", err)
+	}
+	if sp.DefaultEgress != stack.NetworkPolicyDeny {
+		t.Errorf("DefaultEgress = %v, want %v", sp.DefaultEgress, stack.NetworkPolicyDeny)
+	}
+	if len(sp.Egress) != 2 {
+		t.Fatalf("got %d egress rules, want 2", len(sp.Egress))
+	}
+	want := stack.NetworkPolicyRule{
+		Action: stack.NetworkPolicyAllow,
+		Destination: tcpip.AddressWithPrefix{
+			Address:   tcpip.AddrFrom4([4]byte{10, 0, 0, 0}),
+			PrefixLen: 8,
+		}.Subnet(),
+		Protocol:  header.TCPProtocolNumber,
+		StartPort: 8000,
+		EndPort:   8080,
+	}
+	if got := sp.Egress[0]; got != want {
+		t.Errorf("Egress[0] = %+v, want %+v", got, want)
+	}
+	if got := sp.Egress[1]; got.Action != stack.NetworkPolicyDeny || got.Destination.Prefix() != 0 || got.Protocol != 0 {
+		t.Errorf("Egress[1] = %+v, want deny ::/0 for any protocol", got)
+	}
+}
+
+func TestNetworkPolicyNoAnnotation(t *testing.T) {
+	policy, err := networkPolicyFromSpec(&specs.Spec{})
+	if err != nil {
+		t.Fatalf("networkPolicyFromSpec(): %v", err)
+	}
+	if policy != nil {
+		t.Errorf("networkPolicyFromSpec() = %+v, want nil", policy)
+	}
+}
+
+func TestNetworkPolicyInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		policy NetworkPolicy
+	}{
+		{
+			name:   "bad default",
+			policy: NetworkPolicy{DefaultEgress: "reject"},
+		},
+		{
+			name: "bad action",
+			policy: NetworkPolicy{Egress: []NetworkPolicyRule{
+				{Action: "drop", CIDR: "0.0.0.0/0"},
+			}},
+		},
+		{
+			name: "bad cidr",
+			policy: NetworkPolicy{Egress: []NetworkPolicyRule{
+				{Action: "deny", CIDR: "10.0.0.1"},
+			}},
+		},
+		{
+			name: "bad protocol",
+			policy: NetworkPolicy{Egress: []NetworkPolicyRule{
+				{Action: "deny", CIDR: "0.0.0.0/0", Protocol: "sctp"},
+			}},
+		},
+		{
+			name: "ports without protocol",
+			policy: NetworkPolicy{Egress: []NetworkPolicyRule{
+				{Action: "deny", CIDR: "0.0.0.0/0", Ports: "22"},
+			}},
+		},
+		{
+			name: "inverted port range",
+			policy: NetworkPolicy{Egress: []NetworkPolicyRule{
+				{Action: "deny", CIDR: "0.0.0.0/0", Protocol: "tcp", Ports: "90-80"},
+			}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := tc.policy.toStack(); err == nil {
+				t.Errorf("toStack(%+v) succeeded, want error", tc.policy)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/wilinz/gvisor/pkg/log"
+	"github.com/wilinz/gvisor/pkg/tcpip"
+	"github.com/wilinz/gvisor/pkg/tcpip/link/sniffer"
+	"github.com/wilinz/gvisor/pkg/urpc"
+)
+
+// DefaultPCAPSnapLen is the default maximum number of bytes captured per
+// packet by StartPCAP, like tcpdump(8).
+const DefaultPCAPSnapLen = 262144
+
+// StartPCAPArgs are arguments to StartPCAP.
+type StartPCAPArgs struct {
+	// FilePayload contains the host file the capture is written to.
+	urpc.FilePayload
+
+	// SnapLen is the maximum number of bytes captured per packet. Longer
+	// packets are truncated.
+	SnapLen uint32
+}
+
+// StartPCAP starts capturing the packets traversing all network interfaces of
+// the sandbox, streaming them to a host file in pcapng format. Any capture in
+// progress is stopped first.
+//
+// The capture is taken by the sniffer wrapping each link endpoint, so it does
+// not depend on AF_PACKET support in the sandbox. Like the pcap-log flag, link
+// headers are not captured.
+func (n *Network) StartPCAP(args *StartPCAPArgs, _ *struct{}) error {
+	if len(args.Files) != 1 {
+		return fmt.Errorf("StartPCAP requires exactly one file, got %d", len(args.Files))
+	}
+	f := args.Files[0]
+	if n.Stack == nil {
+		f.Close()
+		return fmt.Errorf("packet capture requires the sandbox network stack")
+	}
+	snapLen := args.SnapLen
+	if snapLen == 0 {
+		snapLen = DefaultPCAPSnapLen
+	}
+
+	stopPCAP(n)
+	c, err := sniffer.NewCapture(f, snapLen)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("writing pcapng header: %w", err)
+	}
+	started := 0
+	for _, nic := range pcapNICs(n) {
+		if err := nic.ep.StartCapture(c, nic.name); err != nil {
+			stopPCAP(n)
+			c.Close()
+			return fmt.Errorf("starting capture on interface %q: %w", nic.name, err)
+		}
+		started++
+	}
+	if started == 0 {
+		c.Close()
+		return fmt.Errorf("no network interface supports packet capture")
+	}
+	log.Infof("Started packet capture on %d interfaces", started)
+	return nil
+}
+
+// StopPCAP stops the capture started by StartPCAP and closes its file. It is
+// not an error if no capture is in progress.
+func (n *Network) StopPCAP(_ *struct{}, _ *struct{}) error {
+	if n.Stack == nil {
+		return fmt.Errorf("packet capture requires the sandbox network stack")
+	}
+	if err := stopPCAP(n); err != nil {
+		return fmt.Errorf("closing capture: %w", err)
+	}
+	log.Infof("Stopped packet capture")
+	return nil
+}
+
+// stopPCAP stops the captures of all interfaces and closes them.
+func stopPCAP(n *Network) error {
+	captures := make(map[*sniffer.Capture]struct{})
+	for _, nic := range pcapNICs(n) {
+		if c := nic.ep.StopCapture(); c != nil {
+			captures[c] = struct{}{}
+		}
+	}
+	var retErr error
+	for c := range captures {
+		if err := c.Err(); err != nil {
+			log.Warningf("Packet capture failed: %v", err)
+		}
+		if err := c.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}
+	return retErr
+}
+
+// pcapNIC is a network interface that supports packet capture.
+type pcapNIC struct {
+	name string
+	ep   *sniffer.Endpoint
+}
+
+// pcapNICs returns the interfaces of n's stack that support packet capture,
+// ordered by NIC ID.
+func pcapNICs(n *Network) []pcapNIC {
+	infos := n.Stack.NICInfo()
+	ids := make([]tcpip.NICID, 0, len(infos))
+	for id := range infos {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var nics []pcapNIC
+	for _, id := range ids {
+		name := infos[id].Name
+		ep, ok := n.Stack.GetLinkEndpointByName(name).(*sniffer.Endpoint)
+		if !ok {
+			continue
+		}
+		nics = append(nics, pcapNIC{name: name, ep: ep})
+	}
+	return nics
+}
@@ -0,0 +1,68 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/wilinz/gvisor/pkg/log"
+)
+
+// PathMTUEntry is an entry of the sandbox's path MTU cache.
+type PathMTUEntry struct {
+	// Destination is the remote address the path MTU applies to.
+	Destination string `json:"destination"`
+
+	// MTU is the path MTU, including the IP header.
+	MTU uint32 `json:"mtu"`
+
+	// Expires is the time left until the entry expires.
+	Expires time.Duration `json:"expires"`
+}
+
+// String implements fmt.Stringer, in the style of "ip route show cache".
+func (e PathMTUEntry) String() string {
+	return fmt.Sprintf("%s mtu %d expires %s", e.Destination, e.MTU, e.Expires.Round(time.Second))
+}
+
+// PathMTUCache returns the path MTUs learned by the sandbox network stack from
+// ICMP Fragmentation Needed and Packet Too Big messages.
+func (n *Network) PathMTUCache(_ *struct{}, entries *[]PathMTUEntry) error {
+	if n.Stack == nil {
+		return fmt.Errorf("path MTU cache requires the sandbox network stack")
+	}
+	*entries = nil
+	for _, e := range n.Stack.PathMTUCache() {
+		*entries = append(*entries, PathMTUEntry{
+			Destination: e.Destination.String(),
+			MTU:         e.MTU,
+			Expires:     e.Expires,
+		})
+	}
+	return nil
+}
+
+// FlushPathMTUCache removes all entries of the sandbox's path MTU cache, so
+// that new connections relearn path MTUs. Established TCP connections are not
+// affected.
+func (n *Network) FlushPathMTUCache(_ *struct{}, _ *struct{}) error {
+	if n.Stack == nil {
+		return fmt.Errorf("path MTU cache requires the sandbox network stack")
+	}
+	n.Stack.FlushPathMTUCache()
+	log.Infof("Flushed path MTU cache")
+	return nil
+}
@@ -29,10 +29,12 @@ import (
 	"github.com/wilinz/gvisor/pkg/fd"
 	"github.com/wilinz/gvisor/pkg/log"
 	"github.com/wilinz/gvisor/pkg/sentry/control"
+	"github.com/wilinz/gvisor/pkg/sentry/devices/nvproxy"
 	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/host"
 	"github.com/wilinz/gvisor/pkg/sentry/inet"
 	"github.com/wilinz/gvisor/pkg/sentry/kernel"
 	"github.com/wilinz/gvisor/pkg/sentry/pgalloc"
+	"github.com/wilinz/gvisor/pkg/sentry/platform"
 	"github.com/wilinz/gvisor/pkg/sentry/socket/hostinet"
 	"github.com/wilinz/gvisor/pkg/sentry/socket/netstack"
 	"github.com/wilinz/gvisor/pkg/sentry/state"
@@ -140,6 +142,11 @@ func createNetworkStackForRestore(l *Loader) (*stack.Stack, inet.Stack) {
 	if eps, ok := curNetwork.(*netstack.Stack); ok {
 		return eps.Stack, curNetwork
 	}
+	// The host network stack was configured in Loader.run(), keep using it so
+	// that restored sockets observe the same configuration.
+	if hs, ok := curNetwork.(*hostinet.Stack); ok {
+		return nil, hs
+	}
 	return nil, hostinet.NewStack()
 }
 
@@ -225,6 +232,9 @@ func (r *restorer) restore(l *Loader) error {
 	log.Debugf("Restore using mfmap: %v", mfmap)
 	ctx = context.WithValue(ctx, pgalloc.CtxMemoryFileMap, mfmap)
 	ctx = context.WithValue(ctx, devutil.CtxDevGoferClientProvider, l.k)
+	if specutils.NVProxyEnabled(l.root.spec, l.root.conf) {
+		ctx = context.WithValue(ctx, nvproxy.CtxDriverVersion, l.root.nvidiaDriverVersion)
+	}
 
 	// Load the state.
 	loadOpts := state.LoadOpts{
@@ -233,7 +243,7 @@ func (r *restorer) restore(l *Loader) error {
 		PagesFile:     r.pagesFile,
 		Background:    r.background,
 	}
-	err = loadOpts.Load(ctx, l.k, nil, oldInetStack, time.NewCalibratedClocks(), &vfs.CompleteRestoreOptions{}, l.saveRestoreNet)
+	err = loadOpts.Load(ctx, l.k, nil, oldInetStack, platform.WrapClocks(p, time.NewCalibratedClocks()), &vfs.CompleteRestoreOptions{}, l.saveRestoreNet)
 	r.pagesFile = nil // transferred to loadOpts.Load()
 	if err != nil {
 		return fmt.Errorf("failed to load kernel: %w", err)
@@ -349,8 +359,9 @@ func (l *Loader) save(o *control.SaveOpts) (err error) {
 		l.k.OnCheckpointAttempt(err)
 	}()
 
-	// TODO(gvisor.dev/issues/6243): save/restore not supported w/ hostinet
-	if l.root.conf.Network == config.NetworkHost {
+	// TODO(gvisor.dev/issues/6243): save/restore not supported w/ hostinet,
+	// except for raw and packet sockets when a save policy is configured.
+	if l.root.conf.Network == config.NetworkHost && l.root.conf.HostinetRawSave == config.HostinetRawSaveFail {
 		return errors.New("checkpoint not supported when using hostinet")
 	}
 
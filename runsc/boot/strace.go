@@ -42,6 +42,14 @@ func enableStrace(conf *config.Config) error {
 	if conf.StraceEvent {
 		sink = strace.SinkTypeEvent
 	}
+	if conf.StraceSeccheck {
+		sink = strace.SinkTypeSeccheck
+		policy, err := strace.ParseRedactionPolicy(conf.StraceRedact)
+		if err != nil {
+			return err
+		}
+		strace.SetRedactionPolicy(policy)
+	}
 
 	if len(conf.StraceSyscalls) == 0 {
 		strace.EnableAll(sink)
@@ -0,0 +1,136 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/wilinz/gvisor/pkg/log"
+	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/tmpfs"
+	"github.com/wilinz/gvisor/pkg/sentry/kernel"
+	"github.com/wilinz/gvisor/runsc/config"
+	"github.com/wilinz/gvisor/runsc/specutils"
+)
+
+// minimalSyscalls are the syscalls allowed by the minimal syscall profile.
+// They cover what self-contained programs need from the C and Go runtimes:
+// file I/O, memory management, threads, signals, polling and time.
+// Notably, there are no sockets, no execve, no ptrace, no mount and no
+// namespace or credential changes.
+//
+// Syscalls that don't exist on the current architecture are ignored.
+var minimalSyscalls = []string{
+	// File I/O.
+	"read", "write", "readv", "writev", "pread64", "pwrite64", "preadv", "pwritev", "preadv2", "pwritev2",
+	"open", "openat", "openat2", "creat", "close", "close_range", "lseek", "ioctl", "fcntl", "flock",
+	"dup", "dup2", "dup3", "pipe", "pipe2", "sendfile", "splice", "tee",
+	"fsync", "fdatasync", "sync_file_range", "fadvise64", "fallocate", "truncate", "ftruncate",
+	"stat", "fstat", "lstat", "newfstatat", "statx", "statfs", "fstatfs",
+	"access", "faccessat", "faccessat2", "readlink", "readlinkat",
+	"getdents", "getdents64", "getcwd", "chdir", "fchdir",
+	"mkdir", "mkdirat", "rmdir", "unlink", "unlinkat", "rename", "renameat", "renameat2",
+	"chmod", "fchmod", "fchmodat", "umask", "utime", "utimes", "utimensat", "futimesat",
+	"getxattr", "lgetxattr", "fgetxattr", "listxattr", "llistxattr", "flistxattr",
+
+	// Polling and event notification.
+	"poll", "ppoll", "select", "pselect6",
+	"epoll_create", "epoll_create1", "epoll_ctl", "epoll_wait", "epoll_pwait", "epoll_pwait2",
+	"eventfd", "eventfd2", "timerfd_create", "timerfd_settime", "timerfd_gettime",
+
+	// Memory management.
+	"brk", "mmap", "munmap", "mremap", "mprotect", "madvise", "msync", "mincore",
+	"membarrier", "memfd_create",
+
+	// Threads and processes.
+	"clone", "clone3", "exit", "exit_group", "wait4", "waitid", "set_tid_address",
+	"futex", "set_robust_list", "get_robust_list", "rseq", "arch_prctl", "prctl",
+	"sched_yield", "sched_getaffinity", "sched_getparam", "sched_getscheduler",
+	"sched_get_priority_max", "sched_get_priority_min", "getcpu", "getpriority",
+	"getpid", "getppid", "gettid", "getpgrp", "getpgid", "getsid",
+	"getuid", "geteuid", "getgid", "getegid", "getresuid", "getresgid", "getgroups",
+	"getrlimit", "prlimit64", "getrusage", "times", "sysinfo", "uname",
+
+	// Signals.
+	"rt_sigaction", "rt_sigprocmask", "rt_sigreturn", "rt_sigpending", "rt_sigsuspend",
+	"rt_sigtimedwait", "sigaltstack", "kill", "tkill", "tgkill", "pause", "restart_syscall",
+
+	// Time.
+	"time", "gettimeofday", "clock_gettime", "clock_getres", "clock_nanosleep", "nanosleep",
+	"getitimer", "setitimer", "alarm",
+	"timer_create", "timer_settime", "timer_gettime", "timer_getoverrun", "timer_delete",
+
+	// Randomness.
+	"getrandom",
+}
+
+// enableSyscallProfile restricts the syscalls available to applications
+// according to conf.SyscallProfile.
+func enableSyscallProfile(conf *config.Config) {
+	if conf.SyscallProfile != config.SyscallProfileMinimal {
+		return
+	}
+	for _, table := range kernel.SyscallTables() {
+		allowed := make(map[uintptr]bool)
+		for _, name := range minimalSyscalls {
+			if sysno, err := table.LookupNo(name); err == nil {
+				allowed[sysno] = true
+			}
+		}
+		table.Restrict(allowed)
+	}
+	log.Infof("Syscall profile %v enabled, writable paths: %q", conf.SyscallProfile, conf.SyscallProfileWritable)
+}
+
+// reportDeniedSyscalls logs the syscalls denied by the syscall profile that
+// applications attempted to make.
+func reportDeniedSyscalls() {
+	for _, table := range kernel.SyscallTables() {
+		for _, ds := range table.DeniedSyscalls() {
+			log.Warningf("Syscall profile violation: %s (%d) attempted %d times", ds.Name, ds.Sysno, ds.Count)
+		}
+	}
+}
+
+// syscallProfileWritable returns whether the filesystem mounted at dst can be
+// writable under the syscall profile in conf.
+func syscallProfileWritable(conf *config.Config, dst string) bool {
+	if conf.SyscallProfile != config.SyscallProfileMinimal {
+		return true
+	}
+	dst = filepath.Clean(dst)
+	for _, p := range strings.Split(conf.SyscallProfileWritable, ",") {
+		if p != "" && filepath.Clean(p) == dst {
+			return true
+		}
+	}
+	return false
+}
+
+// applySyscallProfileToMount makes m read-only if it holds application data
+// that must not be writable under the syscall profile in conf.
+// Synthetic filesystems, such as /proc and /dev, are left alone.
+func applySyscallProfileToMount(conf *config.Config, m *specs.Mount) {
+	if m.Type != tmpfs.Name && !specutils.IsGoferMount(*m) {
+		return
+	}
+	if syscallProfileWritable(conf, m.Destination) || specutils.IsReadonlyMount(m.Options) {
+		return
+	}
+	// Don't modify the spec's slice.
+	m.Options = append(slices.Clip(m.Options), "ro")
+}
@@ -35,8 +35,10 @@ import (
 	"github.com/wilinz/gvisor/pkg/fd"
 	"github.com/wilinz/gvisor/pkg/fspath"
 	"github.com/wilinz/gvisor/pkg/log"
+	"github.com/wilinz/gvisor/pkg/sentry/devices/loopdev"
 	"github.com/wilinz/gvisor/pkg/sentry/devices/memdev"
 	"github.com/wilinz/gvisor/pkg/sentry/devices/nvproxy"
+	"github.com/wilinz/gvisor/pkg/sentry/devices/rdmaproxy"
 	"github.com/wilinz/gvisor/pkg/sentry/devices/tpuproxy"
 	"github.com/wilinz/gvisor/pkg/sentry/devices/tpuproxy/vfio"
 	"github.com/wilinz/gvisor/pkg/sentry/devices/ttydev"
@@ -46,11 +48,13 @@ import (
 	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/devpts"
 	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/devtmpfs"
 	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/erofs"
+	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/ext4"
 	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/fuse"
 	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/gofer"
 	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/mqfs"
 	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/overlay"
 	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/proc"
+	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/squashfs"
 	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/sys"
 	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/tmpfs"
 	"github.com/wilinz/gvisor/pkg/sentry/fsimpl/user"
@@ -109,6 +113,10 @@ func registerFilesystems(k *kernel.Kernel, info *containerInfo) error {
 	vfsObj.MustRegisterFilesystemType(erofs.Name, &erofs.FilesystemType{}, &vfs.RegisterFilesystemTypeOptions{
 		AllowUserList: true,
 	})
+	vfsObj.MustRegisterFilesystemType(ext4.Name, &ext4.FilesystemType{}, &vfs.RegisterFilesystemTypeOptions{
+		AllowUserMount: true,
+		AllowUserList:  true,
+	})
 	vfsObj.MustRegisterFilesystemType(fuse.Name, &fuse.FilesystemType{}, &vfs.RegisterFilesystemTypeOptions{
 		AllowUserMount: true,
 		AllowUserList:  true,
@@ -124,6 +132,10 @@ func registerFilesystems(k *kernel.Kernel, info *containerInfo) error {
 		AllowUserMount: true,
 		AllowUserList:  true,
 	})
+	vfsObj.MustRegisterFilesystemType(squashfs.Name, &squashfs.FilesystemType{}, &vfs.RegisterFilesystemTypeOptions{
+		AllowUserMount: true,
+		AllowUserList:  true,
+	})
 	vfsObj.MustRegisterFilesystemType(sys.Name, &sys.FilesystemType{}, &vfs.RegisterFilesystemTypeOptions{
 		AllowUserMount: true,
 		AllowUserList:  true,
@@ -144,6 +156,11 @@ func registerFilesystems(k *kernel.Kernel, info *containerInfo) error {
 	if err := ttydev.Register(vfsObj); err != nil {
 		return fmt.Errorf("registering ttydev: %w", err)
 	}
+	if info.conf.LoopDevices {
+		if err := loopdev.Register(vfsObj); err != nil {
+			return fmt.Errorf("registering loopdev: %w", err)
+		}
+	}
 	tunSupported := tundev.IsNetTunSupported(inet.StackFromContext(ctx))
 	if tunSupported {
 		if err := tundev.Register(vfsObj); err != nil {
@@ -246,6 +263,7 @@ func compileMounts(spec *specs.Spec, conf *config.Config, containerID string) []
 		case "/sys/fs/cgroup":
 			cgroupsMounted = true
 		}
+		applySyscallProfileToMount(conf, &m)
 
 		mounts = append(mounts, m)
 	}
@@ -299,6 +317,9 @@ func goferMountData(fd int, fa config.FileAccessType, conf *config.Config) []str
 	if conf.DirectFS {
 		opts = append(opts, "directfs")
 	}
+	if conf.GoferChannelPool {
+		opts = append(opts, "channel_pool")
+	}
 	if !conf.HostFifo.AllowOpen() {
 		opts = append(opts, "disable_fifo_open")
 	}
@@ -387,6 +408,11 @@ type containerMounter struct {
 	// /sys/devices/virtual/dmi/id/product_name.
 	productName string
 
+	// nvidiaDriverFiles is the contents of /proc/driver/nvidia. It is
+	// restricted to the GPUs visible in the container by mountSubmounts().
+	// See proc.InternalData.
+	nvidiaDriverFiles map[string]string
+
 	// containerID is the ID for the container.
 	containerID string
 
@@ -394,6 +420,10 @@ type containerMounter struct {
 	sandboxID     string
 	containerName string
 
+	// contentCache, if not nil, caches the contents of files of the lower
+	// layers of gofer-backed overlays.
+	contentCache *gofer.ContentCache
+
 	// cgroupsMounted indicates if cgroups are mounted in the container.
 	// This is used to set the InitialCgroups before starting the container
 	// process.
@@ -401,8 +431,12 @@ type containerMounter struct {
 }
 
 func newContainerMounter(info *containerInfo, k *kernel.Kernel, hints *PodMountHints, sharedMounts map[string]*vfs.Mount, productName string, sandboxID string) *containerMounter {
+	root := info.spec.Root
+	if root != nil && !root.Readonly && !syscallProfileWritable(info.conf, "/") {
+		root = &specs.Root{Path: root.Path, Readonly: true}
+	}
 	return &containerMounter{
-		root:              info.spec.Root,
+		root:              root,
 		mounts:            compileMounts(info.spec, info.conf, info.procArgs.ContainerID),
 		goferFDs:          fdDispenser{fds: info.goferFDs},
 		goferFilestoreFDs: fdDispenser{fds: info.goferFilestoreFDs},
@@ -412,6 +446,7 @@ func newContainerMounter(info *containerInfo, k *kernel.Kernel, hints *PodMountH
 		hints:             hints,
 		sharedMounts:      sharedMounts,
 		productName:       productName,
+		nvidiaDriverFiles: info.nvidiaDriverFiles,
 		containerID:       info.cid,
 		sandboxID:         sandboxID,
 		containerName:     info.containerName,
@@ -591,6 +626,11 @@ func (c *containerMounter) configureOverlay(ctx context.Context, conf *config.Co
 
 	// All writes go to the upper layer, be paranoid and make lower readonly.
 	lowerOpts.ReadOnly = true
+	// Being read-only, the lower layer can use the content cache.
+	if iopts, ok := lowerOpts.GetFilesystemOptions.InternalData.(gofer.InternalFilesystemOptions); ok && c.contentCache != nil {
+		iopts.ContentCache = c.contentCache
+		lowerOpts.GetFilesystemOptions.InternalData = iopts
+	}
 	lower, err := c.k.VFS().MountDisconnected(ctx, creds, "" /* source */, lowerFSName, lowerOpts)
 	if err != nil {
 		return nil, nil, err
@@ -711,6 +751,16 @@ func (c *containerMounter) mountSubmounts(ctx context.Context, spec *specs.Spec,
 		return err
 	}
 
+	if len(c.nvidiaDriverFiles) != 0 {
+		// The dev gofer is connected by prepareMounts(), so the GPUs
+		// visible in the container can now be determined.
+		minors, err := nvidiaGPUMinors(ctx, spec, conf)
+		if err != nil {
+			return err
+		}
+		c.nvidiaDriverFiles = specutils.FilterNvidiaGPUFiles(c.nvidiaDriverFiles, minors)
+	}
+
 	for i := range mounts {
 		submount := &mounts[i]
 		log.Debugf("Mounting %q to %q, type: %s, options: %s", submount.mount.Source, submount.mount.Destination, submount.mount.Type, submount.mount.Options)
@@ -814,7 +864,7 @@ func (c *containerMounter) prepareMounts() ([]mountInfo, error) {
 }
 
 func (c *containerMounter) mountSubmount(ctx context.Context, spec *specs.Spec, conf *config.Config, mns *vfs.MountNamespace, creds *auth.Credentials, submount *mountInfo) (*vfs.Mount, error) {
-	fsName, opts, err := getMountNameAndOptions(spec, conf, submount, c.productName, c.containerName)
+	fsName, opts, err := getMountNameAndOptions(spec, conf, submount, c.productName, c.containerName, c.nvidiaDriverFiles)
 	if err != nil {
 		return nil, fmt.Errorf("mountOptions failed: %w", err)
 	}
@@ -855,7 +905,7 @@ func (c *containerMounter) mountSubmount(ctx context.Context, spec *specs.Spec,
 
 // getMountNameAndOptions retrieves the fsName, opts, and useOverlay values
 // used for mounts.
-func getMountNameAndOptions(spec *specs.Spec, conf *config.Config, m *mountInfo, productName, containerName string) (string, *vfs.MountOptions, error) {
+func getMountNameAndOptions(spec *specs.Spec, conf *config.Config, m *mountInfo, productName, containerName string, nvidiaDriverFiles map[string]string) (string, *vfs.MountOptions, error) {
 	fsName := m.mount.Type
 	var (
 		mopts        = m.mount.Options
@@ -872,7 +922,9 @@ func getMountNameAndOptions(spec *specs.Spec, conf *config.Config, m *mountInfo,
 		fsName = sys.Name
 
 	case proc.Name:
-		internalData = newProcInternalData(spec)
+		procData := newProcInternalData(spec)
+		procData.NvidiaDriverFiles = nvidiaDriverFiles
+		internalData = procData
 
 	case sys.Name:
 		sysData := &sys.InternalData{EnableTPUProxyPaths: specutils.TPUProxyIsEnabled(spec, conf)}
@@ -1194,7 +1246,7 @@ func (c *containerMounter) mountSharedMaster(ctx context.Context, spec *specs.Sp
 	// Mount the master using the options from the hint (mount annotations).
 	origOpts := mntInfo.mount.Options
 	mntInfo.mount.Options = mntInfo.hint.Mount.Options
-	fsName, opts, err := getMountNameAndOptions(spec, conf, mntInfo, c.productName, c.containerName)
+	fsName, opts, err := getMountNameAndOptions(spec, conf, mntInfo, c.productName, c.containerName, c.nvidiaDriverFiles)
 	mntInfo.mount.Options = origOpts
 	if err != nil {
 		return nil, err
@@ -1311,24 +1363,11 @@ func createDeviceFiles(ctx context.Context, creds *auth.Credentials, info *conta
 			{Path: "/dev/nvidiactl", Type: "c", Major: nvgpu.NV_MAJOR_DEVICE_NUMBER, Minor: nvgpu.NV_CONTROL_DEVICE_MINOR, FileMode: &mode},
 			{Path: "/dev/nvidia-uvm", Type: "c", Major: int64(info.nvidiaUVMDevMajor), Minor: nvgpu.NVIDIA_UVM_PRIMARY_MINOR_NUMBER, FileMode: &mode},
 		}
-		devClient := devutil.GoferClientFromContext(ctx)
-		if devClient == nil {
-			return fmt.Errorf("dev gofer client not found in context")
-		}
-		names, err := devClient.DirentNames(ctx)
+		minors, err := nvidiaHookDeviceMinors(ctx)
 		if err != nil {
-			return fmt.Errorf("failed to get names of dirents from dev gofer: %w", err)
+			return err
 		}
-		nvidiaDeviceRegex := regexp.MustCompile(`^nvidia(\d+)$`)
-		for _, name := range names {
-			ms := nvidiaDeviceRegex.FindStringSubmatch(name)
-			if ms == nil {
-				continue
-			}
-			minor, err := strconv.ParseUint(ms[1], 10, 32)
-			if err != nil {
-				return fmt.Errorf("invalid nvidia device name %q: %w", name, err)
-			}
+		for _, minor := range minors {
 			nvidiaDevs = append(nvidiaDevs, specs.LinuxDevice{Path: fmt.Sprintf("/dev/nvidia%d", minor), Type: "c", Major: nvgpu.NV_MAJOR_DEVICE_NUMBER, Minor: int64(minor), FileMode: &mode})
 		}
 		for _, nvidiaDev := range nvidiaDevs {
@@ -1340,6 +1379,56 @@ func createDeviceFiles(ctx context.Context, creds *auth.Credentials, info *conta
 	return nil
 }
 
+// nvidiaHookDeviceMinors returns the minor numbers of the /dev/nvidia# GPU
+// device files exposed by the dev gofer when using
+// nvidia-container-runtime-hook.
+func nvidiaHookDeviceMinors(ctx context.Context) ([]uint32, error) {
+	devClient := devutil.GoferClientFromContext(ctx)
+	if devClient == nil {
+		return nil, fmt.Errorf("dev gofer client not found in context")
+	}
+	names, err := devClient.DirentNames(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get names of dirents from dev gofer: %w", err)
+	}
+	nvidiaDeviceRegex := regexp.MustCompile(`^nvidia(\d+)$`)
+	var minors []uint32
+	for _, name := range names {
+		ms := nvidiaDeviceRegex.FindStringSubmatch(name)
+		if ms == nil {
+			continue
+		}
+		minor, err := strconv.ParseUint(ms[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid nvidia device name %q: %w", name, err)
+		}
+		minors = append(minors, uint32(minor))
+	}
+	return minors, nil
+}
+
+// nvidiaGPUMinors returns the minor numbers of the /dev/nvidia# GPU device
+// files that are created in the container.
+func nvidiaGPUMinors(ctx context.Context, spec *specs.Spec, conf *config.Config) ([]uint32, error) {
+	var minors []uint32
+	if spec.Linux != nil {
+		nvidiaDevicePathRegex := regexp.MustCompile(`^/dev/nvidia\d+$`)
+		for _, dev := range spec.Linux.Devices {
+			if nvidiaDevicePathRegex.MatchString(dev.Path) {
+				minors = append(minors, uint32(dev.Minor))
+			}
+		}
+	}
+	if specutils.GPUFunctionalityRequestedViaHook(spec, conf) {
+		hookMinors, err := nvidiaHookDeviceMinors(ctx)
+		if err != nil {
+			return nil, err
+		}
+		minors = append(minors, hookMinors...)
+	}
+	return minors, nil
+}
+
 func createDeviceFile(ctx context.Context, creds *auth.Credentials, info *containerInfo, vfsObj *vfs.VirtualFilesystem, root vfs.VirtualDentry, devSpec specs.LinuxDevice) error {
 	mode := linux.FileMode(devSpec.FileMode.Perm())
 	var major, minor uint32
@@ -1379,6 +1468,27 @@ func createDeviceFile(ctx context.Context, creds *auth.Credentials, info *contai
 				return fmt.Errorf("getting TPU device major number: %w", err)
 			}
 		}
+	} else if info.conf.RDMAProxy && specutils.UverbsFunctionalityRequested(&devSpec) {
+		ms := rdmaproxy.UverbsDeviceRegex.FindStringSubmatch(devSpec.Path)
+		if ms == nil {
+			return fmt.Errorf("invalid uverbs device path %q", devSpec.Path)
+		}
+		num, err := strconv.ParseUint(ms[1], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid uverbs device path %q: %w", devSpec.Path, err)
+		}
+		if err := rdmaproxy.RegisterUverbsDevice(vfsObj, major, minor, uint32(num)); err != nil {
+			return fmt.Errorf("registering uverbs device: %w", err)
+		}
+	} else if info.nvidiaCapsDevMajor != 0 && nvproxy.CapsDeviceRegex.MatchString(devSpec.Path) {
+		// nvidia-caps' major device number is dynamically assigned, but
+		// minor device numbers must be preserved since they are listed in
+		// /proc/driver/nvidia/capabilities.
+		if err := nvproxy.RegisterCapsDevice(vfsObj, info.nvidiaCapsDevMajor, minor); err != nil {
+			return fmt.Errorf("registering nvidia-caps device: %w", err)
+		}
+		log.Infof("Switching %s device major number from %d to %d", devSpec.Path, devSpec.Major, info.nvidiaCapsDevMajor)
+		major = info.nvidiaCapsDevMajor
 	} else if devSpec.Path == "/dev/nvidia-uvm" && info.nvidiaUVMDevMajor != 0 && major != info.nvidiaUVMDevMajor {
 		// nvidia-uvm's major device number is dynamically assigned, so the
 		// number that it has on the host may differ from the number that
@@ -1401,9 +1511,18 @@ func nvproxyRegisterDevices(info *containerInfo, vfsObj *vfs.VirtualFilesystem)
 	if err != nil {
 		return fmt.Errorf("reserving device major number for nvidia-uvm: %w", err)
 	}
-	if err := nvproxy.Register(vfsObj, info.nvidiaDriverVersion, driverCaps, uvmDevMajor); err != nil {
+	submitLimit := nvproxy.SubmitLimit{
+		Rate:  info.conf.NVProxySubmitRate,
+		Burst: info.conf.NVProxySubmitBurst,
+	}
+	if err := nvproxy.Register(vfsObj, info.nvidiaDriverVersion, driverCaps, uvmDevMajor, submitLimit); err != nil {
 		return fmt.Errorf("registering nvproxy driver: %w", err)
 	}
+	capsDevMajor, err := vfsObj.GetDynamicCharDevMajor()
+	if err != nil {
+		return fmt.Errorf("reserving device major number for nvidia-caps: %w", err)
+	}
 	info.nvidiaUVMDevMajor = uvmDevMajor
+	info.nvidiaCapsDevMajor = capsDevMajor
 	return nil
 }
@@ -96,3 +96,38 @@ func TestGetMountAccessType(t *testing.T) {
 		})
 	}
 }
+
+func TestCompileMountsSyscallProfile(t *testing.T) {
+	spec := &specs.Spec{
+		Mounts: []specs.Mount{
+			{Destination: "/proc", Type: "proc"},
+			{Destination: "/data", Type: "bind", Source: "/host/data"},
+			{Destination: "/config", Type: "bind", Source: "/host/config"},
+			{Destination: "/tmp", Type: "tmpfs"},
+			{Destination: "/cache", Type: "tmpfs", Options: []string{"ro"}},
+		},
+	}
+	conf := &config.Config{
+		SyscallProfile:         config.SyscallProfileMinimal,
+		SyscallProfileWritable: "/data,/tmp/",
+	}
+	want := map[string]bool{
+		"/proc":   false,
+		"/data":   false,
+		"/config": true,
+		"/tmp":    false,
+		"/cache":  true,
+	}
+	for _, m := range compileMounts(spec, conf, "") {
+		ro, ok := want[m.Destination]
+		if !ok {
+			continue
+		}
+		if got := ParseMountOptions(m.Options).ReadOnly; got != ro {
+			t.Errorf("mount %q read-only: got %t, want %t (options: %v)", m.Destination, got, ro, m.Options)
+		}
+	}
+	if len(spec.Mounts[2].Options) != 0 {
+		t.Errorf("compileMounts modified the spec's mount options: %v", spec.Mounts[2].Options)
+	}
+}
@@ -34,6 +34,7 @@ import (
 	"github.com/wilinz/gvisor/pkg/sentry/platform"
 	"github.com/wilinz/gvisor/pkg/sentry/syscalls/linux"
 	"github.com/wilinz/gvisor/runsc/cmd"
+	"github.com/wilinz/gvisor/runsc/cmd/cgroups"
 	"github.com/wilinz/gvisor/runsc/cmd/nvproxy"
 	"github.com/wilinz/gvisor/runsc/cmd/trace"
 	"github.com/wilinz/gvisor/runsc/cmd/util"
@@ -199,6 +200,10 @@ func Main() {
 	conf.Log()
 	log.Infof(delimString)
 
+	if conf.Platform == "ptrace" {
+		resolvePtracePlatform(conf)
+	}
+
 	if *coverageFD >= 0 {
 		f := os.NewFile(uintptr(*coverageFD), "coverage file")
 		coverage.EnableReport(f)
@@ -231,6 +236,31 @@ func Main() {
 	os.Exit(128)
 }
 
+// resolvePtracePlatform handles configurations that select the deprecated
+// ptrace platform. If the ptrace shim is enabled and the host supports
+// systrap, conf is changed to use systrap, which is then passed on to child
+// processes. Otherwise, ptrace is kept and the reason is logged.
+func resolvePtracePlatform(conf *config.Config) {
+	const docs = "see https://gvisor.dev/docs/architecture_guide/platforms/"
+	if !conf.PtraceShim {
+		log.Warningf("The ptrace platform is deprecated and will be removed. Use --platform=systrap, or --ptrace-shim to switch to systrap automatically when the host supports it; %s", docs)
+		return
+	}
+	p, err := platform.Lookup("systrap")
+	if err != nil {
+		log.Warningf("Ptrace shim: keeping the deprecated ptrace platform: %v", err)
+		return
+	}
+	if checker, ok := p.(platform.HostSupportChecker); ok {
+		if err := checker.CheckHostSupport(); err != nil {
+			log.Warningf("Ptrace shim: keeping the deprecated ptrace platform, systrap can't be used on this host: %v; %s", err, docs)
+			return
+		}
+	}
+	log.Infof("Ptrace shim: using the systrap platform instead of the deprecated ptrace platform. Pass --platform=systrap to silence this message.")
+	conf.Platform = "systrap"
+}
+
 // forEachCmd invokes the passed callback for each command supported by runsc.
 func forEachCmd(cb func(cmd subcommands.Command, group string)) {
 	// Help and flags commands are generated automatically.
@@ -262,6 +292,7 @@ func forEachCmd(cb func(cmd subcommands.Command, group string)) {
 
 	// Helpers.
 	const helperGroup = "helpers"
+	cb(new(cmd.APIServer), helperGroup)
 	cb(new(cmd.Install), helperGroup)
 	cb(new(cmd.Mitigate), helperGroup)
 	cb(new(cmd.Uninstall), helperGroup)
@@ -269,6 +300,7 @@ func forEachCmd(cb func(cmd subcommands.Command, group string)) {
 	cb(new(trace.Trace), helperGroup)
 
 	const debugGroup = "debug"
+	cb(new(cgroups.Cgroups), debugGroup)
 	cb(new(cmd.Debug), debugGroup)
 	cb(new(cmd.Statefile), debugGroup)
 	cb(new(cmd.Symbolize), debugGroup)
@@ -0,0 +1,102 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/google/subcommands"
+	"google.golang.org/grpc"
+	"github.com/wilinz/gvisor/pkg/log"
+	"github.com/wilinz/gvisor/runsc/api"
+	"github.com/wilinz/gvisor/runsc/cmd/util"
+	"github.com/wilinz/gvisor/runsc/config"
+	"github.com/wilinz/gvisor/runsc/flag"
+)
+
+// APIServer implements subcommands.Command for the "api-server" command.
+type APIServer struct {
+	address       string
+	imageRoot     string
+	authTokenFile string
+}
+
+// Name implements subcommands.Command.Name.
+func (*APIServer) Name() string {
+	return "api-server"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*APIServer) Synopsis() string {
+	return "serve the stable gRPC sandbox API for containers under --root"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*APIServer) Usage() string {
+	return `api-server --address=unix:PATH|vsock:PORT - serve the gRPC sandbox API.
+
+The API is defined in runsc/api/sandbox.proto. It exposes lifecycle, exec,
+stats, checkpoint and trace session operations on the containers managed
+under --root, and is versioned independently of runsc's internal control
+protocol.
+
+Unix sockets only accept connections from the user running the server. To
+listen on vsock, --auth-token-file must be set; clients then present the token
+as "authorization: Bearer <token>" metadata on every call.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (a *APIServer) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&a.address, "address", "", "address to listen on, either unix:PATH or vsock:PORT")
+	f.StringVar(&a.imageRoot, "image-root", "", "host directory under which checkpoint images are saved; checkpoint is disabled if empty")
+	f.StringVar(&a.authTokenFile, "auth-token-file", "", "file containing the token that clients must present on every call")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (a *APIServer) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	if f.NArg() != 0 || a.address == "" {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	conf := args[0].(*config.Config)
+
+	opts := api.Options{ImageRoot: a.imageRoot}
+	if a.authTokenFile != "" {
+		token, err := os.ReadFile(a.authTokenFile)
+		if err != nil {
+			util.Fatalf("reading auth token: %v", err)
+		}
+		opts.AuthToken = strings.TrimSpace(string(token))
+		if opts.AuthToken == "" {
+			util.Fatalf("auth token file %q is empty", a.authTokenFile)
+		}
+	}
+
+	l, err := api.Listen(a.address, opts)
+	if err != nil {
+		util.Fatalf("listening on %q: %v", a.address, err)
+	}
+	server := api.NewServer(conf, opts)
+	s := grpc.NewServer(server.GRPCOptions()...)
+	server.Register(s)
+	log.Infof("Serving sandbox API %s on %s", api.Version, a.address)
+	if err := s.Serve(l); err != nil {
+		util.Fatalf("serving sandbox API: %v", err)
+	}
+	return subcommands.ExitSuccess
+}
@@ -149,6 +149,10 @@ type Boot struct {
 
 	sinkFDs intFlags
 
+	macProfileFD int
+
+	goferContentCacheFD int
+
 	saveFDs intFlags
 
 	// attached is set to true to kill the sandbox process when the parent process
@@ -236,6 +240,8 @@ func (b *Boot) SetFlags(f *flag.FlagSet) {
 	f.IntVar(&b.mountsFD, "mounts-fd", -1, "mountsFD is an optional file descriptor to read list of mounts after they have been resolved (direct paths, no symlinks).")
 	f.IntVar(&b.podInitConfigFD, "pod-init-config-fd", -1, "file descriptor to the pod init configuration file.")
 	f.Var(&b.sinkFDs, "sink-fds", "ordered list of file descriptors to be used by the sinks defined in --pod-init-config.")
+	f.IntVar(&b.macProfileFD, "mac-profile-fd", -1, "file descriptor to the MAC profile file.")
+	f.IntVar(&b.goferContentCacheFD, "gofer-content-cache-fd", -1, "file descriptor to the gofer content cache directory.")
 	f.Var(&b.saveFDs, "save-fds", "ordered list of file descriptors to be used save checkpoints. Order: kernel state, page metadata, page file")
 
 	// Profiling flags.
@@ -523,6 +529,8 @@ func (b *Boot) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomma
 		ProductName:         b.productName,
 		PodInitConfigFD:     b.podInitConfigFD,
 		SinkFDs:             b.sinkFDs.GetArray(),
+		MACProfileFD:        b.macProfileFD,
+		GoferContentCacheFD: b.goferContentCacheFD,
 		ProfileOpts:         b.profileFDs.ToOpts(),
 		NvidiaDriverVersion: nvidiaDriverVersion,
 		HostTHP:             b.hostTHP,
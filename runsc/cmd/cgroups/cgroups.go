@@ -0,0 +1,80 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cgroups provides subcommands for the cgroups command.
+package cgroups
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/google/subcommands"
+	"github.com/wilinz/gvisor/runsc/cmd/util"
+	"github.com/wilinz/gvisor/runsc/config"
+	"github.com/wilinz/gvisor/runsc/container"
+	"github.com/wilinz/gvisor/runsc/flag"
+)
+
+// Cgroups implements subcommands.Command for the "cgroups" command.
+type Cgroups struct{}
+
+// Name implements subcommands.Command.
+func (*Cgroups) Name() string {
+	return "cgroups"
+}
+
+// Synopsis implements subcommands.Command.
+func (*Cgroups) Synopsis() string {
+	return "inspects and adjusts the cgroups configured inside a sandbox"
+}
+
+// Usage implements subcommands.Command.
+func (*Cgroups) Usage() string {
+	buf := bytes.Buffer{}
+	buf.WriteString("Usage: cgroups <flags> <subcommand> <subcommand args>\n\n")
+
+	cdr := createCommander(&flag.FlagSet{})
+	cdr.VisitGroups(func(grp *subcommands.CommandGroup) {
+		cdr.ExplainGroup(&buf, grp)
+	})
+
+	return buf.String()
+}
+
+// SetFlags implements subcommands.Command.
+func (*Cgroups) SetFlags(f *flag.FlagSet) {}
+
+// Execute implements subcommands.Command.
+func (*Cgroups) Execute(ctx context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	return createCommander(f).Execute(ctx, args...)
+}
+
+func createCommander(f *flag.FlagSet) *subcommands.Commander {
+	cdr := subcommands.NewCommander(f, "cgroups")
+	cdr.Register(cdr.HelpCommand(), "")
+	cdr.Register(cdr.FlagsCommand(), "")
+	cdr.Register(new(list), "")
+	cdr.Register(new(read), "")
+	cdr.Register(new(write), "")
+	return cdr
+}
+
+// loadContainer loads the container with the given ID, exiting on failure.
+func loadContainer(conf *config.Config, id string) *container.Container {
+	c, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{SkipCheck: true})
+	if err != nil {
+		util.Fatalf("loading sandbox: %v", err)
+	}
+	return c
+}
@@ -0,0 +1,119 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgroups
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/subcommands"
+	"github.com/wilinz/gvisor/pkg/sentry/control"
+	"github.com/wilinz/gvisor/runsc/cmd/util"
+	"github.com/wilinz/gvisor/runsc/config"
+	"github.com/wilinz/gvisor/runsc/flag"
+)
+
+// list implements subcommands.Command for the "list" command.
+type list struct {
+	stats  bool
+	format string
+}
+
+// Name implements subcommands.Command.
+func (*list) Name() string {
+	return "list"
+}
+
+// Synopsis implements subcommands.Command.
+func (*list) Synopsis() string {
+	return "list cgroup hierarchies and cgroups inside the sandbox"
+}
+
+// Usage implements subcommands.Command.
+func (*list) Usage() string {
+	return `list [flags] <container-id> - list cgroup hierarchies, their controllers and cgroups.
+
+EXAMPLE:
+       # runsc cgroups list -stats <container-id>
+
+OPTIONS:
+`
+}
+
+// SetFlags implements subcommands.Command.
+func (l *list) SetFlags(f *flag.FlagSet) {
+	f.BoolVar(&l.stats, "stats", false, "include per-cgroup stats such as memory and CPU usage")
+	f.StringVar(&l.format, "format", "text", "output format: text or json")
+}
+
+// Execute implements subcommands.Command.
+func (l *list) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	if l.format != "text" && l.format != "json" {
+		util.Fatalf("invalid format %q, must be 'text' or 'json'", l.format)
+	}
+
+	conf := args[0].(*config.Config)
+	c := loadContainer(conf, f.Arg(0))
+
+	out, err := c.Sandbox.CgroupsList(l.stats)
+	if err != nil {
+		util.Fatalf("listing cgroups: %v", err)
+	}
+	if l.format == "json" {
+		if err := json.NewEncoder(os.Stdout).Encode(out); err != nil {
+			util.Fatalf("encoding cgroups: %v", err)
+		}
+		return subcommands.ExitSuccess
+	}
+	printHierarchies(out)
+	return subcommands.ExitSuccess
+}
+
+func printHierarchies(out *control.CgroupsListResult) {
+	for i, h := range out.Hierarchies {
+		if i != 0 {
+			fmt.Println()
+		}
+		fmt.Printf("HIERARCHY %d: %s", h.ID, strings.Join(h.Controllers, ","))
+		if h.Name != "" {
+			fmt.Printf(" (name=%s)", h.Name)
+		}
+		fmt.Println()
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, ' ', 0)
+		fmt.Fprint(w, "ID\tPATH\tTASKS\tSTATS\n")
+		for _, cg := range h.Cgroups {
+			names := make([]string, 0, len(cg.Stats))
+			for name := range cg.Stats {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			stats := make([]string, 0, len(names))
+			for _, name := range names {
+				stats = append(stats, fmt.Sprintf("%s=%s", name, cg.Stats[name]))
+			}
+			fmt.Fprintf(w, "%d\t%s\t%d\t%s\n", cg.ID, cg.Path, cg.NumTasks, strings.Join(stats, " "))
+		}
+		w.Flush()
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgroups
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/subcommands"
+	"github.com/wilinz/gvisor/pkg/sentry/control"
+	"github.com/wilinz/gvisor/runsc/cmd/util"
+	"github.com/wilinz/gvisor/runsc/config"
+	"github.com/wilinz/gvisor/runsc/flag"
+)
+
+// read implements subcommands.Command for the "read" command.
+type read struct{}
+
+// Name implements subcommands.Command.
+func (*read) Name() string {
+	return "read"
+}
+
+// Synopsis implements subcommands.Command.
+func (*read) Synopsis() string {
+	return "read cgroup control files inside the sandbox"
+}
+
+// Usage implements subcommands.Command.
+func (*read) Usage() string {
+	return `read <container-id> <controller> <cgroup-path> <control-file>... - read one or more control files of a cgroup.
+
+EXAMPLE:
+       # runsc cgroups read <container-id> memory / memory.usage_in_bytes memory.limit_in_bytes
+`
+}
+
+// SetFlags implements subcommands.Command.
+func (*read) SetFlags(*flag.FlagSet) {}
+
+// Execute implements subcommands.Command.
+func (*read) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	if f.NArg() < 4 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	conf := args[0].(*config.Config)
+	c := loadContainer(conf, f.Arg(0))
+
+	names := f.Args()[3:]
+	files := make([]control.CgroupControlFile, 0, len(names))
+	for _, name := range names {
+		files = append(files, control.CgroupControlFile{
+			Controller: f.Arg(1),
+			Path:       f.Arg(2),
+			Name:       name,
+		})
+	}
+	results, err := c.Sandbox.CgroupsReadControlFiles(files)
+	if err != nil {
+		util.Fatalf("reading control files: %v", err)
+	}
+	status := subcommands.ExitSuccess
+	for i, res := range results {
+		val, err := res.Unpack()
+		if err != nil {
+			fmt.Printf("%s: ERROR: %s\n", names[i], err)
+			status = subcommands.ExitFailure
+			continue
+		}
+		fmt.Printf("%s: %s\n", names[i], val)
+	}
+	return status
+}
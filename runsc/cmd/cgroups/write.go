@@ -0,0 +1,71 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgroups
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/subcommands"
+	"github.com/wilinz/gvisor/pkg/sentry/control"
+	"github.com/wilinz/gvisor/runsc/config"
+	"github.com/wilinz/gvisor/runsc/flag"
+)
+
+// write implements subcommands.Command for the "write" command.
+type write struct{}
+
+// Name implements subcommands.Command.
+func (*write) Name() string {
+	return "write"
+}
+
+// Synopsis implements subcommands.Command.
+func (*write) Synopsis() string {
+	return "write a cgroup control file inside the sandbox"
+}
+
+// Usage implements subcommands.Command.
+func (*write) Usage() string {
+	return `write <container-id> <controller> <cgroup-path> <control-file> <value> - write a control file of a cgroup.
+
+EXAMPLE:
+       # runsc cgroups write <container-id> pids /mygroup pids.max 128
+`
+}
+
+// SetFlags implements subcommands.Command.
+func (*write) SetFlags(*flag.FlagSet) {}
+
+// Execute implements subcommands.Command.
+func (*write) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	if f.NArg() != 5 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	conf := args[0].(*config.Config)
+	c := loadContainer(conf, f.Arg(0))
+
+	if err := c.Sandbox.CgroupsWriteControlFile(control.CgroupControlFile{
+		Controller: f.Arg(1),
+		Path:       f.Arg(2),
+		Name:       f.Arg(3),
+	}, f.Arg(4)); err != nil {
+		fmt.Printf("ERROR: %s\n", err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
@@ -20,6 +20,7 @@ import (
 	"os"
 
 	"github.com/google/subcommands"
+	"github.com/wilinz/gvisor/pkg/log"
 	"github.com/wilinz/gvisor/pkg/sentry/pgalloc"
 	"github.com/wilinz/gvisor/pkg/state/statefile"
 	"github.com/wilinz/gvisor/runsc/cmd/util"
@@ -41,6 +42,12 @@ type Checkpoint struct {
 	// For example, if the checkpoint files will be stored on a network block
 	// device, which will be detached after the checkpoint is done.
 	direct bool
+
+	// cudaCheckpoint is the path of the cuda-checkpoint utility in the
+	// container. If set, the GPU state of CUDA processes is moved to host
+	// memory before checkpointing, which is required to checkpoint
+	// containers using nvproxy.
+	cudaCheckpoint string
 }
 
 // Name implements subcommands.Command.Name.
@@ -65,6 +72,7 @@ func (c *Checkpoint) SetFlags(f *flag.FlagSet) {
 	f.Var(newCheckpointCompressionValue(statefile.CompressionLevelDefault, &c.compression), "compression", "compress checkpoint image on disk. Values: none|flate-best-speed.")
 	f.BoolVar(&c.excludeCommittedZeroPages, "exclude-committed-zero-pages", false, "exclude committed zero-filled pages from checkpoint")
 	f.BoolVar(&c.direct, "direct", false, "use O_DIRECT for writing checkpoint pages file")
+	f.StringVar(&c.cudaCheckpoint, "cuda-checkpoint", "", "EXPERIMENTAL: path of the cuda-checkpoint utility in the container, used to move the GPU state of CUDA processes to host memory before checkpointing")
 
 	// Unimplemented flags necessary for compatibility with docker.
 	var wp string
@@ -106,7 +114,28 @@ func (c *Checkpoint) Execute(_ context.Context, f *flag.FlagSet, args ...any) su
 		sOpts.Resume = true
 	}
 
-	if err := cont.Checkpoint(c.imagePath, c.direct, sOpts, mfOpts); err != nil {
+	var cudaPIDs []int32
+	if c.cudaCheckpoint != "" {
+		cudaPIDs, err = cont.CheckpointCUDA(conf, c.cudaCheckpoint, c.imagePath)
+		if err != nil {
+			if len(cudaPIDs) != 0 {
+				if rerr := cont.RestoreCUDA(conf, c.cudaCheckpoint, c.imagePath, cudaPIDs); rerr != nil {
+					log.Warningf("Restoring CUDA state: %v", rerr)
+				}
+			}
+			util.Fatalf("checkpointing CUDA state: %v", err)
+		}
+	}
+
+	err = cont.Checkpoint(c.imagePath, c.direct, sOpts, mfOpts)
+	if len(cudaPIDs) != 0 && (err != nil || c.leaveRunning) {
+		// The container is still running, so restore the GPU state that
+		// was moved to host memory above.
+		if rerr := cont.RestoreCUDA(conf, c.cudaCheckpoint, c.imagePath, cudaPIDs); rerr != nil {
+			log.Warningf("Restoring CUDA state: %v", rerr)
+		}
+	}
+	if err != nil {
 		util.Fatalf("checkpoint failed: %v", err)
 	}
 
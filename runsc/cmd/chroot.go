@@ -187,6 +187,10 @@ func setUpChroot(spec *specs.Spec, conf *config.Config) error {
 		return fmt.Errorf("error configuring chroot for TPU devices: %w", err)
 	}
 
+	if err := nvproxyUpdateChroot(chroot, spec, conf); err != nil {
+		return fmt.Errorf("error configuring chroot for NVIDIA devices: %w", err)
+	}
+
 	if err := specutils.SafeMount("", chroot, "", unix.MS_REMOUNT|unix.MS_RDONLY|unix.MS_BIND, "", "/proc"); err != nil {
 		return fmt.Errorf("error remounting chroot in read-only: %v", err)
 	}
@@ -194,6 +198,29 @@ func setUpChroot(spec *specs.Spec, conf *config.Config) error {
 	return pivotRoot(chroot)
 }
 
+// nvproxyUpdateChroot copies the NVIDIA driver's procfs files into the
+// chroot's minimal procfs, so that the sandbox can expose them in its own
+// procfs.
+func nvproxyUpdateChroot(chroot string, spec *specs.Spec, conf *config.Config) error {
+	if !specutils.NVProxyEnabled(spec, conf) {
+		return nil
+	}
+	files, err := specutils.ReadNvidiaDriverFiles(specutils.NvidiaDriverProcPath)
+	if err != nil {
+		return err
+	}
+	for name, data := range files {
+		dst := filepath.Join(chroot, specutils.NvidiaDriverProcPath, name)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return fmt.Errorf("error creating directory %q: %v", filepath.Dir(dst), err)
+		}
+		if err := os.WriteFile(dst, []byte(data), 0444); err != nil {
+			return fmt.Errorf("error writing %q: %v", dst, err)
+		}
+	}
+	return nil
+}
+
 func tpuProxyUpdateChroot(hostRoot, chroot string, spec *specs.Spec, conf *config.Config) error {
 	if !specutils.TPUProxyIsEnabled(spec, conf) {
 		return nil
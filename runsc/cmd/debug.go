@@ -16,6 +16,7 @@ package cmd
 
 import (
 	"context"
+	"math"
 	"os"
 	"os/signal"
 	"strconv"
@@ -27,6 +28,7 @@ import (
 	"golang.org/x/sys/unix"
 	"github.com/wilinz/gvisor/pkg/log"
 	"github.com/wilinz/gvisor/pkg/sentry/control"
+	"github.com/wilinz/gvisor/runsc/boot"
 	"github.com/wilinz/gvisor/runsc/cmd/util"
 	"github.com/wilinz/gvisor/runsc/config"
 	"github.com/wilinz/gvisor/runsc/container"
@@ -50,6 +52,12 @@ type Debug struct {
 	duration     time.Duration
 	ps           bool
 	mount        string
+	pcapStart    string
+	pcapStop     bool
+	pcapSnapLen  uint
+	pmtuCache    bool
+	pmtuFlush    bool
+	neighbors    bool
 }
 
 // Name implements subcommands.Command.
@@ -84,6 +92,12 @@ func (d *Debug) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&d.logPackets, "log-packets", "", "A boolean value to enable or disable packet logging: true or false.")
 	f.BoolVar(&d.ps, "ps", false, "lists processes")
 	f.StringVar(&d.mount, "mount", "", "Mount a filesystem (-mount fstype:source:destination).")
+	f.StringVar(&d.pcapStart, "pcap-start", "", "starts capturing the packets of all sandbox network interfaces to the given file in pcapng format.")
+	f.BoolVar(&d.pcapStop, "pcap-stop", false, "stops the packet capture started with -pcap-start.")
+	f.UintVar(&d.pcapSnapLen, "pcap-snaplen", boot.DefaultPCAPSnapLen, "maximum number of bytes captured per packet by -pcap-start.")
+	f.BoolVar(&d.pmtuCache, "pmtu-cache", false, "lists the path MTUs learned by the sandbox network stack.")
+	f.BoolVar(&d.pmtuFlush, "pmtu-flush", false, "flushes the path MTU cache of the sandbox network stack.")
+	f.BoolVar(&d.neighbors, "neighbors", false, "lists the neighbor (ARP and NDP) tables of the sandbox network stack.")
 }
 
 // Execute implements subcommands.Command.Execute.
@@ -239,6 +253,55 @@ func (d *Debug) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomm
 		}
 	}
 
+	if d.pcapStop {
+		util.Infof("Stopping packet capture")
+		if err := c.Sandbox.StopPCAP(); err != nil {
+			return util.Errorf("%v", err)
+		}
+	}
+	if d.pcapStart != "" {
+		if d.pcapSnapLen == 0 || d.pcapSnapLen > math.MaxUint32 {
+			return util.Errorf("invalid value for pcap-snaplen %d", d.pcapSnapLen)
+		}
+		f, err := os.OpenFile(d.pcapStart, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return util.Errorf("error opening packet capture output: %v", err)
+		}
+		defer f.Close()
+		util.Infof("Starting packet capture to %q", d.pcapStart)
+		if err := c.Sandbox.StartPCAP(f, uint32(d.pcapSnapLen)); err != nil {
+			return util.Errorf("%v", err)
+		}
+	}
+
+	if d.pmtuCache {
+		util.Infof("Retrieving path MTU cache")
+		entries, err := c.Sandbox.PathMTUCache()
+		if err != nil {
+			return util.Errorf("%v", err)
+		}
+		for _, e := range entries {
+			util.Infof("%s", e)
+		}
+	}
+	if d.pmtuFlush {
+		util.Infof("Flushing path MTU cache")
+		if err := c.Sandbox.FlushPathMTUCache(); err != nil {
+			return util.Errorf("%v", err)
+		}
+	}
+
+	if d.neighbors {
+		util.Infof("Retrieving neighbors")
+		entries, err := c.Sandbox.Neighbors()
+		if err != nil {
+			return util.Errorf("%v", err)
+		}
+		for _, e := range entries {
+			util.Infof("%s", e)
+		}
+	}
+
 	// Open profiling files.
 	var (
 		blockFile *os.File
@@ -30,6 +30,7 @@ import (
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"golang.org/x/sys/unix"
 	"github.com/wilinz/gvisor/pkg/log"
+	"github.com/wilinz/gvisor/pkg/sentry/devices/nvproxy"
 	"github.com/wilinz/gvisor/pkg/sentry/devices/tpuproxy/vfio"
 	"github.com/wilinz/gvisor/pkg/unet"
 	"github.com/wilinz/gvisor/pkg/urpc"
@@ -592,7 +593,7 @@ func shouldExposeNvidiaDevice(path string) bool {
 		return true
 	}
 	nvidiaDevPathReg := regexp.MustCompile(`^/dev/nvidia(\d+)$`)
-	return nvidiaDevPathReg.MatchString(path)
+	return nvidiaDevPathReg.MatchString(path) || nvproxy.CapsDeviceRegex.MatchString(path)
 }
 
 // shouldExposeVfioDevice returns true if path refers to an VFIO device
@@ -622,7 +623,8 @@ func (g *Gofer) setupDev(spec *specs.Spec, conf *config.Config, root, procPath s
 	tpuproxyEnabled := specutils.TPUProxyIsEnabled(spec, conf)
 	for _, dev := range spec.Linux.Devices {
 		shouldMount := (nvproxyEnabled && shouldExposeNvidiaDevice(dev.Path)) ||
-			(tpuproxyEnabled && shouldExposeTpuDevice(dev.Path))
+			(tpuproxyEnabled && shouldExposeTpuDevice(dev.Path)) ||
+			(conf.RDMAProxy && specutils.UverbsFunctionalityRequested(&dev))
 		if !shouldMount {
 			continue
 		}
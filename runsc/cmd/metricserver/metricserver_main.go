@@ -50,6 +50,11 @@ func (c *cmd) Execute(ctx context.Context, f *flag.FlagSet, args ...any) subcomm
 		ExporterPrefix:         c.Cmd.ExporterPrefix,
 		ExposeProfileEndpoints: c.Cmd.ExposeProfileEndpoints,
 		AllowUnknownRoot:       c.Cmd.AllowUnknownRoot,
+		TLSCertFile:            c.Cmd.TLSCertFile,
+		TLSKeyFile:             c.Cmd.TLSKeyFile,
+		TLSClientCAFile:        c.Cmd.TLSClientCAFile,
+		AccessFile:             c.Cmd.AccessFile,
+		ExportFilter:           c.Cmd.ExportFilter,
 	}
 	if err := server.Run(ctx); err != nil {
 		return util.Errorf("%v", err)
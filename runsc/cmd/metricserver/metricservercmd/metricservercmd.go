@@ -25,6 +25,11 @@ type Cmd struct {
 	PIDFile                string
 	ExposeProfileEndpoints bool
 	AllowUnknownRoot       bool
+	TLSCertFile            string
+	TLSKeyFile             string
+	TLSClientCAFile        string
+	AccessFile             string
+	ExportFilter           string
 }
 
 // Name implements subcommands.Command.Name.
@@ -39,7 +44,7 @@ func (*Cmd) Synopsis() string {
 
 // Usage implements subcommands.Command.Usage.
 func (*Cmd) Usage() string {
-	return "-root=<root dir> -metric-server=<addr> metric-server [-exporter-prefix=<runsc_>]\n"
+	return "-root=<root dir> -metric-server=<addr> metric-server [-exporter-prefix=<runsc_>] [-tls-cert=<file> -tls-key=<file> [-tls-client-ca=<file>]] [-access-file=<file>] [-export-filter=<regexp>]\n"
 }
 
 // SetFlags implements subcommands.Command.SetFlags.
@@ -48,4 +53,9 @@ func (c *Cmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&c.PIDFile, "pid-file", "", "If set, write the metric server's own PID to this file after binding to the --metric-server address. The parent directory of this file must already exist.")
 	f.BoolVar(&c.ExposeProfileEndpoints, "allow-profiling", false, "If true, expose /runsc-metrics/profile-cpu and /runsc-metrics/profile-heap to get profiling data about the metric server")
 	f.BoolVar(&c.AllowUnknownRoot, "allow-unknown-root", false, "if set, the metric server will keep running regardless of the existence of --root or the metric server's ability to access it.")
+	f.StringVar(&c.TLSCertFile, "tls-cert", "", "if set along with --tls-key, serve metrics over HTTPS using this PEM-encoded certificate")
+	f.StringVar(&c.TLSKeyFile, "tls-key", "", "PEM-encoded private key of --tls-cert")
+	f.StringVar(&c.TLSClientCAFile, "tls-client-ca", "", "if set, clients must present a certificate signed by one of the PEM-encoded CAs in this file, or a token from --access-file")
+	f.StringVar(&c.AccessFile, "access-file", "", "file listing the credentials allowed to scrape metrics, one per line as \"token:<token>|cert:<name> [sandbox=<id>] [pod_name=<name>] [namespace_name=<name>] [iteration=<id>] [metrics=<regexp>]\"; label options restrict the sandboxes a credential may see, and metrics restricts the metrics it may see")
+	f.StringVar(&c.ExportFilter, "export-filter", "", "if set, only sandbox metrics whose name matches this regular expression are exported")
 }
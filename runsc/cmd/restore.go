@@ -53,6 +53,12 @@ type Restore struct {
 	// uncompressed for background to work; if the checkpoint is compressed,
 	// background has no effect.
 	background bool
+
+	// cudaCheckpoint is the path of the cuda-checkpoint utility in the
+	// container. If set, the GPU state of processes checkpointed by
+	// "runsc checkpoint --cuda-checkpoint" is restored after the container
+	// is restored.
+	cudaCheckpoint string
 }
 
 // Name implements subcommands.Command.Name.
@@ -76,6 +82,7 @@ func (r *Restore) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&r.imagePath, "image-path", "", "directory path to saved container image")
 	f.BoolVar(&r.detach, "detach", false, "detach from the container's process")
 	f.BoolVar(&r.direct, "direct", false, "use O_DIRECT for reading checkpoint pages file")
+	f.StringVar(&r.cudaCheckpoint, "cuda-checkpoint", "", "EXPERIMENTAL: path of the cuda-checkpoint utility in the container, used to restore the GPU state of CUDA processes after restore")
 	f.BoolVar(&r.background, "background", false, "allow image loading to continue after restore exits (requires uncompressed checkpoint)")
 
 	// Unimplemented flags necessary for compatibility with docker.
@@ -156,6 +163,11 @@ func (r *Restore) Execute(_ context.Context, f *flag.FlagSet, args ...any) subco
 	if err := c.Restore(conf, r.imagePath, r.direct, r.background); err != nil {
 		return util.Errorf("starting container: %v", err)
 	}
+	if r.cudaCheckpoint != "" {
+		if err := c.RestoreCUDA(conf, r.cudaCheckpoint, r.imagePath, nil /* pids */); err != nil {
+			return util.Errorf("restoring CUDA state: %v", err)
+		}
+	}
 
 	// If we allocate a terminal, forward signals to the sandbox process.
 	// Otherwise, Ctrl+C will terminate this process and its children,
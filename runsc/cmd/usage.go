@@ -27,8 +27,10 @@ import (
 
 // Usage implements subcommands.Command for the "usage" command.
 type Usage struct {
-	full bool
-	fd   bool
+	full       bool
+	fd         bool
+	reclaim    bool
+	keepCaches bool
 }
 
 // Name implements subcommands.Command.Name.
@@ -50,6 +52,8 @@ func (*Usage) Usage() string {
 func (u *Usage) SetFlags(f *flag.FlagSet) {
 	f.BoolVar(&u.full, "full", false, "enumerate all usage by categories")
 	f.BoolVar(&u.fd, "fd", false, "retrieves a subset of usage through the established usage FD")
+	f.BoolVar(&u.reclaim, "reclaim", false, "return unused memory to the host and print how much was released")
+	f.BoolVar(&u.keepCaches, "keep-caches", false, "with -reclaim, don't evict cached file contents")
 }
 
 // Execute implements subcommands.Command.Execute.
@@ -67,7 +71,17 @@ func (u *Usage) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomm
 		util.Fatalf("loading container: %v", err)
 	}
 
-	if u.fd {
+	if u.reclaim {
+		out, err := cont.Sandbox.Reclaim(u.keepCaches)
+		if err != nil {
+			util.Fatalf("reclaim failed: %v", err)
+		}
+		encoder := json.NewEncoder(&util.Writer{})
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(out); err != nil {
+			util.Fatalf("Encode UsageReclaimOutput failed: %v", err)
+		}
+	} else if u.fd {
 		m, err := cont.Sandbox.UsageFD()
 		if err != nil {
 			util.Fatalf("usagefd failed: %v", err)
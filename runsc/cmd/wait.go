@@ -36,6 +36,7 @@ const (
 type Wait struct {
 	rootPID    int
 	pid        int
+	pgid       int
 	checkpoint bool
 }
 
@@ -58,6 +59,7 @@ func (*Wait) Usage() string {
 func (wt *Wait) SetFlags(f *flag.FlagSet) {
 	f.IntVar(&wt.rootPID, "rootpid", unsetPID, "select a PID in the sandbox root PID namespace to wait on instead of the container's root process")
 	f.IntVar(&wt.pid, "pid", unsetPID, "select a PID in the container's PID namespace to wait on instead of the container's root process")
+	f.IntVar(&wt.pgid, "pgid", unsetPID, "select a process group in the container's PID namespace to wait on instead of the container's root process")
 	f.BoolVar(&wt.checkpoint, "checkpoint", false, "wait for the next checkpoint to complete")
 }
 
@@ -68,9 +70,9 @@ func (wt *Wait) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomm
 		f.Usage()
 		return subcommands.ExitUsageError
 	}
-	// You can't specify both -pid and -rootpid.
-	if wt.rootPID != unsetPID && wt.pid != unsetPID {
-		util.Fatalf("only one of -pid and -rootPid can be set")
+	// You can only specify one of -pid, -rootpid and -pgid.
+	if countSet(wt.rootPID, wt.pid, wt.pgid) > 1 {
+		util.Fatalf("only one of -pid, -rootpid and -pgid can be set")
 	}
 
 	id := f.Arg(0)
@@ -82,8 +84,8 @@ func (wt *Wait) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomm
 	}
 
 	if wt.checkpoint {
-		if wt.rootPID != unsetPID || wt.pid != unsetPID {
-			log.Warningf("waiting for checkpoint to complete, ignoring -pid and -rootpid")
+		if countSet(wt.rootPID, wt.pid, wt.pgid) > 0 {
+			log.Warningf("waiting for checkpoint to complete, ignoring -pid, -rootpid and -pgid")
 		}
 		if err := c.WaitCheckpoint(); err != nil {
 			util.Fatalf("waiting for checkpoint to complete: %v", err)
@@ -94,7 +96,7 @@ func (wt *Wait) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomm
 	var waitStatus unix.WaitStatus
 	switch {
 	// Wait on the whole container.
-	case wt.rootPID == unsetPID && wt.pid == unsetPID:
+	case countSet(wt.rootPID, wt.pid, wt.pgid) == 0:
 		ws, err := c.Wait()
 		if err != nil {
 			util.Fatalf("waiting on container %q: %v", c.ID, err)
@@ -114,6 +116,13 @@ func (wt *Wait) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomm
 			util.Fatalf("waiting on PID %d in container %q: %v", wt.pid, c.ID, err)
 		}
 		waitStatus = ws
+	// Wait on a process group in the container's PID namespace.
+	case wt.pgid != unsetPID:
+		ws, err := c.WaitPGID(int32(wt.pgid))
+		if err != nil {
+			util.Fatalf("waiting on process group %d in container %q: %v", wt.pgid, c.ID, err)
+		}
+		waitStatus = ws
 	}
 	result := waitResult{
 		ID:         id,
@@ -126,6 +135,17 @@ func (wt *Wait) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomm
 	return subcommands.ExitSuccess
 }
 
+// countSet returns the number of pids which are set.
+func countSet(pids ...int) int {
+	n := 0
+	for _, pid := range pids {
+		if pid != unsetPID {
+			n++
+		}
+	}
+	return n
+}
+
 type waitResult struct {
 	ID         string `json:"id"`
 	ExitStatus int    `json:"exitStatus"`
@@ -25,6 +25,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/wilinz/gvisor/pkg/cpuid"
 	"github.com/wilinz/gvisor/pkg/log"
 	"github.com/wilinz/gvisor/pkg/refs"
 	"github.com/wilinz/gvisor/pkg/sentry/devices/nvproxy/nvconf"
@@ -151,6 +152,11 @@ type Config struct {
 	// Platform is the platform to run on.
 	Platform string `flag:"platform"`
 
+	// PtraceShim enables the ptrace platform compatibility shim: when the
+	// ptrace platform is selected, systrap is used instead if the host
+	// supports it. Otherwise, ptrace is used and the reason is logged.
+	PtraceShim bool `flag:"ptrace-shim"`
+
 	// PlatformDevicePath is the path to the device file used by the platform.
 	// e.g. "/dev/kvm" for the KVM platform.
 	// If unset, a sane platform-specific default will be used.
@@ -186,6 +192,10 @@ type Config struct {
 	// profiling metrics will be snapshotted.
 	ProfilingMetricsRate int `flag:"profiling-metrics-rate-us"`
 
+	// SyscallLatencyMetrics enables the /task/syscall_latency metric, which
+	// records per-syscall latency histograms.
+	SyscallLatencyMetrics bool `flag:"syscall-latency-metrics"`
+
 	// Strace indicates that strace should be enabled.
 	Strace bool `flag:"strace"`
 
@@ -201,6 +211,16 @@ type Config struct {
 	// sent to log if false.
 	StraceEvent bool `flag:"strace-event"`
 
+	// StraceSeccheck indicates sending strace to the seccheck sinks
+	// configured for the sentry/strace point if true. It takes precedence
+	// over StraceEvent.
+	StraceSeccheck bool `flag:"strace-seccheck"`
+
+	// StraceRedact is a comma-separated list of redaction rules applied to
+	// the arguments of straces sent to seccheck sinks. See
+	// strace.ParseRedactionPolicy for the format.
+	StraceRedact string `flag:"strace-redact"`
+
 	// DisableSeccomp indicates whether seccomp syscall filters should be
 	// disabled. Pardon the double negation, but default to enabled is important.
 	DisableSeccomp bool
@@ -272,6 +292,19 @@ type Config struct {
 	// E.g. 0.2 CPU quota will result in 1, and 1.9 in 2.
 	CPUNumFromQuota bool `flag:"cpu-num-from-quota"`
 
+	// CPUFeatures adds or removes CPU features exposed to applications,
+	// e.g. "+avx2,-avx512f". It can be used to expose the same features on
+	// hosts with different CPUs, so that sandboxes can be restored on any
+	// of them.
+	CPUFeatures string `flag:"cpu-features"`
+
+	// EmulatedIOPorts is a comma-separated list of x86 I/O ports and port
+	// ranges, e.g. "0x378-0x37a,0x3f8-0x3ff", that applications with
+	// CAP_SYS_RAWIO can access with iopl(2) and ioperm(2). The ports are
+	// backed by a null device: writes are ignored and reads return all
+	// ones.
+	EmulatedIOPorts string `flag:"emulated-ioports"`
+
 	// Allows overriding of flags in OCI annotations.
 	AllowFlagOverride bool `flag:"allow-flag-override"`
 
@@ -288,6 +321,20 @@ type Config struct {
 	// take during pod creation.
 	PodInitConfig string `flag:"pod-init-config"`
 
+	// MACProfile is the path to a mandatory access control profile that
+	// restricts file open, exec, socket connect and mount inside the
+	// sandbox. See lsm.Profile for the format.
+	MACProfile string `flag:"mac-profile"`
+
+	// SyscallProfile restricts the syscalls available to applications. See
+	// SyscallProfile for the supported profiles.
+	SyscallProfile SyscallProfile `flag:"syscall-profile"`
+
+	// SyscallProfileWritable is a comma-separated list of container paths
+	// that remain writable under the minimal syscall profile, which mounts
+	// everything else read-only.
+	SyscallProfileWritable string `flag:"syscall-profile-writable"`
+
 	// Use pools to manage buffer memory instead of heap.
 	BufferPooling bool `flag:"buffer-pooling"`
 
@@ -307,6 +354,33 @@ type Config struct {
 	// used.
 	DCache int `flag:"dcache"`
 
+	// DCacheMax limits the number of dentries cached across all
+	// filesystems. If zero, only the limits of individual filesystems apply.
+	DCacheMax int `flag:"dcache-max"`
+
+	// FileMax is the default value of /proc/sys/fs/file-max, the limit on
+	// the number of open files in the sandbox. If zero, it is unlimited.
+	// The fs.file-max sysctl of the OCI spec takes precedence.
+	FileMax uint64 `flag:"file-max"`
+
+	// PipeMaxSize is the default value of /proc/sys/fs/pipe-max-size, the
+	// limit on the size of pipes set by unprivileged applications. The
+	// fs.pipe-max-size sysctl of the OCI spec takes precedence.
+	PipeMaxSize uint64 `flag:"pipe-max-size"`
+
+	// AIOMaxNr is the default value of /proc/sys/fs/aio-max-nr, the limit on
+	// the number of asynchronous I/O events in the sandbox. The
+	// fs.aio-max-nr sysctl of the OCI spec takes precedence.
+	AIOMaxNr uint64 `flag:"aio-max-nr"`
+
+	// GoferContentCache is the path to a host directory caching the contents
+	// of files read from the read-only lower layers of gofer-backed overlays.
+	GoferContentCache string `flag:"gofer-content-cache"`
+
+	// LoopDevices enables /dev/loop-control and /dev/loop[0-7], allowing
+	// privileged applications to mount filesystem images.
+	LoopDevices bool `flag:"loop-devices"`
+
 	// IOUring enables support for the IO_URING API calls to perform
 	// asynchronous I/O operations.
 	IOUring bool `flag:"iouring"`
@@ -316,9 +390,25 @@ type Config struct {
 	// exists, but is mostly idle. Not supported in rootless mode.
 	DirectFS bool `flag:"directfs"`
 
+	// GoferChannelPool makes the sentry communicate with the gofer over a
+	// pool of flipcall channels that grows on demand, instead of a fixed set
+	// of channels with a fallback to the gofer socket. It has no effect with
+	// DirectFS, which makes few RPCs.
+	GoferChannelPool bool `flag:"gofer-channel-pool"`
+
 	// AppHugePages enables support for application huge pages.
 	AppHugePages bool `flag:"app-huge-pages"`
 
+	// WorkingSetSamplePeriod is the period (in milliseconds) at which
+	// application working sets are sampled. If 0, working sets are not
+	// sampled.
+	WorkingSetSamplePeriod int `flag:"working-set-sample-period-ms"`
+
+	// TimerSlack is the initial timer slack (in microseconds) of application
+	// tasks, by which the expirations of their timers may be delayed so that
+	// they are coalesced. If 0, timer expirations are not coalesced.
+	TimerSlack int `flag:"timer-slack-us"`
+
 	// NVProxy enables support for Nvidia GPUs.
 	NVProxy bool `flag:"nvproxy"`
 
@@ -337,9 +427,22 @@ type Config struct {
 	// capabilities that are allowed to be requested by the container.
 	NVProxyAllowedDriverCapabilities string `flag:"nvproxy-allowed-driver-capabilities"`
 
+	// NVProxySubmitRate is the sustained number of GPU ioctls per second that
+	// each container may issue, approximating fractional GPU time-slicing
+	// between containers. If 0, GPU ioctls are not throttled.
+	NVProxySubmitRate int `flag:"nvproxy-submit-rate"`
+
+	// NVProxySubmitBurst is the number of GPU ioctls that each container may
+	// issue back-to-back before being throttled by NVProxySubmitRate.
+	NVProxySubmitBurst int `flag:"nvproxy-submit-burst"`
+
 	// TPUProxy enables support for TPUs.
 	TPUProxy bool `flag:"tpuproxy"`
 
+	// RDMAProxy enables support for a restricted set of RDMA verbs on
+	// /dev/infiniband/uverbs* devices.
+	RDMAProxy bool `flag:"rdmaproxy"`
+
 	// TestOnlyAllowRunAsCurrentUserWithoutChroot should only be used in
 	// tests. It allows runsc to start the sandbox process as the current
 	// user, and without chrooting the sandbox process. This can be
@@ -375,6 +478,10 @@ type Config struct {
 	// sockets should be disconnected upon save."
 	NetDisconnectOk bool `flag:"net-disconnect-ok"`
 
+	// HostinetRawSave indicates how raw and packet sockets are handled on
+	// checkpoint when using the host network.
+	HostinetRawSave HostinetRawSavePolicy `flag:"hostinet-raw-save-policy"`
+
 	// TestOnlyAutosaveImagePath if not empty enables auto save for syscall tests
 	// and stores the directory path to the saved state file.
 	TestOnlyAutosaveImagePath string `flag:"TESTONLY-autosave-image-path"`
@@ -401,6 +508,9 @@ func (c *Config) validate() error {
 	if c.NumNetworkChannels <= 0 {
 		return fmt.Errorf("num_network_channels must be > 0, got: %d", c.NumNetworkChannels)
 	}
+	if c.TimerSlack < 0 {
+		return fmt.Errorf("timer-slack-us must be >= 0, got: %d", c.TimerSlack)
+	}
 	// Require profile flags to explicitly opt-in to profiling with
 	// -profile rather than implying it since these options have security
 	// implications.
@@ -423,6 +533,9 @@ func (c *Config) validate() error {
 	if len(c.ProfilingMetrics) > 0 && len(c.ProfilingMetricsLog) == 0 {
 		return fmt.Errorf("profiling-metrics flag requires defining a profiling-metrics-log for output")
 	}
+	if _, err := cpuid.ParseFeatureOverrides(c.CPUFeatures); err != nil {
+		return fmt.Errorf("--cpu-features=%q: %w", c.CPUFeatures, err)
+	}
 	allowedCaps, _, err := nvconf.DriverCapsFromString(c.NVProxyAllowedDriverCapabilities)
 	if err != nil {
 		return fmt.Errorf("--nvproxy-allowed-driver-capabilities=%q: %w", c.NVProxyAllowedDriverCapabilities, err)
@@ -430,6 +543,18 @@ func (c *Config) validate() error {
 	if unsupported := allowedCaps & ^nvconf.SupportedDriverCaps; unsupported != 0 {
 		return fmt.Errorf("--nvproxy-allowed-driver-capabilities=%q: unsupported capabilities: %v", c.NVProxyAllowedDriverCapabilities, unsupported)
 	}
+	if c.NVProxySubmitRate < 0 {
+		return fmt.Errorf("--nvproxy-submit-rate=%d must not be negative", c.NVProxySubmitRate)
+	}
+	if c.NVProxySubmitBurst < 0 {
+		return fmt.Errorf("--nvproxy-submit-burst=%d must not be negative", c.NVProxySubmitBurst)
+	}
+	if c.SyscallProfile == SyscallProfileMinimal && c.Network != NetworkNone {
+		return fmt.Errorf("--syscall-profile=%v requires --network=none, got: %v", c.SyscallProfile, c.Network)
+	}
+	if c.SyscallProfileWritable != "" && c.SyscallProfile == SyscallProfileDefault {
+		return fmt.Errorf("--syscall-profile-writable requires --syscall-profile=%v", SyscallProfileMinimal)
+	}
 	return nil
 }
 
@@ -1118,6 +1243,117 @@ func (p RestoreSpecValidationPolicy) String() string {
 	}
 }
 
+// HostinetRawSavePolicy dictates how hostinet raw and packet sockets are
+// handled on checkpoint.
+type HostinetRawSavePolicy int
+
+// HostinetRawSavePolicy values.
+const (
+	// HostinetRawSaveFail fails checkpoints when using the host network.
+	HostinetRawSaveFail HostinetRawSavePolicy = iota
+
+	// HostinetRawSaveDrop saves raw and packet sockets, which are left
+	// closed after restore.
+	HostinetRawSaveDrop
+
+	// HostinetRawSaveReopen saves raw and packet sockets, which are
+	// recreated with the same bound address and socket options on restore.
+	HostinetRawSaveReopen
+)
+
+// Set implements flag.Value. Set(String()) should be idempotent.
+func (p *HostinetRawSavePolicy) Set(v string) error {
+	switch v {
+	case "fail":
+		*p = HostinetRawSaveFail
+	case "drop":
+		*p = HostinetRawSaveDrop
+	case "reopen":
+		*p = HostinetRawSaveReopen
+	default:
+		return fmt.Errorf("invalid hostinet raw socket save policy %q", v)
+	}
+	return nil
+}
+
+// Ptr returns a pointer to `p`.
+// Useful in flag declaration line.
+func (p HostinetRawSavePolicy) Ptr() *HostinetRawSavePolicy {
+	return &p
+}
+
+// Get implements flag.Get.
+func (p *HostinetRawSavePolicy) Get() any {
+	return *p
+}
+
+// String implements flag.String.
+func (p HostinetRawSavePolicy) String() string {
+	switch p {
+	case HostinetRawSaveFail:
+		return "fail"
+	case HostinetRawSaveDrop:
+		return "drop"
+	case HostinetRawSaveReopen:
+		return "reopen"
+	default:
+		panic(fmt.Sprintf("invalid hostinet raw socket save policy %d", p))
+	}
+}
+
+// SyscallProfile is a set of syscalls that applications are allowed to use.
+type SyscallProfile int
+
+// SyscallProfile values.
+const (
+	// SyscallProfileDefault allows all syscalls implemented by the sentry.
+	SyscallProfileDefault SyscallProfile = iota
+
+	// SyscallProfileMinimal allows only the syscalls needed by
+	// self-contained programs, such as untrusted plugins: file I/O, memory
+	// management, threads, signals and time. Other syscalls fail with EPERM
+	// and are reported in the sandbox log. The network must be disabled,
+	// and all filesystems are mounted read-only except for the paths in
+	// --syscall-profile-writable.
+	SyscallProfileMinimal
+)
+
+// Set implements flag.Value. Set(String()) should be idempotent.
+func (p *SyscallProfile) Set(v string) error {
+	switch v {
+	case "default":
+		*p = SyscallProfileDefault
+	case "minimal":
+		*p = SyscallProfileMinimal
+	default:
+		return fmt.Errorf("invalid syscall profile %q", v)
+	}
+	return nil
+}
+
+// Ptr returns a pointer to `p`.
+// Useful in flag declaration line.
+func (p SyscallProfile) Ptr() *SyscallProfile {
+	return &p
+}
+
+// Get implements flag.Get.
+func (p *SyscallProfile) Get() any {
+	return *p
+}
+
+// String implements flag.String.
+func (p SyscallProfile) String() string {
+	switch p {
+	case SyscallProfileDefault:
+		return "default"
+	case SyscallProfileMinimal:
+		return "minimal"
+	default:
+		panic(fmt.Sprintf("invalid syscall profile %d", p))
+	}
+}
+
 // XDP holds configuration for whether and how to use XDP.
 type XDP struct {
 	Mode      XDPMode
@@ -1132,7 +1368,9 @@ const (
 	XDPModeOff XDPMode = iota
 
 	// XDPModeNS uses an AF_XDP socket to read from the VETH device inside
-	// the container's network namespace.
+	// the container's network namespace. If the socket can't be set up,
+	// e.g. because the kernel lacks AF_XDP support, an AF_PACKET socket is
+	// used instead.
 	XDPModeNS
 
 	// XDPModeRedirect uses an AF_XDP socket on the host NIC to bypass the
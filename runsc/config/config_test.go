@@ -231,6 +231,16 @@ func TestInvalidFlags(t *testing.T) {
 			value: "root:dir=tmp",
 			error: "overlay host file directory should be an absolute path, got \"tmp\"",
 		},
+		{
+			name:  "hostinet-raw-save-policy",
+			value: "invalid",
+			error: "invalid hostinet raw socket save policy",
+		},
+		{
+			name:  "syscall-profile",
+			value: "invalid",
+			error: "invalid syscall profile",
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			testFlags := flag.NewFlagSet("test", flag.ContinueOnError)
@@ -242,6 +252,35 @@ func TestInvalidFlags(t *testing.T) {
 	}
 }
 
+func TestHostinetRawSavePolicy(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		want  HostinetRawSavePolicy
+	}{
+		{value: "fail", want: HostinetRawSaveFail},
+		{value: "drop", want: HostinetRawSaveDrop},
+		{value: "reopen", want: HostinetRawSaveReopen},
+	} {
+		t.Run(tc.value, func(t *testing.T) {
+			testFlags := flag.NewFlagSet("test", flag.ContinueOnError)
+			RegisterFlags(testFlags)
+			if err := testFlags.Lookup("hostinet-raw-save-policy").Value.Set(tc.value); err != nil {
+				t.Fatalf("flag.Value.Set(%q): %v", tc.value, err)
+			}
+			c, err := NewFromFlags(testFlags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.HostinetRawSave != tc.want {
+				t.Errorf("HostinetRawSave: got %v, want %v", c.HostinetRawSave, tc.want)
+			}
+			if got := c.HostinetRawSave.String(); got != tc.value {
+				t.Errorf("HostinetRawSave.String(): got %q, want %q", got, tc.value)
+			}
+		})
+	}
+}
+
 func TestValidationFail(t *testing.T) {
 	for _, tc := range []struct {
 		name  string
@@ -303,6 +342,20 @@ func TestValidationFail(t *testing.T) {
 			},
 			error: "overlay flag has been replaced with overlay2 flag",
 		},
+		{
+			name: "syscall-profile:minimal+network:sandbox",
+			flags: map[string]string{
+				"syscall-profile": "minimal",
+			},
+			error: "--syscall-profile=minimal requires --network=none",
+		},
+		{
+			name: "syscall-profile-writable",
+			flags: map[string]string{
+				"syscall-profile-writable": "/tmp",
+			},
+			error: "--syscall-profile-writable requires --syscall-profile=minimal",
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			testFlags := flag.NewFlagSet("test", flag.ContinueOnError)
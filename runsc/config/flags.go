@@ -81,15 +81,19 @@ func RegisterFlags(flagSet *flag.FlagSet) {
 	flagSet.String("profiling-metrics", "", "comma separated list of metric names which are going to be written to the profiling-metrics-log file from within the sentry in CSV format. profiling-metrics will be snapshotted at a rate specified by profiling-metrics-rate-us. Requires profiling-metrics-log to be set. (DO NOT USE IN PRODUCTION).")
 	flagSet.String("profiling-metrics-log", "", "file name to use for profiling-metrics output; use the special value '-' to write to the user-visible logs. (DO NOT USE IN PRODUCTION)")
 	flagSet.Int("profiling-metrics-rate-us", 1000, "the target rate (in microseconds) at which profiling metrics will be snapshotted.")
+	flagSet.Bool("syscall-latency-metrics", false, "if set, record the latency of each syscall in the /task/syscall_latency metric, broken down by syscall number. This adds a small overhead to every syscall.")
 
 	// Debugging flags: strace related
 	flagSet.Bool(flagStrace, false, "enable strace.")
 	flagSet.String(flagStraceSyscalls, "", "comma-separated list of syscalls to trace. If --strace is true and this list is empty, then all syscalls will be traced.")
 	flagSet.Uint(flagStraceLogSize, 1024, "default size (in bytes) to log data argument blobs.")
 	flagSet.Bool("strace-event", false, "send strace to event.")
+	flagSet.Bool("strace-seccheck", false, "send strace to the seccheck sinks configured for the sentry/strace point.")
+	flagSet.String("strace-redact", "", "comma-separated list of syscall:arg=action rules redacting arguments of straces sent to seccheck sinks, where action is one of none, omit or hash (e.g. write:1=hash).")
 
 	// Flags that control sandbox runtime behavior.
 	flagSet.String("platform", "systrap", "specifies which platform to use: systrap (default), ptrace, kvm.")
+	flagSet.Bool("ptrace-shim", false, "use systrap instead of the deprecated ptrace platform when --platform=ptrace and the host supports systrap.")
 	flagSet.String("platform_device_path", "", "path to a platform-specific device file (e.g. /dev/kvm for KVM platform). If unset, will use a sane platform-specific default.")
 	flagSet.Var(watchdogActionPtr(watchdog.LogWarning), "watchdog-action", "sets what action the watchdog takes when triggered: log (default), panic.")
 	flagSet.Int("panic-signal", -1, "register signal handling that panics. Usually set to SIGUSR2(12) to troubleshoot hangs. -1 disables it.")
@@ -101,15 +105,22 @@ func RegisterFlags(flagSet *flag.FlagSet) {
 	flagSet.String("trace", "", "collects a Go runtime execution trace to this file path for the duration of the container execution.")
 	flagSet.Bool("rootless", false, "it allows the sandbox to be started with a user that is not root. Sandbox and Gofer processes may run with same privileges as current user.")
 	flagSet.Var(leakModePtr(refs.NoLeakChecking), "ref-leak-mode", "sets reference leak check mode: disabled (default), log-names, log-traces.")
+	flagSet.String("cpu-features", "", "comma-separated list of CPU features to expose to (+feature) or hide from (-feature) applications, e.g. +avx2,-avx512f. Feature names are those of /proc/cpuinfo. Only features supported by the host can be added.")
+	flagSet.String("emulated-ioports", "", "comma-separated list of x86 I/O ports and port ranges, e.g. 0x378-0x37a,0x3f8-0x3ff, that applications with CAP_SYS_RAWIO may access with iopl(2) and ioperm(2). The ports are backed by a null device, which ignores writes and reads as all ones.")
 	flagSet.Bool("cpu-num-from-quota", false, "set cpu number to cpu quota (least integer greater or equal to quota value, but not less than 2)")
 	flagSet.Bool(flagOCISeccomp, false, "Enables loading OCI seccomp filters inside the sandbox.")
 	flagSet.Bool("enable-core-tags", false, "enables core tagging. Requires host linux kernel >= 5.14.")
 	flagSet.String("pod-init-config", "", "path to configuration file with additional steps to take during pod creation.")
+	flagSet.String("mac-profile", "", "path to an AppArmor-like profile restricting file open, exec, socket connect and mount inside the sandbox.")
+	flagSet.Var(SyscallProfileDefault.Ptr(), "syscall-profile", "restricts the syscalls available to applications: default (all syscalls) or minimal (file I/O, memory, threads, signals and time only; requires --network=none). Denied syscalls fail with EPERM and are reported in the sandbox log.")
+	flagSet.String("syscall-profile-writable", "", "comma-separated list of container paths that remain writable with --syscall-profile=minimal. All other filesystems are mounted read-only.")
 	flagSet.Var(HostSettingsCheck.Ptr(), "host-settings", "how to handle non-optimal host kernel settings: check (default, advisory-only), ignore (do not check), adjust (best-effort auto-adjustment), or enforce (auto-adjustment must succeed).")
 	flagSet.Var(RestoreSpecValidationEnforce.Ptr(), "restore-spec-validation", "how to handle spec validation during restore.")
 
 	// Flags that control sandbox runtime behavior: MM related.
 	flagSet.Bool("app-huge-pages", true, "enable use of huge pages for application memory; requires /sys/kernel/mm/transparent_hugepage/shmem_enabled = advise")
+	flagSet.Int("working-set-sample-period-ms", 0, "EXPERIMENTAL: period (in milliseconds) at which application working sets are estimated by sampling page accessed bits, on platforms that support it (currently KVM on amd64). 0 disables sampling.")
+	flagSet.Int("timer-slack-us", 0, "EXPERIMENTAL: initial timer slack (in microseconds) of application tasks, within which timer expirations are coalesced to reduce wakeups; tasks may change their slack with prctl(PR_SET_TIMERSLACK). 0 disables coalescing.")
 
 	// Flags that control sandbox runtime behavior: FS related.
 	flagSet.Var(fileAccessTypePtr(FileAccessExclusive), "file-access", "specifies which filesystem validation to use for the root mount: exclusive (default), shared.")
@@ -127,12 +138,20 @@ func RegisterFlags(flagSet *flag.FlagSet) {
 	flagSet.Bool("ignore-cgroups", false, "don't configure cgroups.")
 	flagSet.Int("fdlimit", -1, "Specifies a limit on the number of host file descriptors that can be open. Applies separately to the sentry and gofer. Note: each file in the sandbox holds more than one host FD open.")
 	flagSet.Int("dcache", -1, "Set the global dentry cache size. This acts as a coarse-grained control on the number of host FDs simultaneously open by the sentry. If negative, per-mount caches are used.")
+	flagSet.String("gofer-content-cache", "", "Host directory caching the contents of files of the read-only lower layers of gofer-backed overlays, keyed by file identity and version and verified with SHA-256 digests. The directory can be shared by sandboxes on the same host. Enabling it relaxes syscall filters to allow host filesystem access.")
+	flagSet.Int("dcache-max", 0, "Limit the number of unreferenced dentries cached across all filesystems in the sandbox. If zero, only per-filesystem limits apply.")
+	flagSet.Uint64("file-max", 0, "default value of /proc/sys/fs/file-max, the limit on the number of open files in the sandbox. If zero, it is unlimited. The fs.file-max sysctl of the OCI spec takes precedence.")
+	flagSet.Uint64("pipe-max-size", 1048576, "default value of /proc/sys/fs/pipe-max-size, the limit on the size of pipes set by unprivileged applications. The fs.pipe-max-size sysctl of the OCI spec takes precedence.")
+	flagSet.Uint64("aio-max-nr", 65536, "default value of /proc/sys/fs/aio-max-nr, the limit on the number of asynchronous I/O events in the sandbox. The fs.aio-max-nr sysctl of the OCI spec takes precedence.")
+	flagSet.Bool("loop-devices", false, "EXPERIMENTAL: enable /dev/loop-control and /dev/loop[0-7], allowing privileged applications to mount filesystem images.")
 	flagSet.Bool("iouring", false, "TEST ONLY; Enables io_uring syscalls in the sentry. Support is experimental and very limited.")
 	flagSet.Bool("directfs", true, "directly access the container filesystems from the sentry. Sentry runs with higher privileges.")
+	flagSet.Bool("gofer-channel-pool", false, "EXPERIMENTAL: make RPCs to the gofer over a pool of shared memory channels that grows on demand.")
 
 	// Flags that control sandbox runtime behavior: network related.
 	flagSet.Var(networkTypePtr(NetworkSandbox), "network", "specifies which network to use: sandbox (default), host, none. Using network inside the sandbox is more secure because it's isolated from the host network.")
 	flagSet.Bool("net-raw", false, "enable raw sockets. When false, raw sockets are disabled by removing CAP_NET_RAW from containers (`runsc exec` will still be able to utilize raw sockets). Raw sockets allow malicious containers to craft packets and potentially attack the network.")
+	flagSet.Var(HostinetRawSaveFail.Ptr(), "hostinet-raw-save-policy", "how to handle raw and packet sockets on checkpoint with --network=host: fail (default, checkpoint fails), drop (sockets are closed after restore), or reopen (sockets are recreated after restore). Other host sockets always fail checkpoints.")
 	flagSet.Bool("gso", true, "enable host segmentation offload if it is supported by a network device.")
 	flagSet.Bool("software-gso", true, "enable gVisor segmentation offload when host offload can't be enabled.")
 	flagSet.Bool("gvisor-gro", false, "enable gVisor generic receive offload")
@@ -153,7 +172,10 @@ func RegisterFlags(flagSet *flag.FlagSet) {
 	flagSet.Bool("nvproxy-docker", false, "DEPRECATED: use nvidia-container-runtime or `docker run --gpus` directly. Or manually add nvidia-container-runtime-hook as a prestart hook and set up NVIDIA_VISIBLE_DEVICES container environment variable.")
 	flagSet.String("nvproxy-driver-version", "", "NVIDIA driver ABI version to use. If empty, autodetect installed driver version. The special value 'latest' may also be used to use the latest ABI.")
 	flagSet.String("nvproxy-allowed-driver-capabilities", "utility,compute", "Comma separated list of NVIDIA driver capabilities that are allowed to be requested by the container. If 'all' is specified here, it is resolved to all driver capabilities supported in nvproxy. If 'all' is requested by the container, it is resolved to this list.")
+	flagSet.Int("nvproxy-submit-rate", 0, "EXPERIMENTAL: maximum sustained number of GPU ioctls per second for each container, approximating fractional GPU time-slicing between containers. 0 disables throttling.")
+	flagSet.Int("nvproxy-submit-burst", 100, "EXPERIMENTAL: number of GPU ioctls each container may issue back-to-back before --nvproxy-submit-rate applies.")
 	flagSet.Bool("tpuproxy", false, "EXPERIMENTAL: enable support for TPU device passthrough.")
+	flagSet.Bool("rdmaproxy", false, "EXPERIMENTAL: enable support for a restricted set of RDMA verbs on /dev/infiniband/uverbs* devices.")
 
 	// Test flags, not to be used outside tests, ever.
 	flagSet.Bool("TESTONLY-unsafe-nonroot", false, "TEST ONLY; do not ever use! This skips many security measures that isolate the host from the sandbox.")
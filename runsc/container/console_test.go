@@ -26,6 +26,7 @@ import (
 
 	"github.com/kr/pty"
 	"golang.org/x/sys/unix"
+	"github.com/wilinz/gvisor/pkg/abi/linux"
 	"github.com/wilinz/gvisor/pkg/sentry/control"
 	"github.com/wilinz/gvisor/pkg/sync"
 	"github.com/wilinz/gvisor/pkg/test/testutil"
@@ -497,6 +498,74 @@ func TestJobControlSignalRootContainer(t *testing.T) {
 	}
 }
 
+// Test that window size changes are propagated to the container TTY and that
+// the foreground process group is notified with SIGWINCH.
+func TestSetWinsize(t *testing.T) {
+	conf := testutil.TestConfig(t)
+	spec := testutil.NewSpecWithArgs("/bin/sh", "-c", "trap 'stty size; exit 0' WINCH; echo ready; while true; do sleep 0.1; done")
+	spec.Process.Terminal = true
+
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	sock, err := socketPath(bundleDir)
+	if err != nil {
+		t.Fatalf("error getting socket path: %v", err)
+	}
+	srv, cleanup := createConsoleSocket(t, sock)
+	defer cleanup()
+
+	args := Args{
+		ID:            testutil.RandomContainerID(),
+		Spec:          spec,
+		BundleDir:     bundleDir,
+		ConsoleSocket: sock,
+	}
+	c, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer c.Destroy()
+
+	ptyMaster, err := receiveConsolePTY(srv)
+	if err != nil {
+		t.Fatalf("error receiving console FD: %v", err)
+	}
+	defer ptyMaster.Close()
+
+	ptyBuf := newBlockingBuffer()
+	tee := io.TeeReader(ptyMaster, ptyBuf)
+	go func() {
+		_, _ = io.Copy(os.Stderr, tee)
+	}()
+
+	if err := c.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+	if err := testutil.WaitUntilRead(ptyBuf, "ready", 5*time.Second); err != nil {
+		t.Fatalf("shell did not start: %v", err)
+	}
+
+	if err := c.Sandbox.SetWinsize(c.ID, 0 /* PID */, &linux.Winsize{Row: 42, Col: 123}); err != nil {
+		t.Fatalf("error setting window size: %v", err)
+	}
+
+	// The trap prints the new size and exits.
+	if err := testutil.WaitUntilRead(ptyBuf, "42 123", 5*time.Second); err != nil {
+		t.Fatalf("window size change not observed: %v", err)
+	}
+	ws, err := c.Wait()
+	if err != nil {
+		t.Fatalf("error waiting on container: %v", err)
+	}
+	if !ws.Exited() || ws.ExitStatus() != 0 {
+		t.Errorf("container exited with %v, want exit status 0", ws)
+	}
+}
+
 // Test that terminal works with root and sub-containers.
 func TestMultiContainerTerminal(t *testing.T) {
 	for name, conf := range configs(t, false /* noOverlay */) {
@@ -604,6 +673,16 @@ func TestMultiContainerTerminal(t *testing.T) {
 				if err := testutil.WaitUntilRead(ptyBuf, "0", 5*time.Second); err != nil {
 					t.Fatalf("head didn't execute: %v", err)
 				}
+
+				// Writes to /dev/console must show up on the container's own
+				// terminal. Use arithmetic so that the command echo doesn't
+				// match.
+				if _, err := tc.master.Write([]byte("echo console-$((40+2)) > /dev/console\n")); err != nil {
+					t.Fatalf("master.Write(): %v", err)
+				}
+				if err := testutil.WaitUntilRead(ptyBuf, "console-42", 5*time.Second); err != nil {
+					t.Fatalf("write to /dev/console not received: %v", err)
+				}
 			}
 		})
 	}
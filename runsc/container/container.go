@@ -633,6 +633,16 @@ func (c *Container) WaitPID(pid int32) (unix.WaitStatus, error) {
 	return c.Sandbox.WaitPID(c.ID, pid)
 }
 
+// WaitPGID waits for all processes of process group 'pgid' in the container's
+// PID namespace and returns the WaitStatus of the process group leader.
+func (c *Container) WaitPGID(pgid int32) (unix.WaitStatus, error) {
+	log.Debugf("Wait on process group %d in container, cid: %s", pgid, c.ID)
+	if !c.IsSandboxRunning() {
+		return 0, fmt.Errorf("sandbox is not running")
+	}
+	return c.Sandbox.WaitPGID(c.ID, pgid)
+}
+
 // WaitCheckpoint waits for the Kernel to have been successfully checkpointed.
 func (c *Container) WaitCheckpoint() error {
 	log.Debugf("Waiting for checkpoint to complete in container, cid: %s", c.ID)
@@ -680,6 +690,9 @@ func (c *Container) SignalProcess(sig unix.Signal, pid int32) error {
 func (c *Container) ForwardSignals(pid int32, fgProcess bool) func() {
 	log.Debugf("Forwarding all signals to container, cid: %s, PIDPID: %d, fgProcess: %t", c.ID, pid, fgProcess)
 	stop := sighandling.StartSignalForwarding(func(sig linux.Signal) {
+		if sig == linux.SIGWINCH && fgProcess && c.forwardWinsize(pid) {
+			return
+		}
 		log.Debugf("Forwarding signal %d to container, cid: %s, PID: %d, fgProcess: %t", sig, c.ID, pid, fgProcess)
 		if err := c.Sandbox.SignalProcess(c.ID, pid, unix.Signal(sig), fgProcess); err != nil {
 			log.Warningf("error forwarding signal %d to container %q: %v", sig, c.ID, err)
@@ -691,6 +704,29 @@ func (c *Container) ForwardSignals(pid int32, fgProcess bool) func() {
 	}
 }
 
+// forwardWinsize propagates the window size of the terminal attached to the
+// current process to the TTY of the container process, which also delivers
+// SIGWINCH to its foreground process group. It returns false if the current
+// process is not attached to a terminal or the update failed, in which case
+// the caller should forward SIGWINCH as is.
+func (c *Container) forwardWinsize(pid int32) bool {
+	ws, err := unix.IoctlGetWinsize(unix.Stdin, unix.TIOCGWINSZ)
+	if err != nil {
+		return false
+	}
+	log.Debugf("Forwarding window size %dx%d to container, cid: %s, PID: %d", ws.Col, ws.Row, c.ID, pid)
+	if err := c.Sandbox.SetWinsize(c.ID, pid, &linux.Winsize{
+		Row:    ws.Row,
+		Col:    ws.Col,
+		Xpixel: ws.Xpixel,
+		Ypixel: ws.Ypixel,
+	}); err != nil {
+		log.Warningf("error forwarding window size to container %q: %v", c.ID, err)
+		return false
+	}
+	return true
+}
+
 // Checkpoint sends the checkpoint call to the container.
 // The statefile will be written to f, the file at the specified image-path.
 func (c *Container) Checkpoint(imagePath string, direct bool, sfOpts statefile.Options, mfOpts pgalloc.SaveOpts) error {
@@ -1182,7 +1218,7 @@ func (c *Container) waitForStopped() error {
 // shouldCreateDeviceGofer indicates whether a device gofer connection should
 // be created.
 func shouldCreateDeviceGofer(spec *specs.Spec, conf *config.Config) bool {
-	return specutils.GPUFunctionalityRequested(spec, conf) || specutils.TPUFunctionalityRequested(spec, conf)
+	return specutils.GPUFunctionalityRequested(spec, conf) || specutils.TPUFunctionalityRequested(spec, conf) || specutils.RDMAFunctionalityRequested(spec, conf)
 }
 
 // shouldSpawnGofer indicates whether the gofer process should be spawned.
@@ -0,0 +1,119 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package container
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/wilinz/gvisor/pkg/log"
+	"github.com/wilinz/gvisor/pkg/sentry/control"
+	"github.com/wilinz/gvisor/runsc/config"
+)
+
+// cudaCheckpointFile is the name of the file in a checkpoint image directory
+// that lists the processes whose CUDA state was checkpointed by
+// CheckpointCUDA.
+const cudaCheckpointFile = "cuda-checkpoint.json"
+
+// CheckpointCUDA uses the cuda-checkpoint utility, at path binary in the
+// container, to move the GPU state of all CUDA processes in the container to
+// host memory, releasing all of their GPU resources so that nvproxy state
+// can be saved. The list of checkpointed processes is recorded in imagePath,
+// and returned so that the caller can pass it to RestoreCUDA if the
+// container keeps running.
+//
+// cuda-checkpoint fails for processes that don't use CUDA, so such failures
+// are logged and otherwise ignored.
+func (c *Container) CheckpointCUDA(conf *config.Config, binary, imagePath string) ([]int32, error) {
+	procs, err := c.Processes()
+	if err != nil {
+		return nil, fmt.Errorf("listing processes: %w", err)
+	}
+	var pids []int32
+	for _, p := range procs {
+		pids = append(pids, int32(p.PID))
+	}
+	toggled, err := c.toggleCUDA(conf, binary, pids)
+	if err != nil {
+		return toggled, err
+	}
+	data, err := json.Marshal(toggled)
+	if err != nil {
+		return toggled, err
+	}
+	if err := os.WriteFile(filepath.Join(imagePath, cudaCheckpointFile), data, 0644); err != nil {
+		return toggled, fmt.Errorf("recording checkpointed CUDA processes: %w", err)
+	}
+	return toggled, nil
+}
+
+// RestoreCUDA uses the cuda-checkpoint utility, at path binary in the
+// container, to restore the GPU state of processes checkpointed by
+// CheckpointCUDA. If pids is nil, the list of processes is read from
+// imagePath.
+func (c *Container) RestoreCUDA(conf *config.Config, binary, imagePath string, pids []int32) error {
+	if pids == nil {
+		data, err := os.ReadFile(filepath.Join(imagePath, cudaCheckpointFile))
+		if errors.Is(err, os.ErrNotExist) {
+			// CUDA state wasn't checkpointed.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &pids); err != nil {
+			return fmt.Errorf("parsing %s: %w", cudaCheckpointFile, err)
+		}
+	}
+	toggled, err := c.toggleCUDA(conf, binary, pids)
+	if err != nil {
+		return err
+	}
+	if len(toggled) != len(pids) {
+		return fmt.Errorf("failed to restore CUDA state of %d out of %d processes", len(pids)-len(toggled), len(pids))
+	}
+	return nil
+}
+
+// toggleCUDA runs cuda-checkpoint --toggle for each process in pids, and
+// returns the processes for which it succeeded.
+func (c *Container) toggleCUDA(conf *config.Config, binary string, pids []int32) ([]int32, error) {
+	var toggled []int32
+	for _, pid := range pids {
+		args := &control.ExecArgs{
+			Filename: binary,
+			Argv:     []string{binary, "--toggle", "--pid", strconv.Itoa(int(pid))},
+		}
+		execPID, err := c.Execute(conf, args)
+		if err != nil {
+			return toggled, fmt.Errorf("executing %q: %w", binary, err)
+		}
+		ws, err := c.WaitPID(execPID)
+		if err != nil {
+			return toggled, fmt.Errorf("waiting for %q: %w", binary, err)
+		}
+		if ws.ExitStatus() != 0 {
+			log.Infof("cuda-checkpoint --toggle failed for PID %d, status: %v", pid, ws)
+			continue
+		}
+		toggled = append(toggled, pid)
+	}
+	return toggled, nil
+}
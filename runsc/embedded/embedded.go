@@ -0,0 +1,312 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package embedded runs a gVisor sandbox inside the calling Go program,
+// without exec'ing the runsc binary.
+//
+// The sandbox is configured with an OCI runtime spec, which describes its
+// root filesystem, mounts and init process, and a runsc config.Config. The
+// sentry and the gofer serving the sandbox's filesystems both run in the
+// calling process, so none of the isolation that runsc sets up around them
+// (namespaces, chroot, capability dropping) is applied. Callers that need
+// defense in depth should run the program itself in such an environment.
+//
+// The sentry has global state, so at most one Sandbox may exist in a process
+// at a time, and a process that has run a Sandbox can't run another one.
+// While the sandbox is running, signals received by the process are forwarded
+// to the sandbox's init process, as they are by runsc.
+//
+// Only the "none" and "host" network modes are supported: the "sandbox" mode
+// needs network interfaces to be configured by the runtime, which is not done
+// for embedded sandboxes.
+package embedded
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+	"github.com/wilinz/gvisor/pkg/abi/linux"
+	"github.com/wilinz/gvisor/pkg/atomicbitops"
+	"github.com/wilinz/gvisor/pkg/cleanup"
+	"github.com/wilinz/gvisor/pkg/control/server"
+	"github.com/wilinz/gvisor/pkg/log"
+	"github.com/wilinz/gvisor/pkg/unet"
+	"github.com/wilinz/gvisor/runsc/boot"
+	"github.com/wilinz/gvisor/runsc/config"
+	"github.com/wilinz/gvisor/runsc/flag"
+	"github.com/wilinz/gvisor/runsc/fsgofer"
+	"github.com/wilinz/gvisor/runsc/specutils"
+)
+
+// used is set once a Sandbox has been created in this process.
+var used atomicbitops.Bool
+
+// Options configures a Sandbox.
+type Options struct {
+	// ID is the sandbox ID. If empty, a random ID is used.
+	ID string
+
+	// Spec describes the sandbox's root filesystem, mounts and init process.
+	// Spec.Root.Path and the sources of bind mounts are paths on the host.
+	Spec *specs.Spec
+
+	// Conf is the runsc configuration. If nil, DefaultConfig is used.
+	Conf *config.Config
+
+	// Stdin, Stdout and Stderr are the init process' standard I/O. They
+	// are duplicated, so the caller keeps ownership of them. If nil, the
+	// corresponding file descriptor is connected to /dev/null.
+	Stdin  *os.File
+	Stdout *os.File
+	Stderr *os.File
+}
+
+// DefaultConfig returns the configuration that runsc uses when no flags are
+// given, except that networking is disabled, and so is seccomp: the sentry's
+// seccomp filters would apply to the whole calling process.
+func DefaultConfig() (*config.Config, error) {
+	flags := flag.NewFlagSet("embedded", flag.ContinueOnError)
+	config.RegisterFlags(flags)
+	conf, err := config.NewFromFlags(flags)
+	if err != nil {
+		return nil, err
+	}
+	conf.Network = config.NetworkNone
+	conf.DisableSeccomp = true
+	return conf, nil
+}
+
+// Sandbox is a gVisor sandbox running in the calling process.
+type Sandbox struct {
+	l *boot.Loader
+
+	// gofer serves the sandbox's root filesystem and bind mounts.
+	gofer *fsgofer.LisafsServer
+
+	// goferSockets are the gofer's ends of its connections with the sentry.
+	goferSockets []*unet.Socket
+}
+
+// New creates a sandbox configured by opts. The sandbox's init process is
+// not started until Start is called.
+func New(opts Options) (*Sandbox, error) {
+	if opts.Spec == nil {
+		return nil, fmt.Errorf("no spec given")
+	}
+	if err := specutils.ValidateSpec(opts.Spec); err != nil {
+		return nil, err
+	}
+	conf := opts.Conf
+	if conf == nil {
+		var err error
+		if conf, err = DefaultConfig(); err != nil {
+			return nil, err
+		}
+	}
+	if conf.Network == config.NetworkSandbox {
+		return nil, fmt.Errorf("network mode %q is not supported by embedded sandboxes", conf.Network)
+	}
+	if !used.CompareAndSwap(false, true) {
+		return nil, fmt.Errorf("a sandbox has already been created in this process")
+	}
+	id := opts.ID
+	if id == "" {
+		id = fmt.Sprintf("embedded-%016x", rand.Uint64())
+	}
+
+	s := &Sandbox{}
+	cu := cleanup.Make(s.stopGofer)
+	defer cu.Clean()
+
+	if err := fsgofer.OpenProcSelfFD("/proc/self/fd"); err != nil {
+		return nil, err
+	}
+	goferFDs, goferMountConfs, err := s.startGofer(opts.Spec, conf)
+	if err != nil {
+		return nil, err
+	}
+	// The Loader takes ownership of all FDs in boot.Args, even when it fails.
+	stdioFDs, err := dupStdio(opts.Stdin, opts.Stdout, opts.Stderr)
+	if err != nil {
+		for _, fd := range goferFDs {
+			_ = unix.Close(fd)
+		}
+		return nil, err
+	}
+	controllerFD, err := server.CreateSocket("\x00runsc-embedded." + id)
+	if err != nil {
+		for _, fd := range append(goferFDs, stdioFDs...) {
+			_ = unix.Close(fd)
+		}
+		return nil, fmt.Errorf("creating control socket: %w", err)
+	}
+
+	s.l, err = boot.New(boot.Args{
+		ID:                  id,
+		Spec:                opts.Spec,
+		Conf:                conf,
+		ControllerFD:        controllerFD,
+		GoferFDs:            goferFDs,
+		DevGoferFD:          -1,
+		StdioFDs:            stdioFDs,
+		ExecFD:              -1,
+		GoferMountConfs:     goferMountConfs,
+		UserLogFD:           -1,
+		PodInitConfigFD:     -1,
+		MACProfileFD:        -1,
+		GoferContentCacheFD: -1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating sandbox: %w", err)
+	}
+	cu.Release()
+	return s, nil
+}
+
+// startGofer starts a gofer connection for the root filesystem and for each
+// bind mount in spec, in the order expected by boot.Args.GoferFDs. It returns
+// the sentry's ends of the connections.
+func (s *Sandbox) startGofer(spec *specs.Spec, conf *config.Config) ([]int, []boot.GoferMountConf, error) {
+	s.gofer = fsgofer.NewLisafsServer(fsgofer.Config{
+		HostUDS:            conf.GetHostUDS(),
+		HostFifo:           conf.HostFifo,
+		DonateMountPointFD: conf.DirectFS,
+		RUID:               os.Getuid(),
+		EUID:               os.Geteuid(),
+		RGID:               os.Getgid(),
+		EGID:               os.Getegid(),
+	})
+	var (
+		fds   []int
+		confs []boot.GoferMountConf
+	)
+	addConnection := func(path string, readonly bool) error {
+		pair, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+		if err != nil {
+			return err
+		}
+		sock, err := unet.NewSocket(pair[1])
+		if err != nil {
+			_ = unix.Close(pair[0])
+			_ = unix.Close(pair[1])
+			return err
+		}
+		c, err := s.gofer.CreateConnection(sock, path, readonly)
+		if err != nil {
+			_ = unix.Close(pair[0])
+			_ = sock.Close()
+			return fmt.Errorf("serving %q: %w", path, err)
+		}
+		s.gofer.StartConnection(c)
+		s.goferSockets = append(s.goferSockets, sock)
+		fds = append(fds, pair[0])
+		confs = append(confs, boot.GoferMountConf{Lower: boot.Lisafs, Upper: boot.NoOverlay})
+		return nil
+	}
+
+	if err := addConnection(spec.Root.Path, spec.Root.Readonly); err != nil {
+		return nil, nil, err
+	}
+	for _, m := range spec.Mounts {
+		if !specutils.IsGoferMount(m) {
+			continue
+		}
+		if err := addConnection(m.Source, specutils.IsReadonlyMount(m.Options)); err != nil {
+			for _, fd := range fds {
+				_ = unix.Close(fd)
+			}
+			return nil, nil, err
+		}
+	}
+	return fds, confs, nil
+}
+
+// stopGofer stops the gofer, if it was started.
+func (s *Sandbox) stopGofer() {
+	if s.gofer == nil {
+		return
+	}
+	// Closing the gofer's sockets ends its connections.
+	for _, sock := range s.goferSockets {
+		if err := sock.Close(); err != nil {
+			log.Warningf("Error closing gofer socket: %v", err)
+		}
+	}
+	s.gofer.Wait()
+	s.gofer.Destroy()
+	s.gofer = nil
+}
+
+// dupStdio returns duplicates of the given files, substituting /dev/null for
+// nil files.
+func dupStdio(files ...*os.File) ([]int, error) {
+	var fds []int
+	for _, f := range files {
+		var (
+			fd  int
+			err error
+		)
+		if f == nil {
+			fd, err = unix.Open("/dev/null", unix.O_RDWR|unix.O_CLOEXEC, 0)
+		} else {
+			fd, err = unix.FcntlInt(f.Fd(), unix.F_DUPFD_CLOEXEC, 0)
+		}
+		if err != nil {
+			for _, fd := range fds {
+				_ = unix.Close(fd)
+			}
+			return nil, fmt.Errorf("setting up stdio: %w", err)
+		}
+		fds = append(fds, fd)
+	}
+	return fds, nil
+}
+
+// Start starts the sandbox's init process.
+func (s *Sandbox) Start() error {
+	return s.l.StartRoot()
+}
+
+// Wait waits for the sandbox's init process to exit, and returns its exit
+// status.
+func (s *Sandbox) Wait() linux.WaitStatus {
+	return s.l.WaitExit()
+}
+
+// Destroy releases all resources used by the sandbox. It must be called after
+// the sandbox has been created, whether or not it was started, and after Wait
+// has returned if it was. Like boot.Loader.Destroy, it must not be deferred.
+func (s *Sandbox) Destroy() {
+	s.l.Destroy()
+	s.stopGofer()
+}
+
+// Run creates a sandbox configured by opts, runs its init process to
+// completion, and returns its exit status.
+func Run(opts Options) (linux.WaitStatus, error) {
+	s, err := New(opts)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.Start(); err != nil {
+		s.Destroy()
+		return 0, err
+	}
+	ws := s.Wait()
+	s.Destroy()
+	return ws, nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package embedded
+
+import (
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/wilinz/gvisor/runsc/config"
+)
+
+func testSpec() *specs.Spec {
+	return &specs.Spec{
+		Root: &specs.Root{
+			Path:     "/",
+			Readonly: true,
+		},
+		Process: &specs.Process{
+			Args: []string{"/bin/true"},
+			Cwd:  "/",
+		},
+	}
+}
+
+func TestDefaultConfig(t *testing.T) {
+	conf, err := DefaultConfig()
+	if err != nil {
+		t.Fatalf("DefaultConfig failed: %v", err)
+	}
+	if !conf.DisableSeccomp {
+		t.Errorf("DefaultConfig enables seccomp")
+	}
+	if conf.Network != config.NetworkNone {
+		t.Errorf("DefaultConfig network is %v, want %v", conf.Network, config.NetworkNone)
+	}
+}
+
+// TestNewInvalid checks that invalid options are rejected before any sandbox
+// state is created.
+func TestNewInvalid(t *testing.T) {
+	sandboxNetwork, err := DefaultConfig()
+	if err != nil {
+		t.Fatalf("DefaultConfig failed: %v", err)
+	}
+	sandboxNetwork.Network = config.NetworkSandbox
+
+	noProcess := testSpec()
+	noProcess.Process = nil
+
+	for _, tc := range []struct {
+		name string
+		opts Options
+	}{
+		{
+			name: "no spec",
+			opts: Options{},
+		},
+		{
+			name: "no process",
+			opts: Options{Spec: noProcess},
+		},
+		{
+			name: "sandbox network",
+			opts: Options{Spec: testSpec(), Conf: sandboxNetwork},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if s, err := New(tc.opts); err == nil {
+				s.Destroy()
+				t.Fatalf("New succeeded, want error")
+			}
+			if used.Load() {
+				t.Errorf("New marked the process as used")
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package embedded_test
+
+import (
+	"fmt"
+	"os"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/wilinz/gvisor/runsc/config"
+	"github.com/wilinz/gvisor/runsc/embedded"
+)
+
+// Example runs a command in a sandbox whose root filesystem is a read-only
+// view of the host's, with a writable host directory bind-mounted at /out.
+func Example() {
+	spec := &specs.Spec{
+		Root: &specs.Root{
+			Path:     "/",
+			Readonly: true,
+		},
+		Mounts: []specs.Mount{
+			{
+				Destination: "/out",
+				Type:        "bind",
+				Source:      os.TempDir(),
+			},
+		},
+		Process: &specs.Process{
+			Args: []string{"/bin/sh", "-c", "uname -a > /out/uname"},
+			Env:  []string{"PATH=/usr/bin:/bin"},
+			Cwd:  "/",
+		},
+	}
+	ws, err := embedded.Run(embedded.Options{
+		Spec:   spec,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "running sandbox: %v\n", err)
+		return
+	}
+	fmt.Printf("sandbox exited with status %d\n", ws.ExitStatus())
+}
+
+// ExampleSandbox creates a sandbox with host networking, and waits for its
+// init process separately from starting it.
+func ExampleSandbox() {
+	conf, err := embedded.DefaultConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "creating config: %v\n", err)
+		return
+	}
+	conf.Network = config.NetworkHost
+	s, err := embedded.New(embedded.Options{
+		ID:   "example",
+		Conf: conf,
+		Spec: &specs.Spec{
+			Root: &specs.Root{Path: "/", Readonly: true},
+			Process: &specs.Process{
+				Args: []string{"/bin/cat", "/etc/resolv.conf"},
+				Cwd:  "/",
+			},
+		},
+		Stdout: os.Stdout,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "creating sandbox: %v\n", err)
+		return
+	}
+	if err := s.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "starting sandbox: %v\n", err)
+		s.Destroy()
+		return
+	}
+	ws := s.Wait()
+	s.Destroy()
+	fmt.Printf("sandbox exited: %v\n", ws)
+}
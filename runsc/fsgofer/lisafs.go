@@ -192,6 +192,7 @@ func (s *LisafsServer) SupportedMessages() []lisafs.MID {
 		lisafs.Listen,
 		lisafs.Accept,
 		lisafs.ConnectWithCreds,
+		lisafs.Getdents64Cursor,
 	}
 }
 
@@ -1034,6 +1035,10 @@ type openFDLisa struct {
 
 	// hostFD is the host file descriptor which can be used to make syscalls.
 	hostFD int
+
+	// direntsMu serializes reads of directory entries from hostFD, since
+	// they depend on hostFD's file offset.
+	direntsMu sync.Mutex
 }
 
 var _ lisafs.OpenFDImpl = (*openFDLisa)(nil)
@@ -1101,12 +1106,33 @@ func (fd *openFDLisa) Flush() error {
 
 // Getdent64 implements lisafs.OpenFDImpl.Getdent64.
 func (fd *openFDLisa) Getdent64(count uint32, seek0 bool, recordDirent func(lisafs.Dirent64)) error {
+	fd.direntsMu.Lock()
+	defer fd.direntsMu.Unlock()
 	if seek0 {
 		if _, err := unix.Seek(fd.hostFD, 0, 0); err != nil {
 			return err
 		}
 	}
+	return fd.getdentsLocked(count, recordDirent)
+}
+
+// Getdent64Cursor implements lisafs.OpenFDImpl.Getdent64Cursor.
+func (fd *openFDLisa) Getdent64Cursor(cursor uint64, count uint32, recordDirent func(lisafs.Dirent64)) error {
+	fd.direntsMu.Lock()
+	defer fd.direntsMu.Unlock()
+	// Directory offsets returned by getdents64(2) are opaque cookies that can
+	// be passed to lseek(2) to resume iteration after the corresponding entry.
+	if _, err := unix.Seek(fd.hostFD, int64(cursor), unix.SEEK_SET); err != nil {
+		return err
+	}
+	return fd.getdentsLocked(count, recordDirent)
+}
 
+// getdentsLocked reads up to count bytes of directory entries from the
+// current offset of fd.hostFD.
+//
+// Preconditions: fd.direntsMu must be locked.
+func (fd *openFDLisa) getdentsLocked(count uint32, recordDirent func(lisafs.Dirent64)) error {
 	var direntsBuf [8192]byte
 	var bytesRead int
 	for bytesRead < int(count) {
@@ -61,3 +61,7 @@ func (tester) BindSupported() bool {
 func TestFSGofer(t *testing.T) {
 	testsuite.RunAllLocalFSTests(t, tester{})
 }
+
+func TestFSGoferChannelPool(t *testing.T) {
+	testsuite.RunAllLocalFSTestsWithChannelPool(t, tester{})
+}
@@ -17,6 +17,8 @@ package metricserver
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -55,6 +57,10 @@ const (
 
 	// exportParallelGoroutines is the maximum number of goroutines spawned during metrics export.
 	exportParallelGoroutines = 8
+
+	// sandboxMetricsPath is the path prefix under which the metrics of a single sandbox are served,
+	// followed by the sandbox ID.
+	sandboxMetricsPath = "/metrics/sandbox/"
 )
 
 // servedSandbox is a sandbox that we serve metrics from.
@@ -256,6 +262,21 @@ type metricServer struct {
 	startTime              time.Time
 	srv                    http.Server
 
+	// access, if set, lists the credentials that clients must present to scrape metrics, along
+	// with the sandboxes and metrics that each credential gives access to.
+	// It is immutable.
+	access *accessList
+
+	// requireClientCert is true if clients must authenticate, either with a client certificate
+	// signed by the configured client CA or with a credential from `access`.
+	// It is immutable.
+	requireClientCert bool
+
+	// exportFilter, if set, is a regular expression that the names of sandbox metrics must match
+	// in order to be exported to any client.
+	// It is immutable.
+	exportFilter *regexp.Regexp
+
 	// Size of the map of written metrics during the last /metrics export. Initially zero.
 	// Used to efficiently reallocate a map of the right size during the next export.
 	lastMetricsWrittenSize atomicbitops.Uint32
@@ -622,8 +643,63 @@ func queryMultiSandboxMetrics(ctx context.Context, loadedSandboxes []sandboxLoad
 	wg.Wait()
 }
 
-// serveMetrics serves metrics requests.
+// serveMetrics serves metrics requests for all the sandboxes that the client may access.
 func (m *metricServer) serveMetrics(w *httpResponseWriter, req *http.Request) httpResult {
+	rule, result := m.authorize(w, req)
+	if result.err != nil {
+		return result
+	}
+	return m.exportMetrics(w, req, rule, "")
+}
+
+// serveSandboxMetrics serves metrics requests for a single sandbox, whose ID follows
+// sandboxMetricsPath in the request path.
+func (m *metricServer) serveSandboxMetrics(w *httpResponseWriter, req *http.Request) httpResult {
+	rule, result := m.authorize(w, req)
+	if result.err != nil {
+		return result
+	}
+	sandboxID := strings.TrimPrefix(req.URL.Path, sandboxMetricsPath)
+	if i := strings.IndexByte(sandboxID, '?'); i != -1 {
+		// Undo Prometheus's encoding of the query string, see serveIndex.
+		req.URL.RawQuery = sandboxID[i+1:]
+		sandboxID = sandboxID[:i]
+	}
+	if sandboxID == "" || strings.Contains(sandboxID, "/") {
+		return httpResult{http.StatusNotFound, errors.New("path not found")}
+	}
+	return m.exportMetrics(w, req, rule, sandboxID)
+}
+
+// exportableMetric returns whether the sandbox metric with the given name may be exported to a
+// client with the given access rule.
+func (m *metricServer) exportableMetric(rule *accessRule, name string) bool {
+	if m.exportFilter != nil && !m.exportFilter.MatchString(name) {
+		return false
+	}
+	return rule.allowsMetric(name)
+}
+
+// filterSnapshot removes the data of metrics that may not be exported to a client with the given
+// access rule from snapshot.
+func (m *metricServer) filterSnapshot(snapshot *prometheus.Snapshot, rule *accessRule) {
+	if m.exportFilter == nil && rule.metrics == nil {
+		return
+	}
+	data := snapshot.Data[:0]
+	for _, d := range snapshot.Data {
+		if m.exportableMetric(rule, d.Metric.Name) {
+			data = append(data, d)
+		}
+	}
+	snapshot.Data = data
+}
+
+// exportMetrics writes out the metrics of the sandboxes visible to a client with the given access
+// rule. If sandboxID is not empty, only the metrics of that sandbox are exported.
+// Metrics about the metric server as a whole reveal the existence of other sandboxes, so they are
+// only exported when all sandboxes are.
+func (m *metricServer) exportMetrics(w *httpResponseWriter, req *http.Request, rule *accessRule, sandboxID string) httpResult {
 	ctx, ctxCancel := context.WithTimeout(req.Context(), metricsExportTimeout)
 	defer ctxCancel()
 
@@ -657,6 +733,31 @@ func (m *metricServer) serveMetrics(w *httpResponseWriter, req *http.Request) ht
 	}
 
 	loadedSandboxes := m.loadSandboxesLocked(ctx)
+	allSandboxes := sandboxID == "" && rule.allSandboxes()
+	if !allSandboxes {
+		visible := loadedSandboxes[:0]
+		for _, s := range loadedSandboxes {
+			if sandboxID != "" && s.served.rootContainerID.SandboxID != sandboxID {
+				continue
+			}
+			// Sandboxes whose labels are not known yet are not visible to clients restricted
+			// by label.
+			if s.err != nil && !rule.allSandboxes() {
+				continue
+			}
+			if !rule.allowsSandbox(s.served.extraLabels) {
+				continue
+			}
+			visible = append(visible, s)
+		}
+		loadedSandboxes = visible
+		if sandboxID != "" && len(loadedSandboxes) == 0 {
+			m.mu.Unlock()
+			// Do not distinguish between sandboxes that don't exist and sandboxes that the
+			// client may not access.
+			return httpResult{http.StatusNotFound, fmt.Errorf("sandbox %q not found", sandboxID)}
+		}
+	}
 	numSandboxes := len(loadedSandboxes)
 	numSandboxesTotal := m.numSandboxes
 	m.mu.Unlock()
@@ -724,6 +825,7 @@ func (m *metricServer) serveMetrics(w *httpResponseWriter, req *http.Request) ht
 			}
 			return
 		}
+		m.filterSnapshot(r.snapshot, rule)
 		snapshotCh <- snapshotAndOptions{
 			snapshot: r.snapshot,
 			options: prometheus.SnapshotExportOptions{
@@ -751,16 +853,21 @@ func (m *metricServer) serveMetrics(w *httpResponseWriter, req *http.Request) ht
 	}
 
 	// Add our own metrics.
-	selfMetrics.Add(prometheus.NewIntData(&NumRunningSandboxesMetric, meta.numRunningSandboxes))
-	selfMetrics.Add(prometheus.NewIntData(&NumCannotExportSandboxesMetric, meta.numCannotExportSandboxes))
-	selfMetrics.Add(prometheus.NewIntData(&NumTotalSandboxesMetric, numSandboxesTotal))
-	selfMetrics.Add(prometheus.NewIntData(&NumCheckpointedSandboxesMetric, meta.numCheckpointedSandboxes))
-	selfMetrics.Add(prometheus.NewIntData(&NumRestoredSandboxesMetric, meta.numRestoredSandboxes))
+	if allSandboxes {
+		selfMetrics.Add(prometheus.NewIntData(&NumRunningSandboxesMetric, meta.numRunningSandboxes))
+		selfMetrics.Add(prometheus.NewIntData(&NumCannotExportSandboxesMetric, meta.numCannotExportSandboxes))
+		selfMetrics.Add(prometheus.NewIntData(&NumTotalSandboxesMetric, numSandboxesTotal))
+		selfMetrics.Add(prometheus.NewIntData(&NumCheckpointedSandboxesMetric, meta.numCheckpointedSandboxes))
+		selfMetrics.Add(prometheus.NewIntData(&NumRestoredSandboxesMetric, meta.numRestoredSandboxes))
+	}
 
 	// Write out all data.
 	lastMetricsWrittenSize := int(m.lastMetricsWrittenSize.Load())
 	metricsWritten := make(map[string]bool, lastMetricsWrittenSize)
 	commentHeader := fmt.Sprintf("Data for runsc metric server exporting data for sandboxes in root directory %s", m.rootDir)
+	if sandboxID != "" {
+		commentHeader = fmt.Sprintf("%s (sandbox %s only)", commentHeader, sandboxID)
+	}
 	if metricsFilter != "" {
 		commentHeader = fmt.Sprintf("%s (filtered using regular expression: %q)", commentHeader, metricsFilter)
 	}
@@ -838,6 +945,63 @@ type Server struct {
 	// AllowUnknownRoot causes the metric server to keep running regardless of the existence of the
 	// Config's root directory or the metric server's ability to access it.
 	AllowUnknownRoot bool
+
+	// TLSCertFile and TLSKeyFile, if set, are the PEM-encoded certificate and private key used to
+	// serve metrics over HTTPS instead of plain HTTP.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// TLSClientCAFile, if set, is a PEM-encoded set of CA certificates used to verify client
+	// certificates. Requires TLSCertFile. Clients must then present a certificate signed by one
+	// of these CAs, or a bearer token from AccessFile. If AccessFile is not set, any such
+	// certificate gives access to all metrics.
+	TLSClientCAFile string
+
+	// AccessFile, if set, is the path to a file listing the credentials that clients must present
+	// to scrape metrics, and which sandboxes and metrics each of them may see.
+	// See parseAccessList for its format.
+	AccessFile string
+
+	// ExportFilter, if set, is a regular expression that the names of sandbox metrics must match
+	// in order to be exported at all.
+	ExportFilter string
+}
+
+// tlsConfig returns the TLS configuration to serve metrics with, or nil if
+// metrics are served over plain HTTP.
+func (s *Server) tlsConfig() (*tls.Config, error) {
+	if s.TLSCertFile == "" && s.TLSKeyFile == "" {
+		if s.TLSClientCAFile != "" {
+			return nil, errors.New("a TLS client CA requires a TLS certificate and key")
+		}
+		return nil, nil
+	}
+	if s.TLSCertFile == "" || s.TLSKeyFile == "" {
+		return nil, errors.New("TLS certificate and key must be specified together")
+	}
+	cert, err := tls.LoadX509KeyPair(s.TLSCertFile, s.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load TLS certificate: %w", err)
+	}
+	tlsConf := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if s.TLSClientCAFile != "" {
+		pem, err := os.ReadFile(s.TLSClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read TLS client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in TLS client CA file %q", s.TLSClientCAFile)
+		}
+		tlsConf.ClientCAs = pool
+		// Clients may still authenticate with a bearer token instead, so only verify
+		// certificates that are presented; authorize rejects requests that present neither.
+		tlsConf.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConf, nil
 }
 
 // Run runs the metric server.
@@ -851,6 +1015,7 @@ func (s *Server) Run(ctx context.Context) error {
 		pidFile:                s.PIDFile,
 		exposeProfileEndpoints: s.ExposeProfileEndpoints,
 		allowUnknownRoot:       s.AllowUnknownRoot,
+		requireClientCert:      s.TLSClientCAFile != "",
 		promWriterPool: sync.Pool{
 			New: func() any {
 				return &prometheus.ReusableWriter[*httpResponseWriter]{}
@@ -861,6 +1026,23 @@ func (s *Server) Run(ctx context.Context) error {
 	if conf.MetricServer == "" {
 		return errors.New("config does not specify the metric server address (--metric-server)")
 	}
+	tlsConf, err := s.tlsConfig()
+	if err != nil {
+		return err
+	}
+	if s.AccessFile != "" {
+		if m.access, err = loadAccessList(s.AccessFile); err != nil {
+			return err
+		}
+		if tlsConf == nil && !strings.HasPrefix(conf.MetricServer, fmt.Sprintf("%c", os.PathSeparator)) {
+			log.Warningf("Access tokens are sent in clear text over TCP; consider also setting a TLS certificate.")
+		}
+	}
+	if s.ExportFilter != "" {
+		if m.exportFilter, err = regexp.Compile(s.ExportFilter); err != nil {
+			return fmt.Errorf("invalid export filter %q: %w", s.ExportFilter, err)
+		}
+	}
 	if strings.Contains(conf.MetricServer, "%ID%") {
 		return fmt.Errorf("metric server address contains '%%ID%%': %v; this should have been replaced by the parent process", conf.MetricServer)
 	}
@@ -925,7 +1107,7 @@ func (s *Server) Run(ctx context.Context) error {
 			log.Infof("Bound on socket file %s which existed prior to this server's existence. As such, it will not be deleted on server shutdown.", conf.MetricServer)
 		}
 	} else {
-		if strings.HasPrefix(conf.MetricServer, ":") {
+		if strings.HasPrefix(conf.MetricServer, ":") && m.access == nil && !m.requireClientCert {
 			log.Warningf("Binding on all interfaces. This will allow anyone to list all containers on your machine!")
 		}
 		if listener, listenErr = (&net.ListenConfig{}).Listen(ctx, "tcp", conf.MetricServer); listenErr != nil {
@@ -933,18 +1115,24 @@ func (s *Server) Run(ctx context.Context) error {
 		}
 	}
 
+	if tlsConf != nil {
+		listener = tls.NewListener(listener, tlsConf)
+	}
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/runsc-metrics/healthcheck", logRequest(m.serveHealthCheck))
 	mux.HandleFunc("/runsc-metrics/pid", logRequest(m.servePID))
 	if m.exposeProfileEndpoints {
 		log.Warningf("Profiling HTTP endpoints are exposed; this should only be used for development!")
-		mux.HandleFunc("/runsc-metrics/profile-cpu", logRequest(m.profileCPU))
-		mux.HandleFunc("/runsc-metrics/profile-heap", logRequest(m.profileHeap))
+		mux.HandleFunc("/runsc-metrics/profile-cpu", logRequest(m.requireFullAccess(m.profileCPU)))
+		mux.HandleFunc("/runsc-metrics/profile-heap", logRequest(m.requireFullAccess(m.profileHeap)))
 	} else {
 		// Disable memory profiling, since we don't expose it.
 		runtime.MemProfileRate = 0
 	}
 	mux.HandleFunc("/metrics", logRequest(m.serveMetrics))
+	mux.HandleFunc(sandboxMetricsPath, logRequest(m.serveSandboxMetrics))
+	mux.HandleFunc(sandboxHealthPath, logRequest(m.serveSandboxHealth))
 	mux.HandleFunc("/", logRequest(m.serveIndex))
 	m.srv.Handler = mux
 	m.srv.ReadTimeout = httpTimeout
@@ -0,0 +1,267 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metricserver
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/wilinz/gvisor/pkg/prometheus"
+)
+
+const (
+	// accessTokenPrefix prefixes credentials that are bearer tokens in the
+	// access file.
+	accessTokenPrefix = "token:"
+
+	// accessCertPrefix prefixes credentials that are client certificate names
+	// in the access file.
+	accessCertPrefix = "cert:"
+
+	// accessMetricsKey is the access file option restricting which sandbox
+	// metrics a credential may see.
+	accessMetricsKey = "metrics"
+)
+
+// accessSelectorLabels is the set of sandbox labels that access rules may
+// select sandboxes by.
+var accessSelectorLabels = map[string]bool{
+	prometheus.SandboxIDLabel:   true,
+	prometheus.PodNameLabel:     true,
+	prometheus.NamespaceLabel:   true,
+	prometheus.IterationIDLabel: true,
+}
+
+// accessRule describes what a client may scrape.
+type accessRule struct {
+	// selectors maps sandbox label names to the values that label may take.
+	// A sandbox is visible if each of its selected labels has one of the
+	// listed values. If empty, all sandboxes are visible.
+	selectors map[string][]string
+
+	// metrics, if set, restricts the exported sandbox metrics to those whose
+	// name matches it.
+	metrics *regexp.Regexp
+}
+
+// fullAccess is the rule used when the server does not authenticate clients.
+var fullAccess = &accessRule{}
+
+// allSandboxes returns whether r gives access to every sandbox.
+func (r *accessRule) allSandboxes() bool {
+	return len(r.selectors) == 0
+}
+
+// allowsSandbox returns whether a sandbox with the given labels is visible.
+func (r *accessRule) allowsSandbox(labels map[string]string) bool {
+	for label, values := range r.selectors {
+		value, ok := labels[label]
+		if !ok {
+			return false
+		}
+		found := false
+		for _, v := range values {
+			if v == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// allowsMetric returns whether the sandbox metric with the given name may be
+// exported.
+func (r *accessRule) allowsMetric(name string) bool {
+	return r.metrics == nil || r.metrics.MatchString(name)
+}
+
+// accessEntry is an accessRule along with the credential that grants it.
+type accessEntry struct {
+	credential string
+	rule       *accessRule
+}
+
+// accessList is the parsed form of an access file.
+type accessList struct {
+	tokens []accessEntry
+	certs  []accessEntry
+}
+
+// parseAccessList parses the contents of an access file.
+//
+// Each non-empty line that doesn't start with '#' is of the form
+//
+//	<credential> [<key>=<value> ...]
+//
+// where <credential> is either "token:<bearer token>" or "cert:<name>", the
+// latter matching the common name or any DNS name of a verified client
+// certificate. Options with a sandbox label as key (sandbox, pod_name,
+// namespace_name, iteration) restrict the credential to sandboxes with that
+// label value; repeating a key allows any of the given values. The option
+// "metrics=<regexp>" restricts the exported sandbox metrics to those whose
+// name matches the regular expression. A credential without options may
+// scrape everything.
+func parseAccessList(data string) (*accessList, error) {
+	var list accessList
+	seen := make(map[string]bool)
+	for i, line := range strings.Split(data, "\n") {
+		lineNum := i + 1
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		credential := fields[0]
+		if seen[credential] {
+			return nil, fmt.Errorf("line %d: duplicate credential", lineNum)
+		}
+		seen[credential] = true
+		rule := &accessRule{}
+		for _, opt := range fields[1:] {
+			key, value, ok := strings.Cut(opt, "=")
+			if !ok || value == "" {
+				return nil, fmt.Errorf("line %d: invalid option %q, want <key>=<value>", lineNum, opt)
+			}
+			switch {
+			case key == accessMetricsKey:
+				if rule.metrics != nil {
+					return nil, fmt.Errorf("line %d: %q specified more than once", lineNum, accessMetricsKey)
+				}
+				reg, err := regexp.Compile(value)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid metrics regular expression %q: %w", lineNum, value, err)
+				}
+				rule.metrics = reg
+			case accessSelectorLabels[key]:
+				if rule.selectors == nil {
+					rule.selectors = make(map[string][]string)
+				}
+				rule.selectors[key] = append(rule.selectors[key], value)
+			default:
+				return nil, fmt.Errorf("line %d: unknown option %q", lineNum, key)
+			}
+		}
+		switch {
+		case strings.HasPrefix(credential, accessTokenPrefix) && len(credential) > len(accessTokenPrefix):
+			list.tokens = append(list.tokens, accessEntry{strings.TrimPrefix(credential, accessTokenPrefix), rule})
+		case strings.HasPrefix(credential, accessCertPrefix) && len(credential) > len(accessCertPrefix):
+			list.certs = append(list.certs, accessEntry{strings.TrimPrefix(credential, accessCertPrefix), rule})
+		default:
+			// Don't echo the credential, it may be a mistyped token.
+			return nil, fmt.Errorf("line %d: credential must start with %q or %q", lineNum, accessTokenPrefix, accessCertPrefix)
+		}
+	}
+	if len(list.tokens) == 0 && len(list.certs) == 0 {
+		return nil, errors.New("no credentials")
+	}
+	return &list, nil
+}
+
+// loadAccessList reads and parses the access file at path.
+func loadAccessList(path string) (*accessList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	list, err := parseAccessList(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid access file %q: %w", path, err)
+	}
+	return list, nil
+}
+
+// lookupToken returns the rule granted by the given bearer token, or nil.
+// All tokens are compared in constant time so that the response time does
+// not reveal how close a guess was.
+func (l *accessList) lookupToken(token string) *accessRule {
+	var rule *accessRule
+	for _, e := range l.tokens {
+		if subtle.ConstantTimeCompare([]byte(e.credential), []byte(token)) == 1 {
+			rule = e.rule
+		}
+	}
+	return rule
+}
+
+// lookupCert returns the rule granted to a client certificate with one of the
+// given names, or nil.
+func (l *accessList) lookupCert(names []string) *accessRule {
+	for _, e := range l.certs {
+		for _, name := range names {
+			if e.credential == name {
+				return e.rule
+			}
+		}
+	}
+	return nil
+}
+
+// authorize returns the access rule of the client that sent req.
+// If the client may not scrape anything, it returns an httpResult with a
+// non-nil error instead.
+func (m *metricServer) authorize(w *httpResponseWriter, req *http.Request) (*accessRule, httpResult) {
+	if m.access == nil && !m.requireClientCert {
+		return fullAccess, httpOK
+	}
+	if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 && len(req.TLS.VerifiedChains[0]) > 0 {
+		if m.access == nil {
+			// Any certificate signed by the client CA grants full access.
+			return fullAccess, httpOK
+		}
+		leaf := req.TLS.VerifiedChains[0][0]
+		names := append([]string{leaf.Subject.CommonName}, leaf.DNSNames...)
+		if rule := m.access.lookupCert(names); rule != nil {
+			return rule, httpOK
+		}
+	}
+	if m.access != nil {
+		if token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer "); ok {
+			if rule := m.access.lookupToken(token); rule != nil {
+				return rule, httpOK
+			}
+			return nil, httpResult{http.StatusForbidden, errors.New("unknown credentials")}
+		}
+	}
+	if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 {
+		return nil, httpResult{http.StatusForbidden, errors.New("unknown credentials")}
+	}
+	if m.access != nil && len(m.access.tokens) > 0 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="runsc metrics"`)
+	}
+	return nil, httpResult{http.StatusUnauthorized, errors.New("authentication required")}
+}
+
+// requireFullAccess wraps an HTTP handler such that it may only be used by
+// clients that may scrape all metrics of all sandboxes.
+func (m *metricServer) requireFullAccess(f func(w *httpResponseWriter, req *http.Request) httpResult) func(w *httpResponseWriter, req *http.Request) httpResult {
+	return func(w *httpResponseWriter, req *http.Request) httpResult {
+		rule, result := m.authorize(w, req)
+		if result.err != nil {
+			return result
+		}
+		if !rule.allSandboxes() || rule.metrics != nil {
+			return httpResult{http.StatusForbidden, errors.New("this endpoint requires access to all metrics")}
+		}
+		return f(w, req)
+	}
+}
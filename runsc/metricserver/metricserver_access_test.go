@@ -0,0 +1,339 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metricserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/wilinz/gvisor/pkg/prometheus"
+)
+
+const testAccessFile = `
+# Operators see everything.
+token:admin-secret
+cert:prometheus.example.com
+
+# Tenants only see their own sandboxes.
+token:tenant-a-secret namespace_name=tenant-a
+token:tenant-b-secret namespace_name=tenant-b namespace_name=tenant-b-staging metrics=^netstack_
+cert:tenant-c sandbox=abc
+`
+
+// TestParseAccessList tests parseAccessList.
+func TestParseAccessList(t *testing.T) {
+	list, err := parseAccessList(testAccessFile)
+	if err != nil {
+		t.Fatalf("parseAccessList failed: %v", err)
+	}
+	if got, want := len(list.tokens), 3; got != want {
+		t.Errorf("got %d tokens, want %d", got, want)
+	}
+	if got, want := len(list.certs), 2; got != want {
+		t.Errorf("got %d certs, want %d", got, want)
+	}
+
+	for _, test := range []struct {
+		name string
+		data string
+		want string
+	}{
+		{
+			name: "empty",
+			data: "# nothing\n\n",
+			want: "no credentials",
+		},
+		{
+			name: "unknown credential type",
+			data: "password:hunter2",
+			want: "credential must start with",
+		},
+		{
+			name: "empty token",
+			data: "token:",
+			want: "credential must start with",
+		},
+		{
+			name: "duplicate credential",
+			data: "token:a\ntoken:a sandbox=b",
+			want: "line 2: duplicate credential",
+		},
+		{
+			name: "option without value",
+			data: "token:a sandbox",
+			want: "invalid option",
+		},
+		{
+			name: "unknown option",
+			data: "token:a container=b",
+			want: "unknown option",
+		},
+		{
+			name: "invalid regular expression",
+			data: "token:a metrics=(",
+			want: "invalid metrics regular expression",
+		},
+		{
+			name: "repeated metrics",
+			data: "token:a metrics=a metrics=b",
+			want: "specified more than once",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseAccessList(test.data)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("parseAccessList(%q) = %v, want error containing %q", test.data, err, test.want)
+			}
+			if err != nil && strings.Contains(err.Error(), "hunter2") {
+				t.Errorf("parseAccessList(%q) error %q leaks the credential", test.data, err)
+			}
+		})
+	}
+}
+
+// TestAccessRule tests accessRule's sandbox and metric matching.
+func TestAccessRule(t *testing.T) {
+	list, err := parseAccessList(testAccessFile)
+	if err != nil {
+		t.Fatalf("parseAccessList failed: %v", err)
+	}
+	admin := list.lookupToken("admin-secret")
+	tenantA := list.lookupToken("tenant-a-secret")
+	tenantB := list.lookupToken("tenant-b-secret")
+	tenantC := list.lookupCert([]string{"tenant-c"})
+	if admin == nil || tenantA == nil || tenantB == nil || tenantC == nil {
+		t.Fatalf("lookups failed: admin=%v tenantA=%v tenantB=%v tenantC=%v", admin, tenantA, tenantB, tenantC)
+	}
+	if list.lookupToken("tenant-a") != nil {
+		t.Errorf("lookupToken matched a prefix of a token")
+	}
+	if list.lookupToken("prometheus.example.com") != nil {
+		t.Errorf("lookupToken matched a certificate name")
+	}
+
+	sandboxA := map[string]string{"sandbox": "abc", "namespace_name": "tenant-a"}
+	sandboxB := map[string]string{"sandbox": "def", "namespace_name": "tenant-b-staging"}
+	unlabeled := map[string]string{"sandbox": "ghi"}
+	for _, test := range []struct {
+		name    string
+		rule    *accessRule
+		labels  map[string]string
+		allowed bool
+	}{
+		{"admin sees a", admin, sandboxA, true},
+		{"admin sees unlabeled", admin, unlabeled, true},
+		{"tenant a sees a", tenantA, sandboxA, true},
+		{"tenant a does not see b", tenantA, sandboxB, false},
+		{"tenant a does not see unlabeled", tenantA, unlabeled, false},
+		{"tenant b sees b", tenantB, sandboxB, true},
+		{"tenant c sees a by ID", tenantC, sandboxA, true},
+		{"tenant c does not see b", tenantC, sandboxB, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.rule.allowsSandbox(test.labels); got != test.allowed {
+				t.Errorf("allowsSandbox(%v) = %t, want %t", test.labels, got, test.allowed)
+			}
+		})
+	}
+
+	if !admin.allSandboxes() || tenantA.allSandboxes() {
+		t.Errorf("allSandboxes: admin=%t tenantA=%t, want true and false", admin.allSandboxes(), tenantA.allSandboxes())
+	}
+	if !tenantA.allowsMetric("fs_opens") {
+		t.Errorf("tenant a may not see fs_opens")
+	}
+	if tenantB.allowsMetric("fs_opens") || !tenantB.allowsMetric("netstack_dropped_packets") {
+		t.Errorf("tenant b metric filter not applied")
+	}
+}
+
+// TestAuthorize tests metricServer.authorize.
+func TestAuthorize(t *testing.T) {
+	list, err := parseAccessList(testAccessFile)
+	if err != nil {
+		t.Fatalf("parseAccessList failed: %v", err)
+	}
+	verified := func(names ...string) *tls.ConnectionState {
+		leaf := &x509.Certificate{Subject: pkix.Name{CommonName: names[0]}, DNSNames: names[1:]}
+		return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{leaf}}}
+	}
+	for _, test := range []struct {
+		name              string
+		access            *accessList
+		requireClientCert bool
+		token             string
+		tls               *tls.ConnectionState
+		wantCode          int
+		wantFull          bool
+	}{
+		{
+			name:     "no authentication",
+			wantCode: http.StatusOK,
+			wantFull: true,
+		},
+		{
+			name:     "missing token",
+			access:   list,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "unknown token",
+			access:   list,
+			token:    "guess",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "admin token",
+			access:   list,
+			token:    "admin-secret",
+			wantCode: http.StatusOK,
+			wantFull: true,
+		},
+		{
+			name:     "tenant token",
+			access:   list,
+			token:    "tenant-a-secret",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:              "certificate by DNS name",
+			access:            list,
+			requireClientCert: true,
+			tls:               verified("scraper", "prometheus.example.com"),
+			wantCode:          http.StatusOK,
+			wantFull:          true,
+		},
+		{
+			name:              "unknown certificate",
+			access:            list,
+			requireClientCert: true,
+			tls:               verified("someone"),
+			wantCode:          http.StatusForbidden,
+		},
+		{
+			name:              "unknown certificate with token",
+			access:            list,
+			requireClientCert: true,
+			tls:               verified("someone"),
+			token:             "tenant-a-secret",
+			wantCode:          http.StatusOK,
+		},
+		{
+			name:              "any certificate without access file",
+			requireClientCert: true,
+			tls:               verified("someone"),
+			wantCode:          http.StatusOK,
+			wantFull:          true,
+		},
+		{
+			name:              "no certificate without access file",
+			requireClientCert: true,
+			tls:               &tls.ConnectionState{},
+			wantCode:          http.StatusUnauthorized,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m := &metricServer{access: test.access, requireClientCert: test.requireClientCert}
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			req.TLS = test.tls
+			if test.token != "" {
+				req.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			rule, result := m.authorize(&httpResponseWriter{resp: httptest.NewRecorder()}, req)
+			if result.code != test.wantCode {
+				t.Fatalf("authorize returned code %d (%v), want %d", result.code, result.err, test.wantCode)
+			}
+			if test.wantCode != http.StatusOK {
+				if result.err == nil || rule != nil {
+					t.Errorf("authorize = %v, %v; want nil rule and an error", rule, result.err)
+				}
+				return
+			}
+			if full := rule.allSandboxes() && rule.metrics == nil; full != test.wantFull {
+				t.Errorf("got full access %t, want %t", full, test.wantFull)
+			}
+		})
+	}
+}
+
+// TestFilterSnapshot tests that metricServer.filterSnapshot applies both the
+// server-wide export filter and the client's metric rule.
+func TestFilterSnapshot(t *testing.T) {
+	list, err := parseAccessList("token:a\ntoken:b metrics=_packets$")
+	if err != nil {
+		t.Fatalf("parseAccessList failed: %v", err)
+	}
+	newSnapshot := func() *prometheus.Snapshot {
+		s := prometheus.NewSnapshot()
+		for _, name := range []string{"fs_opens", "netstack_dropped_packets", "netstack_nic_tx_bytes"} {
+			s.Add(prometheus.NewIntData(&prometheus.Metric{Name: name, Type: prometheus.TypeCounter}, 1))
+		}
+		return s
+	}
+	names := func(s *prometheus.Snapshot) string {
+		var names []string
+		for _, d := range s.Data {
+			names = append(names, d.Metric.Name)
+		}
+		return strings.Join(names, ",")
+	}
+	for _, test := range []struct {
+		name         string
+		exportFilter string
+		token        string
+		want         string
+	}{
+		{
+			name:  "no filter",
+			token: "a",
+			want:  "fs_opens,netstack_dropped_packets,netstack_nic_tx_bytes",
+		},
+		{
+			name:  "rule only",
+			token: "b",
+			want:  "netstack_dropped_packets",
+		},
+		{
+			name:         "export filter only",
+			exportFilter: "^netstack_",
+			token:        "a",
+			want:         "netstack_dropped_packets,netstack_nic_tx_bytes",
+		},
+		{
+			name:         "both",
+			exportFilter: "^fs_",
+			token:        "b",
+			want:         "",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m := &metricServer{access: list}
+			if test.exportFilter != "" {
+				m.exportFilter = regexp.MustCompile(test.exportFilter)
+			}
+			s := newSnapshot()
+			m.filterSnapshot(s, list.lookupToken(test.token))
+			if got := names(s); got != test.want {
+				t.Errorf("got metrics %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metricserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wilinz/gvisor/runsc/boot"
+	"github.com/wilinz/gvisor/runsc/sandbox"
+)
+
+const (
+	// sandboxHealthPath is the path prefix under which the health of a single sandbox is served,
+	// followed by the sandbox ID.
+	sandboxHealthPath = "/health/sandbox/"
+
+	// sandboxHealthTimeout is the maximum amount of time to wait for a sandbox to run its
+	// built-in health checks.
+	sandboxHealthTimeout = 30 * time.Second
+
+	// sandboxHealthProbeTimeout is the maximum amount of time to wait for a sandbox to run its
+	// health checks including the containers' health probes, which may each take up to a minute.
+	sandboxHealthProbeTimeout = 3 * time.Minute
+)
+
+// querySandboxHealth runs the health checks of the given sandbox, giving up when ctx is done.
+func querySandboxHealth(ctx context.Context, sand *sandbox.Sandbox, probe bool) (*boot.HealthStatus, error) {
+	type result struct {
+		status *boot.HealthStatus
+		err    error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		status, err := sand.Health(probe)
+		ch <- result{status, err}
+	}()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-ch:
+		return r.status, r.err
+	}
+}
+
+// serveSandboxHealth serves the health of a single sandbox, whose ID follows sandboxHealthPath in
+// the request path. The containers' health probes are also run if the "probe" query parameter is
+// true. The response is the JSON-encoded boot.HealthStatus, with status code 200 if the sandbox
+// is healthy and 503 otherwise.
+func (m *metricServer) serveSandboxHealth(w *httpResponseWriter, req *http.Request) httpResult {
+	rule, result := m.authorize(w, req)
+	if result.err != nil {
+		return result
+	}
+	sandboxID := strings.TrimPrefix(req.URL.Path, sandboxHealthPath)
+	if sandboxID == "" || strings.Contains(sandboxID, "/") {
+		return httpResult{http.StatusNotFound, errors.New("path not found")}
+	}
+	probe := false
+	if v := req.URL.Query().Get("probe"); v != "" {
+		var err error
+		if probe, err = strconv.ParseBool(v); err != nil {
+			return httpResult{http.StatusBadRequest, fmt.Errorf("invalid probe parameter %q", v)}
+		}
+	}
+
+	m.mu.Lock()
+	if m.shuttingDown {
+		m.mu.Unlock()
+		return httpResult{http.StatusServiceUnavailable, errors.New("server is shutting down")}
+	}
+	m.refreshSandboxesLocked()
+	var served *servedSandbox
+	for id, s := range m.sandboxes {
+		if id.SandboxID == sandboxID {
+			served = s
+			break
+		}
+	}
+	m.mu.Unlock()
+
+	// Do not distinguish between sandboxes that don't exist and sandboxes that the client may not
+	// access.
+	notFound := httpResult{http.StatusNotFound, fmt.Errorf("sandbox %q not found", sandboxID)}
+	if served == nil {
+		return notFound
+	}
+	sand, _, err := served.load()
+	if err != nil {
+		// The sandbox labels are not known, so only reveal the error to clients that may see all
+		// sandboxes.
+		if !rule.allSandboxes() {
+			return notFound
+		}
+		return httpResult{http.StatusServiceUnavailable, err}
+	}
+	if !rule.allowsSandbox(served.extraLabels) {
+		return notFound
+	}
+
+	timeout := sandboxHealthTimeout
+	if probe {
+		timeout = sandboxHealthProbeTimeout
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	defer cancel()
+	status, err := querySandboxHealth(ctx, sand, probe)
+	if err != nil {
+		return httpResult{http.StatusServiceUnavailable, err}
+	}
+	data, err := json.Marshal(status)
+	if err != nil {
+		return httpResult{http.StatusInternalServerError, err}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if status.Healthy {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(data)
+	return httpOK
+}
@@ -168,6 +168,10 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, conf *con
 	args := boot.CreateLinksAndRoutesArgs{
 		DisconnectOk: conf.NetDisconnectOk,
 	}
+	var xdpSockFDs map[int][]*os.File
+	if conf.XDP.Mode == config.XDPModeNS {
+		xdpSockFDs = createSocketsXDP(linkInterfaces(ifaces), createSocketXDP)
+	}
 	for _, iface := range ifaces {
 		if iface.Flags&net.FlagUp == 0 {
 			log.Infof("Skipping down interface: %+v", iface)
@@ -268,12 +272,8 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, conf *con
 			}
 		}
 
-		if conf.XDP.Mode == config.XDPModeNS {
-			xdpSockFDs, err := createSocketXDP(iface)
-			if err != nil {
-				return fmt.Errorf("failed to create XDP socket: %v", err)
-			}
-			args.FilePayload.Files = append(args.FilePayload.Files, xdpSockFDs...)
+		if files, ok := xdpSockFDs[iface.Index]; ok {
+			args.FilePayload.Files = append(args.FilePayload.Files, files...)
 			args.XDPLinks = append(args.XDPLinks, boot.XDPLink{
 				Name:              iface.Name,
 				InterfaceIndex:    iface.Index,
@@ -343,6 +343,46 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, conf *con
 	return nil
 }
 
+// linkInterfaces returns the interfaces in ifaces for which
+// createInterfacesAndRoutesFromNS creates a non-loopback link.
+func linkInterfaces(ifaces []net.Interface) []net.Interface {
+	var linkIfaces []net.Interface
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		if addrs, err := iface.Addrs(); err == nil && len(addrs) == 0 {
+			continue
+		}
+		linkIfaces = append(linkIfaces, iface)
+	}
+	return linkIfaces
+}
+
+// createSocketsXDP uses create to set up AF_XDP sockets for each interface in
+// ifaces, and returns the resulting files by interface index. The sentry can't
+// mix XDP and fdbased links, so if any interface's socket can't be set up,
+// e.g. because the kernel lacks AF_XDP support, createSocketsXDP releases the
+// sockets that were set up and returns nil, and all interfaces use AF_PACKET
+// sockets instead.
+func createSocketsXDP(ifaces []net.Interface, create func(net.Interface) ([]*os.File, error)) map[int][]*os.File {
+	sockFDs := make(map[int][]*os.File)
+	for _, iface := range ifaces {
+		files, err := create(iface)
+		if err != nil {
+			log.Warningf("Failed to create XDP socket for interface %q, falling back to AF_PACKET: %v", iface.Name, err)
+			for _, files := range sockFDs {
+				for _, f := range files {
+					f.Close()
+				}
+			}
+			return nil
+		}
+		sockFDs[iface.Index] = files
+	}
+	return sockFDs
+}
+
 func initPluginStack(conn *urpc.Client, pid int, conf *config.Config) error {
 	pluginStack := plugin.GetPluginStack()
 	if pluginStack == nil {
@@ -0,0 +1,102 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandbox
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"testing"
+)
+
+func TestCreateSocketsXDP(t *testing.T) {
+	ifaces := []net.Interface{
+		{Index: 2, Name: "eth0"},
+		{Index: 3, Name: "eth1"},
+		{Index: 4, Name: "eth2"},
+	}
+	for _, test := range []struct {
+		name string
+		// failIndex is the index of the interface for which creating a socket
+		// fails, or 0 if none fail.
+		failIndex int
+		wantXDP   bool
+	}{
+		{
+			name:    "all succeed",
+			wantXDP: true,
+		},
+		{
+			name:      "first fails",
+			failIndex: 2,
+		},
+		{
+			name:      "last fails",
+			failIndex: 4,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var created []*os.File
+			create := func(iface net.Interface) ([]*os.File, error) {
+				if iface.Index == test.failIndex {
+					return nil, fmt.Errorf("injected failure")
+				}
+				r, w, err := os.Pipe()
+				if err != nil {
+					t.Fatalf("os.Pipe: %v", err)
+				}
+				created = append(created, r, w)
+				return []*os.File{r, w}, nil
+			}
+			got := createSocketsXDP(ifaces, create)
+			t.Cleanup(func() {
+				for _, f := range created {
+					f.Close()
+				}
+			})
+
+			if !test.wantXDP {
+				if got != nil {
+					t.Errorf("createSocketsXDP: got %v, want nil", got)
+				}
+				// Sockets created before the failure must be released.
+				for _, f := range created {
+					if err := f.Close(); err == nil {
+						t.Errorf("file %s was not closed", f.Name())
+					}
+				}
+				return
+			}
+			if len(got) != len(ifaces) {
+				t.Fatalf("createSocketsXDP: got files for %d interfaces, want %d", len(got), len(ifaces))
+			}
+			for _, iface := range ifaces {
+				if len(got[iface.Index]) != 2 {
+					t.Errorf("interface %q: got %d files, want 2", iface.Name, len(got[iface.Index]))
+				}
+			}
+		})
+	}
+}
+
+func TestLinkInterfaces(t *testing.T) {
+	ifaces := []net.Interface{
+		{Index: 1, Name: "lo", Flags: net.FlagUp | net.FlagLoopback},
+		{Index: 2, Name: "down"},
+	}
+	if got := linkInterfaces(ifaces); len(got) != 0 {
+		t.Errorf("linkInterfaces: got %+v, want none", got)
+	}
+}
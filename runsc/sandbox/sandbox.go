@@ -336,6 +336,13 @@ func New(conf *config.Config, args *Args) (*Sandbox, error) {
 		}
 	}
 
+	if len(conf.MACProfile) > 0 {
+		// Validate the profile early to report errors to the caller.
+		if _, err := boot.LoadMACProfile(conf.MACProfile); err != nil {
+			return nil, fmt.Errorf("loading MAC profile: %w", err)
+		}
+	}
+
 	// Create pipe to synchronize when sandbox process has been booted.
 	clientSyncFile, sandboxSyncFile, err := os.Pipe()
 	if err != nil {
@@ -633,6 +640,68 @@ func (s *Sandbox) DeleteTraceSession(name string) error {
 	return nil
 }
 
+// SetNetworkPolicy installs a network policy restricting the traffic that may
+// leave the sandbox. A nil policy removes the current policy.
+func (s *Sandbox) SetNetworkPolicy(policy *boot.NetworkPolicy) error {
+	log.Debugf("Setting network policy in sandbox %q", s.ID)
+	if err := s.call(boot.NetworkSetNetworkPolicy, &boot.SetNetworkPolicyArgs{Policy: policy}, nil); err != nil {
+		return fmt.Errorf("setting network policy: %w", err)
+	}
+	return nil
+}
+
+// StartPCAP starts capturing the packets of the sandbox's network interfaces
+// to f in pcapng format. Packets longer than snapLen bytes are truncated.
+func (s *Sandbox) StartPCAP(f *os.File, snapLen uint32) error {
+	log.Debugf("Starting packet capture in sandbox %q", s.ID)
+	args := boot.StartPCAPArgs{
+		FilePayload: urpc.FilePayload{Files: []*os.File{f}},
+		SnapLen:     snapLen,
+	}
+	if err := s.call(boot.NetworkStartPCAP, &args, nil); err != nil {
+		return fmt.Errorf("starting packet capture: %w", err)
+	}
+	return nil
+}
+
+// StopPCAP stops the packet capture started by StartPCAP.
+func (s *Sandbox) StopPCAP() error {
+	log.Debugf("Stopping packet capture in sandbox %q", s.ID)
+	if err := s.call(boot.NetworkStopPCAP, nil, nil); err != nil {
+		return fmt.Errorf("stopping packet capture: %w", err)
+	}
+	return nil
+}
+
+// PathMTUCache returns the path MTUs learned by the sandbox's network stack.
+func (s *Sandbox) PathMTUCache() ([]boot.PathMTUEntry, error) {
+	log.Debugf("Getting path MTU cache in sandbox %q", s.ID)
+	var entries []boot.PathMTUEntry
+	if err := s.call(boot.NetworkPathMTUCache, nil, &entries); err != nil {
+		return nil, fmt.Errorf("getting path MTU cache: %w", err)
+	}
+	return entries, nil
+}
+
+// FlushPathMTUCache flushes the path MTU cache of the sandbox's network stack.
+func (s *Sandbox) FlushPathMTUCache() error {
+	log.Debugf("Flushing path MTU cache in sandbox %q", s.ID)
+	if err := s.call(boot.NetworkFlushPathMTUCache, nil, nil); err != nil {
+		return fmt.Errorf("flushing path MTU cache: %w", err)
+	}
+	return nil
+}
+
+// Neighbors returns the neighbor tables of the sandbox's network interfaces.
+func (s *Sandbox) Neighbors() ([]boot.NeighborEntry, error) {
+	log.Debugf("Getting neighbors in sandbox %q", s.ID)
+	var entries []boot.NeighborEntry
+	if err := s.call(boot.NetworkNeighbors, nil, &entries); err != nil {
+		return nil, fmt.Errorf("getting neighbors: %w", err)
+	}
+	return entries, nil
+}
+
 // ListTraceSessions lists all trace sessions.
 func (s *Sandbox) ListTraceSessions() ([]seccheck.SessionConfig, error) {
 	log.Debugf("Listing trace sessions in sandbox %q", s.ID)
@@ -927,6 +996,12 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 		return err
 	}
 	donations.DonateAndClose("sink-fds", args.SinkFiles...)
+	if err := donations.OpenAndDonate("gofer-content-cache-fd", conf.GoferContentCache, os.O_RDONLY|unix.O_DIRECTORY); err != nil {
+		return err
+	}
+	if err := donations.OpenAndDonate("mac-profile-fd", conf.MACProfile, os.O_RDONLY); err != nil {
+		return err
+	}
 
 	if len(conf.TestOnlyAutosaveImagePath) != 0 {
 		files, err := createSaveFiles(conf.TestOnlyAutosaveImagePath, false, statefile.CompressionLevelFlateBestSpeed)
@@ -1336,6 +1411,21 @@ func (s *Sandbox) WaitPID(cid string, pid int32) (unix.WaitStatus, error) {
 	return ws, nil
 }
 
+// WaitPGID waits for all processes of process group 'pgid' in the container's
+// sandbox and returns the WaitStatus of the process group leader.
+func (s *Sandbox) WaitPGID(cid string, pgid int32) (unix.WaitStatus, error) {
+	log.Debugf("Waiting for process group %d in sandbox %q", pgid, s.ID)
+	var ws unix.WaitStatus
+	args := &boot.WaitPIDArgs{
+		PGID: pgid,
+		CID:  cid,
+	}
+	if err := s.call(boot.ContMgrWaitPID, args, &ws); err != nil {
+		return ws, fmt.Errorf("waiting on process group %d in sandbox %q: %w", pgid, s.ID, err)
+	}
+	return ws, nil
+}
+
 // WaitCheckpoint waits for the Kernel to have been successfully checkpointed.
 func (s *Sandbox) WaitCheckpoint() error {
 	log.Debugf("Waiting for checkpoint to complete in sandbox %q", s.ID)
@@ -1418,6 +1508,23 @@ func (s *Sandbox) SignalProcess(cid string, pid int32, sig unix.Signal, fgProces
 	return nil
 }
 
+// SetWinsize sets the window size of the TTY attached to a particular process
+// in the container, and sends SIGWINCH to its foreground process group. If pid
+// is 0, the TTY of the container init process is used.
+func (s *Sandbox) SetWinsize(cid string, pid int32, ws *linux.Winsize) error {
+	log.Debugf("SetWinsize sandbox %q", s.ID)
+
+	args := boot.SetWinsizeArgs{
+		CID:     cid,
+		PID:     pid,
+		Winsize: *ws,
+	}
+	if err := s.call(boot.ContMgrSetWinsize, &args, nil); err != nil {
+		return fmt.Errorf("setting window size of container %q PID %d: %w", cid, pid, err)
+	}
+	return nil
+}
+
 // Checkpoint sends the checkpoint call for a container in the sandbox.
 // The statefile will be written to f.
 func (s *Sandbox) Checkpoint(cid string, imagePath string, direct bool, sfOpts statefile.Options, mfOpts pgalloc.SaveOpts) error {
@@ -1519,6 +1626,17 @@ func (s *Sandbox) Usage(Full bool) (control.MemoryUsage, error) {
 	return m, nil
 }
 
+// Reclaim asks the sandbox to return as much memory as possible to the host.
+func (s *Sandbox) Reclaim(keepCaches bool) (control.UsageReclaimOutput, error) {
+	log.Debugf("Reclaim sandbox %q", s.ID)
+	opts := control.UsageReclaimOpts{KeepCaches: keepCaches}
+	var out control.UsageReclaimOutput
+	if err := s.call(boot.UsageReclaim, &opts, &out); err != nil {
+		return control.UsageReclaimOutput{}, fmt.Errorf("reclaiming memory: %w", err)
+	}
+	return out, nil
+}
+
 // UsageFD sends the usagefd call for a container in the sandbox.
 func (s *Sandbox) UsageFD() (*control.MemoryUsageRecord, error) {
 	log.Debugf("Usage sandbox %q", s.ID)
@@ -1781,6 +1899,38 @@ func checkBinaryPermissions(conf *config.Config) error {
 	return nil
 }
 
+// CgroupsList lists the cgroup hierarchies in the sandbox and their cgroups.
+// If stats is true, per-cgroup stats are included.
+func (s *Sandbox) CgroupsList(stats bool) (*control.CgroupsListResult, error) {
+	log.Debugf("CgroupsList sandbox %q", s.ID)
+	args := control.CgroupsListArgs{
+		Stats: stats,
+	}
+	var out control.CgroupsListResult
+	if err := s.call(boot.CgroupsList, &args, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CgroupsReadControlFiles reads a batch of cgroupfs control files in the
+// sandbox. The returned results are in the same order as files.
+func (s *Sandbox) CgroupsReadControlFiles(files []control.CgroupControlFile) ([]control.CgroupsResult, error) {
+	log.Debugf("CgroupsReadControlFiles sandbox %q", s.ID)
+	var args control.CgroupsReadArgs
+	for _, file := range files {
+		args.Args = append(args.Args, control.CgroupsReadArg{File: file})
+	}
+	var out control.CgroupsResults
+	if err := s.call(boot.CgroupsReadControlFiles, &args, &out); err != nil {
+		return nil, err
+	}
+	if len(out.Results) != len(files) {
+		return nil, fmt.Errorf("expected %d results, got %d, raw: %+v", len(files), len(out.Results), out)
+	}
+	return out.Results, nil
+}
+
 // CgroupsReadControlFile reads a single cgroupfs control file in the sandbox.
 func (s *Sandbox) CgroupsReadControlFile(file control.CgroupControlFile) (string, error) {
 	log.Debugf("CgroupsReadControlFiles sandbox %q", s.ID)
@@ -1954,6 +2104,18 @@ func (s *Sandbox) ContainerRuntimeState(cid string) (boot.ContainerRuntimeState,
 	return state, nil
 }
 
+// Health runs the sandbox health checks, including the containers' health
+// probes if probe is true.
+func (s *Sandbox) Health(probe bool) (*boot.HealthStatus, error) {
+	log.Debugf("Health, sandbox: %q, probe: %t", s.ID, probe)
+	args := boot.HealthArgs{Probe: probe}
+	var status boot.HealthStatus
+	if err := s.call(boot.ContMgrHealth, &args, &status); err != nil {
+		return nil, fmt.Errorf("checking sandbox health: %w", err)
+	}
+	return &status, nil
+}
+
 func setCloExeOnAllFDs() error {
 	f, err := os.Open("/proc/self/fd")
 	if err != nil {
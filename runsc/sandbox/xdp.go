@@ -28,6 +28,7 @@ import (
 	"github.com/cilium/ebpf/link"
 	"github.com/vishvananda/netlink"
 	"golang.org/x/sys/unix"
+	"github.com/wilinz/gvisor/pkg/cleanup"
 	"github.com/wilinz/gvisor/pkg/log"
 	"github.com/wilinz/gvisor/pkg/urpc"
 	"github.com/wilinz/gvisor/pkg/xdp"
@@ -238,6 +239,10 @@ func prepareRedirectInterfaceArgs(bind boot.BindOpt, conf *config.Config) (boot.
 	return args, netIface, nil
 }
 
+// createSocketXDP creates an AF_XDP socket for iface and redirects the
+// device's packets to it. On failure, the device is left untouched so that the
+// caller can fall back to an AF_PACKET socket. Closing all of the returned
+// files also detaches the XDP program from the device.
 func createSocketXDP(iface net.Interface) ([]*os.File, error) {
 	// Create an XDP socket. The sentry will mmap memory for the various
 	// rings and bind to the device.
@@ -245,6 +250,8 @@ func createSocketXDP(iface net.Interface) ([]*os.File, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unable to create AF_XDP socket: %v", err)
 	}
+	cu := cleanup.Make(func() { unix.Close(fd) })
+	defer cu.Clean()
 
 	// We also need to, before dropping privileges, attach a program to the
 	// device and insert our socket into its map.
@@ -262,6 +269,10 @@ func createSocketXDP(iface net.Interface) ([]*os.File, error) {
 	if err := spec.LoadAndAssign(&objects, nil); err != nil {
 		return nil, fmt.Errorf("failed to load program: %v", err)
 	}
+	// The returned files hold duplicates of the program, map and link FDs,
+	// so the originals can always be closed.
+	defer objects.Program.Close()
+	defer objects.SockMap.Close()
 
 	rawLink, err := link.AttachRawLink(link.RawLinkOptions{
 		Program: objects.Program,
@@ -277,6 +288,8 @@ func createSocketXDP(iface net.Interface) ([]*os.File, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to attach BPF program: %v", err)
 	}
+	// Closing the link detaches the program from the device.
+	defer rawLink.Close()
 
 	// Insert our AF_XDP socket into the BPF map that dictates where
 	// packets are redirected to.
@@ -294,15 +307,19 @@ func createSocketXDP(iface net.Interface) ([]*os.File, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to dup BPF program: %v", err)
 	}
+	cu.Add(func() { unix.Close(progFD) })
 	sockMapFD, err := unix.Dup(objects.SockMap.FD())
 	if err != nil {
 		return nil, fmt.Errorf("failed to dup BPF map: %v", err)
 	}
+	cu.Add(func() { unix.Close(sockMapFD) })
 	linkFD, err := unix.Dup(rawLink.FD())
 	if err != nil {
 		return nil, fmt.Errorf("failed to dup BPF link: %v", err)
 	}
 
+	cu.Release()
+
 	return []*os.File{
 		os.NewFile(uintptr(fd), "xdp-fd"),            // The socket.
 		os.NewFile(uintptr(progFD), "program-fd"),    // The XDP program.
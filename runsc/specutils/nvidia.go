@@ -15,7 +15,13 @@
 package specutils
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -40,6 +46,9 @@ const (
 	requireCudaEnv = "NVIDIA_REQUIRE_CUDA"
 	// AnnotationNVProxy enables nvproxy.
 	AnnotationNVProxy = "dev.gvisor.internal.nvproxy"
+	// NvidiaDriverProcPath is the procfs directory in which the NVIDIA driver
+	// describes itself and the devices it manages.
+	NvidiaDriverProcPath = "/proc/driver/nvidia"
 )
 
 // NVProxyEnabled checks both the nvproxy annotation and conf.NVProxy to see if nvproxy is enabled.
@@ -219,3 +228,103 @@ func IsLegacyCudaImage(spec *specs.Spec) bool {
 	requireCuda, _ := EnvVar(spec.Process.Env, requireCudaEnv)
 	return len(cudaVersion) > 0 && len(requireCuda) == 0
 }
+
+// isExposedNvidiaDriverFile returns true if the file at the given
+// slash-separated path relative to NvidiaDriverProcPath is exposed to
+// containers:
+//   - version describes the driver version.
+//   - gpus/<bus id>/information describes each GPU.
+//   - capabilities/... describes the /dev/nvidia-caps device files granting
+//     access to MIG configuration, monitoring and instances.
+func isExposedNvidiaDriverFile(name string) bool {
+	if name == "version" || strings.HasPrefix(name, "capabilities/") {
+		return true
+	}
+	ok, _ := path.Match("gpus/*/information", name)
+	return ok
+}
+
+// ReadNvidiaDriverFiles returns the contents of the files under dir, usually
+// NvidiaDriverProcPath, that are exposed to containers, keyed by
+// slash-separated paths relative to dir. It returns an empty map if dir
+// doesn't exist, e.g. because the NVIDIA driver isn't loaded.
+func ReadNvidiaDriverFiles(dir string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !isExposedNvidiaDriverFile(rel) {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[rel] = string(data)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading %q: %w", dir, err)
+	}
+	return files, nil
+}
+
+// nvidiaGPUInformationMinor returns the minor number of the /dev/nvidia#
+// device file described by the contents of a gpus/<bus id>/information file.
+func nvidiaGPUInformationMinor(information string) (uint32, bool) {
+	for _, line := range strings.Split(information, "\n") {
+		value, ok := strings.CutPrefix(line, "Device Minor:")
+		if !ok {
+			continue
+		}
+		minor, err := strconv.ParseUint(strings.TrimSpace(value), 10, 32)
+		if err != nil {
+			return 0, false
+		}
+		return uint32(minor), true
+	}
+	return 0, false
+}
+
+// FilterNvidiaGPUFiles returns a copy of files, as returned by
+// ReadNvidiaDriverFiles, without the gpus/<bus id>/ files of GPUs whose
+// /dev/nvidia# device file minor number isn't in minors.
+func FilterNvidiaGPUFiles(files map[string]string, minors []uint32) map[string]string {
+	visible := make(map[string]bool)
+	for name, data := range files {
+		busID, ok := strings.CutPrefix(name, "gpus/")
+		if !ok {
+			continue
+		}
+		busID, file, _ := strings.Cut(busID, "/")
+		if file != "information" {
+			continue
+		}
+		if minor, ok := nvidiaGPUInformationMinor(data); ok && slices.Contains(minors, minor) {
+			visible[busID] = true
+		}
+	}
+	filtered := make(map[string]string)
+	for name, data := range files {
+		if busID, ok := strings.CutPrefix(name, "gpus/"); ok {
+			busID, _, _ = strings.Cut(busID, "/")
+			if !visible[busID] {
+				continue
+			}
+		}
+		filtered[name] = data
+	}
+	return filtered
+}
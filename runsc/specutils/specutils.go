@@ -601,6 +601,28 @@ func TPUFunctionalityRequested(spec *specs.Spec, conf *config.Config) bool {
 	return false
 }
 
+// UverbsFunctionalityRequested returns true if the container should have
+// access to RDMA verbs functionality through dev.
+func UverbsFunctionalityRequested(dev *specs.LinuxDevice) bool {
+	return strings.HasPrefix(dev.Path, "/dev/infiniband/uverbs")
+}
+
+// RDMAFunctionalityRequested returns true if the container should have access
+// to RDMA verbs functionality.
+func RDMAFunctionalityRequested(spec *specs.Spec, conf *config.Config) bool {
+	if !conf.RDMAProxy {
+		return false
+	}
+	if spec.Linux != nil {
+		for _, dev := range spec.Linux.Devices {
+			if UverbsFunctionalityRequested(&dev) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // SafeSetupAndMount creates the mount point and calls Mount with the given
 // flags. procPath is the path to procfs. If it is "", procfs is assumed to be
 // mounted at /proc.
@@ -16,7 +16,10 @@ package specutils
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -488,3 +491,92 @@ func TestNvidiaDriverCapabilities(t *testing.T) {
 		})
 	}
 }
+
+func TestReadNvidiaDriverFiles(t *testing.T) {
+	dir := t.TempDir()
+	want := map[string]string{
+		"version":                              "NVRM version: NVIDIA UNIX x86_64 Kernel Module  550.54.15\n",
+		"gpus/0000:00:04.0/information":        "Model: \t\t NVIDIA L4\nDevice Minor: \t 0\n",
+		"capabilities/mig/config":              "DeviceFileMinor: 1\n",
+		"capabilities/gpu0/mig/gi1/access":     "DeviceFileMinor: 12\n",
+		"capabilities/gpu0/mig/gi1/ci0/access": "DeviceFileMinor: 13\n",
+	}
+	files := map[string]string{
+		"params":                       "ResmanDebugLevel: 4294967295\n",
+		"gpus/0000:00:04.0/registry":   "Binary: \"\"\n",
+		"patches/README":               "\n",
+		"warnings/README":              "\n",
+		"capabilities/mig/monitor":     "DeviceFileMinor: 2\n",
+		"capabilities/gpu0/mig/config": "DeviceFileMinor: 3\n",
+	}
+	for name, data := range want {
+		files[name] = data
+	}
+	want["capabilities/mig/monitor"] = files["capabilities/mig/monitor"]
+	want["capabilities/gpu0/mig/config"] = files["capabilities/gpu0/mig/config"]
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("os.MkdirAll(%q) failed, err: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0444); err != nil {
+			t.Fatalf("os.WriteFile(%q) failed, err: %v", path, err)
+		}
+	}
+	got, err := ReadNvidiaDriverFiles(dir)
+	if err != nil {
+		t.Fatalf("ReadNvidiaDriverFiles(%q) failed, err: %v", dir, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadNvidiaDriverFiles(%q) got: %v, want: %v", dir, got, want)
+	}
+
+	missing := filepath.Join(dir, "missing")
+	got, err = ReadNvidiaDriverFiles(missing)
+	if err != nil {
+		t.Fatalf("ReadNvidiaDriverFiles(%q) failed, err: %v", missing, err)
+	}
+	if len(got) != 0 {
+		t.Errorf("ReadNvidiaDriverFiles(%q) got: %v, want empty", missing, got)
+	}
+}
+
+func TestFilterNvidiaGPUFiles(t *testing.T) {
+	files := map[string]string{
+		"version":                       "NVRM version: NVIDIA UNIX x86_64 Kernel Module  550.54.15\n",
+		"gpus/0000:00:04.0/information": "Model: \t\t NVIDIA L4\nDevice Minor: \t 0\n",
+		"gpus/0000:00:05.0/information": "Model: \t\t NVIDIA L4\nDevice Minor: \t 1\n",
+		"gpus/0000:00:06.0/information": "Model: \t\t NVIDIA L4\n",
+		"capabilities/mig/config":       "DeviceFileMinor: 1\n",
+	}
+	for _, tc := range []struct {
+		name   string
+		minors []uint32
+		want   []string
+	}{
+		{
+			name: "none",
+			want: []string{"version", "capabilities/mig/config"},
+		},
+		{
+			name:   "one",
+			minors: []uint32{1},
+			want:   []string{"version", "gpus/0000:00:05.0/information", "capabilities/mig/config"},
+		},
+		{
+			name:   "all",
+			minors: []uint32{0, 1},
+			want:   []string{"version", "gpus/0000:00:04.0/information", "gpus/0000:00:05.0/information", "capabilities/mig/config"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			want := make(map[string]string)
+			for _, name := range tc.want {
+				want[name] = files[name]
+			}
+			if got := FilterNvidiaGPUFiles(files, tc.minors); !reflect.DeepEqual(got, want) {
+				t.Errorf("FilterNvidiaGPUFiles(%v) got: %v, want: %v", tc.minors, got, want)
+			}
+		})
+	}
+}
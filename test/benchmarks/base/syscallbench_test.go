@@ -51,6 +51,13 @@ func BenchmarkSyscallbench(b *testing.B) {
 			},
 			syscallArg: 1,
 		},
+		{
+			param: tools.Parameter{
+				Name:  "syscall",
+				Value: "write",
+			},
+			syscallArg: 2,
+		},
 	} {
 		name, err := tools.ParametersToName(tc.param)
 		if err != nil {
@@ -0,0 +1,91 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	RegisterTestCase(&ConnTrackList{})
+}
+
+// conntrackCmd runs conntrack with the given args and returns its output.
+func conntrackCmd(ipv6 bool, args ...string) (string, error) {
+	family := "ipv4"
+	if ipv6 {
+		family = "ipv6"
+	}
+	args = append([]string{"-f", family}, args...)
+	out, err := exec.Command("conntrack", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("error running conntrack with args %v\nerror: %v\noutput: %s", args, err, string(out))
+	}
+	return string(out), nil
+}
+
+// ConnTrackList tests that connections tracked by netstack can be listed and
+// deleted with conntrack.
+type ConnTrackList struct{ baseCase }
+
+var _ TestCase = (*ConnTrackList)(nil)
+
+// Name implements TestCase.Name.
+func (*ConnTrackList) Name() string {
+	return "ConnTrackList"
+}
+
+// ContainerAction implements TestCase.ContainerAction.
+func (*ConnTrackList) ContainerAction(ctx context.Context, ip net.IP, ipv6 bool) error {
+	// Connection tracking is enabled by the first iptables rule.
+	if err := filterTable(ipv6, "-A", "INPUT", "-p", "udp", "--dport", strconv.Itoa(dropPort), "-j", "DROP"); err != nil {
+		return err
+	}
+
+	if err := listenTCP(ctx, acceptPort, ipv6); err != nil {
+		return fmt.Errorf("failed to establish a connection %v", err)
+	}
+
+	dport := fmt.Sprintf("dport=%d", acceptPort)
+	out, err := conntrackCmd(ipv6, "-L", "-p", "tcp")
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(out, dport) || !strings.Contains(out, "packets=") {
+		return fmt.Errorf("connection to port %d isn't listed with counters:\n%s", acceptPort, out)
+	}
+
+	if _, err := conntrackCmd(ipv6, "-F"); err != nil {
+		return err
+	}
+	out, err = conntrackCmd(ipv6, "-L", "-p", "tcp")
+	if err != nil {
+		return err
+	}
+	if strings.Contains(out, dport) {
+		return fmt.Errorf("connection to port %d is still listed after flushing:\n%s", acceptPort, out)
+	}
+	return nil
+}
+
+// LocalAction implements TestCase.LocalAction.
+func (*ConnTrackList) LocalAction(ctx context.Context, ip net.IP, ipv6 bool) error {
+	return connectTCP(ctx, ip, acceptPort, ipv6)
+}
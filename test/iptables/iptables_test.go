@@ -499,6 +499,14 @@ func TestNATPostSNATTCP(t *testing.T) {
 	singleTest(t, &NATPostSNATTCP{})
 }
 
+func TestNATPostMasqueradeUDP(t *testing.T) {
+	singleTest(t, &NATPostMasqueradeUDP{})
+}
+
+func TestNATPostMasqueradeTCP(t *testing.T) {
+	singleTest(t, &NATPostMasqueradeTCP{})
+}
+
 func TestFilterInputDropAllSrcPorts(t *testing.T) {
 	singleTest(t, &FilterInputDropAllSrcPorts{})
 }
@@ -517,3 +525,23 @@ func TestFilterOutputDropSrcPorts(t *testing.T) {
 func TestFilterOutputAcceptInvertPorts(t *testing.T) {
 	singleTest(t, &FilterOutputAcceptInvertPorts{})
 }
+
+func TestNFTablesInputDropUDP(t *testing.T) {
+	singleTest(t, &NFTablesInputDropUDP{})
+}
+
+func TestNFTablesInputDropOnlyUDP(t *testing.T) {
+	singleTest(t, &NFTablesInputDropOnlyUDP{})
+}
+
+func TestNFTablesInputDefaultPolicyDrop(t *testing.T) {
+	singleTest(t, &NFTablesInputDefaultPolicyDrop{})
+}
+
+func TestNFTablesOutputDropTCP(t *testing.T) {
+	singleTest(t, &NFTablesOutputDropTCP{})
+}
+
+func TestConnTrackList(t *testing.T) {
+	singleTest(t, &ConnTrackList{})
+}
@@ -50,6 +50,25 @@ func tableCmd(ipv6 bool, table string, args []string) error {
 	return nil
 }
 
+// nft runs nft with the given args.
+func nft(args ...string) error {
+	cmd := exec.Command("nft", args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error running nft with args %v\nerror: %v\noutput: %s", args, err, string(out))
+	}
+	return nil
+}
+
+// nftRules is like nft, but runs multiple nft commands.
+func nftRules(argsList [][]string) error {
+	for _, args := range argsList {
+		if err := nft(args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // filterTableRules is like filterTable, but runs multiple iptables commands.
 func filterTableRules(ipv6 bool, argsList [][]string) error {
 	return tableRules(ipv6, "filter", argsList)
@@ -53,6 +53,8 @@ func init() {
 	RegisterTestCase(&NATPostSNATUDP{withPort: true})
 	RegisterTestCase(&NATPostSNATTCP{})
 	RegisterTestCase(&NATPostSNATTCP{withPort: true})
+	RegisterTestCase(&NATPostMasqueradeUDP{})
+	RegisterTestCase(&NATPostMasqueradeTCP{})
 	RegisterTestCase(&NATOutDNAT{})
 	RegisterTestCase(&NATOutDNATAddrOnly{})
 	RegisterTestCase(&NATOutDNATPortOnly{})
@@ -1071,6 +1073,72 @@ func (t *NATPostSNATTCP) LocalAction(ctx context.Context, ip net.IP, ipv6 bool)
 	return nil
 }
 
+// NATPostMasqueradeUDP tests that UDP packets are sent from the address of the
+// outgoing interface by a MASQUERADE rule matching all protocols.
+type NATPostMasqueradeUDP struct{ localCase }
+
+var _ TestCase = (*NATPostMasqueradeUDP)(nil)
+
+// Name implements TestCase.Name.
+func (*NATPostMasqueradeUDP) Name() string {
+	return "NATPostMasqueradeUDP"
+}
+
+// ContainerAction implements TestCase.ContainerAction.
+func (*NATPostMasqueradeUDP) ContainerAction(ctx context.Context, ip net.IP, ipv6 bool) error {
+	if err := natTable(ipv6, "-A", "POSTROUTING", "-j", "MASQUERADE"); err != nil {
+		return err
+	}
+	return sendUDPLoop(ctx, ip, acceptPort, ipv6)
+}
+
+// LocalAction implements TestCase.LocalAction.
+func (*NATPostMasqueradeUDP) LocalAction(ctx context.Context, ip net.IP, ipv6 bool) error {
+	remote, err := listenUDPFrom(ctx, acceptPort, ipv6)
+	if err != nil {
+		return err
+	}
+	if got, want := remote.IP, ip; !got.Equal(want) {
+		return fmt.Errorf("got remote address = %s, want = %s", got, want)
+	}
+	return nil
+}
+
+// NATPostMasqueradeTCP tests that TCP connections are made from the address of
+// the outgoing interface by a MASQUERADE rule.
+type NATPostMasqueradeTCP struct{ localCase }
+
+var _ TestCase = (*NATPostMasqueradeTCP)(nil)
+
+// Name implements TestCase.Name.
+func (*NATPostMasqueradeTCP) Name() string {
+	return "NATPostMasqueradeTCP"
+}
+
+// ContainerAction implements TestCase.ContainerAction.
+func (*NATPostMasqueradeTCP) ContainerAction(ctx context.Context, ip net.IP, ipv6 bool) error {
+	if err := natTable(ipv6, "-A", "POSTROUTING", "-p", "tcp", "-j", "MASQUERADE"); err != nil {
+		return err
+	}
+	return connectTCP(ctx, ip, acceptPort, ipv6)
+}
+
+// LocalAction implements TestCase.LocalAction.
+func (*NATPostMasqueradeTCP) LocalAction(ctx context.Context, ip net.IP, ipv6 bool) error {
+	remote, err := listenTCPFrom(ctx, acceptPort, ipv6)
+	if err != nil {
+		return err
+	}
+	host, _, err := net.SplitHostPort(remote.String())
+	if err != nil {
+		return err
+	}
+	if got, want := host, ip.String(); got != want {
+		return fmt.Errorf("got remote address = %s, want = %s", got, want)
+	}
+	return nil
+}
+
 // NATOutDNAT tests that the source port/IP in the packets are modified as
 // expected. It tests the latest-implemented revision of the DNAT target.
 type NATOutDNAT struct{ containerCase }
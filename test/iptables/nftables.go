@@ -0,0 +1,192 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+func init() {
+	RegisterTestCase(&NFTablesInputDropUDP{})
+	RegisterTestCase(&NFTablesInputDropOnlyUDP{})
+	RegisterTestCase(&NFTablesInputDefaultPolicyDrop{})
+	RegisterTestCase(&NFTablesOutputDropTCP{})
+}
+
+// nftInputChain creates an inet table with an input base chain with the given
+// policy.
+func nftInputChain(policy string) error {
+	return nftRules([][]string{
+		{"add", "table", "inet", "filter"},
+		{"add", "chain", "inet", "filter", "input", fmt.Sprintf("{ type filter hook input priority 0; policy %s; }", policy)},
+	})
+}
+
+// NFTablesInputDropUDP tests that an nftables rule can drop UDP traffic.
+type NFTablesInputDropUDP struct{ containerCase }
+
+var _ TestCase = (*NFTablesInputDropUDP)(nil)
+
+// Name implements TestCase.Name.
+func (*NFTablesInputDropUDP) Name() string {
+	return "NFTablesInputDropUDP"
+}
+
+// ContainerAction implements TestCase.ContainerAction.
+func (*NFTablesInputDropUDP) ContainerAction(ctx context.Context, ip net.IP, ipv6 bool) error {
+	if err := nftInputChain("accept"); err != nil {
+		return err
+	}
+	if err := nft("add", "rule", "inet", "filter", "input", "meta", "l4proto", "udp", "drop"); err != nil {
+		return err
+	}
+
+	// Listen for UDP packets on dropPort.
+	timedCtx, cancel := context.WithTimeout(ctx, NegativeTimeout)
+	defer cancel()
+	if err := listenUDP(timedCtx, dropPort, ipv6); err == nil {
+		return fmt.Errorf("packets on port %d should have been dropped, but got a packet", dropPort)
+	} else if !errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("error reading: %v", err)
+	}
+
+	// At this point we know that reading timed out and never received a
+	// packet.
+	return nil
+}
+
+// LocalAction implements TestCase.LocalAction.
+func (*NFTablesInputDropUDP) LocalAction(ctx context.Context, ip net.IP, ipv6 bool) error {
+	return sendUDPLoop(ctx, ip, dropPort, ipv6)
+}
+
+// NFTablesInputDropOnlyUDP tests that an nftables rule dropping UDP traffic
+// doesn't affect TCP traffic.
+type NFTablesInputDropOnlyUDP struct{ baseCase }
+
+var _ TestCase = (*NFTablesInputDropOnlyUDP)(nil)
+
+// Name implements TestCase.Name.
+func (*NFTablesInputDropOnlyUDP) Name() string {
+	return "NFTablesInputDropOnlyUDP"
+}
+
+// ContainerAction implements TestCase.ContainerAction.
+func (*NFTablesInputDropOnlyUDP) ContainerAction(ctx context.Context, ip net.IP, ipv6 bool) error {
+	if err := nftInputChain("accept"); err != nil {
+		return err
+	}
+	if err := nft("add", "rule", "inet", "filter", "input", "meta", "l4proto", "udp", "drop"); err != nil {
+		return err
+	}
+
+	// Listen for a TCP connection, which should be allowed.
+	if err := listenTCP(ctx, acceptPort, ipv6); err != nil {
+		return fmt.Errorf("failed to establish a connection %v", err)
+	}
+
+	return nil
+}
+
+// LocalAction implements TestCase.LocalAction.
+func (*NFTablesInputDropOnlyUDP) LocalAction(ctx context.Context, ip net.IP, ipv6 bool) error {
+	// Try to establish a TCP connection with the container, which should
+	// succeed.
+	return connectTCP(ctx, ip, acceptPort, ipv6)
+}
+
+// NFTablesInputDefaultPolicyDrop tests that an nftables base chain with a drop
+// policy drops traffic.
+type NFTablesInputDefaultPolicyDrop struct{ containerCase }
+
+var _ TestCase = (*NFTablesInputDefaultPolicyDrop)(nil)
+
+// Name implements TestCase.Name.
+func (*NFTablesInputDefaultPolicyDrop) Name() string {
+	return "NFTablesInputDefaultPolicyDrop"
+}
+
+// ContainerAction implements TestCase.ContainerAction.
+func (*NFTablesInputDefaultPolicyDrop) ContainerAction(ctx context.Context, ip net.IP, ipv6 bool) error {
+	if err := nftInputChain("drop"); err != nil {
+		return err
+	}
+
+	// Listen for UDP packets on dropPort.
+	timedCtx, cancel := context.WithTimeout(ctx, NegativeTimeout)
+	defer cancel()
+	if err := listenUDP(timedCtx, dropPort, ipv6); err == nil {
+		return fmt.Errorf("packets on port %d should have been dropped, but got a packet", dropPort)
+	} else if !errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("error reading: %v", err)
+	}
+
+	// At this point we know that reading timed out and never received a
+	// packet.
+	return nil
+}
+
+// LocalAction implements TestCase.LocalAction.
+func (*NFTablesInputDefaultPolicyDrop) LocalAction(ctx context.Context, ip net.IP, ipv6 bool) error {
+	return sendUDPLoop(ctx, ip, dropPort, ipv6)
+}
+
+// NFTablesOutputDropTCP tests that an nftables rule in an output chain can
+// drop outgoing TCP connections.
+type NFTablesOutputDropTCP struct{ baseCase }
+
+var _ TestCase = (*NFTablesOutputDropTCP)(nil)
+
+// Name implements TestCase.Name.
+func (*NFTablesOutputDropTCP) Name() string {
+	return "NFTablesOutputDropTCP"
+}
+
+// ContainerAction implements TestCase.ContainerAction.
+func (*NFTablesOutputDropTCP) ContainerAction(ctx context.Context, ip net.IP, ipv6 bool) error {
+	if err := nftRules([][]string{
+		{"add", "table", "inet", "filter"},
+		{"add", "chain", "inet", "filter", "output", "{ type filter hook output priority 0; policy accept; }"},
+		{"add", "rule", "inet", "filter", "output", "meta", "l4proto", "tcp", "drop"},
+	}); err != nil {
+		return err
+	}
+
+	// Try to establish a TCP connection with the container, which should
+	// fail.
+	timedCtx, cancel := context.WithTimeout(ctx, NegativeTimeout)
+	defer cancel()
+	if err := listenTCP(timedCtx, acceptPort, ipv6); err == nil {
+		return fmt.Errorf("connection on port %d should not be accepted, but got accepted", acceptPort)
+	} else if !errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("error reading: %v", err)
+	}
+
+	return nil
+}
+
+// LocalAction implements TestCase.LocalAction.
+func (*NFTablesOutputDropTCP) LocalAction(ctx context.Context, ip net.IP, ipv6 bool) error {
+	timedCtx, cancel := context.WithTimeout(ctx, NegativeTimeout)
+	defer cancel()
+	if err := connectTCP(timedCtx, ip, acceptPort, ipv6); err == nil {
+		return fmt.Errorf("connection destined to port %d should not be accepted, but got accepted", acceptPort)
+	}
+
+	return nil
+}
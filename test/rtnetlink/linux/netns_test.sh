@@ -0,0 +1,68 @@
+#!/bin/bash
+
+# Copyright 2024 The gVisor Authors.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+set -xeo pipefail
+source "$(dirname "$0")/rtnetlink_test.sh"
+TCP_SRV="$(dirname "$0")/tcp_serv"
+if [[ ! -f "$TCP_SRV" ]]; then
+  TCP_SRV="$(dirname "$0")/tcp_serv_/tcp_serv"
+fi
+
+ip netns add test0
+ip netns add test1
+
+# Move a veth device to the network namespace of a process.
+ip netns exec test1 sleep 1000 &
+pid=$!
+ip netns exec test0 ip link add veth0 type veth peer name veth1
+ip netns exec test0 ip link set dev veth1 netns "$pid"
+ip netns exec test0 ip link show veth0
+ip netns exec test1 ip link show veth1
+if ip netns exec test0 ip link show veth1; then
+  fail "veth1 is still in test0"
+fi
+kill "$pid"
+wait "$pid" || true
+
+# Check that the namespaces are connected by the veth pair.
+ip netns exec test0 ip link set up dev veth0
+ip netns exec test1 ip link set up dev veth1
+ip netns exec test0 ip addr add 192.168.1.1/24 dev veth0
+ip netns exec test1 ip addr add 192.168.1.2/24 dev veth1
+check_connectivity test1 192.168.1.2 8800 test0 "ping from test0"
+
+# A device can't be moved to a namespace that has a device with the same name.
+ip netns exec test1 ip link add test_veth01 type veth peer name test_veth02
+ip netns exec test0 ip link add test_veth01 type veth peer name test_veth03
+if ip netns exec test0 ip link set dev test_veth01 netns test1; then
+  fail "test_veth01 has been moved over an existing device"
+fi
+ip netns exec test0 ip link show test_veth01
+ip netns exec test0 ip link del test_veth01
+ip netns exec test1 ip link del test_veth01
+
+# The loopback device can't be moved.
+if ip netns exec test0 ip link set dev lo netns test1; then
+  fail "lo has been moved"
+fi
+ip netns exec test0 ip link show lo
+
+# Destroying a namespace destroys the veth devices in it and their peers.
+ip netns del test0
+if ! wait_for ! ip netns exec test1 ip link show veth1 2>/dev/null; then
+  fail "veth1 hasn't been destroyed"
+fi
+ip netns del test1
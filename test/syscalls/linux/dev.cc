@@ -13,6 +13,9 @@
 // limitations under the License.
 
 #include <fcntl.h>
+#include <linux/random.h>
+#include <poll.h>
+#include <sys/ioctl.h>
 #include <sys/stat.h>
 #include <sys/types.h>
 #include <unistd.h>
@@ -21,7 +24,12 @@
 
 #include "gmock/gmock.h"
 #include "gtest/gtest.h"
+#include "absl/strings/numbers.h"
+#include "absl/strings/str_cat.h"
+#include "test/util/capability_util.h"
 #include "test/util/file_descriptor.h"
+#include "test/util/fs_util.h"
+#include "test/util/linux_capability_util.h"
 #include "test/util/test_util.h"
 
 namespace gvisor {
@@ -170,6 +178,106 @@ TEST(DevTest, ReadDevFuseWithoutMount) {
               SyscallFailsWithErrno(EPERM));
 }
 
+// Returns the integer contents of the sysctl at path.
+PosixErrorOr<int> ReadSysctlInt(const std::string& path) {
+  ASSIGN_OR_RETURN_ERRNO(std::string contents, GetContents(path));
+  int val;
+  if (!absl::SimpleAtoi(contents, &val)) {
+    return PosixError(EINVAL, absl::StrCat("invalid contents: ", contents));
+  }
+  return val;
+}
+
+TEST(DevTest, RandomGetEntCnt) {
+  const int poolsize = ASSERT_NO_ERRNO_AND_VALUE(
+      ReadSysctlInt("/proc/sys/kernel/random/poolsize"));
+  EXPECT_GT(poolsize, 0);
+
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open("/dev/random", O_RDONLY));
+  int count = -1;
+  ASSERT_THAT(ioctl(fd.get(), RNDGETENTCNT, &count), SyscallSucceeds());
+  EXPECT_GE(count, 0);
+  EXPECT_LE(count, poolsize);
+
+  const int avail = ASSERT_NO_ERRNO_AND_VALUE(
+      ReadSysctlInt("/proc/sys/kernel/random/entropy_avail"));
+  EXPECT_GE(avail, 0);
+  EXPECT_LE(avail, poolsize);
+}
+
+TEST(DevTest, RandomReadWrite) {
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open("/dev/urandom", O_RDWR));
+  char buf[64] = {};
+  EXPECT_THAT(WriteFd(fd.get(), buf, sizeof(buf)),
+              SyscallSucceedsWithValue(sizeof(buf)));
+  EXPECT_THAT(ReadFd(fd.get(), buf, sizeof(buf)),
+              SyscallSucceedsWithValue(sizeof(buf)));
+}
+
+TEST(DevTest, RandomPollReadable) {
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open("/dev/random", O_RDONLY));
+  struct pollfd pfd = {.fd = fd.get(), .events = POLLIN};
+  EXPECT_THAT(RetryEINTR(poll)(&pfd, 1, 0), SyscallSucceedsWithValue(1));
+  EXPECT_EQ(pfd.revents & POLLIN, POLLIN);
+}
+
+TEST(DevTest, RandomIoctlRequiresCapability) {
+  AutoCapability cap(CAP_SYS_ADMIN, false);
+
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open("/dev/random", O_RDONLY));
+  int bits = 8;
+  EXPECT_THAT(ioctl(fd.get(), RNDADDTOENTCNT, &bits),
+              SyscallFailsWithErrno(EPERM));
+  EXPECT_THAT(ioctl(fd.get(), RNDZAPENTCNT), SyscallFailsWithErrno(EPERM));
+  EXPECT_THAT(ioctl(fd.get(), RNDCLEARPOOL), SyscallFailsWithErrno(EPERM));
+
+  struct {
+    struct rand_pool_info info;
+    char buf[8];
+  } entropy = {};
+  entropy.info.entropy_count = 8;
+  entropy.info.buf_size = sizeof(entropy.buf);
+  EXPECT_THAT(ioctl(fd.get(), RNDADDENTROPY, &entropy),
+              SyscallFailsWithErrno(EPERM));
+}
+
+TEST(DevTest, RandomAddEntropy) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open("/dev/random", O_RDONLY));
+  struct {
+    struct rand_pool_info info;
+    char buf[8];
+  } entropy = {};
+  entropy.info.entropy_count = 8;
+  entropy.info.buf_size = sizeof(entropy.buf);
+  EXPECT_THAT(ioctl(fd.get(), RNDADDENTROPY, &entropy), SyscallSucceeds());
+
+  entropy.info.entropy_count = -1;
+  EXPECT_THAT(ioctl(fd.get(), RNDADDENTROPY, &entropy),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(DevTest, RandomUUID) {
+  const std::string uuid1 =
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/sys/kernel/random/uuid"));
+  const std::string uuid2 =
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/sys/kernel/random/uuid"));
+  EXPECT_EQ(uuid1.size(), 37);
+  EXPECT_NE(uuid1, uuid2);
+
+  // boot_id is fixed.
+  EXPECT_EQ(
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/sys/kernel/random/boot_id")),
+      ASSERT_NO_ERRNO_AND_VALUE(
+          GetContents("/proc/sys/kernel/random/boot_id")));
+}
+
 }  // namespace
 }  // namespace testing
 
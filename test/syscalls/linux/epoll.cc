@@ -203,6 +203,55 @@ TEST(EpollTest, EpollPwait2Timeout) {
   EXPECT_GT(ns_elapsed(begin, end), kTimeoutNs - 1);
 }
 
+TEST(EpollTest, EpollPwait2SubMillisecondTimeout) {
+  auto epollfd = ASSERT_NO_ERRNO_AND_VALUE(NewEpollFD());
+  // 1.5 milliseconds, which must not be rounded to whole milliseconds.
+  constexpr int kTimeoutNs = 1500000;
+  struct timespec timeout = {};
+  struct timespec begin;
+  struct timespec end;
+  struct epoll_event result[kFDsPerEpoll];
+
+  SKIP_IF(!IsRunningOnGvisor() &&
+          test_epoll_pwait2(epollfd.get(), result, kFDsPerEpoll, &timeout,
+                            nullptr) < 0 &&
+          errno == ENOSYS);
+
+  {
+    const DisableSave ds;  // Timing-related.
+    EXPECT_THAT(clock_gettime(CLOCK_MONOTONIC, &begin), SyscallSucceeds());
+
+    timeout.tv_nsec = kTimeoutNs;
+    ASSERT_THAT(RetryEINTR(test_epoll_pwait2)(epollfd.get(), result,
+                                              kFDsPerEpoll, &timeout, nullptr),
+                SyscallSucceedsWithValue(0));
+    EXPECT_THAT(clock_gettime(CLOCK_MONOTONIC, &end), SyscallSucceeds());
+  }
+
+  EXPECT_GE(ns_elapsed(begin, end), kTimeoutNs);
+}
+
+TEST(EpollTest, EpollPwait2InvalidTimeout) {
+  auto epollfd = ASSERT_NO_ERRNO_AND_VALUE(NewEpollFD());
+  struct epoll_event result[kFDsPerEpoll];
+  struct timespec timeout = {};
+
+  SKIP_IF(!IsRunningOnGvisor() &&
+          test_epoll_pwait2(epollfd.get(), result, kFDsPerEpoll, &timeout,
+                            nullptr) < 0 &&
+          errno == ENOSYS);
+
+  timeout = {-1, 0};
+  EXPECT_THAT(test_epoll_pwait2(epollfd.get(), result, kFDsPerEpoll,
+                                &timeout, nullptr),
+              SyscallFailsWithErrno(EINVAL));
+
+  timeout = {0, 1000000000};
+  EXPECT_THAT(test_epoll_pwait2(epollfd.get(), result, kFDsPerEpoll,
+                                &timeout, nullptr),
+              SyscallFailsWithErrno(EINVAL));
+}
+
 void* writer(void* arg) {
   int fd = *reinterpret_cast<int*>(arg);
   uint64_t tmp = 1;
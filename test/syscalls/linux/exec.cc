@@ -793,6 +793,43 @@ TEST(ExecveatTest, InterpreterScriptWithCloexecDirFD) {
   EXPECT_EQ(execve_errno, ENOENT);
 }
 
+TEST(ExecveatTest, InterpreterScriptWithFD) {
+  std::string path = RunfilePath(kExitScript);
+  const FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(Open(path, O_RDONLY));
+
+  // The interpreter opens the script through /dev/fd.
+  CheckExecveat(fd.get(), "", {path, "25"}, {}, AT_EMPTY_PATH,
+                ArgEnvExitStatus(25, 0), "");
+}
+
+TEST(ExecveatTest, InterpreterScriptWithOPathFD) {
+  std::string path = RunfilePath(kExitScript);
+  const FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(Open(path, O_PATH));
+
+  CheckExecveat(fd.get(), "", {path, "25"}, {}, AT_EMPTY_PATH,
+                ArgEnvExitStatus(25, 0), "");
+}
+
+TEST(ExecveatTest, Memfd) {
+  std::string path = RunfilePath(kBasicWorkload);
+  std::string contents = ASSERT_NO_ERRNO_AND_VALUE(GetContents(path));
+
+  int memfd = syscall(__NR_memfd_create, "exec_test", 0);
+  ASSERT_THAT(memfd, SyscallSucceeds());
+  FileDescriptor wfd(memfd);
+  ASSERT_THAT(WriteFd(wfd.get(), contents.data(), contents.size()),
+              SyscallSucceedsWithValue(contents.size()));
+
+  // Executing a file that is open for writing fails with ETXTBSY, so reopen
+  // the memfd read-only and close the writable descriptor.
+  const FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(
+      Open(absl::StrCat("/proc/self/fd/", wfd.get()), O_RDONLY));
+  wfd.reset();
+
+  CheckExecveat(fd.get(), "", {path}, {}, AT_EMPTY_PATH, ArgEnvExitStatus(0, 0),
+                absl::StrCat(path, "\n"));
+}
+
 TEST(ExecveatTest, InvalidFlags) {
   int execve_errno;
   ASSERT_NO_ERRNO_AND_VALUE(ForkAndExecveat(
@@ -562,6 +562,81 @@ TEST(CloneTest, Clone3Basic) {
   EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 0);
 }
 
+// Checks that clone3 validates set_tid and set_tid_size.
+TEST(CloneTest, Clone3SetTIDInvalid) {
+  pid_t tid = 1;
+  clone_args ca = {};
+  ca.exit_signal = SIGCHLD;
+
+  // set_tid_size without set_tid.
+  ca.set_tid_size = 1;
+  EXPECT_THAT(clone3(&ca, sizeof(ca)), SyscallFailsWithErrno(EINVAL));
+
+  // set_tid without set_tid_size.
+  ca.set_tid = reinterpret_cast<uint64_t>(&tid);
+  ca.set_tid_size = 0;
+  EXPECT_THAT(clone3(&ca, sizeof(ca)), SyscallFailsWithErrno(EINVAL));
+
+  // More TIDs than the maximum PID namespace depth.
+  ca.set_tid_size = 33;
+  EXPECT_THAT(clone3(&ca, sizeof(ca)), SyscallFailsWithErrno(EINVAL));
+
+  // Invalid TID.
+  tid = -1;
+  ca.set_tid_size = 1;
+  EXPECT_THAT(clone3(&ca, sizeof(ca)), SyscallFailsWithErrno(EINVAL));
+}
+
+// Checks that clone3 fails if the requested TID is in use.
+TEST(CloneTest, Clone3SetTIDInUse) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  pid_t tid = getpid();
+  clone_args ca = {};
+  ca.exit_signal = SIGCHLD;
+  ca.set_tid = reinterpret_cast<uint64_t>(&tid);
+  ca.set_tid_size = 1;
+  EXPECT_THAT(clone3(&ca, sizeof(ca)), SyscallFailsWithErrno(EEXIST));
+}
+
+// Checks that the init process of a new PID namespace can be given TID 1 in
+// the new namespace.
+TEST(CloneTest, Clone3SetTIDNewPIDNamespace) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  pid_t tid = 1;
+  clone_args ca = {};
+  ca.flags = CLONE_NEWPID;
+  ca.exit_signal = SIGCHLD;
+  ca.set_tid = reinterpret_cast<uint64_t>(&tid);
+  ca.set_tid_size = 1;
+
+  int child_pid;
+  ASSERT_THAT(child_pid = clone3(&ca, sizeof(ca)), SyscallSucceeds());
+  if (child_pid == 0) {
+    _exit(getpid() == 1 ? 0 : 1);
+  }
+
+  int status;
+  ASSERT_THAT(waitpid(child_pid, &status, 0),
+              SyscallSucceedsWithValue(child_pid));
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 0)
+      << "status = " << status;
+}
+
+// Checks that the first process of a new PID namespace must have TID 1 in it.
+TEST(CloneTest, Clone3SetTIDNewPIDNamespaceNotInit) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  pid_t tid = 2;
+  clone_args ca = {};
+  ca.flags = CLONE_NEWPID;
+  ca.exit_signal = SIGCHLD;
+  ca.set_tid = reinterpret_cast<uint64_t>(&tid);
+  ca.set_tid_size = 1;
+  EXPECT_THAT(clone3(&ca, sizeof(ca)), SyscallFailsWithErrno(EINVAL));
+}
+
 }  // namespace
 }  // namespace testing
 }  // namespace gvisor
@@ -22,6 +22,7 @@
 #include <unistd.h>
 
 #include <algorithm>
+#include <climits>
 #include <atomic>
 #include <memory>
 #include <vector>
@@ -738,6 +739,257 @@ TEST_P(PrivateAndSharedFutexTest, PITryLockConcurrency) {
   }
 }
 
+int futex_wait_requeue_pi(bool priv, std::atomic<int>* uaddr, int val,
+                          std::atomic<int>* uaddr2) {
+  int op = FUTEX_WAIT_REQUEUE_PI;
+  if (priv) {
+    op |= FUTEX_PRIVATE_FLAG;
+  }
+  return syscall(SYS_futex, uaddr, op, val, nullptr, uaddr2);
+}
+
+int futex_cmp_requeue_pi(bool priv, std::atomic<int>* uaddr,
+                         std::atomic<int>* uaddr2, int nreq, int val) {
+  int op = FUTEX_CMP_REQUEUE_PI;
+  if (priv) {
+    op |= FUTEX_PRIVATE_FLAG;
+  }
+  return syscall(SYS_futex, uaddr, op, 1, nreq, uaddr2, val);
+}
+
+TEST_P(PrivateAndSharedFutexTest, RequeuePIInvalidArguments) {
+  std::atomic<int> a(0);
+  std::atomic<int> m(0);
+  const bool is_priv = IsPrivate();
+
+  // The condition variable and mutex must differ.
+  EXPECT_THAT(futex_wait_requeue_pi(is_priv, &a, 0, &a),
+              SyscallFailsWithErrno(EINVAL));
+  // The condition variable's value must match.
+  EXPECT_THAT(futex_wait_requeue_pi(is_priv, &a, 1, &m),
+              SyscallFailsWithErrno(EAGAIN));
+  // At most one waiter may be woken.
+  EXPECT_THAT(syscall(SYS_futex, &a, FUTEX_CMP_REQUEUE_PI | PrivateFlag(), 2,
+                      1, &m, 0),
+              SyscallFailsWithErrno(EINVAL));
+  // No waiters.
+  EXPECT_THAT(futex_cmp_requeue_pi(is_priv, &a, &m, 1, 0),
+              SyscallSucceedsWithValue(0));
+}
+
+TEST_P(PrivateAndSharedFutexTest, RequeuePI) {
+  constexpr int kThreads = 5;
+  std::atomic<int> cond(0);
+  std::atomic<int> m(0);
+  std::atomic<int> acquired(0);
+  const bool is_priv = IsPrivate();
+
+  std::unique_ptr<ScopedThread> threads[kThreads];
+  for (size_t i = 0; i < ABSL_ARRAYSIZE(threads); ++i) {
+    threads[i] = std::make_unique<ScopedThread>([is_priv, &cond, &m,
+                                                 &acquired] {
+      // On success, we own m. If the condition variable was signaled before
+      // we waited, lock m directly, as pthread_cond_wait does.
+      if (futex_wait_requeue_pi(is_priv, &cond, 0, &m) < 0) {
+        ASSERT_EQ(errno, EAGAIN);
+        ASSERT_THAT(futex_lock_pi(is_priv, &m), SyscallSucceeds());
+      }
+      EXPECT_EQ(m.load() & FUTEX_TID_MASK, gettid());
+      acquired++;
+      ASSERT_THAT(futex_unlock_pi(is_priv, &m), SyscallSucceeds());
+    });
+  }
+
+  // "Broadcast" the condition variable: wake one thread by acquiring m on its
+  // behalf and requeue the rest onto m. Repeat until all threads have
+  // acquired m, in case some had yet to wait.
+  absl::SleepFor(absl::Milliseconds(500));
+  cond.store(1);
+  auto start = absl::Now();
+  while (acquired.load() < kThreads) {
+    ASSERT_LT(absl::Now() - start, absl::Seconds(10));
+    ASSERT_THAT(futex_cmp_requeue_pi(is_priv, &cond, &m, INT_MAX, 1),
+                SyscallSucceeds());
+    absl::SleepFor(absl::Milliseconds(10));
+  }
+}
+
+// futex_waitv(2) may not be defined by older headers.
+#ifndef SYS_futex_waitv
+#define SYS_futex_waitv 449
+#endif
+
+constexpr uint32_t kFutex32 = 2;          // FUTEX_32
+constexpr uint32_t kFutexWaitvMax = 128;  // FUTEX_WAITV_MAX
+
+// Mirrors struct futex_waitv from <linux/futex.h>.
+struct FutexWaitv {
+  uint64_t val;
+  uint64_t uaddr;
+  uint32_t flags;
+  uint32_t reserved;
+};
+
+FutexWaitv MakeFutexWaitv(bool priv, std::atomic<int>* uaddr, int val) {
+  FutexWaitv w = {};
+  w.val = static_cast<uint32_t>(val);
+  w.uaddr = reinterpret_cast<uint64_t>(uaddr);
+  w.flags = kFutex32 | (priv ? FUTEX_PRIVATE_FLAG : 0);
+  return w;
+}
+
+int futex_waitv(FutexWaitv* waiters, unsigned int nr, unsigned int flags,
+                struct timespec* timeout, clockid_t clockid) {
+  return syscall(SYS_futex_waitv, waiters, nr, flags, timeout, clockid);
+}
+
+// Returns true if futex_waitv(2) is implemented.
+bool HaveFutexWaitv() {
+  return futex_waitv(nullptr, 0, 0, nullptr, 0) < 0 && errno != ENOSYS;
+}
+
+// Returns an absolute CLOCK_MONOTONIC timeout d from now.
+struct timespec MonotonicDeadline(absl::Duration d) {
+  struct timespec now;
+  TEST_PCHECK(clock_gettime(CLOCK_MONOTONIC, &now) == 0);
+  return absl::ToTimespec(absl::DurationFromTimespec(now) + d);
+}
+
+TEST(FutexWaitvTest, InvalidArguments) {
+  SKIP_IF(!HaveFutexWaitv());
+
+  std::atomic<int> a(0);
+  FutexWaitv w = MakeFutexWaitv(true, &a, 0);
+
+  // No futexes, or too many.
+  EXPECT_THAT(futex_waitv(&w, 0, 0, nullptr, 0),
+              SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(futex_waitv(&w, kFutexWaitvMax + 1, 0, nullptr, 0),
+              SyscallFailsWithErrno(EINVAL));
+
+  // Non-zero flags.
+  EXPECT_THAT(futex_waitv(&w, 1, 1, nullptr, 0), SyscallFailsWithErrno(EINVAL));
+
+  // Unsupported clock.
+  struct timespec ts = MonotonicDeadline(absl::Seconds(1));
+  EXPECT_THAT(futex_waitv(&w, 1, 0, &ts, CLOCK_BOOTTIME),
+              SyscallFailsWithErrno(EINVAL));
+
+  // Non-zero reserved field.
+  FutexWaitv bad = w;
+  bad.reserved = 1;
+  EXPECT_THAT(futex_waitv(&bad, 1, 0, nullptr, 0),
+              SyscallFailsWithErrno(EINVAL));
+
+  // Unsupported futex size.
+  bad = w;
+  bad.flags = FUTEX_PRIVATE_FLAG;
+  EXPECT_THAT(futex_waitv(&bad, 1, 0, nullptr, 0),
+              SyscallFailsWithErrno(EINVAL));
+
+  // Value doesn't fit in 32 bits.
+  bad = w;
+  bad.val = uint64_t{1} << 32;
+  EXPECT_THAT(futex_waitv(&bad, 1, 0, nullptr, 0),
+              SyscallFailsWithErrno(EINVAL));
+
+  // Misaligned futex.
+  bad = w;
+  bad.uaddr += 1;
+  EXPECT_THAT(futex_waitv(&bad, 1, 0, nullptr, 0),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST_P(PrivateAndSharedFutexTest, Waitv_WrongVal) {
+  SKIP_IF(!HaveFutexWaitv());
+
+  std::atomic<int> a(0);
+  std::atomic<int> b(1);
+  FutexWaitv ws[] = {
+      MakeFutexWaitv(IsPrivate(), &a, 0),
+      MakeFutexWaitv(IsPrivate(), &b, 0),
+  };
+  EXPECT_THAT(futex_waitv(ws, ABSL_ARRAYSIZE(ws), 0, nullptr, 0),
+              SyscallFailsWithErrno(EAGAIN));
+}
+
+TEST_P(PrivateAndSharedFutexTest, Waitv_Timeout) {
+  SKIP_IF(!HaveFutexWaitv());
+
+  std::atomic<int> a(0);
+  std::atomic<int> b(0);
+  FutexWaitv ws[] = {
+      MakeFutexWaitv(IsPrivate(), &a, 0),
+      MakeFutexWaitv(IsPrivate(), &b, 0),
+  };
+
+  absl::Time const start = absl::Now();
+  struct timespec ts = MonotonicDeadline(absl::Milliseconds(500));
+  EXPECT_THAT(RetryEINTR(futex_waitv)(ws, ABSL_ARRAYSIZE(ws), 0, &ts,
+                                      CLOCK_MONOTONIC),
+              SyscallFailsWithErrno(ETIMEDOUT));
+  EXPECT_GE(absl::Now() - start, absl::Milliseconds(500));
+}
+
+TEST_P(PrivateAndSharedFutexTest, Waitv_Wake) {
+  SKIP_IF(!HaveFutexWaitv());
+
+  constexpr int kNumFutexes = 4;
+  constexpr int kWokenIndex = 2;
+  std::atomic<int> futexes[kNumFutexes] = {};
+  FutexWaitv ws[kNumFutexes];
+  for (int i = 0; i < kNumFutexes; i++) {
+    ws[i] = MakeFutexWaitv(IsPrivate(), &futexes[i], 0);
+  }
+
+  ScopedThread thread([&] {
+    EXPECT_THAT(RetryEINTR(futex_waitv)(ws, kNumFutexes, 0, nullptr, 0),
+                SyscallSucceedsWithValue(kWokenIndex));
+  });
+  absl::SleepFor(kWaiterStartupDelay);
+  futexes[kWokenIndex].store(1);
+  EXPECT_THAT(futex_wake(IsPrivate(), &futexes[kWokenIndex], 1),
+              SyscallSucceedsWithValue(1));
+}
+
+TEST(SharedFutexTest, WaitvInterprocessSharedAnon) {
+  SKIP_IF(!HaveFutexWaitv());
+
+  auto const mapping = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kPageSize, PROT_READ | PROT_WRITE, MAP_SHARED));
+  auto const ptr = static_cast<std::atomic<int>*>(mapping.ptr());
+  constexpr int kInitialValue = 1;
+  ptr[0].store(kInitialValue);
+  ptr[1].store(kInitialValue);
+
+  DisableSave ds;
+  pid_t const child_pid = fork();
+  if (child_pid == 0) {
+    FutexWaitv ws[] = {
+        MakeFutexWaitv(false, &ptr[0], kInitialValue),
+        MakeFutexWaitv(false, &ptr[1], kInitialValue),
+    };
+    TEST_PCHECK(RetryEINTR(futex_waitv)(ws, 2, 0, nullptr, 0) == 1);
+    _exit(0);
+  }
+  ASSERT_THAT(child_pid, SyscallSucceeds());
+  auto kill_child = Cleanup(
+      [&] { EXPECT_THAT(kill(child_pid, SIGKILL), SyscallSucceeds()); });
+  absl::SleepFor(kWaiterStartupDelay);
+
+  ptr[1].fetch_add(1);
+  // This is an ASSERT so that if it fails, we immediately abort the test (and
+  // kill the subprocess).
+  ASSERT_THAT(futex_wake(false, &ptr[1], 1), SyscallSucceedsWithValue(1));
+
+  kill_child.Release();
+  int status;
+  ASSERT_THAT(RetryEINTR(waitpid)(child_pid, &status, 0),
+              SyscallSucceedsWithValue(child_pid));
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 0)
+      << " status " << status;
+}
+
 // Robust mutex tests are disabled on Android because Bionic (Android's libc)
 // doesn't support robust pthread mutexes.
 #ifndef __ANDROID__
@@ -833,6 +1085,104 @@ TEST(RobustFutexTest, PthreadMutexAttr) {
   }
 }
 
+// Ownership of a robust mutex shared between processes is handed off to a
+// waiter in another process when the owner exits while holding it. The
+// parameter selects whether the mutex is a PI mutex.
+class RobustInterprocessFutexTest : public ::testing::TestWithParam<bool> {};
+
+TEST_P(RobustInterprocessFutexTest, OwnerDiesWithWaiter) {
+  struct SharedState {
+    pthread_mutex_t mtx;
+    std::atomic<int> locked;
+  };
+
+  auto const mapping = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kPageSize, PROT_READ | PROT_WRITE, MAP_SHARED));
+  auto const state = static_cast<SharedState*>(mapping.ptr());
+  state->locked.store(0);
+
+  pthread_mutexattr_t attr;
+  ASSERT_EQ(pthread_mutexattr_init(&attr), 0);
+  ASSERT_EQ(pthread_mutexattr_setrobust(&attr, PTHREAD_MUTEX_ROBUST), 0);
+  ASSERT_EQ(pthread_mutexattr_setpshared(&attr, PTHREAD_PROCESS_SHARED), 0);
+  if (GetParam()) {
+    ASSERT_EQ(pthread_mutexattr_setprotocol(&attr, PTHREAD_PRIO_INHERIT), 0);
+  }
+  ASSERT_EQ(pthread_mutex_init(&state->mtx, &attr), 0);
+  ASSERT_EQ(pthread_mutexattr_destroy(&attr), 0);
+
+  DisableSave ds;
+  pid_t const child_pid = fork();
+  if (child_pid == 0) {
+    // Take the mutex, give the parent time to block on it, then exit
+    // without releasing it.
+    TEST_CHECK(pthread_mutex_lock(&state->mtx) == 0);
+    state->locked.store(1);
+    absl::SleepFor(kWaiterStartupDelay);
+    _exit(0);
+  }
+  ASSERT_THAT(child_pid, SyscallSucceeds());
+  auto kill_child = Cleanup(
+      [&] { EXPECT_THAT(kill(child_pid, SIGKILL), SyscallSucceeds()); });
+
+  auto const start = absl::Now();
+  while (state->locked.load() == 0) {
+    ASSERT_LT(absl::Now() - start, absl::Seconds(30));
+    absl::SleepFor(absl::Milliseconds(10));
+  }
+
+  // Blocks until the child exits, then takes ownership.
+  EXPECT_EQ(pthread_mutex_lock(&state->mtx), EOWNERDEAD);
+  EXPECT_EQ(pthread_mutex_consistent(&state->mtx), 0);
+  EXPECT_EQ(pthread_mutex_unlock(&state->mtx), 0);
+
+  // The mutex is usable again.
+  EXPECT_EQ(pthread_mutex_lock(&state->mtx), 0);
+  EXPECT_EQ(pthread_mutex_unlock(&state->mtx), 0);
+
+  kill_child.Release();
+  int status;
+  ASSERT_THAT(RetryEINTR(waitpid)(child_pid, &status, 0),
+              SyscallSucceedsWithValue(child_pid));
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 0)
+      << " status " << status;
+}
+
+TEST_P(RobustInterprocessFutexTest, OwnerDiesWithoutWaiter) {
+  auto const mapping = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kPageSize, PROT_READ | PROT_WRITE, MAP_SHARED));
+  auto const mtx = static_cast<pthread_mutex_t*>(mapping.ptr());
+
+  pthread_mutexattr_t attr;
+  ASSERT_EQ(pthread_mutexattr_init(&attr), 0);
+  ASSERT_EQ(pthread_mutexattr_setrobust(&attr, PTHREAD_MUTEX_ROBUST), 0);
+  ASSERT_EQ(pthread_mutexattr_setpshared(&attr, PTHREAD_PROCESS_SHARED), 0);
+  if (GetParam()) {
+    ASSERT_EQ(pthread_mutexattr_setprotocol(&attr, PTHREAD_PRIO_INHERIT), 0);
+  }
+  ASSERT_EQ(pthread_mutex_init(mtx, &attr), 0);
+  ASSERT_EQ(pthread_mutexattr_destroy(&attr), 0);
+
+  pid_t const child_pid = fork();
+  if (child_pid == 0) {
+    TEST_CHECK(pthread_mutex_lock(mtx) == 0);
+    _exit(0);
+  }
+  ASSERT_THAT(child_pid, SyscallSucceeds());
+  int status;
+  ASSERT_THAT(RetryEINTR(waitpid)(child_pid, &status, 0),
+              SyscallSucceedsWithValue(child_pid));
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 0)
+      << " status " << status;
+
+  EXPECT_EQ(pthread_mutex_lock(mtx), EOWNERDEAD);
+  EXPECT_EQ(pthread_mutex_consistent(mtx), 0);
+  EXPECT_EQ(pthread_mutex_unlock(mtx), 0);
+}
+
+INSTANTIATE_TEST_SUITE_P(NonPIAndPI, RobustInterprocessFutexTest,
+                         ::testing::Bool());
+
 #endif  // __ANDROID__
 
 }  // namespace
@@ -21,8 +21,10 @@
 #include <string.h>
 #include <sys/epoll.h>
 #include <sys/mman.h>
+#include <sys/resource.h>
 #include <sys/stat.h>
 #include <sys/types.h>
+#include <sys/uio.h>
 #include <unistd.h>
 
 #include <cerrno>
@@ -30,9 +32,14 @@
 #include <cstdint>
 
 #include "gtest/gtest.h"
+#include "absl/strings/string_view.h"
+#include "test/util/capability_util.h"
+#include "test/util/cleanup.h"
+#include "test/util/fs_util.h"
 #include "test/util/io_uring_util.h"
 #include "test/util/memory_util.h"
 #include "test/util/multiprocess_util.h"
+#include "test/util/rlimit_util.h"
 #include "test/util/temp_path.h"
 #include "test/util/test_util.h"
 #include "test/util/thread_util.h"
@@ -1213,6 +1220,235 @@ TEST(IOUringTest, READVWithInvalidSqeFieldValue) {
   io_uring->store_cq_head(cq_head + 1);
 }
 
+// Tests that IORING_OP_READ_FIXED reads into a registered buffer.
+TEST(IOUringTest, ReadFixedRegisteredBuffer) {
+  SKIP_IF(!IOUringAvailable());
+
+  IOUringParams params = {};
+  std::unique_ptr<IOUring> io_uring =
+      ASSERT_NO_ERRNO_AND_VALUE(IOUring::InitIOUring(1, params));
+
+  std::string file_name = NewTempAbsPath();
+  std::string contents("DEADBEEF");
+  ASSERT_NO_ERRNO(CreateWithContents(file_name, contents, 0666));
+  FileDescriptor filefd = ASSERT_NO_ERRNO_AND_VALUE(Open(file_name, O_RDONLY));
+
+  auto const mapping = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  // Register an unaligned buffer and read into its middle.
+  struct iovec iov;
+  iov.iov_base = reinterpret_cast<char *>(mapping.ptr()) + 16;
+  iov.iov_len = 64;
+  ASSERT_THAT(io_uring->Register(IORING_REGISTER_BUFFERS, &iov, 1),
+              SyscallSucceeds());
+
+  unsigned *sq_array = io_uring->get_sq_array();
+  struct io_uring_sqe *sqe = io_uring->get_sqes();
+  memset(sqe, 0, sizeof(*sqe));
+  sqe->fd = filefd.get();
+  sqe->opcode = IORING_OP_READ_FIXED;
+  sqe->addr = reinterpret_cast<uint64_t>(iov.iov_base) + 8;
+  sqe->len = contents.size();
+  sqe->off = 0;
+  sqe->buf_index = 0;
+  sq_array[0] = 0;
+
+  uint32_t sq_tail = io_uring->load_sq_tail();
+  io_uring->store_sq_tail(sq_tail + 1);
+
+  ASSERT_THAT(io_uring->Enter(1, 1, IORING_ENTER_GETEVENTS, nullptr),
+              SyscallSucceedsWithValue(1));
+
+  struct io_uring_cqe *cqe = io_uring->get_cqes();
+  ASSERT_EQ(cqe->res, static_cast<int32_t>(contents.size()));
+  EXPECT_EQ(absl::string_view(reinterpret_cast<char *>(iov.iov_base) + 8,
+                              contents.size()),
+            contents);
+
+  uint32_t cq_head = io_uring->load_cq_head();
+  io_uring->store_cq_head(cq_head + 1);
+
+  EXPECT_THAT(io_uring->Register(IORING_UNREGISTER_BUFFERS, nullptr, 0),
+              SyscallSucceeds());
+}
+
+// Tests that IORING_OP_WRITE_FIXED writes from a registered buffer to a file
+// in the registered file set.
+TEST(IOUringTest, WriteFixedRegisteredFile) {
+  SKIP_IF(!IOUringAvailable());
+
+  IOUringParams params = {};
+  std::unique_ptr<IOUring> io_uring =
+      ASSERT_NO_ERRNO_AND_VALUE(IOUring::InitIOUring(1, params));
+
+  std::string file_name = NewTempAbsPath();
+  ASSERT_NO_ERRNO(CreateWithContents(file_name, "", 0666));
+  FileDescriptor filefd = ASSERT_NO_ERRNO_AND_VALUE(Open(file_name, O_WRONLY));
+
+  std::string contents("DEADBEEF");
+  auto const mapping = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  memcpy(mapping.ptr(), contents.data(), contents.size());
+  struct iovec iov;
+  iov.iov_base = mapping.ptr();
+  iov.iov_len = mapping.len();
+  ASSERT_THAT(io_uring->Register(IORING_REGISTER_BUFFERS, &iov, 1),
+              SyscallSucceeds());
+
+  // Slot 0 is left empty.
+  int32_t fds[] = {-1, filefd.get()};
+  ASSERT_THAT(io_uring->Register(IORING_REGISTER_FILES, fds, 2),
+              SyscallSucceeds());
+
+  unsigned *sq_array = io_uring->get_sq_array();
+  struct io_uring_sqe *sqe = io_uring->get_sqes();
+  memset(sqe, 0, sizeof(*sqe));
+  sqe->flags = IOSQE_FIXED_FILE;
+  sqe->fd = 1;
+  sqe->opcode = IORING_OP_WRITE_FIXED;
+  sqe->addr = reinterpret_cast<uint64_t>(mapping.ptr());
+  sqe->len = contents.size();
+  sqe->off = 0;
+  sqe->buf_index = 0;
+  sq_array[0] = 0;
+
+  uint32_t sq_tail = io_uring->load_sq_tail();
+  io_uring->store_sq_tail(sq_tail + 1);
+
+  ASSERT_THAT(io_uring->Enter(1, 1, IORING_ENTER_GETEVENTS, nullptr),
+              SyscallSucceedsWithValue(1));
+
+  struct io_uring_cqe *cqe = io_uring->get_cqes();
+  ASSERT_EQ(cqe->res, static_cast<int32_t>(contents.size()));
+
+  uint32_t cq_head = io_uring->load_cq_head();
+  io_uring->store_cq_head(cq_head + 1);
+
+  std::string file_contents;
+  ASSERT_NO_ERRNO(GetContents(file_name, &file_contents));
+  EXPECT_EQ(file_contents, contents);
+
+  // The empty slot can't be used.
+  sqe->fd = 0;
+  sq_tail = io_uring->load_sq_tail();
+  io_uring->store_sq_tail(sq_tail + 1);
+  ASSERT_THAT(io_uring->Enter(1, 1, IORING_ENTER_GETEVENTS, nullptr),
+              SyscallSucceedsWithValue(1));
+  cq_head = io_uring->load_cq_head();
+  cqe = &io_uring->get_cqes()[cq_head & (params.cq_entries - 1)];
+  EXPECT_EQ(cqe->res, -EBADF);
+  io_uring->store_cq_head(cq_head + 1);
+
+  EXPECT_THAT(io_uring->Register(IORING_UNREGISTER_FILES, nullptr, 0),
+              SyscallSucceeds());
+  EXPECT_THAT(io_uring->Register(IORING_UNREGISTER_BUFFERS, nullptr, 0),
+              SyscallSucceeds());
+}
+
+// Tests that fixed operations outside of the registered buffer fail.
+TEST(IOUringTest, ReadFixedOutsideRegisteredBuffer) {
+  SKIP_IF(!IOUringAvailable());
+
+  IOUringParams params = {};
+  std::unique_ptr<IOUring> io_uring =
+      ASSERT_NO_ERRNO_AND_VALUE(IOUring::InitIOUring(1, params));
+
+  std::string file_name = NewTempAbsPath();
+  ASSERT_NO_ERRNO(CreateWithContents(file_name, "DEADBEEF", 0666));
+  FileDescriptor filefd = ASSERT_NO_ERRNO_AND_VALUE(Open(file_name, O_RDONLY));
+
+  auto const mapping = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  struct iovec iov;
+  iov.iov_base = mapping.ptr();
+  iov.iov_len = 4;
+  ASSERT_THAT(io_uring->Register(IORING_REGISTER_BUFFERS, &iov, 1),
+              SyscallSucceeds());
+
+  unsigned *sq_array = io_uring->get_sq_array();
+  struct io_uring_sqe *sqe = io_uring->get_sqes();
+  memset(sqe, 0, sizeof(*sqe));
+  sqe->fd = filefd.get();
+  sqe->opcode = IORING_OP_READ_FIXED;
+  sqe->addr = reinterpret_cast<uint64_t>(mapping.ptr());
+  sqe->len = 8;
+  sqe->off = 0;
+  sqe->buf_index = 0;
+  sq_array[0] = 0;
+
+  uint32_t sq_tail = io_uring->load_sq_tail();
+  io_uring->store_sq_tail(sq_tail + 1);
+
+  ASSERT_THAT(io_uring->Enter(1, 1, IORING_ENTER_GETEVENTS, nullptr),
+              SyscallSucceedsWithValue(1));
+
+  struct io_uring_cqe *cqe = io_uring->get_cqes();
+  EXPECT_EQ(cqe->res, -EFAULT);
+
+  uint32_t cq_head = io_uring->load_cq_head();
+  io_uring->store_cq_head(cq_head + 1);
+}
+
+// Tests io_uring_register(2) errors for registering and unregistering
+// resources twice.
+TEST(IOUringTest, RegisterTwice) {
+  SKIP_IF(!IOUringAvailable());
+
+  IOUringParams params = {};
+  std::unique_ptr<IOUring> io_uring =
+      ASSERT_NO_ERRNO_AND_VALUE(IOUring::InitIOUring(1, params));
+
+  EXPECT_THAT(io_uring->Register(IORING_UNREGISTER_BUFFERS, nullptr, 0),
+              SyscallFailsWithErrno(ENXIO));
+  EXPECT_THAT(io_uring->Register(IORING_UNREGISTER_FILES, nullptr, 0),
+              SyscallFailsWithErrno(ENXIO));
+
+  auto const mapping = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  struct iovec iov;
+  iov.iov_base = mapping.ptr();
+  iov.iov_len = mapping.len();
+  ASSERT_THAT(io_uring->Register(IORING_REGISTER_BUFFERS, &iov, 1),
+              SyscallSucceeds());
+  EXPECT_THAT(io_uring->Register(IORING_REGISTER_BUFFERS, &iov, 1),
+              SyscallFailsWithErrno(EBUSY));
+
+  int32_t fds[] = {io_uring->Fd()};
+  // The ring itself can't be registered.
+  EXPECT_THAT(io_uring->Register(IORING_REGISTER_FILES, fds, 1),
+              SyscallFailsWithErrno(EBADF));
+  fds[0] = -1;
+  ASSERT_THAT(io_uring->Register(IORING_REGISTER_FILES, fds, 1),
+              SyscallSucceeds());
+  EXPECT_THAT(io_uring->Register(IORING_REGISTER_FILES, fds, 1),
+              SyscallFailsWithErrno(EBUSY));
+}
+
+// Tests that registered buffers are charged to RLIMIT_MEMLOCK.
+TEST(IOUringTest, RegisterBuffersRlimitMemlock) {
+  SKIP_IF(!IOUringAvailable());
+
+  IOUringParams params = {};
+  std::unique_ptr<IOUring> io_uring =
+      ASSERT_NO_ERRNO_AND_VALUE(IOUring::InitIOUring(1, params));
+
+  AutoCapability cap(CAP_IPC_LOCK, false);
+  Cleanup reset_rlimit =
+      ASSERT_NO_ERRNO_AND_VALUE(ScopedSetSoftRlimit(RLIMIT_MEMLOCK, kPageSize));
+
+  auto const mapping = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(2 * kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  struct iovec iov;
+  iov.iov_base = mapping.ptr();
+  iov.iov_len = mapping.len();
+  EXPECT_THAT(io_uring->Register(IORING_REGISTER_BUFFERS, &iov, 1),
+              SyscallFailsWithErrno(ENOMEM));
+
+  iov.iov_len = kPageSize;
+  ASSERT_THAT(io_uring->Register(IORING_REGISTER_BUFFERS, &iov, 1),
+              SyscallSucceeds());
+}
+
 }  // namespace
 
 }  // namespace testing
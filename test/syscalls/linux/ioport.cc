@@ -0,0 +1,79 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <sys/syscall.h>
+#include <unistd.h>
+
+#include "gtest/gtest.h"
+#include "test/util/capability_util.h"
+#include "test/util/test_util.h"
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+#if defined(__x86_64__)
+
+// An arbitrary range of I/O ports, those of the first parallel port.
+constexpr unsigned long kPort = 0x378;
+constexpr unsigned long kNumPorts = 3;
+
+TEST(IoportTest, IopermInvalidRange) {
+  EXPECT_THAT(syscall(SYS_ioperm, kPort, 0, 0), SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(syscall(SYS_ioperm, 0xffff, 2, 0),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(IoportTest, IopermTurnOffSucceeds) {
+  AutoCapability cap(CAP_SYS_RAWIO, false);
+  EXPECT_THAT(syscall(SYS_ioperm, kPort, kNumPorts, 0), SyscallSucceeds());
+}
+
+TEST(IoportTest, IopermRequiresCapability) {
+  AutoCapability cap(CAP_SYS_RAWIO, false);
+  EXPECT_THAT(syscall(SYS_ioperm, kPort, kNumPorts, 1),
+              SyscallFailsWithErrno(EPERM));
+}
+
+TEST(IoportTest, IoplInvalidLevel) {
+  EXPECT_THAT(syscall(SYS_iopl, 4), SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(IoportTest, IoplDropSucceeds) {
+  AutoCapability cap(CAP_SYS_RAWIO, false);
+  EXPECT_THAT(syscall(SYS_iopl, 0), SyscallSucceeds());
+}
+
+TEST(IoportTest, IoplRaiseRequiresCapability) {
+  AutoCapability cap(CAP_SYS_RAWIO, false);
+  EXPECT_THAT(syscall(SYS_iopl, 3), SyscallFailsWithErrno(EPERM));
+}
+
+// No I/O ports are emulated by default, so even privileged requests fail.
+TEST(IoportTest, NoEmulatedPorts) {
+  SKIP_IF(!IsRunningOnGvisor());
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_RAWIO)));
+
+  EXPECT_THAT(syscall(SYS_ioperm, kPort, kNumPorts, 1),
+              SyscallFailsWithErrno(EPERM));
+  EXPECT_THAT(syscall(SYS_iopl, 3), SyscallFailsWithErrno(EPERM));
+}
+
+#endif  // defined(__x86_64__)
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
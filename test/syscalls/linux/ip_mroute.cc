@@ -0,0 +1,151 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <arpa/inet.h>
+#include <netinet/in.h>
+#include <sys/socket.h>
+#include <sys/types.h>
+#include <unistd.h>
+
+// Must be included after netinet/in.h.
+#include <linux/mroute.h>
+
+#include "gtest/gtest.h"
+#include "test/syscalls/linux/ip_socket_test_util.h"
+#include "test/util/capability_util.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/socket_util.h"
+#include "test/util/test_util.h"
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+constexpr int kOne = 1;
+
+PosixErrorOr<FileDescriptor> NewIGMPSocket() {
+  return Socket(AF_INET, SOCK_RAW, IPPROTO_IGMP);
+}
+
+// IfindexVIF returns a vifctl with index vifi for the interface ifindex.
+struct vifctl IfindexVIF(vifi_t vifi, int ifindex) {
+  struct vifctl vif = {};
+  vif.vifc_vifi = vifi;
+  vif.vifc_flags = VIFF_USE_IFINDEX;
+  vif.vifc_threshold = 1;
+  vif.vifc_lcl_ifindex = ifindex;
+  return vif;
+}
+
+TEST(IPMRouteTest, RequiresIGMPSocket) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveRawIPSocketCapability()));
+
+  FileDescriptor s =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_INET, SOCK_RAW, IPPROTO_ICMP));
+  EXPECT_THAT(setsockopt(s.get(), IPPROTO_IP, MRT_INIT, &kOne, sizeof(kOne)),
+              SyscallFailsWithErrno(EOPNOTSUPP));
+}
+
+TEST(IPMRouteTest, Version) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveRawIPSocketCapability()));
+
+  FileDescriptor s = ASSERT_NO_ERRNO_AND_VALUE(NewIGMPSocket());
+  int version = 0;
+  socklen_t len = sizeof(version);
+  ASSERT_THAT(getsockopt(s.get(), IPPROTO_IP, MRT_VERSION, &version, &len),
+              SyscallSucceeds());
+  EXPECT_EQ(len, sizeof(version));
+  EXPECT_EQ(version, 0x0305);
+}
+
+TEST(IPMRouteTest, SingleRoutingSocket) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveRawIPSocketCapability()));
+
+  FileDescriptor s1 = ASSERT_NO_ERRNO_AND_VALUE(NewIGMPSocket());
+  FileDescriptor s2 = ASSERT_NO_ERRNO_AND_VALUE(NewIGMPSocket());
+
+  ASSERT_THAT(setsockopt(s1.get(), IPPROTO_IP, MRT_INIT, &kOne, sizeof(kOne)),
+              SyscallSucceeds());
+  EXPECT_THAT(setsockopt(s2.get(), IPPROTO_IP, MRT_INIT, &kOne, sizeof(kOne)),
+              SyscallFailsWithErrno(EADDRINUSE));
+  EXPECT_THAT(setsockopt(s2.get(), IPPROTO_IP, MRT_DONE, nullptr, 0),
+              SyscallFailsWithErrno(EACCES));
+
+  ASSERT_THAT(setsockopt(s1.get(), IPPROTO_IP, MRT_DONE, nullptr, 0),
+              SyscallSucceeds());
+  EXPECT_THAT(setsockopt(s2.get(), IPPROTO_IP, MRT_INIT, &kOne, sizeof(kOne)),
+              SyscallSucceeds());
+}
+
+TEST(IPMRouteTest, AddDeleteVIFAndMFC) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveRawIPSocketCapability()));
+
+  FileDescriptor s = ASSERT_NO_ERRNO_AND_VALUE(NewIGMPSocket());
+  ASSERT_THAT(setsockopt(s.get(), IPPROTO_IP, MRT_INIT, &kOne, sizeof(kOne)),
+              SyscallSucceeds());
+
+  const int lo = ASSERT_NO_ERRNO_AND_VALUE(GetLoopbackIndex());
+  struct vifctl vif = IfindexVIF(0, lo);
+  ASSERT_THAT(setsockopt(s.get(), IPPROTO_IP, MRT_ADD_VIF, &vif, sizeof(vif)),
+              SyscallSucceeds());
+  EXPECT_THAT(setsockopt(s.get(), IPPROTO_IP, MRT_ADD_VIF, &vif, sizeof(vif)),
+              SyscallFailsWithErrno(EADDRINUSE));
+  struct vifctl bad_vif = IfindexVIF(MAXVIFS, lo);
+  EXPECT_THAT(
+      setsockopt(s.get(), IPPROTO_IP, MRT_ADD_VIF, &bad_vif, sizeof(bad_vif)),
+      SyscallFailsWithErrno(ENFILE));
+
+  struct mfcctl mfc = {};
+  ASSERT_EQ(inet_pton(AF_INET, "10.0.0.1", &mfc.mfcc_origin), 1);
+  ASSERT_EQ(inet_pton(AF_INET, "239.1.2.3", &mfc.mfcc_mcastgrp), 1);
+  mfc.mfcc_parent = 0;
+  ASSERT_THAT(setsockopt(s.get(), IPPROTO_IP, MRT_ADD_MFC, &mfc, sizeof(mfc)),
+              SyscallSucceeds());
+  ASSERT_THAT(setsockopt(s.get(), IPPROTO_IP, MRT_DEL_MFC, &mfc, sizeof(mfc)),
+              SyscallSucceeds());
+  EXPECT_THAT(setsockopt(s.get(), IPPROTO_IP, MRT_DEL_MFC, &mfc, sizeof(mfc)),
+              SyscallFailsWithErrno(ENOENT));
+
+  ASSERT_THAT(setsockopt(s.get(), IPPROTO_IP, MRT_DEL_VIF, &vif, sizeof(vif)),
+              SyscallSucceeds());
+  EXPECT_THAT(setsockopt(s.get(), IPPROTO_IP, MRT_DEL_VIF, &vif, sizeof(vif)),
+              SyscallFailsWithErrno(EADDRNOTAVAIL));
+}
+
+TEST(IPMRouteTest, CloseRemovesVIFs) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveRawIPSocketCapability()));
+
+  const int lo = ASSERT_NO_ERRNO_AND_VALUE(GetLoopbackIndex());
+  struct vifctl vif = IfindexVIF(0, lo);
+  {
+    FileDescriptor s = ASSERT_NO_ERRNO_AND_VALUE(NewIGMPSocket());
+    ASSERT_THAT(setsockopt(s.get(), IPPROTO_IP, MRT_INIT, &kOne, sizeof(kOne)),
+                SyscallSucceeds());
+    ASSERT_THAT(
+        setsockopt(s.get(), IPPROTO_IP, MRT_ADD_VIF, &vif, sizeof(vif)),
+        SyscallSucceeds());
+  }
+
+  FileDescriptor s = ASSERT_NO_ERRNO_AND_VALUE(NewIGMPSocket());
+  ASSERT_THAT(setsockopt(s.get(), IPPROTO_IP, MRT_INIT, &kOne, sizeof(kOne)),
+              SyscallSucceeds());
+  EXPECT_THAT(setsockopt(s.get(), IPPROTO_IP, MRT_ADD_VIF, &vif, sizeof(vif)),
+              SyscallSucceeds());
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
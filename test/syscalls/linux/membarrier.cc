@@ -159,6 +159,9 @@ enum membarrier_cmd {
   MEMBARRIER_CMD_REGISTER_GLOBAL_EXPEDITED = (1 << 2),
   MEMBARRIER_CMD_PRIVATE_EXPEDITED = (1 << 3),
   MEMBARRIER_CMD_REGISTER_PRIVATE_EXPEDITED = (1 << 4),
+  MEMBARRIER_CMD_PRIVATE_EXPEDITED_SYNC_CORE = (1 << 5),
+  MEMBARRIER_CMD_REGISTER_PRIVATE_EXPEDITED_SYNC_CORE = (1 << 6),
+  MEMBARRIER_CMD_GET_REGISTRATIONS = (1 << 9),
 };
 
 int membarrier(membarrier_cmd cmd, int flags) {
@@ -262,6 +265,78 @@ TEST(MembarrierTest, PrivateExpedited) {
       &state, [] { std::atomic_signal_fence(std::memory_order_seq_cst); });
 }
 
+TEST(MembarrierTest, PrivateExpeditedSyncCore) {
+  constexpr int kRequiredCommands =
+      MEMBARRIER_CMD_PRIVATE_EXPEDITED_SYNC_CORE |
+      MEMBARRIER_CMD_REGISTER_PRIVATE_EXPEDITED_SYNC_CORE;
+  SKIP_IF((ASSERT_NO_ERRNO_AND_VALUE(SupportedMembarrierCommands()) &
+           kRequiredCommands) != kRequiredCommands);
+
+  // Registration persists for the lifetime of the address space, so only check
+  // the unregistered case if GET_REGISTRATIONS says we aren't registered yet.
+  int const registrations = membarrier(MEMBARRIER_CMD_GET_REGISTRATIONS, 0);
+  if (registrations >= 0 &&
+      (registrations & MEMBARRIER_CMD_REGISTER_PRIVATE_EXPEDITED_SYNC_CORE) ==
+          0) {
+    EXPECT_THAT(membarrier(MEMBARRIER_CMD_PRIVATE_EXPEDITED_SYNC_CORE, 0),
+                SyscallFailsWithErrno(EPERM));
+  }
+
+  ASSERT_THAT(
+      membarrier(MEMBARRIER_CMD_REGISTER_PRIVATE_EXPEDITED_SYNC_CORE, 0),
+      SyscallSucceeds());
+
+  MembarrierTestSharedState state;
+  state.Init();
+
+  ScopedThread remote_thread([&] {
+    RunMembarrierTestRemoteSide(&state, [] {
+      TEST_PCHECK(membarrier(MEMBARRIER_CMD_PRIVATE_EXPEDITED_SYNC_CORE, 0) ==
+                  0);
+    });
+  });
+  RunMembarrierTestLocalSide(
+      &state, [] { std::atomic_signal_fence(std::memory_order_seq_cst); });
+}
+
+TEST(MembarrierTest, GetRegistrations) {
+  SKIP_IF((ASSERT_NO_ERRNO_AND_VALUE(SupportedMembarrierCommands()) &
+           MEMBARRIER_CMD_GET_REGISTRATIONS) == 0);
+
+  EXPECT_THAT(membarrier(MEMBARRIER_CMD_GET_REGISTRATIONS, 1),
+              SyscallFailsWithErrno(EINVAL));
+
+  // Registration state is per-mm, so a forked child starts out unregistered.
+  pid_t const child_pid = fork();
+  if (child_pid == 0) {
+    // In child process.
+    TEST_CHECK(membarrier(MEMBARRIER_CMD_GET_REGISTRATIONS, 0) == 0);
+    int const cmds = membarrier(MEMBARRIER_CMD_QUERY, 0);
+    TEST_PCHECK(cmds >= 0);
+    int expected = 0;
+    if (cmds & MEMBARRIER_CMD_REGISTER_PRIVATE_EXPEDITED) {
+      TEST_PCHECK(
+          membarrier(MEMBARRIER_CMD_REGISTER_PRIVATE_EXPEDITED, 0) == 0);
+      expected |= MEMBARRIER_CMD_REGISTER_PRIVATE_EXPEDITED;
+    }
+    if (cmds & MEMBARRIER_CMD_REGISTER_PRIVATE_EXPEDITED_SYNC_CORE) {
+      TEST_PCHECK(membarrier(
+                      MEMBARRIER_CMD_REGISTER_PRIVATE_EXPEDITED_SYNC_CORE,
+                      0) == 0);
+      expected |= MEMBARRIER_CMD_REGISTER_PRIVATE_EXPEDITED_SYNC_CORE;
+    }
+    TEST_CHECK(membarrier(MEMBARRIER_CMD_GET_REGISTRATIONS, 0) == expected);
+    _exit(0);
+  }
+  // In parent process.
+  ASSERT_THAT(child_pid, SyscallSucceeds());
+  int status;
+  ASSERT_THAT(waitpid(child_pid, &status, 0),
+              SyscallSucceedsWithValue(child_pid));
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 0)
+      << " status " << status;
+}
+
 }  // namespace
 
 }  // namespace testing
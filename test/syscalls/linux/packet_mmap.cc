@@ -511,7 +511,7 @@ TEST(PacketMmapTest, SetVersion) {
   version = TPACKET_V3;
   EXPECT_THAT(setsockopt(mmap_sock.get(), SOL_PACKET, PACKET_VERSION, &version,
                          sizeof(version)),
-              SyscallFailsWithErrno(EINVAL));
+              SyscallSucceeds());
   version = TPACKET_V1 + 100;
   EXPECT_THAT(setsockopt(mmap_sock.get(), SOL_PACKET, PACKET_VERSION, &version,
                          sizeof(version)),
@@ -590,6 +590,12 @@ TEST(PacketMMmapTest, GetPacketHdrLen) {
   EXPECT_EQ(val, sizeof(tpacket2_hdr));
 
   val = TPACKET_V3;
+  EXPECT_THAT(
+      getsockopt(mmap_sock.get(), SOL_PACKET, PACKET_HDRLEN, &val, &val_len),
+      SyscallSucceeds());
+  EXPECT_EQ(val, sizeof(tpacket3_hdr));
+
+  val = TPACKET_V3 + 1;
   EXPECT_THAT(
       getsockopt(mmap_sock.get(), SOL_PACKET, PACKET_HDRLEN, &val, &val_len),
       SyscallFailsWithErrno(EINVAL));
@@ -713,6 +719,178 @@ TEST(PacketMmapTest, PacketStatistics) {
   EXPECT_EQ(stats.tp_packets, tp_frame_nr + expected_dropped);
 }
 
+TEST(PacketMmapTest, TxRing) {
+  if (!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_RAW))) {
+    ASSERT_THAT(socket(AF_PACKET, SOCK_RAW, 0), SyscallFailsWithErrno(EPERM));
+    GTEST_SKIP() << "Missing packet socket capability";
+  }
+  sockaddr_ll bind_addr = {
+      .sll_family = AF_PACKET,
+      .sll_protocol = htons(ETH_P_IP),
+      .sll_ifindex = ASSERT_NO_ERRNO_AND_VALUE(GetLoopbackIndex()),
+      .sll_halen = ETH_ALEN,
+  };
+  FileDescriptor rcv_sock =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_PACKET, SOCK_DGRAM, 0));
+  ASSERT_THAT(
+      bind(rcv_sock.get(), reinterpret_cast<const sockaddr*>(&bind_addr),
+           sizeof(bind_addr)),
+      SyscallSucceeds());
+  FileDescriptor mmap_sock =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_PACKET, SOCK_DGRAM, 0));
+
+  int version = TPACKET_V2;
+  ASSERT_THAT(setsockopt(mmap_sock.get(), SOL_PACKET, PACKET_VERSION, &version,
+                         sizeof(version)),
+              SyscallSucceeds());
+  uint32_t tp_frame_size = 2048;
+  uint32_t tp_block_size = 4096;
+  uint32_t tp_block_nr = 2;
+  uint32_t tp_frame_nr = (tp_block_size * tp_block_nr) / tp_frame_size;
+  tpacket_req req = {
+      .tp_block_size = tp_block_size,
+      .tp_block_nr = tp_block_nr,
+      .tp_frame_size = tp_frame_size,
+      .tp_frame_nr = tp_frame_nr,
+  };
+  ASSERT_THAT(setsockopt(mmap_sock.get(), SOL_PACKET, PACKET_TX_RING, &req,
+                         sizeof(req)),
+              SyscallSucceeds());
+  ASSERT_THAT(
+      bind(mmap_sock.get(), reinterpret_cast<const sockaddr*>(&bind_addr),
+           sizeof(bind_addr)),
+      SyscallSucceeds());
+  void* ring = mmap(0, tp_block_size * tp_block_nr, PROT_READ | PROT_WRITE,
+                    MAP_SHARED, mmap_sock.get(), 0);
+  ASSERT_NE(ring, MAP_FAILED);
+  auto ring_cleanup = Cleanup([ring, tp_block_size, tp_block_nr] {
+    ASSERT_THAT(munmap(ring, tp_block_size * tp_block_nr), SyscallSucceeds());
+  });
+
+  // Queue two frames and send them with a single call.
+  std::string kMessages[] = {"123abc", "456defg"};
+  for (int i = 0; i < 2; i++) {
+    char* frame = static_cast<char*>(ring) + i * tp_frame_size;
+    tpacket2_hdr* hdr = reinterpret_cast<tpacket2_hdr*>(frame);
+    EXPECT_EQ(hdr->tp_status, TP_STATUS_AVAILABLE);
+    memcpy(frame + TPACKET2_HDRLEN - sizeof(sockaddr_ll),
+           kMessages[i].c_str(), kMessages[i].size());
+    hdr->tp_len = kMessages[i].size();
+    hdr->tp_status = TP_STATUS_SEND_REQUEST;
+  }
+  ASSERT_THAT(sendto(mmap_sock.get(), nullptr, 0, 0 /* flags */,
+                     reinterpret_cast<const sockaddr*>(&bind_addr),
+                     sizeof(bind_addr)),
+              SyscallSucceedsWithValue(kMessages[0].size() +
+                                       kMessages[1].size()));
+  for (int i = 0; i < 2; i++) {
+    tpacket2_hdr* hdr = reinterpret_cast<tpacket2_hdr*>(
+        static_cast<char*>(ring) + i * tp_frame_size);
+    EXPECT_EQ(hdr->tp_status, TP_STATUS_AVAILABLE);
+  }
+
+  // Nothing is sent if no frames are queued.
+  ASSERT_THAT(sendto(mmap_sock.get(), nullptr, 0, 0 /* flags */,
+                     reinterpret_cast<const sockaddr*>(&bind_addr),
+                     sizeof(bind_addr)),
+              SyscallSucceedsWithValue(0));
+
+  // Loopback packets are received both as outgoing and incoming packets;
+  // only check the incoming ones.
+  for (const std::string& message : kMessages) {
+    char buf[64];
+    sockaddr_ll src = {};
+    socklen_t src_len;
+    int n;
+    do {
+      src_len = sizeof(src);
+      ASSERT_THAT(n = RetryEINTR(recvfrom)(rcv_sock.get(), buf, sizeof(buf), 0,
+                                           reinterpret_cast<sockaddr*>(&src),
+                                           &src_len),
+                  SyscallSucceeds());
+    } while (src.sll_pkttype == PACKET_OUTGOING);
+    EXPECT_EQ(std::string(buf, n), message);
+  }
+}
+
+TEST(PacketMmapTest, BasicV3) {
+  if (!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_RAW))) {
+    ASSERT_THAT(socket(AF_PACKET, SOCK_RAW, 0), SyscallFailsWithErrno(EPERM));
+    GTEST_SKIP() << "Missing packet socket capability";
+  }
+  sockaddr_ll bind_addr = {
+      .sll_family = AF_PACKET,
+      .sll_protocol = htons(ETH_P_IP),
+      .sll_ifindex = ASSERT_NO_ERRNO_AND_VALUE(GetLoopbackIndex()),
+      .sll_halen = ETH_ALEN,
+  };
+  FileDescriptor mmap_sock =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_PACKET, SOCK_DGRAM, 0));
+
+  int version = TPACKET_V3;
+  ASSERT_THAT(setsockopt(mmap_sock.get(), SOL_PACKET, PACKET_VERSION, &version,
+                         sizeof(version)),
+              SyscallSucceeds());
+  uint32_t tp_block_size = 1 << 16;
+  uint32_t tp_block_nr = 2;
+  uint32_t tp_frame_size = 2048;
+  tpacket_req3 req = {
+      .tp_block_size = tp_block_size,
+      .tp_block_nr = tp_block_nr,
+      .tp_frame_size = tp_frame_size,
+      .tp_frame_nr = (tp_block_size * tp_block_nr) / tp_frame_size,
+      .tp_retire_blk_tov = 100,
+  };
+  ASSERT_THAT(setsockopt(mmap_sock.get(), SOL_PACKET, PACKET_RX_RING, &req,
+                         sizeof(req)),
+              SyscallSucceeds());
+  ASSERT_THAT(
+      bind(mmap_sock.get(), reinterpret_cast<const sockaddr*>(&bind_addr),
+           sizeof(bind_addr)),
+      SyscallSucceeds());
+  void* ring = mmap(0, tp_block_size * tp_block_nr, PROT_READ | PROT_WRITE,
+                    MAP_SHARED, mmap_sock.get(), 0);
+  ASSERT_NE(ring, MAP_FAILED);
+  auto ring_cleanup = Cleanup([ring, tp_block_size, tp_block_nr] {
+    ASSERT_THAT(munmap(ring, tp_block_size * tp_block_nr), SyscallSucceeds());
+  });
+
+  std::string kMessage = "123abc";
+  for (int i = 0; i < 2; i++) {
+    ASSERT_THAT(sendto(mmap_sock.get(), kMessage.c_str(), kMessage.size(),
+                       0 /* flags */,
+                       reinterpret_cast<const sockaddr*>(&bind_addr),
+                       sizeof(bind_addr)),
+                SyscallSucceeds());
+  }
+
+  // The block is retired by its timeout, since all packets fit in it.
+  // Loopback packets may be received both as outgoing and incoming packets.
+  struct pollfd pollset;
+  pollset.fd = mmap_sock.get();
+  pollset.revents = 0;
+  pollset.events = POLLIN | POLLRDNORM | POLLERR;
+  ASSERT_THAT(poll(&pollset, 1, -1), SyscallSucceeds());
+  tpacket_block_desc* desc = reinterpret_cast<tpacket_block_desc*>(ring);
+  EXPECT_EQ(desc->hdr.bh1.block_status & TP_STATUS_USER, TP_STATUS_USER);
+  uint32_t num_pkts = desc->hdr.bh1.num_pkts;
+  ASSERT_GE(num_pkts, 2);
+  char* pkt = reinterpret_cast<char*>(desc) + desc->hdr.bh1.offset_to_first_pkt;
+  for (uint32_t i = 0; i < num_pkts; i++) {
+    tpacket3_hdr* hdr = reinterpret_cast<tpacket3_hdr*>(pkt);
+    EXPECT_EQ(hdr->tp_len, kMessage.size());
+    EXPECT_EQ(hdr->tp_snaplen, kMessage.size());
+    EXPECT_EQ(std::string(pkt + hdr->tp_net, hdr->tp_snaplen), kMessage);
+    if (i == num_pkts - 1) {
+      EXPECT_EQ(hdr->tp_next_offset, 0);
+    }
+    pkt += hdr->tp_next_offset;
+  }
+
+  // Release the block to the kernel.
+  desc->hdr.bh1.block_status = TP_STATUS_KERNEL;
+}
+
 }  // namespace
 }  // namespace testing
 }  // namespace gvisor
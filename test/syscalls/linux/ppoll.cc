@@ -16,6 +16,7 @@
 #include <signal.h>
 #include <sys/syscall.h>
 #include <sys/time.h>
+#include <time.h>
 #include <unistd.h>
 
 #include "gtest/gtest.h"
@@ -66,6 +67,24 @@ TEST_F(PpollTest, NullFds) {
   EXPECT_EQ(timeout.tv_nsec, 0);
 }
 
+// See that ppoll doesn't round sub-millisecond timeouts to whole
+// milliseconds.
+TEST_F(PpollTest, SubMillisecondTimeout) {
+  const DisableSave ds;  // Timing-related.
+  constexpr absl::Duration kTimeout = absl::Microseconds(1500);
+  struct timespec timeout = absl::ToTimespec(kTimeout);
+  struct timespec begin;
+  struct timespec end;
+  ASSERT_THAT(clock_gettime(CLOCK_MONOTONIC, &begin), SyscallSucceeds());
+  ASSERT_THAT(syscallPpoll(nullptr, 0, &timeout, nullptr, 0),
+              SyscallSucceeds());
+  ASSERT_THAT(clock_gettime(CLOCK_MONOTONIC, &end), SyscallSucceeds());
+  EXPECT_GE(ns_elapsed(begin, end),
+            static_cast<uint64_t>(absl::ToInt64Nanoseconds(kTimeout)));
+  EXPECT_EQ(timeout.tv_sec, 0);
+  EXPECT_EQ(timeout.tv_nsec, 0);
+}
+
 TEST_F(PpollTest, ZeroTimeout) {
   struct timespec timeout = {};
   ASSERT_THAT(syscallPpoll(nullptr, 0, &timeout, nullptr, 0),
@@ -12,6 +12,7 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+#include <sched.h>
 #include <sys/prctl.h>
 #include <sys/ptrace.h>
 #include <sys/types.h>
@@ -307,6 +308,77 @@ TEST(PrctlTest, OrphansReparentedToSubreaper) {
   EXPECT_TRUE(got_sigchild);
 }
 
+// Clearing the subreaper bit of a descendant doesn't hide subreapers further
+// up the process tree from its descendants.
+TEST(PrctlTest, OrphansReparentedToSubreaperAfterNestedSubreaperCleared) {
+  ASSERT_THAT(prctl(PR_SET_CHILD_SUBREAPER, 1), SyscallSucceeds());
+
+  // The orphan reports its new parent through report. The middle process
+  // signals through ready once the orphan exists, and waits on exit before
+  // exiting.
+  int report[2], ready[2], exit_fds[2];
+  ASSERT_THAT(pipe(report), SyscallSucceeds());
+  ASSERT_THAT(pipe(ready), SyscallSucceeds());
+  ASSERT_THAT(pipe(exit_fds), SyscallSucceeds());
+  auto fd_cleanup = Cleanup([&] {
+    for (int fd : {report[0], report[1], ready[0], ready[1], exit_fds[0],
+                   exit_fds[1]}) {
+      close(fd);
+    }
+  });
+
+  pid_t child = fork();
+  if (child == 0) {
+    pid_t middle = fork();
+    if (middle == 0) {
+      pid_t orphan = fork();
+      if (orphan == 0) {
+        // Wait to be reparented, and report the new parent.
+        pid_t ppid = getppid();
+        while (getppid() == ppid) {
+          sched_yield();
+        }
+        ppid = getppid();
+        TEST_PCHECK(WriteFd(report[1], &ppid, sizeof(ppid)) == sizeof(ppid));
+        _exit(0);
+      }
+      TEST_PCHECK(orphan > 0);
+      char c = 0;
+      TEST_PCHECK(WriteFd(ready[1], &c, sizeof(c)) == sizeof(c));
+      TEST_PCHECK(ReadFd(exit_fds[0], &c, sizeof(c)) == sizeof(c));
+      _exit(0);
+    }
+    TEST_PCHECK(middle > 0);
+    char c;
+    TEST_PCHECK(ReadFd(ready[0], &c, sizeof(c)) == sizeof(c));
+
+    // Become a subreaper and stop being one, after the middle process and
+    // the orphan were created.
+    TEST_PCHECK(prctl(PR_SET_CHILD_SUBREAPER, 1) == 0);
+    TEST_PCHECK(prctl(PR_SET_CHILD_SUBREAPER, 0) == 0);
+
+    TEST_PCHECK(WriteFd(exit_fds[1], &c, sizeof(c)) == sizeof(c));
+    int status;
+    TEST_PCHECK(RetryEINTR(waitpid)(middle, &status, 0) == middle);
+    TEST_CHECK(WIFEXITED(status) && WEXITSTATUS(status) == 0);
+    _exit(0);
+  }
+  ASSERT_THAT(child, SyscallSucceeds());
+
+  // The orphan is reparented to this process rather than to init.
+  pid_t ppid;
+  ASSERT_THAT(ReadFd(report[0], &ppid, sizeof(ppid)),
+              SyscallSucceedsWithValue(sizeof(ppid)));
+  EXPECT_EQ(ppid, getpid());
+
+  // Reap the child and the orphan.
+  for (int i = 0; i < 2; i++) {
+    int status;
+    ASSERT_THAT(RetryEINTR(waitpid)(-1, &status, 0), SyscallSucceeds());
+    EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 0) << status;
+  }
+}
+
 }  // namespace
 
 }  // namespace testing
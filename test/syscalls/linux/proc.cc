@@ -2724,6 +2724,113 @@ TEST(ProcSysVmOvercommitMemory, HasNumericValue) {
       << overcommit_memory;
 }
 
+TEST(ProcSysFsFileNr, MatchesFileMax) {
+  const std::string file_nr_str =
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/sys/fs/file-nr"));
+  std::vector<std::string> fields =
+      absl::StrSplit(file_nr_str, absl::ByAnyChar("\t\n"), absl::SkipEmpty());
+  ASSERT_EQ(fields.size(), 3) << file_nr_str;
+  uint64_t allocated, max;
+  EXPECT_TRUE(absl::SimpleAtoi(fields[0], &allocated)) << file_nr_str;
+  EXPECT_GT(allocated, 0);
+  EXPECT_EQ(fields[1], "0");
+  ASSERT_TRUE(absl::SimpleAtoi(fields[2], &max)) << file_nr_str;
+
+  const std::string file_max_str =
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/sys/fs/file-max"));
+  uint64_t file_max;
+  ASSERT_TRUE(absl::SimpleAtoi(file_max_str, &file_max)) << file_max_str;
+  EXPECT_EQ(max, file_max);
+}
+
+TEST(ProcSysFsFileMax, Enforced) {
+  // Don't change the host's limits.
+  SKIP_IF(!IsRunningOnGvisor());
+
+  // Keep /proc/sys/fs/file-max open, to be able to restore it once the limit
+  // is reached.
+  const FileDescriptor max_fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open("/proc/sys/fs/file-max", O_RDWR));
+  const std::string old_max =
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/sys/fs/file-max"));
+  const std::string file_nr_str =
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/sys/fs/file-nr"));
+  uint64_t allocated;
+  ASSERT_TRUE(absl::SimpleAtoi(
+      std::vector<std::string>(absl::StrSplit(file_nr_str, '\t'))[0],
+      &allocated));
+
+  const std::string new_max = absl::StrCat(allocated + 8);
+  ASSERT_THAT(pwrite(max_fd.get(), new_max.data(), new_max.size(), 0),
+              SyscallSucceedsWithValue(new_max.size()));
+  std::vector<FileDescriptor> fds;
+  int ret = 0;
+  for (int i = 0; i < 64 && ret >= 0; i++) {
+    ret = open("/dev/null", O_RDONLY);
+    if (ret >= 0) {
+      fds.emplace_back(ret);
+    }
+  }
+  const int saved_errno = errno;
+  fds.clear();
+  ASSERT_THAT(pwrite(max_fd.get(), old_max.data(), old_max.size(), 0),
+              SyscallSucceedsWithValue(old_max.size()));
+  EXPECT_EQ(ret, -1);
+  EXPECT_EQ(saved_errno, ENFILE);
+}
+
+TEST(ProcSysFsPipeMaxSize, RoundedAndEnforced) {
+  // Don't change the host's limits.
+  SKIP_IF(!IsRunningOnGvisor());
+
+  const std::string old_max =
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/sys/fs/pipe-max-size"));
+  auto restore = Cleanup([&] {
+    EXPECT_NO_ERRNO(SetContents("/proc/sys/fs/pipe-max-size", old_max));
+  });
+
+  // Like Linux, the size is rounded up to a power of two number of pages.
+  const int page_size = getpagesize();
+  ASSERT_NO_ERRNO(
+      SetContents("/proc/sys/fs/pipe-max-size", absl::StrCat(page_size + 1)));
+  const std::string max_str =
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/sys/fs/pipe-max-size"));
+  EXPECT_EQ(max_str, absl::StrCat(2 * page_size, "\n"));
+
+  int fds[2];
+  ASSERT_THAT(pipe(fds), SyscallSucceeds());
+  const FileDescriptor rfd(fds[0]);
+  const FileDescriptor wfd(fds[1]);
+
+  AutoCapability cap(CAP_SYS_RESOURCE, false);
+  EXPECT_THAT(fcntl(rfd.get(), F_SETPIPE_SZ, 2 * page_size),
+              SyscallSucceedsWithValue(2 * page_size));
+  EXPECT_THAT(fcntl(rfd.get(), F_SETPIPE_SZ, 4 * page_size),
+              SyscallFailsWithErrno(EPERM));
+}
+
+TEST(ProcSysFsAioMaxNr, Enforced) {
+  // Don't change the host's limits.
+  SKIP_IF(!IsRunningOnGvisor());
+
+  const std::string old_max =
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/sys/fs/aio-max-nr"));
+  auto restore = Cleanup([&] {
+    EXPECT_NO_ERRNO(SetContents("/proc/sys/fs/aio-max-nr", old_max));
+  });
+  ASSERT_NO_ERRNO(SetContents("/proc/sys/fs/aio-max-nr", "16"));
+
+  uint64_t ctx = 0;
+  EXPECT_THAT(syscall(SYS_io_setup, 32, &ctx), SyscallFailsWithErrno(EAGAIN));
+  ASSERT_THAT(syscall(SYS_io_setup, 8, &ctx), SyscallSucceeds());
+  std::string nr =
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/sys/fs/aio-nr"));
+  EXPECT_EQ(nr, "8\n");
+  ASSERT_THAT(syscall(SYS_io_destroy, ctx), SyscallSucceeds());
+  nr = ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/sys/fs/aio-nr"));
+  EXPECT_EQ(nr, "0\n");
+}
+
 // Check that link for proc fd entries point the target node, not the
 // symlink itself. Regression test for b/31155070.
 TEST(ProcTaskFd, FstatatFollowsSymlink) {
@@ -477,9 +477,6 @@ TEST(ProcNetSnmp, UdpIn) {
 }
 
 TEST(ProcNetSnmp, CheckNetStat) {
-  // TODO(b/155123175): SNMP and netstat don't work on gVisor.
-  SKIP_IF(IsRunningOnGvisor());
-
   std::string contents =
       ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/net/netstat"));
 
@@ -584,6 +581,99 @@ TEST(ProcSysNetIpv4Recovery, CanReadAndWrite) {
   EXPECT_EQ(strcmp(buf, "100\n"), 0);
 }
 
+TEST(ProcSysNetIpv4SynCookies, CanReadAndWrite) {
+  DisableSave ds;
+
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability((CAP_NET_ADMIN))) ||
+          IsRunningWithHostinet());
+
+  auto const fd = ASSERT_NO_ERRNO_AND_VALUE(
+      Open("/proc/sys/net/ipv4/tcp_syncookies", O_RDWR));
+
+  char initial[10] = {'\0'};
+  ASSERT_THAT(PreadFd(fd.get(), &initial, sizeof(initial), 0),
+              SyscallSucceedsWithValue(2));
+  if (IsRunningOnGvisor()) {
+    // SYN cookies are sent when the SYN backlog overflows by default.
+    EXPECT_EQ(strcmp(initial, "1\n"), 0);
+  }
+
+  char buf[10] = {'\0'};
+  char to_write = '2';
+  EXPECT_THAT(PwriteFd(fd.get(), &to_write, sizeof(to_write), 0),
+              SyscallSucceedsWithValue(sizeof(to_write)));
+  EXPECT_THAT(PreadFd(fd.get(), &buf, sizeof(buf), 0),
+              SyscallSucceedsWithValue(sizeof(to_write) + 1));
+  EXPECT_EQ(strcmp(buf, "2\n"), 0);
+
+  // Only 0, 1 and 2 are valid.
+  to_write = '3';
+  EXPECT_THAT(PwriteFd(fd.get(), &to_write, sizeof(to_write), 0),
+              SyscallFailsWithErrno(EINVAL));
+
+  EXPECT_THAT(PwriteFd(fd.get(), initial, 1, 0), SyscallSucceedsWithValue(1));
+}
+
+TEST(ProcSysNetCoreSomaxconn, CanReadAndWrite) {
+  DisableSave ds;
+
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability((CAP_NET_ADMIN))) ||
+          IsRunningWithHostinet());
+
+  auto const fd = ASSERT_NO_ERRNO_AND_VALUE(
+      Open("/proc/sys/net/core/somaxconn", O_RDWR));
+
+  char initial[16] = {'\0'};
+  int initial_len;
+  ASSERT_THAT(initial_len = PreadFd(fd.get(), &initial, sizeof(initial), 0),
+              SyscallSucceeds());
+  if (IsRunningOnGvisor()) {
+    EXPECT_EQ(strcmp(initial, "1024\n"), 0);
+  }
+
+  constexpr char kValue[] = "128";
+  EXPECT_THAT(PwriteFd(fd.get(), kValue, strlen(kValue), 0),
+              SyscallSucceedsWithValue(strlen(kValue)));
+  char buf[16] = {'\0'};
+  EXPECT_THAT(PreadFd(fd.get(), &buf, sizeof(buf), 0),
+              SyscallSucceedsWithValue(strlen(kValue) + 1));
+  EXPECT_EQ(strcmp(buf, "128\n"), 0);
+
+  EXPECT_THAT(PwriteFd(fd.get(), initial, initial_len, 0),
+              SyscallSucceedsWithValue(initial_len));
+}
+
+TEST(ProcSysNetIpv4SynRetries, CanReadAndWrite) {
+  DisableSave ds;
+
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability((CAP_NET_ADMIN))) ||
+          IsRunningWithHostinet());
+
+  auto const fd = ASSERT_NO_ERRNO_AND_VALUE(
+      Open("/proc/sys/net/ipv4/tcp_syn_retries", O_RDWR));
+
+  char initial[16] = {'\0'};
+  int initial_len;
+  ASSERT_THAT(initial_len = PreadFd(fd.get(), &initial, sizeof(initial), 0),
+              SyscallSucceeds());
+
+  char buf[16] = {'\0'};
+  char to_write = '3';
+  EXPECT_THAT(PwriteFd(fd.get(), &to_write, sizeof(to_write), 0),
+              SyscallSucceedsWithValue(sizeof(to_write)));
+  EXPECT_THAT(PreadFd(fd.get(), &buf, sizeof(buf), 0),
+              SyscallSucceedsWithValue(sizeof(to_write) + 1));
+  EXPECT_EQ(strcmp(buf, "3\n"), 0);
+
+  // At least one SYN must be retransmitted.
+  to_write = '0';
+  EXPECT_THAT(PwriteFd(fd.get(), &to_write, sizeof(to_write), 0),
+              SyscallFailsWithErrno(EINVAL));
+
+  EXPECT_THAT(PwriteFd(fd.get(), initial, initial_len, 0),
+              SyscallSucceedsWithValue(initial_len));
+}
+
 TEST(ProcSysNetIpv4IpForward, Exists) {
   auto fd = ASSERT_NO_ERRNO_AND_VALUE(Open(kIpForward, O_RDONLY));
 }
@@ -16,7 +16,9 @@
 #include <sched.h>
 
 #include "gtest/gtest.h"
+#include "test/util/capability_util.h"
 #include "test/util/test_util.h"
+#include "test/util/thread_util.h"
 
 namespace gvisor {
 namespace testing {
@@ -65,6 +67,102 @@ TEST(SchedGetschedulerTest, ReturnsESRCH) {
   EXPECT_THAT(sched_getscheduler(kImpossiblePID), SyscallFailsWithErrno(ESRCH));
 }
 
+TEST(SchedPriorityTest, Bounds) {
+  EXPECT_THAT(sched_get_priority_max(SCHED_FIFO),
+              SyscallSucceedsWithValue(99));
+  EXPECT_THAT(sched_get_priority_min(SCHED_FIFO), SyscallSucceedsWithValue(1));
+  EXPECT_THAT(sched_get_priority_max(SCHED_RR), SyscallSucceedsWithValue(99));
+  EXPECT_THAT(sched_get_priority_min(SCHED_RR), SyscallSucceedsWithValue(1));
+  EXPECT_THAT(sched_get_priority_max(SCHED_OTHER),
+              SyscallSucceedsWithValue(0));
+  EXPECT_THAT(sched_get_priority_min(SCHED_OTHER),
+              SyscallSucceedsWithValue(0));
+  EXPECT_THAT(sched_get_priority_max(-1), SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(sched_get_priority_min(-1), SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(SchedSetschedulerTest, InvalidPriority) {
+  struct sched_param param = {};
+  param.sched_priority = 1;
+  EXPECT_THAT(sched_setscheduler(0, SCHED_OTHER, &param),
+              SyscallFailsWithErrno(EINVAL));
+  param.sched_priority = 0;
+  EXPECT_THAT(sched_setscheduler(0, SCHED_FIFO, &param),
+              SyscallFailsWithErrno(EINVAL));
+  param.sched_priority = 100;
+  EXPECT_THAT(sched_setscheduler(0, SCHED_FIFO, &param),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(SchedSetschedulerTest, InvalidPolicy) {
+  struct sched_param param = {};
+  EXPECT_THAT(sched_setscheduler(0, -1, &param),
+              SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(sched_setscheduler(0, 4, &param), SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(SchedSetschedulerTest, Batch) {
+  ScopedThread([] {
+    struct sched_param param = {};
+    ASSERT_THAT(sched_setscheduler(0, SCHED_BATCH, &param), SyscallSucceeds());
+    EXPECT_THAT(sched_getscheduler(0), SyscallSucceedsWithValue(SCHED_BATCH));
+    ASSERT_THAT(sched_setscheduler(0, SCHED_OTHER, &param), SyscallSucceeds());
+    EXPECT_THAT(sched_getscheduler(0), SyscallSucceedsWithValue(SCHED_OTHER));
+  });
+}
+
+TEST(SchedSetschedulerTest, RealTime) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_NICE)));
+
+  // Change the policy of a separate thread, so that the test itself does not
+  // run with a real-time policy.
+  ScopedThread([] {
+    struct sched_param param = {};
+    param.sched_priority = 10;
+    ASSERT_THAT(sched_setscheduler(0, SCHED_FIFO, &param), SyscallSucceeds());
+    EXPECT_THAT(sched_getscheduler(0), SyscallSucceedsWithValue(SCHED_FIFO));
+    param = {};
+    EXPECT_THAT(sched_getparam(0, &param), SyscallSucceeds());
+    EXPECT_EQ(param.sched_priority, 10);
+
+    // sched_setparam(2) retains the policy.
+    param.sched_priority = 20;
+    ASSERT_THAT(sched_setparam(0, &param), SyscallSucceeds());
+    EXPECT_THAT(sched_getscheduler(0), SyscallSucceedsWithValue(SCHED_FIFO));
+    param = {};
+    EXPECT_THAT(sched_getparam(0, &param), SyscallSucceeds());
+    EXPECT_EQ(param.sched_priority, 20);
+
+    param.sched_priority = 0;
+    ASSERT_THAT(sched_setscheduler(0, SCHED_OTHER, &param), SyscallSucceeds());
+  });
+}
+
+TEST(SchedSetschedulerTest, ResetOnFork) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_NICE)));
+
+  ScopedThread([] {
+    struct sched_param param = {};
+    param.sched_priority = 10;
+    ASSERT_THAT(sched_setscheduler(0, SCHED_RR | SCHED_RESET_ON_FORK, &param),
+                SyscallSucceeds());
+    EXPECT_THAT(sched_getscheduler(0),
+                SyscallSucceedsWithValue(SCHED_RR | SCHED_RESET_ON_FORK));
+
+    // Threads created by this one revert to SCHED_OTHER.
+    ScopedThread([] {
+      EXPECT_THAT(sched_getscheduler(0),
+                  SyscallSucceedsWithValue(SCHED_OTHER));
+      struct sched_param param = {};
+      EXPECT_THAT(sched_getparam(0, &param), SyscallSucceeds());
+      EXPECT_EQ(param.sched_priority, 0);
+    });
+
+    param.sched_priority = 0;
+    ASSERT_THAT(sched_setscheduler(0, SCHED_OTHER, &param), SyscallSucceeds());
+  });
+}
+
 }  // namespace
 
 }  // namespace testing
@@ -19,6 +19,7 @@
 #include <unistd.h>
 
 #include <iostream>
+#include <string>
 #include <vector>
 
 #include "gtest/gtest.h"
@@ -158,6 +159,92 @@ TEST_P(SendFileTest, SendMultiple) {
   ASSERT_EQ(memcmp(data.data(), actual.data(), data.size()), 0);
 }
 
+// Sends part of a sparse file and verifies the data received, including the
+// zero-filled hole, as well as the updated offsets.
+TEST_P(SendFileTest, SendSparseFileWithOffset) {
+  constexpr int kPageSize = 4096;
+  constexpr int kHoleSize = 3 * kPageSize;
+  const std::string head(kPageSize, 'a');
+  const std::string tail(kPageSize, 'b');
+
+  const TempPath in_file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
+  const FileDescriptor inf =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(in_file.path(), O_RDWR));
+  ASSERT_THAT(pwrite(inf.get(), head.data(), head.size(), 0),
+              SyscallSucceedsWithValue(head.size()));
+  ASSERT_THAT(
+      pwrite(inf.get(), tail.data(), tail.size(), head.size() + kHoleSize),
+      SyscallSucceedsWithValue(tail.size()));
+
+  std::string expected = head + std::string(kHoleSize, '\0') + tail;
+  constexpr off_t kStart = 100;
+  expected = expected.substr(kStart);
+
+  auto socks = ASSERT_NO_ERRNO_AND_VALUE(Sockets(SOCK_STREAM));
+
+  off_t offset = kStart;
+  size_t sent = 0;
+  while (sent < expected.size()) {
+    int n = RetryEINTR(sendfile)(socks->second_fd(), inf.get(), &offset,
+                                 expected.size() - sent);
+    ASSERT_THAT(n, SyscallSucceeds());
+    ASSERT_GT(n, 0);
+    sent += n;
+  }
+  EXPECT_EQ(offset, kStart + expected.size());
+  // The file offset must not change when an offset is passed.
+  EXPECT_THAT(lseek(inf.get(), 0, SEEK_CUR), SyscallSucceedsWithValue(0));
+
+  // Sending at EOF returns 0.
+  EXPECT_THAT(sendfile(socks->second_fd(), inf.get(), &offset, 1),
+              SyscallSucceedsWithValue(0));
+
+  std::string actual(expected.size(), '\0');
+  size_t received = 0;
+  while (received < actual.size()) {
+    int n = RetryEINTR(read)(socks->first_fd(), &actual[received],
+                             actual.size() - received);
+    ASSERT_THAT(n, SyscallSucceeds());
+    ASSERT_GT(n, 0);
+    received += n;
+  }
+  EXPECT_EQ(actual, expected);
+}
+
+// Verifies that sendfile without an offset advances the file offset by the
+// number of bytes sent.
+TEST_P(SendFileTest, SendAdvancesFileOffset) {
+  std::vector<char> data(64 * 1024);
+  RandomizeBuffer(data.data(), data.size());
+  const TempPath in_file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFileWith(
+      GetAbsoluteTestTmpdir(), absl::string_view(data.data(), data.size()),
+      TempPath::kDefaultFileMode));
+  const FileDescriptor inf =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(in_file.path(), O_RDONLY));
+
+  auto socks = ASSERT_NO_ERRNO_AND_VALUE(Sockets(SOCK_STREAM));
+
+  constexpr off_t kStart = 1000;
+  constexpr size_t kCount = 10000;
+  ASSERT_THAT(lseek(inf.get(), kStart, SEEK_SET),
+              SyscallSucceedsWithValue(kStart));
+  ASSERT_THAT(sendfile(socks->second_fd(), inf.get(), nullptr, kCount),
+              SyscallSucceedsWithValue(kCount));
+  EXPECT_THAT(lseek(inf.get(), 0, SEEK_CUR),
+              SyscallSucceedsWithValue(kStart + kCount));
+
+  std::vector<char> actual(kCount);
+  size_t received = 0;
+  while (received < actual.size()) {
+    int n = RetryEINTR(read)(socks->first_fd(), actual.data() + received,
+                             actual.size() - received);
+    ASSERT_THAT(n, SyscallSucceeds());
+    ASSERT_GT(n, 0);
+    received += n;
+  }
+  EXPECT_EQ(memcmp(data.data() + kStart, actual.data(), kCount), 0);
+}
+
 TEST_P(SendFileTest, Shutdown) {
   // Create a socket.
   auto socks = ASSERT_NO_ERRNO_AND_VALUE(Sockets(SOCK_STREAM));
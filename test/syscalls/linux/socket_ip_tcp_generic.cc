@@ -23,6 +23,7 @@
 #include <sys/socket.h>
 #include <sys/types.h>
 #include <sys/un.h>
+#include <unistd.h>
 
 #include "gtest/gtest.h"
 #include "absl/memory/memory.h"
@@ -1512,5 +1513,40 @@ TEST_P(TCPSocketPairTest, WaitTillTimeoutWithCorkOption) {
               SyscallSucceedsWithValue(sizeof(buf)));
 }
 
+TEST_P(TCPSocketPairTest, IncomingCPU) {
+  auto sockets = ASSERT_NO_ERRNO_AND_VALUE(NewSocketPair());
+  const long ncpus = sysconf(_SC_NPROCESSORS_CONF);
+  ASSERT_GT(ncpus, 0);
+
+  for (int fd : {sockets->first_fd(), sockets->second_fd()}) {
+    int cpu = -1;
+    socklen_t len = sizeof(cpu);
+    ASSERT_THAT(getsockopt(fd, SOL_SOCKET, SO_INCOMING_CPU, &cpu, &len),
+                SyscallSucceeds());
+    ASSERT_EQ(len, sizeof(cpu));
+    EXPECT_GE(cpu, 0);
+    EXPECT_LT(cpu, ncpus);
+
+    // The CPU of a flow is stable.
+    int again = -1;
+    ASSERT_THAT(getsockopt(fd, SOL_SOCKET, SO_INCOMING_CPU, &again, &len),
+                SyscallSucceeds());
+    EXPECT_EQ(again, cpu);
+
+    int napi_id = -1;
+    len = sizeof(napi_id);
+    ASSERT_THAT(
+        getsockopt(fd, SOL_SOCKET, SO_INCOMING_NAPI_ID, &napi_id, &len),
+        SyscallSucceeds());
+    EXPECT_GE(napi_id, 0);
+  }
+
+  // Setting the CPU is accepted as a hint.
+  int cpu = 0;
+  EXPECT_THAT(setsockopt(sockets->first_fd(), SOL_SOCKET, SO_INCOMING_CPU,
+                         &cpu, sizeof(cpu)),
+              SyscallSucceeds());
+}
+
 }  // namespace testing
 }  // namespace gvisor
@@ -0,0 +1,188 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <linux/cn_proc.h>
+#include <linux/connector.h>
+#include <linux/netlink.h>
+#include <signal.h>
+#include <sys/socket.h>
+#include <sys/time.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "gtest/gtest.h"
+#include "absl/strings/str_cat.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/linux_capability_util.h"
+#include "test/util/socket_util.h"
+#include "test/util/test_util.h"
+
+// Tests for the process events connector (NETLINK_CONNECTOR, CN_IDX_PROC).
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+struct ProcConnectorMessage {
+  struct nlmsghdr hdr;
+  struct cn_msg msg;
+  enum proc_cn_mcast_op op;
+} __attribute__((packed));
+
+struct ProcConnectorEvent {
+  struct nlmsghdr hdr;
+  struct cn_msg msg;
+  struct proc_event ev;
+} __attribute__((packed));
+
+PosixErrorOr<FileDescriptor> ProcConnectorSocket() {
+  ASSIGN_OR_RETURN_ERRNO(FileDescriptor fd,
+                         Socket(AF_NETLINK, SOCK_DGRAM, NETLINK_CONNECTOR));
+
+  struct sockaddr_nl addr = {};
+  addr.nl_family = AF_NETLINK;
+  addr.nl_groups = CN_IDX_PROC;
+  RETURN_ERROR_IF_SYSCALL_FAIL(
+      bind(fd.get(), reinterpret_cast<struct sockaddr*>(&addr), sizeof(addr)));
+
+  struct timeval tv = {};
+  tv.tv_sec = 5;
+  RETURN_ERROR_IF_SYSCALL_FAIL(
+      setsockopt(fd.get(), SOL_SOCKET, SO_RCVTIMEO, &tv, sizeof(tv)));
+  return fd;
+}
+
+PosixError SendMcastOp(const FileDescriptor& fd, enum proc_cn_mcast_op op,
+                       uint32_t seq) {
+  ProcConnectorMessage req = {};
+  req.hdr.nlmsg_len = sizeof(req);
+  req.hdr.nlmsg_type = NLMSG_DONE;
+  req.hdr.nlmsg_pid = getpid();
+  req.msg.id.idx = CN_IDX_PROC;
+  req.msg.id.val = CN_VAL_PROC;
+  req.msg.seq = seq;
+  req.msg.len = sizeof(req.op);
+  req.op = op;
+  RETURN_ERROR_IF_SYSCALL_FAIL(send(fd.get(), &req, sizeof(req), 0));
+  return NoError();
+}
+
+// Reads events from fd until pred returns true.
+template <typename Pred>
+PosixError ReadEventUntil(const FileDescriptor& fd, Pred pred) {
+  while (true) {
+    ProcConnectorEvent resp = {};
+    int n;
+    RETURN_ERROR_IF_SYSCALL_FAIL(n = recv(fd.get(), &resp, sizeof(resp), 0));
+    if (n < static_cast<int>(sizeof(resp))) {
+      return PosixError(EINVAL, absl::StrCat("short event: ", n));
+    }
+    if (resp.msg.id.idx != CN_IDX_PROC || resp.msg.id.val != CN_VAL_PROC) {
+      return PosixError(EINVAL, "unexpected connector id");
+    }
+    if (pred(resp.msg, resp.ev)) {
+      return NoError();
+    }
+  }
+}
+
+TEST(NetlinkConnectorTest, BindWithoutCapability) {
+  SKIP_IF(ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(
+      Socket(AF_NETLINK, SOCK_DGRAM, NETLINK_CONNECTOR));
+  struct sockaddr_nl addr = {};
+  addr.nl_family = AF_NETLINK;
+  addr.nl_groups = CN_IDX_PROC;
+  EXPECT_THAT(
+      bind(fd.get(), reinterpret_cast<struct sockaddr*>(&addr), sizeof(addr)),
+      SyscallFailsWithErrno(EPERM));
+}
+
+TEST(NetlinkConnectorTest, GetSockNameGroups) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(ProcConnectorSocket());
+  struct sockaddr_nl addr = {};
+  socklen_t addrlen = sizeof(addr);
+  ASSERT_THAT(
+      getsockname(fd.get(), reinterpret_cast<struct sockaddr*>(&addr), &addrlen),
+      SyscallSucceeds());
+  EXPECT_EQ(addr.nl_groups, CN_IDX_PROC);
+}
+
+TEST(NetlinkConnectorTest, ListenAck) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(ProcConnectorSocket());
+  constexpr uint32_t kSeq = 0x1234;
+  ASSERT_NO_ERRNO(SendMcastOp(fd, PROC_CN_MCAST_LISTEN, kSeq));
+  EXPECT_NO_ERRNO(ReadEventUntil(
+      fd, [&](const struct cn_msg& msg, const struct proc_event& ev) {
+        if (ev.what != PROC_EVENT_NONE || msg.seq != kSeq) {
+          return false;
+        }
+        EXPECT_EQ(msg.ack, 1u);
+        EXPECT_EQ(ev.event_data.ack.err, 0u);
+        return true;
+      }));
+  ASSERT_NO_ERRNO(SendMcastOp(fd, PROC_CN_MCAST_IGNORE, kSeq + 1));
+}
+
+TEST(NetlinkConnectorTest, ForkExit) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(ProcConnectorSocket());
+  ASSERT_NO_ERRNO(SendMcastOp(fd, PROC_CN_MCAST_LISTEN, 0));
+
+  pid_t child = fork();
+  if (child == 0) {
+    _exit(7);
+  }
+  ASSERT_THAT(child, SyscallSucceeds());
+  int status;
+  ASSERT_THAT(RetryEINTR(waitpid)(child, &status, 0),
+              SyscallSucceedsWithValue(child));
+
+  EXPECT_NO_ERRNO(ReadEventUntil(
+      fd, [&](const struct cn_msg& msg, const struct proc_event& ev) {
+        if (ev.what != PROC_EVENT_FORK ||
+            ev.event_data.fork.child_pid != child) {
+          return false;
+        }
+        EXPECT_EQ(ev.event_data.fork.child_tgid, child);
+        EXPECT_EQ(ev.event_data.fork.parent_tgid, getpid());
+        return true;
+      }));
+  EXPECT_NO_ERRNO(ReadEventUntil(
+      fd, [&](const struct cn_msg& msg, const struct proc_event& ev) {
+        if (ev.what != PROC_EVENT_EXIT ||
+            ev.event_data.exit.process_pid != child) {
+          return false;
+        }
+        EXPECT_EQ(ev.event_data.exit.process_tgid, child);
+        EXPECT_EQ(ev.event_data.exit.exit_code, static_cast<uint32_t>(7 << 8));
+        EXPECT_EQ(ev.event_data.exit.exit_signal, static_cast<uint32_t>(SIGCHLD));
+        return true;
+      }));
+
+  ASSERT_NO_ERRNO(SendMcastOp(fd, PROC_CN_MCAST_IGNORE, 0));
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
@@ -0,0 +1,305 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <arpa/inet.h>
+#include <linux/inet_diag.h>
+#include <linux/netlink.h>
+#include <linux/sock_diag.h>
+#include <linux/unix_diag.h>
+#include <netinet/in.h>
+#include <netinet/tcp.h>
+#include <sys/socket.h>
+#include <sys/stat.h>
+#include <sys/un.h>
+
+#include <cstring>
+#include <string>
+
+#include "gtest/gtest.h"
+#include "test/syscalls/linux/socket_netlink_util.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/socket_util.h"
+#include "test/util/test_util.h"
+
+// Tests for NETLINK_SOCK_DIAG.
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+constexpr uint32_t kSeq = 12345;
+
+// TCP states, from include/net/tcp_states.h.
+constexpr int kTCPListen = 10;
+constexpr int kTCPClose = 7;
+
+struct InetDiagRequest {
+  struct nlmsghdr hdr;
+  struct inet_diag_req_v2 req;
+};
+
+struct UnixDiagRequest {
+  struct nlmsghdr hdr;
+  struct unix_diag_req req;
+};
+
+InetDiagRequest NewInetDiagRequest(int family, int protocol) {
+  InetDiagRequest req = {};
+  req.hdr.nlmsg_len = sizeof(req);
+  req.hdr.nlmsg_type = SOCK_DIAG_BY_FAMILY;
+  req.hdr.nlmsg_flags = NLM_F_REQUEST | NLM_F_DUMP;
+  req.hdr.nlmsg_seq = kSeq;
+  req.req.sdiag_family = family;
+  req.req.sdiag_protocol = protocol;
+  req.req.idiag_states = ~0U;
+  return req;
+}
+
+UnixDiagRequest NewUnixDiagRequest(uint32_t show) {
+  UnixDiagRequest req = {};
+  req.hdr.nlmsg_len = sizeof(req);
+  req.hdr.nlmsg_type = SOCK_DIAG_BY_FAMILY;
+  req.hdr.nlmsg_flags = NLM_F_REQUEST | NLM_F_DUMP;
+  req.hdr.nlmsg_seq = kSeq;
+  req.req.sdiag_family = AF_UNIX;
+  req.req.udiag_states = ~0U;
+  req.req.udiag_show = show;
+  return req;
+}
+
+PosixErrorOr<ino_t> Inode(const FileDescriptor& fd) {
+  struct stat st;
+  RETURN_ERROR_IF_SYSCALL_FAIL(fstat(fd.get(), &st));
+  return st.st_ino;
+}
+
+// Returns the attribute of type attr in a unix_diag message, or nullptr.
+const struct rtattr* FindUnixDiagAttr(const struct nlmsghdr* hdr,
+                                      uint16_t attr) {
+  int len = hdr->nlmsg_len - NLMSG_LENGTH(sizeof(struct unix_diag_msg));
+  const struct rtattr* rta = reinterpret_cast<const struct rtattr*>(
+      reinterpret_cast<const char*>(NLMSG_DATA(hdr)) +
+      NLMSG_ALIGN(sizeof(struct unix_diag_msg)));
+  for (; RTA_OK(rta, len); rta = RTA_NEXT(rta, len)) {
+    if (rta->rta_type == attr) {
+      return rta;
+    }
+  }
+  return nullptr;
+}
+
+TEST(NetlinkSockDiagTest, DumpTCPListener) {
+  FileDescriptor listener =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_INET, SOCK_STREAM, IPPROTO_TCP));
+  struct sockaddr_in addr = {};
+  addr.sin_family = AF_INET;
+  addr.sin_addr.s_addr = htonl(INADDR_LOOPBACK);
+  ASSERT_THAT(bind(listener.get(), reinterpret_cast<struct sockaddr*>(&addr),
+                   sizeof(addr)),
+              SyscallSucceeds());
+  ASSERT_THAT(listen(listener.get(), 1), SyscallSucceeds());
+  socklen_t addrlen = sizeof(addr);
+  ASSERT_THAT(getsockname(listener.get(),
+                          reinterpret_cast<struct sockaddr*>(&addr), &addrlen),
+              SyscallSucceeds());
+  const ino_t ino = ASSERT_NO_ERRNO_AND_VALUE(Inode(listener));
+
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_SOCK_DIAG));
+  InetDiagRequest req = NewInetDiagRequest(AF_INET, IPPROTO_TCP);
+
+  bool found = false;
+  ASSERT_NO_ERRNO(NetlinkRequestResponse(
+      fd, &req, sizeof(req),
+      [&](const struct nlmsghdr* hdr) {
+        if (hdr->nlmsg_type != SOCK_DIAG_BY_FAMILY) {
+          return;
+        }
+        ASSERT_GE(hdr->nlmsg_len, NLMSG_LENGTH(sizeof(struct inet_diag_msg)));
+        const struct inet_diag_msg* msg =
+            reinterpret_cast<const struct inet_diag_msg*>(NLMSG_DATA(hdr));
+        EXPECT_EQ(msg->idiag_family, AF_INET);
+        if (msg->idiag_inode != ino) {
+          return;
+        }
+        found = true;
+        EXPECT_EQ(msg->idiag_state, kTCPListen);
+        EXPECT_EQ(msg->id.idiag_sport, addr.sin_port);
+        EXPECT_EQ(msg->id.idiag_src[0], addr.sin_addr.s_addr);
+        EXPECT_EQ(msg->id.idiag_dport, 0);
+        EXPECT_EQ(msg->idiag_uid, getuid());
+      },
+      false));
+  EXPECT_TRUE(found);
+}
+
+TEST(NetlinkSockDiagTest, DumpTCPStates) {
+  FileDescriptor listener =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_INET, SOCK_STREAM, IPPROTO_TCP));
+  struct sockaddr_in addr = {};
+  addr.sin_family = AF_INET;
+  addr.sin_addr.s_addr = htonl(INADDR_LOOPBACK);
+  ASSERT_THAT(bind(listener.get(), reinterpret_cast<struct sockaddr*>(&addr),
+                   sizeof(addr)),
+              SyscallSucceeds());
+  ASSERT_THAT(listen(listener.get(), 1), SyscallSucceeds());
+  const ino_t ino = ASSERT_NO_ERRNO_AND_VALUE(Inode(listener));
+
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_SOCK_DIAG));
+  InetDiagRequest req = NewInetDiagRequest(AF_INET, IPPROTO_TCP);
+  req.req.idiag_states = ~(1U << kTCPListen);
+
+  ASSERT_NO_ERRNO(NetlinkRequestResponse(
+      fd, &req, sizeof(req),
+      [&](const struct nlmsghdr* hdr) {
+        if (hdr->nlmsg_type != SOCK_DIAG_BY_FAMILY) {
+          return;
+        }
+        const struct inet_diag_msg* msg =
+            reinterpret_cast<const struct inet_diag_msg*>(NLMSG_DATA(hdr));
+        EXPECT_NE(msg->idiag_state, kTCPListen);
+        EXPECT_NE(msg->idiag_inode, ino);
+      },
+      false));
+}
+
+TEST(NetlinkSockDiagTest, DumpUDP) {
+  FileDescriptor sock =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_INET, SOCK_DGRAM, IPPROTO_UDP));
+  struct sockaddr_in addr = {};
+  addr.sin_family = AF_INET;
+  addr.sin_addr.s_addr = htonl(INADDR_LOOPBACK);
+  ASSERT_THAT(
+      bind(sock.get(), reinterpret_cast<struct sockaddr*>(&addr), sizeof(addr)),
+      SyscallSucceeds());
+  socklen_t addrlen = sizeof(addr);
+  ASSERT_THAT(getsockname(sock.get(), reinterpret_cast<struct sockaddr*>(&addr),
+                          &addrlen),
+              SyscallSucceeds());
+  const ino_t ino = ASSERT_NO_ERRNO_AND_VALUE(Inode(sock));
+
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_SOCK_DIAG));
+  InetDiagRequest req = NewInetDiagRequest(AF_INET, IPPROTO_UDP);
+
+  bool found = false;
+  ASSERT_NO_ERRNO(NetlinkRequestResponse(
+      fd, &req, sizeof(req),
+      [&](const struct nlmsghdr* hdr) {
+        if (hdr->nlmsg_type != SOCK_DIAG_BY_FAMILY) {
+          return;
+        }
+        const struct inet_diag_msg* msg =
+            reinterpret_cast<const struct inet_diag_msg*>(NLMSG_DATA(hdr));
+        if (msg->idiag_inode != ino) {
+          return;
+        }
+        found = true;
+        EXPECT_EQ(msg->idiag_state, kTCPClose);
+        EXPECT_EQ(msg->id.idiag_sport, addr.sin_port);
+      },
+      false));
+  EXPECT_TRUE(found);
+}
+
+TEST(NetlinkSockDiagTest, DumpUnix) {
+  FileDescriptor sock =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_UNIX, SOCK_STREAM, 0));
+  struct sockaddr_un addr = {};
+  addr.sun_family = AF_UNIX;
+  const std::string name = "sock_diag_test";
+  memcpy(addr.sun_path + 1, name.data(), name.size());
+  const socklen_t addrlen = offsetof(struct sockaddr_un, sun_path) + 1 +
+                            name.size();
+  ASSERT_THAT(
+      bind(sock.get(), reinterpret_cast<struct sockaddr*>(&addr), addrlen),
+      SyscallSucceeds());
+  ASSERT_THAT(listen(sock.get(), 1), SyscallSucceeds());
+  const ino_t ino = ASSERT_NO_ERRNO_AND_VALUE(Inode(sock));
+
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_SOCK_DIAG));
+  UnixDiagRequest req = NewUnixDiagRequest(UDIAG_SHOW_NAME | UDIAG_SHOW_UID);
+
+  bool found = false;
+  ASSERT_NO_ERRNO(NetlinkRequestResponse(
+      fd, &req, sizeof(req),
+      [&](const struct nlmsghdr* hdr) {
+        if (hdr->nlmsg_type != SOCK_DIAG_BY_FAMILY) {
+          return;
+        }
+        ASSERT_GE(hdr->nlmsg_len, NLMSG_LENGTH(sizeof(struct unix_diag_msg)));
+        const struct unix_diag_msg* msg =
+            reinterpret_cast<const struct unix_diag_msg*>(NLMSG_DATA(hdr));
+        EXPECT_EQ(msg->udiag_family, AF_UNIX);
+        if (msg->udiag_ino != ino) {
+          return;
+        }
+        found = true;
+        EXPECT_EQ(msg->udiag_type, SOCK_STREAM);
+        EXPECT_EQ(msg->udiag_state, kTCPListen);
+
+        const struct rtattr* rta = FindUnixDiagAttr(hdr, UNIX_DIAG_NAME);
+        ASSERT_NE(rta, nullptr);
+        EXPECT_EQ(std::string(reinterpret_cast<const char*>(RTA_DATA(rta)),
+                              RTA_PAYLOAD(rta)),
+                  std::string(1, '\0') + name);
+
+        rta = FindUnixDiagAttr(hdr, UNIX_DIAG_UID);
+        ASSERT_NE(rta, nullptr);
+        ASSERT_EQ(RTA_PAYLOAD(rta), sizeof(uint32_t));
+        EXPECT_EQ(*reinterpret_cast<const uint32_t*>(RTA_DATA(rta)), getuid());
+      },
+      false));
+  EXPECT_TRUE(found);
+}
+
+TEST(NetlinkSockDiagTest, GetUnixByInode) {
+  int sv[2];
+  ASSERT_THAT(socketpair(AF_UNIX, SOCK_STREAM, 0, sv), SyscallSucceeds());
+  FileDescriptor sock1(sv[0]);
+  FileDescriptor sock2(sv[1]);
+  const ino_t ino = ASSERT_NO_ERRNO_AND_VALUE(Inode(sock1));
+
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_SOCK_DIAG));
+  UnixDiagRequest req = NewUnixDiagRequest(0);
+  req.hdr.nlmsg_flags = NLM_F_REQUEST;
+  req.req.udiag_ino = ino;
+  req.req.udiag_cookie[0] = INET_DIAG_NOCOOKIE;
+  req.req.udiag_cookie[1] = INET_DIAG_NOCOOKIE;
+
+  bool found = false;
+  ASSERT_NO_ERRNO(NetlinkRequestResponse(
+      fd, &req, sizeof(req),
+      [&](const struct nlmsghdr* hdr) {
+        if (hdr->nlmsg_type != SOCK_DIAG_BY_FAMILY) {
+          return;
+        }
+        const struct unix_diag_msg* msg =
+            reinterpret_cast<const struct unix_diag_msg*>(NLMSG_DATA(hdr));
+        EXPECT_EQ(msg->udiag_ino, ino);
+        EXPECT_EQ(msg->udiag_state, TCP_ESTABLISHED);
+        found = true;
+      },
+      false));
+  EXPECT_TRUE(found);
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
@@ -15,11 +15,15 @@
 #include <fcntl.h>
 #include <linux/unistd.h>
 #include <sys/eventfd.h>
+#include <sys/mman.h>
 #include <sys/resource.h>
 #include <sys/sendfile.h>
 #include <sys/time.h>
+#include <sys/uio.h>
 #include <unistd.h>
 
+#include <vector>
+
 #include "gmock/gmock.h"
 #include "gtest/gtest.h"
 #include "absl/cleanup/cleanup.h"
@@ -946,6 +950,155 @@ TEST(SpliceTest, FromPipeWithWriterToDevNull) {
       SyscallFailsWithErrno(EAGAIN));
 }
 
+TEST(VmspliceTest, ToPipe) {
+  int fds[2];
+  ASSERT_THAT(pipe(fds), SyscallSucceeds());
+  const FileDescriptor rfd(fds[0]);
+  const FileDescriptor wfd(fds[1]);
+
+  std::vector<char> first(kPageSize / 2);
+  RandomizeBuffer(first.data(), first.size());
+  std::vector<char> second(kPageSize);
+  RandomizeBuffer(second.data(), second.size());
+  struct iovec iov[2] = {
+      {first.data(), first.size()},
+      {second.data(), second.size()},
+  };
+  EXPECT_THAT(vmsplice(wfd.get(), iov, 2, 0),
+              SyscallSucceedsWithValue(first.size() + second.size()));
+
+  std::vector<char> rbuf(first.size() + second.size());
+  ASSERT_THAT(read(rfd.get(), rbuf.data(), rbuf.size()),
+              SyscallSucceedsWithValue(rbuf.size()));
+  EXPECT_EQ(memcmp(rbuf.data(), first.data(), first.size()), 0);
+  EXPECT_EQ(memcmp(rbuf.data() + first.size(), second.data(), second.size()),
+            0);
+}
+
+TEST(VmspliceTest, ToPipeGift) {
+  int fds[2];
+  ASSERT_THAT(pipe(fds), SyscallSucceeds());
+  const FileDescriptor rfd(fds[0]);
+  const FileDescriptor wfd(fds[1]);
+
+  Mapping m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  RandomizeBuffer(static_cast<char*>(m.ptr()), m.len());
+  std::vector<char> expected(m.view().begin(), m.view().end());
+  struct iovec iov = {m.ptr(), m.len()};
+  EXPECT_THAT(vmsplice(wfd.get(), &iov, 1, SPLICE_F_GIFT),
+              SyscallSucceedsWithValue(kPageSize));
+
+  std::vector<char> rbuf(kPageSize);
+  ASSERT_THAT(read(rfd.get(), rbuf.data(), rbuf.size()),
+              SyscallSucceedsWithValue(kPageSize));
+  EXPECT_EQ(rbuf, expected);
+}
+
+TEST(VmspliceTest, ToPipePartial) {
+  int fds[2];
+  ASSERT_THAT(pipe(fds), SyscallSucceeds());
+  const FileDescriptor rfd(fds[0]);
+  const FileDescriptor wfd(fds[1]);
+
+  // Limit the pipe to two pages, then write one page of data to it.
+  ASSERT_THAT(fcntl(wfd.get(), F_SETPIPE_SZ, 2 * kPageSize),
+              SyscallSucceeds());
+  std::vector<char> buf(kPageSize);
+  ASSERT_THAT(write(wfd.get(), buf.data(), buf.size()),
+              SyscallSucceedsWithValue(kPageSize));
+
+  // vmsplice of two pages should return after transferring the page that
+  // fits.
+  Mapping m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(2 * kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  struct iovec iov = {m.ptr(), m.len()};
+  EXPECT_THAT(vmsplice(wfd.get(), &iov, 1, 0),
+              SyscallSucceedsWithValue(kPageSize));
+
+  // The pipe is now full.
+  EXPECT_THAT(vmsplice(wfd.get(), &iov, 1, SPLICE_F_NONBLOCK),
+              SyscallFailsWithErrno(EAGAIN));
+}
+
+TEST(VmspliceTest, FromPipe) {
+  int fds[2];
+  ASSERT_THAT(pipe(fds), SyscallSucceeds());
+  const FileDescriptor rfd(fds[0]);
+  FileDescriptor wfd(fds[1]);
+
+  std::vector<char> buf(kPageSize);
+  RandomizeBuffer(buf.data(), buf.size());
+  ASSERT_THAT(write(wfd.get(), buf.data(), buf.size()),
+              SyscallSucceedsWithValue(kPageSize));
+
+  // vmsplice from the pipe returns the data available without waiting for
+  // more.
+  std::vector<char> first(kPageSize / 4);
+  std::vector<char> second(kPageSize);
+  struct iovec iov[2] = {
+      {first.data(), first.size()},
+      {second.data(), second.size()},
+  };
+  EXPECT_THAT(vmsplice(rfd.get(), iov, 2, 0),
+              SyscallSucceedsWithValue(kPageSize));
+  EXPECT_EQ(memcmp(first.data(), buf.data(), first.size()), 0);
+  EXPECT_EQ(memcmp(second.data(), buf.data() + first.size(),
+                   buf.size() - first.size()),
+            0);
+
+  // The pipe is now empty.
+  EXPECT_THAT(vmsplice(rfd.get(), iov, 2, SPLICE_F_NONBLOCK),
+              SyscallFailsWithErrno(EAGAIN));
+
+  // Once the write end is closed, vmsplice returns EOF.
+  wfd.reset();
+  EXPECT_THAT(vmsplice(rfd.get(), iov, 2, 0), SyscallSucceedsWithValue(0));
+}
+
+TEST(VmspliceTest, FromPipeBlocking) {
+  int fds[2];
+  ASSERT_THAT(pipe(fds), SyscallSucceeds());
+  const FileDescriptor rfd(fds[0]);
+  const FileDescriptor wfd(fds[1]);
+
+  std::vector<char> buf(kPageSize);
+  RandomizeBuffer(buf.data(), buf.size());
+  ScopedThread t([&]() {
+    absl::SleepFor(absl::Milliseconds(100));
+    ASSERT_THAT(write(wfd.get(), buf.data(), buf.size()),
+                SyscallSucceedsWithValue(kPageSize));
+  });
+
+  std::vector<char> rbuf(kPageSize);
+  struct iovec iov = {rbuf.data(), rbuf.size()};
+  EXPECT_THAT(vmsplice(rfd.get(), &iov, 1, 0),
+              SyscallSucceedsWithValue(kPageSize));
+  EXPECT_EQ(rbuf, buf);
+}
+
+TEST(VmspliceTest, InvalidFlags) {
+  int fds[2];
+  ASSERT_THAT(pipe(fds), SyscallSucceeds());
+  const FileDescriptor rfd(fds[0]);
+  const FileDescriptor wfd(fds[1]);
+
+  char c = 0;
+  struct iovec iov = {&c, 1};
+  EXPECT_THAT(vmsplice(wfd.get(), &iov, 1, 0x100),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(VmspliceTest, NotPipe) {
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_RDWR));
+
+  char c = 0;
+  struct iovec iov = {&c, 1};
+  EXPECT_THAT(vmsplice(fd.get(), &iov, 1, 0), SyscallFailsWithErrno(EBADF));
+}
+
 }  // namespace
 
 }  // namespace testing
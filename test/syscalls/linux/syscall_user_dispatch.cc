@@ -0,0 +1,168 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <linux/audit.h>
+#include <signal.h>
+#include <sys/prctl.h>
+#include <sys/syscall.h>
+#include <sys/wait.h>
+#include <ucontext.h>
+#include <unistd.h>
+
+#include "gtest/gtest.h"
+#include "test/util/logging.h"
+#include "test/util/test_util.h"
+
+#ifndef PR_SET_SYSCALL_USER_DISPATCH
+#define PR_SET_SYSCALL_USER_DISPATCH 59
+#define PR_SYS_DISPATCH_OFF 0
+#define PR_SYS_DISPATCH_ON 1
+#define SYSCALL_DISPATCH_FILTER_ALLOW 0
+#define SYSCALL_DISPATCH_FILTER_BLOCK 1
+#endif
+
+#ifndef SYS_USER_DISPATCH
+#define SYS_USER_DISPATCH 2
+#endif
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+// The value returned by dispatched syscalls.
+constexpr long kDispatchedReturn = 12345;
+
+// selector is the selector byte used by the tests.
+volatile char selector = SYSCALL_DISPATCH_FILTER_ALLOW;
+
+// Emulates getppid(2) from the SIGSYS handler. Async-signal-safe.
+void DispatchHandler(int signo, siginfo_t* info, void* ucv) {
+  // Syscalls made by the handler, including rt_sigreturn, must be allowed.
+  selector = SYSCALL_DISPATCH_FILTER_ALLOW;
+
+  ucontext_t* uc = static_cast<ucontext_t*>(ucv);
+  TEST_CHECK(info->si_signo == SIGSYS);
+  TEST_CHECK(info->si_code == SYS_USER_DISPATCH);
+  TEST_CHECK(info->si_call_addr != nullptr);
+  TEST_CHECK(info->si_syscall == SYS_getppid);
+#if defined(__x86_64__)
+  TEST_CHECK(info->si_arch == AUDIT_ARCH_X86_64);
+  // The registers are those of the syscall.
+  TEST_CHECK(uc->uc_mcontext.gregs[REG_RAX] == SYS_getppid);
+  uc->uc_mcontext.gregs[REG_RAX] = kDispatchedReturn;
+#elif defined(__aarch64__)
+  TEST_CHECK(info->si_arch == AUDIT_ARCH_AARCH64);
+  TEST_CHECK(uc->uc_mcontext.regs[8] == SYS_getppid);
+  uc->uc_mcontext.regs[0] = kDispatchedReturn;
+#endif  // defined(__x86_64__)
+}
+
+void RegisterSignalHandler(int signum,
+                           void (*handler)(int, siginfo_t*, void*)) {
+  struct sigaction sa = {};
+  sa.sa_sigaction = handler;
+  sigemptyset(&sa.sa_mask);
+  sa.sa_flags = SA_SIGINFO;
+  TEST_PCHECK(sigaction(signum, &sa, nullptr) == 0);
+}
+
+// Forks a child that runs fn and returns the child's wait status.
+template <typename F>
+int RunInChild(F fn) {
+  pid_t const pid = fork();
+  if (pid == 0) {
+    fn();
+    _exit(0);
+  }
+  TEST_PCHECK(pid > 0);
+  int status;
+  TEST_PCHECK(waitpid(pid, &status, 0) == pid);
+  return status;
+}
+
+TEST(SyscallUserDispatchTest, InvalidArguments) {
+  EXPECT_THAT(prctl(PR_SET_SYSCALL_USER_DISPATCH, PR_SYS_DISPATCH_OFF, 1, 0, 0),
+              SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(prctl(PR_SET_SYSCALL_USER_DISPATCH, 2, 0, 0, 0),
+              SyscallFailsWithErrno(EINVAL));
+  // The allowed range must not wrap around.
+  EXPECT_THAT(prctl(PR_SET_SYSCALL_USER_DISPATCH, PR_SYS_DISPATCH_ON,
+                    ~0UL - 1, 16, 0),
+              SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(prctl(PR_SET_SYSCALL_USER_DISPATCH, PR_SYS_DISPATCH_OFF, 0, 0, 0),
+              SyscallSucceeds());
+}
+
+TEST(SyscallUserDispatchTest, BlockedSyscallIsDispatched) {
+  int const status = RunInChild([] {
+    RegisterSignalHandler(SIGSYS, DispatchHandler);
+    selector = SYSCALL_DISPATCH_FILTER_ALLOW;
+    TEST_PCHECK(prctl(PR_SET_SYSCALL_USER_DISPATCH, PR_SYS_DISPATCH_ON, 0, 0,
+                      &selector) == 0);
+
+    // Allowed syscalls are executed.
+    TEST_CHECK(syscall(SYS_getppid) == getppid());
+
+    selector = SYSCALL_DISPATCH_FILTER_BLOCK;
+    long const ret = syscall(SYS_getppid);
+    TEST_CHECK(selector == SYSCALL_DISPATCH_FILTER_ALLOW);
+    TEST_CHECK(ret == kDispatchedReturn);
+
+    TEST_PCHECK(prctl(PR_SET_SYSCALL_USER_DISPATCH, PR_SYS_DISPATCH_OFF, 0, 0,
+                      0) == 0);
+  });
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 0)
+      << "status " << status;
+}
+
+TEST(SyscallUserDispatchTest, InvalidSelectorKills) {
+  int const status = RunInChild([] {
+    // The signal is fatal even if it is handled.
+    RegisterSignalHandler(SIGSYS, +[](int, siginfo_t*, void*) { _exit(1); });
+    selector = SYSCALL_DISPATCH_FILTER_BLOCK + 1;
+    TEST_PCHECK(prctl(PR_SET_SYSCALL_USER_DISPATCH, PR_SYS_DISPATCH_ON, 0, 0,
+                      &selector) == 0);
+    syscall(SYS_getppid);
+    _exit(2);
+  });
+  EXPECT_TRUE(WIFSIGNALED(status) && WTERMSIG(status) == SIGSYS)
+      << "status " << status;
+}
+
+TEST(SyscallUserDispatchTest, NotInheritedByChildren) {
+  int const status = RunInChild([] {
+    RegisterSignalHandler(SIGSYS, +[](int, siginfo_t*, void*) { _exit(1); });
+    selector = SYSCALL_DISPATCH_FILTER_ALLOW;
+    TEST_PCHECK(prctl(PR_SET_SYSCALL_USER_DISPATCH, PR_SYS_DISPATCH_ON, 0, 0,
+                      &selector) == 0);
+    pid_t const pid = fork();
+    if (pid == 0) {
+      selector = SYSCALL_DISPATCH_FILTER_BLOCK;
+      syscall(SYS_getppid);
+      _exit(0);
+    }
+    TEST_PCHECK(pid > 0);
+    int child_status;
+    TEST_PCHECK(waitpid(pid, &child_status, 0) == pid);
+    TEST_CHECK(WIFEXITED(child_status) && WEXITSTATUS(child_status) == 0);
+  });
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 0)
+      << "status " << status;
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
@@ -25,6 +25,7 @@
 #include <netinet/tcp.h>
 #include <poll.h>
 #include <sys/ioctl.h>
+#include <sys/mman.h>
 #include <sys/socket.h>
 #include <unistd.h>
 
@@ -804,6 +805,88 @@ TEST_P(TcpSocketTest, TcpInq) {
   }
 }
 
+#ifndef TCP_ZEROCOPY_RECEIVE
+#define TCP_ZEROCOPY_RECEIVE 35
+#endif
+
+// Mirrors struct tcp_zerocopy_receive from linux/tcp.h, which conflicts with
+// netinet/tcp.h.
+struct TcpZeroCopyReceive {
+  uint64_t address;
+  uint32_t length;
+  uint32_t recv_skip_hint;
+  uint32_t inq;
+  int32_t err;
+  uint64_t copybuf_address;
+  int32_t copybuf_len;
+  uint32_t flags;
+  uint64_t msg_control;
+  uint64_t msg_controllen;
+  uint32_t msg_flags;
+  uint32_t reserved;
+};
+
+TEST_P(TcpSocketTest, ZeroCopyReceiveRequiresReadOnlyMapping) {
+  SKIP_IF(IsRunningWithHostinet());
+
+  EXPECT_THAT(mmap(nullptr, kPageSize, PROT_READ | PROT_WRITE, MAP_SHARED,
+                   accepted_.get(), 0),
+              SyscallFailsWithErrno(EPERM));
+}
+
+TEST_P(TcpSocketTest, ZeroCopyReceive) {
+  // Linux only maps page-aligned fragments of received packets, which
+  // loopback doesn't guarantee, so the mapped length is only deterministic
+  // on gVisor.
+  SKIP_IF(!IsRunningOnGvisor() || IsRunningWithHostinet());
+
+  const size_t kExtra = 100;
+  const size_t size = 2 * kPageSize + kExtra;
+  std::vector<char> buf(size);
+  RandomizeBuffer(buf.data(), buf.size());
+  ASSERT_THAT(WriteFd(connected_.get(), buf.data(), buf.size()),
+              SyscallSucceedsWithValue(buf.size()));
+
+  // Wait for all the data to be received.
+  int inq = 0;
+  for (const auto start = absl::Now();
+       absl::Now() <= start + absl::Milliseconds(kTimeoutMillis);) {
+    ASSERT_THAT(ioctl(accepted_.get(), TIOCINQ, &inq), SyscallSucceeds());
+    if (static_cast<size_t>(inq) == size) {
+      break;
+    }
+    absl::SleepFor(absl::Milliseconds(10));
+  }
+  ASSERT_EQ(static_cast<size_t>(inq), size);
+
+  const size_t map_len = 4 * kPageSize;
+  void* addr = mmap(nullptr, map_len, PROT_READ, MAP_SHARED, accepted_.get(),
+                    0);
+  ASSERT_NE(addr, MAP_FAILED) << "mmap failed: " << strerror(errno);
+
+  TcpZeroCopyReceive zc = {};
+  zc.address = reinterpret_cast<uint64_t>(addr);
+  zc.length = map_len;
+  socklen_t zc_len = sizeof(zc);
+  ASSERT_THAT(getsockopt(accepted_.get(), IPPROTO_TCP, TCP_ZEROCOPY_RECEIVE,
+                         &zc, &zc_len),
+              SyscallSucceeds());
+  EXPECT_EQ(zc_len, sizeof(zc));
+  EXPECT_EQ(zc.err, 0);
+  ASSERT_EQ(zc.length, 2 * kPageSize);
+  EXPECT_EQ(zc.recv_skip_hint, kExtra);
+  EXPECT_EQ(zc.inq, kExtra);
+  EXPECT_EQ(memcmp(addr, buf.data(), zc.length), 0);
+
+  // The data that wasn't mapped is read normally.
+  std::vector<char> rest(kExtra);
+  ASSERT_THAT(RetryEINTR(recv)(accepted_.get(), rest.data(), rest.size(), 0),
+              SyscallSucceedsWithValue(kExtra));
+  EXPECT_EQ(memcmp(rest.data(), buf.data() + zc.length, kExtra), 0);
+
+  EXPECT_THAT(munmap(addr, map_len), SyscallSucceeds());
+}
+
 TEST_P(TcpSocketTest, Tiocinq) {
   char buf[1024];
   int size = sizeof(buf);
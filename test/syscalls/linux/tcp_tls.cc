@@ -0,0 +1,290 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <linux/tls.h>
+#include <netinet/in.h>
+#include <netinet/tcp.h>
+#include <sys/socket.h>
+#include <unistd.h>
+
+#include <cstring>
+#include <string>
+#include <vector>
+
+#include "gtest/gtest.h"
+#include "test/syscalls/linux/ip_socket_test_util.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/socket_util.h"
+#include "test/util/test_util.h"
+
+#ifndef SOL_TLS
+#define SOL_TLS 282
+#endif
+
+#ifndef TCP_ULP
+#define TCP_ULP 31
+#endif
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+constexpr uint8_t kRecordTypeHandshake = 0x16;
+constexpr uint8_t kRecordTypeData = 0x17;
+constexpr int kHeaderSize = 5;
+constexpr int kTagSize = 16;
+
+tls12_crypto_info_aes_gcm_128 CryptoInfo(uint16_t version, uint8_t key_byte) {
+  tls12_crypto_info_aes_gcm_128 info = {};
+  info.info.version = version;
+  info.info.cipher_type = TLS_CIPHER_AES_GCM_128;
+  memset(info.key, key_byte, sizeof(info.key));
+  memset(info.iv, 0x01, sizeof(info.iv));
+  memset(info.salt, 0x02, sizeof(info.salt));
+  return info;
+}
+
+PosixError EnableTLS(int fd) {
+  constexpr char kTLS[] = "tls";
+  RETURN_ERROR_IF_SYSCALL_FAIL(
+      setsockopt(fd, SOL_TCP, TCP_ULP, kTLS, sizeof(kTLS)));
+  return NoError();
+}
+
+PosixError SetCryptoInfo(int fd, int direction,
+                         const tls12_crypto_info_aes_gcm_128& info) {
+  RETURN_ERROR_IF_SYSCALL_FAIL(
+      setsockopt(fd, SOL_TLS, direction, &info, sizeof(info)));
+  return NoError();
+}
+
+class TCPTLSTest : public ::testing::TestWithParam<uint16_t> {
+ protected:
+  void SetUp() override {
+    sockets_ =
+        ASSERT_NO_ERRNO_AND_VALUE(IPv4TCPAcceptBindSocketPair(0).Create());
+    const PosixError err = EnableTLS(sockets_->first_fd());
+    if (!err.ok()) {
+      // The host kernel may not have the tls module loaded.
+      SKIP_IF(!IsRunningOnGvisor());
+      ASSERT_NO_ERRNO(err);
+    }
+    ASSERT_NO_ERRNO(EnableTLS(sockets_->second_fd()));
+  }
+
+  std::unique_ptr<SocketPair> sockets_;
+};
+
+TEST_P(TCPTLSTest, RoundTrip) {
+  auto info = CryptoInfo(GetParam(), 0xAA);
+  ASSERT_NO_ERRNO(SetCryptoInfo(sockets_->first_fd(), TLS_TX, info));
+  ASSERT_NO_ERRNO(SetCryptoInfo(sockets_->second_fd(), TLS_RX, info));
+
+  constexpr char kData[] = "hello, kernel TLS";
+  ASSERT_THAT(WriteFd(sockets_->first_fd(), kData, sizeof(kData)),
+              SyscallSucceedsWithValue(sizeof(kData)));
+
+  char buf[sizeof(kData)] = {};
+  ASSERT_THAT(
+      RetryEINTR(recv)(sockets_->second_fd(), buf, sizeof(buf), MSG_WAITALL),
+      SyscallSucceedsWithValue(sizeof(kData)));
+  EXPECT_EQ(memcmp(buf, kData, sizeof(kData)), 0);
+}
+
+TEST_P(TCPTLSTest, LargeWriteIsSplitIntoRecords) {
+  auto info = CryptoInfo(GetParam(), 0xAA);
+  ASSERT_NO_ERRNO(SetCryptoInfo(sockets_->first_fd(), TLS_TX, info));
+  ASSERT_NO_ERRNO(SetCryptoInfo(sockets_->second_fd(), TLS_RX, info));
+
+  std::vector<char> data(3 * (1 << 14) + 100);
+  RandomizeBuffer(data.data(), data.size());
+  ASSERT_THAT(WriteFd(sockets_->first_fd(), data.data(), data.size()),
+              SyscallSucceedsWithValue(data.size()));
+
+  std::vector<char> buf(data.size());
+  ASSERT_THAT(RetryEINTR(recv)(sockets_->second_fd(), buf.data(), buf.size(),
+                               MSG_WAITALL),
+              SyscallSucceedsWithValue(buf.size()));
+  EXPECT_EQ(buf, data);
+}
+
+TEST_P(TCPTLSTest, RecordFraming) {
+  auto info = CryptoInfo(GetParam(), 0xAA);
+  ASSERT_NO_ERRNO(SetCryptoInfo(sockets_->first_fd(), TLS_TX, info));
+
+  constexpr char kData[] = "abc";
+  ASSERT_THAT(WriteFd(sockets_->first_fd(), kData, sizeof(kData)),
+              SyscallSucceedsWithValue(sizeof(kData)));
+
+  // Without TLS_RX, the peer receives the raw record.
+  int overhead = GetParam() == TLS_1_2_VERSION
+                     ? TLS_CIPHER_AES_GCM_128_IV_SIZE + kTagSize
+                     : 1 + kTagSize;
+  std::vector<uint8_t> record(kHeaderSize + sizeof(kData) + overhead);
+  ASSERT_THAT(RetryEINTR(recv)(sockets_->second_fd(), record.data(),
+                               record.size(), MSG_WAITALL),
+              SyscallSucceedsWithValue(record.size()));
+  EXPECT_EQ(record[0], kRecordTypeData);
+  EXPECT_EQ(record[1], 0x03);
+  EXPECT_EQ(record[2], 0x03);
+  EXPECT_EQ((record[3] << 8) | record[4], sizeof(kData) + overhead);
+  if (GetParam() == TLS_1_2_VERSION) {
+    // The explicit nonce is sent in the clear.
+    EXPECT_EQ(memcmp(&record[kHeaderSize], info.iv, sizeof(info.iv)), 0);
+  }
+
+  // The record sequence number advanced.
+  tls12_crypto_info_aes_gcm_128 got = {};
+  socklen_t len = sizeof(got);
+  ASSERT_THAT(getsockopt(sockets_->first_fd(), SOL_TLS, TLS_TX, &got, &len),
+              SyscallSucceeds());
+  EXPECT_EQ(len, sizeof(got));
+  EXPECT_EQ(got.info.version, GetParam());
+  EXPECT_EQ(got.info.cipher_type, TLS_CIPHER_AES_GCM_128);
+  EXPECT_EQ(got.rec_seq[7], 1);
+}
+
+TEST_P(TCPTLSTest, RecordType) {
+  auto info = CryptoInfo(GetParam(), 0xAA);
+  ASSERT_NO_ERRNO(SetCryptoInfo(sockets_->first_fd(), TLS_TX, info));
+  ASSERT_NO_ERRNO(SetCryptoInfo(sockets_->second_fd(), TLS_RX, info));
+
+  // Send a handshake record followed by application data.
+  constexpr char kHandshake[] = "handshake";
+  char cbuf[CMSG_SPACE(sizeof(uint8_t))] = {};
+  struct iovec iov = {const_cast<char*>(kHandshake), sizeof(kHandshake)};
+  struct msghdr msg = {};
+  msg.msg_iov = &iov;
+  msg.msg_iovlen = 1;
+  msg.msg_control = cbuf;
+  msg.msg_controllen = sizeof(cbuf);
+  struct cmsghdr* cmsg = CMSG_FIRSTHDR(&msg);
+  cmsg->cmsg_level = SOL_TLS;
+  cmsg->cmsg_type = TLS_SET_RECORD_TYPE;
+  cmsg->cmsg_len = CMSG_LEN(sizeof(uint8_t));
+  *CMSG_DATA(cmsg) = kRecordTypeHandshake;
+  ASSERT_THAT(RetryEINTR(sendmsg)(sockets_->first_fd(), &msg, 0),
+              SyscallSucceedsWithValue(sizeof(kHandshake)));
+
+  constexpr char kData[] = "data";
+  ASSERT_THAT(WriteFd(sockets_->first_fd(), kData, sizeof(kData)),
+              SyscallSucceedsWithValue(sizeof(kData)));
+
+  // Non-data records can't be read without room for the record type.
+  char buf[64] = {};
+  EXPECT_THAT(ReadFd(sockets_->second_fd(), buf, sizeof(buf)),
+              SyscallFailsWithErrno(EIO));
+
+  // Record types aren't mixed in a single read, even with MSG_WAITALL.
+  char rcbuf[CMSG_SPACE(sizeof(uint8_t))] = {};
+  iov = {buf, sizeof(buf)};
+  msg = {};
+  msg.msg_iov = &iov;
+  msg.msg_iovlen = 1;
+  msg.msg_control = rcbuf;
+  msg.msg_controllen = sizeof(rcbuf);
+  ASSERT_THAT(RetryEINTR(recvmsg)(sockets_->second_fd(), &msg, MSG_WAITALL),
+              SyscallSucceedsWithValue(sizeof(kHandshake)));
+  EXPECT_EQ(memcmp(buf, kHandshake, sizeof(kHandshake)), 0);
+  cmsg = CMSG_FIRSTHDR(&msg);
+  ASSERT_NE(cmsg, nullptr);
+  EXPECT_EQ(cmsg->cmsg_level, SOL_TLS);
+  EXPECT_EQ(cmsg->cmsg_type, TLS_GET_RECORD_TYPE);
+  EXPECT_EQ(*CMSG_DATA(cmsg), kRecordTypeHandshake);
+
+  ASSERT_THAT(ReadFd(sockets_->second_fd(), buf, sizeof(buf)),
+              SyscallSucceedsWithValue(sizeof(kData)));
+  EXPECT_EQ(memcmp(buf, kData, sizeof(kData)), 0);
+}
+
+TEST_P(TCPTLSTest, BadKey) {
+  ASSERT_NO_ERRNO(SetCryptoInfo(sockets_->first_fd(), TLS_TX,
+                                CryptoInfo(GetParam(), 0xAA)));
+  ASSERT_NO_ERRNO(SetCryptoInfo(sockets_->second_fd(), TLS_RX,
+                                CryptoInfo(GetParam(), 0xBB)));
+
+  constexpr char kData[] = "secret";
+  ASSERT_THAT(WriteFd(sockets_->first_fd(), kData, sizeof(kData)),
+              SyscallSucceedsWithValue(sizeof(kData)));
+
+  char buf[sizeof(kData)] = {};
+  EXPECT_THAT(RetryEINTR(recv)(sockets_->second_fd(), buf, sizeof(buf), 0),
+              SyscallFailsWithErrno(EBADMSG));
+}
+
+TEST_P(TCPTLSTest, SetTwice) {
+  auto info = CryptoInfo(GetParam(), 0xAA);
+  ASSERT_NO_ERRNO(SetCryptoInfo(sockets_->first_fd(), TLS_TX, info));
+  EXPECT_THAT(setsockopt(sockets_->first_fd(), SOL_TLS, TLS_TX, &info,
+                         sizeof(info)),
+              SyscallFailsWithErrno(EBUSY));
+}
+
+TEST_P(TCPTLSTest, InvalidCryptoInfo) {
+  auto info = CryptoInfo(GetParam(), 0xAA);
+  EXPECT_THAT(setsockopt(sockets_->first_fd(), SOL_TLS, TLS_TX, &info,
+                         sizeof(info) - 1),
+              SyscallFailsWithErrno(EINVAL));
+
+  info.info.version = 0x0301;
+  EXPECT_THAT(setsockopt(sockets_->first_fd(), SOL_TLS, TLS_TX, &info,
+                         sizeof(info)),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST_P(TCPTLSTest, GetULP) {
+  char name[16] = {};
+  socklen_t len = sizeof(name);
+  ASSERT_THAT(getsockopt(sockets_->first_fd(), SOL_TCP, TCP_ULP, name, &len),
+              SyscallSucceeds());
+  EXPECT_EQ(std::string(name, strnlen(name, len)), "tls");
+}
+
+INSTANTIATE_TEST_SUITE_P(AllTCPTLSTests, TCPTLSTest,
+                         ::testing::Values(TLS_1_2_VERSION, TLS_1_3_VERSION));
+
+TEST(TCPTLSSetupTest, ULPRequiresConnection) {
+  // Without the tls module loaded, Linux fails with ENOENT instead.
+  SKIP_IF(!IsRunningOnGvisor());
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_INET, SOCK_STREAM, IPPROTO_TCP));
+  constexpr char kTLS[] = "tls";
+  EXPECT_THAT(setsockopt(fd.get(), SOL_TCP, TCP_ULP, kTLS, sizeof(kTLS)),
+              SyscallFailsWithErrno(ENOTCONN));
+}
+
+TEST(TCPTLSSetupTest, UnknownULP) {
+  SKIP_IF(!IsRunningOnGvisor());
+  auto sockets =
+      ASSERT_NO_ERRNO_AND_VALUE(IPv4TCPAcceptBindSocketPair(0).Create());
+  constexpr char kULP[] = "nonexistent";
+  EXPECT_THAT(
+      setsockopt(sockets->first_fd(), SOL_TCP, TCP_ULP, kULP, sizeof(kULP)),
+      SyscallFailsWithErrno(ENOENT));
+}
+
+TEST(TCPTLSSetupTest, TLSRequiresULP) {
+  auto sockets =
+      ASSERT_NO_ERRNO_AND_VALUE(IPv4TCPAcceptBindSocketPair(0).Create());
+  auto info = CryptoInfo(TLS_1_2_VERSION, 0xAA);
+  EXPECT_THAT(setsockopt(sockets->first_fd(), SOL_TLS, TLS_TX, &info,
+                         sizeof(info)),
+              SyscallFailsWithErrno(ENOPROTOOPT));
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
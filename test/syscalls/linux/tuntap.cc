@@ -24,6 +24,7 @@
 #include <sys/ioctl.h>
 #include <sys/socket.h>
 #include <sys/types.h>
+#include <unistd.h>
 
 #include <cstddef>
 #include <cstring>
@@ -697,5 +698,122 @@ TEST_F(TuntapTest, RawPacketSocket) {
   }
 }
 
+TEST_F(TuntapTest, GetFeatures) {
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(Open(kDevNetTun, O_RDWR));
+
+  unsigned int features = 0;
+  ASSERT_THAT(ioctl(fd.get(), TUNGETFEATURES, &features), SyscallSucceeds());
+  constexpr unsigned int kWant =
+      IFF_TUN | IFF_TAP | IFF_NO_PI | IFF_ONE_QUEUE | IFF_MULTI_QUEUE;
+  EXPECT_EQ(features & kWant, kWant);
+}
+
+TEST_F(TuntapTest, SingleQueueBusy) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+
+  struct ifreq ifr = {};
+  ifr.ifr_flags = IFF_TUN | IFF_NO_PI;
+  strncpy(ifr.ifr_name, kTunName, IFNAMSIZ);
+
+  FileDescriptor fd1 = ASSERT_NO_ERRNO_AND_VALUE(Open(kDevNetTun, O_RDWR));
+  ASSERT_THAT(ioctl(fd1.get(), TUNSETIFF, &ifr), SyscallSucceeds());
+
+  FileDescriptor fd2 = ASSERT_NO_ERRNO_AND_VALUE(Open(kDevNetTun, O_RDWR));
+  EXPECT_THAT(ioctl(fd2.get(), TUNSETIFF, &ifr), SyscallFailsWithErrno(EBUSY));
+}
+
+TEST_F(TuntapTest, MultiQueue) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+
+  struct ifreq ifr = {};
+  ifr.ifr_flags = IFF_TUN | IFF_NO_PI | IFF_MULTI_QUEUE;
+  strncpy(ifr.ifr_name, kTunName, IFNAMSIZ);
+
+  FileDescriptor fd1 = ASSERT_NO_ERRNO_AND_VALUE(Open(kDevNetTun, O_RDWR));
+  ASSERT_THAT(ioctl(fd1.get(), TUNSETIFF, &ifr), SyscallSucceeds());
+  FileDescriptor fd2 = ASSERT_NO_ERRNO_AND_VALUE(Open(kDevNetTun, O_RDWR));
+  ASSERT_THAT(ioctl(fd2.get(), TUNSETIFF, &ifr), SyscallSucceeds());
+
+  struct ifreq ifr_get = {};
+  ASSERT_THAT(ioctl(fd2.get(), TUNGETIFF, &ifr_get), SyscallSucceeds());
+  EXPECT_STREQ(ifr_get.ifr_name, kTunName);
+  EXPECT_NE(ifr_get.ifr_flags & IFF_MULTI_QUEUE, 0);
+
+  // All queues of an interface must agree on IFF_MULTI_QUEUE.
+  struct ifreq ifr_single = ifr;
+  ifr_single.ifr_flags &= ~IFF_MULTI_QUEUE;
+  FileDescriptor fd3 = ASSERT_NO_ERRNO_AND_VALUE(Open(kDevNetTun, O_RDWR));
+  EXPECT_THAT(ioctl(fd3.get(), TUNSETIFF, &ifr_single),
+              SyscallFailsWithErrno(EINVAL));
+
+  // A detached queue can't be used until it is attached again.
+  struct ifreq ifr_queue = {};
+  ifr_queue.ifr_flags = IFF_DETACH_QUEUE;
+  ASSERT_THAT(ioctl(fd2.get(), TUNSETQUEUE, &ifr_queue), SyscallSucceeds());
+  EXPECT_THAT(ioctl(fd2.get(), TUNSETQUEUE, &ifr_queue),
+              SyscallFailsWithErrno(EINVAL));
+  char buf[128] = {};
+  EXPECT_THAT(read(fd2.get(), buf, sizeof(buf)),
+              SyscallFailsWithErrno(EBADFD));
+
+  ifr_queue.ifr_flags = IFF_ATTACH_QUEUE;
+  ASSERT_THAT(ioctl(fd2.get(), TUNSETQUEUE, &ifr_queue), SyscallSucceeds());
+  EXPECT_THAT(ioctl(fd2.get(), TUNSETQUEUE, &ifr_queue),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST_F(TuntapTest, Persist) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+
+  struct ifreq ifr = {};
+  ifr.ifr_flags = IFF_TAP;
+  strncpy(ifr.ifr_name, kTapName, IFNAMSIZ);
+
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(Open(kDevNetTun, O_RDWR));
+  ASSERT_THAT(ioctl(fd.get(), TUNSETIFF, &ifr), SyscallSucceeds());
+  ASSERT_THAT(ioctl(fd.get(), TUNSETPERSIST, 1), SyscallSucceeds());
+
+  struct ifreq ifr_get = {};
+  ASSERT_THAT(ioctl(fd.get(), TUNGETIFF, &ifr_get), SyscallSucceeds());
+  EXPECT_NE(ifr_get.ifr_flags & IFF_PERSIST, 0);
+
+  // The interface outlives the file.
+  fd.reset();
+  EXPECT_THAT(DumpLinkNames(),
+              IsPosixErrorOkAndHolds(::testing::Contains(kTapName)));
+
+  fd = ASSERT_NO_ERRNO_AND_VALUE(Open(kDevNetTun, O_RDWR));
+  ASSERT_THAT(ioctl(fd.get(), TUNSETIFF, &ifr), SyscallSucceeds());
+  ASSERT_THAT(ioctl(fd.get(), TUNSETPERSIST, 0), SyscallSucceeds());
+
+  // Without persistence, the interface is removed with its last file.
+  fd.reset();
+  EXPECT_THAT(
+      DumpLinkNames(),
+      IsPosixErrorOkAndHolds(::testing::Not(::testing::Contains(kTapName))));
+}
+
+TEST_F(TuntapTest, AttachAsOwnerWithoutCap) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+
+  struct ifreq ifr = {};
+  ifr.ifr_flags = IFF_TUN | IFF_NO_PI;
+  strncpy(ifr.ifr_name, kTunName, IFNAMSIZ);
+
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(Open(kDevNetTun, O_RDWR));
+  ASSERT_THAT(ioctl(fd.get(), TUNSETIFF, &ifr), SyscallSucceeds());
+  ASSERT_THAT(ioctl(fd.get(), TUNSETOWNER, geteuid()), SyscallSucceeds());
+  ASSERT_THAT(ioctl(fd.get(), TUNSETPERSIST, 1), SyscallSucceeds());
+  fd.reset();
+
+  {
+    AutoCapability cap(CAP_NET_ADMIN, false);
+    fd = ASSERT_NO_ERRNO_AND_VALUE(Open(kDevNetTun, O_RDWR));
+    EXPECT_THAT(ioctl(fd.get(), TUNSETIFF, &ifr), SyscallSucceeds());
+  }
+
+  ASSERT_THAT(ioctl(fd.get(), TUNSETPERSIST, 0), SyscallSucceeds());
+}
+
 }  // namespace testing
 }  // namespace gvisor
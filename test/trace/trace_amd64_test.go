@@ -30,6 +30,8 @@ import (
 func extraMatchers(t *testing.T, msgs []test.Message, matchers map[pb.MessageType]*checkers) {
 	// Register functions that verify each available point specific to amd64 architecture.
 	matchers[pb.MessageType_MESSAGE_SYSCALL_FORK] = &checkers{checker: checkSyscallFork}
+	matchers[pb.MessageType_MESSAGE_SYSCALL_IOPL] = &checkers{checker: checkSyscallIopl}
+	matchers[pb.MessageType_MESSAGE_SYSCALL_IOPERM] = &checkers{checker: checkSyscallIoperm}
 }
 
 func checkSyscallSignalfdFlags(flags int32) error {
@@ -49,3 +51,31 @@ func checkSyscallFork(msg test.Message) error {
 	}
 	return nil
 }
+
+func checkSyscallIopl(msg test.Message) error {
+	p := pb.Iopl{}
+	if err := proto.Unmarshal(msg.Msg, &p); err != nil {
+		return err
+	}
+	if err := checkContextData(p.ContextData); err != nil {
+		return err
+	}
+	if want := uint32(3); p.Level != want {
+		return fmt.Errorf("wrong level, want: %d, got: %d", want, p.Level)
+	}
+	return nil
+}
+
+func checkSyscallIoperm(msg test.Message) error {
+	p := pb.Ioperm{}
+	if err := proto.Unmarshal(msg.Msg, &p); err != nil {
+		return err
+	}
+	if err := checkContextData(p.ContextData); err != nil {
+		return err
+	}
+	if p.From != 0x378 || p.Num != 3 || p.TurnOn != 1 {
+		return fmt.Errorf("wrong arguments, want: (0x378, 3, 1), got: (%#x, %d, %d)", p.From, p.Num, p.TurnOn)
+	}
+	return nil
+}
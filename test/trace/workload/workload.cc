@@ -576,6 +576,12 @@ void runVfork() {
   RetryEINTR(waitpid)(pid, nullptr, 0);
 }
 
+// iopl(2) and ioperm(2) are expected to fail, since no I/O ports are
+// emulated in the test.
+void runIopl() { syscall(__NR_iopl, 3); }
+
+void runIoperm() { syscall(__NR_ioperm, 0x378, 3, 1); }
+
 void runSignalfd() {
   sigset_t mask;
   sigemptyset(&mask);
@@ -703,6 +709,8 @@ int main(int argc, char** argv) {
   ::gvisor::testing::runSignalfd();
   ::gvisor::testing::runFork();
   ::gvisor::testing::runVfork();
+  ::gvisor::testing::runIopl();
+  ::gvisor::testing::runIoperm();
 #endif
   // Run chroot at the end since it changes the root for all other tests.
   ::gvisor::testing::runChroot();
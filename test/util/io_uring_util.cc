@@ -102,6 +102,10 @@ int IOUring::Enter(unsigned int to_submit, unsigned int min_complete,
   return IOUringEnter(iouringfd_.get(), to_submit, min_complete, flags, sig);
 }
 
+int IOUring::Register(unsigned int opcode, void *arg, unsigned int nr_args) {
+  return IOUringRegister(iouringfd_.get(), opcode, arg, nr_args);
+}
+
 IOUringCqe *IOUring::get_cqes() { return cqes_; }
 
 IOUringSqe *IOUring::get_sqes() {
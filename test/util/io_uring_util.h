@@ -32,6 +32,7 @@ namespace testing {
 
 #define __NR_io_uring_setup 425
 #define __NR_io_uring_enter 426
+#define __NR_io_uring_register 427
 
 // io_uring_setup(2) flags.
 #define IORING_SETUP_SQPOLL (1U << 1)
@@ -49,6 +50,17 @@ namespace testing {
 // IO_URING operation codes.
 #define IORING_OP_NOP 0
 #define IORING_OP_READV 1
+#define IORING_OP_READ_FIXED 4
+#define IORING_OP_WRITE_FIXED 5
+
+// io_uring_sqe flags.
+#define IOSQE_FIXED_FILE (1U << 0)
+
+// io_uring_register(2) opcodes.
+#define IORING_REGISTER_BUFFERS 0
+#define IORING_UNREGISTER_BUFFERS 1
+#define IORING_REGISTER_FILES 2
+#define IORING_UNREGISTER_FILES 3
 
 #define BLOCK_SZ kPageSize
 
@@ -177,6 +189,7 @@ class IOUring {
   void store_sq_tail(uint32_t sq_tail_val);
   int Enter(unsigned int to_submit, unsigned int min_complete,
             unsigned int flags, sigset_t *sig);
+  int Register(unsigned int opcode, void *arg, unsigned int nr_args);
 
   IOUringCqe *get_cqes();
   IOUringSqe *get_sqes();
@@ -216,6 +229,12 @@ inline int IOUringEnter(unsigned int fd, unsigned int to_submit,
   return syscall(__NR_io_uring_enter, fd, to_submit, min_complete, flags, sig);
 }
 
+// This is a wrapper for the io_uring_register(2) system call.
+inline int IOUringRegister(unsigned int fd, unsigned int opcode, void *arg,
+                           unsigned int nr_args) {
+  return syscall(__NR_io_uring_register, fd, opcode, arg, nr_args);
+}
+
 // Returns a new iouringfd with the given number of entries.
 inline PosixErrorOr<FileDescriptor> NewIOUringFD(uint32_t entries,
                                                  IOUringParams &params) {
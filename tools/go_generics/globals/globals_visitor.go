@@ -108,11 +108,83 @@ func (v *globalsVisitor) visitType(ge ast.Expr) {
 		v.visitFields(e.Results, KindUnknown)
 	case *ast.InterfaceType:
 		v.visitFields(e.Methods, KindUnknown)
+	case *ast.IndexExpr:
+		// Instantiation of a generic type, e.g., List[T].
+		v.visitType(e.X)
+		v.visitType(e.Index)
+	case *ast.IndexListExpr:
+		// Instantiation of a generic type with multiple type arguments,
+		// e.g., Map[K, V].
+		v.visitType(e.X)
+		for _, i := range e.Indices {
+			v.visitType(i)
+		}
+	case *ast.BinaryExpr:
+		// Union in a constraint, e.g., int | T.
+		if e.Op != token.OR {
+			v.unexpected(e.Pos())
+		}
+		v.visitType(e.X)
+		v.visitType(e.Y)
+	case *ast.UnaryExpr:
+		// Underlying type term in a constraint, e.g., ~int.
+		if e.Op != token.TILDE {
+			v.unexpected(e.Pos())
+		}
+		v.visitType(e.X)
 	default:
 		v.unexpected(ge.Pos())
 	}
 }
 
+// visitTypeParams adds the type parameters in l to the current scope and
+// visits their constraints. All parameters are added before any constraint is
+// visited since constraints may refer to any parameter in the list, e.g.,
+// [T any, PT interface{ *T }].
+func (v *globalsVisitor) visitTypeParams(l *ast.FieldList) {
+	if l == nil {
+		return
+	}
+
+	for _, f := range l.List {
+		for _, n := range f.Names {
+			v.scope.add(n.Name, KindTypeParameter, n.Pos())
+		}
+	}
+	for _, f := range l.List {
+		v.visitType(f.Type)
+	}
+}
+
+// addReceiverTypeParams adds to the current scope the type parameters declared
+// by the receiver of a method of a generic type, e.g., T and U in
+// func (m *Map[T, U]) f().
+func (v *globalsVisitor) addReceiverTypeParams(l *ast.FieldList) {
+	if l == nil || len(l.List) != 1 {
+		return
+	}
+
+	var params []ast.Expr
+	switch e := unparen(l.List[0].Type).(type) {
+	case *ast.StarExpr:
+		switch e := unparen(e.X).(type) {
+		case *ast.IndexExpr:
+			params = []ast.Expr{e.Index}
+		case *ast.IndexListExpr:
+			params = e.Indices
+		}
+	case *ast.IndexExpr:
+		params = []ast.Expr{e.Index}
+	case *ast.IndexListExpr:
+		params = e.Indices
+	}
+	for _, p := range params {
+		if id, ok := p.(*ast.Ident); ok && id.Name != "_" {
+			v.scope.add(id.Name, KindTypeParameter, id.Pos())
+		}
+	}
+}
+
 // visitFields visits all fields, and add symbols if kind isn't KindUnknown.
 func (v *globalsVisitor) visitFields(l *ast.FieldList, kind SymKind) {
 	if l == nil {
@@ -151,7 +223,10 @@ func (v *globalsVisitor) visitGenDecl(d *ast.GenDecl) {
 			if v.scope.isGlobal() {
 				v.f(s.Name, KindType)
 			}
+			v.pushScope()
+			v.visitTypeParams(s.TypeParams)
 			v.visitType(s.Type)
+			v.popScope()
 		}
 	case token.CONST, token.VAR:
 		kind := KindConst
@@ -191,7 +266,7 @@ func (v *globalsVisitor) isViableType(expr ast.Expr) bool {
 		// have to check if it resolves to a type; if the symbol is not
 		// known, we'll claim it's viable as a type.
 		s := v.scope.deepLookup(e.Name)
-		return s == nil || s.kind == KindType
+		return s == nil || s.kind == KindType || s.kind == KindTypeParameter
 
 	case *ast.ChanType, *ast.ArrayType, *ast.MapType, *ast.StructType, *ast.FuncType, *ast.InterfaceType, *ast.Ellipsis:
 		// This covers the following cases:
@@ -240,6 +315,17 @@ func (v *globalsVisitor) isViableType(expr ast.Expr) bool {
 		// T is.
 		return v.isViableType(e.X)
 
+	case *ast.IndexExpr:
+		// This covers the instantiation of a generic type, T[U]. The
+		// expression is a viable type if T is; otherwise, it is an index
+		// expression or the instantiation of a generic function.
+		return v.isViableType(e.X)
+
+	case *ast.IndexListExpr:
+		// This covers the T[U, V] case, which is only viable as a type if
+		// T is.
+		return v.isViableType(e.X)
+
 	default:
 		return false
 	}
@@ -302,7 +388,22 @@ func (v *globalsVisitor) visitExpr(ge ast.Expr) {
 
 	case *ast.IndexExpr:
 		v.visitExpr(e.X)
-		v.visitExpr(e.Index)
+		// The index may be a type argument, e.g., in f[[]T](x). Type
+		// names are visited the same way as expressions, but type
+		// literals must be visited as types.
+		switch e.Index.(type) {
+		case *ast.ArrayType, *ast.ChanType, *ast.FuncType, *ast.InterfaceType, *ast.MapType, *ast.StructType:
+			v.visitType(e.Index)
+		default:
+			v.visitExpr(e.Index)
+		}
+
+	case *ast.IndexListExpr:
+		// Instantiation of a generic function, e.g., f[T, U].
+		v.visitExpr(e.X)
+		for _, i := range e.Indices {
+			v.visitType(i)
+		}
 
 	case *ast.KeyValueExpr:
 		v.visitExpr(e.Value)
@@ -352,6 +453,17 @@ func GetIdent(expr ast.Expr) *ast.Ident {
 	}
 }
 
+// unparen returns expr with any enclosing parentheses removed.
+func unparen(expr ast.Expr) ast.Expr {
+	for {
+		p, ok := expr.(*ast.ParenExpr)
+		if !ok {
+			return expr
+		}
+		expr = p.X
+	}
+}
+
 // visitStmt visits all nodes of a statement, and reports any globals that it
 // finds. It also adds to the current scope new symbols defined/declared.
 func (v *globalsVisitor) visitStmt(gs ast.Stmt) {
@@ -508,6 +620,8 @@ func (v *globalsVisitor) visitFuncDecl(d *ast.FuncDecl) {
 	}
 
 	v.pushScope()
+	v.addReceiverTypeParams(d.Recv)
+	v.visitTypeParams(d.Type.TypeParams)
 	v.visitFields(d.Recv, KindReceiver)
 	v.visitFields(d.Type.Params, KindParameter)
 	v.visitFields(d.Type.Results, KindResult)
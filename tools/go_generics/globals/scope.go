@@ -34,6 +34,7 @@ const (
 	KindParameter
 	KindResult
 	KindTag
+	KindTypeParameter
 )
 
 type symbol struct {
@@ -82,6 +82,11 @@
 // Note that the second call to g() kept "b" as an argument because it refers to
 // the local variable "b".
 //
+// Templates may also use Go generics. Type parameters are scoped like locals,
+// so a type parameter named like a renamed type (e.g., T in func f[T any]())
+// is left untouched, and instantiations such as List[T] are renamed like any
+// other type expression.
+//
 // Note that go_generics can handle anonymous fields with renamed types if
 // -anon is passed in, however it does not perform strict checking on parameter
 // types that share the same name as the global type and therefore will rename
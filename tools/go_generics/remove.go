@@ -35,6 +35,12 @@ func isTypeOrPointerToType(set typeSet, expr ast.Expr, starCount int) bool {
 		return isTypeOrPointerToType(set, e.X, starCount+1)
 	case *ast.ParenExpr:
 		return isTypeOrPointerToType(set, e.X, starCount)
+	case *ast.IndexExpr:
+		// Receiver of a generic type, e.g., T[U].
+		return isTypeOrPointerToType(set, e.X, starCount)
+	case *ast.IndexListExpr:
+		// Receiver of a generic type, e.g., T[U, V].
+		return isTypeOrPointerToType(set, e.X, starCount)
 	default:
 		return false
 	}
@@ -43,7 +49,8 @@ func isTypeOrPointerToType(set typeSet, expr ast.Expr, starCount int) bool {
 // isMethodOf determines if the given function declaration is a method of one
 // of the types in the provided type set. To do that, it checks if the function
 // has a receiver and that its type is either T or *T, where T is a type that
-// exists in the set. This is per the spec:
+// exists in the set, possibly instantiated with the receiver type parameters.
+// This is per the spec:
 //
 // That parameter section must declare a single parameter, the receiver. Its
 // type must be of the form T or *T (possibly using parentheses) where T is a
@@ -0,0 +1,82 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+type T int
+
+type number interface {
+	~int | ~int64 | T
+}
+
+// list mixes the template type T with a real type parameter E.
+type list[E any] struct {
+	elems []E
+	tag   T
+}
+
+func (l *list[E]) push(e E) {
+	l.elems = append(l.elems, e)
+}
+
+func (l list[_]) tagged() T {
+	return l.tag
+}
+
+type pair[K comparable, V any] struct {
+	key K
+	val V
+}
+
+func (p *pair[K, V]) get() (K, V) {
+	return p.key, p.val
+}
+
+// T here is a type parameter that shadows the template type.
+func identity[T any](x T) T {
+	var y T = x
+	return y
+}
+
+func sum[N number](ns ...N) N {
+	var s N
+	for _, n := range ns {
+		s += n
+	}
+	return s
+}
+
+func mapKeys[K comparable, V any, M ~map[K]V](m M) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func f() {
+	l := list[T]{}
+	l.push(1)
+	_ = list[[]T]{}
+	_ = identity[T](2)
+	_ = identity(l.tagged())
+	_ = sum[T](1, 2)
+	_ = sum([]T{1, 2}...)
+	_ = mapKeys[T, pair[T, T]](nil)
+	_ = mapKeys[T, T, map[T]T](nil)
+	p := &pair[string, T]{key: "a"}
+	_, _ = p.get()
+	var n []list[T]
+	_ = n[0]
+}
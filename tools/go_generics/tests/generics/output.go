@@ -0,0 +1,80 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+type numberNew interface {
+	~int | ~int64 | Q
+}
+
+// list mixes the template type T with a real type parameter E.
+type listNew[E any] struct {
+	elems []E
+	tag   Q
+}
+
+func (l *listNew[E]) push(e E) {
+	l.elems = append(l.elems, e)
+}
+
+func (l listNew[_]) tagged() Q {
+	return l.tag
+}
+
+type pairNew[K comparable, V any] struct {
+	key K
+	val V
+}
+
+func (p *pairNew[K, V]) get() (K, V) {
+	return p.key, p.val
+}
+
+// T here is a type parameter that shadows the template type.
+func identityNew[T any](x T) T {
+	var y T = x
+	return y
+}
+
+func sumNew[N numberNew](ns ...N) N {
+	var s N
+	for _, n := range ns {
+		s += n
+	}
+	return s
+}
+
+func mapKeysNew[K comparable, V any, M ~map[K]V](m M) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func fNew() {
+	l := listNew[Q]{}
+	l.push(1)
+	_ = listNew[[]Q]{}
+	_ = identityNew[Q](2)
+	_ = identityNew(l.tagged())
+	_ = sumNew[Q](1, 2)
+	_ = sumNew([]Q{1, 2}...)
+	_ = mapKeysNew[Q, pairNew[Q, Q]](nil)
+	_ = mapKeysNew[Q, Q, map[Q]Q](nil)
+	p := &pairNew[string, Q]{key: "a"}
+	_, _ = p.get()
+	var n []listNew[Q]
+	_ = n[0]
+}